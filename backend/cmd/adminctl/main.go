@@ -0,0 +1,342 @@
+// Command adminctl administers the panel from the command line, for when the web interface cannot
+// be reached: creating the first admin, resetting a password, running migrations and pruning old
+// records. It loads the server's configuration and connects to the same database and Redis.
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+
+	"go.uber.org/zap"
+	"golang.org/x/term"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/api"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/database"
+	"github.com/mynodecp/mynodecp/backend/internal/jobs"
+	"github.com/mynodecp/mynodecp/backend/pkg/logger"
+)
+
+// command is a subcommand of adminctl
+type command struct {
+	summary string
+	run     func(ctx context.Context, args []string) error
+}
+
+var commands = map[string]command{
+	"create-admin":   {"Create an account with the admin role", createAdmin},
+	"reset-password": {"Set a new password for an account and revoke its sessions", resetPassword},
+	"migrate":        {"Run the database migrations", migrate},
+	"prune":          {"Purge records past their retention, as the server's cleanup jobs do", prune},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+	name := os.Args[1]
+	if name == "help" || name == "-h" || name == "--help" {
+		usage(os.Stdout)
+		return
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "adminctl: unknown command %q\n\n", name)
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := cmd.run(ctx, os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "adminctl %s: %s\n", name, err)
+		os.Exit(1)
+	}
+}
+
+// usage lists the subcommands
+func usage(w io.Writer) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintln(w, "Usage: adminctl <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-16s %s\n", name, commands[name].summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run adminctl <command> -h for the flags of a command.")
+}
+
+// createAdmin creates an account with the admin role
+func createAdmin(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("create-admin", flag.ExitOnError)
+	username := flags.String("username", "", "username of the account (required)")
+	email := flags.String("email", "", "email address of the account (required)")
+	flags.Parse(args)
+
+	if *username == "" || *email == "" {
+		flags.Usage()
+		return errors.New("-username and -email are required")
+	}
+	password, err := readPassword(os.Stdin, os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	app, err := open()
+	if err != nil {
+		return err
+	}
+	defer app.close()
+
+	user, err := app.services.User.CreateAdmin(ctx, *username, *email, password)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created admin %s (%s)\n", user.Username, user.ID)
+	return nil
+}
+
+// resetPassword sets a new password for an account
+func resetPassword(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("reset-password", flag.ExitOnError)
+	identity := flags.String("user", "", "username or email address of the account (required)")
+	flags.Parse(args)
+
+	if *identity == "" {
+		flags.Usage()
+		return errors.New("-user is required")
+	}
+	password, err := readPassword(os.Stdin, os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	app, err := open()
+	if err != nil {
+		return err
+	}
+	defer app.close()
+
+	user, err := app.services.User.ResetPassword(ctx, *identity, password)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Reset the password of %s (%s); its sessions were revoked\n", user.Username, user.ID)
+	return nil
+}
+
+// migrate runs the database migrations the server runs on startup
+func migrate(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	flags.Parse(args)
+
+	cfg, log, err := load()
+	if err != nil {
+		return err
+	}
+	defer log.Sync()
+
+	db, err := openDatabase(cfg, log)
+	if err != nil {
+		return err
+	}
+	defer closeDatabase(db)
+
+	if err := database.Migrate(db.WithContext(ctx)); err != nil {
+		return fmt.Errorf("failed to run migrations: %w", err)
+	}
+
+	fmt.Println("Migrations complete")
+	return nil
+}
+
+// prune runs the server's purge jobs once, with the configured retention policies
+func prune(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("prune", flag.ExitOnError)
+	only := flags.String("jobs", "", "comma-separated purge jobs to run; all of them when omitted")
+	list := flags.Bool("list", false, "list the purge jobs enabled by the configuration and exit")
+	flags.Parse(args)
+
+	app, err := open()
+	if err != nil {
+		return err
+	}
+	defer app.close()
+
+	scheduler := jobs.NewScheduler(app.logger, app.config.Jobs.OverdueIntervals)
+	api.RegisterJobs(scheduler, app.services, app.config, app.logger)
+
+	var names []string
+	for _, status := range scheduler.Statuses() {
+		if strings.HasPrefix(status.Name, "purge_") {
+			names = append(names, status.Name)
+		}
+	}
+
+	if *list {
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return nil
+	}
+
+	if *only != "" {
+		enabled := make(map[string]bool, len(names))
+		for _, name := range names {
+			enabled[name] = true
+		}
+		names = nil
+		for _, name := range strings.Split(*only, ",") {
+			name = strings.TrimSpace(name)
+			if !enabled[name] {
+				return fmt.Errorf("%q is not an enabled purge job; see prune -list", name)
+			}
+			names = append(names, name)
+		}
+	}
+
+	failed := 0
+	for _, name := range names {
+		if err := scheduler.RunNow(ctx, name); err != nil {
+			fmt.Printf("%s: failed: %v\n", name, err)
+			failed++
+			continue
+		}
+		fmt.Printf("%s: done\n", name)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d purge jobs failed", failed, len(names))
+	}
+	return nil
+}
+
+// readPassword prompts on w for a password and reads it from in without echoing it, twice so a
+// typo does not lock the account out. When in is not a terminal, as in scripts, the password is
+// its first line. Passwords are never taken as flags, where they would end up in the shell
+// history and the process list.
+func readPassword(in *os.File, w io.Writer) (string, error) {
+	fd := int(in.Fd())
+	if !term.IsTerminal(fd) {
+		return readPasswordLine(in)
+	}
+
+	fmt.Fprint(w, "Password: ")
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(w)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	if len(password) == 0 {
+		return "", errors.New("no password given")
+	}
+
+	fmt.Fprint(w, "Repeat password: ")
+	repeated, err := term.ReadPassword(fd)
+	fmt.Fprintln(w)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	if string(repeated) != string(password) {
+		return "", errors.New("passwords do not match")
+	}
+	return string(password), nil
+}
+
+// readPasswordLine reads a password from the first line of r
+func readPasswordLine(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		return "", errors.New("no password given")
+	}
+	return password, nil
+}
+
+// panel holds the services of the panel, set up as the server sets them up
+type panel struct {
+	config   *config.Config
+	logger   *zap.Logger
+	services *api.Services
+	close    func()
+}
+
+// load reads the server's configuration
+func load() (*config.Config, *zap.Logger, error) {
+	log := logger.New()
+
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	// Secret columns are encrypted at rest once a key is configured
+	if err := api.UseEncryptionKeys(cfg.Security, log); err != nil {
+		return nil, nil, err
+	}
+
+	return cfg, log, nil
+}
+
+// openDatabase connects to the panel's database
+func openDatabase(cfg *config.Config, log *zap.Logger) (*gorm.DB, error) {
+	db, err := database.New(cfg.Database, log)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	return db, nil
+}
+
+// closeDatabase closes the connections of a database
+func closeDatabase(db *gorm.DB) {
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
+
+// open connects to the database and Redis and sets up the panel's services the way the server
+// does. Nothing runs in the background: mail queued by a command is delivered by the server.
+func open() (*panel, error) {
+	cfg, log, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	opened, err := api.OpenPanel(cfg, log)
+	if err != nil {
+		log.Sync()
+		return nil, err
+	}
+
+	return &panel{
+		config:   cfg,
+		logger:   log,
+		services: opened.Services,
+		close: func() {
+			opened.Close()
+			log.Sync()
+		},
+	}, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"io"
+	"os"
+	"testing"
+)
+
+// pipeInput returns the read end of a pipe holding input, which is not a terminal
+func pipeInput(t *testing.T, input string) *os.File {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("pipe: %v", err)
+	}
+	t.Cleanup(func() { r.Close() })
+	if _, err := io.WriteString(w, input); err != nil {
+		t.Fatalf("write input: %v", err)
+	}
+	w.Close()
+	return r
+}
+
+func TestReadPasswordFromScript(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"first line", "s3cret pass\nignored\n", "s3cret pass", false},
+		{"without newline", "s3cret", "s3cret", false},
+		{"windows line ending", "s3cret\r\n", "s3cret", false},
+		{"empty line", "\n", "", true},
+		{"no input", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readPassword(pipeInput(t, tt.input), io.Discard)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readPassword() error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("readPassword() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
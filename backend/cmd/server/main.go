@@ -17,10 +17,12 @@ import (
 	"google.golang.org/grpc/credentials/insecure"
 
 	"github.com/mynodecp/mynodecp/backend/internal/api"
-	"github.com/mynodecp/mynodecp/backend/internal/auth"
 	"github.com/mynodecp/mynodecp/backend/internal/config"
 	"github.com/mynodecp/mynodecp/backend/internal/database"
+	"github.com/mynodecp/mynodecp/backend/internal/jobs"
 	"github.com/mynodecp/mynodecp/backend/internal/middleware"
+	"github.com/mynodecp/mynodecp/backend/internal/ratelimit"
+	"github.com/mynodecp/mynodecp/backend/internal/tracing"
 	"github.com/mynodecp/mynodecp/backend/pkg/logger"
 )
 
@@ -35,33 +37,41 @@ func main() {
 		log.Fatal("Failed to load configuration", zap.Error(err))
 	}
 
-	// Initialize database
-	db, err := database.New(cfg.Database)
+	// Export spans when a collector is configured
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing, cfg.Server.Version)
 	if err != nil {
-		log.Fatal("Failed to connect to database", zap.Error(err))
+		log.Fatal("Failed to configure tracing", zap.Error(err))
 	}
 
-	// Run migrations
-	if err := database.Migrate(db); err != nil {
-		log.Fatal("Failed to run migrations", zap.Error(err))
+	// Secret columns are encrypted at rest once a key is configured
+	if err := api.UseEncryptionKeys(cfg.Security, log); err != nil {
+		log.Fatal("Failed to configure encryption", zap.Error(err))
 	}
 
-	// Initialize Redis
-	redisClient, err := database.NewRedis(cfg.Redis)
+	// Connect to the database, Redis and the managed database server and set up the services,
+	// as adminctl does
+	panel, err := api.OpenPanel(cfg, log)
 	if err != nil {
-		log.Fatal("Failed to connect to Redis", zap.Error(err))
+		log.Fatal("Failed to set up the panel", zap.Error(err))
 	}
+	redisClient, mailSender := panel.Redis, panel.Mailer
+	apiServices := panel.Services
+	authService := apiServices.Auth
 
-	// Initialize auth service
-	authService := auth.NewService(db, redisClient, cfg.Auth)
+	// Run migrations
+	if err := database.Migrate(panel.DB); err != nil {
+		log.Fatal("Failed to run migrations", zap.Error(err))
+	}
 
-	// Initialize API services
-	apiServices := api.NewServices(db, redisClient, authService, log)
+	// Seed built-in DNS templates
+	if err := apiServices.DNS.SeedDNSTemplates(context.Background()); err != nil {
+		log.Warn("Failed to seed DNS templates", zap.Error(err))
+	}
 
 	// Start gRPC server
 	grpcServer := grpc.NewServer(
-		grpc.UnaryInterceptor(middleware.UnaryServerInterceptor(log)),
-		grpc.StreamInterceptor(middleware.StreamServerInterceptor(log)),
+		grpc.ChainUnaryInterceptor(middleware.UnaryTracingInterceptor(), middleware.UnaryServerInterceptor(log)),
+		grpc.ChainStreamInterceptor(middleware.StreamTracingInterceptor(), middleware.StreamServerInterceptor(log)),
 	)
 
 	// Register gRPC services
@@ -85,6 +95,25 @@ func main() {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	// Periodic maintenance: quota checks and purging of expired or old records, delivery of
+	// queued mail, and the rate limiters' syncs registered below. Started once all are registered.
+	scheduler := jobs.NewScheduler(log, cfg.Jobs.OverdueIntervals)
+	api.RegisterJobs(scheduler, apiServices, cfg, log)
+	scheduler.Register("email_outbox", cfg.Mail.PollInterval, mailSender.ProcessOutbox)
+
+	// Rate limit per client IP, sharing counts with other instances through Redis
+	var limiter *ratelimit.Limiter
+	if cfg.Security.RateLimitEnabled {
+		limiter = ratelimit.New(ratelimit.NewRedisStore(redisClient), ratelimit.Options{
+			Limit:        int64(cfg.Security.RateLimitRequests),
+			Window:       cfg.Security.RateLimitWindow,
+			SyncInterval: cfg.Security.RateLimitSyncInterval,
+			FailClosed:   cfg.Security.RateLimitFailClosed,
+			WarnPercent:  cfg.Security.RateLimitWarnPercent,
+		}, log)
+		scheduler.Register("rate_limit_sync", cfg.Security.RateLimitSyncInterval, limiter.Sync)
+	}
+
 	mux := runtime.NewServeMux()
 
 	// Register gRPC-Gateway handlers
@@ -99,11 +128,17 @@ func main() {
 	}
 
 	router := gin.New()
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatal("Invalid trusted proxies", zap.Error(err))
+	}
 	router.Use(gin.Recovery())
-	router.Use(middleware.CORS())
-	router.Use(middleware.RateLimit())
-	router.Use(middleware.Security())
-	router.Use(middleware.Logging(log))
+	router.Use(middleware.RequestID())
+	router.Use(middleware.Tracing())
+	router.Use(middleware.CORS(cfg.Security))
+	router.Use(middleware.RateLimit(limiter))
+	router.Use(middleware.Security(cfg.Security))
+	router.Use(middleware.Logging(log, cfg.Logging))
+	router.Use(middleware.DryRun(cfg.Hosting.DryRun, authService))
 
 	// Health check endpoint
 	router.GET("/health", func(c *gin.Context) {
@@ -114,6 +149,419 @@ func main() {
 		})
 	})
 
+	// Public status page, with its own stricter per-IP limit since anyone can poll it
+	if cfg.Status.Enabled {
+		statusLimiter := ratelimit.New(ratelimit.NewRedisStore(redisClient), ratelimit.Options{
+			Limit:        int64(cfg.Status.RateLimit),
+			Window:       time.Minute,
+			SyncInterval: cfg.Security.RateLimitSyncInterval,
+			FailClosed:   cfg.Security.RateLimitFailClosed,
+			WarnPercent:  cfg.Security.RateLimitWarnPercent,
+			Prefix:       "status:",
+		}, log)
+		scheduler.Register("status_rate_limit_sync", cfg.Security.RateLimitSyncInterval, statusLimiter.Sync)
+
+		router.GET("/status", middleware.RateLimit(statusLimiter), api.PublicStatus(apiServices.Status))
+	}
+	router.PUT("/admin/status/notice",
+		middleware.AuthMiddleware(authService),
+		middleware.RequireRole("admin"),
+		middleware.ValidateJSON(api.StatusNoticeSchema),
+		api.SetStatusNotice(apiServices.Status),
+	)
+
+	// Machine-readable API contract
+	router.GET("/openapi.json", api.OpenAPISpec(api.Spec(cfg.Server.Version)))
+
+	// CSP violation reports sent by browsers, and their review for admins
+	router.POST("/csp-report", middleware.CSPReport(redisClient, log))
+	router.GET("/admin/csp-violations",
+		middleware.AuthMiddleware(authService),
+		middleware.RequireRole("admin"),
+		middleware.CSPViolations(redisClient),
+	)
+
+	// Audit and security log review and export for compliance
+	auditRoutes := router.Group("/admin/audit",
+		middleware.AuthMiddleware(authService),
+		middleware.RequireRole("admin"),
+	)
+	auditRoutes.GET("", api.AuditLogs(apiServices.Audit))
+	auditRoutes.GET("/export", api.AuditExport(apiServices.Audit))
+	auditRoutes.GET("/changes/:resource/:id", api.ResourceHistory(apiServices.Audit))
+
+	// A user's own security log: audit entries and security events about their account and resources
+	router.GET("/audit", middleware.AuthMiddleware(authService), api.AuditLogs(apiServices.Audit))
+
+	// Self-service registration, subject to auth.registration_mode
+	router.POST("/auth/register", middleware.ValidateJSON(api.RegisterSchema), api.Register(authService))
+
+	// Invite codes for invite-only registration
+	inviteRoutes := router.Group("/admin/invites",
+		middleware.AuthMiddleware(authService),
+		middleware.RequireRole("admin"),
+	)
+	inviteRoutes.GET("", api.Invites(authService))
+	inviteRoutes.POST("", middleware.ValidateJSON(api.InviteSchema), api.CreateInvite(authService))
+	inviteRoutes.DELETE("/:id", api.RevokeInvite(authService))
+
+	// Quota alerts for the current cycle
+	router.GET("/quota-alerts", middleware.AuthMiddleware(authService), api.QuotaAlerts(apiServices.Quota))
+
+	// Quotas new domains receive under the caller's package
+	router.GET("/domains/quota-defaults", middleware.AuthMiddleware(authService), api.DomainQuotaDefaults(apiServices.Domain))
+
+	// Storage used by the caller's databases against the database quotas
+	router.GET("/databases/usage", middleware.AuthMiddleware(authService), api.DatabaseUsage(apiServices.Database))
+
+	// New domains with the quotas of the caller's package
+	router.POST("/domains",
+		middleware.AuthMiddleware(authService),
+		middleware.ValidateJSON(api.DomainCreateSchema),
+		api.CreateDomain(apiServices.Domain),
+	)
+
+	// New domains set up like an existing one
+	router.POST("/domains/:id/clone",
+		middleware.AuthMiddleware(authService),
+		middleware.ValidateJSON(api.DomainCloneSchema),
+		api.CloneDomain(apiServices.Domain),
+	)
+
+	// Domains moved to a new name along with their files, DNS records and configuration
+	router.POST("/domains/:id/rename",
+		middleware.AuthMiddleware(authService),
+		middleware.ValidateJSON(api.DomainRenameSchema),
+		api.RenameDomain(apiServices.Domain),
+	)
+
+	// Single resources with ETags; updates honor If-Match
+	router.GET("/domains/:id", middleware.AuthMiddleware(authService), api.GetDomain(apiServices.Domain))
+	router.GET("/users/:id", middleware.AuthMiddleware(authService), api.GetUser(apiServices.User))
+	router.GET("/dns-records/:id",
+		middleware.AuthMiddleware(authService),
+		api.RequireCapability(apiServices.User, "dns"),
+		api.GetDNSRecord(apiServices.DNS),
+	)
+	router.PUT("/dns-records/:id",
+		middleware.AuthMiddleware(authService),
+		api.RequireCapability(apiServices.User, "dns"),
+		middleware.ValidateJSON(api.DNSRecordUpdateSchema),
+		api.UpdateDNSRecord(apiServices.DNS),
+	)
+
+	router.POST("/domains/:id/dns-records",
+		middleware.AuthMiddleware(authService),
+		api.RequireCapability(apiServices.User, "dns"),
+		middleware.ValidateJSON(api.DNSRecordCreateSchema),
+		api.CreateDNSRecord(apiServices.DNS),
+	)
+
+	// Bulk deletion of DNS records, previewed first and confirmed with the preview's token
+	router.POST("/domains/:id/dns-records/bulk-delete",
+		middleware.AuthMiddleware(authService),
+		api.RequireCapability(apiServices.User, "dns"),
+		middleware.ValidateJSON(api.DNSBulkDeleteSchema),
+		api.BulkDeleteDNSRecords(apiServices.DNS),
+	)
+
+	// Zone-wide DNS settings; the SOA record and its serial are managed by the panel
+	router.PUT("/domains/:id/dns-settings",
+		middleware.AuthMiddleware(authService),
+		api.RequireCapability(apiServices.User, "dns"),
+		middleware.ValidateJSON(api.DNSSettingsSchema),
+		api.SetDNSSettings(apiServices.DNS, apiServices.Domain),
+	)
+
+	// Health of a domain's whole zone, such as after a migration: record syntax, delegation,
+	// propagation and mail records
+	router.GET("/domains/:id/dns-health",
+		middleware.AuthMiddleware(authService),
+		api.RequireCapability(apiServices.User, "dns"),
+		api.DNSZoneHealth(apiServices.DNS),
+	)
+
+	// Several DNS, redirect and domain changes applied together in one transaction
+	router.POST("/batch",
+		middleware.AuthMiddleware(authService),
+		middleware.ValidateJSON(api.BatchSchema),
+		api.RunBatch(apiServices.Batch, apiServices.User),
+	)
+
+	// Certificate uploads in PEM, DER or PKCS#12, checked and converted to PEM
+	router.POST("/ssl/inspect",
+		middleware.AuthMiddleware(authService),
+		middleware.ValidateJSON(api.CertificateUploadSchema),
+		api.InspectCertificate(apiServices.SSL),
+	)
+
+	// Certificates from the ACME server; wildcards are validated with TXT records in the domain's zone
+	router.POST("/domains/:id/certificates",
+		middleware.AuthMiddleware(authService),
+		middleware.ValidateJSON(api.CertificateRequestSchema),
+		api.GenerateCertificate(apiServices.SSL),
+	)
+
+	// Resumable uploads into domain directories, sent in chunks continuing at the upload's offset
+	router.POST("/domains/:id/uploads",
+		middleware.AuthMiddleware(authService),
+		middleware.ValidateJSON(api.UploadSchema),
+		api.CreateUpload(apiServices.File),
+	)
+	router.GET("/uploads/:id", middleware.AuthMiddleware(authService), api.GetUpload(apiServices.File))
+	router.PATCH("/uploads/:id", middleware.AuthMiddleware(authService), api.WriteUploadChunk(apiServices.File))
+	router.DELETE("/uploads/:id", middleware.AuthMiddleware(authService), api.CancelUpload(apiServices.File))
+
+	// Per-domain PHP handler, extensions and error handling, and opcache resets
+	router.PUT("/domains/:id/php",
+		middleware.AuthMiddleware(authService),
+		middleware.ValidateJSON(api.DomainPHPSchema),
+		api.SetDomainPHP(apiServices.Domain),
+	)
+	router.POST("/domains/:id/php/opcache-reset",
+		middleware.AuthMiddleware(authService),
+		api.ResetDomainOpcache(apiServices.Domain),
+	)
+
+	// Features available to an account, derived from its roles' permissions and package
+	router.GET("/users/:id/capabilities", middleware.AuthMiddleware(authService), api.UserCapabilities(apiServices.User))
+
+	// IP ranges and countries an account can log in from
+	router.PUT("/users/:id/login-restrictions",
+		middleware.AuthMiddleware(authService),
+		middleware.ValidateJSON(api.LoginRestrictionsSchema),
+		api.SetLoginRestrictions(apiServices.User),
+	)
+
+	// Users changing their own password; sessions whose password expired can only do this
+	router.PUT("/users/:id/password",
+		middleware.AuthMiddleware(authService),
+		middleware.ValidateJSON(api.PasswordChangeSchema),
+		api.ChangePassword(apiServices.User),
+	)
+
+	// How an account gets each type of notification: emailed at once, in a digest, or only in the panel
+	router.GET("/users/:id/notification-preferences", middleware.AuthMiddleware(authService), api.NotificationPreferences(apiServices.Notification))
+	router.PUT("/users/:id/notification-preferences",
+		middleware.AuthMiddleware(authService),
+		middleware.ValidateJSON(api.NotificationPreferencesSchema),
+		api.SetNotificationPreferences(apiServices.Notification),
+	)
+
+	// The caller's recent notifications
+	router.GET("/notifications", middleware.AuthMiddleware(authService), api.Notifications(apiServices.Notification))
+
+	// The caller's encrypted vault of passwords and notes
+	router.GET("/vault", middleware.AuthMiddleware(authService), api.VaultItems(apiServices.Vault))
+	router.POST("/vault",
+		middleware.AuthMiddleware(authService),
+		middleware.ValidateJSON(api.VaultItemSchema),
+		api.CreateVaultItem(apiServices.Vault),
+	)
+	router.GET("/vault/:id", middleware.AuthMiddleware(authService), api.GetVaultItem(apiServices.Vault))
+	router.PUT("/vault/:id",
+		middleware.AuthMiddleware(authService),
+		middleware.ValidateJSON(api.VaultItemUpdateSchema),
+		api.UpdateVaultItem(apiServices.Vault),
+	)
+	router.DELETE("/vault/:id", middleware.AuthMiddleware(authService), api.DeleteVaultItem(apiServices.Vault))
+
+	// Abuse reports from users, or from anyone when the public form is enabled, with its own
+	// per-IP limit; and their triage by admins
+	router.POST("/abuse-reports",
+		middleware.AuthMiddleware(authService),
+		middleware.ValidateJSON(api.AbuseReportSchema),
+		api.SubmitAbuseReport(apiServices.Abuse),
+	)
+	if cfg.Abuse.PublicForm {
+		abuseLimiter := ratelimit.New(ratelimit.NewRedisStore(redisClient), ratelimit.Options{
+			Limit:        int64(cfg.Abuse.RateLimit),
+			Window:       time.Hour,
+			SyncInterval: cfg.Security.RateLimitSyncInterval,
+			FailClosed:   cfg.Security.RateLimitFailClosed,
+			WarnPercent:  cfg.Security.RateLimitWarnPercent,
+			Prefix:       "abuse:",
+		}, log)
+		scheduler.Register("abuse_rate_limit_sync", cfg.Security.RateLimitSyncInterval, abuseLimiter.Sync)
+
+		router.POST("/abuse-reports/public",
+			middleware.RateLimit(abuseLimiter),
+			middleware.ValidateJSON(api.AbuseReportSchema),
+			api.SubmitAbuseReport(apiServices.Abuse),
+		)
+	}
+	router.GET("/admin/abuse-reports",
+		middleware.AuthMiddleware(authService),
+		middleware.RequireRole("admin"),
+		api.AbuseReports(apiServices.Abuse),
+	)
+	router.GET("/admin/abuse-reports/:id",
+		middleware.AuthMiddleware(authService),
+		middleware.RequireRole("admin"),
+		api.GetAbuseReport(apiServices.Abuse),
+	)
+	router.PUT("/admin/abuse-reports/:id",
+		middleware.AuthMiddleware(authService),
+		middleware.RequireRole("admin"),
+		middleware.ValidateJSON(api.AbuseReportUpdateSchema),
+		api.UpdateAbuseReport(apiServices.Abuse),
+	)
+	router.POST("/admin/abuse-reports/:id/suspend",
+		middleware.AuthMiddleware(authService),
+		middleware.RequireRole("admin"),
+		middleware.ValidateJSON(api.AbuseSuspendSchema),
+		api.SuspendAbuseTarget(apiServices.Abuse),
+	)
+
+	// Monthly usage of an account's domains, from the usage snapshots, for billing systems
+	router.GET("/users/:id/usage/export", middleware.AuthMiddleware(authService), api.UsageExport(apiServices.User))
+
+	// Usage counts, and a warning while the domain's PHP version is deprecated
+	router.GET("/domains/:id/stats", middleware.AuthMiddleware(authService), api.DomainStats(apiServices.Domain))
+
+	// Traffic reports from the hourly samples of the access logs
+	router.GET("/domains/:id/traffic", middleware.AuthMiddleware(authService), api.DomainTraffic(apiServices.Domain))
+
+	// Allocated quotas against server capacity, for the overcommit guard
+	router.GET("/admin/capacity",
+		middleware.AuthMiddleware(authService),
+		middleware.RequireRole("admin"),
+		api.CapacityReport(apiServices.Domain),
+	)
+
+	// Domains taken offline for non-payment or abuse, keeping their data
+	router.POST("/admin/domains/:id/suspend",
+		middleware.AuthMiddleware(authService),
+		middleware.RequireRole("admin"),
+		middleware.ValidateJSON(api.DomainSuspendSchema),
+		api.SuspendDomain(apiServices.Domain),
+	)
+	router.POST("/admin/domains/:id/unsuspend",
+		middleware.AuthMiddleware(authService),
+		middleware.RequireRole("admin"),
+		api.UnsuspendDomain(apiServices.Domain),
+	)
+
+	// Per-domain URL redirects
+	router.GET("/domains/:id/redirects", middleware.AuthMiddleware(authService), api.DomainRedirects(apiServices.Domain))
+	router.POST("/domains/:id/redirects",
+		middleware.AuthMiddleware(authService),
+		middleware.ValidateJSON(api.RedirectSchema),
+		api.CreateRedirect(apiServices.Domain),
+	)
+	router.PUT("/redirects/:id",
+		middleware.AuthMiddleware(authService),
+		middleware.ValidateJSON(api.RedirectSchema),
+		api.UpdateRedirect(apiServices.Domain),
+	)
+	router.DELETE("/redirects/:id", middleware.AuthMiddleware(authService), api.DeleteRedirect(apiServices.Domain))
+
+	// Password protected directories (HTTP basic auth) and their logins
+	router.GET("/domains/:id/protected-directories", middleware.AuthMiddleware(authService), api.ProtectedDirectories(apiServices.Domain))
+	router.POST("/domains/:id/protected-directories",
+		middleware.AuthMiddleware(authService),
+		middleware.ValidateJSON(api.ProtectedDirectorySchema),
+		api.CreateProtectedDirectory(apiServices.Domain),
+	)
+	router.PUT("/protected-directories/:id",
+		middleware.AuthMiddleware(authService),
+		middleware.ValidateJSON(api.ProtectedDirectorySchema),
+		api.UpdateProtectedDirectory(apiServices.Domain),
+	)
+	router.DELETE("/protected-directories/:id", middleware.AuthMiddleware(authService), api.DeleteProtectedDirectory(apiServices.Domain))
+	router.POST("/protected-directories/:id/users",
+		middleware.AuthMiddleware(authService),
+		middleware.ValidateJSON(api.DirectoryUserSchema),
+		api.AddDirectoryUser(apiServices.Domain),
+	)
+	router.PUT("/directory-users/:id/password",
+		middleware.AuthMiddleware(authService),
+		middleware.ValidateJSON(api.DirectoryPasswordSchema),
+		api.SetDirectoryUserPassword(apiServices.Domain),
+	)
+	router.DELETE("/directory-users/:id", middleware.AuthMiddleware(authService), api.DeleteDirectoryUser(apiServices.Domain))
+
+	// Outbound send limits: the MTA reports sends, owners see counts, admins lift suspensions.
+	// The MTA also asks before accepting mail for a mailbox, which may be suspended or over quota.
+	if cfg.Mail.SendHookSecret != "" {
+		router.POST("/mail/send-hook", middleware.ValidateJSON(api.MailSendHookSchema), api.MailSendHook(apiServices.Email, cfg.Mail.SendHookSecret))
+		router.POST("/mail/delivery-hook", middleware.ValidateJSON(api.MailDeliveryHookSchema), api.MailDeliveryHook(apiServices.Email, cfg.Mail.SendHookSecret))
+	}
+	router.GET("/domains/:id/send-counts",
+		middleware.AuthMiddleware(authService),
+		api.RequireCapability(apiServices.User, "email"),
+		api.MailSendCounts(apiServices.Email),
+	)
+
+	// Whether a domain can send and receive mail: its MX, SPF, DKIM and DMARC records, blocklists
+	// and a test message
+	router.POST("/domains/:id/mail/deliverability-test",
+		middleware.AuthMiddleware(authService),
+		api.RequireCapability(apiServices.User, "email"),
+		api.MailDeliverabilityTest(apiServices.Email),
+	)
+
+	router.POST("/admin/mail/:kind/:id/resume-sending",
+		middleware.AuthMiddleware(authService),
+		middleware.RequireRole("admin"),
+		api.MailResumeSending(apiServices.Email),
+	)
+
+	// Failed logins reported by the MTA, FTP and SSH servers feed the same IP bans as the panel's
+	if cfg.Auth.AuthFailureHookSecret != "" {
+		router.POST("/security/auth-failures",
+			middleware.ValidateJSON(api.AuthFailureSchema),
+			api.AuthFailureHook(authService, cfg.Auth.AuthFailureHookSecret),
+		)
+	}
+	router.GET("/admin/attack-sources",
+		middleware.AuthMiddleware(authService),
+		middleware.RequireRole("admin"),
+		api.AttackSources(authService),
+	)
+	router.DELETE("/admin/ip-bans/:ip",
+		middleware.AuthMiddleware(authService),
+		middleware.RequireRole("admin"),
+		api.UnbanIP(authService),
+	)
+
+	// One-click phpMyAdmin/Adminer login: owners get a single-use link, which the signon script
+	// redeems for the database and user to sign in as
+	if cfg.Hosting.DBAdminURL != "" {
+		router.POST("/databases/:id/sso",
+			middleware.AuthMiddleware(authService),
+			api.RequireCapability(apiServices.User, "databases"),
+			api.DatabaseSSOLink(apiServices.Database),
+		)
+		router.POST("/db-admin/sso/redeem", api.DatabaseSSORedeem(apiServices.Database, cfg.Hosting.DBAdminSecret))
+	}
+
+	// Managed services looked after by the watchdog, and its restart attempts
+	router.GET("/admin/services",
+		middleware.AuthMiddleware(authService),
+		middleware.RequireRole("admin"),
+		api.ServiceStatuses(apiServices.System),
+	)
+	router.GET("/admin/services/restarts",
+		middleware.AuthMiddleware(authService),
+		middleware.RequireRole("admin"),
+		api.ServiceRestarts(apiServices.System),
+	)
+
+	// Maintenance job status and manual runs
+	jobRoutes := router.Group("/admin/jobs",
+		middleware.AuthMiddleware(authService),
+		middleware.RequireRole("admin"),
+	)
+	jobRoutes.GET("", api.JobStatuses(scheduler))
+	jobRoutes.POST("/:name/run", api.RunJob(scheduler))
+	if cfg.Jobs.MetricsToken != "" {
+		router.GET("/metrics", api.JobMetrics(scheduler, cfg.Jobs.MetricsToken))
+	}
+
+	// Mail client autoconfiguration (Thunderbird autoconfig, Outlook autodiscover)
+	api.RegisterMailAutoconfig(router, apiServices.Email)
+
 	// Serve static files for frontend
 	router.Static("/static", "./frontend/dist/assets")
 	router.StaticFile("/", "./frontend/dist/index.html")
@@ -121,6 +569,8 @@ func main() {
 	// Mount gRPC-Gateway
 	router.Any("/api/*path", gin.WrapH(mux))
 
+	go scheduler.Run(ctx)
+
 	// Create HTTP server
 	httpServer := &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.Server.HTTPPort),
@@ -157,13 +607,13 @@ func main() {
 	// Shutdown gRPC server
 	grpcServer.GracefulStop()
 
-	// Close database connections
-	if sqlDB, err := db.DB(); err == nil {
-		sqlDB.Close()
+	// Flush the spans not yet exported
+	if err := shutdownTracing(ctx); err != nil {
+		log.Error("Failed to flush traces", zap.Error(err))
 	}
 
-	// Close Redis connection
-	redisClient.Close()
+	// Close database and Redis connections
+	panel.Close()
 
 	log.Info("Servers shutdown complete")
 }
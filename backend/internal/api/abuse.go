@@ -0,0 +1,142 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/pagination"
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+// abuseReportUpdateRequest is the body of triaging an abuse report
+type abuseReportUpdateRequest struct {
+	Status string `json:"status"`
+	Note   string `json:"note"`
+}
+
+// abuseSuspendRequest is the body of suspending what an abuse report is about
+type abuseSuspendRequest struct {
+	Scope string `json:"scope"`
+	Note  string `json:"note"`
+}
+
+// SubmitAbuseReport files an abuse report, from a logged-in user or, with the public form
+// enabled, from anyone
+func SubmitAbuseReport(abuse *services.AbuseService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req services.AbuseReportRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var reporter *uuid.UUID
+		if userID, _, ok := caller(c); ok {
+			reporter = &userID
+		}
+
+		report, err := abuse.SubmitReport(serviceContext(c), req, reporter, c.ClientIP())
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"id": report.ID, "status": report.Status})
+	}
+}
+
+// AbuseReports lists abuse reports newest first, optionally filtered by status
+func AbuseReports(abuse *services.AbuseService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := pagination.DefaultLimit
+		if value := c.Query("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 || parsed > pagination.MaxLimit {
+				writeError(c, apperrors.InvalidCode("limit", "field.maximum", map[string]string{"max": strconv.Itoa(pagination.MaxLimit)}))
+				return
+			}
+			limit = parsed
+		}
+
+		reports, next, err := abuse.Reports(serviceContext(c), c.Query("status"), c.Query("cursor"), limit)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"items": reports, "next_cursor": next})
+	}
+}
+
+// GetAbuseReport returns an abuse report with its triage notes
+func GetAbuseReport(abuse *services.AbuseService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		reportID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid abuse report id"})
+			return
+		}
+
+		report, err := abuse.GetReport(serviceContext(c), reportID)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// UpdateAbuseReport moves an abuse report to another status or adds a note to it
+func UpdateAbuseReport(abuse *services.AbuseService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		reportID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid abuse report id"})
+			return
+		}
+
+		var req abuseReportUpdateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		report, err := abuse.UpdateReport(serviceContext(c), reportID, req.Status, req.Note)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
+
+// SuspendAbuseTarget suspends the domain an abuse report is about, or its owner's account
+func SuspendAbuseTarget(abuse *services.AbuseService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		reportID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid abuse report id"})
+			return
+		}
+
+		var req abuseSuspendRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		report, err := abuse.SuspendTarget(serviceContext(c), reportID, req.Scope, req.Note)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
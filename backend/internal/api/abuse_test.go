@@ -0,0 +1,109 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/runner"
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+func TestAbuseReportHandlers(t *testing.T) {
+	db := newTestDB(t)
+	dir := t.TempDir()
+	cfg := config.HostingConfig{VhostDir: filepath.Join(dir, "vhosts"), SuspendedPageDir: filepath.Join(dir, "suspended"), LogDir: filepath.Join(dir, "logs"), AccessLogFormat: "combined"}
+	domains := services.NewDomainService(db, nil, zap.NewNop(), cfg, nil, nil, runner.NewFake())
+	users := services.NewUserService(db, nil, zap.NewNop(), nil, nil, domains, nil, config.AuthConfig{}, nil)
+	abuse := services.NewAbuseService(db, zap.NewNop(), config.AbuseConfig{Categories: []string{"spam", "phishing"}}, domains, users, nil)
+	owner := &models.User{Username: "owner", Email: "owner@example.net", PasswordHash: "x", IsActive: true}
+	db.Create(owner)
+	domain := &models.Domain{UserID: owner.ID, Name: "shop.example", DocumentRoot: "/var/www/shop.example/public_html", IsActive: true}
+	db.Create(domain)
+	adminID := uuid.New()
+
+	// Intake from the public form, without a user
+	submit := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/abuse-reports/public", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = "198.51.100.7:40000"
+		recorder := httptest.NewRecorder()
+		router := gin.New()
+		router.POST("/abuse-reports/public", SubmitAbuseReport(abuse))
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+	w := submit(`{"reporter_email":"abuse@isp.example","target":"https://shop.example/login","category":"phishing","description":"Fake bank login"}`)
+	var created struct {
+		ID     uuid.UUID `json:"id"`
+		Status string    `json:"status"`
+	}
+	if w.Code != http.StatusCreated || json.Unmarshal(w.Body.Bytes(), &created) != nil || created.Status != "open" {
+		t.Fatalf("submit = %d: %s", w.Code, w.Body.String())
+	}
+	if w := submit(`{"target":"shop.example","category":"phishing","description":"No contact"}`); w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "reporter_email") {
+		t.Errorf("anonymous report without contact = %d: %s", w.Code, w.Body.String())
+	}
+	reportPath := "/admin/abuse-reports/" + created.ID.String()
+
+	// Triage by an admin
+	send := func(method, path, route, body string, handler func(*services.AbuseService) gin.HandlerFunc) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return serveRoute(route, handler(abuse), req, adminID, "admin")
+	}
+	w = send(http.MethodGet, "/admin/abuse-reports?status=open", "/admin/abuse-reports", "", AbuseReports)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), created.ID.String()) || !strings.Contains(w.Body.String(), `"reporter_ip":"198.51.100.7"`) {
+		t.Errorf("list = %d: %s", w.Code, w.Body.String())
+	}
+	w = send(http.MethodPost, reportPath+"/suspend", "/admin/abuse-reports/:id/suspend", `{"scope":"domain","note":"Phishing confirmed"}`, SuspendAbuseTarget)
+	var report models.AbuseReport
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &report) != nil || report.Status != "investigating" || len(report.Notes) != 1 || report.Notes[0].Action != "domain_suspend" {
+		t.Fatalf("suspend = %d: %s", w.Code, w.Body.String())
+	}
+	var suspended models.Domain
+	db.First(&suspended, "id = ?", domain.ID)
+	if suspended.SuspendedAt == nil {
+		t.Error("domain not suspended")
+	}
+	w = send(http.MethodPut, reportPath, "/admin/abuse-reports/:id", `{"status":"resolved","note":"Page removed"}`, UpdateAbuseReport)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"resolved"`) {
+		t.Errorf("resolve = %d: %s", w.Code, w.Body.String())
+	}
+	report = models.AbuseReport{}
+	w = send(http.MethodGet, reportPath, "/admin/abuse-reports/:id", "", GetAbuseReport)
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &report) != nil || len(report.Notes) != 2 || report.Notes[1].ToStatus != "resolved" {
+		t.Errorf("get = %d: %s", w.Code, w.Body.String())
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		route   string
+		body    string
+		handler func(*services.AbuseService) gin.HandlerFunc
+		want    int
+	}{
+		{"malformed id", http.MethodGet, "/admin/abuse-reports/42", "/admin/abuse-reports/:id", "", GetAbuseReport, http.StatusBadRequest},
+		{"unknown report", http.MethodGet, "/admin/abuse-reports/" + uuid.NewString(), "/admin/abuse-reports/:id", "", GetAbuseReport, http.StatusNotFound},
+		{"disallowed transition", http.MethodPut, reportPath, "/admin/abuse-reports/:id", `{"status":"open"}`, UpdateAbuseReport, http.StatusConflict},
+		{"unknown scope", http.MethodPost, reportPath + "/suspend", "/admin/abuse-reports/:id/suspend", `{"scope":"server"}`, SuspendAbuseTarget, http.StatusUnprocessableEntity},
+		{"unknown status filter", http.MethodGet, "/admin/abuse-reports?status=closed", "/admin/abuse-reports", "", AbuseReports, http.StatusUnprocessableEntity},
+		{"limit out of range", http.MethodGet, "/admin/abuse-reports?limit=0", "/admin/abuse-reports", "", AbuseReports, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		if w := send(tt.method, tt.path, tt.route, tt.body, tt.handler); w.Code != tt.want {
+			t.Errorf("%s = %d, want %d: %s", tt.name, w.Code, tt.want, w.Body.String())
+		}
+	}
+}
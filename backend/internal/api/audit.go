@@ -0,0 +1,137 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+// AuditLogs lists audit logs or security events newest first. The response carries
+// next_cursor, which is passed back as the cursor parameter to fetch the following page.
+// Non-admins only get the rows about themselves and their resources.
+func AuditLogs(audit *services.AuditService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter, err := parseAuditFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		items, next, err := audit.Query(serviceContext(c), filter, c.Query("cursor"), filter.Limit)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"items": items, "next_cursor": next})
+	}
+}
+
+// AuditExport streams audit logs or security events as a CSV or JSON download.
+// Query parameters mirror services.AuditFilter; from and to are RFC 3339 timestamps.
+func AuditExport(audit *services.AuditService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter, err := parseAuditFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		format := c.DefaultQuery("format", services.ExportFormatCSV)
+		contentType := "text/csv; charset=utf-8"
+		if format == services.ExportFormatJSON {
+			contentType = "application/json"
+		}
+
+		kind := filter.Kind
+		if kind == "" {
+			kind = services.AuditKindAudit
+		}
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-log-%s.%s"`, kind, time.Now().UTC().Format("20060102-150405"), format))
+
+		if err := audit.Export(serviceContext(c), c.Writer, filter, format); err != nil {
+			// Validation fails before anything is written; later failures can only truncate the download
+			if !c.Writer.Written() {
+				c.Writer.Header().Del("Content-Type")
+				c.Writer.Header().Del("Content-Disposition")
+				writeError(c, err)
+				return
+			}
+			c.Error(err)
+		}
+	}
+}
+
+// ResourceHistory lists the recorded changes of one resource, newest first. The resource path
+// parameter is the table name, such as domains or dns_records.
+func ResourceHistory(audit *services.AuditService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := 0
+		if value := c.Query("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+				return
+			}
+			limit = parsed
+		}
+
+		entries, err := audit.ResourceHistory(c.Request.Context(), c.Param("resource"), c.Param("id"), limit)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"changes": entries})
+	}
+}
+
+func parseAuditFilter(c *gin.Context) (services.AuditFilter, error) {
+	filter := services.AuditFilter{
+		Kind:     c.Query("kind"),
+		Action:   c.Query("action"),
+		Resource: c.Query("resource"),
+		Severity: c.Query("severity"),
+	}
+
+	if value := c.Query("user_id"); value != "" {
+		userID, err := uuid.Parse(value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid user_id")
+		}
+		filter.UserID = &userID
+	}
+	if value := c.Query("success"); value != "" {
+		success, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid success")
+		}
+		filter.Success = &success
+	}
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid limit")
+		}
+		filter.Limit = limit
+	}
+
+	for name, target := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := c.Query(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s, expected an RFC 3339 timestamp", name)
+			}
+			*target = parsed
+		}
+	}
+
+	return filter, nil
+}
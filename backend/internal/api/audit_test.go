@@ -0,0 +1,43 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+func TestAuditLogsScope(t *testing.T) {
+	db := newTestDB(t)
+	audit := services.NewAuditService(db, nil, zap.NewNop())
+	owner := &models.User{Username: "owner", Email: "owner@example.net", PasswordHash: "x", IsActive: true}
+	other := &models.User{Username: "other", Email: "other@example.net", PasswordHash: "x", IsActive: true}
+	db.Create(owner)
+	db.Create(other)
+	db.Create(&models.AuditLog{UserID: &owner.ID, Action: "create_domain", Resource: "domain", Success: true})
+	db.Create(&models.AuditLog{UserID: &other.ID, Action: "delete_domain", Resource: "domain", Success: true})
+
+	list := func(query string, user *models.User, role string) (*httptest.ResponseRecorder, []models.AuditLog) {
+		w := serve(AuditLogs(audit), httptest.NewRequest(http.MethodGet, "/audit-logs"+query, nil), user.ID, role)
+		var body struct {
+			Items []models.AuditLog `json:"items"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return w, body.Items
+	}
+
+	if w, items := list("", owner, "user"); w.Code != http.StatusOK || len(items) != 1 || items[0].Action != "create_domain" {
+		t.Errorf("owner's log = %d: %s", w.Code, w.Body.String())
+	}
+	if w, items := list("", owner, "admin"); w.Code != http.StatusOK || len(items) != 2 {
+		t.Errorf("admin's log = %d: %s", w.Code, w.Body.String())
+	}
+	if w, _ := list("?user_id="+other.ID.String(), owner, "user"); w.Code != http.StatusForbidden {
+		t.Errorf("another user's log = %d, want 403", w.Code)
+	}
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/xml"
+	"io"
+	"net"
+	"net/http"
+	"net/mail"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+// maxAutodiscoverBody bounds the request Outlook posts to the autodiscover endpoint
+const maxAutodiscoverBody = 16 << 10
+
+// RegisterMailAutoconfig mounts the endpoints mail clients query to discover server settings
+func RegisterMailAutoconfig(router gin.IRouter, email *services.EmailService) {
+	autoconfig := MailAutoconfig(email)
+	router.GET("/mail/config-v1.1.xml", autoconfig)
+	router.GET("/.well-known/autoconfig/mail/config-v1.1.xml", autoconfig)
+
+	autodiscover := MailAutodiscover(email)
+	router.POST("/autodiscover/autodiscover.xml", autodiscover)
+	router.POST("/Autodiscover/Autodiscover.xml", autodiscover)
+}
+
+// MailAutoconfig serves the Thunderbird autoconfig document. The domain comes from the
+// emailaddress parameter or else from the autoconfig.<domain> host the client contacted.
+func MailAutoconfig(email *services.EmailService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		domain := ""
+		if address := c.Query("emailaddress"); strings.Contains(address, "@") {
+			domain = address[strings.LastIndex(address, "@")+1:]
+		} else {
+			host := c.Request.Host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			domain = strings.TrimPrefix(host, "autoconfig.")
+		}
+
+		body, err := email.AutoconfigXML(c.Request.Context(), domain)
+		if err != nil {
+			c.Status(apperrors.HTTPStatus(err))
+			return
+		}
+
+		c.Data(http.StatusOK, "application/xml; charset=utf-8", body)
+	}
+}
+
+// MailAutodiscover answers Outlook autodiscover requests
+func MailAutodiscover(email *services.EmailService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req services.AutodiscoverRequest
+		if err := xml.NewDecoder(io.LimitReader(c.Request.Body, maxAutodiscoverBody)).Decode(&req); err != nil {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+
+		address, err := mail.ParseAddress(strings.TrimSpace(req.Request.EMailAddress))
+		if err != nil {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+
+		body, err := email.AutodiscoverXML(c.Request.Context(), address.Address)
+		if err != nil {
+			c.Status(apperrors.HTTPStatus(err))
+			return
+		}
+
+		c.Data(http.StatusOK, "application/xml; charset=utf-8", body)
+	}
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/middleware"
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+// batchRequest is the body of running a batch
+type batchRequest struct {
+	Operations      []services.BatchOperation `json:"operations"`
+	ContinueOnError bool                      `json:"continue_on_error"`
+}
+
+// batchOperationResponse is the outcome of one step of a batch, with a failed step's error in
+// the caller's language
+type batchOperationResponse struct {
+	services.BatchOperationResult
+	Error  string            `json:"error,omitempty"`
+	Code   string            `json:"code,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// RunBatch runs several DNS, redirect and domain changes in one transaction. A committed batch
+// answers 200 with every step's outcome; a rolled back one answers with the status of the step
+// that failed, and the same body.
+func RunBatch(batch *services.BatchService, users *services.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, ok := caller(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		var req batchRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// DNS steps need the feature their own routes require
+		for _, operation := range req.Operations {
+			if !strings.HasPrefix(operation.Op, "dns.") {
+				continue
+			}
+			allowed, err := users.HasCapability(serviceContext(c), userID, "dns")
+			if err != nil {
+				writeError(c, err)
+				return
+			}
+			if !allowed {
+				writeError(c, apperrors.PermissionDenied("dns"))
+				return
+			}
+			break
+		}
+
+		result, err := batch.Run(serviceContext(c), req.Operations, req.ContinueOnError)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		locale := middleware.Locale(c)
+		operations := make([]batchOperationResponse, len(result.Operations))
+		for i, outcome := range result.Operations {
+			operations[i] = batchOperationResponse{BatchOperationResult: outcome}
+			if outcome.Err == nil {
+				continue
+			}
+			operations[i].Code, operations[i].Error = apperrors.Message(outcome.Err, locale)
+			if validation, ok := apperrors.AsValidation(outcome.Err); ok {
+				operations[i].Errors = validation.Localize(locale)
+			}
+		}
+		body := gin.H{"committed": result.Committed, "operations": operations}
+
+		if !result.Committed {
+			failed := result.Failed()
+			body["error"] = operations[failed.Index].Error
+			if code := operations[failed.Index].Code; code != "" {
+				body["code"] = code
+			}
+			c.JSON(apperrors.HTTPStatus(failed.Err), body)
+			return
+		}
+
+		c.JSON(http.StatusOK, body)
+	}
+}
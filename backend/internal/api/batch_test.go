@@ -0,0 +1,77 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/runner"
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+func TestRunBatch(t *testing.T) {
+	db := newTestDB(t)
+	cfg := config.HostingConfig{DNSDefaultTTL: 3600, ZoneDir: t.TempDir()}
+	domains := services.NewDomainService(db, nil, zap.NewNop(), cfg, nil, nil, runner.NewFake())
+	dns := services.NewDNSService(db, nil, zap.NewNop(), cfg, nil, domains)
+	users := services.NewUserService(db, nil, zap.NewNop(), nil, nil, domains, nil, config.AuthConfig{}, nil)
+	batch := services.NewBatchService(db, zap.NewNop(), domains, dns)
+
+	owner := &models.User{Username: "owner", Email: "owner@example.net", PasswordHash: "x", IsActive: true}
+	db.Create(owner)
+	domain := &models.Domain{UserID: owner.ID, Name: "example.com", DocumentRoot: "/var/www/example.com/public_html", IsActive: true, CustomDNSEnabled: true}
+	db.Create(domain)
+
+	run := func(body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		req := httptest.NewRequest(http.MethodPost, "/batch", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := serve(RunBatch(batch, users), req, owner.ID, "user")
+		var response map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w, response
+	}
+	create := func(name, value string) string {
+		return `{"op":"dns.create","id":"` + domain.ID.String() + `","params":{"type":"A","name":"` + name + `","value":"` + value + `","ttl":3600}}`
+	}
+	count := func() int64 {
+		var n int64
+		db.Model(&models.DNSRecord{}).Where("domain_id = ?", domain.ID).Count(&n)
+		return n
+	}
+
+	w, body := run(`{"operations":[` + create("www", "192.0.2.1") + `,` + create("bad", "nope") + `]}`)
+	if w.Code != http.StatusUnprocessableEntity || body["committed"] != false || body["error"] == "" {
+		t.Errorf("rolled back batch = %d: %s", w.Code, w.Body.String())
+	}
+	operations, _ := body["operations"].([]interface{})
+	if len(operations) != 2 {
+		t.Fatalf("operations = %v", body["operations"])
+	}
+	if failed := operations[1].(map[string]interface{}); failed["status"] != "failed" || failed["errors"] == nil {
+		t.Errorf("failed step = %v", failed)
+	}
+	if count() != 0 {
+		t.Errorf("%d records left by a rolled back batch", count())
+	}
+
+	w, body = run(`{"continue_on_error":true,"operations":[` + create("www", "192.0.2.1") + `,` + create("bad", "nope") + `]}`)
+	if w.Code != http.StatusOK || body["committed"] != true || count() != 1 {
+		t.Errorf("batch continuing on error = %d with %d records: %s", w.Code, count(), w.Body.String())
+	}
+
+	// DNS steps need the DNS feature
+	db.Create(&models.Permission{Name: "dns.manage", DisplayName: "Manage DNS", Resource: "dns", Action: "manage"})
+	if w, _ := run(`{"operations":[` + create("shop", "192.0.2.2") + `]}`); w.Code != http.StatusForbidden {
+		t.Errorf("batch without the DNS feature = %d, want 403", w.Code)
+	}
+
+	if w, _ := run(`{"operations":"all"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("malformed body = %d, want 400", w.Code)
+	}
+}
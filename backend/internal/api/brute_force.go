@@ -0,0 +1,92 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/auth"
+)
+
+// AuthFailureHook is called by the MTA, FTP and SSH servers for every failed login. The failure
+// counts towards banning the IP, as failed logins to the panel do, and the answer tells the
+// server whether the IP is banned. The servers authenticate with the shared secret as a bearer
+// token.
+func AuthFailureHook(authService *auth.Service, secret string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provided := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if secret == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(secret)) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid hook secret"})
+			return
+		}
+
+		var req struct {
+			Source    string `json:"source"`
+			IPAddress string `json:"ip_address"`
+			Identity  string `json:"identity"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		standing, err := authService.RecordAuthFailure(c.Request.Context(), req.Source, req.IPAddress, req.Identity)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, standing)
+	}
+}
+
+// AttackSources lists the IPs failed logins came from, over the panel, mail, FTP and SSH, with
+// the banned ones (admin). since is a duration such as 24h, the default.
+func AttackSources(authService *auth.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		window := 24 * time.Hour
+		if value := c.Query("since"); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil || parsed <= 0 {
+				writeError(c, apperrors.InvalidCode("since", "field.format", nil))
+				return
+			}
+			window = parsed
+		}
+
+		limit := 100
+		if value := c.Query("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 || parsed > 1000 {
+				writeError(c, apperrors.InvalidCode("limit", "field.maximum", map[string]string{"max": "1000"}))
+				return
+			}
+			limit = parsed
+		}
+
+		attacks, err := authService.AttackSources(serviceContext(c), time.Now().Add(-window), limit)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"attack_sources": attacks})
+	}
+}
+
+// UnbanIP lifts the ban of an IP (admin)
+func UnbanIP(authService *auth.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := authService.UnbanIP(serviceContext(c), c.Param("ip")); err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
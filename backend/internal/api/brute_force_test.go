@@ -0,0 +1,91 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/auth"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+)
+
+func TestAuthFailureHook(t *testing.T) {
+	db := newTestDB(t)
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	authService := auth.NewService(db, client, zap.NewNop(), config.AuthConfig{BanThreshold: 2, BanWindow: 15 * time.Minute, BanDuration: time.Hour}, nil, nil, nil, nil)
+	admin := uuid.New()
+
+	report := func(secret, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/hooks/auth-failure", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return serve(AuthFailureHook(authService, secret), req, uuid.Nil)
+	}
+	failure := `{"source":"ftp","ip_address":"198.51.100.7","identity":"web"}`
+
+	if w := report("", "", failure); w.Code != http.StatusUnauthorized {
+		t.Errorf("hook without a secret configured = %d, want 401", w.Code)
+	}
+	if w := report("hook-secret", "wrong", failure); w.Code != http.StatusUnauthorized {
+		t.Errorf("hook with the wrong secret = %d, want 401", w.Code)
+	}
+	if w := report("hook-secret", "hook-secret", `{"source":`); w.Code != http.StatusBadRequest {
+		t.Errorf("malformed report = %d, want 400", w.Code)
+	}
+	if w := report("hook-secret", "hook-secret", `{"source":"imap","ip_address":"198.51.100.7"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("report of an unknown source = %d, want 422", w.Code)
+	}
+
+	var standing auth.IPBan
+	w := report("hook-secret", "hook-secret", failure)
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &standing) != nil || standing.Banned || standing.Failures != 1 {
+		t.Fatalf("first failure = %d: %s", w.Code, w.Body.String())
+	}
+	w = report("hook-secret", "hook-secret", failure)
+	if json.Unmarshal(w.Body.Bytes(), &standing) != nil || !standing.Banned || standing.BannedUntil == nil {
+		t.Fatalf("second failure = %d: %s", w.Code, w.Body.String())
+	}
+
+	// The ban shows among the attack sources until an admin lifts it
+	w = serve(AttackSources(authService), httptest.NewRequest(http.MethodGet, "/security/attack-sources", nil), admin, "admin")
+	var body struct {
+		AttackSources []auth.AttackSource `json:"attack_sources"`
+	}
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &body) != nil || len(body.AttackSources) != 1 {
+		t.Fatalf("attack sources = %d: %s", w.Code, w.Body.String())
+	}
+	if source := body.AttackSources[0]; source.IPAddress != "198.51.100.7" || source.Failures["ftp"] != 2 || source.BannedUntil == nil {
+		t.Errorf("attack source = %+v", source)
+	}
+	for _, query := range []string{"since=yesterday", "since=-1h", "limit=0", "limit=1001"} {
+		req := httptest.NewRequest(http.MethodGet, "/security/attack-sources?"+query, nil)
+		if w := serve(AttackSources(authService), req, admin, "admin"); w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("attack sources with %s = %d, want 422", query, w.Code)
+		}
+	}
+
+	unban := func(ip string) int {
+		req := httptest.NewRequest(http.MethodDelete, "/security/ip-bans/"+ip, nil)
+		return serveRoute("/security/ip-bans/:ip", UnbanIP(authService), req, admin, "admin").Code
+	}
+	if code := unban("198.51.100.7"); code != http.StatusNoContent {
+		t.Errorf("unban = %d, want 204", code)
+	}
+	if code := unban("198.51.100.7"); code != http.StatusNotFound {
+		t.Errorf("second unban = %d, want 404", code)
+	}
+	if authService.IPBannedUntil(context.Background(), "198.51.100.7") != nil {
+		t.Error("IP still banned")
+	}
+}
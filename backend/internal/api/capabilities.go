@@ -0,0 +1,68 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+// UserCapabilities returns the features available to an account, for the account itself or an
+// admin
+func UserCapabilities(users *services.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+
+		callerID, isAdmin, ok := caller(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+		if !isAdmin && userID != callerID {
+			writeError(c, apperrors.PermissionDenied("user"))
+			return
+		}
+
+		capabilities, err := users.GetCapabilities(serviceContext(c), userID)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, capabilities)
+	}
+}
+
+// RequireCapability rejects requests from users the feature is not available to, by the same
+// rules GetCapabilities reports to the UI. It runs after AuthMiddleware.
+func RequireCapability(users *services.UserService, feature string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, ok := caller(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			c.Abort()
+			return
+		}
+
+		allowed, err := users.HasCapability(serviceContext(c), userID, feature)
+		if err != nil {
+			writeError(c, err)
+			c.Abort()
+			return
+		}
+		if !allowed {
+			writeError(c, apperrors.PermissionDenied(feature))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/runner"
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+func TestUserCapabilities(t *testing.T) {
+	db := newTestDB(t)
+	domains := services.NewDomainService(db, nil, zap.NewNop(), config.HostingConfig{}, nil, nil, runner.NewFake())
+	users := services.NewUserService(db, nil, zap.NewNop(), nil, nil, domains, nil, config.AuthConfig{}, nil)
+	user := &models.User{Username: "owner", Email: "owner@example.net", PasswordHash: "x", IsActive: true}
+	db.Create(user)
+	db.Create(&models.Permission{Name: "email.manage", DisplayName: "Manage email", Resource: "email", Action: "manage"})
+	path := "/users/" + user.ID.String() + "/capabilities"
+	route := "/users/:id/capabilities"
+
+	w := serveRoute(route, UserCapabilities(users), httptest.NewRequest(http.MethodGet, path, nil), user.ID, "user")
+	var capabilities services.Capabilities
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &capabilities) != nil {
+		t.Fatalf("own capabilities = %d: %s", w.Code, w.Body.String())
+	}
+	if capabilities.Features["email"] || !capabilities.Features["dns"] {
+		t.Errorf("features = %v", capabilities.Features)
+	}
+
+	if w := serveRoute(route, UserCapabilities(users), httptest.NewRequest(http.MethodGet, path, nil), uuid.New(), "user"); w.Code != http.StatusForbidden {
+		t.Errorf("another user's capabilities = %d, want 403", w.Code)
+	}
+	if w := serveRoute(route, UserCapabilities(users), httptest.NewRequest(http.MethodGet, path, nil), uuid.New(), "admin"); w.Code != http.StatusOK {
+		t.Errorf("admin reading capabilities = %d, want 200", w.Code)
+	}
+	if w := serveRoute(route, UserCapabilities(users), httptest.NewRequest(http.MethodGet, "/users/nope/capabilities", nil), user.ID, "user"); w.Code != http.StatusBadRequest {
+		t.Errorf("malformed id = %d, want 400", w.Code)
+	}
+}
+
+func TestRequireCapability(t *testing.T) {
+	db := newTestDB(t)
+	domains := services.NewDomainService(db, nil, zap.NewNop(), config.HostingConfig{}, nil, nil, runner.NewFake())
+	users := services.NewUserService(db, nil, zap.NewNop(), nil, nil, domains, nil, config.AuthConfig{}, nil)
+	user := &models.User{Username: "owner", Email: "owner@example.net", PasswordHash: "x", IsActive: true}
+	db.Create(user)
+	db.Create(&models.Permission{Name: "email.manage", DisplayName: "Manage email", Resource: "email", Action: "manage"})
+
+	tests := []struct {
+		feature string
+		want    int
+	}{
+		{"dns", http.StatusNoContent},
+		{"email", http.StatusForbidden},
+		{"system", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		chain := func(c *gin.Context) {
+			RequireCapability(users, tt.feature)(c)
+			if !c.IsAborted() {
+				c.Status(http.StatusNoContent)
+			}
+		}
+		if w := serve(chain, httptest.NewRequest(http.MethodGet, "/feature", nil), user.ID, "user"); w.Code != tt.want {
+			t.Errorf("%s = %d, want %d", tt.feature, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// caller returns the authenticated user set by the auth middleware and whether they are an admin
+func caller(c *gin.Context) (uuid.UUID, bool, bool) {
+	value, _ := c.Get("user_id")
+	userID, ok := value.(uuid.UUID)
+	if !ok {
+		return uuid.Nil, false, false
+	}
+
+	roles, _ := c.Get("roles")
+	userRoles, _ := roles.([]string)
+	for _, role := range userRoles {
+		if role == "admin" {
+			return userID, true, true
+		}
+	}
+	return userID, false, true
+}
+
+// serviceContext carries the authenticated user from the gin context into the request context,
+// where services look for it the same way as under the gRPC auth interceptor
+func serviceContext(c *gin.Context) context.Context {
+	ctx := c.Request.Context()
+	for _, key := range []string{"user_id", "username", "email", "roles", "session_id", "locale", "dry_run"} {
+		if value, ok := c.Get(key); ok {
+			ctx = context.WithValue(ctx, key, value)
+		}
+	}
+	return ctx
+}
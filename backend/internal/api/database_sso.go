@@ -0,0 +1,66 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+// DatabaseSSOLink returns a single-use link that signs the caller into phpMyAdmin or Adminer as
+// the user of one of their databases
+func DatabaseSSOLink(databases *services.DatabaseService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		databaseID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid database id"})
+			return
+		}
+
+		link, err := databases.GetSSOURL(serviceContext(c), databaseID)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, gin.H{"url": link})
+	}
+}
+
+// DatabaseSSORedeem lets the phpMyAdmin/Adminer signon script exchange a single-use token for the
+// database and user to sign in as. The script authenticates with the shared secret as a bearer token.
+func DatabaseSSORedeem(databases *services.DatabaseService, secret string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provided := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if secret == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(secret)) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid signon secret"})
+			return
+		}
+
+		var req struct {
+			Token string `json:"token" form:"token" binding:"required"`
+		}
+		if err := c.ShouldBind(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		session, err := databases.RedeemSSOToken(c.Request.Context(), req.Token)
+		if errors.Is(err, services.ErrSSOTokenInvalid) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to redeem token"})
+			return
+		}
+
+		c.JSON(http.StatusOK, session)
+	}
+}
@@ -0,0 +1,220 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+// dnsRecordCreate is the body of creating a DNS record; a TTL of 0 uses the zone's default
+type dnsRecordCreate struct {
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	TTL      int    `json:"ttl"`
+	Priority *int   `json:"priority"`
+}
+
+// CreateDNSRecord adds a record to a domain's zone. Invalid fields are answered with 422 and a
+// message per field.
+func CreateDNSRecord(dns *services.DNSService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		domainID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid domain id"})
+			return
+		}
+
+		var req dnsRecordCreate
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		record, err := dns.CreateDNSRecord(serviceContext(c), domainID, req.Type, req.Name, req.Value, req.TTL, req.Priority)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, record)
+	}
+}
+
+// dnsRecordUpdate is the body of updating a DNS record; omitted fields are left unchanged
+type dnsRecordUpdate struct {
+	Type     *string `json:"type"`
+	Name     *string `json:"name"`
+	Value    *string `json:"value"`
+	TTL      *int    `json:"ttl"`
+	Priority *int    `json:"priority"`
+	IsActive *bool   `json:"is_active"`
+}
+
+// GetDNSRecord returns a DNS record with its ETag. A request whose If-None-Match names the
+// current ETag gets 304 Not Modified.
+func GetDNSRecord(dns *services.DNSService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		recordID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid record id"})
+			return
+		}
+
+		record, err := dns.GetDNSRecord(serviceContext(c), recordID)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		writeResource(c, record)
+	}
+}
+
+// UpdateDNSRecord changes fields of a DNS record. With If-Match, the change is only made while
+// the record still has that ETag.
+func UpdateDNSRecord(dns *services.DNSService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		recordID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid record id"})
+			return
+		}
+
+		var req dnsRecordUpdate
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Reading the record first also checks that the caller owns it
+		current, err := dns.GetDNSRecord(serviceContext(c), recordID)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		if !checkIfMatch(c, "DNS record", current) {
+			return
+		}
+
+		updates := map[string]interface{}{}
+		if req.Type != nil {
+			updates["type"] = *req.Type
+		}
+		if req.Name != nil {
+			updates["name"] = *req.Name
+		}
+		if req.Value != nil {
+			updates["value"] = *req.Value
+		}
+		if req.TTL != nil {
+			updates["ttl"] = *req.TTL
+		}
+		if req.Priority != nil {
+			updates["priority"] = *req.Priority
+		}
+		if req.IsActive != nil {
+			updates["is_active"] = *req.IsActive
+		}
+		if len(updates) > 0 {
+			if _, err := dns.UpdateDNSRecord(serviceContext(c), recordID, updates); err != nil {
+				writeError(c, err)
+				return
+			}
+		}
+
+		record, err := dns.GetDNSRecord(serviceContext(c), recordID)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+		writeResource(c, record)
+	}
+}
+
+// dnsBulkDelete is the body of bulk deleting DNS records
+type dnsBulkDelete struct {
+	RecordIDs    []uuid.UUID `json:"record_ids"`
+	ConfirmToken string      `json:"confirm_token"`
+	Force        bool        `json:"force"`
+}
+
+// BulkDeleteDNSRecords previews deleting several records of a domain, or with the confirm token
+// from the preview, deletes them
+func BulkDeleteDNSRecords(dns *services.DNSService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		domainID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid domain id"})
+			return
+		}
+
+		var req dnsBulkDelete
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		result, err := dns.BulkDelete(serviceContext(c), domainID, req.RecordIDs, req.ConfirmToken, req.Force)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// dnsSettings is the body of setting a domain's zone-wide DNS settings
+type dnsSettings struct {
+	DefaultTTL int `json:"default_ttl"`
+}
+
+// SetDNSSettings sets the default TTL of a domain's zone, raising its SOA serial. The updated
+// domain is returned as GetDomain returns it.
+func SetDNSSettings(dns *services.DNSService, domains *services.DomainService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		domainID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid domain id"})
+			return
+		}
+
+		var req dnsSettings
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if _, err := dns.SetDefaultTTL(serviceContext(c), domainID, req.DefaultTTL); err != nil {
+			writeError(c, err)
+			return
+		}
+
+		if domain := ownedDomain(c, domains, domainID); domain != nil {
+			writeResource(c, domain)
+		}
+	}
+}
+
+// DNSZoneHealth checks the whole zone of a domain and returns the findings by severity
+func DNSZoneHealth(dns *services.DNSService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		domainID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid domain id"})
+			return
+		}
+
+		report, err := dns.ZoneHealthCheck(serviceContext(c), domainID)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/runner"
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+func TestBulkDeleteDNSRecords(t *testing.T) {
+	db := newTestDB(t)
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	cfg := config.HostingConfig{DNSDefaultTTL: 3600, ZoneDir: t.TempDir()}
+	domains := services.NewDomainService(db, nil, zap.NewNop(), cfg, nil, nil, runner.NewFake())
+	dns := services.NewDNSService(db, client, zap.NewNop(), cfg, nil, domains)
+	owner := &models.User{Username: "owner", Email: "owner@example.net", PasswordHash: "x", IsActive: true}
+	db.Create(owner)
+	domain := &models.Domain{UserID: owner.ID, Name: "example.com", DocumentRoot: "/var/www/example.com/public_html", IsActive: true, CustomDNSEnabled: true}
+	db.Create(domain)
+	record := &models.DNSRecord{DomainID: domain.ID, Type: "A", Name: "www", Value: "192.0.2.1", TTL: 3600, IsActive: true}
+	db.Create(record)
+	apex := &models.DNSRecord{DomainID: domain.ID, Type: "A", Name: "@", Value: "192.0.2.1", TTL: 3600, IsActive: true}
+	db.Create(apex)
+	path := "/domains/" + domain.ID.String() + "/dns-records/bulk-delete"
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return serveRoute("/domains/:id/dns-records/bulk-delete", BulkDeleteDNSRecords(dns), req, owner.ID, "user")
+	}
+
+	w := post(`{"record_ids":["` + record.ID.String() + `"]}`)
+	var preview services.DNSBulkDelete
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &preview) != nil || preview.ConfirmToken == "" {
+		t.Fatalf("preview = %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := post(`{"record_ids":["` + apex.ID.String() + `"]}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("protected record without force = %d, want 422: %s", w.Code, w.Body.String())
+	}
+	if w := post(`{"record_ids":"www"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("malformed body = %d, want 400", w.Code)
+	}
+
+	w = post(`{"record_ids":["` + record.ID.String() + `"],"confirm_token":"` + preview.ConfirmToken + `"}`)
+	var deleted services.DNSBulkDelete
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &deleted) != nil || !deleted.Deleted {
+		t.Fatalf("confirm = %d: %s", w.Code, w.Body.String())
+	}
+	var count int64
+	db.Model(&models.DNSRecord{}).Where("id = ?", record.ID).Count(&count)
+	if count != 0 {
+		t.Error("confirmed record not deleted")
+	}
+}
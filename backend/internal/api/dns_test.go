@@ -0,0 +1,103 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/runner"
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+func TestSetDNSSettings(t *testing.T) {
+	db := newTestDB(t)
+	cfg := config.HostingConfig{DNSDefaultTTL: 3600, DNSMinTTL: 60, DNSMaxTTL: 86400, ZoneDir: t.TempDir()}
+	domains := services.NewDomainService(db, nil, zap.NewNop(), cfg, nil, nil, runner.NewFake())
+	dns := services.NewDNSService(db, nil, zap.NewNop(), cfg, nil, domains)
+	owner := &models.User{Username: "owner", Email: "owner@example.net", PasswordHash: "x", IsActive: true}
+	db.Create(owner)
+	domain := &models.Domain{UserID: owner.ID, Name: "example.com", DocumentRoot: "/var/www/example.com/public_html", IsActive: true, CustomDNSEnabled: true}
+	db.Create(domain)
+
+	set := func(id, body string, userID uuid.UUID) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/domains/"+id+"/dns-settings", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return serveRoute("/domains/:id/dns-settings", SetDNSSettings(dns, domains), req, userID, "user")
+	}
+
+	w := set(domain.ID.String(), `{"default_ttl":600}`, owner.ID)
+	var updated models.Domain
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &updated) != nil || updated.DNSDefaultTTL != 600 || updated.DNSSerial == 0 {
+		t.Fatalf("set = %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("ETag") == "" {
+		t.Error("response lacks the domain's ETag")
+	}
+
+	tests := []struct {
+		name   string
+		id     string
+		body   string
+		userID uuid.UUID
+		want   int
+	}{
+		{"malformed domain id", "example", `{"default_ttl":600}`, owner.ID, http.StatusBadRequest},
+		{"malformed body", domain.ID.String(), `{"default_ttl":"long"}`, owner.ID, http.StatusBadRequest},
+		{"TTL below the minimum", domain.ID.String(), `{"default_ttl":30}`, owner.ID, http.StatusUnprocessableEntity},
+		{"another user's domain", domain.ID.String(), `{"default_ttl":600}`, uuid.New(), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := set(tt.id, tt.body, tt.userID); w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestDNSZoneHealth(t *testing.T) {
+	db := newTestDB(t)
+	cfg := config.HostingConfig{ServerIPv4: "192.0.2.10", ZoneDir: t.TempDir()}
+	domains := services.NewDomainService(db, nil, zap.NewNop(), cfg, nil, nil, runner.NewFake())
+	dns := services.NewDNSService(db, nil, zap.NewNop(), cfg, nil, domains)
+	owner := &models.User{Username: "owner", Email: "owner@example.net", PasswordHash: "x", IsActive: true}
+	db.Create(owner)
+	// A zone without records needs no lookups to be found broken
+	domain := &models.Domain{UserID: owner.ID, Name: "example.com", DocumentRoot: "/var/www/example.com/public_html", IsActive: true}
+	db.Create(domain)
+
+	check := func(id string, userID uuid.UUID) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/domains/"+id+"/dns-health", nil)
+		return serveRoute("/domains/:id/dns-health", DNSZoneHealth(dns), req, userID, "user")
+	}
+
+	w := check(domain.ID.String(), owner.ID)
+	var report services.ZoneHealthReport
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &report) != nil {
+		t.Fatalf("check = %d: %s", w.Code, w.Body.String())
+	}
+	if report.Domain != "example.com" || report.Healthy || report.Errors == 0 || report.Findings[0].Severity != services.SeverityError {
+		t.Errorf("report = %s", w.Body.String())
+	}
+
+	for _, tt := range []struct {
+		id     string
+		userID uuid.UUID
+		want   int
+	}{
+		{"42", owner.ID, http.StatusBadRequest},
+		{uuid.NewString(), owner.ID, http.StatusNotFound},
+		{domain.ID.String(), uuid.New(), http.StatusForbidden},
+	} {
+		if w := check(tt.id, tt.userID); w.Code != tt.want {
+			t.Errorf("check %s = %d, want %d", tt.id, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+// ownedDomain loads a domain the caller owns, or any domain for admins. Otherwise it writes the
+// error response and returns nil.
+func ownedDomain(c *gin.Context, domains *services.DomainService, domainID uuid.UUID) *models.Domain {
+	return loadOwnedDomain(c, domains.GetDomain, domainID)
+}
+
+// currentOwnedDomain is ownedDomain reading the domain from the database instead of the cache, for
+// checking If-Match against
+func currentOwnedDomain(c *gin.Context, domains *services.DomainService, domainID uuid.UUID) *models.Domain {
+	return loadOwnedDomain(c, domains.ReloadDomain, domainID)
+}
+
+// loadOwnedDomain loads a domain with load and checks the caller may manage it
+func loadOwnedDomain(c *gin.Context, load func(context.Context, uuid.UUID) (*models.Domain, error), domainID uuid.UUID) *models.Domain {
+	callerID, isAdmin, ok := caller(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return nil
+	}
+
+	domain, err := load(serviceContext(c), domainID)
+	if err == nil && !isAdmin && domain.UserID != callerID {
+		err = apperrors.PermissionDenied("domain")
+	}
+	if err != nil {
+		writeError(c, err)
+		return nil
+	}
+	return domain
+}
+
+// GetDomain returns a domain with its subdomains, DNS records and certificates, and its ETag.
+// A request whose If-None-Match names the current ETag gets 304 Not Modified.
+func GetDomain(domains *services.DomainService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		domainID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid domain id"})
+			return
+		}
+
+		if domain := ownedDomain(c, domains, domainID); domain != nil {
+			writeResource(c, domain)
+		}
+	}
+}
+
+// DomainStats returns a domain's usage and resource counts, with a warning while its PHP version
+// is deprecated
+func DomainStats(domains *services.DomainService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		domainID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid domain id"})
+			return
+		}
+
+		stats, err := domains.GetDomainStats(serviceContext(c), domainID)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, stats)
+	}
+}
+
+// createDomainRequest is the body of creating a domain; quotas can only lower the package's, and
+// zero keeps them
+type createDomainRequest struct {
+	Name           string `json:"name"`
+	DiskQuota      int64  `json:"disk_quota"`
+	BandwidthQuota int64  `json:"bandwidth_quota"`
+}
+
+// CreateDomain creates a domain owned by the caller. Invalid fields are answered with 422 and a
+// message per field.
+func CreateDomain(domains *services.DomainService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		callerID, _, ok := caller(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		var req createDomainRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		quotas := &services.DomainQuotas{DiskQuota: req.DiskQuota, BandwidthQuota: req.BandwidthQuota}
+		domain, err := domains.CreateDomain(serviceContext(c), callerID, req.Name, quotas)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, domain)
+	}
+}
@@ -0,0 +1,41 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+// cloneDomainRequest is the body of cloning a domain's configuration
+type cloneDomainRequest struct {
+	Name          string `json:"name"`
+	EmailAccounts bool   `json:"email_accounts"`
+}
+
+// CloneDomain creates a new domain set up like an existing one
+func CloneDomain(domains *services.DomainService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		domainID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid domain id"})
+			return
+		}
+
+		var req cloneDomainRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		domain, err := domains.CloneConfig(serviceContext(c), domainID, req.Name, req.EmailAccounts)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, domain)
+	}
+}
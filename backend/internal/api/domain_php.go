@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+// SetDomainPHP sets the PHP version, handler, extensions and error handling of a domain. With
+// If-Match, the change is only made while the domain still has that ETag. The updated domain is
+// returned as GetDomain returns it.
+func SetDomainPHP(domains *services.DomainService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		domainID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid domain id"})
+			return
+		}
+
+		var req services.PHPSettings
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if c.GetHeader("If-Match") != "" {
+			current := currentOwnedDomain(c, domains, domainID)
+			if current == nil || !checkIfMatch(c, "domain", current) {
+				return
+			}
+		}
+
+		if _, err := domains.SetPHPSettings(serviceContext(c), domainID, req); err != nil {
+			writeError(c, err)
+			return
+		}
+
+		if domain := ownedDomain(c, domains, domainID); domain != nil {
+			writeResource(c, domain)
+		}
+	}
+}
+
+// ResetDomainOpcache clears the opcache of a domain's PHP processes
+func ResetDomainOpcache(domains *services.DomainService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		domainID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid domain id"})
+			return
+		}
+
+		if err := domains.ResetPHPOpcache(serviceContext(c), domainID); err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
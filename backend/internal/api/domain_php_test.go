@@ -0,0 +1,50 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/runner"
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+func TestResetDomainOpcache(t *testing.T) {
+	db := newTestDB(t)
+	fake := runner.NewFake()
+	cfg := config.HostingConfig{PHPFPMSocketDir: "/run/php", PHPOpcacheResetCommand: "cachetool opcache:reset --fcgi={socket}"}
+	domains := services.NewDomainService(db, nil, zap.NewNop(), cfg, nil, nil, fake)
+	owner := &models.User{Username: "owner", Email: "owner@example.net", PasswordHash: "x", IsActive: true}
+	db.Create(owner)
+	domain := &models.Domain{UserID: owner.ID, Name: "shop.example", DocumentRoot: "/var/www/shop.example/public_html", IsActive: true}
+	db.Create(domain)
+
+	tests := []struct {
+		name   string
+		id     string
+		userID uuid.UUID
+		want   int
+	}{
+		{"malformed id", "42", owner.ID, http.StatusBadRequest},
+		{"unknown domain", uuid.NewString(), owner.ID, http.StatusNotFound},
+		{"another user", domain.ID.String(), uuid.New(), http.StatusForbidden},
+		{"owner", domain.ID.String(), owner.ID, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/domains/"+tt.id+"/php/opcache-reset", nil)
+			w := serveRoute("/domains/:id/php/opcache-reset", ResetDomainOpcache(domains), req, tt.userID, "user")
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+	if calls := fake.Calls(); len(calls) != 1 || calls[0].String() != "cachetool opcache:reset --fcgi=/run/php/php8.2-fpm.sock" {
+		t.Errorf("calls = %v, want one reset of the shared pool", calls)
+	}
+}
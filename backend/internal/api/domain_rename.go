@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+// renameDomainRequest is the body of renaming a domain
+type renameDomainRequest struct {
+	Name string `json:"name"`
+}
+
+// RenameDomain gives a domain a new name, moving its files, DNS records and configuration along.
+// The renamed domain is returned as GetDomain returns it.
+func RenameDomain(domains *services.DomainService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		domainID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid domain id"})
+			return
+		}
+
+		var req renameDomainRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if _, err := domains.Rename(serviceContext(c), domainID, req.Name); err != nil {
+			writeError(c, err)
+			return
+		}
+
+		if domain := ownedDomain(c, domains, domainID); domain != nil {
+			writeResource(c, domain)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/runner"
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+func TestDomainStats(t *testing.T) {
+	db := newTestDB(t)
+	cfg := config.HostingConfig{PHPDeprecations: []config.PHPDeprecation{{Version: "7.4", RemovedAt: "2020-01-01", Replacement: "8.2"}}}
+	domains := services.NewDomainService(db, nil, zap.NewNop(), cfg, nil, nil, runner.NewFake())
+	owner := &models.User{Username: "owner", Email: "owner@example.net", PasswordHash: "x", IsActive: true}
+	db.Create(owner)
+	domain := &models.Domain{UserID: owner.ID, Name: "example.com", DocumentRoot: "/var/www/example.com/public_html", IsActive: true, PHPVersion: "7.4"}
+	db.Create(domain)
+	path := "/domains/" + domain.ID.String() + "/stats"
+
+	w := serveRoute("/domains/:id/stats", DomainStats(domains), httptest.NewRequest(http.MethodGet, path, nil), owner.ID, "user")
+	var body struct {
+		PHPVersion     string                          `json:"php_version"`
+		PHPDeprecation *services.PHPDeprecationWarning `json:"php_deprecation"`
+	}
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &body) != nil {
+		t.Fatalf("stats = %d: %s", w.Code, w.Body.String())
+	}
+	if body.PHPDeprecation == nil || !body.PHPDeprecation.Removed || body.PHPDeprecation.Replacement != "8.2" {
+		t.Errorf("php_deprecation = %+v", body.PHPDeprecation)
+	}
+
+	if w := serveRoute("/domains/:id/stats", DomainStats(domains), httptest.NewRequest(http.MethodGet, path, nil), uuid.New(), "user"); w.Code != http.StatusForbidden {
+		t.Errorf("another user's stats = %d, want 403", w.Code)
+	}
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+// suspendDomainRequest is the body of suspending a domain
+type suspendDomainRequest struct {
+	Reason string `json:"reason"`
+}
+
+// SuspendDomain takes a domain offline with a reason, keeping its data. The updated domain is
+// returned as GetDomain returns it.
+func SuspendDomain(domains *services.DomainService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		domainID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid domain id"})
+			return
+		}
+
+		var req suspendDomainRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if _, err := domains.Suspend(serviceContext(c), domainID, req.Reason); err != nil {
+			writeError(c, err)
+			return
+		}
+
+		if domain := ownedDomain(c, domains, domainID); domain != nil {
+			writeResource(c, domain)
+		}
+	}
+}
+
+// UnsuspendDomain lifts a domain's suspension. The updated domain is returned as GetDomain
+// returns it.
+func UnsuspendDomain(domains *services.DomainService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		domainID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid domain id"})
+			return
+		}
+
+		if _, err := domains.Unsuspend(serviceContext(c), domainID); err != nil {
+			writeError(c, err)
+			return
+		}
+
+		if domain := ownedDomain(c, domains, domainID); domain != nil {
+			writeResource(c, domain)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/runner"
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+func TestSuspendDomain(t *testing.T) {
+	db := newTestDB(t)
+	dir := t.TempDir()
+	cfg := config.HostingConfig{VhostDir: filepath.Join(dir, "vhosts"), SuspendedPageDir: filepath.Join(dir, "suspended"), LogDir: filepath.Join(dir, "logs"), AccessLogFormat: "combined"}
+	domains := services.NewDomainService(db, nil, zap.NewNop(), cfg, nil, nil, runner.NewFake())
+	owner := &models.User{Username: "owner", Email: "owner@example.net", PasswordHash: "x", IsActive: true}
+	db.Create(owner)
+	domain := &models.Domain{UserID: owner.ID, Name: "shop.example", DocumentRoot: "/var/www/shop.example/public_html", IsActive: true}
+	db.Create(domain)
+	adminID := uuid.New()
+
+	suspend := func(id, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/domains/"+id+"/suspend", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return serveRoute("/admin/domains/:id/suspend", SuspendDomain(domains), req, adminID, "admin")
+	}
+	unsuspend := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/admin/domains/"+id+"/unsuspend", nil)
+		return serveRoute("/admin/domains/:id/unsuspend", UnsuspendDomain(domains), req, adminID, "admin")
+	}
+
+	w := suspend(domain.ID.String(), `{"reason":"Unpaid invoice"}`)
+	var updated models.Domain
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &updated) != nil {
+		t.Fatalf("suspend = %d: %s", w.Code, w.Body.String())
+	}
+	if updated.SuspendedAt == nil || updated.SuspensionReason != "Unpaid invoice" || updated.SuspendedBy == nil || *updated.SuspendedBy != adminID {
+		t.Errorf("suspended domain = %s", w.Body.String())
+	}
+
+	w = unsuspend(domain.ID.String())
+	updated = models.Domain{}
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &updated) != nil || updated.SuspendedAt != nil || updated.SuspensionReason != "" {
+		t.Errorf("unsuspend = %d: %s", w.Code, w.Body.String())
+	}
+
+	tests := []struct {
+		name  string
+		serve func() *httptest.ResponseRecorder
+		want  int
+	}{
+		{"malformed domain id", func() *httptest.ResponseRecorder { return suspend("shop", `{"reason":"x"}`) }, http.StatusBadRequest},
+		{"malformed body", func() *httptest.ResponseRecorder { return suspend(domain.ID.String(), `{"reason":1}`) }, http.StatusBadRequest},
+		{"blank reason", func() *httptest.ResponseRecorder { return suspend(domain.ID.String(), `{"reason":" "}`) }, http.StatusUnprocessableEntity},
+		{"unknown domain", func() *httptest.ResponseRecorder { return suspend(uuid.NewString(), `{"reason":"x"}`) }, http.StatusNotFound},
+		{"unsuspend malformed id", func() *httptest.ResponseRecorder { return unsuspend("shop") }, http.StatusBadRequest},
+		{"unsuspend an active domain", func() *httptest.ResponseRecorder { return unsuspend(domain.ID.String()) }, http.StatusConflict},
+		{"unsuspend an unknown domain", func() *httptest.ResponseRecorder { return unsuspend(uuid.NewString()) }, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := tt.serve(); w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
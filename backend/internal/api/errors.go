@@ -0,0 +1,27 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/middleware"
+)
+
+// writeError sends a service error in the caller's language. Validation errors become a 422 with
+// the message of each offending field under "errors", so the frontend can highlight them; anything
+// else is {"error": message} with the status the error maps to. Errors that carry a message code
+// include it as "code" so clients can tell them apart without parsing text.
+func writeError(c *gin.Context, err error) {
+	locale := middleware.Locale(c)
+	code, message := apperrors.Message(err, locale)
+
+	body := gin.H{"error": message}
+	if code != "" {
+		body["code"] = code
+	}
+	if validation, ok := apperrors.AsValidation(err); ok {
+		body["errors"] = validation.Localize(locale)
+	}
+
+	c.JSON(apperrors.HTTPStatus(err), body)
+}
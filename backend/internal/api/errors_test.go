@@ -0,0 +1,65 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+)
+
+func TestWriteErrorLocalizes(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		locale     string // Stored preference of the caller
+		language   string // Accept-Language header
+		wantStatus int
+		wantCode   string
+		wantError  string
+		wantField  string
+	}{
+		{"English by default", apperrors.NotFound("domain"), "", "", http.StatusNotFound, "not_found", "domain not found", ""},
+		{"Accept-Language", apperrors.NotFound("mailbox"), "", "de-DE,de;q=0.9", http.StatusNotFound, "not_found", "Postfach nicht gefunden", ""},
+		{"preference over header", apperrors.NotFound("mailbox"), "de", "en", http.StatusNotFound, "not_found", "Postfach nicht gefunden", ""},
+		{"validation", apperrors.InvalidCode("name", "field.required", nil), "", "de", http.StatusUnprocessableEntity, "validation_failed", "Einige Felder sind ungültig", "ist erforderlich"},
+		{"uncoded error", errors.New("boom"), "", "de", http.StatusInternalServerError, "", "boom", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/", func(c *gin.Context) {
+				if tt.locale != "" {
+					c.Set("locale", tt.locale)
+				}
+				writeError(c, tt.err)
+			})
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.language != "" {
+				req.Header.Set("Accept-Language", tt.language)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			var body struct {
+				Code   string            `json:"code"`
+				Error  string            `json:"error"`
+				Errors map[string]string `json:"errors"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode %s: %v", w.Body, err)
+			}
+			if w.Code != tt.wantStatus || body.Code != tt.wantCode || body.Error != tt.wantError {
+				t.Errorf("response = %d %+v, want %d %q %q", w.Code, body, tt.wantStatus, tt.wantCode, tt.wantError)
+			}
+			if body.Errors["name"] != tt.wantField {
+				t.Errorf("field message = %q, want %q", body.Errors["name"], tt.wantField)
+			}
+		})
+	}
+}
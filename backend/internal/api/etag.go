@@ -0,0 +1,87 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mynodecp/mynodecp/backend/internal/i18n"
+	"github.com/mynodecp/mynodecp/backend/internal/middleware"
+)
+
+// entityTag returns the strong ETag of a JSON representation. Hashing the representation rather
+// than taking updated_at alone also catches changes to what is embedded in it, such as the DNS
+// records of a domain.
+func entityTag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// resourceTag returns the ETag of the JSON representation of value, and the representation
+func resourceTag(value interface{}) (string, []byte, error) {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return "", nil, err
+	}
+	return entityTag(body), body, nil
+}
+
+// matchesTag reports whether a list of entity tags from If-Match or If-None-Match contains tag or
+// "*". Weak tags (W/"...") are compared by their opaque value.
+func matchesTag(header, tag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// writeResource sends a single resource with its ETag, or 304 Not Modified when the request's
+// If-None-Match already names it
+func writeResource(c *gin.Context, value interface{}) {
+	tag, body, err := resourceTag(value)
+	if err != nil {
+		writeError(c, err)
+		return
+	}
+
+	c.Header("ETag", tag)
+	if header := c.GetHeader("If-None-Match"); header != "" && matchesTag(header, tag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
+
+// checkIfMatch lets an update go ahead when the request has no If-Match or its If-Match names the
+// resource's current ETag. Otherwise it answers 412 Precondition Failed, with the current ETag so
+// the client can tell what changed, and returns false.
+func checkIfMatch(c *gin.Context, resource string, current interface{}) bool {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		return true
+	}
+
+	tag, _, err := resourceTag(current)
+	if err != nil {
+		writeError(c, err)
+		return false
+	}
+	if matchesTag(header, tag) {
+		return true
+	}
+
+	locale := middleware.Locale(c)
+	c.Header("ETag", tag)
+	c.JSON(http.StatusPreconditionFailed, gin.H{
+		"error": i18n.Translate(locale, "resource_modified", map[string]string{"resource": i18n.Term(locale, resource)}),
+		"code":  "resource_modified",
+	})
+	return false
+}
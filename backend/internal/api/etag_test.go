@@ -0,0 +1,176 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/runner"
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+func TestMatchesTag(t *testing.T) {
+	tag := `"abc"`
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{`"abc"`, true},
+		{`"xyz", "abc"`, true},
+		{`W/"abc"`, true},
+		{`*`, true},
+		{`"xyz"`, false},
+		{`abc`, false},
+	}
+	for _, tt := range tests {
+		if got := matchesTag(tt.header, tag); got != tt.want {
+			t.Errorf("matchesTag(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestDNSRecordConditionalRequests(t *testing.T) {
+	db := newTestDB(t)
+	dns := services.NewDNSService(db, nil, zap.NewNop(), config.HostingConfig{DNSDefaultTTL: 3600, ZoneDir: t.TempDir()}, nil, nil)
+	owner := &models.User{Username: "owner", Email: "owner@example.net", PasswordHash: "x", IsActive: true}
+	db.Create(owner)
+	domain := &models.Domain{UserID: owner.ID, Name: "example.com", DocumentRoot: "/var/www/example.com/public_html", IsActive: true, CustomDNSEnabled: true}
+	db.Create(domain)
+	record := &models.DNSRecord{DomainID: domain.ID, Type: "A", Name: "www", Value: "192.0.2.1", TTL: 3600, IsActive: true}
+	db.Create(record)
+	path := "/dns-records/" + record.ID.String()
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		return serveRoute("/dns-records/:id", GetDNSRecord(dns), req, owner.ID, "user")
+	}
+	update := func(ifMatch, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, path, strings.NewReader(body))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		return serveRoute("/dns-records/:id", UpdateDNSRecord(dns), req, owner.ID, "user")
+	}
+
+	first := get("")
+	tag := first.Header().Get("ETag")
+	if first.Code != http.StatusOK || tag == "" {
+		t.Fatalf("GET = %d with ETag %q", first.Code, tag)
+	}
+	if w := get(tag); w.Code != http.StatusNotModified || w.Body.Len() != 0 || w.Header().Get("ETag") != tag {
+		t.Errorf("GET with the current ETag = %d, body %q", w.Code, w.Body.String())
+	}
+	if w := get(`"stale"`); w.Code != http.StatusOK {
+		t.Errorf("GET with another ETag = %d, want 200", w.Code)
+	}
+
+	// An update with the current ETag goes ahead and changes it
+	w := update(tag, `{"value":"192.0.2.2"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update with the current ETag = %d: %s", w.Code, w.Body.String())
+	}
+	newTag := w.Header().Get("ETag")
+	if newTag == tag || newTag != get("").Header().Get("ETag") {
+		t.Errorf("ETag after the update = %s, was %s", newTag, tag)
+	}
+
+	// A client still holding the old ETag is turned away
+	w = update(tag, `{"value":"192.0.2.3"}`)
+	if w.Code != http.StatusPreconditionFailed || w.Header().Get("ETag") != newTag {
+		t.Errorf("update with a stale ETag = %d, ETag %s", w.Code, w.Header().Get("ETag"))
+	}
+	var body map[string]string
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body["code"] != "resource_modified" {
+		t.Errorf("stale update body = %s", w.Body.String())
+	}
+	var stored models.DNSRecord
+	db.First(&stored, "id = ?", record.ID)
+	if stored.Value != "192.0.2.2" {
+		t.Errorf("stale update stored %s", stored.Value)
+	}
+
+	// Without If-Match, updates are unconditional
+	if w := update("", `{"ttl":600}`); w.Code != http.StatusOK {
+		t.Errorf("unconditional update = %d: %s", w.Code, w.Body.String())
+	}
+
+	// Other users learn nothing, not even the ETag
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if w := serveRoute("/dns-records/:id", GetDNSRecord(dns), req, uuid.New(), "user"); w.Code != http.StatusForbidden || w.Header().Get("ETag") != "" {
+		t.Errorf("another user's GET = %d, ETag %q", w.Code, w.Header().Get("ETag"))
+	}
+}
+
+func TestUserConditionalRequests(t *testing.T) {
+	db := newTestDB(t)
+	users := services.NewUserService(db, nil, zap.NewNop(), nil, nil, nil, nil, config.AuthConfig{}, nil)
+	user := &models.User{Username: "owner", Email: "owner@example.net", PasswordHash: "x", IsActive: true}
+	db.Create(user)
+	path := "/users/" + user.ID.String()
+
+	w := serveRoute("/users/:id", GetUser(users), httptest.NewRequest(http.MethodGet, path, nil), user.ID, "user")
+	tag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || tag == "" {
+		t.Fatalf("GET = %d with ETag %q", w.Code, tag)
+	}
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("If-None-Match", tag)
+	if w := serveRoute("/users/:id", GetUser(users), req, user.ID, "user"); w.Code != http.StatusNotModified {
+		t.Errorf("GET with the current ETag = %d, want 304", w.Code)
+	}
+
+	// The account changes under the client
+	db.Model(user).Update("first_name", "Changed")
+
+	req = httptest.NewRequest(http.MethodPut, path+"/login-restrictions", strings.NewReader(`{"ip_ranges":["203.0.113.0/24"]}`))
+	req.Header.Set("If-Match", tag)
+	if w := serveRoute("/users/:id/login-restrictions", SetLoginRestrictions(users), req, user.ID, "user"); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("update with a stale ETag = %d, want 412: %s", w.Code, w.Body.String())
+	}
+	var stored models.User
+	db.First(&stored, "id = ?", user.ID)
+	if len(stored.AllowedIPRanges) != 0 {
+		t.Errorf("stale update stored %v", stored.AllowedIPRanges)
+	}
+
+	if w := serveRoute("/users/:id", GetUser(users), httptest.NewRequest(http.MethodGet, path, nil), uuid.New(), "user"); w.Code != http.StatusForbidden {
+		t.Errorf("another user's GET = %d, want 403", w.Code)
+	}
+}
+
+func TestDomainETagCoversRecords(t *testing.T) {
+	db := newTestDB(t)
+	domains := services.NewDomainService(db, nil, zap.NewNop(), config.HostingConfig{}, nil, nil, runner.NewFake())
+	owner := &models.User{Username: "owner", Email: "owner@example.net", PasswordHash: "x", IsActive: true}
+	db.Create(owner)
+	domain := &models.Domain{UserID: owner.ID, Name: "example.com", DocumentRoot: "/var/www/example.com/public_html", IsActive: true}
+	db.Create(domain)
+	path := "/domains/" + domain.ID.String()
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("If-None-Match", ifNoneMatch)
+		return serveRoute("/domains/:id", GetDomain(domains), req, owner.ID, "user")
+	}
+
+	tag := get("").Header().Get("ETag")
+	if w := get(tag); w.Code != http.StatusNotModified {
+		t.Errorf("GET with the current ETag = %d, want 304", w.Code)
+	}
+
+	// A new record changes the domain's representation without touching its updated_at
+	db.Create(&models.DNSRecord{DomainID: domain.ID, Type: "A", Name: "www", Value: "192.0.2.1", TTL: 3600, IsActive: true})
+	if w := get(tag); w.Code != http.StatusOK || w.Header().Get("ETag") == tag {
+		t.Errorf("GET after a record was added = %d with ETag %s", w.Code, w.Header().Get("ETag"))
+	}
+}
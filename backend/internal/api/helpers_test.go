@@ -0,0 +1,59 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/mynodecp/mynodecp/backend/internal/database"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// newTestDB opens an in-memory database of its own for a test, with the schema migrated
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := "file:" + uuid.NewString() + "?mode=memory&cache=shared&_busy_timeout=5000"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("test database handle: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	return db
+}
+
+// serve runs one request through handler with the caller authenticated as userID with roles
+func serve(handler gin.HandlerFunc, req *http.Request, userID uuid.UUID, roles ...string) *httptest.ResponseRecorder {
+	return serveRoute(req.URL.Path, handler, req, userID, roles...)
+}
+
+// serveRoute is serve for a handler whose route has parameters
+func serveRoute(route string, handler gin.HandlerFunc, req *http.Request, userID uuid.UUID, roles ...string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", userID)
+		c.Set("roles", roles)
+	})
+	router.Handle(req.Method, route, handler)
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
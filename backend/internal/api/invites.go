@@ -0,0 +1,79 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/auth"
+)
+
+// inviteBody is the body of creating an invite code
+type inviteBody struct {
+	Email   string `json:"email"`
+	MaxUses int    `json:"max_uses"`
+	TTL     string `json:"ttl"` // Go duration such as 72h
+}
+
+// CreateInvite creates a registration invite code (admin). The code is only returned here.
+func CreateInvite(authService *auth.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body inviteBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		req := auth.InviteRequest{Email: body.Email, MaxUses: body.MaxUses}
+		if body.TTL != "" {
+			ttl, err := time.ParseDuration(body.TTL)
+			if err != nil || ttl <= 0 {
+				writeError(c, apperrors.InvalidCode("ttl", "field.format", nil))
+				return
+			}
+			req.TTL = ttl
+		}
+
+		code, invite, err := authService.CreateInvite(serviceContext(c), req)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{"code": code, "invite": invite})
+	}
+}
+
+// Invites lists registration invite codes (admin)
+func Invites(authService *auth.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		invites, err := authService.GetInvites(serviceContext(c))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"invites": invites})
+	}
+}
+
+// RevokeInvite stops a registration invite code from being used (admin)
+func RevokeInvite(authService *auth.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		inviteID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid invite id"})
+			return
+		}
+
+		if err := authService.RevokeInvite(serviceContext(c), inviteID); err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
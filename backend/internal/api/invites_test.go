@@ -0,0 +1,85 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/auth"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestInviteHandlers(t *testing.T) {
+	db := newTestDB(t)
+	authService := auth.NewService(db, nil, zap.NewNop(), config.AuthConfig{RegistrationMode: auth.RegistrationInvite, InviteTTL: time.Hour}, nil, nil, nil, nil)
+	admin := uuid.New()
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"defaults", `{}`, http.StatusCreated},
+		{"custom TTL", `{"email":"ann@example.com","max_uses":3,"ttl":"72h"}`, http.StatusCreated},
+		{"malformed TTL", `{"ttl":"3 days"}`, http.StatusUnprocessableEntity},
+		{"negative TTL", `{"ttl":"-1h"}`, http.StatusUnprocessableEntity},
+		{"too many uses", `{"max_uses":100000}`, http.StatusUnprocessableEntity},
+		{"not JSON", `uses=1`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/admin/invites", strings.NewReader(tt.body))
+			w := serve(CreateInvite(authService), req, admin, "admin")
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.status != http.StatusCreated {
+				return
+			}
+			var body struct {
+				Code   string                    `json:"code"`
+				Invite models.RegistrationInvite `json:"invite"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if body.Code == "" || body.Invite.ID == uuid.Nil {
+				t.Errorf("response = %s, want the code and the invite", w.Body)
+			}
+			var stored models.RegistrationInvite
+			db.Where("id = ?", body.Invite.ID).First(&stored)
+			if stored.CodeHash == "" || stored.CodeHash == body.Code || strings.Contains(w.Body.String(), stored.CodeHash) {
+				t.Error("code stored in the clear or its hash returned")
+			}
+		})
+	}
+
+	w := serve(Invites(authService), httptest.NewRequest(http.MethodGet, "/admin/invites", nil), admin, "admin")
+	var list struct {
+		Invites []models.RegistrationInvite `json:"invites"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || len(list.Invites) != 2 {
+		t.Fatalf("Invites() = %s, %v; want the 2 created", w.Body, err)
+	}
+
+	revoke := func(id string) int {
+		req := httptest.NewRequest(http.MethodDelete, "/admin/invites/"+id, nil)
+		return serveRoute("/admin/invites/:id", RevokeInvite(authService), req, admin, "admin").Code
+	}
+	if status := revoke(list.Invites[0].ID.String()); status != http.StatusNoContent {
+		t.Errorf("revoke status = %d, want 204", status)
+	}
+	if status := revoke("nope"); status != http.StatusBadRequest {
+		t.Errorf("revoke malformed id status = %d, want 400", status)
+	}
+	if status := revoke(uuid.NewString()); status != http.StatusNotFound {
+		t.Errorf("revoke unknown id status = %d, want 404", status)
+	}
+}
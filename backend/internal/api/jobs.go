@@ -0,0 +1,206 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/jobs"
+)
+
+// RegisterJobs registers the panel's periodic maintenance jobs
+func RegisterJobs(scheduler *jobs.Scheduler, s *Services, cfg *config.Config, logger *zap.Logger) {
+	scheduler.Register("quota_check", cfg.Hosting.QuotaCheckInterval, s.Quota.CheckUsage)
+
+	// Measures databases on the provisioning server and blocks imports into those over quota
+	scheduler.Register("database_quota_check", cfg.Hosting.QuotaCheckInterval, s.Database.CheckDatabaseQuotas)
+
+	scheduler.Register("collect_traffic", cfg.Hosting.TrafficCollectInterval, s.Domain.CollectTraffic)
+
+	// Usage of every domain for the billing exports
+	if cfg.Hosting.UsageSnapshotInterval > 0 {
+		scheduler.Register("usage_snapshots", cfg.Hosting.UsageSnapshotInterval, s.User.TakeUsageSnapshots)
+	}
+
+	// Notices ahead of password expiry; roles can set a maximum age without a configured default
+	scheduler.Register("password_expiry_notices", cfg.Jobs.CleanupInterval, s.User.NotifyPasswordExpiry)
+
+	scheduler.Register("purge_traffic_samples", cfg.Jobs.CleanupInterval, func(ctx context.Context) error {
+		purged, err := s.Domain.PurgeTrafficSamples(ctx, time.Now().Add(-cfg.Jobs.TrafficRetention))
+		logPurged(logger, "traffic samples", purged)
+		return err
+	})
+
+	// Retention policies; a zero retention keeps the records forever
+	if cfg.Jobs.SessionRetention > 0 {
+		scheduler.Register("purge_sessions", cfg.Jobs.CleanupInterval, func(ctx context.Context) error {
+			purged, err := s.Auth.PurgeSessions(ctx, time.Now().Add(-cfg.Jobs.SessionRetention))
+			logPurged(logger, "sessions", purged)
+			return err
+		})
+	}
+
+	if cfg.Jobs.MetricRetention > 0 {
+		scheduler.Register("purge_metrics", cfg.Jobs.CleanupInterval, func(ctx context.Context) error {
+			purged, err := s.System.PurgeMetrics(ctx, time.Now().Add(-cfg.Jobs.MetricRetention))
+			logPurged(logger, "metrics", purged)
+			return err
+		})
+	}
+
+	if cfg.Jobs.SecurityEventRetention > 0 {
+		scheduler.Register("purge_security_events", cfg.Jobs.CleanupInterval, func(ctx context.Context) error {
+			purged, err := s.Audit.PurgeSecurityEvents(ctx, time.Now().Add(-cfg.Jobs.SecurityEventRetention))
+			logPurged(logger, "security events", purged)
+			return err
+		})
+	}
+
+	if cfg.Jobs.BackupRetention > 0 {
+		scheduler.Register("purge_old_backups", cfg.Jobs.CleanupInterval, func(ctx context.Context) error {
+			purged, err := s.Backup.PurgeBackups(ctx, time.Now().Add(-cfg.Jobs.BackupRetention))
+			logPurged(logger, "backups", int64(purged))
+			return err
+		})
+	}
+
+	if cfg.Jobs.UsageRetention > 0 {
+		scheduler.Register("purge_usage_snapshots", cfg.Jobs.CleanupInterval, func(ctx context.Context) error {
+			purged, err := s.User.PurgeUsageSnapshots(ctx, time.Now().Add(-cfg.Jobs.UsageRetention))
+			logPurged(logger, "usage snapshots", purged)
+			return err
+		})
+	}
+
+	if cfg.Jobs.AuditRetention > 0 {
+		scheduler.Register("purge_audit_logs", cfg.Jobs.CleanupInterval, func(ctx context.Context) error {
+			purged, err := s.Audit.PurgeAuditLogs(ctx, time.Now().Add(-cfg.Jobs.AuditRetention))
+			logPurged(logger, "audit logs", purged)
+			return err
+		})
+
+		scheduler.Register("purge_change_logs", cfg.Jobs.CleanupInterval, func(ctx context.Context) error {
+			purged, err := s.Audit.PurgeChangeLogs(ctx, time.Now().Add(-cfg.Jobs.AuditRetention))
+			logPurged(logger, "change logs", purged)
+			return err
+		})
+	}
+
+	scheduler.Register("purge_expired_backups", cfg.Jobs.CleanupInterval, func(ctx context.Context) error {
+		purged, err := s.Backup.PurgeExpiredBackups(ctx)
+		logPurged(logger, "backups", int64(purged))
+		return err
+	})
+
+	scheduler.Register("purge_stale_uploads", cfg.Jobs.CleanupInterval, func(ctx context.Context) error {
+		purged, err := s.File.PurgeStaleUploads(ctx)
+		logPurged(logger, "staged uploads", purged)
+		return err
+	})
+
+	// Picks up domain suspensions and reinstatements, which change who may log in over FTP
+	scheduler.Register("sync_ftp_users", cfg.Jobs.CleanupInterval, s.FTP.SyncFTPUsers)
+
+	// Moves secrets to the current encryption key, and encrypts those stored before one was set
+	scheduler.Register("reencrypt_secrets", cfg.Jobs.CleanupInterval, func(ctx context.Context) error {
+		count, err := s.System.ReencryptSecrets(ctx)
+		if count > 0 {
+			logger.Info("Re-encrypted secrets", zap.Int64("count", count))
+		}
+		return err
+	})
+
+	if s.ProvisioningDB != nil {
+		scheduler.Register("provisioning_db_health", cfg.Hosting.ProvisioningDBHealthInterval, s.ProvisioningDB.Check)
+	}
+
+	// Issues the certificates new domains are queued for, retrying those not pointing at the
+	// server yet, and renews those about to expire
+	if cfg.Hosting.ACMEDirectoryURL != "" {
+		scheduler.Register("auto_ssl", cfg.Hosting.AutoSSLInterval, s.SSL.IssuePendingCertificates)
+		scheduler.Register("renew_certificates", cfg.Jobs.CleanupInterval, s.SSL.RenewCertificates)
+	}
+
+	// Takes landing pages away from domains whose owners have uploaded their site
+	if cfg.Hosting.LandingPageRemove {
+		scheduler.Register("remove_landing_pages", cfg.Jobs.CleanupInterval, func(ctx context.Context) error {
+			removed, err := s.Domain.RemoveLandingPages(ctx)
+			if removed > 0 {
+				logger.Info("Removed landing pages", zap.Int("domains", removed))
+			}
+			return err
+		})
+	}
+
+	// Tells owners of domains on a deprecated PHP version, once per version, to move off it
+	if cfg.Hosting.PHPDeprecationNotify && len(cfg.Hosting.PHPDeprecations) > 0 {
+		scheduler.Register("php_deprecation_notify", cfg.Jobs.CleanupInterval, s.PHPDeprecation.Notify)
+	}
+
+	// Restarts managed services found failed, backing off and giving up after repeated failures
+	if len(cfg.Hosting.WatchdogServices) > 0 {
+		scheduler.Register("service_watchdog", cfg.Hosting.WatchdogInterval, s.System.WatchServices)
+	}
+
+	// Emails each user one summary of the notifications they chose to get as a digest
+	scheduler.Register("notification_digests", cfg.Mail.DigestInterval, s.Notification.SendDigests)
+
+	scheduler.Register("account_cleanup", cfg.Jobs.CleanupInterval, func(ctx context.Context) error {
+		_, err := s.AccountCleanup.Run(ctx)
+		return err
+	})
+}
+
+func logPurged(logger *zap.Logger, what string, count int64) {
+	if count > 0 {
+		logger.Info("Purged old records", zap.String("records", what), zap.Int64("count", count))
+	}
+}
+
+// JobStatuses lists the maintenance jobs with the outcome of their last run
+func JobStatuses(scheduler *jobs.Scheduler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"jobs": scheduler.Statuses()})
+	}
+}
+
+// JobMetrics serves the job statuses to Prometheus, which authenticates with the metrics token
+func JobMetrics(scheduler *jobs.Scheduler, token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provided := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if token == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid metrics token"})
+			return
+		}
+
+		c.Header("Content-Type", jobs.MetricsContentType)
+		c.Status(http.StatusOK)
+		if err := scheduler.WriteMetrics(c.Writer); err != nil {
+			c.Error(err)
+		}
+	}
+}
+
+// RunJob runs a maintenance job now and reports its result
+func RunJob(scheduler *jobs.Scheduler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		err := scheduler.RunNow(c.Request.Context(), c.Param("name"))
+		switch {
+		case errors.Is(err, jobs.ErrUnknownJob):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, jobs.ErrJobRunning):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusOK, gin.H{"status": "completed"})
+		}
+	}
+}
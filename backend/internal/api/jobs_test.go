@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/jobs"
+)
+
+func TestJobMetrics(t *testing.T) {
+	scheduler := jobs.NewScheduler(zap.NewNop(), 3)
+	scheduler.Register("purge", time.Hour, func(ctx context.Context) error { return nil })
+	scheduler.RunNow(context.Background(), "purge")
+
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		want          int
+	}{
+		{"correct token", "s3cret", "Bearer s3cret", http.StatusOK},
+		{"no token", "s3cret", "", http.StatusUnauthorized},
+		{"wrong token", "s3cret", "Bearer guess", http.StatusUnauthorized},
+		{"metrics disabled", "", "Bearer ", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics/jobs", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := serve(JobMetrics(scheduler, tt.token), req, uuid.Nil)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want != http.StatusOK {
+				if strings.Contains(w.Body.String(), "mynodecp_job") {
+					t.Errorf("metrics served without the token: %s", w.Body.String())
+				}
+				return
+			}
+			if w.Header().Get("Content-Type") != jobs.MetricsContentType {
+				t.Errorf("content type = %q", w.Header().Get("Content-Type"))
+			}
+			if !strings.Contains(w.Body.String(), `mynodecp_job_runs_total{job="purge"} 1`) {
+				t.Errorf("body lacks the run count:\n%s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRegisterJobsRetention(t *testing.T) {
+	registered := func(cfg *config.Config) map[string]bool {
+		scheduler := jobs.NewScheduler(zap.NewNop(), 3)
+		RegisterJobs(scheduler, &Services{}, cfg, zap.NewNop())
+		names := make(map[string]bool)
+		for _, status := range scheduler.Statuses() {
+			names[status.Name] = true
+		}
+		return names
+	}
+	purges := []string{"purge_sessions", "purge_metrics", "purge_security_events", "purge_old_backups", "purge_audit_logs", "purge_change_logs"}
+
+	// Unset retentions keep everything forever
+	names := registered(&config.Config{})
+	for _, name := range purges {
+		if names[name] {
+			t.Errorf("%s registered without a retention", name)
+		}
+	}
+
+	cfg := &config.Config{}
+	cfg.Jobs.SessionRetention = 30 * 24 * time.Hour
+	cfg.Jobs.BackupRetention = 90 * 24 * time.Hour
+	names = registered(cfg)
+	for name, want := range map[string]bool{"purge_sessions": true, "purge_old_backups": true, "purge_metrics": false, "purge_audit_logs": false} {
+		if names[name] != want {
+			t.Errorf("%s registered = %v, want %v", name, names[name], want)
+		}
+	}
+}
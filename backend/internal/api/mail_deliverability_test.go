@@ -0,0 +1,47 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+func TestMailDeliverabilityTestErrors(t *testing.T) {
+	db := newTestDB(t)
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	// A limit of none rejects every test before it makes any DNS query
+	email := services.NewEmailService(db, client, zap.NewNop(), config.MailConfig{DeliverabilityTestLimit: 0}, nil, nil)
+	owner := &models.User{Username: "owner", Email: "owner@example.net", PasswordHash: "x", IsActive: true}
+	db.Create(owner)
+	domain := &models.Domain{UserID: owner.ID, Name: "shop.example", DocumentRoot: "/var/www/shop.example/public_html"}
+	db.Create(domain)
+
+	tests := []struct {
+		name   string
+		id     string
+		userID uuid.UUID
+		want   int
+	}{
+		{"malformed domain id", "shop", owner.ID, http.StatusBadRequest},
+		{"unknown domain", uuid.NewString(), owner.ID, http.StatusNotFound},
+		{"another user's domain", domain.ID.String(), uuid.New(), http.StatusForbidden},
+		{"over the hourly limit", domain.ID.String(), owner.ID, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/domains/"+tt.id+"/mail/deliverability-test", nil)
+			if w := serveRoute("/domains/:id/mail/deliverability-test", MailDeliverabilityTest(email), req, tt.userID, "user"); w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+// MailSendHook is called by the MTA before it sends a message from a hosted mailbox. It counts the
+// message against the send limits and answers whether to accept it. The MTA authenticates with
+// the shared secret as a bearer token.
+func MailSendHook(email *services.EmailService, secret string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provided := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if secret == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(secret)) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid hook secret"})
+			return
+		}
+
+		var req struct {
+			Sender     string `json:"sender" binding:"required"`
+			Recipients int    `json:"recipients"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		decision, err := email.RecordSend(c.Request.Context(), req.Sender, req.Recipients)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to record send"})
+			return
+		}
+
+		c.JSON(http.StatusOK, decision)
+	}
+}
+
+// MailDeliveryHook is called by the MTA before it accepts a message for a hosted mailbox. It
+// answers whether to accept it, refusing disabled and suspended mailboxes and deferring mail for
+// mailboxes over quota. The MTA authenticates like for MailSendHook.
+func MailDeliveryHook(email *services.EmailService, secret string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provided := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if secret == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(secret)) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid hook secret"})
+			return
+		}
+
+		var req struct {
+			Recipient string `json:"recipient" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		decision, err := email.CheckDelivery(c.Request.Context(), req.Recipient)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to check delivery"})
+			return
+		}
+
+		c.JSON(http.StatusOK, decision)
+	}
+}
+
+// MailSendCounts returns the current send counts of a domain and its accounts
+func MailSendCounts(email *services.EmailService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		domainID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid domain id"})
+			return
+		}
+
+		counts, err := email.GetSendCounts(serviceContext(c), domainID)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, counts)
+	}
+}
+
+// MailResumeSending lifts the send suspension of an account (kind "accounts") or a domain
+// (kind "domains")
+func MailResumeSending(email *services.EmailService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+			return
+		}
+
+		ctx := serviceContext(c)
+		switch c.Param("kind") {
+		case "accounts":
+			err = email.ResumeAccountSending(ctx, id)
+		case "domains":
+			err = email.ResumeDomainSending(ctx, id)
+		default:
+			c.JSON(http.StatusNotFound, gin.H{"error": "unknown resource"})
+			return
+		}
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+func TestMailDeliveryHookRequiresSecret(t *testing.T) {
+	db := newTestDB(t)
+	email := services.NewEmailService(db, nil, zap.NewNop(), config.MailConfig{}, nil, nil)
+	router := gin.New()
+	router.POST("/mail/delivery-hook", MailDeliveryHook(email, "hook-secret"))
+
+	tests := []struct {
+		name   string
+		auth   string
+		status int
+	}{
+		{"no secret", "", http.StatusUnauthorized},
+		{"wrong secret", "Bearer guess", http.StatusUnauthorized},
+		{"secret", "Bearer hook-secret", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/mail/delivery-hook", strings.NewReader(`{"recipient":"someone@elsewhere.example"}`))
+			req.Header.Set("Authorization", tt.auth)
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			if resp.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", resp.Code, tt.status, resp.Body)
+			}
+		})
+	}
+}
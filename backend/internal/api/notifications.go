@@ -0,0 +1,91 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+// notificationPreferencesRequest is the body of setting notification preferences
+type notificationPreferencesRequest struct {
+	Preferences []models.NotificationPreference `json:"preferences"`
+}
+
+// NotificationPreferences returns how an account gets each type of notification
+func NotificationPreferences(notifications *services.NotificationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+
+		preferences, err := notifications.Preferences(serviceContext(c), userID)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"preferences": preferences})
+	}
+}
+
+// SetNotificationPreferences sets how an account gets the given types of notification
+func SetNotificationPreferences(notifications *services.NotificationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+
+		var req notificationPreferencesRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		preferences, err := notifications.SetPreferences(serviceContext(c), userID, req.Preferences)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"preferences": preferences})
+	}
+}
+
+// Notifications lists the caller's most recent notifications, newest first
+func Notifications(notifications *services.NotificationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, ok := caller(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		limit := 50
+		if value := c.Query("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 || parsed > 200 {
+				writeError(c, apperrors.InvalidCode("limit", "field.maximum", map[string]string{"max": "200"}))
+				return
+			}
+			limit = parsed
+		}
+
+		list, err := notifications.Notifications(serviceContext(c), userID, limit)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"notifications": list})
+	}
+}
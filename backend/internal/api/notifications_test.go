@@ -0,0 +1,104 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+func TestNotificationPreferences(t *testing.T) {
+	db := newTestDB(t)
+	notifications := services.NewNotificationService(db, zap.NewNop(), nil)
+	user := &models.User{Username: "owner", Email: "owner@example.net", PasswordHash: "x", IsActive: true}
+	db.Create(user)
+	path := "/users/" + user.ID.String() + "/notification-preferences"
+	route := "/users/:id/notification-preferences"
+
+	set := func(id, body string, userID uuid.UUID) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/users/"+id+"/notification-preferences", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return serveRoute(route, SetNotificationPreferences(notifications), req, userID, "user")
+	}
+
+	w := set(user.ID.String(), `{"preferences":[{"event_type":"quota_alert","channel":"email","frequency":"digest"}]}`, user.ID)
+	var body struct {
+		Preferences []models.NotificationPreference `json:"preferences"`
+	}
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &body) != nil || len(body.Preferences) != 3 {
+		t.Fatalf("set = %d: %s", w.Code, w.Body.String())
+	}
+
+	w = serveRoute(route, NotificationPreferences(notifications), httptest.NewRequest(http.MethodGet, path, nil), user.ID, "user")
+	body.Preferences = nil
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &body) != nil {
+		t.Fatalf("get = %d: %s", w.Code, w.Body.String())
+	}
+	for _, p := range body.Preferences {
+		if p.EventType == services.NotificationQuotaAlert && p.Frequency != services.NotificationDigest {
+			t.Errorf("quota alert preference = %+v", p)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		id     string
+		body   string
+		userID uuid.UUID
+		want   int
+	}{
+		{"malformed user id", "owner", `{"preferences":[]}`, user.ID, http.StatusBadRequest},
+		{"malformed body", user.ID.String(), `{"preferences":"digest"}`, user.ID, http.StatusBadRequest},
+		{"urgent as a digest", user.ID.String(), `{"preferences":[{"event_type":"security","channel":"email","frequency":"digest"}]}`, user.ID, http.StatusUnprocessableEntity},
+		{"another user's preferences", user.ID.String(), `{"preferences":[]}`, uuid.New(), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := set(tt.id, tt.body, tt.userID); w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestNotifications(t *testing.T) {
+	db := newTestDB(t)
+	notifications := services.NewNotificationService(db, zap.NewNop(), nil)
+	user := &models.User{Username: "owner", Email: "owner@example.net", PasswordHash: "x", IsActive: true}
+	db.Create(user)
+	for _, subject := range []string{"first", "second", "third"} {
+		subject := subject
+		if err := notifications.Notify(context.Background(), user.ID, services.NotificationQuotaAlert, func(string) (string, string) { return subject, "" }); err != nil {
+			t.Fatalf("Notify() error = %v", err)
+		}
+	}
+
+	list := func(query string, userID uuid.UUID) *httptest.ResponseRecorder {
+		return serve(Notifications(notifications), httptest.NewRequest(http.MethodGet, "/notifications"+query, nil), userID, "user")
+	}
+
+	w := list("?limit=2", user.ID)
+	var body struct {
+		Notifications []models.Notification `json:"notifications"`
+	}
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &body) != nil || len(body.Notifications) != 2 {
+		t.Fatalf("list = %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := list("", uuid.New()); w.Code != http.StatusOK || strings.Contains(w.Body.String(), "first") {
+		t.Errorf("another user's list = %d: %s", w.Code, w.Body.String())
+	}
+	for _, limit := range []string{"0", "201", "many"} {
+		if w := list("?limit="+limit, user.ID); w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("limit %s = %d, want 422", limit, w.Code)
+		}
+	}
+}
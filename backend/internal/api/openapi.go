@@ -0,0 +1,1175 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mynodecp/mynodecp/backend/internal/openapi"
+)
+
+// Request body schemas. Routes enforce them with middleware.ValidateJSON and the spec publishes
+// them, so the contract clients see is the one the server applies.
+var (
+	// RedirectSchema is the body of creating or replacing a redirect
+	RedirectSchema = openapi.Object(map[string]*openapi.Schema{
+		"source_path":    openapi.String(1, 255).Matching("^/").Describe(`Path to redirect; "/" redirects the whole domain`),
+		"target_url":     openapi.String(1, 2048).Describe("Absolute http(s) URL or a path on the same domain"),
+		"status_code":    (&openapi.Schema{Type: "integer", Enum: []interface{}{301, 302}}).Describe("Defaults to 301"),
+		"preserve_query": openapi.Boolean().Describe("Append the request's query string to the target"),
+	}, "source_path", "target_url")
+
+	// ProtectedDirectorySchema is the body of creating or changing a password protected directory
+	ProtectedDirectorySchema = openapi.Object(map[string]*openapi.Schema{
+		"path":  openapi.String(1, 255).Matching("^/").Describe(`URL path below the document root; "/" protects the whole site`),
+		"realm": openapi.String(0, 100).Describe(`Shown in the browser's login prompt; defaults to "Restricted"`),
+	}, "path")
+
+	// DirectoryUserSchema is the body of adding a login to a protected directory
+	DirectoryUserSchema = openapi.Object(map[string]*openapi.Schema{
+		"username": openapi.String(1, 64).Matching(`^[A-Za-z0-9._@-]+$`),
+		"password": openapi.String(8, 72),
+	}, "username", "password")
+
+	// DirectoryPasswordSchema is the body of changing the password of a protected directory's login
+	DirectoryPasswordSchema = openapi.Object(map[string]*openapi.Schema{
+		"password": openapi.String(8, 72),
+	}, "password")
+
+	// RegisterSchema is the body of registering an account
+	RegisterSchema = openapi.Object(map[string]*openapi.Schema{
+		"username":    openapi.String(1, 64),
+		"email":       openapi.String(3, 320),
+		"password":    openapi.String(1, 72).Describe("Checked against auth.password_policy"),
+		"first_name":  openapi.String(0, 100),
+		"last_name":   openapi.String(0, 100),
+		"locale":      openapi.String(0, 10).Describe("Language of the panel and of emails to the account"),
+		"invite_code": openapi.String(0, 64).Describe("Required while registration is invite-only"),
+	}, "username", "email", "password")
+
+	// DomainCreateSchema is the body of creating a domain
+	DomainCreateSchema = openapi.Object(map[string]*openapi.Schema{
+		"name":            openapi.String(3, 253),
+		"disk_quota":      openapi.Integer(0, 9007199254740991).Describe("Bytes; can only lower the package's quota, 0 keeps it"),
+		"bandwidth_quota": openapi.Integer(0, 9007199254740991).Describe("Bytes; can only lower the package's quota, 0 keeps it"),
+	}, "name")
+
+	// DomainCloneSchema is the body of cloning a domain's configuration
+	DomainCloneSchema = openapi.Object(map[string]*openapi.Schema{
+		"name":           openapi.String(3, 253).Describe("Name of the new domain"),
+		"email_accounts": openapi.Boolean().Describe("Create the source's email accounts as inactive stubs without passwords"),
+	}, "name")
+
+	// DomainRenameSchema is the body of renaming a domain
+	DomainRenameSchema = openapi.Object(map[string]*openapi.Schema{
+		"name": openapi.String(3, 253).Describe("New name of the domain"),
+	}, "name")
+
+	// DomainSuspendSchema is the body of suspending a domain
+	DomainSuspendSchema = openapi.Object(map[string]*openapi.Schema{
+		"reason": openapi.String(1, 255).Describe("Why the domain is suspended, such as non-payment; not shown to visitors"),
+	}, "reason")
+
+	// DomainPHPSchema is the body of setting a domain's PHP version, handler, extensions and error
+	// handling
+	DomainPHPSchema = openapi.Object(map[string]*openapi.Schema{
+		"version":        openapi.String(0, 10).Matching(`^(\d+\.\d+)?$`).Describe("PHP version such as 8.2; empty keeps the current one"),
+		"handler":        (&openapi.Schema{Type: "string", Enum: []interface{}{"fpm", "cgi"}}).Describe("Must also be enabled in hosting.php_handlers"),
+		"extensions":     (&openapi.Schema{Type: "array", Items: openapi.String(1, 64)}).Describe("Extensions loaded on top of the server's defaults"),
+		"display_errors": (&openapi.Schema{Type: "boolean"}).Describe("Show errors in responses; omitted keeps the current setting, off leaves the server's default"),
+		"log_errors":     (&openapi.Schema{Type: "boolean"}).Describe("Log errors to error_log; omitted keeps the current setting, off leaves the server's default"),
+		"error_log":      openapi.String(0, 255).Describe("Log file inside the domain's directory and outside its document roots; relative paths start at the directory, empty uses logs/php_error.log"),
+	}, "handler")
+
+	// LoginRestrictionsSchema is the body of setting where an account can log in from
+	LoginRestrictionsSchema = openapi.Object(map[string]*openapi.Schema{
+		"ip_ranges": (&openapi.Schema{Type: "array", Items: openapi.String(1, 64)}).Describe("CIDR ranges or single addresses; empty allows any address"),
+		"countries": (&openapi.Schema{Type: "array", Items: openapi.String(2, 2).Matching("^[A-Za-z]{2}$")}).Describe("ISO 3166 country codes; empty allows any country"),
+	})
+
+	// PasswordChangeSchema is the body of users changing their own password
+	PasswordChangeSchema = openapi.Object(map[string]*openapi.Schema{
+		"current_password": openapi.String(1, 256),
+		"new_password":     openapi.String(1, 256),
+	}, "current_password", "new_password")
+
+	// NotificationPreferencesSchema is the body of setting how an account gets notifications
+	NotificationPreferencesSchema = openapi.Object(map[string]*openapi.Schema{
+		"preferences": (&openapi.Schema{Type: "array", Items: openapi.Object(map[string]*openapi.Schema{
+			"event_type": (&openapi.Schema{Type: "string", Enum: []interface{}{"quota_alert", "php_deprecation", "security"}}),
+			"channel":    (&openapi.Schema{Type: "string", Enum: []interface{}{"email", "panel"}}).Describe("panel only lists the notification in the panel"),
+			"frequency":  (&openapi.Schema{Type: "string", Enum: []interface{}{"immediate", "digest", "off"}}).Describe("digest collects emails into one per mail.digest_interval"),
+		}, "event_type", "channel", "frequency")}).Describe("Types left out keep their preference; security is always emailed immediately"),
+	}, "preferences")
+
+	// VaultItemSchema is the body of storing a secret in the caller's vault
+	VaultItemSchema = openapi.Object(map[string]*openapi.Schema{
+		"name":   openapi.String(1, 128).Describe("Label shown in the list; stored unencrypted"),
+		"secret": openapi.String(0, 8192).Describe("Encrypted at rest and only returned when the item is opened"),
+		"notes":  openapi.String(0, 8192).Describe("Encrypted together with the secret"),
+	}, "name")
+
+	// VaultItemUpdateSchema is the body of updating a vault item; omitted fields are kept
+	VaultItemUpdateSchema = openapi.Object(map[string]*openapi.Schema{
+		"name":   openapi.String(1, 128),
+		"secret": openapi.String(0, 8192),
+		"notes":  openapi.String(0, 8192),
+	})
+
+	// AbuseReportSchema is the body of filing an abuse report
+	AbuseReportSchema = openapi.Object(map[string]*openapi.Schema{
+		"reporter_name":  openapi.String(0, 128),
+		"reporter_email": openapi.String(0, 254).Describe("Required on the public form, where there is no account to reach the reporter"),
+		"target":         openapi.String(1, 255).Describe("Reported domain or URL"),
+		"category":       openapi.String(1, 32).Describe("One of abuse.categories"),
+		"description":    openapi.String(1, 10000),
+	}, "target", "category", "description")
+
+	// AbuseReportUpdateSchema is the body of triaging an abuse report
+	AbuseReportUpdateSchema = openapi.Object(map[string]*openapi.Schema{
+		"status": {Type: "string", Enum: []interface{}{"open", "investigating", "resolved"}, Description: "Omit to only add a note"},
+		"note":   openapi.String(0, 10000),
+	})
+
+	// AbuseSuspendSchema is the body of suspending what an abuse report is about
+	AbuseSuspendSchema = openapi.Object(map[string]*openapi.Schema{
+		"scope": {Type: "string", Enum: []interface{}{"domain", "account"}, Description: "The reported domain, or its owner's account with all its domains"},
+		"note":  openapi.String(0, 10000),
+	}, "scope")
+
+	// DNSRecordCreateSchema is the body of creating a DNS record
+	DNSRecordCreateSchema = openapi.Object(map[string]*openapi.Schema{
+		"type":     (&openapi.Schema{Type: "string", Enum: []interface{}{"A", "AAAA", "CNAME", "MX", "TXT", "NS", "SRV", "CAA"}}),
+		"name":     openapi.String(1, 255),
+		"value":    openapi.String(1, 4096),
+		"ttl":      openapi.Integer(0, 2147483647).Describe("Seconds; 0 uses the zone's default, others are clamped to hosting.dns_min_ttl and dns_max_ttl"),
+		"priority": openapi.Integer(0, 65535).Describe("MX and SRV records"),
+	}, "type", "name", "value")
+
+	// DNSRecordUpdateSchema is the body of updating a DNS record; omitted fields are kept
+	DNSRecordUpdateSchema = openapi.Object(map[string]*openapi.Schema{
+		"type":      (&openapi.Schema{Type: "string", Enum: []interface{}{"A", "AAAA", "CNAME", "MX", "TXT", "NS", "SRV", "CAA"}}),
+		"name":      openapi.String(1, 255),
+		"value":     openapi.String(1, 4096),
+		"ttl":       openapi.Integer(1, 2147483647).Describe("Seconds; clamped to hosting.dns_min_ttl and dns_max_ttl"),
+		"priority":  openapi.Integer(0, 65535).Describe("MX and SRV records"),
+		"is_active": openapi.Boolean(),
+	})
+
+	// DNSBulkDeleteSchema is the body of bulk deleting DNS records
+	DNSBulkDeleteSchema = openapi.Object(map[string]*openapi.Schema{
+		"record_ids":    (&openapi.Schema{Type: "array", Items: openapi.UUID()}).Describe("Records of the domain to delete"),
+		"confirm_token": openapi.String(1, 64).Describe("Token from the preview; without it the deletion is only previewed"),
+		"force":         openapi.Boolean().Describe("Also delete apex, NS and SOA records"),
+	}, "record_ids")
+
+	// DNSSettingsSchema is the body of setting a domain's zone-wide DNS settings
+	DNSSettingsSchema = openapi.Object(map[string]*openapi.Schema{
+		"default_ttl": openapi.Integer(0, 2147483647).Describe("TTL of records created without one and the zone's $TTL; 0 uses the server's default"),
+	}, "default_ttl")
+
+	// BatchSchema is the body of running several changes in one transaction
+	BatchSchema = openapi.Object(map[string]*openapi.Schema{
+		"operations": (&openapi.Schema{Type: "array", Items: openapi.Object(map[string]*openapi.Schema{
+			"op":     (&openapi.Schema{Type: "string", Enum: []interface{}{"dns.create", "dns.update", "dns.delete", "redirect.create", "redirect.update", "redirect.delete", "domain.force_https"}}),
+			"id":     openapi.UUID().Describe("Domain for dns.create, redirect.create and domain.force_https; the record or redirect otherwise"),
+			"params": (&openapi.Schema{Type: "object"}).Describe("Fields of the matching single-resource request; domain.force_https takes enabled"),
+		}, "op", "id")}).Describe("Run in order; at most 100"),
+		"continue_on_error": openapi.Boolean().Describe("Commit the steps that succeed instead of rolling back on the first failure"),
+	}, "operations")
+
+	// CertificateUploadSchema is the body of inspecting certificate material
+	CertificateUploadSchema = openapi.Object(map[string]*openapi.Schema{
+		"certificate": (&openapi.Schema{Type: "string", Format: "byte"}).Describe("Base64 of a PEM bundle, DER certificates or a PKCS#12 bundle"),
+		"private_key": (&openapi.Schema{Type: "string", Format: "byte"}).Describe("Base64 of a PEM or DER key; omit when the bundle holds the key"),
+		"password":    openapi.String(0, 256).Describe("Password of a PKCS#12 bundle"),
+	}, "certificate")
+
+	// CertificateRequestSchema is the body of issuing a certificate for a domain
+	CertificateRequestSchema = openapi.Object(map[string]*openapi.Schema{
+		"names": (&openapi.Schema{Type: "array", Items: openapi.String(3, 253)}).Describe("Names to cover, the domain itself included: " +
+			"names below it and wildcards such as *.example.com, which are validated over DNS-01; at most 100. Defaults to the domain and its www name"),
+	})
+
+	// UploadSchema is the body of starting a resumable upload
+	UploadSchema = openapi.Object(map[string]*openapi.Schema{
+		"path": openapi.String(1, 1024).Describe("Target file, relative to the domain's directory"),
+		"size": openapi.Integer(1, 1<<53).Describe("Bytes the upload will send; must fit the domain's remaining disk quota"),
+	}, "path", "size")
+
+	// InviteSchema is the body of creating a registration invite code
+	InviteSchema = openapi.Object(map[string]*openapi.Schema{
+		"email":    openapi.String(3, 320).Describe("Only this address may register with the code"),
+		"max_uses": openapi.Integer(1, 1000).Describe("Accounts the code can create; defaults to 1"),
+		"ttl":      openapi.String(2, 32).Describe("Lifetime as a duration such as 72h; defaults to auth.invite_ttl"),
+	})
+
+	// MailSendHookSchema is the body the MTA posts before sending a message
+	MailSendHookSchema = openapi.Object(map[string]*openapi.Schema{
+		"sender":     openapi.String(3, 320).Describe("Hosted mailbox sending the message"),
+		"recipients": openapi.Integer(0, 10000).Describe("Number of recipients; counted as 1 when 0"),
+	}, "sender")
+
+	// MailDeliveryHookSchema is the body the MTA posts before accepting an incoming message
+	MailDeliveryHookSchema = openapi.Object(map[string]*openapi.Schema{
+		"recipient": openapi.String(3, 320).Describe("Hosted mailbox the message is for"),
+	}, "recipient")
+
+	// AuthFailureSchema is the body the MTA, FTP and SSH servers report a failed login with
+	AuthFailureSchema = openapi.Object(map[string]*openapi.Schema{
+		"source":     {Type: "string", Enum: []interface{}{"email", "ftp", "ssh"}},
+		"ip_address": openapi.String(2, 45).Describe("Client the login came from"),
+		"identity":   openapi.String(0, 320).Describe("Login name that was tried"),
+	}, "source", "ip_address")
+
+	// StatusNoticeSchema is the body of setting the status page notice
+	StatusNoticeSchema = openapi.Object(map[string]*openapi.Schema{
+		"notice": openapi.String(0, 2000).Describe("Incident note shown on the status page; empty removes it"),
+	}, "notice")
+)
+
+// Response schemas shared by several operations
+var (
+	errorSchema = openapi.Object(map[string]*openapi.Schema{
+		"error": (&openapi.Schema{Type: "string"}).Describe("Message in the caller's language"),
+		"code":  (&openapi.Schema{Type: "string"}).Describe("Message code, when the error has one"),
+	}, "error")
+	validationErrorSchema = openapi.Object(map[string]*openapi.Schema{
+		"error":  {Type: "string"},
+		"code":   {Type: "string"},
+		"errors": {Type: "object", Description: "Message per offending field"},
+	}, "errors")
+)
+
+// Spec builds the OpenAPI document for the HTTP endpoints served next to the gRPC gateway
+func Spec(version string) *openapi.Document {
+	doc := openapi.NewDocument("MyNodeCP API", version)
+	doc.Components.SecuritySchemes = map[string]openapi.SecurityScheme{
+		"bearerAuth":   {Type: "http", Scheme: "bearer", BearerFormat: "JWT", Description: "Access token from login"},
+		"sharedSecret": {Type: "http", Scheme: "bearer", Description: "Shared secret configured for an integration"},
+	}
+	doc.Security = []map[string][]string{{"bearerAuth": {}}}
+	public := []map[string][]string{}
+	integration := []map[string][]string{{"sharedSecret": {}}}
+
+	ok := func(description string, schema *openapi.Schema) map[string]openapi.Response {
+		return map[string]openapi.Response{
+			"200": openapi.JSONResponse(description, schema),
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+		}
+	}
+	withValidation := func(responses map[string]openapi.Response) map[string]openapi.Response {
+		responses["400"] = openapi.JSONResponse("Malformed JSON", errorSchema)
+		responses["422"] = openapi.JSONResponse("Body does not match the schema", validationErrorSchema)
+		return responses
+	}
+	query := func(name, description string, schema *openapi.Schema) openapi.Parameter {
+		return openapi.Parameter{Name: name, In: "query", Description: description, Schema: schema}
+	}
+	header := func(name, description string) openapi.Parameter {
+		return openapi.Parameter{Name: name, In: "header", Description: description, Schema: &openapi.Schema{Type: "string"}}
+	}
+	ifNoneMatch := header("If-None-Match", "ETag of a copy the client holds; answered with 304 while it is current")
+	ifMatch := header("If-Match", "ETag the change is based on; the change is refused with 412 when the resource has changed since")
+	notModified := openapi.Response{Description: "Not modified since the ETag in If-None-Match"}
+	modified := openapi.JSONResponse("Changed since the ETag in If-Match; the current ETag is returned", errorSchema)
+
+	doc.Add("GET", "/health", &openapi.Operation{
+		Summary:   "Service health",
+		Tags:      []string{"system"},
+		Security:  &public,
+		Responses: map[string]openapi.Response{"200": openapi.JSONResponse("Healthy", nil)},
+	})
+	doc.Add("GET", "/status", &openapi.Operation{
+		Summary:  "Public status of the hosting services",
+		Tags:     []string{"system"},
+		Security: &public,
+		Responses: map[string]openapi.Response{
+			"200": openapi.JSONResponse("Overall and per-component status with the current notice", openapi.Object(map[string]*openapi.Schema{
+				"status":     {Type: "string", Enum: []interface{}{"operational", "unknown", "degraded", "outage"}},
+				"components": {Type: "array", Description: "Name and status of each published component"},
+				"notice":     {Type: "string"},
+				"updated_at": {Type: "string", Format: "date-time"},
+			})),
+			"429": openapi.JSONResponse("Too many requests", errorSchema),
+		},
+	})
+	doc.Add("PUT", "/admin/status/notice", &openapi.Operation{
+		Summary:     "Set or clear the status page notice (admin)",
+		Tags:        []string{"admin"},
+		RequestBody: openapi.JSONBody(StatusNoticeSchema),
+		Responses: withValidation(map[string]openapi.Response{
+			"204": {Description: "Notice updated"},
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+		}),
+	})
+	doc.Add("GET", "/openapi.json", &openapi.Operation{
+		Summary:   "This document",
+		Tags:      []string{"system"},
+		Security:  &public,
+		Responses: map[string]openapi.Response{"200": openapi.JSONResponse("OpenAPI document", nil)},
+	})
+	doc.Add("POST", "/csp-report", &openapi.Operation{
+		Summary:   "Receive browser Content-Security-Policy violation reports",
+		Tags:      []string{"system"},
+		Security:  &public,
+		Responses: map[string]openapi.Response{"204": {Description: "Report accepted"}},
+	})
+	doc.Add("GET", "/admin/csp-violations", &openapi.Operation{
+		Summary:    "Recent CSP violations (admin)",
+		Tags:       []string{"admin"},
+		Parameters: []openapi.Parameter{query("limit", "Maximum number of violations", openapi.Integer(1, 1000))},
+		Responses:  ok("Violations, newest first", nil),
+	})
+
+	auditParameters := []openapi.Parameter{
+		query("kind", "Log to read", &openapi.Schema{Type: "string", Enum: []interface{}{"audit", "security"}}),
+		query("user_id", "Only rows of this user", openapi.UUID()),
+		query("action", "Audit action or security event type", &openapi.Schema{Type: "string"}),
+		query("resource", "Audit resource or security event source", &openapi.Schema{Type: "string"}),
+		query("severity", "Security events only", &openapi.Schema{Type: "string"}),
+		query("success", "Audit logs only", openapi.Boolean()),
+		query("from", "RFC 3339 timestamp, inclusive", &openapi.Schema{Type: "string", Format: "date-time"}),
+		query("to", "RFC 3339 timestamp, exclusive", &openapi.Schema{Type: "string", Format: "date-time"}),
+		query("limit", "Page size, or row cap of an export", &openapi.Schema{Type: "integer"}),
+	}
+	doc.Add("GET", "/admin/audit", &openapi.Operation{
+		Summary:    "Page through audit logs or security events (admin)",
+		Tags:       []string{"admin"},
+		Parameters: append(auditParameters, query("cursor", "Cursor returned by the previous page", &openapi.Schema{Type: "string"})),
+		Responses:  ok("Rows and the next cursor", nil),
+	})
+	doc.Add("GET", "/audit", &openapi.Operation{
+		Summary:    "Page through the caller's own audit logs and security events",
+		Tags:       []string{"users"},
+		Parameters: append(auditParameters, query("cursor", "Cursor returned by the previous page", &openapi.Schema{Type: "string"})),
+		Responses: map[string]openapi.Response{
+			"200": openapi.JSONResponse("Rows about the caller's account and resources, and the next cursor", nil),
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+			"403": openapi.JSONResponse("user_id names another user", errorSchema),
+		},
+	})
+	doc.Add("GET", "/admin/audit/export", &openapi.Operation{
+		Summary:    "Export audit logs or security events as CSV or JSON (admin)",
+		Tags:       []string{"admin"},
+		Parameters: append(auditParameters, query("format", "Defaults to csv", &openapi.Schema{Type: "string", Enum: []interface{}{"csv", "json"}})),
+		Responses:  ok("Exported rows", nil),
+	})
+
+	doc.Add("GET", "/admin/audit/changes/:resource/:id", &openapi.Operation{
+		Summary: "Recorded changes of one resource, newest first (admin)",
+		Tags:    []string{"admin"},
+		Parameters: []openapi.Parameter{
+			{Name: "resource", In: "path", Required: true, Description: "Table name, such as domains or dns_records", Schema: &openapi.Schema{Type: "string"}},
+			query("limit", "Maximum number of changes", openapi.Integer(1, 1000)),
+		},
+		Responses: ok("Changes with before/after values per column", nil),
+	})
+
+	doc.Add("GET", "/admin/invites", &openapi.Operation{
+		Summary:   "Registration invite codes (admin)",
+		Tags:      []string{"admin"},
+		Responses: ok("Invites, newest first", nil),
+	})
+	doc.Add("POST", "/auth/register", &openapi.Operation{
+		Summary:     "Register an account, subject to auth.registration_mode",
+		Tags:        []string{"users"},
+		RequestBody: openapi.JSONBody(RegisterSchema),
+		Responses: withValidation(map[string]openapi.Response{
+			"201": openapi.JSONResponse("The account and the onboarding steps that ran", nil),
+			"403": openapi.JSONResponse("Registration is closed", errorSchema),
+		}),
+	})
+	doc.Add("POST", "/admin/invites", &openapi.Operation{
+		Summary:     "Create a registration invite code (admin)",
+		Tags:        []string{"admin"},
+		RequestBody: openapi.JSONBody(InviteSchema),
+		Responses: withValidation(map[string]openapi.Response{
+			"201": openapi.JSONResponse("The code, shown only once, and the invite", nil),
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+		}),
+	})
+	doc.Add("DELETE", "/admin/invites/:id", &openapi.Operation{
+		Summary:   "Revoke a registration invite code (admin)",
+		Tags:      []string{"admin"},
+		Responses: map[string]openapi.Response{"204": {Description: "Revoked"}},
+	})
+
+	doc.Add("GET", "/quota-alerts", &openapi.Operation{
+		Summary:    "Quota alerts of the current cycle",
+		Tags:       []string{"quotas"},
+		Parameters: []openapi.Parameter{query("owner_id", "Admins only: alerts of this user", openapi.UUID())},
+		Responses:  ok("Alerts", nil),
+	})
+	doc.Add("GET", "/domains/quota-defaults", &openapi.Operation{
+		Summary:    "Quotas new domains receive under the caller's package",
+		Tags:       []string{"domains"},
+		Parameters: []openapi.Parameter{query("user_id", "Admins only: look up this user", openapi.UUID())},
+		Responses: ok("Quotas in bytes", openapi.Object(map[string]*openapi.Schema{
+			"disk_quota":      {Type: "integer"},
+			"bandwidth_quota": {Type: "integer"},
+		})),
+	})
+	doc.Add("GET", "/databases/usage", &openapi.Operation{
+		Summary:    "Storage used by the caller's databases against the database quotas",
+		Tags:       []string{"databases", "quotas"},
+		Parameters: []openapi.Parameter{query("user_id", "Admins only: look up this user", openapi.UUID())},
+		Responses: ok("Usage in megabytes; a quota of 0 is unlimited", openapi.Object(map[string]*openapi.Schema{
+			"user_id":    openapi.UUID(),
+			"used_mb":    {Type: "integer"},
+			"quota_mb":   {Type: "integer"},
+			"over_quota": openapi.Boolean(),
+			"databases":  {Type: "array", Description: "id, name, domain_id, size_mb, quota_mb, over_quota and blocked_at of each database"},
+		})),
+	})
+
+	doc.Add("POST", "/domains", &openapi.Operation{
+		Summary:     "Create a domain owned by the caller, with the quotas of their package",
+		Tags:        []string{"domains"},
+		RequestBody: openapi.JSONBody(DomainCreateSchema),
+		Responses: withValidation(map[string]openapi.Response{
+			"201": openapi.JSONResponse("Created domain", nil),
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+		}),
+	})
+
+	doc.Add("POST", "/domains/:id/clone", &openapi.Operation{
+		Summary:     "Create a domain with the DNS records, PHP settings and subdomains of this one",
+		Tags:        []string{"domains"},
+		RequestBody: openapi.JSONBody(DomainCloneSchema),
+		Responses: withValidation(map[string]openapi.Response{
+			"201": openapi.JSONResponse("Created domain", nil),
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+			"404": openapi.JSONResponse("Domain not found", errorSchema),
+			"409": openapi.JSONResponse("Another operation is running on the domain", errorSchema),
+		}),
+	})
+
+	doc.Add("POST", "/domains/:id/rename", &openapi.Operation{
+		Summary:     "Rename a domain, moving its content, document roots, DNS records, vhosts and zone; certificates are deactivated",
+		Tags:        []string{"domains"},
+		RequestBody: openapi.JSONBody(DomainRenameSchema),
+		Responses: withValidation(map[string]openapi.Response{
+			"200": openapi.JSONResponse("Renamed domain", nil),
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+			"403": openapi.JSONResponse("Not the caller's domain", errorSchema),
+			"404": openapi.JSONResponse("Domain not found", errorSchema),
+			"409": openapi.JSONResponse("A directory of the new name already exists, or another operation is running on the domain", errorSchema),
+		}),
+	})
+
+	doc.Add("GET", "/domains/:id", &openapi.Operation{
+		Summary:    "A domain with its subdomains, DNS records and certificates, with its ETag",
+		Tags:       []string{"domains"},
+		Parameters: []openapi.Parameter{ifNoneMatch},
+		Responses: map[string]openapi.Response{
+			"200": openapi.JSONResponse("Domain", nil),
+			"304": notModified,
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+			"404": openapi.JSONResponse("Domain not found", errorSchema),
+		},
+	})
+
+	doc.Add("PUT", "/domains/:id/php", &openapi.Operation{
+		Summary:     "Set a domain's PHP version, handler, extensions and error handling, regenerating its handler configuration",
+		Tags:        []string{"domains"},
+		Parameters:  []openapi.Parameter{ifMatch},
+		RequestBody: openapi.JSONBody(DomainPHPSchema),
+		Responses: withValidation(map[string]openapi.Response{
+			"200": openapi.JSONResponse("Updated domain", nil),
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+			"404": openapi.JSONResponse("Domain not found", errorSchema),
+			"409": openapi.JSONResponse("Another operation is running on the domain", errorSchema),
+			"412": modified,
+		}),
+	})
+
+	doc.Add("POST", "/domains/:id/php/opcache-reset", &openapi.Operation{
+		Summary: "Clear the opcache of a domain's PHP processes; on the shared pool of its version, every domain on it is cleared",
+		Tags:    []string{"domains"},
+		Responses: map[string]openapi.Response{
+			"204": {Description: "Opcache cleared"},
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+			"403": openapi.JSONResponse("Not the domain's owner", errorSchema),
+			"404": openapi.JSONResponse("Domain not found", errorSchema),
+			"409": openapi.JSONResponse("Opcache resets are not enabled", errorSchema),
+		},
+	})
+
+	doc.Add("GET", "/users/:id", &openapi.Operation{
+		Summary:    "An account with its roles, with its ETag (own account, or any for admins)",
+		Tags:       []string{"users"},
+		Parameters: []openapi.Parameter{ifNoneMatch},
+		Responses: map[string]openapi.Response{
+			"200": openapi.JSONResponse("User", nil),
+			"304": notModified,
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+			"403": openapi.JSONResponse("Not the caller's account", errorSchema),
+			"404": openapi.JSONResponse("User not found", errorSchema),
+		},
+	})
+	doc.Add("GET", "/users/:id/capabilities", &openapi.Operation{
+		Summary: "Features available to an account per its roles' permissions, and its package limits (own account, or any for admins)",
+		Tags:    []string{"users"},
+		Responses: map[string]openapi.Response{
+			"200": openapi.JSONResponse("Capabilities", nil),
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+			"403": openapi.JSONResponse("Not the caller's account", errorSchema),
+			"404": openapi.JSONResponse("User not found", errorSchema),
+		},
+	})
+	doc.Add("PUT", "/users/:id/login-restrictions", &openapi.Operation{
+		Summary:     "Set the IP ranges and countries an account can log in from",
+		Tags:        []string{"users", "security"},
+		Parameters:  []openapi.Parameter{ifMatch},
+		RequestBody: openapi.JSONBody(LoginRestrictionsSchema),
+		Responses: withValidation(map[string]openapi.Response{
+			"200": openapi.JSONResponse("Updated user", nil),
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+			"403": openapi.JSONResponse("Not the caller's account", errorSchema),
+			"404": openapi.JSONResponse("User not found", errorSchema),
+			"412": modified,
+		}),
+	})
+
+	doc.Add("PUT", "/users/:id/password", &openapi.Operation{
+		Summary:     "Change the caller's own password; allowed once it expired, then refresh the token",
+		Tags:        []string{"users", "security"},
+		RequestBody: openapi.JSONBody(PasswordChangeSchema),
+		Responses: withValidation(map[string]openapi.Response{
+			"204": {Description: "Password changed"},
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+			"403": openapi.JSONResponse("Not the caller's account", errorSchema),
+		}),
+	})
+
+	doc.Add("GET", "/users/:id/notification-preferences", &openapi.Operation{
+		Summary: "How an account gets each type of notification (own account, or any for admins)",
+		Tags:    []string{"users", "notifications"},
+		Responses: map[string]openapi.Response{
+			"200": openapi.JSONResponse("Channel and frequency per event type", nil),
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+			"403": openapi.JSONResponse("Not the caller's account", errorSchema),
+		},
+	})
+
+	doc.Add("PUT", "/users/:id/notification-preferences", &openapi.Operation{
+		Summary:     "Set how an account gets notifications: emailed immediately, in a digest, only in the panel, or not at all",
+		Tags:        []string{"users", "notifications"},
+		RequestBody: openapi.JSONBody(NotificationPreferencesSchema),
+		Responses: withValidation(map[string]openapi.Response{
+			"200": openapi.JSONResponse("Preferences of every event type", nil),
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+			"403": openapi.JSONResponse("Not the caller's account", errorSchema),
+		}),
+	})
+
+	doc.Add("GET", "/notifications", &openapi.Operation{
+		Summary:    "The caller's recent notifications, newest first",
+		Tags:       []string{"notifications"},
+		Parameters: []openapi.Parameter{query("limit", "Maximum number of notifications, 50 by default", openapi.Integer(1, 200))},
+		Responses: withValidation(map[string]openapi.Response{
+			"200": openapi.JSONResponse("Notifications", nil),
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+		}),
+	})
+
+	doc.Add("GET", "/vault", &openapi.Operation{
+		Summary: "List the names of the caller's vault items, without their secrets",
+		Tags:    []string{"vault"},
+		Responses: map[string]openapi.Response{
+			"200": openapi.JSONResponse("Vault items", nil),
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+		},
+	})
+	doc.Add("POST", "/vault", &openapi.Operation{
+		Summary:     "Store a secret in the caller's vault, encrypted for the caller only",
+		Tags:        []string{"vault"},
+		RequestBody: openapi.JSONBody(VaultItemSchema),
+		Responses: withValidation(map[string]openapi.Response{
+			"201": openapi.JSONResponse("Created vault item with its secret and notes", nil),
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+			"409": openapi.JSONResponse("No encryption key is configured, or the vault is full", errorSchema),
+		}),
+	})
+	doc.Add("GET", "/vault/:id", &openapi.Operation{
+		Summary: "Open one of the caller's vault items; items of other accounts are not found, for admins too",
+		Tags:    []string{"vault"},
+		Responses: map[string]openapi.Response{
+			"200": openapi.JSONResponse("Vault item with its secret and notes", nil),
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+			"404": openapi.JSONResponse("Vault item not found", errorSchema),
+			"409": openapi.JSONResponse("No encryption key is configured", errorSchema),
+		},
+	})
+	doc.Add("PUT", "/vault/:id", &openapi.Operation{
+		Summary:     "Change the name, secret or notes of one of the caller's vault items",
+		Tags:        []string{"vault"},
+		RequestBody: openapi.JSONBody(VaultItemUpdateSchema),
+		Responses: withValidation(map[string]openapi.Response{
+			"200": openapi.JSONResponse("Updated vault item with its secret and notes", nil),
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+			"404": openapi.JSONResponse("Vault item not found", errorSchema),
+			"409": openapi.JSONResponse("No encryption key is configured", errorSchema),
+		}),
+	})
+	doc.Add("DELETE", "/vault/:id", &openapi.Operation{
+		Summary: "Delete one of the caller's vault items",
+		Tags:    []string{"vault"},
+		Responses: map[string]openapi.Response{
+			"204": {Description: "Deleted"},
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+			"404": openapi.JSONResponse("Vault item not found", errorSchema),
+		},
+	})
+
+	doc.Add("POST", "/abuse-reports", &openapi.Operation{
+		Summary:     "Report abuse of a domain or URL",
+		Tags:        []string{"abuse"},
+		RequestBody: openapi.JSONBody(AbuseReportSchema),
+		Responses: withValidation(map[string]openapi.Response{
+			"201": openapi.JSONResponse("ID and status of the filed report", nil),
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+		}),
+	})
+	doc.Add("POST", "/abuse-reports/public", &openapi.Operation{
+		Summary:     "Report abuse without an account, when abuse.public_form is enabled; limited per IP",
+		Tags:        []string{"abuse"},
+		Security:    &public,
+		RequestBody: openapi.JSONBody(AbuseReportSchema),
+		Responses: withValidation(map[string]openapi.Response{
+			"201": openapi.JSONResponse("ID and status of the filed report", nil),
+			"429": openapi.JSONResponse("Too many requests", errorSchema),
+		}),
+	})
+	doc.Add("GET", "/admin/abuse-reports", &openapi.Operation{
+		Summary: "Page through abuse reports, newest first (admin)",
+		Tags:    []string{"abuse", "admin"},
+		Parameters: []openapi.Parameter{
+			query("status", "Only reports with this status", &openapi.Schema{Type: "string", Enum: []interface{}{"open", "investigating", "resolved"}}),
+			query("cursor", "Cursor returned by the previous page", &openapi.Schema{Type: "string"}),
+			query("limit", "Maximum number of reports", openapi.Integer(1, 1000)),
+		},
+		Responses: ok("Reports and the next cursor", nil),
+	})
+	doc.Add("GET", "/admin/abuse-reports/:id", &openapi.Operation{
+		Summary:   "An abuse report with its notes and actions (admin)",
+		Tags:      []string{"abuse", "admin"},
+		Responses: ok("Abuse report", nil),
+	})
+	doc.Add("PUT", "/admin/abuse-reports/:id", &openapi.Operation{
+		Summary:     "Move an abuse report to another status or add a note (admin)",
+		Tags:        []string{"abuse", "admin"},
+		RequestBody: openapi.JSONBody(AbuseReportUpdateSchema),
+		Responses: withValidation(map[string]openapi.Response{
+			"200": openapi.JSONResponse("Updated abuse report", nil),
+			"404": openapi.JSONResponse("Abuse report not found", errorSchema),
+			"409": openapi.JSONResponse("The report cannot move to that status", errorSchema),
+		}),
+	})
+	doc.Add("POST", "/admin/abuse-reports/:id/suspend", &openapi.Operation{
+		Summary:     "Suspend the reported domain or its owner's account, recorded on the report (admin)",
+		Tags:        []string{"abuse", "admin"},
+		RequestBody: openapi.JSONBody(AbuseSuspendSchema),
+		Responses: withValidation(map[string]openapi.Response{
+			"200": openapi.JSONResponse("Updated abuse report", nil),
+			"404": openapi.JSONResponse("Abuse report not found", errorSchema),
+			"409": openapi.JSONResponse("The report is not about a domain hosted here", errorSchema),
+		}),
+	})
+
+	doc.Add("GET", "/users/:id/usage/export", &openapi.Operation{
+		Summary: "Download the usage of an account's domains during a month, for billing (own account, or any for admins)",
+		Tags:    []string{"users", "quotas"},
+		Parameters: []openapi.Parameter{
+			query("month", "Billing month as YYYY-MM (UTC); defaults to the current one", &openapi.Schema{Type: "string", Pattern: `^\d{4}-\d{2}$`}),
+			query("format", "Download format, csv by default", &openapi.Schema{Type: "string", Enum: []interface{}{"csv", "json"}}),
+		},
+		Responses: map[string]openapi.Response{
+			"200": {Description: "Per domain: samples, disk peak and average, bandwidth, and peak mailbox and database counts and sizes"},
+			"400": openapi.JSONResponse("Malformed month or unsupported format", errorSchema),
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+			"403": openapi.JSONResponse("Not the caller's account", errorSchema),
+		},
+	})
+
+	doc.Add("GET", "/dns-records/:id", &openapi.Operation{
+		Summary:    "A DNS record with its ETag",
+		Tags:       []string{"dns"},
+		Parameters: []openapi.Parameter{ifNoneMatch},
+		Responses: map[string]openapi.Response{
+			"200": openapi.JSONResponse("DNS record", nil),
+			"304": notModified,
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+			"404": openapi.JSONResponse("DNS record not found", errorSchema),
+		},
+	})
+	doc.Add("POST", "/domains/:id/dns-records", &openapi.Operation{
+		Summary:     "Add a DNS record to a domain and rewrite its zone",
+		Tags:        []string{"dns"},
+		RequestBody: openapi.JSONBody(DNSRecordCreateSchema),
+		Responses: withValidation(map[string]openapi.Response{
+			"201": openapi.JSONResponse("Created DNS record", nil),
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+			"403": openapi.JSONResponse("Not the caller's domain, or custom DNS is disabled for it", errorSchema),
+			"404": openapi.JSONResponse("Domain not found", errorSchema),
+		}),
+	})
+
+	doc.Add("PUT", "/dns-records/:id", &openapi.Operation{
+		Summary:     "Update a DNS record and rewrite its zone",
+		Tags:        []string{"dns"},
+		Parameters:  []openapi.Parameter{ifMatch},
+		RequestBody: openapi.JSONBody(DNSRecordUpdateSchema),
+		Responses: withValidation(map[string]openapi.Response{
+			"200": openapi.JSONResponse("Updated DNS record", nil),
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+			"404": openapi.JSONResponse("DNS record not found", errorSchema),
+			"412": modified,
+		}),
+	})
+
+	doc.Add("POST", "/domains/:id/dns-records/bulk-delete", &openapi.Operation{
+		Summary:     "Preview deleting DNS records, or delete them with the preview's confirm token",
+		Tags:        []string{"dns"},
+		RequestBody: openapi.JSONBody(DNSBulkDeleteSchema),
+		Responses: withValidation(map[string]openapi.Response{
+			"200": openapi.JSONResponse("Records to be deleted with a confirm token, or the deleted records", nil),
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+			"403": openapi.JSONResponse("Not the caller's domain", errorSchema),
+			"404": openapi.JSONResponse("Domain or DNS record not found", errorSchema),
+		}),
+	})
+
+	doc.Add("PUT", "/domains/:id/dns-settings", &openapi.Operation{
+		Summary:     "Set a domain's default DNS TTL, raising its SOA serial",
+		Tags:        []string{"dns"},
+		RequestBody: openapi.JSONBody(DNSSettingsSchema),
+		Responses: withValidation(map[string]openapi.Response{
+			"200": openapi.JSONResponse("Updated domain", nil),
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+			"403": openapi.JSONResponse("Not the caller's domain, or custom DNS not enabled", errorSchema),
+			"404": openapi.JSONResponse("Domain not found", errorSchema),
+		}),
+	})
+
+	doc.Add("GET", "/domains/:id/dns-health", &openapi.Operation{
+		Summary: "Check a domain's whole zone: record syntax, CNAME targets, delegation, propagation of the apex, and the MX, SPF, DKIM and DMARC records",
+		Tags:    []string{"dns"},
+		Responses: map[string]openapi.Response{
+			"200": openapi.JSONResponse("Zone health report, errors first", openapi.Object(map[string]*openapi.Schema{
+				"domain":   {Type: "string"},
+				"healthy":  (&openapi.Schema{Type: "boolean"}).Describe("No finding is an error"),
+				"errors":   {Type: "integer"},
+				"warnings": {Type: "integer"},
+				"findings": {Type: "array", Items: openapi.Object(map[string]*openapi.Schema{
+					"check":     {Type: "string", Enum: []interface{}{"syntax", "cname", "ns", "apex", "mx", "spf", "dkim", "dmarc", "lookup"}},
+					"severity":  {Type: "string", Enum: []interface{}{"error", "warning", "info"}},
+					"name":      (&openapi.Schema{Type: "string"}).Describe("Owner name relative to the zone, @ at the apex"),
+					"record_id": {Type: "string", Format: "uuid"},
+					"message":   {Type: "string"},
+				})},
+				"checked_at": {Type: "string", Format: "date-time"},
+			})),
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+			"403": openapi.JSONResponse("Not the caller's domain", errorSchema),
+			"404": openapi.JSONResponse("Domain not found", errorSchema),
+		},
+	})
+
+	doc.Add("POST", "/batch", &openapi.Operation{
+		Summary:     "Run DNS, redirect and domain changes in order in one transaction",
+		Tags:        []string{"dns", "domains"},
+		RequestBody: openapi.JSONBody(BatchSchema),
+		Responses: withValidation(map[string]openapi.Response{
+			"200": openapi.JSONResponse("The batch was committed; the outcome of each step", openapi.Object(map[string]*openapi.Schema{
+				"committed": openapi.Boolean(),
+				"operations": {Type: "array", Items: openapi.Object(map[string]*openapi.Schema{
+					"index":  {Type: "integer"},
+					"op":     {Type: "string"},
+					"status": {Type: "string", Enum: []interface{}{"ok", "failed", "rolled_back", "skipped"}},
+					"result": {Type: "object", Description: "Resource the step created or changed"},
+					"error":  {Type: "string", Description: "Why the step failed"},
+					"code":   {Type: "string"},
+					"errors": {Type: "object", Description: "Message per offending field of a failed step"},
+				})},
+			})),
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+			"403": openapi.JSONResponse("A step touched a resource of another user and the batch was rolled back", errorSchema),
+			"404": openapi.JSONResponse("A step's resource was not found and the batch was rolled back", errorSchema),
+			"409": openapi.JSONResponse("A step's precondition failed and the batch was rolled back", errorSchema),
+		}),
+	})
+
+	doc.Add("POST", "/ssl/inspect", &openapi.Operation{
+		Summary:     "Detect an uploaded certificate's format and convert it to PEM",
+		Tags:        []string{"ssl"},
+		RequestBody: openapi.JSONBody(CertificateUploadSchema),
+		Responses: withValidation(ok("Detected format (pem, der or pkcs12), the certificate and chain as PEM, and the names and expiry", openapi.Object(map[string]*openapi.Schema{
+			"format":      {Type: "string", Enum: []interface{}{"pem", "der", "pkcs12"}},
+			"certificate": {Type: "string"},
+			"chain":       {Type: "string"},
+			"names":       {Type: "array", Items: &openapi.Schema{Type: "string"}},
+			"expires_at":  {Type: "string", Format: "date-time"},
+		}))),
+	})
+
+	doc.Add("POST", "/domains/:id/certificates", &openapi.Operation{
+		Summary:     "Issue a certificate for a domain from the ACME server and install it",
+		Tags:        []string{"ssl"},
+		RequestBody: openapi.JSONBody(CertificateRequestSchema),
+		Responses: map[string]openapi.Response{
+			"201": openapi.JSONResponse("The installed certificate with the names it covers; it replaces the domain's active certificate", openapi.Object(map[string]*openapi.Schema{
+				"id":         openapi.UUID(),
+				"type":       {Type: "string", Enum: []interface{}{"letsencrypt"}},
+				"names":      {Type: "array", Items: &openapi.Schema{Type: "string"}},
+				"is_active":  {Type: "boolean"},
+				"expires_at": {Type: "string", Format: "date-time"},
+			})),
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+			"403": openapi.JSONResponse("Not the domain's owner", errorSchema),
+			"404": openapi.JSONResponse("Domain not found", errorSchema),
+			"409": openapi.JSONResponse("No ACME server configured, domain ownership not verified, a challenge failed, or another operation is running on the domain", errorSchema),
+			"422": openapi.JSONResponse("A name is outside the domain, or the domain itself is missing", validationErrorSchema),
+		},
+	})
+
+	doc.Add("GET", "/domains/:id/stats", &openapi.Operation{
+		Summary: "Usage and resource counts of a domain, with a warning when its PHP version is deprecated",
+		Tags:    []string{"domains"},
+		Responses: map[string]openapi.Response{
+			"200": openapi.JSONResponse("Domain statistics", &openapi.Schema{Type: "object", Properties: map[string]*openapi.Schema{
+				"php_version": {Type: "string"},
+				"php_deprecation": {Type: "object", Description: "Present while the PHP version is deprecated: version, removed_at, " +
+					"removed (no longer selectable) and the suggested replacement"},
+			}}),
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+			"403": openapi.JSONResponse("Not the domain's owner", errorSchema),
+			"404": openapi.JSONResponse("Domain not found", errorSchema),
+		},
+	})
+
+	uploadOffset := header("Upload-Offset", "Offset the chunk starts at: the bytes the upload has received so far")
+	uploadOffset.Required = true
+	doc.Add("POST", "/domains/:id/uploads", &openapi.Operation{
+		Summary:     "Start a resumable upload into a domain's directory, sent in chunks afterwards",
+		Tags:        []string{"files"},
+		RequestBody: openapi.JSONBody(UploadSchema),
+		Responses: withValidation(map[string]openapi.Response{
+			"201": openapi.JSONResponse("Upload with its id, expiring upload_ttl after its last chunk", nil),
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+			"404": openapi.JSONResponse("Domain not found", errorSchema),
+			"409": openapi.JSONResponse("The domain is over its disk quota, or the upload does not fit it", errorSchema),
+		}),
+	})
+	doc.Add("GET", "/uploads/:id", &openapi.Operation{
+		Summary: "An upload with the offset to resume it from, also in the Upload-Offset header",
+		Tags:    []string{"files"},
+		Responses: map[string]openapi.Response{
+			"200": openapi.JSONResponse("Upload", nil),
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+			"404": openapi.JSONResponse("Upload not found or expired", errorSchema),
+		},
+	})
+	doc.Add("PATCH", "/uploads/:id", &openapi.Operation{
+		Summary: "Append a chunk to an upload. Data received before an interruption is kept; the chunk completing " +
+			"the upload moves the file into place.",
+		Tags:       []string{"files"},
+		Parameters: []openapi.Parameter{uploadOffset},
+		RequestBody: &openapi.RequestBody{Required: true, Content: map[string]openapi.MediaType{
+			"application/offset+octet-stream": {Schema: &openapi.Schema{Type: "string", Format: "binary"}},
+		}},
+		Responses: withValidation(map[string]openapi.Response{
+			"200": openapi.JSONResponse("Upload with its new offset, completed once all bytes are in", nil),
+			"400": openapi.JSONResponse("Missing or malformed Upload-Offset", errorSchema),
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+			"404": openapi.JSONResponse("Upload not found or expired", errorSchema),
+			"409": openapi.JSONResponse("The offset is not the upload's, another chunk is being written, or the domain is over its disk quota", errorSchema),
+		}),
+	})
+	doc.Add("DELETE", "/uploads/:id", &openapi.Operation{
+		Summary: "Give up an upload and delete the data received for it",
+		Tags:    []string{"files"},
+		Responses: map[string]openapi.Response{
+			"204": {Description: "Upload cancelled"},
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+			"404": openapi.JSONResponse("Upload not found or expired", errorSchema),
+		},
+	})
+
+	doc.Add("GET", "/domains/:id/traffic", &openapi.Operation{
+		Summary: "Traffic of a domain and its subdomains over time, from its access logs",
+		Tags:    []string{"domains", "quotas"},
+		Parameters: []openapi.Parameter{
+			query("from", "RFC 3339 start, moved back to the start of its bucket; defaults to a day, month or year before to", &openapi.Schema{Type: "string", Format: "date-time"}),
+			query("to", "RFC 3339 end (exclusive); defaults to now", &openapi.Schema{Type: "string", Format: "date-time"}),
+			query("interval", "Bucket size, day by default; at most 744 buckets per report", &openapi.Schema{Type: "string", Enum: []interface{}{"hour", "day", "month"}}),
+		},
+		Responses: map[string]openapi.Response{
+			"200": openapi.JSONResponse("Bytes in and out and requests per bucket (UTC), with totals", openapi.Object(map[string]*openapi.Schema{
+				"domain_id": openapi.UUID(),
+				"interval":  {Type: "string"},
+				"from":      {Type: "string", Format: "date-time"},
+				"to":        {Type: "string", Format: "date-time"},
+				"buckets":   {Type: "array", Description: "start, bytes_in, bytes_out and requests of each bucket, oldest first"},
+				"total":     {Type: "object", Description: "Sums over all buckets"},
+			})),
+			"400": openapi.JSONResponse("Malformed timestamp", errorSchema),
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+			"404": openapi.JSONResponse("Domain not found", errorSchema),
+			"422": openapi.JSONResponse("Unknown interval, or too many buckets", validationErrorSchema),
+		},
+	})
+
+	doc.Add("POST", "/admin/domains/:id/suspend", &openapi.Operation{
+		Summary:     "Suspend a domain: its sites answer 503 with a suspension page and its mail is paused, keeping all data (admin)",
+		Tags:        []string{"admin", "domains"},
+		RequestBody: openapi.JSONBody(DomainSuspendSchema),
+		Responses: withValidation(map[string]openapi.Response{
+			"200": openapi.JSONResponse("Updated domain", nil),
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+			"403": openapi.JSONResponse("Not an admin", errorSchema),
+			"404": openapi.JSONResponse("Domain not found", errorSchema),
+			"409": openapi.JSONResponse("Another operation is running on the domain", errorSchema),
+		}),
+	})
+
+	doc.Add("POST", "/admin/domains/:id/unsuspend", &openapi.Operation{
+		Summary: "Lift a domain's suspension; it stays offline while its owner's account is deactivated (admin)",
+		Tags:    []string{"admin", "domains"},
+		Responses: map[string]openapi.Response{
+			"200": openapi.JSONResponse("Updated domain", nil),
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+			"403": openapi.JSONResponse("Not an admin", errorSchema),
+			"404": openapi.JSONResponse("Domain not found", errorSchema),
+			"409": openapi.JSONResponse("Domain not suspended, or another operation is running on it", errorSchema),
+		},
+	})
+
+	doc.Add("GET", "/admin/capacity", &openapi.Operation{
+		Summary:   "Quotas allocated on each server against its capacity (admin)",
+		Tags:      []string{"admin", "quotas"},
+		Responses: ok("Allocation per server, in bytes", nil),
+	})
+
+	doc.Add("GET", "/domains/:id/redirects", &openapi.Operation{
+		Summary:   "List a domain's redirects",
+		Tags:      []string{"redirects"},
+		Responses: ok("Redirects", nil),
+	})
+	doc.Add("POST", "/domains/:id/redirects", &openapi.Operation{
+		Summary:     "Add a redirect to a domain",
+		Tags:        []string{"redirects"},
+		RequestBody: openapi.JSONBody(RedirectSchema),
+		Responses: withValidation(map[string]openapi.Response{
+			"201": openapi.JSONResponse("Created redirect", nil),
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+		}),
+	})
+	doc.Add("PUT", "/redirects/:id", &openapi.Operation{
+		Summary:     "Replace a redirect",
+		Tags:        []string{"redirects"},
+		RequestBody: openapi.JSONBody(RedirectSchema),
+		Responses:   withValidation(ok("Updated redirect", nil)),
+	})
+	doc.Add("DELETE", "/redirects/:id", &openapi.Operation{
+		Summary:   "Delete a redirect",
+		Tags:      []string{"redirects"},
+		Responses: map[string]openapi.Response{"204": {Description: "Deleted"}},
+	})
+
+	doc.Add("GET", "/domains/:id/protected-directories", &openapi.Operation{
+		Summary:   "List a domain's password protected directories with their users",
+		Tags:      []string{"protected directories"},
+		Responses: ok("Protected directories", nil),
+	})
+	doc.Add("POST", "/domains/:id/protected-directories", &openapi.Operation{
+		Summary:     "Password protect a path of a domain",
+		Tags:        []string{"protected directories"},
+		RequestBody: openapi.JSONBody(ProtectedDirectorySchema),
+		Responses: withValidation(map[string]openapi.Response{
+			"201": openapi.JSONResponse("Created protected directory", nil),
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+		}),
+	})
+	doc.Add("PUT", "/protected-directories/:id", &openapi.Operation{
+		Summary:     "Change the path or realm of a protected directory",
+		Tags:        []string{"protected directories"},
+		RequestBody: openapi.JSONBody(ProtectedDirectorySchema),
+		Responses:   withValidation(ok("Updated protected directory", nil)),
+	})
+	doc.Add("DELETE", "/protected-directories/:id", &openapi.Operation{
+		Summary:   "Remove the protection of a directory and its users",
+		Tags:      []string{"protected directories"},
+		Responses: map[string]openapi.Response{"204": {Description: "Deleted"}},
+	})
+	doc.Add("POST", "/protected-directories/:id/users", &openapi.Operation{
+		Summary:     "Add a login to a protected directory",
+		Tags:        []string{"protected directories"},
+		RequestBody: openapi.JSONBody(DirectoryUserSchema),
+		Responses: withValidation(map[string]openapi.Response{
+			"201": openapi.JSONResponse("Created directory user", nil),
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+		}),
+	})
+	doc.Add("PUT", "/directory-users/:id/password", &openapi.Operation{
+		Summary:     "Change the password of a protected directory's login",
+		Tags:        []string{"protected directories"},
+		RequestBody: openapi.JSONBody(DirectoryPasswordSchema),
+		Responses:   withValidation(map[string]openapi.Response{"204": {Description: "Password changed"}}),
+	})
+	doc.Add("DELETE", "/directory-users/:id", &openapi.Operation{
+		Summary:   "Remove a login of a protected directory",
+		Tags:      []string{"protected directories"},
+		Responses: map[string]openapi.Response{"204": {Description: "Deleted"}},
+	})
+
+	doc.Add("POST", "/mail/send-hook", &openapi.Operation{
+		Summary:     "Count an outgoing message against the send limits (MTA integration)",
+		Tags:        []string{"mail"},
+		Security:    &integration,
+		RequestBody: openapi.JSONBody(MailSendHookSchema),
+		Responses:   withValidation(ok("Whether to accept the message", nil)),
+	})
+	doc.Add("POST", "/mail/delivery-hook", &openapi.Operation{
+		Summary:     "Check whether a hosted mailbox accepts incoming mail, refusing suspended ones and deferring those over quota (MTA integration)",
+		Tags:        []string{"mail"},
+		Security:    &integration,
+		RequestBody: openapi.JSONBody(MailDeliveryHookSchema),
+		Responses:   withValidation(ok("Whether to accept the message, and whether a refusal is temporary", nil)),
+	})
+	doc.Add("POST", "/security/auth-failures", &openapi.Operation{
+		Summary:     "Report a failed login to the MTA, FTP or SSH server, counted towards banning the IP (integration)",
+		Tags:        []string{"security"},
+		Security:    &integration,
+		RequestBody: openapi.JSONBody(AuthFailureSchema),
+		Responses: withValidation(ok("Standing of the IP", openapi.Object(map[string]*openapi.Schema{
+			"ip_address":   {Type: "string"},
+			"failures":     {Type: "integer", Description: "Failed logins within the ban window, over all sources"},
+			"banned":       openapi.Boolean(),
+			"banned_until": {Type: "string", Format: "date-time"},
+		}))),
+	})
+	doc.Add("GET", "/admin/attack-sources", &openapi.Operation{
+		Summary: "IPs failed logins came from, over the panel, mail, FTP and SSH, with the banned ones (admin)",
+		Tags:    []string{"admin", "security"},
+		Parameters: []openapi.Parameter{
+			query("since", "Duration to look back, such as 24h (the default)", &openapi.Schema{Type: "string"}),
+			query("limit", "Maximum number of IPs", openapi.Integer(1, 1000)),
+		},
+		Responses: withValidation(ok("IPs with their failures by source, most failures first", nil)),
+	})
+	doc.Add("DELETE", "/admin/ip-bans/:ip", &openapi.Operation{
+		Summary: "Lift the ban of an IP and forget its failed logins (admin)",
+		Tags:    []string{"admin", "security"},
+		Responses: withValidation(map[string]openapi.Response{
+			"204": {Description: "Ban lifted"},
+			"404": openapi.JSONResponse("IP not banned", errorSchema),
+		}),
+	})
+	doc.Add("GET", "/admin/services", &openapi.Operation{
+		Summary:   "State of the services the watchdog restarts when they fail, with its restart attempts (admin)",
+		Tags:      []string{"admin", "system"},
+		Responses: ok("Services with their last checked state, restarts in a row and whether the watchdog gave up", nil),
+	})
+	doc.Add("GET", "/admin/services/restarts", &openapi.Operation{
+		Summary: "Restart attempts of the watchdog, newest first (admin)",
+		Tags:    []string{"admin", "system"},
+		Parameters: []openapi.Parameter{
+			query("service", "Only the attempts of this systemd unit", &openapi.Schema{Type: "string"}),
+			query("limit", "Maximum number of attempts", openapi.Integer(1, 1000)),
+		},
+		Responses: withValidation(ok("Restart attempts with their outcome", nil)),
+	})
+	doc.Add("GET", "/domains/:id/send-counts", &openapi.Operation{
+		Summary:   "Current send counts of a domain and its accounts",
+		Tags:      []string{"mail"},
+		Responses: ok("Send counts", nil),
+	})
+	doc.Add("POST", "/domains/:id/mail/deliverability-test", &openapi.Operation{
+		Summary: "Test whether a domain can send and receive mail, with a score and how to fix what failed",
+		Tags:    []string{"mail"},
+		Responses: map[string]openapi.Response{
+			"200": openapi.JSONResponse("Deliverability report", openapi.Object(map[string]*openapi.Schema{
+				"domain": {Type: "string"},
+				"score":  {Type: "integer"},
+				"checks": {Type: "array", Items: openapi.Object(map[string]*openapi.Schema{
+					"name":        {Type: "string", Enum: []interface{}{"mx", "spf", "dkim", "dmarc", "dnsbl", "test_message"}},
+					"status":      {Type: "string", Enum: []interface{}{"pass", "warn", "fail", "skipped"}},
+					"detail":      {Type: "string"},
+					"remediation": {Type: "string"},
+				})},
+				"tested_at": {Type: "string", Format: "date-time"},
+			})),
+			"401": openapi.JSONResponse("Authentication required", errorSchema),
+			"403": openapi.JSONResponse("Not the domain's owner", errorSchema),
+			"404": openapi.JSONResponse("Domain not found", errorSchema),
+			"409": openapi.JSONResponse("The domain was tested too often in the last hour", errorSchema),
+		},
+	})
+	doc.Add("POST", "/admin/mail/:kind/:id/resume-sending", &openapi.Operation{
+		Summary: "Lift the send suspension of an account or domain (admin)",
+		Tags:    []string{"admin", "mail"},
+		Parameters: []openapi.Parameter{{
+			Name: "kind", In: "path", Required: true,
+			Schema: &openapi.Schema{Type: "string", Enum: []interface{}{"accounts", "domains"}},
+		}},
+		Responses: map[string]openapi.Response{"204": {Description: "Sending resumed"}},
+	})
+
+	doc.Add("POST", "/databases/:id/sso", &openapi.Operation{
+		Summary: "Single-use link that signs the caller into phpMyAdmin/Adminer as the database's user",
+		Tags:    []string{"databases"},
+		Responses: ok("Link valid for hosting.db_admin_token_ttl", openapi.Object(map[string]*openapi.Schema{
+			"url": {Type: "string"},
+		})),
+	})
+	doc.Add("POST", "/db-admin/sso/redeem", &openapi.Operation{
+		Summary:  "Redeem a database admin signon token (phpMyAdmin/Adminer integration)",
+		Tags:     []string{"databases"},
+		Security: &integration,
+		RequestBody: openapi.JSONBody(openapi.Object(map[string]*openapi.Schema{
+			"token": openapi.String(1, -1),
+		}, "token")),
+		Responses: ok("Database and user to sign in as", nil),
+	})
+
+	doc.Add("GET", "/admin/jobs", &openapi.Operation{
+		Summary:   "Maintenance job status (admin)",
+		Tags:      []string{"admin"},
+		Responses: ok("Jobs", nil),
+	})
+	doc.Add("GET", "/metrics", &openapi.Operation{
+		Summary:  "Job metrics in the Prometheus text format (monitoring integration)",
+		Tags:     []string{"admin"},
+		Security: &integration,
+		Responses: map[string]openapi.Response{
+			"200": {Description: "Metrics"},
+			"401": openapi.JSONResponse("Invalid metrics token", errorSchema),
+		},
+	})
+	doc.Add("POST", "/admin/jobs/:name/run", &openapi.Operation{
+		Summary: "Run a maintenance job now (admin)",
+		Tags:    []string{"admin"},
+		Responses: map[string]openapi.Response{
+			"200": openapi.JSONResponse("Job completed", nil),
+			"404": openapi.JSONResponse("Unknown job", errorSchema),
+			"409": openapi.JSONResponse("Job already running", errorSchema),
+		},
+	})
+
+	return doc
+}
+
+// OpenAPISpec serves the OpenAPI document
+func OpenAPISpec(doc *openapi.Document) gin.HandlerFunc {
+	data, err := json.Marshal(doc)
+	return func(c *gin.Context) {
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to encode API spec"})
+			return
+		}
+		c.Data(http.StatusOK, "application/json", data)
+	}
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mynodecp/mynodecp/backend/internal/openapi"
+)
+
+func TestSpec(t *testing.T) {
+	doc := Spec("1.2.3")
+
+	for path, item := range doc.Paths {
+		if strings.Contains(path, ":") {
+			t.Errorf("path %s keeps a gin parameter", path)
+		}
+		for method, op := range item {
+			if op.Summary == "" || len(op.Responses) == 0 {
+				t.Errorf("%s %s lacks a summary or responses", method, path)
+			}
+			if op.RequestBody == nil {
+				continue
+			}
+			if len(op.RequestBody.Content) == 0 {
+				t.Errorf("%s %s has a body without a content type", method, path)
+			}
+			for contentType, media := range op.RequestBody.Content {
+				if media.Schema == nil {
+					t.Errorf("%s %s has a %s body without a schema", method, path, contentType)
+				}
+			}
+		}
+	}
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/openapi.json", OpenAPISpec(Spec("1.2.3")))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		t.Fatalf("status = %d, content type %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	var spec struct {
+		OpenAPI string                   `json:"openapi"`
+		Info    struct{ Version string } `json:"info"`
+		Paths   map[string]interface{}   `json:"paths"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("decode spec: %v", err)
+	}
+	if spec.OpenAPI == "" || spec.Info.Version != "1.2.3" || len(spec.Paths) == 0 {
+		t.Errorf("spec = %s %s with %d paths", spec.OpenAPI, spec.Info.Version, len(spec.Paths))
+	}
+}
+
+func TestRequestSchemas(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema *openapi.Schema
+		body   string
+		valid  bool
+	}{
+		{"register", RegisterSchema, `{"username":"ann","email":"ann@example.com","password":"secret"}`, true},
+		{"register without password", RegisterSchema, `{"username":"ann","email":"ann@example.com"}`, false},
+		{"register as admin", RegisterSchema, `{"username":"ann","email":"ann@example.com","password":"secret","roles":["admin"]}`, false},
+		{"domain", DomainCreateSchema, `{"name":"example.com","disk_quota":1073741824}`, true},
+		{"domain with negative quota", DomainCreateSchema, `{"name":"example.com","disk_quota":-1}`, false},
+		{"domain with quota as string", DomainCreateSchema, `{"name":"example.com","disk_quota":"1G"}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var document interface{}
+			decoder := json.NewDecoder(strings.NewReader(tt.body))
+			decoder.UseNumber()
+			if err := decoder.Decode(&document); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if err := tt.schema.Validate(document); (err == nil) != tt.valid {
+				t.Errorf("Validate(%s) = %v, want valid %v", tt.body, err, tt.valid)
+			}
+		})
+	}
+}
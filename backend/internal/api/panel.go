@@ -0,0 +1,105 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/auth"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/database"
+	"github.com/mynodecp/mynodecp/backend/internal/egress"
+	"github.com/mynodecp/mynodecp/backend/internal/geoip"
+	"github.com/mynodecp/mynodecp/backend/internal/mailer"
+	"github.com/mynodecp/mynodecp/backend/internal/secret"
+)
+
+// Panel holds the connections of the panel and the services built on them. The server and
+// adminctl both open it, so commands act exactly as requests do.
+type Panel struct {
+	DB           *gorm.DB
+	Redis        *redis.Client
+	Provisioning *database.Provisioning // Nil when no provisioning user is configured
+	Mailer       *mailer.Mailer
+	Services     *Services
+}
+
+// UseEncryptionKeys makes secret columns encrypted at rest once a key is configured
+func UseEncryptionKeys(cfg config.SecurityConfig, log *zap.Logger) error {
+	if cfg.EncryptionKeyVersion == "" {
+		log.Warn("No encryption key configured; secrets are stored as plaintext")
+		return nil
+	}
+
+	keyring, err := secret.NewKeyring(cfg.EncryptionKeys, cfg.EncryptionKeyVersion)
+	if err != nil {
+		return fmt.Errorf("failed to load encryption keys: %w", err)
+	}
+	secret.Use(keyring)
+	return nil
+}
+
+// OpenPanel connects to the database, Redis and the managed database server and sets up the
+// panel's services. Nothing runs in the background; the caller schedules the jobs it wants.
+// Encryption keys must already be in use, see UseEncryptionKeys.
+func OpenPanel(cfg *config.Config, log *zap.Logger) (*Panel, error) {
+	db, err := database.New(cfg.Database, log)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	p := &Panel{DB: db}
+
+	if p.Redis, err = database.NewRedis(cfg.Redis); err != nil {
+		p.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+
+	// The admin connection pool of the managed database server
+	if p.Provisioning, err = database.NewProvisioning(cfg.Hosting, log); err != nil {
+		p.Close()
+		return nil, fmt.Errorf("failed to configure provisioning database: %w", err)
+	}
+
+	geoResolver, err := geoip.New(cfg.Auth.GeoIPDatabase)
+	if err != nil {
+		log.Warn("GeoIP lookups disabled", zap.Error(err))
+		geoResolver, _ = geoip.New("")
+	}
+
+	p.Mailer = mailer.New(db, cfg.Mail, log)
+
+	// The proxy and host allowlist of calls to external services
+	outbound, err := egress.New(cfg.Security.OutboundProxy, cfg.Security.OutboundAllowedHosts)
+	if err != nil {
+		p.Close()
+		return nil, fmt.Errorf("failed to configure outbound requests: %w", err)
+	}
+
+	// CAPTCHA verification for throttled logins
+	captchaVerifier, err := auth.NewCaptchaVerifier(cfg.Auth.CaptchaProvider, cfg.Auth.CaptchaSecret, outbound)
+	if err != nil {
+		p.Close()
+		return nil, fmt.Errorf("failed to configure CAPTCHA: %w", err)
+	}
+
+	breachChecker := auth.NewBreachChecker(cfg.Auth.PasswordBreachCheck, cfg.Auth.PasswordBreachAPIURL, cfg.Auth.PasswordBreachCacheTTL, p.Redis, outbound)
+	authService := auth.NewService(db, p.Redis, log, cfg.Auth, geoResolver, captchaVerifier, p.Mailer, breachChecker)
+	p.Services = NewServices(db, p.Redis, authService, p.Mailer, p.Provisioning, outbound, cfg, log)
+
+	return p, nil
+}
+
+// Close closes the panel's connections
+func (p *Panel) Close() {
+	if sqlDB, err := p.DB.DB(); err == nil {
+		sqlDB.Close()
+	}
+	if p.Provisioning != nil {
+		p.Provisioning.Close()
+	}
+	if p.Redis != nil {
+		p.Redis.Close()
+	}
+}
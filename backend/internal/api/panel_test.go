@@ -0,0 +1,29 @@
+package api
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+)
+
+func TestUseEncryptionKeysRejectsBadKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.SecurityConfig
+		wantErr bool
+	}{
+		{"no key configured", config.SecurityConfig{}, false},
+		{"no key of the current version", config.SecurityConfig{EncryptionKeyVersion: "v2", EncryptionKeys: map[string]string{"v1": "c2hvcnQ="}}, true},
+		{"short key", config.SecurityConfig{EncryptionKeyVersion: "v1", EncryptionKeys: map[string]string{"v1": "c2hvcnQ="}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := UseEncryptionKeys(tt.cfg, zap.NewNop()); (err != nil) != tt.wantErr {
+				t.Errorf("UseEncryptionKeys() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
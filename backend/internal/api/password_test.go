@@ -0,0 +1,70 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/mynodecp/mynodecp/backend/internal/auth"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+func TestChangePassword(t *testing.T) {
+	db := newTestDB(t)
+	cfg := config.AuthConfig{PasswordMinLength: 8}
+	users := services.NewUserService(db, nil, zap.NewNop(), nil, auth.NewService(db, nil, zap.NewNop(), cfg, nil, nil, nil, nil), nil, nil, cfg, nil)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("original-pass"), bcrypt.MinCost)
+	user := &models.User{Username: "owner", Email: "owner@example.net", PasswordHash: string(hash), IsActive: true}
+	db.Create(user)
+
+	change := func(id, body string, userID uuid.UUID) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/users/"+id+"/password", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return serveRoute("/users/:id/password", ChangePassword(users), req, userID, "user")
+	}
+
+	tests := []struct {
+		name      string
+		id        string
+		body      string
+		userID    uuid.UUID
+		want      int
+		wantField string
+	}{
+		{"malformed user id", "owner", `{}`, user.ID, http.StatusBadRequest, ""},
+		{"another user's password", user.ID.String(), `{"current_password":"original-pass","new_password":"rotated-pass"}`, uuid.New(), http.StatusForbidden, ""},
+		{"wrong current password", user.ID.String(), `{"current_password":"guess","new_password":"rotated-pass"}`, user.ID, http.StatusUnprocessableEntity, "current_password"},
+		{"too short", user.ID.String(), `{"current_password":"original-pass","new_password":"short"}`, user.ID, http.StatusUnprocessableEntity, "new_password"},
+		{"changed", user.ID.String(), `{"current_password":"original-pass","new_password":"rotated-pass"}`, user.ID, http.StatusNoContent, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := change(tt.id, tt.body, tt.userID)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+			if tt.wantField != "" {
+				var body struct {
+					Errors map[string]string `json:"errors"`
+				}
+				if json.Unmarshal(w.Body.Bytes(), &body) != nil || body.Errors[tt.wantField] == "" {
+					t.Errorf("body = %s, want an error on %s", w.Body.String(), tt.wantField)
+				}
+			}
+		})
+	}
+
+	var changed models.User
+	db.First(&changed, "id = ?", user.ID)
+	if bcrypt.CompareHashAndPassword([]byte(changed.PasswordHash), []byte("rotated-pass")) != nil || changed.PasswordChangedAt == nil {
+		t.Error("password not changed")
+	}
+}
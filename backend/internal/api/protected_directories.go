@@ -0,0 +1,166 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+// ProtectedDirectories lists the password protected directories of a domain
+func ProtectedDirectories(domains *services.DomainService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		domainID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid domain id"})
+			return
+		}
+
+		directories, err := domains.GetProtectedDirectories(serviceContext(c), domainID)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"protected_directories": directories})
+	}
+}
+
+// CreateProtectedDirectory password protects a path of a domain
+func CreateProtectedDirectory(domains *services.DomainService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		domainID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid domain id"})
+			return
+		}
+
+		var req services.ProtectedDirectoryRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		directory, err := domains.CreateProtectedDirectory(serviceContext(c), domainID, req)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, directory)
+	}
+}
+
+// UpdateProtectedDirectory changes the path and realm of a protected directory
+func UpdateProtectedDirectory(domains *services.DomainService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		directoryID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid protected directory id"})
+			return
+		}
+
+		var req services.ProtectedDirectoryRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		directory, err := domains.UpdateProtectedDirectory(serviceContext(c), directoryID, req)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, directory)
+	}
+}
+
+// DeleteProtectedDirectory removes the protection of a directory and its users
+func DeleteProtectedDirectory(domains *services.DomainService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		directoryID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid protected directory id"})
+			return
+		}
+
+		if err := domains.DeleteProtectedDirectory(serviceContext(c), directoryID); err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// AddDirectoryUser adds a login to a protected directory
+func AddDirectoryUser(domains *services.DomainService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		directoryID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid protected directory id"})
+			return
+		}
+
+		var req services.DirectoryUserRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		user, err := domains.AddDirectoryUser(serviceContext(c), directoryID, req)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, user)
+	}
+}
+
+// SetDirectoryUserPassword changes the password of a login of a protected directory
+func SetDirectoryUserPassword(domains *services.DomainService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid directory user id"})
+			return
+		}
+
+		var req struct {
+			Password string `json:"password"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := domains.SetDirectoryUserPassword(serviceContext(c), userID, req.Password); err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// DeleteDirectoryUser removes a login of a protected directory
+func DeleteDirectoryUser(domains *services.DomainService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid directory user id"})
+			return
+		}
+
+		if err := domains.DeleteDirectoryUser(serviceContext(c), userID); err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+// QuotaAlerts lists the current cycle's unresolved quota alerts. Admins see every owner's
+// alerts, or one owner's with the owner_id parameter; other users only see their own.
+func QuotaAlerts(quota *services.QuotaService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		callerID, isAdmin, ok := caller(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		owner := &callerID
+		if isAdmin {
+			owner = nil
+			if raw := c.Query("owner_id"); raw != "" {
+				id, err := uuid.Parse(raw)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "invalid owner_id"})
+					return
+				}
+				owner = &id
+			}
+		}
+
+		alerts, err := quota.GetAlerts(c.Request.Context(), owner)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"alerts": alerts})
+	}
+}
+
+// DomainQuotaDefaults returns the quotas the caller's new domains receive under their package.
+// Admins can look up another user with the user_id parameter.
+func DomainQuotaDefaults(domains *services.DomainService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, isAdmin, ok := caller(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		if raw := c.Query("user_id"); raw != "" && isAdmin {
+			id, err := uuid.Parse(raw)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+				return
+			}
+			userID = id
+		}
+
+		quotas, err := domains.DefaultQuotas(c.Request.Context(), userID)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, quotas)
+	}
+}
+
+// CapacityReport compares the quotas allocated on each server with its capacity (admin)
+func CapacityReport(domains *services.DomainService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report, err := domains.CapacityReport(c.Request.Context())
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"servers": report})
+	}
+}
+
+// DatabaseUsage reports the storage the caller's databases use against the database quotas.
+// Admins can look up another user with the user_id parameter.
+func DatabaseUsage(databases *services.DatabaseService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, isAdmin, ok := caller(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		if raw := c.Query("user_id"); raw != "" && isAdmin {
+			id, err := uuid.Parse(raw)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user_id"})
+				return
+			}
+			userID = id
+		}
+
+		usage, err := databases.GetDatabaseUsage(c.Request.Context(), userID)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, usage)
+	}
+}
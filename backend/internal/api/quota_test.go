@@ -0,0 +1,53 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/runner"
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+func TestDatabaseUsage(t *testing.T) {
+	db := newTestDB(t)
+	databases := services.NewDatabaseService(db, nil, zap.NewNop(), config.HostingConfig{UserDatabaseQuotaMB: 100}, runner.NewFake(), nil)
+	owner := &models.User{Username: "owner", Email: "owner@example.net", PasswordHash: "x", IsActive: true}
+	db.Create(owner)
+	domain := &models.Domain{UserID: owner.ID, Name: "example.com", DocumentRoot: "/var/www/example.com/public_html", IsActive: true}
+	db.Create(domain)
+	db.Create(&models.Database{DomainID: domain.ID, Name: "shop", Type: "mysql", SizeMB: 120})
+
+	get := func(query string, userID uuid.UUID, role string) services.DatabaseUsage {
+		t.Helper()
+		w := serve(DatabaseUsage(databases), httptest.NewRequest(http.MethodGet, "/databases/usage"+query, nil), userID, role)
+		var usage services.DatabaseUsage
+		if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &usage) != nil {
+			t.Fatalf("GET %s = %d: %s", query, w.Code, w.Body.String())
+		}
+		return usage
+	}
+
+	if usage := get("", owner.ID, "user"); usage.UsedMB != 120 || !usage.OverQuota || usage.QuotaMB != 100 {
+		t.Errorf("own usage = %+v", usage)
+	}
+	if usage := get("?user_id="+owner.ID.String(), uuid.New(), "admin"); usage.UserID != owner.ID || usage.UsedMB != 120 {
+		t.Errorf("usage looked up by an admin = %+v", usage)
+	}
+	// Other users only ever see their own databases
+	stranger := uuid.New()
+	if usage := get("?user_id="+owner.ID.String(), stranger, "user"); usage.UserID != stranger || usage.UsedMB != 0 {
+		t.Errorf("usage looked up by another user = %+v", usage)
+	}
+
+	w := serve(DatabaseUsage(databases), httptest.NewRequest(http.MethodGet, "/databases/usage?user_id=nope", nil), uuid.New(), "admin")
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("malformed user_id = %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+// DomainRedirects lists the redirects of a domain
+func DomainRedirects(domains *services.DomainService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		domainID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid domain id"})
+			return
+		}
+
+		redirects, err := domains.GetRedirects(serviceContext(c), domainID)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"redirects": redirects})
+	}
+}
+
+// CreateRedirect adds a redirect to a domain
+func CreateRedirect(domains *services.DomainService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		domainID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid domain id"})
+			return
+		}
+
+		var req services.RedirectRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		redirect, err := domains.CreateRedirect(serviceContext(c), domainID, req)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, redirect)
+	}
+}
+
+// UpdateRedirect replaces a redirect's source, target and options
+func UpdateRedirect(domains *services.DomainService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		redirectID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid redirect id"})
+			return
+		}
+
+		var req services.RedirectRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		redirect, err := domains.UpdateRedirect(serviceContext(c), redirectID, req)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, redirect)
+	}
+}
+
+// DeleteRedirect removes a redirect
+func DeleteRedirect(domains *services.DomainService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		redirectID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid redirect id"})
+			return
+		}
+
+		if err := domains.DeleteRedirect(serviceContext(c), redirectID); err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
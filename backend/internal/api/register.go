@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mynodecp/mynodecp/backend/internal/auth"
+)
+
+// registerBody is the body of registering an account. Required fields are checked by the auth
+// service, so a missing one is reported under its name like any other invalid field.
+type registerBody struct {
+	Username   string `json:"username"`
+	Email      string `json:"email"`
+	Password   string `json:"password"`
+	FirstName  string `json:"first_name"`
+	LastName   string `json:"last_name"`
+	Locale     string `json:"locale"`
+	InviteCode string `json:"invite_code"`
+}
+
+// Register creates an account. Invalid fields are answered with 422 and a message per field.
+func Register(authService *auth.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body registerBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		resp, err := authService.Register(serviceContext(c), &auth.RegisterRequest{
+			Username:   body.Username,
+			Email:      body.Email,
+			Password:   body.Password,
+			FirstName:  body.FirstName,
+			LastName:   body.LastName,
+			Locale:     body.Locale,
+			InviteCode: body.InviteCode,
+		})
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, resp)
+	}
+}
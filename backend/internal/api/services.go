@@ -1,11 +1,21 @@
 package api
 
 import (
+	"strings"
+	"time"
+
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 
 	"github.com/mynodecp/mynodecp/backend/internal/auth"
+	"github.com/mynodecp/mynodecp/backend/internal/cache"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/database"
+	"github.com/mynodecp/mynodecp/backend/internal/egress"
+	"github.com/mynodecp/mynodecp/backend/internal/lock"
+	"github.com/mynodecp/mynodecp/backend/internal/mailer"
+	"github.com/mynodecp/mynodecp/backend/internal/runner"
 	"github.com/mynodecp/mynodecp/backend/internal/services"
 )
 
@@ -21,20 +31,82 @@ type Services struct {
 	Backup   *services.BackupService
 	SSL      *services.SSLService
 	DNS      *services.DNSService
+	Batch    *services.BatchService
+	Node     *services.NodeService
+	SSHKey   *services.SSHKeyService
+	FTP      *services.FTPService
+	Audit    *services.AuditService
+	Quota    *services.QuotaService
+	Status   *services.StatusService
+
+	PHPDeprecation *services.PHPDeprecationService
+	Notification   *services.NotificationService
+	Vault          *services.VaultService
+	Abuse          *services.AbuseService
+
+	ProvisioningDB *database.Provisioning // Nil when no provisioning user is configured
+
+	AccountCleanup *services.AccountCleanupService
 }
 
 // NewServices creates a new Services instance
-func NewServices(db *gorm.DB, redis *redis.Client, authService *auth.Service, logger *zap.Logger) *Services {
+func NewServices(db *gorm.DB, redis *redis.Client, authService *auth.Service, mailSender *mailer.Mailer, provisioningDB *database.Provisioning, outbound *egress.Policy, cfg *config.Config, logger *zap.Logger) *Services {
+	appCache := cache.New(redis, cfg.Cache)
+	cmdRunner := runner.NewExec(commands(cfg.Hosting), logger)
+	// Health checks run their commands even in dry-run mode; database and PHP commands change state
+	dryRunner := runner.NewDryRun(cmdRunner, cfg.Hosting.DryRun, logger)
+	databaseService := services.NewDatabaseService(db, redis, logger, cfg.Hosting, dryRunner, provisioningDB)
+	locks := lock.New(redis, cfg.Hosting.LockTTL, cfg.Hosting.LockWait)
+	domainService := services.NewDomainService(db, redis, logger, cfg.Hosting, appCache, locks, dryRunner)
+	dnsService := services.NewDNSService(db, redis, logger, cfg.Hosting, appCache, domainService)
+	domainService.SetZonePublisher(dnsService)
+	notificationService := services.NewNotificationService(db, logger, mailSender)
+	authService.SetOnboarder(services.NewOnboardingService(logger, cfg.Auth, mailSender, domainService, databaseService))
+	emailService := services.NewEmailService(db, redis, logger, cfg.Mail, notificationService, domainService)
+	domainService.SetMailDiscovery(emailService)
+	ftpService := services.NewFTPService(db, redis, logger, cfg.Hosting)
+	domainService.SetFTPUsers(ftpService)
+	userService := services.NewUserService(db, redis, logger, appCache, authService, domainService, mailSender, cfg.Auth, notificationService)
+
 	return &Services{
 		Auth:     authService,
-		User:     services.NewUserService(db, redis, logger),
-		Domain:   services.NewDomainService(db, redis, logger),
-		Email:    services.NewEmailService(db, redis, logger),
-		Database: services.NewDatabaseService(db, redis, logger),
-		File:     services.NewFileService(db, redis, logger),
-		System:   services.NewSystemService(db, redis, logger),
-		Backup:   services.NewBackupService(db, redis, logger),
-		SSL:      services.NewSSLService(db, redis, logger),
-		DNS:      services.NewDNSService(db, redis, logger),
+		User:     userService,
+		Domain:   domainService,
+		Email:    emailService,
+		Database: databaseService,
+		File:     services.NewFileService(db, redis, logger, cfg.Hosting, domainService),
+		System:   services.NewSystemService(db, redis, logger, cfg.Hosting, cmdRunner, provisioningDB, outbound, notificationService),
+		Backup:   services.NewBackupService(db, redis, logger, cfg.Hosting, databaseService, locks),
+		SSL:      services.NewSSLService(db, redis, logger, cfg.Hosting, domainService, dnsService, outbound, locks),
+		DNS:      dnsService,
+		Batch:    services.NewBatchService(db, logger, domainService, dnsService),
+		Node:     services.NewNodeService(db, redis, logger, cfg.Hosting, dnsService, appCache),
+		SSHKey:   services.NewSSHKeyService(db, redis, logger, cfg.Hosting),
+		FTP:      ftpService,
+		Audit:    services.NewAuditService(db, redis, logger),
+		Quota:    services.NewQuotaService(db, redis, logger, cfg.Hosting, appCache, notificationService),
+		Status:   services.NewStatusService(db, redis, logger, cfg.Status),
+
+		PHPDeprecation: services.NewPHPDeprecationService(db, logger, cfg.Hosting, appCache, notificationService),
+		Notification:   notificationService,
+		Vault:          services.NewVaultService(db, logger),
+		Abuse:          services.NewAbuseService(db, logger, cfg.Abuse, domainService, userService, notificationService),
+
+		AccountCleanup: services.NewAccountCleanupService(db, logger, cfg.Jobs, mailSender),
+		ProvisioningDB: provisioningDB,
+	}
+}
+
+// commands returns the allowlist of system commands, including the configured MTA check and
+// opcache reset
+func commands(cfg config.HostingConfig) map[string]time.Duration {
+	allowed := runner.DefaultCommands()
+	for _, command := range []string{cfg.MTACheckCommand, cfg.PHPOpcacheResetCommand} {
+		if fields := strings.Fields(command); len(fields) > 0 {
+			if _, ok := allowed[fields[0]]; !ok {
+				allowed[fields[0]] = runner.DefaultTimeout
+			}
+		}
 	}
+	return allowed
 }
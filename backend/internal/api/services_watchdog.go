@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+// ServiceStatuses returns the state of the services the watchdog looks after (admin)
+func ServiceStatuses(system *services.SystemService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		statuses, err := system.GetServiceStatus(serviceContext(c))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"services": statuses})
+	}
+}
+
+// ServiceRestarts lists the watchdog's restart attempts, newest first, optionally of one service
+// (admin)
+func ServiceRestarts(system *services.SystemService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := 100
+		if value := c.Query("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 || parsed > 1000 {
+				writeError(c, apperrors.InvalidCode("limit", "field.maximum", map[string]string{"max": "1000"}))
+				return
+			}
+			limit = parsed
+		}
+
+		restarts, err := system.ServiceRestarts(serviceContext(c), c.Query("service"), limit)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"restarts": restarts})
+	}
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/runner"
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+func TestServiceWatchdogHandlers(t *testing.T) {
+	db := newTestDB(t)
+	fake := runner.NewFake()
+	fake.Respond("systemctl is-active nginx", runner.Result{Stdout: []byte("failed\n"), Err: errors.New("exit status 3")})
+	fake.Respond("systemctl is-active mysql", runner.Result{Stdout: []byte("active\n")})
+	cfg := config.HostingConfig{WatchdogServices: []string{"nginx", "mysql"}, WatchdogBackoff: time.Minute, WatchdogMaxAttempts: 3}
+	system := services.NewSystemService(db, nil, zap.NewNop(), cfg, fake, nil, nil, nil)
+	if err := system.WatchServices(context.Background()); err != nil {
+		t.Fatalf("WatchServices() error = %v", err)
+	}
+	adminID := uuid.New()
+
+	w := serve(ServiceStatuses(system), httptest.NewRequest(http.MethodGet, "/admin/services", nil), adminID, "admin")
+	var statuses struct {
+		Services []services.WatchedService `json:"services"`
+	}
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &statuses) != nil || len(statuses.Services) != 2 {
+		t.Fatalf("statuses = %d: %s", w.Code, w.Body.String())
+	}
+	if s := statuses.Services[0]; s.Name != "nginx" || s.Status != services.ServiceFailed || s.Attempts != 1 || s.NextAttempt == nil {
+		t.Errorf("nginx = %+v", s)
+	}
+	if s := statuses.Services[1]; s.Name != "mysql" || s.Status != services.ServiceRunning || s.Attempts != 0 {
+		t.Errorf("mysql = %+v", s)
+	}
+
+	restarts := func(query string) *httptest.ResponseRecorder {
+		return serve(ServiceRestarts(system), httptest.NewRequest(http.MethodGet, "/admin/services/restarts"+query, nil), adminID, "admin")
+	}
+	w = restarts("?service=nginx")
+	var list struct {
+		Restarts []models.ServiceRestart `json:"restarts"`
+	}
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &list) != nil || len(list.Restarts) != 1 || list.Restarts[0].Attempt != 1 {
+		t.Errorf("nginx restarts = %d: %s", w.Code, w.Body.String())
+	}
+	list.Restarts = nil
+	if w := restarts("?service=mysql"); json.Unmarshal(w.Body.Bytes(), &list) != nil || len(list.Restarts) != 0 {
+		t.Errorf("mysql restarts = %s", w.Body.String())
+	}
+	for _, limit := range []string{"0", "1001", "all"} {
+		if w := restarts("?limit=" + limit); w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("limit %s = %d, want 422", limit, w.Code)
+		}
+	}
+}
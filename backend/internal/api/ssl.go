@@ -0,0 +1,66 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+// certificateUpload is the body of inspecting certificate material. Files are base64 encoded, so
+// binary DER and PKCS#12 uploads survive JSON.
+type certificateUpload struct {
+	Certificate []byte `json:"certificate"`
+	PrivateKey  []byte `json:"private_key"`
+	Password    string `json:"password"`
+}
+
+// InspectCertificate detects the format of an uploaded certificate, checks it against its key and
+// reports what the panel would store, without the key
+func InspectCertificate(ssl *services.SSLService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req certificateUpload
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		converted, err := ssl.ConvertCertificate(req.Certificate, req.PrivateKey, req.Password)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, converted)
+	}
+}
+
+// GenerateCertificate issues a certificate for a domain from the ACME server. The names it covers
+// default to the domain and its www name; wildcards are validated over DNS.
+func GenerateCertificate(ssl *services.SSLService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		domainID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid domain id"})
+			return
+		}
+
+		var req struct {
+			Names []string `json:"names"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		certificate, err := ssl.GenerateCertificate(serviceContext(c), domainID, req.Names)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, certificate)
+	}
+}
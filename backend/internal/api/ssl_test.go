@@ -0,0 +1,106 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/runner"
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+func TestInspectCertificate(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "shop.example"},
+		DNSNames:     []string{"shop.example"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	keyDER, _ := x509.MarshalPKCS8PrivateKey(key)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+
+	inspect := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/ssl/inspect", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return serve(InspectCertificate(&services.SSLService{}), req, uuid.New(), "user")
+	}
+
+	w := inspect(`{"certificate":"` + base64.StdEncoding.EncodeToString(der) + `","private_key":"` + base64.StdEncoding.EncodeToString(keyPEM) + `"}`)
+	var body map[string]interface{}
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &body) != nil {
+		t.Fatalf("inspect DER = %d: %s", w.Code, w.Body.String())
+	}
+	if body["format"] != services.CertificateFormatDER || !strings.HasPrefix(body["certificate"].(string), "-----BEGIN CERTIFICATE-----") {
+		t.Errorf("response = %v", body)
+	}
+	if strings.Contains(w.Body.String(), "PRIVATE KEY") {
+		t.Error("response contains the private key")
+	}
+
+	if w := inspect(`{"certificate":"` + base64.StdEncoding.EncodeToString(der) + `"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("certificate without a key = %d, want 422", w.Code)
+	}
+	if w := inspect(`{"certificate":"not base64!"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("malformed body = %d, want 400", w.Code)
+	}
+}
+
+func TestGenerateCertificate(t *testing.T) {
+	db := newTestDB(t)
+	cfg := config.HostingConfig{}
+	domains := services.NewDomainService(db, nil, zap.NewNop(), cfg, nil, nil, runner.NewFake())
+	ssl := services.NewSSLService(db, nil, zap.NewNop(), cfg, domains, nil, nil, nil)
+	owner := &models.User{Username: "owner", Email: "owner@example.net", PasswordHash: "x", IsActive: true}
+	db.Create(owner)
+	domain := &models.Domain{UserID: owner.ID, Name: "example.com", DocumentRoot: "/var/www/example.com/public_html", IsActive: true}
+	db.Create(domain)
+
+	generate := func(id, body string, userID uuid.UUID) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/domains/"+id+"/ssl", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		return serveRoute("/domains/:id/ssl", GenerateCertificate(ssl), req, userID, "user")
+	}
+
+	tests := []struct {
+		name   string
+		id     string
+		body   string
+		userID uuid.UUID
+		want   int
+	}{
+		{"malformed domain id", "example", `{}`, owner.ID, http.StatusBadRequest},
+		{"malformed body", domain.ID.String(), `{"names":"example.com"}`, owner.ID, http.StatusBadRequest},
+		{"name outside the domain", domain.ID.String(), `{"names":["example.com","example.org"]}`, owner.ID, http.StatusUnprocessableEntity},
+		{"another user's domain", domain.ID.String(), `{}`, uuid.New(), http.StatusForbidden},
+		{"no ACME directory", domain.ID.String(), `{"names":["example.com","*.example.com"]}`, owner.ID, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := generate(tt.id, tt.body, tt.userID); w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
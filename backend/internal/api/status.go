@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+// statusNoticeBody is the body of setting the status page notice
+type statusNoticeBody struct {
+	Notice string `json:"notice"`
+}
+
+// PublicStatus serves the public status page. It needs no authentication, so failures are
+// reported without detail.
+func PublicStatus(status *services.StatusService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, err := status.PublicStatus(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": services.StatusUnknown})
+			return
+		}
+
+		c.JSON(http.StatusOK, page)
+	}
+}
+
+// SetStatusNotice publishes or clears the incident note on the status page (admin)
+func SetStatusNotice(status *services.StatusService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body statusNoticeBody
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := status.SetNotice(serviceContext(c), body.Notice); err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+func TestPublicStatus(t *testing.T) {
+	db := newTestDB(t)
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	status := services.NewStatusService(db, client, zap.NewNop(), config.StatusConfig{
+		Components: []config.StatusComponent{{Name: "Websites", Services: []string{"nginx", "php-fpm"}}},
+		CacheTTL:   time.Minute,
+		StaleAfter: 5 * time.Minute,
+	})
+	pid := 4242
+	db.Create(&models.ServiceStatus{ServiceName: "nginx", Status: "running", PID: &pid, Memory: 1 << 20, LastChecked: time.Now()})
+	db.Create(&models.ServiceStatus{ServiceName: "php-fpm", Status: "failed", LastChecked: time.Now()})
+
+	w := serve(PublicStatus(status), httptest.NewRequest(http.MethodGet, "/status", nil), uuid.Nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body.String())
+	}
+
+	var page map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if page["status"] != services.StatusDegraded {
+		t.Errorf("overall status = %v, want degraded", page["status"])
+	}
+	for key := range page {
+		switch key {
+		case "status", "components", "updated_at":
+		default:
+			t.Errorf("page reveals %q", key)
+		}
+	}
+	for _, internal := range []string{"nginx", "php-fpm", "4242", "failed", "service_name"} {
+		if strings.Contains(w.Body.String(), internal) {
+			t.Errorf("page reveals %q: %s", internal, w.Body.String())
+		}
+	}
+
+	// Failures are reported without detail
+	server.Close()
+	sqlDB, _ := db.DB()
+	sqlDB.Close()
+	w = serve(PublicStatus(status), httptest.NewRequest(http.MethodGet, "/status", nil), uuid.Nil)
+	if w.Code != http.StatusServiceUnavailable || strings.TrimSpace(w.Body.String()) != `{"status":"unknown"}` {
+		t.Errorf("unavailable: %d %s", w.Code, w.Body.String())
+	}
+}
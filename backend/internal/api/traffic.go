@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+// DomainTraffic reports a domain's traffic over time, by hour, day or month
+func DomainTraffic(domains *services.DomainService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		domainID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid domain id"})
+			return
+		}
+
+		var from, to time.Time
+		for name, target := range map[string]*time.Time{"from": &from, "to": &to} {
+			if value := c.Query(name); value != "" {
+				parsed, err := time.Parse(time.RFC3339, value)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + name + ", expected an RFC 3339 timestamp"})
+					return
+				}
+				*target = parsed
+			}
+		}
+
+		report, err := domains.GetTrafficReport(serviceContext(c), domainID, from, to, c.Query("interval"))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
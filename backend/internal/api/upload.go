@@ -0,0 +1,90 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+// uploadRequest is the body of starting an upload
+type uploadRequest struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// CreateUpload starts a resumable upload into a domain's directory
+func CreateUpload(files *services.FileService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		domainID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid domain id"})
+			return
+		}
+
+		var req uploadRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		upload, err := files.CreateUpload(serviceContext(c), domainID, req.Path, req.Size)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Header("Upload-Offset", "0")
+		c.JSON(http.StatusCreated, upload)
+	}
+}
+
+// GetUpload returns an upload with the offset to resume it from, also in the Upload-Offset header
+func GetUpload(files *services.FileService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		upload, err := files.GetUpload(serviceContext(c), c.Param("id"))
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		c.JSON(http.StatusOK, upload)
+	}
+}
+
+// WriteUploadChunk appends the request body to an upload. The Upload-Offset header names the
+// offset the chunk starts at, which must be the offset the upload has reached.
+func WriteUploadChunk(files *services.FileService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+		if err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Offset header must be a non-negative integer"})
+			return
+		}
+
+		upload, err := files.WriteChunk(serviceContext(c), c.Param("id"), offset, c.Request.Body)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		c.JSON(http.StatusOK, upload)
+	}
+}
+
+// CancelUpload gives up an upload and deletes the data received for it
+func CancelUpload(files *services.FileService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := files.CancelUpload(serviceContext(c), c.Param("id")); err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
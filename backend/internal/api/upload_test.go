@@ -0,0 +1,83 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/runner"
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+func TestUploadHandlers(t *testing.T) {
+	db := newTestDB(t)
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	cfg := config.HostingConfig{UploadDir: t.TempDir(), UploadTTL: time.Hour}
+	domains := services.NewDomainService(db, nil, zap.NewNop(), cfg, nil, nil, runner.NewFake())
+	files := services.NewFileService(db, client, zap.NewNop(), cfg, domains)
+	owner := &models.User{Username: "owner", Email: "owner@example.net", PasswordHash: "x", IsActive: true}
+	db.Create(owner)
+	domain := &models.Domain{UserID: owner.ID, Name: "example.com", DocumentRoot: "/var/www/example.com/public_html", IsActive: true}
+	db.Create(domain)
+
+	req := httptest.NewRequest(http.MethodPost, "/domains/"+domain.ID.String()+"/uploads", strings.NewReader(`{"path":"public_html/a.bin","size":10}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := serveRoute("/domains/:id/uploads", CreateUpload(files), req, owner.ID, "user")
+	var upload services.Upload
+	if w.Code != http.StatusCreated || json.Unmarshal(w.Body.Bytes(), &upload) != nil || w.Header().Get("Upload-Offset") != "0" {
+		t.Fatalf("create = %d: %s", w.Code, w.Body.String())
+	}
+	path := "/uploads/" + upload.ID
+
+	chunk := func(offset, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, path, strings.NewReader(body))
+		if offset != "" {
+			req.Header.Set("Upload-Offset", offset)
+		}
+		return serveRoute("/uploads/:id", WriteUploadChunk(files), req, owner.ID, "user")
+	}
+	get := func(userID uuid.UUID) *httptest.ResponseRecorder {
+		return serveRoute("/uploads/:id", GetUpload(files), httptest.NewRequest(http.MethodGet, path, nil), userID, "user")
+	}
+
+	for _, offset := range []string{"", "-1", "abc"} {
+		if w := chunk(offset, "abc"); w.Code != http.StatusBadRequest {
+			t.Errorf("chunk with Upload-Offset %q = %d, want 400", offset, w.Code)
+		}
+	}
+	if w := chunk("0", "abcd"); w.Code != http.StatusOK || w.Header().Get("Upload-Offset") != "4" {
+		t.Errorf("chunk = %d, offset %q: %s", w.Code, w.Header().Get("Upload-Offset"), w.Body.String())
+	}
+
+	// A client that lost track of the offset asks for it and is told off when it guesses wrong
+	if w := get(owner.ID); w.Code != http.StatusOK || w.Header().Get("Upload-Offset") != "4" {
+		t.Errorf("get = %d, offset %q", w.Code, w.Header().Get("Upload-Offset"))
+	}
+	if w := chunk("0", "abcd"); w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "upload_offset_mismatch") {
+		t.Errorf("chunk at a stale offset = %d: %s", w.Code, w.Body.String())
+	}
+	if w := chunk("4", "efghijklmn"); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("chunk past the size = %d: %s", w.Code, w.Body.String())
+	}
+	if w := get(uuid.New()); w.Code != http.StatusNotFound {
+		t.Errorf("another user's get = %d, want 404", w.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, path, nil)
+	if w := serveRoute("/uploads/:id", CancelUpload(files), req, owner.ID, "user"); w.Code != http.StatusNoContent {
+		t.Errorf("cancel = %d: %s", w.Code, w.Body.String())
+	}
+	if w := get(owner.ID); w.Code != http.StatusNotFound {
+		t.Errorf("get after cancelling = %d, want 404", w.Code)
+	}
+}
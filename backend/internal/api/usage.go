@@ -0,0 +1,59 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+// UsageExport downloads the usage of an account's domains during a month (YYYY-MM, UTC; the
+// current one by default) as CSV or JSON, for billing
+func UsageExport(users *services.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+
+		month := time.Now().UTC()
+		if value := c.Query("month"); value != "" {
+			month, err = time.Parse("2006-01", value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid month, expected YYYY-MM"})
+				return
+			}
+		}
+
+		format := c.DefaultQuery("format", services.ExportFormatCSV)
+		contentType := "text/csv; charset=utf-8"
+		switch format {
+		case services.ExportFormatCSV:
+		case services.ExportFormatJSON:
+			contentType = "application/json"
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported export format: " + format})
+			return
+		}
+
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="usage-%s.%s"`, month.Format("2006-01"), format))
+
+		if err := users.UsageExport(serviceContext(c), c.Writer, userID, month, format); err != nil {
+			// Permission and database errors come before anything is written; later failures can
+			// only truncate the download
+			if !c.Writer.Written() {
+				c.Writer.Header().Del("Content-Type")
+				c.Writer.Header().Del("Content-Disposition")
+				writeError(c, err)
+				return
+			}
+			c.Error(err)
+		}
+	}
+}
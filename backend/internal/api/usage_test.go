@@ -0,0 +1,76 @@
+package api
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+func TestUsageExport(t *testing.T) {
+	db := newTestDB(t)
+	users := services.NewUserService(db, nil, zap.NewNop(), nil, nil, nil, nil, config.AuthConfig{}, nil)
+	owner := &models.User{Username: "owner", Email: "owner@example.net", PasswordHash: "x", IsActive: true}
+	db.Create(owner)
+	domain := &models.Domain{UserID: owner.ID, Name: "shop.example", DocumentRoot: "/var/www/shop.example/public_html", IsActive: true}
+	db.Create(domain)
+	db.Create(&models.UsageSnapshot{DomainID: domain.ID, TakenAt: time.Date(2024, time.March, 3, 0, 0, 0, 0, time.UTC), UserID: owner.ID, DomainName: domain.Name, DiskUsage: 2048})
+
+	export := func(id, query string, userID uuid.UUID, roles ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/users/"+id+"/usage/export"+query, nil)
+		return serveRoute("/users/:id/usage/export", UsageExport(users), req, userID, roles...)
+	}
+
+	w := export(owner.ID.String(), "?month=2024-03", owner.ID, "user")
+	if w.Code != http.StatusOK {
+		t.Fatalf("export = %d: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/csv") {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if got := w.Header().Get("Content-Disposition"); got != `attachment; filename="usage-2024-03.csv"` {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil || len(rows) != 2 || rows[1][1] != "shop.example" || rows[1][5] != "2048" {
+		t.Errorf("CSV = %v, %v", rows, err)
+	}
+
+	w = export(owner.ID.String(), "?month=2024-03&format=json", owner.ID, "user")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" || !strings.Contains(w.Body.String(), `"domain_name":"shop.example"`) {
+		t.Errorf("JSON export = %d %q: %s", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+	}
+
+	tests := []struct {
+		name   string
+		id     string
+		query  string
+		userID uuid.UUID
+		want   int
+	}{
+		{"malformed user id", "owner", "", owner.ID, http.StatusBadRequest},
+		{"malformed month", owner.ID.String(), "?month=March", owner.ID, http.StatusBadRequest},
+		{"unknown format", owner.ID.String(), "?format=xml", owner.ID, http.StatusBadRequest},
+		{"another user's account", owner.ID.String(), "", uuid.New(), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := export(tt.id, tt.query, tt.userID, "user")
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body.String())
+			}
+			if w.Header().Get("Content-Disposition") != "" {
+				t.Error("error response is an attachment")
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+// visibleUser loads the caller's own account, or any account for admins. Otherwise it writes the
+// error response and returns nil.
+func visibleUser(c *gin.Context, users *services.UserService, userID uuid.UUID) *models.User {
+	callerID, isAdmin, ok := caller(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return nil
+	}
+	if !isAdmin && userID != callerID {
+		writeError(c, apperrors.PermissionDenied("user"))
+		return nil
+	}
+
+	user, err := users.GetUser(serviceContext(c), userID)
+	if err != nil {
+		writeError(c, err)
+		return nil
+	}
+	return user
+}
+
+// GetUser returns an account with its roles, and its ETag. A request whose If-None-Match names
+// the current ETag gets 304 Not Modified.
+func GetUser(users *services.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+
+		if user := visibleUser(c, users, userID); user != nil {
+			writeResource(c, user)
+		}
+	}
+}
+
+// ChangePassword changes the caller's own password, given the current one. It is the only
+// request a session with an expired password can make.
+func ChangePassword(users *services.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+
+		callerID, _, ok := caller(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+		if userID != callerID {
+			writeError(c, apperrors.PermissionDenied("user"))
+			return
+		}
+
+		var req struct {
+			CurrentPassword string `json:"current_password"`
+			NewPassword     string `json:"new_password"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := users.ChangePassword(serviceContext(c), userID, req.CurrentPassword, req.NewPassword); err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// SetLoginRestrictions sets the IP ranges and countries an account can log in from. With
+// If-Match, the change is only made while the account still has that ETag.
+func SetLoginRestrictions(users *services.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+			return
+		}
+
+		var req services.LoginRestrictions
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if c.GetHeader("If-Match") != "" {
+			current := visibleUser(c, users, userID)
+			if current == nil || !checkIfMatch(c, "user", current) {
+				return
+			}
+		}
+
+		if _, err := users.SetLoginRestrictions(serviceContext(c), userID, req); err != nil {
+			writeError(c, err)
+			return
+		}
+
+		if user := visibleUser(c, users, userID); user != nil {
+			writeResource(c, user)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/auth"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/runner"
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+// fieldErrors decodes a 422 response and returns the fields its "errors" map names, sorted
+func fieldErrors(t *testing.T, resp *httptest.ResponseRecorder) []string {
+	t.Helper()
+
+	if resp.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want 422: %s", resp.Code, resp.Body)
+	}
+	var body struct {
+		Error  string            `json:"error"`
+		Errors map[string]string `json:"errors"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if body.Error == "" {
+		t.Errorf("body has no error message: %s", resp.Body)
+	}
+
+	fields := make([]string, 0, len(body.Errors))
+	for field, message := range body.Errors {
+		if message == "" {
+			t.Errorf("field %q has no message", field)
+		}
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func TestRegisterReportsInvalidFields(t *testing.T) {
+	db := newTestDB(t)
+	authService := auth.NewService(db, nil, zap.NewNop(), config.AuthConfig{RegistrationMode: auth.RegistrationOpen, PasswordMinLength: 8}, nil, nil, nil, nil)
+	taken := &models.User{Username: "taken", Email: "taken@example.net", PasswordHash: "x", IsActive: true}
+	if err := db.Create(taken).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		fields []string
+	}{
+		{"missing username and bad email", `{"email":"not-an-address","password":"long enough"}`, []string{"email", "username"}},
+		{"short password", `{"username":"newcomer","email":"new@example.net","password":"short"}`, []string{"password"}},
+		{"taken username and email", `{"username":"taken","email":"taken@example.net","password":"long enough"}`, []string{"email", "username"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/auth/register", strings.NewReader(tt.body))
+			fields := fieldErrors(t, serve(Register(authService), req, uuid.Nil))
+			if strings.Join(fields, ",") != strings.Join(tt.fields, ",") {
+				t.Errorf("errors name %v, want %v", fields, tt.fields)
+			}
+		})
+	}
+}
+
+func TestCreateDomainReportsInvalidFields(t *testing.T) {
+	db := newTestDB(t)
+	domains := services.NewDomainService(db, nil, zap.NewNop(), config.HostingConfig{}, nil, nil, runner.NewFake())
+	owner := &models.User{Username: "owner", Email: "owner@example.net", PasswordHash: "x", IsActive: true}
+	if err := db.Create(owner).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if err := db.Create(&models.Domain{UserID: owner.ID, Name: "example.com", DocumentRoot: "/var/www/example.com/public_html", IsActive: true}).Error; err != nil {
+		t.Fatalf("create domain: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		fields []string
+	}{
+		{"invalid name", `{"name":"not a domain"}`, []string{"name"}},
+		{"existing name", `{"name":"example.com"}`, []string{"name"}},
+		{"negative quotas", `{"name":"example.org","disk_quota":-1,"bandwidth_quota":-1}`, []string{"bandwidth_quota", "disk_quota"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/domains", strings.NewReader(tt.body))
+			fields := fieldErrors(t, serve(CreateDomain(domains), req, owner.ID, "user"))
+			if strings.Join(fields, ",") != strings.Join(tt.fields, ",") {
+				t.Errorf("errors name %v, want %v", fields, tt.fields)
+			}
+		})
+	}
+}
+
+func TestCreateDNSRecordReportsInvalidFields(t *testing.T) {
+	db := newTestDB(t)
+	dns := services.NewDNSService(db, nil, zap.NewNop(), config.HostingConfig{DNSDefaultTTL: 3600}, nil, nil)
+	owner := &models.User{Username: "owner", Email: "owner@example.net", PasswordHash: "x", IsActive: true}
+	if err := db.Create(owner).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	domain := &models.Domain{UserID: owner.ID, Name: "example.com", DocumentRoot: "/var/www/example.com/public_html", IsActive: true, CustomDNSEnabled: true}
+	if err := db.Create(domain).Error; err != nil {
+		t.Fatalf("create domain: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		fields []string
+	}{
+		{"A record with a hostname", `{"type":"A","name":"www","value":"host.example.net"}`, []string{"value"}},
+		{"MX record without priority", `{"type":"MX","name":"@","value":"mail.example.com"}`, []string{"priority"}},
+		{"SOA record", `{"type":"SOA","name":"@","value":"ns1.example.com. hostmaster.example.com."}`, []string{"type"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/domains/"+domain.ID.String()+"/dns-records", strings.NewReader(tt.body))
+			resp := serveRoute("/domains/:id/dns-records", CreateDNSRecord(dns), req, owner.ID, "user")
+			fields := fieldErrors(t, resp)
+			if strings.Join(fields, ",") != strings.Join(tt.fields, ",") {
+				t.Errorf("errors name %v, want %v", fields, tt.fields)
+			}
+		})
+	}
+
+	t.Run("another user's domain", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/domains/"+domain.ID.String()+"/dns-records", strings.NewReader(`{"type":"A","name":"www","value":"192.0.2.1"}`))
+		resp := serveRoute("/domains/:id/dns-records", CreateDNSRecord(dns), req, uuid.New(), "user")
+		if resp.Code != http.StatusForbidden {
+			t.Errorf("status = %d, want 403: %s", resp.Code, resp.Body)
+		}
+	})
+}
@@ -0,0 +1,161 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+// vaultItemRequest is the body of creating or updating a vault item; omitted fields are kept
+// by updates
+type vaultItemRequest struct {
+	Name   *string `json:"name"`
+	Secret *string `json:"secret"`
+	Notes  *string `json:"notes"`
+}
+
+// VaultItems lists the names of the caller's vault items, without their secrets
+func VaultItems(vault *services.VaultService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, ok := caller(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		items, err := vault.ListItems(serviceContext(c), userID)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"items": items})
+	}
+}
+
+// CreateVaultItem stores a secret in the caller's vault
+func CreateVaultItem(vault *services.VaultService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, ok := caller(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		var req vaultItemRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var name string
+		var content services.VaultContent
+		if req.Name != nil {
+			name = *req.Name
+		}
+		if req.Secret != nil {
+			content.Secret = *req.Secret
+		}
+		if req.Notes != nil {
+			content.Notes = *req.Notes
+		}
+
+		item, err := vault.CreateItem(serviceContext(c), userID, name, content)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusCreated, item)
+	}
+}
+
+// GetVaultItem returns one of the caller's vault items with its secret and notes
+func GetVaultItem(vault *services.VaultService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, ok := caller(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		itemID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid vault item id"})
+			return
+		}
+
+		item, err := vault.GetItem(serviceContext(c), userID, itemID)
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, item)
+	}
+}
+
+// UpdateVaultItem changes the name, secret or notes of one of the caller's vault items
+func UpdateVaultItem(vault *services.VaultService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, ok := caller(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		itemID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid vault item id"})
+			return
+		}
+
+		var req vaultItemRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		item, err := vault.UpdateItem(serviceContext(c), userID, itemID, services.VaultItemUpdate{
+			Name:   req.Name,
+			Secret: req.Secret,
+			Notes:  req.Notes,
+		})
+		if err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, item)
+	}
+}
+
+// DeleteVaultItem removes one of the caller's vault items
+func DeleteVaultItem(vault *services.VaultService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, _, ok := caller(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		itemID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid vault item id"})
+			return
+		}
+
+		if err := vault.DeleteItem(serviceContext(c), userID, itemID); err != nil {
+			writeError(c, err)
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
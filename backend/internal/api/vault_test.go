@@ -0,0 +1,90 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/secret"
+	"github.com/mynodecp/mynodecp/backend/internal/services"
+)
+
+func TestVaultHandlers(t *testing.T) {
+	db := newTestDB(t)
+	keyring, err := secret.NewKeyring(map[string]string{"v1": base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", secret.KeySize)))}, "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret.Use(keyring)
+	t.Cleanup(func() { secret.Use(nil) })
+	vault := services.NewVaultService(db, zap.NewNop())
+	owner, other := uuid.New(), uuid.New()
+
+	send := func(method, path, body string, userID uuid.UUID, handler func(*services.VaultService) gin.HandlerFunc) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		route := "/vault"
+		if strings.Count(path, "/") > 1 {
+			route = "/vault/:id"
+		}
+		return serveRoute(route, handler(vault), req, userID, "user")
+	}
+
+	w := send(http.MethodPost, "/vault", `{"name":"FTP","secret":"s3cret","notes":"port 21"}`, owner, CreateVaultItem)
+	var created struct {
+		ID     uuid.UUID `json:"id"`
+		Secret string    `json:"secret"`
+	}
+	if w.Code != http.StatusCreated || json.Unmarshal(w.Body.Bytes(), &created) != nil || created.Secret != "s3cret" {
+		t.Fatalf("create = %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Cache-Control") != "no-store" {
+		t.Error("created item with its secret may be cached")
+	}
+	itemPath := "/vault/" + created.ID.String()
+
+	// The list names items without their secrets
+	w = send(http.MethodGet, "/vault", "", owner, VaultItems)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"name":"FTP"`) || strings.Contains(w.Body.String(), "s3cret") || strings.Contains(w.Body.String(), "enc:") {
+		t.Errorf("list = %d: %s", w.Code, w.Body.String())
+	}
+
+	w = send(http.MethodGet, itemPath, "", owner, GetVaultItem)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"secret":"s3cret"`) || w.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("get = %d: %s", w.Code, w.Body.String())
+	}
+	w = send(http.MethodPut, itemPath, `{"secret":"n3w"}`, owner, UpdateVaultItem)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"secret":"n3w"`) || !strings.Contains(w.Body.String(), `"notes":"port 21"`) {
+		t.Errorf("update = %d: %s", w.Code, w.Body.String())
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		userID  uuid.UUID
+		handler func(*services.VaultService) gin.HandlerFunc
+		want    int
+	}{
+		{"empty name", http.MethodPost, "/vault", `{"secret":"x"}`, owner, CreateVaultItem, http.StatusUnprocessableEntity},
+		{"malformed id", http.MethodGet, "/vault/42", "", owner, GetVaultItem, http.StatusBadRequest},
+		{"another user's item", http.MethodGet, itemPath, "", other, GetVaultItem, http.StatusNotFound},
+		{"another user updating", http.MethodPut, itemPath, `{"secret":"x"}`, other, UpdateVaultItem, http.StatusNotFound},
+		{"another user deleting", http.MethodDelete, itemPath, "", other, DeleteVaultItem, http.StatusNotFound},
+		{"owner deleting", http.MethodDelete, itemPath, "", owner, DeleteVaultItem, http.StatusNoContent},
+		{"deleted item", http.MethodGet, itemPath, "", owner, GetVaultItem, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if w := send(tt.method, tt.path, tt.body, tt.userID, tt.handler); w.Code != tt.want {
+			t.Errorf("%s = %d, want %d: %s", tt.name, w.Code, tt.want, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package apperrors
+
+import (
+	"errors"
+
+	"github.com/mynodecp/mynodecp/backend/internal/i18n"
+)
+
+// Coded is implemented by errors that carry a message code, so the API can render them in the
+// caller's language instead of the English Error() text
+type Coded interface {
+	error
+	Code() string
+	Params() map[string]string
+}
+
+func (e *NotFoundError) Code() string { return "not_found" }
+func (e *NotFoundError) Params() map[string]string {
+	return map[string]string{"resource": e.Resource}
+}
+
+func (e *PermissionDeniedError) Code() string {
+	if e.MessageCode != "" {
+		return e.MessageCode
+	}
+	return "permission_denied"
+}
+func (e *PermissionDeniedError) Params() map[string]string {
+	if e.MessageCode != "" {
+		return e.MessageParams
+	}
+	return map[string]string{"resource": e.Resource}
+}
+
+func (e *FeatureDisabledError) Code() string { return "feature_disabled" }
+func (e *FeatureDisabledError) Params() map[string]string {
+	return map[string]string{"feature": e.Feature}
+}
+
+func (e *PreconditionError) Code() string {
+	if e.MessageCode != "" {
+		return e.MessageCode
+	}
+	return "precondition_failed"
+}
+func (e *PreconditionError) Params() map[string]string {
+	if e.MessageCode != "" {
+		return e.MessageParams
+	}
+	return map[string]string{"reason": e.Reason}
+}
+
+func (e *ValidationError) Code() string              { return "validation_failed" }
+func (e *ValidationError) Params() map[string]string { return nil }
+
+// Message renders err for the locale. Coded errors are translated, with parameters such as
+// resource names translated as terms; other errors keep their English text and have no code.
+func Message(err error, locale string) (code, message string) {
+	var coded Coded
+	if !errors.As(err, &coded) {
+		return "", err.Error()
+	}
+
+	params := make(map[string]string, len(coded.Params()))
+	for name, value := range coded.Params() {
+		params[name] = i18n.Term(locale, value)
+	}
+	return coded.Code(), i18n.Translate(locale, coded.Code(), params)
+}
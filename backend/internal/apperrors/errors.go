@@ -0,0 +1,273 @@
+package apperrors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/i18n"
+)
+
+// NotFoundError reports that a requested resource does not exist
+type NotFoundError struct {
+	Resource string
+}
+
+func (e *NotFoundError) Error() string {
+	return e.Resource + " not found"
+}
+
+// GRPCStatus maps the error to codes.NotFound, which the gateway turns into a 404
+func (e *NotFoundError) GRPCStatus() *status.Status {
+	return status.New(codes.NotFound, e.Error())
+}
+
+// NotFound returns a NotFoundError for the named resource
+func NotFound(resource string) error {
+	return &NotFoundError{Resource: resource}
+}
+
+// IsNotFound reports whether err is or wraps a NotFoundError
+func IsNotFound(err error) bool {
+	var notFound *NotFoundError
+	return errors.As(err, &notFound)
+}
+
+// FromDB converts a lookup error into a NotFoundError when no record matched and wraps any other error
+func FromDB(err error, resource string) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return NotFound(resource)
+	}
+	return fmt.Errorf("failed to load %s: %w", resource, err)
+}
+
+// PermissionDeniedError reports that the caller may not access a resource
+type PermissionDeniedError struct {
+	Resource string
+
+	// Set by PermissionDeniedCode for denials that are not about a resource
+	MessageCode   string
+	MessageParams map[string]string
+}
+
+func (e *PermissionDeniedError) Error() string {
+	if e.MessageCode != "" {
+		return i18n.Translate(i18n.DefaultLocale, e.MessageCode, e.MessageParams)
+	}
+	return "permission denied for " + e.Resource
+}
+
+// GRPCStatus maps the error to codes.PermissionDenied, which the gateway turns into a 403
+func (e *PermissionDeniedError) GRPCStatus() *status.Status {
+	return status.New(codes.PermissionDenied, e.Error())
+}
+
+// PermissionDenied returns a PermissionDeniedError for the named resource
+func PermissionDenied(resource string) error {
+	return &PermissionDeniedError{Resource: resource}
+}
+
+// PermissionDeniedCode returns a PermissionDeniedError whose message is the one for code
+func PermissionDeniedCode(code string, params map[string]string) error {
+	return &PermissionDeniedError{MessageCode: code, MessageParams: params}
+}
+
+// IsPermissionDenied reports whether err is or wraps a PermissionDeniedError
+func IsPermissionDenied(err error) bool {
+	var denied *PermissionDeniedError
+	return errors.As(err, &denied)
+}
+
+// FeatureDisabledError reports that a service is not enabled for a domain
+type FeatureDisabledError struct {
+	Feature string
+}
+
+func (e *FeatureDisabledError) Error() string {
+	return "feature not enabled for this domain: " + e.Feature
+}
+
+// GRPCStatus maps the error to codes.FailedPrecondition
+func (e *FeatureDisabledError) GRPCStatus() *status.Status {
+	return status.New(codes.FailedPrecondition, e.Error())
+}
+
+// FeatureDisabled returns a FeatureDisabledError for the named feature
+func FeatureDisabled(feature string) error {
+	return &FeatureDisabledError{Feature: feature}
+}
+
+// IsFeatureDisabled reports whether err is or wraps a FeatureDisabledError
+func IsFeatureDisabled(err error) bool {
+	var disabled *FeatureDisabledError
+	return errors.As(err, &disabled)
+}
+
+// PreconditionError reports that an operation cannot run until something else is done first
+type PreconditionError struct {
+	Reason string
+
+	// Set by PreconditionCode to translate the reason
+	MessageCode   string
+	MessageParams map[string]string
+}
+
+func (e *PreconditionError) Error() string {
+	return e.Reason
+}
+
+// GRPCStatus maps the error to codes.FailedPrecondition
+func (e *PreconditionError) GRPCStatus() *status.Status {
+	return status.New(codes.FailedPrecondition, e.Error())
+}
+
+// Precondition returns a PreconditionError with the reason
+func Precondition(reason string) error {
+	return &PreconditionError{Reason: reason}
+}
+
+// PreconditionCode returns a PreconditionError whose reason is the message for code
+func PreconditionCode(code string, params map[string]string) error {
+	return &PreconditionError{
+		Reason:        i18n.Translate(i18n.DefaultLocale, code, params),
+		MessageCode:   code,
+		MessageParams: params,
+	}
+}
+
+// IsPrecondition reports whether err is or wraps a PreconditionError
+func IsPrecondition(err error) bool {
+	var precondition *PreconditionError
+	return errors.As(err, &precondition)
+}
+
+// ValidationError reports invalid input as a message per offending field
+type ValidationError struct {
+	Fields map[string]string
+
+	// codes holds the message code of fields added with AddCode
+	codes map[string]fieldCode
+}
+
+type fieldCode struct {
+	code   string
+	params map[string]string
+}
+
+// NewValidation returns an empty ValidationError to collect field errors into
+func NewValidation() *ValidationError {
+	return &ValidationError{Fields: make(map[string]string), codes: make(map[string]fieldCode)}
+}
+
+// Invalid returns a ValidationError for a single field
+func Invalid(field, message string) error {
+	v := NewValidation()
+	v.Add(field, message)
+	return v
+}
+
+// Add records a message for a field; the first message per field wins
+func (e *ValidationError) Add(field, message string) {
+	if _, ok := e.Fields[field]; !ok {
+		e.Fields[field] = message
+	}
+}
+
+// AddCode records the message for code for a field, so it can be localized; the first message
+// per field wins
+func (e *ValidationError) AddCode(field, code string, params map[string]string) {
+	if _, ok := e.Fields[field]; ok {
+		return
+	}
+	e.Fields[field] = i18n.Translate(i18n.DefaultLocale, code, params)
+	e.codes[field] = fieldCode{code: code, params: params}
+}
+
+// AddNested records the fields of other under prefix, keeping their message codes
+func (e *ValidationError) AddNested(prefix string, other *ValidationError) {
+	for field, message := range other.Fields {
+		if coded, ok := other.codes[field]; ok {
+			e.AddCode(prefix+"."+field, coded.code, coded.params)
+		} else {
+			e.Add(prefix+"."+field, message)
+		}
+	}
+}
+
+// InvalidCode returns a ValidationError for a single field with a coded message
+func InvalidCode(field, code string, params map[string]string) error {
+	v := NewValidation()
+	v.AddCode(field, code, params)
+	return v
+}
+
+// Localize returns the field messages in the locale. Fields added without a code keep their
+// English message.
+func (e *ValidationError) Localize(locale string) map[string]string {
+	fields := make(map[string]string, len(e.Fields))
+	for field, message := range e.Fields {
+		if coded, ok := e.codes[field]; ok {
+			message = i18n.Translate(locale, coded.code, coded.params)
+		}
+		fields[field] = message
+	}
+	return fields
+}
+
+// Err returns the error, or nil when no field was invalid
+func (e *ValidationError) Err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+func (e *ValidationError) Error() string {
+	fields := make([]string, 0, len(e.Fields))
+	for field := range e.Fields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	messages := make([]string, len(fields))
+	for i, field := range fields {
+		messages[i] = field + ": " + e.Fields[field]
+	}
+	return "invalid input: " + strings.Join(messages, "; ")
+}
+
+// GRPCStatus maps the error to codes.InvalidArgument
+func (e *ValidationError) GRPCStatus() *status.Status {
+	return status.New(codes.InvalidArgument, e.Error())
+}
+
+// AsValidation returns the ValidationError err is or wraps
+func AsValidation(err error) (*ValidationError, bool) {
+	var validation *ValidationError
+	ok := errors.As(err, &validation)
+	return validation, ok
+}
+
+// HTTPStatus returns the HTTP status code for an error returned by a service
+func HTTPStatus(err error) int {
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case IsNotFound(err):
+		return http.StatusNotFound
+	case IsPermissionDenied(err), IsFeatureDisabled(err):
+		return http.StatusForbidden
+	case IsPrecondition(err):
+		return http.StatusConflict
+	case errors.As(err, new(*ValidationError)):
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,109 @@
+package apperrors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+func TestFromDB(t *testing.T) {
+	missing := FromDB(gorm.ErrRecordNotFound, "domain")
+	if !IsNotFound(missing) || missing.Error() != "domain not found" {
+		t.Errorf("FromDB(ErrRecordNotFound) = %v, want domain not found", missing)
+	}
+
+	broken := errors.New("connection refused")
+	failed := FromDB(broken, "domain")
+	if IsNotFound(failed) || !errors.Is(failed, broken) {
+		t.Errorf("FromDB(other error) = %v, want it wrapped and not a NotFoundError", failed)
+	}
+}
+
+func TestNotFoundStatus(t *testing.T) {
+	wrapped := fmt.Errorf("failed to rename domain: %w", NotFound("domain"))
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"nil", nil, http.StatusOK},
+		{"not found", NotFound("subdomain"), http.StatusNotFound},
+		{"wrapped not found", wrapped, http.StatusNotFound},
+		{"other", errors.New("disk full"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HTTPStatus(tt.err); got != tt.want {
+				t.Errorf("HTTPStatus(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+
+	if code := status.Code(NotFound("user")); code != codes.NotFound {
+		t.Errorf("gRPC code = %v, want NotFound", code)
+	}
+}
+
+func TestMessage(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		locale      string
+		wantCode    string
+		wantMessage string
+	}{
+		{"coded error in English", NotFound("mailbox"), "en", "not_found", "mailbox not found"},
+		{"resource term translated", fmt.Errorf("lookup: %w", NotFound("mailbox")), "de", "not_found", "Postfach nicht gefunden"},
+		{"coded precondition", PreconditionCode("subdomain_limit_reached", map[string]string{"limit": "3"}), "de", "subdomain_limit_reached", "Diese Domain hat ihr Limit von 3 Subdomains erreicht"},
+		{"validation", Invalid("name", "is wrong"), "de", "validation_failed", "Einige Felder sind ungültig"},
+		{"plain error", errors.New("disk on fire"), "de", "", "disk on fire"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, message := Message(tt.err, tt.locale)
+			if code != tt.wantCode || message != tt.wantMessage {
+				t.Errorf("Message() = %q, %q; want %q, %q", code, message, tt.wantCode, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestValidationLocalize(t *testing.T) {
+	v := NewValidation()
+	v.AddCode("name", "field.required", nil)
+	v.Add("path", "must stay inside the domain")
+
+	fields := v.Localize("de")
+	if fields["name"] != "ist erforderlich" {
+		t.Errorf("coded field = %q, want the German message", fields["name"])
+	}
+	if fields["path"] != "must stay inside the domain" {
+		t.Errorf("uncoded field = %q, want the English message kept", fields["path"])
+	}
+	if v.Fields["name"] != "is required" {
+		t.Errorf("Fields[name] = %q, want the English message", v.Fields["name"])
+	}
+}
+
+func TestValidationAddNested(t *testing.T) {
+	record := NewValidation()
+	record.AddCode("name", "field.required", nil)
+	record.Add("ttl", "record TTL must be positive")
+
+	v := NewValidation()
+	v.AddNested("records[2]", record)
+
+	fields := v.Localize("de")
+	if fields["records[2].name"] != "ist erforderlich" {
+		t.Errorf("nested coded field = %q, want the German message", fields["records[2].name"])
+	}
+	if fields["records[2].ttl"] != "record TTL must be positive" {
+		t.Errorf("nested uncoded field = %q", fields["records[2].ttl"])
+	}
+}
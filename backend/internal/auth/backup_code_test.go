@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// withBackupCodes stores hashed backup codes for the user
+func withBackupCodes(t *testing.T, s *Service, user *models.User, codes ...string) {
+	t.Helper()
+
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = HashBackupCode(code)
+	}
+	encoded, _ := json.Marshal(hashes)
+	if err := s.db.Model(user).Update("two_factor_backup_codes", string(encoded)).Error; err != nil {
+		t.Fatalf("store backup codes: %v", err)
+	}
+}
+
+func TestConsumeBackupCodeOnce(t *testing.T) {
+	s := &Service{db: newTestDB(t)}
+	user := createTestUser(t, s.db)
+	withBackupCodes(t, s, user, "aaaa-bbbb", "cccc-dddd")
+	ctx := context.Background()
+
+	if !s.consumeBackupCode(ctx, user, "AAAA-BBBB") {
+		t.Fatal("first redemption refused")
+	}
+	if s.consumeBackupCode(ctx, user, "aaaa-bbbb") {
+		t.Error("code redeemed twice")
+	}
+	if !s.consumeBackupCode(ctx, user, "ccccdddd") {
+		t.Error("other code refused")
+	}
+}
+
+func TestConsumeBackupCodeConcurrentLogins(t *testing.T) {
+	s := &Service{db: newTestDB(t)}
+	user := createTestUser(t, s.db)
+	withBackupCodes(t, s, user, "aaaa-bbbb", "cccc-dddd")
+	ctx := context.Background()
+
+	// Two logins read the user before either redeems a code
+	var first, second models.User
+	s.db.Where("id = ?", user.ID).First(&first)
+	s.db.Where("id = ?", user.ID).First(&second)
+
+	if !s.consumeBackupCode(ctx, &first, "aaaa-bbbb") {
+		t.Fatal("first login refused")
+	}
+	if s.consumeBackupCode(ctx, &second, "aaaa-bbbb") {
+		t.Error("second login redeemed the same code")
+	}
+
+	// A login that read the codes before another one was redeemed can still use its own
+	var third models.User
+	s.db.Where("id = ?", user.ID).First(&third)
+	withBackupCodes(t, s, user, "cccc-dddd", "eeee-ffff")
+	if !s.consumeBackupCode(ctx, &third, "cccc-dddd") {
+		t.Error("login with stale codes refused a valid code")
+	}
+
+	var stored models.User
+	s.db.Where("id = ?", user.ID).First(&stored)
+	var hashes []string
+	json.Unmarshal([]byte(stored.TwoFactorBackupCodes), &hashes)
+	if len(hashes) != 1 || hashes[0] != HashBackupCode("eeee-ffff") {
+		t.Errorf("remaining codes = %v, want only eeee-ffff", hashes)
+	}
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/mynodecp/mynodecp/backend/internal/egress"
+)
+
+// maxRangeResponse bounds the size of a range API response
+const maxRangeResponse = 1 << 20
+
+// BreachChecker reports whether a password appears in known data breaches
+type BreachChecker interface {
+	IsBreached(ctx context.Context, password string) (bool, error)
+}
+
+// NewBreachChecker returns a checker for the Pwned Passwords range API, or nil when disabled.
+// Range responses are cached in Redis for cacheTTL. Requests follow the outbound policy.
+func NewBreachChecker(enabled bool, apiURL string, cacheTTL time.Duration, redis *redis.Client, outbound *egress.Policy) BreachChecker {
+	if !enabled {
+		return nil
+	}
+
+	return &rangeChecker{
+		url:      strings.TrimSuffix(apiURL, "/") + "/",
+		client:   outbound.Client(5 * time.Second),
+		redis:    redis,
+		cacheTTL: cacheTTL,
+	}
+}
+
+// rangeChecker implements the k-anonymity range protocol: only the first five hex characters of
+// the password's SHA-1 hash leave the server, and the match is made locally against the suffixes
+type rangeChecker struct {
+	url      string
+	client   *http.Client
+	redis    *redis.Client
+	cacheTTL time.Duration
+}
+
+func (c *rangeChecker) IsBreached(ctx context.Context, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	body, err := c.rangeFor(ctx, prefix)
+	if err != nil {
+		return false, err
+	}
+
+	return rangeContains(body, suffix), nil
+}
+
+// rangeFor returns the suffix list for a hash prefix, from the cache when possible
+func (c *rangeChecker) rangeFor(ctx context.Context, prefix string) (string, error) {
+	key := "pwned_range:" + prefix
+	if c.redis != nil {
+		if cached, err := c.redis.Get(ctx, key).Result(); err == nil {
+			return cached, nil
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url+prefix, nil)
+	if err != nil {
+		return "", err
+	}
+	// Padding hides the real size of the response from observers
+	req.Header.Set("Add-Padding", "true")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("breach check request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("breach check returned status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRangeResponse))
+	if err != nil {
+		return "", fmt.Errorf("failed to read breach check response: %w", err)
+	}
+
+	body := string(data)
+	if c.redis != nil && c.cacheTTL > 0 {
+		c.redis.Set(ctx, key, body, c.cacheTTL)
+	}
+
+	return body, nil
+}
+
+// rangeContains reports whether a range response lists suffix with a non-zero count.
+// Padding entries have a count of zero.
+func rangeContains(body, suffix string) bool {
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	for scanner.Scan() {
+		entry, count, found := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if found && strings.EqualFold(entry, suffix) && count != "0" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+)
+
+// pwnedRange serves a range API listing the breached password, counting the requests it gets
+func pwnedRange(t *testing.T, breached string) (string, *int32) {
+	t.Helper()
+
+	sum := sha1.Sum([]byte(breached))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if len(strings.TrimPrefix(r.URL.Path, "/range/")) != 5 {
+			t.Errorf("request path %s does not end in a five character prefix", r.URL.Path)
+		}
+		if r.Header.Get("Add-Padding") != "true" {
+			t.Error("request without padding")
+		}
+		if strings.HasSuffix(r.URL.Path, hash[:5]) {
+			w.Write([]byte("0000000000000000000000000000000000A:0\r\n" + hash[5:] + ":42\r\n"))
+			return
+		}
+		w.Write([]byte("0000000000000000000000000000000000B:3\r\n"))
+	}))
+	t.Cleanup(server.Close)
+	return server.URL + "/range", &requests
+}
+
+func TestRangeChecker(t *testing.T) {
+	apiURL, requests := pwnedRange(t, "password123")
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	checker := NewBreachChecker(true, apiURL, time.Hour, client, nil)
+	ctx := context.Background()
+
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{"password123", true},
+		{"correct horse battery staple", false},
+		{"password123", true},
+	}
+	for _, tt := range tests {
+		got, err := checker.IsBreached(ctx, tt.password)
+		if err != nil || got != tt.want {
+			t.Errorf("IsBreached(%q) = %v, %v; want %v", tt.password, got, err, tt.want)
+		}
+	}
+	// The repeated prefix is answered from the cache
+	if got := atomic.LoadInt32(requests); got != 2 {
+		t.Errorf("range requests = %d, want 2", got)
+	}
+}
+
+func TestRangeContainsIgnoresPadding(t *testing.T) {
+	body := "ABCDEF:0\nFEDCBA:12\n"
+	if rangeContains(body, "ABCDEF") {
+		t.Error("padding entry counted as a breach")
+	}
+	if !rangeContains(body, "fedcba") {
+		t.Error("listed suffix not found")
+	}
+}
+
+// failingBreach fails every check
+type failingBreach struct{}
+
+func (failingBreach) IsBreached(context.Context, string) (bool, error) {
+	return false, errors.New("API unreachable")
+}
+
+func TestCheckPassword(t *testing.T) {
+	apiURL, _ := pwnedRange(t, "password123")
+	cfg := config.AuthConfig{PasswordMinLength: 8}
+
+	tests := []struct {
+		name     string
+		breach   BreachChecker
+		password string
+		want     error
+	}{
+		{"breached", NewBreachChecker(true, apiURL, 0, nil, nil), "password123", ErrPasswordBreached},
+		{"not breached", NewBreachChecker(true, apiURL, 0, nil, nil), "a-fresh-passphrase", nil},
+		{"check disabled", NewBreachChecker(false, apiURL, 0, nil, nil), "password123", nil},
+		{"API down fails open", failingBreach{}, "password123", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{config: cfg, breach: tt.breach}
+			if err := s.CheckPassword(context.Background(), tt.password); !errors.Is(err, tt.want) {
+				t.Errorf("CheckPassword() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	s := &Service{config: cfg}
+	if err := s.CheckPassword(context.Background(), "short"); err == nil {
+		t.Error("short password accepted")
+	}
+}
@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// banConfig bans an IP for an hour after three failed logins within 15 minutes
+func banConfig() config.AuthConfig {
+	return config.AuthConfig{
+		JWTSecret:         "test",
+		JWTExpiration:     time.Hour,
+		RefreshExpiration: time.Hour,
+		BanThreshold:      3,
+		BanWindow:         15 * time.Minute,
+		BanDuration:       time.Hour,
+	}
+}
+
+func TestRecordAuthFailureValidation(t *testing.T) {
+	s, _ := newSessionService(t, banConfig())
+
+	tests := []struct {
+		source, ip, field string
+	}{
+		{"imap", "198.51.100.7", "source"},
+		{"", "198.51.100.7", "source"},
+		{SourceFTP, "", "ip_address"},
+		{SourceFTP, "198.51.100.300", "ip_address"},
+		{SourceFTP, "host.example", "ip_address"},
+	}
+	for _, tt := range tests {
+		_, err := s.RecordAuthFailure(context.Background(), tt.source, tt.ip, "web")
+		if validation, ok := apperrors.AsValidation(err); !ok || validation.Fields[tt.field] == "" {
+			t.Errorf("RecordAuthFailure(%q, %q) error = %v, want a %s error", tt.source, tt.ip, err, tt.field)
+		}
+	}
+
+	var count int64
+	s.db.Model(&models.SecurityEvent{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d security events for refused reports", count)
+	}
+}
+
+func TestFTPFailuresBanIP(t *testing.T) {
+	s, server := newSessionService(t, banConfig())
+	s.geo = fixedResolver{}
+	user := createTestUser(t, s.db)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	s.db.Model(user).Update("password_hash", string(hash))
+	ctx := context.Background()
+
+	for i := int64(1); i <= 2; i++ {
+		standing, err := s.RecordAuthFailure(ctx, SourceFTP, "198.51.100.7", "web")
+		if err != nil || standing.Banned || standing.Failures != i {
+			t.Fatalf("failure %d = %+v, %v", i, standing, err)
+		}
+	}
+	if s.IPBannedUntil(ctx, "198.51.100.7") != nil {
+		t.Fatal("IP banned below the threshold")
+	}
+
+	// The third failure, the IPv4 address written as IPv6, bans the IP
+	standing, err := s.RecordAuthFailure(ctx, SourceFTP, "::ffff:198.51.100.7", "web")
+	if err != nil || !standing.Banned || standing.IPAddress != "198.51.100.7" || standing.BannedUntil == nil {
+		t.Fatalf("third failure = %+v, %v", standing, err)
+	}
+	if until := s.IPBannedUntil(ctx, "198.51.100.7"); until == nil || time.Until(*until) < 59*time.Minute {
+		t.Errorf("ban ends at %v, want in an hour", until)
+	}
+
+	var events []models.SecurityEvent
+	s.db.Where("type = ?", "brute_force").Find(&events)
+	if len(events) != 1 || events[0].Source != SourceFTP || !strings.Contains(events[0].Description, "3 ftp") {
+		t.Errorf("brute force events = %+v", events)
+	}
+	var failures int64
+	s.db.Model(&models.SecurityEvent{}).Where("type = ? AND source = ?", "login_failed", SourceFTP).Count(&failures)
+	if failures != 3 {
+		t.Errorf("%d failed FTP logins recorded, want 3", failures)
+	}
+
+	// The ban covers the panel too, even with the right password
+	login := &LoginRequest{Username: user.Username, Password: "correct horse", IPAddress: "198.51.100.7"}
+	if _, err := s.Login(ctx, login); !errors.Is(err, ErrIPBanned) {
+		t.Errorf("Login() from the banned IP error = %v", err)
+	}
+	if _, err := s.Login(ctx, &LoginRequest{Username: user.Username, Password: "correct horse", IPAddress: "203.0.113.1"}); err != nil {
+		t.Errorf("Login() from another IP error = %v", err)
+	}
+
+	// Further failures while banned are reported as banned without a second ban
+	if standing, _ := s.RecordAuthFailure(ctx, SourceSSH, "198.51.100.7", "root"); !standing.Banned {
+		t.Errorf("failure during the ban = %+v", standing)
+	}
+	s.db.Model(&models.SecurityEvent{}).Where("type = ?", "brute_force").Count(&failures)
+	if failures != 1 {
+		t.Errorf("%d brute force events, want 1", failures)
+	}
+
+	// The ban runs out
+	server.FastForward(time.Hour + time.Second)
+	if s.IPBannedUntil(ctx, "198.51.100.7") != nil {
+		t.Error("ban outlived its duration")
+	}
+	if _, err := s.Login(ctx, login); err != nil {
+		t.Errorf("Login() after the ban error = %v", err)
+	}
+}
+
+func TestFailuresAcrossSourcesBanIP(t *testing.T) {
+	s, server := newSessionService(t, banConfig())
+	s.geo = fixedResolver{}
+	user := createTestUser(t, s.db)
+	ctx := context.Background()
+
+	// Failures outside the window are forgotten
+	s.RecordAuthFailure(ctx, SourceSSH, "198.51.100.7", "root")
+	s.RecordAuthFailure(ctx, SourceSSH, "198.51.100.7", "root")
+	server.FastForward(16 * time.Minute)
+
+	if standing, _ := s.RecordAuthFailure(ctx, SourceEmail, "198.51.100.7", "info@shop.example"); standing.Failures != 1 {
+		t.Errorf("failures after the window = %d, want 1", standing.Failures)
+	}
+	s.Login(ctx, &LoginRequest{Username: user.Username, Password: "wrong", IPAddress: "198.51.100.7"})
+	standing, _ := s.RecordAuthFailure(ctx, SourceFTP, "198.51.100.7", "web")
+	if !standing.Banned {
+		t.Fatalf("mail, panel and FTP failures did not add up to a ban: %+v", standing)
+	}
+
+	var event models.SecurityEvent
+	s.db.Where("type = ?", "brute_force").First(&event)
+	for _, part := range []string{"1 email", "1 ftp", "1 web"} {
+		if !strings.Contains(event.Description, part) {
+			t.Errorf("ban event %q lacks %q", event.Description, part)
+		}
+	}
+
+	// An admin lifts the ban, and the count starts over
+	if err := s.UnbanIP(ctx, "198.51.100.7"); err != nil {
+		t.Fatalf("UnbanIP() error = %v", err)
+	}
+	if s.IPBannedUntil(ctx, "198.51.100.7") != nil {
+		t.Error("IP still banned")
+	}
+	if standing, _ := s.RecordAuthFailure(ctx, SourceFTP, "198.51.100.7", "web"); standing.Banned || standing.Failures != 1 {
+		t.Errorf("failure after the unban = %+v", standing)
+	}
+	if err := s.UnbanIP(ctx, "203.0.113.1"); apperrors.HTTPStatus(err) != http.StatusNotFound {
+		t.Errorf("UnbanIP() of an IP never banned: error = %v", err)
+	}
+	if err := s.UnbanIP(ctx, "not-an-ip"); apperrors.HTTPStatus(err) != http.StatusUnprocessableEntity {
+		t.Errorf("UnbanIP() of a malformed IP: error = %v", err)
+	}
+}
+
+func TestBansDisabled(t *testing.T) {
+	cfg := banConfig()
+	cfg.BanThreshold = 0
+	s, _ := newSessionService(t, cfg)
+	ctx := context.Background()
+
+	for i := 0; i < 10; i++ {
+		standing, err := s.RecordAuthFailure(ctx, SourceFTP, "198.51.100.7", "web")
+		if err != nil || standing.Banned {
+			t.Fatalf("failure %d = %+v, %v", i, standing, err)
+		}
+	}
+
+	// The failures are still recorded for the attack overview
+	var count int64
+	s.db.Model(&models.SecurityEvent{}).Where("type = ?", "login_failed").Count(&count)
+	if count != 10 {
+		t.Errorf("%d failures recorded, want 10", count)
+	}
+}
+
+func TestAttackSources(t *testing.T) {
+	s, _ := newSessionService(t, banConfig())
+	ctx := context.Background()
+
+	for _, failure := range []struct{ source, ip string }{
+		{SourceFTP, "198.51.100.7"},
+		{SourceFTP, "198.51.100.7"},
+		{SourceSSH, "198.51.100.7"},
+		{SourceEmail, "203.0.113.1"},
+		{SourceWeb, "203.0.113.1"},
+		{SourceSSH, "192.0.2.99"},
+	} {
+		if _, err := s.RecordAuthFailure(ctx, failure.source, failure.ip, "someone"); err != nil {
+			t.Fatalf("RecordAuthFailure() error = %v", err)
+		}
+	}
+	// A failure from before the period does not count
+	s.db.Create(&models.SecurityEvent{Type: "login_failed", Source: SourceSSH, IPAddress: "192.0.2.99", CreatedAt: time.Now().Add(-48 * time.Hour)})
+
+	attacks, err := s.AttackSources(ctx, time.Now().Add(-24*time.Hour), 0)
+	if err != nil {
+		t.Fatalf("AttackSources() error = %v", err)
+	}
+	if len(attacks) != 3 {
+		t.Fatalf("%d attack sources, want 3: %+v", len(attacks), attacks)
+	}
+	first := attacks[0]
+	if first.IPAddress != "198.51.100.7" || first.Total != 3 || first.Failures[SourceFTP] != 2 || first.Failures[SourceSSH] != 1 {
+		t.Errorf("top attack source = %+v", first)
+	}
+	if first.BannedUntil == nil || first.LastSeenAt == nil {
+		t.Errorf("banned IP lacks its ban or last failure: %+v", first)
+	}
+	if attacks[1].IPAddress != "203.0.113.1" || attacks[1].Total != 2 || attacks[1].BannedUntil != nil {
+		t.Errorf("second attack source = %+v", attacks[1])
+	}
+	if attacks[2].IPAddress != "192.0.2.99" || attacks[2].Total != 1 {
+		t.Errorf("third attack source = %+v", attacks[2])
+	}
+
+	if attacks, _ := s.AttackSources(ctx, time.Now().Add(-24*time.Hour), 1); len(attacks) != 1 {
+		t.Errorf("limit 1 returned %d attack sources", len(attacks))
+	}
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mynodecp/mynodecp/backend/internal/egress"
+)
+
+// CaptchaVerifier checks a CAPTCHA token solved by a client
+type CaptchaVerifier interface {
+	Verify(ctx context.Context, token, remoteIP string) (bool, error)
+}
+
+// captchaVerifyURLs are the siteverify endpoints of the supported providers
+var captchaVerifyURLs = map[string]string{
+	"recaptcha": "https://www.google.com/recaptcha/api/siteverify",
+	"hcaptcha":  "https://hcaptcha.com/siteverify",
+	"turnstile": "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+}
+
+// NewCaptchaVerifier returns a verifier for the named provider, or nil when provider is empty.
+// Requests follow the outbound policy.
+func NewCaptchaVerifier(provider, secret string, outbound *egress.Policy) (CaptchaVerifier, error) {
+	if provider == "" {
+		return nil, nil
+	}
+
+	verifyURL, ok := captchaVerifyURLs[provider]
+	if !ok {
+		return nil, fmt.Errorf("unsupported captcha provider: %s", provider)
+	}
+
+	return &siteVerifier{
+		url:    verifyURL,
+		secret: secret,
+		client: outbound.Client(10 * time.Second),
+	}, nil
+}
+
+// siteVerifier implements the siteverify protocol shared by reCAPTCHA, hCaptcha and Turnstile
+type siteVerifier struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+func (v *siteVerifier) Verify(ctx context.Context, token, remoteIP string) (bool, error) {
+	form := url.Values{
+		"secret":   {v.secret},
+		"response": {token},
+	}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return false, fmt.Errorf("failed to create captcha request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to verify captcha: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("captcha provider returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false, fmt.Errorf("failed to decode captcha response: %w", err)
+	}
+
+	return result.Success, nil
+}
@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+)
+
+// stubCaptcha accepts a single token
+type stubCaptcha struct{ token string }
+
+func (c stubCaptcha) Verify(_ context.Context, token, _ string) (bool, error) {
+	return token == c.token, nil
+}
+
+func TestLoginRequiresCaptchaAfterFailures(t *testing.T) {
+	s, _ := newSessionService(t, config.AuthConfig{CaptchaThreshold: 2, CaptchaWindow: time.Hour})
+	s.captcha = stubCaptcha{token: "solved"}
+	ctx := context.Background()
+	login := func(token string) error {
+		_, err := s.Login(ctx, &LoginRequest{Username: "nobody", Password: "guess", IPAddress: "203.0.113.9", CaptchaToken: token})
+		return err
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := login(""); err == nil || errors.Is(err, ErrCaptchaRequired) {
+			t.Fatalf("failed login %d: error = %v, want invalid credentials", i+1, err)
+		}
+	}
+	if err := login(""); !errors.Is(err, ErrCaptchaRequired) {
+		t.Errorf("login without a CAPTCHA: error = %v, want ErrCaptchaRequired", err)
+	}
+	if err := login("wrong"); !errors.Is(err, ErrCaptchaInvalid) {
+		t.Errorf("login with a bad CAPTCHA: error = %v, want ErrCaptchaInvalid", err)
+	}
+	if err := login("solved"); errors.Is(err, ErrCaptchaRequired) || errors.Is(err, ErrCaptchaInvalid) {
+		t.Errorf("login with a solved CAPTCHA: error = %v", err)
+	}
+
+	// Other addresses are not affected
+	if _, err := s.Login(ctx, &LoginRequest{Username: "nobody", Password: "guess", IPAddress: "203.0.113.10"}); errors.Is(err, ErrCaptchaRequired) {
+		t.Error("CAPTCHA required from another address")
+	}
+
+	// Raising the threshold lifts the requirement; resetting it restores the configured one
+	if err := s.SetCaptchaThreshold(ctx, 10); err != nil {
+		t.Fatalf("SetCaptchaThreshold: %v", err)
+	}
+	if err := login(""); errors.Is(err, ErrCaptchaRequired) {
+		t.Error("CAPTCHA required under the raised threshold")
+	}
+	if err := s.SetCaptchaThreshold(ctx, 0); err != nil {
+		t.Fatalf("reset threshold: %v", err)
+	}
+	if err := login(""); !errors.Is(err, ErrCaptchaRequired) {
+		t.Errorf("after resetting the threshold: error = %v, want ErrCaptchaRequired", err)
+	}
+}
+
+func TestSiteVerifier(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    bool
+		wantErr bool
+	}{
+		{name: "solved", status: http.StatusOK, body: `{"success": true}`, want: true},
+		{name: "rejected", status: http.StatusOK, body: `{"success": false}`},
+		{name: "provider error", status: http.StatusInternalServerError, wantErr: true},
+		{name: "malformed response", status: http.StatusOK, body: `<html>`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.PostFormValue("secret") != "shh" || r.PostFormValue("response") != "token" || r.PostFormValue("remoteip") != "203.0.113.9" {
+					t.Errorf("verification form = %v", r.PostForm)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			verifier := &siteVerifier{url: server.URL, secret: "shh", client: server.Client()}
+			got, err := verifier.Verify(context.Background(), "token", "203.0.113.9")
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("Verify() = %v, %v; want %v with error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewCaptchaVerifier(t *testing.T) {
+	if verifier, err := NewCaptchaVerifier("", "", nil); verifier != nil || err != nil {
+		t.Errorf("no provider = %v, %v; want disabled", verifier, err)
+	}
+	for provider := range captchaVerifyURLs {
+		if _, err := NewCaptchaVerifier(provider, "secret", nil); err != nil {
+			t.Errorf("provider %s: %v", provider, err)
+		}
+	}
+	if _, err := NewCaptchaVerifier("puzzle", "secret", nil); err == nil {
+		t.Error("unknown provider accepted")
+	}
+}
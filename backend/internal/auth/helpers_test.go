@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/mynodecp/mynodecp/backend/internal/database"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// newTestDB opens an in-memory database of its own for a test, with the schema migrated
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := "file:" + uuid.NewString() + "?mode=memory&cache=shared&_busy_timeout=5000"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("test database handle: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	return db
+}
+
+// createTestUser stores an active user with a unique name
+func createTestUser(t *testing.T, db *gorm.DB) *models.User {
+	t.Helper()
+
+	name := "user" + uuid.NewString()[:8]
+	user := &models.User{
+		Username:     name,
+		Email:        name + "@example.net",
+		PasswordHash: "x",
+		IsActive:     true,
+	}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/geoip"
+	"github.com/mynodecp/mynodecp/backend/internal/mailer"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// withSessionFrom stores a session of the user located in the country
+func withSessionFrom(t *testing.T, s *Service, user *models.User, countryCode string) {
+	t.Helper()
+
+	session := &models.Session{
+		UserID:       user.ID,
+		Token:        uuid.NewString(),
+		RefreshToken: uuid.NewString(),
+		CountryCode:  countryCode,
+		ExpiresAt:    time.Now().Add(time.Hour),
+	}
+	if err := s.db.Create(session).Error; err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+}
+
+func TestCheckNewCountry(t *testing.T) {
+	db := newTestDB(t)
+	s := &Service{db: db, logger: zap.NewNop(), mailer: mailer.NewWithSender(db, config.MailConfig{}, zap.NewNop(), nil)}
+	user := createTestUser(t, db)
+	withSessionFrom(t, s, user, "DE")
+	ctx := context.Background()
+	req := &LoginRequest{IPAddress: "198.51.100.7"}
+
+	s.checkNewCountry(ctx, user, &geoip.Location{CountryCode: "DE"}, req)
+	s.checkNewCountry(ctx, user, &geoip.Location{CountryCode: "FR", Country: "France"}, req)
+
+	var alerts []models.OutboxEmail
+	db.Where("template = ?", "new_country_login").Find(&alerts)
+	if len(alerts) != 1 || alerts[0].To != user.Email {
+		t.Fatalf("alerts = %+v, want one to %s", alerts, user.Email)
+	}
+	var events int64
+	db.Model(&models.SecurityEvent{}).Where("type = ?", "new_country_login").Count(&events)
+	if events != 1 {
+		t.Errorf("security events = %d, want 1", events)
+	}
+}
+
+func TestLoginFromNewCountryWhenAlertCannotBeQueued(t *testing.T) {
+	db := newTestDB(t)
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	s := NewService(db, client, zap.NewNop(), config.AuthConfig{JWTSecret: "test", JWTExpiration: time.Hour, RefreshExpiration: time.Hour},
+		fixedResolver{location: &geoip.Location{CountryCode: "FR"}}, nil, mailer.NewWithSender(db, config.MailConfig{}, zap.NewNop(), nil), nil)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	user := &models.User{Username: "traveller", Email: "not an address", PasswordHash: string(hash), IsActive: true, FailedLoginCount: 2}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	withSessionFrom(t, s, user, "DE")
+
+	// The alert cannot be queued for the malformed address, and the login goes ahead regardless
+	if _, err := s.Login(context.Background(), &LoginRequest{Username: "traveller", Password: "correct horse", IPAddress: "198.51.100.7"}); err != nil {
+		t.Fatalf("Login() error = %v, want the login allowed", err)
+	}
+
+	var events, sessions, alerts int64
+	db.Model(&models.SecurityEvent{}).Where("type = ?", "new_country_login").Count(&events)
+	db.Model(&models.Session{}).Where("user_id = ? AND country_code = ?", user.ID, "FR").Count(&sessions)
+	db.Model(&models.OutboxEmail{}).Where("template = ?", "new_country_login").Count(&alerts)
+	if events != 1 || sessions != 1 || alerts != 0 {
+		t.Errorf("%d security events, %d sessions from FR and %d alerts, want 1, 1 and 0", events, sessions, alerts)
+	}
+	var stored models.User
+	db.First(&stored, "id = ?", user.ID)
+	if stored.FailedLoginCount != 0 || stored.LastLoginAt == nil {
+		t.Errorf("login not recorded: %d failures, last login %v", stored.FailedLoginCount, stored.LastLoginAt)
+	}
+}
+
+// fixedResolver locates every address in the same place, or fails to look any up
+type fixedResolver struct {
+	location *geoip.Location
+	err      error
+}
+
+func (r fixedResolver) Lookup(string) (*geoip.Location, error) {
+	return r.location, r.err
+}
+
+func TestCreateSessionStoresLocation(t *testing.T) {
+	tests := []struct {
+		name     string
+		resolver geoip.Resolver
+		want     geoip.Location
+	}{
+		{"located", fixedResolver{location: &geoip.Location{CountryCode: "NL", Country: "Netherlands", City: "Amsterdam"}}, geoip.Location{CountryCode: "NL", Country: "Netherlands", City: "Amsterdam"}},
+		{"unknown address", fixedResolver{}, geoip.Location{}},
+		{"lookup failure", fixedResolver{err: errors.New("corrupt database")}, geoip.Location{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			s := &Service{db: db, geo: tt.resolver, config: config.AuthConfig{RefreshExpiration: time.Hour}}
+			user := createTestUser(t, db)
+
+			session, err := s.createSession(context.Background(), user, "198.51.100.7", "test", s.lookupLocation("198.51.100.7"))
+			if err != nil {
+				t.Fatalf("createSession: %v", err)
+			}
+			var stored models.Session
+			db.Where("id = ?", session.ID).First(&stored)
+			if got := (geoip.Location{CountryCode: stored.CountryCode, Country: stored.Country, City: stored.City}); got != tt.want {
+				t.Errorf("session location = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckNewCountryFirstLocatedLogin(t *testing.T) {
+	db := newTestDB(t)
+	s := &Service{db: db, logger: zap.NewNop(), mailer: mailer.NewWithSender(db, config.MailConfig{}, zap.NewNop(), nil)}
+	user := createTestUser(t, db)
+	// Sessions from before locations were recorded have no country
+	withSessionFrom(t, s, user, "")
+
+	s.checkNewCountry(context.Background(), user, &geoip.Location{CountryCode: "FR"}, &LoginRequest{})
+	var alerts int64
+	db.Model(&models.OutboxEmail{}).Where("template = ?", "new_country_login").Count(&alerts)
+	if alerts != 0 {
+		t.Errorf("alerted %d times on the first located login", alerts)
+	}
+}
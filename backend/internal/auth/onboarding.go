@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// Onboarder provisions a newly registered user, such as a starter domain or a welcome email
+type Onboarder interface {
+	// Onboard runs the configured steps for a user and reports their outcome. A failed step must
+	// not keep the others from running.
+	Onboard(ctx context.Context, user *models.User) []OnboardingResult
+}
+
+// OnboardingResult is the outcome of one onboarding step
+type OnboardingResult struct {
+	Step    string `json:"step"`
+	Success bool   `json:"success"`
+}
+
+// RegisterResponse represents a registration response
+type RegisterResponse struct {
+	User       *models.User       `json:"user"`
+	Onboarding []OnboardingResult `json:"onboarding,omitempty"` // The onboarding steps that ran, in order
+}
+
+// SetOnboarder sets the provisioning run after each registration. The onboarder is built from
+// services that themselves depend on the auth service, so it cannot be passed to NewService.
+func (s *Service) SetOnboarder(onboarder Onboarder) {
+	s.onboarder = onboarder
+}
+
+// onboard runs the onboarding steps for a new user. The account already exists, so failures are
+// only reported in the results.
+func (s *Service) onboard(ctx context.Context, user *models.User) []OnboardingResult {
+	if s.onboarder == nil {
+		return nil
+	}
+	return s.onboarder.Onboard(ctx, user)
+}
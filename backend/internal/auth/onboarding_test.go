@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// fakeOnboarder records the users it onboards and reports the canned results
+type fakeOnboarder struct {
+	users   []string
+	results []OnboardingResult
+}
+
+func (f *fakeOnboarder) Onboard(ctx context.Context, user *models.User) []OnboardingResult {
+	f.users = append(f.users, user.Username)
+	return f.results
+}
+
+func TestRegisterRunsOnboarding(t *testing.T) {
+	s := newRegistrationService(t, "open")
+
+	response, err := s.Register(context.Background(), registration("plain", ""))
+	if err != nil {
+		t.Fatalf("Register() without onboarder error = %v", err)
+	}
+	if response.Onboarding != nil {
+		t.Errorf("onboarding without onboarder = %+v", response.Onboarding)
+	}
+
+	results := []OnboardingResult{{Step: "welcome_email", Success: false}, {Step: "starter_domain", Success: true}}
+	onboarder := &fakeOnboarder{results: results}
+	s.SetOnboarder(onboarder)
+
+	response, err = s.Register(context.Background(), registration("newbie", ""))
+	if err != nil {
+		t.Fatalf("Register() error = %v, want failed steps to be non-fatal", err)
+	}
+	if !reflect.DeepEqual(onboarder.users, []string{"newbie"}) {
+		t.Errorf("onboarded %v, want the new user", onboarder.users)
+	}
+	if !reflect.DeepEqual(response.Onboarding, results) || response.User.Username != "newbie" {
+		t.Errorf("response = %+v", response)
+	}
+
+	// Rejected registrations onboard nobody
+	if _, err := s.Register(context.Background(), registration("newbie", "")); err == nil {
+		t.Fatal("duplicate registration succeeded")
+	}
+	if len(onboarder.users) != 1 {
+		t.Errorf("onboarded %v after a rejected registration", onboarder.users)
+	}
+}
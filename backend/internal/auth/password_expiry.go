@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// PasswordMaxAge returns how long a user's password lasts, from the maximum ages of their roles
+// and the configured default; zero when it never expires. The user's roles must be loaded. An
+// age set on a role takes precedence over the default, and the shortest of several applies.
+func (s *Service) PasswordMaxAge(user *models.User) time.Duration {
+	maxAge := time.Duration(0)
+	usesDefault := len(user.Roles) == 0
+	for _, role := range user.Roles {
+		if role.PasswordMaxAgeDays == nil {
+			usesDefault = true
+			continue
+		}
+		if age := time.Duration(*role.PasswordMaxAgeDays) * 24 * time.Hour; age > 0 && (maxAge == 0 || age < maxAge) {
+			maxAge = age
+		}
+	}
+	if usesDefault && s.config.PasswordMaxAge > 0 && (maxAge == 0 || s.config.PasswordMaxAge < maxAge) {
+		maxAge = s.config.PasswordMaxAge
+	}
+	return maxAge
+}
+
+// PasswordExpiresAt returns when a user's password expires, or nil when it does not. Passwords
+// set before their change was recorded date from the account's creation.
+func (s *Service) PasswordExpiresAt(user *models.User) *time.Time {
+	maxAge := s.PasswordMaxAge(user)
+	if maxAge <= 0 {
+		return nil
+	}
+	changedAt := user.CreatedAt
+	if user.PasswordChangedAt != nil {
+		changedAt = *user.PasswordChangedAt
+	}
+	expiresAt := changedAt.Add(maxAge)
+	return &expiresAt
+}
+
+// passwordExpired reports whether a user must change their password before doing anything else
+func (s *Service) passwordExpired(user *models.User) bool {
+	expiresAt := s.PasswordExpiresAt(user)
+	return expiresAt != nil && !time.Now().Before(*expiresAt)
+}
+
+// PasswordChangeAllowed reports whether a request to an HTTP route or gRPC method can be made
+// with a session whose password has expired
+func PasswordChangeAllowed(route string) bool {
+	return passwordExpiredRoutes[route]
+}
+
+// passwordExpiredRoutes are what sessions with an expired password are limited to
+var passwordExpiredRoutes = map[string]bool{
+	"/users/:id/password":                       true,
+	"/mynodecp.auth.AuthService/ChangePassword": true,
+	"/mynodecp.auth.AuthService/Logout":         true,
+}
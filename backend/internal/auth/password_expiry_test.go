@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestPasswordMaxAge(t *testing.T) {
+	days := func(d int) *int { return &d }
+	role := func(maxAgeDays *int) models.Role { return models.Role{PasswordMaxAgeDays: maxAgeDays} }
+	const day = 24 * time.Hour
+
+	tests := []struct {
+		name       string
+		defaultAge time.Duration
+		roles      []models.Role
+		want       time.Duration
+	}{
+		{"no roles, no default", 0, nil, 0},
+		{"no roles", 90 * day, nil, 90 * day},
+		{"role without an age uses the default", 90 * day, []models.Role{role(nil)}, 90 * day},
+		{"role age takes precedence", 90 * day, []models.Role{role(days(180))}, 180 * day},
+		{"exempt role", 90 * day, []models.Role{role(days(0))}, 0},
+		{"role age without a default", 0, []models.Role{role(days(30))}, 30 * day},
+		{"shortest of several roles", 0, []models.Role{role(days(60)), role(days(30)), role(days(0))}, 30 * day},
+		{"default shorter than a role's", 20 * day, []models.Role{role(days(30)), role(nil)}, 20 * day},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{config: config.AuthConfig{PasswordMaxAge: tt.defaultAge}}
+			if got := s.PasswordMaxAge(&models.User{Roles: tt.roles}); got != tt.want {
+				t.Errorf("PasswordMaxAge() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPasswordExpiresAt(t *testing.T) {
+	s := &Service{config: config.AuthConfig{PasswordMaxAge: time.Hour}}
+	created := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	changed := created.Add(24 * time.Hour)
+
+	// Passwords never changed date from the account's creation
+	if got := s.PasswordExpiresAt(&models.User{CreatedAt: created}); got == nil || !got.Equal(created.Add(time.Hour)) {
+		t.Errorf("PasswordExpiresAt() = %v, want an hour after creation", got)
+	}
+	if got := s.PasswordExpiresAt(&models.User{CreatedAt: created, PasswordChangedAt: &changed}); got == nil || !got.Equal(changed.Add(time.Hour)) {
+		t.Errorf("PasswordExpiresAt() = %v, want an hour after the change", got)
+	}
+	if got := (&Service{}).PasswordExpiresAt(&models.User{CreatedAt: created}); got != nil {
+		t.Errorf("PasswordExpiresAt() = %v without a maximum age", got)
+	}
+}
+
+func TestLoginWithExpiredPassword(t *testing.T) {
+	s, _ := newSessionService(t, config.AuthConfig{JWTSecret: "test", JWTExpiration: time.Hour, RefreshExpiration: time.Hour, PasswordMaxAge: 24 * time.Hour})
+	s.geo = fixedResolver{}
+	ctx := context.Background()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	changed := time.Now().Add(-48 * time.Hour)
+	user := &models.User{Username: "owner", Email: "owner@example.net", PasswordHash: string(hash), IsActive: true, PasswordChangedAt: &changed}
+	s.db.Create(user)
+
+	// The login succeeds, but its session is limited to changing the password
+	login, err := s.Login(ctx, &LoginRequest{Username: "owner", Password: "correct horse"})
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	if !login.PasswordExpired {
+		t.Error("login with an expired password not flagged")
+	}
+	claims, err := s.ValidateToken(login.AccessToken)
+	if err != nil || !claims.PasswordExpired {
+		t.Fatalf("claims = %+v, %v, want the password expired", claims, err)
+	}
+
+	// Once the password is changed, refreshing the token lifts the limit
+	s.db.Model(&models.User{}).Where("id = ?", user.ID).Update("password_changed_at", time.Now())
+	refreshed, err := s.RefreshToken(ctx, login.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshToken() error = %v", err)
+	}
+	claims, err = s.ValidateToken(refreshed.AccessToken)
+	if err != nil || refreshed.PasswordExpired || claims.PasswordExpired {
+		t.Errorf("refreshed = %v, claims = %+v, %v, want the limit lifted", refreshed.PasswordExpired, claims, err)
+	}
+}
+
+func TestPasswordChangeAllowed(t *testing.T) {
+	tests := []struct {
+		route string
+		want  bool
+	}{
+		{"/users/:id/password", true},
+		{"/mynodecp.auth.AuthService/ChangePassword", true},
+		{"/mynodecp.auth.AuthService/Logout", true},
+		{"/users/:id", false},
+		{"/domains", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := PasswordChangeAllowed(tt.route); got != tt.want {
+			t.Errorf("PasswordChangeAllowed(%q) = %v, want %v", tt.route, got, tt.want)
+		}
+	}
+}
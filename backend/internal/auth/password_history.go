@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// CheckPasswordReuse rejects a new password for a user, given as field, that matches one of
+// their last PasswordHistory passwords, the current one included. Any password is accepted while
+// the history is disabled.
+func (s *Service) CheckPasswordReuse(ctx context.Context, user *models.User, field, password string) error {
+	limit := s.config.PasswordHistory
+	if limit <= 0 {
+		return nil
+	}
+
+	var history []string
+	if err := s.db.WithContext(ctx).Model(&models.PasswordHistory{}).
+		Where("user_id = ?", user.ID).
+		Order("created_at DESC").
+		Limit(limit).
+		Pluck("password_hash", &history).Error; err != nil {
+		return fmt.Errorf("failed to get password history: %w", err)
+	}
+
+	// Accounts from before the history was enabled only have their current password
+	hashes := make([]string, 0, limit)
+	if user.PasswordHash != "" {
+		hashes = append(hashes, user.PasswordHash)
+	}
+	for _, hash := range history {
+		if len(hashes) == limit {
+			break
+		}
+		if hash != user.PasswordHash {
+			hashes = append(hashes, hash)
+		}
+	}
+
+	for _, hash := range hashes {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil {
+			v := apperrors.NewValidation()
+			v.AddCode(field, "user.password_reused", map[string]string{"count": strconv.Itoa(limit)})
+			return v.Err()
+		}
+	}
+
+	return nil
+}
+
+// RecordPassword adds a user's new password hash to their history, in the transaction setting
+// it, and removes the entries no longer needed to check reuse. The replaced hash, empty for new
+// accounts, starts the history of accounts from before it was enabled. Nothing is kept while the
+// history is disabled.
+func (s *Service) RecordPassword(tx *gorm.DB, userID uuid.UUID, previousHash, passwordHash string) error {
+	limit := s.config.PasswordHistory
+	if limit <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+	entries := []*models.PasswordHistory{{UserID: userID, PasswordHash: passwordHash, CreatedAt: now}}
+	if previousHash != "" {
+		var count int64
+		if err := tx.Model(&models.PasswordHistory{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to get password history: %w", err)
+		}
+		if count == 0 {
+			entries = append(entries, &models.PasswordHistory{UserID: userID, PasswordHash: previousHash, CreatedAt: now.Add(-time.Second)})
+		}
+	}
+	if err := tx.Create(entries).Error; err != nil {
+		return fmt.Errorf("failed to record password history: %w", err)
+	}
+
+	var expired []uuid.UUID
+	if err := tx.Model(&models.PasswordHistory{}).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Offset(limit).
+		Limit(1000).
+		Pluck("id", &expired).Error; err != nil {
+		return fmt.Errorf("failed to get password history: %w", err)
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+	if err := tx.Where("id IN ?", expired).Delete(&models.PasswordHistory{}).Error; err != nil {
+		return fmt.Errorf("failed to prune password history: %w", err)
+	}
+
+	return nil
+}
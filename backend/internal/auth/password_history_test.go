@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// setPassword changes a user's password as the user service does, recording it in the history
+func setPassword(t *testing.T, s *Service, user *models.User, password string) {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("hash password: %v", err)
+	}
+	previousHash := user.PasswordHash
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("password_hash", string(hash)).Error; err != nil {
+			return err
+		}
+		return s.RecordPassword(tx, user.ID, previousHash, string(hash))
+	}); err != nil {
+		t.Fatalf("set password: %v", err)
+	}
+}
+
+func TestCheckPasswordReuse(t *testing.T) {
+	db := newTestDB(t)
+	s := &Service{db: db, config: config.AuthConfig{PasswordHistory: 3}}
+	user := createTestUser(t, db)
+	for _, password := range []string{"first-pass", "second-pass", "third-pass", "fourth-pass"} {
+		setPassword(t, s, user, password)
+	}
+
+	tests := []struct {
+		password string
+		reused   bool
+	}{
+		{"fourth-pass", true}, // The current password
+		{"third-pass", true},
+		{"second-pass", true},
+		{"first-pass", false}, // Older than the last three
+		{"fifth-pass", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			err := s.CheckPasswordReuse(context.Background(), user, "new_password", tt.password)
+			if !tt.reused {
+				if err != nil {
+					t.Errorf("CheckPasswordReuse() error = %v, want none", err)
+				}
+				return
+			}
+			v, ok := apperrors.AsValidation(err)
+			if !ok || v.Fields["new_password"] != "must differ from your last 3 passwords" {
+				t.Errorf("CheckPasswordReuse() error = %v, want the password reported as reused", err)
+			}
+		})
+	}
+
+	// Entries beyond the window are pruned
+	var kept int64
+	db.Model(&models.PasswordHistory{}).Where("user_id = ?", user.ID).Count(&kept)
+	if kept != 3 {
+		t.Errorf("%d history entries kept, want 3", kept)
+	}
+}
+
+func TestPasswordHistoryStartsWithExistingPassword(t *testing.T) {
+	db := newTestDB(t)
+	s := &Service{db: db, config: config.AuthConfig{PasswordHistory: 2}}
+	user := createTestUser(t, db)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("original-pass"), bcrypt.MinCost)
+	db.Model(user).Update("password_hash", string(hash))
+
+	// An account from before the history was enabled is checked against its current password
+	if err := s.CheckPasswordReuse(context.Background(), user, "password", "original-pass"); err == nil {
+		t.Error("current password accepted before any history was recorded")
+	}
+	// and its first change keeps the replaced password in the history
+	setPassword(t, s, user, "changed-pass")
+	if err := s.CheckPasswordReuse(context.Background(), user, "password", "original-pass"); err == nil {
+		t.Error("replaced password accepted within the window")
+	}
+	setPassword(t, s, user, "another-pass")
+	if err := s.CheckPasswordReuse(context.Background(), user, "password", "original-pass"); err != nil {
+		t.Errorf("password outside the window rejected: %v", err)
+	}
+}
+
+func TestPasswordHistoryDisabled(t *testing.T) {
+	db := newTestDB(t)
+	s := &Service{db: db}
+	user := createTestUser(t, db)
+	setPassword(t, s, user, "same-pass")
+
+	if err := s.CheckPasswordReuse(context.Background(), user, "password", "same-pass"); err != nil {
+		t.Errorf("CheckPasswordReuse() error = %v with the history disabled", err)
+	}
+	var kept int64
+	db.Model(&models.PasswordHistory{}).Count(&kept)
+	if kept != 0 {
+		t.Errorf("%d history entries kept with the history disabled", kept)
+	}
+}
@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// Registration modes
+const (
+	RegistrationOpen   = "open"
+	RegistrationInvite = "invite"
+	RegistrationClosed = "closed"
+)
+
+// maxInviteUses bounds how many accounts a single invite code can create
+const maxInviteUses = 1000
+
+// InviteRequest describes an invite code to create
+type InviteRequest struct {
+	Email   string        `json:"email"`    // Optional; restricts the code to this address
+	MaxUses int           `json:"max_uses"` // Defaults to 1
+	TTL     time.Duration `json:"-"`        // Defaults to the configured invite TTL
+}
+
+// ReservedUsername reports whether a username is on the reserved list, ignoring case
+func (s *Service) ReservedUsername(username string) bool {
+	for _, reserved := range s.config.ReservedUsernames {
+		if strings.EqualFold(strings.TrimSpace(username), reserved) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRegistration applies the registration mode and the reserved usernames to a
+// self-registration. Admins creating accounts are exempt from both.
+func (s *Service) checkRegistration(ctx context.Context, req *RegisterRequest, v *apperrors.ValidationError) error {
+	if callerIsAdmin(ctx) {
+		return nil
+	}
+
+	switch s.config.RegistrationMode {
+	case RegistrationClosed:
+		return apperrors.PermissionDeniedCode("registration_disabled", nil)
+	case RegistrationInvite:
+		if strings.TrimSpace(req.InviteCode) == "" {
+			v.AddCode("invite_code", "user.invite_required", nil)
+		}
+	}
+
+	if s.ReservedUsername(req.Username) {
+		v.AddCode("username", "user.username_reserved", map[string]string{"name": req.Username})
+	}
+	return nil
+}
+
+// inviteRequired reports whether a registration must redeem an invite code
+func (s *Service) inviteRequired(ctx context.Context) bool {
+	return s.config.RegistrationMode == RegistrationInvite && !callerIsAdmin(ctx)
+}
+
+// redeemInvite uses up one use of an invite code inside the registration's transaction, so a
+// failed registration does not consume it
+func redeemInvite(tx *gorm.DB, code, email string) error {
+	result := tx.Model(&models.RegistrationInvite{}).
+		Where("code_hash = ? AND revoked_at IS NULL AND expires_at > ? AND uses < max_uses", hashInviteCode(code), time.Now()).
+		Where("email = '' OR email = ?", email).
+		Update("uses", gorm.Expr("uses + 1"))
+	if result.Error != nil {
+		return fmt.Errorf("failed to redeem invite code: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return apperrors.InvalidCode("invite_code", "user.invite_invalid", nil)
+	}
+	return nil
+}
+
+// CreateInvite creates an invite code and returns it. The code is only shown here; the panel
+// keeps a hash of it.
+func (s *Service) CreateInvite(ctx context.Context, req InviteRequest) (string, *models.RegistrationInvite, error) {
+	v := apperrors.NewValidation()
+	if req.MaxUses == 0 {
+		req.MaxUses = 1
+	}
+	if req.MaxUses < 0 {
+		v.AddCode("max_uses", "field.minimum", map[string]string{"min": "1"})
+	}
+	if req.MaxUses > maxInviteUses {
+		v.AddCode("max_uses", "field.maximum", map[string]string{"max": fmt.Sprint(maxInviteUses)})
+	}
+	if req.TTL == 0 {
+		req.TTL = s.config.InviteTTL
+	}
+	if req.TTL < 0 {
+		v.AddCode("ttl", "field.minimum", map[string]string{"min": "0"})
+	}
+	if address, err := mail.ParseAddress(req.Email); req.Email != "" && (err != nil || address.Address != req.Email) {
+		v.AddCode("email", "user.email_invalid", nil)
+	}
+	if err := v.Err(); err != nil {
+		return "", nil, err
+	}
+
+	buf := make([]byte, 18)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, fmt.Errorf("failed to generate invite code: %w", err)
+	}
+	code := base64.RawURLEncoding.EncodeToString(buf)
+
+	invite := &models.RegistrationInvite{
+		CodeHash:  hashInviteCode(code),
+		Email:     req.Email,
+		MaxUses:   req.MaxUses,
+		ExpiresAt: time.Now().Add(req.TTL),
+		CreatedBy: callerID(ctx),
+	}
+	if err := s.db.WithContext(ctx).Create(invite).Error; err != nil {
+		return "", nil, fmt.Errorf("failed to create invite code: %w", err)
+	}
+
+	return code, invite, nil
+}
+
+// GetInvites lists invite codes, newest first
+func (s *Service) GetInvites(ctx context.Context) ([]*models.RegistrationInvite, error) {
+	var invites []*models.RegistrationInvite
+	if err := s.db.WithContext(ctx).Order("created_at DESC").Find(&invites).Error; err != nil {
+		return nil, fmt.Errorf("failed to get invite codes: %w", err)
+	}
+
+	return invites, nil
+}
+
+// RevokeInvite stops an invite code from being used
+func (s *Service) RevokeInvite(ctx context.Context, inviteID uuid.UUID) error {
+	var invite models.RegistrationInvite
+	if err := s.db.WithContext(ctx).Where("id = ?", inviteID).First(&invite).Error; err != nil {
+		return apperrors.FromDB(err, "invite")
+	}
+	if invite.RevokedAt != nil {
+		return nil
+	}
+
+	if err := s.db.WithContext(ctx).Model(&invite).Update("revoked_at", time.Now()).Error; err != nil {
+		return fmt.Errorf("failed to revoke invite code: %w", err)
+	}
+	return nil
+}
+
+func hashInviteCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// callerIsAdmin reports whether the authenticated user on the context is an admin
+func callerIsAdmin(ctx context.Context) bool {
+	roles, _ := ctx.Value("roles").([]string)
+	for _, role := range roles {
+		if role == "admin" {
+			return true
+		}
+	}
+	return false
+}
+
+// callerID returns the authenticated user on the context
+func callerID(ctx context.Context) *uuid.UUID {
+	userID, ok := ctx.Value("user_id").(uuid.UUID)
+	if !ok {
+		return nil
+	}
+	return &userID
+}
@@ -0,0 +1,178 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// newRegistrationService returns a service registering accounts in the mode
+func newRegistrationService(t *testing.T, mode string) *Service {
+	t.Helper()
+
+	return NewService(newTestDB(t), nil, zap.NewNop(), config.AuthConfig{
+		RegistrationMode:  mode,
+		ReservedUsernames: []string{"admin", "root"},
+		InviteTTL:         time.Hour,
+		PasswordMinLength: 8,
+	}, nil, nil, nil, nil)
+}
+
+// registration returns a valid self-registration for the username
+func registration(username, invite string) *RegisterRequest {
+	return &RegisterRequest{Username: username, Email: username + "@example.com", Password: "a-long-passphrase", InviteCode: invite}
+}
+
+// fieldError returns the message of a field of a validation error, or "" when there is none
+func fieldError(err error, field string) string {
+	validation, ok := apperrors.AsValidation(err)
+	if !ok {
+		return ""
+	}
+	return validation.Fields[field]
+}
+
+func TestRegistrationModes(t *testing.T) {
+	admin := context.WithValue(context.Background(), "roles", []string{"admin"})
+
+	tests := []struct {
+		name      string
+		mode      string
+		ctx       context.Context
+		req       *RegisterRequest
+		wantField string // Field of the validation error, or "" for success
+		denied    bool
+	}{
+		{name: "open", mode: RegistrationOpen, ctx: context.Background(), req: registration("ann", "")},
+		{name: "closed", mode: RegistrationClosed, ctx: context.Background(), req: registration("ann", ""), denied: true},
+		{name: "closed to an admin", mode: RegistrationClosed, ctx: admin, req: registration("ann", "")},
+		{name: "invite-only without a code", mode: RegistrationInvite, ctx: context.Background(), req: registration("ann", ""), wantField: "invite_code"},
+		{name: "invite-only with a wrong code", mode: RegistrationInvite, ctx: context.Background(), req: registration("ann", "not-a-code"), wantField: "invite_code"},
+		{name: "invite-only for an admin", mode: RegistrationInvite, ctx: admin, req: registration("ann", "")},
+		{name: "reserved username", mode: RegistrationOpen, ctx: context.Background(), req: registration("Root", ""), wantField: "username"},
+		{name: "reserved username by an admin", mode: RegistrationOpen, ctx: admin, req: registration("root", "")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newRegistrationService(t, tt.mode)
+			_, err := s.Register(tt.ctx, tt.req)
+
+			switch {
+			case tt.denied:
+				if code, _ := apperrors.Message(err, "en"); apperrors.HTTPStatus(err) != http.StatusForbidden || code != "registration_disabled" {
+					t.Errorf("Register() error = %v, want registration_disabled", err)
+				}
+			case tt.wantField != "":
+				if fieldError(err, tt.wantField) == "" {
+					t.Errorf("Register() error = %v, want one for %s", err, tt.wantField)
+				}
+			case err != nil:
+				t.Errorf("Register() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestInviteCodes(t *testing.T) {
+	s := newRegistrationService(t, RegistrationInvite)
+	adminID := uuid.New()
+	admin := context.WithValue(context.WithValue(context.Background(), "user_id", adminID), "roles", []string{"admin"})
+	ctx := context.Background()
+
+	code, invite, err := s.CreateInvite(admin, InviteRequest{MaxUses: 2})
+	if err != nil {
+		t.Fatalf("CreateInvite() error = %v", err)
+	}
+	if invite.CodeHash == code || invite.CreatedBy == nil || *invite.CreatedBy != adminID {
+		t.Errorf("invite = %+v, want the code hashed and the creator recorded", invite)
+	}
+	if until := time.Until(invite.ExpiresAt); until < 59*time.Minute || until > time.Hour {
+		t.Errorf("invite expires in %v, want the configured hour", until)
+	}
+
+	// A failed registration does not use up the code
+	taken := registration("ann", code)
+	taken.Password = "short"
+	if _, err := s.Register(ctx, taken); err == nil {
+		t.Fatal("registration with a weak password succeeded")
+	}
+	for _, username := range []string{"ann", "bob"} {
+		if _, err := s.Register(ctx, registration(username, code)); err != nil {
+			t.Fatalf("register %s: %v", username, err)
+		}
+	}
+	if _, err := s.Register(ctx, registration("cat", code)); fieldError(err, "invite_code") == "" {
+		t.Errorf("third use of a two-use code: error = %v", err)
+	}
+
+	// Codes for one address only work for it
+	personal, _, err := s.CreateInvite(admin, InviteRequest{Email: "dan@example.com"})
+	if err != nil {
+		t.Fatalf("CreateInvite(email) error = %v", err)
+	}
+	if _, err := s.Register(ctx, registration("eve", personal)); fieldError(err, "invite_code") == "" {
+		t.Errorf("personal code for another address: error = %v", err)
+	}
+	if _, err := s.Register(ctx, registration("dan", personal)); err != nil {
+		t.Errorf("personal code for its address: %v", err)
+	}
+
+	// Revoked and expired codes are refused
+	revoked, revokedInvite, _ := s.CreateInvite(admin, InviteRequest{})
+	if err := s.RevokeInvite(admin, revokedInvite.ID); err != nil {
+		t.Fatalf("RevokeInvite() error = %v", err)
+	}
+	if _, err := s.Register(ctx, registration("fay", revoked)); fieldError(err, "invite_code") == "" {
+		t.Errorf("revoked code: error = %v", err)
+	}
+	expired, expiredInvite, _ := s.CreateInvite(admin, InviteRequest{})
+	s.db.Model(expiredInvite).Update("expires_at", time.Now().Add(-time.Minute))
+	if _, err := s.Register(ctx, registration("gus", expired)); fieldError(err, "invite_code") == "" {
+		t.Errorf("expired code: error = %v", err)
+	}
+
+	if err := s.RevokeInvite(admin, uuid.New()); !apperrors.IsNotFound(err) {
+		t.Errorf("RevokeInvite(unknown) error = %v, want not found", err)
+	}
+	invites, err := s.GetInvites(admin)
+	if err != nil || len(invites) != 4 {
+		t.Errorf("GetInvites() = %d invites, %v; want 4", len(invites), err)
+	}
+}
+
+func TestCreateInviteValidation(t *testing.T) {
+	s := newRegistrationService(t, RegistrationInvite)
+
+	tests := []struct {
+		name  string
+		req   InviteRequest
+		field string
+	}{
+		{"negative uses", InviteRequest{MaxUses: -1}, "max_uses"},
+		{"too many uses", InviteRequest{MaxUses: maxInviteUses + 1}, "max_uses"},
+		{"negative TTL", InviteRequest{TTL: -time.Hour}, "ttl"},
+		{"malformed email", InviteRequest{Email: "Dan <dan@example.com>"}, "email"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := s.CreateInvite(context.Background(), tt.req); fieldError(err, tt.field) == "" {
+				t.Errorf("CreateInvite() error = %v, want one for %s", err, tt.field)
+			}
+		})
+	}
+
+	var stored int64
+	s.db.Model(&models.RegistrationInvite{}).Count(&stored)
+	if stored != 0 {
+		t.Errorf("%d invalid invites stored", stored)
+	}
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/mynodecp/mynodecp/backend/internal/geoip"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// loginAllowed reports whether a login from ipAddress, located at location, is inside the user's
+// allowed IP ranges and countries. Each list only applies when it is set. An address that cannot
+// be parsed, or whose country is unknown, is outside any list it is checked against.
+func loginAllowed(user *models.User, ipAddress string, location *geoip.Location) bool {
+	if len(user.AllowedIPRanges) > 0 {
+		ip := net.ParseIP(ipAddress)
+		if ip == nil || !inRanges(ip, user.AllowedIPRanges) {
+			return false
+		}
+	}
+
+	if len(user.AllowedCountries) > 0 {
+		if location == nil || location.CountryCode == "" {
+			return false
+		}
+		allowed := false
+		for _, country := range user.AllowedCountries {
+			allowed = allowed || strings.EqualFold(country, location.CountryCode)
+		}
+		if !allowed {
+			return false
+		}
+	}
+
+	return true
+}
+
+// inRanges reports whether ip is in one of the CIDR ranges; ranges that do not parse match nothing
+func inRanges(ip net.IP, ranges []string) bool {
+	for _, cidr := range ranges {
+		if _, network, err := net.ParseCIDR(cidr); err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// recordRestrictedLogin logs a security event for a login with valid credentials from outside
+// the user's allowed IP ranges or countries
+func (s *Service) recordRestrictedLogin(ctx context.Context, user *models.User, location *geoip.Location, req *LoginRequest) {
+	country := "unknown country"
+	if location != nil && location.CountryCode != "" {
+		country = location.CountryCode
+	}
+
+	securityEvent := &models.SecurityEvent{
+		UserID:      &user.ID,
+		Type:        "login_restricted",
+		Severity:    "high",
+		Source:      "web",
+		IPAddress:   req.IPAddress,
+		UserAgent:   req.UserAgent,
+		Description: fmt.Sprintf("Login for user %s rejected from %s (%s) outside the allowed sources", user.Username, req.IPAddress, country),
+	}
+	s.db.WithContext(ctx).Create(securityEvent)
+}
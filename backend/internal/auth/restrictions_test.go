@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/geoip"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestLoginAllowed(t *testing.T) {
+	nl := &geoip.Location{CountryCode: "NL"}
+
+	tests := []struct {
+		name      string
+		ranges    []string
+		countries []string
+		ip        string
+		location  *geoip.Location
+		want      bool
+	}{
+		{"no restrictions", nil, nil, "203.0.113.9", nil, true},
+		{"inside a range", []string{"198.51.100.0/24", "203.0.113.0/24"}, nil, "203.0.113.9", nil, true},
+		{"outside the ranges", []string{"198.51.100.0/24"}, nil, "203.0.113.9", nil, false},
+		{"IPv6 range", []string{"2001:db8::/32"}, nil, "2001:db8::1", nil, true},
+		{"unparsable address", []string{"0.0.0.0/0"}, nil, "not-an-ip", nil, false},
+		{"malformed range matches nothing", []string{"203.0.113.0/33"}, nil, "203.0.113.9", nil, false},
+		{"allowed country", nil, []string{"de", "NL"}, "203.0.113.9", nl, true},
+		{"other country", nil, []string{"DE"}, "203.0.113.9", nl, false},
+		{"unknown country", nil, []string{"NL"}, "203.0.113.9", &geoip.Location{}, false},
+		{"not located", nil, []string{"NL"}, "203.0.113.9", nil, false},
+		{"range and country both needed", []string{"198.51.100.0/24"}, []string{"NL"}, "203.0.113.9", nl, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &models.User{AllowedIPRanges: tt.ranges, AllowedCountries: tt.countries}
+			if got := loginAllowed(user, tt.ip, tt.location); got != tt.want {
+				t.Errorf("loginAllowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoginRestricted(t *testing.T) {
+	s, _ := newSessionService(t, config.AuthConfig{JWTSecret: "test", JWTExpiration: time.Hour, RefreshExpiration: time.Hour})
+	s.geo = fixedResolver{location: &geoip.Location{CountryCode: "NL"}}
+	user := createTestUser(t, s.db)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	user.PasswordHash = string(hash)
+	user.AllowedIPRanges = []string{"198.51.100.0/24"}
+	user.AllowedCountries = []string{"NL"}
+	s.db.Select("password_hash", "allowed_ip_ranges", "allowed_countries").Updates(user)
+	ctx := context.Background()
+	login := func(ip, password string) error {
+		_, err := s.Login(ctx, &LoginRequest{Username: user.Username, Password: password, IPAddress: ip})
+		return err
+	}
+	restrictedEvents := func() int64 {
+		var count int64
+		s.db.Model(&models.SecurityEvent{}).Where("user_id = ? AND type = ?", user.ID, "login_restricted").Count(&count)
+		return count
+	}
+
+	if err := login("198.51.100.7", "correct horse"); err != nil {
+		t.Fatalf("login from an allowed source: %v", err)
+	}
+	if err := login("203.0.113.9", "correct horse"); !errors.Is(err, ErrLoginRestricted) {
+		t.Errorf("login from outside the ranges: error = %v, want ErrLoginRestricted", err)
+	}
+	if restrictedEvents() != 1 {
+		t.Errorf("%d login_restricted events, want 1", restrictedEvents())
+	}
+
+	// A wrong password from outside reveals nothing about the restriction
+	if err := login("203.0.113.9", "guess"); err == nil || errors.Is(err, ErrLoginRestricted) {
+		t.Errorf("wrong password from outside: error = %v, want invalid credentials", err)
+	}
+	if restrictedEvents() != 1 {
+		t.Errorf("failed password logged as a restricted login")
+	}
+
+	s.geo = fixedResolver{location: &geoip.Location{CountryCode: "US"}}
+	if err := login("198.51.100.7", "correct horse"); !errors.Is(err, ErrLoginRestricted) {
+		t.Errorf("login from another country: error = %v, want ErrLoginRestricted", err)
+	}
+}
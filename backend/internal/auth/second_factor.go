@@ -0,0 +1,382 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/mynodecp/mynodecp/backend/internal/i18n"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// Second factor methods
+const (
+	MethodTOTP     = "totp"     // Codes from an authenticator app
+	MethodEmail    = "email"    // Codes sent to the account's verified address
+	MethodWebAuthn = "webauthn" // Security keys and passkeys
+)
+
+// methodOrder is the order in which enrolled methods are listed, and picked when a user has no
+// usable default
+var methodOrder = []string{MethodWebAuthn, MethodTOTP, MethodEmail}
+
+// emailOTPMaxAttempts is how many wrong emailed codes a user can enter within EmailOTPTTL of the
+// first, however many codes are sent
+const emailOTPMaxAttempts = 5
+
+var (
+	// ErrTwoFactorMethod is returned when a login asks for a second factor the user has not enrolled
+	ErrTwoFactorMethod = errors.New("two-factor method not available")
+	// ErrLoginCodeAttempts is returned instead of sending another login code once too many wrong
+	// codes have been entered
+	ErrLoginCodeAttempts = errors.New("too many wrong login codes, try again later")
+)
+
+// SecondFactor is a way for a user to back up their password at login
+type SecondFactor interface {
+	// Enrolled reports whether the user has set the factor up
+	Enrolled(ctx context.Context, user *models.User) (bool, error)
+	// Challenge starts a login with the factor and returns what the client needs to answer it,
+	// or nil when there is nothing to hand over, as with authenticator apps
+	Challenge(ctx context.Context, user *models.User) (interface{}, error)
+	// Verify checks the answer in a login request. Wrong answers are reported as false, not as
+	// errors.
+	Verify(ctx context.Context, user *models.User, req *LoginRequest) (bool, error)
+}
+
+// ChallengeError is returned by Login when the password was right and a second factor is needed.
+// Method is the one challenged; the login can be repeated with another of Methods instead.
+type ChallengeError struct {
+	Method    string      `json:"method"`
+	Methods   []string    `json:"methods"`
+	Challenge interface{} `json:"challenge,omitempty"` // WebAuthn request options, or where an email code went
+}
+
+func (e *ChallengeError) Error() string {
+	return "two-factor code required"
+}
+
+// EmailChallenge tells the client where a login code was sent
+type EmailChallenge struct {
+	SentTo    string    `json:"sent_to"` // The address, partly masked
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// SetSecondFactor adds a second factor method, or replaces the built-in one of that name
+func (s *Service) SetSecondFactor(method string, factor SecondFactor) {
+	s.factors[method] = factor
+}
+
+// secondFactors returns the built-in factors of the methods enabled in the configuration
+func (s *Service) secondFactors() map[string]SecondFactor {
+	builtin := map[string]SecondFactor{
+		MethodTOTP:     &totpFactor{service: s},
+		MethodEmail:    &emailFactor{service: s},
+		MethodWebAuthn: &webAuthnFactor{service: s},
+	}
+
+	factors := make(map[string]SecondFactor)
+	for _, method := range s.config.TwoFactorMethods {
+		if factor, ok := builtin[method]; ok {
+			factors[method] = factor
+		}
+	}
+	return factors
+}
+
+// MethodAvailable reports whether users can enroll a second factor method
+func (s *Service) MethodAvailable(method string) bool {
+	_, ok := s.factors[method]
+	return ok
+}
+
+// EnrolledMethods returns the available methods the user has set up: the built-in ones in
+// methodOrder, then added ones by name
+func (s *Service) EnrolledMethods(ctx context.Context, user *models.User) ([]string, error) {
+	names := append([]string{}, methodOrder...)
+	var added []string
+	for method := range s.factors {
+		if method != MethodTOTP && method != MethodEmail && method != MethodWebAuthn {
+			added = append(added, method)
+		}
+	}
+	sort.Strings(added)
+	names = append(names, added...)
+
+	var methods []string
+	for _, method := range names {
+		factor, ok := s.factors[method]
+		if !ok {
+			continue
+		}
+		enrolled, err := factor.Enrolled(ctx, user)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check %s enrollment: %w", method, err)
+		}
+		if enrolled {
+			methods = append(methods, method)
+		}
+	}
+	return methods, nil
+}
+
+// chooseMethod picks the method a login is challenged with: the one the client asked for, the
+// user's default, or else the first enrolled one. Only enrolled methods can be picked.
+func chooseMethod(requested, preferred string, enrolled []string) (string, error) {
+	isEnrolled := func(method string) bool {
+		for _, candidate := range enrolled {
+			if candidate == method {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case requested != "":
+		if !isEnrolled(requested) {
+			return "", ErrTwoFactorMethod
+		}
+		return requested, nil
+	case preferred != "" && isEnrolled(preferred):
+		return preferred, nil
+	case len(enrolled) > 0:
+		return enrolled[0], nil
+	}
+	return "", ErrTwoFactorMethod
+}
+
+// checkSecondFactor holds a login whose password was right to the user's second factor. Without
+// an answer in the request it challenges the chosen method and returns a ChallengeError. A backup
+// code is accepted in place of any method.
+func (s *Service) checkSecondFactor(ctx context.Context, user *models.User, req *LoginRequest) error {
+	methods, err := s.EnrolledMethods(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	method, err := chooseMethod(req.TwoFactorMethod, user.TwoFactorMethod, methods)
+	if err != nil {
+		// Backup codes still work when every enrolled method has been turned off
+		if req.TwoFactorCode != "" && s.consumeBackupCode(ctx, user, req.TwoFactorCode) {
+			return nil
+		}
+		return err
+	}
+	factor := s.factors[method]
+
+	if req.TwoFactorCode == "" && req.WebAuthnAssertion == nil {
+		challenge, err := factor.Challenge(ctx, user)
+		if err != nil {
+			return err
+		}
+		return &ChallengeError{Method: method, Methods: methods, Challenge: challenge}
+	}
+
+	ok, err := factor.Verify(ctx, user, req)
+	if err != nil {
+		return err
+	}
+	if !ok && !(req.TwoFactorCode != "" && s.consumeBackupCode(ctx, user, req.TwoFactorCode)) {
+		s.recordIPFailure(ctx, req.IPAddress)
+		return fmt.Errorf("invalid two-factor code")
+	}
+	return nil
+}
+
+// totpFactor checks codes from an authenticator app against the user's TOTP secret
+type totpFactor struct {
+	service *Service
+}
+
+func (f *totpFactor) Enrolled(ctx context.Context, user *models.User) (bool, error) {
+	return user.TwoFactorSecret != "", nil
+}
+
+func (f *totpFactor) Challenge(ctx context.Context, user *models.User) (interface{}, error) {
+	return nil, nil
+}
+
+func (f *totpFactor) Verify(ctx context.Context, user *models.User, req *LoginRequest) (bool, error) {
+	return f.service.verifyTwoFactorCode(string(user.TwoFactorSecret), req.TwoFactorCode), nil
+}
+
+// emailFactor sends a one-time code to the user's verified address for each login. Only the
+// latest code is valid, until it expires or emailOTPMaxAttempts wrong codes have been entered.
+// The wrong codes are counted apart from the code, so logging in again for a new one does not
+// buy more guesses.
+type emailFactor struct {
+	service *Service
+}
+
+func (f *emailFactor) Enrolled(ctx context.Context, user *models.User) (bool, error) {
+	return user.EmailOTPEnabled && user.IsEmailVerified, nil
+}
+
+func (f *emailFactor) Challenge(ctx context.Context, user *models.User) (interface{}, error) {
+	s := f.service
+
+	attempts, err := s.redis.Get(ctx, emailOTPAttemptsKey(user.ID)).Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("failed to get login code attempts: %w", err)
+	}
+	if attempts >= emailOTPMaxAttempts {
+		return nil, ErrLoginCodeAttempts
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate login code: %w", err)
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+
+	key := emailOTPKey(user.ID)
+	pipe := s.redis.TxPipeline()
+	pipe.Del(ctx, key)
+	pipe.HSet(ctx, key, "code", hashLoginCode(code))
+	pipe.Expire(ctx, key, s.config.EmailOTPTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to store login code: %w", err)
+	}
+
+	name := user.FirstName
+	if name == "" {
+		name = user.Username
+	}
+	if _, err := s.mailer.EnqueueLocale(ctx, user.Email, i18n.Resolve(user.Locale, ""), "login_code", map[string]string{
+		"Name":      name,
+		"Code":      code,
+		"ExpiresIn": s.config.EmailOTPTTL.String(),
+	}); err != nil {
+		return nil, fmt.Errorf("failed to send login code: %w", err)
+	}
+
+	return &EmailChallenge{SentTo: maskEmail(user.Email), ExpiresAt: time.Now().Add(s.config.EmailOTPTTL)}, nil
+}
+
+func (f *emailFactor) Verify(ctx context.Context, user *models.User, req *LoginRequest) (bool, error) {
+	s := f.service
+	key := emailOTPKey(user.ID)
+
+	stored, err := s.redis.HGet(ctx, key, "code").Result()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get login code: %w", err)
+	}
+
+	// Every answer counts until one is right, so the budget is spent before the code is compared
+	attemptsKey := emailOTPAttemptsKey(user.ID)
+	attempts, err := s.redis.Incr(ctx, attemptsKey).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to count login code attempts: %w", err)
+	}
+	if attempts == 1 {
+		if err := s.redis.Expire(ctx, attemptsKey, s.config.EmailOTPTTL).Err(); err != nil {
+			return false, fmt.Errorf("failed to count login code attempts: %w", err)
+		}
+	}
+	if attempts > emailOTPMaxAttempts {
+		s.redis.Del(ctx, key)
+		return false, nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashLoginCode(req.TwoFactorCode)), []byte(stored)) != 1 {
+		return false, nil
+	}
+	s.redis.Del(ctx, key, attemptsKey)
+	return true, nil
+}
+
+func emailOTPKey(userID uuid.UUID) string {
+	return "two_factor:email:" + userID.String()
+}
+
+// emailOTPAttemptsKey counts the answers to a user's emailed codes since the first one
+func emailOTPAttemptsKey(userID uuid.UUID) string {
+	return "two_factor:email_attempts:" + userID.String()
+}
+
+// hashLoginCode returns the stored form of an emailed login code
+func hashLoginCode(code string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// maskEmail hides most of the local part of an address, e.g. j***@example.com
+func maskEmail(address string) string {
+	at := strings.LastIndex(address, "@")
+	if at < 1 {
+		return address
+	}
+	return address[:1] + "***" + address[at:]
+}
+
+// webAuthnFactor asks the browser to sign a challenge with one of the user's security keys or
+// passkeys
+type webAuthnFactor struct {
+	service *Service
+}
+
+func (f *webAuthnFactor) credentials(ctx context.Context, userID uuid.UUID) ([]models.WebAuthnCredential, error) {
+	var credentials []models.WebAuthnCredential
+	if err := f.service.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at").Find(&credentials).Error; err != nil {
+		return nil, fmt.Errorf("failed to get security keys: %w", err)
+	}
+	return credentials, nil
+}
+
+func (f *webAuthnFactor) Enrolled(ctx context.Context, user *models.User) (bool, error) {
+	var count int64
+	if err := f.service.db.WithContext(ctx).Model(&models.WebAuthnCredential{}).Where("user_id = ?", user.ID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (f *webAuthnFactor) Challenge(ctx context.Context, user *models.User) (interface{}, error) {
+	credentials, err := f.credentials(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return f.service.webAuthnRequestOptions(ctx, user.ID, credentials)
+}
+
+func (f *webAuthnFactor) Verify(ctx context.Context, user *models.User, req *LoginRequest) (bool, error) {
+	if req.WebAuthnAssertion == nil {
+		return false, nil
+	}
+
+	credentials, err := f.credentials(ctx, user.ID)
+	if err != nil {
+		return false, err
+	}
+
+	credential, err := f.service.verifyWebAuthnAssertion(ctx, user.ID, credentials, req.WebAuthnAssertion)
+	if errors.Is(err, ErrWebAuthnInvalid) || errors.Is(err, ErrWebAuthnChallenge) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err := f.service.db.WithContext(ctx).Model(credential).Updates(map[string]interface{}{
+		"sign_count":   credential.SignCount,
+		"last_used_at": time.Now(),
+	}).Error; err != nil {
+		return false, fmt.Errorf("failed to update security key: %w", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/mailer"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// newEmailOTPService returns a service with emailed login codes on an in-memory Redis, and a user
+// enrolled in them
+func newEmailOTPService(t *testing.T) (*Service, *miniredis.Miniredis, *models.User) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	db := newTestDB(t)
+	s := NewService(db, client, zap.NewNop(), config.AuthConfig{TwoFactorMethods: []string{MethodEmail}, EmailOTPTTL: 10 * time.Minute},
+		nil, nil, mailer.NewWithSender(db, config.MailConfig{}, zap.NewNop(), nil), nil)
+
+	user := createTestUser(t, db)
+	user.EmailOTPEnabled = true
+	user.IsEmailVerified = true
+	return s, server, user
+}
+
+// issueKnownCode challenges the user and replaces the emailed code with code
+func issueKnownCode(t *testing.T, s *Service, user *models.User, code string) error {
+	t.Helper()
+
+	if _, err := s.factors[MethodEmail].Challenge(context.Background(), user); err != nil {
+		return err
+	}
+	if err := s.redis.HSet(context.Background(), emailOTPKey(user.ID), "code", hashLoginCode(code)).Err(); err != nil {
+		t.Fatalf("set code: %v", err)
+	}
+	return nil
+}
+
+func TestEmailOTPAttemptsSurviveNewCodes(t *testing.T) {
+	s, _, user := newEmailOTPService(t)
+	factor := s.factors[MethodEmail]
+	ctx := context.Background()
+	wrong := &LoginRequest{TwoFactorCode: "000000"}
+
+	// Logging in again for a fresh code after each wrong guess must not refill the budget
+	for i := 0; i < emailOTPMaxAttempts; i++ {
+		if err := issueKnownCode(t, s, user, "123456"); err != nil {
+			t.Fatalf("code %d: %v", i+1, err)
+		}
+		if ok, err := factor.Verify(ctx, user, wrong); err != nil || ok {
+			t.Fatalf("wrong code %d = %v, %v; want false", i+1, ok, err)
+		}
+	}
+
+	if err := issueKnownCode(t, s, user, "123456"); !errors.Is(err, ErrLoginCodeAttempts) {
+		t.Fatalf("code after %d wrong ones: error = %v, want ErrLoginCodeAttempts", emailOTPMaxAttempts, err)
+	}
+}
+
+func TestEmailOTPRightCodeClearsAttempts(t *testing.T) {
+	s, _, user := newEmailOTPService(t)
+	factor := s.factors[MethodEmail]
+	ctx := context.Background()
+
+	if err := issueKnownCode(t, s, user, "123456"); err != nil {
+		t.Fatalf("challenge: %v", err)
+	}
+	for i := 0; i < emailOTPMaxAttempts-1; i++ {
+		factor.Verify(ctx, user, &LoginRequest{TwoFactorCode: "000000"})
+	}
+	if ok, err := factor.Verify(ctx, user, &LoginRequest{TwoFactorCode: "123456"}); err != nil || !ok {
+		t.Fatalf("right code = %v, %v; want true", ok, err)
+	}
+	if ok, _ := factor.Verify(ctx, user, &LoginRequest{TwoFactorCode: "123456"}); ok {
+		t.Error("code accepted twice")
+	}
+
+	if err := issueKnownCode(t, s, user, "654321"); err != nil {
+		t.Fatalf("challenge after a right code: %v", err)
+	}
+	if ok, err := factor.Verify(ctx, user, &LoginRequest{TwoFactorCode: "654321"}); err != nil || !ok {
+		t.Fatalf("next login's code = %v, %v; want true", ok, err)
+	}
+}
+
+func TestEmailOTPAttemptsExpire(t *testing.T) {
+	s, server, user := newEmailOTPService(t)
+	factor := s.factors[MethodEmail]
+	ctx := context.Background()
+
+	for i := 0; i < emailOTPMaxAttempts; i++ {
+		if err := issueKnownCode(t, s, user, "123456"); err != nil {
+			t.Fatalf("code %d: %v", i+1, err)
+		}
+		factor.Verify(ctx, user, &LoginRequest{TwoFactorCode: "000000"})
+	}
+
+	server.FastForward(s.config.EmailOTPTTL + time.Second)
+	if err := issueKnownCode(t, s, user, "123456"); err != nil {
+		t.Fatalf("code once the attempts expired: %v", err)
+	}
+	if ok, err := factor.Verify(ctx, user, &LoginRequest{TwoFactorCode: "123456"}); err != nil || !ok {
+		t.Fatalf("right code = %v, %v; want true", ok, err)
+	}
+}
@@ -3,43 +3,97 @@ package auth
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/pquerna/otp/totp"
 	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
 	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/geoip"
+	"github.com/mynodecp/mynodecp/backend/internal/i18n"
+	"github.com/mynodecp/mynodecp/backend/internal/mailer"
 	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/pagination"
+)
+
+
+// captchaThresholdKey holds an admin override of the configured CAPTCHA threshold
+const captchaThresholdKey = "login_throttle:captcha_threshold"
+
+var (
+	// ErrCaptchaRequired is returned when an IP has too many failed logins and no CAPTCHA token was sent
+	ErrCaptchaRequired = errors.New("captcha required")
+	// ErrCaptchaInvalid is returned when the CAPTCHA token fails verification
+	ErrCaptchaInvalid = errors.New("invalid captcha")
+	// ErrPasswordBreached is returned when a new password appears in known data breaches
+	ErrPasswordBreached = errors.New("password has appeared in a data breach, choose a different one")
+	// ErrSessionIdle is returned for sessions without activity for longer than the idle timeout
+	ErrSessionIdle = errors.New("session ended after inactivity")
+	// ErrSessionLifetime is returned for sessions older than the maximum session lifetime
+	ErrSessionLifetime = errors.New("session exceeded its maximum lifetime")
+	// ErrLoginRestricted is returned when a login comes from outside the account's allowed IP ranges or countries
+	ErrLoginRestricted = errors.New("login not allowed from this location")
 )
 
 // Service handles authentication operations
 type Service struct {
 	db     *gorm.DB
 	redis  *redis.Client
+	logger *zap.Logger
 	config config.AuthConfig
+	geo    geoip.Resolver
+	captcha CaptchaVerifier
+	mailer  *mailer.Mailer
+	breach  BreachChecker
+
+	onboarder Onboarder
+	factors   map[string]SecondFactor // Second factor methods by name
 }
 
 // NewService creates a new authentication service
-func NewService(db *gorm.DB, redis *redis.Client, config config.AuthConfig) *Service {
-	return &Service{
-		db:     db,
-		redis:  redis,
-		config: config,
-	}
+// A nil captcha verifier disables CAPTCHA escalation, and a nil breach checker disables breached password checks.
+func NewService(db *gorm.DB, redis *redis.Client, logger *zap.Logger, config config.AuthConfig, geo geoip.Resolver, captcha CaptchaVerifier, mailer *mailer.Mailer, breach BreachChecker) *Service {
+	s := &Service{
+		db:      db,
+		redis:   redis,
+		logger:  logger,
+		config:  config,
+		geo:     geo,
+		captcha: captcha,
+		mailer:  mailer,
+		breach:  breach,
+	}
+	s.factors = s.secondFactors()
+	return s
 }
 
 // Claims represents JWT claims
 type Claims struct {
-	UserID    uuid.UUID `json:"user_id"`
-	Username  string    `json:"username"`
-	Email     string    `json:"email"`
-	Roles     []string  `json:"roles"`
-	SessionID uuid.UUID `json:"session_id"`
+	UserID       uuid.UUID        `json:"user_id"`
+	Username     string           `json:"username"`
+	Email        string           `json:"email"`
+	Roles        []string         `json:"roles"`
+	SessionID    uuid.UUID        `json:"session_id"`
+	SessionStart *jwt.NumericDate `json:"session_start,omitempty"` // When the session logged in
+	Locale       string           `json:"locale,omitempty"`        // The user's preferred language
+	Client       *ClientBinding   `json:"client,omitempty"`        // Client the session is bound to
+	// The password has expired: the session can only change it, then refresh its token
+	PasswordExpired bool `json:"password_expired,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -48,6 +102,9 @@ type LoginRequest struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
 	TwoFactorCode string `json:"two_factor_code,omitempty"`
+	TwoFactorMethod string `json:"two_factor_method,omitempty"` // Challenge this method instead of the user's default
+	WebAuthnAssertion *WebAuthnAssertion `json:"webauthn_assertion,omitempty"` // Answer to a WebAuthn challenge
+	CaptchaToken string `json:"captcha_token,omitempty"`
 	IPAddress string `json:"ip_address"`
 	UserAgent string `json:"user_agent"`
 }
@@ -58,25 +115,41 @@ type LoginResponse struct {
 	RefreshToken string    `json:"refresh_token"`
 	ExpiresAt    time.Time `json:"expires_at"`
 	User         *models.User `json:"user"`
+	// The password must be changed before the session can be used for anything else
+	PasswordExpired bool `json:"password_expired,omitempty"`
 }
 
 // RegisterRequest represents a registration request
 type RegisterRequest struct {
-	Username  string `json:"username" binding:"required"`
-	Email     string `json:"email" binding:"required,email"`
-	Password  string `json:"password" binding:"required"`
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
+	Username   string `json:"username" binding:"required"`
+	Email      string `json:"email" binding:"required,email"`
+	Password   string `json:"password" binding:"required"`
+	FirstName  string `json:"first_name"`
+	LastName   string `json:"last_name"`
+	Locale     string `json:"locale"`
+	InviteCode string `json:"invite_code,omitempty"` // Required while registration is invite-only
 }
 
 // Login authenticates a user and returns tokens
 func (s *Service) Login(ctx context.Context, req *LoginRequest) (*LoginResponse, error) {
+	// Turn away IPs banned for failed logins to the panel, mail, FTP or SSH
+	if s.IPBannedUntil(ctx, req.IPAddress) != nil {
+		return nil, ErrIPBanned
+	}
+
+	// Require a CAPTCHA once this IP has failed too often
+	if err := s.checkCaptcha(ctx, req); err != nil {
+		return nil, err
+	}
+
 	// Find user by username or email
 	var user models.User
 	if err := s.db.WithContext(ctx).
 		Preload("Roles").
 		Where("username = ? OR email = ?", req.Username, req.Username).
 		First(&user).Error; err != nil {
+		s.logAuthFailure(ctx, SourceWeb, req.IPAddress, req.Username)
+		s.recordIPFailure(ctx, req.IPAddress)
 		return nil, fmt.Errorf("invalid credentials")
 	}
 
@@ -94,37 +167,49 @@ func (s *Service) Login(ctx context.Context, req *LoginRequest) (*LoginResponse,
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
 		// Increment failed login count
 		s.incrementFailedLogin(ctx, &user, req.IPAddress)
+		s.recordIPFailure(ctx, req.IPAddress)
 		return nil, fmt.Errorf("invalid credentials")
 	}
 
+	// Resolve approximate location, and hold the account to its allowed IP ranges and countries
+	location := s.lookupLocation(req.IPAddress)
+	if !loginAllowed(&user, req.IPAddress, location) {
+		s.recordRestrictedLogin(ctx, &user, location, req)
+		return nil, ErrLoginRestricted
+	}
+
 	// Check two-factor authentication if enabled
 	if user.IsTwoFactorEnabled {
-		if req.TwoFactorCode == "" {
-			return nil, fmt.Errorf("two-factor code required")
-		}
-		if !s.verifyTwoFactorCode(user.TwoFactorSecret, req.TwoFactorCode) {
-			return nil, fmt.Errorf("invalid two-factor code")
+		if err := s.checkSecondFactor(ctx, &user, req); err != nil {
+			return nil, err
 		}
 	}
 
 	// Reset failed login count on successful login
 	if err := s.db.WithContext(ctx).Model(&user).Updates(map[string]interface{}{
-		"failed_login_count": 0,
-		"locked_until":       nil,
-		"last_login_at":      time.Now(),
-		"last_login_ip":      req.IPAddress,
+		"failed_login_count":  0,
+		"locked_until":        nil,
+		"last_login_at":       time.Now(),
+		"last_login_ip":       req.IPAddress,
+		"inactive_flagged_at": nil,
 	}).Error; err != nil {
 		return nil, fmt.Errorf("failed to update user login info: %w", err)
 	}
+	s.redis.Del(ctx, loginFailuresKey(req.IPAddress))
+
+	// Flag logins from a new country
+	if location != nil {
+		s.checkNewCountry(ctx, &user, location, req)
+	}
 
 	// Create session
-	session, err := s.createSession(ctx, &user, req.IPAddress, req.UserAgent)
+	session, err := s.createSession(ctx, &user, req.IPAddress, req.UserAgent, location)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create session: %w", err)
 	}
 
 	// Generate tokens
-	accessToken, err := s.generateAccessToken(&user, session.ID)
+	accessToken, err := s.generateAccessToken(&user, session)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate access token: %w", err)
 	}
@@ -151,26 +236,55 @@ func (s *Service) Login(ctx context.Context, req *LoginRequest) (*LoginResponse,
 		RefreshToken: refreshToken,
 		ExpiresAt:    session.ExpiresAt,
 		User:         &user,
+		PasswordExpired: s.passwordExpired(&user),
 	}, nil
 }
 
-// Register creates a new user account
-func (s *Service) Register(ctx context.Context, req *RegisterRequest) (*models.User, error) {
+// Register creates a new user account and runs the configured onboarding steps for it. Invalid
+// input is reported as an apperrors.ValidationError keyed by request field; onboarding failures
+// do not fail the registration.
+func (s *Service) Register(ctx context.Context, req *RegisterRequest) (*RegisterResponse, error) {
+	v := apperrors.NewValidation()
+	if err := s.checkRegistration(ctx, req, v); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(req.Username) == "" {
+		v.AddCode("username", "user.username_required", nil)
+	}
+	if address, err := mail.ParseAddress(req.Email); err != nil || address.Address != req.Email {
+		v.AddCode("email", "user.email_invalid", nil)
+	}
+	locale := i18n.Normalize(req.Locale)
+	if locale != "" && !i18n.Supported(locale) {
+		v.AddCode("locale", "field.locale", map[string]string{"locales": strings.Join(i18n.Locales(), ", ")})
+	}
+
 	// Validate password strength
-	if err := s.validatePassword(req.Password); err != nil {
+	if err := s.CheckPassword(ctx, req.Password); err != nil {
+		v.Add("password", err.Error())
+	}
+	if err := v.Err(); err != nil {
 		return nil, err
 	}
 
 	// Check if username or email already exists
-	var count int64
-	if err := s.db.WithContext(ctx).Model(&models.User{}).
+	var existing []models.User
+	if err := s.db.WithContext(ctx).Select("username", "email").
 		Where("username = ? OR email = ?", req.Username, req.Email).
-		Count(&count).Error; err != nil {
+		Find(&existing).Error; err != nil {
 		return nil, fmt.Errorf("failed to check user existence: %w", err)
 	}
 
-	if count > 0 {
-		return nil, fmt.Errorf("username or email already exists")
+	for _, user := range existing {
+		if user.Username == req.Username {
+			v.AddCode("username", "user.username_taken", nil)
+		}
+		if user.Email == req.Email {
+			v.AddCode("email", "user.email_taken", nil)
+		}
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
 	}
 
 	// Hash password
@@ -180,17 +294,30 @@ func (s *Service) Register(ctx context.Context, req *RegisterRequest) (*models.U
 	}
 
 	// Create user
+	now := time.Now()
 	user := &models.User{
 		Username:     req.Username,
 		Email:        req.Email,
 		PasswordHash: string(hashedPassword),
 		FirstName:    req.FirstName,
 		LastName:     req.LastName,
+		Locale:       locale,
 		IsActive:     true,
+		PasswordChangedAt: &now,
 	}
 
-	if err := s.db.WithContext(ctx).Create(user).Error; err != nil {
-		return nil, fmt.Errorf("failed to create user: %w", err)
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if s.inviteRequired(ctx) {
+			if err := redeemInvite(tx, req.InviteCode, req.Email); err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(user).Error; err != nil {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+		return s.RecordPassword(tx, user.ID, "", user.PasswordHash)
+	}); err != nil {
+		return nil, err
 	}
 
 	// Assign default role
@@ -198,7 +325,10 @@ func (s *Service) Register(ctx context.Context, req *RegisterRequest) (*models.U
 		return nil, fmt.Errorf("failed to assign default role: %w", err)
 	}
 
-	return user, nil
+	return &RegisterResponse{
+		User:       user,
+		Onboarding: s.onboard(ctx, user),
+	}, nil
 }
 
 // ValidateToken validates a JWT token and returns claims
@@ -232,8 +362,13 @@ func (s *Service) RefreshToken(ctx context.Context, refreshToken string) (*Login
 		return nil, fmt.Errorf("invalid refresh token")
 	}
 
+	// Refreshing cannot outlive the idle timeout or the session lifetime
+	if err := s.checkSessionLimits(ctx, session.ID, session.CreatedAt); err != nil {
+		return nil, err
+	}
+
 	// Generate new access token
-	accessToken, err := s.generateAccessToken(&session.User, session.ID)
+	accessToken, err := s.generateAccessToken(&session.User, &session)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate access token: %w", err)
 	}
@@ -241,6 +376,9 @@ func (s *Service) RefreshToken(ctx context.Context, refreshToken string) (*Login
 	// Update session
 	session.Token = accessToken
 	session.LastUsedAt = time.Now()
+	if s.config.SlidingSessions {
+		session.ExpiresAt = s.slidingExpiry(&session, session.LastUsedAt)
+	}
 	if err := s.db.WithContext(ctx).Save(&session).Error; err != nil {
 		return nil, fmt.Errorf("failed to update session: %w", err)
 	}
@@ -255,9 +393,153 @@ func (s *Service) RefreshToken(ctx context.Context, refreshToken string) (*Login
 		RefreshToken: refreshToken,
 		ExpiresAt:    session.ExpiresAt,
 		User:         &session.User,
+		PasswordExpired: s.passwordExpired(&session.User),
 	}, nil
 }
 
+// ExtendSession records activity on a session and, when sliding sessions are enabled, slides its
+// expiry forward. The last-seen time is buffered in Redis on every call and written to the
+// database, together with the new expiry, at most once per session activity interval.
+func (s *Service) ExtendSession(ctx context.Context, sessionID uuid.UUID) error {
+	now := time.Now()
+	if !s.recordActivity(ctx, sessionID, now) {
+		return nil
+	}
+
+	var session models.Session
+	if err := s.db.WithContext(ctx).
+		Where("id = ? AND revoked_at IS NULL AND expires_at > ?", sessionID, now).
+		First(&session).Error; err != nil {
+		return fmt.Errorf("session expired or revoked")
+	}
+
+	updates := map[string]interface{}{"last_used_at": now}
+	session.LastUsedAt = now
+	if s.config.SlidingSessions {
+		session.ExpiresAt = s.slidingExpiry(&session, now)
+		updates["expires_at"] = session.ExpiresAt
+	}
+
+	if err := s.db.WithContext(ctx).Model(&session).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to extend session: %w", err)
+	}
+
+	if s.config.SlidingSessions {
+		if err := s.storeSessionInRedis(ctx, &session); err != nil {
+			return fmt.Errorf("failed to update session in Redis: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// CheckSessionLimits ends the token's session when it has been idle longer than the idle timeout
+// or has outlived the maximum session lifetime. It must run before the request is recorded as
+// activity. Failures to read the last activity are treated as expired.
+func (s *Service) CheckSessionLimits(ctx context.Context, claims *Claims) error {
+	var createdAt time.Time
+	if claims.SessionStart != nil {
+		createdAt = claims.SessionStart.Time
+	}
+	return s.checkSessionLimits(ctx, claims.SessionID, createdAt)
+}
+
+func (s *Service) checkSessionLimits(ctx context.Context, sessionID uuid.UUID, createdAt time.Time) error {
+	now := time.Now()
+	if s.config.SessionMaxLifetime > 0 && !createdAt.IsZero() && now.Sub(createdAt) > s.config.SessionMaxLifetime {
+		s.Logout(ctx, sessionID)
+		return ErrSessionLifetime
+	}
+
+	if s.config.IdleTimeout <= 0 {
+		return nil
+	}
+
+	lastSeen, err := s.lastActivity(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if now.Sub(lastSeen) > s.config.IdleTimeout {
+		s.Logout(ctx, sessionID)
+		return ErrSessionIdle
+	}
+
+	return nil
+}
+
+// lastActivity returns when a session was last used, preferring the activity buffered in Redis
+func (s *Service) lastActivity(ctx context.Context, sessionID uuid.UUID) (time.Time, error) {
+	unix, err := s.redis.Get(ctx, sessionSeenKey(sessionID)).Int64()
+	if err == nil {
+		return time.Unix(unix, 0), nil
+	}
+	if !errors.Is(err, redis.Nil) {
+		return time.Time{}, fmt.Errorf("failed to get session activity: %w", err)
+	}
+
+	var session models.Session
+	if err := s.db.WithContext(ctx).Select("last_used_at").Where("id = ?", sessionID).First(&session).Error; err != nil {
+		return time.Time{}, fmt.Errorf("failed to get session activity: %w", err)
+	}
+	return session.LastUsedAt, nil
+}
+
+// recordActivity buffers the session's last-seen time in Redis and reports whether the activity
+// interval has passed since the last database write. Redis errors fall back to writing.
+func (s *Service) recordActivity(ctx context.Context, sessionID uuid.UUID, now time.Time) bool {
+	if s.config.SessionActivityInterval <= 0 {
+		return true
+	}
+
+	pipe := s.redis.Pipeline()
+	pipe.Set(ctx, sessionSeenKey(sessionID), now.Unix(), s.config.SessionTimeout)
+	persist := pipe.SetNX(ctx, sessionPersistKey(sessionID), 1, s.config.SessionActivityInterval)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return true
+	}
+
+	return persist.Val()
+}
+
+// applyBufferedActivity updates the sessions' last-seen times with newer activity buffered in Redis
+func (s *Service) applyBufferedActivity(ctx context.Context, sessions []*models.Session) {
+	if len(sessions) == 0 {
+		return
+	}
+
+	keys := make([]string, len(sessions))
+	for i, session := range sessions {
+		keys[i] = sessionSeenKey(session.ID)
+	}
+
+	values, err := s.redis.MGet(ctx, keys...).Result()
+	if err != nil {
+		return
+	}
+
+	for i, value := range values {
+		str, ok := value.(string)
+		if !ok {
+			continue
+		}
+		unix, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			continue
+		}
+		if seen := time.Unix(unix, 0); seen.After(sessions[i].LastUsedAt) {
+			sessions[i].LastUsedAt = seen
+		}
+	}
+}
+
+func sessionSeenKey(sessionID uuid.UUID) string {
+	return fmt.Sprintf("session_seen:%s", sessionID)
+}
+
+func sessionPersistKey(sessionID uuid.UUID) string {
+	return fmt.Sprintf("session_persisted:%s", sessionID)
+}
+
 // Logout revokes a session
 func (s *Service) Logout(ctx context.Context, sessionID uuid.UUID) error {
 	now := time.Now()
@@ -269,14 +551,67 @@ func (s *Service) Logout(ctx context.Context, sessionID uuid.UUID) error {
 		return fmt.Errorf("failed to revoke session: %w", err)
 	}
 
-	// Remove session from Redis
-	if err := s.redis.Del(ctx, fmt.Sprintf("session:%s", sessionID)).Err(); err != nil {
-		return fmt.Errorf("failed to remove session from Redis: %w", err)
+	return s.DropSessions(ctx, sessionID)
+}
+
+// DropSessions removes revoked sessions from Redis and blacklists them so access tokens
+// already issued for them stop working before they expire
+func (s *Service) DropSessions(ctx context.Context, sessionIDs ...uuid.UUID) error {
+	for _, sessionID := range sessionIDs {
+		pipe := s.redis.TxPipeline()
+		pipe.Del(ctx, fmt.Sprintf("session:%s", sessionID))
+		pipe.Set(ctx, revokedSessionKey(sessionID), 1, s.config.JWTExpiration)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return fmt.Errorf("failed to drop session %s: %w", sessionID, err)
+		}
 	}
 
 	return nil
 }
 
+// PurgeSessions deletes sessions that expired or were revoked before the cutoff and returns how
+// many were removed
+func (s *Service) PurgeSessions(ctx context.Context, before time.Time) (int64, error) {
+	result := s.db.WithContext(ctx).Where("expires_at < ? OR revoked_at < ?", before, before).Delete(&models.Session{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to purge sessions: %w", result.Error)
+	}
+
+	return result.RowsAffected, nil
+}
+
+// IsSessionRevoked reports whether access tokens for a session have been revoked.
+// Redis errors are treated as revoked so an outage cannot resurrect disabled accounts.
+func (s *Service) IsSessionRevoked(ctx context.Context, sessionID uuid.UUID) bool {
+	exists, err := s.redis.Exists(ctx, revokedSessionKey(sessionID)).Result()
+	return err != nil || exists > 0
+}
+
+func revokedSessionKey(sessionID uuid.UUID) string {
+	return fmt.Sprintf("revoked_session:%s", sessionID)
+}
+
+// GetLoginHistory retrieves a user's sessions newest first, one page at a time.
+// Pass the returned cursor to fetch the next page; it is empty on the last page.
+func (s *Service) GetLoginHistory(ctx context.Context, userID uuid.UUID, cursor string, limit int) ([]*models.Session, string, error) {
+	limit = pagination.ClampLimit(limit)
+	query, err := pagination.Apply(s.db.WithContext(ctx).Where("user_id = ?", userID), cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var sessions []*models.Session
+	if err := query.Find(&sessions).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to get login history: %w", err)
+	}
+
+	sessions, next := pagination.Next(sessions, limit, func(session *models.Session) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: session.CreatedAt, ID: session.ID.String()}
+	})
+	s.applyBufferedActivity(ctx, sessions)
+	return sessions, next, nil
+}
+
 // Helper methods
 
 func (s *Service) incrementFailedLogin(ctx context.Context, user *models.User, ipAddress string) {
@@ -302,15 +637,159 @@ func (s *Service) incrementFailedLogin(ctx context.Context, user *models.User, i
 	s.db.WithContext(ctx).Create(securityEvent)
 }
 
-func (s *Service) createSession(ctx context.Context, user *models.User, ipAddress, userAgent string) (*models.Session, error) {
+// SetCaptchaThreshold overrides the number of failed logins from an IP after which a CAPTCHA is required.
+// A threshold of zero or less restores the configured default.
+func (s *Service) SetCaptchaThreshold(ctx context.Context, threshold int) error {
+	if threshold <= 0 {
+		if err := s.redis.Del(ctx, captchaThresholdKey).Err(); err != nil {
+			return fmt.Errorf("failed to reset captcha threshold: %w", err)
+		}
+		return nil
+	}
+
+	if err := s.redis.Set(ctx, captchaThresholdKey, threshold, 0).Err(); err != nil {
+		return fmt.Errorf("failed to set captcha threshold: %w", err)
+	}
+
+	return nil
+}
+
+// captchaThreshold returns the admin override if set, otherwise the configured threshold
+func (s *Service) captchaThreshold(ctx context.Context) int {
+	if value, err := s.redis.Get(ctx, captchaThresholdKey).Result(); err == nil {
+		if threshold, err := strconv.Atoi(value); err == nil && threshold > 0 {
+			return threshold
+		}
+	}
+
+	return s.config.CaptchaThreshold
+}
+
+// checkCaptcha verifies the request's CAPTCHA token once the IP's failure count reaches the threshold
+func (s *Service) checkCaptcha(ctx context.Context, req *LoginRequest) error {
+	if s.captcha == nil || req.IPAddress == "" {
+		return nil
+	}
+
+	failures, err := s.redis.Get(ctx, loginFailuresKey(req.IPAddress)).Int()
+	if err != nil || failures < s.captchaThreshold(ctx) {
+		return nil
+	}
+
+	if req.CaptchaToken == "" {
+		return ErrCaptchaRequired
+	}
+
+	ok, err := s.captcha.Verify(ctx, req.CaptchaToken, req.IPAddress)
+	if err != nil {
+		return fmt.Errorf("failed to verify captcha: %w", err)
+	}
+	if !ok {
+		return ErrCaptchaInvalid
+	}
+
+	return nil
+}
+
+// recordIPFailure counts a failed login from an IP towards its ban and within the CAPTCHA window
+func (s *Service) recordIPFailure(ctx context.Context, ipAddress string) {
+	s.countAuthFailure(ctx, SourceWeb, ipAddress)
+
+	if s.captcha == nil || ipAddress == "" {
+		return
+	}
+
+	key := loginFailuresKey(ipAddress)
+	pipe := s.redis.TxPipeline()
+	pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, s.config.CaptchaWindow)
+	pipe.Exec(ctx)
+}
+
+func loginFailuresKey(ipAddress string) string {
+	return fmt.Sprintf("login_failures:%s", ipAddress)
+}
+
+func (s *Service) lookupLocation(ipAddress string) *geoip.Location {
+	location, err := s.geo.Lookup(ipAddress)
+	if err != nil {
+		return nil
+	}
+	return location
+}
+
+// checkNewCountry records a security event and emails the user when they log in from a country
+// none of their sessions came from before. Failures are logged and do not stop the login, which
+// has already been recorded: a mail outage must not lock out users who travel.
+func (s *Service) checkNewCountry(ctx context.Context, user *models.User, location *geoip.Location, req *LoginRequest) {
+	// Without any previously located login there is nothing to compare against
+	var known int64
+	s.db.WithContext(ctx).Model(&models.Session{}).
+		Where("user_id = ? AND country_code <> ''", user.ID).
+		Count(&known)
+	if known == 0 {
+		return
+	}
+
+	var seen int64
+	s.db.WithContext(ctx).Model(&models.Session{}).
+		Where("user_id = ? AND country_code = ?", user.ID, location.CountryCode).
+		Count(&seen)
+	if seen > 0 {
+		return
+	}
+
+	securityEvent := &models.SecurityEvent{
+		UserID:      &user.ID,
+		Type:        "new_country_login",
+		Severity:    "medium",
+		Source:      "web",
+		IPAddress:   req.IPAddress,
+		UserAgent:   req.UserAgent,
+		Description: fmt.Sprintf("Login for user %s from new country %s", user.Username, location.CountryCode),
+	}
+	if err := s.db.WithContext(ctx).Create(securityEvent).Error; err != nil {
+		s.logger.Error("Failed to record new country login", zap.String("user", user.Username), zap.Error(err))
+	}
+
+	country := location.Country
+	if country == "" {
+		country = location.CountryCode
+	}
+	name := user.FirstName
+	if name == "" {
+		name = user.Username
+	}
+	if _, err := s.mailer.EnqueueLocale(ctx, user.Email, i18n.Resolve(user.Locale, ""), "new_country_login", map[string]string{
+		"Name":      name,
+		"Country":   country,
+		"IPAddress": req.IPAddress,
+	}); err != nil {
+		s.logger.Error("Failed to queue new country login alert", zap.String("user", user.Username), zap.Error(err))
+	}
+}
+
+func (s *Service) createSession(ctx context.Context, user *models.User, ipAddress, userAgent string, location *geoip.Location) (*models.Session, error) {
+	lifetime := s.config.RefreshExpiration
+	if s.config.SlidingSessions {
+		// Sliding sessions start short and are extended by activity
+		lifetime = s.config.SessionTimeout
+	}
+
 	session := &models.Session{
 		UserID:     user.ID,
 		IPAddress:  ipAddress,
 		UserAgent:  userAgent,
-		ExpiresAt:  time.Now().Add(s.config.RefreshExpiration),
+		ExpiresAt:  time.Now().Add(lifetime),
 		LastUsedAt: time.Now(),
 	}
 
+	if location != nil {
+		session.CountryCode = location.CountryCode
+		session.Country = location.Country
+		session.City = location.City
+	}
+
 	if err := s.db.WithContext(ctx).Create(session).Error; err != nil {
 		return nil, err
 	}
@@ -318,18 +797,22 @@ func (s *Service) createSession(ctx context.Context, user *models.User, ipAddres
 	return session, nil
 }
 
-func (s *Service) generateAccessToken(user *models.User, sessionID uuid.UUID) (string, error) {
+func (s *Service) generateAccessToken(user *models.User, session *models.Session) (string, error) {
 	roles := make([]string, len(user.Roles))
 	for i, role := range user.Roles {
 		roles[i] = role.Name
 	}
 
 	claims := &Claims{
-		UserID:    user.ID,
-		Username:  user.Username,
-		Email:     user.Email,
-		Roles:     roles,
-		SessionID: sessionID,
+		UserID:       user.ID,
+		Username:     user.Username,
+		Email:        user.Email,
+		Roles:        roles,
+		SessionID:    session.ID,
+		SessionStart: jwt.NewNumericDate(session.CreatedAt),
+		Locale:       user.Locale,
+		Client:       s.newClientBinding(session),
+		PasswordExpired: s.passwordExpired(user),
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.config.JWTExpiration)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -350,9 +833,45 @@ func (s *Service) generateRefreshToken() (string, error) {
 	return base64.URLEncoding.EncodeToString(bytes), nil
 }
 
+// slidingExpiry returns the session expiry extended from now, capped at the maximum session lifetime
+func (s *Service) slidingExpiry(session *models.Session, now time.Time) time.Time {
+	expiresAt := now.Add(s.config.SessionTimeout)
+	if s.config.SessionMaxLifetime > 0 {
+		if limit := session.CreatedAt.Add(s.config.SessionMaxLifetime); expiresAt.After(limit) {
+			expiresAt = limit
+		}
+	}
+
+	// Never shorten a session that already expires later
+	if expiresAt.Before(session.ExpiresAt) {
+		return session.ExpiresAt
+	}
+	return expiresAt
+}
+
 func (s *Service) storeSessionInRedis(ctx context.Context, session *models.Session) error {
 	key := fmt.Sprintf("session:%s", session.ID)
-	return s.redis.Set(ctx, key, session.UserID.String(), s.config.SessionTimeout).Err()
+	ttl := s.config.SessionTimeout
+	if s.config.SlidingSessions {
+		ttl = time.Until(session.ExpiresAt)
+	}
+	return s.redis.Set(ctx, key, session.UserID.String(), ttl).Err()
+}
+
+// CheckPassword validates a new password against the password policy and, when enabled, against
+// known breached passwords. The breach check fails open so an unreachable API never blocks users.
+func (s *Service) CheckPassword(ctx context.Context, password string) error {
+	if err := s.validatePassword(password); err != nil {
+		return err
+	}
+
+	if s.breach != nil {
+		if breached, err := s.breach.IsBreached(ctx, password); err == nil && breached {
+			return ErrPasswordBreached
+		}
+	}
+
+	return nil
 }
 
 func (s *Service) validatePassword(password string) error {
@@ -364,9 +883,63 @@ func (s *Service) validatePassword(password string) error {
 }
 
 func (s *Service) verifyTwoFactorCode(secret, code string) bool {
-	// Implement TOTP verification here
-	// This is a placeholder - you would use a library like github.com/pquerna/otp
-	return true
+	return secret != "" && totp.Validate(code, secret)
+}
+
+// consumeBackupCode checks a one-time backup code and removes it once used. The codes are only
+// replaced while they are still those read, so concurrent logins cannot both redeem a code; a login
+// that lost the race to the redemption of another code reads them again.
+func (s *Service) consumeBackupCode(ctx context.Context, user *models.User, code string) bool {
+	hashed := HashBackupCode(code)
+	stored := user.TwoFactorBackupCodes
+
+	for attempt := 0; attempt < 3; attempt++ {
+		var hashes []string
+		if stored == "" || json.Unmarshal([]byte(stored), &hashes) != nil {
+			return false
+		}
+		i := indexOf(hashes, hashed)
+		if i < 0 {
+			return false
+		}
+
+		remaining, _ := json.Marshal(append(hashes[:i:i], hashes[i+1:]...))
+		result := s.db.WithContext(ctx).Model(&models.User{}).
+			Where("id = ? AND two_factor_backup_codes = ?", user.ID, stored).
+			Update("two_factor_backup_codes", string(remaining))
+		if result.Error != nil {
+			return false
+		}
+		if result.RowsAffected == 1 {
+			user.TwoFactorBackupCodes = string(remaining)
+			return true
+		}
+
+		var current models.User
+		if err := s.db.WithContext(ctx).Select("two_factor_backup_codes").Where("id = ?", user.ID).First(&current).Error; err != nil {
+			return false
+		}
+		stored = current.TwoFactorBackupCodes
+	}
+
+	return false
+}
+
+// indexOf returns the index of value in values, or -1
+func indexOf(values []string, value string) int {
+	for i := range values {
+		if values[i] == value {
+			return i
+		}
+	}
+	return -1
+}
+
+// HashBackupCode returns the stored form of a two-factor backup code
+func HashBackupCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
 }
 
 func (s *Service) assignDefaultRole(ctx context.Context, user *models.User) error {
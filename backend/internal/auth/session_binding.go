@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// Session binding modes, from auth.session_binding
+const (
+	BindingOff       = "off"
+	BindingUserAgent = "user_agent"
+	BindingIP        = "ip"     // Same address and user agent
+	BindingSubnet    = "subnet" // Same user agent, and an address in the same /24 or /64
+)
+
+// Prefix lengths within which the subnet binding tolerates address changes
+const (
+	bindingIPv4Prefix = 24
+	bindingIPv6Prefix = 64
+)
+
+// ErrSessionBinding is returned when a session is used from a client other than the one that
+// logged in. The session is ended, so the user has to log in again.
+var ErrSessionBinding = errors.New("session used from a different client, log in again")
+
+// ClientBinding identifies the client a session logged in from. Access tokens carry it so
+// requests can be checked without loading the session; only a hash of the user agent is kept.
+type ClientBinding struct {
+	IPAddress     string `json:"ip,omitempty"`
+	UserAgentHash string `json:"ua,omitempty"`
+}
+
+// newClientBinding returns the binding of a session, or nil while binding is off
+func (s *Service) newClientBinding(session *models.Session) *ClientBinding {
+	if s.config.SessionBinding == "" || s.config.SessionBinding == BindingOff {
+		return nil
+	}
+	return &ClientBinding{IPAddress: session.IPAddress, UserAgentHash: hashUserAgent(session.UserAgent)}
+}
+
+// CheckSessionBinding rejects a request whose client does not match the one its session logged
+// in from, under the configured binding mode. A mismatch, a sign the token was stolen, is logged
+// as a security event from source, the API the request came in through, and ends the session.
+// Tokens issued while binding was off are not checked.
+func (s *Service) CheckSessionBinding(ctx context.Context, claims *Claims, source, ipAddress, userAgent string) error {
+	mode := s.config.SessionBinding
+	if mode == "" || mode == BindingOff || claims.Client == nil {
+		return nil
+	}
+	if bindingMatches(mode, claims.Client, ipAddress, userAgent) {
+		return nil
+	}
+
+	securityEvent := &models.SecurityEvent{
+		UserID:      &claims.UserID,
+		Type:        "session_binding_mismatch",
+		Severity:    "high",
+		Source:      source,
+		IPAddress:   ipAddress,
+		UserAgent:   userAgent,
+		Description: fmt.Sprintf("Session of user %s, logged in from %s, used from a different client (%s binding); session ended", claims.Username, claims.Client.IPAddress, mode),
+	}
+	s.db.WithContext(ctx).Create(securityEvent)
+
+	s.Logout(ctx, claims.SessionID)
+	return ErrSessionBinding
+}
+
+// bindingMatches reports whether a request's client matches a session's binding under mode
+func bindingMatches(mode string, binding *ClientBinding, ipAddress, userAgent string) bool {
+	switch mode {
+	case BindingOff:
+		return true
+	case BindingUserAgent:
+		return binding.UserAgentHash == hashUserAgent(userAgent)
+	case BindingIP:
+		return binding.UserAgentHash == hashUserAgent(userAgent) && sameAddress(binding.IPAddress, ipAddress)
+	case BindingSubnet:
+		return binding.UserAgentHash == hashUserAgent(userAgent) && sameSubnet(binding.IPAddress, ipAddress)
+	}
+	return false
+}
+
+// sameAddress reports whether two addresses are the same, however they are written
+func sameAddress(a, b string) bool {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	if ipA == nil || ipB == nil {
+		return a == b
+	}
+	return ipA.Equal(ipB)
+}
+
+// sameSubnet reports whether two addresses are in the same /24 (IPv4) or /64 (IPv6)
+func sameSubnet(a, b string) bool {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	if ipA == nil || ipB == nil {
+		return a == b
+	}
+
+	if v4A, v4B := ipA.To4(), ipB.To4(); v4A != nil || v4B != nil {
+		if v4A == nil || v4B == nil {
+			return false
+		}
+		mask := net.CIDRMask(bindingIPv4Prefix, 32)
+		return v4A.Mask(mask).Equal(v4B.Mask(mask))
+	}
+	mask := net.CIDRMask(bindingIPv6Prefix, 128)
+	return ipA.Mask(mask).Equal(ipB.Mask(mask))
+}
+
+func hashUserAgent(userAgent string) string {
+	sum := sha256.Sum256([]byte(userAgent))
+	return hex.EncodeToString(sum[:16])
+}
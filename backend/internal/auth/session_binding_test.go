@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestBindingMatches(t *testing.T) {
+	binding := &ClientBinding{IPAddress: "198.51.100.7", UserAgentHash: hashUserAgent("Firefox")}
+	binding6 := &ClientBinding{IPAddress: "2001:db8:1:2::7", UserAgentHash: hashUserAgent("Firefox")}
+
+	tests := []struct {
+		mode      string
+		binding   *ClientBinding
+		ip, agent string
+		want      bool
+	}{
+		{BindingOff, binding, "203.0.113.1", "curl", true},
+
+		{BindingUserAgent, binding, "203.0.113.1", "Firefox", true},
+		{BindingUserAgent, binding, "198.51.100.7", "curl", false},
+
+		{BindingIP, binding, "198.51.100.7", "Firefox", true},
+		{BindingIP, binding, "::ffff:198.51.100.7", "Firefox", true},
+		{BindingIP, binding, "198.51.100.8", "Firefox", false},
+		{BindingIP, binding, "198.51.100.7", "curl", false},
+
+		{BindingSubnet, binding, "198.51.100.200", "Firefox", true},
+		{BindingSubnet, binding, "198.51.101.7", "Firefox", false},
+		{BindingSubnet, binding, "198.51.100.200", "curl", false},
+		{BindingSubnet, binding, "2001:db8::7", "Firefox", false},
+		{BindingSubnet, binding6, "2001:db8:1:2:ffff::1", "Firefox", true},
+		{BindingSubnet, binding6, "2001:db8:1:3::7", "Firefox", false},
+
+		{"strict", binding, "198.51.100.7", "Firefox", false},
+	}
+	for _, tt := range tests {
+		if got := bindingMatches(tt.mode, tt.binding, tt.ip, tt.agent); got != tt.want {
+			t.Errorf("bindingMatches(%s, %s from %s) = %v, want %v", tt.mode, tt.agent, tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestCheckSessionBinding(t *testing.T) {
+	tests := []struct {
+		mode      string
+		ip, agent string
+		source    string // API the request came in through
+		wantErr   bool
+	}{
+		{BindingOff, "203.0.113.1", "curl", "web", false},
+		{BindingUserAgent, "203.0.113.1", "Firefox", "web", false},
+		{BindingUserAgent, "198.51.100.7", "curl", "web", true},
+		{BindingIP, "198.51.100.7", "Firefox", "grpc", false},
+		{BindingIP, "198.51.100.8", "Firefox", "grpc", true},
+		{BindingSubnet, "198.51.100.99", "Firefox", "web", false},
+		{BindingSubnet, "203.0.113.1", "Firefox", "web", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode+" from "+tt.ip+" with "+tt.agent, func(t *testing.T) {
+			s, _ := newSessionService(t, config.AuthConfig{JWTSecret: "test", JWTExpiration: time.Hour, RefreshExpiration: time.Hour, SessionBinding: tt.mode})
+			s.geo = fixedResolver{}
+			user := createTestUser(t, s.db)
+			hash, _ := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+			s.db.Model(user).Update("password_hash", string(hash))
+			ctx := context.Background()
+
+			login, err := s.Login(ctx, &LoginRequest{Username: user.Username, Password: "correct horse", IPAddress: "198.51.100.7", UserAgent: "Firefox"})
+			if err != nil {
+				t.Fatalf("Login() error = %v", err)
+			}
+			claims, err := s.ValidateToken(login.AccessToken)
+			if err != nil {
+				t.Fatalf("ValidateToken() error = %v", err)
+			}
+			if (claims.Client == nil) != (tt.mode == BindingOff) {
+				t.Errorf("token binding = %+v under %s", claims.Client, tt.mode)
+			}
+
+			err = s.CheckSessionBinding(ctx, claims, tt.source, tt.ip, tt.agent)
+			if !tt.wantErr {
+				if err != nil {
+					t.Errorf("CheckSessionBinding() error = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrSessionBinding) {
+				t.Fatalf("CheckSessionBinding() error = %v, want ErrSessionBinding", err)
+			}
+
+			var events []models.SecurityEvent
+			s.db.Where("user_id = ? AND type = ?", user.ID, "session_binding_mismatch").Find(&events)
+			if len(events) != 1 || events[0].IPAddress != tt.ip || events[0].Severity != "high" || events[0].Source != tt.source {
+				t.Errorf("security events = %+v", events)
+			}
+			if !s.IsSessionRevoked(ctx, claims.SessionID) {
+				t.Error("session kept after a binding mismatch")
+			}
+		})
+	}
+}
+
+func TestUnboundTokensAreNotChecked(t *testing.T) {
+	s, _ := newSessionService(t, config.AuthConfig{SessionBinding: BindingIP})
+
+	claims := &Claims{Client: nil}
+	if err := s.CheckSessionBinding(context.Background(), claims, "web", "203.0.113.1", "curl"); err != nil {
+		t.Errorf("token issued while binding was off: error = %v", err)
+	}
+}
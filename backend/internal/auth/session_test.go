@@ -0,0 +1,238 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// newSessionService returns a service with the session settings on an in-memory Redis
+func newSessionService(t *testing.T, cfg config.AuthConfig) (*Service, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return NewService(newTestDB(t), client, zap.NewNop(), cfg, nil, nil, nil, nil), server
+}
+
+func TestSlidingExpiry(t *testing.T) {
+	now := time.Now()
+	s := &Service{config: config.AuthConfig{SessionTimeout: time.Hour, SessionMaxLifetime: 8 * time.Hour}}
+
+	tests := []struct {
+		name    string
+		session models.Session
+		want    time.Time
+	}{
+		{"extended by the timeout", models.Session{CreatedAt: now.Add(-time.Hour), ExpiresAt: now.Add(time.Minute)}, now.Add(time.Hour)},
+		{"capped at the maximum lifetime", models.Session{CreatedAt: now.Add(-7*time.Hour - 30*time.Minute), ExpiresAt: now.Add(time.Minute)}, now.Add(30 * time.Minute)},
+		{"never shortened", models.Session{CreatedAt: now, ExpiresAt: now.Add(2 * time.Hour)}, now.Add(2 * time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.slidingExpiry(&tt.session, now); !got.Equal(tt.want) {
+				t.Errorf("slidingExpiry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtendSession(t *testing.T) {
+	tests := []struct {
+		name       string
+		sliding    bool
+		expiresIn  time.Duration
+		wantErr    bool
+		wantExtend bool
+	}{
+		{name: "sliding", sliding: true, expiresIn: time.Minute, wantExtend: true},
+		{name: "fixed", sliding: false, expiresIn: time.Minute},
+		{name: "expired", sliding: true, expiresIn: -time.Minute, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, server := newSessionService(t, config.AuthConfig{SlidingSessions: tt.sliding, SessionTimeout: time.Hour, SessionMaxLifetime: 24 * time.Hour})
+			user := createTestUser(t, s.db)
+			session := &models.Session{UserID: user.ID, Token: "token", RefreshToken: "refresh", ExpiresAt: time.Now().Add(tt.expiresIn)}
+			if err := s.db.Create(session).Error; err != nil {
+				t.Fatalf("create session: %v", err)
+			}
+
+			err := s.ExtendSession(context.Background(), session.ID)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExtendSession() error = %v, want error %v", err, tt.wantErr)
+			}
+
+			var stored models.Session
+			s.db.Where("id = ?", session.ID).First(&stored)
+			extended := stored.ExpiresAt.After(time.Now().Add(50 * time.Minute))
+			if extended != tt.wantExtend {
+				t.Errorf("expires at %v, extended = %v, want %v", stored.ExpiresAt, extended, tt.wantExtend)
+			}
+			if tt.wantExtend {
+				if ttl := server.TTL(fmt.Sprintf("session:%s", session.ID)); ttl < 50*time.Minute {
+					t.Errorf("Redis session TTL = %v, want it extended", ttl)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateSessionLifetime(t *testing.T) {
+	tests := []struct {
+		name    string
+		sliding bool
+		want    time.Duration
+	}{
+		{"fixed sessions last the refresh expiration", false, 7 * 24 * time.Hour},
+		{"sliding sessions start at the timeout", true, time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newSessionService(t, config.AuthConfig{SlidingSessions: tt.sliding, SessionTimeout: time.Hour, RefreshExpiration: 7 * 24 * time.Hour})
+			session, err := s.createSession(context.Background(), createTestUser(t, s.db), "198.51.100.7", "test", nil)
+			if err != nil {
+				t.Fatalf("createSession: %v", err)
+			}
+			if got := time.Until(session.ExpiresAt); got > tt.want || got < tt.want-time.Minute {
+				t.Errorf("session lifetime = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionActivityIsBuffered(t *testing.T) {
+	s, server := newSessionService(t, config.AuthConfig{SessionTimeout: time.Hour, SessionActivityInterval: 5 * time.Minute})
+	user := createTestUser(t, s.db)
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	session := &models.Session{UserID: user.ID, Token: "token", RefreshToken: "refresh", ExpiresAt: time.Now().Add(time.Hour), LastUsedAt: old}
+	if err := s.db.Create(session).Error; err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	ctx := context.Background()
+	stored := func() time.Time {
+		var reloaded models.Session
+		s.db.Where("id = ?", session.ID).First(&reloaded)
+		return reloaded.LastUsedAt
+	}
+
+	// The first request of an interval is written through
+	if err := s.ExtendSession(ctx, session.ID); err != nil {
+		t.Fatalf("ExtendSession: %v", err)
+	}
+	if !stored().After(old) {
+		t.Fatal("first activity not written to the database")
+	}
+
+	// Later ones within the interval only reach Redis
+	s.db.Model(session).Update("last_used_at", old)
+	if err := s.ExtendSession(ctx, session.ID); err != nil {
+		t.Fatalf("ExtendSession: %v", err)
+	}
+	if !stored().Equal(old) {
+		t.Error("activity within the interval written to the database")
+	}
+	history, _, err := s.GetLoginHistory(ctx, user.ID, "", 10)
+	if err != nil || len(history) != 1 || !history[0].LastUsedAt.After(old) {
+		t.Errorf("login history does not show the buffered activity: %+v, %v", history, err)
+	}
+
+	server.FastForward(6 * time.Minute)
+	if err := s.ExtendSession(ctx, session.ID); err != nil {
+		t.Fatalf("ExtendSession: %v", err)
+	}
+	if !stored().After(old) {
+		t.Error("activity after the interval not written to the database")
+	}
+}
+
+func TestCheckSessionLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		started  time.Duration // Before now
+		lastUsed time.Duration // Before now, in the database
+		seen     time.Duration // Before now, buffered in Redis; zero when nothing is buffered
+		want     error
+	}{
+		{name: "active", started: time.Hour, lastUsed: time.Minute},
+		{name: "idle", started: time.Hour, lastUsed: 45 * time.Minute, want: ErrSessionIdle},
+		{name: "idle in the database but seen recently", started: time.Hour, lastUsed: 45 * time.Minute, seen: time.Minute},
+		{name: "past the maximum lifetime", started: 13 * time.Hour, lastUsed: time.Minute, want: ErrSessionLifetime},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, server := newSessionService(t, config.AuthConfig{IdleTimeout: 30 * time.Minute, SessionMaxLifetime: 12 * time.Hour, SessionTimeout: time.Hour})
+			user := createTestUser(t, s.db)
+			now := time.Now()
+			session := &models.Session{UserID: user.ID, Token: "token", RefreshToken: "refresh", ExpiresAt: now.Add(time.Hour), LastUsedAt: now.Add(-tt.lastUsed)}
+			if err := s.db.Create(session).Error; err != nil {
+				t.Fatalf("create session: %v", err)
+			}
+			if tt.seen > 0 {
+				server.Set(sessionSeenKey(session.ID), fmt.Sprint(now.Add(-tt.seen).Unix()))
+			}
+
+			err := s.checkSessionLimits(context.Background(), session.ID, now.Add(-tt.started))
+			if err != tt.want {
+				t.Fatalf("checkSessionLimits() = %v, want %v", err, tt.want)
+			}
+
+			var stored models.Session
+			s.db.Where("id = ?", session.ID).First(&stored)
+			if ended := stored.RevokedAt != nil; ended != (tt.want != nil) {
+				t.Errorf("session revoked = %v, want %v", ended, tt.want != nil)
+			}
+			if tt.want != nil && !server.Exists(revokedSessionKey(session.ID)) {
+				t.Error("ended session's tokens not blacklisted")
+			}
+		})
+	}
+}
+
+func TestPurgeSessions(t *testing.T) {
+	s, _ := newSessionService(t, config.AuthConfig{})
+	user := createTestUser(t, s.db)
+	now := time.Now()
+	cutoff := now.Add(-30 * 24 * time.Hour)
+	old, recent := now.Add(-31*24*time.Hour), now.Add(-29*24*time.Hour)
+
+	sessions := map[string]*models.Session{
+		"expired long ago": {ExpiresAt: old},
+		"revoked long ago": {ExpiresAt: now.Add(time.Hour), RevokedAt: &old},
+		"expired recently": {ExpiresAt: recent},
+		"revoked recently": {ExpiresAt: now.Add(time.Hour), RevokedAt: &recent},
+		"active":           {ExpiresAt: now.Add(time.Hour)},
+	}
+	for name, session := range sessions {
+		session.UserID = user.ID
+		session.Token, session.RefreshToken = name+" token", name+" refresh"
+		if err := s.db.Create(session).Error; err != nil {
+			t.Fatalf("create %s session: %v", name, err)
+		}
+	}
+
+	purged, err := s.PurgeSessions(context.Background(), cutoff)
+	if err != nil || purged != 2 {
+		t.Fatalf("PurgeSessions() = %d, %v, want 2", purged, err)
+	}
+	for name, session := range sessions {
+		err := s.db.Where("id = ?", session.ID).First(&models.Session{}).Error
+		if gone := err != nil; gone != strings.HasSuffix(name, "long ago") {
+			t.Errorf("%s session gone = %v", name, gone)
+		}
+	}
+}
@@ -0,0 +1,586 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// webAuthnTimeout is how long a WebAuthn ceremony may take, in the browser and on the server
+const webAuthnTimeout = 5 * time.Minute
+
+// Authenticator data flags
+const (
+	webAuthnUserPresent = 0x01
+	webAuthnAttested    = 0x40
+)
+
+// COSE algorithms accepted for credentials, in order of preference
+const (
+	coseES256 = -7
+	coseEdDSA = -8
+	coseRS256 = -257
+)
+
+var (
+	// ErrWebAuthnInvalid is returned when a WebAuthn response does not check out
+	ErrWebAuthnInvalid = errors.New("invalid security key response")
+	// ErrWebAuthnChallenge is returned when no ceremony is pending, or it expired
+	ErrWebAuthnChallenge = errors.New("no pending security key request, start again")
+)
+
+// WebAuthnCredentialDescriptor names a credential in WebAuthn options
+type WebAuthnCredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"` // Base64url
+}
+
+// WebAuthnCreationOptions are the publicKey options for navigator.credentials.create(); the
+// challenge, user ID and credential IDs are base64url and must be decoded to buffers first
+type WebAuthnCreationOptions struct {
+	Challenge string `json:"challenge"`
+	RP        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams []struct {
+		Type string `json:"type"`
+		Alg  int    `json:"alg"`
+	} `json:"pubKeyCredParams"`
+	Timeout                int64                          `json:"timeout"` // Milliseconds
+	ExcludeCredentials     []WebAuthnCredentialDescriptor `json:"excludeCredentials"`
+	Attestation            string                         `json:"attestation"`
+	AuthenticatorSelection struct {
+		ResidentKey      string `json:"residentKey"`
+		UserVerification string `json:"userVerification"`
+	} `json:"authenticatorSelection"`
+}
+
+// WebAuthnRequestOptions are the publicKey options for navigator.credentials.get()
+type WebAuthnRequestOptions struct {
+	Challenge        string                         `json:"challenge"`
+	RPID             string                         `json:"rpId"`
+	Timeout          int64                          `json:"timeout"`
+	AllowCredentials []WebAuthnCredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                         `json:"userVerification"`
+}
+
+// WebAuthnAttestation is the browser's answer to navigator.credentials.create(), its buffers
+// base64url encoded
+type WebAuthnAttestation struct {
+	ID                string `json:"id"`
+	ClientDataJSON    string `json:"client_data_json"`
+	AttestationObject string `json:"attestation_object"`
+}
+
+// WebAuthnAssertion is the browser's answer to navigator.credentials.get(), its buffers
+// base64url encoded
+type WebAuthnAssertion struct {
+	ID                string `json:"id"`
+	ClientDataJSON    string `json:"client_data_json"`
+	AuthenticatorData string `json:"authenticator_data"`
+	Signature         string `json:"signature"`
+}
+
+// BeginWebAuthnRegistration starts enrolling a security key or passkey for a user. Credentials
+// the user already has are excluded so the same authenticator is not enrolled twice.
+func (s *Service) BeginWebAuthnRegistration(ctx context.Context, user *models.User, existing []models.WebAuthnCredential) (*WebAuthnCreationOptions, error) {
+	challenge, err := s.newWebAuthnChallenge(ctx, webAuthnRegistrationKey(user.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	options := &WebAuthnCreationOptions{
+		Challenge:   challenge,
+		Timeout:     webAuthnTimeout.Milliseconds(),
+		Attestation: "none",
+	}
+	options.RP.ID = s.config.WebAuthnRPID
+	options.RP.Name = s.config.WebAuthnRPName
+	options.User.ID = base64.RawURLEncoding.EncodeToString(user.ID[:])
+	options.User.Name = user.Username
+	options.User.DisplayName = strings.TrimSpace(user.FirstName + " " + user.LastName)
+	if options.User.DisplayName == "" {
+		options.User.DisplayName = user.Username
+	}
+	for _, alg := range []int{coseES256, coseEdDSA, coseRS256} {
+		options.PubKeyCredParams = append(options.PubKeyCredParams, struct {
+			Type string `json:"type"`
+			Alg  int    `json:"alg"`
+		}{"public-key", alg})
+	}
+	options.ExcludeCredentials = credentialDescriptors(existing)
+	options.AuthenticatorSelection.ResidentKey = "preferred"
+	options.AuthenticatorSelection.UserVerification = "preferred"
+
+	return options, nil
+}
+
+// FinishWebAuthnRegistration checks the browser's answer to the pending registration of a user
+// and returns the credential to store. Attestation statements are not verified: any
+// authenticator is accepted, as with attestation "none".
+func (s *Service) FinishWebAuthnRegistration(ctx context.Context, user *models.User, attestation *WebAuthnAttestation) (*models.WebAuthnCredential, error) {
+	challenge, err := s.takeWebAuthnChallenge(ctx, webAuthnRegistrationKey(user.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	clientData, err := decodeWebAuthnBuffer(attestation.ClientDataJSON)
+	if err != nil {
+		return nil, ErrWebAuthnInvalid
+	}
+	if err := s.checkClientData(clientData, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	object, err := decodeWebAuthnBuffer(attestation.AttestationObject)
+	if err != nil {
+		return nil, ErrWebAuthnInvalid
+	}
+	decoded, _, err := cborDecode(object)
+	if err != nil {
+		return nil, ErrWebAuthnInvalid
+	}
+	fields, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, ErrWebAuthnInvalid
+	}
+	authData, ok := fields["authData"].([]byte)
+	if !ok {
+		return nil, ErrWebAuthnInvalid
+	}
+
+	parsed, err := s.parseAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.credentialID == nil {
+		return nil, ErrWebAuthnInvalid
+	}
+	if _, err := coseKey(parsed.publicKey); err != nil {
+		return nil, err
+	}
+
+	return &models.WebAuthnCredential{
+		UserID:       user.ID,
+		CredentialID: base64.RawURLEncoding.EncodeToString(parsed.credentialID),
+		PublicKey:    parsed.publicKey,
+		SignCount:    parsed.signCount,
+	}, nil
+}
+
+// webAuthnRequestOptions starts a login with one of the user's credentials
+func (s *Service) webAuthnRequestOptions(ctx context.Context, userID uuid.UUID, credentials []models.WebAuthnCredential) (*WebAuthnRequestOptions, error) {
+	challenge, err := s.newWebAuthnChallenge(ctx, webAuthnLoginKey(userID))
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebAuthnRequestOptions{
+		Challenge:        challenge,
+		RPID:             s.config.WebAuthnRPID,
+		Timeout:          webAuthnTimeout.Milliseconds(),
+		AllowCredentials: credentialDescriptors(credentials),
+		UserVerification: "preferred",
+	}, nil
+}
+
+// verifyWebAuthnAssertion checks the browser's answer to the pending login challenge of a user
+// against the credential it names, and returns that credential with its new signature counter
+func (s *Service) verifyWebAuthnAssertion(ctx context.Context, userID uuid.UUID, credentials []models.WebAuthnCredential, assertion *WebAuthnAssertion) (*models.WebAuthnCredential, error) {
+	challenge, err := s.takeWebAuthnChallenge(ctx, webAuthnLoginKey(userID))
+	if err != nil {
+		return nil, err
+	}
+
+	var credential *models.WebAuthnCredential
+	for i := range credentials {
+		if credentials[i].CredentialID == strings.TrimRight(assertion.ID, "=") {
+			credential = &credentials[i]
+		}
+	}
+	if credential == nil {
+		return nil, ErrWebAuthnInvalid
+	}
+
+	clientData, err := decodeWebAuthnBuffer(assertion.ClientDataJSON)
+	if err != nil {
+		return nil, ErrWebAuthnInvalid
+	}
+	if err := s.checkClientData(clientData, "webauthn.get", challenge); err != nil {
+		return nil, err
+	}
+
+	authData, err := decodeWebAuthnBuffer(assertion.AuthenticatorData)
+	if err != nil {
+		return nil, ErrWebAuthnInvalid
+	}
+	parsed, err := s.parseAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := decodeWebAuthnBuffer(assertion.Signature)
+	if err != nil {
+		return nil, ErrWebAuthnInvalid
+	}
+	// The signature covers the authenticator data followed by the hash of the client data
+	clientDataHash := sha256.Sum256(clientData)
+	signed := append(append([]byte{}, authData...), clientDataHash[:]...)
+	if err := verifyCOSESignature(credential.PublicKey, signed, signature); err != nil {
+		return nil, err
+	}
+
+	// A counter that does not move forward means the authenticator may have been cloned;
+	// authenticators without a counter always report 0
+	if parsed.signCount != 0 || credential.SignCount != 0 {
+		if parsed.signCount <= credential.SignCount {
+			return nil, ErrWebAuthnInvalid
+		}
+	}
+	credential.SignCount = parsed.signCount
+
+	return credential, nil
+}
+
+// newWebAuthnChallenge creates a random challenge and keeps it under key for one ceremony
+func (s *Service) newWebAuthnChallenge(ctx context.Context, key string) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate challenge: %w", err)
+	}
+	challenge := base64.RawURLEncoding.EncodeToString(buf)
+
+	if err := s.redis.Set(ctx, key, challenge, webAuthnTimeout).Err(); err != nil {
+		return "", fmt.Errorf("failed to store challenge: %w", err)
+	}
+	return challenge, nil
+}
+
+// takeWebAuthnChallenge returns the pending challenge under key and removes it, so every
+// challenge is answered at most once
+func (s *Service) takeWebAuthnChallenge(ctx context.Context, key string) (string, error) {
+	challenge, err := s.redis.GetDel(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", ErrWebAuthnChallenge
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get challenge: %w", err)
+	}
+	return challenge, nil
+}
+
+func webAuthnRegistrationKey(userID uuid.UUID) string {
+	return "webauthn:registration:" + userID.String()
+}
+
+func webAuthnLoginKey(userID uuid.UUID) string {
+	return "webauthn:login:" + userID.String()
+}
+
+// checkClientData checks the client data the browser signed over: the ceremony type, the
+// challenge, and an origin the panel is served from
+func (s *Service) checkClientData(raw []byte, ceremony, challenge string) error {
+	var clientData struct {
+		Type      string `json:"type"`
+		Challenge string `json:"challenge"`
+		Origin    string `json:"origin"`
+	}
+	if err := json.Unmarshal(raw, &clientData); err != nil {
+		return ErrWebAuthnInvalid
+	}
+
+	if clientData.Type != ceremony {
+		return ErrWebAuthnInvalid
+	}
+	if subtle.ConstantTimeCompare([]byte(strings.TrimRight(clientData.Challenge, "=")), []byte(challenge)) != 1 {
+		return ErrWebAuthnInvalid
+	}
+	for _, origin := range s.config.WebAuthnOrigins {
+		if clientData.Origin == origin {
+			return nil
+		}
+	}
+	return ErrWebAuthnInvalid
+}
+
+// authenticatorData is what an authenticator reports about a ceremony
+type authenticatorData struct {
+	flags        byte
+	signCount    uint32
+	credentialID []byte // Only on registration
+	publicKey    []byte // COSE_Key, only on registration
+}
+
+// parseAuthenticatorData reads authenticator data and checks that it was made for the panel's
+// relying party ID with the user present
+func (s *Service) parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, ErrWebAuthnInvalid
+	}
+
+	rpIDHash := sha256.Sum256([]byte(s.config.WebAuthnRPID))
+	if !bytes.Equal(data[:32], rpIDHash[:]) {
+		return nil, ErrWebAuthnInvalid
+	}
+
+	parsed := &authenticatorData{
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if parsed.flags&webAuthnUserPresent == 0 {
+		return nil, ErrWebAuthnInvalid
+	}
+
+	if parsed.flags&webAuthnAttested != 0 {
+		// AAGUID (16 bytes), credential ID length (2 bytes), credential ID, COSE key
+		rest := data[37:]
+		if len(rest) < 18 {
+			return nil, ErrWebAuthnInvalid
+		}
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if len(rest) < idLength {
+			return nil, ErrWebAuthnInvalid
+		}
+		parsed.credentialID = rest[:idLength]
+		rest = rest[idLength:]
+
+		_, after, err := cborDecode(rest)
+		if err != nil {
+			return nil, ErrWebAuthnInvalid
+		}
+		parsed.publicKey = rest[:len(rest)-len(after)]
+	}
+
+	return parsed, nil
+}
+
+// coseKey reads a COSE_Key of one of the accepted algorithms
+func coseKey(raw []byte) (crypto.PublicKey, error) {
+	decoded, _, err := cborDecode(raw)
+	if err != nil {
+		return nil, ErrWebAuthnInvalid
+	}
+	key, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, ErrWebAuthnInvalid
+	}
+	param := func(label int64) []byte {
+		value, _ := key[label].([]byte)
+		return value
+	}
+
+	kty, _ := key[int64(1)].(int64)
+	alg, _ := key[int64(3)].(int64)
+	crv, _ := key[int64(-1)].(int64)
+	switch {
+	case kty == 2 && alg == coseES256 && crv == 1:
+		x, y := param(-2), param(-3)
+		if len(x) != 32 || len(y) != 32 {
+			return nil, ErrWebAuthnInvalid
+		}
+		public := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !public.Curve.IsOnCurve(public.X, public.Y) {
+			return nil, ErrWebAuthnInvalid
+		}
+		return public, nil
+	case kty == 1 && alg == coseEdDSA && crv == 6:
+		x := param(-2)
+		if len(x) != ed25519.PublicKeySize {
+			return nil, ErrWebAuthnInvalid
+		}
+		return ed25519.PublicKey(x), nil
+	case kty == 3 && alg == coseRS256:
+		n, e := param(-1), param(-2)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, ErrWebAuthnInvalid
+		}
+		exponent := 0
+		for _, b := range e {
+			exponent = exponent<<8 | int(b)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}, nil
+	}
+	return nil, fmt.Errorf("%w: unsupported key type", ErrWebAuthnInvalid)
+}
+
+// verifyCOSESignature checks a signature over data with a COSE_Key
+func verifyCOSESignature(rawKey, data, signature []byte) error {
+	public, err := coseKey(rawKey)
+	if err != nil {
+		return err
+	}
+
+	digest := sha256.Sum256(data)
+	switch public := public.(type) {
+	case *ecdsa.PublicKey:
+		if ecdsa.VerifyASN1(public, digest[:], signature) {
+			return nil
+		}
+	case ed25519.PublicKey:
+		if ed25519.Verify(public, data, signature) {
+			return nil
+		}
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(public, crypto.SHA256, digest[:], signature) == nil {
+			return nil
+		}
+	}
+	return ErrWebAuthnInvalid
+}
+
+// credentialDescriptors lists credentials for allowCredentials or excludeCredentials
+func credentialDescriptors(credentials []models.WebAuthnCredential) []WebAuthnCredentialDescriptor {
+	descriptors := make([]WebAuthnCredentialDescriptor, len(credentials))
+	for i, credential := range credentials {
+		descriptors[i] = WebAuthnCredentialDescriptor{Type: "public-key", ID: credential.CredentialID}
+	}
+	return descriptors
+}
+
+// decodeWebAuthnBuffer decodes a base64url buffer, with or without padding
+func decodeWebAuthnBuffer(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+}
+
+// cborDecode decodes the first CBOR data item in data, as far as WebAuthn uses CBOR: integers,
+// byte and text strings, arrays, maps, tags and simple values, all of definite length. Integers
+// are int64, maps map[interface{}]interface{}. It returns the bytes after the item.
+func cborDecode(data []byte) (interface{}, []byte, error) {
+	return cborItem(data, 0)
+}
+
+func cborItem(data []byte, depth int) (interface{}, []byte, error) {
+	if depth > 16 {
+		return nil, nil, errors.New("cbor: nested too deeply")
+	}
+	if len(data) == 0 {
+		return nil, nil, errors.New("cbor: unexpected end of data")
+	}
+
+	major, info := data[0]>>5, data[0]&0x1f
+	data = data[1:]
+
+	// Simple values and floats carry their value in the additional information
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, data, nil
+		case 21:
+			return true, data, nil
+		case 22, 23:
+			return nil, data, nil
+		case 25, 26, 27:
+			size := 1 << (info - 24)
+			if len(data) < size {
+				return nil, nil, errors.New("cbor: unexpected end of data")
+			}
+			return nil, data[size:], nil
+		}
+		return nil, nil, fmt.Errorf("cbor: unsupported simple value %d", info)
+	}
+
+	var argument uint64
+	switch {
+	case info < 24:
+		argument = uint64(info)
+	case info <= 27:
+		size := 1 << (info - 24)
+		if len(data) < size {
+			return nil, nil, errors.New("cbor: unexpected end of data")
+		}
+		for _, b := range data[:size] {
+			argument = argument<<8 | uint64(b)
+		}
+		data = data[size:]
+	default:
+		return nil, nil, errors.New("cbor: indefinite lengths are not supported")
+	}
+
+	switch major {
+	case 0:
+		if argument > 1<<63-1 {
+			return nil, nil, errors.New("cbor: integer out of range")
+		}
+		return int64(argument), data, nil
+	case 1:
+		if argument > 1<<63-1 {
+			return nil, nil, errors.New("cbor: integer out of range")
+		}
+		return -1 - int64(argument), data, nil
+	case 2, 3:
+		if uint64(len(data)) < argument {
+			return nil, nil, errors.New("cbor: unexpected end of data")
+		}
+		value := data[:argument]
+		if major == 3 {
+			return string(value), data[argument:], nil
+		}
+		return value, data[argument:], nil
+	case 4:
+		if argument > uint64(len(data)) {
+			return nil, nil, errors.New("cbor: unexpected end of data")
+		}
+		items := make([]interface{}, 0, argument)
+		for i := uint64(0); i < argument; i++ {
+			item, rest, err := cborItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+			data = rest
+		}
+		return items, data, nil
+	case 5:
+		if argument > uint64(len(data)) {
+			return nil, nil, errors.New("cbor: unexpected end of data")
+		}
+		entries := make(map[interface{}]interface{}, argument)
+		for i := uint64(0); i < argument; i++ {
+			key, rest, err := cborItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, errors.New("cbor: unsupported map key")
+			}
+			value, rest, err := cborItem(rest, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			entries[key] = value
+			data = rest
+		}
+		return entries, data, nil
+	default: // 6, a tag: the tagged item stands for itself
+		return cborItem(data, depth+1)
+	}
+}
@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+)
+
+// Cache is a thin Redis-backed read-through cache.
+// Values are stored as JSON, so fields tagged json:"-" (such as password hashes) are never cached.
+type Cache struct {
+	client  *redis.Client
+	enabled bool
+	ttl     time.Duration
+}
+
+// New creates a new cache
+func New(client *redis.Client, cfg config.CacheConfig) *Cache {
+	return &Cache{
+		client:  client,
+		enabled: cfg.Enabled && client != nil,
+		ttl:     cfg.TTL,
+	}
+}
+
+// GetOrSet returns the cached value for key, calling load and caching its result on a miss.
+// Redis failures fall back to load so the cache never makes a read fail.
+func GetOrSet[T any](ctx context.Context, c *Cache, key string, load func() (T, error)) (T, error) {
+	if c == nil || !c.enabled {
+		return load()
+	}
+
+	var value T
+	data, err := c.client.Get(ctx, key).Bytes()
+	if err == nil && json.Unmarshal(data, &value) == nil {
+		return value, nil
+	}
+
+	value, err = load()
+	if err != nil {
+		return value, err
+	}
+
+	if data, err := json.Marshal(value); err == nil {
+		c.client.Set(ctx, key, data, c.ttl)
+	}
+
+	return value, nil
+}
+
+// Invalidate removes keys from the cache
+func (c *Cache) Invalidate(ctx context.Context, keys ...string) error {
+	if c == nil || !c.enabled || len(keys) == 0 {
+		return nil
+	}
+
+	if err := c.client.Del(ctx, keys...).Err(); err != nil && !errors.Is(err, redis.Nil) {
+		return fmt.Errorf("failed to invalidate cache: %w", err)
+	}
+
+	return nil
+}
+
+// DomainKey returns the cache key for a domain
+func DomainKey(id fmt.Stringer) string {
+	return "cache:domain:" + id.String()
+}
+
+// UserKey returns the cache key for a user
+func UserKey(id fmt.Stringer) string {
+	return "cache:user:" + id.String()
+}
+
+// PermissionsKey returns the cache key for a user's effective permissions
+func PermissionsKey(userID fmt.Stringer) string {
+	return "cache:permissions:" + userID.String()
+}
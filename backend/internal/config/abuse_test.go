@@ -0,0 +1,30 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestPublicAbuseFormIsOffByDefault(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	setDefaults()
+
+	if viper.GetBool("abuse.public_form") {
+		t.Error("abuse.public_form defaults to on, want reports from logged-in users only")
+	}
+	if limit := viper.GetInt("abuse.rate_limit"); limit <= 0 {
+		t.Errorf("abuse.rate_limit defaults to %d, want a limit for when the form is turned on", limit)
+	}
+	want := []string{"spam", "phishing", "malware", "copyright", "other"}
+	if categories := viper.GetStringSlice("abuse.categories"); !reflect.DeepEqual(categories, want) {
+		t.Errorf("abuse.categories defaults to %v, want %v", categories, want)
+	}
+	for _, category := range want {
+		if !abuseCategoryPattern.MatchString(category) {
+			t.Errorf("default category %q does not pass validation", category)
+		}
+	}
+}
@@ -2,10 +2,18 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
 	"github.com/spf13/viper"
+
+	"github.com/mynodecp/mynodecp/backend/internal/egress"
+	"github.com/mynodecp/mynodecp/backend/internal/secret"
 )
 
 // Config holds all configuration for the application
@@ -16,6 +24,13 @@ type Config struct {
 	Auth     AuthConfig     `mapstructure:"auth"`
 	Security SecurityConfig `mapstructure:"security"`
 	Logging  LoggingConfig  `mapstructure:"logging"`
+	Hosting  HostingConfig  `mapstructure:"hosting"`
+	Mail     MailConfig     `mapstructure:"mail"`
+	Cache    CacheConfig    `mapstructure:"cache"`
+	Jobs     JobsConfig     `mapstructure:"jobs"`
+	Status   StatusConfig   `mapstructure:"status"`
+	Tracing  TracingConfig  `mapstructure:"tracing"`
+	Abuse    AbuseConfig    `mapstructure:"abuse"`
 }
 
 // ServerConfig holds server configuration
@@ -28,6 +43,10 @@ type ServerConfig struct {
 	TLSEnabled  bool   `mapstructure:"tls_enabled"`
 	CertFile    string `mapstructure:"cert_file"`
 	KeyFile     string `mapstructure:"key_file"`
+
+	// Addresses or CIDR ranges of reverse proxies whose X-Forwarded-For header is believed for the
+	// client IP. Empty trusts none, so the client IP is always the connecting address.
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
 }
 
 // DatabaseConfig holds database configuration
@@ -41,6 +60,14 @@ type DatabaseConfig struct {
 	MaxIdleConns    int           `mapstructure:"max_idle_conns"`
 	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"`
 	SSLMode         string        `mapstructure:"ssl_mode"`
+	LogLevel        string        `mapstructure:"log_level"` // silent, error, warn, info
+	SlowQueryThreshold time.Duration `mapstructure:"slow_query_threshold"`
+
+	// Record creates, updates and deletes of the main models, with before/after diffs
+	ChangeLog bool `mapstructure:"change_log"`
+
+	// Keep the database writes of dry-run requests instead of skipping them
+	DryRunWrites bool `mapstructure:"dry_run_writes"`
 }
 
 // RedisConfig holds Redis configuration
@@ -66,8 +93,63 @@ type AuthConfig struct {
 	PasswordRequireLower bool         `mapstructure:"password_require_lower"`
 	PasswordRequireDigit bool         `mapstructure:"password_require_digit"`
 	PasswordRequireSpecial bool       `mapstructure:"password_require_special"`
+	PasswordBreachCheck bool          `mapstructure:"password_breach_check"` // Reject passwords found in the Pwned Passwords list
+	PasswordBreachAPIURL string       `mapstructure:"password_breach_api_url"`
+	PasswordBreachCacheTTL time.Duration `mapstructure:"password_breach_cache_ttl"`
+	PasswordHistory int               `mapstructure:"password_history"` // Recent passwords a new one may not repeat; 0 allows reuse
+	// Passwords older than this must be changed before the account can do anything else; 0 lets
+	// them live forever unless a role sets its own maximum age. Users are told PasswordExpiryNotice
+	// before.
+	PasswordMaxAge       time.Duration `mapstructure:"password_max_age"`
+	PasswordExpiryNotice time.Duration `mapstructure:"password_expiry_notice"`
 	TwoFactorEnabled    bool          `mapstructure:"two_factor_enabled"`
 	SessionTimeout      time.Duration `mapstructure:"session_timeout"`
+	SlidingSessions     bool          `mapstructure:"sliding_sessions"`
+	SessionMaxLifetime  time.Duration `mapstructure:"session_max_lifetime"` // Absolute cap, however the session is extended or refreshed
+	IdleTimeout         time.Duration `mapstructure:"idle_timeout"` // Sessions end after this long without activity; 0 disables
+	SessionActivityInterval time.Duration `mapstructure:"session_activity_interval"` // Minimum time between last-seen writes
+	// Binds sessions to the client that logged in: off, user_agent, ip (address and user agent)
+	// or subnet (user agent, and an address in the same /24 or /64 as at login, for mobile clients)
+	SessionBinding string `mapstructure:"session_binding"`
+	GeoIPDatabase       string        `mapstructure:"geoip_database"`
+	CaptchaProvider     string        `mapstructure:"captcha_provider"` // recaptcha, hcaptcha, turnstile; empty disables
+	CaptchaSecret       string        `mapstructure:"captcha_secret"`
+	CaptchaThreshold    int           `mapstructure:"captcha_threshold"`
+	CaptchaWindow       time.Duration `mapstructure:"captcha_window"`
+	// Brute-force protection: an IP with BanThreshold failed logins within BanWindow, to the panel
+	// or reported by the MTA, FTP and SSH servers through the auth failure hook, is banned from
+	// logging in for BanDuration; 0 disables bans. The hook is off while its secret is empty.
+	BanThreshold          int           `mapstructure:"ban_threshold"`
+	BanWindow             time.Duration `mapstructure:"ban_window"`
+	BanDuration           time.Duration `mapstructure:"ban_duration"`
+	AuthFailureHookSecret string        `mapstructure:"auth_failure_hook_secret"`
+
+	// Self-registration: open to anyone, invite (an invite code from an admin is required) or
+	// closed (only admins create accounts). Reserved usernames can only be taken by admins.
+	RegistrationMode  string        `mapstructure:"registration_mode"`
+	ReservedUsernames []string      `mapstructure:"reserved_usernames"`
+	InviteTTL         time.Duration `mapstructure:"invite_ttl"` // Default lifetime of invite codes
+
+	// Email changes are confirmed through a link sent to the new address: EmailChangeURL with the
+	// token appended as the token query parameter, valid for EmailChangeTTL
+	EmailChangeURL string        `mapstructure:"email_change_url"`
+	EmailChangeTTL time.Duration `mapstructure:"email_change_ttl"`
+
+	// Provisioning steps run in order after a user registers: welcome_email, starter_domain (a
+	// domain named after OnboardingDomain with {username} replaced) and default_database (a MySQL
+	// database on the starter domain). A failed step is logged and does not undo the registration.
+	OnboardingSteps  []string `mapstructure:"onboarding_steps"`
+	OnboardingDomain string   `mapstructure:"onboarding_domain"`
+
+	// Second factors users can enroll, any number of them, with one as their default: totp
+	// (authenticator apps), email (codes sent to the verified address, valid for EmailOTPTTL) and
+	// webauthn (security keys and passkeys). WebAuthn credentials are scoped to WebAuthnRPID, a
+	// domain the panel is served under, and only accepted from pages at WebAuthnOrigins.
+	TwoFactorMethods []string      `mapstructure:"two_factor_methods"`
+	EmailOTPTTL      time.Duration `mapstructure:"email_otp_ttl"`
+	WebAuthnRPID     string        `mapstructure:"webauthn_rp_id"`
+	WebAuthnRPName   string        `mapstructure:"webauthn_rp_name"`
+	WebAuthnOrigins  []string      `mapstructure:"webauthn_origins"`
 }
 
 // SecurityConfig holds security configuration
@@ -75,14 +157,38 @@ type SecurityConfig struct {
 	RateLimitEnabled    bool          `mapstructure:"rate_limit_enabled"`
 	RateLimitRequests   int           `mapstructure:"rate_limit_requests"`
 	RateLimitWindow     time.Duration `mapstructure:"rate_limit_window"`
+	RateLimitSyncInterval time.Duration `mapstructure:"rate_limit_sync_interval"` // How often instances reconcile counts through Redis
+	RateLimitFailClosed bool          `mapstructure:"rate_limit_fail_closed"`   // Reject requests while Redis is unreachable
+	RateLimitWarnPercent int          `mapstructure:"rate_limit_warn_percent"`  // Warn clients once this share of the limit, in percent, is left; 0 never warns
 	CORSEnabled         bool          `mapstructure:"cors_enabled"`
 	CORSAllowedOrigins  []string      `mapstructure:"cors_allowed_origins"`
+	CORSAllowedMethods  []string      `mapstructure:"cors_allowed_methods"`
+	CORSAllowedHeaders  []string      `mapstructure:"cors_allowed_headers"`
+	CORSAllowCredentials bool         `mapstructure:"cors_allow_credentials"`
+	CORSMaxAge          time.Duration `mapstructure:"cors_max_age"`
+	CSPEnabled          bool          `mapstructure:"csp_enabled"`
+	CSPPolicy           string        `mapstructure:"csp_policy"`
+	CSPReportOnly       bool          `mapstructure:"csp_report_only"`
+	CSPReportURI        string        `mapstructure:"csp_report_uri"`
 	CSRFEnabled         bool          `mapstructure:"csrf_enabled"`
 	HSTSEnabled         bool          `mapstructure:"hsts_enabled"`
 	HSTSMaxAge          int           `mapstructure:"hsts_max_age"`
 	ContentTypeNosniff  bool          `mapstructure:"content_type_nosniff"`
 	XFrameOptions       string        `mapstructure:"x_frame_options"`
 	XSSProtection       bool          `mapstructure:"xss_protection"`
+
+	// Keys encrypting secret columns at rest, such as TLS private keys and two-factor secrets, by
+	// version. Each is 32 random bytes, base64 encoded. New values use EncryptionKeyVersion; keep
+	// older versions until the re-encryption job has moved every value to the current one.
+	EncryptionKeys       map[string]string `mapstructure:"encryption_keys"`
+	EncryptionKeyVersion string            `mapstructure:"encryption_key_version"`
+
+	// Outbound HTTP calls to external services (breach checks, CAPTCHA verification, the
+	// nameserver API, the ACME server) go through OutboundProxy when set, and only to hosts in
+	// OutboundAllowedHosts: hostnames, or *.example.com for every name below a domain. An empty
+	// allowlist allows any host.
+	OutboundProxy        string   `mapstructure:"outbound_proxy"`
+	OutboundAllowedHosts []string `mapstructure:"outbound_allowed_hosts"`
 }
 
 // LoggingConfig holds logging configuration
@@ -94,6 +200,335 @@ type LoggingConfig struct {
 	MaxBackups int    `mapstructure:"max_backups"`
 	MaxAge     int    `mapstructure:"max_age"`
 	Compress   bool   `mapstructure:"compress"`
+
+	// Share of successful (2xx) HTTP requests that are logged, from 0 to 1; other responses are
+	// always logged
+	RequestSampleRate float64 `mapstructure:"request_sample_rate"`
+	// Request headers included in request logs
+	RequestHeaders []string `mapstructure:"request_headers"`
+	// Headers and query parameters whose values are never logged: any field whose name contains
+	// one of these, ignoring case
+	RedactFields []string `mapstructure:"redact_fields"`
+}
+
+// HostingConfig holds web hosting configuration
+type HostingConfig struct {
+	VhostDir        string `mapstructure:"vhost_dir"`
+	SSLDir          string `mapstructure:"ssl_dir"`
+	PHPFPMSocketDir string `mapstructure:"php_fpm_socket_dir"`
+	// PHP handlers installed on the server, "fpm" and "cgi"; domains pick one of them. Domains
+	// loading their own extensions get an FPM pool in PHPPoolDir, or php-cgi files in PHPCGIDir.
+	// Installed extensions are the .ini files in PHPModsDir. "{version}" in the directories is
+	// replaced with the PHP version.
+	PHPHandlers []string `mapstructure:"php_handlers"`
+	PHPPoolDir  string   `mapstructure:"php_pool_dir"`
+	PHPCGIDir   string   `mapstructure:"php_cgi_dir"`
+	PHPModsDir  string   `mapstructure:"php_mods_dir"`
+	// Clears the opcache of a domain's PHP processes, run without a shell; {socket}, {version} and
+	// {domain} are replaced. Domains on the shared pool of their version clear it for all of its
+	// domains. Empty disables opcache resets.
+	PHPOpcacheResetCommand string `mapstructure:"php_opcache_reset_command"`
+	// PHP versions being retired. Domains on one show a warning, and with PHPDeprecationNotify
+	// their owners are emailed once; from its removal date a version can no longer be selected.
+	PHPDeprecations      []PHPDeprecation `mapstructure:"php_deprecations"`
+	PHPDeprecationNotify bool             `mapstructure:"php_deprecation_notify"`
+	ZoneDir         string `mapstructure:"zone_dir"`
+	LogDir          string `mapstructure:"log_dir"`
+	BackupDir       string `mapstructure:"backup_dir"`
+	HomeDir         string `mapstructure:"home_dir"` // Parent of the shell users' home directories
+	HtpasswdDir     string `mapstructure:"htpasswd_dir"` // Password files of protected directories, one per directory
+
+	// FTP accounts are synced to a ProFTPD AuthUserFile and an include file that denies writes to
+	// read-only accounts; logins run as FTPUID/FTPGID, the owner of the web files
+	FTPUsersFile    string `mapstructure:"ftp_users_file"`
+	FTPReadOnlyFile string `mapstructure:"ftp_read_only_file"`
+	FTPUID          int    `mapstructure:"ftp_uid"`
+	FTPGID          int    `mapstructure:"ftp_gid"`
+
+	// Resumable uploads into domain directories are staged in UploadDir, and given up UploadTTL
+	// after their last chunk. UploadMaxSize caps a single upload in bytes; 0 leaves only the
+	// domain's disk quota.
+	UploadDir     string        `mapstructure:"upload_dir"`
+	UploadTTL     time.Duration `mapstructure:"upload_ttl"`
+	UploadMaxSize int64         `mapstructure:"upload_max_size"`
+
+	// Log provisioning (zone, vhost and authorized_keys writes, database commands) instead of
+	// carrying it out. Admins can also ask for this per request with the X-Dry-Run header.
+	DryRun bool `mapstructure:"dry_run"`
+
+	// Quotas of new domains whose owner has no role (package) granting more, in bytes
+	DefaultDiskQuota      int64 `mapstructure:"default_disk_quota"`
+	DefaultBandwidthQuota int64 `mapstructure:"default_bandwidth_quota"`
+
+	// Overcommit guard: quotas allocated on a server are compared with its capacity (a node's
+	// disk_capacity/bandwidth_capacity, or these for domains not on a node; 0 leaves it unchecked).
+	// Allocations beyond OvercommitWarnRatio of the capacity are logged, beyond OvercommitMaxRatio
+	// refused; a ratio of 0 disables the respective step.
+	ServerDiskCapacity      int64   `mapstructure:"server_disk_capacity"`
+	ServerBandwidthCapacity int64   `mapstructure:"server_bandwidth_capacity"`
+	OvercommitWarnRatio     float64 `mapstructure:"overcommit_warn_ratio"`
+	OvercommitMaxRatio      float64 `mapstructure:"overcommit_max_ratio"`
+
+	// Subdomains per domain when no role sets max_subdomains; 0 means unlimited
+	DefaultMaxSubdomains int `mapstructure:"default_max_subdomains"`
+	// Names that cannot be created as subdomains because default records or services use them
+	ReservedSubdomains []string `mapstructure:"reserved_subdomains"`
+	// DNS records deleting a subdomain removes: all (every record at or under its name), created
+	// (its address records, while they still point at the server) or off
+	SubdomainDNSCleanup string `mapstructure:"subdomain_dns_cleanup"`
+
+	// Addresses set up the first time a domain's email is enabled, such as the RFC 2142 postmaster
+	// and abuse: mailboxes of DefaultMailboxQuotaMB each, created without a password until the
+	// owner sets one, and aliases forwarding to the owner's email address. Addresses that exist
+	// are skipped, as are mailboxes that would not fit the domain's disk quota.
+	DefaultMailboxes      []string `mapstructure:"default_mailboxes"`
+	DefaultMailAliases    []string `mapstructure:"default_mail_aliases"`
+	DefaultMailboxQuotaMB int      `mapstructure:"default_mailbox_quota_mb"`
+
+	// Page written to the document root of new domains so they do not answer 403 before the owner
+	// uploads a site: "default", "coming_soon" or "none". LandingPageTemplate, an html/template
+	// file given .Domain and .Brand, replaces the built-in page. With LandingPageRemove, the page
+	// is deleted once other content appears in the document root.
+	LandingPage         string `mapstructure:"landing_page"`
+	LandingPageTemplate string `mapstructure:"landing_page_template"`
+	LandingPageBrand    string `mapstructure:"landing_page_brand"`
+	LandingPageRemove   bool   `mapstructure:"landing_page_remove"`
+
+	// Suspended domains answer 503 with a page naming LandingPageBrand, kept per domain in
+	// SuspendedPageDir apart from the customer's files
+	SuspendedPageDir string `mapstructure:"suspended_page_dir"`
+
+	// DNS records per domain: at most DNSRecordLimits[type] of a type and DNSMaxRecords in total,
+	// 0 meaning unlimited; record TTLs are clamped to [DNSMinTTL, DNSMaxTTL] seconds
+	DNSRecordLimits map[string]int `mapstructure:"dns_record_limits"`
+	DNSMaxRecords   int            `mapstructure:"dns_max_records"`
+	DNSMinTTL       int            `mapstructure:"dns_min_ttl"`
+	DNSMaxTTL       int            `mapstructure:"dns_max_ttl"`
+
+	// Zone defaults: the TTL of records created without one, unless the domain sets its own, and
+	// the SOA timers in seconds. The SOA names the contact, as a mailbox such as
+	// hostmaster@example.com; empty uses hostmaster at each zone's own domain.
+	DNSDefaultTTL int    `mapstructure:"dns_default_ttl"`
+	DNSSOAContact string `mapstructure:"dns_soa_contact"`
+	DNSSOARefresh int    `mapstructure:"dns_soa_refresh"`
+	DNSSOARetry   int    `mapstructure:"dns_soa_retry"`
+	DNSSOAExpire  int    `mapstructure:"dns_soa_expire"`
+	DNSSOAMinimum int    `mapstructure:"dns_soa_minimum"` // Negative caching TTL
+
+	// Usage alerts, as percentages of each quota
+	QuotaAlertThresholds []int         `mapstructure:"quota_alert_thresholds"`
+	QuotaCheckInterval   time.Duration `mapstructure:"quota_check_interval"`
+	QuotaEnforce         bool          `mapstructure:"quota_enforce"` // Block uploads and incoming mail at 100%
+
+	// Database storage caps in megabytes: DatabaseQuotaMB for each database and
+	// UserDatabaseQuotaMB for all databases of a user together; 0 means unlimited. Sizes are
+	// measured on the provisioning database server with every quota check. Databases over either
+	// cap are blocked from imports, and users over their cap cannot create databases.
+	DatabaseQuotaMB     int64 `mapstructure:"database_quota_mb"`
+	UserDatabaseQuotaMB int64 `mapstructure:"user_database_quota_mb"`
+
+	// How often access logs are read into hourly traffic samples, which also make up the domains'
+	// bandwidth usage for the month. Request sizes are counted when log lines end with
+	// $request_length, as in the mynodecp log format.
+	TrafficCollectInterval time.Duration `mapstructure:"traffic_collect_interval"`
+	AccessLogFormat        string        `mapstructure:"access_log_format"` // nginx log_format of the domains' access logs
+
+	// How often each domain's disk, bandwidth, mail and database usage is snapshotted for the
+	// billing exports; 0 disables the snapshots
+	UsageSnapshotInterval time.Duration `mapstructure:"usage_snapshot_interval"`
+
+	// Single sign-on handoff to phpMyAdmin or Adminer; disabled when the URL is empty
+	DBAdminURL      string        `mapstructure:"db_admin_url"`
+	DBAdminSecret   string        `mapstructure:"db_admin_secret"` // Shared with the signon script
+	DBAdminTokenTTL time.Duration `mapstructure:"db_admin_token_ttl"`
+
+	// Authoritative nameservers of hosted zones. New domains get NS records for them and zones
+	// are rendered with an SOA naming the first; empty leaves both out.
+	Nameservers []string `mapstructure:"nameservers"`
+
+	// Addresses used in default DNS records of domains that are not on a node
+	ServerIPv4 string `mapstructure:"server_ipv4"`
+	ServerIPv6 string `mapstructure:"server_ipv6"` // Optional; AAAA records are created when set
+
+	// Admin connection to the managed database server that customer databases are provisioned
+	// on. It has its own pool, apart from the panel's database, so slow or failing provisioning
+	// cannot exhaust or block the panel's connections. Without a user only the address is checked.
+	ProvisioningDBUser            string        `mapstructure:"provisioning_db_user"`
+	ProvisioningDBPassword        string        `mapstructure:"provisioning_db_password"`
+	ProvisioningDBMaxOpenConns    int           `mapstructure:"provisioning_db_max_open_conns"`
+	ProvisioningDBMaxIdleConns    int           `mapstructure:"provisioning_db_max_idle_conns"`
+	ProvisioningDBConnMaxLifetime time.Duration `mapstructure:"provisioning_db_conn_max_lifetime"`
+	ProvisioningDBConnMaxIdleTime time.Duration `mapstructure:"provisioning_db_conn_max_idle_time"`
+	ProvisioningDBDialTimeout     time.Duration `mapstructure:"provisioning_db_dial_timeout"`
+	ProvisioningDBQueryTimeout    time.Duration `mapstructure:"provisioning_db_query_timeout"` // Bounds every statement
+	ProvisioningDBHealthInterval  time.Duration `mapstructure:"provisioning_db_health_interval"`
+
+	ProvisioningDBAddr string `mapstructure:"provisioning_db_addr"`
+	NameserverAPIURL   string `mapstructure:"nameserver_api_url"`
+	MTACheckCommand    string `mapstructure:"mta_check_command"`
+	ACMEDirectoryURL   string `mapstructure:"acme_directory_url"`
+
+	// ACME account certificates are issued under: its key, created on first use, and the contact
+	// address registered with it. DNS-01 challenges, used for wildcard names, wait ACMEDNSPropagation
+	// after publishing their TXT records for the nameserver to load the zone.
+	ACMEAccountKeyFile string        `mapstructure:"acme_account_key_file"`
+	ACMEEmail          string        `mapstructure:"acme_email"`
+	ACMEDNSPropagation time.Duration `mapstructure:"acme_dns_propagation"`
+
+	// Certificates issued automatically for new domains when no role (package) sets auto_ssl.
+	// Every AutoSSLInterval, domains waiting for one are verified and issued a certificate, which
+	// also turns on force_https. A domain not pointing at the server yet, or failing issuance, is
+	// retried after AutoSSLBackoff and then twice as long each time, and after AutoSSLMaxAttempts
+	// attempts is marked failed, leaving issuance to its owner.
+	AutoSSL            bool          `mapstructure:"auto_ssl"`
+	AutoSSLInterval    time.Duration `mapstructure:"auto_ssl_interval"`
+	AutoSSLBackoff     time.Duration `mapstructure:"auto_ssl_backoff"`
+	AutoSSLMaxAttempts int           `mapstructure:"auto_ssl_max_attempts"`
+
+	// Watchdog restarting managed systemd units, such as nginx or mysql, found failed. A unit is
+	// restarted at most WatchdogMaxAttempts times in a row, waiting WatchdogBackoff before the
+	// second attempt and twice as long before each further one; then it is left alone and admins
+	// are alerted until it is running again. No units disables the watchdog.
+	WatchdogServices    []string      `mapstructure:"watchdog_services"`
+	WatchdogInterval    time.Duration `mapstructure:"watchdog_interval"`
+	WatchdogBackoff     time.Duration `mapstructure:"watchdog_backoff"`
+	WatchdogMaxAttempts int           `mapstructure:"watchdog_max_attempts"`
+	// Long-running operations on a domain, such as renames, certificates and backups, hold a lock
+	// on it shared by every panel instance. The lock expires LockTTL after its holder stops
+	// renewing it, as when it crashes. A conflicting operation waits up to LockWait for it, then
+	// fails as busy; 0 fails at once.
+	LockTTL  time.Duration `mapstructure:"lock_ttl"`
+	LockWait time.Duration `mapstructure:"lock_wait"`
+}
+
+// MailConfig holds mail server configuration
+type MailConfig struct {
+	IMAPAddr string `mapstructure:"imap_addr"`
+
+	// Settings recommended to mail clients; an empty hostname means mail.<domain>
+	ClientHostname string `mapstructure:"client_hostname"`
+	ClientIMAPPort int    `mapstructure:"client_imap_port"`
+	ClientPOP3Port int    `mapstructure:"client_pop3_port"`
+	ClientSMTPPort int    `mapstructure:"client_smtp_port"`
+
+	// DNS records created when a domain's email is enabled so mail clients find the settings above:
+	// autoconfig and autodiscover (CNAMEs to DiscoveryHost, where the autoconfig endpoints answer,
+	// and the _autodiscover._tcp SRV record), imap and submission (the RFC 6186 SRV records of the
+	// client IMAP and SMTP ports). An empty DiscoveryHost means the domain itself. Names that
+	// already have records are left alone.
+	DiscoveryRecords []string `mapstructure:"discovery_records"`
+	DiscoveryHost    string   `mapstructure:"discovery_host"`
+
+	// Outbound send limits of hosted mailboxes, reported by the MTA through the send hook
+	SendLimitAccount int           `mapstructure:"send_limit_account"`
+	SendLimitDomain  int           `mapstructure:"send_limit_domain"`
+	SendLimitWindow  time.Duration `mapstructure:"send_limit_window"`
+	SendHookSecret   string        `mapstructure:"send_hook_secret"` // Disables the send and delivery hooks when empty
+
+	// Outbound mail sent by the panel
+	SMTPHost      string        `mapstructure:"smtp_host"`
+	SMTPPort      int           `mapstructure:"smtp_port"`
+	SMTPUsername  string        `mapstructure:"smtp_username"`
+	SMTPPassword  string        `mapstructure:"smtp_password"`
+	From          string        `mapstructure:"from"`
+	DryRun        bool          `mapstructure:"dry_run"` // Log messages instead of sending them
+	MaxAttempts   int           `mapstructure:"max_attempts"`
+	RetryInterval time.Duration `mapstructure:"retry_interval"`
+	PollInterval  time.Duration `mapstructure:"poll_interval"`
+	SendTimeout   time.Duration `mapstructure:"send_timeout"` // Per connection attempt and per SMTP session
+
+	// Messages claimed for sending longer than this ago, by an instance that stopped before
+	// recording the outcome, are queued again
+	SendingLease time.Duration `mapstructure:"sending_lease"`
+
+	// How often notifications users chose to get in a digest are emailed together
+	DigestInterval time.Duration `mapstructure:"digest_interval"`
+
+	// Deliverability tests look for DKIM keys under DKIMSelectors and for the server's address on
+	// the DNSBLs. With a DeliverabilityMailbox they also send it a test message from the domain's
+	// postmaster. A domain can be tested DeliverabilityTestLimit times an hour.
+	DKIMSelectors           []string `mapstructure:"dkim_selectors"`
+	DNSBLs                  []string `mapstructure:"dnsbls"`
+	DeliverabilityMailbox   string   `mapstructure:"deliverability_mailbox"`
+	DeliverabilityTestLimit int      `mapstructure:"deliverability_test_limit"`
+}
+
+// CacheConfig holds Redis read cache configuration
+type CacheConfig struct {
+	Enabled bool          `mapstructure:"enabled"`
+	TTL     time.Duration `mapstructure:"ttl"`
+}
+
+// JobsConfig holds maintenance job configuration
+type JobsConfig struct {
+	CleanupInterval  time.Duration `mapstructure:"cleanup_interval"` // How often the purge jobs run
+	TrafficRetention time.Duration `mapstructure:"traffic_retention"` // Hourly traffic samples behind the traffic reports
+
+	// Retention policies: rows older than their retention are purged every CleanupInterval.
+	// Zero, the default, keeps them forever.
+	SessionRetention       time.Duration `mapstructure:"session_retention"` // After expiry or revocation, for login history
+	MetricRetention        time.Duration `mapstructure:"metric_retention"`
+	AuditRetention         time.Duration `mapstructure:"audit_retention"` // Audit and change logs
+	SecurityEventRetention time.Duration `mapstructure:"security_event_retention"`
+	BackupRetention        time.Duration `mapstructure:"backup_retention"` // Backups and their archives, whatever their expiry
+	UsageRetention         time.Duration `mapstructure:"usage_retention"`  // Usage snapshots behind the billing exports
+
+	// Account cleanup: unverified accounts owning nothing are deleted after UnverifiedRetention,
+	// having been warned UnverifiedWarning before; accounts unused for InactiveAfter are flagged.
+	// Zero disables the respective step; deletion is off by default.
+	UnverifiedRetention time.Duration `mapstructure:"unverified_retention"`
+	UnverifiedWarning   time.Duration `mapstructure:"unverified_warning"`
+	InactiveAfter       time.Duration `mapstructure:"inactive_after"`
+
+	// A scheduled job counts as overdue, and is reported, once this many of its intervals pass
+	// without a finished run
+	OverdueIntervals int `mapstructure:"overdue_intervals"`
+	// Bearer token Prometheus scrapes /metrics with; the endpoint is off while empty
+	MetricsToken string `mapstructure:"metrics_token"`
+}
+
+// StatusConfig holds public status page configuration
+type StatusConfig struct {
+	Enabled    bool              `mapstructure:"enabled"`
+	Components []StatusComponent `mapstructure:"components"` // Published components, in display order
+	CacheTTL   time.Duration     `mapstructure:"cache_ttl"`
+	StaleAfter time.Duration     `mapstructure:"stale_after"` // Service checks older than this count as unknown
+	RateLimit  int               `mapstructure:"rate_limit"`  // Requests per client IP and minute
+}
+
+// AbuseConfig holds the intake of abuse reports
+type AbuseConfig struct {
+	// Accept reports at /abuse-reports/public without logging in, limited to RateLimit per client
+	// IP and hour; otherwise only logged-in users can file them
+	PublicForm bool `mapstructure:"public_form"`
+	RateLimit  int  `mapstructure:"rate_limit"`
+	// Categories reports are filed under, such as spam or phishing
+	Categories []string `mapstructure:"categories"`
+	// Notify every admin of new reports
+	NotifyAdmins bool `mapstructure:"notify_admins"`
+}
+
+// TracingConfig holds OpenTelemetry tracing configuration
+type TracingConfig struct {
+	// OTLP gRPC collector spans are exported to, as host:port; tracing is off while empty
+	Endpoint string `mapstructure:"endpoint"`
+	Insecure bool   `mapstructure:"insecure"` // Export without TLS
+	// Share of traces recorded, from 0 to 1; traces continued from a caller follow its decision
+	SampleRate float64 `mapstructure:"sample_rate"`
+}
+
+// PHPDeprecation is a PHP version being retired
+type PHPDeprecation struct {
+	Version     string `mapstructure:"version"`
+	RemovedAt   string `mapstructure:"removed_at"`  // Removal date, YYYY-MM-DD
+	Replacement string `mapstructure:"replacement"` // Version owners are asked to move to, optional
+}
+
+// StatusComponent is a component shown on the status page, up while the managed services it
+// depends on are running
+type StatusComponent struct {
+	Name     string   `mapstructure:"name"`
+	Services []string `mapstructure:"services"`
 }
 
 // Load loads configuration from environment variables and config files
@@ -118,6 +553,14 @@ func Load() (*Config, error) {
 		}
 	}
 
+	// Overlay environment specific settings, e.g. config.production.yaml
+	viper.SetConfigName("config." + viper.GetString("server.environment"))
+	if err := viper.MergeInConfig(); err != nil {
+		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
+			return nil, fmt.Errorf("failed to read environment config file: %w", err)
+		}
+	}
+
 	var config Config
 	if err := viper.Unmarshal(&config); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
@@ -140,6 +583,7 @@ func setDefaults() {
 	viper.SetDefault("server.version", "1.0.0")
 	viper.SetDefault("server.domain", "localhost")
 	viper.SetDefault("server.tls_enabled", false)
+	viper.SetDefault("server.trusted_proxies", []string{})
 
 	// Database defaults
 	viper.SetDefault("database.host", "localhost")
@@ -151,6 +595,10 @@ func setDefaults() {
 	viper.SetDefault("database.max_idle_conns", 5)
 	viper.SetDefault("database.conn_max_lifetime", "5m")
 	viper.SetDefault("database.ssl_mode", "disable")
+	viper.SetDefault("database.log_level", "warn")
+	viper.SetDefault("database.slow_query_threshold", "200ms")
+	viper.SetDefault("database.change_log", true)
+	viper.SetDefault("database.dry_run_writes", false)
 
 	// Redis defaults
 	viper.SetDefault("redis.host", "localhost")
@@ -168,27 +616,90 @@ func setDefaults() {
 	viper.SetDefault("auth.jwt_expiration", "15m")
 	viper.SetDefault("auth.refresh_expiration", "7d")
 	viper.SetDefault("auth.password_min_length", 8)
+	viper.SetDefault("auth.password_history", 0)
+	viper.SetDefault("auth.password_max_age", "0")
+	viper.SetDefault("auth.password_expiry_notice", "168h")
 	viper.SetDefault("auth.password_require_upper", true)
 	viper.SetDefault("auth.password_require_lower", true)
 	viper.SetDefault("auth.password_require_digit", true)
 	viper.SetDefault("auth.password_require_special", true)
+	viper.SetDefault("auth.password_breach_check", false)
+	viper.SetDefault("auth.password_breach_api_url", "https://api.pwnedpasswords.com/range/")
+	viper.SetDefault("auth.password_breach_cache_ttl", "15m")
 	viper.SetDefault("auth.two_factor_enabled", true)
+	viper.SetDefault("auth.two_factor_methods", []string{"totp", "email", "webauthn"})
+	viper.SetDefault("auth.email_otp_ttl", "10m")
+	viper.SetDefault("auth.webauthn_rp_id", "localhost")
+	viper.SetDefault("auth.webauthn_rp_name", "MyNodeCP")
+	viper.SetDefault("auth.webauthn_origins", []string{"http://localhost:3000", "http://localhost:8080"})
 	viper.SetDefault("auth.session_timeout", "24h")
+	viper.SetDefault("auth.sliding_sessions", false)
+	viper.SetDefault("auth.session_max_lifetime", "720h")
+	viper.SetDefault("auth.session_activity_interval", "60s")
+	viper.SetDefault("auth.idle_timeout", "0s")
+	viper.SetDefault("auth.session_binding", "off")
+	viper.SetDefault("auth.geoip_database", "")
+	viper.SetDefault("auth.captcha_provider", "")
+	viper.SetDefault("auth.captcha_secret", "")
+	viper.SetDefault("auth.captcha_threshold", 3)
+	viper.SetDefault("auth.captcha_window", "15m")
+	viper.SetDefault("auth.ban_threshold", 20)
+	viper.SetDefault("auth.ban_window", "15m")
+	viper.SetDefault("auth.ban_duration", "1h")
+	viper.SetDefault("auth.auth_failure_hook_secret", "")
+	viper.SetDefault("auth.registration_mode", "open")
+	viper.SetDefault("auth.reserved_usernames", []string{"admin", "administrator", "root", "postmaster", "hostmaster", "webmaster", "abuse", "security", "support", "noreply", "no-reply", "mailer-daemon", "nobody", "system", "mynodecp"})
+	viper.SetDefault("auth.invite_ttl", "168h")
+	viper.SetDefault("auth.email_change_url", "https://localhost/account/email/confirm")
+	viper.SetDefault("auth.email_change_ttl", "24h")
+	viper.SetDefault("auth.onboarding_steps", []string{})
+	viper.SetDefault("auth.onboarding_domain", "")
+
+	// Status page defaults
+	viper.SetDefault("status.enabled", false)
+	viper.SetDefault("status.cache_ttl", "30s")
+	viper.SetDefault("status.stale_after", "5m")
+	viper.SetDefault("status.rate_limit", 30)
+
+	// Abuse report defaults
+	viper.SetDefault("abuse.public_form", false)
+	viper.SetDefault("abuse.rate_limit", 5)
+	viper.SetDefault("abuse.categories", []string{"spam", "phishing", "malware", "copyright", "other"})
+	viper.SetDefault("abuse.notify_admins", true)
 
 	// Security defaults
 	viper.SetDefault("security.rate_limit_enabled", true)
 	viper.SetDefault("security.rate_limit_requests", 100)
 	viper.SetDefault("security.rate_limit_window", "1m")
+	viper.SetDefault("security.rate_limit_sync_interval", "1s")
+	viper.SetDefault("security.rate_limit_fail_closed", false)
+	viper.SetDefault("security.rate_limit_warn_percent", 20)
 	viper.SetDefault("security.cors_enabled", true)
-	viper.SetDefault("security.cors_allowed_origins", []string{"http://localhost:3000", "http://localhost:8080"})
+	viper.SetDefault("security.cors_allowed_origins", []string{"http://localhost:3000", "http://localhost:8080", "https://mynodecp.com"})
+	viper.SetDefault("security.cors_allowed_methods", []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"})
+	viper.SetDefault("security.cors_allowed_headers", []string{"Content-Type", "Content-Length", "Accept-Encoding", "X-CSRF-Token", "Authorization", "Accept", "Origin", "Cache-Control", "X-Requested-With", "X-Dry-Run", "If-Match", "If-None-Match", "Upload-Offset"})
+	viper.SetDefault("security.cors_allow_credentials", true)
+	viper.SetDefault("security.cors_max_age", "12h")
+	viper.SetDefault("security.csp_enabled", true)
+	viper.SetDefault("security.csp_policy", "default-src 'self'; script-src 'self' 'unsafe-inline'; style-src 'self' 'unsafe-inline'; img-src 'self' data: https:; font-src 'self' data:")
+	viper.SetDefault("security.csp_report_only", false)
+	viper.SetDefault("security.csp_report_uri", "/csp-report")
 	viper.SetDefault("security.csrf_enabled", true)
 	viper.SetDefault("security.hsts_enabled", true)
 	viper.SetDefault("security.hsts_max_age", 31536000)
 	viper.SetDefault("security.content_type_nosniff", true)
 	viper.SetDefault("security.x_frame_options", "DENY")
 	viper.SetDefault("security.xss_protection", true)
+	viper.SetDefault("security.encryption_keys", map[string]string{})
+	viper.SetDefault("security.encryption_key_version", "")
+	viper.SetDefault("security.outbound_proxy", "")
+	viper.SetDefault("security.outbound_allowed_hosts", []string{})
 
 	// Logging defaults
+	viper.SetDefault("tracing.endpoint", "")
+	viper.SetDefault("tracing.insecure", false)
+	viper.SetDefault("tracing.sample_rate", 1.0)
+
 	viper.SetDefault("logging.level", "info")
 	viper.SetDefault("logging.format", "json")
 	viper.SetDefault("logging.output", "stdout")
@@ -196,6 +707,206 @@ func setDefaults() {
 	viper.SetDefault("logging.max_backups", 3)
 	viper.SetDefault("logging.max_age", 28)
 	viper.SetDefault("logging.compress", true)
+	viper.SetDefault("logging.request_sample_rate", 1.0)
+	viper.SetDefault("logging.request_headers", []string{})
+	viper.SetDefault("logging.redact_fields", []string{"Authorization", "Cookie", "X-API-Key", "password", "secret", "token"})
+
+	// Hosting defaults
+	viper.SetDefault("hosting.vhost_dir", "/etc/nginx/sites-enabled")
+	viper.SetDefault("hosting.ssl_dir", "/etc/mynodecp/ssl")
+	viper.SetDefault("hosting.php_fpm_socket_dir", "/run/php")
+	viper.SetDefault("hosting.php_handlers", []string{"fpm"})
+	viper.SetDefault("hosting.php_pool_dir", "/etc/php/{version}/fpm/pool.d")
+	viper.SetDefault("hosting.php_cgi_dir", "/etc/mynodecp/php-cgi")
+	viper.SetDefault("hosting.php_opcache_reset_command", "cachetool opcache:reset --fcgi={socket}")
+	viper.SetDefault("hosting.php_mods_dir", "/etc/php/{version}/mods-available")
+	viper.SetDefault("hosting.php_deprecation_notify", false)
+	viper.SetDefault("hosting.zone_dir", "/etc/bind/zones")
+	viper.SetDefault("hosting.log_dir", "/var/log/nginx/domains")
+	viper.SetDefault("hosting.backup_dir", "/var/backups/mynodecp")
+	viper.SetDefault("hosting.home_dir", "/home")
+	viper.SetDefault("hosting.htpasswd_dir", "/etc/nginx/htpasswd")
+	viper.SetDefault("hosting.ftp_users_file", "/etc/proftpd/ftpd.passwd")
+	viper.SetDefault("hosting.ftp_read_only_file", "/etc/proftpd/conf.d/mynodecp-readonly.conf")
+	viper.SetDefault("hosting.ftp_uid", 33)
+	viper.SetDefault("hosting.ftp_gid", 33)
+	viper.SetDefault("hosting.upload_dir", "/var/lib/mynodecp/uploads")
+	viper.SetDefault("hosting.upload_ttl", "24h")
+	viper.SetDefault("hosting.upload_max_size", int64(0))
+	viper.SetDefault("hosting.dry_run", false)
+	viper.SetDefault("hosting.default_disk_quota", int64(1<<30))
+	viper.SetDefault("hosting.default_bandwidth_quota", int64(10<<30))
+	viper.SetDefault("hosting.server_disk_capacity", int64(0))
+	viper.SetDefault("hosting.server_bandwidth_capacity", int64(0))
+	viper.SetDefault("hosting.overcommit_warn_ratio", 1.0)
+	viper.SetDefault("hosting.overcommit_max_ratio", 1.5)
+	viper.SetDefault("hosting.default_max_subdomains", 25)
+	viper.SetDefault("hosting.reserved_subdomains", []string{"www", "mail", "ftp", "webmail", "smtp", "imap", "pop", "ns1", "ns2", "autoconfig", "autodiscover"})
+	viper.SetDefault("hosting.subdomain_dns_cleanup", "all")
+	viper.SetDefault("hosting.default_mailboxes", []string{})
+	viper.SetDefault("hosting.default_mail_aliases", []string{})
+	viper.SetDefault("hosting.default_mailbox_quota_mb", 1024)
+	viper.SetDefault("hosting.landing_page", "default")
+	viper.SetDefault("hosting.landing_page_template", "")
+	viper.SetDefault("hosting.landing_page_brand", "MyNodeCP")
+	viper.SetDefault("hosting.landing_page_remove", true)
+	viper.SetDefault("hosting.suspended_page_dir", "/var/lib/mynodecp/suspended")
+	viper.SetDefault("hosting.dns_record_limits", map[string]int{"NS": 8, "MX": 10, "CNAME": 100, "TXT": 50, "SRV": 50, "CAA": 10})
+	viper.SetDefault("hosting.dns_max_records", 500)
+	viper.SetDefault("hosting.dns_min_ttl", 60)
+	viper.SetDefault("hosting.dns_max_ttl", 604800)
+	viper.SetDefault("hosting.dns_default_ttl", 3600)
+	viper.SetDefault("hosting.dns_soa_contact", "")
+	viper.SetDefault("hosting.dns_soa_refresh", 7200)
+	viper.SetDefault("hosting.dns_soa_retry", 3600)
+	viper.SetDefault("hosting.dns_soa_expire", 1209600)
+	viper.SetDefault("hosting.dns_soa_minimum", 300)
+	viper.SetDefault("hosting.quota_alert_thresholds", []int{80, 95, 100})
+	viper.SetDefault("hosting.quota_check_interval", "1h")
+	viper.SetDefault("hosting.traffic_collect_interval", "5m")
+	viper.SetDefault("hosting.access_log_format", "combined")
+	viper.SetDefault("hosting.usage_snapshot_interval", "1h")
+	viper.SetDefault("hosting.quota_enforce", false)
+	viper.SetDefault("hosting.database_quota_mb", 0)
+	viper.SetDefault("hosting.user_database_quota_mb", 0)
+	viper.SetDefault("hosting.db_admin_url", "")
+	viper.SetDefault("hosting.db_admin_secret", "")
+	viper.SetDefault("hosting.db_admin_token_ttl", "60s")
+	viper.SetDefault("hosting.nameservers", []string{})
+	viper.SetDefault("hosting.server_ipv4", "") // Required; there is no address that works everywhere
+	viper.SetDefault("hosting.server_ipv6", "")
+	viper.SetDefault("hosting.provisioning_db_addr", "localhost:3306")
+	viper.SetDefault("hosting.provisioning_db_user", "")
+	viper.SetDefault("hosting.provisioning_db_password", "")
+	viper.SetDefault("hosting.provisioning_db_max_open_conns", 5)
+	viper.SetDefault("hosting.provisioning_db_max_idle_conns", 2)
+	viper.SetDefault("hosting.provisioning_db_conn_max_lifetime", "30m")
+	viper.SetDefault("hosting.provisioning_db_conn_max_idle_time", "5m")
+	viper.SetDefault("hosting.provisioning_db_dial_timeout", "5s")
+	viper.SetDefault("hosting.provisioning_db_query_timeout", "30s")
+	viper.SetDefault("hosting.provisioning_db_health_interval", "1m")
+	viper.SetDefault("hosting.nameserver_api_url", "")
+	viper.SetDefault("hosting.mta_check_command", "postfix check")
+	viper.SetDefault("hosting.acme_directory_url", "https://acme-v02.api.letsencrypt.org/directory")
+	viper.SetDefault("hosting.acme_account_key_file", "/var/lib/mynodecp/acme/account.key")
+	viper.SetDefault("hosting.acme_email", "")
+	viper.SetDefault("hosting.acme_dns_propagation", "10s")
+	viper.SetDefault("hosting.auto_ssl", false)
+	viper.SetDefault("hosting.auto_ssl_interval", "5m")
+	viper.SetDefault("hosting.auto_ssl_backoff", "15m")
+	viper.SetDefault("hosting.auto_ssl_max_attempts", 10)
+	viper.SetDefault("hosting.watchdog_services", []string{})
+	viper.SetDefault("hosting.watchdog_interval", "1m")
+	viper.SetDefault("hosting.watchdog_backoff", "1m")
+	viper.SetDefault("hosting.watchdog_max_attempts", 3)
+	viper.SetDefault("hosting.lock_ttl", "30s")
+	viper.SetDefault("hosting.lock_wait", "0")
+
+	// Mail defaults
+	viper.SetDefault("mail.imap_addr", "")
+	viper.SetDefault("mail.client_hostname", "")
+	viper.SetDefault("mail.client_imap_port", 993)
+	viper.SetDefault("mail.client_pop3_port", 995)
+	viper.SetDefault("mail.client_smtp_port", 587)
+	viper.SetDefault("mail.discovery_records", []string{"autoconfig", "autodiscover", "imap", "submission"})
+	viper.SetDefault("mail.discovery_host", "")
+	viper.SetDefault("mail.send_limit_account", 500)
+	viper.SetDefault("mail.send_limit_domain", 2000)
+	viper.SetDefault("mail.send_limit_window", "1h")
+	viper.SetDefault("mail.send_hook_secret", "")
+	viper.SetDefault("mail.smtp_host", "localhost")
+	viper.SetDefault("mail.smtp_port", 587)
+	viper.SetDefault("mail.smtp_username", "")
+	viper.SetDefault("mail.smtp_password", "")
+	viper.SetDefault("mail.from", "MyNodeCP <noreply@localhost>")
+	viper.SetDefault("mail.dry_run", false)
+	viper.SetDefault("mail.max_attempts", 5)
+	viper.SetDefault("mail.retry_interval", "1m")
+	viper.SetDefault("mail.poll_interval", "10s")
+	viper.SetDefault("mail.send_timeout", "1m")
+	viper.SetDefault("mail.sending_lease", "10m")
+	viper.SetDefault("mail.digest_interval", "24h")
+	viper.SetDefault("mail.dkim_selectors", []string{"default", "mail", "dkim"})
+	viper.SetDefault("mail.dnsbls", []string{"zen.spamhaus.org", "bl.spamcop.net", "b.barracudacentral.org"})
+	viper.SetDefault("mail.deliverability_mailbox", "")
+	viper.SetDefault("mail.deliverability_test_limit", 5)
+
+	// Cache defaults
+	viper.SetDefault("cache.enabled", true)
+	viper.SetDefault("cache.ttl", "5m")
+
+	// Jobs defaults
+	viper.SetDefault("jobs.cleanup_interval", "1h")
+	viper.SetDefault("jobs.traffic_retention", "9504h")
+	viper.SetDefault("jobs.session_retention", "0")
+	viper.SetDefault("jobs.metric_retention", "0")
+	viper.SetDefault("jobs.audit_retention", "0")
+	viper.SetDefault("jobs.security_event_retention", "0")
+	viper.SetDefault("jobs.backup_retention", "0")
+	viper.SetDefault("jobs.usage_retention", "0")
+	viper.SetDefault("jobs.unverified_retention", "0")
+	viper.SetDefault("jobs.unverified_warning", "168h")
+	viper.SetDefault("jobs.inactive_after", "8760h")
+	viper.SetDefault("jobs.overdue_intervals", 3)
+	viper.SetDefault("jobs.metrics_token", "")
+}
+
+// mailLocalPartPattern matches the local parts accepted for default mail addresses
+var mailLocalPartPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9._+-]{0,62}[a-z0-9])?$`)
+
+// phpVersionPattern matches PHP versions as domains select them, such as 8.2
+var phpVersionPattern = regexp.MustCompile(`^\d+\.\d+$`)
+
+// unitNamePattern matches names of systemd units
+var unitNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9@._:-]*$`)
+
+// logFormatPattern matches names of nginx log formats
+var logFormatPattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// abuseCategoryPattern matches abuse report categories
+var abuseCategoryPattern = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// validateCORS refuses allowing every origin with credentials, which would let any site make
+// authenticated requests on behalf of a logged-in user
+func validateCORS(security SecurityConfig) error {
+	if !security.CORSEnabled || !security.CORSAllowCredentials {
+		return nil
+	}
+	for _, origin := range security.CORSAllowedOrigins {
+		if origin == "*" {
+			return fmt.Errorf("cors_allowed_origins cannot contain \"*\" while cors_allow_credentials is set")
+		}
+	}
+	return nil
+}
+
+// validateTrustedProxies requires every trusted proxy to be an address or a CIDR range
+func validateTrustedProxies(proxies []string) error {
+	for _, proxy := range proxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			return fmt.Errorf("server.trusted_proxies must be addresses or CIDR ranges: %q", proxy)
+		}
+	}
+	return nil
+}
+
+// validateServerAddresses requires the public IPv4 address used in default DNS records, and
+// an IPv6 address when one is set. Loopback and unspecified addresses would publish records no
+// one else can reach, so they are refused.
+func validateServerAddresses(hosting HostingConfig) error {
+	if hosting.ServerIPv4 == "" {
+		return fmt.Errorf("hosting.server_ipv4 is required: set it to the public IPv4 address of this server")
+	}
+	if ip := net.ParseIP(hosting.ServerIPv4); ip == nil || ip.To4() == nil || ip.IsLoopback() || ip.IsUnspecified() {
+		return fmt.Errorf("invalid server IPv4 address: %q", hosting.ServerIPv4)
+	}
+
+	if hosting.ServerIPv6 != "" {
+		if ip := net.ParseIP(hosting.ServerIPv6); ip == nil || ip.To4() != nil || ip.IsLoopback() || ip.IsUnspecified() {
+			return fmt.Errorf("invalid server IPv6 address: %q", hosting.ServerIPv6)
+		}
+	}
+	return nil
 }
 
 // validate validates the configuration
@@ -208,10 +919,393 @@ func validate(config *Config) error {
 		return fmt.Errorf("invalid gRPC port: %d", config.Server.GRPCPort)
 	}
 
+	if err := validateTrustedProxies(config.Server.TrustedProxies); err != nil {
+		return err
+	}
+
+	if err := validateCORS(config.Security); err != nil {
+		return err
+	}
+
+	if err := validateServerAddresses(config.Hosting); err != nil {
+		return err
+	}
+
+	if len(config.Hosting.PHPHandlers) == 0 {
+		return fmt.Errorf("at least one PHP handler must be installed")
+	}
+	for _, handler := range config.Hosting.PHPHandlers {
+		if handler != "fpm" && handler != "cgi" {
+			return fmt.Errorf("unknown PHP handler %q: must be fpm or cgi", handler)
+		}
+	}
+	deprecated := make(map[string]bool, len(config.Hosting.PHPDeprecations))
+	for _, deprecation := range config.Hosting.PHPDeprecations {
+		if !phpVersionPattern.MatchString(deprecation.Version) {
+			return fmt.Errorf("invalid deprecated PHP version %q", deprecation.Version)
+		}
+		if deprecated[deprecation.Version] {
+			return fmt.Errorf("PHP %s is deprecated more than once", deprecation.Version)
+		}
+		deprecated[deprecation.Version] = true
+		if _, err := time.Parse("2006-01-02", deprecation.RemovedAt); err != nil {
+			return fmt.Errorf("invalid removal date %q of PHP %s: expected YYYY-MM-DD", deprecation.RemovedAt, deprecation.Version)
+		}
+		if deprecation.Replacement != "" && !phpVersionPattern.MatchString(deprecation.Replacement) {
+			return fmt.Errorf("invalid replacement %q of PHP %s", deprecation.Replacement, deprecation.Version)
+		}
+	}
+
+	if config.Hosting.FTPUID <= 0 || config.Hosting.FTPGID <= 0 {
+		return fmt.Errorf("FTP logins must run as a non-root user and group")
+	}
+
+	if len(config.Hosting.Nameservers) == 1 {
+		return fmt.Errorf("at least two nameservers are required when hosting.nameservers is set")
+	}
+	for _, nameserver := range config.Hosting.Nameservers {
+		if net.ParseIP(nameserver) != nil || !strings.Contains(strings.Trim(nameserver, "."), ".") {
+			return fmt.Errorf("nameserver must be a fully qualified hostname: %q", nameserver)
+		}
+	}
+
+	// Both run as scheduled jobs, which only run on demand with a non-positive interval
+	if config.Mail.PollInterval <= 0 {
+		return fmt.Errorf("mail.poll_interval must be positive")
+	}
+	if config.Security.RateLimitSyncInterval <= 0 {
+		return fmt.Errorf("security.rate_limit_sync_interval must be positive")
+	}
+	if config.Mail.SendTimeout <= 0 {
+		return fmt.Errorf("mail.send_timeout must be positive")
+	}
+	if config.Mail.SendingLease <= config.Mail.SendTimeout {
+		return fmt.Errorf("mail.sending_lease must be longer than mail.send_timeout")
+	}
+	if config.Mail.DigestInterval < time.Minute {
+		return fmt.Errorf("mail.digest_interval must be at least a minute")
+	}
+	if config.Mail.DeliverabilityTestLimit < 1 {
+		return fmt.Errorf("mail.deliverability_test_limit must be at least 1")
+	}
+	if config.Mail.DeliverabilityMailbox != "" {
+		if _, err := mail.ParseAddress(config.Mail.DeliverabilityMailbox); err != nil {
+			return fmt.Errorf("invalid mail.deliverability_mailbox: %w", err)
+		}
+	}
+
+	discoveryRecords := map[string]bool{}
+	for _, record := range config.Mail.DiscoveryRecords {
+		switch record {
+		case "autoconfig", "autodiscover", "imap", "submission":
+		default:
+			return fmt.Errorf("unknown mail discovery record %q: must be autoconfig, autodiscover, imap or submission", record)
+		}
+		if discoveryRecords[record] {
+			return fmt.Errorf("mail discovery record %q is listed more than once", record)
+		}
+		discoveryRecords[record] = true
+	}
+	if discoveryRecords["imap"] && (config.Mail.ClientIMAPPort <= 0 || config.Mail.ClientIMAPPort > 65535) {
+		return fmt.Errorf("mail.client_imap_port must be a valid port for the imap discovery record")
+	}
+	if discoveryRecords["submission"] && (config.Mail.ClientSMTPPort <= 0 || config.Mail.ClientSMTPPort > 65535) {
+		return fmt.Errorf("mail.client_smtp_port must be a valid port for the submission discovery record")
+	}
+	if host := config.Mail.DiscoveryHost; host != "" && (net.ParseIP(host) != nil || !strings.Contains(strings.Trim(host, "."), ".")) {
+		return fmt.Errorf("mail.discovery_host must be a fully qualified hostname: %q", host)
+	}
+
+	if config.Mail.SendLimitWindow < time.Second {
+		return fmt.Errorf("mail send limit window must be at least one second")
+	}
+
+	if config.Hosting.UploadDir == "" || config.Hosting.UploadTTL <= 0 || config.Hosting.UploadMaxSize < 0 {
+		return fmt.Errorf("hosting.upload_dir and a positive upload_ttl are required, and upload_max_size must not be negative")
+	}
+
+	if config.Hosting.ACMEDirectoryURL != "" && config.Hosting.ACMEAccountKeyFile == "" {
+		return fmt.Errorf("hosting.acme_account_key_file is required with an ACME directory")
+	}
+
+	if config.Hosting.ACMEDNSPropagation < 0 {
+		return fmt.Errorf("hosting.acme_dns_propagation must not be negative")
+	}
+
+	if config.Hosting.AutoSSLInterval <= 0 || config.Hosting.AutoSSLBackoff < 0 || config.Hosting.AutoSSLMaxAttempts < 1 {
+		return fmt.Errorf("hosting.auto_ssl_interval must be positive, auto_ssl_backoff not negative and auto_ssl_max_attempts at least 1")
+	}
+
+	if len(config.Hosting.WatchdogServices) > 0 {
+		for _, unit := range config.Hosting.WatchdogServices {
+			if !unitNamePattern.MatchString(unit) {
+				return fmt.Errorf("invalid systemd unit in hosting.watchdog_services: %q", unit)
+			}
+		}
+		if config.Hosting.WatchdogInterval <= 0 || config.Hosting.WatchdogBackoff < 0 || config.Hosting.WatchdogMaxAttempts < 1 {
+			return fmt.Errorf("hosting.watchdog_interval must be positive, watchdog_backoff not negative and watchdog_max_attempts at least 1")
+		}
+	}
+
+	if config.Hosting.LockTTL <= 0 || config.Hosting.LockWait < 0 {
+		return fmt.Errorf("hosting.lock_ttl must be positive and hosting.lock_wait not negative")
+	}
+
+	if config.Hosting.UsageSnapshotInterval < 0 {
+		return fmt.Errorf("hosting.usage_snapshot_interval must not be negative (0 disables usage snapshots)")
+	}
+
+	if config.Hosting.DefaultDiskQuota <= 0 || config.Hosting.DefaultBandwidthQuota <= 0 {
+		return fmt.Errorf("default domain quotas must be positive")
+	}
+
+	if config.Jobs.OverdueIntervals < 2 {
+		return fmt.Errorf("jobs.overdue_intervals must be at least 2")
+	}
+
+	if config.Jobs.SessionRetention < 0 || config.Jobs.MetricRetention < 0 || config.Jobs.AuditRetention < 0 ||
+		config.Jobs.SecurityEventRetention < 0 || config.Jobs.BackupRetention < 0 || config.Jobs.UsageRetention < 0 {
+		return fmt.Errorf("jobs retentions must not be negative (0 keeps records forever)")
+	}
+
+	if config.Jobs.UnverifiedRetention > 0 && config.Jobs.UnverifiedWarning >= config.Jobs.UnverifiedRetention {
+		return fmt.Errorf("unverified account warning must come before the retention ends")
+	}
+
+	if config.Hosting.ServerDiskCapacity < 0 || config.Hosting.ServerBandwidthCapacity < 0 {
+		return fmt.Errorf("server capacities must not be negative")
+	}
+
+	if config.Hosting.OvercommitWarnRatio < 0 || config.Hosting.OvercommitMaxRatio < 0 {
+		return fmt.Errorf("overcommit ratios must not be negative")
+	}
+
+	if config.Hosting.OvercommitMaxRatio > 0 && config.Hosting.OvercommitWarnRatio > config.Hosting.OvercommitMaxRatio {
+		return fmt.Errorf("overcommit warning ratio must not exceed the maximum ratio")
+	}
+
+	if config.Hosting.DefaultMaxSubdomains < 0 {
+		return fmt.Errorf("default max subdomains must not be negative")
+	}
+
+	switch config.Hosting.SubdomainDNSCleanup {
+	case "all", "created", "off":
+	default:
+		return fmt.Errorf("invalid subdomain DNS cleanup: %q", config.Hosting.SubdomainDNSCleanup)
+	}
+
+	if config.Hosting.DefaultMailboxQuotaMB <= 0 {
+		return fmt.Errorf("default mailbox quota must be positive")
+	}
+
+	if !logFormatPattern.MatchString(config.Hosting.AccessLogFormat) {
+		return fmt.Errorf("invalid access log format %q: must be the name of an nginx log_format", config.Hosting.AccessLogFormat)
+	}
+
+	switch config.Hosting.LandingPage {
+	case "default", "coming_soon", "none":
+	default:
+		return fmt.Errorf("unknown landing page %q: must be default, coming_soon or none", config.Hosting.LandingPage)
+	}
+
+	if !filepath.IsAbs(config.Hosting.SuspendedPageDir) {
+		return fmt.Errorf("hosting.suspended_page_dir must be an absolute path")
+	}
+
+	defaultAddresses := map[string]bool{}
+	for _, name := range append(append([]string{}, config.Hosting.DefaultMailboxes...), config.Hosting.DefaultMailAliases...) {
+		if !mailLocalPartPattern.MatchString(name) {
+			return fmt.Errorf("invalid default mail address %q: use a lower-case local part such as postmaster", name)
+		}
+		if defaultAddresses[name] {
+			return fmt.Errorf("default mail address %q is listed more than once", name)
+		}
+		defaultAddresses[name] = true
+	}
+
+	for recordType, limit := range config.Hosting.DNSRecordLimits {
+		if limit < 0 {
+			return fmt.Errorf("DNS record limit for %s must not be negative", recordType)
+		}
+	}
+
+	if config.Hosting.DNSMaxRecords < 0 {
+		return fmt.Errorf("DNS max records must not be negative")
+	}
+
+	if config.Hosting.DNSMinTTL <= 0 || config.Hosting.DNSMaxTTL < config.Hosting.DNSMinTTL {
+		return fmt.Errorf("DNS TTL bounds must be positive with dns_min_ttl <= dns_max_ttl")
+	}
+
+	if config.Hosting.DNSDefaultTTL < config.Hosting.DNSMinTTL || config.Hosting.DNSDefaultTTL > config.Hosting.DNSMaxTTL {
+		return fmt.Errorf("hosting.dns_default_ttl must be within dns_min_ttl and dns_max_ttl")
+	}
+
+	if config.Hosting.DNSSOARefresh <= 0 || config.Hosting.DNSSOARetry <= 0 || config.Hosting.DNSSOAExpire <= 0 || config.Hosting.DNSSOAMinimum <= 0 {
+		return fmt.Errorf("DNS SOA refresh, retry, expire and minimum must be positive")
+	}
+
+	if contact := config.Hosting.DNSSOAContact; contact != "" && strings.Count(contact, "@") != 1 {
+		return fmt.Errorf("hosting.dns_soa_contact must be an email address")
+	}
+
+	for _, threshold := range config.Hosting.QuotaAlertThresholds {
+		if threshold <= 0 || threshold > 100 {
+			return fmt.Errorf("invalid quota alert threshold: %d", threshold)
+		}
+	}
+	if config.Hosting.DatabaseQuotaMB < 0 || config.Hosting.UserDatabaseQuotaMB < 0 {
+		return fmt.Errorf("hosting.database_quota_mb and user_database_quota_mb must not be negative")
+	}
+
+	if config.Hosting.ProvisioningDBUser != "" {
+		if config.Hosting.ProvisioningDBAddr == "" {
+			return fmt.Errorf("provisioning_db_addr is required when provisioning_db_user is set")
+		}
+		if config.Hosting.ProvisioningDBMaxOpenConns <= 0 || config.Hosting.ProvisioningDBMaxIdleConns < 0 ||
+			config.Hosting.ProvisioningDBMaxIdleConns > config.Hosting.ProvisioningDBMaxOpenConns {
+			return fmt.Errorf("provisioning database pool needs max_open_conns > 0 and 0 <= max_idle_conns <= max_open_conns")
+		}
+		if config.Hosting.ProvisioningDBDialTimeout <= 0 || config.Hosting.ProvisioningDBQueryTimeout <= 0 ||
+			config.Hosting.ProvisioningDBHealthInterval <= 0 {
+			return fmt.Errorf("provisioning database dial timeout, query timeout and health interval must be positive")
+		}
+	}
+
+	if config.Hosting.DBAdminURL != "" && config.Hosting.DBAdminSecret == "" {
+		return fmt.Errorf("database admin SSO secret is required when db_admin_url is set")
+	}
+	if config.Hosting.DBAdminTokenTTL <= 0 || config.Hosting.DBAdminTokenTTL > 5*time.Minute {
+		return fmt.Errorf("hosting.db_admin_token_ttl must be positive and at most 5m")
+	}
+
+	if config.Auth.PasswordHistory < 0 {
+		return fmt.Errorf("auth.password_history must not be negative")
+	}
+	if config.Auth.PasswordMaxAge < 0 || config.Auth.PasswordExpiryNotice < 0 {
+		return fmt.Errorf("auth.password_max_age and auth.password_expiry_notice must not be negative")
+	}
+
+	switch config.Auth.SessionBinding {
+	case "off", "user_agent", "ip", "subnet":
+	default:
+		return fmt.Errorf("invalid session binding: %q", config.Auth.SessionBinding)
+	}
+
+	if config.Auth.BanThreshold < 0 {
+		return fmt.Errorf("auth.ban_threshold must not be negative")
+	}
+	if config.Auth.BanThreshold > 0 && (config.Auth.BanWindow <= 0 || config.Auth.BanDuration <= 0) {
+		return fmt.Errorf("auth.ban_window and ban_duration must be positive while bans are enabled")
+	}
+
+	switch config.Auth.RegistrationMode {
+	case "open", "invite", "closed":
+	default:
+		return fmt.Errorf("invalid registration mode: %q", config.Auth.RegistrationMode)
+	}
+
+	if link, err := url.Parse(config.Auth.EmailChangeURL); err != nil || (link.Scheme != "http" && link.Scheme != "https") || link.Host == "" {
+		return fmt.Errorf("email change URL must be an absolute http(s) URL: %q", config.Auth.EmailChangeURL)
+	}
+	if config.Auth.EmailChangeTTL <= 0 {
+		return fmt.Errorf("email change TTL must be positive")
+	}
+
+	onboardingSteps := make(map[string]bool)
+	for _, step := range config.Auth.OnboardingSteps {
+		switch step {
+		case "welcome_email", "starter_domain":
+		case "default_database":
+			if !onboardingSteps["starter_domain"] {
+				return fmt.Errorf("onboarding step default_database must come after starter_domain")
+			}
+		default:
+			return fmt.Errorf("invalid onboarding step: %q", step)
+		}
+		if onboardingSteps[step] {
+			return fmt.Errorf("duplicate onboarding step: %q", step)
+		}
+		onboardingSteps[step] = true
+	}
+	if onboardingSteps["starter_domain"] && !strings.Contains(config.Auth.OnboardingDomain, "{username}") {
+		return fmt.Errorf("onboarding domain must contain {username} when the starter_domain step is enabled")
+	}
+
+	twoFactorMethods := make(map[string]bool)
+	for _, method := range config.Auth.TwoFactorMethods {
+		if method != "totp" && method != "email" && method != "webauthn" {
+			return fmt.Errorf("unknown two-factor method %q: must be totp, email or webauthn", method)
+		}
+		twoFactorMethods[method] = true
+	}
+	if twoFactorMethods["email"] && config.Auth.EmailOTPTTL <= 0 {
+		return fmt.Errorf("email OTP TTL must be positive")
+	}
+	if twoFactorMethods["webauthn"] {
+		if config.Auth.WebAuthnRPID == "" || len(config.Auth.WebAuthnOrigins) == 0 {
+			return fmt.Errorf("webauthn_rp_id and webauthn_origins are required for the webauthn two-factor method")
+		}
+		for _, origin := range config.Auth.WebAuthnOrigins {
+			if link, err := url.Parse(origin); err != nil || (link.Scheme != "http" && link.Scheme != "https") || link.Host == "" || link.Path != "" {
+				return fmt.Errorf("WebAuthn origin must be a scheme and host, such as https://panel.example.com: %q", origin)
+			}
+		}
+	}
+
+	if config.Status.Enabled {
+		if config.Status.CacheTTL <= 0 || config.Status.StaleAfter <= 0 || config.Status.RateLimit <= 0 {
+			return fmt.Errorf("status cache_ttl, stale_after and rate_limit must be positive")
+		}
+		for _, component := range config.Status.Components {
+			if strings.TrimSpace(component.Name) == "" || len(component.Services) == 0 {
+				return fmt.Errorf("status components need a name and at least one service")
+			}
+		}
+	}
+
+	if len(config.Abuse.Categories) == 0 {
+		return fmt.Errorf("abuse.categories needs at least one category")
+	}
+	for _, category := range config.Abuse.Categories {
+		if !abuseCategoryPattern.MatchString(category) {
+			return fmt.Errorf("invalid abuse category %q: use up to 32 lowercase letters, digits and underscores", category)
+		}
+	}
+	if config.Abuse.PublicForm && config.Abuse.RateLimit <= 0 {
+		return fmt.Errorf("abuse.rate_limit must be positive with the public form")
+	}
+
+	if config.Logging.RequestSampleRate < 0 || config.Logging.RequestSampleRate > 1 {
+		return fmt.Errorf("logging.request_sample_rate must be between 0 and 1")
+	}
+
+	if config.Tracing.SampleRate < 0 || config.Tracing.SampleRate > 1 {
+		return fmt.Errorf("tracing.sample_rate must be between 0 and 1")
+	}
+
 	if config.Database.Host == "" {
 		return fmt.Errorf("database host is required")
 	}
 
+	if config.Security.RateLimitWarnPercent < 0 || config.Security.RateLimitWarnPercent > 100 {
+		return fmt.Errorf("security.rate_limit_warn_percent must be between 0 and 100")
+	}
+	if len(config.Security.EncryptionKeys) > 0 && config.Security.EncryptionKeyVersion == "" {
+		return fmt.Errorf("security.encryption_key_version must name one of the encryption keys")
+	}
+	if config.Security.EncryptionKeyVersion != "" {
+		if _, err := secret.NewKeyring(config.Security.EncryptionKeys, config.Security.EncryptionKeyVersion); err != nil {
+			return fmt.Errorf("invalid encryption keys: %w", err)
+		}
+	}
+	if config.Security.EncryptionKeyVersion == "" && config.Server.Environment == "production" {
+		return fmt.Errorf("an encryption key for secrets must be set in production")
+	}
+	if _, err := egress.New(config.Security.OutboundProxy, config.Security.OutboundAllowedHosts); err != nil {
+		return fmt.Errorf("invalid security outbound settings: %w", err)
+	}
+
 	if config.Auth.JWTSecret == "" || config.Auth.JWTSecret == "your-super-secret-jwt-key-change-this-in-production" {
 		if config.Server.Environment == "production" {
 			return fmt.Errorf("JWT secret must be set in production")
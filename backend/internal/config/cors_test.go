@@ -0,0 +1,24 @@
+package config
+
+import "testing"
+
+func TestValidateCORS(t *testing.T) {
+	tests := []struct {
+		name     string
+		security SecurityConfig
+		wantErr  bool
+	}{
+		{"listed origins with credentials", SecurityConfig{CORSEnabled: true, CORSAllowedOrigins: []string{"https://mynodecp.com"}, CORSAllowCredentials: true}, false},
+		{"wildcard without credentials", SecurityConfig{CORSEnabled: true, CORSAllowedOrigins: []string{"*"}}, false},
+		{"wildcard with credentials", SecurityConfig{CORSEnabled: true, CORSAllowedOrigins: []string{"https://mynodecp.com", "*"}, CORSAllowCredentials: true}, true},
+		{"wildcard with CORS disabled", SecurityConfig{CORSAllowedOrigins: []string{"*"}, CORSAllowCredentials: true}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateCORS(tt.security); (err != nil) != tt.wantErr {
+				t.Errorf("validateCORS() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestUnverifiedAccountDeletionIsOffByDefault(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	setDefaults()
+
+	if retention := viper.GetDuration("jobs.unverified_retention"); retention != 0 {
+		t.Errorf("jobs.unverified_retention defaults to %v, want 0", retention)
+	}
+}
+
+func TestRetentionPoliciesKeepForeverByDefault(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	setDefaults()
+
+	for _, key := range []string{"session_retention", "metric_retention", "audit_retention", "security_event_retention", "backup_retention"} {
+		if retention := viper.GetDuration("jobs." + key); retention != 0 {
+			t.Errorf("jobs.%s defaults to %v, want 0", key, retention)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestRequestLoggingDefaults(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	setDefaults()
+
+	if rate := viper.GetFloat64("logging.request_sample_rate"); rate != 1 {
+		t.Errorf("logging.request_sample_rate defaults to %v, want every request logged", rate)
+	}
+	redacted := make(map[string]bool)
+	for _, field := range viper.GetStringSlice("logging.redact_fields") {
+		redacted[field] = true
+	}
+	for _, field := range []string{"Authorization", "X-API-Key", "password"} {
+		if !redacted[field] {
+			t.Errorf("logging.redact_fields lacks %s by default", field)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package config
+
+import "testing"
+
+func TestValidateTrustedProxies(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxies []string
+		wantErr bool
+	}{
+		{"none", nil, false},
+		{"addresses and ranges", []string{"10.0.0.1", "192.168.0.0/16", "2001:db8::/32"}, false},
+		{"hostname", []string{"proxy.example.com"}, true},
+		{"bad range", []string{"10.0.0.0/33"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateTrustedProxies(tt.proxies); (err != nil) != tt.wantErr {
+				t.Errorf("validateTrustedProxies() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
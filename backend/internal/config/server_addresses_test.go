@@ -0,0 +1,49 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestValidateServerAddresses(t *testing.T) {
+	tests := []struct {
+		name    string
+		ipv4    string
+		ipv6    string
+		wantErr bool
+	}{
+		{"public IPv4", "192.0.2.10", "", false},
+		{"both families", "192.0.2.10", "2001:db8::10", false},
+		{"missing IPv4", "", "", true},
+		{"missing IPv4 with IPv6", "", "2001:db8::10", true},
+		{"malformed IPv4", "192.0.2", "", true},
+		{"IPv6 as IPv4", "2001:db8::10", "", true},
+		{"IPv4 loopback", "127.0.0.1", "", true},
+		{"other IPv4 loopback", "127.1.2.3", "", true},
+		{"unspecified IPv4", "0.0.0.0", "", true},
+		{"malformed IPv6", "192.0.2.10", "2001:db8::zz", true},
+		{"IPv4 as IPv6", "192.0.2.10", "192.0.2.11", true},
+		{"IPv6 loopback", "192.0.2.10", "::1", true},
+		{"unspecified IPv6", "192.0.2.10", "::", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateServerAddresses(HostingConfig{ServerIPv4: tt.ipv4, ServerIPv6: tt.ipv6})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateServerAddresses() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServerIPv4HasNoDefault(t *testing.T) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	setDefaults()
+
+	if ip := viper.GetString("hosting.server_ipv4"); ip != "" {
+		t.Errorf("hosting.server_ipv4 defaults to %q, want it left for the admin to set", ip)
+	}
+}
@@ -0,0 +1,365 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// trackedTables are the tables whose changes are recorded in the change log
+var trackedTables = map[string]bool{
+	"users":            true,
+	"roles":            true,
+	"ssh_keys":         true,
+	"domains":          true,
+	"subdomains":       true,
+	"redirects":        true,
+	"dns_records":      true,
+	"dns_templates":    true,
+	"ssl_certificates": true,
+	"email_accounts":   true,
+	"email_aliases":    true,
+	"email_forwarders": true,
+	"ftp_accounts":     true,
+	"databases":        true,
+	"database_users":   true,
+	"cron_jobs":        true,
+	"nodes":            true,
+}
+
+// untrackedColumns change on every write or are implied by the action, and are left out of diffs
+var untrackedColumns = map[string]bool{
+	"created_at": true,
+	"updated_at": true,
+	"deleted_at": true,
+}
+
+// redactedValue replaces the values of secret columns, which models hide with a json:"-" tag
+var redactedValue = json.RawMessage(`"[redacted]"`)
+
+// beforeKey holds the rows an update or delete affects, loaded before it runs
+const beforeKey = "changelog:before"
+
+// changeCapture records creates, updates and deletes of the tracked models through GORM callbacks
+type changeCapture struct {
+	logger *zap.Logger
+}
+
+// snapshot is the state of one row, with each column encoded as JSON
+type snapshot struct {
+	id     string
+	values map[string]json.RawMessage
+}
+
+// RegisterChangeLog adds the callbacks that record changes of the tracked models to the change
+// log. Entries are written on the statement's connection, so they commit or roll back with a
+// surrounding transaction, and are attributed to the user on the statement's context.
+func RegisterChangeLog(db *gorm.DB, logger *zap.Logger) error {
+	c := &changeCapture{logger: logger}
+
+	if err := db.Callback().Create().After("gorm:create").Register("changelog:create", c.afterCreate); err != nil {
+		return fmt.Errorf("failed to register change log callback: %w", err)
+	}
+	if err := db.Callback().Update().Before("gorm:update").Register("changelog:before_update", c.before); err != nil {
+		return fmt.Errorf("failed to register change log callback: %w", err)
+	}
+	if err := db.Callback().Update().After("gorm:update").Register("changelog:update", c.afterUpdate); err != nil {
+		return fmt.Errorf("failed to register change log callback: %w", err)
+	}
+	if err := db.Callback().Delete().Before("gorm:delete").Register("changelog:before_delete", c.before); err != nil {
+		return fmt.Errorf("failed to register change log callback: %w", err)
+	}
+	if err := db.Callback().Delete().After("gorm:delete").Register("changelog:delete", c.afterDelete); err != nil {
+		return fmt.Errorf("failed to register change log callback: %w", err)
+	}
+
+	return nil
+}
+
+func tracked(db *gorm.DB) bool {
+	return db.Error == nil && db.Statement.Schema != nil &&
+		db.Statement.Schema.PrioritizedPrimaryField != nil && trackedTables[db.Statement.Schema.Table]
+}
+
+func (c *changeCapture) afterCreate(db *gorm.DB) {
+	if !tracked(db) {
+		return
+	}
+
+	var rows []snapshot
+	eachStruct(db.Statement.ReflectValue, func(value reflect.Value) {
+		rows = append(rows, takeSnapshot(db.Statement.Context, db.Statement.Schema, value))
+	})
+
+	entries := make([]*models.ChangeLog, 0, len(rows))
+	for _, row := range rows {
+		entries = append(entries, c.entry(db, row.id, "create", diffSnapshots(db.Statement.Schema, nil, row.values)))
+	}
+	c.write(db, entries)
+}
+
+// before loads the rows an update or delete is about to change
+func (c *changeCapture) before(db *gorm.DB) {
+	if !tracked(db) {
+		return
+	}
+
+	query, ok := affectedRows(db)
+	if !ok {
+		return
+	}
+	rows, err := loadSnapshots(query, db.Statement.Schema)
+	if err != nil {
+		c.logger.Error("Failed to load rows for change log", zap.String("table", db.Statement.Schema.Table), zap.Error(err))
+		return
+	}
+	db.InstanceSet(beforeKey, rows)
+}
+
+func (c *changeCapture) afterUpdate(db *gorm.DB) {
+	if !tracked(db) {
+		return
+	}
+	before := beforeSnapshots(db)
+	if len(before) == 0 {
+		return
+	}
+
+	ids := make([]string, len(before))
+	for i, row := range before {
+		ids[i] = row.id
+	}
+	field := db.Statement.Schema.PrioritizedPrimaryField
+	after, err := loadSnapshots(newQuery(db).Unscoped().Where(clause.IN{
+		Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName},
+		Values: toValues(ids),
+	}), db.Statement.Schema)
+	if err != nil {
+		c.logger.Error("Failed to load rows for change log", zap.String("table", db.Statement.Schema.Table), zap.Error(err))
+		return
+	}
+	afterByID := make(map[string]map[string]json.RawMessage, len(after))
+	for _, row := range after {
+		afterByID[row.id] = row.values
+	}
+
+	var entries []*models.ChangeLog
+	for _, row := range before {
+		values, ok := afterByID[row.id]
+		if !ok {
+			continue
+		}
+		if changes := diffSnapshots(db.Statement.Schema, row.values, values); len(changes) > 0 {
+			entries = append(entries, c.entry(db, row.id, "update", changes))
+		}
+	}
+	c.write(db, entries)
+}
+
+func (c *changeCapture) afterDelete(db *gorm.DB) {
+	if !tracked(db) || db.RowsAffected == 0 {
+		return
+	}
+
+	before := beforeSnapshots(db)
+	entries := make([]*models.ChangeLog, 0, len(before))
+	for _, row := range before {
+		entries = append(entries, c.entry(db, row.id, "delete", diffSnapshots(db.Statement.Schema, row.values, nil)))
+	}
+	c.write(db, entries)
+}
+
+func (c *changeCapture) entry(db *gorm.DB, id, action string, changes map[string][2]json.RawMessage) *models.ChangeLog {
+	encoded, err := json.Marshal(changes)
+	if err != nil {
+		encoded = []byte("{}")
+	}
+	return &models.ChangeLog{
+		UserID:     actorFromContext(db.Statement.Context),
+		Resource:   db.Statement.Schema.Table,
+		ResourceID: id,
+		Action:     action,
+		Changes:    string(encoded),
+	}
+}
+
+// write stores entries on the statement's connection. A failure is logged rather than failing
+// the change itself, as with the audit log.
+func (c *changeCapture) write(db *gorm.DB, entries []*models.ChangeLog) {
+	if len(entries) == 0 {
+		return
+	}
+	if err := db.Session(&gorm.Session{NewDB: true}).Create(&entries).Error; err != nil {
+		c.logger.Error("Failed to record change log", zap.String("table", db.Statement.Schema.Table), zap.Error(err))
+	}
+}
+
+// affectedRows builds a query for the rows a statement will change: those matching its WHERE
+// clause and the primary keys of the records it was given. It reports false when the statement
+// has neither, which GORM refuses to run anyway.
+func affectedRows(db *gorm.DB) (*gorm.DB, bool) {
+	query := newQuery(db)
+	if db.Statement.Unscoped {
+		query = query.Unscoped()
+	}
+
+	conditions := false
+	if where, ok := db.Statement.Clauses["WHERE"]; ok {
+		if expression, ok := where.Expression.(clause.Where); ok && len(expression.Exprs) > 0 {
+			query = query.Clauses(expression)
+			conditions = true
+		}
+	}
+
+	field := db.Statement.Schema.PrioritizedPrimaryField
+	var ids []interface{}
+	eachStruct(db.Statement.ReflectValue, func(value reflect.Value) {
+		if id, isZero := field.ValueOf(db.Statement.Context, value); !isZero {
+			ids = append(ids, id)
+		}
+	})
+	if len(ids) > 0 {
+		query = query.Where(clause.IN{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Values: ids})
+		conditions = true
+	}
+
+	return query, conditions
+}
+
+// newQuery starts a query on the statement's model and connection without hooks
+func newQuery(db *gorm.DB) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true, SkipHooks: true}).
+		Model(reflect.New(db.Statement.Schema.ModelType).Interface())
+}
+
+func loadSnapshots(query *gorm.DB, s *schema.Schema) ([]snapshot, error) {
+	rows := reflect.New(reflect.SliceOf(s.ModelType))
+	if err := query.Find(rows.Interface()).Error; err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]snapshot, 0, rows.Elem().Len())
+	eachStruct(rows.Elem(), func(value reflect.Value) {
+		snapshots = append(snapshots, takeSnapshot(query.Statement.Context, s, value))
+	})
+	return snapshots, nil
+}
+
+func beforeSnapshots(db *gorm.DB) []snapshot {
+	value, ok := db.InstanceGet(beforeKey)
+	if !ok {
+		return nil
+	}
+	rows, _ := value.([]snapshot)
+	return rows
+}
+
+// takeSnapshot encodes the columns of one row
+func takeSnapshot(ctx context.Context, s *schema.Schema, value reflect.Value) snapshot {
+	row := snapshot{values: make(map[string]json.RawMessage, len(s.Fields))}
+	for _, field := range s.Fields {
+		if field.DBName == "" || untrackedColumns[field.DBName] {
+			continue
+		}
+		v, _ := field.ValueOf(ctx, value)
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			continue
+		}
+		row.values[field.DBName] = encoded
+		if field == s.PrioritizedPrimaryField {
+			row.id = fmt.Sprint(v)
+		}
+	}
+	return row
+}
+
+// diffSnapshots returns the [old, new] values of the columns that differ between two states of a
+// row. A nil state stands for a row that does not exist, whose side of the diff is null; columns
+// that are empty on the existing side are then left out to keep the diff compact.
+func diffSnapshots(s *schema.Schema, before, after map[string]json.RawMessage) map[string][2]json.RawMessage {
+	changes := make(map[string][2]json.RawMessage)
+	for _, field := range s.Fields {
+		old, hasOld := before[field.DBName]
+		updated, hasNew := after[field.DBName]
+		if !hasOld && !hasNew {
+			continue
+		}
+		if hasOld && hasNew && bytes.Equal(old, updated) {
+			continue
+		}
+		if (!hasOld && isEmptyJSON(updated)) || (!hasNew && isEmptyJSON(old)) {
+			continue
+		}
+
+		if field.Tag.Get("json") == "-" {
+			if hasOld {
+				old = redactedValue
+			}
+			if hasNew {
+				updated = redactedValue
+			}
+		}
+		if !hasOld {
+			old = json.RawMessage("null")
+		}
+		if !hasNew {
+			updated = json.RawMessage("null")
+		}
+		changes[field.DBName] = [2]json.RawMessage{old, updated}
+	}
+	return changes
+}
+
+func isEmptyJSON(value json.RawMessage) bool {
+	switch string(value) {
+	case "null", `""`, "0", "false":
+		return true
+	}
+	return false
+}
+
+// eachStruct calls fn with the struct, or each struct of the slice or array, that value holds
+func eachStruct(value reflect.Value, fn func(reflect.Value)) {
+	value = reflect.Indirect(value)
+	switch value.Kind() {
+	case reflect.Struct:
+		fn(value)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			if element := reflect.Indirect(value.Index(i)); element.Kind() == reflect.Struct {
+				fn(element)
+			}
+		}
+	}
+}
+
+func toValues(ids []string) []interface{} {
+	values := make([]interface{}, len(ids))
+	for i, id := range ids {
+		values[i] = id
+	}
+	return values
+}
+
+// actorFromContext returns the authenticated user set on the context by the auth interceptor
+func actorFromContext(ctx context.Context) *uuid.UUID {
+	if ctx == nil {
+		return nil
+	}
+	userID, ok := ctx.Value("user_id").(uuid.UUID)
+	if !ok {
+		return nil
+	}
+	return &userID
+}
@@ -0,0 +1,163 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// openChangeLogged opens a migrated in-memory database that records changes
+func openChangeLogged(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open("file:"+uuid.NewString()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := Migrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err := RegisterChangeLog(db, zap.NewNop()); err != nil {
+		t.Fatalf("RegisterChangeLog: %v", err)
+	}
+	return db
+}
+
+// changesOf returns the change log of a row, oldest first, with each entry's changes decoded
+func changesOf(t *testing.T, db *gorm.DB, resource, id string) ([]models.ChangeLog, []map[string][2]interface{}) {
+	t.Helper()
+
+	var entries []models.ChangeLog
+	if err := db.Where("resource = ? AND resource_id = ?", resource, id).Order("created_at, rowid").Find(&entries).Error; err != nil {
+		t.Fatalf("load change log: %v", err)
+	}
+	changes := make([]map[string][2]interface{}, len(entries))
+	for i, entry := range entries {
+		if err := json.Unmarshal([]byte(entry.Changes), &changes[i]); err != nil {
+			t.Fatalf("decode changes %s: %v", entry.Changes, err)
+		}
+	}
+	return entries, changes
+}
+
+func TestChangeLogRecordsLifecycle(t *testing.T) {
+	db := openChangeLogged(t)
+	actor := uuid.New()
+	ctx := context.WithValue(context.Background(), "user_id", actor)
+
+	user := &models.User{Username: "ann", Email: "ann@example.com", PasswordHash: "$2a$10$secret", IsActive: true}
+	if err := db.WithContext(ctx).Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if err := db.WithContext(ctx).Model(user).Updates(map[string]interface{}{"first_name": "Ann", "password_hash": "$2a$10$other"}).Error; err != nil {
+		t.Fatalf("update user: %v", err)
+	}
+	// Writing the same values again changes nothing and is not recorded
+	if err := db.WithContext(ctx).Model(user).Update("first_name", "Ann").Error; err != nil {
+		t.Fatalf("repeat update: %v", err)
+	}
+	if err := db.Delete(user).Error; err != nil {
+		t.Fatalf("delete user: %v", err)
+	}
+
+	entries, changes := changesOf(t, db, "users", user.ID.String())
+	if len(entries) != 3 {
+		t.Fatalf("%d change log entries, want create, update and delete", len(entries))
+	}
+	for i, action := range []string{"create", "update", "delete"} {
+		if entries[i].Action != action {
+			t.Errorf("entry %d action = %s, want %s", i, entries[i].Action, action)
+		}
+	}
+
+	created := changes[0]
+	if created["username"] != [2]interface{}{nil, "ann"} {
+		t.Errorf("created username = %v", created["username"])
+	}
+	if created["password_hash"] != [2]interface{}{nil, "[redacted]"} {
+		t.Errorf("created password hash = %v, want it redacted", created["password_hash"])
+	}
+	if _, ok := created["first_name"]; ok {
+		t.Error("empty column recorded on create")
+	}
+	if _, ok := created["created_at"]; ok {
+		t.Error("timestamp recorded on create")
+	}
+	if entries[0].UserID == nil || *entries[0].UserID != actor {
+		t.Errorf("create attributed to %v, want %s", entries[0].UserID, actor)
+	}
+
+	updated := changes[1]
+	if len(updated) != 2 || updated["first_name"] != [2]interface{}{"", "Ann"} || updated["password_hash"] != [2]interface{}{"[redacted]", "[redacted]"} {
+		t.Errorf("update changes = %v, want first name and a redacted password hash", updated)
+	}
+
+	if changes[2]["email"] != [2]interface{}{"ann@example.com", nil} {
+		t.Errorf("deleted email = %v", changes[2]["email"])
+	}
+	if entries[2].UserID != nil {
+		t.Errorf("delete without a user attributed to %v", entries[2].UserID)
+	}
+}
+
+func TestChangeLogBatchesAndTransactions(t *testing.T) {
+	db := openChangeLogged(t)
+
+	owner := &models.User{Username: "bob", Email: "bob@example.com", PasswordHash: "x", IsActive: true}
+	if err := db.Create(owner).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	domains := []*models.Domain{
+		{UserID: owner.ID, Name: "a.example", DocumentRoot: "/var/www/a.example/public_html", PHPVersion: "8.1"},
+		{UserID: owner.ID, Name: "b.example", DocumentRoot: "/var/www/b.example/public_html", PHPVersion: "8.1"},
+	}
+	if err := db.Create(&domains).Error; err != nil {
+		t.Fatalf("create domains: %v", err)
+	}
+
+	// An update by condition is recorded for each row it changes
+	if err := db.Model(&models.Domain{}).Where("user_id = ?", owner.ID).Update("php_version", "8.3").Error; err != nil {
+		t.Fatalf("bulk update: %v", err)
+	}
+	for _, domain := range domains {
+		entries, changes := changesOf(t, db, "domains", domain.ID.String())
+		if len(entries) != 2 || changes[1]["php_version"] != [2]interface{}{"8.1", "8.3"} {
+			t.Errorf("%s change log = %v", domain.Name, changes)
+		}
+	}
+
+	// Entries of a rolled back change are rolled back with it
+	failed := errors.New("abort")
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(domains[0]).Update("php_version", "7.4").Error; err != nil {
+			return err
+		}
+		return failed
+	}); !errors.Is(err, failed) {
+		t.Fatalf("transaction error = %v", err)
+	}
+	if entries, _ := changesOf(t, db, "domains", domains[0].ID.String()); len(entries) != 2 {
+		t.Errorf("%d entries after a rollback, want 2", len(entries))
+	}
+
+	// Untracked tables are not recorded
+	if err := db.Create(&models.AuditLog{Action: "login", Resource: "session"}).Error; err != nil {
+		t.Fatalf("create audit log: %v", err)
+	}
+	var untracked int64
+	db.Model(&models.ChangeLog{}).Where("resource = ?", "audit_logs").Count(&untracked)
+	if untracked != 0 {
+		t.Errorf("%d entries for an untracked table", untracked)
+	}
+}
@@ -1,20 +1,20 @@
 package database
 
 import (
+	"context"
 	"fmt"
-	"time"
 
 	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
 
 	"github.com/mynodecp/mynodecp/backend/internal/config"
 	"github.com/mynodecp/mynodecp/backend/internal/models"
 )
 
 // New creates a new database connection
-func New(cfg config.DatabaseConfig) (*gorm.DB, error) {
+func New(cfg config.DatabaseConfig, log *zap.Logger) (*gorm.DB, error) {
 	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
 		cfg.Username,
 		cfg.Password,
@@ -24,8 +24,12 @@ func New(cfg config.DatabaseConfig) (*gorm.DB, error) {
 	)
 
 	// Configure GORM
+	queryLogger, err := newQueryLogger(log, cfg.LogLevel, cfg.SlowQueryThreshold)
+	if err != nil {
+		return nil, err
+	}
 	gormConfig := &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Silent),
+		Logger: queryLogger,
 	}
 
 	// Open database connection
@@ -34,6 +38,22 @@ func New(cfg config.DatabaseConfig) (*gorm.DB, error) {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
+	if err := RegisterTracing(db); err != nil {
+		return nil, err
+	}
+
+	if cfg.ChangeLog {
+		if err := RegisterChangeLog(db, log); err != nil {
+			return nil, err
+		}
+	}
+
+	if !cfg.DryRunWrites {
+		if err := RegisterDryRun(db, log); err != nil {
+			return nil, err
+		}
+	}
+
 	// Get underlying sql.DB
 	sqlDB, err := db.DB()
 	if err != nil {
@@ -66,8 +86,10 @@ func NewRedis(cfg config.RedisConfig) (*redis.Client, error) {
 		WriteTimeout: cfg.WriteTimeout,
 	})
 
+	client.AddHook(redisTracing{})
+
 	// Test connection
-	ctx := client.Context()
+	ctx := context.Background()
 	if err := client.Ping(ctx).Err(); err != nil {
 		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
@@ -84,20 +106,45 @@ func Migrate(db *gorm.DB) error {
 		&models.UserRole{},
 		&models.RolePermission{},
 		&models.Session{},
+		&models.PasswordHistory{},
+		&models.RegistrationInvite{},
+		&models.SSHKey{},
+		&models.WebAuthnCredential{},
+		&models.VaultItem{},
 		&models.AuditLog{},
+		&models.ChangeLog{},
+		&models.SecurityEvent{},
+		&models.AbuseReport{},
+		&models.AbuseReportNote{},
+		&models.NotificationPreference{},
+		&models.Notification{},
 		&models.Domain{},
 		&models.Subdomain{},
+		&models.Redirect{},
+		&models.ProtectedDirectory{},
+		&models.DirectoryUser{},
 		&models.DNSRecord{},
+		&models.DNSZoneVersion{},
+		&models.DNSTemplate{},
 		&models.SSLCertificate{},
 		&models.EmailAccount{},
 		&models.EmailAlias{},
 		&models.EmailForwarder{},
+		&models.FTPAccount{},
 		&models.Database{},
 		&models.DatabaseUser{},
 		&models.FileManager{},
 		&models.CronJob{},
 		&models.Backup{},
+		&models.Node{},
+		&models.OutboxEmail{},
+		&models.QuotaAlert{},
 		&models.SystemMetric{},
+		&models.TrafficSample{},
+		&models.TrafficLogCursor{},
+		&models.UsageSnapshot{},
+		&models.ServiceStatus{},
+		&models.ServiceRestart{},
 		&models.ServerResource{},
 	)
 }
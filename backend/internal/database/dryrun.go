@@ -0,0 +1,79 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// dryRunKey marks a statement that was switched to dry-run mode by the callbacks below
+const dryRunKey = "dryrun:skipped"
+
+// RegisterDryRun adds callbacks that turn the creates, updates and deletes of dry-run requests
+// into GORM dry runs: hooks still run, so new records get their IDs and the caller gets the
+// would-be result, but no SQL is executed. Reads are unaffected. Since nothing is written,
+// RowsAffected is always zero for these statements.
+func RegisterDryRun(db *gorm.DB, logger *zap.Logger) error {
+	d := &dryRunWrites{logger: logger}
+
+	if err := db.Callback().Create().Before("*").Register("dryrun:before_create", d.before); err != nil {
+		return fmt.Errorf("failed to register dry run callback: %w", err)
+	}
+	if err := db.Callback().Create().After("*").Register("dryrun:after_create", d.after); err != nil {
+		return fmt.Errorf("failed to register dry run callback: %w", err)
+	}
+	if err := db.Callback().Update().Before("*").Register("dryrun:before_update", d.before); err != nil {
+		return fmt.Errorf("failed to register dry run callback: %w", err)
+	}
+	if err := db.Callback().Update().After("*").Register("dryrun:after_update", d.after); err != nil {
+		return fmt.Errorf("failed to register dry run callback: %w", err)
+	}
+	if err := db.Callback().Delete().Before("*").Register("dryrun:before_delete", d.before); err != nil {
+		return fmt.Errorf("failed to register dry run callback: %w", err)
+	}
+	if err := db.Callback().Delete().After("*").Register("dryrun:after_delete", d.after); err != nil {
+		return fmt.Errorf("failed to register dry run callback: %w", err)
+	}
+
+	return nil
+}
+
+// dryRunWrites skips the writes of statements whose context is marked as a dry run
+type dryRunWrites struct {
+	logger *zap.Logger
+}
+
+// before switches the statement's session to dry-run mode. The session's config is a copy made
+// by WithContext, so other sessions are unaffected.
+func (d *dryRunWrites) before(db *gorm.DB) {
+	if db.DryRun || !dryRunFromContext(db.Statement.Context) {
+		return
+	}
+
+	table := ""
+	if db.Statement.Schema != nil {
+		table = db.Statement.Schema.Table
+	}
+	d.logger.Info("Dry run: skipping database write", zap.String("table", table))
+
+	db.DryRun = true
+	db.InstanceSet(dryRunKey, true)
+}
+
+// after switches the session back so later reads on it still run
+func (d *dryRunWrites) after(db *gorm.DB) {
+	if _, ok := db.InstanceGet(dryRunKey); ok {
+		db.DryRun = false
+	}
+}
+
+// dryRunFromContext reports whether the request on the context is a dry run
+func dryRunFromContext(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	dryRun, _ := ctx.Value("dry_run").(bool)
+	return dryRun
+}
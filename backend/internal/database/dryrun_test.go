@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestDryRunSkipsWrites(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:"+uuid.NewString()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := Migrate(db); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err := RegisterDryRun(db, zap.NewNop()); err != nil {
+		t.Fatalf("RegisterDryRun: %v", err)
+	}
+
+	real := &models.User{Username: "ann", Email: "ann@example.com", PasswordHash: "x", IsActive: true}
+	if err := db.Create(real).Error; err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	dry := db.WithContext(context.WithValue(context.Background(), "dry_run", true))
+	skipped := &models.User{Username: "bob", Email: "bob@example.com", PasswordHash: "x", IsActive: true}
+	if err := dry.Create(skipped).Error; err != nil {
+		t.Fatalf("dry-run create: %v", err)
+	}
+	if skipped.ID == uuid.Nil {
+		t.Error("dry-run create did not run hooks")
+	}
+	if err := dry.Model(real).Update("first_name", "Changed").Error; err != nil {
+		t.Fatalf("dry-run update: %v", err)
+	}
+	if err := dry.Delete(real).Error; err != nil {
+		t.Fatalf("dry-run delete: %v", err)
+	}
+
+	// Reads on the same session still run
+	var users []models.User
+	if err := dry.Find(&users).Error; err != nil {
+		t.Fatalf("dry-run read: %v", err)
+	}
+	if len(users) != 1 || users[0].Username != "ann" || users[0].FirstName != "" {
+		t.Errorf("users after dry-run writes = %+v, want ann unchanged", users)
+	}
+
+	// Other sessions keep writing
+	if err := db.Model(real).Update("first_name", "Ann").Error; err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	var stored models.User
+	db.Where("id = ?", real.ID).First(&stored)
+	if stored.FirstName != "Ann" {
+		t.Errorf("first name = %q after a real update", stored.FirstName)
+	}
+}
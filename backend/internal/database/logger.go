@@ -0,0 +1,118 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+
+	"github.com/mynodecp/mynodecp/backend/pkg/logger"
+)
+
+// queryLogger routes GORM logs through zap and warns about slow queries
+type queryLogger struct {
+	logger        *zap.Logger
+	level         gormlogger.LogLevel
+	slowThreshold time.Duration
+}
+
+// newQueryLogger creates a GORM logger. Queries are logged with placeholders in place of
+// their parameters, which may hold secrets such as password hashes and tokens.
+func newQueryLogger(log *zap.Logger, level string, slowThreshold time.Duration) (*queryLogger, error) {
+	logLevel, err := parseLogLevel(level)
+	if err != nil {
+		return nil, err
+	}
+
+	return &queryLogger{
+		logger:        log.WithOptions(zap.AddCallerSkip(3)),
+		level:         logLevel,
+		slowThreshold: slowThreshold,
+	}, nil
+}
+
+func parseLogLevel(level string) (gormlogger.LogLevel, error) {
+	switch strings.ToLower(level) {
+	case "silent":
+		return gormlogger.Silent, nil
+	case "error":
+		return gormlogger.Error, nil
+	case "warn", "":
+		return gormlogger.Warn, nil
+	case "info":
+		return gormlogger.Info, nil
+	default:
+		return 0, fmt.Errorf("invalid database log level: %s", level)
+	}
+}
+
+func (l *queryLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	clone := *l
+	clone.level = level
+	return &clone
+}
+
+func (l *queryLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= gormlogger.Info {
+		l.withContext(ctx).Info(fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l *queryLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= gormlogger.Warn {
+		l.withContext(ctx).Warn(fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l *queryLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= gormlogger.Error {
+		l.withContext(ctx).Error(fmt.Sprintf(msg, args...))
+	}
+}
+
+// Trace logs a finished query: errors at error level, slow queries at warn level and everything at info level
+func (l *queryLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	if l.level <= gormlogger.Silent {
+		return
+	}
+
+	elapsed := time.Since(begin)
+	slow := l.slowThreshold > 0 && elapsed > l.slowThreshold
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound) && l.level >= gormlogger.Error:
+		sql, rows := fc()
+		l.withContext(ctx).Error("Database query failed", queryFields(sql, rows, elapsed, zap.Error(err))...)
+	case slow && l.level >= gormlogger.Warn:
+		sql, rows := fc()
+		l.withContext(ctx).Warn("Slow database query",
+			queryFields(sql, rows, elapsed, zap.Duration("threshold", l.slowThreshold))...)
+	case l.level >= gormlogger.Info:
+		sql, rows := fc()
+		l.withContext(ctx).Info("Database query", queryFields(sql, rows, elapsed)...)
+	}
+}
+
+// ParamsFilter drops query parameters so they never reach the logs
+func (l *queryLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	return sql, nil
+}
+
+func (l *queryLogger) withContext(ctx context.Context) *zap.Logger {
+	if requestID := logger.RequestIDFromContext(ctx); requestID != "" {
+		return l.logger.With(zap.String("request_id", requestID))
+	}
+	return l.logger
+}
+
+func queryFields(sql string, rows int64, elapsed time.Duration, extra ...zap.Field) []zap.Field {
+	return append([]zap.Field{
+		zap.String("sql", sql),
+		zap.Int64("rows", rows),
+		zap.Duration("duration", elapsed),
+	}, extra...)
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/pkg/logger"
+)
+
+// openLogged opens an in-memory database whose queries are logged to the returned observer
+func openLogged(t *testing.T, level string, slowThreshold time.Duration) (*gorm.DB, *observer.ObservedLogs) {
+	t.Helper()
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	queryLogger, err := newQueryLogger(zap.New(core), level, slowThreshold)
+	if err != nil {
+		t.Fatalf("newQueryLogger: %v", err)
+	}
+	db, err := gorm.Open(sqlite.Open("file:"+uuid.NewString()+"?mode=memory&cache=shared"), &gorm.Config{Logger: queryLogger})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.Exec("CREATE TABLE secrets (token TEXT)").Error; err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+
+	return db, logs
+}
+
+func TestQueryLoggerLevels(t *testing.T) {
+	tests := []struct {
+		name          string
+		level         string
+		slowThreshold time.Duration
+		query         string
+		want          string
+		wantLevel     zapcore.Level
+	}{
+		{"info logs every query", "info", 0, "SELECT 1", "Database query", zapcore.InfoLevel},
+		{"warn logs slow queries", "warn", time.Nanosecond, "SELECT 1", "Slow database query", zapcore.WarnLevel},
+		{"warn skips fast queries", "warn", time.Hour, "SELECT 1", "", 0},
+		{"errors are logged", "error", 0, "SELECT * FROM missing", "Database query failed", zapcore.ErrorLevel},
+		{"silent logs nothing", "silent", time.Nanosecond, "SELECT * FROM missing", "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, logs := openLogged(t, tt.level, tt.slowThreshold)
+			logs.TakeAll()
+
+			db.Exec(tt.query)
+			entries := logs.TakeAll()
+			if tt.want == "" {
+				if len(entries) != 0 {
+					t.Errorf("logged %v", entries)
+				}
+				return
+			}
+			if len(entries) != 1 || entries[0].Message != tt.want || entries[0].Level != tt.wantLevel {
+				t.Fatalf("entries = %v, want one %s %q", entries, tt.wantLevel, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryLoggerHidesParameters(t *testing.T) {
+	db, logs := openLogged(t, "info", 0)
+	ctx := logger.ContextWithRequestID(context.Background(), "req-42")
+
+	db.WithContext(ctx).Exec("INSERT INTO secrets (token) VALUES (?)", "s3cr3t-token")
+	inserts := 0
+	for _, entry := range logs.All() {
+		fields := entry.ContextMap()
+		sql, _ := fields["sql"].(string)
+		if strings.Contains(sql, "s3cr3t-token") {
+			t.Errorf("query logged with its parameter: %s", sql)
+		}
+		if strings.HasPrefix(sql, "INSERT") {
+			inserts++
+			if fields["request_id"] != "req-42" {
+				t.Errorf("query logged without the request ID: %v", fields)
+			}
+		}
+	}
+	if inserts != 1 {
+		t.Errorf("logged %d inserts, want 1", inserts)
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	for _, level := range []string{"silent", "error", "warn", "", "INFO"} {
+		if _, err := parseLogLevel(level); err != nil {
+			t.Errorf("parseLogLevel(%q): %v", level, err)
+		}
+	}
+	if _, err := parseLogLevel("verbose"); err == nil {
+		t.Error("unknown level accepted")
+	}
+}
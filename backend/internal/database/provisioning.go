@@ -0,0 +1,141 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"github.com/go-sql-driver/mysql"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+)
+
+// Provisioning is the pool of admin connections to the managed database server, kept apart from
+// the panel's own database. Every statement is bounded by the query timeout, and the pool is
+// health checked with Check: when the server stops answering, idle connections are dropped so
+// the pool reconnects from scratch once it is back.
+type Provisioning struct {
+	db        *sql.DB
+	cfg       config.HostingConfig
+	logger    *zap.Logger
+	mu        sync.Mutex
+	unhealthy bool
+}
+
+// NewProvisioning creates the provisioning pool, or returns nil when no provisioning user is
+// configured. It does not connect: the managed server being down must not keep the panel from
+// starting, so connections are opened on first use.
+func NewProvisioning(cfg config.HostingConfig, logger *zap.Logger) (*Provisioning, error) {
+	if cfg.ProvisioningDBUser == "" {
+		return nil, nil
+	}
+
+	db, err := sql.Open("mysql", provisioningDSN(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open provisioning database: %w", err)
+	}
+	db.SetMaxOpenConns(cfg.ProvisioningDBMaxOpenConns)
+	db.SetMaxIdleConns(cfg.ProvisioningDBMaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ProvisioningDBConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ProvisioningDBConnMaxIdleTime)
+
+	return &Provisioning{
+		db:     db,
+		cfg:    cfg,
+		logger: logger,
+	}, nil
+}
+
+// provisioningDSN builds the connection string. The driver's dial timeout bounds connecting, and
+// its read and write timeouts cut off a server that stops responding mid-statement.
+func provisioningDSN(cfg config.HostingConfig) string {
+	dsn := mysql.NewConfig()
+	dsn.User = cfg.ProvisioningDBUser
+	dsn.Passwd = cfg.ProvisioningDBPassword
+	dsn.Net = "tcp"
+	dsn.Addr = cfg.ProvisioningDBAddr
+	dsn.Timeout = cfg.ProvisioningDBDialTimeout
+	dsn.ReadTimeout = cfg.ProvisioningDBQueryTimeout
+	dsn.WriteTimeout = cfg.ProvisioningDBQueryTimeout
+	dsn.ParseTime = true
+	return dsn.FormatDSN()
+}
+
+// Exec runs a statement on the managed server within the query timeout
+func (p *Provisioning) Exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.ProvisioningDBQueryTimeout)
+	defer cancel()
+	return p.db.ExecContext(ctx, query, args...)
+}
+
+// DatabaseSizes returns the size in bytes of each database on the managed server, by name,
+// counting the data and indexes of its tables
+func (p *Provisioning) DatabaseSizes(ctx context.Context) (map[string]int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.ProvisioningDBQueryTimeout)
+	defer cancel()
+
+	rows, err := p.db.QueryContext(ctx,
+		"SELECT table_schema, COALESCE(SUM(data_length + index_length), 0) FROM information_schema.tables GROUP BY table_schema")
+	if err != nil {
+		return nil, fmt.Errorf("failed to measure databases: %w", err)
+	}
+	defer rows.Close()
+
+	sizes := make(map[string]int64)
+	for rows.Next() {
+		var name string
+		var size int64
+		if err := rows.Scan(&name, &size); err != nil {
+			return nil, fmt.Errorf("failed to measure databases: %w", err)
+		}
+		sizes[name] = size
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to measure databases: %w", err)
+	}
+
+	return sizes, nil
+}
+
+// Ping checks that the managed server accepts the provisioning user, within the dial timeout
+func (p *Provisioning) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.ProvisioningDBDialTimeout)
+	defer cancel()
+	return p.db.PingContext(ctx)
+}
+
+// Check is the periodic health check of the pool. A failed ping drops the idle connections,
+// which may be stale after a server restart, and is logged once until the server is back.
+func (p *Provisioning) Check(ctx context.Context) error {
+	err := p.Ping(ctx)
+
+	p.mu.Lock()
+	wasUnhealthy := p.unhealthy
+	p.unhealthy = err != nil
+	p.mu.Unlock()
+
+	if err != nil {
+		p.db.SetMaxIdleConns(0)
+		p.db.SetMaxIdleConns(p.cfg.ProvisioningDBMaxIdleConns)
+		if !wasUnhealthy {
+			p.logger.Error("Provisioning database unreachable", zap.String("addr", p.cfg.ProvisioningDBAddr), zap.Error(err))
+		}
+		return fmt.Errorf("provisioning database unreachable: %w", err)
+	}
+	if wasUnhealthy {
+		p.logger.Info("Provisioning database reachable again", zap.String("addr", p.cfg.ProvisioningDBAddr))
+	}
+	return nil
+}
+
+// Stats returns the pool's connection statistics
+func (p *Provisioning) Stats() sql.DBStats {
+	return p.db.Stats()
+}
+
+// Close closes the pool's connections
+func (p *Provisioning) Close() error {
+	return p.db.Close()
+}
@@ -0,0 +1,118 @@
+package database
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+)
+
+// silentServer accepts connections and never answers, like a hung database server
+func silentServer(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for _, conn := range conns {
+				conn.Close()
+			}
+		}()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func provisioningConfig(addr string) config.HostingConfig {
+	return config.HostingConfig{
+		ProvisioningDBAddr:            addr,
+		ProvisioningDBUser:            "provision",
+		ProvisioningDBPassword:        "s3cret",
+		ProvisioningDBMaxOpenConns:    4,
+		ProvisioningDBMaxIdleConns:    2,
+		ProvisioningDBConnMaxLifetime: time.Minute,
+		ProvisioningDBConnMaxIdleTime: time.Second,
+		ProvisioningDBDialTimeout:     100 * time.Millisecond,
+		ProvisioningDBQueryTimeout:    200 * time.Millisecond,
+	}
+}
+
+func TestNewProvisioning(t *testing.T) {
+	pool, err := NewProvisioning(config.HostingConfig{ProvisioningDBAddr: "127.0.0.1:3306"}, zap.NewNop())
+	if err != nil || pool != nil {
+		t.Errorf("NewProvisioning() without a user = %v, %v, want no pool", pool, err)
+	}
+
+	// Creating the pool does not connect, so an unreachable server is fine
+	pool, err = NewProvisioning(provisioningConfig("127.0.0.1:1"), zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewProvisioning() error = %v", err)
+	}
+	defer pool.Close()
+	if stats := pool.Stats(); stats.MaxOpenConnections != 4 || stats.OpenConnections != 0 {
+		t.Errorf("pool stats = %+v, want 4 connections at most and none open", stats)
+	}
+}
+
+func TestProvisioningDSN(t *testing.T) {
+	dsn, err := mysql.ParseDSN(provisioningDSN(provisioningConfig("db.internal:3306")))
+	if err != nil {
+		t.Fatalf("ParseDSN() error = %v", err)
+	}
+	if dsn.User != "provision" || dsn.Passwd != "s3cret" || dsn.Net != "tcp" || dsn.Addr != "db.internal:3306" || !dsn.ParseTime {
+		t.Errorf("DSN = %+v", dsn)
+	}
+	if dsn.Timeout != 100*time.Millisecond || dsn.ReadTimeout != 200*time.Millisecond || dsn.WriteTimeout != 200*time.Millisecond {
+		t.Errorf("DSN timeouts = %v dial, %v read, %v write", dsn.Timeout, dsn.ReadTimeout, dsn.WriteTimeout)
+	}
+}
+
+func TestProvisioningTimeouts(t *testing.T) {
+	core, logs := observer.New(zap.ErrorLevel)
+	pool, err := NewProvisioning(provisioningConfig(silentServer(t)), zap.New(core))
+	if err != nil {
+		t.Fatalf("NewProvisioning() error = %v", err)
+	}
+	defer pool.Close()
+	ctx := context.Background()
+
+	bounded := func(name string, call func() error) {
+		t.Helper()
+		start := time.Now()
+		if err := call(); err == nil {
+			t.Errorf("%s on a hung server succeeded", name)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("%s took %v on a hung server", name, elapsed)
+		}
+	}
+	bounded("Ping", func() error { return pool.Ping(ctx) })
+	bounded("Exec", func() error { _, err := pool.Exec(ctx, "CREATE DATABASE shop"); return err })
+	bounded("DatabaseSizes", func() error { _, err := pool.DatabaseSizes(ctx); return err })
+
+	// Repeated failed checks are logged once
+	bounded("Check", func() error { return pool.Check(ctx) })
+	bounded("Check", func() error { return pool.Check(ctx) })
+	if logs.Len() != 1 {
+		t.Errorf("%d errors logged for two failed checks, want 1", logs.Len())
+	}
+}
@@ -0,0 +1,136 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/tracing"
+)
+
+// traceSpanKey holds the span of a statement between the callbacks below
+const traceSpanKey = "tracing:span"
+
+// rowsAffectedKey is the span attribute of the rows a statement affected or returned
+const rowsAffectedKey = attribute.Key("db.rows_affected")
+
+// RegisterTracing adds callbacks that record a span of each statement, as a child of the span on
+// the statement's context. Statements are recorded with their placeholders, not their values.
+func RegisterTracing(db *gorm.DB) error {
+	callbacks := db.Callback()
+	processors := []struct {
+		operation string
+		before    func(string, func(*gorm.DB)) error
+		after     func(string, func(*gorm.DB)) error
+	}{
+		{"create", callbacks.Create().Before("*").Register, callbacks.Create().After("*").Register},
+		{"query", callbacks.Query().Before("*").Register, callbacks.Query().After("*").Register},
+		{"update", callbacks.Update().Before("*").Register, callbacks.Update().After("*").Register},
+		{"delete", callbacks.Delete().Before("*").Register, callbacks.Delete().After("*").Register},
+		{"row", callbacks.Row().Before("*").Register, callbacks.Row().After("*").Register},
+		{"raw", callbacks.Raw().Before("*").Register, callbacks.Raw().After("*").Register},
+	}
+
+	for _, p := range processors {
+		if err := p.before("tracing:before_"+p.operation, startStatementSpan(p.operation)); err != nil {
+			return fmt.Errorf("failed to register tracing callback: %w", err)
+		}
+		if err := p.after("tracing:after_"+p.operation, endStatementSpan); err != nil {
+			return fmt.Errorf("failed to register tracing callback: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// startStatementSpan returns the callback starting the span of a statement of an operation
+func startStatementSpan(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		ctx := db.Statement.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		_, span := tracing.Tracer().Start(ctx, "db."+operation,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(semconv.DBSystemMySQL, semconv.DBOperation(operation)),
+		)
+		db.InstanceSet(traceSpanKey, span)
+	}
+}
+
+// endStatementSpan ends the span of a statement with its table, SQL and outcome
+func endStatementSpan(db *gorm.DB) {
+	value, ok := db.InstanceGet(traceSpanKey)
+	if !ok {
+		return
+	}
+	span := value.(trace.Span)
+	defer span.End()
+
+	if db.Statement.Table != "" {
+		span.SetAttributes(semconv.DBSQLTable(db.Statement.Table))
+	}
+	if sql := db.Statement.SQL.String(); sql != "" {
+		span.SetAttributes(semconv.DBStatement(sql))
+	}
+	span.SetAttributes(rowsAffectedKey.Int64(db.Statement.RowsAffected))
+	if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		tracing.Fail(span, db.Error)
+	}
+}
+
+// redisTracing is a Redis hook recording a span of each command and pipeline
+type redisTracing struct{}
+
+// DialHook implements redis.Hook
+func (redisTracing) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+// ProcessHook implements redis.Hook
+func (redisTracing) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		ctx, span := tracing.Tracer().Start(ctx, "redis."+cmd.Name(),
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(semconv.DBSystemRedis, semconv.DBOperation(cmd.Name())),
+		)
+		defer span.End()
+
+		err := next(ctx, cmd)
+		if err != nil && !errors.Is(err, redis.Nil) {
+			tracing.Fail(span, err)
+		}
+		return err
+	}
+}
+
+// ProcessPipelineHook implements redis.Hook
+func (redisTracing) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		names := make([]string, len(cmds))
+		for i, cmd := range cmds {
+			names[i] = cmd.Name()
+		}
+		ctx, span := tracing.Tracer().Start(ctx, "redis.pipeline",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(semconv.DBSystemRedis, semconv.DBOperation(strings.Join(names, " "))),
+		)
+		defer span.End()
+
+		err := next(ctx, cmds)
+		if err != nil && !errors.Is(err, redis.Nil) {
+			tracing.Fail(span, err)
+		}
+		return err
+	}
+}
@@ -0,0 +1,142 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/tracing"
+)
+
+// recordSpans records the spans ended during a test in memory
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	previous := otel.GetTracerProvider()
+	recorder := tracetest.NewSpanRecorder()
+	tracing.Use(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+// spanAttribute returns an attribute of a span, or an empty value
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestStatementSpans(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:"+uuid.NewString()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Role{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err := RegisterTracing(db); err != nil {
+		t.Fatalf("RegisterTracing() error = %v", err)
+	}
+	recorder := recordSpans(t)
+
+	ctx, parent := tracing.Start(context.Background(), "RoleService.Create")
+	db.WithContext(ctx).Create(&models.Role{ID: uuid.New(), Name: "reseller", DisplayName: "Reseller"})
+	var role models.Role
+	db.WithContext(ctx).Where("name = ?", "reseller").First(&role)
+	db.WithContext(ctx).Where("name = ?", "missing").First(&models.Role{})
+	db.WithContext(ctx).Exec("SELECT * FROM no_such_table")
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 5 {
+		t.Fatalf("%d spans, want 4 statements and their parent", len(spans))
+	}
+	tests := []struct {
+		name      string
+		operation string
+		rows      int64
+		failed    bool
+	}{
+		{"db.create", "create", 1, false},
+		{"db.query", "query", 1, false},
+		{"db.query", "query", 0, false}, // Not finding a row is no failure
+		{"db.raw", "raw", 0, true},
+	}
+	for i, tt := range tests {
+		span := spans[i]
+		if span.Name() != tt.name || spanAttribute(span, "db.operation").AsString() != tt.operation {
+			t.Errorf("span %d = %s", i, span.Name())
+		}
+		if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("span %d is not a child of the service span", i)
+		}
+		if got := spanAttribute(span, "db.rows_affected").AsInt64(); got != tt.rows {
+			t.Errorf("span %d rows = %d, want %d", i, got, tt.rows)
+		}
+		if failed := span.Status().Code == codes.Error; failed != tt.failed {
+			t.Errorf("span %d failed = %v, want %v", i, failed, tt.failed)
+		}
+	}
+	query := spans[1]
+	if spanAttribute(query, "db.sql.table").AsString() != "roles" {
+		t.Errorf("table = %q", spanAttribute(query, "db.sql.table").AsString())
+	}
+	if statement := spanAttribute(query, "db.statement").AsString(); statement == "" || strings.Contains(statement, "reseller") {
+		t.Errorf("statement = %q, want it with placeholders only", statement)
+	}
+}
+
+func TestRedisSpans(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	client.AddHook(redisTracing{})
+	recorder := recordSpans(t)
+
+	ctx := context.Background()
+	client.Set(ctx, "session", "1", 0)
+	client.Get(ctx, "missing")
+	pipe := client.Pipeline()
+	pipe.Incr(ctx, "hits")
+	pipe.Expire(ctx, "hits", 0)
+	pipe.Exec(ctx)
+	client.Do(ctx, "nosuchcommand")
+
+	spans := recorder.Ended()
+	if len(spans) != 4 {
+		t.Fatalf("%d spans, want 4", len(spans))
+	}
+	tests := []struct {
+		name      string
+		operation string
+		failed    bool
+	}{
+		{"redis.set", "set", false},
+		{"redis.get", "get", false}, // A missing key is no failure
+		{"redis.pipeline", "incr expire", false},
+		{"redis.nosuchcommand", "nosuchcommand", true},
+	}
+	for i, tt := range tests {
+		span := spans[i]
+		if span.Name() != tt.name || spanAttribute(span, "db.operation").AsString() != tt.operation || spanAttribute(span, "db.system").AsString() != "redis" {
+			t.Errorf("span %d = %s %v", i, span.Name(), span.Attributes())
+		}
+		if failed := span.Status().Code == codes.Error; failed != tt.failed {
+			t.Errorf("span %d failed = %v, want %v", i, failed, tt.failed)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Package egress controls the outbound HTTP calls the panel makes to external services, such as
+// breach checks, CAPTCHA verification, the nameserver API and the ACME server. Calls can be routed
+// through a proxy and restricted to an allowlist of hosts, which also applies to every redirect.
+package egress
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ErrHostNotAllowed is returned for requests to hosts outside the allowlist
+var ErrHostNotAllowed = errors.New("outbound host not allowed")
+
+// hostPattern matches an allowlist entry: a hostname or IP address, or *. and a domain to allow
+// every name below it
+var hostPattern = regexp.MustCompile(`^(\*\.)?[a-z0-9]([a-z0-9.:-]*[a-z0-9])?$`)
+
+// Policy routes outbound requests through a proxy and rejects requests to hosts that are not
+// allowed. A nil policy allows every host.
+type Policy struct {
+	proxy     *url.URL
+	allowed   []string
+	transport *transport
+}
+
+// New builds a policy from a proxy URL (http, https or socks5; empty leaves proxying to the
+// environment) and an allowlist of hosts. Entries are hostnames or addresses, matched exactly, or
+// *.example.com, matching every name below example.com. An empty allowlist allows every host.
+func New(proxyURL string, allowedHosts []string) (*Policy, error) {
+	p := &Policy{}
+
+	if proxyURL != "" {
+		proxy, err := url.Parse(proxyURL)
+		if err != nil || proxy.Host == "" {
+			return nil, fmt.Errorf("invalid outbound proxy URL %q", proxyURL)
+		}
+		switch proxy.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("outbound proxy must be an http, https or socks5 URL: %q", proxyURL)
+		}
+		p.proxy = proxy
+	}
+
+	for _, host := range allowedHosts {
+		host = strings.ToLower(strings.TrimSpace(host))
+		if !hostPattern.MatchString(host) {
+			return nil, fmt.Errorf("invalid outbound host %q", host)
+		}
+		p.allowed = append(p.allowed, host)
+	}
+
+	// Without a proxy, the usual HTTPS_PROXY and NO_PROXY variables still apply
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	if p.proxy != nil {
+		base.Proxy = http.ProxyURL(p.proxy)
+	}
+	p.transport = &transport{policy: p, base: base}
+
+	return p, nil
+}
+
+// Client returns an HTTP client with the given timeout whose requests follow the policy. Clients
+// share one transport, and with it their connections.
+func (p *Policy) Client(timeout time.Duration) *http.Client {
+	if p == nil {
+		return &http.Client{Timeout: timeout}
+	}
+	return &http.Client{Timeout: timeout, Transport: p.transport}
+}
+
+// Allowed reports whether requests may be sent to a host, given with or without a port
+func (p *Policy) Allowed(host string) bool {
+	if p == nil || len(p.allowed) == 0 {
+		return true
+	}
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(strings.Trim(host, "[]"), "."))
+
+	for _, allowed := range p.allowed {
+		if domain, ok := strings.CutPrefix(allowed, "*."); ok {
+			if strings.HasSuffix(host, "."+domain) {
+				return true
+			}
+			continue
+		}
+		if host == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// transport checks each request, including those following redirects, against the policy before
+// sending it
+type transport struct {
+	policy *Policy
+	base   *http.Transport
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.policy.Allowed(req.URL.Host) {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, fmt.Errorf("%w: %s", ErrHostNotAllowed, req.URL.Hostname())
+	}
+	return t.base.RoundTrip(req)
+}
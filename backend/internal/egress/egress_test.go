@@ -0,0 +1,138 @@
+package egress
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxy   string
+		hosts   []string
+		wantErr bool
+	}{
+		{name: "nothing set"},
+		{name: "http proxy", proxy: "http://proxy.internal:3128"},
+		{name: "socks proxy", proxy: "socks5://127.0.0.1:1080"},
+		{name: "proxy without a host", proxy: "http://", wantErr: true},
+		{name: "proxy of another scheme", proxy: "ftp://proxy.internal", wantErr: true},
+		{name: "hosts", hosts: []string{"api.pwnedpasswords.com", " *.Example.com ", "192.0.2.1"}},
+		{name: "wildcard in the middle", hosts: []string{"api.*.example.com"}, wantErr: true},
+		{name: "URL as host", hosts: []string{"https://example.com"}, wantErr: true},
+		{name: "empty host", hosts: []string{""}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.proxy, tt.hosts); (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	policy, err := New("", []string{"api.pwnedpasswords.com", "*.example.com", "192.0.2.1", "2001:db8::1"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"api.pwnedpasswords.com", true},
+		{"API.PwnedPasswords.com.", true},
+		{"api.pwnedpasswords.com:443", true},
+		{"pwnedpasswords.com", false},
+		{"acme.example.com", true},
+		{"a.b.example.com", true},
+		{"example.com", false},
+		{"badexample.com", false},
+		{"192.0.2.1:8080", true},
+		{"[2001:db8::1]:443", true},
+		{"192.0.2.2", false},
+	}
+	for _, tt := range tests {
+		if got := policy.Allowed(tt.host); got != tt.want {
+			t.Errorf("Allowed(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+
+	var none *Policy
+	if !none.Allowed("anything.example") {
+		t.Error("nil policy rejected a host")
+	}
+	open, _ := New("", nil)
+	if !open.Allowed("anything.example") {
+		t.Error("empty allowlist rejected a host")
+	}
+}
+
+func TestClientBlocksDisallowedHosts(t *testing.T) {
+	var served int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served++
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "http://elsewhere.example/", http.StatusFound)
+		}
+	}))
+	defer server.Close()
+
+	blocked, _ := New("", []string{"api.example.com"})
+	if _, err := blocked.Client(time.Second).Get(server.URL); !errors.Is(err, ErrHostNotAllowed) {
+		t.Errorf("request to a host off the allowlist: error = %v", err)
+	}
+	if served != 0 {
+		t.Errorf("server got %d requests from a blocked client", served)
+	}
+
+	allowed, _ := New("", []string{"127.0.0.1"})
+	resp, err := allowed.Client(time.Second).Get(server.URL)
+	if err != nil {
+		t.Fatalf("request to an allowed host: %v", err)
+	}
+	resp.Body.Close()
+
+	// Redirects are checked like the first request
+	if _, err := allowed.Client(time.Second).Get(server.URL + "/redirect"); !errors.Is(err, ErrHostNotAllowed) {
+		t.Errorf("redirect off the allowlist: error = %v", err)
+	}
+}
+
+func TestClientUsesProxy(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		io.WriteString(w, "via proxy")
+	}))
+	defer proxy.Close()
+
+	policy, err := New(proxy.URL, []string{"upstream.example"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	resp, err := policy.Client(time.Second).Get("http://upstream.example/check")
+	if err != nil {
+		t.Fatalf("request through the proxy: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "via proxy" || len(proxied) != 1 || !strings.HasPrefix(proxied[0], "http://upstream.example/check") {
+		t.Errorf("proxy saw %v, client got %q", proxied, body)
+	}
+
+	// The allowlist is checked before the proxy is involved
+	if _, err := policy.Client(time.Second).Get("http://other.example/"); !errors.Is(err, ErrHostNotAllowed) {
+		t.Errorf("request off the allowlist: error = %v", err)
+	}
+	if len(proxied) != 1 {
+		t.Errorf("proxy got %d requests, want 1", len(proxied))
+	}
+}
@@ -0,0 +1,68 @@
+package geoip
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// Location represents the approximate location of an IP address
+type Location struct {
+	CountryCode string `json:"country_code"`
+	Country     string `json:"country"`
+	City        string `json:"city"`
+}
+
+// Resolver looks up the approximate location of an IP address
+type Resolver interface {
+	// Lookup returns nil when the location of the address is unknown
+	Lookup(ip string) (*Location, error)
+}
+
+// New creates a resolver backed by a local MaxMind City database.
+// An empty path disables lookups instead of failing.
+func New(dbPath string) (Resolver, error) {
+	if dbPath == "" {
+		return noopResolver{}, nil
+	}
+
+	reader, err := geoip2.Open(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GeoIP database: %w", err)
+	}
+
+	return &maxMindResolver{reader: reader}, nil
+}
+
+type maxMindResolver struct {
+	reader *geoip2.Reader
+}
+
+func (r *maxMindResolver) Lookup(ip string) (*Location, error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return nil, nil
+	}
+
+	record, err := r.reader.City(parsed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up %s: %w", ip, err)
+	}
+
+	if record.Country.IsoCode == "" {
+		return nil, nil
+	}
+
+	return &Location{
+		CountryCode: record.Country.IsoCode,
+		Country:     record.Country.Names["en"],
+		City:        record.City.Names["en"],
+	}, nil
+}
+
+type noopResolver struct{}
+
+func (noopResolver) Lookup(ip string) (*Location, error) {
+	return nil, nil
+}
@@ -0,0 +1,355 @@
+package i18n
+
+// catalogs maps each supported locale to its messages by code. Every code needs an English
+// message; other locales may leave codes out and get the English message instead. Codes starting
+// with "term." translate words substituted into other messages, such as resource names.
+var catalogs = map[string]map[string]string{
+	"en": {
+		// Service errors
+		"not_found":                     "{resource} not found",
+		"permission_denied":             "You do not have permission to access this {resource}",
+		"feature_disabled":              "The {feature} feature is not enabled for this domain",
+		"precondition_failed":           "{reason}",
+		"validation_failed":             "Some fields are invalid",
+		"subdomain_limit_reached":       "This domain has reached its limit of {limit} subdomains",
+		"dns_record_limit_reached":      "This domain has reached its limit of {limit} DNS records",
+		"dns_record_type_limit_reached": "This domain has reached its limit of {limit} {type} records",
+		"capacity_overcommit":           "The server cannot take this {resource} quota: allocations would exceed {percent}% of its capacity",
+		"registration_disabled":         "Registration is closed; ask an administrator for an account",
+		"resource_modified":             "This {resource} has changed since it was loaded; reload it and try again",
+		"database_quota_exceeded":       "Database {name} has reached its storage quota; imports are blocked until it shrinks or the quota is raised",
+		"user_database_quota_exceeded":  "Your databases use {used} MB of your {quota} MB quota; free space before creating another",
+		"disk_quota_exceeded":           "{name} has reached its disk quota; uploads are blocked until space is freed or the quota is raised",
+		"upload_over_quota":             "This upload of {size} does not fit the {free} left of the disk quota of {name}",
+		"upload_offset_mismatch":        "The upload has received {offset} bytes; resume from there",
+		"upload_busy":                   "Another chunk of this upload is being written; try again once it has finished",
+		"resource_busy":                 "Another operation is running on this {resource}; try again once it has finished",
+		"deliverability_test_limit":     "A domain's mail deliverability can be tested {limit} times an hour; try again later",
+		"credential_check_limit":        "A mailbox password can be checked {limit} times every {minutes} minutes; try again later",
+		"opcache_reset_disabled":        "Opcache resets are not enabled on this server",
+		"vault_unavailable":             "The vault is not available: no encryption key is configured on this server",
+		"vault_limit_reached":           "Your vault has reached its limit of {limit} items",
+		"abuse_transition":              "An abuse report cannot move from {from} to {to}",
+		"abuse_no_target":               "{target} is not a domain hosted here; nothing can be suspended",
+		"acme_disabled":                 "Certificates cannot be issued: no ACME server is configured",
+		"acme_challenge_failed":         "The ACME server could not validate {name} over {type}: {error}",
+		"acme_challenge_unsupported":    "The ACME server offers no challenge the panel can answer for {name}",
+		"domain_not_suspended":          "{name} is not suspended",
+		"domain_path_exists":            "{path} already exists; move it away before renaming the domain",
+		"https_requires_certificate":    "{name} has no SSL certificate installed; install one before forcing HTTPS",
+		"two_factor_enrolled":           "An authenticator app is already set up; disable two-factor authentication before setting up another",
+		"two_factor_setup_missing":      "There is no pending two-factor setup, or it has expired; start the setup again",
+		"ssh_key_change_limit":          "Too many SSH key changes in the last hour; try again later",
+		"backup_no_databases":           "This domain has no databases to back up",
+		"backup_not_restorable":         "Only completed backups of a domain can be restored",
+		"last_admin":                    "The last active admin cannot be deactivated; give another active account the admin role first",
+
+		// Field validation
+		"field.required":          "is required",
+		"field.unknown":           "unknown field",
+		"field.null":              "must not be null",
+		"field.object":            "must be an object",
+		"field.array":             "must be an array",
+		"field.string":            "must be a string",
+		"field.number":            "must be a number",
+		"field.integer":           "must be an integer",
+		"field.boolean":           "must be a boolean",
+		"field.empty":             "must not be empty",
+		"field.min_length":        "must be at least {min} characters",
+		"field.max_length":        "must be at most {max} characters",
+		"field.minimum":           "must be at least {min}",
+		"field.maximum":           "must be at most {max}",
+		"field.uuid":              "must be a UUID",
+		"field.format":            "has an invalid format",
+		"field.enum":              "must be one of {values}",
+		"field.locale":            "must be one of the supported languages: {locales}",
+		"domain.invalid":          "invalid domain name",
+		"domain.exists":           "domain already exists",
+		"domain.unchanged":        "the domain already has this name",
+		"subdomain.invalid":       "subdomain must be a single label of lowercase letters, digits and hyphens",
+		"subdomain.reserved":      "subdomain \"{name}\" is reserved",
+		"subdomain.exists":        "subdomain already exists",
+		"subdomain.root_outside":  "must be a directory inside {dir}",
+		"dns.nameserver_invalid":  "nameserver \"{name}\" must be a fully qualified hostname",
+		"dns.ns_minimum":          "{name} needs at least {min} nameservers",
+		"dns.cname_apex":          "a CNAME record cannot be placed at the zone apex",
+		"dns.cname_conflict":      "{name} cannot have both a CNAME record and NS records",
+		"dns.glue_required":       "nameserver {name} is inside the delegated name and needs an A or AAAA record",
+		"dns.zone_invalid":        "invalid zone file: {error}",
+		"dns.archive_invalid":     "must be a zip archive of zone files",
+		"dns.template_exists":     "a DNS template with this name already exists",
+		"dns.archive_too_large":   "the archive may hold at most {max} zone files",
+		"dns.zone_too_large":      "zone files may be at most {max} bytes",
+		"dns.zone_foreign":        "{name} belongs to another account",
+		"dns.zone_domain_missing": "domain not found; allow creating missing domains to import {name}",
+		"dns.bulk_empty":          "select at least one record to delete",
+		"dns.bulk_too_many":       "at most {max} records can be deleted at once",
+		"dns.soa_managed":         "the SOA record is managed by the panel",
+		"dns.ttl_range":           "must be between {min} and {max} seconds",
+		"dns.bulk_protected":      "deleting {records} needs force, since the domain may stop resolving",
+		"dns.bulk_token":          "the confirm token is invalid or has expired; preview the deletion again",
+		"dns.bulk_mismatch":       "the confirm token was issued for a different selection; preview the deletion again",
+		"batch.empty":             "add at least one operation",
+		"batch.too_many":          "a batch may run at most {max} operations",
+		"batch.unknown_op":        "unknown operation \"{op}\"",
+		"batch.params":            "invalid parameters: {error}",
+		"ssl.format_unknown":      "must be a PEM or DER certificate or a PKCS#12 bundle",
+		"ssl.cert_invalid":        "contains no valid certificate",
+		"ssl.password":            "the PKCS#12 password is incorrect",
+		"ssl.pkcs12_unsupported":  "the PKCS#12 bundle cannot be read ({error}); export it with legacy encryption or as PEM",
+		"ssl.key_missing":         "a private key is required, in the bundle or uploaded separately",
+		"ssl.key_invalid":         "must be a PKCS#8, PKCS#1 or EC private key",
+		"ssl.key_encrypted":       "the private key is encrypted; upload it without a passphrase",
+		"ssl.key_mismatch":        "the private key does not belong to any of the certificates",
+		"ssl.name_outside":        "\"{name}\" is not {domain} or a name below it",
+		"ssl.name_apex":           "must include {domain} itself",
+		"ssl.too_many_names":      "a certificate covers at most {max} names",
+		"php.version_missing":     "PHP {version} is not installed",
+		"php.version_invalid":     "must be a PHP version such as 8.3",
+		"php.extension_unknown":   "unknown PHP {version} extension \"{name}\"; available: {available}",
+		"php.version_removed":     "PHP {version} was retired on {date} and can no longer be selected",
+		"php.error_log_outside":   "must be a file path inside {dir}",
+		"php.error_log_public":    "must not be inside the document root {dir}, which would serve the log to visitors",
+		"vault.name_invalid":      "must be 1 to {max} characters on a single line",
+		"vault.too_large":         "must be at most {max} bytes",
+		"abuse.contact_required":  "is required to report abuse without an account",
+		"abuse.target_invalid":    "must be a domain or URL",
+		"upload.path":             "must be a file path inside the domain's directory",
+		"upload.too_long":         "is longer than the {size} bytes announced for the upload",
+		"ftp.username_invalid":    "FTP username must be 1 to 32 lowercase letters, digits, dots, hyphens or underscores",
+		"ftp.username_taken":      "FTP username is already taken",
+		"ftp.home_outside":        "home directory must be inside {root}",
+		"user.username_required":  "username is required",
+		"user.username_taken":     "username is already taken",
+		"user.username_reserved":  "username \"{name}\" is reserved",
+		"user.invite_required":    "an invite code is required to register",
+		"user.invite_invalid":     "invite code is invalid, expired or used up",
+		"user.email_invalid":      "invalid email address",
+		"user.email_taken":        "email is already registered",
+		"user.password_reused":    "must differ from your last {count} passwords",
+		"user.password_wrong":     "current password is incorrect",
+		"user.email_unchanged":    "this is already your email address",
+		"user.email_change":       "email addresses are changed by confirming the new address",
+		"user.email_token":        "confirmation link is invalid or has expired",
+		"user.ip_range_invalid":   "\"{range}\" is not an IP address or CIDR range",
+		"user.country_invalid":    "\"{code}\" is not a two-letter country code",
+		"user.geoip_missing":      "countries can only be restricted with a GeoIP database configured",
+		"user.mfa_unavailable":    "two-factor method \"{method}\" is not available",
+		"user.mfa_not_enrolled":   "two-factor method \"{method}\" is not set up",
+		"user.mfa_unverified":     "verify your email address before receiving sign-in codes by email",
+		"user.mfa_code_invalid":   "the two-factor code is invalid",
+		"ssh_key.name_invalid":    "must be 1 to {max} characters on a single line",
+		"ssh_key.single_line":     "must be a single line",
+		"ssh_key.invalid":         "is not a valid SSH public key",
+		"ssh_key.options":         "must not contain key options",
+		"ssh_key.dsa":             "DSA keys are not supported",
+		"ssh_key.rsa_bits":        "RSA keys must be at least {bits} bits",
+		"ssh_key.exists":          "this key is already added",
+		"node.ipv4_invalid":       "must be an IPv4 address",
+		"node.ipv6_invalid":       "must be an IPv6 address",
+		"node.role_unknown":       "unknown node role \"{role}\"",
+		"node.endpoint_invalid":   "must be an http or https URL",
+		"notify.event_unknown":    "unknown notification type \"{type}\"",
+		"notify.urgent":           "{type} notifications are always emailed immediately",
+
+		// Notifications
+		"quota.alert.subject":   "{name} has used {threshold}% of its {metric} quota",
+		"quota.alert.body":      "{name} is using {usage} of its {quota} {metric} quota.",
+		"quota.blocked.disk":    "Uploads are blocked until space is freed or the quota is raised.",
+		"quota.blocked.mailbox": "Incoming mail is refused until space is freed or the quota is raised.",
+		"php.eol.subject":       "PHP {version} of {name} is deprecated",
+		"php.eol.body":          "{name} runs PHP {version}, which is deprecated. From {date} it can no longer be selected.",
+		"php.eol.upgrade":       "Please switch {name} to PHP {replacement}.",
+		"send.blocked.subject":  "Outgoing mail of {name} was suspended",
+		"send.blocked.body":     "{name} sent to {count} recipients within {window}, above the limit of {limit}. Its outgoing mail stays suspended until an administrator lifts the suspension.",
+		"service.down.subject":  "{service} is down and could not be restarted",
+		"service.down.body":     "{service} has failed and {attempts} restarts did not bring it back; the last error was: {error}. The watchdog does not restart it again until it is running.",
+		"abuse.report.subject":  "New {category} abuse report about {target}",
+		"abuse.report.body":     "An abuse report ({category}) about {target} was filed and waits for triage under report {id}.",
+		"password.due.subject":  "Your password expires on {date}",
+		"password.due.body":     "The password of {username} expires on {date}. Please change it before then; afterwards you can only log in to change it.",
+		"term.disk":             "disk",
+		"term.bandwidth":        "bandwidth",
+		"term.mailbox":          "mailbox",
+		"term.domain":           "domain",
+		"term.subdomain":        "subdomain",
+		"term.redirect":         "redirect",
+		"term.database":         "database",
+		"term.user":             "user",
+		"term.email":            "email",
+		"term.databases":        "databases",
+		"term.custom_dns":       "custom DNS",
+	},
+	"de": {
+		"not_found":                     "{resource} nicht gefunden",
+		"permission_denied":             "Sie haben keine Berechtigung für diese Ressource ({resource})",
+		"feature_disabled":              "Die Funktion {feature} ist für diese Domain nicht aktiviert",
+		"validation_failed":             "Einige Felder sind ungültig",
+		"subdomain_limit_reached":       "Diese Domain hat ihr Limit von {limit} Subdomains erreicht",
+		"dns_record_limit_reached":      "Diese Domain hat ihr Limit von {limit} DNS-Einträgen erreicht",
+		"dns_record_type_limit_reached": "Diese Domain hat ihr Limit von {limit} {type}-Einträgen erreicht",
+		"capacity_overcommit":           "Der Server kann dieses {resource}-Kontingent nicht aufnehmen: die Zuteilungen würden {percent}% seiner Kapazität übersteigen",
+		"registration_disabled":         "Die Registrierung ist geschlossen; bitten Sie einen Administrator um ein Konto",
+		"resource_modified":             "Diese Ressource ({resource}) wurde seit dem Laden geändert; laden Sie sie neu und versuchen Sie es erneut",
+		"database_quota_exceeded":       "Die Datenbank {name} hat ihr Speicherkontingent erreicht; Importe sind gesperrt, bis sie kleiner wird oder das Kontingent erhöht wird",
+		"user_database_quota_exceeded":  "Ihre Datenbanken belegen {used} MB von {quota} MB; geben Sie Speicher frei, bevor Sie eine weitere anlegen",
+		"disk_quota_exceeded":           "{name} hat das Speicherkontingent erreicht; Uploads sind gesperrt, bis Speicher freigegeben oder das Kontingent erhöht wird",
+		"upload_over_quota":             "Dieser Upload von {size} passt nicht in die verbleibenden {free} des Speicherkontingents von {name}",
+		"upload_offset_mismatch":        "Der Upload hat {offset} Bytes erhalten; setzen Sie ihn dort fort",
+		"upload_busy":                   "Ein anderer Teil dieses Uploads wird gerade geschrieben; versuchen Sie es danach erneut",
+		"resource_busy":                 "Für diese {resource} läuft bereits ein anderer Vorgang; versuchen Sie es danach erneut",
+		"deliverability_test_limit":     "Die Zustellbarkeit einer Domain kann {limit}-mal pro Stunde getestet werden; versuchen Sie es später erneut",
+		"credential_check_limit":        "Das Passwort eines Postfachs kann {limit}-mal alle {minutes} Minuten geprüft werden; versuchen Sie es später erneut",
+		"opcache_reset_disabled":        "Das Zurücksetzen des Opcache ist auf diesem Server nicht aktiviert",
+		"vault_unavailable":             "Der Tresor ist nicht verfügbar: auf diesem Server ist kein Schlüssel konfiguriert",
+		"vault_limit_reached":           "Ihr Tresor hat sein Limit von {limit} Einträgen erreicht",
+		"abuse_transition":              "Eine Missbrauchsmeldung kann nicht von {from} zu {to} wechseln",
+		"abuse_no_target":               "{target} ist keine hier gehostete Domain; es kann nichts gesperrt werden",
+		"acme_disabled":                 "Zertifikate können nicht ausgestellt werden: kein ACME-Server konfiguriert",
+		"acme_challenge_failed":         "Der ACME-Server konnte {name} nicht über {type} prüfen: {error}",
+		"acme_challenge_unsupported":    "Der ACME-Server bietet für {name} keine Prüfung an, die das Panel beantworten kann",
+		"domain_not_suspended":          "{name} ist nicht gesperrt",
+		"domain_path_exists":            "{path} existiert bereits; verschieben Sie es, bevor Sie die Domain umbenennen",
+		"https_requires_certificate":    "Für {name} ist kein SSL-Zertifikat installiert; installieren Sie eines, bevor Sie HTTPS erzwingen",
+		"two_factor_enrolled":           "Eine Authenticator-App ist bereits eingerichtet; deaktivieren Sie die Zwei-Faktor-Authentifizierung, bevor Sie eine weitere einrichten",
+		"two_factor_setup_missing":      "Es gibt keine offene Einrichtung der Zwei-Faktor-Authentifizierung, oder sie ist abgelaufen; beginnen Sie die Einrichtung erneut",
+		"ssh_key_change_limit":          "Zu viele Änderungen an SSH-Schlüsseln in der letzten Stunde; versuchen Sie es später erneut",
+		"backup_no_databases":           "Diese Domain hat keine Datenbanken, die gesichert werden können",
+		"backup_not_restorable":         "Nur abgeschlossene Sicherungen einer Domain können wiederhergestellt werden",
+		"last_admin":                    "Der letzte aktive Administrator kann nicht deaktiviert werden; geben Sie zuerst einem anderen aktiven Konto die Administratorrolle",
+
+		"field.required":          "ist erforderlich",
+		"field.unknown":           "unbekanntes Feld",
+		"field.null":              "darf nicht null sein",
+		"field.object":            "muss ein Objekt sein",
+		"field.array":             "muss eine Liste sein",
+		"field.string":            "muss eine Zeichenkette sein",
+		"field.number":            "muss eine Zahl sein",
+		"field.integer":           "muss eine ganze Zahl sein",
+		"field.boolean":           "muss ein Wahrheitswert sein",
+		"field.empty":             "darf nicht leer sein",
+		"field.min_length":        "muss mindestens {min} Zeichen lang sein",
+		"field.max_length":        "darf höchstens {max} Zeichen lang sein",
+		"field.minimum":           "muss mindestens {min} sein",
+		"field.maximum":           "darf höchstens {max} sein",
+		"field.uuid":              "muss eine UUID sein",
+		"field.format":            "hat ein ungültiges Format",
+		"field.enum":              "muss einer der Werte {values} sein",
+		"field.locale":            "muss eine der unterstützten Sprachen sein: {locales}",
+		"domain.invalid":          "ungültiger Domainname",
+		"domain.exists":           "Domain existiert bereits",
+		"domain.unchanged":        "die Domain hat bereits diesen Namen",
+		"subdomain.invalid":       "Subdomain muss ein einzelnes Label aus Kleinbuchstaben, Ziffern und Bindestrichen sein",
+		"subdomain.reserved":      "Subdomain \"{name}\" ist reserviert",
+		"subdomain.exists":        "Subdomain existiert bereits",
+		"subdomain.root_outside":  "muss ein Verzeichnis innerhalb von {dir} sein",
+		"dns.nameserver_invalid":  "Nameserver \"{name}\" muss ein vollständiger Hostname sein",
+		"dns.ns_minimum":          "{name} benötigt mindestens {min} Nameserver",
+		"dns.cname_apex":          "ein CNAME-Eintrag ist an der Zonenspitze nicht erlaubt",
+		"dns.cname_conflict":      "{name} kann nicht zugleich einen CNAME- und NS-Einträge haben",
+		"dns.glue_required":       "Nameserver {name} liegt in der delegierten Domain und benötigt einen A- oder AAAA-Eintrag",
+		"dns.zone_invalid":        "ungültige Zonendatei: {error}",
+		"dns.archive_invalid":     "muss ein ZIP-Archiv mit Zonendateien sein",
+		"dns.template_exists":     "eine DNS-Vorlage mit diesem Namen existiert bereits",
+		"dns.archive_too_large":   "das Archiv darf höchstens {max} Zonendateien enthalten",
+		"dns.zone_too_large":      "Zonendateien dürfen höchstens {max} Byte groß sein",
+		"dns.zone_foreign":        "{name} gehört zu einem anderen Konto",
+		"dns.zone_domain_missing": "Domain nicht gefunden; erlauben Sie das Anlegen fehlender Domains, um {name} zu importieren",
+		"dns.bulk_empty":          "wählen Sie mindestens einen Eintrag zum Löschen aus",
+		"dns.bulk_too_many":       "es können höchstens {max} Einträge auf einmal gelöscht werden",
+		"dns.soa_managed":         "der SOA-Eintrag wird vom Panel verwaltet",
+		"dns.ttl_range":           "muss zwischen {min} und {max} Sekunden liegen",
+		"dns.bulk_protected":      "das Löschen von {records} erfordert force, da die Domain sonst nicht mehr auflösen könnte",
+		"dns.bulk_token":          "das Bestätigungstoken ist ungültig oder abgelaufen; lassen Sie die Löschung erneut anzeigen",
+		"dns.bulk_mismatch":       "das Bestätigungstoken gilt für eine andere Auswahl; lassen Sie die Löschung erneut anzeigen",
+		"batch.empty":             "fügen Sie mindestens eine Operation hinzu",
+		"batch.too_many":          "ein Batch kann höchstens {max} Operationen ausführen",
+		"batch.unknown_op":        "unbekannte Operation \"{op}\"",
+		"batch.params":            "ungültige Parameter: {error}",
+		"ssl.format_unknown":      "muss ein PEM- oder DER-Zertifikat oder ein PKCS#12-Bundle sein",
+		"ssl.cert_invalid":        "enthält kein gültiges Zertifikat",
+		"ssl.password":            "das PKCS#12-Passwort ist falsch",
+		"ssl.pkcs12_unsupported":  "das PKCS#12-Bundle kann nicht gelesen werden ({error}); exportieren Sie es mit älterer Verschlüsselung oder als PEM",
+		"ssl.key_missing":         "ein privater Schlüssel ist erforderlich, im Bundle oder separat hochgeladen",
+		"ssl.key_invalid":         "muss ein privater PKCS#8-, PKCS#1- oder EC-Schlüssel sein",
+		"ssl.key_encrypted":       "der private Schlüssel ist verschlüsselt; laden Sie ihn ohne Passphrase hoch",
+		"ssl.key_mismatch":        "der private Schlüssel gehört zu keinem der Zertifikate",
+		"ssl.name_outside":        "\"{name}\" ist weder {domain} noch ein Name darunter",
+		"ssl.name_apex":           "muss {domain} selbst enthalten",
+		"ssl.too_many_names":      "ein Zertifikat deckt höchstens {max} Namen ab",
+		"php.version_missing":     "PHP {version} ist nicht installiert",
+		"php.version_invalid":     "muss eine PHP-Version wie 8.3 sein",
+		"php.extension_unknown":   "unbekannte PHP-{version}-Erweiterung \"{name}\"; verfügbar: {available}",
+		"php.version_removed":     "PHP {version} wurde am {date} abgeschaltet und kann nicht mehr gewählt werden",
+		"php.error_log_outside":   "muss ein Dateipfad in {dir} sein",
+		"php.error_log_public":    "darf nicht im Document-Root {dir} liegen, der das Log an Besucher ausliefern würde",
+		"vault.name_invalid":      "muss 1 bis {max} Zeichen in einer Zeile lang sein",
+		"vault.too_large":         "darf höchstens {max} Bytes lang sein",
+		"abuse.contact_required":  "ist für Meldungen ohne Konto erforderlich",
+		"abuse.target_invalid":    "muss eine Domain oder URL sein",
+		"upload.path":             "muss ein Dateipfad im Verzeichnis der Domain sein",
+		"upload.too_long":         "ist länger als die für den Upload angekündigten {size} Bytes",
+		"ftp.username_invalid":    "FTP-Benutzername muss aus 1 bis 32 Kleinbuchstaben, Ziffern, Punkten, Binde- oder Unterstrichen bestehen",
+		"ftp.username_taken":      "FTP-Benutzername ist bereits vergeben",
+		"ftp.home_outside":        "Home-Verzeichnis muss innerhalb von {root} liegen",
+		"user.username_required":  "Benutzername ist erforderlich",
+		"user.username_taken":     "Benutzername ist bereits vergeben",
+		"user.username_reserved":  "Benutzername \"{name}\" ist reserviert",
+		"user.invite_required":    "für die Registrierung ist ein Einladungscode erforderlich",
+		"user.invite_invalid":     "Einladungscode ist ungültig, abgelaufen oder aufgebraucht",
+		"user.email_invalid":      "ungültige E-Mail-Adresse",
+		"user.email_taken":        "E-Mail-Adresse ist bereits registriert",
+		"user.password_reused":    "darf keinem Ihrer letzten {count} Passwörter entsprechen",
+		"user.password_wrong":     "aktuelles Passwort ist falsch",
+		"user.email_unchanged":    "dies ist bereits Ihre E-Mail-Adresse",
+		"user.email_change":       "E-Mail-Adressen werden durch Bestätigung der neuen Adresse geändert",
+		"user.email_token":        "Bestätigungslink ist ungültig oder abgelaufen",
+		"user.ip_range_invalid":   "\"{range}\" ist keine IP-Adresse und kein CIDR-Bereich",
+		"user.country_invalid":    "\"{code}\" ist kein zweistelliger Ländercode",
+		"user.geoip_missing":      "Länder können nur mit einer konfigurierten GeoIP-Datenbank eingeschränkt werden",
+		"user.mfa_unavailable":    "Zwei-Faktor-Methode \"{method}\" ist nicht verfügbar",
+		"user.mfa_not_enrolled":   "Zwei-Faktor-Methode \"{method}\" ist nicht eingerichtet",
+		"user.mfa_unverified":     "bestätigen Sie Ihre E-Mail-Adresse, bevor Sie Anmeldecodes per E-Mail erhalten",
+		"user.mfa_code_invalid":   "der Zwei-Faktor-Code ist ungültig",
+		"ssh_key.name_invalid":    "muss 1 bis {max} Zeichen auf einer Zeile lang sein",
+		"ssh_key.single_line":     "muss eine einzelne Zeile sein",
+		"ssh_key.invalid":         "ist kein gültiger öffentlicher SSH-Schlüssel",
+		"ssh_key.options":         "darf keine Schlüsseloptionen enthalten",
+		"ssh_key.dsa":             "DSA-Schlüssel werden nicht unterstützt",
+		"ssh_key.rsa_bits":        "RSA-Schlüssel müssen mindestens {bits} Bit lang sein",
+		"ssh_key.exists":          "dieser Schlüssel wurde bereits hinzugefügt",
+		"node.ipv4_invalid":       "muss eine IPv4-Adresse sein",
+		"node.ipv6_invalid":       "muss eine IPv6-Adresse sein",
+		"node.role_unknown":       "unbekannte Serverrolle \"{role}\"",
+		"node.endpoint_invalid":   "muss eine http- oder https-URL sein",
+		"notify.event_unknown":    "unbekannte Benachrichtigungsart \"{type}\"",
+		"notify.urgent":           "{type}-Benachrichtigungen werden immer sofort per E-Mail gesendet",
+
+		"quota.alert.subject":   "{name} hat {threshold}% des {metric}-Kontingents verbraucht",
+		"quota.alert.body":      "{name} belegt {usage} von {quota} des {metric}-Kontingents.",
+		"quota.blocked.disk":    "Uploads sind gesperrt, bis Speicher freigegeben oder das Kontingent erhöht wird.",
+		"quota.blocked.mailbox": "Eingehende E-Mails werden abgelehnt, bis Speicher freigegeben oder das Kontingent erhöht wird.",
+		"php.eol.subject":       "PHP {version} von {name} ist veraltet",
+		"php.eol.body":          "{name} verwendet PHP {version}, das veraltet ist. Ab dem {date} kann es nicht mehr gewählt werden.",
+		"php.eol.upgrade":       "Bitte stellen Sie {name} auf PHP {replacement} um.",
+		"send.blocked.subject":  "Ausgehende E-Mails von {name} wurden gesperrt",
+		"send.blocked.body":     "{name} hat innerhalb von {window} an {count} Empfänger gesendet, mehr als das Limit von {limit}. Ausgehende E-Mails bleiben gesperrt, bis ein Administrator die Sperre aufhebt.",
+		"service.down.subject":  "{service} ist ausgefallen und konnte nicht neu gestartet werden",
+		"service.down.body":     "{service} ist ausgefallen und {attempts} Neustarts haben den Dienst nicht wiederhergestellt; der letzte Fehler war: {error}. Der Watchdog startet ihn erst wieder neu, wenn er läuft.",
+		"abuse.report.subject":  "Neue Missbrauchsmeldung ({category}) zu {target}",
+		"abuse.report.body":     "Eine Missbrauchsmeldung ({category}) zu {target} wurde eingereicht und wartet unter Meldung {id} auf Bearbeitung.",
+		"password.due.subject":  "Ihr Passwort läuft am {date} ab",
+		"password.due.body":     "Das Passwort von {username} läuft am {date} ab. Bitte ändern Sie es vorher; danach können Sie sich nur noch anmelden, um es zu ändern.",
+		"term.disk":             "Speicher",
+		"term.bandwidth":        "Bandbreiten",
+		"term.mailbox":          "Postfach",
+		"term.domain":           "Domain",
+		"term.subdomain":        "Subdomain",
+		"term.redirect":         "Weiterleitung",
+		"term.database":         "Datenbank",
+		"term.user":             "Benutzer",
+		"term.email":            "E-Mail",
+		"term.databases":        "Datenbanken",
+		"term.custom_dns":       "Eigenes DNS",
+	},
+}
@@ -0,0 +1,106 @@
+// Package i18n translates user-facing messages. Messages are looked up by code in per-locale
+// catalogs and fall back to English when a locale or a translation is missing.
+package i18n
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLocale is used when no supported locale was requested, and for missing translations
+const DefaultLocale = "en"
+
+// Supported reports whether there is a catalog for the locale
+func Supported(locale string) bool {
+	_, ok := catalogs[locale]
+	return ok
+}
+
+// Locales returns the supported locales, sorted
+func Locales() []string {
+	locales := make([]string, 0, len(catalogs))
+	for locale := range catalogs {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Translate renders the message for code in the locale. Placeholders such as {resource} are
+// replaced from params. A code without a translation in the locale is rendered in English; a code
+// without any translation is returned as is.
+func Translate(locale, code string, params map[string]string) string {
+	message, ok := catalogs[locale][code]
+	if !ok {
+		message, ok = catalogs[DefaultLocale][code]
+	}
+	if !ok {
+		return code
+	}
+
+	if len(params) == 0 {
+		return message
+	}
+	replacements := make([]string, 0, 2*len(params))
+	for name, value := range params {
+		replacements = append(replacements, "{"+name+"}", value)
+	}
+	return strings.NewReplacer(replacements...).Replace(message)
+}
+
+// Term translates a word substituted into messages, such as a resource name, returning it
+// unchanged when there is no translation
+func Term(locale, word string) string {
+	if message, ok := catalogs[locale]["term."+word]; ok {
+		return message
+	}
+	if message, ok := catalogs[DefaultLocale]["term."+word]; ok {
+		return message
+	}
+	return word
+}
+
+// Resolve picks the locale of a request: the user's stored preference when it is supported,
+// otherwise the best match of the Accept-Language header, otherwise DefaultLocale
+func Resolve(preference, acceptLanguage string) string {
+	if preference = Normalize(preference); Supported(preference) {
+		return preference
+	}
+	return Negotiate(acceptLanguage)
+}
+
+// Negotiate returns the supported locale the Accept-Language header prefers most. Regional tags
+// match their language ("de-AT" selects "de").
+func Negotiate(acceptLanguage string) string {
+	best, bestQuality := DefaultLocale, 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+
+		locale := Normalize(tag)
+		if Supported(locale) && quality > bestQuality {
+			best, bestQuality = locale, quality
+		}
+	}
+	return best
+}
+
+// Normalize reduces a language tag to the lower-case language it names ("pt-BR" becomes "pt")
+func Normalize(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if language, _, ok := strings.Cut(tag, "-"); ok {
+		return language
+	}
+	if language, _, ok := strings.Cut(tag, "_"); ok {
+		return language
+	}
+	return tag
+}
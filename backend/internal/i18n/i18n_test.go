@@ -0,0 +1,115 @@
+package i18n
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestTranslate(t *testing.T) {
+	tests := []struct {
+		name   string
+		locale string
+		code   string
+		params map[string]string
+		want   string
+	}{
+		{"english", "en", "not_found", map[string]string{"resource": "domain"}, "domain not found"},
+		{"german", "de", "not_found", map[string]string{"resource": "Domain"}, "Domain nicht gefunden"},
+		{"unsupported locale", "fr", "field.required", nil, "is required"},
+		{"several placeholders", "en", "dns_record_type_limit_reached", map[string]string{"limit": "5", "type": "MX"}, "This domain has reached its limit of 5 MX records"},
+		{"unknown code", "de", "no.such.code", nil, "no.such.code"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Translate(tt.locale, tt.code, tt.params); got != tt.want {
+				t.Errorf("Translate(%s, %s) = %q, want %q", tt.locale, tt.code, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTerm(t *testing.T) {
+	if got := Term("de", "mailbox"); got != "Postfach" {
+		t.Errorf("Term(de, mailbox) = %q, want Postfach", got)
+	}
+	if got := Term("fr", "mailbox"); got != "mailbox" {
+		t.Errorf("Term(fr, mailbox) = %q, want the English term", got)
+	}
+	if got := Term("de", "widget"); got != "widget" {
+		t.Errorf("Term(de, widget) = %q, want the word unchanged", got)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", "en"},
+		{"de", "de"},
+		{"de-AT,de;q=0.9,en;q=0.8", "de"},
+		{"en-US,en;q=0.9,de;q=0.8", "en"},
+		{"fr-FR,fr;q=0.9,de;q=0.5", "de"},
+		{"en;q=0.2, de;q=0.7", "de"},
+		{"de;q=bad, en;q=0.1", "en"},
+		{"fr, it", "en"},
+		{"DE_de", "de"},
+	}
+	for _, tt := range tests {
+		if got := Negotiate(tt.header); got != tt.want {
+			t.Errorf("Negotiate(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		preference, header, want string
+	}{
+		{"de", "en-US", "de"},
+		{"de-CH", "", "de"},
+		{"", "de", "de"},
+		{"fr", "de", "de"},
+		{"", "", DefaultLocale},
+	}
+	for _, tt := range tests {
+		if got := Resolve(tt.preference, tt.header); got != tt.want {
+			t.Errorf("Resolve(%q, %q) = %q, want %q", tt.preference, tt.header, got, tt.want)
+		}
+	}
+}
+
+var placeholder = regexp.MustCompile(`\{[a-z_]+\}`)
+
+func TestCatalogs(t *testing.T) {
+	english := catalogs[DefaultLocale]
+	for _, locale := range Locales() {
+		for code, message := range catalogs[locale] {
+			source, ok := english[code]
+			if !ok {
+				t.Errorf("%s message %s has no English original", locale, code)
+				continue
+			}
+
+			// Translations must use the placeholders of the original
+			want := map[string]bool{}
+			for _, name := range placeholder.FindAllString(source, -1) {
+				want[name] = true
+			}
+			got := map[string]bool{}
+			for _, name := range placeholder.FindAllString(message, -1) {
+				got[name] = true
+			}
+			for name := range want {
+				if !got[name] {
+					t.Errorf("%s message %s lacks %s", locale, code, name)
+				}
+			}
+			for name := range got {
+				if !want[name] {
+					t.Errorf("%s message %s has unknown placeholder %s", locale, code, name)
+				}
+			}
+		}
+	}
+}
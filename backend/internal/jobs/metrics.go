@@ -0,0 +1,76 @@
+package jobs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// MetricsContentType is the content type of the Prometheus text format written by WriteMetrics
+const MetricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// metric is one gauge or counter of the job metrics, with its value for a job
+type metric struct {
+	name  string
+	kind  string
+	help  string
+	value func(status Status) (float64, bool) // false leaves the job out, e.g. before its first run
+}
+
+var metrics = []metric{
+	{"mynodecp_job_runs_total", "counter", "Runs of the job since the panel started.",
+		func(st Status) (float64, bool) { return float64(st.Runs), true }},
+	{"mynodecp_job_failures_total", "counter", "Failed runs of the job since the panel started.",
+		func(st Status) (float64, bool) { return float64(st.Failures), true }},
+	{"mynodecp_job_running", "gauge", "Whether the job is running.",
+		func(st Status) (float64, bool) { return boolValue(st.Running), true }},
+	{"mynodecp_job_overdue", "gauge", "Whether the job has gone too many intervals without a finished run.",
+		func(st Status) (float64, bool) { return boolValue(st.Overdue), true }},
+	{"mynodecp_job_interval_seconds", "gauge", "Interval the job is scheduled at; 0 for jobs only run on demand.",
+		func(st Status) (float64, bool) { return st.Interval.Seconds(), true }},
+	{"mynodecp_job_last_run_timestamp_seconds", "gauge", "Unix time the last run of the job started.",
+		func(st Status) (float64, bool) { return timestamp(st.LastRunAt) }},
+	{"mynodecp_job_last_duration_seconds", "gauge", "Duration of the last run of the job.",
+		func(st Status) (float64, bool) { return st.LastDuration.Seconds(), st.LastRunAt != nil }},
+	{"mynodecp_job_last_success", "gauge", "Whether the last run of the job succeeded.",
+		func(st Status) (float64, bool) { return boolValue(st.LastError == ""), st.LastRunAt != nil }},
+	{"mynodecp_job_next_run_timestamp_seconds", "gauge", "Unix time the job is next scheduled to run.",
+		func(st Status) (float64, bool) { return timestamp(st.NextRunAt) }},
+}
+
+// WriteMetrics writes the status of every job in the Prometheus text exposition format
+func (s *Scheduler) WriteMetrics(w io.Writer) error {
+	statuses := s.Statuses()
+
+	b := bufio.NewWriter(w)
+	for _, m := range metrics {
+		fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		for _, status := range statuses {
+			if value, ok := m.value(status); ok {
+				fmt.Fprintf(b, "%s{job=\"%s\"} %g\n", m.name, labelValue(status.Name), value)
+			}
+		}
+	}
+	return b.Flush()
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func timestamp(t *time.Time) (float64, bool) {
+	if t == nil {
+		return 0, false
+	}
+	return float64(t.UnixNano()) / 1e9, true
+}
+
+// labelValue escapes a label value as the text format requires
+func labelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
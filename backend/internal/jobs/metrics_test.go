@@ -0,0 +1,70 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	scheduler := NewScheduler(zap.NewNop(), 3)
+	now := time.Unix(1700000000, 0)
+	scheduler.now = func() time.Time { return now }
+	scheduler.Register("backup", time.Hour, func(ctx context.Context) error {
+		now = now.Add(1500 * time.Millisecond)
+		return errors.New("disk full")
+	})
+	scheduler.Register(`odd "name"`, 0, func(ctx context.Context) error { return nil })
+	scheduler.RunNow(context.Background(), "backup")
+
+	var out strings.Builder
+	if err := scheduler.WriteMetrics(&out); err != nil {
+		t.Fatalf("WriteMetrics() error = %v", err)
+	}
+	text := out.String()
+
+	for _, line := range []string{
+		"# TYPE mynodecp_job_runs_total counter",
+		"# TYPE mynodecp_job_overdue gauge",
+		`mynodecp_job_runs_total{job="backup"} 1`,
+		`mynodecp_job_failures_total{job="backup"} 1`,
+		`mynodecp_job_running{job="backup"} 0`,
+		`mynodecp_job_interval_seconds{job="backup"} 3600`,
+		`mynodecp_job_last_run_timestamp_seconds{job="backup"} 1.7e+09`,
+		`mynodecp_job_last_duration_seconds{job="backup"} 1.5`,
+		`mynodecp_job_last_success{job="backup"} 0`,
+		`mynodecp_job_runs_total{job="odd \"name\""} 0`,
+	} {
+		if !strings.Contains(text, line+"\n") {
+			t.Errorf("metrics lack %q:\n%s", line, text)
+		}
+	}
+
+	// A job that has not run has no last run metrics, and none is scheduled before the start
+	for _, name := range []string{"last_run_timestamp_seconds", "last_duration_seconds", "last_success"} {
+		if strings.Contains(text, "mynodecp_job_"+name+`{job="odd`) {
+			t.Errorf("%s reported for a job that never ran", name)
+		}
+	}
+	if strings.Contains(text, "mynodecp_job_next_run_timestamp_seconds{") {
+		t.Error("next run reported before the scheduler started")
+	}
+}
+
+func TestLabelValue(t *testing.T) {
+	tests := []struct{ value, want string }{
+		{"backup", "backup"},
+		{`a"b`, `a\"b`},
+		{`a\b`, `a\\b`},
+		{"a\nb", `a\nb`},
+	}
+	for _, tt := range tests {
+		if got := labelValue(tt.value); got != tt.want {
+			t.Errorf("labelValue(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+// Package jobs runs the panel's periodic maintenance work, such as purging expired sessions and
+// old logs, from one scheduler. Each job has its own interval, can be triggered on demand and
+// reports the outcome of its last run. Jobs that stop finishing runs are reported as overdue.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/tracing"
+)
+
+var (
+	// ErrUnknownJob is returned when triggering a job that is not registered
+	ErrUnknownJob = errors.New("unknown job")
+	// ErrJobRunning is returned when triggering a job that is already running
+	ErrJobRunning = errors.New("job is already running")
+)
+
+// jobNameKey is the span attribute naming the job a run belongs to
+const jobNameKey = attribute.Key("job.name")
+
+// Func is the work of a job
+type Func func(ctx context.Context) error
+
+// Status describes a job and its last run
+type Status struct {
+	Name         string        `json:"name"`
+	Interval     time.Duration `json:"interval"`
+	Running      bool          `json:"running"`
+	RunningSince *time.Time    `json:"running_since,omitempty"`
+	LastRunAt    *time.Time    `json:"last_run_at,omitempty"`
+	LastDuration time.Duration `json:"last_duration"`
+	LastError    string        `json:"last_error,omitempty"`
+	NextRunAt    *time.Time    `json:"next_run_at,omitempty"`
+	Runs         int           `json:"runs"`
+	Failures     int           `json:"failures"`
+	Overdue      bool          `json:"overdue"` // No run finished within the overdue intervals
+}
+
+type job struct {
+	fn      Func
+	running sync.Mutex
+	status  Status
+	overdue bool // Last reported overdue state, to log transitions once
+}
+
+// watchdogInterval is how often the scheduler looks for overdue jobs
+const watchdogInterval = time.Minute
+
+// Scheduler runs registered jobs on their intervals
+type Scheduler struct {
+	logger *zap.Logger
+
+	mu        sync.Mutex
+	jobs      map[string]*job
+	started   bool
+	startedAt time.Time
+	now       func() time.Time
+
+	overdueIntervals int
+}
+
+// NewScheduler creates an empty scheduler. A scheduled job is overdue once overdueIntervals of
+// its intervals pass without a finished run.
+func NewScheduler(logger *zap.Logger, overdueIntervals int) *Scheduler {
+	return &Scheduler{
+		logger: logger,
+		jobs:   make(map[string]*job),
+		now:    time.Now,
+
+		overdueIntervals: overdueIntervals,
+	}
+}
+
+// Register adds a job that runs every interval once the scheduler starts. A non-positive
+// interval registers a job that only runs when triggered.
+func (s *Scheduler) Register(name string, interval time.Duration, fn Func) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		panic(fmt.Sprintf("jobs: %s registered after the scheduler started", name))
+	}
+	if _, ok := s.jobs[name]; ok {
+		panic(fmt.Sprintf("jobs: %s registered twice", name))
+	}
+
+	s.jobs[name] = &job{fn: fn, status: Status{Name: name, Interval: interval}}
+}
+
+// Run starts every job's schedule and the overdue watchdog, and blocks until ctx is cancelled.
+// Jobs first run one interval after the start.
+func (s *Scheduler) Run(ctx context.Context) {
+	s.mu.Lock()
+	s.started = true
+	s.startedAt = s.now()
+	jobs := make([]*job, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		jobs = append(jobs, j)
+	}
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.watch(ctx)
+	}()
+
+	for _, j := range jobs {
+		if j.status.Interval <= 0 {
+			continue
+		}
+
+		wg.Add(1)
+		go func(j *job) {
+			defer wg.Done()
+			s.schedule(ctx, j)
+		}(j)
+	}
+
+	wg.Wait()
+}
+
+// RunNow runs a job immediately and returns its error. The run is detached from ctx's
+// cancellation, so a job triggered by a request finishes even when the client goes away.
+func (s *Scheduler) RunNow(ctx context.Context, name string) error {
+	s.mu.Lock()
+	j, ok := s.jobs[name]
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownJob, name)
+	}
+
+	if !j.running.TryLock() {
+		return ErrJobRunning
+	}
+	defer j.running.Unlock()
+
+	return s.execute(context.WithoutCancel(ctx), j)
+}
+
+// Statuses returns the status of every job, ordered by name
+func (s *Scheduler) Statuses() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	statuses := make([]Status, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		status := j.status
+		status.Overdue = s.isOverdue(j, now)
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(a, b int) bool { return statuses[a].Name < statuses[b].Name })
+
+	return statuses
+}
+
+// schedule runs a job every interval, skipping ticks while a triggered run is still going
+func (s *Scheduler) schedule(ctx context.Context, j *job) {
+	ticker := time.NewTicker(j.status.Interval)
+	defer ticker.Stop()
+
+	s.setNextRun(j)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if j.running.TryLock() {
+			s.execute(ctx, j)
+			j.running.Unlock()
+		}
+		s.setNextRun(j)
+	}
+}
+
+// execute runs a job once and records the outcome; the caller holds the job's running lock
+func (s *Scheduler) execute(ctx context.Context, j *job) (err error) {
+	// Deferred first so the span also ends failed when the job panics
+	ctx, span := tracing.Start(ctx, "job "+j.status.Name, jobNameKey.String(j.status.Name))
+	defer tracing.End(span, &err)
+
+	start := s.now()
+	s.mu.Lock()
+	j.status.Running = true
+	j.status.RunningSince = &start
+	s.mu.Unlock()
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+
+		s.mu.Lock()
+		j.status.Running = false
+		j.status.RunningSince = nil
+		j.status.LastRunAt = &start
+		j.status.LastDuration = s.now().Sub(start)
+		j.status.Runs++
+		j.status.LastError = ""
+		if err != nil {
+			j.status.LastError = err.Error()
+			j.status.Failures++
+		}
+		s.mu.Unlock()
+
+		if err != nil {
+			s.logger.Error("Job failed", zap.String("job", j.status.Name), zap.Error(err))
+		}
+	}()
+
+	return j.fn(ctx)
+}
+
+func (s *Scheduler) setNextRun(j *job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next := s.now().Add(j.status.Interval)
+	j.status.NextRunAt = &next
+}
+
+// watch checks for overdue jobs every watchdogInterval until ctx is cancelled
+func (s *Scheduler) watch(ctx context.Context) {
+	ticker := time.NewTicker(watchdogInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.checkOverdue()
+	}
+}
+
+// checkOverdue logs jobs that became overdue, and those that finished a run again, once each
+func (s *Scheduler) checkOverdue() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for _, j := range s.jobs {
+		overdue := s.isOverdue(j, now)
+		if overdue == j.overdue {
+			continue
+		}
+		j.overdue = overdue
+
+		if overdue {
+			fields := []zap.Field{zap.String("job", j.status.Name), zap.Duration("interval", j.status.Interval)}
+			if j.status.LastRunAt != nil {
+				fields = append(fields, zap.Time("last_run_at", *j.status.LastRunAt))
+			}
+			if j.status.RunningSince != nil {
+				fields = append(fields, zap.Time("running_since", *j.status.RunningSince))
+			}
+			s.logger.Error("Job overdue", fields...)
+		} else {
+			s.logger.Info("Job no longer overdue", zap.String("job", j.status.Name))
+		}
+	}
+}
+
+// isOverdue reports whether a scheduled job has gone overdueIntervals of its intervals without a
+// finished run, counting from the scheduler's start for jobs that have not run yet. The caller
+// holds s.mu.
+func (s *Scheduler) isOverdue(j *job, now time.Time) bool {
+	if !s.started || j.status.Interval <= 0 || s.overdueIntervals <= 0 {
+		return false
+	}
+
+	finished := s.startedAt
+	if j.status.LastRunAt != nil {
+		finished = j.status.LastRunAt.Add(j.status.LastDuration)
+	}
+	return now.Sub(finished) > time.Duration(s.overdueIntervals)*j.status.Interval
+}
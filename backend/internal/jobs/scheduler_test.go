@@ -0,0 +1,162 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRunNowIsDetachedFromTheCaller(t *testing.T) {
+	scheduler := NewScheduler(zap.NewNop(), 3)
+	var jobErr error
+	scheduler.Register("cleanup", 0, func(ctx context.Context) error {
+		jobErr = ctx.Err()
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := scheduler.RunNow(ctx, "cleanup"); err != nil {
+		t.Fatalf("run now: %v", err)
+	}
+	if jobErr != nil {
+		t.Errorf("job ran with a cancelled context: %v", jobErr)
+	}
+}
+
+func TestRunNow(t *testing.T) {
+	scheduler := NewScheduler(zap.NewNop(), 3)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	scheduler.Register("slow", 0, func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	})
+	scheduler.Register("broken", time.Hour, func(ctx context.Context) error {
+		panic("boom")
+	})
+
+	if err := scheduler.RunNow(context.Background(), "missing"); !errors.Is(err, ErrUnknownJob) {
+		t.Errorf("unknown job: err = %v", err)
+	}
+
+	done := make(chan error)
+	go func() { done <- scheduler.RunNow(context.Background(), "slow") }()
+	<-started
+	if err := scheduler.RunNow(context.Background(), "slow"); !errors.Is(err, ErrJobRunning) {
+		t.Errorf("second run: err = %v, want already running", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Errorf("first run: %v", err)
+	}
+
+	if err := scheduler.RunNow(context.Background(), "broken"); err == nil {
+		t.Error("panicking job reported success")
+	}
+	for _, status := range scheduler.Statuses() {
+		if status.Name == "broken" && (status.Failures != 1 || status.LastError == "") {
+			t.Errorf("status of the panicking job = %+v", status)
+		}
+	}
+}
+
+func TestOverdue(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	scheduler := NewScheduler(zap.New(core), 3)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	scheduler.now = func() time.Time { return now }
+	scheduler.Register("purge", time.Hour, func(ctx context.Context) error {
+		now = now.Add(time.Minute)
+		return nil
+	})
+	scheduler.Register("manual", 0, func(ctx context.Context) error { return nil })
+
+	overdue := func(name string) bool {
+		for _, status := range scheduler.Statuses() {
+			if status.Name == name {
+				return status.Overdue
+			}
+		}
+		t.Fatalf("no status for %s", name)
+		return false
+	}
+
+	// Nothing is overdue before the scheduler starts
+	now = now.Add(10 * time.Hour)
+	if overdue("purge") {
+		t.Error("job overdue before the scheduler started")
+	}
+
+	scheduler.started = true
+	scheduler.startedAt = now
+	now = now.Add(3 * time.Hour)
+	if overdue("purge") {
+		t.Error("job overdue at exactly three intervals")
+	}
+	now = now.Add(time.Second)
+	if !overdue("purge") {
+		t.Error("job not overdue after three intervals without a run")
+	}
+	if overdue("manual") {
+		t.Error("job without an interval overdue")
+	}
+
+	scheduler.checkOverdue()
+	scheduler.checkOverdue()
+	if got := logs.FilterMessage("Job overdue").Len(); got != 1 {
+		t.Errorf("%d overdue logs, want 1 per transition", got)
+	}
+
+	// A finished run clears it, counted from the end of the run
+	if err := scheduler.RunNow(context.Background(), "purge"); err != nil {
+		t.Fatalf("run now: %v", err)
+	}
+	now = now.Add(3*time.Hour - time.Second)
+	if overdue("purge") {
+		t.Error("job overdue within three intervals of its last run")
+	}
+	scheduler.checkOverdue()
+	if got := logs.FilterMessage("Job no longer overdue").Len(); got != 1 {
+		t.Errorf("%d recovery logs, want 1", got)
+	}
+	now = now.Add(2 * time.Second)
+	if !overdue("purge") {
+		t.Error("job not overdue three intervals after the end of its last run")
+	}
+}
+
+func TestRunNowRecordsStatus(t *testing.T) {
+	scheduler := NewScheduler(zap.NewNop(), 3)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	scheduler.now = func() time.Time { return now }
+	fail := true
+	scheduler.Register("sync", time.Hour, func(ctx context.Context) error {
+		now = now.Add(2 * time.Second)
+		if fail {
+			return errors.New("remote unavailable")
+		}
+		return nil
+	})
+
+	scheduler.RunNow(context.Background(), "sync")
+	status := scheduler.Statuses()[0]
+	if status.Runs != 1 || status.Failures != 1 || status.LastError != "remote unavailable" || status.Running || status.RunningSince != nil {
+		t.Errorf("status after a failed run = %+v", status)
+	}
+	if status.LastRunAt == nil || !status.LastRunAt.Equal(now.Add(-2*time.Second)) || status.LastDuration != 2*time.Second {
+		t.Errorf("last run = %v for %s", status.LastRunAt, status.LastDuration)
+	}
+
+	fail = false
+	scheduler.RunNow(context.Background(), "sync")
+	status = scheduler.Statuses()[0]
+	if status.Runs != 2 || status.Failures != 1 || status.LastError != "" {
+		t.Errorf("status after a successful run = %+v", status)
+	}
+}
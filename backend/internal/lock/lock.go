@@ -0,0 +1,154 @@
+// Package lock implements locks on resources shared by several panel instances, held in Redis.
+//
+// A lock is a key holding a random token, set only while absent and with a TTL. Its holder renews
+// the TTL while the operation runs, so a lock outlives slow operations but lapses soon after its
+// holder crashes. Only the holder's token can renew or release it.
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrBusy is returned when another operation holds the lock of a resource
+var ErrBusy = errors.New("resource is locked by another operation")
+
+// retryInterval is how often a waiting Acquire tries to take the lock again
+const retryInterval = 100 * time.Millisecond
+
+var (
+	// renewScript extends the TTL of a lock while it still holds the caller's token
+	renewScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0`)
+
+	// releaseScript deletes a lock while it still holds the caller's token
+	releaseScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`)
+)
+
+// Locker takes locks on resources
+type Locker struct {
+	client *redis.Client
+	ttl    time.Duration
+	wait   time.Duration
+}
+
+// New creates a Locker whose locks lapse ttl after their holder stops renewing them. Acquire
+// waits up to wait for a lock held elsewhere. Without a client every lock is granted at once.
+func New(client *redis.Client, ttl, wait time.Duration) *Locker {
+	return &Locker{client: client, ttl: ttl, wait: wait}
+}
+
+// Lock is a held lock, renewed until it is released
+type Lock struct {
+	locker *Locker
+	key    string
+	token  string
+
+	once sync.Once
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Acquire takes the lock of a resource, such as "domain:<id>", waiting for its holder to release
+// it for as long as the Locker allows. It returns ErrBusy when the lock stays held.
+func (l *Locker) Acquire(ctx context.Context, resource string) (*Lock, error) {
+	if l == nil || l.client == nil {
+		return &Lock{}, nil
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	key := "lock:" + resource
+
+	deadline := time.Now().Add(l.wait)
+	for {
+		acquired, err := l.client.SetNX(ctx, key, token, l.ttl).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to lock %s: %w", resource, err)
+		}
+		if acquired {
+			break
+		}
+
+		if !time.Now().Before(deadline) {
+			return nil, ErrBusy
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(min(retryInterval, time.Until(deadline))):
+		}
+	}
+
+	held := &Lock{
+		locker: l,
+		key:    key,
+		token:  token,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go held.renew()
+	return held, nil
+}
+
+// Release gives up the lock. It is safe to call more than once, and after the lock lapsed.
+func (h *Lock) Release() {
+	if h.locker == nil {
+		return
+	}
+	h.once.Do(func() {
+		close(h.stop)
+		<-h.done
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		releaseScript.Run(ctx, h.locker.client, []string{h.key}, h.token)
+	})
+}
+
+// renew extends the lock's TTL every third of it until the lock is released or found lost
+func (h *Lock) renew() {
+	defer close(h.done)
+
+	ticker := time.NewTicker(h.locker.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), h.locker.ttl/3)
+			renewed, err := renewScript.Run(ctx, h.locker.client, []string{h.key}, h.token, h.locker.ttl.Milliseconds()).Int()
+			cancel()
+			// A failed renewal is retried on the next tick while the TTL lasts; a lost lock is not
+			if err == nil && renewed == 0 {
+				return
+			}
+		}
+	}
+}
+
+// newToken returns a random token identifying the holder of a lock
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate lock token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
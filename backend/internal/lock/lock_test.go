@@ -0,0 +1,135 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestLocker returns a Locker on an in-memory Redis
+func newTestLocker(t *testing.T, ttl, wait time.Duration) (*Locker, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return New(client, ttl, wait), server
+}
+
+func TestAcquireRejectsSecondHolder(t *testing.T) {
+	locker, server := newTestLocker(t, time.Minute, 0)
+	ctx := context.Background()
+
+	held, err := locker.Acquire(ctx, "domain:1")
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if _, err := locker.Acquire(ctx, "domain:1"); !errors.Is(err, ErrBusy) {
+		t.Fatalf("second Acquire() error = %v, want ErrBusy", err)
+	}
+	// Other resources are not affected
+	other, err := locker.Acquire(ctx, "domain:2")
+	if err != nil {
+		t.Fatalf("Acquire() of another resource error = %v", err)
+	}
+	other.Release()
+
+	held.Release()
+	held.Release()
+	if server.Exists("lock:domain:1") {
+		t.Error("lock kept after its release")
+	}
+	again, err := locker.Acquire(ctx, "domain:1")
+	if err != nil {
+		t.Fatalf("Acquire() after the release error = %v", err)
+	}
+	again.Release()
+}
+
+func TestAcquireWaitsForRelease(t *testing.T) {
+	locker, _ := newTestLocker(t, time.Minute, 5*time.Second)
+	ctx := context.Background()
+
+	held, err := locker.Acquire(ctx, "domain:1")
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	time.AfterFunc(150*time.Millisecond, held.Release)
+
+	start := time.Now()
+	waited, err := locker.Acquire(ctx, "domain:1")
+	if err != nil {
+		t.Fatalf("waiting Acquire() error = %v", err)
+	}
+	defer waited.Release()
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("Acquire() returned after %v, before the holder released the lock", elapsed)
+	}
+
+	// A cancelled wait gives up at once
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := locker.Acquire(cancelled, "domain:1"); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled Acquire() error = %v", err)
+	}
+}
+
+func TestLockLapsesAfterCrash(t *testing.T) {
+	locker, server := newTestLocker(t, time.Minute, 0)
+	ctx := context.Background()
+
+	// A holder that crashed stops renewing its lock, which then lapses with its TTL
+	server.Set("lock:domain:1", "crashed-holder")
+	server.SetTTL("lock:domain:1", time.Minute)
+	if _, err := locker.Acquire(ctx, "domain:1"); !errors.Is(err, ErrBusy) {
+		t.Fatalf("Acquire() error = %v, want ErrBusy", err)
+	}
+	server.FastForward(time.Minute)
+	held, err := locker.Acquire(ctx, "domain:1")
+	if err != nil {
+		t.Fatalf("Acquire() after the TTL error = %v", err)
+	}
+
+	// Releasing a lock that lapsed and was taken by another holder leaves that holder's lock
+	server.FastForward(time.Minute)
+	server.Set("lock:domain:1", "next-holder")
+	held.Release()
+	if got, _ := server.Get("lock:domain:1"); got != "next-holder" {
+		t.Errorf("lock = %q after releasing a lapsed lock, want the next holder's", got)
+	}
+}
+
+func TestLockRenewedWhileHeld(t *testing.T) {
+	locker, server := newTestLocker(t, 300*time.Millisecond, 0)
+
+	held, err := locker.Acquire(context.Background(), "domain:1")
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	defer held.Release()
+
+	server.FastForward(200 * time.Millisecond)
+	time.Sleep(250 * time.Millisecond)
+	if ttl := server.TTL("lock:domain:1"); ttl <= 100*time.Millisecond {
+		t.Errorf("TTL = %v, want it renewed", ttl)
+	}
+}
+
+func TestWithoutRedis(t *testing.T) {
+	for _, locker := range []*Locker{nil, New(nil, time.Minute, 0)} {
+		first, err := locker.Acquire(context.Background(), "domain:1")
+		if err != nil {
+			t.Fatalf("Acquire() error = %v", err)
+		}
+		second, err := locker.Acquire(context.Background(), "domain:1")
+		if err != nil {
+			t.Fatalf("second Acquire() error = %v, want every lock granted", err)
+		}
+		first.Release()
+		second.Release()
+	}
+}
@@ -0,0 +1,205 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/i18n"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// Outbox statuses
+const (
+	StatusPending = "pending"
+	StatusSending = "sending"
+	StatusSent    = "sent"
+	StatusDead    = "dead" // Gave up after a permanent failure or too many attempts
+)
+
+// batchSize bounds the number of messages delivered per poll
+const batchSize = 50
+
+// Mailer queues outbound mail in the outbox table and delivers it when ProcessOutbox runs, which
+// the server schedules every poll interval
+type Mailer struct {
+	db     *gorm.DB
+	logger *zap.Logger
+	config config.MailConfig
+	sender Sender
+}
+
+// New creates a mailer that sends through SMTP, or only logs messages in dry-run mode
+func New(db *gorm.DB, cfg config.MailConfig, logger *zap.Logger) *Mailer {
+	var sender Sender = NewSMTPSender(cfg)
+	if cfg.DryRun {
+		sender = NewLogSender(logger)
+	}
+
+	return NewWithSender(db, cfg, logger, sender)
+}
+
+// NewWithSender creates a mailer that delivers through the given sender
+func NewWithSender(db *gorm.DB, cfg config.MailConfig, logger *zap.Logger, sender Sender) *Mailer {
+	return &Mailer{
+		db:     db,
+		logger: logger,
+		config: cfg,
+		sender: sender,
+	}
+}
+
+// Enqueue renders a template in English and queues the message for delivery
+func (m *Mailer) Enqueue(ctx context.Context, to, templateName string, data interface{}) (*models.OutboxEmail, error) {
+	return m.EnqueueLocale(ctx, to, i18n.DefaultLocale, templateName, data)
+}
+
+// EnqueueLocale renders a template in the recipient's locale and queues the message for delivery
+func (m *Mailer) EnqueueLocale(ctx context.Context, to, locale, templateName string, data interface{}) (*models.OutboxEmail, error) {
+	if _, err := mail.ParseAddress(to); err != nil {
+		return nil, fmt.Errorf("invalid recipient address: %w", err)
+	}
+
+	subject, body, err := RenderLocale(locale, templateName, data)
+	if err != nil {
+		return nil, err
+	}
+
+	email := &models.OutboxEmail{
+		To:            to,
+		Subject:       subject,
+		Body:          body,
+		Template:      templateName,
+		Status:        StatusPending,
+		NextAttemptAt: time.Now(),
+	}
+	if err := m.db.WithContext(ctx).Create(email).Error; err != nil {
+		return nil, fmt.Errorf("failed to queue email: %w", err)
+	}
+
+	return email, nil
+}
+
+// ProcessOutbox delivers the messages that are due. It stops between messages when ctx is
+// cancelled.
+func (m *Mailer) ProcessOutbox(ctx context.Context) error {
+	if err := m.requeueStale(ctx); err != nil {
+		return err
+	}
+
+	var due []*models.OutboxEmail
+	if err := m.db.WithContext(ctx).
+		Where("status = ? AND next_attempt_at <= ?", StatusPending, time.Now()).
+		Order("next_attempt_at").
+		Limit(batchSize).
+		Find(&due).Error; err != nil {
+		return fmt.Errorf("failed to load email outbox: %w", err)
+	}
+
+	for _, email := range due {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// Claim the message so another instance does not send it too
+		result := m.db.WithContext(ctx).Model(&models.OutboxEmail{}).
+			Where("id = ? AND status = ?", email.ID, StatusPending).
+			Update("status", StatusSending)
+		if result.Error != nil {
+			return fmt.Errorf("failed to claim email: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		m.deliver(ctx, email)
+	}
+
+	return nil
+}
+
+// requeueStale queues again the messages whose claim outlived the sending lease, because the
+// instance delivering them stopped before recording the outcome. The interrupted delivery counts
+// as an attempt so a message that keeps crashing its sender is eventually given up on.
+func (m *Mailer) requeueStale(ctx context.Context) error {
+	result := m.db.WithContext(ctx).Model(&models.OutboxEmail{}).
+		Where("status = ? AND updated_at < ?", StatusSending, time.Now().Add(-m.config.SendingLease)).
+		Updates(map[string]interface{}{
+			"status":          StatusPending,
+			"attempts":        gorm.Expr("attempts + 1"),
+			"last_error":      "delivery interrupted",
+			"next_attempt_at": time.Now(),
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to requeue stale emails: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		m.logger.Warn("Requeued interrupted emails", zap.Int64("count", result.RowsAffected))
+	}
+	return nil
+}
+
+// deliver sends one message and records the outcome, scheduling a retry on transient failures
+func (m *Mailer) deliver(ctx context.Context, email *models.OutboxEmail) {
+	err := m.sender.Send(ctx, Message{
+		From:    m.config.From,
+		To:      email.To,
+		Subject: email.Subject,
+		Body:    email.Body,
+	})
+
+	if ctx.Err() != nil {
+		// Shutting down: hand the message back without counting the attempt
+		if err := m.db.WithContext(context.WithoutCancel(ctx)).Model(&models.OutboxEmail{}).
+			Where("id = ? AND status = ?", email.ID, StatusSending).
+			Update("status", StatusPending).Error; err != nil {
+			m.logger.Error("Failed to release email", zap.String("email_id", email.ID.String()), zap.Error(err))
+		}
+		return
+	}
+
+	attempts := email.Attempts + 1
+	updates := map[string]interface{}{"attempts": attempts}
+	switch {
+	case err == nil:
+		updates["status"] = StatusSent
+		updates["sent_at"] = time.Now()
+		updates["last_error"] = ""
+	case IsPermanent(err) || attempts >= m.config.MaxAttempts:
+		updates["status"] = StatusDead
+		updates["last_error"] = err.Error()
+		m.logger.Error("Giving up on email",
+			zap.String("email_id", email.ID.String()),
+			zap.String("template", email.Template),
+			zap.Int("attempts", attempts),
+			zap.Error(err))
+	default:
+		updates["status"] = StatusPending
+		updates["last_error"] = err.Error()
+		updates["next_attempt_at"] = time.Now().Add(m.backoff(attempts))
+		m.logger.Warn("Email delivery failed, will retry",
+			zap.String("email_id", email.ID.String()),
+			zap.Int("attempts", attempts),
+			zap.Error(err))
+	}
+
+	if err := m.db.WithContext(ctx).Model(&models.OutboxEmail{}).
+		Where("id = ?", email.ID).
+		Updates(updates).Error; err != nil {
+		m.logger.Error("Failed to update email status", zap.String("email_id", email.ID.String()), zap.Error(err))
+	}
+}
+
+// backoff doubles the retry interval with each attempt
+func (m *Mailer) backoff(attempts int) time.Duration {
+	delay := m.config.RetryInterval
+	for i := 1; i < attempts && delay < 24*time.Hour; i++ {
+		delay *= 2
+	}
+	return delay
+}
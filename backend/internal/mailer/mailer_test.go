@@ -0,0 +1,197 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/database"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// fakeSender records the messages it is asked to send and fails with err
+type fakeSender struct {
+	mu   sync.Mutex
+	sent []Message
+	err  error
+	hook func() // Called during each send
+}
+
+func (f *fakeSender) Send(ctx context.Context, msg Message) error {
+	if f.hook != nil {
+		f.hook()
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, msg)
+	return f.err
+}
+
+func newTestMailer(t *testing.T, sender Sender) *Mailer {
+	t.Helper()
+
+	dsn := "file:" + uuid.NewString() + "?mode=memory&cache=shared&_busy_timeout=5000"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	t.Cleanup(func() { sqlDB.Close() })
+
+	return NewWithSender(db, config.MailConfig{
+		From:          "MyNodeCP <noreply@example.net>",
+		MaxAttempts:   3,
+		RetryInterval: time.Minute,
+		SendTimeout:   time.Minute,
+		SendingLease:  10 * time.Minute,
+	}, zap.NewNop(), sender)
+}
+
+func enqueue(t *testing.T, m *Mailer) *models.OutboxEmail {
+	t.Helper()
+
+	email, err := m.Enqueue(context.Background(), "user@example.net", "welcome", map[string]string{"Name": "Ada"})
+	if err != nil {
+		t.Fatalf("enqueue: %v", err)
+	}
+	return email
+}
+
+func reload(t *testing.T, m *Mailer, email *models.OutboxEmail) *models.OutboxEmail {
+	t.Helper()
+
+	var current models.OutboxEmail
+	if err := m.db.First(&current, "id = ?", email.ID).Error; err != nil {
+		t.Fatalf("reload email: %v", err)
+	}
+	return &current
+}
+
+func TestProcessOutboxDelivers(t *testing.T) {
+	sender := &fakeSender{}
+	m := newTestMailer(t, sender)
+	email := enqueue(t, m)
+
+	if err := m.ProcessOutbox(context.Background()); err != nil {
+		t.Fatalf("process outbox: %v", err)
+	}
+
+	if got := reload(t, m, email); got.Status != StatusSent || got.Attempts != 1 {
+		t.Errorf("status %s after %d attempts, want sent after 1", got.Status, got.Attempts)
+	}
+	if len(sender.sent) != 1 || sender.sent[0].To != "user@example.net" {
+		t.Errorf("sent = %+v", sender.sent)
+	}
+}
+
+func TestProcessOutboxRetriesAndGivesUp(t *testing.T) {
+	m := newTestMailer(t, &fakeSender{err: errors.New("connection refused")})
+	email := enqueue(t, m)
+
+	m.ProcessOutbox(context.Background())
+	got := reload(t, m, email)
+	if got.Status != StatusPending || !got.NextAttemptAt.After(time.Now()) {
+		t.Fatalf("status %s next attempt %s, want a later retry", got.Status, got.NextAttemptAt)
+	}
+
+	m.sender = &fakeSender{err: permanent(errors.New("mailbox unavailable"))}
+	m.db.Model(got).Update("next_attempt_at", time.Now().Add(-time.Second))
+	m.ProcessOutbox(context.Background())
+	if got := reload(t, m, email); got.Status != StatusDead {
+		t.Errorf("status %s after a permanent failure, want dead", got.Status)
+	}
+}
+
+func TestProcessOutboxRequeuesStaleClaims(t *testing.T) {
+	sender := &fakeSender{}
+	m := newTestMailer(t, sender)
+	stale := enqueue(t, m)
+	fresh := enqueue(t, m)
+	m.db.Model(&models.OutboxEmail{}).Where("id IN ?", []uuid.UUID{stale.ID, fresh.ID}).Update("status", StatusSending)
+	m.db.Exec("UPDATE outbox_emails SET updated_at = ? WHERE id = ?", time.Now().Add(-time.Hour), stale.ID)
+
+	if err := m.ProcessOutbox(context.Background()); err != nil {
+		t.Fatalf("process outbox: %v", err)
+	}
+
+	if got := reload(t, m, stale); got.Status != StatusSent || got.Attempts != 2 {
+		t.Errorf("stale claim: status %s after %d attempts, want sent after 2", got.Status, got.Attempts)
+	}
+	if got := reload(t, m, fresh); got.Status != StatusSending {
+		t.Errorf("claim within the lease: status %s, want sending", got.Status)
+	}
+}
+
+func TestProcessOutboxStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sender := &fakeSender{hook: cancel, err: context.Canceled}
+	m := newTestMailer(t, sender)
+	first := enqueue(t, m)
+	second := enqueue(t, m)
+
+	if err := m.ProcessOutbox(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("process outbox = %v, want context canceled", err)
+	}
+
+	if len(sender.sent) != 1 {
+		t.Errorf("sent %d messages after cancelling, want 1", len(sender.sent))
+	}
+	for _, email := range []*models.OutboxEmail{first, second} {
+		if got := reload(t, m, email); got.Status != StatusPending || got.Attempts != 0 {
+			t.Errorf("status %s after %d attempts, want pending and uncounted", got.Status, got.Attempts)
+		}
+	}
+}
+
+func TestSMTPSenderTimesOut(t *testing.T) {
+	// A server that accepts connections and never greets
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	sender := NewSMTPSender(config.MailConfig{SMTPHost: "127.0.0.1", SMTPPort: addr.Port, SendTimeout: 200 * time.Millisecond})
+
+	start := time.Now()
+	err = sender.Send(context.Background(), Message{From: "noreply@example.net", To: "user@example.net"})
+	if err == nil {
+		t.Fatal("send to a silent server succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("send gave up after %s", elapsed)
+	}
+}
+
+func TestTemplatesRender(t *testing.T) {
+	for name := range builtinTemplates {
+		for _, locale := range []string{"en", "de"} {
+			if _, _, err := RenderLocale(locale, name, map[string]interface{}{"Notifications": []string{}}); err != nil {
+				t.Errorf("render %s in %s: %v", name, locale, err)
+			}
+		}
+	}
+}
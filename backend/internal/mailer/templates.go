@@ -0,0 +1,198 @@
+package mailer
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/mynodecp/mynodecp/backend/internal/i18n"
+)
+
+// Built-in email templates. The first line of each is the subject.
+var builtinTemplates = map[string]string{
+	"password_reset": `Reset your password
+Hello {{.Name}},
+
+A password reset was requested for your account. Open the link below to choose a new password:
+
+{{.Link}}
+
+The link expires in {{.ExpiresIn}}. If you did not request this, you can ignore this email.
+`,
+	"new_country_login": `New sign-in from {{.Country}}
+Hello {{.Name}},
+
+Your account was just signed in from {{.Country}} (IP address {{.IPAddress}}).
+
+If this was not you, change your password and review your active sessions.
+`,
+	"account_deletion_warning": `Your account will be deleted on {{.DeleteOn}}
+Hello {{.Name}},
+
+Your account {{.Username}} was created but its email address was never verified. Unverified accounts
+without any domains are deleted automatically; yours will be deleted on {{.DeleteOn}}.
+
+To keep the account, verify your email address before then.
+`,
+	"confirm_email_change": `Confirm your new email address
+Hello {{.Name}},
+
+You asked to change the email address of your account {{.Username}} to {{.Email}}. Open the link
+below to confirm the change:
+
+{{.Link}}
+
+The link expires in {{.ExpiresIn}}. If you did not ask for this, you can ignore this email.
+`,
+	"email_changed": `Your email address was changed
+Hello {{.Name}},
+
+The email address of your account {{.Username}} was changed from {{.OldEmail}} to {{.NewEmail}}.
+
+If you did not make this change, contact support and change your password.
+`,
+	"login_code": `Your sign-in code: {{.Code}}
+Hello {{.Name}},
+
+Enter this code to finish signing in:
+
+{{.Code}}
+
+The code expires in {{.ExpiresIn}}. If you did not try to sign in, change your password.
+`,
+	"welcome": `Welcome to MyNodeCP
+Hello {{.Name}},
+
+Your account {{.Username}} is ready. Sign in to the control panel to set up your domains,
+mailboxes and databases.
+`,
+	"notification": `{{.Subject}}
+{{.Body}}
+`,
+	"notification_digest": `Your notification summary: {{len .Notifications}} new
+Hello {{.Name}},
+
+Here is what happened since your last summary:
+{{range .Notifications}}
+{{.CreatedAt.UTC.Format "2006-01-02 15:04"}} UTC - {{.Subject}}
+{{.Body}}
+{{end}}
+You can change which notifications you get and how often in your account settings.
+`,
+}
+
+// Translations of the built-in templates by locale. Templates missing here are sent in English.
+var localizedTemplates = map[string]map[string]string{
+	"de": {
+		"password_reset": `Passwort zurücksetzen
+Hallo {{.Name}},
+
+für Ihr Konto wurde das Zurücksetzen des Passworts angefordert. Öffnen Sie den folgenden Link, um ein neues Passwort zu wählen:
+
+{{.Link}}
+
+Der Link läuft in {{.ExpiresIn}} ab. Wenn Sie dies nicht angefordert haben, können Sie diese E-Mail ignorieren.
+`,
+		"account_deletion_warning": `Ihr Konto wird am {{.DeleteOn}} gelöscht
+Hallo {{.Name}},
+
+Ihr Konto {{.Username}} wurde angelegt, aber die E-Mail-Adresse wurde nie bestätigt. Nicht bestätigte
+Konten ohne Domains werden automatisch gelöscht; Ihres wird am {{.DeleteOn}} gelöscht.
+
+Um das Konto zu behalten, bestätigen Sie Ihre E-Mail-Adresse vorher.
+`,
+		"confirm_email_change": `Bestätigen Sie Ihre neue E-Mail-Adresse
+Hallo {{.Name}},
+
+Sie möchten die E-Mail-Adresse Ihres Kontos {{.Username}} in {{.Email}} ändern. Öffnen Sie den
+folgenden Link, um die Änderung zu bestätigen:
+
+{{.Link}}
+
+Der Link läuft in {{.ExpiresIn}} ab. Wenn Sie dies nicht angefordert haben, können Sie diese E-Mail ignorieren.
+`,
+		"email_changed": `Ihre E-Mail-Adresse wurde geändert
+Hallo {{.Name}},
+
+die E-Mail-Adresse Ihres Kontos {{.Username}} wurde von {{.OldEmail}} in {{.NewEmail}} geändert.
+
+Wenn Sie diese Änderung nicht vorgenommen haben, wenden Sie sich an den Support und ändern Sie Ihr Passwort.
+`,
+		"login_code": `Ihr Anmeldecode: {{.Code}}
+Hallo {{.Name}},
+
+geben Sie diesen Code ein, um die Anmeldung abzuschließen:
+
+{{.Code}}
+
+Der Code läuft in {{.ExpiresIn}} ab. Wenn Sie sich nicht anmelden wollten, ändern Sie Ihr Passwort.
+`,
+		"welcome": `Willkommen bei MyNodeCP
+Hallo {{.Name}},
+
+Ihr Konto {{.Username}} ist eingerichtet. Melden Sie sich im Control Panel an, um Ihre Domains,
+Postfächer und Datenbanken einzurichten.
+`,
+		"notification_digest": `Ihre Benachrichtigungen im Überblick: {{len .Notifications}} neu
+Hallo {{.Name}},
+
+das ist seit Ihrer letzten Zusammenfassung geschehen:
+{{range .Notifications}}
+{{.CreatedAt.UTC.Format "2006-01-02 15:04"}} UTC - {{.Subject}}
+{{.Body}}
+{{end}}
+In Ihren Kontoeinstellungen können Sie festlegen, welche Benachrichtigungen Sie wie oft erhalten.
+`,
+		"new_country_login": `Neue Anmeldung aus {{.Country}}
+Hallo {{.Name}},
+
+Ihr Konto wurde soeben aus {{.Country}} angemeldet (IP-Adresse {{.IPAddress}}).
+
+Wenn Sie das nicht waren, ändern Sie Ihr Passwort und prüfen Sie Ihre aktiven Sitzungen.
+`,
+	},
+}
+
+var templates = template.Must(parseTemplates())
+
+func parseTemplates() (*template.Template, error) {
+	root := template.New("")
+	for name, text := range builtinTemplates {
+		if _, err := root.New(name).Option("missingkey=zero").Parse(text); err != nil {
+			return nil, err
+		}
+	}
+	for locale, localized := range localizedTemplates {
+		for name, text := range localized {
+			if _, err := root.New(locale + "/" + name).Option("missingkey=zero").Parse(text); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return root, nil
+}
+
+// Render renders a named template into a subject and body
+func Render(name string, data interface{}) (subject, body string, err error) {
+	return RenderLocale(i18n.DefaultLocale, name, data)
+}
+
+// RenderLocale renders a named template in the locale, falling back to English when the template
+// has no translation
+func RenderLocale(locale, name string, data interface{}) (subject, body string, err error) {
+	tmpl := templates.Lookup(locale + "/" + name)
+	if tmpl == nil {
+		tmpl = templates.Lookup(name)
+	}
+	if tmpl == nil {
+		return "", "", fmt.Errorf("unknown email template: %s", name)
+	}
+
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", "", fmt.Errorf("failed to render email template %s: %w", name, err)
+	}
+
+	subject, body, _ = strings.Cut(out.String(), "\n")
+	return strings.TrimSpace(subject), body, nil
+}
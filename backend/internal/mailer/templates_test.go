@@ -0,0 +1,55 @@
+package mailer
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestRenderLocale(t *testing.T) {
+	data := map[string]string{"Name": "Ann", "Subject": "Backup finished", "Body": "All good", "Link": "https://panel.example/reset?t=1", "ExpiresIn": "1 hour"}
+
+	tests := []struct {
+		name        string
+		locale      string
+		template    string
+		wantSubject string
+		wantBody    string
+	}{
+		{"English", "en", "password_reset", "Reset your password", "https://panel.example/reset?t=1"},
+		{"German", "de", "password_reset", "Passwort zurücksetzen", "Der Link läuft in 1 hour ab."},
+		{"unsupported locale", "fr", "password_reset", "Reset your password", "Ann"},
+		{"untranslated template", "de", "notification", "Backup finished", "All good"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subject, body, err := RenderLocale(tt.locale, tt.template, data)
+			if err != nil {
+				t.Fatalf("RenderLocale() error = %v", err)
+			}
+			if subject != tt.wantSubject || !strings.Contains(body, tt.wantBody) {
+				t.Errorf("RenderLocale() = %q\n%s\nwant subject %q and %q in the body", subject, body, tt.wantSubject, tt.wantBody)
+			}
+		})
+	}
+
+	if _, _, err := RenderLocale("de", "no_such_template", data); err == nil {
+		t.Error("RenderLocale() rendered an unknown template")
+	}
+}
+
+func TestEnqueueLocale(t *testing.T) {
+	m := newTestMailer(t, &fakeSender{})
+
+	email, err := m.EnqueueLocale(context.Background(), "ann@example.com", "de", "welcome", map[string]string{"Name": "Ann"})
+	if err != nil {
+		t.Fatalf("EnqueueLocale() error = %v", err)
+	}
+	if !strings.HasPrefix(email.Subject, "Willkommen") {
+		t.Errorf("queued subject = %q, want the German template", email.Subject)
+	}
+
+	if _, err := m.EnqueueLocale(context.Background(), "not an address", "de", "welcome", nil); err == nil {
+		t.Error("EnqueueLocale() queued mail to an invalid address")
+	}
+}
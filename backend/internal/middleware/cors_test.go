@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+)
+
+func TestCORS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name        string
+		origins     []string
+		credentials bool
+		origin      string
+		wantOrigin  string
+		wantCreds   bool
+	}{
+		{"listed origin", []string{"https://panel.example"}, true, "https://panel.example", "https://panel.example", true},
+		{"unlisted origin", []string{"https://panel.example"}, true, "https://evil.example", "", false},
+		{"wildcard", []string{"*"}, false, "https://any.example", "*", false},
+		{"wildcard with credentials", []string{"*"}, true, "https://any.example", "*", false},
+		{"listed next to wildcard", []string{"*", "https://panel.example"}, true, "https://panel.example", "https://panel.example", true},
+		{"no origin", []string{"*"}, false, "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(CORS(config.SecurityConfig{
+				CORSEnabled:          true,
+				CORSAllowedOrigins:   tt.origins,
+				CORSAllowCredentials: tt.credentials,
+			}))
+			router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Credentials") == "true"; got != tt.wantCreds {
+				t.Errorf("credentials allowed = %v, want %v", got, tt.wantCreds)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	cspViolationsKey   = "csp_violations"
+	maxCSPViolations   = 200
+	maxCSPReportLength = 64 * 1024
+)
+
+// CSPViolation is a single Content-Security-Policy violation reported by a browser
+type CSPViolation struct {
+	DocumentURI        string    `json:"document_uri"`
+	Referrer           string    `json:"referrer,omitempty"`
+	BlockedURI         string    `json:"blocked_uri"`
+	ViolatedDirective  string    `json:"violated_directive"`
+	EffectiveDirective string    `json:"effective_directive,omitempty"`
+	OriginalPolicy     string    `json:"original_policy,omitempty"`
+	Disposition        string    `json:"disposition,omitempty"`
+	SourceFile         string    `json:"source_file,omitempty"`
+	LineNumber         int       `json:"line_number,omitempty"`
+	StatusCode         int       `json:"status_code,omitempty"`
+	UserAgent          string    `json:"user_agent,omitempty"`
+	ReceivedAt         time.Time `json:"received_at"`
+}
+
+// legacyCSPReport is the application/csp-report body sent for the report-uri directive
+type legacyCSPReport struct {
+	Report struct {
+		DocumentURI        string `json:"document-uri"`
+		Referrer           string `json:"referrer"`
+		BlockedURI         string `json:"blocked-uri"`
+		ViolatedDirective  string `json:"violated-directive"`
+		EffectiveDirective string `json:"effective-directive"`
+		OriginalPolicy     string `json:"original-policy"`
+		Disposition        string `json:"disposition"`
+		SourceFile         string `json:"source-file"`
+		LineNumber         int    `json:"line-number"`
+		StatusCode         int    `json:"status-code"`
+	} `json:"csp-report"`
+}
+
+// reportingAPIReport is an entry of the application/reports+json body sent by the Reporting API
+type reportingAPIReport struct {
+	Type string `json:"type"`
+	Body struct {
+		DocumentURL        string `json:"documentURL"`
+		Referrer           string `json:"referrer"`
+		BlockedURL         string `json:"blockedURL"`
+		EffectiveDirective string `json:"effectiveDirective"`
+		OriginalPolicy     string `json:"originalPolicy"`
+		Disposition        string `json:"disposition"`
+		SourceFile         string `json:"sourceFile"`
+		LineNumber         int    `json:"lineNumber"`
+		StatusCode         int    `json:"statusCode"`
+	} `json:"body"`
+}
+
+// ParseCSPReport parses a violation report in either the legacy report-uri format
+// or the Reporting API format
+func ParseCSPReport(data []byte) ([]CSPViolation, error) {
+	var batch []reportingAPIReport
+	if err := json.Unmarshal(data, &batch); err == nil {
+		violations := make([]CSPViolation, 0, len(batch))
+		for _, report := range batch {
+			if report.Type != "csp-violation" {
+				continue
+			}
+			violations = append(violations, CSPViolation{
+				DocumentURI:        report.Body.DocumentURL,
+				Referrer:           report.Body.Referrer,
+				BlockedURI:         report.Body.BlockedURL,
+				ViolatedDirective:  report.Body.EffectiveDirective,
+				EffectiveDirective: report.Body.EffectiveDirective,
+				OriginalPolicy:     report.Body.OriginalPolicy,
+				Disposition:        report.Body.Disposition,
+				SourceFile:         report.Body.SourceFile,
+				LineNumber:         report.Body.LineNumber,
+				StatusCode:         report.Body.StatusCode,
+			})
+		}
+		return violations, nil
+	}
+
+	var legacy legacyCSPReport
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return nil, fmt.Errorf("invalid CSP report: %w", err)
+	}
+	if legacy.Report.DocumentURI == "" && legacy.Report.ViolatedDirective == "" {
+		return nil, fmt.Errorf("invalid CSP report: missing csp-report body")
+	}
+
+	return []CSPViolation{{
+		DocumentURI:        legacy.Report.DocumentURI,
+		Referrer:           legacy.Report.Referrer,
+		BlockedURI:         legacy.Report.BlockedURI,
+		ViolatedDirective:  legacy.Report.ViolatedDirective,
+		EffectiveDirective: legacy.Report.EffectiveDirective,
+		OriginalPolicy:     legacy.Report.OriginalPolicy,
+		Disposition:        legacy.Report.Disposition,
+		SourceFile:         legacy.Report.SourceFile,
+		LineNumber:         legacy.Report.LineNumber,
+		StatusCode:         legacy.Report.StatusCode,
+	}}, nil
+}
+
+// CSPReport collects violation reports sent by browsers, logs them, and keeps the most recent for review
+func CSPReport(redisClient *redis.Client, logger *zap.Logger) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		data, err := io.ReadAll(io.LimitReader(c.Request.Body, maxCSPReportLength))
+		if err != nil {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+
+		violations, err := ParseCSPReport(data)
+		if err != nil {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+
+		for _, violation := range violations {
+			violation.UserAgent = c.Request.UserAgent()
+			violation.ReceivedAt = time.Now().UTC()
+
+			logger.Warn("CSP violation",
+				zap.String("document_uri", violation.DocumentURI),
+				zap.String("blocked_uri", violation.BlockedURI),
+				zap.String("violated_directive", violation.ViolatedDirective),
+				zap.String("disposition", violation.Disposition),
+				zap.String("source_file", violation.SourceFile),
+				zap.Int("line_number", violation.LineNumber),
+			)
+
+			entry, err := json.Marshal(violation)
+			if err != nil {
+				continue
+			}
+			ctx := c.Request.Context()
+			pipe := redisClient.TxPipeline()
+			pipe.LPush(ctx, cspViolationsKey, entry)
+			pipe.LTrim(ctx, cspViolationsKey, 0, maxCSPViolations-1)
+			if _, err := pipe.Exec(ctx); err != nil {
+				logger.Error("Failed to store CSP violation", zap.Error(err))
+			}
+		}
+
+		c.Status(http.StatusNoContent)
+	})
+}
+
+// RecentCSPViolations returns the most recently reported violations, newest first
+func RecentCSPViolations(ctx context.Context, redisClient *redis.Client, limit int) ([]CSPViolation, error) {
+	if limit <= 0 || limit > maxCSPViolations {
+		limit = maxCSPViolations
+	}
+
+	entries, err := redisClient.LRange(ctx, cspViolationsKey, 0, int64(limit-1)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load CSP violations: %w", err)
+	}
+
+	violations := make([]CSPViolation, 0, len(entries))
+	for _, entry := range entries {
+		var violation CSPViolation
+		if err := json.Unmarshal([]byte(entry), &violation); err == nil {
+			violations = append(violations, violation)
+		}
+	}
+
+	return violations, nil
+}
+
+// CSPViolations lists recently reported violations for review
+func CSPViolations(redisClient *redis.Client) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		limit, _ := strconv.Atoi(c.Query("limit"))
+		violations, err := RecentCSPViolations(c.Request.Context(), redisClient, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load CSP violations"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"violations": violations})
+	})
+}
@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/mynodecp/mynodecp/backend/internal/auth"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/database"
+	"github.com/mynodecp/mynodecp/backend/internal/geoip"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestDryRun(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open("file:"+uuid.NewString()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	geo, _ := geoip.New("")
+	authService := auth.NewService(db, client, zap.NewNop(), config.AuthConfig{
+		JWTSecret:         "test",
+		JWTExpiration:     time.Hour,
+		RefreshExpiration: time.Hour,
+	}, geo, nil, nil, nil)
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	login := func(username string, roles ...models.Role) string {
+		db.Create(&models.User{Username: username, Email: username + "@example.net", PasswordHash: string(hash), IsActive: true, Roles: roles})
+		response, err := authService.Login(context.Background(), &auth.LoginRequest{Username: username, Password: "correct horse", IPAddress: "198.51.100.7"})
+		if err != nil {
+			t.Fatalf("Login() error = %v", err)
+		}
+		return response.AccessToken
+	}
+	admin := login("admin", models.Role{Name: "admin", DisplayName: "Admin"})
+	user := login("owner")
+
+	tests := []struct {
+		name    string
+		enabled bool
+		header  string
+		token   string
+		want    bool
+		status  int
+	}{
+		{"off", false, "", "", false, http.StatusOK},
+		{"enabled for every request", true, "", "", true, http.StatusOK},
+		{"requested by an admin", false, "true", admin, true, http.StatusOK},
+		{"requested with 1", false, "1", admin, true, http.StatusOK},
+		{"declined", false, "false", "", false, http.StatusOK},
+		{"misspelt value", false, "ture", admin, true, http.StatusOK},
+		{"declined while enabled", true, "false", "", true, http.StatusOK},
+		{"requested anonymously", false, "true", "", false, http.StatusForbidden},
+		{"requested by a user", false, "true", user, false, http.StatusForbidden},
+		{"requested with a forged token", false, "true", "not-a-token", false, http.StatusForbidden},
+		{"requested anonymously while enabled", true, "true", "", true, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var marked, reached bool
+			router := gin.New()
+			router.Use(DryRun(tt.enabled, authService))
+			router.POST("/auth/register", func(c *gin.Context) {
+				reached = true
+				marked = c.GetBool("dry_run")
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/auth/register", nil)
+			if tt.header != "" {
+				req.Header.Set(DryRunHeader, tt.header)
+			}
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if reached == (tt.status == http.StatusForbidden) {
+				t.Errorf("handler reached = %v", reached)
+			}
+			if marked != tt.want {
+				t.Errorf("dry_run = %v, want %v", marked, tt.want)
+			}
+			if echoed := w.Header().Get(DryRunHeader) == "true"; echoed != tt.want {
+				t.Errorf("response header %s = %q", DryRunHeader, w.Header().Get(DryRunHeader))
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	applog "github.com/mynodecp/mynodecp/backend/pkg/logger"
+)
+
+func TestSampleRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		rate   float64
+		random float64
+		want   bool
+	}{
+		{"success sampled in", http.StatusOK, 0.5, 0.2, true},
+		{"success sampled out", http.StatusOK, 0.5, 0.7, false},
+		{"success with no sampling", http.StatusNoContent, 0, 0, false},
+		{"success with full rate", http.StatusOK, 1, 0.99, true},
+		{"redirect", http.StatusFound, 0, 0.99, true},
+		{"client error", http.StatusNotFound, 0, 0.99, true},
+		{"server error", http.StatusInternalServerError, 0, 0.99, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sampleRequest(tt.status, tt.rate, func() float64 { return tt.random }); got != tt.want {
+				t.Errorf("sampleRequest() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogging(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	core, logs := observer.New(zap.InfoLevel)
+	router := gin.New()
+	router.Use(Logging(zap.New(core), config.LoggingConfig{
+		RequestSampleRate: 0,
+		RequestHeaders:    []string{"Authorization", "X-API-Key", "Accept"},
+		RedactFields:      []string{"Authorization", "X-API-Key", "password"},
+	}))
+	router.GET("/ok", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/fail", func(c *gin.Context) { c.Status(http.StatusInternalServerError) })
+
+	send := func(path string) {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer secret-token")
+		req.Header.Set("X-API-Key", "secret-key")
+		req.Header.Set("Accept", "application/json")
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// With a sample rate of 0 only the failures are logged
+	for i := 0; i < 5; i++ {
+		send("/ok")
+	}
+	send("/fail?user=alice&new_password=hunter2")
+	send("/missing")
+
+	entries := logs.All()
+	if len(entries) != 2 {
+		t.Fatalf("%d requests logged, want the 2 failures", len(entries))
+	}
+
+	fields := entries[0].ContextMap()
+	if path := fields["path"].(string); path != "/fail?user=alice&new_password="+applog.Redacted {
+		t.Errorf("logged path = %q", path)
+	}
+	headers, _ := fields["headers"].(map[string]string)
+	if headers["Authorization"] != applog.Redacted || headers["X-Api-Key"] != applog.Redacted || headers["Accept"] != "application/json" {
+		t.Errorf("logged headers = %v", headers)
+	}
+	for _, entry := range entries {
+		for _, field := range entry.Context {
+			if strings.Contains(field.String, "secret") || strings.Contains(field.String, "hunter2") {
+				t.Errorf("secret logged in %s = %q", field.Key, field.String)
+			}
+		}
+	}
+	if entries[1].ContextMap()["status"] != int64(http.StatusNotFound) {
+		t.Errorf("second entry = %v, want the 404", entries[1].ContextMap())
+	}
+}
@@ -3,49 +3,82 @@ package middleware
 import (
 	"context"
 	"fmt"
+	"math"
+	"math/rand"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 
 	"github.com/mynodecp/mynodecp/backend/internal/auth"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/i18n"
+	"github.com/mynodecp/mynodecp/backend/internal/ratelimit"
+	"github.com/mynodecp/mynodecp/backend/internal/tracing"
+	applog "github.com/mynodecp/mynodecp/backend/pkg/logger"
 )
 
+// RequestIDHeader carries the request ID between clients, the gateway and the gRPC server
+const RequestIDHeader = "X-Request-ID"
+
+// DryRunHeader asks for a request to be a dry run; only admins may send it
+const DryRunHeader = "X-Dry-Run"
+
 // CORS middleware
-func CORS() gin.HandlerFunc {
+func CORS(cfg config.SecurityConfig) gin.HandlerFunc {
+	allowedOrigins := make(map[string]bool, len(cfg.CORSAllowedOrigins))
+	allowAll := false
+	for _, origin := range cfg.CORSAllowedOrigins {
+		if origin == "*" {
+			allowAll = true
+			continue
+		}
+		allowedOrigins[origin] = true
+	}
+	allowedMethods := strings.Join(cfg.CORSAllowedMethods, ", ")
+	allowedHeaders := strings.Join(cfg.CORSAllowedHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.CORSMaxAge.Seconds()))
+
 	return gin.HandlerFunc(func(c *gin.Context) {
-		origin := c.Request.Header.Get("Origin")
-		
-		// Allow specific origins or all origins in development
-		allowedOrigins := []string{
-			"http://localhost:3000",
-			"http://localhost:8080",
-			"https://mynodecp.com",
+		if !cfg.CORSEnabled {
+			c.Next()
+			return
 		}
-		
-		allowed := false
-		for _, allowedOrigin := range allowedOrigins {
-			if origin == allowedOrigin {
-				allowed = true
-				break
+
+		origin := c.Request.Header.Get("Origin")
+		if origin != "" && (allowAll || allowedOrigins[origin]) {
+			// Listed origins are echoed and may send credentials; any other origin allowed by "*"
+			// gets the wildcard, which browsers never combine with credentials
+			if allowedOrigins[origin] {
+				c.Header("Access-Control-Allow-Origin", origin)
+				c.Header("Vary", "Origin")
+				if cfg.CORSAllowCredentials {
+					c.Header("Access-Control-Allow-Credentials", "true")
+				}
+			} else {
+				c.Header("Access-Control-Allow-Origin", "*")
 			}
+			// Lets browser clients read ETags for conditional requests and their rate limit
+			c.Header("Access-Control-Expose-Headers", "ETag, Upload-Offset, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset, RateLimit-Warning")
 		}
-		
-		if allowed {
-			c.Header("Access-Control-Allow-Origin", origin)
-		}
-		
-		c.Header("Access-Control-Allow-Credentials", "true")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Header("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH")
+
+		c.Header("Access-Control-Allow-Headers", allowedHeaders)
+		c.Header("Access-Control-Allow-Methods", allowedMethods)
 
 		if c.Request.Method == "OPTIONS" {
+			if cfg.CORSMaxAge > 0 {
+				c.Header("Access-Control-Max-Age", maxAge)
+			}
 			c.AbortWithStatus(204)
 			return
 		}
@@ -55,35 +88,94 @@ func CORS() gin.HandlerFunc {
 }
 
 // Security middleware adds security headers
-func Security() gin.HandlerFunc {
+func Security(cfg config.SecurityConfig) gin.HandlerFunc {
+	policy := cfg.CSPPolicy
+	if cfg.CSPReportURI != "" {
+		policy = strings.TrimRight(strings.TrimSpace(policy), ";") + "; report-uri " + cfg.CSPReportURI
+	}
+	cspHeader := "Content-Security-Policy"
+	if cfg.CSPReportOnly {
+		cspHeader = "Content-Security-Policy-Report-Only"
+	}
+
 	return gin.HandlerFunc(func(c *gin.Context) {
 		// Security headers
-		c.Header("X-Frame-Options", "DENY")
-		c.Header("X-Content-Type-Options", "nosniff")
-		c.Header("X-XSS-Protection", "1; mode=block")
+		if cfg.XFrameOptions != "" {
+			c.Header("X-Frame-Options", cfg.XFrameOptions)
+		}
+		if cfg.ContentTypeNosniff {
+			c.Header("X-Content-Type-Options", "nosniff")
+		}
+		if cfg.XSSProtection {
+			c.Header("X-XSS-Protection", "1; mode=block")
+		}
 		c.Header("Referrer-Policy", "strict-origin-when-cross-origin")
-		c.Header("Content-Security-Policy", "default-src 'self'; script-src 'self' 'unsafe-inline'; style-src 'self' 'unsafe-inline'; img-src 'self' data: https:; font-src 'self' data:")
-		
+		if cfg.CSPEnabled && cfg.CSPPolicy != "" {
+			c.Header(cspHeader, policy)
+		}
+
 		// HSTS header for HTTPS
-		if c.Request.TLS != nil {
-			c.Header("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
+		if cfg.HSTSEnabled && c.Request.TLS != nil {
+			c.Header("Strict-Transport-Security", fmt.Sprintf("max-age=%d; includeSubDomains", cfg.HSTSMaxAge))
 		}
 
 		c.Next()
 	})
 }
 
-// RateLimit middleware (simplified version)
-func RateLimit() gin.HandlerFunc {
+// RateLimit middleware limits requests per client IP. A nil limiter disables limiting.
+//
+// Every response reports the limit, the requests left and the seconds until the window resets in
+// X-RateLimit-* headers, so clients can slow down before they are rejected. Once the requests left
+// reach the limiter's warning threshold, RateLimit-Warning says so as well.
+func RateLimit(limiter *ratelimit.Limiter) gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
-		// This is a simplified rate limiter
-		// In production, you would use Redis or a proper rate limiting library
+		if limiter == nil {
+			c.Next()
+			return
+		}
+
+		decision := limiter.Take(c.ClientIP())
+		reset := int(math.Ceil(decision.Reset.Seconds()))
+		c.Header("X-RateLimit-Limit", strconv.FormatInt(decision.Limit, 10))
+		c.Header("X-RateLimit-Remaining", strconv.FormatInt(decision.Remaining, 10))
+		c.Header("X-RateLimit-Reset", strconv.Itoa(reset))
+		if decision.Warn {
+			c.Header("RateLimit-Warning", fmt.Sprintf("%d of %d requests left, resets in %ds", decision.Remaining, decision.Limit, reset))
+		}
+
+		if !decision.Allowed {
+			c.Header("Retry-After", strconv.Itoa(reset))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	})
+}
+
+// RequestID middleware tags each request with an ID, reusing the client's one when provided
+func RequestID() gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if requestID == "" || len(requestID) > 64 {
+			requestID = uuid.New().String()
+		}
+
+		c.Set("request_id", requestID)
+		c.Request = c.Request.WithContext(applog.ContextWithRequestID(c.Request.Context(), requestID))
+		c.Header(RequestIDHeader, requestID)
+
 		c.Next()
 	})
 }
 
-// Logging middleware
-func Logging(logger *zap.Logger) gin.HandlerFunc {
+// Logging middleware. Responses other than 2xx are always logged; successful ones only at the
+// configured sample rate. Values of sensitive query parameters and headers are redacted.
+func Logging(logger *zap.Logger, cfg config.LoggingConfig) gin.HandlerFunc {
+	redactor := applog.NewRedactor(cfg.RedactFields)
+
 	return gin.HandlerFunc(func(c *gin.Context) {
 		start := time.Now()
 		path := c.Request.URL.Path
@@ -98,21 +190,39 @@ func Logging(logger *zap.Logger) gin.HandlerFunc {
 		method := c.Request.Method
 		statusCode := c.Writer.Status()
 
+		if !sampleRequest(statusCode, cfg.RequestSampleRate, rand.Float64) {
+			return
+		}
+
 		if raw != "" {
-			path = path + "?" + raw
+			path = path + "?" + redactor.Query(raw)
 		}
 
-		logger.Info("HTTP Request",
+		fields := []zap.Field{
+			zap.String("request_id", c.GetString("request_id")),
 			zap.String("method", method),
 			zap.String("path", path),
 			zap.Int("status", statusCode),
 			zap.Duration("latency", latency),
 			zap.String("client_ip", clientIP),
 			zap.String("user_agent", c.Request.UserAgent()),
-		)
+		}
+		if headers := redactor.Headers(c.Request.Header, cfg.RequestHeaders); len(headers) > 0 {
+			fields = append(fields, zap.Any("headers", headers))
+		}
+		logger.Info("HTTP Request", fields...)
 	})
 }
 
+// sampleRequest reports whether a request is logged: every response other than 2xx is, and
+// successful ones when random, a number in [0, 1), falls below the sample rate
+func sampleRequest(status int, rate float64, random func() float64) bool {
+	if status < 200 || status >= 300 || rate >= 1 {
+		return true
+	}
+	return random() < rate
+}
+
 // AuthMiddleware validates JWT tokens
 func AuthMiddleware(authService *auth.Service) gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
@@ -139,17 +249,107 @@ func AuthMiddleware(authService *auth.Service) gin.HandlerFunc {
 			return
 		}
 
+		if authService.IsSessionRevoked(c.Request.Context(), claims.SessionID) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session revoked"})
+			c.Abort()
+			return
+		}
+
+		if err := authService.CheckSessionLimits(c.Request.Context(), claims); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session expired"})
+			c.Abort()
+			return
+		}
+
+		if err := authService.CheckSessionBinding(c.Request.Context(), claims, "web", c.ClientIP(), c.Request.UserAgent()); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session used from a different client; log in again", "code": "reauth_required"})
+			c.Abort()
+			return
+		}
+
+		if err := authService.ExtendSession(c.Request.Context(), claims.SessionID); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session expired"})
+			c.Abort()
+			return
+		}
+
 		// Set user information in context
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
 		c.Set("email", claims.Email)
 		c.Set("roles", claims.Roles)
 		c.Set("session_id", claims.SessionID)
+		c.Set("locale", claims.Locale)
+		tracing.SetUser(c.Request.Context(), claims.UserID.String())
+
+		if claims.PasswordExpired && !auth.PasswordChangeAllowed(c.FullPath()) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Password expired; change it to continue", "code": "password_expired"})
+			c.Abort()
+			return
+		}
 
 		c.Next()
 	})
 }
 
+// DryRun marks requests as dry runs when dry-run mode is enabled or the request asks for one,
+// and echoes the header so clients can tell nothing was carried out. It runs before any route
+// authenticates its caller, so it checks the bearer token itself and refuses the header unless
+// it belongs to an admin; otherwise anyone could suppress the side effects of public routes.
+func DryRun(enabled bool, authService *auth.Service) gin.HandlerFunc {
+	return gin.HandlerFunc(func(c *gin.Context) {
+		if !enabled && dryRunRequested(c) && !adminToken(c, authService) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Dry runs require the admin role"})
+			c.Abort()
+			return
+		}
+		if enabled || dryRunRequested(c) {
+			c.Set("dry_run", true)
+			c.Header(DryRunHeader, "true")
+		}
+		c.Next()
+	})
+}
+
+// adminToken reports whether the request carries a valid, unrevoked bearer token of an admin
+func adminToken(c *gin.Context, authService *auth.Service) bool {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || authService == nil {
+		return false
+	}
+	claims, err := authService.ValidateToken(token)
+	if err != nil || authService.IsSessionRevoked(c.Request.Context(), claims.SessionID) {
+		return false
+	}
+	return isAdmin(claims.Roles)
+}
+
+// dryRunRequested reports whether the request asks for a dry run. Any value other than one
+// meaning false counts, so a misspelt value never runs the request for real.
+func dryRunRequested(c *gin.Context) bool {
+	value := c.GetHeader(DryRunHeader)
+	if value == "" {
+		return false
+	}
+	requested, err := strconv.ParseBool(value)
+	return err != nil || requested
+}
+
+func isAdmin(roles []string) bool {
+	for _, role := range roles {
+		if role == "admin" {
+			return true
+		}
+	}
+	return false
+}
+
+// Locale returns the language to answer a request in: the authenticated user's preference, or
+// the best match of the Accept-Language header
+func Locale(c *gin.Context) string {
+	return i18n.Resolve(c.GetString("locale"), c.GetHeader("Accept-Language"))
+}
+
 // RequireRole middleware checks if user has required role
 func RequireRole(role string) gin.HandlerFunc {
 	return gin.HandlerFunc(func(c *gin.Context) {
@@ -192,6 +392,13 @@ func UnaryServerInterceptor(logger *zap.Logger) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
 		start := time.Now()
 
+		// Carry the caller's request ID into the handler
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get("x-request-id"); len(values) > 0 && values[0] != "" {
+				ctx = applog.ContextWithRequestID(ctx, values[0])
+			}
+		}
+
 		// Call the handler
 		resp, err := handler(ctx, req)
 
@@ -282,17 +489,67 @@ func AuthInterceptor(authService *auth.Service) grpc.UnaryServerInterceptor {
 			return nil, status.Errorf(codes.Unauthenticated, "invalid token: %v", err)
 		}
 
+		if authService.IsSessionRevoked(ctx, claims.SessionID) {
+			return nil, status.Errorf(codes.Unauthenticated, "session revoked")
+		}
+
+		if err := authService.CheckSessionLimits(ctx, claims); err != nil {
+			return nil, status.Errorf(codes.Unauthenticated, "session expired")
+		}
+
+		ipAddress, userAgent := grpcClient(ctx, md)
+		if err := authService.CheckSessionBinding(ctx, claims, "grpc", ipAddress, userAgent); err != nil {
+			return nil, status.Errorf(codes.Unauthenticated, "session used from a different client; log in again")
+		}
+
+		if err := authService.ExtendSession(ctx, claims.SessionID); err != nil {
+			return nil, status.Errorf(codes.Unauthenticated, "session expired")
+		}
+
 		// Add user information to context
 		ctx = context.WithValue(ctx, "user_id", claims.UserID)
 		ctx = context.WithValue(ctx, "username", claims.Username)
 		ctx = context.WithValue(ctx, "email", claims.Email)
 		ctx = context.WithValue(ctx, "roles", claims.Roles)
 		ctx = context.WithValue(ctx, "session_id", claims.SessionID)
+		ctx = context.WithValue(ctx, "locale", claims.Locale)
+		tracing.SetUser(ctx, claims.UserID.String())
+
+		if claims.PasswordExpired && !auth.PasswordChangeAllowed(info.FullMethod) {
+			return nil, status.Errorf(codes.PermissionDenied, "password expired; change it to continue")
+		}
 
 		return handler(ctx, req)
 	}
 }
 
+// grpcClient returns the address and user agent of a gRPC call's client. The gateway dials the
+// server over loopback and passes the original client's in metadata, which is only trusted from
+// loopback peers; other calls use the peer address. The gateway appends the address it received
+// the request from to X-Forwarded-For, so only the last entry is its own: earlier ones are
+// whatever the client sent.
+func grpcClient(ctx context.Context, md metadata.MD) (ipAddress, userAgent string) {
+	if p, ok := peer.FromContext(ctx); ok {
+		ipAddress = p.Addr.String()
+		if host, _, err := net.SplitHostPort(ipAddress); err == nil {
+			ipAddress = host
+		}
+	}
+	ip := net.ParseIP(ipAddress)
+	gateway := ip != nil && ip.IsLoopback()
+
+	if forwarded := md.Get("x-forwarded-for"); gateway && len(forwarded) > 0 {
+		entries := strings.Split(forwarded[len(forwarded)-1], ",")
+		ipAddress = strings.TrimSpace(entries[len(entries)-1])
+	}
+	if agents := md.Get("grpcgateway-user-agent"); gateway && len(agents) > 0 {
+		userAgent = agents[0]
+	} else if agents := md.Get("user-agent"); len(agents) > 0 {
+		userAgent = agents[0]
+	}
+	return ipAddress, userAgent
+}
+
 // RequireRoleInterceptor checks if user has required role for gRPC calls
 func RequireRoleInterceptor(role string) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/mynodecp/mynodecp/backend/internal/auth"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/database"
+	"github.com/mynodecp/mynodecp/backend/internal/geoip"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestExpiredPasswordLimitsSession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open("file:"+uuid.NewString()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	geo, _ := geoip.New("")
+	authService := auth.NewService(db, client, zap.NewNop(), config.AuthConfig{
+		JWTSecret:         "test",
+		JWTExpiration:     time.Hour,
+		RefreshExpiration: time.Hour,
+		PasswordMaxAge:    24 * time.Hour,
+	}, geo, nil, nil, nil)
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	changed := time.Now().Add(-48 * time.Hour)
+	user := &models.User{Username: "owner", Email: "owner@example.net", PasswordHash: string(hash), IsActive: true, PasswordChangedAt: &changed}
+	db.Create(user)
+	login, err := authService.Login(context.Background(), &auth.LoginRequest{Username: "owner", Password: "correct horse", IPAddress: "198.51.100.7"})
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+
+	router := gin.New()
+	router.Use(AuthMiddleware(authService))
+	router.GET("/domains", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	router.PUT("/users/:id/password", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	request := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request(http.MethodGet, "/domains", login.AccessToken)
+	var body map[string]string
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != http.StatusForbidden || body["code"] != "password_expired" {
+		t.Errorf("other request with an expired password = %d: %s", w.Code, w.Body.String())
+	}
+	if w := request(http.MethodPut, "/users/"+user.ID.String()+"/password", login.AccessToken); w.Code != http.StatusNoContent {
+		t.Errorf("password change = %d, want it allowed", w.Code)
+	}
+
+	// The gRPC API is limited the same way
+	interceptor := AuthInterceptor(authService)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+login.AccessToken))
+	handler := func(context.Context, interface{}) (interface{}, error) { return nil, nil }
+	if _, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/mynodecp.domain.DomainService/ListDomains"}, handler); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("gRPC call with an expired password error = %v, want PermissionDenied", err)
+	}
+	if _, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/mynodecp.auth.AuthService/ChangePassword"}, handler); err != nil {
+		t.Errorf("gRPC password change error = %v, want it allowed", err)
+	}
+
+	// A token issued after the password was changed is no longer limited
+	db.Model(&models.User{}).Where("id = ?", user.ID).Update("password_changed_at", time.Now())
+	refreshed, err := authService.RefreshToken(context.Background(), login.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshToken() error = %v", err)
+	}
+	if w := request(http.MethodGet, "/domains", refreshed.AccessToken); w.Code != http.StatusNoContent {
+		t.Errorf("request after the change = %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/ratelimit"
+)
+
+func TestRateLimitHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	limiter := ratelimit.New(ratelimit.NewRedisStore(client), ratelimit.Options{Limit: 3, Window: time.Minute, WarnPercent: 34}, zap.NewNop())
+
+	router := gin.New()
+	router.Use(RateLimit(limiter))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		status    int
+		remaining string
+		warn      bool
+	}{
+		{http.StatusOK, "2", false},
+		{http.StatusOK, "1", true},
+		{http.StatusOK, "0", true},
+		{http.StatusTooManyRequests, "0", true},
+	}
+	for i, tt := range tests {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if w.Code != tt.status {
+			t.Errorf("request %d: status = %d, want %d", i+1, w.Code, tt.status)
+		}
+		if w.Header().Get("X-RateLimit-Limit") != "3" || w.Header().Get("X-RateLimit-Remaining") != tt.remaining {
+			t.Errorf("request %d: limit %q, remaining %q; want 3, %s", i+1, w.Header().Get("X-RateLimit-Limit"), w.Header().Get("X-RateLimit-Remaining"), tt.remaining)
+		}
+		if reset, err := strconv.Atoi(w.Header().Get("X-RateLimit-Reset")); err != nil || reset < 1 || reset > 60 {
+			t.Errorf("request %d: reset = %q", i+1, w.Header().Get("X-RateLimit-Reset"))
+		}
+		if got := w.Header().Get("RateLimit-Warning") != ""; got != tt.warn {
+			t.Errorf("request %d: warning = %q, want one %v", i+1, w.Header().Get("RateLimit-Warning"), tt.warn)
+		}
+		if got := w.Header().Get("Retry-After") != ""; got != (tt.status == http.StatusTooManyRequests) {
+			t.Errorf("request %d: Retry-After = %q", i+1, w.Header().Get("Retry-After"))
+		}
+	}
+}
+
+func TestRateLimitDisabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RateLimit(nil))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Limit") != "" {
+		t.Errorf("status = %d, limit header %q", w.Code, w.Header().Get("X-RateLimit-Limit"))
+	}
+}
@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/mynodecp/mynodecp/backend/internal/auth"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/database"
+	"github.com/mynodecp/mynodecp/backend/internal/geoip"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestAuthMiddlewareSessionBinding(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open("file:"+uuid.NewString()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	geo, _ := geoip.New("")
+	authService := auth.NewService(db, client, zap.NewNop(), config.AuthConfig{
+		JWTSecret:         "test",
+		JWTExpiration:     time.Hour,
+		RefreshExpiration: time.Hour,
+		SessionBinding:    auth.BindingIP,
+	}, geo, nil, nil, nil)
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	user := &models.User{Username: "owner", Email: "owner@example.net", PasswordHash: string(hash), IsActive: true}
+	db.Create(user)
+	login, err := authService.Login(context.Background(), &auth.LoginRequest{Username: "owner", Password: "correct horse", IPAddress: "198.51.100.7", UserAgent: "Firefox"})
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+
+	router := gin.New()
+	router.Use(AuthMiddleware(authService))
+	router.GET("/me", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	request := func(remoteAddr, agent string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("User-Agent", agent)
+		req.Header.Set("Authorization", "Bearer "+login.AccessToken)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := request("198.51.100.7:40000", "Firefox"); w.Code != http.StatusNoContent {
+		t.Fatalf("request from the login client = %d: %s", w.Code, w.Body.String())
+	}
+
+	w := request("203.0.113.9:40000", "Firefox")
+	var body map[string]string
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != http.StatusUnauthorized || body["code"] != "reauth_required" {
+		t.Errorf("request from another address = %d: %s", w.Code, w.Body.String())
+	}
+
+	// The session has ended, even for the original client
+	if w := request("198.51.100.7:40000", "Firefox"); w.Code != http.StatusUnauthorized {
+		t.Errorf("request after the mismatch = %d, want 401", w.Code)
+	}
+}
+
+func TestGRPCClient(t *testing.T) {
+	fromPeer := func(addr string) context.Context {
+		tcp, _ := net.ResolveTCPAddr("tcp", addr)
+		return peer.NewContext(context.Background(), &peer.Peer{Addr: tcp})
+	}
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		md        metadata.MD
+		wantIP    string
+		wantAgent string
+	}{
+		{
+			name:      "direct client",
+			ctx:       fromPeer("203.0.113.5:51000"),
+			md:        metadata.Pairs("user-agent", "grpc-go/1.60"),
+			wantIP:    "203.0.113.5",
+			wantAgent: "grpc-go/1.60",
+		},
+		{
+			name:      "gateway forwards the original client",
+			ctx:       fromPeer("127.0.0.1:51000"),
+			md:        metadata.Pairs("x-forwarded-for", "198.51.100.7", "grpcgateway-user-agent", "Firefox", "user-agent", "grpc-gateway"),
+			wantIP:    "198.51.100.7",
+			wantAgent: "Firefox",
+		},
+		{
+			name:      "gateway appends the client to what the client sent",
+			ctx:       fromPeer("127.0.0.1:51000"),
+			md:        metadata.Pairs("x-forwarded-for", "203.0.113.66, 10.0.0.1, 198.51.100.7", "grpcgateway-user-agent", "Firefox"),
+			wantIP:    "198.51.100.7",
+			wantAgent: "Firefox",
+		},
+		{
+			name:      "forwarding metadata from elsewhere is ignored",
+			ctx:       fromPeer("203.0.113.5:51000"),
+			md:        metadata.Pairs("x-forwarded-for", "198.51.100.7", "grpcgateway-user-agent", "Firefox", "user-agent", "curl"),
+			wantIP:    "203.0.113.5",
+			wantAgent: "curl",
+		},
+		{
+			name:   "no peer",
+			ctx:    context.Background(),
+			md:     metadata.MD{},
+			wantIP: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip, agent := grpcClient(tt.ctx, tt.md)
+			if ip != tt.wantIP || agent != tt.wantAgent {
+				t.Errorf("grpcClient() = %q, %q; want %q, %q", ip, agent, tt.wantIP, tt.wantAgent)
+			}
+		})
+	}
+}
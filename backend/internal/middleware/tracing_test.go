@@ -0,0 +1,183 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/mynodecp/mynodecp/backend/internal/auth"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/database"
+	"github.com/mynodecp/mynodecp/backend/internal/geoip"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/tracing"
+)
+
+// recordSpans records the spans ended during a test in memory
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	previous := otel.GetTracerProvider()
+	recorder := tracetest.NewSpanRecorder()
+	tracing.Use(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+// spanAttributes returns the attributes of a span by key
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestTracingRecordsRequestSpans(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open("file:"+uuid.NewString()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+	client := redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	geo, _ := geoip.New("")
+	authService := auth.NewService(db, client, zap.NewNop(), config.AuthConfig{JWTSecret: "test", JWTExpiration: time.Hour, RefreshExpiration: time.Hour}, geo, nil, nil, nil)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	user := &models.User{Username: "owner", Email: "owner@example.net", PasswordHash: string(hash), IsActive: true}
+	db.Create(user)
+	login, err := authService.Login(context.Background(), &auth.LoginRequest{Username: "owner", Password: "correct horse", IPAddress: "198.51.100.7", UserAgent: "Firefox"})
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+
+	recorder := recordSpans(t)
+	router := gin.New()
+	router.Use(RequestID(), Tracing())
+	router.GET("/domains/:id", AuthMiddleware(authService), func(c *gin.Context) {
+		_, span := tracing.Start(c.Request.Context(), "DomainService.GetDomain")
+		span.End()
+		c.Status(http.StatusNoContent)
+	})
+	router.GET("/broken", func(c *gin.Context) {
+		c.Error(errors.New("backend unavailable"))
+		c.Status(http.StatusServiceUnavailable)
+	})
+
+	// The span of an authenticated request names the route, the request and the user
+	req := httptest.NewRequest(http.MethodGet, "/domains/42", nil)
+	req.Header.Set("Authorization", "Bearer "+login.AccessToken)
+	req.Header.Set(RequestIDHeader, "request-1")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	var server, child sdktrace.ReadOnlySpan
+	for _, span := range spans {
+		switch span.Name() {
+		case "GET /domains/:id":
+			server = span
+		case "DomainService.GetDomain":
+			child = span
+		}
+	}
+	if server == nil || child == nil {
+		t.Fatalf("spans = %v, want the request's and its service call's", spans)
+	}
+	attrs := spanAttributes(server)
+	want := map[attribute.Key]string{
+		"http.request.method": "GET",
+		"http.route":          "/domains/:id",
+		"url.path":            "/domains/42",
+		"request.id":          "request-1",
+		"enduser.id":          user.ID.String(),
+	}
+	for key, value := range want {
+		if got := attrs[key].Emit(); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+	if got := attrs["http.response.status_code"].AsInt64(); got != http.StatusNoContent {
+		t.Errorf("status code attribute = %d", got)
+	}
+	// The caller's trace is continued and service spans are its children
+	if got := server.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace ID = %s, want the caller's", got)
+	}
+	if child.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Error("service span is not a child of the request span")
+	}
+
+	// Server errors fail the span
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/broken", nil))
+	spans = recorder.Ended()
+	broken := spans[len(spans)-1]
+	if broken.Name() != "GET /broken" || broken.Status().Code != codes.Error || len(broken.Events()) == 0 {
+		t.Errorf("span of a failed request = %s, %+v, %d events", broken.Name(), broken.Status(), len(broken.Events()))
+	}
+	if _, ok := spanAttributes(broken)["enduser.id"]; ok {
+		t.Error("anonymous request has a user")
+	}
+}
+
+func TestUnaryTracingInterceptor(t *testing.T) {
+	recorder := recordSpans(t)
+	interceptor := UnaryTracingInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/mynodecp.v1.DomainService/GetDomain"}
+
+	tests := []struct {
+		name     string
+		err      error
+		wantCode codes.Code
+	}{
+		{"success", nil, codes.Unset},
+		{"failure", errors.New("not found"), codes.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-request-id", "grpc-request"))
+			var handled context.Context
+			interceptor(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+				handled = ctx
+				return nil, tt.err
+			})
+
+			spans := recorder.Ended()
+			span := spans[len(spans)-1]
+			if span.Name() != "mynodecp.v1.DomainService/GetDomain" || span.Status().Code != tt.wantCode {
+				t.Errorf("span = %s, %+v", span.Name(), span.Status())
+			}
+			attrs := spanAttributes(span)
+			if attrs["rpc.service"].AsString() != "mynodecp.v1.DomainService" || attrs["rpc.method"].AsString() != "GetDomain" || attrs["request.id"].AsString() != "grpc-request" {
+				t.Errorf("attributes = %v", attrs)
+			}
+			if trace.SpanFromContext(handled).SpanContext().SpanID() != span.SpanContext().SpanID() {
+				t.Error("handler context lacks the call's span")
+			}
+		})
+	}
+}
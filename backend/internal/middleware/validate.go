@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/openapi"
+)
+
+// maxValidatedBody caps the request bodies ValidateJSON reads
+const maxValidatedBody = 1 << 20
+
+// ValidateJSON rejects requests whose body is not JSON matching the schema before they reach the
+// handler. Schema violations get a 422 with a message per field, like service validation errors;
+// the body is restored so the handler can bind it as usual.
+func ValidateJSON(schema *openapi.Schema) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxValidatedBody))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "failed to read request body"})
+			return
+		}
+
+		var document interface{}
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		if err := decoder.Decode(&document); err != nil || decoder.More() {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "request body must be a single JSON document"})
+			return
+		}
+
+		if err := schema.Validate(document); err != nil {
+			validation, _ := apperrors.AsValidation(err)
+			code, message := apperrors.Message(err, Locale(c))
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+				"code":   code,
+				"error":  message,
+				"errors": validation.Localize(Locale(c)),
+			})
+			return
+		}
+
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Next()
+	}
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/mynodecp/mynodecp/backend/internal/openapi"
+)
+
+func TestValidateJSON(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	schema := openapi.Object(map[string]*openapi.Schema{
+		"name": openapi.String(1, 20),
+		"ttl":  openapi.Integer(60, 86400),
+	}, "name")
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantFields []string
+	}{
+		{"valid", `{"name":"shop","ttl":3600}`, http.StatusOK, nil},
+		{"schema violation", `{"ttl":5}`, http.StatusUnprocessableEntity, []string{"name", "ttl"}},
+		{"unknown field", `{"name":"shop","admin":true}`, http.StatusUnprocessableEntity, []string{"admin"}},
+		{"malformed JSON", `{"name":`, http.StatusBadRequest, nil},
+		{"two documents", `{"name":"a"}{"name":"b"}`, http.StatusBadRequest, nil},
+		{"empty body", ``, http.StatusBadRequest, nil},
+		{"too large", `{"name":"` + strings.Repeat("a", maxValidatedBody) + `"}`, http.StatusRequestEntityTooLarge, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received string
+			router := gin.New()
+			router.POST("/", ValidateJSON(schema), func(c *gin.Context) {
+				// The handler reads the body the middleware already consumed
+				body, _ := io.ReadAll(c.Request.Body)
+				received = string(body)
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body)))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus == http.StatusOK {
+				if received != tt.body {
+					t.Errorf("handler received %q, want %q", received, tt.body)
+				}
+				return
+			}
+			if received != "" {
+				t.Error("handler ran for a rejected body")
+			}
+
+			var response struct {
+				Code   string            `json:"code"`
+				Error  string            `json:"error"`
+				Errors map[string]string `json:"errors"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("response %s: %v", w.Body, err)
+			}
+			if response.Error == "" {
+				t.Error("response has no error message")
+			}
+			for _, field := range tt.wantFields {
+				if response.Errors[field] == "" {
+					t.Errorf("errors = %v, want a message for %s", response.Errors, field)
+				}
+			}
+			if len(response.Errors) != len(tt.wantFields) {
+				t.Errorf("errors = %v, want fields %v", response.Errors, tt.wantFields)
+			}
+		})
+	}
+}
@@ -5,32 +5,63 @@ import (
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/secret"
 )
 
 // Domain represents a domain in the hosting system
 type Domain struct {
 	ID              uuid.UUID `json:"id" gorm:"type:char(36);primary_key"`
 	UserID          uuid.UUID `json:"user_id" gorm:"type:char(36);not null"`
+	NodeID          *uuid.UUID `json:"node_id,omitempty" gorm:"type:char(36);index"`
 	Name            string    `json:"name" gorm:"uniqueIndex;not null"`
 	DocumentRoot    string    `json:"document_root"`
 	IsActive        bool      `json:"is_active" gorm:"default:true"`
 	HasSSL          bool      `json:"has_ssl" gorm:"default:false"`
 	SSLAutoRenew    bool      `json:"ssl_auto_renew" gorm:"default:true"`
+	ForceHTTPS      bool      `json:"force_https" gorm:"column:force_https;default:false"`
+	AutoSSLStatus   string    `json:"auto_ssl_status,omitempty" gorm:"size:16;index"` // pending while a certificate is to be issued automatically, failed once retries ran out
+	AutoSSLAttempts int       `json:"auto_ssl_attempts,omitempty" gorm:"column:auto_ssl_attempts;default:0"`
+	AutoSSLNextAt   *time.Time `json:"auto_ssl_next_at,omitempty"` // Next issuance attempt while pending
+	AutoSSLError    string    `json:"auto_ssl_error,omitempty" gorm:"type:text"` // Why the last attempt failed
 	PHPVersion      string    `json:"php_version" gorm:"default:'8.2'"`
+	PHPHandler      string    `json:"php_handler" gorm:"size:10;default:'fpm'"` // fpm or cgi
+	PHPExtensions   []string  `json:"php_extensions" gorm:"serializer:json;type:text"` // Loaded on top of the server's defaults
+	PHPDeprecationNotice string `json:"-" gorm:"size:10"` // PHP version the owner was last told is being retired
+	PHPDisplayErrors bool     `json:"php_display_errors" gorm:"default:false"` // Shows errors in responses; off leaves the server's default
+	PHPLogErrors     bool     `json:"php_log_errors" gorm:"default:false"` // Logs errors to PHPErrorLog; off leaves the server's default
+	PHPErrorLog      string   `json:"php_error_log,omitempty"` // Inside the domain's directory, outside its document root
 	DiskUsage       int64     `json:"disk_usage" gorm:"default:0"`
 	BandwidthUsage  int64     `json:"bandwidth_usage" gorm:"default:0"`
 	DiskQuota       int64     `json:"disk_quota" gorm:"default:1073741824"` // 1GB default
 	BandwidthQuota  int64     `json:"bandwidth_quota" gorm:"default:10737418240"` // 10GB default
+	EmailEnabled     bool     `json:"email_enabled" gorm:"default:true"`
+	MailDefaultsAt   *time.Time `json:"mail_defaults_at,omitempty"` // When the configured default mailboxes and aliases were set up
+	LandingPageAt    *time.Time `json:"landing_page_at,omitempty"` // Set while the generated landing page is in the document root
+	DatabasesEnabled bool     `json:"databases_enabled" gorm:"default:true"`
+	CustomDNSEnabled bool     `json:"custom_dns_enabled" gorm:"default:true"`
+	DNSDefaultTTL   int       `json:"dns_default_ttl" gorm:"default:0"` // TTL of records created without one; 0 uses the server's default
+	DNSSerial       uint32    `json:"dns_serial" gorm:"default:0"` // SOA serial, raised with every zone change
 	ExpiresAt       *time.Time `json:"expires_at"`
+	SuspendedAt     *time.Time `json:"suspended_at,omitempty"` // Set while suspended, on its own or with the owner's account
+	SuspensionReason string    `json:"suspension_reason,omitempty" gorm:"size:255"` // Set while suspended on its own, e.g. for non-payment
+	SuspendedBy     *uuid.UUID `json:"suspended_by,omitempty" gorm:"type:char(36)"`
+	QuotaBlockedAt  *time.Time `json:"quota_blocked_at,omitempty"` // Uploads are blocked while set
+	SendSuspendedAt *time.Time `json:"send_suspended_at,omitempty"` // Outbound mail of every account is refused while set
+	VerificationToken string   `json:"verification_token,omitempty"` // Expected in the ownership TXT record
+	VerifiedAt      *time.Time `json:"verified_at,omitempty"` // Last successful ownership verification
 	CreatedAt       time.Time `json:"created_at"`
 	UpdatedAt       time.Time `json:"updated_at"`
 	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
 
 	// Relationships
 	User            User              `json:"user" gorm:"foreignKey:UserID"`
+	Node            *Node             `json:"node,omitempty" gorm:"foreignKey:NodeID"`
 	Subdomains      []Subdomain       `json:"subdomains" gorm:"foreignKey:DomainID"`
 	DNSRecords      []DNSRecord       `json:"dns_records" gorm:"foreignKey:DomainID"`
 	SSLCertificates []SSLCertificate  `json:"ssl_certificates" gorm:"foreignKey:DomainID"`
+	Redirects       []Redirect        `json:"redirects,omitempty" gorm:"foreignKey:DomainID"`
+	ProtectedDirectories []ProtectedDirectory `json:"protected_directories,omitempty" gorm:"foreignKey:DomainID"`
 	EmailAccounts   []EmailAccount    `json:"email_accounts" gorm:"foreignKey:DomainID"`
 	Databases       []Database        `json:"databases" gorm:"foreignKey:DomainID"`
 }
@@ -41,6 +72,7 @@ type Subdomain struct {
 	DomainID     uuid.UUID `json:"domain_id" gorm:"type:char(36);not null"`
 	Name         string    `json:"name" gorm:"not null"`
 	DocumentRoot string    `json:"document_root"`
+	PHPVersion   string    `json:"php_version"` // Empty inherits the domain's version
 	IsActive     bool      `json:"is_active" gorm:"default:true"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
@@ -49,6 +81,49 @@ type Subdomain struct {
 	Domain Domain `json:"domain" gorm:"foreignKey:DomainID"`
 }
 
+// Redirect sends requests for a path of a domain, or the whole domain, to another URL
+type Redirect struct {
+	ID            uuid.UUID `json:"id" gorm:"type:char(36);primary_key"`
+	DomainID      uuid.UUID `json:"domain_id" gorm:"type:char(36);not null;uniqueIndex:idx_redirects_source"`
+	SourcePath    string    `json:"source_path" gorm:"not null;size:255;uniqueIndex:idx_redirects_source"` // "/" redirects the whole domain
+	TargetURL     string    `json:"target_url" gorm:"not null;type:text"` // Absolute http(s) URL or a path on the same domain
+	StatusCode    int       `json:"status_code" gorm:"default:301"` // 301 or 302
+	PreserveQuery bool      `json:"preserve_query" gorm:"default:false"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+
+	// Relationships
+	Domain Domain `json:"-" gorm:"foreignKey:DomainID"`
+}
+
+// ProtectedDirectory requires HTTP basic authentication for a path of a domain and everything
+// below it
+type ProtectedDirectory struct {
+	ID        uuid.UUID `json:"id" gorm:"type:char(36);primary_key"`
+	DomainID  uuid.UUID `json:"domain_id" gorm:"type:char(36);not null;uniqueIndex:idx_protected_directories_path"`
+	Path      string    `json:"path" gorm:"not null;size:255;uniqueIndex:idx_protected_directories_path"` // URL path, "/" protects the whole site
+	Realm     string    `json:"realm" gorm:"not null;size:100"` // Shown by browsers in the login prompt
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Relationships
+	Domain Domain          `json:"-" gorm:"foreignKey:DomainID"`
+	Users  []DirectoryUser `json:"users,omitempty" gorm:"foreignKey:DirectoryID"`
+}
+
+// DirectoryUser is a login of a protected directory
+type DirectoryUser struct {
+	ID           uuid.UUID `json:"id" gorm:"type:char(36);primary_key"`
+	DirectoryID  uuid.UUID `json:"directory_id" gorm:"type:char(36);not null;uniqueIndex:idx_directory_users_username"`
+	Username     string    `json:"username" gorm:"not null;size:64;uniqueIndex:idx_directory_users_username"`
+	PasswordHash string    `json:"-" gorm:"not null"` // bcrypt, as written to the htpasswd file
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+
+	// Relationships
+	Directory ProtectedDirectory `json:"-" gorm:"foreignKey:DirectoryID"`
+}
+
 // DNSRecord represents a DNS record
 type DNSRecord struct {
 	ID        uuid.UUID `json:"id" gorm:"type:char(36);primary_key"`
@@ -66,13 +141,47 @@ type DNSRecord struct {
 	Domain Domain `json:"domain" gorm:"foreignKey:DomainID"`
 }
 
+// DNSZoneVersion records a change to a domain's DNS zone along with a snapshot of the resulting zone
+type DNSZoneVersion struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:char(36);primary_key"`
+	DomainID  uuid.UUID  `json:"domain_id" gorm:"type:char(36);not null;index"`
+	UserID    *uuid.UUID `json:"user_id,omitempty" gorm:"type:char(36)"`
+	RecordID  *uuid.UUID `json:"record_id,omitempty" gorm:"type:char(36)"`
+	Action    string     `json:"action" gorm:"not null"`     // create, update, delete, revert
+	OldValue  string     `json:"old_value" gorm:"type:text"` // JSON record before the change
+	NewValue  string     `json:"new_value" gorm:"type:text"` // JSON record after the change
+	Snapshot  string     `json:"-" gorm:"type:text"`         // JSON of every record in the zone after the change
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// DNSTemplate is a reusable set of DNS records that can be applied to a domain
+type DNSTemplate struct {
+	ID          uuid.UUID `json:"id" gorm:"type:char(36);primary_key"`
+	Name        string    `json:"name" gorm:"uniqueIndex;not null"`
+	Description string    `json:"description"`
+	Records     string    `json:"records" gorm:"type:text"` // JSON array of DNSTemplateRecord
+	IsBuiltin   bool      `json:"is_builtin" gorm:"default:false"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// DNSTemplateRecord is a record in a DNSTemplate. Name and Value may contain a {domain} placeholder.
+type DNSTemplateRecord struct {
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	TTL      int    `json:"ttl"`
+	Priority *int   `json:"priority,omitempty"`
+}
+
 // SSLCertificate represents an SSL certificate
 type SSLCertificate struct {
 	ID          uuid.UUID  `json:"id" gorm:"type:char(36);primary_key"`
 	DomainID    uuid.UUID  `json:"domain_id" gorm:"type:char(36);not null"`
 	Type        string     `json:"type" gorm:"not null"` // letsencrypt, custom, self-signed
+	Names       []string   `json:"names" gorm:"serializer:json;type:text"` // DNS names covered, wildcards included
 	Certificate string     `json:"-" gorm:"type:text"`
-	PrivateKey  string     `json:"-" gorm:"type:text"`
+	PrivateKey  secret.String `json:"-" gorm:"type:text"` // Encrypted at rest
 	Chain       string     `json:"-" gorm:"type:text"`
 	IsActive    bool       `json:"is_active" gorm:"default:true"`
 	AutoRenew   bool       `json:"auto_renew" gorm:"default:true"`
@@ -94,6 +203,9 @@ type EmailAccount struct {
 	QuotaMB      int       `json:"quota_mb" gorm:"default:1024"` // 1GB default
 	UsedMB       int       `json:"used_mb" gorm:"default:0"`
 	IsActive     bool      `json:"is_active" gorm:"default:true"`
+	SuspendedAt  *time.Time `json:"suspended_at,omitempty"` // Mail is paused while set
+	QuotaBlockedAt *time.Time `json:"quota_blocked_at,omitempty"` // Incoming mail is refused while set
+	SendSuspendedAt *time.Time `json:"send_suspended_at,omitempty"` // Outbound mail is refused while set
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
 
@@ -135,6 +247,28 @@ type EmailForwarder struct {
 	EmailAccount *EmailAccount `json:"email_account,omitempty" gorm:"foreignKey:EmailAccountID"`
 }
 
+// FTPAccount is an FTP/SFTP login confined to a directory of its domain
+type FTPAccount struct {
+	ID           uuid.UUID `json:"id" gorm:"type:char(36);primary_key"`
+	DomainID     uuid.UUID `json:"domain_id" gorm:"type:char(36);not null;uniqueIndex:idx_ftp_accounts_login"`
+	Username     string    `json:"username" gorm:"not null;uniqueIndex:idx_ftp_accounts_login"` // Logs in as username@domain
+	PasswordHash string    `json:"-" gorm:"not null"`
+	HomeDir      string    `json:"home_dir" gorm:"not null"` // Inside the domain's directory
+	QuotaMB      int       `json:"quota_mb" gorm:"default:0"` // 0 means the domain's disk quota only
+	ReadOnly     bool      `json:"read_only" gorm:"default:false"`
+	IsActive     bool      `json:"is_active" gorm:"default:true"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+
+	// Relationships
+	Domain Domain `json:"domain" gorm:"foreignKey:DomainID"`
+}
+
+// Login returns the name the account logs in with
+func (f *FTPAccount) Login() string {
+	return f.Username + "@" + f.Domain.Name
+}
+
 // Database represents a database
 type Database struct {
 	ID        uuid.UUID `json:"id" gorm:"type:char(36);primary_key"`
@@ -145,6 +279,8 @@ type Database struct {
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 
+	QuotaBlockedAt *time.Time `json:"quota_blocked_at,omitempty"` // Imports are refused while set
+
 	// Relationships
 	Domain        Domain         `json:"domain" gorm:"foreignKey:DomainID"`
 	DatabaseUsers []DatabaseUser `json:"database_users" gorm:"foreignKey:DatabaseID"`
@@ -179,6 +315,27 @@ func (s *Subdomain) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+func (r *Redirect) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+func (p *ProtectedDirectory) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return nil
+}
+
+func (u *DirectoryUser) BeforeCreate(tx *gorm.DB) error {
+	if u.ID == uuid.Nil {
+		u.ID = uuid.New()
+	}
+	return nil
+}
+
 func (d *DNSRecord) BeforeCreate(tx *gorm.DB) error {
 	if d.ID == uuid.Nil {
 		d.ID = uuid.New()
@@ -186,6 +343,20 @@ func (d *DNSRecord) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+func (d *DNSZoneVersion) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	return nil
+}
+
+func (d *DNSTemplate) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	return nil
+}
+
 func (s *SSLCertificate) BeforeCreate(tx *gorm.DB) error {
 	if s.ID == uuid.Nil {
 		s.ID = uuid.New()
@@ -214,6 +385,13 @@ func (e *EmailForwarder) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+func (f *FTPAccount) BeforeCreate(tx *gorm.DB) error {
+	if f.ID == uuid.Nil {
+		f.ID = uuid.New()
+	}
+	return nil
+}
+
 func (d *Database) BeforeCreate(tx *gorm.DB) error {
 	if d.ID == uuid.Nil {
 		d.ID = uuid.New()
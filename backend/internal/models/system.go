@@ -63,6 +63,7 @@ type Backup struct {
 	SizeMB      int64      `json:"size_mb" gorm:"default:0"`
 	Status      string     `json:"status" gorm:"default:'pending'"` // pending, running, completed, failed
 	Progress    int        `json:"progress" gorm:"default:0"` // 0-100
+	Metadata    string     `json:"metadata" gorm:"type:text"` // JSON manifest of the backup contents
 	StartedAt   *time.Time `json:"started_at"`
 	CompletedAt *time.Time `json:"completed_at"`
 	ExpiresAt   *time.Time `json:"expires_at"`
@@ -76,12 +77,12 @@ type Backup struct {
 
 // SystemMetric represents system metrics
 type SystemMetric struct {
-	ID        uuid.UUID `json:"id" gorm:"type:char(36);primary_key"`
+	ID        uuid.UUID `json:"id" gorm:"type:char(36);primary_key;index:idx_system_metrics_keyset,priority:2"`
 	Type      string    `json:"type" gorm:"not null"` // cpu, memory, disk, network
 	Value     float64   `json:"value" gorm:"not null"`
 	Unit      string    `json:"unit" gorm:"not null"` // percent, bytes, etc.
 	Metadata  string    `json:"metadata" gorm:"type:text"` // JSON metadata
-	CreatedAt time.Time `json:"created_at"`
+	CreatedAt time.Time `json:"created_at" gorm:"index:idx_system_metrics_keyset,priority:1"`
 }
 
 // ServerResource represents server resource usage
@@ -102,6 +103,38 @@ type ServerResource struct {
 	CreatedAt        time.Time `json:"created_at"`
 }
 
+// TrafficSample is the web traffic of a domain and its subdomains during one hour (UTC), taken
+// from their access logs
+type TrafficSample struct {
+	DomainID uuid.UUID `json:"domain_id" gorm:"type:char(36);primaryKey"`
+	Hour     time.Time `json:"hour" gorm:"primaryKey;index"`
+	BytesIn  int64     `json:"bytes_in" gorm:"default:0"`  // Request sizes; 0 unless the log records them
+	BytesOut int64     `json:"bytes_out" gorm:"default:0"` // Response bodies
+	Requests int64     `json:"requests" gorm:"default:0"`
+}
+
+// UsageSnapshot is the resource usage of a domain at one point in time, sampled for billing
+// exports. It records the owner and name at that time, so it outlives transfers and deletion.
+type UsageSnapshot struct {
+	DomainID       uuid.UUID `json:"domain_id" gorm:"type:char(36);primaryKey"`
+	TakenAt        time.Time `json:"taken_at" gorm:"primaryKey;index:idx_usage_snapshots_user,priority:2"`
+	UserID         uuid.UUID `json:"user_id" gorm:"type:char(36);not null;index:idx_usage_snapshots_user,priority:1"`
+	DomainName     string    `json:"domain_name" gorm:"not null"`
+	DiskUsage      int64     `json:"disk_usage" gorm:"default:0"`      // Bytes
+	BandwidthUsage int64     `json:"bandwidth_usage" gorm:"default:0"` // Bytes in the month so far
+	EmailAccounts  int       `json:"email_accounts" gorm:"default:0"`
+	EmailUsedMB    int64     `json:"email_used_mb" gorm:"default:0"`
+	Databases      int       `json:"databases" gorm:"default:0"`
+	DatabaseSizeMB int64     `json:"database_size_mb" gorm:"default:0"`
+}
+
+// TrafficLogCursor is how far an access log has been read into traffic samples
+type TrafficLogCursor struct {
+	Path      string    `json:"path" gorm:"primaryKey;size:512"`
+	Offset    int64     `json:"offset"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
 // ServiceStatus represents the status of system services
 type ServiceStatus struct {
 	ID          uuid.UUID `json:"id" gorm:"type:char(36);primary_key"`
@@ -116,9 +149,73 @@ type ServiceStatus struct {
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
+// ServiceRestart is an attempt of the watchdog to restart a failed service
+type ServiceRestart struct {
+	ID        uuid.UUID `json:"id" gorm:"type:char(36);primary_key"`
+	Service   string    `json:"service" gorm:"not null;size:255;index:idx_service_restarts_service,priority:1"`
+	Attempt   int       `json:"attempt" gorm:"not null"` // 1 for the first restart since the service last ran
+	Success   bool      `json:"success"`
+	Error     string    `json:"error,omitempty" gorm:"type:text"`
+	CreatedAt time.Time `json:"created_at" gorm:"index:idx_service_restarts_service,priority:2"`
+}
+
+// OutboxEmail is an outbound email queued for delivery by the mailer
+type OutboxEmail struct {
+	ID            uuid.UUID  `json:"id" gorm:"type:char(36);primary_key"`
+	To            string     `json:"to" gorm:"not null"`
+	Subject       string     `json:"subject" gorm:"not null"`
+	Body          string     `json:"body" gorm:"type:text"`
+	Template      string     `json:"template"`
+	Status        string     `json:"status" gorm:"default:'pending';index"` // pending, sending, sent, dead
+	Attempts      int        `json:"attempts" gorm:"default:0"`
+	LastError     string     `json:"last_error" gorm:"type:text"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" gorm:"index"`
+	SentAt        *time.Time `json:"sent_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// QuotaAlert records that a resource's usage crossed a quota threshold during a cycle
+type QuotaAlert struct {
+	ID           uuid.UUID  `json:"id" gorm:"type:char(36);primary_key"`
+	OwnerID      uuid.UUID  `json:"owner_id" gorm:"type:char(36);index"`
+	Resource     string     `json:"resource" gorm:"not null"` // domain, email_account
+	ResourceID   uuid.UUID  `json:"resource_id" gorm:"type:char(36);not null;uniqueIndex:idx_quota_alerts_dedup"`
+	ResourceName string     `json:"resource_name"`
+	Metric       string     `json:"metric" gorm:"not null;uniqueIndex:idx_quota_alerts_dedup"` // disk, bandwidth, mailbox
+	Threshold    int        `json:"threshold" gorm:"not null;uniqueIndex:idx_quota_alerts_dedup"` // Percent of the quota
+	Cycle        string     `json:"cycle" gorm:"not null;uniqueIndex:idx_quota_alerts_dedup"` // Billing month, e.g. 2024-05
+	Usage        int64      `json:"usage"`
+	Quota        int64      `json:"quota"`
+	ResolvedAt   *time.Time `json:"resolved_at"` // Set once usage drops back below the threshold
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// Node represents a managed server that hosts domains
+type Node struct {
+	ID            uuid.UUID  `json:"id" gorm:"type:char(36);primary_key"`
+	Name          string     `json:"name" gorm:"uniqueIndex;not null"`
+	Hostname      string     `json:"hostname" gorm:"not null"`
+	IPAddress     string     `json:"ip_address" gorm:"not null"`
+	IPv6Address   string     `json:"ipv6_address,omitempty" gorm:"column:ipv6_address"` // Optional; AAAA records point at it when set
+	Roles         string     `json:"roles" gorm:"type:text"` // JSON array: web, dns, mail, database
+	AgentEndpoint string     `json:"agent_endpoint"`
+	IsDefault     bool       `json:"is_default" gorm:"default:false"` // Receives new domains
+	IsActive      bool       `json:"is_active" gorm:"default:true"`
+	LastSeenAt    *time.Time `json:"last_seen_at"`
+
+	// What the server can hold, in bytes, for the overcommit guard; 0 leaves it unchecked
+	DiskCapacity      int64 `json:"disk_capacity" gorm:"default:0"`
+	BandwidthCapacity int64 `json:"bandwidth_capacity" gorm:"default:0"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
 // SecurityEvent represents security events
 type SecurityEvent struct {
-	ID          uuid.UUID  `json:"id" gorm:"type:char(36);primary_key"`
+	ID          uuid.UUID  `json:"id" gorm:"type:char(36);primary_key;index:idx_security_events_keyset,priority:2"`
 	UserID      *uuid.UUID `json:"user_id,omitempty" gorm:"type:char(36)"`
 	Type        string     `json:"type" gorm:"not null"` // login_failed, brute_force, suspicious_activity
 	Severity    string     `json:"severity" gorm:"not null"` // low, medium, high, critical
@@ -130,13 +227,48 @@ type SecurityEvent struct {
 	IsResolved  bool       `json:"is_resolved" gorm:"default:false"`
 	ResolvedAt  *time.Time `json:"resolved_at"`
 	ResolvedBy  *uuid.UUID `json:"resolved_by,omitempty" gorm:"type:char(36)"`
-	CreatedAt   time.Time  `json:"created_at"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"index:idx_security_events_keyset,priority:1"`
 
 	// Relationships
 	User       *User `json:"user,omitempty" gorm:"foreignKey:UserID"`
 	ResolvedByUser *User `json:"resolved_by_user,omitempty" gorm:"foreignKey:ResolvedBy"`
 }
 
+// AbuseReport is a complaint about a hosted domain or account, such as spam or phishing,
+// triaged by admins from open through investigating to resolved
+type AbuseReport struct {
+	ID             uuid.UUID  `json:"id" gorm:"type:char(36);primary_key;index:idx_abuse_reports_keyset,priority:2"`
+	ReporterName   string     `json:"reporter_name" gorm:"size:128"`
+	ReporterEmail  string     `json:"reporter_email" gorm:"size:255"`
+	ReporterUserID *uuid.UUID `json:"reporter_user_id,omitempty" gorm:"type:char(36)"` // Set when a logged-in user reported
+	ReporterIP     string     `json:"reporter_ip" gorm:"size:45"`
+	Target         string     `json:"target" gorm:"size:255;not null"` // Domain or URL as reported
+	DomainID       *uuid.UUID `json:"domain_id,omitempty" gorm:"type:char(36);index"` // Hosted domain the target resolved to
+	TargetUserID   *uuid.UUID `json:"target_user_id,omitempty" gorm:"type:char(36);index"` // Owner of that domain
+	Category       string     `json:"category" gorm:"size:32;not null"`
+	Description    string     `json:"description" gorm:"type:text"`
+	Status         string     `json:"status" gorm:"size:16;not null;index"` // open, investigating, resolved
+	ResolvedAt     *time.Time `json:"resolved_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"index:idx_abuse_reports_keyset,priority:1"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+
+	// Relationships
+	Notes []AbuseReportNote `json:"notes,omitempty" gorm:"foreignKey:ReportID"`
+}
+
+// AbuseReportNote records an admin's note on an abuse report, with the status change or
+// suspension made along with it
+type AbuseReportNote struct {
+	ID         uuid.UUID  `json:"id" gorm:"type:char(36);primary_key"`
+	ReportID   uuid.UUID  `json:"report_id" gorm:"type:char(36);not null;index"`
+	UserID     *uuid.UUID `json:"user_id,omitempty" gorm:"type:char(36)"`
+	FromStatus string     `json:"from_status" gorm:"size:16"`
+	ToStatus   string     `json:"to_status" gorm:"size:16"`
+	Action     string     `json:"action,omitempty" gorm:"size:32"` // domain_suspend or user_deactivate
+	Note       string     `json:"note" gorm:"type:text"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
 // BeforeCreate hooks
 func (f *FileManager) BeforeCreate(tx *gorm.DB) error {
 	if f.ID == uuid.Nil {
@@ -180,9 +312,51 @@ func (s *ServiceStatus) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+func (r *ServiceRestart) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+func (o *OutboxEmail) BeforeCreate(tx *gorm.DB) error {
+	if o.ID == uuid.Nil {
+		o.ID = uuid.New()
+	}
+	return nil
+}
+
+func (n *Node) BeforeCreate(tx *gorm.DB) error {
+	if n.ID == uuid.Nil {
+		n.ID = uuid.New()
+	}
+	return nil
+}
+
+func (q *QuotaAlert) BeforeCreate(tx *gorm.DB) error {
+	if q.ID == uuid.Nil {
+		q.ID = uuid.New()
+	}
+	return nil
+}
+
 func (s *SecurityEvent) BeforeCreate(tx *gorm.DB) error {
 	if s.ID == uuid.Nil {
 		s.ID = uuid.New()
 	}
 	return nil
 }
+
+func (a *AbuseReport) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
+
+func (n *AbuseReportNote) BeforeCreate(tx *gorm.DB) error {
+	if n.ID == uuid.Nil {
+		n.ID = uuid.New()
+	}
+	return nil
+}
@@ -5,6 +5,8 @@ import (
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/secret"
 )
 
 // User represents a user in the system
@@ -15,14 +17,25 @@ type User struct {
 	PasswordHash      string     `json:"-" gorm:"not null"`
 	FirstName         string     `json:"first_name"`
 	LastName          string     `json:"last_name"`
+	Locale            string     `json:"locale" gorm:"size:10"` // Preferred language of messages; empty follows the browser
 	IsActive          bool       `json:"is_active" gorm:"default:true"`
 	IsEmailVerified   bool       `json:"is_email_verified" gorm:"default:false"`
 	IsTwoFactorEnabled bool      `json:"is_two_factor_enabled" gorm:"default:false"`
-	TwoFactorSecret   string     `json:"-"`
+	TwoFactorSecret   secret.String `json:"-" gorm:"type:text"` // Encrypted at rest
+	TwoFactorBackupCodes string  `json:"-" gorm:"type:text"` // JSON array of hashed one-time backup codes
+	TwoFactorMethod   string     `json:"two_factor_method" gorm:"size:20"` // Default second factor: totp, email or webauthn
+	EmailOTPEnabled   bool       `json:"email_otp_enabled" gorm:"default:false"` // Login codes are sent to the verified address
 	LastLoginAt       *time.Time `json:"last_login_at"`
 	LastLoginIP       string     `json:"last_login_ip"`
 	FailedLoginCount  int        `json:"failed_login_count" gorm:"default:0"`
 	LockedUntil       *time.Time `json:"locked_until"`
+	PasswordChangedAt *time.Time `json:"password_changed_at,omitempty"` // Nil for older accounts, whose password dates from CreatedAt
+	PasswordWarnedAt  *time.Time `json:"-"`                             // When the upcoming password expiry was notified; cleared on change
+	DeletionWarnedAt  *time.Time `json:"deletion_warned_at,omitempty"`  // When the unverified-account deletion warning was sent
+	InactiveFlaggedAt *time.Time `json:"inactive_flagged_at,omitempty"` // Set by the cleanup job; cleared on login
+	// Logins are only accepted from these CIDR ranges and ISO country codes; an empty list allows any
+	AllowedIPRanges  []string `json:"allowed_ip_ranges" gorm:"serializer:json;type:text"`
+	AllowedCountries []string `json:"allowed_countries" gorm:"serializer:json;type:text"`
 	CreatedAt         time.Time  `json:"created_at"`
 	UpdatedAt         time.Time  `json:"updated_at"`
 	DeletedAt         gorm.DeletedAt `json:"-" gorm:"index"`
@@ -40,6 +53,17 @@ type Role struct {
 	DisplayName string    `json:"display_name" gorm:"not null"`
 	Description string    `json:"description"`
 	IsSystem    bool      `json:"is_system" gorm:"default:false"`
+
+	// Package allocations for new domains; nil falls back to the configured defaults
+	DiskQuota      *int64 `json:"disk_quota,omitempty"`
+	BandwidthQuota *int64 `json:"bandwidth_quota,omitempty"`
+	MaxSubdomains  *int   `json:"max_subdomains,omitempty"` // Per domain; 0 means unlimited
+	AutoSSL        *bool  `json:"auto_ssl,omitempty"`       // Issue certificates for new domains automatically
+
+	// Days after which members must change their password; nil falls back to the configured
+	// maximum age and 0 exempts the role. With several roles the shortest age applies.
+	PasswordMaxAgeDays *int `json:"password_max_age_days,omitempty"`
+
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 
@@ -87,24 +111,55 @@ type RolePermission struct {
 
 // Session represents a user session
 type Session struct {
-	ID           uuid.UUID  `json:"id" gorm:"type:char(36);primary_key"`
+	ID           uuid.UUID  `json:"id" gorm:"type:char(36);primary_key;index:idx_sessions_keyset,priority:2"`
 	UserID       uuid.UUID  `json:"user_id" gorm:"type:char(36);not null"`
 	Token        string     `json:"-" gorm:"uniqueIndex;not null"`
 	RefreshToken string     `json:"-" gorm:"uniqueIndex;not null"`
 	IPAddress    string     `json:"ip_address"`
 	UserAgent    string     `json:"user_agent"`
+	CountryCode  string     `json:"country_code"`
+	Country      string     `json:"country"`
+	City         string     `json:"city"`
 	ExpiresAt    time.Time  `json:"expires_at"`
 	LastUsedAt   time.Time  `json:"last_used_at"`
-	CreatedAt    time.Time  `json:"created_at"`
+	CreatedAt    time.Time  `json:"created_at" gorm:"index:idx_sessions_keyset,priority:1"`
 	RevokedAt    *time.Time `json:"revoked_at"`
 
 	// Relationships
 	User User `json:"user" gorm:"foreignKey:UserID"`
 }
 
+// SSHKey represents a public key allowed to log in as the user's shell/SFTP account
+type SSHKey struct {
+	ID          uuid.UUID `json:"id" gorm:"type:char(36);primary_key"`
+	UserID      uuid.UUID `json:"user_id" gorm:"type:char(36);not null;uniqueIndex:idx_ssh_keys_user_fingerprint"`
+	Name        string    `json:"name" gorm:"not null"`
+	PublicKey   string    `json:"public_key" gorm:"type:text;not null"`
+	Fingerprint string    `json:"fingerprint" gorm:"not null;uniqueIndex:idx_ssh_keys_user_fingerprint"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	// Relationships
+	User User `json:"-" gorm:"foreignKey:UserID"`
+}
+
+// WebAuthnCredential is a security key or passkey a user enrolled as a second factor
+type WebAuthnCredential struct {
+	ID           uuid.UUID  `json:"id" gorm:"type:char(36);primary_key"`
+	UserID       uuid.UUID  `json:"user_id" gorm:"type:char(36);not null;index"`
+	Name         string     `json:"name" gorm:"not null"`
+	CredentialID string     `json:"credential_id" gorm:"size:255;uniqueIndex;not null"` // Base64url, as the authenticator reports it
+	PublicKey    []byte     `json:"-" gorm:"type:blob;not null"` // COSE_Key from the attestation
+	SignCount    uint32     `json:"sign_count"` // Last signature counter seen, to detect cloned authenticators
+	CreatedAt    time.Time  `json:"created_at"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+
+	// Relationships
+	User User `json:"-" gorm:"foreignKey:UserID"`
+}
+
 // AuditLog represents an audit log entry
 type AuditLog struct {
-	ID         uuid.UUID `json:"id" gorm:"type:char(36);primary_key"`
+	ID         uuid.UUID `json:"id" gorm:"type:char(36);primary_key;index:idx_audit_logs_keyset,priority:2"`
 	UserID     *uuid.UUID `json:"user_id" gorm:"type:char(36)"`
 	Action     string    `json:"action" gorm:"not null"`
 	Resource   string    `json:"resource" gorm:"not null"`
@@ -113,12 +168,82 @@ type AuditLog struct {
 	UserAgent  string    `json:"user_agent"`
 	Details    string    `json:"details" gorm:"type:text"`
 	Success    bool      `json:"success" gorm:"default:true"`
-	CreatedAt  time.Time `json:"created_at"`
+	CreatedAt  time.Time `json:"created_at" gorm:"index:idx_audit_logs_keyset,priority:1"`
 
 	// Relationships
 	User *User `json:"user,omitempty" gorm:"foreignKey:UserID"`
 }
 
+// RegistrationInvite lets people register while registration is invite-only. Only a hash of
+// the code is stored.
+type RegistrationInvite struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:char(36);primary_key"`
+	CodeHash  string     `json:"-" gorm:"uniqueIndex;size:64;not null"`
+	Email     string     `json:"email,omitempty"` // Only this address may register with it when set
+	MaxUses   int        `json:"max_uses" gorm:"default:1"`
+	Uses      int        `json:"uses" gorm:"default:0"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedBy *uuid.UUID `json:"created_by,omitempty" gorm:"type:char(36)"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// ChangeLog records one create, update or delete of a tracked model. Changes maps each changed
+// column to its [old, new] values, with secret columns redacted.
+type ChangeLog struct {
+	ID         uuid.UUID  `json:"id" gorm:"type:char(36);primary_key"`
+	UserID     *uuid.UUID `json:"user_id" gorm:"type:char(36)"`
+	Resource   string     `json:"resource" gorm:"not null;size:64;index:idx_change_logs_resource,priority:1"` // Table name
+	ResourceID string     `json:"resource_id" gorm:"not null;size:64;index:idx_change_logs_resource,priority:2"`
+	Action     string     `json:"action" gorm:"not null"` // create, update, delete
+	Changes    string     `json:"changes" gorm:"type:text"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"index:idx_change_logs_resource,priority:3"`
+}
+
+// NotificationPreference is how a user wants notifications of one event type: by email or only
+// in the panel, and immediately, in a digest or not at all. Event types without one are emailed
+// immediately.
+type NotificationPreference struct {
+	UserID    uuid.UUID `json:"-" gorm:"type:char(36);primaryKey"`
+	EventType string    `json:"event_type" gorm:"primaryKey;size:32"`
+	Channel   string    `json:"channel" gorm:"size:16;not null"`   // email, panel
+	Frequency string    `json:"frequency" gorm:"size:16;not null"` // immediate, digest, off
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Notification is a message to a user about an event, listed in the panel. Email notifications
+// are emailed at once or, while DigestPending, with the user's next digest.
+type Notification struct {
+	ID            uuid.UUID  `json:"id" gorm:"type:char(36);primary_key"`
+	UserID        uuid.UUID  `json:"user_id" gorm:"type:char(36);not null;index:idx_notifications_user,priority:1"`
+	EventType     string     `json:"event_type" gorm:"size:32;not null"`
+	Subject       string     `json:"subject" gorm:"not null"`
+	Body          string     `json:"body" gorm:"type:text"`
+	DigestPending bool       `json:"digest_pending" gorm:"default:false;index"`
+	EmailedAt     *time.Time `json:"emailed_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at" gorm:"index:idx_notifications_user,priority:2"`
+}
+
+// VaultItem is a secret a user keeps in the panel, such as a password or notes. The secret and
+// notes are sealed together with the keyring, bound to the user and item, and only opened for
+// the owner; the name is stored in the clear so items can be listed without decrypting them.
+type VaultItem struct {
+	ID        uuid.UUID `json:"id" gorm:"type:char(36);primary_key"`
+	UserID    uuid.UUID `json:"user_id" gorm:"type:char(36);not null;index"`
+	Name      string    `json:"name" gorm:"size:128;not null"`
+	Sealed    string    `json:"-" gorm:"type:text;not null"` // Encrypted JSON of the secret and notes
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// PasswordHistory is a password a user had, kept so a new password cannot repeat a recent one
+type PasswordHistory struct {
+	ID           uuid.UUID `json:"id" gorm:"type:char(36);primary_key"`
+	UserID       uuid.UUID `json:"user_id" gorm:"type:char(36);not null;index:idx_password_histories_user,priority:1"`
+	PasswordHash string    `json:"-" gorm:"not null"`
+	CreatedAt    time.Time `json:"created_at" gorm:"index:idx_password_histories_user,priority:2"`
+}
+
 // BeforeCreate hook for User model
 func (u *User) BeforeCreate(tx *gorm.DB) error {
 	if u.ID == uuid.Nil {
@@ -151,6 +276,22 @@ func (s *Session) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// BeforeCreate hook for SSHKey model
+func (k *SSHKey) BeforeCreate(tx *gorm.DB) error {
+	if k.ID == uuid.Nil {
+		k.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeCreate hook for VaultItem model
+func (v *VaultItem) BeforeCreate(tx *gorm.DB) error {
+	if v.ID == uuid.Nil {
+		v.ID = uuid.New()
+	}
+	return nil
+}
+
 // BeforeCreate hook for AuditLog model
 func (a *AuditLog) BeforeCreate(tx *gorm.DB) error {
 	if a.ID == uuid.Nil {
@@ -159,6 +300,46 @@ func (a *AuditLog) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// BeforeCreate hook for RegistrationInvite model
+func (i *RegistrationInvite) BeforeCreate(tx *gorm.DB) error {
+	if i.ID == uuid.Nil {
+		i.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeCreate hook for WebAuthnCredential model
+func (c *WebAuthnCredential) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeCreate hook for ChangeLog model
+func (c *ChangeLog) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeCreate hook for Notification model
+func (n *Notification) BeforeCreate(tx *gorm.DB) error {
+	if n.ID == uuid.Nil {
+		n.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeCreate hook for PasswordHistory model
+func (h *PasswordHistory) BeforeCreate(tx *gorm.DB) error {
+	if h.ID == uuid.Nil {
+		h.ID = uuid.New()
+	}
+	return nil
+}
+
 // TableName returns the table name for UserRole
 func (UserRole) TableName() string {
 	return "user_roles"
@@ -0,0 +1,67 @@
+package openapi
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDocumentAddPathParameters(t *testing.T) {
+	doc := NewDocument("Test API", "1.0.0")
+	doc.Add("GET", "/domains/:id/records/:record", &Operation{
+		Summary:    "Get a record",
+		Parameters: []Parameter{{Name: "record", In: "path", Required: true, Description: "Record ID", Schema: UUID()}},
+		Responses:  map[string]Response{"200": JSONResponse("Record", nil)},
+	})
+	doc.Add("DELETE", "/domains/:id/records/:record", &Operation{Summary: "Delete a record", Responses: map[string]Response{"204": {Description: "Deleted"}}})
+
+	item, ok := doc.Paths["/domains/{id}/records/{record}"]
+	if !ok {
+		t.Fatalf("paths = %v, want the templated path", doc.Paths)
+	}
+	if item["get"] == nil || item["delete"] == nil {
+		t.Fatalf("methods = %v, want get and delete", item)
+	}
+
+	get := item["get"]
+	if len(get.Parameters) != 2 {
+		t.Fatalf("parameters = %+v, want record and id", get.Parameters)
+	}
+	if get.Parameters[0].Description != "Record ID" || get.Parameters[0].Schema.Format != "uuid" {
+		t.Errorf("declared parameter replaced: %+v", get.Parameters[0])
+	}
+	if id := get.Parameters[1]; id.Name != "id" || id.In != "path" || !id.Required {
+		t.Errorf("added parameter = %+v, want required path parameter id", id)
+	}
+}
+
+func TestDocumentEncoding(t *testing.T) {
+	doc := NewDocument("Test API", "1.0.0")
+	public := []map[string][]string{}
+	doc.Add("POST", "/login", &Operation{
+		Summary:     "Log in",
+		RequestBody: JSONBody(Object(map[string]*Schema{"email": String(1, 255)}, "email")),
+		Responses:   map[string]Response{"200": JSONResponse("Tokens", nil)},
+		Security:    &public,
+	})
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if decoded["openapi"] != "3.0.3" {
+		t.Errorf("openapi = %v", decoded["openapi"])
+	}
+
+	login := decoded["paths"].(map[string]interface{})["/login"].(map[string]interface{})["post"].(map[string]interface{})
+	if security, ok := login["security"].([]interface{}); !ok || len(security) != 0 {
+		t.Errorf("security = %v, want an empty list for a public operation", login["security"])
+	}
+	schema := login["requestBody"].(map[string]interface{})["content"].(map[string]interface{})["application/json"].(map[string]interface{})["schema"].(map[string]interface{})
+	if schema["additionalProperties"] != false {
+		t.Errorf("request schema additionalProperties = %v, want false", schema["additionalProperties"])
+	}
+}
@@ -0,0 +1,252 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+)
+
+// Schema is the subset of the OpenAPI 3.0 schema object the panel's API uses. The same value is
+// published in the spec and enforced on request bodies by Validate.
+type Schema struct {
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"` // Validated for "uuid"
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"` // Unknown fields are rejected when false
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+}
+
+// Object returns a closed object schema: fields outside properties are rejected
+func Object(properties map[string]*Schema, required ...string) *Schema {
+	closed := false
+	return &Schema{Type: "object", Properties: properties, Required: required, AdditionalProperties: &closed}
+}
+
+// String returns a string schema with optional length bounds; a negative bound is omitted
+func String(minLength, maxLength int) *Schema {
+	s := &Schema{Type: "string"}
+	if minLength >= 0 {
+		s.MinLength = &minLength
+	}
+	if maxLength >= 0 {
+		s.MaxLength = &maxLength
+	}
+	return s
+}
+
+// Integer returns an integer schema bounded by minimum and maximum
+func Integer(minimum, maximum float64) *Schema {
+	return &Schema{Type: "integer", Minimum: &minimum, Maximum: &maximum}
+}
+
+// Boolean returns a boolean schema
+func Boolean() *Schema {
+	return &Schema{Type: "boolean"}
+}
+
+// UUID returns a string schema in uuid format
+func UUID() *Schema {
+	return &Schema{Type: "string", Format: "uuid"}
+}
+
+// Describe sets the description of a schema and returns it
+func (s *Schema) Describe(description string) *Schema {
+	s.Description = description
+	return s
+}
+
+// Matching sets the pattern of a string schema and returns it
+func (s *Schema) Matching(pattern string) *Schema {
+	s.Pattern = pattern
+	return s
+}
+
+// patterns caches compiled Pattern values
+var patterns sync.Map
+
+// Validate checks a decoded JSON document against the schema. Values must be decoded with
+// json.Decoder.UseNumber so integers can be told from fractions. Problems are reported per field,
+// with nested fields joined by dots and array elements indexed, e.g. "items[2].name"; problems
+// with the document itself are reported under "body".
+func (s *Schema) Validate(value interface{}) error {
+	v := apperrors.NewValidation()
+	s.validate(v, "", value)
+	return v.Err()
+}
+
+func (s *Schema) validate(v *apperrors.ValidationError, path string, value interface{}) {
+	field := path
+	if field == "" {
+		field = "body"
+	}
+
+	if value == nil {
+		if !s.Nullable {
+			v.AddCode(field, "field.null", nil)
+		}
+		return
+	}
+
+	switch s.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			v.AddCode(field, "field.object", nil)
+			return
+		}
+		s.validateObject(v, path, object)
+		return
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			v.AddCode(field, "field.array", nil)
+			return
+		}
+		if s.Items != nil {
+			for i, item := range array {
+				s.Items.validate(v, fmt.Sprintf("%s[%d]", path, i), item)
+			}
+		}
+		return
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			v.AddCode(field, "field.string", nil)
+			return
+		}
+		if code, params := s.checkString(str); code != "" {
+			v.AddCode(field, code, params)
+			return
+		}
+	case "integer", "number":
+		number, ok := value.(json.Number)
+		if !ok {
+			v.AddCode(field, "field.number", nil)
+			return
+		}
+		if code, params := s.checkNumber(number); code != "" {
+			v.AddCode(field, code, params)
+			return
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			v.AddCode(field, "field.boolean", nil)
+			return
+		}
+	}
+
+	if len(s.Enum) > 0 && !s.inEnum(value) {
+		v.AddCode(field, "field.enum", map[string]string{"values": fmt.Sprint(s.Enum)})
+	}
+}
+
+func (s *Schema) validateObject(v *apperrors.ValidationError, path string, object map[string]interface{}) {
+	prefix := ""
+	if path != "" {
+		prefix = path + "."
+	}
+
+	for _, name := range s.Required {
+		if _, ok := object[name]; !ok {
+			v.AddCode(prefix+name, "field.required", nil)
+		}
+	}
+
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		property, ok := s.Properties[name]
+		if !ok {
+			if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				v.AddCode(prefix+name, "field.unknown", nil)
+			}
+			continue
+		}
+		property.validate(v, prefix+name, object[name])
+	}
+}
+
+// checkString returns the message code and parameters of the first constraint str violates
+func (s *Schema) checkString(str string) (string, map[string]string) {
+	length := utf8.RuneCountInString(str)
+	if s.MinLength != nil && length < *s.MinLength {
+		if *s.MinLength == 1 {
+			return "field.empty", nil
+		}
+		return "field.min_length", map[string]string{"min": strconv.Itoa(*s.MinLength)}
+	}
+	if s.MaxLength != nil && length > *s.MaxLength {
+		return "field.max_length", map[string]string{"max": strconv.Itoa(*s.MaxLength)}
+	}
+	if s.Format == "uuid" {
+		if _, err := uuid.Parse(str); err != nil {
+			return "field.uuid", nil
+		}
+	}
+	if s.Pattern != "" {
+		compiled, ok := patterns.Load(s.Pattern)
+		if !ok {
+			compiled, _ = patterns.LoadOrStore(s.Pattern, regexp.MustCompile(s.Pattern))
+		}
+		if !compiled.(*regexp.Regexp).MatchString(str) {
+			return "field.format", nil
+		}
+	}
+	return "", nil
+}
+
+// checkNumber returns the message code and parameters of the first constraint number violates
+func (s *Schema) checkNumber(number json.Number) (string, map[string]string) {
+	value, err := number.Float64()
+	if err != nil {
+		return "field.number", nil
+	}
+	if s.Type == "integer" {
+		if _, err := strconv.ParseInt(number.String(), 10, 64); err != nil {
+			return "field.integer", nil
+		}
+	}
+	if s.Minimum != nil && value < *s.Minimum {
+		return "field.minimum", map[string]string{"min": fmt.Sprint(*s.Minimum)}
+	}
+	if s.Maximum != nil && value > *s.Maximum {
+		return "field.maximum", map[string]string{"max": fmt.Sprint(*s.Maximum)}
+	}
+	return "", nil
+}
+
+// inEnum compares a decoded value with the enum by its JSON form, so 301 matches json.Number("301")
+func (s *Schema) inEnum(value interface{}) bool {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range s.Enum {
+		candidate, err := json.Marshal(allowed)
+		if err == nil && string(candidate) == string(encoded) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+)
+
+// decode parses a document the way request bodies are parsed before validation
+func decode(t *testing.T, document string) interface{} {
+	t.Helper()
+
+	var value interface{}
+	decoder := json.NewDecoder(strings.NewReader(document))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		t.Fatalf("decode %s: %v", document, err)
+	}
+	return value
+}
+
+func TestSchemaValidate(t *testing.T) {
+	schema := Object(map[string]*Schema{
+		"name":     String(1, 10).Matching(`^[a-z]+$`),
+		"owner_id": UUID(),
+		"ttl":      Integer(60, 86400),
+		"active":   Boolean(),
+		"status":   {Type: "integer", Enum: []interface{}{301, 302}},
+		"note":     {Type: "string", Nullable: true},
+		"tags":     {Type: "array", Items: String(1, -1)},
+		"limits":   Object(map[string]*Schema{"disk": Integer(0, 100)}, "disk"),
+	}, "name")
+
+	tests := []struct {
+		name     string
+		document string
+		invalid  []string // Fields reported, sorted
+	}{
+		{"valid", `{"name":"shop","owner_id":"8c6f1d4e-2f4b-4f0a-9d59-3c1b1a7e2c11","ttl":3600,"active":true,"status":301,"note":null,"tags":["a"],"limits":{"disk":5}}`, nil},
+		{"only required", `{"name":"shop"}`, nil},
+		{"missing required", `{"ttl":3600}`, []string{"name"}},
+		{"unknown field", `{"name":"shop","color":"red"}`, []string{"color"}},
+		{"empty string", `{"name":""}`, []string{"name"}},
+		{"too long", `{"name":"abcdefghijk"}`, []string{"name"}},
+		{"pattern", `{"name":"Shop"}`, []string{"name"}},
+		{"uuid", `{"name":"shop","owner_id":"42"}`, []string{"owner_id"}},
+		{"fraction for integer", `{"name":"shop","ttl":60.5}`, []string{"ttl"}},
+		{"below minimum", `{"name":"shop","ttl":59}`, []string{"ttl"}},
+		{"above maximum", `{"name":"shop","ttl":86401}`, []string{"ttl"}},
+		{"string for integer", `{"name":"shop","ttl":"3600"}`, []string{"ttl"}},
+		{"string for boolean", `{"name":"shop","active":"yes"}`, []string{"active"}},
+		{"outside enum", `{"name":"shop","status":307}`, []string{"status"}},
+		{"null where not nullable", `{"name":null}`, []string{"name"}},
+		{"array element", `{"name":"shop","tags":["a",""]}`, []string{"tags[1]"}},
+		{"nested field", `{"name":"shop","limits":{"disk":101,"cpu":1}}`, []string{"limits.cpu", "limits.disk"}},
+		{"nested required", `{"name":"shop","limits":{}}`, []string{"limits.disk"}},
+		{"several problems", `{"ttl":1,"active":1}`, []string{"active", "name", "ttl"}},
+		{"not an object", `["shop"]`, []string{"body"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := schema.Validate(decode(t, tt.document))
+			if tt.invalid == nil {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+
+			validation, ok := apperrors.AsValidation(err)
+			if !ok {
+				t.Fatalf("Validate() error = %v, want a validation error", err)
+			}
+			var fields []string
+			for field, message := range validation.Fields {
+				if message == "" {
+					t.Errorf("field %s has no message", field)
+				}
+				fields = append(fields, field)
+			}
+			sort.Strings(fields)
+			if !reflect.DeepEqual(fields, tt.invalid) {
+				t.Errorf("invalid fields = %v, want %v", fields, tt.invalid)
+			}
+		})
+	}
+}
+
+func TestSchemaMessages(t *testing.T) {
+	schema := Object(map[string]*Schema{"name": String(3, 10), "ttl": Integer(60, 100)}, "name")
+
+	validation, _ := apperrors.AsValidation(schema.Validate(decode(t, `{"name":"ab","ttl":500}`)))
+	if validation == nil {
+		t.Fatal("Validate() accepted an invalid document")
+	}
+	if !strings.Contains(validation.Fields["name"], "3") {
+		t.Errorf("name message = %q, want the minimum length", validation.Fields["name"])
+	}
+	if !strings.Contains(validation.Fields["ttl"], "100") {
+		t.Errorf("ttl message = %q, want the maximum", validation.Fields["ttl"])
+	}
+}
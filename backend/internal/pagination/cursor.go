@@ -0,0 +1,83 @@
+// Package pagination provides keyset (cursor) pagination for large, append-mostly tables.
+// Rows are paged newest first by (created_at, id), so deep pages cost the same as the first
+// and rows inserted while a client pages through are never returned twice.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultLimit is used when a caller does not ask for a page size
+	DefaultLimit = 50
+	// MaxLimit caps the page size
+	MaxLimit = 200
+)
+
+// Cursor identifies the last row of a page
+type Cursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        string    `json:"i"`
+}
+
+// Encode returns the opaque token handed to clients
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Decode parses a token produced by Encode
+func Decode(token string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	var cursor Cursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == "" {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+
+	return &cursor, nil
+}
+
+// ClampLimit applies the default and maximum page sizes
+func ClampLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultLimit
+	}
+	if limit > MaxLimit {
+		return MaxLimit
+	}
+	return limit
+}
+
+// Apply orders query newest first and restricts it to the rows after token. It fetches one
+// extra row so Next can tell whether another page exists.
+func Apply(query *gorm.DB, token string, limit int) (*gorm.DB, error) {
+	if token != "" {
+		cursor, err := Decode(token)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("(created_at < ? OR (created_at = ? AND id < ?))", cursor.CreatedAt, cursor.CreatedAt, cursor.ID)
+	}
+
+	return query.Order("created_at DESC, id DESC").Limit(limit + 1), nil
+}
+
+// Next trims the extra row fetched by Apply and returns the token for the following page,
+// or an empty token on the last page
+func Next[T any](rows []T, limit int, key func(T) Cursor) ([]T, string) {
+	if len(rows) <= limit {
+		return rows, ""
+	}
+
+	rows = rows[:limit]
+	return rows, key(rows[limit-1]).Encode()
+}
@@ -0,0 +1,110 @@
+package pagination
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type event struct {
+	ID        string `gorm:"primaryKey"`
+	CreatedAt time.Time
+}
+
+// pageAll reads every page of the events and returns their IDs in order
+func pageAll(t *testing.T, db *gorm.DB, limit int, between func()) []string {
+	t.Helper()
+
+	var ids []string
+	token := ""
+	for page := 0; page < 20; page++ {
+		query, err := Apply(db.Model(&event{}), token, limit)
+		if err != nil {
+			t.Fatalf("Apply: %v", err)
+		}
+		var rows []*event
+		if err := query.Find(&rows).Error; err != nil {
+			t.Fatalf("find page %d: %v", page, err)
+		}
+		rows, token = Next(rows, limit, func(e *event) Cursor { return Cursor{CreatedAt: e.CreatedAt, ID: e.ID} })
+		if len(rows) > limit {
+			t.Fatalf("page %d has %d rows, limit %d", page, len(rows), limit)
+		}
+		for _, row := range rows {
+			ids = append(ids, row.ID)
+		}
+		if token == "" {
+			return ids
+		}
+		if between != nil {
+			between()
+		}
+	}
+	t.Fatal("paging did not end")
+	return nil
+}
+
+func TestPagingNewestFirst(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:"+uuid.NewString()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	if err := db.AutoMigrate(&event{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	// Several rows share a timestamp, so the ID breaks ties
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var want []string
+	for i := 6; i >= 0; i-- {
+		want = append(want, fmt.Sprintf("e%d", i))
+	}
+	for i := 0; i < 7; i++ {
+		if err := db.Create(&event{ID: fmt.Sprintf("e%d", i), CreatedAt: base.Add(time.Duration(i/3) * time.Minute)}).Error; err != nil {
+			t.Fatalf("create event: %v", err)
+		}
+	}
+
+	// Rows added while paging are newer than the cursor and do not appear
+	added := 0
+	got := pageAll(t, db, 2, func() {
+		added++
+		db.Create(&event{ID: fmt.Sprintf("new%d", added), CreatedAt: base.Add(time.Hour)})
+	})
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("paged IDs = %v, want %v", got, want)
+	}
+}
+
+func TestDecodeRejectsBadTokens(t *testing.T) {
+	for _, token := range []string{"%%%", "bm90IGpzb24", Cursor{CreatedAt: time.Now()}.Encode()} {
+		if _, err := Decode(token); err == nil {
+			t.Errorf("Decode(%q) accepted", token)
+		}
+	}
+
+	cursor := Cursor{CreatedAt: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), ID: "e1"}
+	decoded, err := Decode(cursor.Encode())
+	if err != nil || !decoded.CreatedAt.Equal(cursor.CreatedAt) || decoded.ID != cursor.ID {
+		t.Errorf("Decode(Encode(%v)) = %v, %v", cursor, decoded, err)
+	}
+}
+
+func TestClampLimit(t *testing.T) {
+	tests := []struct{ limit, want int }{
+		{0, DefaultLimit},
+		{-5, DefaultLimit},
+		{10, 10},
+		{MaxLimit + 1, MaxLimit},
+	}
+	for _, tt := range tests {
+		if got := ClampLimit(tt.limit); got != tt.want {
+			t.Errorf("ClampLimit(%d) = %d, want %d", tt.limit, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+// Package ratelimit implements a fixed-window rate limiter shared by several panel instances.
+//
+// Each instance decides locally, from the last global count it learned plus the requests it has
+// admitted since, so allowing a request never waits on Redis. A periodic Sync pushes the local
+// counts to Redis and pulls back the global totals. Between syncs instances may together admit a
+// little more than the limit; the overshoot is bounded by the traffic of one sync interval.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// Store keeps the global per-window counters
+type Store interface {
+	// IncrBy adds deltas[i] to the counter keys[i] and returns the new totals in the same order,
+	// in one round trip. The counters expire after ttl.
+	IncrBy(ctx context.Context, keys []string, deltas []int64, ttl time.Duration) ([]int64, error)
+}
+
+// RedisStore keeps counters in Redis
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore creates a Redis-backed counter store
+func NewRedisStore(client *redis.Client) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+// IncrBy implements Store
+func (s *RedisStore) IncrBy(ctx context.Context, keys []string, deltas []int64, ttl time.Duration) ([]int64, error) {
+	pipe := s.client.Pipeline()
+	incrs := make([]*redis.IntCmd, len(keys))
+	for i, key := range keys {
+		incrs[i] = pipe.IncrBy(ctx, key, deltas[i])
+		pipe.Expire(ctx, key, ttl)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	totals := make([]int64, len(keys))
+	for i, incr := range incrs {
+		totals[i] = incr.Val()
+	}
+	return totals, nil
+}
+
+// Options configures a Limiter
+type Options struct {
+	Limit        int64         // Requests allowed per key and window across all instances
+	Window       time.Duration // Length of a window
+	SyncInterval time.Duration // How often local counts are reconciled with the store
+	// FailClosed rejects every request while the store is unreachable. Otherwise the
+	// limiter keeps enforcing the limit on this instance's traffic alone.
+	FailClosed bool
+	// Prefix separates the store keys of limiters sharing a store
+	Prefix string
+	// WarnPercent is the share of the limit, in percent, at or below which the remaining requests
+	// are reported as running low. 0 never warns.
+	WarnPercent int
+}
+
+// Decision is the outcome of Take for one request
+type Decision struct {
+	Allowed   bool
+	Limit     int64         // Requests allowed per window
+	Remaining int64         // Requests left in the window after this one
+	Reset     time.Duration // Time until the window ends
+	Warn      bool          // Remaining is at or below the warning threshold
+}
+
+// bucket tracks one key within the current window
+type bucket struct {
+	window  int64 // Index of the window the counts belong to
+	global  int64 // Total across instances as of the last sync
+	pending int64 // Requests admitted here and not yet pushed to the store
+	local   int64 // Requests admitted here during the window
+}
+
+// Limiter is a two-tier rate limiter: local decisions, periodic global reconciliation
+type Limiter struct {
+	store  Store
+	opts   Options
+	logger *zap.Logger
+	now    func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	available bool // Whether the last sync reached the store
+}
+
+// New creates a limiter. Sync must be called every SyncInterval, such as from a scheduled job, to
+// take other instances into account.
+func New(store Store, opts Options, logger *zap.Logger) *Limiter {
+	if opts.SyncInterval <= 0 {
+		opts.SyncInterval = time.Second
+	}
+
+	return &Limiter{
+		store:     store,
+		opts:      opts,
+		logger:    logger,
+		now:       time.Now,
+		buckets:   make(map[string]*bucket),
+		available: true,
+	}
+}
+
+// Allow reports whether a request for key may proceed, and counts it if so
+func (l *Limiter) Allow(key string) bool {
+	return l.Take(key).Allowed
+}
+
+// Take decides whether a request for key may proceed, counts it if so, and reports how much of
+// the limit is left
+func (l *Limiter) Take(key string) Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.bucket(key)
+	decision := Decision{Limit: l.opts.Limit, Reset: l.RetryAfter()}
+
+	used := b.global + b.pending
+	if !l.available {
+		if l.opts.FailClosed {
+			decision.Warn = l.opts.WarnPercent > 0
+			return decision
+		}
+		used = b.local
+	}
+	if used < l.opts.Limit {
+		decision.Allowed = true
+		b.pending++
+		b.local++
+		used++
+	}
+
+	decision.Remaining = l.opts.Limit - used
+	if decision.Remaining < 0 {
+		decision.Remaining = 0
+	}
+	decision.Warn = l.opts.WarnPercent > 0 && decision.Remaining*100 <= l.opts.Limit*int64(l.opts.WarnPercent)
+	return decision
+}
+
+// RetryAfter returns the time until the current window ends
+func (l *Limiter) RetryAfter() time.Duration {
+	now := l.now()
+	return l.opts.Window - time.Duration(now.UnixNano()%int64(l.opts.Window))
+}
+
+// Sync pushes locally admitted requests to the store and refreshes the global counts, all keys
+// in one round trip
+func (l *Limiter) Sync(ctx context.Context) error {
+	type delta struct {
+		key    string
+		window int64
+		count  int64
+	}
+
+	l.mu.Lock()
+	current := l.windowIndex()
+	deltas := make([]delta, 0, len(l.buckets))
+	for key, b := range l.buckets {
+		if b.window != current {
+			delete(l.buckets, key)
+			continue
+		}
+		deltas = append(deltas, delta{key: key, window: b.window, count: b.pending})
+	}
+	l.mu.Unlock()
+
+	var syncErr error
+	if len(deltas) > 0 {
+		keys := make([]string, len(deltas))
+		counts := make([]int64, len(deltas))
+		for i, d := range deltas {
+			keys[i] = storeKey(l.opts.Prefix+d.key, d.window)
+			counts[i] = d.count
+		}
+
+		var totals []int64
+		totals, syncErr = l.store.IncrBy(ctx, keys, counts, l.opts.Window)
+		if syncErr == nil {
+			l.mu.Lock()
+			for i, d := range deltas {
+				if b, ok := l.buckets[d.key]; ok && b.window == d.window {
+					b.global = totals[i]
+					b.pending -= d.count
+				}
+			}
+			l.mu.Unlock()
+		}
+	}
+
+	l.mu.Lock()
+	wasAvailable := l.available
+	l.available = syncErr == nil
+	l.mu.Unlock()
+
+	if syncErr != nil && wasAvailable {
+		l.logger.Warn("Rate limiter lost its store, enforcing locally",
+			zap.Bool("fail_closed", l.opts.FailClosed),
+			zap.Error(syncErr))
+	} else if syncErr == nil && !wasAvailable {
+		l.logger.Info("Rate limiter store reachable again")
+	}
+
+	if syncErr != nil {
+		return fmt.Errorf("failed to sync rate limits: %w", syncErr)
+	}
+	return nil
+}
+
+// bucket returns the bucket for key in the current window; the caller holds mu
+func (l *Limiter) bucket(key string) *bucket {
+	current := l.windowIndex()
+	b, ok := l.buckets[key]
+	if !ok || b.window != current {
+		b = &bucket{window: current}
+		l.buckets[key] = b
+	}
+	return b
+}
+
+func (l *Limiter) windowIndex() int64 {
+	return l.now().UnixNano() / int64(l.opts.Window)
+}
+
+func storeKey(key string, window int64) string {
+	return fmt.Sprintf("ratelimit:%s:%d", key, window)
+}
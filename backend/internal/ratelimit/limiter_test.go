@@ -0,0 +1,162 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// countingStore wraps a store and counts the round trips made to it
+type countingStore struct {
+	Store
+	calls int
+	err   error
+}
+
+func (s *countingStore) IncrBy(ctx context.Context, keys []string, deltas []int64, ttl time.Duration) ([]int64, error) {
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.Store.IncrBy(ctx, keys, deltas, ttl)
+}
+
+func newTestStore(t *testing.T) *RedisStore {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewRedisStore(client)
+}
+
+func TestSyncSharesCountsAcrossInstances(t *testing.T) {
+	store := newTestStore(t)
+	opts := Options{Limit: 3, Window: time.Hour}
+	first := New(store, opts, zap.NewNop())
+	second := New(store, opts, zap.NewNop())
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if !first.Allow("client") {
+			t.Fatalf("request %d refused", i+1)
+		}
+	}
+	first.Sync(ctx)
+	if !second.Allow("client") {
+		t.Fatal("third request refused")
+	}
+	second.Sync(ctx)
+
+	if second.Allow("client") {
+		t.Error("fourth request across instances allowed")
+	}
+}
+
+func TestSyncIsOneRoundTrip(t *testing.T) {
+	store := &countingStore{Store: newTestStore(t)}
+	limiter := New(store, Options{Limit: 10, Window: time.Hour}, zap.NewNop())
+
+	for _, key := range []string{"a", "b", "c", "d"} {
+		limiter.Allow(key)
+	}
+	limiter.Sync(context.Background())
+
+	if store.calls != 1 {
+		t.Errorf("sync made %d store calls for 4 keys, want 1", store.calls)
+	}
+}
+
+func TestSyncFailure(t *testing.T) {
+	tests := []struct {
+		name       string
+		failClosed bool
+		allowed    bool
+	}{
+		{"fail open enforces locally", false, true},
+		{"fail closed refuses", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &countingStore{Store: newTestStore(t), err: errors.New("connection refused")}
+			limiter := New(store, Options{Limit: 2, Window: time.Hour, FailClosed: tt.failClosed}, zap.NewNop())
+
+			limiter.Allow("client")
+			if err := limiter.Sync(context.Background()); err == nil {
+				t.Fatal("sync without a store succeeded")
+			}
+
+			if got := limiter.Allow("client"); got != tt.allowed {
+				t.Errorf("allowed = %v, want %v", got, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestPrefixSeparatesLimiters(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	opts := Options{Limit: 2, Window: time.Hour}
+	api := New(store, opts, zap.NewNop())
+	opts.Prefix = "status:"
+	status := New(store, opts, zap.NewNop())
+	other := New(store, opts, zap.NewNop())
+
+	api.Allow("client")
+	api.Allow("client")
+	api.Sync(ctx)
+
+	status.Allow("client")
+	status.Sync(ctx)
+	if !status.Allow("client") {
+		t.Fatal("requests to another limiter counted against the status limiter")
+	}
+	status.Sync(ctx)
+
+	// Limiters with the same prefix share counts
+	other.Allow("client")
+	other.Sync(ctx)
+	if other.Allow("client") {
+		t.Error("request over the shared status limit allowed")
+	}
+}
+
+func TestTake(t *testing.T) {
+	limiter := New(newTestStore(t), Options{Limit: 4, Window: time.Hour, WarnPercent: 50}, zap.NewNop())
+
+	tests := []struct {
+		allowed   bool
+		remaining int64
+		warn      bool
+	}{
+		{true, 3, false},
+		{true, 2, true},
+		{true, 1, true},
+		{true, 0, true},
+		{false, 0, true},
+	}
+	for i, tt := range tests {
+		decision := limiter.Take("client")
+		if decision.Allowed != tt.allowed || decision.Remaining != tt.remaining || decision.Warn != tt.warn || decision.Limit != 4 {
+			t.Errorf("request %d: %+v, want allowed %v, %d left, warn %v", i+1, decision, tt.allowed, tt.remaining, tt.warn)
+		}
+		if decision.Reset <= 0 || decision.Reset > time.Hour {
+			t.Errorf("request %d: reset in %s", i+1, decision.Reset)
+		}
+	}
+
+	if decision := limiter.Take("other"); !decision.Allowed || decision.Remaining != 3 {
+		t.Errorf("other client: %+v", decision)
+	}
+
+	quiet := New(newTestStore(t), Options{Limit: 1, Window: time.Hour}, zap.NewNop())
+	if decision := quiet.Take("client"); decision.Warn {
+		t.Error("warned without a warning threshold")
+	}
+}
@@ -0,0 +1,60 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// DryRun wraps a Runner and logs commands instead of running them when dry-run mode is enabled,
+// globally or for the request on the context. Skipped commands succeed with no output.
+type DryRun struct {
+	runner  Runner
+	enabled bool
+	logger  *zap.Logger
+}
+
+// NewDryRun creates a runner that skips commands in dry-run mode. enabled turns dry-run mode on
+// for every command; otherwise only commands of dry-run requests are skipped.
+func NewDryRun(runner Runner, enabled bool, logger *zap.Logger) *DryRun {
+	return &DryRun{
+		runner:  runner,
+		enabled: enabled,
+		logger:  logger,
+	}
+}
+
+// Run implements Runner
+func (d *DryRun) Run(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+	if d.skip(ctx, name, args) {
+		return nil, nil, nil
+	}
+	return d.runner.Run(ctx, name, args...)
+}
+
+// Stream implements Runner. The stdin of a skipped command is drained, so a writer feeding it
+// through a pipe does not block.
+func (d *DryRun) Stream(ctx context.Context, r io.Reader, w io.Writer, name string, args ...string) ([]byte, error) {
+	if d.skip(ctx, name, args) {
+		if r != nil {
+			if _, err := io.Copy(io.Discard, r); err != nil {
+				return nil, fmt.Errorf("failed to read stdin: %w", err)
+			}
+		}
+		return nil, nil
+	}
+	return d.runner.Stream(ctx, r, w, name, args...)
+}
+
+func (d *DryRun) skip(ctx context.Context, name string, args []string) bool {
+	dryRun, _ := ctx.Value("dry_run").(bool)
+	if !d.enabled && !dryRun {
+		return false
+	}
+
+	d.logger.Info("Dry run: skipping command", zap.String("command", strings.Join(append([]string{name}, args...), " ")))
+	return true
+}
@@ -0,0 +1,69 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestDryRun(t *testing.T) {
+	dryRequest := context.WithValue(context.Background(), "dry_run", true)
+
+	tests := []struct {
+		name    string
+		enabled bool
+		ctx     context.Context
+		skipped bool
+	}{
+		{"disabled", false, context.Background(), false},
+		{"enabled", true, context.Background(), true},
+		{"dry-run request", false, dryRequest, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := NewFake()
+			fake.Respond("mysql", Result{Stdout: []byte("done")})
+			d := NewDryRun(fake, tt.enabled, zap.NewNop())
+
+			stdout, _, err := d.Run(tt.ctx, "mysql", "-e", "DROP DATABASE shop")
+			if err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+			if skipped := len(fake.Calls()) == 0; skipped != tt.skipped {
+				t.Errorf("skipped = %v, want %v", skipped, tt.skipped)
+			}
+			if tt.skipped && stdout != nil {
+				t.Errorf("skipped command printed %q", stdout)
+			}
+			if !tt.skipped && string(stdout) != "done" {
+				t.Errorf("stdout = %q, want the command's", stdout)
+			}
+		})
+	}
+}
+
+func TestDryRunStreamDrainsStdin(t *testing.T) {
+	fake := NewFake()
+	d := NewDryRun(fake, true, zap.NewNop())
+
+	// A writer feeding the command through a pipe must not block
+	r, w := io.Pipe()
+	go func() {
+		w.Write(bytes.Repeat([]byte("x"), 1<<16))
+		w.Close()
+	}()
+
+	var out bytes.Buffer
+	if _, err := d.Stream(context.Background(), r, &out, "mysql", "shop"); err != nil {
+		t.Fatalf("Stream() error = %v", err)
+	}
+	if len(fake.Calls()) != 0 || out.Len() != 0 {
+		t.Errorf("dry-run stream ran %v and wrote %q", fake.Calls(), out.String())
+	}
+	if _, err := d.Stream(context.Background(), nil, nil, "mysqldump", "shop"); err != nil {
+		t.Errorf("Stream() without stdin error = %v", err)
+	}
+}
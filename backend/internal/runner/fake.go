@@ -0,0 +1,94 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Call is a command run through a Fake
+type Call struct {
+	Name  string
+	Args  []string
+	Stdin []byte
+}
+
+// String returns the command line of the call
+func (c Call) String() string {
+	return strings.Join(append([]string{c.Name}, c.Args...), " ")
+}
+
+// Result is the canned outcome of a command run through a Fake
+type Result struct {
+	Stdout []byte
+	Stderr []byte
+	Err    error
+}
+
+// Fake records the commands it is asked to run instead of running them. Commands without a
+// canned result succeed with no output.
+type Fake struct {
+	mu      sync.Mutex
+	calls   []Call
+	results map[string]Result
+}
+
+// NewFake creates a fake runner
+func NewFake() *Fake {
+	return &Fake{results: make(map[string]Result)}
+}
+
+// Respond sets the result for a command. key is either a full command line, which takes
+// precedence, or just the command name.
+func (f *Fake) Respond(key string, result Result) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.results[key] = result
+}
+
+// Calls returns the commands run so far
+func (f *Fake) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+// Run implements Runner
+func (f *Fake) Run(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+	result := f.record(Call{Name: name, Args: args})
+	return result.Stdout, result.Stderr, result.Err
+}
+
+// Stream implements Runner
+func (f *Fake) Stream(ctx context.Context, r io.Reader, w io.Writer, name string, args ...string) ([]byte, error) {
+	call := Call{Name: name, Args: args}
+	if r != nil {
+		stdin, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read stdin: %w", err)
+		}
+		call.Stdin = stdin
+	}
+
+	result := f.record(call)
+	if w != nil && len(result.Stdout) > 0 {
+		if _, err := w.Write(result.Stdout); err != nil {
+			return result.Stderr, fmt.Errorf("failed to write stdout: %w", err)
+		}
+	}
+
+	return result.Stderr, result.Err
+}
+
+func (f *Fake) record(call Call) Result {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, call)
+	if result, ok := f.results[call.String()]; ok {
+		return result
+	}
+	return f.results[call.Name]
+}
@@ -0,0 +1,136 @@
+// Package runner runs the system commands the panel uses to manage the host.
+//
+// Services never call os/exec directly; they go through a Runner so that commands are
+// restricted to an allowlist, bounded by a per-command timeout and easy to fake in tests.
+// Commands are executed directly, never through a shell, so arguments built from user input
+// are passed to the program verbatim and cannot be interpreted as shell syntax.
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/tracing"
+)
+
+// DefaultTimeout bounds commands that are allowed without an explicit timeout
+const DefaultTimeout = 30 * time.Second
+
+// ErrNotAllowed is returned for commands that are not on the allowlist
+var ErrNotAllowed = errors.New("command not allowed")
+
+// Runner runs system commands
+type Runner interface {
+	// Run runs a command and returns its captured stdout and stderr
+	Run(ctx context.Context, name string, args ...string) (stdout, stderr []byte, err error)
+	// Stream runs a command with stdin and stdout connected to r and w, which may be nil,
+	// and returns its captured stderr
+	Stream(ctx context.Context, r io.Reader, w io.Writer, name string, args ...string) (stderr []byte, err error)
+}
+
+// DefaultCommands returns the commands the panel runs and how long each may take
+func DefaultCommands() map[string]time.Duration {
+	return map[string]time.Duration{
+		"mysqldump": time.Hour,
+		"mysql":     time.Hour,
+		"pg_dump":   time.Hour,
+		"psql":      time.Hour,
+		"postfix":   DefaultTimeout,
+		"nginx":     DefaultTimeout,  // Configuration checks and reloads after vhost writes
+		"systemctl": 2 * time.Minute, // Restarts wait for the service to start
+	}
+}
+
+// Exec runs allowlisted commands with os/exec
+type Exec struct {
+	commands map[string]time.Duration
+	logger   *zap.Logger
+}
+
+// NewExec creates a runner that only runs the given commands, each bounded by its timeout.
+// A zero timeout uses DefaultTimeout.
+func NewExec(commands map[string]time.Duration, logger *zap.Logger) *Exec {
+	allowed := make(map[string]time.Duration, len(commands))
+	for name, timeout := range commands {
+		if timeout <= 0 {
+			timeout = DefaultTimeout
+		}
+		allowed[name] = timeout
+	}
+
+	return &Exec{
+		commands: allowed,
+		logger:   logger,
+	}
+}
+
+// Run implements Runner
+func (e *Exec) Run(ctx context.Context, name string, args ...string) ([]byte, []byte, error) {
+	var stdout bytes.Buffer
+	stderr, err := e.Stream(ctx, nil, &stdout, name, args...)
+	return stdout.Bytes(), stderr, err
+}
+
+// Stream implements Runner. Arguments are left out of the command's span, since some carry
+// secrets.
+func (e *Exec) Stream(ctx context.Context, r io.Reader, w io.Writer, name string, args ...string) (_ []byte, err error) {
+	timeout, err := e.check(name, args)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, span := tracing.Start(ctx, "exec "+name, semconv.ProcessCommand(name))
+	defer tracing.End(span, &err)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = r
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+
+	start := time.Now()
+	err = cmd.Run()
+	e.logger.Debug("Command finished",
+		zap.String("command", name),
+		zap.Strings("args", args),
+		zap.Duration("duration", time.Since(start)),
+		zap.Error(err),
+	)
+
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return stderr.Bytes(), fmt.Errorf("%s timed out after %s", name, timeout)
+		}
+		return stderr.Bytes(), fmt.Errorf("%s failed: %w", name, err)
+	}
+
+	return stderr.Bytes(), nil
+}
+
+// check returns the timeout of an allowed command and rejects arguments no program could receive
+func (e *Exec) check(name string, args []string) (time.Duration, error) {
+	timeout, ok := e.commands[name]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrNotAllowed, name)
+	}
+
+	for _, arg := range args {
+		if strings.ContainsRune(arg, 0) {
+			return 0, fmt.Errorf("invalid argument to %s: contains NUL byte", name)
+		}
+	}
+
+	return timeout, nil
+}
@@ -0,0 +1,91 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestExecAllowlist(t *testing.T) {
+	e := NewExec(map[string]time.Duration{"echo": 0}, zap.NewNop())
+	ctx := context.Background()
+
+	if _, _, err := e.Run(ctx, "rm", "-rf", "/"); !errors.Is(err, ErrNotAllowed) {
+		t.Errorf("unlisted command: error = %v, want ErrNotAllowed", err)
+	}
+	if _, _, err := e.Run(ctx, "echo", "a\x00b"); err == nil {
+		t.Error("argument with a NUL byte accepted")
+	}
+
+	// Arguments reach the program verbatim, never through a shell
+	stdout, _, err := e.Run(ctx, "echo", "$(id)", "; ls")
+	if err != nil {
+		t.Fatalf("echo: %v", err)
+	}
+	if got := strings.TrimSpace(string(stdout)); got != "$(id) ; ls" {
+		t.Errorf("echo printed %q", got)
+	}
+}
+
+func TestExecFailures(t *testing.T) {
+	e := NewExec(map[string]time.Duration{"sh": 0, "sleep": 50 * time.Millisecond}, zap.NewNop())
+	ctx := context.Background()
+
+	_, stderr, err := e.Run(ctx, "sh", "-c", "echo broken >&2; exit 3")
+	if err == nil || strings.TrimSpace(string(stderr)) != "broken" {
+		t.Errorf("failing command = %q, %v; want its stderr and an error", stderr, err)
+	}
+
+	start := time.Now()
+	if _, _, err := e.Run(ctx, "sleep", "5"); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("slow command: error = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("timeout took %v", elapsed)
+	}
+}
+
+func TestExecStream(t *testing.T) {
+	e := NewExec(map[string]time.Duration{"cat": 0}, zap.NewNop())
+
+	var out bytes.Buffer
+	if _, err := e.Stream(context.Background(), strings.NewReader("dump data"), &out, "cat"); err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	if out.String() != "dump data" {
+		t.Errorf("streamed %q", out.String())
+	}
+}
+
+func TestFake(t *testing.T) {
+	f := NewFake()
+	f.Respond("nginx", Result{Err: errors.New("exit status 1")})
+	f.Respond("nginx -t", Result{Stdout: []byte("syntax is ok")})
+	f.Respond("mysqldump", Result{Stdout: []byte("CREATE TABLE")})
+	ctx := context.Background()
+
+	if stdout, _, err := f.Run(ctx, "nginx", "-t"); err != nil || string(stdout) != "syntax is ok" {
+		t.Errorf("full command line = %q, %v; want its own result", stdout, err)
+	}
+	if _, _, err := f.Run(ctx, "nginx", "-s", "reload"); err == nil {
+		t.Error("command name result not used")
+	}
+	if _, _, err := f.Run(ctx, "postfix", "check"); err != nil {
+		t.Errorf("command without a result: %v", err)
+	}
+
+	var out bytes.Buffer
+	if _, err := f.Stream(ctx, strings.NewReader("secret"), &out, "mysqldump", "shop"); err != nil || out.String() != "CREATE TABLE" {
+		t.Errorf("Stream = %q, %v", out.String(), err)
+	}
+
+	calls := f.Calls()
+	if len(calls) != 4 || calls[3].String() != "mysqldump shop" || string(calls[3].Stdin) != "secret" {
+		t.Errorf("calls = %v", calls)
+	}
+}
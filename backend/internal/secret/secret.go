@@ -0,0 +1,194 @@
+// Package secret encrypts sensitive columns at rest. Values are sealed with AES-256-GCM under a
+// versioned key and stored as "enc:<version>:<base64 nonce and ciphertext>", so keys can be
+// rotated: new values use the current key while older versions stay readable until re-encrypted.
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// prefix marks an encrypted value; anything else is a plaintext value from before encryption
+const prefix = "enc:"
+
+// KeySize is the length of an encryption key in bytes
+const KeySize = 32
+
+// versionPattern restricts key versions to labels that cannot contain the separator
+var versionPattern = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// Keyring holds the encryption keys by version
+type Keyring struct {
+	current string
+	aeads   map[string]cipher.AEAD
+}
+
+// NewKeyring builds a keyring from base64 encoded 32-byte keys by version. New values are
+// encrypted with the current version's key.
+func NewKeyring(keys map[string]string, current string) (*Keyring, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("no encryption key for the current version %q", current)
+	}
+
+	k := &Keyring{current: current, aeads: make(map[string]cipher.AEAD, len(keys))}
+	for version, encoded := range keys {
+		if !versionPattern.MatchString(version) {
+			return nil, fmt.Errorf("invalid encryption key version %q", version)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != KeySize {
+			return nil, fmt.Errorf("encryption key %q must be %d bytes, base64 encoded", version, KeySize)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key %q: %w", version, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key %q: %w", version, err)
+		}
+		k.aeads[version] = aead
+	}
+
+	return k, nil
+}
+
+// CurrentPrefix is the prefix of values encrypted with the current key
+func (k *Keyring) CurrentPrefix() string {
+	return prefix + k.current + ":"
+}
+
+// Encrypt seals a value with the current key
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	return k.EncryptFor(plaintext, "")
+}
+
+// EncryptFor seals a value with the current key, bound to a context such as the owner and row
+// it belongs to: it only opens with DecryptFor and the same context, so a sealed value copied
+// to another row cannot be read there.
+func (k *Keyring) EncryptFor(plaintext, context string) (string, error) {
+	aead := k.aeads[k.current]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), additionalData(k.current, context))
+	return k.CurrentPrefix() + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value sealed with any key of the keyring. Values without the encryption
+// prefix are returned as they are.
+func (k *Keyring) Decrypt(value string) (string, error) {
+	if !strings.HasPrefix(value, prefix) {
+		return value, nil
+	}
+	return k.DecryptFor(value, "")
+}
+
+// DecryptFor opens a value sealed by EncryptFor with the same context, under any key of the
+// keyring. Unlike Decrypt, it rejects values that are not encrypted.
+func (k *Keyring) DecryptFor(value, context string) (string, error) {
+	if !strings.HasPrefix(value, prefix) {
+		return "", errors.New("value is not encrypted")
+	}
+
+	version, encoded, ok := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	if !ok {
+		return "", errors.New("malformed encrypted value")
+	}
+	aead, ok := k.aeads[version]
+	if !ok {
+		return "", fmt.Errorf("no encryption key for version %q", version)
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", errors.New("malformed encrypted value")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additionalData(version, context))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value with key %q: %w", version, err)
+	}
+
+	return string(plaintext), nil
+}
+
+// additionalData authenticates the key version, and the context of values bound to one, along
+// with a sealed value. Values without a context keep the plain version, as before contexts.
+func additionalData(version, context string) []byte {
+	if context == "" {
+		return []byte(version)
+	}
+	return []byte(version + "\x00" + context)
+}
+
+var (
+	mu      sync.RWMutex
+	keyring *Keyring
+)
+
+// Use sets the keyring String values are encrypted with. Without one, values are stored as
+// plaintext and encrypted values cannot be read.
+func Use(k *Keyring) {
+	mu.Lock()
+	defer mu.Unlock()
+	keyring = k
+}
+
+// Current returns the keyring in use, or nil
+func Current() *Keyring {
+	mu.RLock()
+	defer mu.RUnlock()
+	return keyring
+}
+
+// String is a string column encrypted at rest. It is encrypted when written and decrypted when
+// read; the empty string is stored as is, so queries for unset values keep working.
+type String string
+
+// Value implements driver.Valuer
+func (s String) Value() (driver.Value, error) {
+	k := Current()
+	if s == "" || k == nil {
+		return string(s), nil
+	}
+	return k.Encrypt(string(s))
+}
+
+// Scan implements sql.Scanner
+func (s *String) Scan(src interface{}) error {
+	var value string
+	switch v := src.(type) {
+	case nil:
+	case string:
+		value = v
+	case []byte:
+		value = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into secret.String", src)
+	}
+
+	if !strings.HasPrefix(value, prefix) {
+		*s = String(value)
+		return nil
+	}
+	k := Current()
+	if k == nil {
+		return errors.New("encrypted value read without an encryption key")
+	}
+	plaintext, err := k.Decrypt(value)
+	if err != nil {
+		return err
+	}
+	*s = String(plaintext)
+	return nil
+}
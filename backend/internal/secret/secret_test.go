@@ -0,0 +1,151 @@
+package secret
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func testKey(fill byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(fill), KeySize)))
+}
+
+func TestNewKeyring(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    map[string]string
+		current string
+		wantErr string
+	}{
+		{"valid", map[string]string{"v1": testKey('a'), "v2": testKey('b')}, "v2", ""},
+		{"missing current", map[string]string{"v1": testKey('a')}, "v2", "current version"},
+		{"bad version", map[string]string{"V:1": testKey('a')}, "V:1", "invalid encryption key version"},
+		{"not base64", map[string]string{"v1": "not base64!"}, "v1", "base64 encoded"},
+		{"short key", map[string]string{"v1": base64.StdEncoding.EncodeToString([]byte("short"))}, "v1", "32 bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewKeyring(tt.keys, tt.current)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("NewKeyring() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("NewKeyring() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEncryptRoundTripAndRotation(t *testing.T) {
+	old, _ := NewKeyring(map[string]string{"v1": testKey('a')}, "v1")
+	rotated, _ := NewKeyring(map[string]string{"v1": testKey('a'), "v2": testKey('b')}, "v2")
+
+	sealed, err := old.Encrypt("JBSWY3DPEHPK3PXP")
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	if !strings.HasPrefix(sealed, "enc:v1:") || strings.Contains(sealed, "JBSWY3DPEHPK3PXP") {
+		t.Errorf("sealed value = %q", sealed)
+	}
+	if again, _ := old.Encrypt("JBSWY3DPEHPK3PXP"); again == sealed {
+		t.Error("two encryptions of a value are identical")
+	}
+
+	// After rotation old values stay readable and new ones use the new key
+	if plaintext, err := rotated.Decrypt(sealed); err != nil || plaintext != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("Decrypt() of a v1 value = %q, %v", plaintext, err)
+	}
+	resealed, _ := rotated.Encrypt("JBSWY3DPEHPK3PXP")
+	if !strings.HasPrefix(resealed, rotated.CurrentPrefix()) || rotated.CurrentPrefix() != "enc:v2:" {
+		t.Errorf("value after rotation = %q", resealed)
+	}
+	if _, err := old.Decrypt(resealed); err == nil {
+		t.Error("value of an unknown key version decrypted")
+	}
+
+	// Values from before encryption pass through Decrypt
+	if plaintext, err := old.Decrypt("plain"); err != nil || plaintext != "plain" {
+		t.Errorf("Decrypt() of plaintext = %q, %v", plaintext, err)
+	}
+}
+
+func TestDecryptRejectsTampering(t *testing.T) {
+	keyring, _ := NewKeyring(map[string]string{"v1": testKey('a'), "v2": testKey('b')}, "v1")
+	sealed, _ := keyring.Encrypt("secret")
+
+	raw, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(sealed, "enc:v1:"))
+	raw[len(raw)-1] ^= 1
+	tests := map[string]string{
+		"flipped bit":     "enc:v1:" + base64.StdEncoding.EncodeToString(raw),
+		"swapped version": strings.Replace(sealed, "enc:v1:", "enc:v2:", 1),
+		"no version":      "enc:abc",
+		"bad encoding":    "enc:v1:***",
+		"too short":       "enc:v1:" + base64.StdEncoding.EncodeToString([]byte("x")),
+	}
+	for name, value := range tests {
+		if plaintext, err := keyring.Decrypt(value); err == nil {
+			t.Errorf("%s: Decrypt() = %q, want an error", name, plaintext)
+		}
+	}
+}
+
+func TestEncryptForBindsContext(t *testing.T) {
+	keyring, _ := NewKeyring(map[string]string{"v1": testKey('a')}, "v1")
+
+	sealed, err := keyring.EncryptFor("hunter2", "user-1/item-1")
+	if err != nil {
+		t.Fatalf("EncryptFor() error = %v", err)
+	}
+	if plaintext, err := keyring.DecryptFor(sealed, "user-1/item-1"); err != nil || plaintext != "hunter2" {
+		t.Errorf("DecryptFor() = %q, %v", plaintext, err)
+	}
+	if _, err := keyring.DecryptFor(sealed, "user-2/item-1"); err == nil {
+		t.Error("value opened in another context")
+	}
+	if _, err := keyring.Decrypt(sealed); err == nil {
+		t.Error("bound value opened without its context")
+	}
+	if _, err := keyring.DecryptFor("hunter2", "user-1/item-1"); err == nil {
+		t.Error("DecryptFor() accepted a plaintext value")
+	}
+}
+
+func TestString(t *testing.T) {
+	t.Cleanup(func() { Use(nil) })
+
+	Use(nil)
+	if value, _ := String("secret").Value(); value != "secret" {
+		t.Errorf("Value() without a key = %v, want plaintext", value)
+	}
+	var s String
+	if err := s.Scan("enc:v1:abcd"); err == nil {
+		t.Error("encrypted value scanned without a key")
+	}
+
+	keyring, _ := NewKeyring(map[string]string{"v1": testKey('a')}, "v1")
+	Use(keyring)
+	value, err := String("secret").Value()
+	if err != nil || !strings.HasPrefix(value.(string), "enc:v1:") {
+		t.Fatalf("Value() = %v, %v, want ciphertext", value, err)
+	}
+	if empty, _ := String("").Value(); empty != "" {
+		t.Errorf("Value() of the empty string = %v", empty)
+	}
+
+	for _, src := range []interface{}{value, []byte(value.(string))} {
+		var scanned String
+		if err := scanned.Scan(src); err != nil || scanned != "secret" {
+			t.Errorf("Scan(%T) = %q, %v", src, scanned, err)
+		}
+	}
+	var plain, null String
+	if err := plain.Scan("legacy"); err != nil || plain != "legacy" {
+		t.Errorf("Scan() of plaintext = %q, %v", plain, err)
+	}
+	if err := null.Scan(nil); err != nil || null != "" {
+		t.Errorf("Scan(nil) = %q, %v", null, err)
+	}
+	if err := null.Scan(42); err == nil {
+		t.Error("Scan() accepted an int")
+	}
+}
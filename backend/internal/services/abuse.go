@@ -0,0 +1,417 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/i18n"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/pagination"
+)
+
+// Abuse report statuses
+const (
+	AbuseStatusOpen          = "open"
+	AbuseStatusInvestigating = "investigating"
+	AbuseStatusResolved      = "resolved"
+)
+
+// Suspensions an abuse report can lead to
+const (
+	AbuseSuspendDomain  = "domain"  // Suspends the reported domain
+	AbuseSuspendAccount = "account" // Deactivates the domain owner's account with all its domains
+)
+
+const (
+	maxAbuseReporterNameLength = 128
+	maxAbuseTargetLength       = 255
+	maxAbuseDescriptionLength  = 10000
+	maxAbuseNoteLength         = 10000
+)
+
+// abuseTransitions lists the statuses each status can move to; resolved reports can be reopened
+var abuseTransitions = map[string][]string{
+	AbuseStatusOpen:          {AbuseStatusInvestigating, AbuseStatusResolved},
+	AbuseStatusInvestigating: {AbuseStatusResolved},
+	AbuseStatusResolved:      {AbuseStatusInvestigating},
+}
+
+// AbuseService takes in abuse reports about hosted domains and tracks their triage by admins,
+// including the suspensions they lead to
+type AbuseService struct {
+	db            *gorm.DB
+	logger        *zap.Logger
+	config        config.AbuseConfig
+	domains       *DomainService
+	users         *UserService
+	notifications *NotificationService
+}
+
+// NewAbuseService creates a new abuse report service
+func NewAbuseService(db *gorm.DB, logger *zap.Logger, config config.AbuseConfig, domains *DomainService, users *UserService, notifications *NotificationService) *AbuseService {
+	return &AbuseService{
+		db:            db,
+		logger:        logger,
+		config:        config,
+		domains:       domains,
+		users:         users,
+		notifications: notifications,
+	}
+}
+
+// AbuseReportRequest is an abuse report as filed
+type AbuseReportRequest struct {
+	ReporterName  string `json:"reporter_name"`
+	ReporterEmail string `json:"reporter_email"`
+	Target        string `json:"target"`
+	Category      string `json:"category"`
+	Description   string `json:"description"`
+}
+
+// SubmitReport files an abuse report. reporter is the logged-in user filing it, or nil for the
+// public form, which needs a contact address. The target, a domain or URL, is linked to the
+// hosted domain it belongs to, if any, and its owner.
+func (s *AbuseService) SubmitReport(ctx context.Context, req AbuseReportRequest, reporter *uuid.UUID, ip string) (*models.AbuseReport, error) {
+	report := &models.AbuseReport{
+		ReporterName:   strings.TrimSpace(req.ReporterName),
+		ReporterEmail:  strings.TrimSpace(req.ReporterEmail),
+		ReporterUserID: reporter,
+		ReporterIP:     ip,
+		Target:         strings.TrimSpace(req.Target),
+		Category:       req.Category,
+		Description:    strings.TrimSpace(req.Description),
+		Status:         AbuseStatusOpen,
+	}
+
+	v := apperrors.NewValidation()
+	if utf8.RuneCountInString(report.ReporterName) > maxAbuseReporterNameLength {
+		v.AddCode("reporter_name", "field.max_length", map[string]string{"max": strconv.Itoa(maxAbuseReporterNameLength)})
+	}
+	if report.ReporterEmail == "" && reporter == nil {
+		v.AddCode("reporter_email", "abuse.contact_required", nil)
+	} else if report.ReporterEmail != "" {
+		if address, err := mail.ParseAddress(report.ReporterEmail); err != nil || address.Address != report.ReporterEmail {
+			v.AddCode("reporter_email", "user.email_invalid", nil)
+		}
+	}
+	host := abuseTargetHost(report.Target)
+	if host == "" || len(report.Target) > maxAbuseTargetLength {
+		v.AddCode("target", "abuse.target_invalid", nil)
+	}
+	if !s.knownCategory(report.Category) {
+		v.AddCode("category", "field.enum", map[string]string{"values": strings.Join(s.config.Categories, ", ")})
+	}
+	if report.Description == "" {
+		v.AddCode("description", "field.empty", nil)
+	} else if utf8.RuneCountInString(report.Description) > maxAbuseDescriptionLength {
+		v.AddCode("description", "field.max_length", map[string]string{"max": strconv.Itoa(maxAbuseDescriptionLength)})
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	domain, err := s.hostedDomain(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if domain != nil {
+		report.DomainID = &domain.ID
+		report.TargetUserID = &domain.UserID
+	}
+
+	if err := s.db.WithContext(ctx).Create(report).Error; err != nil {
+		return nil, fmt.Errorf("failed to file abuse report: %w", err)
+	}
+
+	s.audit(ctx, "abuse_report.create", report, fmt.Sprintf("category=%s target=%q", report.Category, report.Target))
+	s.logger.Info("Abuse report filed",
+		zap.String("report_id", report.ID.String()),
+		zap.String("category", report.Category),
+		zap.String("target", report.Target),
+		zap.Bool("hosted", domain != nil))
+
+	if s.config.NotifyAdmins {
+		s.notifyAdmins(ctx, report)
+	}
+
+	return report, nil
+}
+
+// Reports lists abuse reports newest first, optionally only those with a status
+func (s *AbuseService) Reports(ctx context.Context, status, cursor string, limit int) ([]*models.AbuseReport, string, error) {
+	query := s.db.WithContext(ctx).Model(&models.AbuseReport{})
+	if status != "" {
+		if _, ok := abuseTransitions[status]; !ok {
+			return nil, "", apperrors.InvalidCode("status", "field.enum", map[string]string{"values": "open, investigating, resolved"})
+		}
+		query = query.Where("status = ?", status)
+	}
+
+	limit = pagination.ClampLimit(limit)
+	page, err := pagination.Apply(query, cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var reports []*models.AbuseReport
+	if err := page.Find(&reports).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to get abuse reports: %w", err)
+	}
+	reports, next := pagination.Next(reports, limit, func(report *models.AbuseReport) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: report.CreatedAt, ID: report.ID.String()}
+	})
+
+	return reports, next, nil
+}
+
+// GetReport returns an abuse report with its notes, oldest first
+func (s *AbuseService) GetReport(ctx context.Context, reportID uuid.UUID) (*models.AbuseReport, error) {
+	var report models.AbuseReport
+	if err := s.db.WithContext(ctx).
+		Preload("Notes", func(db *gorm.DB) *gorm.DB { return db.Order("created_at") }).
+		Where("id = ?", reportID).
+		First(&report).Error; err != nil {
+		return nil, apperrors.FromDB(err, "abuse report")
+	}
+	return &report, nil
+}
+
+// UpdateReport moves an abuse report to another status with a note explaining why, or adds a
+// note alone when status is empty or the current one
+func (s *AbuseService) UpdateReport(ctx context.Context, reportID uuid.UUID, status, note string) (*models.AbuseReport, error) {
+	note = strings.TrimSpace(note)
+	if utf8.RuneCountInString(note) > maxAbuseNoteLength {
+		return nil, apperrors.InvalidCode("note", "field.max_length", map[string]string{"max": strconv.Itoa(maxAbuseNoteLength)})
+	}
+
+	report, err := s.GetReport(ctx, reportID)
+	if err != nil {
+		return nil, err
+	}
+	if status == "" {
+		status = report.Status
+	}
+	if status == report.Status && note == "" {
+		return nil, apperrors.InvalidCode("note", "field.empty", nil)
+	}
+	if status != report.Status && !abuseTransitionAllowed(report.Status, status) {
+		return nil, apperrors.PreconditionCode("abuse_transition", map[string]string{"from": report.Status, "to": status})
+	}
+
+	entry, err := s.record(ctx, report, status, "", note)
+	if err != nil {
+		return nil, err
+	}
+	report.Notes = append(report.Notes, *entry)
+
+	return report, nil
+}
+
+// SuspendTarget suspends what an abuse report is about: the reported domain, or the account
+// owning it with all of its domains. An open report moves to investigating, and the suspension
+// is noted on the report.
+func (s *AbuseService) SuspendTarget(ctx context.Context, reportID uuid.UUID, scope, note string) (*models.AbuseReport, error) {
+	note = strings.TrimSpace(note)
+	if utf8.RuneCountInString(note) > maxAbuseNoteLength {
+		return nil, apperrors.InvalidCode("note", "field.max_length", map[string]string{"max": strconv.Itoa(maxAbuseNoteLength)})
+	}
+
+	report, err := s.GetReport(ctx, reportID)
+	if err != nil {
+		return nil, err
+	}
+	if report.DomainID == nil || report.TargetUserID == nil {
+		return nil, apperrors.PreconditionCode("abuse_no_target", map[string]string{"target": report.Target})
+	}
+
+	var action string
+	switch scope {
+	case AbuseSuspendDomain:
+		action = "domain_suspend"
+		reason := fmt.Sprintf("Abuse report %s (%s)", report.ID, report.Category)
+		if _, err := s.domains.Suspend(ctx, *report.DomainID, reason); err != nil {
+			return nil, err
+		}
+	case AbuseSuspendAccount:
+		action = "user_deactivate"
+		if err := s.users.Deactivate(ctx, *report.TargetUserID); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, apperrors.InvalidCode("scope", "field.enum", map[string]string{"values": "domain, account"})
+	}
+
+	status := report.Status
+	if status == AbuseStatusOpen {
+		status = AbuseStatusInvestigating
+	}
+	entry, err := s.record(ctx, report, status, action, note)
+	if err != nil {
+		return nil, err
+	}
+	report.Notes = append(report.Notes, *entry)
+
+	return report, nil
+}
+
+// record stores a note on a report along with its new status, and audits it
+func (s *AbuseService) record(ctx context.Context, report *models.AbuseReport, status, action, note string) (*models.AbuseReportNote, error) {
+	entry := &models.AbuseReportNote{
+		ReportID:   report.ID,
+		UserID:     actorFromContext(ctx),
+		FromStatus: report.Status,
+		ToStatus:   status,
+		Action:     action,
+		Note:       note,
+	}
+
+	updates := map[string]interface{}{"status": status}
+	switch {
+	case status == AbuseStatusResolved && report.Status != AbuseStatusResolved:
+		now := time.Now()
+		updates["resolved_at"] = now
+	case status != AbuseStatusResolved:
+		updates["resolved_at"] = nil
+	}
+
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(entry).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.AbuseReport{}).Where("id = ?", report.ID).Updates(updates).Error
+	}); err != nil {
+		return nil, fmt.Errorf("failed to update abuse report: %w", err)
+	}
+	report.Status = status
+
+	details := fmt.Sprintf("status=%s->%s", entry.FromStatus, entry.ToStatus)
+	if action != "" {
+		details += " action=" + action
+	}
+	s.audit(ctx, "abuse_report.update", report, details)
+
+	return entry, nil
+}
+
+// hostedDomain finds the hosted domain a host name belongs to: the domain itself or the closest
+// domain above it, so reports about subdomains and www names reach their domain
+func (s *AbuseService) hostedDomain(ctx context.Context, host string) (*models.Domain, error) {
+	var candidates []string
+	for name := host; strings.Contains(name, "."); name = name[strings.Index(name, ".")+1:] {
+		candidates = append(candidates, name)
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	var domains []*models.Domain
+	if err := s.db.WithContext(ctx).Where("name IN ?", candidates).Find(&domains).Error; err != nil {
+		return nil, fmt.Errorf("failed to look up reported domain: %w", err)
+	}
+
+	var found *models.Domain
+	for _, domain := range domains {
+		if found == nil || len(domain.Name) > len(found.Name) {
+			found = domain
+		}
+	}
+	return found, nil
+}
+
+// abuseTargetHost returns the lowercased host name of a reported domain or URL, or "" when it
+// names none
+func abuseTargetHost(target string) string {
+	host := target
+	if strings.Contains(host, "://") {
+		parsed, err := url.Parse(host)
+		if err != nil {
+			return ""
+		}
+		host = parsed.Hostname()
+	} else {
+		if i := strings.IndexAny(host, "/?#"); i >= 0 {
+			host = host[:i]
+		}
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+	}
+
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if len(host) > 253 || !domainNamePattern.MatchString(host) {
+		return ""
+	}
+	return host
+}
+
+func abuseTransitionAllowed(from, to string) bool {
+	for _, allowed := range abuseTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *AbuseService) knownCategory(category string) bool {
+	for _, known := range s.config.Categories {
+		if category == known {
+			return true
+		}
+	}
+	return false
+}
+
+// notifyAdmins tells every admin of a new report
+func (s *AbuseService) notifyAdmins(ctx context.Context, report *models.AbuseReport) {
+	if s.notifications == nil {
+		return
+	}
+
+	admins, err := activeAdminIDs(s.db.WithContext(ctx))
+	if err != nil {
+		s.logger.Error("Failed to get admins to notify of abuse report", zap.Error(err))
+		return
+	}
+
+	params := map[string]string{
+		"category": report.Category,
+		"target":   report.Target,
+		"id":       report.ID.String(),
+	}
+	for _, admin := range admins {
+		if err := s.notifications.Notify(ctx, admin, NotificationAbuseReport, func(locale string) (string, string) {
+			return i18n.Translate(locale, "abuse.report.subject", params), i18n.Translate(locale, "abuse.report.body", params)
+		}); err != nil {
+			s.logger.Error("Failed to notify admin of abuse report", zap.String("user_id", admin.String()), zap.Error(err))
+		}
+	}
+}
+
+func (s *AbuseService) audit(ctx context.Context, action string, report *models.AbuseReport, details string) {
+	resourceID := report.ID.String()
+	auditLog := &models.AuditLog{
+		UserID:     actorFromContext(ctx),
+		Action:     action,
+		Resource:   "abuse_report",
+		ResourceID: &resourceID,
+		Details:    details,
+		Success:    true,
+	}
+	if err := s.db.WithContext(ctx).Create(auditLog).Error; err != nil {
+		s.logger.Error("Failed to record audit log", zap.Error(err))
+	}
+}
@@ -0,0 +1,308 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestAbuseTargetHost(t *testing.T) {
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"shop.example", "shop.example"},
+		{"Shop.Example.", "shop.example"},
+		{"https://www.shop.example/login?next=/", "www.shop.example"},
+		{"http://shop.example:8080/", "shop.example"},
+		{"shop.example:8080/phish.html", "shop.example"},
+		{"shop.example/path#frag", "shop.example"},
+		{"http://[2001:db8::1]/", ""},
+		{"192.0.2.1", ""},
+		{"not a domain", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := abuseTargetHost(tt.target); got != tt.want {
+			t.Errorf("abuseTargetHost(%q) = %q, want %q", tt.target, got, tt.want)
+		}
+	}
+}
+
+// newTestAbuseService creates an abuse service notifying admins of reports, whose suspensions
+// go through a user service on the same domains
+func newTestAbuseService(t *testing.T, db *gorm.DB) *AbuseService {
+	t.Helper()
+
+	users := newTestUserService(t, db)
+	cfg := config.AbuseConfig{Categories: []string{"spam", "phishing"}, NotifyAdmins: true}
+	return NewAbuseService(db, zap.NewNop(), cfg, users.domains, users, newTestNotificationService(t, db))
+}
+
+func TestSubmitAbuseReport(t *testing.T) {
+	db := newTestDB(t)
+	abuse := newTestAbuseService(t, db)
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "shop.example")
+	admin := createTestUser(t, db)
+	grantRole(t, db, admin, "admin")
+	valid := AbuseReportRequest{ReporterEmail: "abuse@isp.example", Target: "shop.example", Category: "spam", Description: "Spam from this domain"}
+
+	rejections := []struct {
+		name     string
+		change   func(*AbuseReportRequest)
+		reporter *uuid.UUID
+		field    string
+	}{
+		{"anonymous without contact", func(r *AbuseReportRequest) { r.ReporterEmail = "" }, nil, "reporter_email"},
+		{"malformed contact", func(r *AbuseReportRequest) { r.ReporterEmail = "Abuse <abuse@isp.example>" }, nil, "reporter_email"},
+		{"target without a host", func(r *AbuseReportRequest) { r.Target = "https:///" }, nil, "target"},
+		{"unknown category", func(r *AbuseReportRequest) { r.Category = "rudeness" }, nil, "category"},
+		{"empty description", func(r *AbuseReportRequest) { r.Description = "  " }, nil, "description"},
+		{"long reporter name", func(r *AbuseReportRequest) { r.ReporterName = strings.Repeat("n", maxAbuseReporterNameLength+1) }, nil, "reporter_name"},
+	}
+	for _, tt := range rejections {
+		t.Run(tt.name, func(t *testing.T) {
+			req := valid
+			tt.change(&req)
+			if _, err := abuse.SubmitReport(context.Background(), req, tt.reporter, "198.51.100.7"); fieldMessage(err, tt.field) == "" {
+				t.Errorf("SubmitReport() error = %v, want %s rejected", err, tt.field)
+			}
+		})
+	}
+
+	// Reports about names under a hosted domain are linked to it and its owner
+	req := valid
+	req.Target = "https://www.shop.example/login"
+	report, err := abuse.SubmitReport(context.Background(), req, nil, "198.51.100.7")
+	if err != nil {
+		t.Fatalf("SubmitReport() error = %v", err)
+	}
+	if report.Status != AbuseStatusOpen || report.DomainID == nil || *report.DomainID != domain.ID || report.TargetUserID == nil || *report.TargetUserID != owner.ID || report.ReporterIP != "198.51.100.7" {
+		t.Errorf("report = %+v, want an open report on shop.example", report)
+	}
+	var notified int64
+	db.Model(&models.Notification{}).Where("user_id = ? AND event_type = ?", admin.ID, NotificationAbuseReport).Count(&notified)
+	if notified != 1 {
+		t.Errorf("admin notified %d times, want once", notified)
+	}
+
+	// Logged-in users need no contact address; unhosted targets are kept unlinked
+	reporter := createTestUser(t, db)
+	req = valid
+	req.ReporterEmail, req.Target = "", "elsewhere.example"
+	report, err = abuse.SubmitReport(asUser(reporter.ID, "user"), req, &reporter.ID, "198.51.100.8")
+	if err != nil {
+		t.Fatalf("SubmitReport() error = %v", err)
+	}
+	if report.DomainID != nil || report.TargetUserID != nil || report.ReporterUserID == nil || *report.ReporterUserID != reporter.ID {
+		t.Errorf("report = %+v, want an unlinked report by the user", report)
+	}
+	var audited int64
+	db.Model(&models.AuditLog{}).Where("action = ?", "abuse_report.create").Count(&audited)
+	if audited != 2 {
+		t.Errorf("%d reports audited, want 2", audited)
+	}
+}
+
+func TestAbuseReportTriage(t *testing.T) {
+	db := newTestDB(t)
+	abuse := newTestAbuseService(t, db)
+	owner := createTestUser(t, db)
+	createTestDomain(t, db, owner, "shop.example")
+	report, err := abuse.SubmitReport(context.Background(), AbuseReportRequest{ReporterEmail: "abuse@isp.example", Target: "shop.example", Category: "phishing", Description: "Fake bank login"}, nil, "198.51.100.7")
+	if err != nil {
+		t.Fatalf("SubmitReport() error = %v", err)
+	}
+	admin := createTestUser(t, db)
+	ctx := asUser(admin.ID, "admin")
+
+	// Count the notes written, to catch notes already stored being saved again
+	noteInserts := 0
+	db.Callback().Create().Before("gorm:create").Register("test:count_notes", func(tx *gorm.DB) {
+		if tx.Statement.Table == "abuse_report_notes" {
+			noteInserts++
+		}
+	})
+
+	steps := []struct {
+		name     string
+		status   string
+		note     string
+		want     string // Status afterwards
+		wantCode string // Error code when rejected
+	}{
+		{"note without text", "", "", AbuseStatusOpen, "validation_failed"},
+		{"investigate", AbuseStatusInvestigating, "Looking at the login page", AbuseStatusInvestigating, ""},
+		{"back to open", AbuseStatusOpen, "", AbuseStatusInvestigating, "abuse_transition"},
+		{"note alone", "", "Page is still up", AbuseStatusInvestigating, ""},
+		{"resolve", AbuseStatusResolved, "Owner removed the page", AbuseStatusResolved, ""},
+		{"reopen", AbuseStatusInvestigating, "It is back", AbuseStatusInvestigating, ""},
+	}
+	for _, step := range steps {
+		updated, err := abuse.UpdateReport(ctx, report.ID, step.status, step.note)
+		if step.wantCode != "" {
+			if code := errorCode(err); code != step.wantCode {
+				t.Errorf("%s: error = %v, want %s", step.name, err, step.wantCode)
+			}
+		} else if err != nil {
+			t.Fatalf("%s: UpdateReport() error = %v", step.name, err)
+		} else if updated.Status != step.want {
+			t.Errorf("%s: status = %s, want %s", step.name, updated.Status, step.want)
+		}
+
+		stored, _ := abuse.GetReport(ctx, report.ID)
+		if stored.Status != step.want {
+			t.Errorf("%s: stored status = %s, want %s", step.name, stored.Status, step.want)
+		}
+		if step.name == "resolve" && stored.ResolvedAt == nil {
+			t.Errorf("resolved report has no resolution time")
+		}
+		if step.name == "reopen" && stored.ResolvedAt != nil {
+			t.Errorf("reopened report keeps its resolution time")
+		}
+	}
+
+	stored, _ := abuse.GetReport(ctx, report.ID)
+	if len(stored.Notes) != 4 || noteInserts != 4 {
+		t.Fatalf("%d notes, %d written, want 4 of each", len(stored.Notes), noteInserts)
+	}
+	wantTransitions := [][2]string{{"open", "investigating"}, {"investigating", "investigating"}, {"investigating", "resolved"}, {"resolved", "investigating"}}
+	for i, note := range stored.Notes {
+		if note.FromStatus != wantTransitions[i][0] || note.ToStatus != wantTransitions[i][1] || note.UserID == nil || *note.UserID != admin.ID {
+			t.Errorf("note %d = %+v, want %v by the admin", i, note, wantTransitions[i])
+		}
+	}
+	var audited int64
+	db.Model(&models.AuditLog{}).Where("action = ? AND resource_id = ?", "abuse_report.update", report.ID.String()).Count(&audited)
+	if audited != 4 {
+		t.Errorf("%d updates audited, want 4", audited)
+	}
+
+	if _, err := abuse.UpdateReport(ctx, uuid.New(), AbuseStatusResolved, "x"); !apperrors.IsNotFound(err) {
+		t.Errorf("unknown report error = %v, want not found", err)
+	}
+}
+
+func TestAbuseSuspendTarget(t *testing.T) {
+	db := newTestDB(t)
+	abuse := newTestAbuseService(t, db)
+	admin := createTestUser(t, db)
+	grantRole(t, db, admin, "admin")
+	ctx := asUser(admin.ID, "admin")
+	submit := func(target string) *models.AbuseReport {
+		t.Helper()
+		report, err := abuse.SubmitReport(context.Background(), AbuseReportRequest{ReporterEmail: "abuse@isp.example", Target: target, Category: "spam", Description: "Spam"}, nil, "198.51.100.7")
+		if err != nil {
+			t.Fatalf("SubmitReport() error = %v", err)
+		}
+		return report
+	}
+
+	// Suspending the domain moves the report to investigating and notes the suspension
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "spam.example")
+	report := submit("mail.spam.example")
+	updated, err := abuse.SuspendTarget(ctx, report.ID, AbuseSuspendDomain, "Confirmed spam run")
+	if err != nil {
+		t.Fatalf("SuspendTarget() error = %v", err)
+	}
+	var suspended models.Domain
+	db.First(&suspended, "id = ?", domain.ID)
+	if suspended.SuspendedAt == nil || !strings.Contains(suspended.SuspensionReason, report.ID.String()) {
+		t.Errorf("domain suspension = %v %q, want it citing the report", suspended.SuspendedAt, suspended.SuspensionReason)
+	}
+	if updated.Status != AbuseStatusInvestigating || len(updated.Notes) != 1 || updated.Notes[0].Action != "domain_suspend" || updated.Notes[0].Note != "Confirmed spam run" {
+		t.Errorf("report = %s %+v", updated.Status, updated.Notes)
+	}
+	var active models.User
+	db.First(&active, "id = ?", owner.ID)
+	if !active.IsActive {
+		t.Error("suspending the domain deactivated its owner")
+	}
+
+	// Suspending the account deactivates the owner and suspends all of their domains
+	other := createTestUser(t, db)
+	first := createTestDomain(t, db, other, "phish.example")
+	second := createTestDomain(t, db, other, "other.example")
+	report = submit("phish.example")
+	if updated, err = abuse.SuspendTarget(ctx, report.ID, AbuseSuspendAccount, ""); err != nil {
+		t.Fatalf("SuspendTarget() error = %v", err)
+	}
+	var deactivated models.User
+	db.First(&deactivated, "id = ?", other.ID)
+	if deactivated.IsActive {
+		t.Error("account still active")
+	}
+	for _, id := range []uuid.UUID{first.ID, second.ID} {
+		var d models.Domain
+		db.First(&d, "id = ?", id)
+		if d.SuspendedAt == nil {
+			t.Errorf("%s not suspended with its account deactivated", d.Name)
+		}
+	}
+	if updated.Notes[len(updated.Notes)-1].Action != "user_deactivate" {
+		t.Errorf("notes = %+v, want the deactivation", updated.Notes)
+	}
+
+	// Resolved reports keep their status when acted on
+	abuse.UpdateReport(ctx, report.ID, AbuseStatusResolved, "Account closed")
+	if updated, err = abuse.SuspendTarget(ctx, report.ID, AbuseSuspendDomain, ""); err != nil || updated.Status != AbuseStatusResolved {
+		t.Errorf("suspending for a resolved report = %v, %v", updated, err)
+	}
+
+	rejections := []struct {
+		name   string
+		report uuid.UUID
+		scope  string
+		check  func(error) bool
+	}{
+		{"unhosted target", submit("elsewhere.example").ID, AbuseSuspendDomain, func(err error) bool { return errorCode(err) == "abuse_no_target" }},
+		{"unknown scope", report.ID, "server", func(err error) bool { return fieldMessage(err, "scope") != "" }},
+		{"unknown report", uuid.New(), AbuseSuspendDomain, apperrors.IsNotFound},
+	}
+	for _, tt := range rejections {
+		if _, err := abuse.SuspendTarget(ctx, tt.report, tt.scope, ""); !tt.check(err) {
+			t.Errorf("%s: error = %v", tt.name, err)
+		}
+	}
+}
+
+func TestAbuseReportsList(t *testing.T) {
+	db := newTestDB(t)
+	abuse := newTestAbuseService(t, db)
+	ctx := asUser(uuid.New(), "admin")
+	var ids []uuid.UUID
+	for _, target := range []string{"a.example", "b.example", "c.example"} {
+		report, err := abuse.SubmitReport(context.Background(), AbuseReportRequest{ReporterEmail: "abuse@isp.example", Target: target, Category: "spam", Description: "Spam"}, nil, "198.51.100.7")
+		if err != nil {
+			t.Fatalf("SubmitReport() error = %v", err)
+		}
+		ids = append(ids, report.ID)
+	}
+	abuse.UpdateReport(ctx, ids[1], AbuseStatusResolved, "Handled")
+
+	open, _, err := abuse.Reports(ctx, AbuseStatusOpen, "", 10)
+	if err != nil || len(open) != 2 {
+		t.Errorf("open reports = %d, %v, want 2", len(open), err)
+	}
+	page, next, err := abuse.Reports(ctx, "", "", 2)
+	if err != nil || len(page) != 2 || next == "" {
+		t.Fatalf("first page = %d, %q, %v", len(page), next, err)
+	}
+	rest, next, _ := abuse.Reports(ctx, "", next, 2)
+	if len(rest) != 1 || next != "" || rest[0].ID == page[0].ID || rest[0].ID == page[1].ID {
+		t.Errorf("second page = %v, %q", rest, next)
+	}
+	if _, _, err := abuse.Reports(ctx, "closed", "", 10); fieldMessage(err, "status") == "" {
+		t.Errorf("unknown status error = %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/i18n"
+	"github.com/mynodecp/mynodecp/backend/internal/mailer"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// AccountCleanupResult counts what one cleanup run did
+type AccountCleanupResult struct {
+	Warned  int `json:"warned"`
+	Deleted int `json:"deleted"`
+	Flagged int `json:"flagged"`
+}
+
+// AccountCleanupService removes abandoned unverified accounts and flags inactive ones
+type AccountCleanupService struct {
+	db     *gorm.DB
+	logger *zap.Logger
+	config config.JobsConfig
+	mailer *mailer.Mailer
+	now    func() time.Time
+}
+
+// NewAccountCleanupService creates a new account cleanup service
+func NewAccountCleanupService(db *gorm.DB, logger *zap.Logger, config config.JobsConfig, mailer *mailer.Mailer) *AccountCleanupService {
+	return &AccountCleanupService{
+		db:     db,
+		logger: logger,
+		config: config,
+		mailer: mailer,
+		now:    time.Now,
+	}
+}
+
+// Run warns and then deletes unverified accounts and flags inactive accounts. Admins are never
+// touched; accounts owning domains, mailboxes, databases, FTP accounts, backups or vault entries
+// are never deleted. An account is only deleted once its warning
+// is at least UnverifiedWarning old, so owners get the full notice even after downtime.
+func (s *AccountCleanupService) Run(ctx context.Context) (*AccountCleanupResult, error) {
+	var result AccountCleanupResult
+
+	if s.config.UnverifiedRetention > 0 {
+		candidates, err := s.unverifiedCandidates(ctx)
+		if err != nil {
+			return &result, err
+		}
+
+		now := s.now()
+		for _, user := range candidates {
+			switch {
+			case user.DeletionWarnedAt == nil:
+				if s.warn(ctx, user) {
+					result.Warned++
+				}
+			case !user.DeletionWarnedAt.After(now.Add(-s.config.UnverifiedWarning)) &&
+				user.CreatedAt.Before(now.Add(-s.config.UnverifiedRetention)):
+				if err := s.delete(ctx, user); err != nil {
+					return &result, err
+				}
+				result.Deleted++
+			}
+		}
+	}
+
+	if s.config.InactiveAfter > 0 {
+		flagged, err := s.flagInactive(ctx)
+		if err != nil {
+			return &result, err
+		}
+		result.Flagged = flagged
+	}
+
+	if result.Warned > 0 || result.Deleted > 0 || result.Flagged > 0 {
+		s.logger.Info("Account cleanup finished",
+			zap.Int("warned", result.Warned),
+			zap.Int("deleted", result.Deleted),
+			zap.Int("flagged", result.Flagged))
+	}
+
+	return &result, nil
+}
+
+// unverifiedCandidates returns unverified non-admin accounts owning nothing that are due for a
+// warning or deletion
+func (s *AccountCleanupService) unverifiedCandidates(ctx context.Context) ([]*models.User, error) {
+	warnBefore := s.now().Add(-(s.config.UnverifiedRetention - s.config.UnverifiedWarning))
+
+	var users []*models.User
+	if err := excludeOwners(s.excludeProtected(s.db.WithContext(ctx).
+		Where("is_email_verified = ? AND created_at < ?", false, warnBefore))).
+		Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to get unverified accounts: %w", err)
+	}
+
+	return users, nil
+}
+
+// ownedResources are subqueries finding something a user owns. Mailboxes, databases and FTP
+// accounts count through any domain of the user, including deleted ones, as they can outlive it.
+var ownedResources = []string{
+	"SELECT 1 FROM domains WHERE domains.user_id = users.id AND domains.deleted_at IS NULL",
+	"SELECT 1 FROM email_accounts JOIN domains ON domains.id = email_accounts.domain_id WHERE domains.user_id = users.id",
+	"SELECT 1 FROM databases JOIN domains ON domains.id = databases.domain_id WHERE domains.user_id = users.id",
+	"SELECT 1 FROM ftp_accounts JOIN domains ON domains.id = ftp_accounts.domain_id WHERE domains.user_id = users.id",
+	"SELECT 1 FROM backups WHERE backups.user_id = users.id",
+	"SELECT 1 FROM vault_items WHERE vault_items.user_id = users.id",
+}
+
+// excludeOwners filters accounts owning any of ownedResources out of a users query
+func excludeOwners(query *gorm.DB) *gorm.DB {
+	for _, owned := range ownedResources {
+		query = query.Where("NOT EXISTS (" + owned + ")")
+	}
+	return query
+}
+
+// excludeProtected filters admins out of a users query
+func (s *AccountCleanupService) excludeProtected(query *gorm.DB) *gorm.DB {
+	return query.Where("NOT EXISTS (SELECT 1 FROM user_roles JOIN roles ON roles.id = user_roles.role_id " +
+		"WHERE user_roles.user_id = users.id AND roles.name = 'admin')")
+}
+
+// warn emails the owner of an unverified account and records the warning. The warning is
+// recorded even when the email cannot be queued, so a bad address does not block cleanup forever.
+func (s *AccountCleanupService) warn(ctx context.Context, user *models.User) bool {
+	now := s.now()
+	deleteOn := now.Add(s.config.UnverifiedWarning)
+	if earliest := user.CreatedAt.Add(s.config.UnverifiedRetention); earliest.After(deleteOn) {
+		deleteOn = earliest
+	}
+
+	if s.mailer != nil {
+		name := user.FirstName
+		if name == "" {
+			name = user.Username
+		}
+		if _, err := s.mailer.EnqueueLocale(ctx, user.Email, i18n.Resolve(user.Locale, ""), "account_deletion_warning", map[string]string{
+			"Name":     name,
+			"Username": user.Username,
+			"DeleteOn": deleteOn.UTC().Format("2006-01-02"),
+		}); err != nil {
+			s.logger.Warn("Failed to queue account deletion warning", zap.String("user_id", user.ID.String()), zap.Error(err))
+		}
+	}
+
+	if err := s.db.WithContext(ctx).Model(user).Update("deletion_warned_at", now).Error; err != nil {
+		s.logger.Error("Failed to record account deletion warning", zap.String("user_id", user.ID.String()), zap.Error(err))
+		return false
+	}
+	return true
+}
+
+// delete removes an unverified account, re-checking the exclusions in the same transaction so a
+// resource created since the candidates were selected keeps the account
+func (s *AccountCleanupService) delete(ctx context.Context, user *models.User) error {
+	deleted := false
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := s.excludeProtected(tx.Where("id = ? AND is_email_verified = ?", user.ID, false)).
+			Where("NOT EXISTS (SELECT 1 FROM domains WHERE domains.user_id = users.id AND domains.deleted_at IS NULL)").
+			Delete(&models.User{})
+		if result.Error != nil {
+			return result.Error
+		}
+		deleted = result.RowsAffected > 0
+		if !deleted {
+			return nil
+		}
+		return tx.Model(&models.Session{}).
+			Where("user_id = ? AND revoked_at IS NULL", user.ID).
+			Update("revoked_at", s.now()).Error
+	}); err != nil {
+		return fmt.Errorf("failed to delete unverified account: %w", err)
+	}
+	if !deleted {
+		return nil
+	}
+
+	resourceID := user.ID.String()
+	auditLog := &models.AuditLog{
+		Action:     "cleanup_delete",
+		Resource:   "user",
+		ResourceID: &resourceID,
+		Details:    fmt.Sprintf("unverified account %s deleted by account cleanup", user.Username),
+		Success:    true,
+	}
+	if err := s.db.WithContext(ctx).Create(auditLog).Error; err != nil {
+		s.logger.Error("Failed to record audit log", zap.Error(err))
+	}
+
+	s.logger.Info("Unverified account deleted", zap.String("user_id", user.ID.String()), zap.String("username", user.Username))
+	return nil
+}
+
+// flagInactive flags non-admin accounts without a login, or created without ever logging in,
+// for longer than InactiveAfter
+func (s *AccountCleanupService) flagInactive(ctx context.Context) (int, error) {
+	cutoff := s.now().Add(-s.config.InactiveAfter)
+
+	result := s.excludeProtected(s.db.WithContext(ctx).Model(&models.User{}).
+		Where("inactive_flagged_at IS NULL").
+		Where("(last_login_at < ? OR (last_login_at IS NULL AND created_at < ?))", cutoff, cutoff)).
+		Update("inactive_flagged_at", s.now())
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to flag inactive accounts: %w", result.Error)
+	}
+
+	return int(result.RowsAffected), nil
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestAccountCleanupKeepsAccountsOwningResources(t *testing.T) {
+	tests := []struct {
+		name    string
+		own     func(t *testing.T, db *gorm.DB, user *models.User)
+		deleted bool
+	}{
+		{"nothing", func(*testing.T, *gorm.DB, *models.User) {}, true},
+		{"domain", func(t *testing.T, db *gorm.DB, user *models.User) {
+			createTestDomain(t, db, user, "kept.example")
+		}, false},
+		{"mailbox of a deleted domain", func(t *testing.T, db *gorm.DB, user *models.User) {
+			domain := createTestDomain(t, db, user, "gone.example")
+			mustCreate(t, db, &models.EmailAccount{DomainID: domain.ID, Username: "info", PasswordHash: "x"})
+			if err := db.Delete(domain).Error; err != nil {
+				t.Fatalf("delete domain: %v", err)
+			}
+		}, false},
+		{"database of a deleted domain", func(t *testing.T, db *gorm.DB, user *models.User) {
+			domain := createTestDomain(t, db, user, "gone.example")
+			mustCreate(t, db, &models.Database{DomainID: domain.ID, Name: "shop", Type: "mysql"})
+			if err := db.Delete(domain).Error; err != nil {
+				t.Fatalf("delete domain: %v", err)
+			}
+		}, false},
+		{"FTP account of a deleted domain", func(t *testing.T, db *gorm.DB, user *models.User) {
+			domain := createTestDomain(t, db, user, "gone.example")
+			mustCreate(t, db, &models.FTPAccount{DomainID: domain.ID, Username: "deploy", PasswordHash: "x", HomeDir: "/var/www/gone.example"})
+			if err := db.Delete(domain).Error; err != nil {
+				t.Fatalf("delete domain: %v", err)
+			}
+		}, false},
+		{"backup", func(t *testing.T, db *gorm.DB, user *models.User) {
+			mustCreate(t, db, &models.Backup{UserID: user.ID, Type: "full", Name: "before-move"})
+		}, false},
+		{"vault entry", func(t *testing.T, db *gorm.DB, user *models.User) {
+			mustCreate(t, db, &models.VaultItem{UserID: user.ID, Name: "registrar", Sealed: "sealed"})
+		}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			now := time.Now()
+			user := createTestUser(t, db)
+			if err := db.Model(user).Update("created_at", now.Add(-60*24*time.Hour)).Error; err != nil {
+				t.Fatalf("age user: %v", err)
+			}
+			tt.own(t, db, user)
+
+			cleanup := NewAccountCleanupService(db, zap.NewNop(), config.JobsConfig{
+				UnverifiedRetention: 30 * 24 * time.Hour,
+				UnverifiedWarning:   7 * 24 * time.Hour,
+			}, nil)
+			cleanup.now = func() time.Time { return now }
+			if _, err := cleanup.Run(context.Background()); err != nil {
+				t.Fatalf("first run: %v", err)
+			}
+			cleanup.now = func() time.Time { return now.Add(8 * 24 * time.Hour) }
+			result, err := cleanup.Run(context.Background())
+			if err != nil {
+				t.Fatalf("second run: %v", err)
+			}
+
+			var remaining int64
+			db.Model(&models.User{}).Where("id = ?", user.ID).Count(&remaining)
+			if deleted := remaining == 0; deleted != tt.deleted {
+				t.Errorf("deleted = %v, want %v (result %+v)", deleted, tt.deleted, result)
+			}
+		})
+	}
+}
+
+// mustCreate stores a row or fails the test
+func mustCreate(t *testing.T, db *gorm.DB, value interface{}) {
+	t.Helper()
+
+	if err := db.Create(value).Error; err != nil {
+		t.Fatalf("create %T: %v", value, err)
+	}
+}
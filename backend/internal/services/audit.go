@@ -0,0 +1,474 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/pagination"
+)
+
+// Log kinds that can be queried and exported
+const (
+	AuditKindAudit    = "audit"
+	AuditKindSecurity = "security"
+)
+
+// Export formats
+const (
+	ExportFormatCSV  = "csv"
+	ExportFormatJSON = "json"
+)
+
+const (
+	// maxExportRows caps a single export; narrower filters are needed for more
+	maxExportRows = 100000
+	// maxExportRange bounds the time span of an export
+	maxExportRange = 366 * 24 * time.Hour
+	// exportBatchSize is the number of rows fetched per keyset page
+	exportBatchSize = 500
+	// maxHistoryEntries caps the change history returned for one resource
+	maxHistoryEntries = 1000
+)
+
+// AuditFilter selects audit log or security event rows
+type AuditFilter struct {
+	Kind     string     `json:"kind"` // audit (default) or security
+	UserID   *uuid.UUID `json:"user_id,omitempty"`
+	Action   string     `json:"action,omitempty"`   // Audit action or security event type
+	Resource string     `json:"resource,omitempty"` // Audit resource or security event source
+	Severity string     `json:"severity,omitempty"` // Security events only
+	Success  *bool      `json:"success,omitempty"`  // Audit logs only
+	From     time.Time  `json:"from"`
+	To       time.Time  `json:"to"`
+	Limit    int        `json:"limit,omitempty"` // Page size for Query; row cap for Export, at most maxExportRows
+}
+
+// AuditService handles queries over the audit and security logs
+type AuditService struct {
+	db     *gorm.DB
+	redis  *redis.Client
+	logger *zap.Logger
+}
+
+// NewAuditService creates a new audit service
+func NewAuditService(db *gorm.DB, redis *redis.Client, logger *zap.Logger) *AuditService {
+	return &AuditService{
+		db:     db,
+		redis:  redis,
+		logger: logger,
+	}
+}
+
+// Query returns a page of audit log or security event rows, newest first, and the cursor of the
+// next page. The cursor is empty on the last page. Admins see every row; other callers only their
+// own, see scopeToCaller.
+func (s *AuditService) Query(ctx context.Context, filter AuditFilter, cursor string, limit int) (interface{}, string, error) {
+	query, err := s.filtered(ctx, filter)
+	if err != nil {
+		return nil, "", err
+	}
+
+	limit = pagination.ClampLimit(limit)
+	page, err := pagination.Apply(query, cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if filter.Kind == AuditKindSecurity {
+		var events []*models.SecurityEvent
+		if err := page.Find(&events).Error; err != nil {
+			return nil, "", fmt.Errorf("failed to get security events: %w", err)
+		}
+		events, next := pagination.Next(events, limit, func(event *models.SecurityEvent) pagination.Cursor {
+			return pagination.Cursor{CreatedAt: event.CreatedAt, ID: event.ID.String()}
+		})
+		return events, next, nil
+	}
+
+	var logs []*models.AuditLog
+	if err := page.Find(&logs).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to get audit logs: %w", err)
+	}
+	logs, next := pagination.Next(logs, limit, func(log *models.AuditLog) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: log.CreatedAt, ID: log.ID.String()}
+	})
+	return logs, next, nil
+}
+
+// Export streams the rows matching filter to w as CSV or JSON, oldest first. Rows are read in
+// keyset-paginated batches so the export never holds the whole result in memory. The filter is
+// checked before anything is written, so an error without output means nothing was sent.
+func (s *AuditService) Export(ctx context.Context, w io.Writer, filter AuditFilter, format string) error {
+	if filter.To.IsZero() {
+		filter.To = time.Now()
+	}
+	if filter.From.IsZero() || filter.To.Sub(filter.From) > maxExportRange {
+		return apperrors.Invalid("from", fmt.Sprintf("export range must start at most %d days before its end", int(maxExportRange.Hours()/24)))
+	}
+	if filter.Limit <= 0 || filter.Limit > maxExportRows {
+		filter.Limit = maxExportRows
+	}
+
+	var out exportWriter
+	switch format {
+	case ExportFormatCSV:
+		out = &csvExportWriter{w: csv.NewWriter(w)}
+	case ExportFormatJSON:
+		out = &jsonExportWriter{w: w}
+	default:
+		return apperrors.Invalid("format", fmt.Sprintf("unsupported export format: %s", format))
+	}
+
+	// Rejects an unknown kind and a caller who may not read the rows
+	if _, err := s.filtered(ctx, filter); err != nil {
+		return err
+	}
+
+	table := auditExportTable
+	if filter.Kind == AuditKindSecurity {
+		table = securityExportTable
+	}
+	if err := out.begin(table.header); err != nil {
+		return err
+	}
+
+	var afterTime time.Time
+	var afterID string
+	written := 0
+	for written < filter.Limit {
+		query, err := s.filtered(ctx, filter)
+		if err != nil {
+			return err
+		}
+		if afterID != "" {
+			query = query.Where("(created_at > ? OR (created_at = ? AND id > ?))", afterTime, afterTime, afterID)
+		}
+		batch := exportBatchSize
+		if remaining := filter.Limit - written; remaining < batch {
+			batch = remaining
+		}
+
+		rows, err := table.fetch(query.Order("created_at, id").Limit(batch))
+		if err != nil {
+			return fmt.Errorf("failed to read logs: %w", err)
+		}
+		for _, row := range rows {
+			if err := out.write(row.record, row.fields); err != nil {
+				return fmt.Errorf("failed to write export: %w", err)
+			}
+		}
+
+		written += len(rows)
+		if len(rows) < batch {
+			break
+		}
+		afterTime, afterID = rows[len(rows)-1].createdAt, rows[len(rows)-1].id
+	}
+
+	return out.end()
+}
+
+// filtered builds the base query for a filter
+func (s *AuditService) filtered(ctx context.Context, filter AuditFilter) (*gorm.DB, error) {
+	var query *gorm.DB
+	switch filter.Kind {
+	case "", AuditKindAudit:
+		query = s.db.WithContext(ctx).Model(&models.AuditLog{})
+		if filter.Action != "" {
+			query = query.Where("action = ?", filter.Action)
+		}
+		if filter.Resource != "" {
+			query = query.Where("resource = ?", filter.Resource)
+		}
+		if filter.Success != nil {
+			query = query.Where("success = ?", *filter.Success)
+		}
+	case AuditKindSecurity:
+		query = s.db.WithContext(ctx).Model(&models.SecurityEvent{})
+		if filter.Action != "" {
+			query = query.Where("type = ?", filter.Action)
+		}
+		if filter.Resource != "" {
+			query = query.Where("source = ?", filter.Resource)
+		}
+		if filter.Severity != "" {
+			query = query.Where("severity = ?", filter.Severity)
+		}
+	default:
+		return nil, apperrors.Invalid("kind", fmt.Sprintf("unknown log kind: %s", filter.Kind))
+	}
+
+	if filter.UserID != nil {
+		query = query.Where("user_id = ?", *filter.UserID)
+	}
+	query, err := scopeToCaller(ctx, query, filter)
+	if err != nil {
+		return nil, err
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+
+	return query, nil
+}
+
+// ownedAuditResources maps audit log resources to a query for the IDs of those @user owns, directly
+// or through their domains. Deleted resources drop out, leaving only the entries of the caller's
+// own actions on them.
+var ownedAuditResources = map[string]string{
+	"user":                "SELECT id FROM users WHERE id = @user",
+	"domain":              "SELECT id FROM domains WHERE user_id = @user",
+	"redirect":            "SELECT redirects.id FROM redirects JOIN domains ON domains.id = redirects.domain_id WHERE domains.user_id = @user",
+	"database":            "SELECT `databases`.id FROM `databases` JOIN domains ON domains.id = `databases`.domain_id WHERE domains.user_id = @user",
+	"email_account":       "SELECT email_accounts.id FROM email_accounts JOIN domains ON domains.id = email_accounts.domain_id WHERE domains.user_id = @user",
+	"ftp_account":         "SELECT ftp_accounts.id FROM ftp_accounts JOIN domains ON domains.id = ftp_accounts.domain_id WHERE domains.user_id = @user",
+	"protected_directory": "SELECT protected_directories.id FROM protected_directories JOIN domains ON domains.id = protected_directories.domain_id WHERE domains.user_id = @user",
+	"directory_user":      "SELECT directory_users.id FROM directory_users JOIN protected_directories ON protected_directories.id = directory_users.directory_id JOIN domains ON domains.id = protected_directories.domain_id WHERE domains.user_id = @user",
+	"ssh_key":             "SELECT id FROM ssh_keys WHERE user_id = @user",
+}
+
+// scopeToCaller limits a log query to what the caller may see. Admins see everything. Other users
+// see the audit entries of their own actions and of actions on resources they own, such as an
+// admin's change to one of their domains, and the security events about their account; filtering
+// by another user is refused.
+func scopeToCaller(ctx context.Context, query *gorm.DB, filter AuditFilter) (*gorm.DB, error) {
+	if hasRoleInContext(ctx, "admin") {
+		return query, nil
+	}
+
+	actor := actorFromContext(ctx)
+	if actor == nil || (filter.UserID != nil && *filter.UserID != *actor) {
+		return nil, apperrors.PermissionDenied("audit log")
+	}
+
+	if filter.Kind == AuditKindSecurity {
+		return query.Where("user_id = ?", *actor), nil
+	}
+
+	resources := make([]string, 0, len(ownedAuditResources))
+	for resource := range ownedAuditResources {
+		resources = append(resources, resource)
+	}
+	sort.Strings(resources)
+
+	conditions := []string{"user_id = @user"}
+	for _, resource := range resources {
+		conditions = append(conditions, fmt.Sprintf("(resource = '%s' AND resource_id IN (%s))", resource, ownedAuditResources[resource]))
+	}
+	return query.Where("("+strings.Join(conditions, " OR ")+")", map[string]interface{}{"user": actor.String()}), nil
+}
+
+// exportRow is one fetched row together with its CSV fields and keyset cursor
+type exportRow struct {
+	record    interface{}
+	fields    []string
+	createdAt time.Time
+	id        string
+}
+
+// exportTable describes how one kind of log is read and flattened
+type exportTable struct {
+	header []string
+	fetch  func(query *gorm.DB) ([]exportRow, error)
+}
+
+var auditExportTable = exportTable{
+	header: []string{"id", "created_at", "user_id", "action", "resource", "resource_id", "ip_address", "user_agent", "success", "details"},
+	fetch: func(query *gorm.DB) ([]exportRow, error) {
+		var logs []*models.AuditLog
+		if err := query.Find(&logs).Error; err != nil {
+			return nil, err
+		}
+
+		rows := make([]exportRow, len(logs))
+		for i, log := range logs {
+			resourceID := ""
+			if log.ResourceID != nil {
+				resourceID = *log.ResourceID
+			}
+			rows[i] = exportRow{
+				record: log,
+				fields: []string{
+					log.ID.String(), formatExportTime(log.CreatedAt), formatExportUser(log.UserID),
+					log.Action, log.Resource, resourceID, log.IPAddress, log.UserAgent,
+					strconv.FormatBool(log.Success), log.Details,
+				},
+				createdAt: log.CreatedAt,
+				id:        log.ID.String(),
+			}
+		}
+		return rows, nil
+	},
+}
+
+var securityExportTable = exportTable{
+	header: []string{"id", "created_at", "user_id", "type", "severity", "source", "ip_address", "user_agent", "description", "is_resolved"},
+	fetch: func(query *gorm.DB) ([]exportRow, error) {
+		var events []*models.SecurityEvent
+		if err := query.Find(&events).Error; err != nil {
+			return nil, err
+		}
+
+		rows := make([]exportRow, len(events))
+		for i, event := range events {
+			rows[i] = exportRow{
+				record: event,
+				fields: []string{
+					event.ID.String(), formatExportTime(event.CreatedAt), formatExportUser(event.UserID),
+					event.Type, event.Severity, event.Source, event.IPAddress, event.UserAgent,
+					event.Description, strconv.FormatBool(event.IsResolved),
+				},
+				createdAt: event.CreatedAt,
+				id:        event.ID.String(),
+			}
+		}
+		return rows, nil
+	},
+}
+
+func formatExportTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func formatExportUser(userID *uuid.UUID) string {
+	if userID == nil {
+		return ""
+	}
+	return userID.String()
+}
+
+// exportWriter writes rows in one export format
+type exportWriter interface {
+	begin(header []string) error
+	write(record interface{}, fields []string) error
+	end() error
+}
+
+type csvExportWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvExportWriter) begin(header []string) error {
+	return c.w.Write(header)
+}
+
+func (c *csvExportWriter) write(record interface{}, fields []string) error {
+	escaped := make([]string, len(fields))
+	for i, field := range fields {
+		escaped[i] = escapeCSVFormula(field)
+	}
+	return c.w.Write(escaped)
+}
+
+func (c *csvExportWriter) end() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// escapeCSVFormula stops spreadsheets from evaluating user-controlled values such as user agents
+func escapeCSVFormula(field string) string {
+	if field != "" && strings.ContainsRune("=+-@\t\r", rune(field[0])) {
+		return "'" + field
+	}
+	return field
+}
+
+type jsonExportWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (j *jsonExportWriter) begin(header []string) error {
+	_, err := io.WriteString(j.w, "[")
+	return err
+}
+
+func (j *jsonExportWriter) write(record interface{}, fields []string) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	separator := "\n"
+	if j.count > 0 {
+		separator = ",\n"
+	}
+	j.count++
+	if _, err := io.WriteString(j.w, separator); err != nil {
+		return err
+	}
+	_, err = j.w.Write(data)
+	return err
+}
+
+func (j *jsonExportWriter) end() error {
+	_, err := io.WriteString(j.w, "\n]\n")
+	return err
+}
+
+// PurgeAuditLogs deletes audit logs created before the cutoff and returns how many were removed
+func (s *AuditService) PurgeAuditLogs(ctx context.Context, before time.Time) (int64, error) {
+	result := s.db.WithContext(ctx).Where("created_at < ?", before).Delete(&models.AuditLog{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to purge audit logs: %w", result.Error)
+	}
+
+	return result.RowsAffected, nil
+}
+
+// PurgeSecurityEvents deletes security events recorded before the cutoff and returns how many were
+// removed
+func (s *AuditService) PurgeSecurityEvents(ctx context.Context, before time.Time) (int64, error) {
+	result := s.db.WithContext(ctx).Where("created_at < ?", before).Delete(&models.SecurityEvent{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to purge security events: %w", result.Error)
+	}
+
+	return result.RowsAffected, nil
+}
+
+// ResourceHistory returns the change log of one resource, newest first. The resource is the
+// table name, such as domains or dns_records; limit is capped at maxHistoryEntries.
+func (s *AuditService) ResourceHistory(ctx context.Context, resource, resourceID string, limit int) ([]*models.ChangeLog, error) {
+	if limit <= 0 || limit > maxHistoryEntries {
+		limit = maxHistoryEntries
+	}
+
+	var entries []*models.ChangeLog
+	if err := s.db.WithContext(ctx).
+		Where("resource = ? AND resource_id = ?", resource, resourceID).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&entries).Error; err != nil {
+		return nil, fmt.Errorf("failed to get change history: %w", err)
+	}
+
+	return entries, nil
+}
+
+// PurgeChangeLogs deletes change log entries created before the cutoff and returns how many were removed
+func (s *AuditService) PurgeChangeLogs(ctx context.Context, before time.Time) (int64, error) {
+	result := s.db.WithContext(ctx).Where("created_at < ?", before).Delete(&models.ChangeLog{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to purge change logs: %w", result.Error)
+	}
+
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestAuditQueryScope(t *testing.T) {
+	db := newTestDB(t)
+	audit := NewAuditService(db, nil, zap.NewNop())
+	owner := createTestUser(t, db)
+	other := createTestUser(t, db)
+	admin := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "mine.example")
+	otherDomain := createTestDomain(t, db, other, "theirs.example")
+	redirect := &models.Redirect{DomainID: domain.ID, SourcePath: "/old", TargetURL: "https://mine.example/new", StatusCode: 301}
+	mustCreate(t, db, redirect)
+
+	entry := func(action string, actor *models.User, resource string, resourceID uuid.UUID) {
+		id := resourceID.String()
+		mustCreate(t, db, &models.AuditLog{UserID: &actor.ID, Action: action, Resource: resource, ResourceID: &id, Success: true})
+	}
+	entry("own_key", owner, "ssh_key", uuid.New())
+	entry("admin_domain", admin, "domain", domain.ID)
+	entry("admin_redirect", admin, "redirect", redirect.ID)
+	entry("admin_user", admin, "user", owner.ID)
+	entry("other_domain", other, "domain", otherDomain.ID)
+	entry("other_self", other, "user", other.ID)
+	entry("admin_other_domain", admin, "domain", otherDomain.ID)
+	mustCreate(t, db, &models.SecurityEvent{UserID: &owner.ID, Type: "login_failed", Severity: "low", Source: "web"})
+	mustCreate(t, db, &models.SecurityEvent{UserID: &other.ID, Type: "login_failed", Severity: "low", Source: "web"})
+
+	actions := func(ctx context.Context, filter AuditFilter) string {
+		t.Helper()
+		items, _, err := audit.Query(ctx, filter, "", 100)
+		if err != nil {
+			t.Fatalf("Query() error = %v", err)
+		}
+		var got []string
+		switch items := items.(type) {
+		case []*models.AuditLog:
+			for _, item := range items {
+				got = append(got, item.Action)
+			}
+		case []*models.SecurityEvent:
+			for _, item := range items {
+				got = append(got, item.UserID.String())
+			}
+		}
+		sort.Strings(got)
+		return strings.Join(got, ",")
+	}
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		filter AuditFilter
+		want   string
+	}{
+		{"owner", asUser(owner.ID, "user"), AuditFilter{}, "admin_domain,admin_redirect,admin_user,own_key"},
+		{"other user", asUser(other.ID, "user"), AuditFilter{}, "admin_other_domain,other_domain,other_self"},
+		{"owner filtering by themselves", asUser(owner.ID, "user"), AuditFilter{UserID: &owner.ID}, "own_key"},
+		{"owner filtering by resource", asUser(owner.ID, "user"), AuditFilter{Resource: "domain"}, "admin_domain"},
+		{"admin", asUser(admin.ID, "admin"), AuditFilter{}, "admin_domain,admin_other_domain,admin_redirect,admin_user,other_domain,other_self,own_key"},
+		{"admin filtering by a user", asUser(admin.ID, "admin"), AuditFilter{UserID: &other.ID}, "other_domain,other_self"},
+		{"owner's security events", asUser(owner.ID, "user"), AuditFilter{Kind: AuditKindSecurity}, owner.ID.String()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := actions(tt.ctx, tt.filter); got != tt.want {
+				t.Errorf("visible entries = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	// Other users' entries cannot be asked for, and an anonymous caller gets nothing
+	if _, _, err := audit.Query(asUser(owner.ID, "user"), AuditFilter{UserID: &other.ID}, "", 10); !apperrors.IsPermissionDenied(err) {
+		t.Errorf("owner filtering by another user: error = %v", err)
+	}
+	if _, _, err := audit.Query(context.Background(), AuditFilter{}, "", 10); !apperrors.IsPermissionDenied(err) {
+		t.Errorf("anonymous query: error = %v", err)
+	}
+
+	// Exports are scoped the same way
+	var out bytes.Buffer
+	err := audit.Export(asUser(other.ID, "user"), &out, AuditFilter{From: time.Now().Add(-time.Hour)}, ExportFormatCSV)
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "other_domain") || strings.Contains(out.String(), "own_key") || strings.Contains(out.String(), "admin_domain") {
+		t.Errorf("export of the other user:\n%s", out.String())
+	}
+	if err := audit.Export(asUser(owner.ID, "user"), &out, AuditFilter{UserID: &other.ID, From: time.Now().Add(-time.Hour)}, ExportFormatCSV); !apperrors.IsPermissionDenied(err) {
+		t.Errorf("export of another user's entries: error = %v", err)
+	}
+}
@@ -1,36 +1,608 @@
 package services
 
 import (
+	"archive/tar"
+	"compress/gzip"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/lock"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/tracing"
+)
+
+// Backup types
+const (
+	BackupTypeFull     = "full"
+	BackupTypeFiles    = "files"
+	BackupTypeDatabase = "database"
 )
 
+// backupFilesPrefix is the directory of a backup archive the domain's files are stored under
+const backupFilesPrefix = "files/"
+
+// BackupManifest is stored as the backup metadata and records what a backup contains
+type BackupManifest struct {
+	Files     *BackupFiles     `json:"files,omitempty"`
+	Databases []BackupDatabase `json:"databases"`
+}
+
+// BackupFiles describes the domain's files included in a backup
+type BackupFiles struct {
+	Count     int   `json:"count"`
+	SizeBytes int64 `json:"size_bytes"`
+}
+
+// BackupDatabase describes a database dump included in a backup
+type BackupDatabase struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	Type      string    `json:"type"`
+	File      string    `json:"file"`
+	SizeBytes int64     `json:"size_bytes"`
+}
+
+// BackupRestoreResult reports what a restore did with each database in the backup
+type BackupRestoreResult struct {
+	Files     int      `json:"files,omitempty"` // Files written back into the domain's directory
+	Restored  []string `json:"restored"`
+	Recreated []string `json:"recreated,omitempty"` // Databases deleted since the backup, created again before import
+}
+
 // BackupService handles backup operations
 type BackupService struct {
-	db     *gorm.DB
-	redis  *redis.Client
-	logger *zap.Logger
+	db        *gorm.DB
+	redis     *redis.Client
+	logger    *zap.Logger
+	config    config.HostingConfig
+	databases *DatabaseService
+	locks     *lock.Locker
+	webRoot   string // Directory holding the domains' directories
 }
 
 // NewBackupService creates a new backup service
-func NewBackupService(db *gorm.DB, redis *redis.Client, logger *zap.Logger) *BackupService {
+func NewBackupService(db *gorm.DB, redis *redis.Client, logger *zap.Logger, config config.HostingConfig, databases *DatabaseService, locks *lock.Locker) *BackupService {
 	return &BackupService{
-		db:     db,
-		redis:  redis,
-		logger: logger,
+		db:        db,
+		redis:     redis,
+		logger:    logger,
+		config:    config,
+		databases: databases,
+		locks:     locks,
+		webRoot:   webRoot,
+	}
+}
+
+// CreateBackup creates a backup of a domain. Files backups archive the domain's directory,
+// database backups dump every database of the domain, and full backups hold both in one bundle.
+// A backup that cannot be completed is marked failed.
+func (s *BackupService) CreateBackup(ctx context.Context, userID, domainID uuid.UUID, backupType, name string) (_ *models.Backup, err error) {
+	ctx, span := tracing.Start(ctx, "BackupService.CreateBackup", attribute.String("domain.id", domainID.String()))
+	defer tracing.End(span, &err)
+
+	switch backupType {
+	case BackupTypeFull, BackupTypeFiles, BackupTypeDatabase:
+	default:
+		return nil, apperrors.InvalidCode("type", "field.enum", map[string]string{"values": strings.Join([]string{BackupTypeFull, BackupTypeFiles, BackupTypeDatabase}, ", ")})
+	}
+
+	held, err := lockDomain(ctx, s.locks, domainID)
+	if err != nil {
+		return nil, err
+	}
+	defer held.Release()
+
+	var domain models.Domain
+	if err := s.db.WithContext(ctx).Where("id = ?", domainID).First(&domain).Error; err != nil {
+		return nil, apperrors.FromDB(err, "domain")
+	}
+
+	var databases []*models.Database
+	if backupType != BackupTypeFiles {
+		if databases, err = s.databases.GetDatabases(ctx, domainID); err != nil {
+			return nil, err
+		}
+		if backupType == BackupTypeDatabase && len(databases) == 0 {
+			return nil, apperrors.PreconditionCode("backup_no_databases", nil)
+		}
+	}
+
+	now := time.Now()
+	backup := &models.Backup{
+		ID:        uuid.New(),
+		UserID:    userID,
+		DomainID:  &domainID,
+		Type:      backupType,
+		Name:      name,
+		Status:    "running",
+		StartedAt: &now,
+	}
+	backup.FilePath = filepath.Join(s.config.BackupDir, backup.ID.String()+".tar.gz")
+
+	if err := s.db.WithContext(ctx).Create(backup).Error; err != nil {
+		return nil, fmt.Errorf("failed to create backup: %w", err)
+	}
+
+	manifest, err := s.writeBundle(ctx, backup, &domain, databases)
+	if err != nil {
+		return nil, s.failBackup(ctx, backup, err)
+	}
+
+	metadata, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, s.failBackup(ctx, backup, fmt.Errorf("failed to encode backup metadata: %w", err))
+	}
+
+	var sizeMB int64
+	if info, err := os.Stat(backup.FilePath); err == nil {
+		sizeMB = info.Size() / (1024 * 1024)
+	}
+
+	completedAt := time.Now()
+	if err := s.db.WithContext(ctx).Model(backup).Updates(map[string]interface{}{
+		"status":       "completed",
+		"progress":     100,
+		"metadata":     string(metadata),
+		"size_mb":      sizeMB,
+		"completed_at": completedAt,
+	}).Error; err != nil {
+		return nil, s.failBackup(ctx, backup, fmt.Errorf("failed to update backup: %w", err))
+	}
+	backup.Status = "completed"
+
+	s.logger.Info("Backup created",
+		zap.String("backup_id", backup.ID.String()),
+		zap.String("type", backupType),
+		zap.Bool("files", manifest.Files != nil),
+		zap.Int("databases", len(manifest.Databases)))
+
+	return backup, nil
+}
+
+// failBackup removes the archive of a backup that could not be completed, marks it failed and
+// returns cause. The backup is marked even when ctx was cancelled.
+func (s *BackupService) failBackup(ctx context.Context, backup *models.Backup, cause error) error {
+	if err := os.Remove(backup.FilePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		s.logger.Warn("Failed to remove incomplete backup archive", zap.String("path", backup.FilePath), zap.Error(err))
+	}
+	if err := s.db.WithContext(context.WithoutCancel(ctx)).Model(backup).Update("status", "failed").Error; err != nil {
+		s.logger.Error("Failed to mark backup failed", zap.String("backup_id", backup.ID.String()), zap.Error(err))
+	}
+	backup.Status = "failed"
+
+	return cause
+}
+
+// RestoreBackup restores a backup. Databases deleted since the backup was taken are created again.
+func (s *BackupService) RestoreBackup(ctx context.Context, backupID uuid.UUID) (_ *BackupRestoreResult, err error) {
+	ctx, span := tracing.Start(ctx, "BackupService.RestoreBackup", attribute.String("backup.id", backupID.String()))
+	defer tracing.End(span, &err)
+
+	var backup models.Backup
+	if err := s.db.WithContext(ctx).Where("id = ?", backupID).First(&backup).Error; err != nil {
+		return nil, apperrors.FromDB(err, "backup")
+	}
+
+	if backup.Status != "completed" || backup.DomainID == nil {
+		return nil, apperrors.PreconditionCode("backup_not_restorable", nil)
+	}
+
+	held, err := lockDomain(ctx, s.locks, *backup.DomainID)
+	if err != nil {
+		return nil, err
+	}
+	defer held.Release()
+
+	var manifest BackupManifest
+	if err := json.Unmarshal([]byte(backup.Metadata), &manifest); err != nil {
+		return nil, fmt.Errorf("failed to read backup metadata: %w", err)
+	}
+
+	var domain models.Domain
+	if err := s.db.WithContext(ctx).Where("id = ?", *backup.DomainID).First(&domain).Error; err != nil {
+		return nil, apperrors.FromDB(err, "domain")
+	}
+	root := s.domainDir(&domain)
+
+	entries := make(map[string]BackupDatabase, len(manifest.Databases))
+	for _, entry := range manifest.Databases {
+		entries[entry.File] = entry
+	}
+
+	file, err := os.Open(backup.FilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup: %w", err)
+	}
+	defer gz.Close()
+
+	result := &BackupRestoreResult{}
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return result, fmt.Errorf("failed to read backup: %w", err)
+		}
+
+		if manifest.Files != nil && strings.HasPrefix(header.Name, backupFilesPrefix) {
+			restored, err := s.restoreFile(root, header, archive)
+			if err != nil {
+				return result, err
+			}
+			if restored {
+				result.Files++
+			}
+			continue
+		}
+
+		entry, ok := entries[header.Name]
+		if !ok {
+			continue
+		}
+
+		databaseID, recreated, err := s.resolveBackupDatabase(ctx, *backup.DomainID, entry)
+		if err != nil {
+			return result, err
+		}
+		if recreated {
+			result.Recreated = append(result.Recreated, entry.Name)
+		}
+
+		if err := s.databases.ImportDatabase(ctx, databaseID, archive); err != nil {
+			return result, err
+		}
+		result.Restored = append(result.Restored, entry.Name)
+	}
+
+	s.logger.Info("Backup restored",
+		zap.String("backup_id", backup.ID.String()),
+		zap.Int("files", result.Files),
+		zap.Strings("restored", result.Restored),
+		zap.Strings("recreated", result.Recreated))
+
+	return result, nil
+}
+
+// writeBundle writes a gzipped tarball at the backup's file path with the domain's files, unless
+// it is a database backup, and a dump of each database
+func (s *BackupService) writeBundle(ctx context.Context, backup *models.Backup, domain *models.Domain, databases []*models.Database) (*BackupManifest, error) {
+	if err := os.MkdirAll(s.config.BackupDir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	file, err := os.OpenFile(backup.FilePath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backup file: %w", err)
+	}
+	defer file.Close()
+
+	gz := gzip.NewWriter(file)
+	archive := tar.NewWriter(gz)
+
+	includeFiles := backup.Type != BackupTypeDatabase
+	steps := len(databases)
+	if includeFiles {
+		steps++
+	}
+	done := 0
+	progress := func() {
+		done++
+		s.db.WithContext(ctx).Model(backup).Update("progress", done*100/steps)
+	}
+
+	manifest := &BackupManifest{}
+	if includeFiles {
+		files, err := s.addFiles(ctx, archive, s.domainDir(domain))
+		if err != nil {
+			return nil, err
+		}
+		manifest.Files = files
+		progress()
+	}
+	for _, database := range databases {
+		entry, err := s.addDatabaseDump(ctx, archive, database)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Databases = append(manifest.Databases, *entry)
+		progress()
 	}
+
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+
+	return manifest, nil
+}
+
+// addFiles archives the directories and regular files under root. Symbolic links and special
+// files are left out, so neither the backup nor a restore of it reaches outside the domain's
+// directory. A domain without a directory yet has no files to archive.
+func (s *BackupService) addFiles(ctx context.Context, archive *tar.Writer, root string) (*BackupFiles, error) {
+	files := &BackupFiles{}
+	if _, err := os.Lstat(root); errors.Is(err, os.ErrNotExist) {
+		return files, nil
+	}
+
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		if !entry.IsDir() && !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = backupFilesPrefix + filepath.ToSlash(rel)
+		if entry.IsDir() {
+			header.Name += "/"
+			return archive.WriteHeader(header)
+		}
+
+		// Opened without following links, in case the file was replaced by one meanwhile
+		file, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NOFOLLOW, 0)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(archive, file, header.Size); err != nil {
+			return err
+		}
+		files.Count++
+		files.SizeBytes += header.Size
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to back up files: %w", err)
+	}
+
+	return files, nil
 }
 
-// Placeholder methods - to be implemented
-func (s *BackupService) CreateBackup(ctx context.Context) (interface{}, error) {
-	// TODO: Implement backup creation
-	return nil, nil
+// addDatabaseDump exports a database to a temporary file, then copies it into the archive.
+// Tar headers need the size up front, so the dump cannot be streamed in directly.
+func (s *BackupService) addDatabaseDump(ctx context.Context, archive *tar.Writer, database *models.Database) (*BackupDatabase, error) {
+	dump, err := os.CreateTemp(s.config.BackupDir, ".dump-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dump file: %w", err)
+	}
+	defer os.Remove(dump.Name())
+	defer dump.Close()
+
+	if err := s.databases.ExportDatabase(ctx, database.ID, dump); err != nil {
+		return nil, err
+	}
+
+	size, err := dump.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dump file: %w", err)
+	}
+	if _, err := dump.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to read dump file: %w", err)
+	}
+
+	entry := &BackupDatabase{
+		ID:        database.ID,
+		Name:      database.Name,
+		Type:      database.Type,
+		File:      fmt.Sprintf("databases/%s.sql", database.Name),
+		SizeBytes: size,
+	}
+
+	if err := archive.WriteHeader(&tar.Header{
+		Name:    entry.File,
+		Mode:    0600,
+		Size:    size,
+		ModTime: time.Now(),
+	}); err != nil {
+		return nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+	if _, err := io.Copy(archive, dump); err != nil {
+		return nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+
+	return entry, nil
+}
+
+// restoreFile writes a directory or regular file of a backup into root, owned by the web files'
+// owner, and reports whether a file was written. Existing files are replaced; other entries are
+// skipped. Symbolic links on the way are refused, so an entry cannot be written outside root.
+func (s *BackupService) restoreFile(root string, header *tar.Header, content io.Reader) (bool, error) {
+	target, err := resolveWithin(root, filepath.FromSlash(strings.TrimPrefix(header.Name, backupFilesPrefix)))
+	if err != nil || target == root {
+		return false, fmt.Errorf("invalid backup entry %s", header.Name)
+	}
+
+	switch header.Typeflag {
+	case tar.TypeDir:
+		return false, s.mkdirWithin(root, target)
+	case tar.TypeReg:
+	default:
+		return false, nil
+	}
+
+	if err := s.mkdirWithin(root, filepath.Dir(target)); err != nil {
+		return false, err
+	}
+	// A link in place of the file is replaced rather than written through
+	if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		if err := os.Remove(target); err != nil {
+			return false, fmt.Errorf("failed to restore %s: %w", target, err)
+		}
+	}
+
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC|syscall.O_NOFOLLOW, 0644)
+	if err != nil {
+		return false, fmt.Errorf("failed to restore %s: %w", target, err)
+	}
+	defer file.Close()
+
+	if _, err := io.CopyN(file, content, header.Size); err != nil {
+		return false, fmt.Errorf("failed to restore %s: %w", target, err)
+	}
+	if err := file.Chmod(header.FileInfo().Mode().Perm()); err != nil {
+		return false, fmt.Errorf("failed to restore %s: %w", target, err)
+	}
+	if err := file.Chown(s.config.FTPUID, s.config.FTPGID); err != nil {
+		return false, fmt.Errorf("failed to restore %s: %w", target, err)
+	}
+	if err := file.Close(); err != nil {
+		return false, fmt.Errorf("failed to restore %s: %w", target, err)
+	}
+
+	return true, nil
 }
 
-func (s *BackupService) RestoreBackup(ctx context.Context) error {
-	// TODO: Implement backup restoration
+// mkdirWithin creates dir and its missing parents up from root, owned by the web files' owner. It
+// fails when one of them is a symbolic link or not a directory.
+func (s *BackupService) mkdirWithin(root, dir string) error {
+	if err := mkdirOwned(root, s.config.FTPUID, s.config.FTPGID); err != nil {
+		return fmt.Errorf("failed to create %s: %w", root, err)
+	}
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == "." {
+		return err
+	}
+
+	current := root
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			if err := os.Mkdir(current, 0755); err != nil {
+				return fmt.Errorf("failed to create %s: %w", current, err)
+			}
+			if err := os.Chown(current, s.config.FTPUID, s.config.FTPGID); err != nil {
+				return fmt.Errorf("failed to create %s: %w", current, err)
+			}
+		case err != nil:
+			return fmt.Errorf("failed to restore into %s: %w", current, err)
+		case !info.IsDir():
+			return fmt.Errorf("cannot restore into %s: not a directory", current)
+		}
+	}
+
 	return nil
 }
+
+// domainDir returns the directory holding a domain's document roots and logs
+func (s *BackupService) domainDir(domain *models.Domain) string {
+	return filepath.Join(s.webRoot, domain.Name)
+}
+
+// resolveBackupDatabase finds the database a dump should be restored into, matching by ID and then by name,
+// and creates it again if it no longer exists
+func (s *BackupService) resolveBackupDatabase(ctx context.Context, domainID uuid.UUID, entry BackupDatabase) (uuid.UUID, bool, error) {
+	var database models.Database
+	err := s.db.WithContext(ctx).
+		Where("domain_id = ? AND (id = ? OR name = ?)", domainID, entry.ID, entry.Name).
+		First(&database).Error
+	if err == nil {
+		return database.ID, false, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return uuid.Nil, false, fmt.Errorf("failed to look up database %s: %w", entry.Name, err)
+	}
+
+	created, err := s.databases.CreateDatabase(ctx, domainID, entry.Name, entry.Type)
+	if err != nil {
+		return uuid.Nil, false, fmt.Errorf("failed to recreate database %s: %w", entry.Name, err)
+	}
+
+	return created.ID, true, nil
+}
+
+// PurgeExpiredBackups deletes backups past their expiry together with their archives and returns
+// how many were removed
+func (s *BackupService) PurgeExpiredBackups(ctx context.Context) (int, error) {
+	var backups []*models.Backup
+	if err := s.db.WithContext(ctx).Where("expires_at < ?", time.Now()).Find(&backups).Error; err != nil {
+		return 0, fmt.Errorf("failed to get expired backups: %w", err)
+	}
+
+	return s.deleteBackups(ctx, backups)
+}
+
+// PurgeBackups deletes backups taken before the cutoff together with their archives, whether or
+// not they have expired, and returns how many were removed. Backups still running are left alone.
+func (s *BackupService) PurgeBackups(ctx context.Context, before time.Time) (int, error) {
+	var backups []*models.Backup
+	if err := s.db.WithContext(ctx).
+		Where("created_at < ? AND status NOT IN ?", before, []string{"pending", "running"}).
+		Find(&backups).Error; err != nil {
+		return 0, fmt.Errorf("failed to get old backups: %w", err)
+	}
+
+	return s.deleteBackups(ctx, backups)
+}
+
+// deleteBackups deletes backups and their archives. A backup whose archive cannot be removed is
+// kept, so it is retried on the next run rather than orphaning the file.
+func (s *BackupService) deleteBackups(ctx context.Context, backups []*models.Backup) (int, error) {
+	purged := 0
+	for _, backup := range backups {
+		if backup.FilePath != "" {
+			if err := os.Remove(backup.FilePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+				s.logger.Error("Failed to remove backup archive", zap.String("path", backup.FilePath), zap.Error(err))
+				continue
+			}
+		}
+
+		if err := s.db.WithContext(ctx).Delete(backup).Error; err != nil {
+			return purged, fmt.Errorf("failed to delete backup: %w", err)
+		}
+		purged++
+	}
+
+	return purged, nil
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// newTestBackupService creates a backup service whose domains' directories are in a temporary
+// directory, returned with it
+func newTestBackupService(t *testing.T) (*BackupService, string) {
+	t.Helper()
+
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	cfg.FTPUID = os.Getuid()
+	cfg.FTPGID = os.Getgid()
+	databases := NewDatabaseService(db, nil, zap.NewNop(), cfg, nil, nil)
+	s := NewBackupService(db, nil, zap.NewNop(), cfg, databases, nil)
+	s.webRoot = t.TempDir()
+	return s, s.webRoot
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0640); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFilesBackupRoundTrip(t *testing.T) {
+	for _, backupType := range []string{BackupTypeFiles, BackupTypeFull} {
+		t.Run(backupType, func(t *testing.T) {
+			s, root := newTestBackupService(t)
+			owner := createTestUser(t, s.db)
+			domain := createTestDomain(t, s.db, owner, "files.example")
+			dir := filepath.Join(root, domain.Name)
+			writeTestFile(t, filepath.Join(dir, "public_html", "index.php"), "<?php echo 1;")
+			writeTestFile(t, filepath.Join(dir, "subdomains", "blog", "index.html"), "blog")
+			if err := os.Symlink("/etc/passwd", filepath.Join(dir, "public_html", "passwd")); err != nil {
+				t.Fatal(err)
+			}
+
+			backup, err := s.CreateBackup(asUser(owner.ID), owner.ID, domain.ID, backupType, "nightly")
+			if err != nil {
+				t.Fatalf("CreateBackup: %v", err)
+			}
+			var stored models.Backup
+			s.db.Where("id = ?", backup.ID).First(&stored)
+			if stored.Status != "completed" || stored.Progress != 100 {
+				t.Fatalf("backup status %q progress %d, want completed at 100", stored.Status, stored.Progress)
+			}
+
+			// The site is changed and partly deleted after the backup
+			writeTestFile(t, filepath.Join(dir, "public_html", "index.php"), "defaced")
+			os.RemoveAll(filepath.Join(dir, "subdomains"))
+
+			result, err := s.RestoreBackup(asUser(owner.ID), backup.ID)
+			if err != nil {
+				t.Fatalf("RestoreBackup: %v", err)
+			}
+			if result.Files != 2 {
+				t.Errorf("restored %d files, want 2", result.Files)
+			}
+			for path, want := range map[string]string{
+				"public_html/index.php":      "<?php echo 1;",
+				"subdomains/blog/index.html": "blog",
+			} {
+				got, err := os.ReadFile(filepath.Join(dir, path))
+				if err != nil || string(got) != want {
+					t.Errorf("%s = %q (%v), want %q", path, got, err, want)
+				}
+			}
+			if info, err := os.Stat(filepath.Join(dir, "public_html", "index.php")); err != nil || info.Mode().Perm() != 0640 {
+				t.Errorf("restored file mode = %v (%v), want 0640", info.Mode().Perm(), err)
+			}
+		})
+	}
+}
+
+func TestRestoreRefusesSymlinkedDirectories(t *testing.T) {
+	s, root := newTestBackupService(t)
+	owner := createTestUser(t, s.db)
+	domain := createTestDomain(t, s.db, owner, "links.example")
+	dir := filepath.Join(root, domain.Name)
+	writeTestFile(t, filepath.Join(dir, "public_html", "index.html"), "site")
+
+	backup, err := s.CreateBackup(asUser(owner.ID), owner.ID, domain.ID, BackupTypeFiles, "before")
+	if err != nil {
+		t.Fatalf("CreateBackup: %v", err)
+	}
+
+	// The owner swaps the document root for a link to a directory outside theirs
+	outside := t.TempDir()
+	os.RemoveAll(filepath.Join(dir, "public_html"))
+	if err := os.Symlink(outside, filepath.Join(dir, "public_html")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.RestoreBackup(asUser(owner.ID), backup.ID); err == nil {
+		t.Error("restore through a symbolic link succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "index.html")); err == nil {
+		t.Error("restore wrote outside the domain's directory")
+	}
+}
+
+func TestCreateBackupMarksFailures(t *testing.T) {
+	s, _ := newTestBackupService(t)
+	owner := createTestUser(t, s.db)
+	domain := createTestDomain(t, s.db, owner, "failing.example")
+
+	// The backup directory cannot be created where a file is in the way
+	blocker := filepath.Join(t.TempDir(), "backups")
+	writeTestFile(t, blocker, "")
+	s.config.BackupDir = filepath.Join(blocker, "nested")
+
+	if _, err := s.CreateBackup(asUser(owner.ID), owner.ID, domain.ID, BackupTypeFiles, "broken"); err == nil {
+		t.Fatal("CreateBackup succeeded without a backup directory")
+	}
+
+	var backups []models.Backup
+	s.db.Where("domain_id = ?", domain.ID).Find(&backups)
+	if len(backups) != 1 || backups[0].Status != "failed" {
+		t.Errorf("backups = %+v, want one failed backup", backups)
+	}
+}
+
+func TestCreateBackupTypes(t *testing.T) {
+	s, _ := newTestBackupService(t)
+	owner := createTestUser(t, s.db)
+	domain := createTestDomain(t, s.db, owner, "types.example")
+
+	if _, err := s.CreateBackup(asUser(owner.ID), owner.ID, domain.ID, "snapshot", "x"); fieldMessage(err, "type") == "" {
+		t.Errorf("unknown backup type: error = %v, want a validation error on type", err)
+	}
+	if _, err := s.CreateBackup(asUser(owner.ID), owner.ID, domain.ID, BackupTypeDatabase, "x"); errorCode(err) != "backup_no_databases" {
+		t.Errorf("database backup of a domain without databases: error = %v, want backup_no_databases", err)
+	}
+	if _, err := s.CreateBackup(asUser(owner.ID), owner.ID, domain.ID, BackupTypeFull, "x"); err != nil {
+		t.Errorf("full backup of a domain without databases or files: %v", err)
+	}
+}
+
+func TestRestoreBackupRefusesFailedBackups(t *testing.T) {
+	s, _ := newTestBackupService(t)
+	owner := createTestUser(t, s.db)
+	domain := createTestDomain(t, s.db, owner, "unrestorable.example")
+	backup := &models.Backup{UserID: owner.ID, DomainID: &domain.ID, Name: "broken", Type: BackupTypeFiles, Status: "failed"}
+	mustCreate(t, s.db, backup)
+
+	_, err := s.RestoreBackup(asUser(owner.ID), backup.ID)
+	if errorCode(err) != "backup_not_restorable" || apperrors.HTTPStatus(err) != http.StatusConflict {
+		t.Fatalf("RestoreBackup() error = %v, want backup_not_restorable", err)
+	}
+}
@@ -0,0 +1,410 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// MaxBatchOperations bounds the operations a single batch may run
+const MaxBatchOperations = 100
+
+// Operations a batch can run. The operation's ID names the domain for dns.create,
+// redirect.create and domain.force_https, and the record or redirect otherwise.
+const (
+	BatchDNSCreate      = "dns.create"
+	BatchDNSUpdate      = "dns.update"
+	BatchDNSDelete      = "dns.delete"
+	BatchRedirectCreate = "redirect.create"
+	BatchRedirectUpdate = "redirect.update"
+	BatchRedirectDelete = "redirect.delete"
+	BatchForceHTTPS     = "domain.force_https"
+)
+
+// Batch operation outcomes
+const (
+	BatchStatusOK         = "ok"
+	BatchStatusFailed     = "failed"
+	BatchStatusRolledBack = "rolled_back" // Succeeded, but undone when a later operation failed
+	BatchStatusSkipped    = "skipped"     // Not run, since an earlier operation failed
+)
+
+// BatchOperation is one step of a batch
+type BatchOperation struct {
+	Op     string          `json:"op"`
+	ID     uuid.UUID       `json:"id"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// BatchOperationResult is the outcome of one step of a batch, with the resource it created or
+// changed. Err is the reason a failed step failed.
+type BatchOperationResult struct {
+	Index  int         `json:"index"`
+	Op     string      `json:"op"`
+	Status string      `json:"status"`
+	Result interface{} `json:"result,omitempty"`
+	Err    error       `json:"-"`
+}
+
+// BatchResult is the outcome of a batch. Committed is false when a failure rolled back every step.
+type BatchResult struct {
+	Committed  bool                   `json:"committed"`
+	Operations []BatchOperationResult `json:"operations"`
+}
+
+// Failed returns the first failed step, or nil
+func (r *BatchResult) Failed() *BatchOperationResult {
+	for i := range r.Operations {
+		if r.Operations[i].Status == BatchStatusFailed {
+			return &r.Operations[i]
+		}
+	}
+	return nil
+}
+
+// batchDNSRecord holds the parameters of dns.create and dns.update; for updates, omitted fields
+// are left unchanged
+type batchDNSRecord struct {
+	Type     *string `json:"type"`
+	Name     *string `json:"name"`
+	Value    *string `json:"value"`
+	TTL      *int    `json:"ttl"`
+	Priority *int    `json:"priority"`
+	IsActive *bool   `json:"is_active"`
+}
+
+// batchForceHTTPS holds the parameters of domain.force_https
+type batchForceHTTPS struct {
+	Enabled bool `json:"enabled"`
+}
+
+// batchStep runs one decoded operation with services bound to the batch's transaction
+type batchStep func(ctx context.Context, domains *DomainService, dns *DNSService) (interface{}, error)
+
+// BatchService runs several DNS, redirect and domain changes as one unit
+type BatchService struct {
+	db     *gorm.DB
+	logger *zap.Logger
+
+	domains *DomainService
+	dns     *DNSService
+}
+
+// NewBatchService creates a new batch service
+func NewBatchService(db *gorm.DB, logger *zap.Logger, domains *DomainService, dns *DNSService) *BatchService {
+	return &BatchService{
+		db:     db,
+		logger: logger,
+
+		domains: domains,
+		dns:     dns,
+	}
+}
+
+// Run executes operations in order in one database transaction, as the caller in ctx, who must
+// own every domain touched. By default the first failure rolls back every step; with
+// continueOnError only the failed step is undone and the rest are committed. Zone files, vhosts
+// and caches are updated once the transaction has committed, so a rolled back batch leaves no
+// trace.
+func (s *BatchService) Run(ctx context.Context, operations []BatchOperation, continueOnError bool) (*BatchResult, error) {
+	switch {
+	case len(operations) == 0:
+		return nil, apperrors.InvalidCode("operations", "batch.empty", nil)
+	case len(operations) > MaxBatchOperations:
+		return nil, apperrors.InvalidCode("operations", "batch.too_many", map[string]string{"max": strconv.Itoa(MaxBatchOperations)})
+	}
+
+	steps, err := planBatch(operations)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &BatchResult{Operations: make([]BatchOperationResult, len(operations))}
+	for i, operation := range operations {
+		result.Operations[i] = BatchOperationResult{Index: i, Op: operation.Op, Status: BatchStatusSkipped}
+	}
+
+	effects := &batchEffects{
+		caches: make(map[uuid.UUID]bool),
+		zones:  make(map[uuid.UUID]bool),
+		vhosts: make(map[uuid.UUID]bool),
+	}
+	batchCtx := context.WithValue(ctx, batchEffectsKey{}, effects)
+
+	errStepFailed := errors.New("batch step failed")
+	err = s.db.WithContext(batchCtx).Transaction(func(tx *gorm.DB) error {
+		for i, step := range steps {
+			outcome := &result.Operations[i]
+			// Each step gets a savepoint, so a failed step can be undone on its own
+			stepErr := tx.Transaction(func(stepTx *gorm.DB) error {
+				value, err := step(batchCtx, s.domains.withDB(stepTx), s.dns.withDB(stepTx))
+				outcome.Result = value
+				return err
+			})
+			if stepErr != nil {
+				outcome.Status = BatchStatusFailed
+				outcome.Result = nil
+				outcome.Err = stepErr
+				if !continueOnError {
+					return errStepFailed
+				}
+				continue
+			}
+			outcome.Status = BatchStatusOK
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStepFailed) {
+		return nil, fmt.Errorf("failed to run batch: %w", err)
+	}
+
+	if err != nil {
+		for i := range result.Operations {
+			if result.Operations[i].Status == BatchStatusOK {
+				result.Operations[i].Status = BatchStatusRolledBack
+				result.Operations[i].Result = nil
+			}
+		}
+		return result, nil
+	}
+
+	result.Committed = true
+	s.applyEffects(ctx, effects)
+
+	s.logger.Info("Batch committed",
+		zap.Int("operations", len(operations)),
+		zap.Bool("continue_on_error", continueOnError))
+
+	return result, nil
+}
+
+// planBatch checks and decodes every operation before anything runs, so a malformed batch is
+// refused as a whole
+func planBatch(operations []BatchOperation) ([]batchStep, error) {
+	steps := make([]batchStep, len(operations))
+	v := apperrors.NewValidation()
+
+	for i, operation := range operations {
+		field := fmt.Sprintf("operations[%d]", i)
+		if operation.ID == uuid.Nil {
+			v.AddCode(field+".id", "field.required", nil)
+		}
+
+		step, err := batchStepFor(operation)
+		if err != nil {
+			if errors.Is(err, errUnknownBatchOp) {
+				v.AddCode(field+".op", "batch.unknown_op", map[string]string{"op": operation.Op})
+			} else {
+				v.AddCode(field+".params", "batch.params", map[string]string{"error": err.Error()})
+			}
+			continue
+		}
+		steps[i] = step
+	}
+
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	return steps, nil
+}
+
+// errUnknownBatchOp is returned by batchStepFor for operations a batch cannot run
+var errUnknownBatchOp = errors.New("unknown batch operation")
+
+// batchStepFor decodes an operation's parameters into the step running it. Ownership is checked
+// when the step runs: redirect methods check it themselves, steps on a domain load it through
+// ownedDomain and DNS records are read through GetDNSRecord first.
+func batchStepFor(operation BatchOperation) (batchStep, error) {
+	id := operation.ID
+
+	switch operation.Op {
+	case BatchDNSCreate:
+		var params batchDNSRecord
+		if err := decodeBatchParams(operation.Params, &params); err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, domains *DomainService, dns *DNSService) (interface{}, error) {
+			if _, err := domains.ownedDomain(ctx, id); err != nil {
+				return nil, err
+			}
+			record := params.record()
+			return dns.CreateDNSRecord(ctx, id, record.Type, record.Name, record.Value, record.TTL, record.Priority)
+		}, nil
+
+	case BatchDNSUpdate:
+		var params batchDNSRecord
+		if err := decodeBatchParams(operation.Params, &params); err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, domains *DomainService, dns *DNSService) (interface{}, error) {
+			if _, err := dns.GetDNSRecord(ctx, id); err != nil {
+				return nil, err
+			}
+			updates := params.updates()
+			if len(updates) == 0 {
+				return dns.GetDNSRecord(ctx, id)
+			}
+			return dns.UpdateDNSRecord(ctx, id, updates)
+		}, nil
+
+	case BatchDNSDelete:
+		return func(ctx context.Context, domains *DomainService, dns *DNSService) (interface{}, error) {
+			if _, err := dns.GetDNSRecord(ctx, id); err != nil {
+				return nil, err
+			}
+			return nil, dns.DeleteDNSRecord(ctx, id)
+		}, nil
+
+	case BatchRedirectCreate, BatchRedirectUpdate:
+		var params RedirectRequest
+		if err := decodeBatchParams(operation.Params, &params); err != nil {
+			return nil, err
+		}
+		if operation.Op == BatchRedirectCreate {
+			return func(ctx context.Context, domains *DomainService, dns *DNSService) (interface{}, error) {
+				return domains.CreateRedirect(ctx, id, params)
+			}, nil
+		}
+		return func(ctx context.Context, domains *DomainService, dns *DNSService) (interface{}, error) {
+			return domains.UpdateRedirect(ctx, id, params)
+		}, nil
+
+	case BatchRedirectDelete:
+		return func(ctx context.Context, domains *DomainService, dns *DNSService) (interface{}, error) {
+			return nil, domains.DeleteRedirect(ctx, id)
+		}, nil
+
+	case BatchForceHTTPS:
+		var params batchForceHTTPS
+		if err := decodeBatchParams(operation.Params, &params); err != nil {
+			return nil, err
+		}
+		return func(ctx context.Context, domains *DomainService, dns *DNSService) (interface{}, error) {
+			if _, err := domains.ownedDomain(ctx, id); err != nil {
+				return nil, err
+			}
+			return domains.SetForceHTTPS(ctx, id, params.Enabled)
+		}, nil
+	}
+
+	return nil, errUnknownBatchOp
+}
+
+// decodeBatchParams decodes an operation's parameters, rejecting fields the operation does not
+// take. Missing parameters decode as an empty object.
+func decodeBatchParams(raw json.RawMessage, v interface{}) error {
+	if len(bytes.TrimSpace(raw)) == 0 || bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+		raw = json.RawMessage("{}")
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// record returns the record dns.create asks for; omitted fields are left empty for
+// validateDNSRecord to report
+func (p batchDNSRecord) record() *models.DNSRecord {
+	record := &models.DNSRecord{Priority: p.Priority}
+	if p.Type != nil {
+		record.Type = *p.Type
+	}
+	if p.Name != nil {
+		record.Name = *p.Name
+	}
+	if p.Value != nil {
+		record.Value = *p.Value
+	}
+	if p.TTL != nil {
+		record.TTL = *p.TTL
+	}
+	return record
+}
+
+// updates returns the columns dns.update changes
+func (p batchDNSRecord) updates() map[string]interface{} {
+	updates := map[string]interface{}{}
+	if p.Type != nil {
+		updates["type"] = *p.Type
+	}
+	if p.Name != nil {
+		updates["name"] = *p.Name
+	}
+	if p.Value != nil {
+		updates["value"] = *p.Value
+	}
+	if p.TTL != nil {
+		updates["ttl"] = *p.TTL
+	}
+	if p.Priority != nil {
+		updates["priority"] = *p.Priority
+	}
+	if p.IsActive != nil {
+		updates["is_active"] = *p.IsActive
+	}
+	return updates
+}
+
+// batchEffectsKey is the context key under which a batch collects the side effects of its steps
+type batchEffectsKey struct{}
+
+// batchEffects are the domains whose cache, zone file or vhost a batch updates after committing.
+// Effects of steps that failed are kept: they only re-render from the committed state.
+type batchEffects struct {
+	caches map[uuid.UUID]bool
+	zones  map[uuid.UUID]bool
+	vhosts map[uuid.UUID]bool
+}
+
+// deferredEffects returns the effects collected for the batch running in ctx, or nil outside a
+// batch
+func deferredEffects(ctx context.Context) *batchEffects {
+	effects, _ := ctx.Value(batchEffectsKey{}).(*batchEffects)
+	return effects
+}
+
+// applyEffects invalidates caches, syncs zones and writes vhosts for the domains a committed
+// batch changed
+func (s *BatchService) applyEffects(ctx context.Context, effects *batchEffects) {
+	for domainID := range effects.caches {
+		if !effects.zones[domainID] {
+			s.domains.invalidateDomain(ctx, domainID)
+		}
+	}
+	for domainID := range effects.zones {
+		s.dns.zoneChanged(ctx, domainID)
+	}
+	for domainID := range effects.vhosts {
+		var domain models.Domain
+		if err := s.db.WithContext(ctx).Where("id = ?", domainID).First(&domain).Error; err != nil {
+			s.logger.Error("Failed to load domain for vhost write", zap.String("domain_id", domainID.String()), zap.Error(err))
+			continue
+		}
+		s.domains.writeVhost(ctx, &domain)
+	}
+}
+
+// withDB returns a copy of the service using db, such as a transaction
+func (s *DomainService) withDB(db *gorm.DB) *DomainService {
+	copied := *s
+	copied.db = db
+	return &copied
+}
+
+// withDB returns a copy of the service using db, such as a transaction. Domains are looked up
+// through db as well.
+func (s *DNSService) withDB(db *gorm.DB) *DNSService {
+	copied := *s
+	copied.db = db
+	copied.domains = s.domains.withDB(db)
+	return &copied
+}
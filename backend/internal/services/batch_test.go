@@ -0,0 +1,216 @@
+package services
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestPlanBatch(t *testing.T) {
+	id := uuid.New()
+	tests := []struct {
+		name      string
+		operation BatchOperation
+		field     string // Field of the validation error, or "" when the operation is fine
+	}{
+		{"DNS create", BatchOperation{Op: BatchDNSCreate, ID: id, Params: json.RawMessage(`{"type":"A","name":"www","value":"192.0.2.1"}`)}, ""},
+		{"delete without params", BatchOperation{Op: BatchDNSDelete, ID: id}, ""},
+		{"null params", BatchOperation{Op: BatchForceHTTPS, ID: id, Params: json.RawMessage(`null`)}, ""},
+		{"unknown operation", BatchOperation{Op: "domain.delete", ID: id}, "operations[0].op"},
+		{"missing ID", BatchOperation{Op: BatchDNSDelete}, "operations[0].id"},
+		{"unknown parameter", BatchOperation{Op: BatchDNSUpdate, ID: id, Params: json.RawMessage(`{"ttl":60,"owner":"me"}`)}, "operations[0].params"},
+		{"malformed parameters", BatchOperation{Op: BatchRedirectCreate, ID: id, Params: json.RawMessage(`{"status_code":"301"}`)}, "operations[0].params"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			steps, err := planBatch([]BatchOperation{tt.operation})
+			if tt.field == "" {
+				if err != nil || len(steps) != 1 || steps[0] == nil {
+					t.Errorf("planBatch() = %v, %v", steps, err)
+				}
+				return
+			}
+			if fieldMessage(err, tt.field) == "" {
+				t.Errorf("planBatch() error = %v, want one on %s", err, tt.field)
+			}
+		})
+	}
+}
+
+func TestBatchUpdates(t *testing.T) {
+	ttl, active := 300, false
+	updates := batchDNSRecord{TTL: &ttl, IsActive: &active}.updates()
+	if len(updates) != 2 || updates["ttl"] != 300 || updates["is_active"] != false {
+		t.Errorf("updates() = %v", updates)
+	}
+	if updates := (batchDNSRecord{}).updates(); len(updates) != 0 {
+		t.Errorf("updates() of no fields = %v", updates)
+	}
+}
+
+// batchFixture is a domain with one record, and a batch service over it
+type batchFixture struct {
+	batch  *BatchService
+	domain *models.Domain
+	record *models.DNSRecord
+	owner  *models.User
+	zone   string
+}
+
+func newBatchFixture(t *testing.T) *batchFixture {
+	t.Helper()
+
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	dns, domains := newTestDNSService(t, db, cfg)
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "batch.example")
+	record := &models.DNSRecord{DomainID: domain.ID, Type: "A", Name: "www", Value: "192.0.2.1", TTL: 3600, IsActive: true}
+	mustCreate(t, db, record)
+
+	return &batchFixture{
+		batch:  NewBatchService(db, zap.NewNop(), domains, dns),
+		domain: domain,
+		record: record,
+		owner:  owner,
+		zone:   filepath.Join(cfg.ZoneDir, "batch.example.zone"),
+	}
+}
+
+// operations returns a create, an invalid create and an update of the fixture's record
+func (f *batchFixture) operations() []BatchOperation {
+	return []BatchOperation{
+		{Op: BatchDNSCreate, ID: f.domain.ID, Params: json.RawMessage(`{"type":"A","name":"shop","value":"192.0.2.7","ttl":3600}`)},
+		{Op: BatchDNSCreate, ID: f.domain.ID, Params: json.RawMessage(`{"type":"A","name":"bad","value":"not-an-address","ttl":3600}`)},
+		{Op: BatchDNSUpdate, ID: f.record.ID, Params: json.RawMessage(`{"value":"192.0.2.99"}`)},
+	}
+}
+
+func (f *batchFixture) statuses(result *BatchResult) string {
+	statuses := make([]string, len(result.Operations))
+	for i, outcome := range result.Operations {
+		statuses[i] = outcome.Status
+	}
+	return strings.Join(statuses, ",")
+}
+
+func (f *batchFixture) records(t *testing.T) string {
+	t.Helper()
+
+	var records []models.DNSRecord
+	f.batch.db.Where("domain_id = ?", f.domain.ID).Order("name").Find(&records)
+	values := make([]string, len(records))
+	for i, record := range records {
+		values[i] = record.Name + "=" + record.Value
+	}
+	return strings.Join(values, ",")
+}
+
+func TestBatchRollsBackOnFailure(t *testing.T) {
+	f := newBatchFixture(t)
+
+	result, err := f.batch.Run(asUser(f.owner.ID, "user"), f.operations(), false)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if result.Committed {
+		t.Error("batch with a failed step committed")
+	}
+	if got := f.statuses(result); got != "rolled_back,failed,skipped" {
+		t.Errorf("statuses = %s", got)
+	}
+	if failed := result.Failed(); failed == nil || failed.Index != 1 || fieldMessage(failed.Err, "value") == "" {
+		t.Errorf("failed step = %+v", failed)
+	}
+	if got := f.records(t); got != "www=192.0.2.1" {
+		t.Errorf("records after rollback = %s", got)
+	}
+	if _, err := os.Stat(f.zone); !os.IsNotExist(err) {
+		t.Errorf("zone file written for a rolled back batch: %v", err)
+	}
+}
+
+func TestBatchContinuesOnError(t *testing.T) {
+	f := newBatchFixture(t)
+
+	result, err := f.batch.Run(asUser(f.owner.ID, "user"), f.operations(), true)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !result.Committed {
+		t.Error("batch continuing on error not committed")
+	}
+	if got := f.statuses(result); got != "ok,failed,ok" {
+		t.Errorf("statuses = %s", got)
+	}
+	if record, ok := result.Operations[0].Result.(*models.DNSRecord); !ok || record.Name != "shop" {
+		t.Errorf("result of the create = %#v", result.Operations[0].Result)
+	}
+	if got := f.records(t); got != "shop=192.0.2.7,www=192.0.2.99" {
+		t.Errorf("records = %s", got)
+	}
+
+	// The zone is published once, after the commit
+	zone, err := os.ReadFile(f.zone)
+	if err != nil || !strings.Contains(string(zone), "192.0.2.99") || strings.Contains(string(zone), "not-an-address") {
+		t.Errorf("zone file (%v):\n%s", err, zone)
+	}
+}
+
+func TestBatchChecksOwnership(t *testing.T) {
+	f := newBatchFixture(t)
+	stranger := asUser(uuid.New(), "user")
+
+	result, err := f.batch.Run(stranger, []BatchOperation{
+		{Op: BatchDNSUpdate, ID: f.record.ID, Params: json.RawMessage(`{"ttl":60}`)},
+		{Op: BatchDNSCreate, ID: f.domain.ID, Params: json.RawMessage(`{"type":"A","name":"shop","value":"192.0.2.7"}`)},
+		{Op: BatchForceHTTPS, ID: f.domain.ID, Params: json.RawMessage(`{"enabled":false}`)},
+	}, true)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	for i, operation := range result.Operations {
+		if operation.Status != BatchStatusFailed || !apperrors.IsPermissionDenied(operation.Err) {
+			t.Errorf("operation %d on another user's domain = %s (%v)", i, operation.Status, operation.Err)
+		}
+	}
+	if got := f.records(t); got != "www=192.0.2.1" {
+		t.Errorf("records = %s", got)
+	}
+}
+
+func TestBatchSize(t *testing.T) {
+	f := newBatchFixture(t)
+	ctx := asUser(f.owner.ID, "user")
+
+	if _, err := f.batch.Run(ctx, nil, false); fieldMessage(err, "operations") == "" {
+		t.Errorf("empty batch: error = %v", err)
+	}
+	operations := make([]BatchOperation, MaxBatchOperations+1)
+	for i := range operations {
+		operations[i] = BatchOperation{Op: BatchDNSDelete, ID: f.record.ID}
+	}
+	if _, err := f.batch.Run(ctx, operations, false); fieldMessage(err, "operations") == "" {
+		t.Errorf("oversized batch: error = %v", err)
+	}
+
+	// A malformed step refuses the whole batch before anything runs
+	_, err := f.batch.Run(ctx, []BatchOperation{
+		{Op: BatchDNSDelete, ID: f.record.ID},
+		{Op: "dns.explode", ID: f.record.ID},
+	}, true)
+	if fieldMessage(err, "operations[1].op") == "" {
+		t.Errorf("unknown operation: error = %v", err)
+	}
+	if got := f.records(t); got != "www=192.0.2.1" {
+		t.Errorf("records = %s", got)
+	}
+}
@@ -0,0 +1,193 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// ResourceCapacity compares the quotas allocated on a server with what it can hold, in bytes
+type ResourceCapacity struct {
+	Capacity      int64   `json:"capacity"` // 0 when not configured
+	Allocated     int64   `json:"allocated"`
+	Ratio         float64 `json:"ratio"`         // Allocated / Capacity; 0 when the capacity is unknown
+	Overcommitted bool    `json:"overcommitted"` // Beyond the warning ratio
+}
+
+// ServerCapacity is the allocation report of one server
+type ServerCapacity struct {
+	NodeID    *uuid.UUID       `json:"node_id,omitempty"` // Nil for the panel's own server
+	Name      string           `json:"name"`
+	Domains   int64            `json:"domains"`
+	Disk      ResourceCapacity `json:"disk"`
+	Bandwidth ResourceCapacity `json:"bandwidth"`
+}
+
+// localServerName names the panel's own server, which hosts domains that are not on a node
+const localServerName = "local"
+
+// newResourceCapacity computes the allocation ratio and whether it passes the warning ratio
+func newResourceCapacity(capacity, allocated int64, warnRatio float64) ResourceCapacity {
+	rc := ResourceCapacity{Capacity: capacity, Allocated: allocated}
+	if capacity > 0 {
+		rc.Ratio = float64(allocated) / float64(capacity)
+		rc.Overcommitted = exceedsCapacity(capacity, allocated, warnRatio)
+	}
+	return rc
+}
+
+// exceedsCapacity reports whether allocated is beyond ratio times capacity. An unknown capacity
+// or a zero ratio never is.
+func exceedsCapacity(capacity, allocated int64, ratio float64) bool {
+	return capacity > 0 && ratio > 0 && float64(allocated) > float64(capacity)*ratio
+}
+
+// serverCapacities returns the disk and bandwidth capacity of a node, or of the panel's own
+// server when node is nil
+func serverCapacities(cfg config.HostingConfig, node *models.Node) (disk, bandwidth int64) {
+	if node == nil {
+		return cfg.ServerDiskCapacity, cfg.ServerBandwidthCapacity
+	}
+	return node.DiskCapacity, node.BandwidthCapacity
+}
+
+// serverAllocation sums the quotas of the domains on a node, or on the panel's own server when
+// nodeID is nil. The domain exclude, when set, is left out so its new quotas can be added instead.
+func serverAllocation(ctx context.Context, db *gorm.DB, nodeID, exclude *uuid.UUID) (domains, disk, bandwidth int64, err error) {
+	query := db.WithContext(ctx).Model(&models.Domain{})
+	if nodeID == nil {
+		query = query.Where("node_id IS NULL")
+	} else {
+		query = query.Where("node_id = ?", *nodeID)
+	}
+	if exclude != nil {
+		query = query.Where("id <> ?", *exclude)
+	}
+
+	row := query.Select("COUNT(*), COALESCE(SUM(disk_quota), 0), COALESCE(SUM(bandwidth_quota), 0)").Row()
+	if err := row.Scan(&domains, &disk, &bandwidth); err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to sum allocated quotas: %w", err)
+	}
+
+	return domains, disk, bandwidth, nil
+}
+
+// checkCapacity refuses quotas that would take a server beyond its maximum overcommit ratio and
+// logs those beyond the warning ratio. domainID names the domain the quotas are for when it
+// already counts against the server, so its current quotas are replaced rather than added to.
+// A zero quota is not checked, so callers raising one quota leave the other at zero and are not
+// refused for a server that is already overcommitted on it.
+func checkCapacity(ctx context.Context, db *gorm.DB, logger *zap.Logger, cfg config.HostingConfig, node *models.Node, domainID *uuid.UUID, quotas *DomainQuotas) error {
+	diskCapacity, bandwidthCapacity := serverCapacities(cfg, node)
+	if diskCapacity == 0 && bandwidthCapacity == 0 {
+		return nil
+	}
+
+	var nodeID *uuid.UUID
+	name := localServerName
+	if node != nil {
+		nodeID, name = &node.ID, node.Name
+	}
+	_, disk, bandwidth, err := serverAllocation(ctx, db, nodeID, domainID)
+	if err != nil {
+		return err
+	}
+	disk += quotas.DiskQuota
+	bandwidth += quotas.BandwidthQuota
+
+	for _, resource := range []struct {
+		name                       string
+		quota, capacity, allocated int64
+	}{
+		{"disk", quotas.DiskQuota, diskCapacity, disk},
+		{"bandwidth", quotas.BandwidthQuota, bandwidthCapacity, bandwidth},
+	} {
+		if resource.quota == 0 {
+			continue
+		}
+		if exceedsCapacity(resource.capacity, resource.allocated, cfg.OvercommitMaxRatio) {
+			return apperrors.PreconditionCode("capacity_overcommit", map[string]string{
+				"resource": resource.name,
+				"percent":  strconv.Itoa(int(cfg.OvercommitMaxRatio * 100)),
+			})
+		}
+		if exceedsCapacity(resource.capacity, resource.allocated, cfg.OvercommitWarnRatio) {
+			logger.Warn("Quota allocation overcommits server",
+				zap.String("server", name),
+				zap.String("resource", resource.name),
+				zap.Int64("allocated", resource.allocated),
+				zap.Int64("capacity", resource.capacity))
+		}
+	}
+
+	return nil
+}
+
+// raisedQuotas returns the quotas an update raises above the domain's current ones, leaving
+// unchanged or lowered quotas at zero, or nil when it raises none
+func raisedQuotas(domain *models.Domain, updates map[string]interface{}) *DomainQuotas {
+	var raised DomainQuotas
+	if quota, ok := quotaValue(updates["disk_quota"]); ok && quota > domain.DiskQuota {
+		raised.DiskQuota = quota
+	}
+	if quota, ok := quotaValue(updates["bandwidth_quota"]); ok && quota > domain.BandwidthQuota {
+		raised.BandwidthQuota = quota
+	}
+
+	if raised.DiskQuota == 0 && raised.BandwidthQuota == 0 {
+		return nil
+	}
+	return &raised
+}
+
+// quotaValue reads a quota from an updates map, where it may be any integer type or a decoded
+// JSON number
+func quotaValue(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int64:
+		return v, true
+	case float64:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+// CapacityReport compares the quotas allocated on the panel's own server and on each node with
+// their capacities
+func (s *DomainService) CapacityReport(ctx context.Context) ([]*ServerCapacity, error) {
+	var nodes []*models.Node
+	if err := s.db.WithContext(ctx).Order("name").Find(&nodes).Error; err != nil {
+		return nil, fmt.Errorf("failed to get nodes: %w", err)
+	}
+
+	report := make([]*ServerCapacity, 0, len(nodes)+1)
+	for _, node := range append([]*models.Node{nil}, nodes...) {
+		entry := &ServerCapacity{Name: localServerName}
+		if node != nil {
+			entry.NodeID, entry.Name = &node.ID, node.Name
+		}
+
+		domains, disk, bandwidth, err := serverAllocation(ctx, s.db, entry.NodeID, nil)
+		if err != nil {
+			return nil, err
+		}
+		diskCapacity, bandwidthCapacity := serverCapacities(s.config, node)
+		entry.Domains = domains
+		entry.Disk = newResourceCapacity(diskCapacity, disk, s.config.OvercommitWarnRatio)
+		entry.Bandwidth = newResourceCapacity(bandwidthCapacity, bandwidth, s.config.OvercommitWarnRatio)
+
+		report = append(report, entry)
+	}
+
+	return report, nil
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestExceedsCapacity(t *testing.T) {
+	tests := []struct {
+		name                string
+		capacity, allocated int64
+		ratio               float64
+		want                bool
+	}{
+		{"below", 1000, 900, 1.0, false},
+		{"at the ratio", 1000, 1500, 1.5, false},
+		{"beyond the ratio", 1000, 1501, 1.5, true},
+		{"unknown capacity", 0, 1 << 40, 1.0, false},
+		{"disabled ratio", 1000, 1 << 40, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exceedsCapacity(tt.capacity, tt.allocated, tt.ratio); got != tt.want {
+				t.Errorf("exceedsCapacity(%d, %d, %v) = %v, want %v", tt.capacity, tt.allocated, tt.ratio, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRaisedQuotas(t *testing.T) {
+	domain := &models.Domain{DiskQuota: 100, BandwidthQuota: 1000}
+
+	tests := []struct {
+		name    string
+		updates map[string]interface{}
+		want    *DomainQuotas
+	}{
+		{"no quotas", map[string]interface{}{"php_version": "8.2"}, nil},
+		{"lowered", map[string]interface{}{"disk_quota": 50, "bandwidth_quota": int64(10)}, nil},
+		{"unchanged", map[string]interface{}{"disk_quota": int64(100)}, nil},
+		{"disk raised", map[string]interface{}{"disk_quota": 200, "bandwidth_quota": 10}, &DomainQuotas{DiskQuota: 200}},
+		{"JSON number", map[string]interface{}{"bandwidth_quota": float64(5000)}, &DomainQuotas{BandwidthQuota: 5000}},
+		{"not a number", map[string]interface{}{"disk_quota": "lots"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := raisedQuotas(domain, tt.updates)
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("raisedQuotas() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateDomainCapacity(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	cfg.DefaultDiskQuota = 600
+	cfg.DefaultBandwidthQuota = 100
+	cfg.ServerDiskCapacity = 1000
+	cfg.OvercommitWarnRatio = 1.0
+	cfg.OvercommitMaxRatio = 1.5
+	domains, _ := newTestDomainService(t, db, cfg)
+	core, logs := observer.New(zapcore.WarnLevel)
+	domains.logger = zap.New(core)
+	owner := createTestUser(t, db)
+	ctx := asUser(owner.ID, "user")
+
+	if _, err := domains.CreateDomain(ctx, owner.ID, "first.example", nil); err != nil {
+		t.Fatalf("first domain: %v", err)
+	}
+	if logs.Len() != 0 {
+		t.Errorf("warned below capacity: %v", logs.All())
+	}
+
+	// 1200 of 1000 bytes passes the warning ratio but not the maximum
+	if _, err := domains.CreateDomain(ctx, owner.ID, "second.example", nil); err != nil {
+		t.Fatalf("second domain: %v", err)
+	}
+	if logs.FilterMessage("Quota allocation overcommits server").Len() != 1 {
+		t.Errorf("overcommit logs = %v, want one warning", logs.All())
+	}
+
+	if _, err := domains.CreateDomain(ctx, owner.ID, "third.example", nil); errorCode(err) != "capacity_overcommit" {
+		t.Fatalf("third domain: error = %v, want capacity_overcommit", err)
+	}
+	var count int64
+	db.Model(&models.Domain{}).Where("name = ?", "third.example").Count(&count)
+	if count != 0 {
+		t.Error("refused domain was stored")
+	}
+}
+
+func TestUpdateDomainCapacity(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	cfg.ServerDiskCapacity = 1000
+	cfg.OvercommitWarnRatio = 1.0
+	cfg.OvercommitMaxRatio = 1.5
+	domains, _ := newTestDomainService(t, db, cfg)
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "grow.example")
+	other := createTestDomain(t, db, owner, "other.example")
+	db.Model(domain).Update("disk_quota", 800)
+	db.Model(other).Update("disk_quota", 800)
+	ctx := asUser(owner.ID, "admin")
+
+	// The domain's own quota is replaced, not added to: 800 + 700 fits 1.5 × 1000
+	if _, err := domains.UpdateDomain(ctx, domain.ID, map[string]interface{}{"disk_quota": 700}); err != nil {
+		t.Fatalf("lower quota on an overcommitted server: %v", err)
+	}
+	if _, err := domains.UpdateDomain(ctx, domain.ID, map[string]interface{}{"disk_quota": 701}); errorCode(err) != "capacity_overcommit" {
+		t.Errorf("raise beyond the maximum: error = %v, want capacity_overcommit", err)
+	}
+	if _, err := domains.UpdateDomain(ctx, domain.ID, map[string]interface{}{"disk_quota": 700, "bandwidth_quota": 1 << 40}); err != nil {
+		t.Errorf("raise bandwidth without a bandwidth capacity: %v", err)
+	}
+}
+
+func TestCapacityReport(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	cfg.ServerDiskCapacity = 1000
+	cfg.OvercommitWarnRatio = 1.0
+	domains, _ := newTestDomainService(t, db, cfg)
+	owner := createTestUser(t, db)
+
+	node := &models.Node{Name: "edge-1", Hostname: "edge-1.example", IPAddress: "192.0.2.20", IsActive: true, DiskCapacity: 4000, BandwidthCapacity: 100}
+	mustCreate(t, db, node)
+	local := createTestDomain(t, db, owner, "local.example")
+	db.Model(local).Update("disk_quota", 1200)
+	remote := createTestDomain(t, db, owner, "remote.example")
+	db.Model(remote).Updates(map[string]interface{}{"node_id": node.ID, "disk_quota": 1000, "bandwidth_quota": 50})
+
+	report, err := domains.CapacityReport(context.Background())
+	if err != nil {
+		t.Fatalf("CapacityReport() error = %v", err)
+	}
+	if len(report) != 2 {
+		t.Fatalf("report has %d servers, want local and edge-1", len(report))
+	}
+
+	own, edge := report[0], report[1]
+	if own.Name != localServerName || own.NodeID != nil || own.Domains != 1 {
+		t.Errorf("local server = %+v", own)
+	}
+	if own.Disk.Allocated != 1200 || own.Disk.Ratio != 1.2 || !own.Disk.Overcommitted {
+		t.Errorf("local disk = %+v, want 1200 of 1000 overcommitted", own.Disk)
+	}
+	if own.Bandwidth.Capacity != 0 || own.Bandwidth.Ratio != 0 || own.Bandwidth.Overcommitted {
+		t.Errorf("local bandwidth without a capacity = %+v", own.Bandwidth)
+	}
+	if edge.Name != "edge-1" || edge.NodeID == nil || *edge.NodeID != node.ID || edge.Domains != 1 {
+		t.Errorf("node = %+v", edge)
+	}
+	if edge.Disk.Ratio != 0.25 || edge.Disk.Overcommitted || edge.Bandwidth.Ratio != 0.5 {
+		t.Errorf("node disk %+v, bandwidth %+v", edge.Disk, edge.Bandwidth)
+	}
+}
+
+func TestCreateDomainOnNodeUsesNodeCapacity(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	cfg.DefaultDiskQuota = 600
+	cfg.ServerDiskCapacity = 100 // The panel's own server would refuse the domain
+	cfg.OvercommitMaxRatio = 1.0
+	dns, domains := newTestDNSService(t, db, cfg)
+	nodes := NewNodeService(db, nil, zap.NewNop(), cfg, dns, nil)
+	owner := createTestUser(t, db)
+	admin := asUser(owner.ID, "admin")
+
+	if _, err := nodes.RegisterNode(admin, NodeRegistration{Name: "bad", Hostname: "bad.example", IPAddress: "198.51.100.9", DiskCapacity: -1}); err == nil {
+		t.Error("node with a negative capacity registered")
+	}
+	if _, err := nodes.RegisterNode(admin, NodeRegistration{Name: "big", Hostname: "big.example", IPAddress: "198.51.100.10", IsDefault: true, DiskCapacity: 1000}); err != nil {
+		t.Fatalf("RegisterNode: %v", err)
+	}
+
+	if _, err := domains.CreateDomain(asUser(owner.ID), owner.ID, "fits.example", nil); err != nil {
+		t.Fatalf("domain within the node's capacity: %v", err)
+	}
+	if _, err := domains.CreateDomain(asUser(owner.ID), owner.ID, "full.example", nil); errorCode(err) != "capacity_overcommit" {
+		t.Errorf("domain beyond the node's capacity: error = %v, want capacity_overcommit", err)
+	}
+}
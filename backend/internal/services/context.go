@@ -0,0 +1,56 @@
+package services
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// actorFromContext returns the authenticated user set on the context by the auth interceptor
+func actorFromContext(ctx context.Context) *uuid.UUID {
+	userID, ok := ctx.Value("user_id").(uuid.UUID)
+	if !ok {
+		return nil
+	}
+	return &userID
+}
+
+// hasRoleInContext reports whether the authenticated user has the role or is an admin
+func hasRoleInContext(ctx context.Context, role string) bool {
+	roles, ok := ctx.Value("roles").([]string)
+	if !ok {
+		return false
+	}
+	for _, r := range roles {
+		if r == role || r == "admin" {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeOwner allows the authenticated user to act on a resource of ownerID when they own it
+// or are an admin; resource names the resource in the permission error
+func authorizeOwner(ctx context.Context, ownerID uuid.UUID, resource string) error {
+	actor := actorFromContext(ctx)
+	if !hasRoleInContext(ctx, "admin") && (actor == nil || *actor != ownerID) {
+		return apperrors.PermissionDenied(resource)
+	}
+	return nil
+}
+
+// authorizeDomain allows the authenticated user to act on the domain when they own it or are an admin
+func authorizeDomain(ctx context.Context, domain *models.Domain) error {
+	return authorizeOwner(ctx, domain.UserID, "domain")
+}
+
+// dryRun reports whether provisioning side effects should only be logged: in dry-run mode, or
+// for a request the API marked as a dry run
+func dryRun(ctx context.Context, cfg config.HostingConfig) bool {
+	requested, _ := ctx.Value("dry_run").(bool)
+	return cfg.DryRun || requested
+}
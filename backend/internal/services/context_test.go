@@ -0,0 +1,40 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestAuthorizeDomain(t *testing.T) {
+	owner := uuid.New()
+	domain := &models.Domain{UserID: owner, Name: "example.com"}
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		allowed bool
+	}{
+		{"owner", asUser(owner), true},
+		{"admin", asUser(uuid.New(), "admin"), true},
+		{"other user", asUser(uuid.New()), false},
+		{"other user with another role", asUser(uuid.New(), "support"), false},
+		{"anonymous", context.Background(), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := authorizeDomain(tt.ctx, domain)
+			if tt.allowed && err != nil {
+				t.Fatalf("refused: %v", err)
+			}
+			if !tt.allowed && !apperrors.IsPermissionDenied(err) {
+				t.Fatalf("err = %v, want permission denied", err)
+			}
+		})
+	}
+}
@@ -10,7 +10,11 @@ import (
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/database"
 	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/runner"
 )
 
 // DatabaseService handles database-related operations
@@ -18,14 +22,23 @@ type DatabaseService struct {
 	db     *gorm.DB
 	redis  *redis.Client
 	logger *zap.Logger
+	config config.HostingConfig
+	runner runner.Runner
+
+	provisioning *database.Provisioning // Measures database sizes; nil when not configured
 }
 
-// NewDatabaseService creates a new database service
-func NewDatabaseService(db *gorm.DB, redis *redis.Client, logger *zap.Logger) *DatabaseService {
+// NewDatabaseService creates a new database service. provisioning may be nil, which leaves
+// database sizes unmeasured.
+func NewDatabaseService(db *gorm.DB, redis *redis.Client, logger *zap.Logger, config config.HostingConfig, runner runner.Runner, provisioning *database.Provisioning) *DatabaseService {
 	return &DatabaseService{
 		db:     db,
 		redis:  redis,
 		logger: logger,
+		config: config,
+		runner: runner,
+
+		provisioning: provisioning,
 	}
 }
 
@@ -34,7 +47,10 @@ func (s *DatabaseService) CreateDatabase(ctx context.Context, domainID uuid.UUID
 	// Check if domain exists
 	var domain models.Domain
 	if err := s.db.WithContext(ctx).Where("id = ?", domainID).First(&domain).Error; err != nil {
-		return nil, fmt.Errorf("domain not found: %w", err)
+		return nil, apperrors.FromDB(err, "domain")
+	}
+	if err := requireFeature(&domain, FeatureDatabases); err != nil {
+		return nil, err
 	}
 
 	// Check if database already exists
@@ -48,6 +64,9 @@ func (s *DatabaseService) CreateDatabase(ctx context.Context, domainID uuid.UUID
 	if count > 0 {
 		return nil, fmt.Errorf("database already exists")
 	}
+	if err := s.checkUserDatabaseQuota(ctx, domain.UserID); err != nil {
+		return nil, err
+	}
 
 	database := &models.Database{
 		DomainID: domainID,
@@ -94,7 +113,7 @@ func (s *DatabaseService) CreateDatabaseUser(ctx context.Context, databaseID uui
 	// Check if database exists
 	var database models.Database
 	if err := s.db.WithContext(ctx).Where("id = ?", databaseID).First(&database).Error; err != nil {
-		return nil, fmt.Errorf("database not found: %w", err)
+		return nil, apperrors.FromDB(err, "database")
 	}
 
 	// Hash password
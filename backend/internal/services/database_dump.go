@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// databaseNamePattern restricts names passed to the dump tools so they cannot be read as flags
+var databaseNamePattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// ExportDatabase writes an SQL dump of a database to w
+func (s *DatabaseService) ExportDatabase(ctx context.Context, databaseID uuid.UUID, w io.Writer) error {
+	database, err := s.getDatabase(ctx, databaseID)
+	if err != nil {
+		return err
+	}
+
+	var name string
+	var args []string
+	switch database.Type {
+	case "mysql":
+		name, args = "mysqldump", []string{"--single-transaction", "--routines", "--triggers", database.Name}
+	case "postgresql":
+		name, args = "pg_dump", []string{"--no-owner", "--clean", "--if-exists", database.Name}
+	default:
+		return fmt.Errorf("unsupported database type: %s", database.Type)
+	}
+
+	if stderr, err := s.runner.Stream(ctx, nil, w, name, args...); err != nil {
+		return fmt.Errorf("failed to export database %s: %v: %s", database.Name, err, strings.TrimSpace(string(stderr)))
+	}
+
+	return nil
+}
+
+// ImportDatabase loads an SQL dump from r into a database. Databases over their quota, or whose
+// owner is over theirs, refuse imports.
+func (s *DatabaseService) ImportDatabase(ctx context.Context, databaseID uuid.UUID, r io.Reader) error {
+	database, err := s.getDatabase(ctx, databaseID)
+	if err != nil {
+		return err
+	}
+	if database.QuotaBlockedAt != nil {
+		return apperrors.PreconditionCode("database_quota_exceeded", map[string]string{"name": database.Name})
+	}
+
+	var name string
+	var args []string
+	switch database.Type {
+	case "mysql":
+		name, args = "mysql", []string{database.Name}
+	case "postgresql":
+		name, args = "psql", []string{"--quiet", "--set", "ON_ERROR_STOP=1", "--dbname", database.Name}
+	default:
+		return fmt.Errorf("unsupported database type: %s", database.Type)
+	}
+
+	if stderr, err := s.runner.Stream(ctx, r, nil, name, args...); err != nil {
+		return fmt.Errorf("failed to import database %s: %v: %s", database.Name, err, strings.TrimSpace(string(stderr)))
+	}
+
+	s.logger.Info("Database imported", zap.String("database", database.Name))
+	return nil
+}
+
+// getDatabase loads a database and checks that its name is safe to hand to the dump tools
+func (s *DatabaseService) getDatabase(ctx context.Context, databaseID uuid.UUID) (*models.Database, error) {
+	var database models.Database
+	if err := s.db.WithContext(ctx).Where("id = ?", databaseID).First(&database).Error; err != nil {
+		return nil, apperrors.FromDB(err, "database")
+	}
+
+	if !databaseNamePattern.MatchString(database.Name) {
+		return nil, fmt.Errorf("invalid database name: %s", database.Name)
+	}
+
+	return &database, nil
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// DatabaseUsage is the storage used by a user's databases against their quotas, in megabytes.
+// A quota of 0 means unlimited.
+type DatabaseUsage struct {
+	UserID    uuid.UUID            `json:"user_id"`
+	UsedMB    int64                `json:"used_mb"`
+	QuotaMB   int64                `json:"quota_mb"`
+	OverQuota bool                 `json:"over_quota"`
+	Databases []DatabaseQuotaUsage `json:"databases"`
+}
+
+// DatabaseQuotaUsage is the storage used by one database against its quota
+type DatabaseQuotaUsage struct {
+	ID        uuid.UUID  `json:"id"`
+	Name      string     `json:"name"`
+	DomainID  uuid.UUID  `json:"domain_id"`
+	SizeMB    int64      `json:"size_mb"`
+	QuotaMB   int64      `json:"quota_mb"`
+	OverQuota bool       `json:"over_quota"`
+	BlockedAt *time.Time `json:"blocked_at,omitempty"`
+}
+
+// GetDatabaseUsage returns the sizes of a user's databases, as of the last quota check, against
+// the per-database and per-user quotas
+func (s *DatabaseService) GetDatabaseUsage(ctx context.Context, userID uuid.UUID) (*DatabaseUsage, error) {
+	databases, err := s.userDatabases(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &DatabaseUsage{
+		UserID:    userID,
+		QuotaMB:   s.config.UserDatabaseQuotaMB,
+		Databases: make([]DatabaseQuotaUsage, 0, len(databases)),
+	}
+	for _, database := range databases {
+		usage.UsedMB += database.SizeMB
+		usage.Databases = append(usage.Databases, DatabaseQuotaUsage{
+			ID:        database.ID,
+			Name:      database.Name,
+			DomainID:  database.DomainID,
+			SizeMB:    database.SizeMB,
+			QuotaMB:   s.config.DatabaseQuotaMB,
+			OverQuota: overQuota(database.SizeMB, s.config.DatabaseQuotaMB),
+			BlockedAt: database.QuotaBlockedAt,
+		})
+	}
+	usage.OverQuota = overQuota(usage.UsedMB, usage.QuotaMB)
+
+	return usage, nil
+}
+
+// CheckDatabaseQuotas measures every database on the provisioning server and blocks the ones
+// over their quota or owned by a user over theirs from further imports. Blocks are lifted once
+// usage falls back below the quotas.
+func (s *DatabaseService) CheckDatabaseQuotas(ctx context.Context) error {
+	var databases []*models.Database
+	if err := s.db.WithContext(ctx).Preload("Domain").Find(&databases).Error; err != nil {
+		return fmt.Errorf("failed to get databases: %w", err)
+	}
+
+	if s.provisioning != nil {
+		sizes, err := s.provisioning.DatabaseSizes(ctx)
+		if err != nil {
+			return err
+		}
+		for _, database := range databases {
+			size, ok := sizes[database.Name]
+			if database.Type != "mysql" || !ok {
+				continue
+			}
+			if sizeMB := bytesToMB(size); sizeMB != database.SizeMB {
+				if err := s.db.WithContext(ctx).Model(&models.Database{ID: database.ID}).Update("size_mb", sizeMB).Error; err != nil {
+					s.logger.Error("Failed to update database size", zap.String("database", database.Name), zap.Error(err))
+					continue
+				}
+				database.SizeMB = sizeMB
+			}
+		}
+	}
+
+	over := overQuotaDatabases(databases, s.config.DatabaseQuotaMB, s.config.UserDatabaseQuotaMB)
+	now := time.Now()
+	for _, database := range databases {
+		blocked := over[database.ID]
+		if blocked == (database.QuotaBlockedAt != nil) {
+			continue
+		}
+
+		var value interface{}
+		if blocked {
+			value = now
+		}
+		if err := s.db.WithContext(ctx).Model(&models.Database{ID: database.ID}).Update("quota_blocked_at", value).Error; err != nil {
+			s.logger.Error("Failed to update database quota block", zap.String("database", database.Name), zap.Error(err))
+			continue
+		}
+		if blocked {
+			s.logger.Warn("Database over quota, imports blocked",
+				zap.String("database", database.Name),
+				zap.Int64("size_mb", database.SizeMB))
+		}
+	}
+
+	return nil
+}
+
+// checkUserDatabaseQuota refuses new databases for users whose databases use up their quota
+func (s *DatabaseService) checkUserDatabaseQuota(ctx context.Context, userID uuid.UUID) error {
+	if s.config.UserDatabaseQuotaMB <= 0 {
+		return nil
+	}
+
+	databases, err := s.userDatabases(ctx, userID)
+	if err != nil {
+		return err
+	}
+	used := databaseUsageByUser(databases)[userID]
+	if overQuota(used, s.config.UserDatabaseQuotaMB) {
+		return apperrors.PreconditionCode("user_database_quota_exceeded", map[string]string{
+			"used":  strconv.FormatInt(used, 10),
+			"quota": strconv.FormatInt(s.config.UserDatabaseQuotaMB, 10),
+		})
+	}
+
+	return nil
+}
+
+// userDatabases loads the databases on a user's domains, with their domains
+func (s *DatabaseService) userDatabases(ctx context.Context, userID uuid.UUID) ([]*models.Database, error) {
+	var databases []*models.Database
+	if err := s.db.WithContext(ctx).
+		Preload("Domain").
+		Joins("JOIN domains ON domains.id = `databases`.domain_id").
+		Where("domains.user_id = ?", userID).
+		Order("`databases`.name").
+		Find(&databases).Error; err != nil {
+		return nil, fmt.Errorf("failed to get databases: %w", err)
+	}
+	return databases, nil
+}
+
+// databaseUsageByUser adds up the sizes of databases per owner. The databases' domains must be
+// loaded.
+func databaseUsageByUser(databases []*models.Database) map[uuid.UUID]int64 {
+	usage := make(map[uuid.UUID]int64)
+	for _, database := range databases {
+		usage[database.Domain.UserID] += database.SizeMB
+	}
+	return usage
+}
+
+// overQuotaDatabases returns the databases that are at or over the per-database quota, or whose
+// owner's databases together are at or over the per-user quota. A quota of 0 is unlimited.
+func overQuotaDatabases(databases []*models.Database, perDatabaseMB, perUserMB int64) map[uuid.UUID]bool {
+	byUser := databaseUsageByUser(databases)
+
+	over := make(map[uuid.UUID]bool)
+	for _, database := range databases {
+		if overQuota(database.SizeMB, perDatabaseMB) || overQuota(byUser[database.Domain.UserID], perUserMB) {
+			over[database.ID] = true
+		}
+	}
+	return over
+}
+
+// overQuota reports whether usage has reached a quota; a quota of 0 is unlimited
+func overQuota(usage, quota int64) bool {
+	return quota > 0 && usage >= quota
+}
+
+// bytesToMB converts a size to megabytes, rounding up so any data counts
+func bytesToMB(size int64) int64 {
+	return (size + 1<<20 - 1) >> 20
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/runner"
+)
+
+func TestBytesToMB(t *testing.T) {
+	tests := []struct{ size, want int64 }{
+		{0, 0},
+		{1, 1},
+		{1 << 20, 1},
+		{1<<20 + 1, 2},
+		{5 << 20, 5},
+	}
+	for _, tt := range tests {
+		if got := bytesToMB(tt.size); got != tt.want {
+			t.Errorf("bytesToMB(%d) = %d, want %d", tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestOverQuotaDatabases(t *testing.T) {
+	alice, bob := uuid.New(), uuid.New()
+	database := func(owner uuid.UUID, sizeMB int64) *models.Database {
+		return &models.Database{ID: uuid.New(), SizeMB: sizeMB, Domain: models.Domain{UserID: owner}}
+	}
+	a1, a2, b1 := database(alice, 60), database(alice, 50), database(bob, 10)
+	databases := []*models.Database{a1, a2, b1}
+
+	if usage := databaseUsageByUser(databases); usage[alice] != 110 || usage[bob] != 10 {
+		t.Errorf("databaseUsageByUser() = %v", usage)
+	}
+
+	tests := []struct {
+		name                 string
+		perDatabase, perUser int64
+		want                 []*models.Database
+	}{
+		{"unlimited", 0, 0, nil},
+		{"per-database quota", 60, 0, []*models.Database{a1}},
+		{"per-user quota blocks all of the user's databases", 0, 100, []*models.Database{a1, a2}},
+		{"usage at the quota counts", 0, 110, []*models.Database{a1, a2}},
+		{"both quotas", 10, 1000, []*models.Database{a1, a2, b1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			over := overQuotaDatabases(databases, tt.perDatabase, tt.perUser)
+			if len(over) != len(tt.want) {
+				t.Errorf("%d databases over quota, want %d", len(over), len(tt.want))
+			}
+			for _, database := range tt.want {
+				if !over[database.ID] {
+					t.Errorf("database of %d MB not over quota", database.SizeMB)
+				}
+			}
+		})
+	}
+}
+
+func TestDatabaseQuotas(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	cfg.DatabaseQuotaMB = 100
+	cfg.UserDatabaseQuotaMB = 150
+	databases := NewDatabaseService(db, nil, zap.NewNop(), cfg, runner.NewFake(), nil)
+	ctx := context.Background()
+
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "data.example")
+	other := createTestUser(t, db)
+	otherDomain := createTestDomain(t, db, other, "other.example")
+	shop := &models.Database{DomainID: domain.ID, Name: "shop", Type: "mysql", SizeMB: 120}
+	blog := &models.Database{DomainID: domain.ID, Name: "blog", Type: "mysql", SizeMB: 20}
+	small := &models.Database{DomainID: otherDomain.ID, Name: "small", Type: "mysql", SizeMB: 5}
+	for _, database := range []*models.Database{shop, blog, small} {
+		mustCreate(t, db, database)
+	}
+	blocked := func(database *models.Database) bool {
+		var stored models.Database
+		db.First(&stored, "id = ?", database.ID)
+		return stored.QuotaBlockedAt != nil
+	}
+
+	usage, err := databases.GetDatabaseUsage(ctx, owner.ID)
+	if err != nil {
+		t.Fatalf("GetDatabaseUsage() error = %v", err)
+	}
+	if usage.UsedMB != 140 || usage.QuotaMB != 150 || usage.OverQuota || len(usage.Databases) != 2 {
+		t.Errorf("usage = %+v", usage)
+	}
+	if usage.Databases[0].Name != "blog" || usage.Databases[0].OverQuota || !usage.Databases[1].OverQuota {
+		t.Errorf("database usage = %+v", usage.Databases)
+	}
+
+	// Only the database over its own quota is blocked
+	if err := databases.CheckDatabaseQuotas(ctx); err != nil {
+		t.Fatalf("CheckDatabaseQuotas() error = %v", err)
+	}
+	if !blocked(shop) || blocked(blog) || blocked(small) {
+		t.Errorf("blocked: shop %v, blog %v, small %v", blocked(shop), blocked(blog), blocked(small))
+	}
+	if err := databases.ImportDatabase(ctx, shop.ID, strings.NewReader("")); errorCode(err) != "database_quota_exceeded" {
+		t.Errorf("import into a blocked database: error = %v", err)
+	}
+	if err := databases.ImportDatabase(ctx, blog.ID, strings.NewReader("")); err != nil {
+		t.Errorf("import into a database under quota: %v", err)
+	}
+
+	// The user reaches their quota: no new databases, and every database is blocked
+	db.Model(blog).Update("size_mb", 30)
+	if _, err := databases.CreateDatabase(ctx, domain.ID, "extra", "mysql"); errorCode(err) != "user_database_quota_exceeded" {
+		t.Errorf("create over the user quota: error = %v", err)
+	}
+	if _, err := databases.CreateDatabase(ctx, otherDomain.ID, "extra", "mysql"); err != nil {
+		t.Errorf("create for a user under quota: %v", err)
+	}
+	databases.CheckDatabaseQuotas(ctx)
+	if !blocked(blog) || blocked(small) {
+		t.Errorf("blocked: blog %v, small %v", blocked(blog), blocked(small))
+	}
+
+	// Blocks are lifted once usage shrinks
+	db.Model(shop).Update("size_mb", 50)
+	databases.CheckDatabaseQuotas(ctx)
+	if blocked(shop) || blocked(blog) {
+		t.Errorf("blocks kept under quota: shop %v, blog %v", blocked(shop), blocked(blog))
+	}
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// ErrSSOTokenInvalid is returned for database admin tokens that are forged, expired or already used
+var ErrSSOTokenInvalid = errors.New("invalid or expired database admin token")
+
+// DatabaseSSOSession is what the phpMyAdmin/Adminer signon script learns when it redeems a token.
+// It never contains a password; the signon script authenticates as the user by its own means.
+type DatabaseSSOSession struct {
+	DatabaseID uuid.UUID `json:"database_id"`
+	Database   string    `json:"database"`
+	Type       string    `json:"type"`
+	Username   string    `json:"username"`
+	UserID     uuid.UUID `json:"user_id"` // The panel user who asked for the handoff
+}
+
+// GetSSOURL returns a link that signs the caller into the configured phpMyAdmin or Adminer as
+// the database's user. The link carries a signed, single-use token that expires after
+// the configured TTL.
+func (s *DatabaseService) GetSSOURL(ctx context.Context, databaseID uuid.UUID) (string, error) {
+	if s.config.DBAdminURL == "" {
+		return "", apperrors.FeatureDisabled("database admin single sign-on")
+	}
+
+	var database models.Database
+	if err := s.db.WithContext(ctx).Preload("Domain").Where("id = ?", databaseID).First(&database).Error; err != nil {
+		return "", apperrors.FromDB(err, "database")
+	}
+
+	actor := actorFromContext(ctx)
+	if err := authorizeOwner(ctx, database.Domain.UserID, "database"); err != nil {
+		return "", err
+	}
+
+	var dbUser models.DatabaseUser
+	if err := s.db.WithContext(ctx).Where("database_id = ?", databaseID).Order("created_at").First(&dbUser).Error; err != nil {
+		return "", apperrors.FromDB(err, "database user")
+	}
+
+	session := DatabaseSSOSession{
+		DatabaseID: database.ID,
+		Database:   database.Name,
+		Type:       database.Type,
+		Username:   dbUser.Username,
+	}
+	if actor != nil {
+		session.UserID = *actor
+	}
+
+	token, err := s.issueSSOToken(ctx, &session)
+	if err != nil {
+		return "", err
+	}
+
+	link, err := url.Parse(s.config.DBAdminURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid database admin URL: %w", err)
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	resourceID := database.ID.String()
+	auditLog := &models.AuditLog{
+		UserID:     actor,
+		Action:     "database_sso",
+		Resource:   "database",
+		ResourceID: &resourceID,
+		Details:    fmt.Sprintf("database=%s user=%s", database.Name, dbUser.Username),
+		Success:    true,
+	}
+	if err := s.db.WithContext(ctx).Create(auditLog).Error; err != nil {
+		s.logger.Error("Failed to record audit log", zap.Error(err))
+	}
+
+	return link.String(), nil
+}
+
+// RedeemSSOToken exchanges a token for the session it was issued for. Each token can be
+// redeemed once, and only before it expires: the expiry is part of the signed token, and the
+// session is deleted from Redis as it is read.
+func (s *DatabaseService) RedeemSSOToken(ctx context.Context, token string) (*DatabaseSSOSession, error) {
+	nonce, ok := s.verifySSOToken(token, time.Now())
+	if !ok {
+		return nil, ErrSSOTokenInvalid
+	}
+
+	data, err := s.redis.GetDel(ctx, ssoTokenKey(nonce)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrSSOTokenInvalid
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to redeem database admin token: %w", err)
+	}
+
+	var session DatabaseSSOSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("failed to decode database admin session: %w", err)
+	}
+
+	return &session, nil
+}
+
+// issueSSOToken stores the session under a random nonce and returns the nonce with its expiry and
+// their signature
+func (s *DatabaseService) issueSSOToken(ctx context.Context, session *DatabaseSSOSession) (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate database admin token: %w", err)
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(buf)
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode database admin session: %w", err)
+	}
+
+	if err := s.redis.Set(ctx, ssoTokenKey(nonce), data, s.config.DBAdminTokenTTL).Err(); err != nil {
+		return "", fmt.Errorf("failed to store database admin token: %w", err)
+	}
+
+	payload := nonce + "." + strconv.FormatInt(time.Now().Add(s.config.DBAdminTokenTTL).Unix(), 10)
+	return payload + "." + s.signSSOPayload(payload), nil
+}
+
+// verifySSOToken checks the token's signature and expiry and returns its nonce
+func (s *DatabaseService) verifySSOToken(token string, now time.Time) (string, bool) {
+	payload, signature, ok := cutLast(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(s.signSSOPayload(payload))) {
+		return "", false
+	}
+
+	nonce, expiry, ok := strings.Cut(payload, ".")
+	if !ok || nonce == "" {
+		return "", false
+	}
+	expiresAt, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || now.Unix() >= expiresAt {
+		return "", false
+	}
+
+	return nonce, true
+}
+
+func (s *DatabaseService) signSSOPayload(payload string) string {
+	mac := hmac.New(sha256.New, []byte(s.config.DBAdminSecret))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// cutLast slices s around the last instance of sep
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+func ssoTokenKey(nonce string) string {
+	return "db_sso:" + nonce
+}
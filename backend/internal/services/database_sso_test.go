@@ -0,0 +1,59 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestDatabaseSSOToken(t *testing.T) {
+	db := newTestDB(t)
+	client, _ := newTestRedis(t)
+	cfg := testHostingConfig(t)
+	cfg.DBAdminURL = "https://db.example.net/signon.php"
+	cfg.DBAdminSecret = "signon-secret"
+	cfg.DBAdminTokenTTL = time.Minute
+	databases := NewDatabaseService(db, client, zap.NewNop(), cfg, nil, nil)
+
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "sso.example")
+	database := &models.Database{DomainID: domain.ID, Name: "shop", Type: "mysql"}
+	db.Create(database)
+	db.Create(&models.DatabaseUser{DatabaseID: database.ID, Username: "shop_user", PasswordHash: "x"})
+
+	if _, err := databases.GetSSOURL(asUser(createTestUser(t, db).ID), database.ID); !apperrors.IsPermissionDenied(err) {
+		t.Fatalf("link for another user's database: err = %v, want permission denied", err)
+	}
+
+	link, err := databases.GetSSOURL(asUser(owner.ID), database.ID)
+	if err != nil {
+		t.Fatalf("get link: %v", err)
+	}
+	parsed, _ := url.Parse(link)
+	token := parsed.Query().Get("token")
+
+	if _, ok := databases.verifySSOToken(token, time.Now().Add(2*time.Minute)); ok {
+		t.Error("token accepted after its expiry")
+	}
+	if _, err := databases.RedeemSSOToken(context.Background(), token+"x"); !errors.Is(err, ErrSSOTokenInvalid) {
+		t.Errorf("tampered token: err = %v", err)
+	}
+
+	session, err := databases.RedeemSSOToken(context.Background(), token)
+	if err != nil {
+		t.Fatalf("redeem: %v", err)
+	}
+	if session.Username != "shop_user" || session.UserID != owner.ID {
+		t.Errorf("session = %+v", session)
+	}
+	if _, err := databases.RedeemSSOToken(context.Background(), token); !errors.Is(err, ErrSSOTokenInvalid) {
+		t.Errorf("second redemption: err = %v, want invalid token", err)
+	}
+}
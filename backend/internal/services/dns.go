@@ -2,34 +2,83 @@ package services
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/cache"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
 	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/zone"
 )
 
+// maxZoneVersions bounds the number of history entries kept per domain
+const maxZoneVersions = 50
+
 // DNSService handles DNS record operations
 type DNSService struct {
 	db     *gorm.DB
 	redis  *redis.Client
 	logger *zap.Logger
+	config config.HostingConfig
+	cache  *cache.Cache
+
+	domains *DomainService // Creates missing domains when importing zone archives
 }
 
 // NewDNSService creates a new DNS service
-func NewDNSService(db *gorm.DB, redis *redis.Client, logger *zap.Logger) *DNSService {
+func NewDNSService(db *gorm.DB, redis *redis.Client, logger *zap.Logger, config config.HostingConfig, cache *cache.Cache, domains *DomainService) *DNSService {
 	return &DNSService{
 		db:     db,
 		redis:  redis,
 		logger: logger,
+		config: config,
+		cache:  cache,
+
+		domains: domains,
 	}
 }
 
-// CreateDNSRecord creates a new DNS record
+// dnsRecordSnapshot is the serialized form of a record stored in the zone history
+type dnsRecordSnapshot struct {
+	ID       uuid.UUID `json:"id"`
+	Type     string    `json:"type"`
+	Name     string    `json:"name"`
+	Value    string    `json:"value"`
+	TTL      int       `json:"ttl"`
+	Priority *int      `json:"priority,omitempty"`
+	IsActive bool      `json:"is_active"`
+}
+
+// CreateDNSRecord creates a new DNS record in a domain the caller owns
 func (s *DNSService) CreateDNSRecord(ctx context.Context, domainID uuid.UUID, recordType, name, value string, ttl int, priority *int) (*models.DNSRecord, error) {
+	var domain models.Domain
+	if err := s.db.WithContext(ctx).Where("id = ?", domainID).First(&domain).Error; err != nil {
+		return nil, apperrors.FromDB(err, "domain")
+	}
+	if err := authorizeDomain(ctx, &domain); err != nil {
+		return nil, err
+	}
+	if err := requireFeature(&domain, FeatureCustomDNS); err != nil {
+		return nil, err
+	}
+	if recordType == "SOA" {
+		return nil, apperrors.InvalidCode("type", "dns.soa_managed", nil)
+	}
+	if ttl == 0 {
+		ttl = defaultRecordTTL(&domain, s.config)
+	}
+
 	record := &models.DNSRecord{
 		DomainID: domainID,
 		Type:     recordType,
@@ -40,10 +89,35 @@ func (s *DNSService) CreateDNSRecord(ctx context.Context, domainID uuid.UUID, re
 		IsActive: true,
 	}
 
-	if err := s.db.WithContext(ctx).Create(record).Error; err != nil {
+	if err := validateDNSRecord(record); err != nil {
+		return nil, err
+	}
+	record.TTL = s.clampTTL(record.TTL)
+
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var zone []*models.DNSRecord
+		if err := tx.Where("domain_id = ?", domainID).Find(&zone).Error; err != nil {
+			return err
+		}
+		if err := s.checkRecordLimits(append(zone, record), []*models.DNSRecord{record}); err != nil {
+			return err
+		}
+		if touchesNameservers(record) {
+			if err := checkNameservers(append(zone, record), domain.Name, record); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Create(record).Error; err != nil {
+			return err
+		}
+		return s.recordVersion(ctx, tx, domainID, "create", &record.ID, nil, record)
+	}); err != nil {
 		return nil, fmt.Errorf("failed to create DNS record: %w", err)
 	}
 
+	s.zoneChanged(ctx, domainID)
+
 	return record, nil
 }
 
@@ -59,25 +133,453 @@ func (s *DNSService) GetDNSRecords(ctx context.Context, domainID uuid.UUID) ([]*
 	return records, nil
 }
 
+// GetDNSRecord retrieves a DNS record with its domain. Only the domain's owner and admins can read it.
+func (s *DNSService) GetDNSRecord(ctx context.Context, recordID uuid.UUID) (*models.DNSRecord, error) {
+	var record models.DNSRecord
+	if err := s.db.WithContext(ctx).Preload("Domain").Where("id = ?", recordID).First(&record).Error; err != nil {
+		return nil, apperrors.FromDB(err, "DNS record")
+	}
+
+	if err := authorizeOwner(ctx, record.Domain.UserID, "DNS record"); err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
+
 // UpdateDNSRecord updates a DNS record
 func (s *DNSService) UpdateDNSRecord(ctx context.Context, recordID uuid.UUID, updates map[string]interface{}) (*models.DNSRecord, error) {
 	var record models.DNSRecord
 	if err := s.db.WithContext(ctx).Where("id = ?", recordID).First(&record).Error; err != nil {
-		return nil, fmt.Errorf("DNS record not found: %w", err)
+		return nil, apperrors.FromDB(err, "DNS record")
+	}
+	if record.Type == "SOA" {
+		return nil, apperrors.InvalidCode("type", "dns.soa_managed", nil)
 	}
+	before := record
 
-	if err := s.db.WithContext(ctx).Model(&record).Updates(updates).Error; err != nil {
-		return nil, fmt.Errorf("failed to update DNS record: %w", err)
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&record).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to update DNS record: %w", err)
+		}
+		// Validate the merged record so partial updates cannot produce an invalid one
+		if err := tx.Where("id = ?", recordID).First(&record).Error; err != nil {
+			return fmt.Errorf("failed to reload DNS record: %w", err)
+		}
+		if err := validateDNSRecord(&record); err != nil {
+			return err
+		}
+		if record.Type == "SOA" {
+			return apperrors.InvalidCode("type", "dns.soa_managed", nil)
+		}
+		if ttl := s.clampTTL(record.TTL); ttl != record.TTL {
+			if err := tx.Model(&record).Update("ttl", ttl).Error; err != nil {
+				return fmt.Errorf("failed to update DNS record: %w", err)
+			}
+		}
+		if record.Type != before.Type || touchesNameservers(&before, &record) {
+			var zone []*models.DNSRecord
+			if err := tx.Where("domain_id = ?", record.DomainID).Find(&zone).Error; err != nil {
+				return fmt.Errorf("failed to load DNS zone: %w", err)
+			}
+			if record.Type != before.Type {
+				if err := s.checkRecordLimits(zone, []*models.DNSRecord{&record}); err != nil {
+					return err
+				}
+			}
+			if touchesNameservers(&before, &record) {
+				origin, err := zoneOrigin(tx, record.DomainID)
+				if err != nil {
+					return err
+				}
+				if err := checkNameservers(zone, origin, &before, &record); err != nil {
+					return err
+				}
+			}
+		}
+		return s.recordVersion(ctx, tx, record.DomainID, "update", &record.ID, &before, &record)
+	}); err != nil {
+		return nil, err
 	}
 
+	s.zoneChanged(ctx, record.DomainID)
+
 	return &record, nil
 }
 
 // DeleteDNSRecord deletes a DNS record
 func (s *DNSService) DeleteDNSRecord(ctx context.Context, recordID uuid.UUID) error {
-	if err := s.db.WithContext(ctx).Where("id = ?", recordID).Delete(&models.DNSRecord{}).Error; err != nil {
+	var record models.DNSRecord
+	if err := s.db.WithContext(ctx).Where("id = ?", recordID).First(&record).Error; err != nil {
+		return apperrors.FromDB(err, "DNS record")
+	}
+
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ?", recordID).Delete(&models.DNSRecord{}).Error; err != nil {
+			return err
+		}
+		if record.Type == "NS" {
+			var zone []*models.DNSRecord
+			if err := tx.Where("domain_id = ?", record.DomainID).Find(&zone).Error; err != nil {
+				return err
+			}
+			origin, err := zoneOrigin(tx, record.DomainID)
+			if err != nil {
+				return err
+			}
+			if err := checkNameservers(zone, origin, &record); err != nil {
+				return err
+			}
+		}
+		return s.recordVersion(ctx, tx, record.DomainID, "delete", &record.ID, &record, nil)
+	}); err != nil {
 		return fmt.Errorf("failed to delete DNS record: %w", err)
 	}
 
+	s.zoneChanged(ctx, record.DomainID)
+
 	return nil
 }
+
+// GetRecordHistory retrieves the DNS change history for a domain, newest first
+func (s *DNSService) GetRecordHistory(ctx context.Context, domainID uuid.UUID) ([]*models.DNSZoneVersion, error) {
+	var versions []*models.DNSZoneVersion
+	if err := s.db.WithContext(ctx).
+		Where("domain_id = ?", domainID).
+		Order("created_at DESC").
+		Find(&versions).Error; err != nil {
+		return nil, fmt.Errorf("failed to get DNS record history: %w", err)
+	}
+
+	return versions, nil
+}
+
+// RevertToVersion restores a domain's zone to the snapshot taken after the given version
+func (s *DNSService) RevertToVersion(ctx context.Context, domainID, versionID uuid.UUID) ([]*models.DNSRecord, error) {
+	var version models.DNSZoneVersion
+	if err := s.db.WithContext(ctx).
+		Where("id = ? AND domain_id = ?", versionID, domainID).
+		First(&version).Error; err != nil {
+		return nil, apperrors.FromDB(err, "DNS zone version")
+	}
+
+	var snapshot []dnsRecordSnapshot
+	if err := json.Unmarshal([]byte(version.Snapshot), &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to decode zone snapshot: %w", err)
+	}
+
+	records := make([]*models.DNSRecord, 0, len(snapshot))
+	for _, snap := range snapshot {
+		record := &models.DNSRecord{
+			ID:       snap.ID,
+			DomainID: domainID,
+			Type:     snap.Type,
+			Name:     snap.Name,
+			Value:    snap.Value,
+			TTL:      snap.TTL,
+			Priority: snap.Priority,
+			IsActive: snap.IsActive,
+		}
+		if err := validateDNSRecord(record); err != nil {
+			return nil, fmt.Errorf("snapshot contains an invalid record: %w", err)
+		}
+		records = append(records, record)
+	}
+
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("domain_id = ?", domainID).Delete(&models.DNSRecord{}).Error; err != nil {
+			return err
+		}
+		for _, record := range records {
+			// is_active defaults to true, so GORM leaves a false value out of the insert and reads
+			// the default back into the record
+			active := record.IsActive
+			if err := tx.Create(record).Error; err != nil {
+				return err
+			}
+			if !active {
+				if err := tx.Model(record).Update("is_active", false).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return s.recordVersion(ctx, tx, domainID, "revert", nil, nil, nil)
+	}); err != nil {
+		return nil, fmt.Errorf("failed to revert DNS zone: %w", err)
+	}
+
+	s.zoneChanged(ctx, domainID)
+
+	s.logger.Info("DNS zone reverted",
+		zap.String("domain_id", domainID.String()),
+		zap.String("version_id", versionID.String()))
+
+	return records, nil
+}
+
+// recordVersion stores a history entry with a snapshot of the zone after a change and prunes old entries
+func (s *DNSService) recordVersion(ctx context.Context, tx *gorm.DB, domainID uuid.UUID, action string, recordID *uuid.UUID, before, after *models.DNSRecord) error {
+	return recordZoneVersion(ctx, tx, domainID, action, recordID, before, after)
+}
+
+// recordZoneVersion is recordVersion for changes to zones made outside the DNS service, such as
+// renaming their domain
+func recordZoneVersion(ctx context.Context, tx *gorm.DB, domainID uuid.UUID, action string, recordID *uuid.UUID, before, after *models.DNSRecord) error {
+	var current []models.DNSRecord
+	if err := tx.Where("domain_id = ?", domainID).Find(&current).Error; err != nil {
+		return fmt.Errorf("failed to snapshot zone: %w", err)
+	}
+
+	snapshot := make([]dnsRecordSnapshot, len(current))
+	for i := range current {
+		snapshot[i] = toRecordSnapshot(&current[i])
+	}
+
+	snapshotJSON, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to encode zone snapshot: %w", err)
+	}
+
+	version := &models.DNSZoneVersion{
+		DomainID: domainID,
+		UserID:   actorFromContext(ctx),
+		RecordID: recordID,
+		Action:   action,
+		OldValue: encodeRecordSnapshot(before),
+		NewValue: encodeRecordSnapshot(after),
+		Snapshot: string(snapshotJSON),
+	}
+	if err := tx.Create(version).Error; err != nil {
+		return fmt.Errorf("failed to record DNS history: %w", err)
+	}
+
+	// Keep only the most recent versions for the domain
+	var stale []uuid.UUID
+	if err := tx.Model(&models.DNSZoneVersion{}).
+		Where("domain_id = ?", domainID).
+		Order("created_at DESC").
+		Offset(maxZoneVersions).
+		Pluck("id", &stale).Error; err != nil {
+		return fmt.Errorf("failed to find stale DNS history: %w", err)
+	}
+	if len(stale) > 0 {
+		if err := tx.Where("id IN ?", stale).Delete(&models.DNSZoneVersion{}).Error; err != nil {
+			return fmt.Errorf("failed to prune DNS history: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// AddRecords creates records the panel sets up in a domain's zone itself, such as a new domain's
+// default records or the address records of a subdomain, and publishes the zone. They are
+// validated, count against the record limits and enter the zone history like records users
+// create, but do not need the custom DNS feature.
+func (s *DNSService) AddRecords(ctx context.Context, domainID uuid.UUID, records []*models.DNSRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	for _, record := range records {
+		record.DomainID = domainID
+		if err := validateDNSRecord(record); err != nil {
+			return err
+		}
+		record.TTL = s.clampTTL(record.TTL)
+	}
+
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var zone []*models.DNSRecord
+		if err := tx.Where("domain_id = ?", domainID).Find(&zone).Error; err != nil {
+			return err
+		}
+		if err := s.checkRecordLimits(append(zone, records...), records); err != nil {
+			return err
+		}
+
+		for _, record := range records {
+			if err := tx.Create(record).Error; err != nil {
+				return err
+			}
+			if err := s.recordVersion(ctx, tx, domainID, "create", &record.ID, nil, record); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to create DNS records: %w", err)
+	}
+
+	s.zoneChanged(ctx, domainID)
+
+	return nil
+}
+
+// addChallengeRecord publishes the TXT record of an ACME DNS-01 challenge in a domain's zone. The
+// record is the panel's own and short-lived, so it bypasses the custom DNS feature and the record
+// limits and stays out of the zone history; remove it with removeChallengeRecord.
+func (s *DNSService) addChallengeRecord(ctx context.Context, domainID uuid.UUID, name, value string) (*models.DNSRecord, error) {
+	record := &models.DNSRecord{
+		DomainID: domainID,
+		Type:     "TXT",
+		Name:     name,
+		Value:    value,
+		TTL:      s.clampTTL(60),
+		IsActive: true,
+	}
+	if err := s.db.WithContext(ctx).Create(record).Error; err != nil {
+		return nil, fmt.Errorf("failed to create ACME challenge record: %w", err)
+	}
+
+	s.zoneChanged(ctx, domainID)
+
+	return record, nil
+}
+
+// removeChallengeRecord deletes a record created by addChallengeRecord. Failures are logged, since
+// the challenge is over either way.
+func (s *DNSService) removeChallengeRecord(ctx context.Context, record *models.DNSRecord) {
+	if err := s.db.WithContext(ctx).Where("id = ?", record.ID).Delete(&models.DNSRecord{}).Error; err != nil {
+		s.logger.Error("Failed to delete ACME challenge record", zap.String("name", record.Name), zap.Error(err))
+		return
+	}
+
+	s.zoneChanged(ctx, record.DomainID)
+}
+
+// zoneChanged invalidates cached copies of a domain and syncs its zone to the nameserver. Inside
+// a batch, this waits until the batch commits.
+func (s *DNSService) zoneChanged(ctx context.Context, domainID uuid.UUID) {
+	if effects := deferredEffects(ctx); effects != nil {
+		effects.zones[domainID] = true
+		return
+	}
+	s.raiseSerial(ctx, domainID)
+	if err := s.cache.Invalidate(ctx, cache.DomainKey(domainID)); err != nil {
+		s.logger.Warn("Failed to invalidate domain cache", zap.String("domain_id", domainID.String()), zap.Error(err))
+	}
+	s.syncZone(ctx, domainID)
+}
+
+// ZoneChanged publishes a domain's zone after the domain service changed its records
+func (s *DNSService) ZoneChanged(ctx context.Context, domainID uuid.UUID) {
+	s.zoneChanged(ctx, domainID)
+}
+
+// syncZone renders the domain's zone and writes it for the nameserver to load
+func (s *DNSService) syncZone(ctx context.Context, domainID uuid.UUID) {
+	var domain models.Domain
+	if err := s.db.WithContext(ctx).Where("id = ?", domainID).First(&domain).Error; err != nil {
+		s.logger.Error("Failed to load domain for zone sync", zap.String("domain_id", domainID.String()), zap.Error(err))
+		return
+	}
+
+	var records []models.DNSRecord
+	if err := s.db.WithContext(ctx).Where("domain_id = ?", domainID).Find(&records).Error; err != nil {
+		s.logger.Error("Failed to load records for zone sync", zap.String("domain", domain.Name), zap.Error(err))
+		return
+	}
+
+	path := filepath.Join(s.config.ZoneDir, domain.Name+".zone")
+	if dryRun(ctx, s.config) {
+		s.logger.Info("Dry run: skipping zone file write", zap.String("path", path), zap.Int("records", len(records)))
+		return
+	}
+
+	if err := os.MkdirAll(s.config.ZoneDir, 0755); err != nil {
+		s.logger.Error("Failed to create zone directory", zap.Error(err))
+		return
+	}
+
+	if err := os.WriteFile(path, []byte(zone.Render(domain.Name, s.zoneSOA(&domain), records)), 0644); err != nil {
+		s.logger.Error("Failed to write zone file", zap.String("domain", domain.Name), zap.Error(err))
+	}
+}
+
+// ZoneRenamed publishes the zone of a renamed domain under its new name, with a raised serial, and
+// removes the zone file of its old name
+func (s *DNSService) ZoneRenamed(ctx context.Context, domainID uuid.UUID, oldName string) {
+	s.zoneChanged(ctx, domainID)
+
+	path := filepath.Join(s.config.ZoneDir, oldName+".zone")
+	if dryRun(ctx, s.config) {
+		s.logger.Info("Dry run: skipping zone file removal", zap.String("path", path))
+		return
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		s.logger.Error("Failed to remove zone file of old domain name", zap.String("path", path), zap.Error(err))
+	}
+}
+
+// zoneOrigin returns the name of the domain a zone belongs to
+func zoneOrigin(tx *gorm.DB, domainID uuid.UUID) (string, error) {
+	var domain models.Domain
+	if err := tx.Select("name").Where("id = ?", domainID).First(&domain).Error; err != nil {
+		return "", fmt.Errorf("failed to load domain: %w", err)
+	}
+	return domain.Name, nil
+}
+
+func toRecordSnapshot(record *models.DNSRecord) dnsRecordSnapshot {
+	return dnsRecordSnapshot{
+		ID:       record.ID,
+		Type:     record.Type,
+		Name:     record.Name,
+		Value:    record.Value,
+		TTL:      record.TTL,
+		Priority: record.Priority,
+		IsActive: record.IsActive,
+	}
+}
+
+func encodeRecordSnapshot(record *models.DNSRecord) string {
+	if record == nil {
+		return ""
+	}
+	data, err := json.Marshal(toRecordSnapshot(record))
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// validateDNSRecord checks that a record is well formed for its type
+func validateDNSRecord(record *models.DNSRecord) error {
+	v := apperrors.NewValidation()
+	if record.Name == "" {
+		v.Add("name", "record name is required")
+	}
+	if record.Value == "" {
+		v.Add("value", "record value is required")
+	}
+	if record.TTL <= 0 {
+		v.Add("ttl", "record TTL must be positive")
+	}
+
+	switch record.Type {
+	case "A":
+		if ip := net.ParseIP(record.Value); record.Value != "" && (ip == nil || ip.To4() == nil) {
+			v.Add("value", "A record value must be an IPv4 address")
+		}
+	case "AAAA":
+		if ip := net.ParseIP(record.Value); record.Value != "" && (ip == nil || ip.To4() != nil) {
+			v.Add("value", "AAAA record value must be an IPv6 address")
+		}
+	case "MX":
+		if record.Priority == nil {
+			v.Add("priority", "MX record requires a priority")
+		}
+	case "NS":
+		if record.Value != "" && !validNameserver(record.Value) {
+			v.AddCode("value", "dns.nameserver_invalid", map[string]string{"name": record.Value})
+		}
+	case "SOA":
+		if len(strings.Fields(record.Value)) != 2 {
+			v.Add("value", "SOA record value must be the primary nameserver and the contact")
+		}
+	case "CNAME", "TXT", "SRV", "CAA":
+	default:
+		v.Add("type", fmt.Sprintf("unsupported record type: %s", record.Type))
+	}
+
+	return v.Err()
+}
@@ -0,0 +1,249 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// maxBulkDelete bounds the records a single bulk delete may remove
+const maxBulkDelete = 500
+
+// bulkDeleteTTL is how long a bulk delete preview can be confirmed for
+const bulkDeleteTTL = 5 * time.Minute
+
+// DNSBulkDelete is the outcome of a bulk delete: a preview with the token confirming it, or the
+// records that were deleted
+type DNSBulkDelete struct {
+	Records []*models.DNSRecord `json:"records"`
+	// Protected lists the apex, NS and SOA records among Records; deleting them needs force
+	Protected    []*models.DNSRecord `json:"protected"`
+	Force        bool                `json:"force"`
+	ConfirmToken string              `json:"confirm_token,omitempty"`
+	ExpiresAt    *time.Time          `json:"expires_at,omitempty"`
+	Deleted      bool                `json:"deleted"`
+}
+
+// pendingBulkDelete is a previewed bulk delete waiting for confirmation
+type pendingBulkDelete struct {
+	DomainID  uuid.UUID   `json:"domain_id"`
+	UserID    *uuid.UUID  `json:"user_id"`
+	RecordIDs []uuid.UUID `json:"record_ids"`
+	Force     bool        `json:"force"`
+}
+
+// BulkDelete deletes several records of a domain in two steps. Without a confirm token it only
+// previews the deletion and returns a token; the same request repeated with that token deletes
+// the records in one transaction. A token confirms exactly the records and force flag it was
+// issued for, for the same user, and can be used once. Apex, NS and SOA records are refused
+// unless force is set.
+func (s *DNSService) BulkDelete(ctx context.Context, domainID uuid.UUID, recordIDs []uuid.UUID, confirmToken string, force bool) (*DNSBulkDelete, error) {
+	domain, err := s.domains.ownedDomain(ctx, domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	recordIDs = uniqueRecordIDs(recordIDs)
+	switch {
+	case len(recordIDs) == 0:
+		return nil, apperrors.InvalidCode("record_ids", "dns.bulk_empty", nil)
+	case len(recordIDs) > maxBulkDelete:
+		return nil, apperrors.InvalidCode("record_ids", "dns.bulk_too_many", map[string]string{"max": strconv.Itoa(maxBulkDelete)})
+	}
+
+	if confirmToken == "" {
+		return s.previewBulkDelete(ctx, domain, recordIDs, force)
+	}
+
+	if err := s.claimBulkDelete(ctx, confirmToken, pendingBulkDelete{
+		DomainID:  domainID,
+		UserID:    actorFromContext(ctx),
+		RecordIDs: recordIDs,
+		Force:     force,
+	}); err != nil {
+		return nil, err
+	}
+
+	result := &DNSBulkDelete{Force: force, Deleted: true}
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Checked again, since the zone may have changed since the preview
+		records, err := bulkDeleteRecords(tx, domain, recordIDs, force)
+		if err != nil {
+			return err
+		}
+		result.Records = records
+		result.Protected = protectedRecords(records, domain.Name)
+
+		if err := tx.Where("domain_id = ? AND id IN ?", domainID, recordIDs).Delete(&models.DNSRecord{}).Error; err != nil {
+			return err
+		}
+		if touchesNameservers(records...) {
+			var zone []*models.DNSRecord
+			if err := tx.Where("domain_id = ?", domainID).Find(&zone).Error; err != nil {
+				return err
+			}
+			if err := checkNameservers(zone, domain.Name, records...); err != nil {
+				return err
+			}
+		}
+		return s.recordVersion(ctx, tx, domainID, "bulk_delete", nil, nil, nil)
+	}); err != nil {
+		return nil, fmt.Errorf("failed to delete DNS records: %w", err)
+	}
+
+	s.zoneChanged(ctx, domainID)
+
+	s.logger.Info("DNS records bulk deleted",
+		zap.String("domain", domain.Name),
+		zap.Int("records", len(result.Records)),
+		zap.Bool("force", force))
+
+	return result, nil
+}
+
+// previewBulkDelete lists the records a bulk delete would remove and issues the token confirming it
+func (s *DNSService) previewBulkDelete(ctx context.Context, domain *models.Domain, recordIDs []uuid.UUID, force bool) (*DNSBulkDelete, error) {
+	records, err := bulkDeleteRecords(s.db.WithContext(ctx), domain, recordIDs, force)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("failed to generate confirm token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	data, err := json.Marshal(pendingBulkDelete{
+		DomainID:  domain.ID,
+		UserID:    actorFromContext(ctx),
+		RecordIDs: recordIDs,
+		Force:     force,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode bulk delete: %w", err)
+	}
+	if err := s.redis.Set(ctx, bulkDeleteKey(token), data, bulkDeleteTTL).Err(); err != nil {
+		return nil, fmt.Errorf("failed to store bulk delete: %w", err)
+	}
+
+	expiresAt := time.Now().Add(bulkDeleteTTL)
+	return &DNSBulkDelete{
+		Records:      records,
+		Protected:    protectedRecords(records, domain.Name),
+		Force:        force,
+		ConfirmToken: token,
+		ExpiresAt:    &expiresAt,
+	}, nil
+}
+
+// claimBulkDelete consumes a confirm token, which must have been issued for want
+func (s *DNSService) claimBulkDelete(ctx context.Context, token string, want pendingBulkDelete) error {
+	data, err := s.redis.GetDel(ctx, bulkDeleteKey(token)).Result()
+	if errors.Is(err, redis.Nil) {
+		return apperrors.InvalidCode("confirm_token", "dns.bulk_token", nil)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load bulk delete: %w", err)
+	}
+
+	var pending pendingBulkDelete
+	if err := json.Unmarshal([]byte(data), &pending); err != nil {
+		return fmt.Errorf("failed to decode bulk delete: %w", err)
+	}
+	if !pending.matches(want) {
+		return apperrors.InvalidCode("confirm_token", "dns.bulk_mismatch", nil)
+	}
+
+	return nil
+}
+
+// matches reports whether a pending bulk delete is for the same domain, user, records and force
+// flag as other. Record IDs are compared in order, so both must come from uniqueRecordIDs.
+func (p pendingBulkDelete) matches(other pendingBulkDelete) bool {
+	if p.DomainID != other.DomainID || p.Force != other.Force || len(p.RecordIDs) != len(other.RecordIDs) {
+		return false
+	}
+	if (p.UserID == nil) != (other.UserID == nil) || (p.UserID != nil && *p.UserID != *other.UserID) {
+		return false
+	}
+	for i := range p.RecordIDs {
+		if p.RecordIDs[i] != other.RecordIDs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// bulkDeleteRecords loads the records of a bulk delete. Every ID must name a record of the domain,
+// and protected records are refused unless force is set.
+func bulkDeleteRecords(db *gorm.DB, domain *models.Domain, recordIDs []uuid.UUID, force bool) ([]*models.DNSRecord, error) {
+	var records []*models.DNSRecord
+	if err := db.Where("domain_id = ? AND id IN ?", domain.ID, recordIDs).
+		Order("name, type").
+		Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to get DNS records: %w", err)
+	}
+	if len(records) != len(recordIDs) {
+		return nil, apperrors.NotFound("DNS record")
+	}
+
+	if protected := protectedRecords(records, domain.Name); len(protected) > 0 && !force {
+		names := make([]string, len(protected))
+		for i, record := range protected {
+			names[i] = record.Type + " " + relativeName(record.Name, domain.Name)
+		}
+		return nil, apperrors.InvalidCode("force", "dns.bulk_protected", map[string]string{"records": strings.Join(names, ", ")})
+	}
+
+	return records, nil
+}
+
+// protectedRecords returns the records a bulk delete only removes when forced: records at the
+// apex and NS and SOA records, without which the domain stops resolving or is delegated away
+func protectedRecords(records []*models.DNSRecord, origin string) []*models.DNSRecord {
+	protected := []*models.DNSRecord{}
+	for _, record := range records {
+		if record.Type == "NS" || record.Type == "SOA" || relativeName(record.Name, origin) == "@" {
+			protected = append(protected, record)
+		}
+	}
+	return protected
+}
+
+// uniqueRecordIDs returns record IDs sorted and without duplicates
+func uniqueRecordIDs(ids []uuid.UUID) []uuid.UUID {
+	sorted := append([]uuid.UUID{}, ids...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].String() < sorted[j].String() })
+
+	unique := sorted[:0]
+	for i, id := range sorted {
+		if i == 0 || id != sorted[i-1] {
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+// bulkDeleteKey is the Redis key of a pending bulk delete; only a hash of the token is stored
+func bulkDeleteKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "dns:bulk_delete:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestUniqueRecordIDs(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+	if a.String() > b.String() {
+		a, b = b, a
+	}
+
+	got := uniqueRecordIDs([]uuid.UUID{b, a, b, a})
+	if len(got) != 2 || got[0] != a || got[1] != b {
+		t.Errorf("uniqueRecordIDs() = %v, want [%s %s]", got, a, b)
+	}
+}
+
+func TestProtectedRecords(t *testing.T) {
+	records := []*models.DNSRecord{
+		{Type: "A", Name: "@"},
+		{Type: "MX", Name: "shop.example."},
+		{Type: "NS", Name: "dev"},
+		{Type: "SOA", Name: "@"},
+		{Type: "A", Name: "www"},
+		{Type: "TXT", Name: "_dmarc"},
+	}
+
+	var got []string
+	for _, record := range protectedRecords(records, "shop.example") {
+		got = append(got, record.Type+" "+record.Name)
+	}
+	if want := "A @,MX shop.example.,NS dev,SOA @"; strings.Join(got, ",") != want {
+		t.Errorf("protectedRecords() = %v, want %s", got, want)
+	}
+}
+
+func TestBulkDelete(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	client, server := newTestRedis(t)
+	domains, _ := newTestDomainService(t, db, cfg)
+	dns := NewDNSService(db, client, zap.NewNop(), cfg, nil, domains)
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "shop.example")
+	ctx := asUser(owner.ID, "user")
+
+	record := func(recordType, name, value string) *models.DNSRecord {
+		r := &models.DNSRecord{DomainID: domain.ID, Type: recordType, Name: name, Value: value, TTL: 3600, IsActive: true}
+		mustCreate(t, db, r)
+		return r
+	}
+	apex := record("A", "@", "192.0.2.10")
+	www := record("A", "www", "192.0.2.10")
+	txt := record("TXT", "www", "v=spf1 -all")
+	ns1 := record("NS", "@", "ns1.host.example")
+	record("NS", "@", "ns2.host.example")
+	exists := func(r *models.DNSRecord) bool {
+		var count int64
+		db.Model(&models.DNSRecord{}).Where("id = ?", r.ID).Count(&count)
+		return count == 1
+	}
+
+	if _, err := dns.BulkDelete(ctx, domain.ID, nil, "", false); fieldMessage(err, "record_ids") == "" {
+		t.Errorf("empty selection: error = %v", err)
+	}
+	if _, err := dns.BulkDelete(ctx, domain.ID, []uuid.UUID{www.ID, uuid.New()}, "", false); apperrors.HTTPStatus(err) != http.StatusNotFound {
+		t.Errorf("unknown record: error = %v", err)
+	}
+
+	// The preview deletes nothing and its token only confirms the same selection
+	selection := []uuid.UUID{www.ID, txt.ID, www.ID}
+	preview, err := dns.BulkDelete(ctx, domain.ID, selection, "", false)
+	if err != nil {
+		t.Fatalf("preview: %v", err)
+	}
+	if len(preview.Records) != 2 || preview.ConfirmToken == "" || preview.Deleted || len(preview.Protected) != 0 {
+		t.Errorf("preview = %+v", preview)
+	}
+	if !exists(www) || !exists(txt) {
+		t.Fatal("preview deleted records")
+	}
+	if _, err := dns.BulkDelete(ctx, domain.ID, []uuid.UUID{www.ID}, preview.ConfirmToken, false); !strings.Contains(fieldMessage(err, "confirm_token"), "different selection") {
+		t.Errorf("token confirming another selection: error = %v", err)
+	}
+	if _, err := dns.BulkDelete(ctx, domain.ID, selection, preview.ConfirmToken, false); !strings.Contains(fieldMessage(err, "confirm_token"), "invalid or has expired") {
+		t.Errorf("token reused after a mismatch: error = %v", err)
+	}
+
+	// Tokens expire, and are bound to the user previewing
+	preview, _ = dns.BulkDelete(ctx, domain.ID, selection, "", false)
+	server.FastForward(bulkDeleteTTL + 1)
+	if _, err := dns.BulkDelete(ctx, domain.ID, selection, preview.ConfirmToken, false); !strings.Contains(fieldMessage(err, "confirm_token"), "expired") {
+		t.Errorf("expired token: error = %v", err)
+	}
+	preview, _ = dns.BulkDelete(ctx, domain.ID, selection, "", false)
+	if _, err := dns.BulkDelete(asUser(uuid.New(), "admin"), domain.ID, selection, preview.ConfirmToken, false); fieldMessage(err, "confirm_token") == "" {
+		t.Errorf("token of another user: error = %v", err)
+	}
+
+	preview, _ = dns.BulkDelete(ctx, domain.ID, selection, "", false)
+	deleted, err := dns.BulkDelete(ctx, domain.ID, selection, preview.ConfirmToken, false)
+	if err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+	if !deleted.Deleted || len(deleted.Records) != 2 || exists(www) || exists(txt) {
+		t.Errorf("confirmed delete = %+v", deleted)
+	}
+	zoneFile, _ := os.ReadFile(filepath.Join(cfg.ZoneDir, "shop.example.zone"))
+	if strings.Contains(string(zoneFile), "v=spf1") {
+		t.Errorf("zone file still holds deleted records:\n%s", zoneFile)
+	}
+
+	// Apex and NS records need force, and force still keeps two nameservers
+	if _, err := dns.BulkDelete(ctx, domain.ID, []uuid.UUID{apex.ID, ns1.ID}, "", false); !strings.Contains(fieldMessage(err, "force"), "A @, NS @") {
+		t.Errorf("protected records without force: error = %v", err)
+	}
+	preview, err = dns.BulkDelete(ctx, domain.ID, []uuid.UUID{apex.ID, ns1.ID}, "", true)
+	if err != nil || len(preview.Protected) != 2 {
+		t.Fatalf("forced preview = %+v, %v", preview, err)
+	}
+	if _, err := dns.BulkDelete(ctx, domain.ID, []uuid.UUID{apex.ID, ns1.ID}, preview.ConfirmToken, true); !strings.Contains(fieldMessage(err, "value"), "at least 2") {
+		t.Errorf("deleting one of two nameservers: error = %v", err)
+	}
+	if !exists(apex) || !exists(ns1) {
+		t.Error("a failed bulk delete removed records")
+	}
+
+	preview, _ = dns.BulkDelete(ctx, domain.ID, []uuid.UUID{apex.ID}, "", true)
+	if _, err := dns.BulkDelete(ctx, domain.ID, []uuid.UUID{apex.ID}, preview.ConfirmToken, true); err != nil || exists(apex) {
+		t.Errorf("forced delete of the apex record: %v", err)
+	}
+
+	other := createTestUser(t, db)
+	if _, err := dns.BulkDelete(asUser(other.ID, "user"), domain.ID, []uuid.UUID{ns1.ID}, "", true); err == nil {
+		t.Error("another user previewed deleting the records")
+	}
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// minNameservers is the number of nameservers an NS record set needs; resolvers need a second
+// server to fall back on
+const minNameservers = 2
+
+// nameserverTTL is the TTL of NS records the panel creates
+const nameserverTTL = 3600
+
+// validNameserver reports whether a value is a hostname that can be named in an NS record
+func validNameserver(value string) bool {
+	host := strings.ToLower(strings.TrimSuffix(value, "."))
+	return net.ParseIP(host) == nil && len(host) <= 253 && domainNamePattern.MatchString(host)
+}
+
+// relativeName returns a record name relative to its zone's origin, lower-cased, with "@" for the apex
+func relativeName(name, origin string) string {
+	name = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+	origin = strings.ToLower(origin)
+	switch {
+	case name == "" || name == "@" || name == origin:
+		return "@"
+	case strings.HasSuffix(name, "."+origin):
+		return strings.TrimSuffix(name, "."+origin)
+	}
+	return name
+}
+
+// touchesNameservers reports whether a change involves records the NS rules apply to
+func touchesNameservers(records ...*models.DNSRecord) bool {
+	for _, record := range records {
+		if record != nil && (record.Type == "NS" || record.Type == "CNAME") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkNameservers checks the names of the changed records in a zone, as it would be after the
+// change: an NS record set needs at least two nameservers, the apex cannot hold a CNAME and a
+// delegated name cannot also be a CNAME. Names the change does not touch are left alone, so a zone
+// that predates these rules only has to follow them once it is edited.
+func checkNameservers(zone []*models.DNSRecord, origin string, changed ...*models.DNSRecord) error {
+	checked := make(map[string]bool)
+	for _, record := range changed {
+		name := relativeName(record.Name, origin)
+		if checked[name] {
+			continue
+		}
+		checked[name] = true
+
+		nameservers, cnames := 0, 0
+		for _, current := range zone {
+			if !current.IsActive || relativeName(current.Name, origin) != name {
+				continue
+			}
+			switch current.Type {
+			case "NS":
+				nameservers++
+			case "CNAME":
+				cnames++
+			}
+		}
+
+		switch {
+		case name == "@" && cnames > 0:
+			return apperrors.InvalidCode("name", "dns.cname_apex", nil)
+		case nameservers > 0 && cnames > 0:
+			return apperrors.InvalidCode("name", "dns.cname_conflict", map[string]string{"name": name})
+		case nameservers > 0 && nameservers < minNameservers:
+			return apperrors.InvalidCode("value", "dns.ns_minimum", map[string]string{
+				"name": name,
+				"min":  strconv.Itoa(minNameservers),
+			})
+		}
+	}
+
+	return nil
+}
+
+// checkGlue requires an address record for each nameserver inside the name it serves, without
+// which resolvers could never reach it
+func checkGlue(zone []*models.DNSRecord, origin, name string, nameservers []string) error {
+	for _, nameserver := range nameservers {
+		host := relativeName(nameserver, origin)
+		if host != name && !strings.HasSuffix(host, "."+name) {
+			continue
+		}
+
+		glued := false
+		for _, record := range zone {
+			if record.IsActive && (record.Type == "A" || record.Type == "AAAA") && relativeName(record.Name, origin) == host {
+				glued = true
+				break
+			}
+		}
+		if !glued {
+			return apperrors.InvalidCode("nameservers", "dns.glue_required", map[string]string{"name": nameserver})
+		}
+	}
+
+	return nil
+}
+
+// SetNameservers replaces the NS records of a name in a domain's zone. At the apex ("@") it sets
+// the nameservers the domain is served from; for a name below it, it delegates that name to other
+// nameservers, and an empty list removes the delegation. Nameservers inside the delegated name need
+// an A or AAAA record in the zone to serve as glue.
+func (s *DNSService) SetNameservers(ctx context.Context, domainID uuid.UUID, name string, nameservers []string) ([]*models.DNSRecord, error) {
+	var domain models.Domain
+	if err := s.db.WithContext(ctx).Where("id = ?", domainID).First(&domain).Error; err != nil {
+		return nil, apperrors.FromDB(err, "domain")
+	}
+	if err := requireFeature(&domain, FeatureCustomDNS); err != nil {
+		return nil, err
+	}
+
+	name = relativeName(name, domain.Name)
+	if name != "@" {
+		for _, label := range strings.Split(name, ".") {
+			if !subdomainLabelPattern.MatchString(label) {
+				return nil, apperrors.InvalidCode("name", "subdomain.invalid", nil)
+			}
+		}
+	}
+
+	v := apperrors.NewValidation()
+	seen := make(map[string]bool)
+	hosts := make([]string, 0, len(nameservers))
+	for _, nameserver := range nameservers {
+		host := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(nameserver), "."))
+		if !validNameserver(host) {
+			v.AddCode("nameservers", "dns.nameserver_invalid", map[string]string{"name": nameserver})
+			continue
+		}
+		if !seen[host] {
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+	}
+	if len(hosts) < minNameservers && (name == "@" || len(hosts) > 0) {
+		v.AddCode("nameservers", "dns.ns_minimum", map[string]string{"name": name, "min": strconv.Itoa(minNameservers)})
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	records := make([]*models.DNSRecord, 0, len(hosts))
+	for _, host := range hosts {
+		records = append(records, &models.DNSRecord{
+			DomainID: domainID,
+			Type:     "NS",
+			Name:     name,
+			Value:    host,
+			TTL:      s.clampTTL(nameserverTTL),
+			IsActive: true,
+		})
+	}
+
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var zone []*models.DNSRecord
+		if err := tx.Where("domain_id = ?", domainID).Find(&zone).Error; err != nil {
+			return err
+		}
+
+		var replaced []*models.DNSRecord
+		for _, record := range zone {
+			if record.Type == "NS" && relativeName(record.Name, domain.Name) == name {
+				replaced = append(replaced, record)
+			}
+		}
+		zone = append(withoutRecords(zone, replaced), records...)
+
+		if err := checkNameservers(zone, domain.Name, &models.DNSRecord{Name: name}); err != nil {
+			return err
+		}
+		if name != "@" {
+			if err := checkGlue(zone, domain.Name, name, hosts); err != nil {
+				return err
+			}
+		}
+		if err := s.checkRecordLimits(zone, records); err != nil {
+			return err
+		}
+
+		for _, record := range replaced {
+			if err := tx.Where("id = ?", record.ID).Delete(&models.DNSRecord{}).Error; err != nil {
+				return err
+			}
+		}
+		for _, record := range records {
+			if err := tx.Create(record).Error; err != nil {
+				return err
+			}
+		}
+		return s.recordVersion(ctx, tx, domainID, "set_nameservers", nil, nil, nil)
+	}); err != nil {
+		return nil, fmt.Errorf("failed to set nameservers: %w", err)
+	}
+
+	s.zoneChanged(ctx, domainID)
+
+	s.logger.Info("Nameservers set",
+		zap.String("domain", domain.Name),
+		zap.String("name", name),
+		zap.Strings("nameservers", hosts))
+
+	return records, nil
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestRelativeName(t *testing.T) {
+	tests := []struct{ name, want string }{
+		{"@", "@"},
+		{"", "@"},
+		{"shop.example.", "@"},
+		{"Shop.Example", "@"},
+		{"dev", "dev"},
+		{"dev.shop.example.", "dev"},
+		{"ns1.dev.shop.example", "ns1.dev"},
+		{"ns1.other.example", "ns1.other.example"},
+	}
+	for _, tt := range tests {
+		if got := relativeName(tt.name, "shop.example"); got != tt.want {
+			t.Errorf("relativeName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidNameserver(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"ns1.host.example", true},
+		{"NS1.Host.Example.", true},
+		{"ns1", false},
+		{"192.0.2.1", false},
+		{"2001:db8::1", false},
+		{"ns_1.host.example", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := validNameserver(tt.value); got != tt.want {
+			t.Errorf("validNameserver(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestCheckNameservers(t *testing.T) {
+	record := func(recordType, name string) *models.DNSRecord {
+		return &models.DNSRecord{Type: recordType, Name: name, Value: "x.example", IsActive: true}
+	}
+
+	tests := []struct {
+		name    string
+		zone    []*models.DNSRecord
+		changed *models.DNSRecord
+		want    string // Part of the field message, or "" when the zone is fine
+	}{
+		{"two nameservers", []*models.DNSRecord{record("NS", "dev"), record("NS", "dev.shop.example.")}, record("NS", "dev"), ""},
+		{"one nameserver", []*models.DNSRecord{record("NS", "dev")}, record("NS", "dev"), "at least 2 nameservers"},
+		{"inactive nameserver not counted", []*models.DNSRecord{record("NS", "dev"), {Type: "NS", Name: "dev", IsActive: false}}, record("NS", "dev"), "at least 2"},
+		{"CNAME at the apex", []*models.DNSRecord{record("CNAME", "@")}, record("CNAME", "shop.example"), "apex"},
+		{"CNAME at a delegated name", []*models.DNSRecord{record("NS", "dev"), record("NS", "dev"), record("CNAME", "dev")}, record("CNAME", "dev"), "both a CNAME"},
+		{"CNAME elsewhere", []*models.DNSRecord{record("NS", "dev"), record("NS", "dev"), record("CNAME", "www")}, record("CNAME", "www"), ""},
+		{"untouched legacy name", []*models.DNSRecord{record("NS", "old"), record("CNAME", "www")}, record("CNAME", "www"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkNameservers(tt.zone, "shop.example", tt.changed)
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("checkNameservers() error = %v", err)
+				}
+				return
+			}
+			var message string
+			for _, field := range []string{"name", "value"} {
+				message += fieldMessage(err, field)
+			}
+			if !strings.Contains(message, tt.want) {
+				t.Errorf("checkNameservers() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetNameservers(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	dns, _ := newTestDNSService(t, db, cfg)
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "shop.example")
+	ctx := asUser(owner.ID, "user")
+	countNS := func(name string) int64 {
+		var count int64
+		db.Model(&models.DNSRecord{}).Where("domain_id = ? AND type = ? AND name = ?", domain.ID, "NS", name).Count(&count)
+		return count
+	}
+
+	if _, err := dns.SetNameservers(ctx, domain.ID, "@", []string{"ns1.host.example"}); !strings.Contains(fieldMessage(err, "nameservers"), "at least 2") {
+		t.Errorf("single apex nameserver: error = %v", err)
+	}
+	if _, err := dns.SetNameservers(ctx, domain.ID, "dev", []string{"ns1.other.example", "192.0.2.53"}); !strings.Contains(fieldMessage(err, "nameservers"), "fully qualified") {
+		t.Errorf("IP address as nameserver: error = %v", err)
+	}
+	if _, err := dns.SetNameservers(ctx, domain.ID, "bad_label", []string{"ns1.other.example", "ns2.other.example"}); fieldMessage(err, "name") == "" {
+		t.Errorf("invalid delegated name: error = %v", err)
+	}
+
+	// Duplicates collapse, and nameservers inside the delegation need glue
+	records, err := dns.SetNameservers(ctx, domain.ID, "dev.shop.example.", []string{"NS1.Other.Example.", "ns1.other.example", "ns2.other.example"})
+	if err != nil {
+		t.Fatalf("delegate dev: %v", err)
+	}
+	if len(records) != 2 || records[0].Name != "dev" || records[0].Value != "ns1.other.example" {
+		t.Errorf("delegation records = %+v", records)
+	}
+	zoneFile, err := os.ReadFile(filepath.Join(cfg.ZoneDir, "shop.example.zone"))
+	if err != nil || !strings.Contains(string(zoneFile), "dev\t3600\tIN\tNS\tns2.other.example.") {
+		t.Errorf("zone file lacks the delegation (%v):\n%s", err, zoneFile)
+	}
+
+	if _, err := dns.SetNameservers(ctx, domain.ID, "lab", []string{"ns1.lab.shop.example", "ns2.other.example"}); !strings.Contains(fieldMessage(err, "nameservers"), "needs an A or AAAA") {
+		t.Errorf("nameserver inside the delegation without glue: error = %v", err)
+	}
+	mustCreate(t, db, &models.DNSRecord{DomainID: domain.ID, Type: "A", Name: "ns1.lab", Value: "192.0.2.53", TTL: 3600, IsActive: true})
+	if _, err := dns.SetNameservers(ctx, domain.ID, "lab", []string{"ns1.lab.shop.example", "ns2.other.example"}); err != nil {
+		t.Errorf("nameserver with glue: %v", err)
+	}
+
+	// A delegated name cannot also be a CNAME, and its NS set cannot drop below two
+	if _, err := dns.CreateDNSRecord(ctx, domain.ID, "CNAME", "dev", "shop.example", 3600, nil); !strings.Contains(fieldMessage(err, "name"), "both a CNAME") {
+		t.Errorf("CNAME at a delegated name: error = %v", err)
+	}
+	if _, err := dns.CreateDNSRecord(ctx, domain.ID, "CNAME", "@", "other.example", 3600, nil); !strings.Contains(fieldMessage(err, "name"), "apex") {
+		t.Errorf("CNAME at the apex: error = %v", err)
+	}
+	if err := dns.DeleteDNSRecord(ctx, records[0].ID); err == nil {
+		t.Error("deleting one of two nameservers succeeded")
+	}
+	if countNS("dev") != 2 {
+		t.Errorf("%d NS records for dev, want 2", countNS("dev"))
+	}
+
+	// An empty list removes the delegation
+	if _, err := dns.SetNameservers(ctx, domain.ID, "dev", nil); err != nil {
+		t.Fatalf("remove delegation: %v", err)
+	}
+	if countNS("dev") != 0 {
+		t.Errorf("%d NS records left for dev", countNS("dev"))
+	}
+}
+
+func TestCreateDomainAddsNameservers(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	cfg.Nameservers = []string{"ns1.host.example.", "NS2.host.example"}
+	domains, _ := newTestDomainService(t, db, cfg)
+	owner := createTestUser(t, db)
+
+	domain, err := domains.CreateDomain(asUser(owner.ID), owner.ID, "new.example", nil)
+	if err != nil {
+		t.Fatalf("CreateDomain() error = %v", err)
+	}
+
+	var records []models.DNSRecord
+	db.Where("domain_id = ? AND type = ?", domain.ID, "NS").Order("value").Find(&records)
+	if len(records) != 2 || records[0].Value != "ns1.host.example" || records[1].Value != "ns2.host.example" || records[0].Name != "@" {
+		t.Errorf("NS records = %+v", records)
+	}
+
+	zoneFile, err := os.ReadFile(filepath.Join(cfg.ZoneDir, "new.example.zone"))
+	if err != nil || !strings.Contains(string(zoneFile), "IN\tSOA\tns1.host.example. hostmaster.new.example.") {
+		t.Errorf("zone file lacks the SOA (%v):\n%s", err, zoneFile)
+	}
+}
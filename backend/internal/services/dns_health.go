@@ -0,0 +1,547 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// Severities of zone health findings
+const (
+	SeverityError   = "error"   // Breaks resolution or mail delivery
+	SeverityWarning = "warning" // Works, but is likely to cause problems
+	SeverityInfo    = "info"
+)
+
+// maxHealthLookups bounds the DNS lookups of one zone health check, so a zone with many records
+// pointing out of it cannot keep the check running
+const maxHealthLookups = 50
+
+// spfLookupLimit is the number of DNS lookups an SPF evaluation may take before receivers treat
+// the record as broken (RFC 7208 section 4.6.4)
+const spfLookupLimit = 10
+
+// ZoneHealthReport is the result of checking a domain's whole zone
+type ZoneHealthReport struct {
+	Domain    string               `json:"domain"`
+	Healthy   bool                 `json:"healthy"` // No finding is an error
+	Errors    int                  `json:"errors"`
+	Warnings  int                  `json:"warnings"`
+	Findings  []*ZoneHealthFinding `json:"findings"`
+	CheckedAt time.Time            `json:"checked_at"`
+}
+
+// ZoneHealthFinding is a problem, or a note, found by a zone health check
+type ZoneHealthFinding struct {
+	Check    string     `json:"check"` // syntax, cname, ns, apex, mx, spf, dkim, dmarc or lookup
+	Severity string     `json:"severity"`
+	Name     string     `json:"name,omitempty"` // Owner name relative to the zone, "@" at the apex
+	RecordID *uuid.UUID `json:"record_id,omitempty"`
+	Message  string     `json:"message"`
+}
+
+// zoneHealth holds the state of one zone health check
+type zoneHealth struct {
+	resolver Resolver
+	origin   string
+	records  []*models.DNSRecord            // Active records only
+	byName   map[string][]*models.DNSRecord // Active records by relative owner name
+	lookups  int
+	report   *ZoneHealthReport
+}
+
+// ZoneHealthCheck checks a domain's zone as a whole, such as after a migration: the syntax of
+// every record, CNAMEs without a target or sharing their name, the nameservers and whether the
+// domain is delegated to them, whether the apex resolves to the addresses in the zone, and the
+// MX, SPF, DKIM and DMARC records mail depends on. Problems are findings of the report, not
+// errors.
+func (s *DNSService) ZoneHealthCheck(ctx context.Context, domainID uuid.UUID) (*ZoneHealthReport, error) {
+	var domain models.Domain
+	if err := s.db.WithContext(ctx).Preload("Node").Where("id = ?", domainID).First(&domain).Error; err != nil {
+		return nil, apperrors.FromDB(err, "domain")
+	}
+
+	if err := authorizeDomain(ctx, &domain); err != nil {
+		return nil, err
+	}
+
+	var records []*models.DNSRecord
+	if err := s.db.WithContext(ctx).Where("domain_id = ?", domainID).Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to get DNS records: %w", err)
+	}
+
+	h := newZoneHealth(s.domains.resolver, domain.Name, records)
+	h.checkSyntax()
+	h.checkCNAMEs(ctx)
+	h.checkNameservers(ctx, s.config.Nameservers)
+	ipv4, ipv6 := s.domains.serverIPs(&domain)
+	h.checkApex(ctx, ipv4, ipv6)
+	if domain.EmailEnabled || len(h.named("@", "MX")) > 0 {
+		h.checkMX(ctx, domain.EmailEnabled)
+		h.checkSPF()
+		h.checkDKIM()
+		h.checkDMARC()
+	}
+
+	report := h.finish()
+	s.logger.Info("DNS zone health checked",
+		zap.String("domain", domain.Name),
+		zap.Int("errors", report.Errors),
+		zap.Int("warnings", report.Warnings))
+
+	return report, nil
+}
+
+// newZoneHealth prepares a health check of the active records of a zone
+func newZoneHealth(resolver Resolver, origin string, records []*models.DNSRecord) *zoneHealth {
+	h := &zoneHealth{
+		resolver: resolver,
+		origin:   strings.ToLower(origin),
+		byName:   make(map[string][]*models.DNSRecord),
+		report:   &ZoneHealthReport{Domain: origin, Findings: []*ZoneHealthFinding{}},
+	}
+	for _, record := range records {
+		if !record.IsActive {
+			continue
+		}
+		h.records = append(h.records, record)
+		name := relativeName(record.Name, origin)
+		h.byName[name] = append(h.byName[name], record)
+	}
+	return h
+}
+
+// add records a finding, about a record when one is given
+func (h *zoneHealth) add(check, severity, name string, record *models.DNSRecord, format string, args ...interface{}) {
+	finding := &ZoneHealthFinding{
+		Check:    check,
+		Severity: severity,
+		Name:     name,
+		Message:  fmt.Sprintf(format, args...),
+	}
+	if record != nil {
+		id := record.ID
+		finding.RecordID = &id
+	}
+	h.report.Findings = append(h.report.Findings, finding)
+}
+
+// finish orders the findings by severity and counts them
+func (h *zoneHealth) finish() *ZoneHealthReport {
+	rank := map[string]int{SeverityError: 0, SeverityWarning: 1, SeverityInfo: 2}
+	sort.SliceStable(h.report.Findings, func(i, j int) bool {
+		return rank[h.report.Findings[i].Severity] < rank[h.report.Findings[j].Severity]
+	})
+	for _, finding := range h.report.Findings {
+		switch finding.Severity {
+		case SeverityError:
+			h.report.Errors++
+		case SeverityWarning:
+			h.report.Warnings++
+		}
+	}
+	h.report.Healthy = h.report.Errors == 0
+	h.report.CheckedAt = time.Now()
+	return h.report
+}
+
+// names returns the relative owner names of the zone, sorted
+func (h *zoneHealth) names() []string {
+	names := make([]string, 0, len(h.byName))
+	for name := range h.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// named returns the records of a type at a relative name
+func (h *zoneHealth) named(name, recordType string) []*models.DNSRecord {
+	var records []*models.DNSRecord
+	for _, record := range h.byName[name] {
+		if record.Type == recordType {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// txt returns the TXT records at a relative name whose data starts with prefix, ignoring case,
+// with their data unquoted
+func (h *zoneHealth) txt(name, prefix string) (records []*models.DNSRecord, values []string) {
+	for _, record := range h.named(name, "TXT") {
+		value := unquoteTXT(record.Value)
+		if strings.HasPrefix(strings.ToLower(value), prefix) {
+			records = append(records, record)
+			values = append(values, value)
+		}
+	}
+	return records, values
+}
+
+// lookup counts a DNS lookup against maxHealthLookups, noting once when the limit is reached
+func (h *zoneHealth) lookup() bool {
+	h.lookups++
+	if h.lookups == maxHealthLookups+1 {
+		h.add("lookup", SeverityInfo, "", nil, "Stopped looking up names outside the zone after %d lookups; the remaining ones were not checked", maxHealthLookups)
+	}
+	return h.lookups <= maxHealthLookups
+}
+
+// target resolves the host name in a record's data to a fully qualified name without the
+// trailing dot, as the zone is rendered: names without a dot are relative to the origin
+func (h *zoneHealth) target(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch {
+	case value == "@":
+		return h.origin
+	case !strings.HasSuffix(value, ".") && !strings.Contains(value, "."):
+		return value + "." + h.origin
+	}
+	return strings.TrimSuffix(value, ".")
+}
+
+// inZone reports whether a fully qualified name belongs to the zone
+func (h *zoneHealth) inZone(host string) bool {
+	return host == h.origin || strings.HasSuffix(host, "."+h.origin)
+}
+
+// checkSyntax validates every active record as record changes are validated
+func (h *zoneHealth) checkSyntax() {
+	for _, record := range h.records {
+		name := relativeName(record.Name, h.origin)
+		if err := validateDNSRecord(record); err != nil {
+			h.add("syntax", SeverityError, name, record, "%s %s record is invalid: %v", name, record.Type, err)
+			continue
+		}
+		switch record.Type {
+		case "CNAME", "MX", "NS":
+			if net.ParseIP(strings.TrimSuffix(record.Value, ".")) != nil {
+				h.add("syntax", SeverityError, name, record, "%s %s record names the address %s; it must name a host", name, record.Type, record.Value)
+			}
+		}
+	}
+}
+
+// checkCNAMEs finds CNAMEs at the apex or beside other records, which resolvers ignore or
+// reject, and CNAMEs whose target does not exist: a dangling CNAME to a released cloud resource
+// lets whoever claims it next serve content under the domain
+func (h *zoneHealth) checkCNAMEs(ctx context.Context) {
+	for _, name := range h.names() {
+		cnames := h.named(name, "CNAME")
+		if len(cnames) == 0 {
+			continue
+		}
+		switch {
+		case name == "@":
+			h.add("cname", SeverityError, name, cnames[0], "The apex cannot be a CNAME; it must hold the zone's SOA and NS records")
+		case len(cnames) > 1:
+			h.add("cname", SeverityError, name, cnames[1], "%s has %d CNAME records; a name can only be an alias of one target", name, len(cnames))
+		case len(h.byName[name]) > len(cnames):
+			h.add("cname", SeverityError, name, cnames[0], "%s is a CNAME and also has other records, which resolvers ignore", name)
+		}
+
+		for _, cname := range cnames {
+			h.checkCNAMETarget(ctx, name, cname)
+		}
+	}
+}
+
+// checkCNAMETarget checks that a CNAME's target exists, in the zone or by looking it up
+func (h *zoneHealth) checkCNAMETarget(ctx context.Context, name string, cname *models.DNSRecord) {
+	target := h.target(cname.Value)
+	if h.inZone(target) {
+		targetName := relativeName(target, h.origin)
+		switch {
+		case targetName == name:
+			h.add("cname", SeverityError, name, cname, "%s is a CNAME of itself", name)
+		case len(h.byName[targetName]) == 0:
+			h.add("cname", SeverityError, name, cname, "%s points at %s, which has no records in the zone", name, target)
+		case len(h.named(targetName, "CNAME")) > 0:
+			h.add("cname", SeverityWarning, name, cname, "%s points at %s, which is a CNAME itself; point it at the final target", name, target)
+		}
+		return
+	}
+
+	if !h.lookup() {
+		return
+	}
+	if _, err := h.resolver.LookupIPAddr(ctx, target); err != nil {
+		if dnsNotFound(err) {
+			h.add("cname", SeverityError, name, cname, "%s points at %s, which does not resolve; remove the record or whoever claims %s controls %s", name, target, target, name)
+		} else {
+			h.add("cname", SeverityWarning, name, cname, "The target %s of %s could not be looked up: %v", target, name, err)
+		}
+	}
+}
+
+// checkNameservers checks the zone's own NS records and delegations, and that the registry
+// delegates the domain to the nameservers the zone lists
+func (h *zoneHealth) checkNameservers(ctx context.Context, configured []string) {
+	apex := h.named("@", "NS")
+	switch {
+	case len(apex) == 0:
+		h.add("ns", SeverityError, "@", nil, "The zone has no NS records at the apex")
+	case len(apex) < minNameservers:
+		h.add("ns", SeverityError, "@", apex[0], "The zone lists %d nameserver; at least %d are needed for resolvers to fall back on", len(apex), minNameservers)
+	}
+
+	listed := make(map[string]bool, len(apex))
+	hosts := make([]string, 0, len(apex))
+	for _, record := range apex {
+		host := h.target(record.Value)
+		listed[host] = true
+		hosts = append(hosts, host)
+	}
+	for _, nameserver := range configured {
+		host := strings.ToLower(strings.TrimSuffix(nameserver, "."))
+		if len(apex) > 0 && !listed[host] {
+			h.add("ns", SeverityWarning, "@", nil, "The zone does not list %s, one of the nameservers serving it", host)
+		}
+	}
+
+	for _, name := range h.names() {
+		delegated := h.named(name, "NS")
+		if name == "@" || len(delegated) == 0 {
+			continue
+		}
+		if len(delegated) < minNameservers {
+			h.add("ns", SeverityError, name, delegated[0], "%s is delegated to %d nameserver; at least %d are needed", name, len(delegated), minNameservers)
+		}
+		servers := make([]string, len(delegated))
+		for i, record := range delegated {
+			servers[i] = record.Value
+		}
+		if err := checkGlue(h.records, h.origin, name, servers); err != nil {
+			h.add("ns", SeverityError, name, delegated[0], "A nameserver inside %s has no A or AAAA record in the zone to serve as glue", name)
+		}
+	}
+
+	if len(apex) == 0 || !h.lookup() {
+		return
+	}
+	delegation, err := h.resolver.LookupNS(ctx, h.origin)
+	if err != nil {
+		if dnsNotFound(err) {
+			h.add("ns", SeverityError, "@", nil, "%s is not delegated: the registry has no nameservers for it", h.origin)
+		} else {
+			h.add("ns", SeverityWarning, "@", nil, "The delegation of %s could not be looked up: %v", h.origin, err)
+		}
+		return
+	}
+
+	delegated := make([]string, len(delegation))
+	matched := 0
+	for i, ns := range delegation {
+		delegated[i] = strings.ToLower(strings.TrimSuffix(ns.Host, "."))
+		if listed[delegated[i]] {
+			matched++
+		}
+	}
+	sort.Strings(delegated)
+	sort.Strings(hosts)
+	switch {
+	case matched == 0:
+		h.add("ns", SeverityError, "@", nil, "%s is delegated to %s, none of which the zone lists (%s); changes to this zone have no effect", h.origin, strings.Join(delegated, ", "), strings.Join(hosts, ", "))
+	case matched < len(delegated) || matched < len(hosts):
+		h.add("ns", SeverityWarning, "@", nil, "%s is delegated to %s, but the zone lists %s; make them match at the registrar or in the zone", h.origin, strings.Join(delegated, ", "), strings.Join(hosts, ", "))
+	}
+}
+
+// checkApex checks that the apex has addresses pointing at the server, and that they resolve:
+// a mismatch after a migration means the change has not propagated or the domain is served
+// from elsewhere
+func (h *zoneHealth) checkApex(ctx context.Context, ipv4, ipv6 string) {
+	a, aaaa := h.named("@", "A"), h.named("@", "AAAA")
+	if len(a) == 0 && len(aaaa) == 0 {
+		h.add("apex", SeverityError, "@", nil, "The apex has no A or AAAA record; %s does not resolve", h.origin)
+		return
+	}
+
+	expected := make(map[string]bool)
+	pointsHere := false
+	for _, record := range append(append([]*models.DNSRecord{}, a...), aaaa...) {
+		if ip := net.ParseIP(record.Value); ip != nil {
+			expected[ip.String()] = true
+		}
+		pointsHere = pointsHere || sameIP(record.Value, ipv4) || sameIP(record.Value, ipv6)
+	}
+	if !pointsHere {
+		h.add("apex", SeverityWarning, "@", nil, "No apex address record points at this server (%s)", strings.Trim(ipv4+" "+ipv6, " "))
+	}
+	if ipv6 != "" && len(aaaa) == 0 {
+		h.add("apex", SeverityInfo, "@", nil, "The apex has no AAAA record; %s is not reachable over IPv6", h.origin)
+	}
+
+	if !h.lookup() {
+		return
+	}
+	addrs, err := h.resolver.LookupIPAddr(ctx, h.origin)
+	if err != nil {
+		if dnsNotFound(err) {
+			h.add("apex", SeverityError, "@", nil, "%s does not resolve yet; the zone may not have propagated", h.origin)
+		} else {
+			h.add("apex", SeverityWarning, "@", nil, "%s could not be looked up: %v", h.origin, err)
+		}
+		return
+	}
+	resolved := make([]string, 0, len(addrs))
+	stale := false
+	for _, addr := range addrs {
+		resolved = append(resolved, addr.IP.String())
+		stale = stale || !expected[addr.IP.String()]
+	}
+	if stale {
+		h.add("apex", SeverityWarning, "@", nil, "%s resolves to %s, which the zone does not hold; the change is still propagating or the domain is served from elsewhere", h.origin, strings.Join(resolved, ", "))
+	}
+}
+
+// checkMX checks that the domain receives mail and that every MX host exists. Mail to an MX
+// naming an alias or an address is rejected by many senders.
+func (h *zoneHealth) checkMX(ctx context.Context, emailEnabled bool) {
+	records := h.named("@", "MX")
+	if len(records) == 0 {
+		if emailEnabled {
+			h.add("mx", SeverityError, "@", nil, "The apex has no MX record; mail to %s cannot be delivered", h.origin)
+		}
+		return
+	}
+
+	for _, record := range records {
+		target := h.target(record.Value)
+		if net.ParseIP(target) != nil {
+			continue // Reported by checkSyntax
+		}
+		if h.inZone(target) {
+			targetName := relativeName(target, h.origin)
+			switch {
+			case len(h.named(targetName, "CNAME")) > 0:
+				h.add("mx", SeverityError, "@", record, "The MX host %s is a CNAME; an MX must name a host with A or AAAA records", target)
+			case len(h.named(targetName, "A")) == 0 && len(h.named(targetName, "AAAA")) == 0:
+				h.add("mx", SeverityError, "@", record, "The MX host %s has no A or AAAA record in the zone", target)
+			}
+			continue
+		}
+
+		if !h.lookup() {
+			continue
+		}
+		if _, err := h.resolver.LookupIPAddr(ctx, target); err != nil {
+			if dnsNotFound(err) {
+				h.add("mx", SeverityError, "@", record, "The MX host %s does not resolve", target)
+			} else {
+				h.add("mx", SeverityWarning, "@", record, "The MX host %s could not be looked up: %v", target, err)
+			}
+		}
+	}
+}
+
+// checkSPF checks that the apex has one SPF record, ending in a policy that restricts senders
+// and within the lookup limit
+func (h *zoneHealth) checkSPF() {
+	records, values := h.txt("@", "v=spf1")
+	switch {
+	case len(records) == 0:
+		h.add("spf", SeverityWarning, "@", nil, "No SPF record: receivers cannot tell which servers may send mail for %s", h.origin)
+		return
+	case len(records) > 1:
+		h.add("spf", SeverityError, "@", records[1], "The apex has %d SPF records, which makes SPF fail everywhere; merge them into one", len(records))
+		return
+	}
+
+	record, terms := records[0], strings.Fields(strings.ToLower(values[0]))
+	last := terms[len(terms)-1]
+	switch {
+	case last == "+all" || last == "all":
+		h.add("spf", SeverityError, "@", record, "The SPF record lets any server send mail as %s; end it with ~all or -all", h.origin)
+	case last == "?all" || !strings.HasSuffix(last, "all") && !strings.HasPrefix(last, "redirect="):
+		h.add("spf", SeverityWarning, "@", record, "The SPF record does not tell receivers to reject other servers; end it with ~all or -all")
+	}
+
+	lookups := 0
+	for _, term := range terms {
+		term = strings.TrimLeft(term, "+-~?")
+		switch {
+		case term == "a", term == "mx", term == "ptr",
+			strings.HasPrefix(term, "a:"), strings.HasPrefix(term, "a/"), strings.HasPrefix(term, "mx:"), strings.HasPrefix(term, "mx/"),
+			strings.HasPrefix(term, "ptr:"), strings.HasPrefix(term, "include:"), strings.HasPrefix(term, "exists:"), strings.HasPrefix(term, "redirect="):
+			lookups++
+		}
+		if term == "ptr" || strings.HasPrefix(term, "ptr:") {
+			h.add("spf", SeverityWarning, "@", record, "The SPF record uses the ptr mechanism, which is deprecated and ignored by some receivers")
+		}
+	}
+	if lookups > spfLookupLimit {
+		h.add("spf", SeverityError, "@", record, "The SPF record needs %d DNS lookups; receivers give up after %d", lookups, spfLookupLimit)
+	}
+}
+
+// checkDKIM checks the DKIM keys published in the zone
+func (h *zoneHealth) checkDKIM() {
+	found := false
+	for _, record := range h.records {
+		name := relativeName(record.Name, h.origin)
+		if record.Type != "TXT" || !strings.HasSuffix(name, "._domainkey") {
+			continue
+		}
+		found = true
+
+		tags := dkimTags(unquoteTXT(record.Value))
+		key, hasKey := tags["p"]
+		switch {
+		case tags["v"] != "" && tags["v"] != "DKIM1":
+			h.add("dkim", SeverityError, name, record, "The DKIM record at %s has version %q; it must be DKIM1", name, tags["v"])
+		case !hasKey:
+			h.add("dkim", SeverityError, name, record, "The DKIM record at %s has no public key (p=)", name)
+		case key == "":
+			h.add("dkim", SeverityInfo, name, record, "The DKIM key at %s is revoked (empty p=)", name)
+		case tags["k"] != "" && tags["k"] != "rsa" && tags["k"] != "ed25519":
+			h.add("dkim", SeverityWarning, name, record, "The DKIM key at %s has the unknown key type %q", name, tags["k"])
+		}
+	}
+	if !found {
+		h.add("dkim", SeverityWarning, "", nil, "No DKIM key is published at <selector>._domainkey; mail from %s cannot be DKIM-signed verifiably", h.origin)
+	}
+}
+
+// checkDMARC checks that the domain publishes one DMARC policy
+func (h *zoneHealth) checkDMARC() {
+	records, values := h.txt("_dmarc", "v=dmarc1")
+	switch {
+	case len(records) == 0:
+		h.add("dmarc", SeverityWarning, "_dmarc", nil, "No DMARC policy: receivers decide on their own what to do with mail failing SPF and DKIM")
+		return
+	case len(records) > 1:
+		h.add("dmarc", SeverityError, "_dmarc", records[1], "There are %d DMARC records, which makes receivers ignore all of them; keep one", len(records))
+		return
+	}
+
+	switch policy := strings.ToLower(dkimTags(values[0])["p"]); policy {
+	case "quarantine", "reject":
+	case "none":
+		h.add("dmarc", SeverityInfo, "_dmarc", records[0], "The DMARC policy only monitors (p=none); failing mail is still delivered")
+	case "":
+		h.add("dmarc", SeverityError, "_dmarc", records[0], "The DMARC record has no policy (p=)")
+	default:
+		h.add("dmarc", SeverityError, "_dmarc", records[0], "The DMARC policy p=%s is not none, quarantine or reject", policy)
+	}
+}
+
+// unquoteTXT returns the data of a TXT record without the quotes of a zone file, joining data
+// split into several strings
+func unquoteTXT(value string) string {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, `"`) || !strings.HasSuffix(value, `"`) || len(value) < 2 {
+		return value
+	}
+	return strings.ReplaceAll(value[1:len(value)-1], `" "`, "")
+}
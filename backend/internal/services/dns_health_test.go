@@ -0,0 +1,318 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// zoneDNS answers lookups of zone health checks from its maps; other names do not exist
+type zoneDNS struct {
+	hosts   map[string][]string
+	ns      map[string][]string
+	lookups int
+}
+
+func (d *zoneDNS) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	d.lookups++
+	addresses, ok := d.hosts[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	addrs := make([]net.IPAddr, len(addresses))
+	for i, address := range addresses {
+		addrs[i] = net.IPAddr{IP: net.ParseIP(address)}
+	}
+	return addrs, nil
+}
+
+func (d *zoneDNS) LookupTXT(_ context.Context, name string) ([]string, error) {
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func (d *zoneDNS) LookupNS(_ context.Context, name string) ([]*net.NS, error) {
+	d.lookups++
+	hosts, ok := d.ns[name]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	records := make([]*net.NS, len(hosts))
+	for i, host := range hosts {
+		records[i] = &net.NS{Host: host + "."}
+	}
+	return records, nil
+}
+
+// seedZone creates a domain owned by owner with the records given as "name type value", MX
+// records with priority 10
+func seedZone(t *testing.T, db *gorm.DB, owner *models.User, name string, records ...string) *models.Domain {
+	t.Helper()
+
+	domain := createTestDomain(t, db, owner, name)
+	for _, line := range records {
+		fields := strings.SplitN(line, " ", 3)
+		record := &models.DNSRecord{DomainID: domain.ID, Name: fields[0], Type: fields[1], Value: fields[2], TTL: 3600, IsActive: true}
+		if record.Type == "MX" {
+			priority := 10
+			record.Priority = &priority
+		}
+		mustCreate(t, db, record)
+	}
+	return domain
+}
+
+// finding returns the first finding of a check with a severity whose message contains text
+func finding(report *ZoneHealthReport, check, severity, text string) *ZoneHealthFinding {
+	for _, f := range report.Findings {
+		if f.Check == check && f.Severity == severity && strings.Contains(f.Message, text) {
+			return f
+		}
+	}
+	return nil
+}
+
+// newTestZoneHealth creates a DNS service whose zones are served by ns1 and ns2.panel.example
+// and whose lookups go to dns
+func newTestZoneHealth(t *testing.T, db *gorm.DB, dns *zoneDNS) *DNSService {
+	t.Helper()
+
+	cfg := testHostingConfig(t)
+	cfg.Nameservers = []string{"ns1.panel.example", "ns2.panel.example"}
+	service, domains := newTestDNSService(t, db, cfg)
+	domains.resolver = dns
+	return service
+}
+
+func TestZoneHealthCheckHealthyZone(t *testing.T) {
+	db := newTestDB(t)
+	dns := &zoneDNS{
+		hosts: map[string][]string{"good.example": {"192.0.2.10"}, "shop.example.net": {"203.0.113.4"}},
+		ns:    map[string][]string{"good.example": {"ns1.panel.example", "ns2.panel.example"}},
+	}
+	service := newTestZoneHealth(t, db, dns)
+	owner := createTestUser(t, db)
+	domain := seedZone(t, db, owner, "good.example",
+		"@ NS ns1.panel.example.",
+		"@ NS ns2.panel.example.",
+		"@ A 192.0.2.10",
+		"www CNAME @",
+		"shop CNAME shop.example.net.",
+		"mail A 192.0.2.10",
+		"@ MX mail",
+		"@ TXT v=spf1 mx -all",
+		`default._domainkey TXT "v=DKIM1; k=rsa; " "p=MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEA"`,
+		"_dmarc TXT v=DMARC1; p=reject; rua=mailto:postmaster@good.example",
+	)
+
+	report, err := service.ZoneHealthCheck(asUser(owner.ID, "user"), domain.ID)
+	if err != nil {
+		t.Fatalf("ZoneHealthCheck() error = %v", err)
+	}
+	if !report.Healthy || report.Errors != 0 || report.Warnings != 0 || len(report.Findings) != 0 {
+		for _, f := range report.Findings {
+			t.Logf("%s %s %s: %s", f.Severity, f.Check, f.Name, f.Message)
+		}
+		t.Errorf("report = %d errors, %d warnings, want a healthy zone", report.Errors, report.Warnings)
+	}
+}
+
+func TestZoneHealthCheckMisconfiguredZone(t *testing.T) {
+	db := newTestDB(t)
+	dns := &zoneDNS{
+		hosts: map[string][]string{"bad.example": {"203.0.113.9"}, "cdn.example.net": {"203.0.113.4"}},
+		ns:    map[string][]string{"bad.example": {"ns1.old-host.example", "ns2.old-host.example"}},
+	}
+	service := newTestZoneHealth(t, db, dns)
+	owner := createTestUser(t, db)
+	domain := seedZone(t, db, owner, "bad.example",
+		"@ NS ns1.panel.example.",
+		"@ A 198.51.100.5",
+		"broken A 999.1.1.1",
+		"shop CNAME gone.cloudapp.example.",
+		"old CNAME missing",
+		"www CNAME @",
+		"ftp CNAME www",
+		"cdn CNAME cdn.example.net.",
+		"cdn TXT verification",
+		"loop CNAME loop",
+		"dev NS ns1.dev.bad.example.",
+		"@ MX 192.0.2.1",
+		"@ MX ftp",
+		"@ TXT v=spf1 -all",
+		"@ TXT v=spf1 +all",
+		"_dmarc TXT v=DMARC1; p=none",
+	)
+	// Inactive records are not checked
+	inactive := &models.DNSRecord{DomainID: domain.ID, Name: "old-mail", Type: "CNAME", Value: "nowhere", TTL: 3600, IsActive: true}
+	mustCreate(t, db, inactive)
+	db.Model(&models.DNSRecord{}).Where("id = ?", inactive.ID).Update("is_active", false)
+
+	report, err := service.ZoneHealthCheck(asUser(owner.ID, "user"), domain.ID)
+	if err != nil {
+		t.Fatalf("ZoneHealthCheck() error = %v", err)
+	}
+
+	tests := []struct {
+		check    string
+		severity string
+		name     string
+		text     string
+	}{
+		{"syntax", SeverityError, "broken", "A record value must be an IPv4 address"},
+		{"syntax", SeverityError, "@", "names the address 192.0.2.1"},
+		{"cname", SeverityError, "shop", "gone.cloudapp.example, which does not resolve"},
+		{"cname", SeverityError, "old", "missing.bad.example, which has no records"},
+		{"cname", SeverityWarning, "ftp", "which is a CNAME itself"},
+		{"cname", SeverityError, "cdn", "also has other records"},
+		{"cname", SeverityError, "loop", "CNAME of itself"},
+		{"ns", SeverityError, "@", "lists 1 nameserver"},
+		{"ns", SeverityWarning, "@", "does not list ns2.panel.example"},
+		{"ns", SeverityError, "dev", "delegated to 1 nameserver"},
+		{"ns", SeverityError, "dev", "no A or AAAA record in the zone to serve as glue"},
+		{"ns", SeverityError, "@", "none of which the zone lists"},
+		{"apex", SeverityWarning, "@", "points at this server (192.0.2.10)"},
+		{"apex", SeverityWarning, "@", "resolves to 203.0.113.9"},
+		{"mx", SeverityError, "@", "ftp.bad.example is a CNAME"},
+		{"spf", SeverityError, "@", "2 SPF records"},
+		{"dkim", SeverityWarning, "", "No DKIM key"},
+		{"dmarc", SeverityInfo, "_dmarc", "only monitors"},
+	}
+	for _, tt := range tests {
+		f := finding(report, tt.check, tt.severity, tt.text)
+		if f == nil {
+			t.Errorf("no %s %s finding %q", tt.severity, tt.check, tt.text)
+			continue
+		}
+		if f.Name != tt.name {
+			t.Errorf("finding %q is about %q, want %q", tt.text, f.Name, tt.name)
+		}
+	}
+	for _, f := range report.Findings {
+		if f.Name == "old-mail" {
+			t.Errorf("inactive record checked: %s", f.Message)
+		}
+	}
+
+	// Errors come first and are counted
+	errors, warnings := 0, 0
+	for i, f := range report.Findings {
+		switch f.Severity {
+		case SeverityError:
+			errors++
+			if i > 0 && report.Findings[i-1].Severity != SeverityError {
+				t.Errorf("error %q follows a %s", f.Message, report.Findings[i-1].Severity)
+			}
+		case SeverityWarning:
+			warnings++
+		}
+	}
+	if report.Healthy || report.Errors != errors || report.Warnings != warnings {
+		t.Errorf("report healthy = %v, %d errors, %d warnings; findings have %d and %d", report.Healthy, report.Errors, report.Warnings, errors, warnings)
+	}
+	if f := finding(report, "syntax", SeverityError, "IPv4"); f == nil || f.RecordID == nil {
+		t.Error("syntax finding does not name the record")
+	}
+}
+
+func TestZoneHealthMailRecords(t *testing.T) {
+	tests := []struct {
+		name     string
+		records  []string
+		check    string
+		severity string
+		text     string // Empty when the records must raise no finding of the check
+	}{
+		{"spf restricting senders", []string{"@ TXT v=spf1 mx ~all"}, "spf", "", ""},
+		{"spf redirected", []string{"@ TXT v=spf1 redirect=_spf.example.net"}, "spf", "", ""},
+		{"spf missing", nil, "spf", SeverityWarning, "No SPF record"},
+		{"spf neutral", []string{"@ TXT v=spf1 mx ?all"}, "spf", SeverityWarning, "does not tell receivers to reject"},
+		{"spf allowing everyone", []string{`@ TXT "v=spf1 a mx all"`}, "spf", SeverityError, "lets any server send"},
+		{"spf ptr", []string{"@ TXT v=spf1 ptr -all"}, "spf", SeverityWarning, "ptr mechanism"},
+		{"spf over the lookup limit", []string{"@ TXT v=spf1 a mx include:a.example include:b.example include:c.example include:d.example include:e.example exists:f.example a:g.example mx:h.example redirect=i.example"}, "spf", SeverityError, "needs 11 DNS lookups"},
+		{"dkim without key", []string{"mail._domainkey TXT v=DKIM1; k=rsa"}, "dkim", SeverityError, "no public key"},
+		{"dkim revoked", []string{"mail._domainkey TXT v=DKIM1; p="}, "dkim", SeverityInfo, "revoked"},
+		{"dkim version", []string{"mail._domainkey TXT v=DKIM2; p=abc"}, "dkim", SeverityError, `version "DKIM2"`},
+		{"dkim key type", []string{"mail._domainkey TXT v=DKIM1; k=dsa; p=abc"}, "dkim", SeverityWarning, `key type "dsa"`},
+		{"dmarc rejecting", []string{"_dmarc TXT v=DMARC1; p=quarantine"}, "dmarc", "", ""},
+		{"dmarc missing", nil, "dmarc", SeverityWarning, "No DMARC policy"},
+		{"dmarc without policy", []string{"_dmarc TXT v=DMARC1; rua=mailto:dmarc@mail.example"}, "dmarc", SeverityError, "no policy"},
+		{"dmarc unknown policy", []string{"_dmarc TXT v=DMARC1; p=block"}, "dmarc", SeverityError, "p=block"},
+		{"dmarc twice", []string{"_dmarc TXT v=DMARC1; p=reject", "_dmarc TXT v=DMARC1; p=none"}, "dmarc", SeverityError, "2 DMARC records"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var records []*models.DNSRecord
+			for _, line := range tt.records {
+				fields := strings.SplitN(line, " ", 3)
+				records = append(records, &models.DNSRecord{ID: uuid.New(), Name: fields[0], Type: fields[1], Value: fields[2], TTL: 3600, IsActive: true})
+			}
+			h := newZoneHealth(&zoneDNS{}, "mail.example", records)
+			h.checkSPF()
+			h.checkDKIM()
+			h.checkDMARC()
+			report := h.finish()
+
+			if tt.text == "" {
+				for _, f := range report.Findings {
+					if f.Check == tt.check {
+						t.Errorf("unexpected %s finding: %s", f.Severity, f.Message)
+					}
+				}
+				return
+			}
+			if finding(report, tt.check, tt.severity, tt.text) == nil {
+				t.Errorf("no %s %s finding %q in %v", tt.severity, tt.check, tt.text, report.Findings)
+			}
+		})
+	}
+}
+
+func TestZoneHealthLookupLimit(t *testing.T) {
+	records := []*models.DNSRecord{
+		{Name: "@", Type: "NS", Value: "ns1.panel.example.", TTL: 3600, IsActive: true},
+		{Name: "@", Type: "NS", Value: "ns2.panel.example.", TTL: 3600, IsActive: true},
+	}
+	for i := 0; i < 2*maxHealthLookups; i++ {
+		records = append(records, &models.DNSRecord{Name: fmt.Sprintf("app%d", i), Type: "CNAME", Value: fmt.Sprintf("app%d.cloud.example.", i), TTL: 3600, IsActive: true})
+	}
+	dns := &zoneDNS{}
+	h := newZoneHealth(dns, "many.example", records)
+	h.checkCNAMEs(context.Background())
+	h.checkNameservers(context.Background(), nil)
+	report := h.finish()
+
+	if dns.lookups != maxHealthLookups {
+		t.Errorf("%d lookups, want the limit of %d", dns.lookups, maxHealthLookups)
+	}
+	if finding(report, "lookup", SeverityInfo, "Stopped looking up") == nil {
+		t.Error("reaching the limit is not reported")
+	}
+}
+
+func TestZoneHealthCheckAccess(t *testing.T) {
+	db := newTestDB(t)
+	service := newTestZoneHealth(t, db, &zoneDNS{})
+	owner := createTestUser(t, db)
+	domain := seedZone(t, db, owner, "access.example")
+
+	if _, err := service.ZoneHealthCheck(asUser(createTestUser(t, db).ID, "user"), domain.ID); !apperrors.IsPermissionDenied(err) {
+		t.Errorf("another user's check error = %v, want permission denied", err)
+	}
+	if _, err := service.ZoneHealthCheck(asUser(owner.ID, "user"), uuid.New()); !apperrors.IsNotFound(err) {
+		t.Errorf("unknown domain error = %v, want not found", err)
+	}
+
+	// An empty zone is reported, not an error
+	report, err := service.ZoneHealthCheck(asUser(uuid.New(), "admin"), domain.ID)
+	if err != nil || report.Healthy || finding(report, "ns", SeverityError, "no NS records") == nil || finding(report, "apex", SeverityError, "no A or AAAA record") == nil {
+		t.Errorf("empty zone report = %+v, %v", report, err)
+	}
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestRevertToVersion(t *testing.T) {
+	db := newTestDB(t)
+	dns, _ := newTestDNSService(t, db, testHostingConfig(t))
+	owner := createTestUser(t, db)
+	domain := createDNSDomain(t, db, owner, "shop.example")
+	ctx := asUser(owner.ID)
+
+	www, err := dns.CreateDNSRecord(ctx, domain.ID, "A", "www", "192.0.2.10", 3600, nil)
+	if err != nil {
+		t.Fatalf("CreateDNSRecord() error = %v", err)
+	}
+	if _, err := dns.UpdateDNSRecord(ctx, www.ID, map[string]interface{}{"is_active": false}); err != nil {
+		t.Fatalf("UpdateDNSRecord() error = %v", err)
+	}
+	history, err := dns.GetRecordHistory(ctx, domain.ID)
+	if err != nil || len(history) != 2 || history[0].Action != "update" || history[1].Action != "create" {
+		t.Fatalf("history = %+v (%v)", history, err)
+	}
+	paused := history[0]
+
+	if err := dns.DeleteDNSRecord(ctx, www.ID); err != nil {
+		t.Fatalf("DeleteDNSRecord() error = %v", err)
+	}
+	if _, err := dns.CreateDNSRecord(ctx, domain.ID, "A", "shop", "192.0.2.20", 3600, nil); err != nil {
+		t.Fatalf("CreateDNSRecord() error = %v", err)
+	}
+
+	records, err := dns.RevertToVersion(ctx, domain.ID, paused.ID)
+	if err != nil {
+		t.Fatalf("RevertToVersion() error = %v", err)
+	}
+	if len(records) != 1 || records[0].ID != www.ID {
+		t.Fatalf("reverted records = %+v", records)
+	}
+
+	var stored []models.DNSRecord
+	db.Where("domain_id = ?", domain.ID).Find(&stored)
+	if len(stored) != 1 || stored[0].Name != "www" || stored[0].IsActive {
+		t.Errorf("zone after revert = %+v, want www inactive", stored)
+	}
+	if history, _ := dns.GetRecordHistory(ctx, domain.ID); history[0].Action != "revert" {
+		t.Errorf("latest version = %s, want revert", history[0].Action)
+	}
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// recordTypeLimit returns the maximum number of records of a type per domain, 0 meaning unlimited.
+// Keys are matched case-insensitively since the config loader lower-cases map keys.
+func recordTypeLimit(cfg config.HostingConfig, recordType string) int {
+	for limitType, limit := range cfg.DNSRecordLimits {
+		if strings.EqualFold(limitType, recordType) {
+			return limit
+		}
+	}
+	return 0
+}
+
+// checkRecordLimits checks a domain's zone, as it would be after adding records, against the total
+// record limit and the limits of the added records' types. Only the added types are checked, so a
+// zone over a lowered limit still accepts records of other types.
+func (s *DNSService) checkRecordLimits(zone, added []*models.DNSRecord) error {
+	return checkZoneLimits(s.config, zone, added)
+}
+
+// checkZoneLimits applies the record limits of checkRecordLimits
+func checkZoneLimits(cfg config.HostingConfig, zone, added []*models.DNSRecord) error {
+	if len(added) == 0 {
+		return nil
+	}
+	if limit := cfg.DNSMaxRecords; limit > 0 && len(zone) > limit {
+		return apperrors.PreconditionCode("dns_record_limit_reached", map[string]string{"limit": strconv.Itoa(limit)})
+	}
+
+	counts := make(map[string]int)
+	for _, record := range zone {
+		counts[record.Type]++
+	}
+	for _, record := range added {
+		if limit := recordTypeLimit(cfg, record.Type); limit > 0 && counts[record.Type] > limit {
+			return apperrors.PreconditionCode("dns_record_type_limit_reached", map[string]string{
+				"type":  record.Type,
+				"limit": strconv.Itoa(limit),
+			})
+		}
+	}
+
+	return nil
+}
+
+// clampTTL bounds a record TTL to the configured range
+func (s *DNSService) clampTTL(ttl int) int {
+	if s.config.DNSMinTTL > 0 && ttl < s.config.DNSMinTTL {
+		return s.config.DNSMinTTL
+	}
+	if s.config.DNSMaxTTL > 0 && ttl > s.config.DNSMaxTTL {
+		return s.config.DNSMaxTTL
+	}
+	return ttl
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestClampTTL(t *testing.T) {
+	cfg := testHostingConfig(t)
+	cfg.DNSMinTTL = 60
+	cfg.DNSMaxTTL = 86400
+	dns, _ := newTestDNSService(t, newTestDB(t), cfg)
+
+	tests := []struct{ ttl, want int }{
+		{1, 60},
+		{60, 60},
+		{3600, 3600},
+		{86400, 86400},
+		{604800, 86400},
+	}
+	for _, tt := range tests {
+		if got := dns.clampTTL(tt.ttl); got != tt.want {
+			t.Errorf("clampTTL(%d) = %d, want %d", tt.ttl, got, tt.want)
+		}
+	}
+
+	// Without bounds TTLs are kept
+	cfg.DNSMinTTL, cfg.DNSMaxTTL = 0, 0
+	unbounded, _ := newTestDNSService(t, newTestDB(t), cfg)
+	if got := unbounded.clampTTL(5); got != 5 {
+		t.Errorf("unbounded clampTTL(5) = %d", got)
+	}
+}
+
+func TestCheckRecordLimits(t *testing.T) {
+	cfg := testHostingConfig(t)
+	cfg.DNSRecordLimits = map[string]int{"mx": 2, "TXT": 0}
+	cfg.DNSMaxRecords = 4
+	dns, _ := newTestDNSService(t, newTestDB(t), cfg)
+
+	record := func(recordType string) *models.DNSRecord { return &models.DNSRecord{Type: recordType} }
+
+	tests := []struct {
+		name  string
+		zone  []*models.DNSRecord
+		added []*models.DNSRecord
+		want  string
+	}{
+		{"within limits", []*models.DNSRecord{record("A"), record("MX"), record("MX")}, []*models.DNSRecord{record("MX")}, ""},
+		{"type limit matched case-insensitively", []*models.DNSRecord{record("MX"), record("MX"), record("MX")}, []*models.DNSRecord{record("MX")}, "dns_record_type_limit_reached"},
+		{"unlimited type", []*models.DNSRecord{record("TXT"), record("TXT"), record("TXT"), record("TXT")}, []*models.DNSRecord{record("TXT")}, ""},
+		{"total limit", []*models.DNSRecord{record("A"), record("A"), record("A"), record("A"), record("A")}, []*models.DNSRecord{record("A")}, "dns_record_limit_reached"},
+		{"over a lowered limit of another type", []*models.DNSRecord{record("MX"), record("MX"), record("MX"), record("A")}, []*models.DNSRecord{record("A")}, ""},
+		{"nothing added", []*models.DNSRecord{record("A"), record("A"), record("A"), record("A"), record("A")}, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorCode(dns.checkRecordLimits(tt.zone, tt.added)); got != tt.want {
+				t.Errorf("checkRecordLimits() code = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDNSRecordLimitsEnforced(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	cfg.DNSRecordLimits = map[string]int{"MX": 1}
+	cfg.DNSMinTTL = 300
+	cfg.DNSMaxTTL = 3600
+	dns, _ := newTestDNSService(t, db, cfg)
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "limits.example")
+	ctx := asUser(owner.ID, "user")
+	priority := 10
+
+	mx, err := dns.CreateDNSRecord(ctx, domain.ID, "MX", "@", "mx1.limits.example", 30, &priority)
+	if err != nil {
+		t.Fatalf("first MX: %v", err)
+	}
+	if mx.TTL != 300 {
+		t.Errorf("TTL of 30 stored as %d, want the minimum 300", mx.TTL)
+	}
+
+	if _, err := dns.CreateDNSRecord(ctx, domain.ID, "MX", "@", "mx2.limits.example", 3600, &priority); errorCode(err) != "dns_record_type_limit_reached" {
+		t.Fatalf("second MX: error = %v, want dns_record_type_limit_reached", err)
+	}
+	var count int64
+	db.Model(&models.DNSRecord{}).Where("domain_id = ? AND type = ?", domain.ID, "MX").Count(&count)
+	if count != 1 {
+		t.Errorf("%d MX records stored, want 1", count)
+	}
+
+	a, err := dns.CreateDNSRecord(ctx, domain.ID, "A", "www", "192.0.2.1", 0, nil)
+	if err != nil {
+		t.Fatalf("A record: %v", err)
+	}
+
+	updated, err := dns.UpdateDNSRecord(ctx, a.ID, map[string]interface{}{"ttl": 86400})
+	if err != nil {
+		t.Fatalf("update TTL: %v", err)
+	}
+	if updated.TTL != 3600 {
+		t.Errorf("TTL of 86400 updated to %d, want the maximum 3600", updated.TTL)
+	}
+
+	// Changing a record's type counts it against the new type's limit
+	if _, err := dns.UpdateDNSRecord(ctx, a.ID, map[string]interface{}{"type": "MX", "value": "mx2.limits.example", "priority": 20}); errorCode(err) != "dns_record_type_limit_reached" {
+		t.Errorf("retype to MX: error = %v, want dns_record_type_limit_reached", err)
+	}
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/zone"
+)
+
+// dateSerial returns the first SOA serial of a day in the YYYYMMDDnn form of RFC 1912
+func dateSerial(now time.Time) uint32 {
+	year, month, day := now.UTC().Date()
+	return uint32(year*1000000 + int(month)*10000 + day*100)
+}
+
+// nextSerial returns the SOA serial following current: the next of the day, or the day's first
+// when current is older. Serials only ever grow, even past 99 changes in a day.
+func nextSerial(current uint32, now time.Time) uint32 {
+	if base := dateSerial(now); current < base {
+		return base + 1
+	}
+	return current + 1
+}
+
+// defaultRecordTTL returns the TTL of records created in a domain's zone without one
+func defaultRecordTTL(domain *models.Domain, cfg config.HostingConfig) int {
+	if domain.DNSDefaultTTL > 0 {
+		return domain.DNSDefaultTTL
+	}
+	if cfg.DNSDefaultTTL > 0 {
+		return cfg.DNSDefaultTTL
+	}
+	return 3600
+}
+
+// soaRecord builds the SOA record of a new zone, naming the first of the panel's nameservers as
+// primary, or returns nil when none is configured
+func soaRecord(domain *models.Domain, cfg config.HostingConfig) *models.DNSRecord {
+	if len(cfg.Nameservers) == 0 {
+		return nil
+	}
+
+	contact := "hostmaster." + domain.Name
+	if cfg.DNSSOAContact != "" {
+		contact = zone.Contact(cfg.DNSSOAContact)
+	}
+	return &models.DNSRecord{
+		DomainID: domain.ID,
+		Type:     "SOA",
+		Name:     "@",
+		Value:    strings.ToLower(strings.TrimSuffix(cfg.Nameservers[0], ".")) + " " + contact,
+		TTL:      defaultRecordTTL(domain, cfg),
+		IsActive: true,
+	}
+}
+
+// raiseSerial moves a domain's SOA serial on after a zone change. The serial is raised in the
+// database, so concurrent changes each get their own; CASE rather than GREATEST, which not every
+// database has.
+func (s *DNSService) raiseSerial(ctx context.Context, domainID uuid.UUID) {
+	first := dateSerial(time.Now()) + 1
+	if err := s.db.WithContext(ctx).Model(&models.Domain{}).
+		Where("id = ?", domainID).
+		UpdateColumn("dns_serial", gorm.Expr("CASE WHEN dns_serial + 1 > ? THEN dns_serial + 1 ELSE ? END", first, first)).Error; err != nil {
+		s.logger.Error("Failed to raise SOA serial", zap.String("domain_id", domainID.String()), zap.Error(err))
+	}
+}
+
+// zoneSOA returns the SOA values a domain's zone is rendered with. Zones whose serial was never
+// raised get the day's first serial, which is above the timestamps zones used to be rendered with.
+func (s *DNSService) zoneSOA(domain *models.Domain) zone.SOA {
+	serial := domain.DNSSerial
+	if serial == 0 {
+		serial = nextSerial(0, time.Now())
+	}
+
+	return zone.SOA{
+		Serial:  serial,
+		TTL:     defaultRecordTTL(domain, s.config),
+		Refresh: s.config.DNSSOARefresh,
+		Retry:   s.config.DNSSOARetry,
+		Expire:  s.config.DNSSOAExpire,
+		Minimum: s.config.DNSSOAMinimum,
+	}
+}
+
+// SetDefaultTTL sets the TTL of records created in a domain's zone without one, which is also the
+// zone's $TTL. 0 returns the domain to the server's default.
+func (s *DNSService) SetDefaultTTL(ctx context.Context, domainID uuid.UUID, ttl int) (*models.Domain, error) {
+	domain, err := s.domains.ownedDomain(ctx, domainID)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireFeature(domain, FeatureCustomDNS); err != nil {
+		return nil, err
+	}
+	if ttl != 0 && (ttl < s.config.DNSMinTTL || ttl > s.config.DNSMaxTTL) {
+		return nil, apperrors.InvalidCode("default_ttl", "dns.ttl_range", map[string]string{
+			"min": strconv.Itoa(s.config.DNSMinTTL),
+			"max": strconv.Itoa(s.config.DNSMaxTTL),
+		})
+	}
+
+	if err := s.db.WithContext(ctx).Model(domain).Update("dns_default_ttl", ttl).Error; err != nil {
+		return nil, fmt.Errorf("failed to update domain: %w", err)
+	}
+	domain.DNSDefaultTTL = ttl
+
+	s.zoneChanged(ctx, domainID)
+
+	return domain, nil
+}
@@ -0,0 +1,250 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestNextSerial(t *testing.T) {
+	day := time.Date(2024, time.March, 5, 23, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		current uint32
+		want    uint32
+	}{
+		{"new zone", 0, 2024030501},
+		{"older day", 2024030407, 2024030501},
+		{"Unix timestamp serial", 1709600000, 2024030501},
+		{"same day", 2024030501, 2024030502},
+		{"past 99 changes", 2024030599, 2024030600},
+		{"ahead of the date", 2030010105, 2030010106},
+	}
+	for _, tt := range tests {
+		if got := nextSerial(tt.current, day); got != tt.want {
+			t.Errorf("%s: nextSerial(%d) = %d, want %d", tt.name, tt.current, got, tt.want)
+		}
+	}
+
+	// The day is taken in UTC
+	if got := dateSerial(time.Date(2024, time.March, 5, 23, 0, 0, 0, time.FixedZone("UTC-5", -5*3600))); got != 2024030600 {
+		t.Errorf("dateSerial() of a zone behind UTC = %d", got)
+	}
+}
+
+func TestDefaultRecordTTL(t *testing.T) {
+	tests := []struct {
+		domain, server, want int
+	}{
+		{300, 3600, 300},
+		{0, 1800, 1800},
+		{0, 0, 3600},
+	}
+	for _, tt := range tests {
+		got := defaultRecordTTL(&models.Domain{DNSDefaultTTL: tt.domain}, config.HostingConfig{DNSDefaultTTL: tt.server})
+		if got != tt.want {
+			t.Errorf("defaultRecordTTL(domain %d, server %d) = %d, want %d", tt.domain, tt.server, got, tt.want)
+		}
+	}
+}
+
+// zoneSerial returns the serial of a domain's zone file
+func zoneSerial(t *testing.T, zoneDir, name string) uint32 {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join(zoneDir, name+".zone"))
+	if err != nil {
+		t.Fatalf("read zone: %v", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if fields := strings.Fields(line); len(fields) >= 7 && fields[3] == "SOA" {
+			serial, err := strconv.ParseUint(fields[6], 10, 32)
+			if err != nil {
+				t.Fatalf("SOA serial %q: %v", fields[6], err)
+			}
+			return uint32(serial)
+		}
+	}
+	t.Fatalf("zone has no SOA:\n%s", data)
+	return 0
+}
+
+func TestSerialIncrementsOnChanges(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	cfg.Nameservers = []string{"ns1.host.example", "ns2.host.example"}
+	cfg.DNSSOAContact = "dns.admin@host.example"
+	cfg.DNSSOARefresh = 900
+	cfg.DNSMinTTL, cfg.DNSMaxTTL = 60, 86400
+	dns, domains := newTestDNSService(t, db, cfg)
+	owner := createTestUser(t, db)
+	ctx := asUser(owner.ID, "user")
+
+	domain, err := domains.CreateDomain(ctx, owner.ID, "shop.example", nil)
+	if err != nil {
+		t.Fatalf("CreateDomain() error = %v", err)
+	}
+	db.Model(domain).Update("custom_dns_enabled", true)
+
+	// The new zone has the panel's SOA with the day's first serials
+	var soa models.DNSRecord
+	if err := db.Where("domain_id = ? AND type = ?", domain.ID, "SOA").First(&soa).Error; err != nil {
+		t.Fatalf("no SOA record: %v", err)
+	}
+	if soa.Value != `ns1.host.example dns\.admin.host.example` {
+		t.Errorf("SOA value = %q", soa.Value)
+	}
+	zoneFile, _ := os.ReadFile(filepath.Join(cfg.ZoneDir, "shop.example.zone"))
+	if !strings.Contains(string(zoneFile), `IN	SOA	ns1.host.example. dns\.admin.host.example. `) || !strings.Contains(string(zoneFile), " 900 ") {
+		t.Errorf("zone SOA:\n%s", zoneFile)
+	}
+	serial := zoneSerial(t, cfg.ZoneDir, "shop.example")
+	if today := dateSerial(time.Now()); serial <= today || serial > today+10 {
+		t.Errorf("serial of a new zone = %d, want from %d", serial, today+1)
+	}
+
+	// Every change raises it
+	steps := []struct {
+		name   string
+		change func() error
+	}{
+		{"create", func() error {
+			_, err := dns.CreateDNSRecord(ctx, domain.ID, "A", "www", "192.0.2.1", 0, nil)
+			return err
+		}},
+		{"update", func() error {
+			var record models.DNSRecord
+			db.Where("domain_id = ? AND name = ?", domain.ID, "www").First(&record)
+			_, err := dns.UpdateDNSRecord(ctx, record.ID, map[string]interface{}{"value": "192.0.2.2"})
+			return err
+		}},
+		{"delete", func() error {
+			var record models.DNSRecord
+			db.Where("domain_id = ? AND name = ?", domain.ID, "www").First(&record)
+			return dns.DeleteDNSRecord(ctx, record.ID)
+		}},
+		{"default TTL", func() error {
+			_, err := dns.SetDefaultTTL(ctx, domain.ID, 600)
+			return err
+		}},
+	}
+	for _, step := range steps {
+		if err := step.change(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		next := zoneSerial(t, cfg.ZoneDir, "shop.example")
+		if next <= serial {
+			t.Errorf("serial after %s = %d, was %d", step.name, next, serial)
+		}
+		var stored models.Domain
+		db.First(&stored, "id = ?", domain.ID)
+		if stored.DNSSerial != next {
+			t.Errorf("stored serial after %s = %d, zone has %d", step.name, stored.DNSSerial, next)
+		}
+		serial = next
+	}
+
+	// A serial ahead of the date keeps growing from where it is
+	db.Model(domain).UpdateColumn("dns_serial", 2090010199)
+	if _, err := dns.CreateDNSRecord(ctx, domain.ID, "TXT", "@", "v=spf1 -all", 0, nil); err != nil {
+		t.Fatalf("create record: %v", err)
+	}
+	if serial := zoneSerial(t, cfg.ZoneDir, "shop.example"); serial != 2090010200 {
+		t.Errorf("serial after a future one = %d, want 2090010200", serial)
+	}
+
+	// Records created without a TTL take the domain's default, which is also the zone's
+	var txt models.DNSRecord
+	db.Where("domain_id = ? AND type = ?", domain.ID, "TXT").First(&txt)
+	if txt.TTL != 600 {
+		t.Errorf("TTL of a record created without one = %d, want 600", txt.TTL)
+	}
+	if zoneFile, _ := os.ReadFile(filepath.Join(cfg.ZoneDir, "shop.example.zone")); !strings.Contains(string(zoneFile), "$TTL 600\n") {
+		t.Errorf("zone lacks the default TTL:\n%s", zoneFile)
+	}
+}
+
+func TestSOAIsManaged(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	cfg.Nameservers = []string{"ns1.host.example", "ns2.host.example"}
+	cfg.DNSMinTTL, cfg.DNSMaxTTL = 60, 86400
+	dns, domains := newTestDNSService(t, db, cfg)
+	owner := createTestUser(t, db)
+	ctx := asUser(owner.ID, "user")
+	domain, err := domains.CreateDomain(ctx, owner.ID, "shop.example", nil)
+	if err != nil {
+		t.Fatalf("CreateDomain() error = %v", err)
+	}
+	db.Model(domain).Update("custom_dns_enabled", true)
+
+	if _, err := dns.CreateDNSRecord(ctx, domain.ID, "SOA", "@", "ns9.other.example hostmaster.other.example", 3600, nil); fieldMessage(err, "type") == "" {
+		t.Errorf("SOA record created: error = %v", err)
+	}
+	var soa models.DNSRecord
+	db.Where("domain_id = ? AND type = ?", domain.ID, "SOA").First(&soa)
+	if _, err := dns.UpdateDNSRecord(ctx, soa.ID, map[string]interface{}{"value": "ns9.other.example hostmaster.other.example"}); fieldMessage(err, "type") == "" {
+		t.Errorf("SOA record updated: error = %v", err)
+	}
+
+	if _, err := dns.SetDefaultTTL(asUser(uuid.New(), "user"), domain.ID, 600); !apperrors.IsPermissionDenied(err) {
+		t.Errorf("SetDefaultTTL() on another user's domain: error = %v", err)
+	}
+	for _, ttl := range []int{30, 100000} {
+		if _, err := dns.SetDefaultTTL(ctx, domain.ID, ttl); fieldMessage(err, "default_ttl") == "" {
+			t.Errorf("SetDefaultTTL(%d) error = %v", ttl, err)
+		}
+	}
+	if _, err := dns.SetDefaultTTL(asUser(createTestUser(t, db).ID, "user"), domain.ID, 600); err == nil {
+		t.Error("another user set the default TTL")
+	}
+	updated, err := dns.SetDefaultTTL(ctx, domain.ID, 0)
+	if err != nil || updated.DNSDefaultTTL != 0 {
+		t.Errorf("SetDefaultTTL(0) = %+v, %v", updated, err)
+	}
+
+	// Exports carry the stored serial, and imports keep the SOA and raise it
+	var stored models.Domain
+	db.First(&stored, "id = ?", domain.ID)
+	exported, err := dns.ExportZone(ctx, domain.ID)
+	if err != nil || !strings.Contains(exported, " "+strconv.FormatUint(uint64(stored.DNSSerial), 10)+" ") {
+		t.Errorf("export lacks serial %d (%v):\n%s", stored.DNSSerial, err, exported)
+	}
+	if _, err := dns.ImportZone(ctx, domain.ID, "www 300 IN A 192.0.2.7\n@ 300 IN NS ns1.host.example.\n@ 300 IN NS ns2.host.example.\n"); err != nil {
+		t.Fatalf("ImportZone() error = %v", err)
+	}
+	var count int64
+	db.Model(&models.DNSRecord{}).Where("domain_id = ? AND type = ?", domain.ID, "SOA").Count(&count)
+	if count != 1 {
+		t.Errorf("%d SOA records after an import, want 1", count)
+	}
+	if serial := zoneSerial(t, cfg.ZoneDir, "shop.example"); serial <= stored.DNSSerial {
+		t.Errorf("serial after an import = %d, was %d", serial, stored.DNSSerial)
+	}
+}
+
+func TestRaiseSerial(t *testing.T) {
+	db := newTestDB(t)
+	dns, _ := newTestDNSService(t, db, testHostingConfig(t))
+	domain := createTestDomain(t, db, createTestUser(t, db), "shop.example")
+	today := dateSerial(time.Now())
+
+	for i := 1; i <= 3; i++ {
+		dns.raiseSerial(asUser(domain.UserID), domain.ID)
+		var stored models.Domain
+		db.First(&stored, "id = ?", domain.ID)
+		if stored.DNSSerial != today+uint32(i) {
+			t.Fatalf("serial after %d raises = %d, want %d", i, stored.DNSSerial, today+uint32(i))
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// Placeholders replaced when a template is applied: with the domain name, and with the domain
+// name with its dots replaced by hyphens, as in the mail hosts of Microsoft 365
+const (
+	domainPlaceholder       = "{domain}"
+	dashedDomainPlaceholder = "{domain-dashed}"
+)
+
+// DNSTemplateResult reports what applying a template did
+type DNSTemplateResult struct {
+	Created  []*models.DNSRecord `json:"created"`
+	Skipped  []*models.DNSRecord `json:"skipped,omitempty"`  // Template records left out because they conflict
+	Replaced []*models.DNSRecord `json:"replaced,omitempty"` // Existing records removed to make room
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+// builtinDNSTemplates are the templates provided for common providers
+var builtinDNSTemplates = []struct {
+	name        string
+	description string
+	records     []models.DNSTemplateRecord
+}{
+	{
+		name:        "google-workspace",
+		description: "Google Workspace mail",
+		records: []models.DNSTemplateRecord{
+			{Type: "MX", Name: "@", Value: "aspmx.l.google.com", TTL: 3600, Priority: intPtr(1)},
+			{Type: "MX", Name: "@", Value: "alt1.aspmx.l.google.com", TTL: 3600, Priority: intPtr(5)},
+			{Type: "MX", Name: "@", Value: "alt2.aspmx.l.google.com", TTL: 3600, Priority: intPtr(5)},
+			{Type: "MX", Name: "@", Value: "alt3.aspmx.l.google.com", TTL: 3600, Priority: intPtr(10)},
+			{Type: "MX", Name: "@", Value: "alt4.aspmx.l.google.com", TTL: 3600, Priority: intPtr(10)},
+			{Type: "TXT", Name: "@", Value: "v=spf1 include:_spf.google.com ~all", TTL: 3600},
+		},
+	},
+	{
+		name:        "microsoft-365",
+		description: "Microsoft 365 mail and autodiscover",
+		records: []models.DNSTemplateRecord{
+			{Type: "MX", Name: "@", Value: "{domain-dashed}.mail.protection.outlook.com", TTL: 3600, Priority: intPtr(0)},
+			{Type: "TXT", Name: "@", Value: "v=spf1 include:spf.protection.outlook.com -all", TTL: 3600},
+			{Type: "CNAME", Name: "autodiscover", Value: "autodiscover.outlook.com", TTL: 3600},
+		},
+	},
+	{
+		name:        "zoho-mail",
+		description: "Zoho Mail",
+		records: []models.DNSTemplateRecord{
+			{Type: "MX", Name: "@", Value: "mx.zoho.com", TTL: 3600, Priority: intPtr(10)},
+			{Type: "MX", Name: "@", Value: "mx2.zoho.com", TTL: 3600, Priority: intPtr(20)},
+			{Type: "MX", Name: "@", Value: "mx3.zoho.com", TTL: 3600, Priority: intPtr(50)},
+			{Type: "TXT", Name: "@", Value: "v=spf1 include:zoho.com ~all", TTL: 3600},
+		},
+	},
+	{
+		name:        "common-aliases",
+		description: "www, ftp and webmail aliases of the domain",
+		records: []models.DNSTemplateRecord{
+			{Type: "CNAME", Name: "www", Value: "{domain}", TTL: 3600},
+			{Type: "CNAME", Name: "ftp", Value: "{domain}", TTL: 3600},
+			{Type: "CNAME", Name: "webmail", Value: "{domain}", TTL: 3600},
+		},
+	},
+}
+
+// SeedDNSTemplates creates or refreshes the built-in DNS templates
+func (s *DNSService) SeedDNSTemplates(ctx context.Context) error {
+	for _, builtin := range builtinDNSTemplates {
+		records, err := json.Marshal(builtin.records)
+		if err != nil {
+			return fmt.Errorf("failed to encode DNS template %s: %w", builtin.name, err)
+		}
+
+		var template models.DNSTemplate
+		err = s.db.WithContext(ctx).Where("name = ?", builtin.name).First(&template).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			template = models.DNSTemplate{
+				Name:        builtin.name,
+				Description: builtin.description,
+				Records:     string(records),
+				IsBuiltin:   true,
+			}
+			if err := s.db.WithContext(ctx).Create(&template).Error; err != nil {
+				return fmt.Errorf("failed to create DNS template %s: %w", builtin.name, err)
+			}
+		case err != nil:
+			return fmt.Errorf("failed to load DNS template %s: %w", builtin.name, err)
+		case template.IsBuiltin:
+			if err := s.db.WithContext(ctx).Model(&template).Updates(map[string]interface{}{
+				"description": builtin.description,
+				"records":     string(records),
+			}).Error; err != nil {
+				return fmt.Errorf("failed to update DNS template %s: %w", builtin.name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// GetDNSTemplates retrieves all DNS templates
+func (s *DNSService) GetDNSTemplates(ctx context.Context) ([]*models.DNSTemplate, error) {
+	var templates []*models.DNSTemplate
+	if err := s.db.WithContext(ctx).Order("name").Find(&templates).Error; err != nil {
+		return nil, fmt.Errorf("failed to get DNS templates: %w", err)
+	}
+
+	return templates, nil
+}
+
+// CreateDNSTemplate creates a custom DNS template
+func (s *DNSService) CreateDNSTemplate(ctx context.Context, name, description string, records []models.DNSTemplateRecord) (*models.DNSTemplate, error) {
+	v := apperrors.NewValidation()
+	if strings.TrimSpace(name) == "" {
+		v.AddCode("name", "field.required", nil)
+	}
+	if len(records) == 0 {
+		v.AddCode("records", "field.empty", nil)
+	}
+
+	// Validate against a placeholder domain so mistakes surface before the template is applied
+	for i, record := range ExpandDNSTemplate(records, "example.com") {
+		if err := validateDNSRecord(record); err != nil {
+			invalid, ok := apperrors.AsValidation(err)
+			if !ok {
+				return nil, err
+			}
+			v.AddNested(fmt.Sprintf("records[%d]", i), invalid)
+		}
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&models.DNSTemplate{}).Where("name = ?", name).Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("failed to check DNS template name: %w", err)
+	}
+	if count > 0 {
+		return nil, apperrors.InvalidCode("name", "dns.template_exists", nil)
+	}
+
+	data, err := json.Marshal(records)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode template records: %w", err)
+	}
+
+	template := &models.DNSTemplate{
+		Name:        name,
+		Description: description,
+		Records:     string(data),
+	}
+	if err := s.db.WithContext(ctx).Create(template).Error; err != nil {
+		return nil, fmt.Errorf("failed to create DNS template: %w", err)
+	}
+
+	return template, nil
+}
+
+// ApplyTemplate adds a template's records to a domain. Records that conflict with existing ones are
+// skipped, or when replace is set, the conflicting existing records are removed first.
+func (s *DNSService) ApplyTemplate(ctx context.Context, domainID, templateID uuid.UUID, replace bool) (*DNSTemplateResult, error) {
+	var domain models.Domain
+	if err := s.db.WithContext(ctx).Where("id = ?", domainID).First(&domain).Error; err != nil {
+		return nil, apperrors.FromDB(err, "domain")
+	}
+	if err := requireFeature(&domain, FeatureCustomDNS); err != nil {
+		return nil, err
+	}
+
+	var template models.DNSTemplate
+	if err := s.db.WithContext(ctx).Where("id = ?", templateID).First(&template).Error; err != nil {
+		return nil, apperrors.FromDB(err, "DNS template")
+	}
+
+	var templateRecords []models.DNSTemplateRecord
+	if err := json.Unmarshal([]byte(template.Records), &templateRecords); err != nil {
+		return nil, fmt.Errorf("failed to decode DNS template: %w", err)
+	}
+
+	records := ExpandDNSTemplate(templateRecords, domain.Name)
+	for _, record := range records {
+		record.DomainID = domainID
+		if err := validateDNSRecord(record); err != nil {
+			return nil, fmt.Errorf("invalid template record %s %s: %w", record.Type, record.Name, err)
+		}
+		record.TTL = s.clampTTL(record.TTL)
+	}
+
+	result := &DNSTemplateResult{}
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Only records that predate the template count as conflicts, so a template may hold several MX records
+		var existing []*models.DNSRecord
+		if err := tx.Where("domain_id = ?", domainID).Find(&existing).Error; err != nil {
+			return err
+		}
+
+		for _, record := range records {
+			conflicts := conflictingRecords(existing, record)
+			if len(conflicts) > 0 && !replace {
+				result.Skipped = append(result.Skipped, record)
+				continue
+			}
+
+			for _, conflict := range conflicts {
+				if err := tx.Where("id = ?", conflict.ID).Delete(&models.DNSRecord{}).Error; err != nil {
+					return err
+				}
+				result.Replaced = append(result.Replaced, conflict)
+			}
+			existing = withoutRecords(existing, conflicts)
+
+			if err := tx.Create(record).Error; err != nil {
+				return err
+			}
+			result.Created = append(result.Created, record)
+		}
+
+		if len(result.Created) == 0 {
+			return nil
+		}
+		if err := s.checkRecordLimits(append(existing, result.Created...), result.Created); err != nil {
+			return err
+		}
+		if touchesNameservers(result.Created...) {
+			if err := checkNameservers(append(existing, result.Created...), domain.Name, result.Created...); err != nil {
+				return err
+			}
+		}
+		return s.recordVersion(ctx, tx, domainID, "apply_template", nil, nil, nil)
+	}); err != nil {
+		return nil, fmt.Errorf("failed to apply DNS template: %w", err)
+	}
+
+	if len(result.Created) > 0 {
+		s.zoneChanged(ctx, domainID)
+	}
+
+	s.logger.Info("DNS template applied",
+		zap.String("domain", domain.Name),
+		zap.String("template", template.Name),
+		zap.Int("created", len(result.Created)),
+		zap.Int("skipped", len(result.Skipped)),
+		zap.Int("replaced", len(result.Replaced)))
+
+	return result, nil
+}
+
+// ExpandDNSTemplate turns template records into DNS records for a domain, substituting {domain}
+// and {domain-dashed}
+func ExpandDNSTemplate(templateRecords []models.DNSTemplateRecord, domainName string) []*models.DNSRecord {
+	placeholders := strings.NewReplacer(
+		domainPlaceholder, domainName,
+		dashedDomainPlaceholder, strings.ReplaceAll(domainName, ".", "-"),
+	)
+
+	records := make([]*models.DNSRecord, 0, len(templateRecords))
+	for _, tr := range templateRecords {
+		ttl := tr.TTL
+		if ttl <= 0 {
+			ttl = 3600
+		}
+		records = append(records, &models.DNSRecord{
+			Type:     strings.ToUpper(tr.Type),
+			Name:     placeholders.Replace(tr.Name),
+			Value:    placeholders.Replace(tr.Value),
+			TTL:      ttl,
+			Priority: tr.Priority,
+			IsActive: true,
+		})
+	}
+
+	return records
+}
+
+// conflictingRecords returns the existing records a new record cannot coexist with: records of the same
+// type and name, or any record sharing a name with a CNAME. TXT records only conflict when both are
+// SPF records, since a name may have any number of other TXT records but only one SPF record.
+func conflictingRecords(existing []*models.DNSRecord, record *models.DNSRecord) []*models.DNSRecord {
+	var conflicts []*models.DNSRecord
+	for _, current := range existing {
+		if !strings.EqualFold(current.Name, record.Name) {
+			continue
+		}
+		switch {
+		case current.Type == "CNAME" || record.Type == "CNAME":
+		case current.Type != record.Type:
+			continue
+		case record.Type == "TXT" && !(isSPFRecord(current) && isSPFRecord(record)):
+			continue
+		}
+		conflicts = append(conflicts, current)
+	}
+
+	return conflicts
+}
+
+// isSPFRecord reports whether a record is a TXT record holding an SPF policy
+func isSPFRecord(record *models.DNSRecord) bool {
+	value := strings.ToLower(unquoteTXT(record.Value))
+	return record.Type == "TXT" && (value == "v=spf1" || strings.HasPrefix(value, "v=spf1 "))
+}
+
+func withoutRecords(records, remove []*models.DNSRecord) []*models.DNSRecord {
+	kept := records[:0]
+	for _, record := range records {
+		removed := false
+		for _, r := range remove {
+			if r == record {
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			kept = append(kept, record)
+		}
+	}
+
+	return kept
+}
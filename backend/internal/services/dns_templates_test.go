@@ -0,0 +1,131 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestExpandDNSTemplate(t *testing.T) {
+	records := ExpandDNSTemplate([]models.DNSTemplateRecord{
+		{Type: "mx", Name: "@", Value: "{domain-dashed}.mail.protection.outlook.com", Priority: intPtr(0)},
+		{Type: "CNAME", Name: "www", Value: "{domain}", TTL: 600},
+	}, "shop.example.co.uk")
+
+	tests := []struct {
+		typ, name, value string
+		ttl              int
+	}{
+		{"MX", "@", "shop-example-co-uk.mail.protection.outlook.com", 3600},
+		{"CNAME", "www", "shop.example.co.uk", 600},
+	}
+	for i, want := range tests {
+		got := records[i]
+		if got.Type != want.typ || got.Name != want.name || got.Value != want.value || got.TTL != want.ttl {
+			t.Errorf("record %d = %s %s %s %d, want %s %s %s %d", i, got.Type, got.Name, got.Value, got.TTL, want.typ, want.name, want.value, want.ttl)
+		}
+	}
+}
+
+func TestConflictingRecords(t *testing.T) {
+	existing := []*models.DNSRecord{
+		{Type: "TXT", Name: "@", Value: "google-site-verification=abc"},
+		{Type: "TXT", Name: "@", Value: `"v=spf1 a mx -all"`},
+		{Type: "MX", Name: "@", Value: "mail.example.com"},
+		{Type: "A", Name: "www", Value: "192.0.2.1"},
+	}
+
+	tests := []struct {
+		name   string
+		record *models.DNSRecord
+		want   int
+	}{
+		{"SPF replaces SPF", &models.DNSRecord{Type: "TXT", Name: "@", Value: "v=spf1 include:zoho.com ~all"}, 1},
+		{"other TXT coexists", &models.DNSRecord{Type: "TXT", Name: "@", Value: "MS=ms12345"}, 0},
+		{"MX conflicts with MX", &models.DNSRecord{Type: "MX", Name: "@", Value: "mx.zoho.com"}, 1},
+		{"CNAME conflicts with anything", &models.DNSRecord{Type: "CNAME", Name: "www", Value: "example.com"}, 1},
+		{"other name", &models.DNSRecord{Type: "TXT", Name: "mail", Value: "v=spf1 -all"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := len(conflictingRecords(existing, tt.record)); got != tt.want {
+				t.Errorf("conflicts = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyTemplateKeepsUnrelatedTXT(t *testing.T) {
+	db := newTestDB(t)
+	dns, _ := newTestDNSService(t, db, testHostingConfig(t))
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "template.example")
+	verification := &models.DNSRecord{DomainID: domain.ID, Type: "TXT", Name: "@", Value: "google-site-verification=abc", TTL: 3600, IsActive: true}
+	db.Create(verification)
+	if err := dns.SeedDNSTemplates(asUser(owner.ID)); err != nil {
+		t.Fatalf("SeedDNSTemplates: %v", err)
+	}
+	var template models.DNSTemplate
+	db.Where("name = ?", "microsoft-365").First(&template)
+
+	result, err := dns.ApplyTemplate(asUser(owner.ID), domain.ID, template.ID, false)
+	if err != nil {
+		t.Fatalf("ApplyTemplate: %v", err)
+	}
+	if len(result.Created) != 3 || len(result.Skipped) != 0 {
+		t.Errorf("created %d and skipped %d records, want 3 and 0", len(result.Created), len(result.Skipped))
+	}
+
+	var mx models.DNSRecord
+	db.Where("domain_id = ? AND type = ?", domain.ID, "MX").First(&mx)
+	if mx.Value != "template-example.mail.protection.outlook.com" {
+		t.Errorf("MX = %q, want template-example.mail.protection.outlook.com", mx.Value)
+	}
+	var kept int64
+	db.Model(&models.DNSRecord{}).Where("id = ?", verification.ID).Count(&kept)
+	if kept != 1 {
+		t.Error("verification TXT record was removed")
+	}
+
+	// Applying it again finds the SPF record in place
+	result, err = dns.ApplyTemplate(asUser(owner.ID), domain.ID, template.ID, false)
+	if err != nil {
+		t.Fatalf("ApplyTemplate again: %v", err)
+	}
+	if len(result.Skipped) != 3 {
+		t.Errorf("second application skipped %d records, want 3", len(result.Skipped))
+	}
+}
+
+func TestCreateDNSTemplateValidation(t *testing.T) {
+	db := newTestDB(t)
+	dns, _ := newTestDNSService(t, db, testHostingConfig(t))
+	ctx := asUser(createTestUser(t, db).ID, "admin")
+	valid := []models.DNSTemplateRecord{{Type: "A", Name: "@", Value: "192.0.2.20"}}
+	if _, err := dns.CreateDNSTemplate(ctx, "web", "", valid); err != nil {
+		t.Fatalf("CreateDNSTemplate() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		records  []models.DNSTemplateRecord
+		field    string
+	}{
+		{"missing name", " ", valid, "name"},
+		{"taken name", "web", valid, "name"},
+		{"no records", "empty", nil, "records"},
+		{"bad second record", "mail", []models.DNSTemplateRecord{
+			{Type: "A", Name: "@", Value: "192.0.2.20"},
+			{Type: "A", Name: "mail", Value: "not-an-address"},
+		}, "records[1].value"},
+		{"unknown type", "odd", []models.DNSTemplateRecord{{Type: "XYZ", Name: "@", Value: "x"}}, "records[0].type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := dns.CreateDNSTemplate(ctx, tt.template, "", tt.records); fieldMessage(err, tt.field) == "" {
+				t.Fatalf("CreateDNSTemplate() error = %v, want a validation error on %s", err, tt.field)
+			}
+		})
+	}
+}
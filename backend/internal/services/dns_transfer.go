@@ -0,0 +1,309 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/zone"
+)
+
+const (
+	// zoneFileSuffix names the zone files in an archive, e.g. example.com.zone
+	zoneFileSuffix = ".zone"
+	// maxArchiveZones bounds the zone files imported from one archive
+	maxArchiveZones = 500
+	// maxZoneFileSize bounds a single zone file, after decompression
+	maxZoneFileSize = 1 << 20
+)
+
+// ZoneImportResult is the outcome of importing one zone file of an archive
+type ZoneImportResult struct {
+	File     string `json:"file"`
+	Domain   string `json:"domain"`
+	Records  int    `json:"records"`
+	Created  bool   `json:"created"`  // The domain did not exist and was created for the zone
+	Imported bool   `json:"imported"` // The domain's records were replaced by the zone's
+	Error    string `json:"error,omitempty"`
+}
+
+// zoneImport is a validated zone waiting to be written
+type zoneImport struct {
+	result  *ZoneImportResult
+	domain  *models.Domain // Nil when the domain is to be created
+	records []*models.DNSRecord
+}
+
+// ExportZone renders a domain's active records as a BIND zone file
+func (s *DNSService) ExportZone(ctx context.Context, domainID uuid.UUID) (string, error) {
+	var domain models.Domain
+	if err := s.db.WithContext(ctx).Where("id = ?", domainID).First(&domain).Error; err != nil {
+		return "", apperrors.FromDB(err, "domain")
+	}
+
+	var records []models.DNSRecord
+	if err := s.db.WithContext(ctx).Where("domain_id = ?", domainID).Find(&records).Error; err != nil {
+		return "", fmt.Errorf("failed to get DNS records: %w", err)
+	}
+
+	return zone.Render(domain.Name, s.zoneSOA(&domain), records), nil
+}
+
+// ImportZone replaces a domain's records with those of a BIND zone file. The whole file is
+// validated first, so an invalid record leaves the zone unchanged.
+func (s *DNSService) ImportZone(ctx context.Context, domainID uuid.UUID, data string) ([]*models.DNSRecord, error) {
+	var domain models.Domain
+	if err := s.db.WithContext(ctx).Where("id = ?", domainID).First(&domain).Error; err != nil {
+		return nil, apperrors.FromDB(err, "domain")
+	}
+	if err := requireFeature(&domain, FeatureCustomDNS); err != nil {
+		return nil, err
+	}
+
+	records, err := s.parseZone(domain.Name, data)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.replaceZone(ctx, &domain, records); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// ExportAllZones returns a zip archive with a BIND zone file, named after the domain with a
+// .zone suffix, for every domain a user owns
+func (s *DNSService) ExportAllZones(ctx context.Context, userID uuid.UUID) ([]byte, error) {
+	var domains []models.Domain
+	if err := s.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("name").
+		Find(&domains).Error; err != nil {
+		return nil, fmt.Errorf("failed to get domains: %w", err)
+	}
+
+	ids := make([]uuid.UUID, len(domains))
+	for i, domain := range domains {
+		ids[i] = domain.ID
+	}
+	byDomain := make(map[uuid.UUID][]models.DNSRecord)
+	if len(ids) > 0 {
+		var records []models.DNSRecord
+		if err := s.db.WithContext(ctx).Where("domain_id IN ?", ids).Find(&records).Error; err != nil {
+			return nil, fmt.Errorf("failed to get DNS records: %w", err)
+		}
+		for _, record := range records {
+			byDomain[record.DomainID] = append(byDomain[record.DomainID], record)
+		}
+	}
+
+	now := time.Now()
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, domain := range domains {
+		w, err := archive.CreateHeader(&zip.FileHeader{
+			Name:     domain.Name + zoneFileSuffix,
+			Method:   zip.Deflate,
+			Modified: now,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to add zone to archive: %w", err)
+		}
+		if _, err := io.WriteString(w, zone.Render(domain.Name, s.zoneSOA(&domain), byDomain[domain.ID])); err != nil {
+			return nil, fmt.Errorf("failed to add zone to archive: %w", err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write zone archive: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// ImportAllZones imports a zip archive of zone files, as written by ExportAllZones, into a
+// user's domains. Each file maps to the domain it is named after; domains the user does not have
+// are created when createMissing is set and reported otherwise. Every zone is validated before
+// anything is written: if any file fails, nothing is imported and the results say why. Files
+// without the .zone suffix are ignored.
+func (s *DNSService) ImportAllZones(ctx context.Context, userID uuid.UUID, archive []byte, createMissing bool) ([]*ZoneImportResult, error) {
+	reader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		return nil, apperrors.InvalidCode("archive", "dns.archive_invalid", nil)
+	}
+
+	var files []*zip.File
+	for _, file := range reader.File {
+		if !file.FileInfo().IsDir() && strings.HasSuffix(strings.ToLower(file.Name), zoneFileSuffix) {
+			files = append(files, file)
+		}
+	}
+	if len(files) > maxArchiveZones {
+		return nil, apperrors.InvalidCode("archive", "dns.archive_too_large", map[string]string{"max": strconv.Itoa(maxArchiveZones)})
+	}
+
+	imports := make([]*zoneImport, 0, len(files))
+	results := make([]*ZoneImportResult, 0, len(files))
+	seen := make(map[string]bool)
+	failed := false
+	for _, file := range files {
+		name := strings.ToLower(strings.TrimSuffix(path.Base(file.Name), path.Ext(file.Name)))
+		result := &ZoneImportResult{File: file.Name, Domain: name}
+		results = append(results, result)
+
+		if seen[name] {
+			result.Error = "the archive holds more than one zone for this domain"
+			failed = true
+			continue
+		}
+		seen[name] = true
+
+		plan, err := s.checkImport(ctx, userID, name, file, createMissing)
+		if err != nil {
+			result.Error = err.Error()
+			failed = true
+			continue
+		}
+		plan.result = result
+		result.Records = len(plan.records)
+		imports = append(imports, plan)
+	}
+	if failed {
+		return results, nil
+	}
+
+	for _, plan := range imports {
+		domain := plan.domain
+		if domain == nil {
+			created, err := s.domains.CreateDomain(ctx, userID, plan.result.Domain, nil)
+			if err != nil {
+				plan.result.Error = err.Error()
+				continue
+			}
+			domain = created
+			plan.result.Created = true
+		}
+		if err := s.replaceZone(ctx, domain, plan.records); err != nil {
+			plan.result.Error = err.Error()
+			continue
+		}
+		plan.result.Imported = true
+	}
+
+	s.logger.Info("Zone archive imported",
+		zap.String("user_id", userID.String()),
+		zap.Int("zones", len(imports)))
+
+	return results, nil
+}
+
+// checkImport reads and validates one zone file of an archive and finds the domain it belongs to
+func (s *DNSService) checkImport(ctx context.Context, userID uuid.UUID, name string, file *zip.File, createMissing bool) (*zoneImport, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return nil, apperrors.InvalidCode("archive", "dns.archive_invalid", nil)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, maxZoneFileSize+1))
+	if err != nil {
+		return nil, apperrors.InvalidCode("archive", "dns.archive_invalid", nil)
+	}
+	if len(data) > maxZoneFileSize {
+		return nil, apperrors.InvalidCode("archive", "dns.zone_too_large", map[string]string{"max": strconv.Itoa(maxZoneFileSize)})
+	}
+
+	plan := &zoneImport{}
+	var domain models.Domain
+	err = s.db.WithContext(ctx).Where("name = ?", name).First(&domain).Error
+	switch {
+	case err == nil && domain.UserID != userID:
+		return nil, apperrors.InvalidCode("archive", "dns.zone_foreign", map[string]string{"name": name})
+	case err == nil:
+		if err := requireFeature(&domain, FeatureCustomDNS); err != nil {
+			return nil, err
+		}
+		plan.domain = &domain
+	case errors.Is(err, gorm.ErrRecordNotFound) && createMissing:
+		if len(name) > 253 || !domainNamePattern.MatchString(name) {
+			return nil, apperrors.InvalidCode("name", "domain.invalid", nil)
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, apperrors.InvalidCode("archive", "dns.zone_domain_missing", map[string]string{"name": name})
+	default:
+		return nil, fmt.Errorf("failed to get domain: %w", err)
+	}
+
+	plan.records, err = s.parseZone(name, string(data))
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// parseZone parses a zone file and validates its records as a whole zone: each record must be
+// valid, and the zone must follow the nameserver rules and record limits
+func (s *DNSService) parseZone(origin, data string) ([]*models.DNSRecord, error) {
+	parsed, err := zone.Parse(origin, data)
+	if err != nil {
+		return nil, apperrors.InvalidCode("zone", "dns.zone_invalid", map[string]string{"error": err.Error()})
+	}
+
+	records := make([]*models.DNSRecord, len(parsed))
+	for i := range parsed {
+		record := &parsed[i]
+		if err := validateDNSRecord(record); err != nil {
+			return nil, fmt.Errorf("%s %s: %w", record.Name, record.Type, err)
+		}
+		record.TTL = s.clampTTL(record.TTL)
+		records[i] = record
+	}
+
+	if err := checkNameservers(records, origin, records...); err != nil {
+		return nil, err
+	}
+	if err := s.checkRecordLimits(records, records); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// replaceZone replaces all records of a domain with the given ones and syncs the zone
+func (s *DNSService) replaceZone(ctx context.Context, domain *models.Domain, records []*models.DNSRecord) error {
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// The SOA is the panel's; zone files cannot replace it
+		if err := tx.Where("domain_id = ? AND type <> ?", domain.ID, "SOA").Delete(&models.DNSRecord{}).Error; err != nil {
+			return err
+		}
+		for _, record := range records {
+			record.DomainID = domain.ID
+			if err := tx.Create(record).Error; err != nil {
+				return err
+			}
+		}
+		return s.recordVersion(ctx, tx, domain.ID, "import", nil, nil, nil)
+	}); err != nil {
+		return fmt.Errorf("failed to import DNS zone: %w", err)
+	}
+
+	s.zoneChanged(ctx, domain.ID)
+
+	s.logger.Info("DNS zone imported",
+		zap.String("domain", domain.Name),
+		zap.Int("records", len(records)))
+
+	return nil
+}
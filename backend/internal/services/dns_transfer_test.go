@@ -0,0 +1,205 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// zoneArchive zips the given files, in order
+func zoneArchive(t *testing.T, files ...[2]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, file := range files {
+		w, err := archive.Create(file[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, file[1])
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// createDNSDomain creates a domain with custom DNS enabled
+func createDNSDomain(t *testing.T, db *gorm.DB, owner *models.User, name string) *models.Domain {
+	t.Helper()
+
+	domain := createTestDomain(t, db, owner, name)
+	db.Model(domain).Update("custom_dns_enabled", true)
+	domain.CustomDNSEnabled = true
+	return domain
+}
+
+func TestExportAllZones(t *testing.T) {
+	db := newTestDB(t)
+	dns, _ := newTestDNSService(t, db, testHostingConfig(t))
+	owner := createTestUser(t, db)
+	other := createTestUser(t, db)
+	shop := createDNSDomain(t, db, owner, "shop.example")
+	createDNSDomain(t, db, owner, "blog.example")
+	createDNSDomain(t, db, other, "other.example")
+	mustCreate(t, db, &models.DNSRecord{DomainID: shop.ID, Type: "A", Name: "www", Value: "192.0.2.10", TTL: 300, IsActive: true})
+
+	data, err := dns.ExportAllZones(asUser(owner.ID), owner.ID)
+	if err != nil {
+		t.Fatalf("ExportAllZones() error = %v", err)
+	}
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("export is not a zip archive: %v", err)
+	}
+
+	var names []string
+	contents := make(map[string]string)
+	for _, file := range reader.File {
+		names = append(names, file.Name)
+		rc, _ := file.Open()
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		contents[file.Name] = string(content)
+	}
+	if strings.Join(names, " ") != "blog.example.zone shop.example.zone" {
+		t.Errorf("archive files = %v, want the owner's zones by name", names)
+	}
+	if !strings.HasPrefix(contents["shop.example.zone"], "$ORIGIN shop.example.\n") || !strings.Contains(contents["shop.example.zone"], "www\t300\tIN\tA\t192.0.2.10\n") {
+		t.Errorf("shop.example.zone:\n%s", contents["shop.example.zone"])
+	}
+
+	empty, err := dns.ExportAllZones(asUser(owner.ID), createTestUser(t, db).ID)
+	if err != nil {
+		t.Fatalf("ExportAllZones() without domains error = %v", err)
+	}
+	if reader, err := zip.NewReader(bytes.NewReader(empty), int64(len(empty))); err != nil || len(reader.File) != 0 {
+		t.Errorf("export without domains: %v", err)
+	}
+}
+
+func TestImportAllZones(t *testing.T) {
+	const nameservers = "@ NS ns1.host.example.\n@ NS ns2.host.example.\n"
+	const shopZone = nameservers + "www 600 A 192.0.2.20\n"
+	const newZone = nameservers + "@ A 192.0.2.30\n"
+
+	tests := []struct {
+		name          string
+		files         [][2]string
+		createMissing bool
+		wantErrors    map[string]string // Result errors by file; any error means nothing is imported
+	}{
+		{
+			name:          "existing and created",
+			files:         [][2]string{{"shop.example.zone", shopZone}, {"zones/New.Example.zone", newZone}, {"README", "not a zone"}},
+			createMissing: true,
+		},
+		{
+			name:       "missing domain",
+			files:      [][2]string{{"shop.example.zone", shopZone}, {"new.example.zone", newZone}},
+			wantErrors: map[string]string{"new.example.zone": "archive: domain not found"},
+		},
+		{
+			name:          "another account's domain",
+			files:         [][2]string{{"shop.example.zone", shopZone}, {"other.example.zone", newZone}},
+			createMissing: true,
+			wantErrors:    map[string]string{"other.example.zone": "archive: other.example belongs to another account"},
+		},
+		{
+			name:       "invalid record",
+			files:      [][2]string{{"shop.example.zone", shopZone}, {"blog.example.zone", nameservers + "@ A 192.0.2.300\n"}},
+			wantErrors: map[string]string{"blog.example.zone": "@ A: invalid input"},
+		},
+		{
+			name:       "oversized zone",
+			files:      [][2]string{{"shop.example.zone", shopZone}, {"blog.example.zone", nameservers + strings.Repeat(";", maxZoneFileSize)}},
+			wantErrors: map[string]string{"blog.example.zone": "archive: zone files may be at most"},
+		},
+		{
+			name:       "duplicate zone",
+			files:      [][2]string{{"shop.example.zone", shopZone}, {"copy/shop.example.zone", shopZone}},
+			wantErrors: map[string]string{"copy/shop.example.zone": "more than one zone"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			cfg := testHostingConfig(t)
+			dns, _ := newTestDNSService(t, db, cfg)
+			owner := createTestUser(t, db)
+			shop := createDNSDomain(t, db, owner, "shop.example")
+			createDNSDomain(t, db, owner, "blog.example")
+			createDNSDomain(t, db, createTestUser(t, db), "other.example")
+			mustCreate(t, db, &models.DNSRecord{DomainID: shop.ID, Type: "A", Name: "old", Value: "192.0.2.1", TTL: 3600, IsActive: true})
+
+			results, err := dns.ImportAllZones(asUser(owner.ID), owner.ID, zoneArchive(t, tt.files...), tt.createMissing)
+			if err != nil {
+				t.Fatalf("ImportAllZones() error = %v", err)
+			}
+
+			for _, result := range results {
+				want := tt.wantErrors[result.File]
+				if want == "" && result.Error != "" {
+					t.Errorf("%s: error %q", result.File, result.Error)
+				}
+				if want != "" && !strings.Contains(result.Error, want) {
+					t.Errorf("%s: error %q, want %q", result.File, result.Error, want)
+				}
+				if result.Imported != (len(tt.wantErrors) == 0) {
+					t.Errorf("%s: imported = %v", result.File, result.Imported)
+				}
+			}
+
+			var records []models.DNSRecord
+			db.Where("domain_id = ?", shop.ID).Order("name").Find(&records)
+			if len(tt.wantErrors) > 0 {
+				if len(records) != 1 || records[0].Name != "old" {
+					t.Errorf("shop.example records = %+v, want them unchanged", records)
+				}
+				return
+			}
+
+			if len(results) != 2 || results[0].Domain != "shop.example" || results[0].Records != 3 || results[1].Domain != "new.example" || !results[1].Created {
+				t.Errorf("results = %+v %+v", results[0], results[1])
+			}
+			if len(records) != 3 || records[2].Name != "www" || records[2].TTL != 600 {
+				t.Errorf("shop.example records = %+v, want the zone's", records)
+			}
+			var created models.Domain
+			if err := db.Where("name = ? AND user_id = ?", "new.example", owner.ID).First(&created).Error; err != nil {
+				t.Fatalf("new.example not created: %v", err)
+			}
+			var address models.DNSRecord
+			if err := db.Where("domain_id = ? AND type = ? AND name = ?", created.ID, "A", "@").First(&address).Error; err != nil || address.Value != "192.0.2.30" {
+				t.Errorf("new.example apex A = %+v (%v)", address, err)
+			}
+		})
+	}
+}
+
+func TestImportAllZonesRejectsArchives(t *testing.T) {
+	db := newTestDB(t)
+	dns, _ := newTestDNSService(t, db, testHostingConfig(t))
+	owner := createTestUser(t, db)
+
+	if _, err := dns.ImportAllZones(asUser(owner.ID), owner.ID, []byte("not a zip"), false); fieldMessage(err, "archive") == "" {
+		t.Errorf("invalid archive: error = %v", err)
+	}
+
+	files := make([][2]string, maxArchiveZones+1)
+	for i := range files {
+		files[i] = [2]string{strings.Repeat("a", i%50+1) + string(rune('a'+i%26)) + ".example.zone", ""}
+	}
+	if _, err := dns.ImportAllZones(asUser(owner.ID), owner.ID, zoneArchive(t, files...), false); apperrors.HTTPStatus(err) != http.StatusUnprocessableEntity {
+		t.Errorf("oversized archive: error = %v", err)
+	}
+}
@@ -2,35 +2,148 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
+	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/cache"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/lock"
 	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/runner"
+	"github.com/mynodecp/mynodecp/backend/internal/tracing"
+	"github.com/mynodecp/mynodecp/backend/internal/vhost"
 )
 
+// webRoot is the directory under which every domain's content lives
+const webRoot = "/var/www"
+
+var phpVersionPattern = regexp.MustCompile(`^\d+\.\d+$`)
+
+// domainNamePattern matches lower-case fully qualified domain names
+var domainNamePattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+
+// subdomainLabelPattern matches a single lower-case DNS label
+var subdomainLabelPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
 // DomainService handles domain-related operations
 type DomainService struct {
 	db     *gorm.DB
 	redis  *redis.Client
 	logger *zap.Logger
+	config config.HostingConfig
+	vhost  *vhost.Generator
+	cache  *cache.Cache
+	locks  *lock.Locker
+	runner runner.Runner // Clears opcaches and reloads nginx
+
+	resolver  Resolver
+	zones     ZonePublisher
+	discovery MailDiscovery
+	ftp       FTPUsers
 }
 
 // NewDomainService creates a new domain service
-func NewDomainService(db *gorm.DB, redis *redis.Client, logger *zap.Logger) *DomainService {
+func NewDomainService(db *gorm.DB, redis *redis.Client, logger *zap.Logger, config config.HostingConfig, cache *cache.Cache, locks *lock.Locker, runner runner.Runner) *DomainService {
 	return &DomainService{
 		db:     db,
 		redis:  redis,
 		logger: logger,
+		config: config,
+		vhost:  vhost.NewGenerator(config),
+		cache:  cache,
+		locks:  locks,
+		runner: runner,
+
+		resolver: net.DefaultResolver,
 	}
 }
 
-// CreateDomain creates a new domain
-func (s *DomainService) CreateDomain(ctx context.Context, userID uuid.UUID, name string) (*models.Domain, error) {
+// ZonePublisher creates records in and publishes the zones of domains the domain service changes
+type ZonePublisher interface {
+	// AddRecords creates records of the panel's own in a domain's zone and publishes it
+	AddRecords(ctx context.Context, domainID uuid.UUID, records []*models.DNSRecord) error
+	// ZoneChanged publishes a domain's zone after its records changed
+	ZoneChanged(ctx context.Context, domainID uuid.UUID)
+	// ZoneRenamed publishes the zone of a domain under its new name and withdraws the one of oldName
+	ZoneRenamed(ctx context.Context, domainID uuid.UUID, oldName string)
+}
+
+// SetZonePublisher sets what creates a domain's default and subdomain records and publishes its
+// zone when a rename or a subdomain's deletion changes it. The DNS service is built on top of the domain service, so it cannot be passed to
+// NewDomainService.
+func (s *DomainService) SetZonePublisher(zones ZonePublisher) {
+	s.zones = zones
+}
+
+// MailDiscovery creates the DNS records mail clients use to find a domain's mail settings
+type MailDiscovery interface {
+	// AddDiscoveryRecords creates the configured records the domain does not have yet
+	AddDiscoveryRecords(ctx context.Context, domain *models.Domain) ([]*models.DNSRecord, error)
+}
+
+// FTPUsers rewrites the FTP server's logins, which name the domain and its directory
+type FTPUsers interface {
+	// SyncFTPUsers rewrites the logins from the stored FTP accounts
+	SyncFTPUsers(ctx context.Context) error
+}
+
+// SetFTPUsers sets what rewrites the FTP logins after a rename. The FTP service is created after
+// the domain service, so it cannot be passed to NewDomainService.
+func (s *DomainService) SetFTPUsers(ftp FTPUsers) {
+	s.ftp = ftp
+}
+
+// SetMailDiscovery sets what creates a domain's mail discovery records when its email is
+// enabled. The email service is built on top of the domain service, so it cannot be passed to
+// NewDomainService.
+func (s *DomainService) SetMailDiscovery(discovery MailDiscovery) {
+	s.discovery = discovery
+}
+
+// CreateDomain creates a new domain. Its quotas come from the owner's package; requested quotas,
+// which may be nil, can only lower them. When the package has automatic certificates, the domain
+// is queued for issuance, which happens once it points at the server.
+func (s *DomainService) CreateDomain(ctx context.Context, userID uuid.UUID, name string, requested *DomainQuotas) (_ *models.Domain, err error) {
+	ctx, span := tracing.Start(ctx, "DomainService.CreateDomain", attribute.String("domain.name", name))
+	defer tracing.End(span, &err)
+
+	name = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+	if len(name) > 253 || !domainNamePattern.MatchString(name) {
+		return nil, apperrors.InvalidCode("name", "domain.invalid", nil)
+	}
+
+	// Held until the domain exists, so a concurrent request cannot pass the check below as well
+	held, err := lockDomainName(ctx, s.locks, name)
+	if err != nil {
+		return nil, err
+	}
+	defer held.Release()
+
+	v := apperrors.NewValidation()
+	if requested != nil && requested.DiskQuota < 0 {
+		v.Add("disk_quota", "disk quota cannot be negative")
+	}
+	if requested != nil && requested.BandwidthQuota < 0 {
+		v.Add("bandwidth_quota", "bandwidth quota cannot be negative")
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
 	// Check if domain already exists
 	var count int64
 	if err := s.db.WithContext(ctx).Model(&models.Domain{}).
@@ -40,51 +153,134 @@ func (s *DomainService) CreateDomain(ctx context.Context, userID uuid.UUID, name
 	}
 
 	if count > 0 {
-		return nil, fmt.Errorf("domain already exists")
+		return nil, apperrors.InvalidCode("name", "domain.exists", nil)
+	}
+
+	allowed, err := s.DefaultQuotas(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	quotas := allowed.clamp(requested)
+
+	autoSSL := false
+	if s.config.ACMEDirectoryURL != "" && !dryRun(ctx, s.config) {
+		if autoSSL, err = s.AutoSSL(ctx, userID); err != nil {
+			return nil, err
+		}
 	}
 
 	// Create document root path
-	documentRoot := filepath.Join("/var/www", name, "public_html")
+	documentRoot := filepath.Join(domainRoot(name), "public_html")
 
 	domain := &models.Domain{
-		UserID:       userID,
-		Name:         name,
-		DocumentRoot: documentRoot,
-		IsActive:     true,
-		PHPVersion:   "8.2",
+		UserID:         userID,
+		Name:           name,
+		DocumentRoot:   documentRoot,
+		IsActive:       true,
+		PHPVersion:     "8.2",
+		PHPHandler:     vhost.PHPHandlerFPM,
+		DiskQuota:      quotas.DiskQuota,
+		BandwidthQuota: quotas.BandwidthQuota,
+	}
+	if autoSSL {
+		now := time.Now()
+		domain.AutoSSLStatus = AutoSSLPending
+		domain.AutoSSLNextAt = &now
+	}
+
+	// New domains go to the default node when one is registered
+	var node models.Node
+	hasNode := s.db.WithContext(ctx).Where("is_default = ? AND is_active = ?", true, true).First(&node).Error == nil
+	var server *models.Node
+	if hasNode {
+		domain.NodeID = &node.ID
+		server = &node
+	}
+	if err := checkCapacity(ctx, s.db, s.logger, s.config, server, nil, quotas); err != nil {
+		return nil, err
 	}
 
 	if err := s.db.WithContext(ctx).Create(domain).Error; err != nil {
 		return nil, fmt.Errorf("failed to create domain: %w", err)
 	}
+	if hasNode {
+		domain.Node = &node
+	}
 
 	// Create default DNS records
-	if err := s.createDefaultDNSRecords(ctx, domain.ID, name); err != nil {
+	if err := s.createDefaultDNSRecords(ctx, domain); err != nil {
 		s.logger.Error("Failed to create default DNS records", zap.Error(err))
 	}
 
-	// Create document root directory (this would be done by a system service)
-	s.logger.Info("Domain created", zap.String("domain", name), zap.String("user_id", userID.String()))
+	// New domains have email enabled, so they get the default mail addresses right away
+	if defaults, err := s.createDefaultMail(ctx, domain); err != nil {
+		s.logger.Error("Failed to create default mail addresses", zap.String("domain", name), zap.Error(err))
+	} else if defaults != nil {
+		for _, account := range defaults.Mailboxes {
+			domain.EmailAccounts = append(domain.EmailAccounts, *account)
+		}
+	}
+	s.addMailDiscovery(ctx, domain)
+
+	// Until the owner uploads a site, the document root serves the landing page
+	s.writeLandingPage(ctx, domain)
+
+	s.logger.Info("Domain created", zap.String("domain", name), zap.String("user_id", userID.String()), zap.Bool("auto_ssl", autoSSL))
 
 	return domain, nil
 }
 
-// GetDomain retrieves a domain by ID
+// GetDomain retrieves a domain by ID. The domain, its subdomains, DNS records and certificates are
+// cached; the owner is loaded on every call, since user changes do not touch the domain's cache.
 func (s *DomainService) GetDomain(ctx context.Context, domainID uuid.UUID) (*models.Domain, error) {
+	domain, err := cache.GetOrSet(ctx, s.cache, cache.DomainKey(domainID), func() (*models.Domain, error) {
+		var domain models.Domain
+		if err := s.db.WithContext(ctx).
+			Preload("Subdomains").
+			Preload("DNSRecords").
+			Preload("SSLCertificates").
+			Where("id = ?", domainID).
+			First(&domain).Error; err != nil {
+			return nil, apperrors.FromDB(err, "domain")
+		}
+
+		return &domain, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	domain.User = models.User{}
+	if err := s.db.WithContext(ctx).Where("id = ?", domain.UserID).First(&domain.User).Error; err != nil {
+		return nil, apperrors.FromDB(err, "user")
+	}
+
+	return domain, nil
+}
+
+// ownedDomain loads a domain and checks that the caller may manage it
+func (s *DomainService) ownedDomain(ctx context.Context, domainID uuid.UUID) (*models.Domain, error) {
 	var domain models.Domain
-	if err := s.db.WithContext(ctx).
-		Preload("User").
-		Preload("Subdomains").
-		Preload("DNSRecords").
-		Preload("SSLCertificates").
-		Where("id = ?", domainID).
-		First(&domain).Error; err != nil {
-		return nil, fmt.Errorf("failed to get domain: %w", err)
+	if err := s.db.WithContext(ctx).Where("id = ?", domainID).First(&domain).Error; err != nil {
+		return nil, apperrors.FromDB(err, "domain")
+	}
+
+	if err := authorizeDomain(ctx, &domain); err != nil {
+		return nil, err
 	}
 
 	return &domain, nil
 }
 
+// ReloadDomain retrieves a domain by ID as GetDomain does, but from the database, replacing the
+// cached copy. Preconditions such as If-Match are checked against it.
+func (s *DomainService) ReloadDomain(ctx context.Context, domainID uuid.UUID) (*models.Domain, error) {
+	if err := s.cache.Invalidate(ctx, cache.DomainKey(domainID)); err != nil {
+		return nil, fmt.Errorf("failed to invalidate domain cache: %w", err)
+	}
+	return s.GetDomain(ctx, domainID)
+}
+
 // GetUserDomains retrieves all domains for a user
 func (s *DomainService) GetUserDomains(ctx context.Context, userID uuid.UUID, offset, limit int) ([]*models.Domain, int64, error) {
 	var domains []*models.Domain
@@ -112,13 +308,19 @@ func (s *DomainService) GetUserDomains(ctx context.Context, userID uuid.UUID, of
 // UpdateDomain updates domain information
 func (s *DomainService) UpdateDomain(ctx context.Context, domainID uuid.UUID, updates map[string]interface{}) (*models.Domain, error) {
 	var domain models.Domain
-	if err := s.db.WithContext(ctx).Where("id = ?", domainID).First(&domain).Error; err != nil {
-		return nil, fmt.Errorf("domain not found: %w", err)
+	if err := s.db.WithContext(ctx).Preload("Node").Where("id = ?", domainID).First(&domain).Error; err != nil {
+		return nil, apperrors.FromDB(err, "domain")
+	}
+	if raised := raisedQuotas(&domain, updates); raised != nil {
+		if err := checkCapacity(ctx, s.db, s.logger, s.config, domain.Node, &domain.ID, raised); err != nil {
+			return nil, err
+		}
 	}
 
 	if err := s.db.WithContext(ctx).Model(&domain).Updates(updates).Error; err != nil {
 		return nil, fmt.Errorf("failed to update domain: %w", err)
 	}
+	s.invalidateDomain(ctx, domainID)
 
 	// Reload domain with relationships
 	if err := s.db.WithContext(ctx).
@@ -136,20 +338,215 @@ func (s *DomainService) UpdateDomain(ctx context.Context, domainID uuid.UUID, up
 
 // DeleteDomain soft deletes a domain
 func (s *DomainService) DeleteDomain(ctx context.Context, domainID uuid.UUID) error {
+	held, err := lockDomain(ctx, s.locks, domainID)
+	if err != nil {
+		return err
+	}
+	defer held.Release()
+
 	if err := s.db.WithContext(ctx).Where("id = ?", domainID).Delete(&models.Domain{}).Error; err != nil {
 		return fmt.Errorf("failed to delete domain: %w", err)
 	}
+	s.invalidateDomain(ctx, domainID)
 
 	s.logger.Info("Domain deleted", zap.String("domain_id", domainID.String()))
 	return nil
 }
 
-// CreateSubdomain creates a new subdomain
+// SetForceHTTPS enables or disables the HTTP to HTTPS redirect for a domain
+func (s *DomainService) SetForceHTTPS(ctx context.Context, domainID uuid.UUID, enabled bool) (*models.Domain, error) {
+	var domain models.Domain
+	if err := s.db.WithContext(ctx).Where("id = ?", domainID).First(&domain).Error; err != nil {
+		return nil, apperrors.FromDB(err, "domain")
+	}
+	if err := authorizeDomain(ctx, &domain); err != nil {
+		return nil, err
+	}
+
+	// The vhost only redirects while it serves HTTPS, so the same check decides here. HasSSL is not
+	// cleared when a certificate expires, so a valid certificate must be on file as well.
+	if enabled {
+		var valid int64
+		if err := s.db.WithContext(ctx).Model(&models.SSLCertificate{}).
+			Where("domain_id = ? AND is_active = ? AND expires_at > ?", domain.ID, true, time.Now()).
+			Count(&valid).Error; err != nil {
+			return nil, fmt.Errorf("failed to check certificates: %w", err)
+		}
+		if !vhost.ServesHTTPS(&domain) || valid == 0 {
+			return nil, apperrors.PreconditionCode("https_requires_certificate", map[string]string{"name": domain.Name})
+		}
+	}
+
+	if err := s.db.WithContext(ctx).Model(&domain).Update("force_https", enabled).Error; err != nil {
+		return nil, fmt.Errorf("failed to update domain: %w", err)
+	}
+	s.invalidateDomain(ctx, domainID)
+
+	s.writeVhost(ctx, &domain)
+
+	s.logger.Info("Force HTTPS updated", zap.String("domain", domain.Name), zap.Bool("enabled", enabled))
+
+	return &domain, nil
+}
+
+// Domain features that can be switched off per domain
+const (
+	FeatureEmail     = "email"
+	FeatureDatabases = "databases"
+	FeatureCustomDNS = "custom_dns"
+)
+
+// DomainFeatures toggles domain features; nil fields are left unchanged
+type DomainFeatures struct {
+	Email     *bool `json:"email,omitempty"`
+	Databases *bool `json:"databases,omitempty"`
+	CustomDNS *bool `json:"custom_dns,omitempty"`
+}
+
+// SetFeatures enables or disables services for a domain, for example when its hosting package changes.
+// Disabling a feature only blocks new resources; existing ones are kept. Enabling email for the
+// first time sets up the configured default mailboxes and aliases, which are returned, and
+// enabling it adds the mail discovery records the domain lacks.
+func (s *DomainService) SetFeatures(ctx context.Context, domainID uuid.UUID, features DomainFeatures) (*models.Domain, *DefaultMail, error) {
+	var domain models.Domain
+	if err := s.db.WithContext(ctx).Where("id = ?", domainID).First(&domain).Error; err != nil {
+		return nil, nil, apperrors.FromDB(err, "domain")
+	}
+
+	updates := map[string]interface{}{}
+	if features.Email != nil {
+		updates["email_enabled"] = *features.Email
+	}
+	if features.Databases != nil {
+		updates["databases_enabled"] = *features.Databases
+	}
+	if features.CustomDNS != nil {
+		updates["custom_dns_enabled"] = *features.CustomDNS
+	}
+	if len(updates) == 0 {
+		return &domain, nil, nil
+	}
+
+	if err := s.db.WithContext(ctx).Model(&domain).Updates(updates).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to update domain features: %w", err)
+	}
+	s.invalidateDomain(ctx, domainID)
+
+	s.logger.Info("Domain features updated", zap.String("domain", domain.Name), zap.Any("features", updates))
+
+	if features.Email != nil {
+		domain.EmailEnabled = *features.Email
+	}
+	defaults, err := s.createDefaultMail(ctx, &domain)
+	if err != nil {
+		return nil, nil, err
+	}
+	if features.Email != nil && *features.Email {
+		s.addMailDiscovery(ctx, &domain)
+	}
+
+	return &domain, defaults, nil
+}
+
+// addMailDiscovery creates the mail discovery records of a domain whose email is enabled and
+// publishes its zone. Failures are logged, not returned, since mail works without them.
+func (s *DomainService) addMailDiscovery(ctx context.Context, domain *models.Domain) {
+	if s.discovery == nil || !domain.EmailEnabled {
+		return
+	}
+
+	if _, err := s.discovery.AddDiscoveryRecords(ctx, domain); err != nil {
+		s.logger.Error("Failed to create mail discovery records", zap.String("domain", domain.Name), zap.Error(err))
+	}
+}
+
+// requireFeature returns a FeatureDisabledError when a feature is switched off for a domain
+func requireFeature(domain *models.Domain, feature string) error {
+	var enabled bool
+	switch feature {
+	case FeatureEmail:
+		enabled = domain.EmailEnabled
+	case FeatureDatabases:
+		enabled = domain.DatabasesEnabled
+	case FeatureCustomDNS:
+		enabled = domain.CustomDNSEnabled
+	}
+
+	if !enabled {
+		return apperrors.FeatureDisabled(feature)
+	}
+	return nil
+}
+
+// SetUserDomainsSuspended suspends or resumes every domain of a user. Suspended sites answer
+// with 503 and their mailboxes are paused; resuming leaves domains disabled by other means
+// untouched, including domains suspended on their own with Suspend.
+func (s *DomainService) SetUserDomainsSuspended(ctx context.Context, userID uuid.UUID, suspended bool) error {
+	query := s.db.WithContext(ctx).Preload("Subdomains").Where("user_id = ?", userID)
+	if suspended {
+		query = query.Where("suspended_at IS NULL")
+	} else {
+		query = query.Where("suspension_reason = ''")
+	}
+
+	var domains []*models.Domain
+	if err := query.Find(&domains).Error; err != nil {
+		return fmt.Errorf("failed to get user domains: %w", err)
+	}
+	if len(domains) == 0 {
+		return nil
+	}
+
+	domainIDs := make([]uuid.UUID, len(domains))
+	for i, domain := range domains {
+		domainIDs[i] = domain.ID
+	}
+
+	var suspendedAt *time.Time
+	if suspended {
+		now := time.Now()
+		suspendedAt = &now
+	}
+
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Domain{}).Where("id IN ?", domainIDs).Update("suspended_at", suspendedAt).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.EmailAccount{}).Where("domain_id IN ?", domainIDs).Update("suspended_at", suspendedAt).Error
+	}); err != nil {
+		return fmt.Errorf("failed to update domain suspension: %w", err)
+	}
+
+	for _, domain := range domains {
+		s.invalidateDomain(ctx, domain.ID)
+
+		domain.SuspendedAt = suspendedAt
+		s.writeVhost(ctx, domain)
+		for i := range domain.Subdomains {
+			s.writeSubdomainVhost(ctx, domain, &domain.Subdomains[i])
+		}
+	}
+
+	s.logger.Info("User domains suspension updated",
+		zap.String("user_id", userID.String()),
+		zap.Int("domains", len(domains)),
+		zap.Bool("suspended", suspended))
+
+	return nil
+}
+
+// CreateSubdomain creates a new subdomain. The name must be a single DNS label that is not
+// reserved, and the domain must be below the subdomain limit of its owner's package.
 func (s *DomainService) CreateSubdomain(ctx context.Context, domainID uuid.UUID, name string) (*models.Subdomain, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if err := s.checkSubdomainName(name); err != nil {
+		return nil, err
+	}
+
 	// Check if domain exists
 	var domain models.Domain
-	if err := s.db.WithContext(ctx).Where("id = ?", domainID).First(&domain).Error; err != nil {
-		return nil, fmt.Errorf("domain not found: %w", err)
+	if err := s.db.WithContext(ctx).Preload("Node").Where("id = ?", domainID).First(&domain).Error; err != nil {
+		return nil, apperrors.FromDB(err, "domain")
 	}
 
 	// Check if subdomain already exists
@@ -161,11 +558,26 @@ func (s *DomainService) CreateSubdomain(ctx context.Context, domainID uuid.UUID,
 	}
 
 	if count > 0 {
-		return nil, fmt.Errorf("subdomain already exists")
+		return nil, apperrors.InvalidCode("name", "subdomain.exists", nil)
+	}
+
+	limit, err := s.SubdomainLimit(ctx, domain.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 {
+		if err := s.db.WithContext(ctx).Model(&models.Subdomain{}).
+			Where("domain_id = ?", domainID).
+			Count(&count).Error; err != nil {
+			return nil, fmt.Errorf("failed to count subdomains: %w", err)
+		}
+		if count >= int64(limit) {
+			return nil, apperrors.PreconditionCode("subdomain_limit_reached", map[string]string{"limit": strconv.Itoa(limit)})
+		}
 	}
 
 	// Create document root path
-	documentRoot := filepath.Join("/var/www", domain.Name, "subdomains", name)
+	documentRoot := filepath.Join(domainRoot(domain.Name), "subdomains", name)
 
 	subdomain := &models.Subdomain{
 		DomainID:     domainID,
@@ -177,19 +589,11 @@ func (s *DomainService) CreateSubdomain(ctx context.Context, domainID uuid.UUID,
 	if err := s.db.WithContext(ctx).Create(subdomain).Error; err != nil {
 		return nil, fmt.Errorf("failed to create subdomain: %w", err)
 	}
+	defer s.invalidateDomain(ctx, domainID)
 
-	// Create DNS record for subdomain
-	dnsRecord := &models.DNSRecord{
-		DomainID: domainID,
-		Type:     "A",
-		Name:     name,
-		Value:    "127.0.0.1", // This would be the server's IP
-		TTL:      3600,
-		IsActive: true,
-	}
-
-	if err := s.db.WithContext(ctx).Create(dnsRecord).Error; err != nil {
-		s.logger.Error("Failed to create DNS record for subdomain", zap.Error(err))
+	// Create DNS records for subdomain
+	if err := s.addRecords(ctx, domainID, s.addressRecords(&domain, name)); err != nil {
+		s.logger.Error("Failed to create DNS records for subdomain", zap.String("subdomain", name), zap.Error(err))
 	}
 
 	return subdomain, nil
@@ -207,34 +611,234 @@ func (s *DomainService) GetSubdomains(ctx context.Context, domainID uuid.UUID) (
 	return subdomains, nil
 }
 
-// UpdateSubdomain updates subdomain information
+// UpdateSubdomain updates subdomain information. Renaming a subdomain moves its vhost and the
+// address records CreateSubdomain made to the new name, the way deleting and creating it would.
 func (s *DomainService) UpdateSubdomain(ctx context.Context, subdomainID uuid.UUID, updates map[string]interface{}) (*models.Subdomain, error) {
 	var subdomain models.Subdomain
 	if err := s.db.WithContext(ctx).Where("id = ?", subdomainID).First(&subdomain).Error; err != nil {
-		return nil, fmt.Errorf("subdomain not found: %w", err)
+		return nil, apperrors.FromDB(err, "subdomain")
 	}
 
-	if err := s.db.WithContext(ctx).Model(&subdomain).Updates(updates).Error; err != nil {
-		return nil, fmt.Errorf("failed to update subdomain: %w", err)
+	var domain models.Domain
+	if err := s.db.WithContext(ctx).Preload("Node").Where("id = ?", subdomain.DomainID).First(&domain).Error; err != nil {
+		return nil, apperrors.FromDB(err, "domain")
+	}
+	if err := authorizeDomain(ctx, &domain); err != nil {
+		return nil, err
 	}
 
+	previousName := subdomain.Name
+	if value, ok := updates["name"]; ok {
+		name, isString := value.(string)
+		if !isString {
+			return nil, apperrors.InvalidCode("name", "subdomain.invalid", nil)
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if err := s.checkSubdomainName(name); err != nil {
+			return nil, err
+		}
+		if name != previousName {
+			var count int64
+			if err := s.db.WithContext(ctx).Model(&models.Subdomain{}).
+				Where("domain_id = ? AND name = ?", domain.ID, name).
+				Count(&count).Error; err != nil {
+				return nil, fmt.Errorf("failed to check subdomain existence: %w", err)
+			}
+			if count > 0 {
+				return nil, apperrors.InvalidCode("name", "subdomain.exists", nil)
+			}
+		}
+		updates["name"] = name
+	}
+
+	// Custom document roots must stay inside the parent domain's directory, also after following
+	// symlinks
+	if value, ok := updates["document_root"]; ok {
+		root, isString := value.(string)
+		if !isString {
+			return nil, apperrors.InvalidCode("document_root", "field.string", nil)
+		}
+		if root == "" {
+			return nil, apperrors.InvalidCode("document_root", "field.empty", nil)
+		}
+
+		resolved, err := resolveRealWithin(domainRoot(domain.Name), root)
+		if err != nil {
+			return nil, apperrors.InvalidCode("document_root", "subdomain.root_outside", map[string]string{"dir": domainRoot(domain.Name)})
+		}
+		updates["document_root"] = resolved
+	}
+
+	// An empty PHP version clears the override so the domain's version is inherited
+	if value, ok := updates["php_version"]; ok {
+		version, isString := value.(string)
+		if !isString || (version != "" && !phpVersionPattern.MatchString(version)) {
+			return nil, apperrors.InvalidCode("php_version", "php.version_invalid", nil)
+		}
+		if version != "" && version != subdomain.PHPVersion {
+			if err := s.checkPHPVersionSelectable("php_version", version); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var removed []models.DNSRecord
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&subdomain).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to update subdomain: %w", err)
+		}
+		if subdomain.Name == previousName {
+			return nil
+		}
+
+		var err error
+		removed, _, err = s.subdomainRecords(tx, &domain, previousName)
+		if err != nil || len(removed) == 0 {
+			return err
+		}
+		ids := make([]uuid.UUID, len(removed))
+		for i, record := range removed {
+			ids[i] = record.ID
+		}
+		if err := tx.Where("id IN ?", ids).Delete(&models.DNSRecord{}).Error; err != nil {
+			return fmt.Errorf("failed to delete DNS records of subdomain: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	s.invalidateDomain(ctx, domain.ID)
+
+	if subdomain.Name != previousName {
+		if len(removed) > 0 && s.zones != nil {
+			s.zones.ZoneChanged(ctx, domain.ID)
+		}
+		if err := s.addRecords(ctx, domain.ID, s.addressRecords(&domain, subdomain.Name)); err != nil {
+			s.logger.Error("Failed to create DNS records for subdomain", zap.String("subdomain", subdomain.Name), zap.Error(err))
+		}
+		if !dryRun(ctx, s.config) {
+			if err := s.vhost.RemoveSubdomain(&domain, previousName); err != nil {
+				s.logger.Error("Failed to remove vhost of old subdomain name", zap.String("subdomain", previousName+"."+domain.Name), zap.Error(err))
+			}
+		}
+		s.logger.Info("Subdomain renamed",
+			zap.String("from", previousName+"."+domain.Name),
+			zap.String("to", subdomain.Name+"."+domain.Name),
+			zap.Int("dns_records", len(removed)))
+	}
+
+	s.writeSubdomainVhost(ctx, &domain, &subdomain)
+
 	return &subdomain, nil
 }
 
-// DeleteSubdomain deletes a subdomain
+// DeleteSubdomain deletes a subdomain along with its DNS records, as configured, and publishes
+// the domain's zone without them
 func (s *DomainService) DeleteSubdomain(ctx context.Context, subdomainID uuid.UUID) error {
-	if err := s.db.WithContext(ctx).Where("id = ?", subdomainID).Delete(&models.Subdomain{}).Error; err != nil {
-		return fmt.Errorf("failed to delete subdomain: %w", err)
+	var subdomain models.Subdomain
+	if err := s.db.WithContext(ctx).Where("id = ?", subdomainID).First(&subdomain).Error; err != nil {
+		return apperrors.FromDB(err, "subdomain")
+	}
+
+	var domain models.Domain
+	if err := s.db.WithContext(ctx).Preload("Node").Where("id = ?", subdomain.DomainID).First(&domain).Error; err != nil {
+		return apperrors.FromDB(err, "domain")
+	}
+
+	var removed, kept []models.DNSRecord
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ?", subdomainID).Delete(&models.Subdomain{}).Error; err != nil {
+			return fmt.Errorf("failed to delete subdomain: %w", err)
+		}
+
+		var err error
+		removed, kept, err = s.subdomainRecords(tx, &domain, subdomain.Name)
+		if err != nil || len(removed) == 0 {
+			return err
+		}
+		ids := make([]uuid.UUID, len(removed))
+		for i, record := range removed {
+			ids[i] = record.ID
+		}
+		if err := tx.Where("id IN ?", ids).Delete(&models.DNSRecord{}).Error; err != nil {
+			return fmt.Errorf("failed to delete DNS records of subdomain: %w", err)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	s.invalidateDomain(ctx, domain.ID)
+	if len(removed) > 0 && s.zones != nil {
+		s.zones.ZoneChanged(ctx, domain.ID)
+	}
+
+	if len(kept) > 0 {
+		s.logger.Warn("Kept DNS records of deleted subdomain that no longer point at the server",
+			zap.String("subdomain", subdomain.Name+"."+domain.Name),
+			zap.Int("records", len(kept)))
+	}
+	s.logger.Info("Subdomain deleted",
+		zap.String("subdomain", subdomain.Name+"."+domain.Name),
+		zap.Int("dns_records", len(removed)))
+
+	return nil
+}
+
+// subdomainRecords returns the records of a domain's zone that deleting one of its subdomains
+// removes, and the records at the subdomain's name it keeps. With cleanup set to created, only
+// the address records CreateSubdomain made go, unless they were since pointed elsewhere by hand.
+func (s *DomainService) subdomainRecords(tx *gorm.DB, domain *models.Domain, name string) (removed, kept []models.DNSRecord, err error) {
+	if s.config.SubdomainDNSCleanup == "off" {
+		return nil, nil, nil
+	}
+
+	var records []models.DNSRecord
+	if err := tx.Where("domain_id = ?", domain.ID).Find(&records).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to get DNS records of subdomain: %w", err)
+	}
+
+	ipv4, ipv6 := s.serverIPs(domain)
+	for _, record := range records {
+		owner := relativeName(record.Name, domain.Name)
+		switch {
+		case s.config.SubdomainDNSCleanup == "all" && (owner == name || strings.HasSuffix(owner, "."+name)):
+			removed = append(removed, record)
+		case owner != name:
+		case record.Type == "A" && sameIP(record.Value, ipv4), record.Type == "AAAA" && sameIP(record.Value, ipv6):
+			removed = append(removed, record)
+		default:
+			kept = append(kept, record)
+		}
+	}
+
+	return removed, kept, nil
+}
+
+// checkSubdomainName rejects names that are not a single DNS label and reserved names
+func (s *DomainService) checkSubdomainName(name string) error {
+	if !subdomainLabelPattern.MatchString(name) {
+		return apperrors.InvalidCode("name", "subdomain.invalid", nil)
+	}
+
+	for _, reserved := range s.config.ReservedSubdomains {
+		if strings.EqualFold(name, reserved) {
+			return apperrors.InvalidCode("name", "subdomain.reserved", map[string]string{"name": name})
+		}
 	}
 
 	return nil
 }
 
-// GetDomainStats retrieves domain statistics
+// GetDomainStats retrieves domain statistics, with a warning when the domain's PHP version is
+// being retired
 func (s *DomainService) GetDomainStats(ctx context.Context, domainID uuid.UUID) (map[string]interface{}, error) {
 	var domain models.Domain
 	if err := s.db.WithContext(ctx).Where("id = ?", domainID).First(&domain).Error; err != nil {
-		return nil, fmt.Errorf("domain not found: %w", err)
+		return nil, apperrors.FromDB(err, "domain")
+	}
+
+	if err := authorizeDomain(ctx, &domain); err != nil {
+		return nil, err
 	}
 
 	// Count subdomains
@@ -260,45 +864,220 @@ func (s *DomainService) GetDomainStats(ctx context.Context, domainID uuid.UUID)
 		"has_ssl":          domain.HasSSL,
 		"php_version":      domain.PHPVersion,
 	}
+	if warning := phpDeprecation(s.config.PHPDeprecations, domain.PHPVersion, time.Now()); warning != nil {
+		stats["php_deprecation"] = warning
+	}
 
 	return stats, nil
 }
 
 // createDefaultDNSRecords creates default DNS records for a new domain
-func (s *DomainService) createDefaultDNSRecords(ctx context.Context, domainID uuid.UUID, domainName string) error {
-	defaultRecords := []models.DNSRecord{
-		{
-			DomainID: domainID,
-			Type:     "A",
-			Name:     "@",
-			Value:    "127.0.0.1", // This would be the server's IP
-			TTL:      3600,
-			IsActive: true,
-		},
-		{
-			DomainID: domainID,
-			Type:     "A",
-			Name:     "www",
-			Value:    "127.0.0.1", // This would be the server's IP
-			TTL:      3600,
-			IsActive: true,
-		},
-		{
-			DomainID: domainID,
+func (s *DomainService) createDefaultDNSRecords(ctx context.Context, domain *models.Domain) error {
+	defaultRecords := append(s.nameserverRecords(domain), s.addressRecords(domain, "@")...)
+	defaultRecords = append(defaultRecords, s.addressRecords(domain, "www")...)
+	defaultRecords = append(defaultRecords,
+		&models.DNSRecord{
+			DomainID: domain.ID,
 			Type:     "MX",
 			Name:     "@",
-			Value:    "mail." + domainName,
-			TTL:      3600,
+			Value:    "mail." + domain.Name,
+			TTL:      defaultRecordTTL(domain, s.config),
 			Priority: &[]int{10}[0],
 			IsActive: true,
 		},
+	)
+	if soa := soaRecord(domain, s.config); soa != nil {
+		defaultRecords = append(defaultRecords, soa)
 	}
 
-	for _, record := range defaultRecords {
-		if err := s.db.WithContext(ctx).Create(&record).Error; err != nil {
-			return fmt.Errorf("failed to create DNS record: %w", err)
-		}
+	if err := s.addRecords(ctx, domain.ID, defaultRecords); err != nil {
+		return err
+	}
+
+	domain.DNSSerial = nextSerial(0, time.Now())
+	if err := s.db.WithContext(ctx).Model(domain).UpdateColumn("dns_serial", domain.DNSSerial).Error; err != nil {
+		return fmt.Errorf("failed to set SOA serial: %w", err)
 	}
 
 	return nil
 }
+
+// addRecords creates records of the panel's own in a domain's zone through the zone publisher
+func (s *DomainService) addRecords(ctx context.Context, domainID uuid.UUID, records []*models.DNSRecord) error {
+	if s.zones == nil {
+		return fmt.Errorf("no zone publisher configured")
+	}
+	return s.zones.AddRecords(ctx, domainID, records)
+}
+
+// nameserverRecords builds the apex NS records naming the panel's nameservers, if configured
+func (s *DomainService) nameserverRecords(domain *models.Domain) []*models.DNSRecord {
+	records := make([]*models.DNSRecord, 0, len(s.config.Nameservers))
+	for _, nameserver := range s.config.Nameservers {
+		records = append(records, &models.DNSRecord{
+			DomainID: domain.ID,
+			Type:     "NS",
+			Name:     "@",
+			Value:    strings.ToLower(strings.TrimSuffix(nameserver, ".")),
+			TTL:      nameserverTTL,
+			IsActive: true,
+		})
+	}
+
+	return records
+}
+
+// addressRecords builds the A record, and the AAAA record when an IPv6 address is configured,
+// pointing a name of the domain at the server hosting it
+func (s *DomainService) addressRecords(domain *models.Domain, name string) []*models.DNSRecord {
+	ipv4, ipv6 := s.serverIPs(domain)
+
+	records := []*models.DNSRecord{{
+		DomainID: domain.ID,
+		Type:     "A",
+		Name:     name,
+		Value:    ipv4,
+		TTL:      defaultRecordTTL(domain, s.config),
+		IsActive: true,
+	}}
+	if ipv6 != "" {
+		records = append(records, &models.DNSRecord{
+			DomainID: domain.ID,
+			Type:     "AAAA",
+			Name:     name,
+			Value:    ipv6,
+			TTL:      defaultRecordTTL(domain, s.config),
+			IsActive: true,
+		})
+	}
+
+	return records
+}
+
+// serverIPs returns the addresses default records of a domain point at: its node's, or the configured server's
+func (s *DomainService) serverIPs(domain *models.Domain) (ipv4, ipv6 string) {
+	if domain.Node != nil && domain.Node.IPAddress != "" {
+		return domain.Node.IPAddress, domain.Node.IPv6Address
+	}
+	return s.config.ServerIPv4, s.config.ServerIPv6
+}
+
+// invalidateDomain drops the cached copy of a domain, once the batch commits when inside one
+func (s *DomainService) invalidateDomain(ctx context.Context, domainID uuid.UUID) {
+	if effects := deferredEffects(ctx); effects != nil {
+		effects.caches[domainID] = true
+		return
+	}
+	if err := s.cache.Invalidate(ctx, cache.DomainKey(domainID)); err != nil {
+		s.logger.Warn("Failed to invalidate domain cache", zap.String("domain_id", domainID.String()), zap.Error(err))
+	}
+}
+
+// writeVhost regenerates a domain's vhost with its current redirects and protected directories.
+// Failures are logged, not returned, since the database change has already been made. Inside a
+// batch, the vhost is written once the batch commits.
+func (s *DomainService) writeVhost(ctx context.Context, domain *models.Domain) {
+	if effects := deferredEffects(ctx); effects != nil {
+		effects.vhosts[domain.ID] = true
+		return
+	}
+	if err := s.db.WithContext(ctx).Where("domain_id = ?", domain.ID).Order("source_path").Find(&domain.Redirects).Error; err != nil {
+		s.logger.Error("Failed to load redirects", zap.String("domain", domain.Name), zap.Error(err))
+		return
+	}
+	if err := s.db.WithContext(ctx).Where("domain_id = ?", domain.ID).Find(&domain.ProtectedDirectories).Error; err != nil {
+		s.logger.Error("Failed to load protected directories", zap.String("domain", domain.Name), zap.Error(err))
+		return
+	}
+
+	if dryRun(ctx, s.config) {
+		s.logger.Info("Dry run: skipping vhost write", zap.String("domain", domain.Name), zap.Int("redirects", len(domain.Redirects)))
+		return
+	}
+
+	if err := s.vhost.Write(domain); err != nil {
+		s.logger.Error("Failed to regenerate vhost", zap.String("domain", domain.Name), zap.Error(err))
+		return
+	}
+	s.reloadWebServer(ctx)
+}
+
+// writeSubdomainVhost regenerates a subdomain's vhost, logging failures like writeVhost
+func (s *DomainService) writeSubdomainVhost(ctx context.Context, domain *models.Domain, subdomain *models.Subdomain) {
+	if dryRun(ctx, s.config) {
+		s.logger.Info("Dry run: skipping vhost write", zap.String("subdomain", subdomain.Name+"."+domain.Name))
+		return
+	}
+
+	if err := s.vhost.WriteSubdomain(domain, subdomain); err != nil {
+		s.logger.Error("Failed to regenerate subdomain vhost", zap.String("subdomain", subdomain.Name+"."+domain.Name), zap.Error(err))
+		return
+	}
+	s.reloadWebServer(ctx)
+}
+
+// reloadWebServer has nginx check the written configuration and reload it, so vhost changes take
+// effect. A configuration failing the check is not loaded; nginx keeps serving the previous one
+// and the error is logged for an admin.
+func (s *DomainService) reloadWebServer(ctx context.Context) {
+	if _, stderr, err := s.runner.Run(ctx, "nginx", "-t"); err != nil {
+		s.logger.Error("nginx rejected the vhost configuration, not reloading", zap.ByteString("output", stderr), zap.Error(err))
+		return
+	}
+	if _, stderr, err := s.runner.Run(ctx, "nginx", "-s", "reload"); err != nil {
+		s.logger.Error("Failed to reload nginx", zap.ByteString("output", stderr), zap.Error(err))
+	}
+}
+
+// domainRoot returns the directory that holds all of a domain's content
+func domainRoot(domainName string) string {
+	return filepath.Join(webRoot, domainName)
+}
+
+// resolveWithin resolves path against base and rejects results that escape base
+func resolveWithin(base, path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(base, path)
+	}
+
+	resolved := filepath.Clean(path)
+	rel, err := filepath.Rel(base, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %s is outside of %s", path, base)
+	}
+
+	return resolved, nil
+}
+
+// resolveRealWithin resolves path against base like resolveWithin, and also rejects paths that
+// escape base through symlinks: the deepest part of the path that exists must resolve inside
+// base. A base that does not exist yet holds no symlinks to follow.
+func resolveRealWithin(base, path string) (string, error) {
+	resolved, err := resolveWithin(base, path)
+	if err != nil {
+		return "", err
+	}
+
+	existing := resolved
+	for existing != base && existing != filepath.Dir(existing) {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		existing = filepath.Dir(existing)
+	}
+	realBase, err := filepath.EvalSymlinks(base)
+	if errors.Is(err, os.ErrNotExist) {
+		return resolved, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	realPath, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return "", err
+	}
+	if _, err := resolveWithin(realBase, realPath); err != nil {
+		return "", err
+	}
+	return resolved, nil
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/cache"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/runner"
+)
+
+// newCachedDomainService creates a domain service whose domains are cached in an in-memory Redis
+func newCachedDomainService(t *testing.T) (*DomainService, *cache.Cache) {
+	t.Helper()
+
+	db := newTestDB(t)
+	client, _ := newTestRedis(t)
+	appCache := cache.New(client, config.CacheConfig{Enabled: true, TTL: time.Hour})
+	domains := NewDomainService(db, client, zap.NewNop(), testHostingConfig(t), appCache, nil, runner.NewFake())
+	return domains, appCache
+}
+
+func TestGetDomainLoadsOwnerUncached(t *testing.T) {
+	domains, _ := newCachedDomainService(t)
+	owner := createTestUser(t, domains.db)
+	domain := createTestDomain(t, domains.db, owner, "owner.example")
+	ctx := context.Background()
+
+	if _, err := domains.GetDomain(ctx, domain.ID); err != nil {
+		t.Fatalf("GetDomain: %v", err)
+	}
+	if err := domains.db.Model(owner).Update("is_active", false).Error; err != nil {
+		t.Fatalf("deactivate owner: %v", err)
+	}
+
+	got, err := domains.GetDomain(ctx, domain.ID)
+	if err != nil {
+		t.Fatalf("GetDomain: %v", err)
+	}
+	if got.User.ID != owner.ID || got.User.IsActive {
+		t.Errorf("owner = %s active %v, want the deactivated owner", got.User.ID, got.User.IsActive)
+	}
+}
+
+func TestDomainWritesInvalidateCache(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(t *testing.T, domains *DomainService, appCache *cache.Cache, domain *models.Domain)
+		check  func(domain *models.Domain) bool
+	}{
+		{
+			name: "resume sending",
+			change: func(t *testing.T, domains *DomainService, _ *cache.Cache, domain *models.Domain) {
+				emails := NewEmailService(domains.db, domains.redis, zap.NewNop(), config.MailConfig{SendLimitWindow: time.Hour}, nil, domains)
+				ctx := asUser(domain.UserID, "admin")
+				if err := emails.ResumeDomainSending(ctx, domain.ID); err != nil {
+					t.Fatalf("ResumeDomainSending: %v", err)
+				}
+			},
+			check: func(domain *models.Domain) bool { return domain.SendSuspendedAt == nil },
+		},
+		{
+			name: "quota block",
+			change: func(t *testing.T, domains *DomainService, appCache *cache.Cache, domain *models.Domain) {
+				quotas := NewQuotaService(domains.db, domains.redis, zap.NewNop(), domains.config, appCache, nil)
+				quotas.setBlocked(context.Background(), &models.Domain{ID: domain.ID}, domain.SendSuspendedAt, false)
+			},
+			check: func(domain *models.Domain) bool { return domain.QuotaBlockedAt == nil },
+		},
+		{
+			name: "verification token",
+			change: func(t *testing.T, domains *DomainService, _ *cache.Cache, domain *models.Domain) {
+				domain.VerificationToken = ""
+				if _, err := domains.verifyOwnership(context.Background(), domain); err != nil {
+					t.Fatalf("verifyOwnership: %v", err)
+				}
+			},
+			check: func(domain *models.Domain) bool { return domain.VerificationToken != "" },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			domains, appCache := newCachedDomainService(t)
+			owner := createTestUser(t, domains.db)
+			domain := createTestDomain(t, domains.db, owner, "cached.example")
+			now := time.Now()
+			domains.db.Model(domain).Updates(map[string]interface{}{"send_suspended_at": now, "quota_blocked_at": now})
+			domain.SendSuspendedAt = &now
+			domain.QuotaBlockedAt = &now
+			ctx := context.Background()
+
+			if _, err := domains.GetDomain(ctx, domain.ID); err != nil {
+				t.Fatalf("GetDomain: %v", err)
+			}
+			tt.change(t, domains, appCache, domain)
+
+			got, err := domains.GetDomain(ctx, domain.ID)
+			if err != nil {
+				t.Fatalf("GetDomain: %v", err)
+			}
+			if !tt.check(got) {
+				t.Errorf("GetDomain returned the cached copy from before the change")
+			}
+		})
+	}
+}
+
+func TestReloadDomainReplacesCachedCopy(t *testing.T) {
+	domains, _ := newCachedDomainService(t)
+	owner := createTestUser(t, domains.db)
+	domain := createTestDomain(t, domains.db, owner, "reload.example")
+	ctx := context.Background()
+
+	if _, err := domains.GetDomain(ctx, domain.ID); err != nil {
+		t.Fatalf("GetDomain: %v", err)
+	}
+	// A write that bypasses the service leaves the cached copy stale
+	domains.db.Model(domain).Update("php_version", "8.3")
+
+	current, err := domains.ReloadDomain(ctx, domain.ID)
+	if err != nil {
+		t.Fatalf("ReloadDomain: %v", err)
+	}
+	if current.PHPVersion != "8.3" {
+		t.Errorf("ReloadDomain PHP version = %q, want 8.3", current.PHPVersion)
+	}
+	if cached, _ := domains.GetDomain(ctx, domain.ID); cached.PHPVersion != "8.3" {
+		t.Errorf("GetDomain after ReloadDomain PHP version = %q, want 8.3", cached.PHPVersion)
+	}
+}
@@ -0,0 +1,297 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/tracing"
+)
+
+// CloneConfig creates a domain set up like an existing one, for the same owner: its DNS records
+// with names under the source domain moved to the new one, its PHP settings and features, and its
+// subdomains. With withEmail, the source's email accounts are created as inactive stubs without
+// passwords. Files, certificates and secrets are not copied, and the new domain gets the quotas of
+// the source only as far as the owner's package allows.
+func (s *DomainService) CloneConfig(ctx context.Context, sourceDomainID uuid.UUID, newDomainName string, withEmail bool) (_ *models.Domain, err error) {
+	ctx, span := tracing.Start(ctx, "DomainService.CloneConfig", attribute.String("domain.id", sourceDomainID.String()))
+	defer tracing.End(span, &err)
+
+	// The source cannot change while it is copied; CreateDomain takes the new name
+	held, err := lockDomain(ctx, s.locks, sourceDomainID)
+	if err != nil {
+		return nil, err
+	}
+	defer held.Release()
+
+	var source models.Domain
+	if err := s.db.WithContext(ctx).
+		Preload("Node").
+		Preload("Subdomains").
+		Preload("DNSRecords").
+		Where("id = ?", sourceDomainID).
+		First(&source).Error; err != nil {
+		return nil, apperrors.FromDB(err, "domain")
+	}
+
+	if err := authorizeDomain(ctx, &source); err != nil {
+		return nil, err
+	}
+
+	name := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(newDomainName), "."))
+	if len(name) > 253 || !domainNamePattern.MatchString(name) {
+		return nil, apperrors.InvalidCode("name", "domain.invalid", nil)
+	}
+
+	var accounts []models.EmailAccount
+	if withEmail && source.EmailEnabled {
+		if err := s.db.WithContext(ctx).Where("domain_id = ?", source.ID).Find(&accounts).Error; err != nil {
+			return nil, fmt.Errorf("failed to get email accounts: %w", err)
+		}
+	}
+
+	// Check the package limits before anything is created
+	limit, err := s.SubdomainLimit(ctx, source.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if limit > 0 && len(source.Subdomains) > limit {
+		return nil, apperrors.PreconditionCode("subdomain_limit_reached", map[string]string{"limit": strconv.Itoa(limit)})
+	}
+	records := cloneDNSRecords(source.DNSRecords, source.Name, name)
+	if err := checkZoneLimits(s.config, records, records); err != nil {
+		return nil, err
+	}
+
+	domain, err := s.CreateDomain(ctx, source.UserID, name, &DomainQuotas{
+		DiskQuota:      source.DiskQuota,
+		BandwidthQuota: source.BandwidthQuota,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Records pointing at the source's server follow the new domain to its own
+	oldIPv4, oldIPv6 := s.serverIPs(&source)
+	newIPv4, newIPv6 := s.serverIPs(domain)
+	for _, record := range records {
+		record.DomainID = domain.ID
+		switch {
+		case record.Type == "A" && record.Value == oldIPv4:
+			record.Value = newIPv4
+		case record.Type == "AAAA" && oldIPv6 != "" && record.Value == oldIPv6 && newIPv6 != "":
+			record.Value = newIPv6
+		}
+	}
+
+	if err := s.copyConfig(ctx, &source, domain, records, accounts); err != nil {
+		s.discardDomain(ctx, domain)
+		return nil, err
+	}
+
+	s.writePHP(ctx, domain, "")
+	s.writeVhost(ctx, domain)
+	for i := range domain.Subdomains {
+		s.writeSubdomainVhost(ctx, domain, &domain.Subdomains[i])
+	}
+
+	s.logger.Info("Domain cloned",
+		zap.String("source", source.Name),
+		zap.String("domain", domain.Name),
+		zap.Int("records", len(records)),
+		zap.Int("subdomains", len(domain.Subdomains)),
+		zap.Int("email_accounts", len(accounts)))
+
+	return domain, nil
+}
+
+// copyConfig writes the copied settings, records, subdomains and email stubs of a clone in one
+// transaction, replacing the default records the new domain was created with
+func (s *DomainService) copyConfig(ctx context.Context, source, domain *models.Domain, records []*models.DNSRecord, accounts []models.EmailAccount) error {
+	domain.PHPVersion = source.PHPVersion
+	domain.PHPHandler = source.PHPHandler
+	domain.PHPExtensions = source.PHPExtensions
+	domain.PHPDisplayErrors = source.PHPDisplayErrors
+	domain.PHPLogErrors = source.PHPLogErrors
+	domain.PHPErrorLog = rebasePath(source.PHPErrorLog, domainRoot(source.Name), domainRoot(domain.Name))
+	domain.EmailEnabled = source.EmailEnabled
+	domain.DatabasesEnabled = source.DatabasesEnabled
+	domain.CustomDNSEnabled = source.CustomDNSEnabled
+
+	subdomains := make([]models.Subdomain, len(source.Subdomains))
+	for i, subdomain := range source.Subdomains {
+		subdomains[i] = models.Subdomain{
+			DomainID:     domain.ID,
+			Name:         subdomain.Name,
+			DocumentRoot: filepath.Join(domainRoot(domain.Name), "subdomains", subdomain.Name),
+			PHPVersion:   subdomain.PHPVersion,
+			IsActive:     subdomain.IsActive,
+		}
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// The is_active columns default to true, so GORM leaves a false value out of the insert.
+		// active is passed separately since the insert reads the default back into value.
+		create := func(value interface{}, active bool) error {
+			if err := tx.Create(value).Error; err != nil {
+				return err
+			}
+			if active {
+				return nil
+			}
+			return tx.Model(value).Update("is_active", false).Error
+		}
+
+		if err := tx.Model(domain).
+			Select("php_version", "php_handler", "php_extensions", "php_display_errors", "php_log_errors", "php_error_log", "email_enabled", "databases_enabled", "custom_dns_enabled").
+			Updates(domain).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("domain_id = ?", domain.ID).Delete(&models.DNSRecord{}).Error; err != nil {
+			return err
+		}
+		for _, record := range records {
+			if err := create(record, record.IsActive); err != nil {
+				return err
+			}
+		}
+
+		for i := range subdomains {
+			if err := create(&subdomains[i], subdomains[i].IsActive); err != nil {
+				return err
+			}
+		}
+
+		// Stubs cannot receive or send mail until the owner sets a password and activates them.
+		// Addresses the new domain already got as its default mail addresses are left alone.
+		var taken []string
+		if err := tx.Model(&models.EmailAccount{}).Where("domain_id = ?", domain.ID).Pluck("username", &taken).Error; err != nil {
+			return err
+		}
+		var aliases []string
+		if err := tx.Model(&models.EmailAlias{}).Where("domain_id = ?", domain.ID).Pluck("alias", &aliases).Error; err != nil {
+			return err
+		}
+		exists := make(map[string]bool)
+		for _, name := range append(taken, aliases...) {
+			exists[name] = true
+		}
+		for _, account := range accounts {
+			if exists[account.Username] || exists[account.Username+"@"+domain.Name] {
+				continue
+			}
+			if err := create(&models.EmailAccount{
+				DomainID: domain.ID,
+				Username: account.Username,
+				QuotaMB:  account.QuotaMB,
+			}, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to copy domain configuration: %w", err)
+	}
+
+	domain.Subdomains = subdomains
+	s.invalidateDomain(ctx, domain.ID)
+	return nil
+}
+
+// discardDomain removes a domain whose clone failed halfway. The row is deleted for good so its
+// name can be used again.
+func (s *DomainService) discardDomain(ctx context.Context, domain *models.Domain) {
+	if err := s.db.WithContext(ctx).Where("domain_id = ?", domain.ID).Delete(&models.DNSRecord{}).Error; err != nil {
+		s.logger.Error("Failed to remove records of incomplete clone", zap.String("domain", domain.Name), zap.Error(err))
+	}
+	if err := s.db.WithContext(ctx).Unscoped().Delete(domain).Error; err != nil {
+		s.logger.Error("Failed to remove incomplete clone", zap.String("domain", domain.Name), zap.Error(err))
+	}
+	s.invalidateDomain(ctx, domain.ID)
+}
+
+// cloneDNSRecords copies a zone from one domain to another. Owner names and host names in the
+// record data under the old domain are moved to the new one; anything else, such as external
+// hosts and TXT data, is kept as is. The ownership verification record is skipped since its
+// token belongs to the old domain.
+func cloneDNSRecords(records []models.DNSRecord, from, to string) []*models.DNSRecord {
+	verification := strings.TrimSuffix(verificationRecordPrefix, ".")
+
+	cloned := make([]*models.DNSRecord, 0, len(records))
+	for _, record := range records {
+		if relativeName(record.Name, from) == verification {
+			continue
+		}
+
+		name, value := rebaseRecord(&record, from, to)
+		clone := &models.DNSRecord{
+			Type:     record.Type,
+			Name:     name,
+			Value:    value,
+			TTL:      record.TTL,
+			IsActive: record.IsActive,
+		}
+		if record.Priority != nil {
+			priority := *record.Priority
+			clone.Priority = &priority
+		}
+		cloned = append(cloned, clone)
+	}
+
+	return cloned
+}
+
+// rebaseRecord returns the owner name and data of a record with the names under the old domain
+// moved to the new one. Only data holding host names is changed.
+func rebaseRecord(record *models.DNSRecord, from, to string) (name, value string) {
+	value = record.Value
+	switch record.Type {
+	case "CNAME", "NS", "MX":
+		value = rebaseName(value, from, to)
+	case "SRV":
+		// The target is the last field of the data
+		fields := strings.Fields(value)
+		if len(fields) > 0 {
+			fields[len(fields)-1] = rebaseName(fields[len(fields)-1], from, to)
+			value = strings.Join(fields, " ")
+		}
+	case "SOA":
+		// The primary nameserver and the contact mailbox
+		fields := strings.Fields(value)
+		for i := 0; i < len(fields) && i < 2; i++ {
+			fields[i] = rebaseName(fields[i], from, to)
+		}
+		value = strings.Join(fields, " ")
+	}
+
+	return rebaseName(record.Name, from, to), value
+}
+
+// rebaseName moves a fully qualified name at or under the old domain to the new one, keeping a
+// trailing dot. Relative names and names outside the old domain are returned unchanged.
+func rebaseName(name, from, to string) string {
+	dot := ""
+	if strings.HasSuffix(name, ".") {
+		dot = "."
+	}
+	lower := strings.ToLower(strings.TrimSuffix(name, "."))
+
+	switch {
+	case lower == from:
+		return to + dot
+	case strings.HasSuffix(lower, "."+from):
+		return lower[:len(lower)-len(from)] + to + dot
+	}
+	return name
+}
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestRebaseName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"shop.example", "new.example"},
+		{"shop.example.", "new.example."},
+		{"mail.shop.example.", "mail.new.example."},
+		{"Mail.Shop.Example", "mail.new.example"},
+		{"www", "www"},
+		{"@", "@"},
+		{"myshop.example", "myshop.example"},
+		{"shop.example.net", "shop.example.net"},
+		{"mx.provider.example.", "mx.provider.example."},
+	}
+	for _, tt := range tests {
+		if got := rebaseName(tt.name, "shop.example", "new.example"); got != tt.want {
+			t.Errorf("rebaseName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCloneDNSRecords(t *testing.T) {
+	priority := 10
+	records := []models.DNSRecord{
+		{Type: "A", Name: "@", Value: "192.0.2.10", TTL: 300, IsActive: true},
+		{Type: "A", Name: "shop.example.", Value: "192.0.2.10", TTL: 300, IsActive: true},
+		{Type: "CNAME", Name: "www.shop.example", Value: "shop.example.", TTL: 3600, IsActive: true},
+		{Type: "CNAME", Name: "cdn", Value: "shop.cdn.example", TTL: 3600, IsActive: false},
+		{Type: "MX", Name: "@", Value: "mail.shop.example", Priority: &priority, TTL: 3600, IsActive: true},
+		{Type: "NS", Name: "dev", Value: "ns1.shop.example", TTL: 3600, IsActive: true},
+		{Type: "SRV", Name: "_sip._tcp.shop.example", Value: "10 5 5060 sip.shop.example.", TTL: 3600, IsActive: true},
+		{Type: "SOA", Name: "@", Value: "ns1.shop.example hostmaster.shop.example", TTL: 3600, IsActive: true},
+		{Type: "TXT", Name: "@", Value: "v=spf1 include:shop.example -all", TTL: 3600, IsActive: true},
+		{Type: "TXT", Name: "_mynodecp-verify", Value: "token", TTL: 3600, IsActive: true},
+		{Type: "TXT", Name: "_mynodecp-verify.shop.example.", Value: "token", TTL: 3600, IsActive: true},
+	}
+
+	var got []string
+	for _, record := range cloneDNSRecords(records, "shop.example", "new.example") {
+		line := record.Type + " " + record.Name + " " + record.Value
+		if !record.IsActive {
+			line += " (inactive)"
+		}
+		got = append(got, line)
+	}
+	want := []string{
+		"A @ 192.0.2.10",
+		"A new.example. 192.0.2.10",
+		"CNAME www.new.example new.example.",
+		"CNAME cdn shop.cdn.example (inactive)",
+		"MX @ mail.new.example",
+		"NS dev ns1.new.example",
+		"SRV _sip._tcp.new.example 10 5 5060 sip.new.example.",
+		"SOA @ ns1.new.example hostmaster.new.example",
+		"TXT @ v=spf1 include:shop.example -all",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("cloneDNSRecords() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	cloned := cloneDNSRecords(records[4:5], "shop.example", "new.example")
+	*records[4].Priority = 20
+	if *cloned[0].Priority != 10 {
+		t.Error("cloned record shares its priority with the source")
+	}
+}
+
+func TestCloneConfig(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	domains, _ := newTestDomainService(t, db, cfg)
+	owner := createTestUser(t, db)
+	ctx := asUser(owner.ID)
+
+	source, err := domains.CreateDomain(ctx, owner.ID, "shop.example", nil)
+	if err != nil {
+		t.Fatalf("CreateDomain() error = %v", err)
+	}
+	db.Model(source).Updates(map[string]interface{}{"php_display_errors": true, "custom_dns_enabled": true, "email_enabled": true})
+	mustCreate(t, db, &models.DNSRecord{DomainID: source.ID, Type: "CNAME", Name: "shop", Value: "store.shop.example", TTL: 600, IsActive: true})
+	mustCreate(t, db, &models.Subdomain{DomainID: source.ID, Name: "blog", DocumentRoot: domainRoot("shop.example") + "/subdomains/blog", IsActive: true})
+	paused := &models.DNSRecord{DomainID: source.ID, Type: "A", Name: "old", Value: "203.0.113.5", TTL: 600, IsActive: true}
+	mustCreate(t, db, paused)
+	db.Model(paused).Update("is_active", false)
+	draft := &models.Subdomain{DomainID: source.ID, Name: "draft", DocumentRoot: domainRoot("shop.example") + "/subdomains/draft", IsActive: true}
+	mustCreate(t, db, draft)
+	db.Model(draft).Update("is_active", false)
+	mustCreate(t, db, &models.EmailAccount{DomainID: source.ID, Username: "sales", PasswordHash: "secret-hash", QuotaMB: 512, IsActive: true})
+
+	clone, err := domains.CloneConfig(ctx, source.ID, " New.Example. ", true)
+	if err != nil {
+		t.Fatalf("CloneConfig() error = %v", err)
+	}
+	if clone.Name != "new.example" || clone.UserID != owner.ID {
+		t.Errorf("clone = %s of %s", clone.Name, clone.UserID)
+	}
+
+	var stored models.Domain
+	db.Where("id = ?", clone.ID).First(&stored)
+	if !stored.PHPDisplayErrors || !stored.CustomDNSEnabled || !stored.EmailEnabled {
+		t.Errorf("settings not copied: %+v", stored)
+	}
+
+	var records []models.DNSRecord
+	db.Where("domain_id = ?", clone.ID).Find(&records)
+	var names []string
+	for _, record := range records {
+		if strings.Contains(record.Name+record.Value, "shop.example") && record.Type != "TXT" {
+			t.Errorf("record still names the source: %+v", record)
+		}
+		names = append(names, record.Type+" "+record.Name+" "+record.Value)
+	}
+	sort.Strings(names)
+	if !strings.Contains(strings.Join(names, "\n"), "CNAME shop store.new.example") {
+		t.Errorf("records:\n%s", strings.Join(names, "\n"))
+	}
+
+	var subdomain models.Subdomain
+	if err := db.Where("domain_id = ? AND name = ?", clone.ID, "blog").First(&subdomain).Error; err != nil || subdomain.DocumentRoot != domainRoot("new.example")+"/subdomains/blog" {
+		t.Errorf("subdomain = %+v (%v)", subdomain, err)
+	}
+
+	var inactive models.DNSRecord
+	if err := db.Where("domain_id = ? AND name = ?", clone.ID, "old").First(&inactive).Error; err != nil || inactive.IsActive {
+		t.Errorf("inactive record cloned as %+v (%v)", inactive, err)
+	}
+	var inactiveSubdomain models.Subdomain
+	if err := db.Where("domain_id = ? AND name = ?", clone.ID, "draft").First(&inactiveSubdomain).Error; err != nil || inactiveSubdomain.IsActive {
+		t.Errorf("inactive subdomain cloned as %+v (%v)", inactiveSubdomain, err)
+	}
+
+	var stub models.EmailAccount
+	if err := db.Where("domain_id = ? AND username = ?", clone.ID, "sales").First(&stub).Error; err != nil {
+		t.Fatalf("email stub not created: %v", err)
+	}
+	if stub.IsActive || stub.PasswordHash != "" || stub.QuotaMB != 512 {
+		t.Errorf("email stub = active %v, password %q, quota %d", stub.IsActive, stub.PasswordHash, stub.QuotaMB)
+	}
+}
+
+func TestCloneConfigRejections(t *testing.T) {
+	db := newTestDB(t)
+	domains, _ := newTestDomainService(t, db, testHostingConfig(t))
+	owner := createTestUser(t, db)
+	source := createTestDomain(t, db, owner, "shop.example")
+	createTestDomain(t, db, owner, "taken.example")
+
+	if _, err := domains.CloneConfig(asUser(owner.ID), source.ID, "not a domain", false); fieldMessage(err, "name") == "" {
+		t.Errorf("invalid name: error = %v", err)
+	}
+	if _, err := domains.CloneConfig(asUser(owner.ID), source.ID, "taken.example", false); apperrors.HTTPStatus(err) != http.StatusUnprocessableEntity {
+		t.Errorf("taken name: error = %v", err)
+	}
+	if _, err := domains.CloneConfig(asUser(createTestUser(t, db).ID), source.ID, "mine.example", false); !apperrors.IsPermissionDenied(err) && !apperrors.IsNotFound(err) {
+		t.Errorf("another user's domain: error = %v", err)
+	}
+
+	// Subdomains beyond the owner's package
+	role := &models.Role{Name: "basic", DisplayName: "basic", MaxSubdomains: subdomainLimit(1)}
+	mustCreate(t, db, role)
+	mustCreate(t, db, &models.UserRole{UserID: owner.ID, RoleID: role.ID})
+	for _, name := range []string{"a", "b"} {
+		mustCreate(t, db, &models.Subdomain{DomainID: source.ID, Name: name, DocumentRoot: "/tmp/" + name, IsActive: true})
+	}
+	if _, err := domains.CloneConfig(asUser(owner.ID), source.ID, "many.example", false); errorCode(err) != "subdomain_limit_reached" {
+		t.Errorf("subdomain limit: error = %v", err)
+	}
+
+	var count int64
+	db.Model(&models.Domain{}).Where("name IN ?", []string{"mine.example", "many.example"}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d domains created by rejected clones", count)
+	}
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/runner"
+)
+
+// featureServices are the services whose resources the domain features gate
+type featureServices struct {
+	db        *gorm.DB
+	ctx       context.Context
+	domains   *DomainService
+	dns       *DNSService
+	email     *EmailService
+	databases *DatabaseService
+}
+
+// newFeatureServices returns the services on a fresh database and a domain of a user they act as
+func newFeatureServices(t *testing.T) (*featureServices, *models.Domain) {
+	t.Helper()
+
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	dns, domains := newTestDNSService(t, db, cfg)
+	client, _ := newTestRedis(t)
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "features.example")
+
+	return &featureServices{
+		db:        db,
+		ctx:       asUser(owner.ID, "user"),
+		domains:   domains,
+		dns:       dns,
+		email:     NewEmailService(db, client, zap.NewNop(), config.MailConfig{}, nil, domains),
+		databases: NewDatabaseService(db, client, zap.NewNop(), cfg, runner.NewFake(), nil),
+	}, domain
+}
+
+func TestDisabledFeaturesBlockNewResources(t *testing.T) {
+	off := false
+
+	tests := []struct {
+		name     string
+		features DomainFeatures
+		create   func(t *testing.T, s *featureServices, domain *models.Domain) error
+	}{
+		{"mailbox", DomainFeatures{Email: &off}, func(t *testing.T, s *featureServices, domain *models.Domain) error {
+			_, err := s.email.CreateEmailAccount(s.ctx, domain.ID, "info", "a-long-password-1", 100)
+			return err
+		}},
+		{"alias", DomainFeatures{Email: &off}, func(t *testing.T, s *featureServices, domain *models.Domain) error {
+			_, err := s.email.CreateEmailAlias(s.ctx, domain.ID, "sales", "info@features.example")
+			return err
+		}},
+		{"database", DomainFeatures{Databases: &off}, func(t *testing.T, s *featureServices, domain *models.Domain) error {
+			_, err := s.databases.CreateDatabase(s.ctx, domain.ID, "shop", "mysql")
+			return err
+		}},
+		{"DNS record", DomainFeatures{CustomDNS: &off}, func(t *testing.T, s *featureServices, domain *models.Domain) error {
+			_, err := s.dns.CreateDNSRecord(s.ctx, domain.ID, "A", "www", "192.0.2.20", 3600, nil)
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, domain := newFeatureServices(t)
+			mustCreate(t, s.db, &models.EmailAccount{DomainID: domain.ID, Username: "kept", PasswordHash: "x"})
+
+			updated, _, err := s.domains.SetFeatures(s.ctx, domain.ID, tt.features)
+			if err != nil {
+				t.Fatalf("SetFeatures() error = %v", err)
+			}
+			if tt.features.Email != nil && updated.EmailEnabled {
+				t.Error("returned domain still has email enabled")
+			}
+
+			err = tt.create(t, s, domain)
+			if !apperrors.IsFeatureDisabled(err) {
+				t.Fatalf("create with the feature off: error = %v, want FeatureDisabledError", err)
+			}
+			if status := apperrors.HTTPStatus(err); status != 403 {
+				t.Errorf("HTTP status = %d, want 403", status)
+			}
+
+			var kept int64
+			s.db.Model(&models.EmailAccount{}).Where("domain_id = ?", domain.ID).Count(&kept)
+			if kept != 1 {
+				t.Errorf("existing mailboxes = %d after disabling a feature, want 1", kept)
+			}
+		})
+	}
+}
+
+func TestSetFeaturesLeavesUnsetFeatures(t *testing.T) {
+	s, domain := newFeatureServices(t)
+	off := false
+
+	if _, _, err := s.domains.SetFeatures(s.ctx, domain.ID, DomainFeatures{CustomDNS: &off}); err != nil {
+		t.Fatalf("SetFeatures() error = %v", err)
+	}
+	var stored models.Domain
+	s.db.Where("id = ?", domain.ID).First(&stored)
+	if !stored.EmailEnabled || !stored.DatabasesEnabled || stored.CustomDNSEnabled {
+		t.Errorf("features = email %v, databases %v, DNS %v; want only DNS off", stored.EmailEnabled, stored.DatabasesEnabled, stored.CustomDNSEnabled)
+	}
+
+	on := true
+	if _, _, err := s.domains.SetFeatures(s.ctx, domain.ID, DomainFeatures{CustomDNS: &on}); err != nil {
+		t.Fatalf("enable DNS: %v", err)
+	}
+	if _, err := s.dns.CreateDNSRecord(s.ctx, domain.ID, "A", "www", "192.0.2.20", 3600, nil); err != nil {
+		t.Errorf("DNS record after enabling custom DNS: %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestSetForceHTTPSRequiresServedCertificate(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	domains, _ := newTestDomainService(t, db, cfg)
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "example.com")
+
+	// A certificate row alone does not make the vhost serve HTTPS
+	if err := db.Create(&models.SSLCertificate{DomainID: domain.ID, IsActive: true, ExpiresAt: time.Now().Add(time.Hour)}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := domains.SetForceHTTPS(asUser(owner.ID), domain.ID, true)
+	if code := errorCode(err); code != "https_requires_certificate" {
+		t.Fatalf("error code = %q (%v), want https_requires_certificate", code, err)
+	}
+}
+
+func TestSetForceHTTPSRequiresValidCertificate(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	domains, _ := newTestDomainService(t, db, cfg)
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "example.com")
+	if err := db.Model(domain).Update("has_ssl", true).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	expired := &models.SSLCertificate{DomainID: domain.ID, IsActive: true, ExpiresAt: time.Now().Add(-time.Hour)}
+	mustCreate(t, db, expired)
+	replaced := &models.SSLCertificate{DomainID: domain.ID, ExpiresAt: time.Now().Add(time.Hour)}
+	mustCreate(t, db, replaced)
+	db.Model(replaced).Update("is_active", false)
+
+	_, err := domains.SetForceHTTPS(asUser(owner.ID), domain.ID, true)
+	if code := errorCode(err); code != "https_requires_certificate" {
+		t.Fatalf("error code = %q (%v), want https_requires_certificate", code, err)
+	}
+	// Turning the redirect off needs no certificate
+	if _, err := domains.SetForceHTTPS(asUser(owner.ID), domain.ID, false); err != nil {
+		t.Errorf("disable: %v", err)
+	}
+}
+
+func TestSetForceHTTPSChecksOwnership(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	domains, _ := newTestDomainService(t, db, cfg)
+	domain := createTestDomain(t, db, createTestUser(t, db), "example.com")
+	other := createTestUser(t, db)
+
+	if _, err := domains.SetForceHTTPS(asUser(other.ID), domain.ID, false); !apperrors.IsPermissionDenied(err) {
+		t.Fatalf("SetForceHTTPS() error = %v, want permission denied", err)
+	}
+}
+
+func TestSetForceHTTPSWritesAndReloads(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	domains, fake := newTestDomainService(t, db, cfg)
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "example.com")
+	if err := db.Model(domain).Update("has_ssl", true).Error; err != nil {
+		t.Fatal(err)
+	}
+	mustCreate(t, db, &models.SSLCertificate{DomainID: domain.ID, IsActive: true, ExpiresAt: time.Now().Add(30 * 24 * time.Hour)})
+
+	updated, err := domains.SetForceHTTPS(asUser(owner.ID), domain.ID, true)
+	if err != nil {
+		t.Fatalf("SetForceHTTPS: %v", err)
+	}
+	if !updated.ForceHTTPS {
+		t.Error("ForceHTTPS not set on the returned domain")
+	}
+
+	content, err := os.ReadFile(filepath.Join(cfg.VhostDir, "example.com.conf"))
+	if err != nil {
+		t.Fatalf("vhost not written: %v", err)
+	}
+	if !strings.Contains(string(content), "return 301 https://$host$request_uri;") {
+		t.Error("vhost does not redirect to HTTPS")
+	}
+
+	var commands []string
+	for _, call := range fake.Calls() {
+		commands = append(commands, call.String())
+	}
+	if got := strings.Join(commands, "; "); got != "nginx -t; nginx -s reload" {
+		t.Errorf("commands = %q, want the configuration checked, then nginx reloaded", got)
+	}
+}
+
+func TestReloadSkippedWhenConfigurationFailsCheck(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	domains, fake := newTestDomainService(t, db, cfg)
+	fake.Respond("nginx -t", runnerFailure("emerg"))
+
+	domains.reloadWebServer(context.Background())
+
+	for _, call := range fake.Calls() {
+		if call.String() == "nginx -s reload" {
+			t.Fatal("nginx reloaded a configuration that failed its check")
+		}
+	}
+}
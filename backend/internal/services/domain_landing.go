@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// writeLandingPage puts the configured landing page into a new domain's document root and records
+// it, so RemoveLandingPages can take it away once the owner uploads a site. Failures are logged;
+// the domain works without the page.
+func (s *DomainService) writeLandingPage(ctx context.Context, domain *models.Domain) {
+	if dryRun(ctx, s.config) {
+		s.logger.Info("Dry run: skipping landing page write", zap.String("domain", domain.Name))
+		return
+	}
+
+	written, err := s.vhost.WriteLandingPage(domain)
+	if err != nil {
+		s.logger.Error("Failed to write landing page", zap.String("domain", domain.Name), zap.Error(err))
+		return
+	}
+	if !written {
+		return
+	}
+
+	now := time.Now()
+	if err := s.db.WithContext(ctx).Model(domain).Update("landing_page_at", now).Error; err != nil {
+		s.logger.Error("Failed to record landing page", zap.String("domain", domain.Name), zap.Error(err))
+		return
+	}
+	domain.LandingPageAt = &now
+	s.invalidateDomain(ctx, domain.ID)
+}
+
+// RemoveLandingPages deletes the generated landing page of every domain that has other content in
+// its document root by now, and stops tracking pages the owner replaced or deleted. It returns the
+// number of domains done with.
+func (s *DomainService) RemoveLandingPages(ctx context.Context) (int, error) {
+	var domains []models.Domain
+	if err := s.db.WithContext(ctx).Where("landing_page_at IS NOT NULL").Find(&domains).Error; err != nil {
+		return 0, fmt.Errorf("failed to get domains with landing pages: %w", err)
+	}
+	if dryRun(ctx, s.config) {
+		s.logger.Info("Dry run: skipping landing page removal", zap.Int("domains", len(domains)))
+		return 0, nil
+	}
+
+	done := 0
+	for i := range domains {
+		domain := &domains[i]
+		removed, err := s.vhost.RemoveLandingPage(domain)
+		if err != nil {
+			s.logger.Error("Failed to check landing page", zap.String("domain", domain.Name), zap.Error(err))
+			continue
+		}
+		if !removed {
+			continue
+		}
+
+		if err := s.db.WithContext(ctx).Model(domain).Update("landing_page_at", nil).Error; err != nil {
+			return done, fmt.Errorf("failed to update domain %s: %w", domain.Name, err)
+		}
+		s.invalidateDomain(ctx, domain.ID)
+		done++
+	}
+
+	return done, nil
+}
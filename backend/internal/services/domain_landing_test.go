@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestLandingPageLifecycle(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	cfg.LandingPage = "coming_soon"
+	cfg.FTPUID, cfg.FTPGID = os.Getuid(), os.Getgid()
+	domains, _ := newTestDomainService(t, db, cfg)
+	owner := createTestUser(t, db)
+	ctx := context.Background()
+
+	newDomain := func(name string) *models.Domain {
+		domain := createTestDomain(t, db, owner, name)
+		domain.DocumentRoot = filepath.Join(t.TempDir(), "public_html")
+		db.Model(domain).Update("document_root", domain.DocumentRoot)
+		return domain
+	}
+	landingPageAt := func(domain *models.Domain) bool {
+		var stored models.Domain
+		db.First(&stored, "id = ?", domain.ID)
+		return stored.LandingPageAt != nil
+	}
+
+	uploaded := newDomain("uploaded.example")
+	empty := newDomain("empty.example")
+	dry := newDomain("dry.example")
+	domains.writeLandingPage(ctx, uploaded)
+	domains.writeLandingPage(ctx, empty)
+	domains.writeLandingPage(context.WithValue(ctx, "dry_run", true), dry)
+
+	if _, err := os.Stat(filepath.Join(uploaded.DocumentRoot, "index.html")); err != nil {
+		t.Fatalf("landing page not written: %v", err)
+	}
+	if !landingPageAt(uploaded) || uploaded.LandingPageAt == nil {
+		t.Error("landing page not recorded")
+	}
+	if _, err := os.Stat(dry.DocumentRoot); !os.IsNotExist(err) || landingPageAt(dry) {
+		t.Error("landing page written in a dry run")
+	}
+
+	if err := os.WriteFile(filepath.Join(uploaded.DocumentRoot, "app.php"), []byte("<?php"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	removed, err := domains.RemoveLandingPages(ctx)
+	if err != nil || removed != 1 {
+		t.Fatalf("RemoveLandingPages() = %d, %v; want 1", removed, err)
+	}
+	if _, err := os.Stat(filepath.Join(uploaded.DocumentRoot, "index.html")); !os.IsNotExist(err) {
+		t.Error("landing page left next to the uploaded site")
+	}
+	if landingPageAt(uploaded) || !landingPageAt(empty) {
+		t.Errorf("tracked landing pages: uploaded %v, empty %v", landingPageAt(uploaded), landingPageAt(empty))
+	}
+	if _, err := os.Stat(filepath.Join(empty.DocumentRoot, "index.html")); err != nil {
+		t.Errorf("landing page of the empty domain removed: %v", err)
+	}
+}
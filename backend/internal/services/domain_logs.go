@@ -0,0 +1,138 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+const (
+	defaultLogLines = 100
+	maxLogLines     = 1000
+)
+
+var (
+	// Combined log format: ip ident user [time] "request" status ...
+	accessLogPattern = regexp.MustCompile(`^\S+ \S+ \S+ \[([^\]]+)\] "[^"]*" (\d{3}) `)
+	errorLogPattern  = regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}) `)
+)
+
+// LogQuery filters the lines returned from a domain's web server logs
+type LogQuery struct {
+	Lines  int       `json:"lines"`
+	Status int       `json:"status,omitempty"` // Only applies to access logs
+	Since  time.Time `json:"since,omitempty"`
+}
+
+// GetAccessLog returns the most recent access log lines of a domain owned by the user
+func (s *DomainService) GetAccessLog(ctx context.Context, userID, domainID uuid.UUID, query LogQuery) ([]string, error) {
+	domain, err := s.getOwnedDomain(ctx, userID, domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	accessLog, _ := s.vhost.LogPaths(domain.Name)
+	return tailLog(accessLog, query.Lines, func(line string) bool {
+		match := accessLogPattern.FindStringSubmatch(line)
+		if match == nil {
+			return query.Status == 0 && query.Since.IsZero()
+		}
+		if query.Status != 0 {
+			if status, _ := strconv.Atoi(match[2]); status != query.Status {
+				return false
+			}
+		}
+		if !query.Since.IsZero() {
+			at, err := time.Parse("02/Jan/2006:15:04:05 -0700", match[1])
+			if err != nil || at.Before(query.Since) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// GetErrorLog returns the most recent error log lines of a domain owned by the user
+func (s *DomainService) GetErrorLog(ctx context.Context, userID, domainID uuid.UUID, query LogQuery) ([]string, error) {
+	domain, err := s.getOwnedDomain(ctx, userID, domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, errorLog := s.vhost.LogPaths(domain.Name)
+	return tailLog(errorLog, query.Lines, func(line string) bool {
+		if query.Since.IsZero() {
+			return true
+		}
+		match := errorLogPattern.FindStringSubmatch(line)
+		if match == nil {
+			return false
+		}
+		at, err := time.ParseInLocation("2006/01/02 15:04:05", match[1], time.Local)
+		return err == nil && !at.Before(query.Since)
+	})
+}
+
+// getOwnedDomain loads a domain, treating domains owned by other users as missing
+func (s *DomainService) getOwnedDomain(ctx context.Context, userID, domainID uuid.UUID) (*models.Domain, error) {
+	var domain models.Domain
+	if err := s.db.WithContext(ctx).
+		Where("id = ? AND user_id = ?", domainID, userID).
+		First(&domain).Error; err != nil {
+		return nil, apperrors.FromDB(err, "domain")
+	}
+
+	return &domain, nil
+}
+
+// tailLog returns up to limit of the last lines in a file that satisfy match
+func tailLog(path string, limit int, match func(line string) bool) ([]string, error) {
+	if limit <= 0 {
+		limit = defaultLogLines
+	}
+	if limit > maxLogLines {
+		limit = maxLogLines
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, fmt.Errorf("failed to open log: %w", err)
+	}
+	defer file.Close()
+
+	// Keep a ring of the last matching lines while scanning
+	ring := make([]string, limit)
+	count := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !match(line) {
+			continue
+		}
+		ring[count%limit] = line
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read log: %w", err)
+	}
+
+	if count <= limit {
+		return ring[:count], nil
+	}
+
+	start := count % limit
+	return append(ring[start:], ring[:start]...), nil
+}
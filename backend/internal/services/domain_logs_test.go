@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestGetAccessLog(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	domains, _ := newTestDomainService(t, db, cfg)
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "logs.example")
+
+	lines := []string{
+		`198.51.100.1 - - [01/Mar/2026:10:00:00 +0000] "GET / HTTP/1.1" 200 512 "-" "curl"`,
+		`198.51.100.2 - - [01/Mar/2026:11:00:00 +0000] "GET /missing HTTP/1.1" 404 0 "-" "curl"`,
+		`198.51.100.3 - - [01/Mar/2026:12:00:00 +0000] "GET /about HTTP/1.1" 200 256 "-" "curl"`,
+		`not an access log line`,
+	}
+	accessLog, _ := domains.vhost.LogPaths(domain.Name)
+	if err := os.MkdirAll(filepath.Dir(accessLog), 0755); err != nil {
+		t.Fatalf("create log directory: %v", err)
+	}
+	if err := os.WriteFile(accessLog, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatalf("write access log: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		query LogQuery
+		want  []string
+	}{
+		{"all", LogQuery{}, lines},
+		{"last lines", LogQuery{Lines: 2}, lines[2:]},
+		{"status", LogQuery{Status: 200}, []string{lines[0], lines[2]}},
+		{"since", LogQuery{Since: time.Date(2026, 3, 1, 10, 30, 0, 0, time.UTC)}, lines[1:3]},
+		{"status and since", LogQuery{Status: 200, Since: time.Date(2026, 3, 1, 10, 30, 0, 0, time.UTC)}, lines[2:3]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := domains.GetAccessLog(context.Background(), owner.ID, domain.ID, tt.query)
+			if err != nil {
+				t.Fatalf("GetAccessLog() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetAccessLog() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetErrorLogOfOthersDomain(t *testing.T) {
+	db := newTestDB(t)
+	domains, _ := newTestDomainService(t, db, testHostingConfig(t))
+	domain := createTestDomain(t, db, createTestUser(t, db), "private.example")
+
+	if _, err := domains.GetErrorLog(context.Background(), createTestUser(t, db).ID, domain.ID, LogQuery{}); err == nil {
+		t.Error("read the error log of another user's domain")
+	}
+	// A domain without logs yet has no lines
+	lines, err := domains.GetErrorLog(context.Background(), domain.UserID, domain.ID, LogQuery{})
+	if err != nil || len(lines) != 0 {
+		t.Errorf("GetErrorLog() = %q, %v; want no lines", lines, err)
+	}
+	if _, err := domains.GetErrorLog(context.Background(), domain.UserID, uuid.New(), LogQuery{}); err == nil {
+		t.Error("read the error log of a missing domain")
+	}
+}
+
+func TestTailLogKeepsTheLastLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "error.log")
+	var lines []string
+	for i := 0; i < 2500; i++ {
+		lines = append(lines, strings.Repeat("x", i%7)+"line")
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatalf("write log: %v", err)
+	}
+
+	got, err := tailLog(path, 5000, func(string) bool { return true })
+	if err != nil {
+		t.Fatalf("tailLog: %v", err)
+	}
+	if len(got) != maxLogLines || !reflect.DeepEqual(got, lines[len(lines)-maxLogLines:]) {
+		t.Errorf("tailLog returned %d lines, want the last %d", len(got), maxLogLines)
+	}
+}
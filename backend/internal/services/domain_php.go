@@ -0,0 +1,261 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/vhost"
+)
+
+// defaultPHPErrorLog is where a domain logs PHP errors when it sets no path, relative to its
+// directory
+const defaultPHPErrorLog = "logs/php_error.log"
+
+// phpErrorLogPattern bounds error log paths to characters that need no quoting in PHP
+// configuration
+var phpErrorLogPattern = regexp.MustCompile(`^[A-Za-z0-9._/-]{1,255}$`)
+
+// PHPSettings selects how a domain runs PHP. An empty version keeps the current one, as do
+// omitted error settings.
+type PHPSettings struct {
+	Version    string   `json:"version"`
+	Handler    string   `json:"handler"`    // fpm or cgi, as installed
+	Extensions []string `json:"extensions"` // Loaded on top of the server's defaults
+
+	DisplayErrors *bool   `json:"display_errors,omitempty"`
+	LogErrors     *bool   `json:"log_errors,omitempty"`
+	ErrorLog      *string `json:"error_log,omitempty"` // Relative to the domain's directory; empty uses logs/php_error.log
+}
+
+// SetPHPSettings sets a domain's PHP version, handler, extensions and error handling, and
+// regenerates its handler configuration and vhosts. The handler must be installed and every
+// extension available for the PHP version; unknown extensions are rejected with the list of
+// available ones. A deprecated version cannot be switched to once past its removal date. The
+// error log must be inside the domain's directory and outside the document roots it serves.
+func (s *DomainService) SetPHPSettings(ctx context.Context, domainID uuid.UUID, settings PHPSettings) (*models.Domain, error) {
+	held, err := lockDomain(ctx, s.locks, domainID)
+	if err != nil {
+		return nil, err
+	}
+	defer held.Release()
+
+	var domain models.Domain
+	if err := s.db.WithContext(ctx).Preload("Node").Preload("Subdomains").Where("id = ?", domainID).First(&domain).Error; err != nil {
+		return nil, apperrors.FromDB(err, "domain")
+	}
+
+	if err := authorizeDomain(ctx, &domain); err != nil {
+		return nil, err
+	}
+
+	version := settings.Version
+	if version == "" {
+		version = domain.PHPVersion
+	}
+	// Domains already on a removed version keep it, and may still change handler and extensions
+	if version != domain.PHPVersion {
+		if err := s.checkPHPVersionSelectable("version", version); err != nil {
+			return nil, err
+		}
+	}
+	extensions, err := s.checkPHPSettings(version, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	if settings.DisplayErrors != nil {
+		domain.PHPDisplayErrors = *settings.DisplayErrors
+	}
+	if settings.LogErrors != nil {
+		domain.PHPLogErrors = *settings.LogErrors
+	}
+	if settings.ErrorLog != nil {
+		domain.PHPErrorLog = strings.TrimSpace(*settings.ErrorLog)
+	}
+	if domain.PHPLogErrors && domain.PHPErrorLog == "" {
+		domain.PHPErrorLog = defaultPHPErrorLog
+	}
+	if domain.PHPErrorLog != "" {
+		if domain.PHPErrorLog, err = phpErrorLogPath(&domain, domain.PHPErrorLog); err != nil {
+			return nil, err
+		}
+	}
+
+	// A struct update, since map updates would skip the JSON serializer of the extensions
+	previousVersion := domain.PHPVersion
+	domain.PHPVersion = version
+	domain.PHPHandler = settings.Handler
+	domain.PHPExtensions = extensions
+	if err := s.db.WithContext(ctx).Model(&domain).
+		Select("php_version", "php_handler", "php_extensions", "php_display_errors", "php_log_errors", "php_error_log").
+		Updates(&domain).Error; err != nil {
+		return nil, fmt.Errorf("failed to update PHP settings: %w", err)
+	}
+	s.invalidateDomain(ctx, domainID)
+
+	s.writePHP(ctx, &domain, previousVersion)
+	s.writeVhost(ctx, &domain)
+	for i := range domain.Subdomains {
+		s.writeSubdomainVhost(ctx, &domain, &domain.Subdomains[i])
+	}
+
+	s.logger.Info("PHP settings updated",
+		zap.String("domain", domain.Name),
+		zap.String("version", version),
+		zap.String("handler", settings.Handler),
+		zap.Strings("extensions", extensions),
+		zap.Bool("display_errors", domain.PHPDisplayErrors),
+		zap.Bool("log_errors", domain.PHPLogErrors))
+
+	return &domain, nil
+}
+
+// phpErrorLogPath resolves an error log path against a domain's directory. It must stay inside
+// the directory and outside the document roots of the domain and its subdomains, which would
+// serve the log to anyone; the domain's subdomains must be loaded.
+func phpErrorLogPath(domain *models.Domain, path string) (string, error) {
+	if !phpErrorLogPattern.MatchString(path) {
+		return "", apperrors.InvalidCode("error_log", "field.format", nil)
+	}
+
+	root := domainRoot(domain.Name)
+	resolved, err := resolveWithin(root, path)
+	if err != nil || resolved == root {
+		return "", apperrors.InvalidCode("error_log", "php.error_log_outside", map[string]string{"dir": root})
+	}
+
+	documentRoots := []string{domain.DocumentRoot}
+	for _, subdomain := range domain.Subdomains {
+		documentRoots = append(documentRoots, subdomain.DocumentRoot)
+	}
+	for _, documentRoot := range documentRoots {
+		if documentRoot == "" {
+			continue
+		}
+		if _, err := resolveWithin(documentRoot, resolved); err == nil {
+			return "", apperrors.InvalidCode("error_log", "php.error_log_public", map[string]string{"dir": documentRoot})
+		}
+	}
+
+	return resolved, nil
+}
+
+// ResetPHPOpcache clears the opcache of the PHP processes serving a domain, so changed scripts
+// are compiled again. Domains on the shared FPM pool of their version clear the cache of every
+// domain on it.
+func (s *DomainService) ResetPHPOpcache(ctx context.Context, domainID uuid.UUID) error {
+	var domain models.Domain
+	if err := s.db.WithContext(ctx).Where("id = ?", domainID).First(&domain).Error; err != nil {
+		return apperrors.FromDB(err, "domain")
+	}
+
+	if err := authorizeDomain(ctx, &domain); err != nil {
+		return err
+	}
+
+	fields := strings.Fields(s.config.PHPOpcacheResetCommand)
+	if len(fields) == 0 {
+		return apperrors.PreconditionCode("opcache_reset_disabled", nil)
+	}
+	replacer := strings.NewReplacer(
+		"{socket}", s.vhost.DomainPHPSocket(&domain),
+		"{version}", domain.PHPVersion,
+		"{domain}", domain.Name,
+	)
+	for i := range fields {
+		fields[i] = replacer.Replace(fields[i])
+	}
+
+	stdout, stderr, err := s.runner.Run(ctx, fields[0], fields[1:]...)
+	if err != nil {
+		output := strings.TrimSpace(string(stdout) + "\n" + string(stderr))
+		return fmt.Errorf("failed to reset opcache of %s: %v: %s", domain.Name, err, output)
+	}
+
+	s.logger.Info("PHP opcache reset", zap.String("domain", domain.Name), zap.String("version", domain.PHPVersion))
+
+	return nil
+}
+
+// checkPHPSettings validates PHP settings for a version against what the server has installed,
+// and returns the extensions normalized: lower case, sorted and without duplicates
+func (s *DomainService) checkPHPSettings(version string, settings PHPSettings) ([]string, error) {
+	v := apperrors.NewValidation()
+	if !phpVersionPattern.MatchString(version) {
+		v.AddCode("version", "field.format", nil)
+		return nil, v.Err()
+	}
+
+	handlerInstalled := false
+	for _, handler := range s.config.PHPHandlers {
+		handlerInstalled = handlerInstalled || handler == settings.Handler
+	}
+	if !handlerInstalled {
+		v.AddCode("handler", "field.enum", map[string]string{"values": strings.Join(s.config.PHPHandlers, ", ")})
+	}
+
+	installed, err := vhost.InstalledPHPExtensions(s.config.PHPModsDir, version)
+	if err != nil {
+		s.logger.Warn("Failed to list PHP extensions", zap.String("version", version), zap.Error(err))
+		v.AddCode("version", "php.version_missing", map[string]string{"version": version})
+		return nil, v.Err()
+	}
+	available := make(map[string]bool, len(installed))
+	for _, name := range installed {
+		available[name] = true
+	}
+
+	seen := make(map[string]bool)
+	extensions := make([]string, 0, len(settings.Extensions))
+	for _, name := range settings.Extensions {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		if !available[name] {
+			v.AddCode("extensions", "php.extension_unknown", map[string]string{
+				"name":      name,
+				"version":   version,
+				"available": strings.Join(installed, ", "),
+			})
+			continue
+		}
+		extensions = append(extensions, name)
+	}
+	sort.Strings(extensions)
+
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	return extensions, nil
+}
+
+// writePHP regenerates a domain's PHP handler configuration and creates the directory of its
+// error log, logging failures like writeVhost
+func (s *DomainService) writePHP(ctx context.Context, domain *models.Domain, previousVersion string) {
+	if dryRun(ctx, s.config) {
+		s.logger.Info("Dry run: skipping PHP configuration write", zap.String("domain", domain.Name))
+		return
+	}
+
+	if domain.PHPLogErrors && domain.PHPErrorLog != "" {
+		if err := mkdirOwned(filepath.Dir(domain.PHPErrorLog), s.config.FTPUID, s.config.FTPGID); err != nil {
+			s.logger.Warn("Failed to create PHP error log directory", zap.String("domain", domain.Name), zap.Error(err))
+		}
+	}
+
+	if err := s.vhost.WritePHP(domain, previousVersion); err != nil {
+		s.logger.Error("Failed to regenerate PHP configuration", zap.String("domain", domain.Name), zap.Error(err))
+	}
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/runner"
+)
+
+func TestPHPErrorLogPath(t *testing.T) {
+	domain := &models.Domain{
+		Name:         "php.example",
+		DocumentRoot: "/var/www/php.example/public_html",
+		Subdomains:   []models.Subdomain{{Name: "blog", DocumentRoot: "/var/www/php.example/subdomains/blog"}},
+	}
+
+	tests := []struct {
+		path    string
+		want    string
+		message string // Expected message when rejected
+	}{
+		{"logs/php_error.log", "/var/www/php.example/logs/php_error.log", ""},
+		{"/var/www/php.example/tmp/php.log", "/var/www/php.example/tmp/php.log", ""},
+		{"logs/../private/php.log", "/var/www/php.example/private/php.log", ""},
+		{"subdomains/blog.log", "/var/www/php.example/subdomains/blog.log", ""},
+		{"../other.example/logs/php.log", "", "must be a file path inside /var/www/php.example"},
+		{"/var/log/php.log", "", "must be a file path inside /var/www/php.example"},
+		{".", "", "must be a file path inside /var/www/php.example"},
+		{"public_html/php.log", "", "document root /var/www/php.example/public_html"},
+		{"logs/../public_html/php.log", "", "document root /var/www/php.example/public_html"},
+		{"subdomains/blog/logs/php.log", "", "document root /var/www/php.example/subdomains/blog"},
+		{"logs/php error.log", "", "invalid format"},
+		{"logs/php.log\nphp_admin_value[open_basedir] = /", "", "invalid format"},
+		{"", "", "invalid format"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := phpErrorLogPath(domain, tt.path)
+			if tt.message == "" {
+				if err != nil || got != tt.want {
+					t.Errorf("phpErrorLogPath() = %q, %v, want %q", got, err, tt.want)
+				}
+				return
+			}
+			if message := fieldMessage(err, "error_log"); !strings.Contains(message, tt.message) {
+				t.Errorf("error_log = %q (%v), want %q", message, err, tt.message)
+			}
+		})
+	}
+}
+
+func TestSetPHPErrorHandling(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	cfg.PHPHandlers = []string{"fpm"}
+	cfg.PHPModsDir = filepath.Join(t.TempDir(), "{version}")
+	if err := os.MkdirAll(strings.ReplaceAll(cfg.PHPModsDir, "{version}", "8.2"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	domains, _ := newTestDomainService(t, db, cfg)
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "php-errors.example")
+	// The log directory is created under the domain's directory
+	if _, err := os.Stat(domainRoot(domain.Name)); os.IsNotExist(err) {
+		t.Cleanup(func() { os.RemoveAll(domainRoot(domain.Name)) })
+	}
+	ctx := asUser(owner.ID, "user")
+	pool := filepath.Join(cfg.PHPPoolDir, "php-errors.example.conf")
+	on, off := true, false
+
+	// Logging without a path logs to the default file, through a pool of the domain's own
+	updated, err := domains.SetPHPSettings(ctx, domain.ID, PHPSettings{Handler: "fpm", DisplayErrors: &on, LogErrors: &on})
+	if err != nil {
+		t.Fatalf("SetPHPSettings() error = %v", err)
+	}
+	if want := "/var/www/php-errors.example/logs/php_error.log"; updated.PHPErrorLog != want {
+		t.Errorf("error log = %q, want %q", updated.PHPErrorLog, want)
+	}
+	content, err := os.ReadFile(pool)
+	for _, line := range []string{"php_flag[display_errors] = on", "php_admin_value[error_log] = /var/www/php-errors.example/logs/php_error.log"} {
+		if !strings.Contains(string(content), line) {
+			t.Errorf("pool lacks %q (%v):\n%s", line, err, content)
+		}
+	}
+
+	// A log the domain would serve is rejected and nothing changes
+	public := "public_html/errors.log"
+	_, err = domains.SetPHPSettings(ctx, domain.ID, PHPSettings{Handler: "fpm", ErrorLog: &public})
+	if message := fieldMessage(err, "error_log"); !strings.Contains(message, "document root") {
+		t.Errorf("error_log = %q (%v), want the document root refused", message, err)
+	}
+	var stored models.Domain
+	db.First(&stored, "id = ?", domain.ID)
+	if !stored.PHPDisplayErrors || !stored.PHPLogErrors || stored.PHPErrorLog != updated.PHPErrorLog {
+		t.Errorf("stored = %v %v %q, want the earlier settings", stored.PHPDisplayErrors, stored.PHPLogErrors, stored.PHPErrorLog)
+	}
+
+	// Omitted settings are kept; turning both off returns the domain to the shared pool
+	custom := "logs/app/php.log"
+	if updated, err = domains.SetPHPSettings(ctx, domain.ID, PHPSettings{Handler: "fpm", ErrorLog: &custom}); err != nil {
+		t.Fatalf("SetPHPSettings() error = %v", err)
+	}
+	if !updated.PHPDisplayErrors || !updated.PHPLogErrors || updated.PHPErrorLog != "/var/www/php-errors.example/logs/app/php.log" {
+		t.Errorf("updated = %v %v %q", updated.PHPDisplayErrors, updated.PHPLogErrors, updated.PHPErrorLog)
+	}
+	if _, err = domains.SetPHPSettings(ctx, domain.ID, PHPSettings{Handler: "fpm", DisplayErrors: &off, LogErrors: &off}); err != nil {
+		t.Fatalf("SetPHPSettings() error = %v", err)
+	}
+	var disabled models.Domain
+	db.First(&disabled, "id = ?", domain.ID)
+	if disabled.PHPDisplayErrors || disabled.PHPLogErrors {
+		t.Errorf("stored = %v %v, want both off", disabled.PHPDisplayErrors, disabled.PHPLogErrors)
+	}
+	if _, err := os.Stat(pool); !os.IsNotExist(err) {
+		t.Errorf("pool left behind with error handling off: %v", err)
+	}
+}
+
+func TestResetPHPOpcache(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	cfg.PHPOpcacheResetCommand = "cachetool opcache:reset --fcgi={socket} --php={version} --name={domain}"
+	domains, fake := newTestDomainService(t, db, cfg)
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "php.example")
+	db.Model(&models.Domain{}).Where("id = ?", domain.ID).Updates(map[string]interface{}{"php_version": "8.3", "php_log_errors": true})
+	ctx := asUser(owner.ID, "user")
+
+	// The command is run against the domain's own pool
+	if err := domains.ResetPHPOpcache(ctx, domain.ID); err != nil {
+		t.Fatalf("ResetPHPOpcache() error = %v", err)
+	}
+	calls := fake.Calls()
+	want := "cachetool opcache:reset --fcgi=" + cfg.PHPFPMSocketDir + "/php8.3-fpm-php.example.sock --php=8.3 --name=php.example"
+	if len(calls) != 1 || calls[0].String() != want {
+		t.Errorf("calls = %v, want %s", calls, want)
+	}
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		command string
+		result  *runner.Result
+		check   func(error) bool
+	}{
+		{"another user", asUser(createTestUser(t, db).ID, "user"), cfg.PHPOpcacheResetCommand, nil, apperrors.IsPermissionDenied},
+		{"admin", asUser(createTestUser(t, db).ID, "admin"), cfg.PHPOpcacheResetCommand, nil, func(err error) bool { return err == nil }},
+		{"not enabled", ctx, "", nil, func(err error) bool { return errorCode(err) == "opcache_reset_disabled" }},
+		{"command fails", ctx, cfg.PHPOpcacheResetCommand, &runner.Result{Stderr: []byte("connection refused"), Err: errors.New("exit status 1")}, func(err error) bool {
+			return err != nil && strings.Contains(err.Error(), "connection refused")
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			domains.config.PHPOpcacheResetCommand = tt.command
+			if tt.result != nil {
+				fake.Respond("cachetool", *tt.result)
+			}
+			if err := domains.ResetPHPOpcache(tt.ctx, domain.ID); !tt.check(err) {
+				t.Errorf("ResetPHPOpcache() error = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestSetPHPSettings(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	cfg.PHPHandlers = []string{"fpm", "cgi"}
+	cfg.PHPModsDir = filepath.Join(t.TempDir(), "{version}", "mods-available")
+	for _, name := range []string{"8.2/intl.ini", "8.2/redis.ini", "8.3/intl.ini"} {
+		path := filepath.Join(strings.ReplaceAll(cfg.PHPModsDir, "{version}", filepath.Dir(name)), filepath.Base(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	domains, _ := newTestDomainService(t, db, cfg)
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "php.example")
+	mustCreate(t, db, &models.Subdomain{DomainID: domain.ID, Name: "blog", DocumentRoot: "/var/www/php.example/subdomains/blog", IsActive: true})
+	ctx := asUser(owner.ID, "user")
+	pool := filepath.Join(cfg.PHPPoolDir, "php.example.conf")
+
+	rejections := []struct {
+		name     string
+		settings PHPSettings
+		field    string
+		want     string
+	}{
+		{"handler not installed", PHPSettings{Handler: "lsapi"}, "handler", "must be one of fpm, cgi"},
+		{"unknown extension", PHPSettings{Handler: "fpm", Extensions: []string{"intl", "xdebug"}}, "extensions", `"xdebug"; available: intl, redis`},
+		{"extension of another version", PHPSettings{Version: "8.3", Handler: "fpm", Extensions: []string{"redis"}}, "extensions", "available: intl"},
+		{"version not installed", PHPSettings{Version: "7.4", Handler: "fpm"}, "version", "not installed"},
+		{"malformed version", PHPSettings{Version: "8.2; rm", Handler: "fpm"}, "version", "format"},
+	}
+	for _, tt := range rejections {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := domains.SetPHPSettings(ctx, domain.ID, tt.settings)
+			if message := fieldMessage(err, tt.field); !strings.Contains(message, tt.want) {
+				t.Errorf("%s = %q (%v), want %q", tt.field, message, err, tt.want)
+			}
+		})
+	}
+	var stored models.Domain
+	db.First(&stored, "id = ?", domain.ID)
+	if stored.PHPHandler != "fpm" || len(stored.PHPExtensions) != 0 {
+		t.Errorf("rejected settings stored: %s %v", stored.PHPHandler, stored.PHPExtensions)
+	}
+
+	// Extensions are normalized and get the domain a pool its vhosts pass PHP to
+	updated, err := domains.SetPHPSettings(ctx, domain.ID, PHPSettings{Handler: "fpm", Extensions: []string{"Redis", " intl", "redis"}})
+	if err != nil {
+		t.Fatalf("SetPHPSettings() error = %v", err)
+	}
+	db.First(&stored, "id = ?", domain.ID)
+	if want := []string{"intl", "redis"}; !reflect.DeepEqual(updated.PHPExtensions, want) || !reflect.DeepEqual(stored.PHPExtensions, want) {
+		t.Errorf("extensions = %v, stored %v, want %v", updated.PHPExtensions, stored.PHPExtensions, want)
+	}
+	content, err := os.ReadFile(pool)
+	if err != nil || !strings.Contains(string(content), "php_admin_value[extension] = redis") {
+		t.Errorf("pool not written (%v):\n%s", err, content)
+	}
+	socket := domains.vhost.DomainPHPSocket(updated)
+	for _, name := range []string{"php.example.conf", "blog.php.example.conf"} {
+		vhost, err := os.ReadFile(filepath.Join(cfg.VhostDir, name))
+		if err != nil || !strings.Contains(string(vhost), socket) {
+			t.Errorf("%s does not pass PHP to %s (%v)", name, socket, err)
+		}
+	}
+
+	// php-cgi replaces the pool
+	if _, err := domains.SetPHPSettings(ctx, domain.ID, PHPSettings{Handler: "cgi", Extensions: []string{"intl"}}); err != nil {
+		t.Fatalf("SetPHPSettings() error = %v", err)
+	}
+	if _, err := os.Stat(pool); !os.IsNotExist(err) {
+		t.Errorf("pool left behind after switching to php-cgi: %v", err)
+	}
+	if content, err := os.ReadFile(filepath.Join(cfg.PHPCGIDir, "php.example.ini")); err != nil || !strings.Contains(string(content), "extension=intl") {
+		t.Errorf("php-cgi configuration not written (%v):\n%s", err, content)
+	}
+
+	// Another user cannot change the settings
+	other := createTestUser(t, db)
+	if _, err := domains.SetPHPSettings(asUser(other.ID, "user"), domain.ID, PHPSettings{Handler: "fpm"}); err == nil {
+		t.Error("another user changed the PHP settings")
+	}
+}
@@ -0,0 +1,368 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// protectedPathPattern matches the paths a directory can be protected at. The character set keeps
+// paths safe to place in a location regex.
+var protectedPathPattern = regexp.MustCompile(`^/[A-Za-z0-9._~/-]*$`)
+
+// directoryUsernamePattern matches the logins of protected directories; a colon would break the
+// htpasswd file
+var directoryUsernamePattern = regexp.MustCompile(`^[A-Za-z0-9._@-]{1,64}$`)
+
+const (
+	defaultProtectedRealm   = "Restricted"
+	maxProtectedRealmLen    = 100
+	directoryPasswordMinLen = 8
+	directoryPasswordMaxLen = 72 // bcrypt ignores anything longer
+)
+
+// ProtectedDirectoryRequest describes a protected directory to create or its new state
+type ProtectedDirectoryRequest struct {
+	Path  string `json:"path"`  // URL path below the document root, "/" for the whole site
+	Realm string `json:"realm"` // Defaults to "Restricted"
+}
+
+// DirectoryUserRequest describes a login of a protected directory
+type DirectoryUserRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// CreateProtectedDirectory requires basic authentication for a path of a domain. Nobody can log in
+// until users are added.
+func (s *DomainService) CreateProtectedDirectory(ctx context.Context, domainID uuid.UUID, req ProtectedDirectoryRequest) (*models.ProtectedDirectory, error) {
+	domain, err := s.ownedDomain(ctx, domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	directory := &models.ProtectedDirectory{DomainID: domain.ID}
+	if err := s.applyProtectedDirectory(ctx, domain, directory, req); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.WithContext(ctx).Create(directory).Error; err != nil {
+		return nil, fmt.Errorf("failed to create protected directory: %w", err)
+	}
+	s.protectedDirectoryChanged(ctx, domain, directory, "create_protected_directory", "protected_directory", directory.ID)
+
+	s.logger.Info("Protected directory created",
+		zap.String("domain", domain.Name),
+		zap.String("path", directory.Path))
+
+	return directory, nil
+}
+
+// GetProtectedDirectories retrieves the protected directories of a domain with their users
+func (s *DomainService) GetProtectedDirectories(ctx context.Context, domainID uuid.UUID) ([]*models.ProtectedDirectory, error) {
+	if _, err := s.ownedDomain(ctx, domainID); err != nil {
+		return nil, err
+	}
+
+	var directories []*models.ProtectedDirectory
+	if err := s.db.WithContext(ctx).
+		Preload("Users", func(db *gorm.DB) *gorm.DB { return db.Order("username") }).
+		Where("domain_id = ?", domainID).
+		Order("path").
+		Find(&directories).Error; err != nil {
+		return nil, fmt.Errorf("failed to get protected directories: %w", err)
+	}
+
+	return directories, nil
+}
+
+// UpdateProtectedDirectory changes the path and realm of a protected directory
+func (s *DomainService) UpdateProtectedDirectory(ctx context.Context, directoryID uuid.UUID, req ProtectedDirectoryRequest) (*models.ProtectedDirectory, error) {
+	directory, domain, err := s.protectedDirectory(ctx, directoryID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.applyProtectedDirectory(ctx, domain, directory, req); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.WithContext(ctx).Omit("Users").Save(directory).Error; err != nil {
+		return nil, fmt.Errorf("failed to update protected directory: %w", err)
+	}
+	s.protectedDirectoryChanged(ctx, domain, directory, "update_protected_directory", "protected_directory", directory.ID)
+
+	return directory, nil
+}
+
+// DeleteProtectedDirectory removes the protection of a directory along with its users
+func (s *DomainService) DeleteProtectedDirectory(ctx context.Context, directoryID uuid.UUID) error {
+	directory, domain, err := s.protectedDirectory(ctx, directoryID)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("directory_id = ?", directory.ID).Delete(&models.DirectoryUser{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(directory).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete protected directory: %w", err)
+	}
+
+	s.invalidateDomain(ctx, domain.ID)
+	s.writeVhost(ctx, domain)
+	if !dryRun(ctx, s.config) {
+		if err := s.vhost.RemoveHtpasswd(domain, directory); err != nil {
+			s.logger.Error("Failed to remove htpasswd", zap.String("domain", domain.Name), zap.Error(err))
+		}
+	}
+	s.auditProtectedDirectory(ctx, domain, directory, "delete_protected_directory", "protected_directory", directory.ID)
+
+	return nil
+}
+
+// AddDirectoryUser adds a login to a protected directory
+func (s *DomainService) AddDirectoryUser(ctx context.Context, directoryID uuid.UUID, req DirectoryUserRequest) (*models.DirectoryUser, error) {
+	directory, domain, err := s.protectedDirectory(ctx, directoryID)
+	if err != nil {
+		return nil, err
+	}
+
+	v := apperrors.NewValidation()
+	if !directoryUsernamePattern.MatchString(req.Username) {
+		v.Add("username", "must be 1 to 64 letters, digits, dots, hyphens, underscores or @")
+	}
+	validateDirectoryPassword(v, req.Password)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	for _, existing := range directory.Users {
+		if existing.Username == req.Username {
+			return nil, apperrors.Invalid("username", "this directory already has a user with this name")
+		}
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	user := &models.DirectoryUser{DirectoryID: directory.ID, Username: req.Username, PasswordHash: string(hash)}
+	if err := s.db.WithContext(ctx).Create(user).Error; err != nil {
+		return nil, fmt.Errorf("failed to create directory user: %w", err)
+	}
+	directory.Users = append(directory.Users, *user)
+	s.protectedDirectoryChanged(ctx, domain, directory, "create_directory_user", "directory_user", user.ID)
+
+	return user, nil
+}
+
+// SetDirectoryUserPassword changes the password of a login of a protected directory
+func (s *DomainService) SetDirectoryUserPassword(ctx context.Context, userID uuid.UUID, password string) error {
+	user, directory, domain, err := s.directoryUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	v := apperrors.NewValidation()
+	validateDirectoryPassword(v, password)
+	if err := v.Err(); err != nil {
+		return err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	if err := s.db.WithContext(ctx).Model(user).Update("password_hash", string(hash)).Error; err != nil {
+		return fmt.Errorf("failed to update directory user: %w", err)
+	}
+	for i := range directory.Users {
+		if directory.Users[i].ID == user.ID {
+			directory.Users[i].PasswordHash = string(hash)
+		}
+	}
+	s.protectedDirectoryChanged(ctx, domain, directory, "update_directory_user", "directory_user", user.ID)
+
+	return nil
+}
+
+// DeleteDirectoryUser removes a login of a protected directory
+func (s *DomainService) DeleteDirectoryUser(ctx context.Context, userID uuid.UUID) error {
+	user, directory, domain, err := s.directoryUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.WithContext(ctx).Delete(user).Error; err != nil {
+		return fmt.Errorf("failed to delete directory user: %w", err)
+	}
+	users := directory.Users[:0]
+	for _, other := range directory.Users {
+		if other.ID != user.ID {
+			users = append(users, other)
+		}
+	}
+	directory.Users = users
+	s.protectedDirectoryChanged(ctx, domain, directory, "delete_directory_user", "directory_user", user.ID)
+
+	return nil
+}
+
+// protectedDirectory loads a protected directory with its users and its domain, checking that the
+// caller may manage the domain
+func (s *DomainService) protectedDirectory(ctx context.Context, directoryID uuid.UUID) (*models.ProtectedDirectory, *models.Domain, error) {
+	var directory models.ProtectedDirectory
+	if err := s.db.WithContext(ctx).Preload("Users").Where("id = ?", directoryID).First(&directory).Error; err != nil {
+		return nil, nil, apperrors.FromDB(err, "protected directory")
+	}
+
+	domain, err := s.ownedDomain(ctx, directory.DomainID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &directory, domain, nil
+}
+
+// directoryUser loads a login of a protected directory along with the directory and its domain
+func (s *DomainService) directoryUser(ctx context.Context, userID uuid.UUID) (*models.DirectoryUser, *models.ProtectedDirectory, *models.Domain, error) {
+	var user models.DirectoryUser
+	if err := s.db.WithContext(ctx).Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, nil, nil, apperrors.FromDB(err, "directory user")
+	}
+
+	directory, domain, err := s.protectedDirectory(ctx, user.DirectoryID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return &user, directory, domain, nil
+}
+
+// applyProtectedDirectory validates req against the domain's other protected directories and
+// copies it onto directory
+func (s *DomainService) applyProtectedDirectory(ctx context.Context, domain *models.Domain, directory *models.ProtectedDirectory, req ProtectedDirectoryRequest) error {
+	dirPath, pathErr := cleanProtectedPath(domain.DocumentRoot, req.Path)
+
+	realm := strings.TrimSpace(req.Realm)
+	if realm == "" {
+		realm = defaultProtectedRealm
+	}
+
+	v := apperrors.NewValidation()
+	if pathErr != nil {
+		v.Add("path", pathErr.Error())
+	}
+	if err := validateRealm(realm); err != nil {
+		v.Add("realm", err.Error())
+	}
+	if err := v.Err(); err != nil {
+		return err
+	}
+
+	var count int64
+	query := s.db.WithContext(ctx).Model(&models.ProtectedDirectory{}).Where("domain_id = ? AND path = ?", domain.ID, dirPath)
+	if directory.ID != uuid.Nil {
+		query = query.Where("id <> ?", directory.ID)
+	}
+	if err := query.Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check protected directories: %w", err)
+	}
+	if count > 0 {
+		return apperrors.Invalid("path", "this path is already protected")
+	}
+
+	directory.Path = dirPath
+	directory.Realm = realm
+	return nil
+}
+
+// cleanProtectedPath normalizes the URL path of a protected directory and checks that the
+// directory it maps to stays inside the document root
+func cleanProtectedPath(documentRoot, dirPath string) (string, error) {
+	if len(dirPath) > 255 || !protectedPathPattern.MatchString(dirPath) {
+		return "", fmt.Errorf("must be a path starting with / made of letters, digits, dots, hyphens, underscores and ~")
+	}
+	for _, segment := range strings.Split(dirPath, "/") {
+		if segment == ".." {
+			return "", fmt.Errorf("must not contain ..")
+		}
+	}
+
+	cleaned := path.Clean(dirPath)
+	if _, err := resolveWithin(documentRoot, strings.TrimPrefix(cleaned, "/")); err != nil {
+		return "", fmt.Errorf("must stay inside the document root")
+	}
+	return cleaned, nil
+}
+
+// validateDirectoryPassword checks the length of a password of a protected directory
+func validateDirectoryPassword(v *apperrors.ValidationError, password string) {
+	if len(password) < directoryPasswordMinLen {
+		v.AddCode("password", "field.min_length", map[string]string{"min": strconv.Itoa(directoryPasswordMinLen)})
+	} else if len(password) > directoryPasswordMaxLen {
+		v.AddCode("password", "field.max_length", map[string]string{"max": strconv.Itoa(directoryPasswordMaxLen)})
+	}
+}
+
+// validateRealm accepts realms that can be written quoted into the vhost
+func validateRealm(realm string) error {
+	if len(realm) > maxProtectedRealmLen {
+		return fmt.Errorf("must be at most %d characters", maxProtectedRealmLen)
+	}
+	for _, r := range realm {
+		if unicode.IsControl(r) || strings.ContainsRune(`"\${};`, r) {
+			return fmt.Errorf("must not contain quotes, backslashes, braces, semicolons or $")
+		}
+	}
+	return nil
+}
+
+// protectedDirectoryChanged writes a directory's password file, regenerates the vhost and audits
+// the change. The directory's Users must be loaded.
+func (s *DomainService) protectedDirectoryChanged(ctx context.Context, domain *models.Domain, directory *models.ProtectedDirectory, action, resource string, resourceID uuid.UUID) {
+	s.invalidateDomain(ctx, domain.ID)
+
+	// The password file goes first: a vhost pointing at a missing one rejects every login
+	if dryRun(ctx, s.config) {
+		s.logger.Info("Dry run: skipping htpasswd write", zap.String("domain", domain.Name), zap.String("path", directory.Path), zap.Int("users", len(directory.Users)))
+	} else if err := s.vhost.WriteHtpasswd(domain, directory); err != nil {
+		s.logger.Error("Failed to write htpasswd", zap.String("domain", domain.Name), zap.Error(err))
+	}
+	s.writeVhost(ctx, domain)
+
+	s.auditProtectedDirectory(ctx, domain, directory, action, resource, resourceID)
+}
+
+// auditProtectedDirectory records a change to a protected directory or one of its users
+func (s *DomainService) auditProtectedDirectory(ctx context.Context, domain *models.Domain, directory *models.ProtectedDirectory, action, resource string, resourceID uuid.UUID) {
+	id := resourceID.String()
+	auditLog := &models.AuditLog{
+		UserID:     actorFromContext(ctx),
+		Action:     action,
+		Resource:   resource,
+		ResourceID: &id,
+		Details:    domain.Name + directory.Path,
+		Success:    true,
+	}
+	if err := s.db.WithContext(ctx).Create(auditLog).Error; err != nil {
+		s.logger.Error("Failed to record audit log", zap.Error(err))
+	}
+}
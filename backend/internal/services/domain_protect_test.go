@@ -0,0 +1,165 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestCleanProtectedPath(t *testing.T) {
+	root := "/var/www/shop.example/public_html"
+	tests := []struct {
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{path: "/", want: "/"},
+		{path: "/admin", want: "/admin"},
+		{path: "/admin/", want: "/admin"},
+		{path: "//admin//billing", want: "/admin/billing"},
+		{path: "/a/./b", want: "/a/b"},
+		{path: "/~user", want: "/~user"},
+		{path: "admin", wantErr: true},
+		{path: "", wantErr: true},
+		{path: "/../secrets", wantErr: true},
+		{path: "/admin/../../x", wantErr: true},
+		{path: "/admin dir", wantErr: true},
+		{path: "/admin;", wantErr: true},
+		{path: "/(x|y)", wantErr: true},
+		{path: "/" + strings.Repeat("a", 255), wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := cleanProtectedPath(root, tt.path)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("cleanProtectedPath(%q) = %q, %v; want %q, error %v", tt.path, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateRealm(t *testing.T) {
+	tests := []struct {
+		realm string
+		ok    bool
+	}{
+		{"Staff only", true},
+		{"Área restrita", true},
+		{`Say "hi"`, false},
+		{`a\b`, false},
+		{"a;b", false},
+		{"${host}", false},
+		{"line\nbreak", false},
+		{strings.Repeat("r", 101), false},
+	}
+	for _, tt := range tests {
+		if err := validateRealm(tt.realm); (err == nil) != tt.ok {
+			t.Errorf("validateRealm(%q) = %v, want ok %v", tt.realm, err, tt.ok)
+		}
+	}
+}
+
+func TestProtectedDirectoryLifecycle(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	domains, _ := newTestDomainService(t, db, cfg)
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "protect.example")
+	ctx := asUser(owner.ID, "user")
+	vhostPath := filepath.Join(cfg.VhostDir, "protect.example.conf")
+	readFile := func(path string) string {
+		content, _ := os.ReadFile(path)
+		return string(content)
+	}
+
+	if _, err := domains.CreateProtectedDirectory(ctx, domain.ID, ProtectedDirectoryRequest{Path: "/../etc"}); fieldMessage(err, "path") == "" {
+		t.Errorf("path outside the document root: error = %v", err)
+	}
+	directory, err := domains.CreateProtectedDirectory(ctx, domain.ID, ProtectedDirectoryRequest{Path: "/admin/"})
+	if err != nil {
+		t.Fatalf("CreateProtectedDirectory() error = %v", err)
+	}
+	if directory.Path != "/admin" || directory.Realm != "Restricted" {
+		t.Errorf("directory = %s with realm %q", directory.Path, directory.Realm)
+	}
+	if _, err := domains.CreateProtectedDirectory(ctx, domain.ID, ProtectedDirectoryRequest{Path: "/admin"}); !strings.Contains(fieldMessage(err, "path"), "already protected") {
+		t.Errorf("second protection of /admin: error = %v", err)
+	}
+
+	htpasswd := domains.vhost.HtpasswdPath(domain, directory)
+	if !strings.Contains(readFile(vhostPath), "auth_basic_user_file "+htpasswd+";") {
+		t.Errorf("vhost does not protect /admin:\n%s", readFile(vhostPath))
+	}
+
+	rejections := []struct {
+		name  string
+		req   DirectoryUserRequest
+		field string
+	}{
+		{"colon in the username", DirectoryUserRequest{Username: "a:b", Password: "long enough"}, "username"},
+		{"short password", DirectoryUserRequest{Username: "alice", Password: "short"}, "password"},
+		{"password past bcrypt's limit", DirectoryUserRequest{Username: "alice", Password: strings.Repeat("p", 73)}, "password"},
+	}
+	for _, tt := range rejections {
+		if _, err := domains.AddDirectoryUser(ctx, directory.ID, tt.req); fieldMessage(err, tt.field) == "" {
+			t.Errorf("%s: error = %v", tt.name, err)
+		}
+	}
+
+	user, err := domains.AddDirectoryUser(ctx, directory.ID, DirectoryUserRequest{Username: "alice", Password: "correct horse"})
+	if err != nil {
+		t.Fatalf("AddDirectoryUser() error = %v", err)
+	}
+	if _, err := domains.AddDirectoryUser(ctx, directory.ID, DirectoryUserRequest{Username: "alice", Password: "another one"}); fieldMessage(err, "username") == "" {
+		t.Errorf("duplicate user: error = %v", err)
+	}
+	checkPassword := func(password string) error {
+		for _, line := range strings.Split(readFile(htpasswd), "\n") {
+			if hash, ok := strings.CutPrefix(line, "alice:"); ok {
+				return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+			}
+		}
+		t.Fatalf("htpasswd lacks alice:\n%s", readFile(htpasswd))
+		return nil
+	}
+	if err := checkPassword("correct horse"); err != nil {
+		t.Errorf("htpasswd hash does not match the password: %v", err)
+	}
+
+	if err := domains.SetDirectoryUserPassword(ctx, user.ID, "battery staple"); err != nil {
+		t.Fatalf("SetDirectoryUserPassword() error = %v", err)
+	}
+	if err := checkPassword("battery staple"); err != nil {
+		t.Errorf("htpasswd not updated with the new password: %v", err)
+	}
+
+	other := createTestUser(t, db)
+	if err := domains.DeleteDirectoryUser(asUser(other.ID, "user"), user.ID); err == nil {
+		t.Error("another user deleted a directory user")
+	}
+
+	if err := domains.DeleteProtectedDirectory(ctx, directory.ID); err != nil {
+		t.Fatalf("DeleteProtectedDirectory() error = %v", err)
+	}
+	if _, err := os.Stat(htpasswd); !os.IsNotExist(err) {
+		t.Errorf("htpasswd left behind: %v", err)
+	}
+	if strings.Contains(readFile(vhostPath), "auth_basic") {
+		t.Error("vhost still protects the deleted directory")
+	}
+	var users int64
+	db.Model(&models.DirectoryUser{}).Where("directory_id = ?", directory.ID).Count(&users)
+	if users != 0 {
+		t.Errorf("%d users left of the deleted directory", users)
+	}
+
+	var actions []string
+	db.Model(&models.AuditLog{}).Where("user_id = ?", owner.ID).Order("created_at").Pluck("action", &actions)
+	want := "create_protected_directory,create_directory_user,update_directory_user,delete_protected_directory"
+	if strings.Join(actions, ",") != want {
+		t.Errorf("audit log = %v, want %s", actions, want)
+	}
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// DomainQuotas are the disk and bandwidth allocations of a domain, in bytes
+type DomainQuotas struct {
+	DiskQuota      int64 `json:"disk_quota"`
+	BandwidthQuota int64 `json:"bandwidth_quota"`
+}
+
+// DefaultQuotas returns the quotas a new domain of the user receives. Each role acts as a
+// package: the user gets the largest allocation any of their roles grants, or the configured
+// default when none of them sets one.
+func (s *DomainService) DefaultQuotas(ctx context.Context, userID uuid.UUID) (*DomainQuotas, error) {
+	var user models.User
+	if err := s.db.WithContext(ctx).Preload("Roles").Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, apperrors.FromDB(err, "user")
+	}
+
+	return packageQuotas(user.Roles, s.config.DefaultDiskQuota, s.config.DefaultBandwidthQuota), nil
+}
+
+// packageQuotas picks the largest allocation of the roles, falling back to the defaults
+func packageQuotas(roles []models.Role, defaultDisk, defaultBandwidth int64) *DomainQuotas {
+	var quotas DomainQuotas
+	for _, role := range roles {
+		if role.DiskQuota != nil && *role.DiskQuota > quotas.DiskQuota {
+			quotas.DiskQuota = *role.DiskQuota
+		}
+		if role.BandwidthQuota != nil && *role.BandwidthQuota > quotas.BandwidthQuota {
+			quotas.BandwidthQuota = *role.BandwidthQuota
+		}
+	}
+
+	if quotas.DiskQuota == 0 {
+		quotas.DiskQuota = defaultDisk
+	}
+	if quotas.BandwidthQuota == 0 {
+		quotas.BandwidthQuota = defaultBandwidth
+	}
+
+	return &quotas
+}
+
+// SubdomainLimit returns how many subdomains each domain of the user may have; 0 means unlimited
+func (s *DomainService) SubdomainLimit(ctx context.Context, userID uuid.UUID) (int, error) {
+	var user models.User
+	if err := s.db.WithContext(ctx).Preload("Roles").Where("id = ?", userID).First(&user).Error; err != nil {
+		return 0, apperrors.FromDB(err, "user")
+	}
+
+	return packageSubdomainLimit(user.Roles, s.config.DefaultMaxSubdomains), nil
+}
+
+// packageSubdomainLimit picks the most generous subdomain limit of the roles, falling back to
+// the default when none sets one. A role allowing unlimited subdomains wins.
+func packageSubdomainLimit(roles []models.Role, defaultLimit int) int {
+	limit, set := 0, false
+	for _, role := range roles {
+		if role.MaxSubdomains == nil {
+			continue
+		}
+		if *role.MaxSubdomains <= 0 {
+			return 0
+		}
+		if *role.MaxSubdomains > limit {
+			limit = *role.MaxSubdomains
+		}
+		set = true
+	}
+
+	if !set {
+		return defaultLimit
+	}
+	return limit
+}
+
+// AutoSSL reports whether new domains of the user get a certificate issued automatically
+func (s *DomainService) AutoSSL(ctx context.Context, userID uuid.UUID) (bool, error) {
+	var user models.User
+	if err := s.db.WithContext(ctx).Preload("Roles").Where("id = ?", userID).First(&user).Error; err != nil {
+		return false, apperrors.FromDB(err, "user")
+	}
+
+	return packageAutoSSL(user.Roles, s.config.AutoSSL), nil
+}
+
+// packageAutoSSL reports whether any role turns automatic certificates on, falling back to the
+// default when none sets it
+func packageAutoSSL(roles []models.Role, defaultEnabled bool) bool {
+	enabled, set := false, false
+	for _, role := range roles {
+		if role.AutoSSL == nil {
+			continue
+		}
+		enabled = enabled || *role.AutoSSL
+		set = true
+	}
+
+	if !set {
+		return defaultEnabled
+	}
+	return enabled
+}
+
+// clamp limits requested quotas to the allowed ones; unset (zero) requests get the full allocation
+func (q *DomainQuotas) clamp(requested *DomainQuotas) *DomainQuotas {
+	effective := *q
+	if requested == nil {
+		return &effective
+	}
+
+	if requested.DiskQuota > 0 && requested.DiskQuota < effective.DiskQuota {
+		effective.DiskQuota = requested.DiskQuota
+	}
+	if requested.BandwidthQuota > 0 && requested.BandwidthQuota < effective.BandwidthQuota {
+		effective.BandwidthQuota = requested.BandwidthQuota
+	}
+
+	return &effective
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// createPackageRole stores a role with the given quotas and gives it to the user
+func createPackageRole(t *testing.T, db *gorm.DB, user *models.User, name string, disk, bandwidth *int64) {
+	t.Helper()
+
+	role := &models.Role{Name: name, DisplayName: name, DiskQuota: disk, BandwidthQuota: bandwidth}
+	mustCreate(t, db, role)
+	mustCreate(t, db, &models.UserRole{UserID: user.ID, RoleID: role.ID})
+}
+
+func quota(n int64) *int64 { return &n }
+
+func TestPackageQuotas(t *testing.T) {
+	tests := []struct {
+		name  string
+		roles []models.Role
+		want  DomainQuotas
+	}{
+		{"no roles", nil, DomainQuotas{DiskQuota: 100, BandwidthQuota: 1000}},
+		{"role without package", []models.Role{{Name: "user"}}, DomainQuotas{DiskQuota: 100, BandwidthQuota: 1000}},
+		{"largest allocation wins", []models.Role{
+			{DiskQuota: quota(500), BandwidthQuota: quota(200)},
+			{DiskQuota: quota(300), BandwidthQuota: quota(4000)},
+		}, DomainQuotas{DiskQuota: 500, BandwidthQuota: 4000}},
+		{"partial package", []models.Role{{DiskQuota: quota(50)}}, DomainQuotas{DiskQuota: 50, BandwidthQuota: 1000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := packageQuotas(tt.roles, 100, 1000); *got != tt.want {
+				t.Errorf("packageQuotas() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClampQuotas(t *testing.T) {
+	allowed := &DomainQuotas{DiskQuota: 500, BandwidthQuota: 4000}
+
+	tests := []struct {
+		name      string
+		requested *DomainQuotas
+		want      DomainQuotas
+	}{
+		{"nothing requested", nil, *allowed},
+		{"lower", &DomainQuotas{DiskQuota: 100, BandwidthQuota: 1000}, DomainQuotas{DiskQuota: 100, BandwidthQuota: 1000}},
+		{"higher", &DomainQuotas{DiskQuota: 900, BandwidthQuota: 9000}, *allowed},
+		{"unset", &DomainQuotas{DiskQuota: 100}, DomainQuotas{DiskQuota: 100, BandwidthQuota: 4000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := allowed.clamp(tt.requested); *got != tt.want {
+				t.Errorf("clamp() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateDomainUsesPackageQuotas(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	cfg.DefaultDiskQuota = 100
+	cfg.DefaultBandwidthQuota = 1000
+	domains, _ := newTestDomainService(t, db, cfg)
+	owner := createTestUser(t, db)
+	createPackageRole(t, db, owner, "gold", quota(500), quota(4000))
+
+	defaults, err := domains.DefaultQuotas(context.Background(), owner.ID)
+	if err != nil || *defaults != (DomainQuotas{DiskQuota: 500, BandwidthQuota: 4000}) {
+		t.Fatalf("DefaultQuotas() = %+v, %v", defaults, err)
+	}
+
+	domain, err := domains.CreateDomain(asUser(owner.ID, "user"), owner.ID, "package.example", &DomainQuotas{DiskQuota: 9000, BandwidthQuota: 2000})
+	if err != nil {
+		t.Fatalf("CreateDomain() error = %v", err)
+	}
+	if domain.DiskQuota != 500 || domain.BandwidthQuota != 2000 {
+		t.Errorf("domain quotas = %d disk, %d bandwidth; want 500 and 2000", domain.DiskQuota, domain.BandwidthQuota)
+	}
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestCreateDomainDefaultRecords(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	cfg.Nameservers = []string{"ns1.panel.example", "ns2.panel.example"}
+	domains, _ := newTestDomainService(t, db, cfg)
+	owner := createTestUser(t, db)
+	ctx := asUser(owner.ID)
+
+	domain, err := domains.CreateDomain(ctx, owner.ID, "records.example", nil)
+	if err != nil {
+		t.Fatalf("CreateDomain: %v", err)
+	}
+
+	var records []models.DNSRecord
+	if err := db.Where("domain_id = ?", domain.ID).Order("type, name").Find(&records).Error; err != nil {
+		t.Fatalf("load records: %v", err)
+	}
+	var got []string
+	for _, record := range records {
+		got = append(got, record.Type+" "+record.Name+" "+record.Value)
+	}
+	want := []string{
+		"A @ 192.0.2.10",
+		"A www 192.0.2.10",
+		"MX @ mail.records.example",
+		"NS @ ns1.panel.example",
+		"NS @ ns2.panel.example",
+		"SOA @ ns1.panel.example hostmaster.records.example",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("records:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	var versions int64
+	db.Model(&models.DNSZoneVersion{}).Where("domain_id = ? AND action = ?", domain.ID, "create").Count(&versions)
+	if versions != int64(len(want)) {
+		t.Errorf("zone history has %d create entries, want %d", versions, len(want))
+	}
+
+	zoneFile, err := os.ReadFile(filepath.Join(cfg.ZoneDir, "records.example.zone"))
+	if err != nil {
+		t.Fatalf("zone file not written: %v", err)
+	}
+	if !strings.Contains(string(zoneFile), "192.0.2.10") {
+		t.Errorf("zone file misses the address record:\n%s", zoneFile)
+	}
+}
+
+func TestCreateDomainDefaultRecordsValidated(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	cfg.ServerIPv4 = "not-an-address"
+	domains, _ := newTestDomainService(t, db, cfg)
+	owner := createTestUser(t, db)
+
+	domain, err := domains.CreateDomain(asUser(owner.ID), owner.ID, "invalid.example", nil)
+	if err != nil {
+		t.Fatalf("CreateDomain: %v", err)
+	}
+
+	var count int64
+	db.Model(&models.DNSRecord{}).Where("domain_id = ?", domain.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("%d records stored for an invalid server address, want none", count)
+	}
+}
+
+func TestCreateSubdomainRecords(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	cfg.ServerIPv6 = "2001:db8::10"
+	domains, _ := newTestDomainService(t, db, cfg)
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "sub.example")
+
+	if _, err := domains.CreateSubdomain(asUser(owner.ID), domain.ID, "blog"); err != nil {
+		t.Fatalf("CreateSubdomain: %v", err)
+	}
+
+	var records []models.DNSRecord
+	db.Where("domain_id = ? AND name = ?", domain.ID, "blog").Order("type").Find(&records)
+	if len(records) != 2 || records[0].Type != "A" || records[1].Type != "AAAA" || records[1].Value != "2001:db8::10" {
+		t.Fatalf("subdomain records = %+v, want an A and an AAAA record", records)
+	}
+
+	var versions int64
+	db.Model(&models.DNSZoneVersion{}).Where("domain_id = ?", domain.ID).Count(&versions)
+	if versions != 2 {
+		t.Errorf("zone history has %d entries, want 2", versions)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.ZoneDir, "sub.example.zone")); err != nil {
+		t.Errorf("zone not synced: %v", err)
+	}
+}
+
+func TestCreateSubdomainRecordsRespectLimits(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	cfg.DNSMaxRecords = 1
+	domains, _ := newTestDomainService(t, db, cfg)
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "limited.example")
+	db.Create(&models.DNSRecord{DomainID: domain.ID, Type: "A", Name: "@", Value: "192.0.2.10", TTL: 3600, IsActive: true})
+
+	if _, err := domains.CreateSubdomain(asUser(owner.ID), domain.ID, "blog"); err != nil {
+		t.Fatalf("CreateSubdomain: %v", err)
+	}
+
+	var count int64
+	db.Model(&models.DNSRecord{}).Where("domain_id = ?", domain.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("zone has %d records, want the limit of 1", count)
+	}
+}
@@ -0,0 +1,255 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// redirectSourcePattern matches the paths a redirect can be attached to. The character set keeps
+// sources safe to place unquoted in a location directive.
+var redirectSourcePattern = regexp.MustCompile(`^/[A-Za-z0-9._~%/+,=:@-]*$`)
+
+// maxRedirectTargetLength bounds redirect target URLs
+const maxRedirectTargetLength = 2048
+
+// RedirectRequest describes a redirect to create or the new state of an existing one
+type RedirectRequest struct {
+	SourcePath    string `json:"source_path"` // "/" redirects the whole domain
+	TargetURL     string `json:"target_url"`
+	StatusCode    int    `json:"status_code"` // 301 (default) or 302
+	PreserveQuery bool   `json:"preserve_query"`
+}
+
+// CreateRedirect adds a redirect to a domain and regenerates its vhost
+func (s *DomainService) CreateRedirect(ctx context.Context, domainID uuid.UUID, req RedirectRequest) (*models.Redirect, error) {
+	domain, err := s.ownedDomain(ctx, domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	redirect := &models.Redirect{DomainID: domain.ID}
+	if err := s.applyRedirect(ctx, domain, redirect, req); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.WithContext(ctx).Create(redirect).Error; err != nil {
+		return nil, fmt.Errorf("failed to create redirect: %w", err)
+	}
+	s.redirectsChanged(ctx, domain, "create_redirect", redirect.ID)
+
+	s.logger.Info("Redirect created",
+		zap.String("domain", domain.Name),
+		zap.String("source", redirect.SourcePath),
+		zap.String("target", redirect.TargetURL))
+
+	return redirect, nil
+}
+
+// GetRedirects retrieves all redirects of a domain
+func (s *DomainService) GetRedirects(ctx context.Context, domainID uuid.UUID) ([]*models.Redirect, error) {
+	if _, err := s.ownedDomain(ctx, domainID); err != nil {
+		return nil, err
+	}
+
+	var redirects []*models.Redirect
+	if err := s.db.WithContext(ctx).Where("domain_id = ?", domainID).Order("source_path").Find(&redirects).Error; err != nil {
+		return nil, fmt.Errorf("failed to get redirects: %w", err)
+	}
+
+	return redirects, nil
+}
+
+// UpdateRedirect replaces the source, target and options of a redirect and regenerates the vhost
+func (s *DomainService) UpdateRedirect(ctx context.Context, redirectID uuid.UUID, req RedirectRequest) (*models.Redirect, error) {
+	var redirect models.Redirect
+	if err := s.db.WithContext(ctx).Where("id = ?", redirectID).First(&redirect).Error; err != nil {
+		return nil, apperrors.FromDB(err, "redirect")
+	}
+
+	domain, err := s.ownedDomain(ctx, redirect.DomainID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.applyRedirect(ctx, domain, &redirect, req); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.WithContext(ctx).Save(&redirect).Error; err != nil {
+		return nil, fmt.Errorf("failed to update redirect: %w", err)
+	}
+	s.redirectsChanged(ctx, domain, "update_redirect", redirect.ID)
+
+	return &redirect, nil
+}
+
+// DeleteRedirect removes a redirect and regenerates the vhost
+func (s *DomainService) DeleteRedirect(ctx context.Context, redirectID uuid.UUID) error {
+	var redirect models.Redirect
+	if err := s.db.WithContext(ctx).Where("id = ?", redirectID).First(&redirect).Error; err != nil {
+		return apperrors.FromDB(err, "redirect")
+	}
+
+	domain, err := s.ownedDomain(ctx, redirect.DomainID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.WithContext(ctx).Delete(&redirect).Error; err != nil {
+		return fmt.Errorf("failed to delete redirect: %w", err)
+	}
+	s.redirectsChanged(ctx, domain, "delete_redirect", redirect.ID)
+
+	return nil
+}
+
+// applyRedirect validates req against the domain's other redirects and copies it onto redirect
+func (s *DomainService) applyRedirect(ctx context.Context, domain *models.Domain, redirect *models.Redirect, req RedirectRequest) error {
+	if req.StatusCode == 0 {
+		req.StatusCode = 301
+	}
+
+	validation := apperrors.NewValidation()
+	if len(req.SourcePath) > 255 || !redirectSourcePattern.MatchString(req.SourcePath) || strings.Contains(req.SourcePath, "..") {
+		validation.Add("source_path", "must be a path starting with / without spaces, quotes or ..")
+	}
+	if err := validateRedirectTarget(req.TargetURL); err != nil {
+		validation.Add("target_url", err.Error())
+	}
+	if req.StatusCode != 301 && req.StatusCode != 302 {
+		validation.Add("status_code", "must be 301 or 302")
+	}
+	if err := validation.Err(); err != nil {
+		return err
+	}
+
+	var others []models.Redirect
+	query := s.db.WithContext(ctx).Where("domain_id = ?", domain.ID)
+	if redirect.ID != uuid.Nil {
+		query = query.Where("id <> ?", redirect.ID)
+	}
+	if err := query.Find(&others).Error; err != nil {
+		return fmt.Errorf("failed to get redirects: %w", err)
+	}
+
+	for _, other := range others {
+		if other.SourcePath == req.SourcePath {
+			return apperrors.Invalid("source_path", "a redirect for this path already exists")
+		}
+	}
+	if redirectLoops(domain.Name, others, req.SourcePath, req.TargetURL) {
+		return apperrors.Invalid("target_url", "redirect would lead back to its own source path")
+	}
+
+	redirect.SourcePath = req.SourcePath
+	redirect.TargetURL = req.TargetURL
+	redirect.StatusCode = req.StatusCode
+	redirect.PreserveQuery = req.PreserveQuery
+	return nil
+}
+
+// redirectsChanged regenerates the vhost and audits a redirect change
+func (s *DomainService) redirectsChanged(ctx context.Context, domain *models.Domain, action string, redirectID uuid.UUID) {
+	s.invalidateDomain(ctx, domain.ID)
+	s.writeVhost(ctx, domain)
+
+	resourceID := redirectID.String()
+	auditLog := &models.AuditLog{
+		UserID:     actorFromContext(ctx),
+		Action:     action,
+		Resource:   "redirect",
+		ResourceID: &resourceID,
+		Details:    domain.Name,
+		Success:    true,
+	}
+	if err := s.db.WithContext(ctx).Create(auditLog).Error; err != nil {
+		s.logger.Error("Failed to record audit log", zap.Error(err))
+	}
+}
+
+// validateRedirectTarget accepts absolute http(s) URLs and paths on the same domain. Targets are
+// written quoted into the vhost, so characters nginx would interpret are rejected.
+func validateRedirectTarget(target string) error {
+	if target == "" || len(target) > maxRedirectTargetLength {
+		return fmt.Errorf("must be between 1 and %d characters", maxRedirectTargetLength)
+	}
+	for _, r := range target {
+		if unicode.IsSpace(r) || unicode.IsControl(r) || strings.ContainsRune(`"\$`, r) {
+			return fmt.Errorf("must not contain spaces, quotes, backslashes or $")
+		}
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return fmt.Errorf("must be a valid URL")
+	}
+	if u.IsAbs() {
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User != nil {
+			return fmt.Errorf("must be an http or https URL")
+		}
+		return nil
+	}
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") {
+		return fmt.Errorf("must be an http or https URL or a path starting with /")
+	}
+	return nil
+}
+
+// redirectTargetPath returns the path a target points to when it stays on the domain
+func redirectTargetPath(domainName, target string) (string, bool) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", false
+	}
+	if u.IsAbs() {
+		host := strings.ToLower(u.Hostname())
+		if host != domainName && host != "www."+domainName {
+			return "", false
+		}
+	}
+
+	if u.Path == "" {
+		return "/", true
+	}
+	return u.Path, true
+}
+
+// redirectLoops reports whether a redirect from source to target would send requests back to
+// source, either directly or through the domain's other redirects. A whole-domain redirect loops
+// whenever it targets the domain itself.
+func redirectLoops(domainName string, others []models.Redirect, source, target string) bool {
+	next := make(map[string]string, len(others)+1)
+	for _, other := range others {
+		if path, ok := redirectTargetPath(domainName, other.TargetURL); ok {
+			next[other.SourcePath] = path
+		}
+	}
+
+	path, ok := redirectTargetPath(domainName, target)
+	if !ok {
+		return false
+	}
+	if source == "/" {
+		return true
+	}
+
+	for hops := 0; hops <= len(others); hops++ {
+		if path == source {
+			return true
+		}
+		if path, ok = next[path]; !ok {
+			return false
+		}
+	}
+	return false
+}
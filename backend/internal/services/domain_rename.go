@@ -0,0 +1,301 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/tracing"
+)
+
+// renameUndo holds the undo actions of the steps of a rename that already ran
+type renameUndo []func() error
+
+// run undoes the steps in reverse order. Failures are logged, since the rename already failed.
+func (u renameUndo) run(logger *zap.Logger, name string) {
+	for i := len(u) - 1; i >= 0; i-- {
+		if err := u[i](); err != nil {
+			logger.Error("Failed to undo domain rename step", zap.String("domain", name), zap.Error(err))
+		}
+	}
+}
+
+// Rename gives a domain a new name and moves everything that refers to it: its content directory
+// and the document roots of the domain and its subdomains, the home directories and logins of its
+// FTP accounts, DNS record names and host names under the old name, the vhosts, PHP configuration
+// and password files, and the published zone. The files are moved and the new configuration
+// written first; the database change comes last, and when any step fails the ones before it are
+// undone. Certificates do not cover the new name, so they are deactivated and HTTPS is switched
+// off until one is issued; ownership has to be verified again. Databases, their users and grants
+// belong to the domain by ID and never carry its name, so they are left as they are. Mail
+// addresses of the old name in aliases and forwards are not changed.
+func (s *DomainService) Rename(ctx context.Context, domainID uuid.UUID, newName string) (_ *models.Domain, err error) {
+	ctx, span := tracing.Start(ctx, "DomainService.Rename", attribute.String("domain.id", domainID.String()))
+	defer tracing.End(span, &err)
+
+	name := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(newName), "."))
+	if len(name) > 253 || !domainNamePattern.MatchString(name) {
+		return nil, apperrors.InvalidCode("name", "domain.invalid", nil)
+	}
+
+	held, err := lockDomain(ctx, s.locks, domainID)
+	if err != nil {
+		return nil, err
+	}
+	defer held.Release()
+	heldName, err := lockDomainName(ctx, s.locks, name)
+	if err != nil {
+		return nil, err
+	}
+	defer heldName.Release()
+
+	var domain models.Domain
+	if err := s.db.WithContext(ctx).
+		Preload("Node").
+		Preload("Subdomains").
+		Preload("DNSRecords").
+		Preload("Redirects", func(db *gorm.DB) *gorm.DB { return db.Order("source_path") }).
+		Preload("ProtectedDirectories").
+		Where("id = ?", domainID).
+		First(&domain).Error; err != nil {
+		return nil, apperrors.FromDB(err, "domain")
+	}
+
+	actor := actorFromContext(ctx)
+	if err := authorizeDomain(ctx, &domain); err != nil {
+		return nil, err
+	}
+	if name == domain.Name {
+		return nil, apperrors.InvalidCode("name", "domain.unchanged", nil)
+	}
+
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&models.Domain{}).Where("name = ?", name).Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("failed to check domain existence: %w", err)
+	}
+	if count > 0 {
+		return nil, apperrors.InvalidCode("name", "domain.exists", nil)
+	}
+
+	renamed := renamedDomain(&domain, name)
+
+	var undo renameUndo
+	if !dryRun(ctx, s.config) {
+		if err := s.moveDomainFiles(ctx, &domain, renamed, &undo); err != nil {
+			undo.run(s.logger, domain.Name)
+			return nil, err
+		}
+	}
+
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return saveRenamedDomain(ctx, tx, &domain, renamed)
+	}); err != nil {
+		undo.run(s.logger, domain.Name)
+		return nil, fmt.Errorf("failed to rename domain: %w", err)
+	}
+
+	// The old configuration only goes once nothing refers to it any more
+	if !dryRun(ctx, s.config) {
+		if err := s.vhost.Remove(&domain); err != nil {
+			s.logger.Error("Failed to remove configuration of old domain name", zap.String("domain", domain.Name), zap.Error(err))
+		}
+		s.reloadWebServer(ctx)
+	}
+	// FTP logins are username@domain, so the server only knows the new ones after a sync
+	if s.ftp != nil {
+		if err := s.ftp.SyncFTPUsers(ctx); err != nil {
+			s.logger.Error("Failed to sync FTP users after domain rename", zap.String("domain", name), zap.Error(err))
+		}
+	}
+	s.invalidateDomain(ctx, domainID)
+	if s.zones != nil {
+		s.zones.ZoneRenamed(ctx, domainID, domain.Name)
+	}
+
+	resourceID := domainID.String()
+	auditLog := &models.AuditLog{
+		UserID:     actor,
+		Action:     "domain_rename",
+		Resource:   "domain",
+		ResourceID: &resourceID,
+		Details:    domain.Name + " -> " + name,
+		Success:    true,
+	}
+	if err := s.db.WithContext(ctx).Create(auditLog).Error; err != nil {
+		s.logger.Error("Failed to record audit log", zap.Error(err))
+	}
+
+	s.logger.Info("Domain renamed", zap.String("from", domain.Name), zap.String("to", name))
+
+	return renamed, nil
+}
+
+// renamedDomain returns a copy of a domain under a new name, with its document roots, DNS records
+// and SSL state as they are after the rename
+func renamedDomain(domain *models.Domain, name string) *models.Domain {
+	from, to := domainRoot(domain.Name), domainRoot(name)
+
+	renamed := *domain
+	renamed.Name = name
+	renamed.DocumentRoot = rebasePath(domain.DocumentRoot, from, to)
+	renamed.PHPErrorLog = rebasePath(domain.PHPErrorLog, from, to)
+	renamed.HasSSL = false
+	renamed.ForceHTTPS = false
+	renamed.VerifiedAt = nil
+	renamed.SSLCertificates = nil
+
+	renamed.Subdomains = make([]models.Subdomain, len(domain.Subdomains))
+	for i, subdomain := range domain.Subdomains {
+		subdomain.DocumentRoot = rebasePath(subdomain.DocumentRoot, from, to)
+		renamed.Subdomains[i] = subdomain
+	}
+
+	renamed.DNSRecords = make([]models.DNSRecord, len(domain.DNSRecords))
+	for i, record := range domain.DNSRecords {
+		record.Name, record.Value = rebaseRecord(&record, domain.Name, name)
+		renamed.DNSRecords[i] = record
+	}
+
+	return &renamed
+}
+
+// moveDomainFiles moves a domain's content and password files to the directories of its new name
+// and writes its configuration under the new name, adding the undo action of each step. The
+// written configuration must pass nginx's check, so a rename never leaves the web server with a
+// configuration it cannot load.
+func (s *DomainService) moveDomainFiles(ctx context.Context, domain, renamed *models.Domain, undo *renameUndo) error {
+	moves := [][2]string{
+		{domainRoot(domain.Name), domainRoot(renamed.Name)},
+		{s.vhost.HtpasswdDir(domain.Name), s.vhost.HtpasswdDir(renamed.Name)},
+	}
+	for _, move := range moves {
+		from, to := move[0], move[1]
+		moved, err := moveDir(from, to)
+		if err != nil {
+			return err
+		}
+		if moved {
+			*undo = append(*undo, func() error {
+				_, err := moveDir(to, from)
+				return err
+			})
+		}
+	}
+
+	// Removing the new configuration also cleans up after a write that failed halfway
+	*undo = append(*undo, func() error { return s.vhost.Remove(renamed) })
+	if err := s.vhost.Write(renamed); err != nil {
+		return fmt.Errorf("failed to write vhost of %s: %w", renamed.Name, err)
+	}
+	for i := range renamed.Subdomains {
+		if err := s.vhost.WriteSubdomain(renamed, &renamed.Subdomains[i]); err != nil {
+			return fmt.Errorf("failed to write vhost of %s.%s: %w", renamed.Subdomains[i].Name, renamed.Name, err)
+		}
+	}
+	if err := s.vhost.WritePHP(renamed, ""); err != nil {
+		return fmt.Errorf("failed to write PHP configuration of %s: %w", renamed.Name, err)
+	}
+
+	if _, stderr, err := s.runner.Run(ctx, "nginx", "-t"); err != nil {
+		return fmt.Errorf("nginx rejected the configuration of %s: %s: %w", renamed.Name, strings.TrimSpace(string(stderr)), err)
+	}
+
+	return nil
+}
+
+// saveRenamedDomain stores the new name of a domain with its changed document roots, FTP home
+// directories and DNS records, and deactivates its certificates. The zone history gets a rename
+// entry, so reverting to it restores records under the new name.
+func saveRenamedDomain(ctx context.Context, tx *gorm.DB, domain, renamed *models.Domain) error {
+	if err := tx.Model(&models.Domain{}).Where("id = ?", domain.ID).Updates(map[string]interface{}{
+		"name":          renamed.Name,
+		"document_root": renamed.DocumentRoot,
+		"php_error_log": renamed.PHPErrorLog,
+		"has_ssl":       false,
+		"force_https":   false,
+		"verified_at":   nil,
+	}).Error; err != nil {
+		return err
+	}
+
+	for i, subdomain := range renamed.Subdomains {
+		if subdomain.DocumentRoot == domain.Subdomains[i].DocumentRoot {
+			continue
+		}
+		if err := tx.Model(&models.Subdomain{}).Where("id = ?", subdomain.ID).Update("document_root", subdomain.DocumentRoot).Error; err != nil {
+			return err
+		}
+	}
+
+	var accounts []models.FTPAccount
+	if err := tx.Where("domain_id = ?", domain.ID).Find(&accounts).Error; err != nil {
+		return err
+	}
+	from, to := domainRoot(domain.Name), domainRoot(renamed.Name)
+	for _, account := range accounts {
+		homeDir := rebasePath(account.HomeDir, from, to)
+		if homeDir == account.HomeDir {
+			continue
+		}
+		if err := tx.Model(&models.FTPAccount{}).Where("id = ?", account.ID).Update("home_dir", homeDir).Error; err != nil {
+			return err
+		}
+	}
+
+	for i, record := range renamed.DNSRecords {
+		old := domain.DNSRecords[i]
+		if record.Name == old.Name && record.Value == old.Value {
+			continue
+		}
+		if err := tx.Model(&models.DNSRecord{}).Where("id = ?", record.ID).Updates(map[string]interface{}{
+			"name":  record.Name,
+			"value": record.Value,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	if err := recordZoneVersion(ctx, tx, domain.ID, "rename", nil, nil, nil); err != nil {
+		return err
+	}
+
+	return tx.Model(&models.SSLCertificate{}).Where("domain_id = ?", domain.ID).Update("is_active", false).Error
+}
+
+// moveDir renames a directory, creating the parent of the target. It reports false when there is
+// nothing to move, and refuses to replace an existing target.
+func moveDir(from, to string) (bool, error) {
+	if _, err := os.Lstat(from); errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if _, err := os.Lstat(to); err == nil {
+		return false, apperrors.PreconditionCode("domain_path_exists", map[string]string{"path": to})
+	}
+
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return false, fmt.Errorf("failed to create %s: %w", filepath.Dir(to), err)
+	}
+	if err := os.Rename(from, to); err != nil {
+		return false, fmt.Errorf("failed to move %s to %s: %w", from, to, err)
+	}
+	return true, nil
+}
+
+// rebasePath moves a path inside the from directory to the same place inside to. Other paths are
+// returned unchanged.
+func rebasePath(path, from, to string) string {
+	rel, err := filepath.Rel(from, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return filepath.Join(to, rel)
+}
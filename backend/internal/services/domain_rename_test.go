@@ -0,0 +1,157 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/runner"
+)
+
+// createRenameFixture stores a domain with a DNS record, an FTP account and a database with a user
+func createRenameFixture(t *testing.T, db *gorm.DB) (*models.User, *models.Domain) {
+	t.Helper()
+
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "old.example")
+	mustCreate(t, db, &models.DNSRecord{DomainID: domain.ID, Type: "CNAME", Name: "www", Value: "old.example.", TTL: 3600, IsActive: true})
+	mustCreate(t, db, &models.FTPAccount{DomainID: domain.ID, Username: "deploy", PasswordHash: "$2a$10$hash", HomeDir: "/var/www/old.example/public_html/uploads", IsActive: true})
+	mustCreate(t, db, &models.FTPAccount{DomainID: domain.ID, Username: "backup", PasswordHash: "$2a$10$hash", HomeDir: "/var/www/old.example", IsActive: true})
+	database := &models.Database{DomainID: domain.ID, Name: "shop", Type: "mysql"}
+	mustCreate(t, db, database)
+	mustCreate(t, db, &models.DatabaseUser{DatabaseID: database.ID, Username: "shop_rw", PasswordHash: "x", Privileges: `["ALL"]`})
+	return owner, domain
+}
+
+func TestRenameUpdatesDependents(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	domains, _ := newTestDomainService(t, db, cfg)
+	domains.SetFTPUsers(NewFTPService(db, nil, zap.NewNop(), cfg))
+	owner, domain := createRenameFixture(t, db)
+
+	renamed, err := domains.Rename(asUser(owner.ID, "user"), domain.ID, "new.example")
+	if err != nil {
+		t.Fatalf("Rename() error = %v", err)
+	}
+	if renamed.Name != "new.example" || renamed.DocumentRoot != "/var/www/new.example/public_html" {
+		t.Errorf("renamed domain = %s at %s", renamed.Name, renamed.DocumentRoot)
+	}
+
+	var record models.DNSRecord
+	db.Where("domain_id = ?", domain.ID).First(&record)
+	if record.Value != "new.example." {
+		t.Errorf("CNAME value = %q, want new.example.", record.Value)
+	}
+
+	homes := map[string]string{}
+	var accounts []models.FTPAccount
+	db.Where("domain_id = ?", domain.ID).Find(&accounts)
+	for _, account := range accounts {
+		homes[account.Username] = account.HomeDir
+	}
+	if homes["deploy"] != "/var/www/new.example/public_html/uploads" || homes["backup"] != "/var/www/new.example" {
+		t.Errorf("FTP home directories = %v", homes)
+	}
+
+	users, err := os.ReadFile(cfg.FTPUsersFile)
+	if err != nil {
+		t.Fatalf("read FTP users: %v", err)
+	}
+	for _, want := range []string{"deploy@new.example:", ":/var/www/new.example/public_html/uploads:"} {
+		if !strings.Contains(string(users), want) {
+			t.Errorf("FTP users file lacks %q:\n%s", want, users)
+		}
+	}
+	if strings.Contains(string(users), "old.example") {
+		t.Errorf("FTP users file still names the old domain:\n%s", users)
+	}
+
+	// Databases and their grants are tied to the domain by ID and keep working
+	var database models.Database
+	if err := db.Preload("DatabaseUsers").Where("domain_id = ?", domain.ID).First(&database).Error; err != nil {
+		t.Fatalf("database of renamed domain: %v", err)
+	}
+	if database.Name != "shop" || len(database.DatabaseUsers) != 1 || database.DatabaseUsers[0].Privileges != `["ALL"]` {
+		t.Errorf("database = %s with users %+v", database.Name, database.DatabaseUsers)
+	}
+
+	// The zone history marks the rename with the records under the new name
+	var versions []models.DNSZoneVersion
+	db.Where("domain_id = ?", domain.ID).Find(&versions)
+	if len(versions) != 1 || versions[0].Action != "rename" || !strings.Contains(versions[0].Snapshot, "new.example.") || strings.Contains(versions[0].Snapshot, "old.example") {
+		t.Errorf("zone history = %+v, want one rename entry under the new name", versions)
+	}
+}
+
+func TestRenameRollsBackWhenNginxRejectsConfiguration(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	domains, fake := newTestDomainService(t, db, cfg)
+	fake.Respond("nginx -t", runner.Result{Stderr: []byte("nginx: [emerg] unknown directive"), Err: errors.New("exit status 1")})
+	owner, domain := createRenameFixture(t, db)
+
+	if _, err := domains.Rename(asUser(owner.ID, "user"), domain.ID, "new.example"); err == nil {
+		t.Fatal("Rename() succeeded with a configuration nginx rejects")
+	}
+
+	var stored models.Domain
+	db.Where("id = ?", domain.ID).First(&stored)
+	if stored.Name != "old.example" {
+		t.Errorf("domain renamed to %s with a rejected configuration", stored.Name)
+	}
+	var versions int64
+	db.Model(&models.DNSZoneVersion{}).Where("domain_id = ?", domain.ID).Count(&versions)
+	if versions != 0 {
+		t.Errorf("%d zone history entries for a failed rename", versions)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.VhostDir, "new.example.conf")); !os.IsNotExist(err) {
+		t.Errorf("rejected vhost kept: %v", err)
+	}
+	for _, call := range fake.Calls() {
+		if call.String() == "nginx -s reload" {
+			t.Error("nginx reloaded with a rejected configuration")
+		}
+	}
+}
+
+func TestRenameRollsBackOnFailure(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	// A file where the vhost directory should be makes writing the new configuration fail
+	if err := os.WriteFile(cfg.VhostDir, nil, 0644); err != nil {
+		t.Fatalf("block vhost directory: %v", err)
+	}
+	domains, _ := newTestDomainService(t, db, cfg)
+	domains.SetFTPUsers(NewFTPService(db, nil, zap.NewNop(), cfg))
+	owner, domain := createRenameFixture(t, db)
+
+	if _, err := domains.Rename(asUser(owner.ID, "user"), domain.ID, "new.example"); err == nil {
+		t.Fatal("Rename() succeeded with an unwritable vhost directory")
+	}
+
+	var stored models.Domain
+	db.Where("id = ?", domain.ID).First(&stored)
+	if stored.Name != "old.example" || stored.DocumentRoot != domain.DocumentRoot {
+		t.Errorf("domain after failed rename = %s at %s", stored.Name, stored.DocumentRoot)
+	}
+	var moved int64
+	db.Model(&models.FTPAccount{}).Where("domain_id = ? AND home_dir LIKE ?", domain.ID, "/var/www/new.example%").Count(&moved)
+	if moved != 0 {
+		t.Errorf("%d FTP accounts moved by a failed rename", moved)
+	}
+	var record models.DNSRecord
+	db.Where("domain_id = ?", domain.ID).First(&record)
+	if record.Value != "old.example." {
+		t.Errorf("CNAME value after failed rename = %q", record.Value)
+	}
+	if _, err := os.Stat(cfg.FTPUsersFile); !os.IsNotExist(err) {
+		t.Errorf("FTP users synced after a failed rename: %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestDeleteSubdomainRemovesDNSRecords(t *testing.T) {
+	tests := []struct {
+		cleanup string
+		want    []string // Records left at or under the subdomain's name
+	}{
+		{"all", nil},
+		{"created", []string{"A blog 203.0.113.5", "MX blog mx.elsewhere.example.", "TXT _dmarc.blog v=DMARC1; p=none"}},
+		{"off", []string{"A blog 192.0.2.10", "A blog 203.0.113.5", "MX blog mx.elsewhere.example.", "TXT _dmarc.blog v=DMARC1; p=none"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cleanup, func(t *testing.T) {
+			db := newTestDB(t)
+			cfg := testHostingConfig(t)
+			cfg.SubdomainDNSCleanup = tt.cleanup
+			domains, _ := newTestDomainService(t, db, cfg)
+			domain := createTestDomain(t, db, createTestUser(t, db), "shop.example")
+			ctx := context.Background()
+
+			subdomain, err := domains.CreateSubdomain(ctx, domain.ID, "blog")
+			if err != nil {
+				t.Fatalf("CreateSubdomain() error = %v", err)
+			}
+			// Records the user added by hand at and under the name, one pointing elsewhere, and
+			// records of the rest of the zone
+			for _, record := range []*models.DNSRecord{
+				{Type: "A", Name: "blog.shop.example.", Value: "203.0.113.5"},
+				{Type: "MX", Name: "blog", Value: "mx.elsewhere.example."},
+				{Type: "TXT", Name: "_dmarc.blog", Value: "v=DMARC1; p=none"},
+				{Type: "A", Name: "blogs", Value: "192.0.2.10"},
+				{Type: "A", Name: "@", Value: "192.0.2.10"},
+			} {
+				record.DomainID, record.TTL, record.IsActive = domain.ID, 3600, true
+				mustCreate(t, db, record)
+			}
+
+			if err := domains.DeleteSubdomain(ctx, subdomain.ID); err != nil {
+				t.Fatalf("DeleteSubdomain() error = %v", err)
+			}
+
+			var records []models.DNSRecord
+			db.Where("domain_id = ?", domain.ID).Find(&records)
+			var left []string
+			others := 0
+			for _, record := range records {
+				name := relativeName(record.Name, domain.Name)
+				if name == "blog" || strings.HasSuffix(name, ".blog") {
+					left = append(left, record.Type+" "+name+" "+record.Value)
+				} else {
+					others++
+				}
+			}
+			sort.Strings(left)
+			if strings.Join(left, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("records left = %q, want %q", left, tt.want)
+			}
+			if others != 2 {
+				t.Errorf("%d other records left, want the 2 outside the subdomain", others)
+			}
+			var subdomains int64
+			db.Model(&models.Subdomain{}).Where("id = ?", subdomain.ID).Count(&subdomains)
+			if subdomains != 0 {
+				t.Error("subdomain not deleted")
+			}
+
+			// The published zone no longer serves the removed records
+			if tt.cleanup == "off" {
+				return
+			}
+			zone, err := os.ReadFile(filepath.Join(cfg.ZoneDir, domain.Name+".zone"))
+			if err != nil {
+				t.Fatalf("read zone file: %v", err)
+			}
+			served := 0
+			for _, line := range strings.Split(string(zone), "\n") {
+				fields := strings.Fields(line)
+				if len(fields) == 0 || strings.HasPrefix(fields[0], "$") {
+					continue
+				}
+				if name := relativeName(fields[0], domain.Name); name == "blog" || strings.HasSuffix(name, ".blog") {
+					served++
+				}
+			}
+			if served != len(tt.want) {
+				t.Errorf("published zone serves %d records of the subdomain, want %d:\n%s", served, len(tt.want), zone)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func subdomainLimit(n int) *int { return &n }
+
+func TestPackageSubdomainLimit(t *testing.T) {
+	tests := []struct {
+		name  string
+		roles []models.Role
+		want  int
+	}{
+		{"no roles", nil, 25},
+		{"roles without a limit", []models.Role{{Name: "user"}}, 25},
+		{"one package", []models.Role{{Name: "user"}, {Name: "basic", MaxSubdomains: subdomainLimit(5)}}, 5},
+		{"most generous package", []models.Role{{Name: "basic", MaxSubdomains: subdomainLimit(5)}, {Name: "pro", MaxSubdomains: subdomainLimit(50)}}, 50},
+		{"unlimited package", []models.Role{{Name: "pro", MaxSubdomains: subdomainLimit(50)}, {Name: "reseller", MaxSubdomains: subdomainLimit(0)}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := packageSubdomainLimit(tt.roles, 25); got != tt.want {
+				t.Errorf("packageSubdomainLimit() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateSubdomainRejections(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []string
+		create   string
+		wantErr  string // Part of the name field's message, or the code of a failed precondition
+	}{
+		{name: "valid label", create: "blog"},
+		{name: "upper case is folded", create: " Shop ", wantErr: ""},
+		{name: "dotted name", create: "a.b", wantErr: "single label"},
+		{name: "leading hyphen", create: "-blog", wantErr: "single label"},
+		{name: "underscore", create: "my_blog", wantErr: "single label"},
+		{name: "empty", create: "", wantErr: "single label"},
+		{name: "reserved", create: "mail", wantErr: "reserved"},
+		{name: "reserved in another case", create: "WWW", wantErr: "reserved"},
+		{name: "existing", existing: []string{"blog"}, create: "blog", wantErr: "already exists"},
+		{name: "limit reached", existing: []string{"a", "b"}, create: "c", wantErr: "subdomain_limit_reached"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			cfg := testHostingConfig(t)
+			cfg.ReservedSubdomains = []string{"www", "mail"}
+			cfg.DefaultMaxSubdomains = 2
+			domains, _ := newTestDomainService(t, db, cfg)
+			domain := createTestDomain(t, db, createTestUser(t, db), "subs.example")
+			for _, name := range tt.existing {
+				mustCreate(t, db, &models.Subdomain{DomainID: domain.ID, Name: name, DocumentRoot: "/var/www/subs.example/subdomains/" + name, IsActive: true})
+			}
+
+			subdomain, err := domains.CreateSubdomain(context.Background(), domain.ID, tt.create)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("CreateSubdomain(%q) error = %v", tt.create, err)
+				}
+				if !subdomainLabelPattern.MatchString(subdomain.Name) {
+					t.Errorf("stored name = %q, want a lower-case label", subdomain.Name)
+				}
+				return
+			}
+			var invalid *apperrors.ValidationError
+			if errors.As(err, &invalid) {
+				if !strings.Contains(invalid.Fields["name"], tt.wantErr) {
+					t.Errorf("CreateSubdomain(%q) name error = %q, want %q", tt.create, invalid.Fields["name"], tt.wantErr)
+				}
+			} else if code := errorCode(err); code != tt.wantErr {
+				t.Errorf("CreateSubdomain(%q) error = %v (code %q), want %q", tt.create, err, code, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCreateSubdomainPackageLimit(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	cfg.DefaultMaxSubdomains = 1
+	domains, _ := newTestDomainService(t, db, cfg)
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "subs.example")
+
+	role := &models.Role{Name: "unlimited", DisplayName: "Unlimited", MaxSubdomains: subdomainLimit(0)}
+	mustCreate(t, db, role)
+	mustCreate(t, db, &models.UserRole{UserID: owner.ID, RoleID: role.ID})
+
+	// The package lifts the default limit of one subdomain
+	for _, name := range []string{"one", "two", "three"} {
+		if _, err := domains.CreateSubdomain(context.Background(), domain.ID, name); err != nil {
+			t.Fatalf("CreateSubdomain(%q) error = %v", name, err)
+		}
+	}
+}
+
+func TestUpdateSubdomainValidatesName(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	cfg.ReservedSubdomains = []string{"ftp"}
+	domains, _ := newTestDomainService(t, db, cfg)
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "subs.example")
+	subdomain := &models.Subdomain{DomainID: domain.ID, Name: "blog", DocumentRoot: "/var/www/subs.example/subdomains/blog", IsActive: true}
+	mustCreate(t, db, subdomain)
+	ctx := asUser(owner.ID, "user")
+
+	for _, name := range []interface{}{"ftp", "bad name", 7} {
+		if _, err := domains.UpdateSubdomain(ctx, subdomain.ID, map[string]interface{}{"name": name}); apperrors.HTTPStatus(err) != http.StatusUnprocessableEntity {
+			t.Errorf("rename to %v: error = %v, want invalid", name, err)
+		}
+	}
+	updated, err := domains.UpdateSubdomain(ctx, subdomain.ID, map[string]interface{}{"name": "News"})
+	if err != nil {
+		t.Fatalf("rename to News: %v", err)
+	}
+	if updated.Name != "news" {
+		t.Errorf("renamed subdomain = %q, want news", updated.Name)
+	}
+}
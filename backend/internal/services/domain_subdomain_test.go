@@ -0,0 +1,191 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestUpdateSubdomainOverrides(t *testing.T) {
+	tests := []struct {
+		name     string
+		updates  map[string]interface{}
+		wantErr  string // Field rejected
+		wantRoot string
+		wantPHP  string
+	}{
+		{name: "relative document root", updates: map[string]interface{}{"document_root": "apps/blog/public"}, wantRoot: "/var/www/sub.example/apps/blog/public"},
+		{name: "absolute document root inside the domain", updates: map[string]interface{}{"document_root": "/var/www/sub.example/blog"}, wantRoot: "/var/www/sub.example/blog"},
+		{name: "document root escaping the domain", updates: map[string]interface{}{"document_root": "../other.example/public_html"}, wantErr: "document_root"},
+		{name: "document root of another domain", updates: map[string]interface{}{"document_root": "/var/www/other.example"}, wantErr: "document_root"},
+		{name: "empty document root", updates: map[string]interface{}{"document_root": ""}, wantErr: "document_root"},
+		{name: "PHP version", updates: map[string]interface{}{"php_version": "8.3"}, wantPHP: "8.3"},
+		{name: "inherited PHP version", updates: map[string]interface{}{"php_version": ""}, wantPHP: ""},
+		{name: "document root that is not a string", updates: map[string]interface{}{"document_root": 7}, wantErr: "document_root"},
+		{name: "malformed PHP version", updates: map[string]interface{}{"php_version": "8.3; rm"}, wantErr: "php_version"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			cfg := testHostingConfig(t)
+			domains, _ := newTestDomainService(t, db, cfg)
+			owner := createTestUser(t, db)
+			domain := createTestDomain(t, db, owner, "sub.example")
+			subdomain := &models.Subdomain{DomainID: domain.ID, Name: "blog", DocumentRoot: "/var/www/sub.example/subdomains/blog", PHPVersion: "8.1", IsActive: true}
+			mustCreate(t, db, subdomain)
+
+			updated, err := domains.UpdateSubdomain(asUser(owner.ID, "user"), subdomain.ID, tt.updates)
+			if tt.wantErr != "" {
+				if fieldMessage(err, tt.wantErr) == "" {
+					t.Fatalf("UpdateSubdomain(%v) error = %v, want %s rejected", tt.updates, err, tt.wantErr)
+				}
+				var stored models.Subdomain
+				db.Where("id = ?", subdomain.ID).First(&stored)
+				if stored.DocumentRoot != subdomain.DocumentRoot || stored.PHPVersion != subdomain.PHPVersion {
+					t.Errorf("rejected update stored %s, PHP %q", stored.DocumentRoot, stored.PHPVersion)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UpdateSubdomain(%v) error = %v", tt.updates, err)
+			}
+
+			wantRoot, wantPHP := subdomain.DocumentRoot, subdomain.PHPVersion
+			if _, ok := tt.updates["document_root"]; ok {
+				wantRoot = tt.wantRoot
+			}
+			if _, ok := tt.updates["php_version"]; ok {
+				wantPHP = tt.wantPHP
+			}
+			if updated.DocumentRoot != wantRoot || updated.PHPVersion != wantPHP {
+				t.Errorf("subdomain = %s with PHP %q, want %s with PHP %q", updated.DocumentRoot, updated.PHPVersion, wantRoot, wantPHP)
+			}
+
+			vhost, err := os.ReadFile(filepath.Join(cfg.VhostDir, "blog.sub.example.conf"))
+			if err != nil {
+				t.Fatalf("read subdomain vhost: %v", err)
+			}
+			if !strings.Contains(string(vhost), "root "+wantRoot) {
+				t.Errorf("subdomain vhost does not serve %s:\n%s", wantRoot, vhost)
+			}
+		})
+	}
+}
+
+func TestUpdateSubdomainChecksOwnership(t *testing.T) {
+	db := newTestDB(t)
+	domains, _ := newTestDomainService(t, db, testHostingConfig(t))
+	owner, other := createTestUser(t, db), createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "sub.example")
+	subdomain := &models.Subdomain{DomainID: domain.ID, Name: "blog", DocumentRoot: "/var/www/sub.example/subdomains/blog", IsActive: true}
+	mustCreate(t, db, subdomain)
+	updates := func() map[string]interface{} { return map[string]interface{}{"document_root": "public_html"} }
+
+	if _, err := domains.UpdateSubdomain(asUser(other.ID, "user"), subdomain.ID, updates()); apperrors.HTTPStatus(err) != http.StatusForbidden {
+		t.Errorf("another user's update error = %v, want permission denied", err)
+	}
+	var stored models.Subdomain
+	db.First(&stored, "id = ?", subdomain.ID)
+	if stored.DocumentRoot != subdomain.DocumentRoot {
+		t.Errorf("another user retargeted the subdomain to %s", stored.DocumentRoot)
+	}
+
+	if _, err := domains.UpdateSubdomain(asUser(other.ID, "admin"), subdomain.ID, updates()); err != nil {
+		t.Errorf("admin's update error = %v", err)
+	}
+}
+
+func TestUpdateSubdomainRejectsSymlinkedRoot(t *testing.T) {
+	db := newTestDB(t)
+	domains, _ := newTestDomainService(t, db, testHostingConfig(t))
+	owner := createTestUser(t, db)
+
+	// The check follows symlinks in the domain's real directory under the web root
+	name := "subroot-" + uuid.NewString()[:8] + ".test"
+	root := domainRoot(name)
+	if err := os.MkdirAll(filepath.Join(root, "public_html"), 0755); err != nil {
+		t.Skipf("web root not writable: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(root) })
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(root, "public_html"), filepath.Join(root, "inside")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	domain := createTestDomain(t, db, owner, name)
+	subdomain := &models.Subdomain{DomainID: domain.ID, Name: "blog", DocumentRoot: filepath.Join(root, "subdomains", "blog"), IsActive: true}
+	mustCreate(t, db, subdomain)
+	ctx := asUser(owner.ID, "user")
+
+	for _, path := range []string{"escape", "escape/site", filepath.Join(root, "escape", "site")} {
+		if _, err := domains.UpdateSubdomain(ctx, subdomain.ID, map[string]interface{}{"document_root": path}); fieldMessage(err, "document_root") == "" {
+			t.Errorf("document root %s through a symlink out of the domain: error = %v", path, err)
+		}
+	}
+	updated, err := domains.UpdateSubdomain(ctx, subdomain.ID, map[string]interface{}{"document_root": "inside/blog"})
+	if err != nil || updated.DocumentRoot != filepath.Join(root, "inside", "blog") {
+		t.Errorf("document root through a symlink inside the domain = %+v, %v", updated, err)
+	}
+}
+
+func TestRenameSubdomain(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	cfg.SubdomainDNSCleanup = "created"
+	domains, _ := newTestDomainService(t, db, cfg)
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "sub.example")
+	ctx := asUser(owner.ID, "user")
+
+	subdomain, err := domains.CreateSubdomain(ctx, domain.ID, "blog")
+	if err != nil {
+		t.Fatalf("CreateSubdomain() error = %v", err)
+	}
+	if _, err := domains.UpdateSubdomain(ctx, subdomain.ID, map[string]interface{}{"php_version": "8.3"}); err != nil {
+		t.Fatalf("UpdateSubdomain() error = %v", err)
+	}
+	custom := &models.DNSRecord{DomainID: domain.ID, Type: "TXT", Name: "blog", Value: "kept", TTL: 3600, IsActive: true}
+	mustCreate(t, db, custom)
+	if _, err := domains.CreateSubdomain(ctx, domain.ID, "shop"); err != nil {
+		t.Fatalf("CreateSubdomain() error = %v", err)
+	}
+
+	if _, err := domains.UpdateSubdomain(ctx, subdomain.ID, map[string]interface{}{"name": "shop"}); fieldMessage(err, "name") == "" {
+		t.Errorf("rename onto another subdomain: error = %v", err)
+	}
+	if _, err := domains.UpdateSubdomain(ctx, subdomain.ID, map[string]interface{}{"name": "news"}); err != nil {
+		t.Fatalf("rename error = %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(cfg.VhostDir, "blog.sub.example.conf")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("vhost of the old name kept: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.VhostDir, "news.sub.example.conf")); err != nil {
+		t.Errorf("vhost of the new name: %v", err)
+	}
+
+	var records []models.DNSRecord
+	db.Where("domain_id = ? AND type = ?", domain.ID, "A").Order("name").Find(&records)
+	var names []string
+	for _, record := range records {
+		names = append(names, record.Name)
+	}
+	if strings.Join(names, ",") != "news,shop" {
+		t.Errorf("A records at %v, want news and shop", names)
+	}
+	var kept models.DNSRecord
+	if err := db.First(&kept, "id = ?", custom.ID).Error; err != nil || kept.Name != "blog" {
+		t.Errorf("record added by hand = %+v, %v, want it kept", kept, err)
+	}
+}
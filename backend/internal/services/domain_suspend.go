@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// maxSuspensionReasonLength is the size of the suspension_reason column
+const maxSuspensionReasonLength = 255
+
+// Suspend takes a domain offline without deleting anything, for example for non-payment or abuse:
+// its sites and subdomains answer 503 with a suspension page and its mailboxes are paused. The
+// reason and the acting user are recorded. A domain suspended with its owner's account stays
+// suspended when the account is reactivated.
+func (s *DomainService) Suspend(ctx context.Context, domainID uuid.UUID, reason string) (*models.Domain, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, apperrors.InvalidCode("reason", "field.empty", nil)
+	}
+	if utf8.RuneCountInString(reason) > maxSuspensionReasonLength {
+		return nil, apperrors.InvalidCode("reason", "field.max_length", map[string]string{"max": strconv.Itoa(maxSuspensionReasonLength)})
+	}
+
+	held, err := lockDomain(ctx, s.locks, domainID)
+	if err != nil {
+		return nil, err
+	}
+	defer held.Release()
+
+	var domain models.Domain
+	if err := s.db.WithContext(ctx).Preload("Subdomains").Where("id = ?", domainID).First(&domain).Error; err != nil {
+		return nil, apperrors.FromDB(err, "domain")
+	}
+
+	suspendedAt := time.Now()
+	if domain.SuspendedAt != nil {
+		suspendedAt = *domain.SuspendedAt
+	}
+	actor := actorFromContext(ctx)
+
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Domain{}).Where("id = ?", domainID).Updates(map[string]interface{}{
+			"suspended_at":      suspendedAt,
+			"suspension_reason": reason,
+			"suspended_by":      actor,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.EmailAccount{}).
+			Where("domain_id = ? AND suspended_at IS NULL", domainID).
+			Update("suspended_at", suspendedAt).Error
+	}); err != nil {
+		return nil, fmt.Errorf("failed to suspend domain: %w", err)
+	}
+	domain.SuspendedAt = &suspendedAt
+	domain.SuspensionReason = reason
+	domain.SuspendedBy = actor
+
+	s.suspensionChanged(ctx, &domain, "domain_suspend", reason)
+
+	return &domain, nil
+}
+
+// Unsuspend brings a domain suspended with Suspend back online with its mailboxes. While the
+// owner's account is deactivated, only the domain's own suspension is lifted; it stays offline
+// until the account is reactivated.
+func (s *DomainService) Unsuspend(ctx context.Context, domainID uuid.UUID) (*models.Domain, error) {
+	held, err := lockDomain(ctx, s.locks, domainID)
+	if err != nil {
+		return nil, err
+	}
+	defer held.Release()
+
+	var domain models.Domain
+	if err := s.db.WithContext(ctx).Preload("User").Preload("Subdomains").Where("id = ?", domainID).First(&domain).Error; err != nil {
+		return nil, apperrors.FromDB(err, "domain")
+	}
+	if domain.SuspensionReason == "" {
+		return nil, apperrors.PreconditionCode("domain_not_suspended", map[string]string{"name": domain.Name})
+	}
+
+	updates := map[string]interface{}{
+		"suspension_reason": "",
+		"suspended_by":      nil,
+	}
+	resume := domain.User.IsActive
+	if resume {
+		updates["suspended_at"] = nil
+	}
+
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Domain{}).Where("id = ?", domainID).Updates(updates).Error; err != nil {
+			return err
+		}
+		if !resume {
+			return nil
+		}
+		return tx.Model(&models.EmailAccount{}).Where("domain_id = ?", domainID).Update("suspended_at", nil).Error
+	}); err != nil {
+		return nil, fmt.Errorf("failed to unsuspend domain: %w", err)
+	}
+	domain.SuspensionReason = ""
+	domain.SuspendedBy = nil
+	if resume {
+		domain.SuspendedAt = nil
+	}
+
+	s.suspensionChanged(ctx, &domain, "domain_unsuspend", "")
+
+	return &domain, nil
+}
+
+// suspensionChanged regenerates the vhosts of a domain and its subdomains after a suspension
+// change and audits it
+func (s *DomainService) suspensionChanged(ctx context.Context, domain *models.Domain, action, reason string) {
+	s.invalidateDomain(ctx, domain.ID)
+	s.writeVhost(ctx, domain)
+	for i := range domain.Subdomains {
+		s.writeSubdomainVhost(ctx, domain, &domain.Subdomains[i])
+	}
+
+	details := domain.Name
+	if reason != "" {
+		details += ": " + reason
+	}
+	resourceID := domain.ID.String()
+	auditLog := &models.AuditLog{
+		UserID:     actorFromContext(ctx),
+		Action:     action,
+		Resource:   "domain",
+		ResourceID: &resourceID,
+		Details:    details,
+		Success:    true,
+	}
+	if err := s.db.WithContext(ctx).Create(auditLog).Error; err != nil {
+		s.logger.Error("Failed to record audit log", zap.Error(err))
+	}
+
+	s.logger.Info("Domain suspension updated",
+		zap.String("domain", domain.Name),
+		zap.Bool("suspended", domain.SuspendedAt != nil),
+		zap.String("reason", domain.SuspensionReason))
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestSuspendValidation(t *testing.T) {
+	db := newTestDB(t)
+	domains, _ := newTestDomainService(t, db, testHostingConfig(t))
+	domain := createTestDomain(t, db, createTestUser(t, db), "shop.example")
+	admin := asUser(createTestUser(t, db).ID, "admin")
+
+	tests := []struct {
+		name   string
+		reason string
+	}{
+		{"empty", ""},
+		{"blank", "   "},
+		{"too long", strings.Repeat("x", maxSuspensionReasonLength+1)},
+	}
+	for _, tt := range tests {
+		if _, err := domains.Suspend(admin, domain.ID, tt.reason); fieldMessage(err, "reason") == "" {
+			t.Errorf("%s reason: error = %v, want a reason error", tt.name, err)
+		}
+	}
+
+	var stored models.Domain
+	db.First(&stored, "id = ?", domain.ID)
+	if stored.SuspendedAt != nil {
+		t.Error("domain suspended without a valid reason")
+	}
+}
+
+func TestSuspendCycle(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	domains, _ := newTestDomainService(t, db, cfg)
+	owner := createTestUser(t, db)
+	adminUser := createTestUser(t, db)
+	admin := asUser(adminUser.ID, "admin")
+	domain := createTestDomain(t, db, owner, "shop.example")
+	mustCreate(t, db, &models.Subdomain{DomainID: domain.ID, Name: "blog", DocumentRoot: "/var/www/shop.example/blog"})
+	account := createTestMailbox(t, db, domain, "info", "secret-password")
+	vhostFile := filepath.Join(cfg.VhostDir, "shop.example.conf")
+	subdomainVhostFile := filepath.Join(cfg.VhostDir, "blog.shop.example.conf")
+	page := filepath.Join(cfg.SuspendedPageDir, "shop.example", "suspended.html")
+
+	suspended, err := domains.Suspend(admin, domain.ID, "  Unpaid invoice 1042 ")
+	if err != nil {
+		t.Fatalf("Suspend() error = %v", err)
+	}
+	if suspended.SuspendedAt == nil || suspended.SuspensionReason != "Unpaid invoice 1042" || suspended.SuspendedBy == nil || *suspended.SuspendedBy != adminUser.ID {
+		t.Errorf("suspended domain = %+v", suspended)
+	}
+
+	// The state is stored with the actor, the mail is paused and the sites answer with the page
+	var stored models.Domain
+	db.First(&stored, "id = ?", domain.ID)
+	if stored.SuspendedAt == nil || stored.SuspensionReason != "Unpaid invoice 1042" || stored.SuspendedBy == nil || *stored.SuspendedBy != adminUser.ID {
+		t.Errorf("stored domain = %+v", stored)
+	}
+	db.First(account, "id = ?", account.ID)
+	if account.SuspendedAt == nil {
+		t.Error("mailbox not paused")
+	}
+	for _, file := range []string{vhostFile, subdomainVhostFile} {
+		content, err := os.ReadFile(file)
+		if err != nil || !strings.Contains(string(content), "error_page 503 /suspended.html;") {
+			t.Errorf("%s does not serve the suspension page (%v):\n%s", filepath.Base(file), err, content)
+		}
+	}
+	if content, err := os.ReadFile(page); err != nil || !strings.Contains(string(content), "shop.example has been suspended") {
+		t.Errorf("suspension page (%v):\n%s", err, content)
+	}
+	var audit models.AuditLog
+	if err := db.Where("action = ?", "domain_suspend").First(&audit).Error; err != nil || audit.Details != "shop.example: Unpaid invoice 1042" || audit.UserID == nil || *audit.UserID != adminUser.ID {
+		t.Errorf("audit log = %+v, %v", audit, err)
+	}
+
+	// Suspending again changes the reason but keeps the time
+	again, err := domains.Suspend(admin, domain.ID, "Abuse report")
+	if err != nil || again.SuspensionReason != "Abuse report" || !again.SuspendedAt.Equal(*stored.SuspendedAt) {
+		t.Errorf("second Suspend() = %+v, %v", again, err)
+	}
+
+	// Reactivating the owner's account does not lift it
+	if err := domains.SetUserDomainsSuspended(admin, owner.ID, false); err != nil {
+		t.Fatalf("SetUserDomainsSuspended() error = %v", err)
+	}
+	db.First(&stored, "id = ?", domain.ID)
+	if stored.SuspendedAt == nil {
+		t.Error("account reactivation lifted the domain's suspension")
+	}
+
+	resumed, err := domains.Unsuspend(admin, domain.ID)
+	if err != nil {
+		t.Fatalf("Unsuspend() error = %v", err)
+	}
+	if resumed.SuspendedAt != nil || resumed.SuspensionReason != "" || resumed.SuspendedBy != nil {
+		t.Errorf("unsuspended domain = %+v", resumed)
+	}
+	var current models.Domain
+	db.First(&current, "id = ?", domain.ID)
+	if current.SuspendedAt != nil || current.SuspensionReason != "" || current.SuspendedBy != nil {
+		t.Errorf("stored domain after Unsuspend() = %+v", current)
+	}
+	var mailbox models.EmailAccount
+	db.First(&mailbox, "id = ?", account.ID)
+	if mailbox.SuspendedAt != nil {
+		t.Error("mailbox still paused")
+	}
+	for _, file := range []string{vhostFile, subdomainVhostFile} {
+		if content, _ := os.ReadFile(file); strings.Contains(string(content), "return 503;") {
+			t.Errorf("%s still suspended:\n%s", filepath.Base(file), content)
+		}
+	}
+	if _, err := os.Stat(page); !os.IsNotExist(err) {
+		t.Error("suspension page kept")
+	}
+	if err := db.Where("action = ?", "domain_unsuspend").First(&models.AuditLog{}).Error; err != nil {
+		t.Errorf("unsuspension not audited: %v", err)
+	}
+
+	if _, err := domains.Unsuspend(admin, domain.ID); errorCode(err) != "domain_not_suspended" {
+		t.Errorf("Unsuspend() of an active domain error = %v", err)
+	}
+}
+
+func TestUnsuspendWhileAccountDeactivated(t *testing.T) {
+	db := newTestDB(t)
+	domains, _ := newTestDomainService(t, db, testHostingConfig(t))
+	owner := createTestUser(t, db)
+	admin := asUser(createTestUser(t, db).ID, "admin")
+	domain := createTestDomain(t, db, owner, "shop.example")
+	account := createTestMailbox(t, db, domain, "info", "secret-password")
+
+	// An account-wide suspension is not an Unsuspend's to lift
+	if err := domains.SetUserDomainsSuspended(admin, owner.ID, true); err != nil {
+		t.Fatalf("SetUserDomainsSuspended() error = %v", err)
+	}
+	if _, err := domains.Unsuspend(admin, domain.ID); errorCode(err) != "domain_not_suspended" {
+		t.Errorf("Unsuspend() of an account suspension error = %v", err)
+	}
+
+	if _, err := domains.Suspend(admin, domain.ID, "Abuse report"); err != nil {
+		t.Fatalf("Suspend() error = %v", err)
+	}
+	db.Model(owner).Update("is_active", false)
+
+	// The domain's own suspension goes, the account's stays
+	resumed, err := domains.Unsuspend(admin, domain.ID)
+	if err != nil {
+		t.Fatalf("Unsuspend() error = %v", err)
+	}
+	if resumed.SuspendedAt == nil || resumed.SuspensionReason != "" {
+		t.Errorf("domain of a deactivated account = %+v", resumed)
+	}
+	db.First(account, "id = ?", account.ID)
+	if account.SuspendedAt == nil {
+		t.Error("mailbox of a deactivated account resumed")
+	}
+
+	// Reactivating the account brings it back
+	db.Model(owner).Update("is_active", true)
+	if err := domains.SetUserDomainsSuspended(admin, owner.ID, false); err != nil {
+		t.Fatalf("SetUserDomainsSuspended() error = %v", err)
+	}
+	var stored models.Domain
+	var mailbox models.EmailAccount
+	db.First(&stored, "id = ?", domain.ID)
+	db.First(&mailbox, "id = ?", account.ID)
+	if stored.SuspendedAt != nil || mailbox.SuspendedAt != nil {
+		t.Errorf("after reactivation domain suspended at %v, mailbox at %v", stored.SuspendedAt, mailbox.SuspendedAt)
+	}
+}
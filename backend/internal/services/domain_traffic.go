@@ -0,0 +1,352 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// Granularities of traffic reports
+const (
+	TrafficHourly  = "hour"
+	TrafficDaily   = "day"
+	TrafficMonthly = "month"
+)
+
+// maxTrafficBuckets bounds the size of a traffic report: a month of hours, or years of days
+const maxTrafficBuckets = 744
+
+// trafficLinePattern reads the time, body size and, with the mynodecp log format, the request
+// size of an access log line in the combined format
+var trafficLinePattern = regexp.MustCompile(`^\S+ \S+ \S+ \[([^\]]+)\] "[^"]*" \d{3} (\d+|-)(?: "[^"]*" "[^"]*"(?: (\d+))?)?`)
+
+// TrafficBucket is a domain's traffic during one interval of a report, starting at Start
+type TrafficBucket struct {
+	Start    time.Time `json:"start"`
+	BytesIn  int64     `json:"bytes_in"`
+	BytesOut int64     `json:"bytes_out"`
+	Requests int64     `json:"requests"`
+}
+
+// TrafficReport is a domain's traffic between From and To, in buckets of Interval, oldest first.
+// Times are UTC.
+type TrafficReport struct {
+	DomainID uuid.UUID       `json:"domain_id"`
+	Interval string          `json:"interval"`
+	From     time.Time       `json:"from"`
+	To       time.Time       `json:"to"`
+	Buckets  []TrafficBucket `json:"buckets"`
+	Total    TrafficBucket   `json:"total"`
+}
+
+// GetTrafficReport returns the traffic of a domain, its subdomains included, between from and to
+// by hour, day or month. A zero to means now and a zero from goes back a day, a month or a year.
+// from is moved back to the start of its bucket.
+func (s *DomainService) GetTrafficReport(ctx context.Context, domainID uuid.UUID, from, to time.Time, interval string) (*TrafficReport, error) {
+	if _, err := s.ownedDomain(ctx, domainID); err != nil {
+		return nil, err
+	}
+
+	v := apperrors.NewValidation()
+	if interval == "" {
+		interval = TrafficDaily
+	}
+	if interval != TrafficHourly && interval != TrafficDaily && interval != TrafficMonthly {
+		v.Add("interval", "interval must be hour, day or month")
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	if to.IsZero() {
+		to = time.Now()
+	}
+	to = to.UTC()
+	if from.IsZero() {
+		switch interval {
+		case TrafficHourly:
+			from = to.Add(-24 * time.Hour)
+		case TrafficDaily:
+			from = to.AddDate(0, -1, 0)
+		default:
+			from = to.AddDate(-1, 0, 0)
+		}
+	}
+	from = trafficBucketStart(from.UTC(), interval)
+
+	if !from.Before(to) {
+		v.Add("from", "from must be before to")
+	} else if count := trafficBucketCount(from, to, interval); count > maxTrafficBuckets {
+		v.Add("from", fmt.Sprintf("a report covers at most %d buckets, this range has %d", maxTrafficBuckets, count))
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	var samples []models.TrafficSample
+	if err := s.db.WithContext(ctx).
+		Where("domain_id = ? AND hour >= ? AND hour < ?", domainID, from, to).
+		Order("hour").
+		Find(&samples).Error; err != nil {
+		return nil, fmt.Errorf("failed to get traffic samples: %w", err)
+	}
+
+	report := &TrafficReport{
+		DomainID: domainID,
+		Interval: interval,
+		From:     from,
+		To:       to,
+		Buckets:  bucketTraffic(samples, from, to, interval),
+	}
+	for _, bucket := range report.Buckets {
+		report.Total.BytesIn += bucket.BytesIn
+		report.Total.BytesOut += bucket.BytesOut
+		report.Total.Requests += bucket.Requests
+	}
+	report.Total.Start = from
+
+	return report, nil
+}
+
+// bucketTraffic sums hourly samples into consecutive buckets covering [from, to), from being the
+// start of a bucket. Buckets without samples are included with zero traffic.
+func bucketTraffic(samples []models.TrafficSample, from, to time.Time, interval string) []TrafficBucket {
+	var buckets []TrafficBucket
+	index := make(map[time.Time]int)
+	for start := from; start.Before(to); start = nextTrafficBucket(start, interval) {
+		index[start] = len(buckets)
+		buckets = append(buckets, TrafficBucket{Start: start})
+	}
+
+	for _, sample := range samples {
+		i, ok := index[trafficBucketStart(sample.Hour.UTC(), interval)]
+		if !ok {
+			continue
+		}
+		buckets[i].BytesIn += sample.BytesIn
+		buckets[i].BytesOut += sample.BytesOut
+		buckets[i].Requests += sample.Requests
+	}
+
+	return buckets
+}
+
+// trafficBucketStart returns the start of the bucket t falls in
+func trafficBucketStart(t time.Time, interval string) time.Time {
+	switch interval {
+	case TrafficHourly:
+		return t.Truncate(time.Hour)
+	case TrafficMonthly:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// nextTrafficBucket returns the start of the bucket after the one starting at start
+func nextTrafficBucket(start time.Time, interval string) time.Time {
+	switch interval {
+	case TrafficHourly:
+		return start.Add(time.Hour)
+	case TrafficMonthly:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// trafficBucketCount returns how many buckets cover [from, to), giving up past maxTrafficBuckets
+func trafficBucketCount(from, to time.Time, interval string) int {
+	count := 0
+	for start := from; start.Before(to) && count <= maxTrafficBuckets; start = nextTrafficBucket(start, interval) {
+		count++
+	}
+	return count
+}
+
+// CollectTraffic reads what was appended to the access logs of every domain and its subdomains
+// since the last run into hourly traffic samples, and sets each domain's bandwidth usage to its
+// traffic in the current month. A log shorter than what was read of it has been rotated and is
+// read from the start.
+func (s *DomainService) CollectTraffic(ctx context.Context) error {
+	var domains []models.Domain
+	if err := s.db.WithContext(ctx).Preload("Subdomains").Find(&domains).Error; err != nil {
+		return fmt.Errorf("failed to get domains: %w", err)
+	}
+
+	var failed int
+	for i := range domains {
+		if err := s.collectDomainTraffic(ctx, &domains[i]); err != nil {
+			s.logger.Error("Failed to collect traffic", zap.String("domain", domains[i].Name), zap.Error(err))
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to collect traffic of %d domains", failed)
+	}
+
+	return nil
+}
+
+// collectDomainTraffic adds the new lines of a domain's access logs to its samples
+func (s *DomainService) collectDomainTraffic(ctx context.Context, domain *models.Domain) error {
+	serverNames := []string{domain.Name}
+	for _, subdomain := range domain.Subdomains {
+		serverNames = append(serverNames, subdomain.Name+"."+domain.Name)
+	}
+
+	hours := make(map[time.Time]*models.TrafficSample)
+	var cursors []models.TrafficLogCursor
+	for _, serverName := range serverNames {
+		path, _ := s.vhost.LogPaths(serverName)
+
+		cursor := models.TrafficLogCursor{Path: path}
+		if err := s.db.WithContext(ctx).Where("path = ?", path).Limit(1).Find(&cursor).Error; err != nil {
+			return fmt.Errorf("failed to get log position: %w", err)
+		}
+
+		offset, err := readTraffic(path, cursor.Offset, func(hour time.Time, bytesIn, bytesOut int64) {
+			sample, ok := hours[hour]
+			if !ok {
+				sample = &models.TrafficSample{DomainID: domain.ID, Hour: hour}
+				hours[hour] = sample
+			}
+			sample.BytesIn += bytesIn
+			sample.BytesOut += bytesOut
+			sample.Requests++
+		})
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if offset != cursor.Offset {
+			cursor.Offset = offset
+			cursors = append(cursors, cursor)
+		}
+	}
+	if len(cursors) == 0 {
+		return nil
+	}
+
+	samples := make([]*models.TrafficSample, 0, len(hours))
+	for _, sample := range hours {
+		samples = append(samples, sample)
+	}
+
+	monthStart := trafficBucketStart(time.Now().UTC(), TrafficMonthly)
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Added to the hour's sample when there is one, since an upsert adding to the stored
+		// values has no form every database accepts
+		for _, sample := range samples {
+			added := tx.Model(&models.TrafficSample{}).
+				Where("domain_id = ? AND hour = ?", sample.DomainID, sample.Hour).
+				Updates(map[string]interface{}{
+					"bytes_in":  gorm.Expr("bytes_in + ?", sample.BytesIn),
+					"bytes_out": gorm.Expr("bytes_out + ?", sample.BytesOut),
+					"requests":  gorm.Expr("requests + ?", sample.Requests),
+				})
+			if added.Error != nil {
+				return fmt.Errorf("failed to store traffic samples: %w", added.Error)
+			}
+			if added.RowsAffected > 0 {
+				continue
+			}
+			if err := tx.Create(sample).Error; err != nil {
+				return fmt.Errorf("failed to store traffic samples: %w", err)
+			}
+		}
+
+		// The position is saved with the samples so no line is counted twice
+		for i := range cursors {
+			if err := tx.Save(&cursors[i]).Error; err != nil {
+				return fmt.Errorf("failed to save log position: %w", err)
+			}
+		}
+
+		var usage int64
+		if err := tx.Model(&models.TrafficSample{}).
+			Select("COALESCE(SUM(bytes_in + bytes_out), 0)").
+			Where("domain_id = ? AND hour >= ?", domain.ID, monthStart).
+			Scan(&usage).Error; err != nil {
+			return fmt.Errorf("failed to sum traffic: %w", err)
+		}
+		return tx.Model(domain).UpdateColumn("bandwidth_usage", usage).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	s.invalidateDomain(ctx, domain.ID)
+	return nil
+}
+
+// readTraffic passes the hour (UTC) and sizes of each complete access log line after offset to add,
+// and returns the offset after the last of them. Lines it cannot read are skipped.
+func readTraffic(path string, offset int64, add func(hour time.Time, bytesIn, bytesOut int64)) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return offset, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return offset, err
+	}
+	if info.Size() < offset {
+		offset = 0
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return offset, err
+	}
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			// A line without its newline is still being written; it is read next time
+			return offset, nil
+		}
+		if err != nil {
+			return offset, err
+		}
+		offset += int64(len(line))
+
+		match := trafficLinePattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		at, err := time.Parse("02/Jan/2006:15:04:05 -0700", match[1])
+		if err != nil {
+			continue
+		}
+		bytesOut, _ := strconv.ParseInt(match[2], 10, 64)
+		bytesIn, _ := strconv.ParseInt(match[3], 10, 64)
+		add(at.UTC().Truncate(time.Hour), bytesIn, bytesOut)
+	}
+}
+
+// PurgeTrafficSamples deletes traffic samples of hours before the given time
+func (s *DomainService) PurgeTrafficSamples(ctx context.Context, before time.Time) (int64, error) {
+	result := s.db.WithContext(ctx).Where("hour < ?", before).Delete(&models.TrafficSample{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to purge traffic samples: %w", result.Error)
+	}
+
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestBucketTraffic(t *testing.T) {
+	at := func(value string) time.Time {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+	samples := []models.TrafficSample{
+		{Hour: at("2026-01-30T22:00:00Z"), BytesIn: 1, BytesOut: 10, Requests: 1},
+		{Hour: at("2026-01-31T23:00:00Z"), BytesIn: 2, BytesOut: 20, Requests: 2},
+		{Hour: at("2026-02-01T00:00:00Z"), BytesIn: 4, BytesOut: 40, Requests: 4},
+		{Hour: at("2026-02-01T05:00:00Z"), BytesIn: 8, BytesOut: 80, Requests: 8},
+		{Hour: at("2026-03-10T00:00:00Z"), BytesIn: 16, BytesOut: 160, Requests: 16},
+	}
+
+	tests := []struct {
+		name     string
+		from, to string
+		interval string
+		want     map[string]int64 // Requests by bucket start; buckets not listed are empty
+		count    int
+	}{
+		{"daily", "2026-01-30T00:00:00Z", "2026-02-02T00:00:00Z", TrafficDaily,
+			map[string]int64{"2026-01-30T00:00:00Z": 1, "2026-01-31T00:00:00Z": 2, "2026-02-01T00:00:00Z": 12}, 3},
+		{"monthly", "2026-01-01T00:00:00Z", "2026-04-01T00:00:00Z", TrafficMonthly,
+			map[string]int64{"2026-01-01T00:00:00Z": 3, "2026-02-01T00:00:00Z": 12, "2026-03-01T00:00:00Z": 16}, 3},
+		{"hourly with gaps", "2026-02-01T00:00:00Z", "2026-02-01T06:00:00Z", TrafficHourly,
+			map[string]int64{"2026-02-01T00:00:00Z": 4, "2026-02-01T05:00:00Z": 8}, 6},
+		{"samples outside the range", "2026-02-02T00:00:00Z", "2026-02-04T00:00:00Z", TrafficDaily, map[string]int64{}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buckets := bucketTraffic(samples, at(tt.from), at(tt.to), tt.interval)
+			if len(buckets) != tt.count {
+				t.Fatalf("%d buckets, want %d", len(buckets), tt.count)
+			}
+			for i, bucket := range buckets {
+				if i > 0 && !bucket.Start.After(buckets[i-1].Start) {
+					t.Errorf("bucket %d starts at %s, not after the one before", i, bucket.Start)
+				}
+				want := tt.want[bucket.Start.Format(time.RFC3339)]
+				if bucket.Requests != want || bucket.BytesIn != want || bucket.BytesOut != 10*want {
+					t.Errorf("bucket %s = %+v, want %d requests", bucket.Start.Format(time.RFC3339), bucket, want)
+				}
+			}
+		})
+	}
+}
+
+func TestTrafficBucketStart(t *testing.T) {
+	at := time.Date(2026, 2, 14, 17, 45, 12, 0, time.UTC)
+	tests := []struct {
+		interval string
+		want     time.Time
+		next     time.Time
+	}{
+		{TrafficHourly, time.Date(2026, 2, 14, 17, 0, 0, 0, time.UTC), time.Date(2026, 2, 14, 18, 0, 0, 0, time.UTC)},
+		{TrafficDaily, time.Date(2026, 2, 14, 0, 0, 0, 0, time.UTC), time.Date(2026, 2, 15, 0, 0, 0, 0, time.UTC)},
+		{TrafficMonthly, time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		start := trafficBucketStart(at, tt.interval)
+		if !start.Equal(tt.want) {
+			t.Errorf("trafficBucketStart(%s) = %s, want %s", tt.interval, start, tt.want)
+		}
+		if next := nextTrafficBucket(start, tt.interval); !next.Equal(tt.next) {
+			t.Errorf("nextTrafficBucket(%s) = %s, want %s", tt.interval, next, tt.next)
+		}
+	}
+}
+
+func TestGetTrafficReport(t *testing.T) {
+	db := newTestDB(t)
+	domains, _ := newTestDomainService(t, db, testHostingConfig(t))
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "traffic.example")
+	ctx := asUser(owner.ID, "user")
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	for hour := 0; hour < 48; hour += 6 {
+		mustCreate(t, db, &models.TrafficSample{DomainID: domain.ID, Hour: day.Add(time.Duration(hour) * time.Hour), BytesIn: 100, BytesOut: 1000, Requests: 10})
+	}
+
+	// from is moved back to the start of its day
+	report, err := domains.GetTrafficReport(ctx, domain.ID, day.Add(7*time.Hour), day.Add(48*time.Hour), TrafficDaily)
+	if err != nil {
+		t.Fatalf("GetTrafficReport() error = %v", err)
+	}
+	if !report.From.Equal(day) || len(report.Buckets) != 2 {
+		t.Fatalf("report from %s with %d buckets", report.From, len(report.Buckets))
+	}
+	if report.Buckets[0].Requests != 40 || report.Total.Requests != 80 || report.Total.BytesOut != 8000 || report.Total.BytesIn != 800 {
+		t.Errorf("buckets %+v, total %+v", report.Buckets, report.Total)
+	}
+
+	rejections := []struct {
+		name     string
+		from, to time.Time
+		interval string
+		field    string
+		want     string
+	}{
+		{"unknown interval", day, day.Add(time.Hour), "week", "interval", "hour, day or month"},
+		{"from after to", day.Add(48 * time.Hour), day, TrafficDaily, "from", "before to"},
+		{"too many buckets", day.AddDate(-1, 0, 0), day, TrafficHourly, "from", "at most 744 buckets"},
+	}
+	for _, tt := range rejections {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := domains.GetTrafficReport(ctx, domain.ID, tt.from, tt.to, tt.interval)
+			if message := fieldMessage(err, tt.field); !strings.Contains(message, tt.want) {
+				t.Errorf("%s = %q (%v), want %q", tt.field, message, err, tt.want)
+			}
+		})
+	}
+
+	other := createTestUser(t, db)
+	if _, err := domains.GetTrafficReport(asUser(other.ID, "user"), domain.ID, time.Time{}, time.Time{}, ""); err == nil {
+		t.Error("another user read the traffic report")
+	}
+}
+
+func TestCollectTraffic(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	domains, _ := newTestDomainService(t, db, cfg)
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "logs.example")
+	mustCreate(t, db, &models.Subdomain{DomainID: domain.ID, Name: "shop", DocumentRoot: "/var/www/logs.example/subdomains/shop", IsActive: true})
+	ctx := context.Background()
+
+	hour := time.Now().UTC().Truncate(time.Hour)
+	stamp := hour.Add(5 * time.Minute).Format("02/Jan/2006:15:04:05 -0700")
+	appendLog := func(serverName string, lines ...string) {
+		t.Helper()
+		path := filepath.Join(cfg.LogDir, serverName, "access.log")
+		os.MkdirAll(filepath.Dir(path), 0755)
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		for _, line := range lines {
+			file.WriteString(line)
+		}
+	}
+	line := func(bytesOut string, extra string) string {
+		return `192.0.2.1 - - [` + stamp + `] "GET / HTTP/1.1" 200 ` + bytesOut + ` "-" "curl/8"` + extra + "\n"
+	}
+	sample := func() models.TrafficSample {
+		var sample models.TrafficSample
+		db.Where("domain_id = ? AND hour = ?", domain.ID, hour).First(&sample)
+		return sample
+	}
+
+	appendLog("logs.example", line("1000", " 300"), line("-", ""), "garbage\n", line("500", ""))
+	appendLog("shop.logs.example", line("2000", " 100"), `192.0.2.1 - - [`+stamp+`] "GET /partial`)
+	if err := domains.CollectTraffic(ctx); err != nil {
+		t.Fatalf("CollectTraffic() error = %v", err)
+	}
+	if got := sample(); got.Requests != 4 || got.BytesOut != 3500 || got.BytesIn != 400 {
+		t.Errorf("sample after the first run = %+v", got)
+	}
+
+	// Only new lines count, including the one finished since
+	appendLog("shop.logs.example", " HTTP/1.1\" 200 50 \"-\" \"curl/8\"\n")
+	appendLog("logs.example", line("10", " 1"))
+	if err := domains.CollectTraffic(ctx); err != nil {
+		t.Fatalf("CollectTraffic() error = %v", err)
+	}
+	got := sample()
+	if got.Requests != 6 || got.BytesOut != 3560 || got.BytesIn != 401 {
+		t.Errorf("sample after the second run = %+v", got)
+	}
+	var stored models.Domain
+	db.First(&stored, "id = ?", domain.ID)
+	if stored.BandwidthUsage != 3961 {
+		t.Errorf("bandwidth usage = %d, want 3961", stored.BandwidthUsage)
+	}
+
+	// A rotated log is read from the start
+	os.WriteFile(filepath.Join(cfg.LogDir, "logs.example", "access.log"), []byte(line("7", "")), 0644)
+	if err := domains.CollectTraffic(ctx); err != nil {
+		t.Fatalf("CollectTraffic() error = %v", err)
+	}
+	if got := sample(); got.Requests != 7 || got.BytesOut != 3567 {
+		t.Errorf("sample after rotation = %+v", got)
+	}
+}
+
+func TestPurgeTrafficSamples(t *testing.T) {
+	db := newTestDB(t)
+	domains, _ := newTestDomainService(t, db, testHostingConfig(t))
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "old.example")
+	now := time.Now().UTC().Truncate(time.Hour)
+	mustCreate(t, db, &models.TrafficSample{DomainID: domain.ID, Hour: now.AddDate(-2, 0, 0), Requests: 1})
+	mustCreate(t, db, &models.TrafficSample{DomainID: domain.ID, Hour: now, Requests: 1})
+
+	purged, err := domains.PurgeTrafficSamples(context.Background(), now.AddDate(-1, 0, 0))
+	if err != nil || purged != 1 {
+		t.Errorf("PurgeTrafficSamples() = %d, %v; want 1", purged, err)
+	}
+}
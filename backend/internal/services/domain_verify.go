@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// Ownership verification methods
+const (
+	VerifyMethodAddress = "address" // A/AAAA records point at the server
+	VerifyMethodTXT     = "txt"     // The verification TXT record is published
+)
+
+// verificationRecordPrefix is the label under which the verification TXT record is published
+const verificationRecordPrefix = "_mynodecp-verify."
+
+// Resolver looks up DNS records; satisfied by *net.Resolver
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+	LookupNS(ctx context.Context, name string) ([]*net.NS, error)
+}
+
+// OwnershipVerification is the result of checking that a domain is served by this panel
+type OwnershipVerification struct {
+	Verified bool     `json:"verified"`
+	Method   string   `json:"method,omitempty"` // The method that succeeded
+	Expected []string `json:"expected"`         // Addresses the domain should resolve to
+	Resolved []string `json:"resolved"`
+	TXTName  string   `json:"txt_name"`  // Alternatively publish this TXT record...
+	TXTValue string   `json:"txt_value"` // ...with this value
+	Message  string   `json:"message,omitempty"`
+}
+
+// VerifyOwnership checks that a domain points at this server, either because its A/AAAA records
+// resolve to the server's address or because it publishes the verification TXT record. Failing
+// verification is not an error; the result says what to publish instead.
+func (s *DomainService) VerifyOwnership(ctx context.Context, domainID uuid.UUID) (*OwnershipVerification, error) {
+	var domain models.Domain
+	if err := s.db.WithContext(ctx).Preload("Node").Where("id = ?", domainID).First(&domain).Error; err != nil {
+		return nil, apperrors.FromDB(err, "domain")
+	}
+
+	if err := authorizeDomain(ctx, &domain); err != nil {
+		return nil, err
+	}
+
+	return s.verifyOwnership(ctx, &domain)
+}
+
+// verifyOwnership checks a domain, loaded with its node, and records a successful verification.
+// A domain waiting for an automatic certificate gets it at the next run of the auto_ssl job.
+func (s *DomainService) verifyOwnership(ctx context.Context, domain *models.Domain) (*OwnershipVerification, error) {
+	if domain.VerificationToken == "" {
+		token, err := newVerificationToken()
+		if err != nil {
+			return nil, err
+		}
+		if err := s.db.WithContext(ctx).Model(domain).Update("verification_token", token).Error; err != nil {
+			return nil, fmt.Errorf("failed to store verification token: %w", err)
+		}
+		domain.VerificationToken = token
+		s.invalidateDomain(ctx, domain.ID)
+	}
+
+	ipv4, ipv6 := s.serverIPs(domain)
+	result := s.checkOwnership(ctx, domain.Name, domain.VerificationToken, ipv4, ipv6)
+
+	if result.Verified {
+		now := time.Now()
+		updates := map[string]interface{}{"verified_at": now}
+		if domain.AutoSSLStatus == AutoSSLPending && domain.AutoSSLNextAt != nil && domain.AutoSSLNextAt.After(now) {
+			updates["auto_ssl_next_at"] = now
+		}
+		if err := s.db.WithContext(ctx).Model(domain).Updates(updates).Error; err != nil {
+			return nil, fmt.Errorf("failed to record verification: %w", err)
+		}
+		s.invalidateDomain(ctx, domain.ID)
+	}
+
+	s.logger.Info("Domain ownership checked",
+		zap.String("domain", domain.Name),
+		zap.Bool("verified", result.Verified),
+		zap.String("method", result.Method),
+	)
+
+	return result, nil
+}
+
+// checkOwnership resolves the domain and its verification record
+func (s *DomainService) checkOwnership(ctx context.Context, name, token string, expected ...string) *OwnershipVerification {
+	result := &OwnershipVerification{
+		Expected: []string{},
+		Resolved: []string{},
+		TXTName:  verificationRecordPrefix + name,
+		TXTValue: "mynodecp-verify=" + token,
+	}
+
+	want := make(map[string]bool)
+	for _, addr := range expected {
+		if ip := net.ParseIP(addr); ip != nil {
+			want[ip.String()] = true
+			result.Expected = append(result.Expected, ip.String())
+		}
+	}
+
+	addrs, err := s.resolver.LookupIPAddr(ctx, name)
+	for _, addr := range addrs {
+		result.Resolved = append(result.Resolved, addr.IP.String())
+		if want[addr.IP.String()] {
+			result.Verified = true
+			result.Method = VerifyMethodAddress
+		}
+	}
+	if result.Verified {
+		return result
+	}
+	if err != nil {
+		result.Message = fmt.Sprintf("%s does not resolve: %v", name, err)
+	} else {
+		result.Message = fmt.Sprintf("%s does not resolve to this server", name)
+	}
+
+	records, err := s.resolver.LookupTXT(ctx, result.TXTName)
+	if err != nil {
+		return result
+	}
+	for _, record := range records {
+		if record == result.TXTValue {
+			result.Verified = true
+			result.Method = VerifyMethodTXT
+			result.Message = ""
+			return result
+		}
+	}
+
+	return result
+}
+
+func newVerificationToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate verification token: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
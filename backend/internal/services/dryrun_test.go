@@ -0,0 +1,55 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDryRunSkipsProvisioning(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    bool
+		request bool
+		skipped bool
+	}{
+		{"live", false, false, false},
+		{"dry-run mode", true, false, true},
+		{"dry-run request", false, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			cfg := testHostingConfig(t)
+			cfg.DryRun = tt.mode
+			domains, fake := newTestDomainService(t, db, cfg)
+			owner := createTestUser(t, db)
+
+			ctx := context.Context(asUser(owner.ID))
+			if tt.request {
+				ctx = context.WithValue(ctx, "dry_run", true)
+			}
+			domain, err := domains.CreateDomain(ctx, owner.ID, "dry.example", nil)
+			if err != nil {
+				t.Fatalf("CreateDomain() error = %v", err)
+			}
+			if _, err := domains.CreateRedirect(ctx, domain.ID, RedirectRequest{SourcePath: "/old", TargetURL: "https://example.net/new"}); err != nil {
+				t.Fatalf("CreateRedirect() error = %v", err)
+			}
+
+			for _, path := range []string{
+				filepath.Join(cfg.VhostDir, "dry.example.conf"),
+				filepath.Join(cfg.ZoneDir, "dry.example.zone"),
+			} {
+				_, err := os.Stat(path)
+				if written := err == nil; written == tt.skipped {
+					t.Errorf("%s written = %v", filepath.Base(path), written)
+				}
+			}
+			if tt.skipped && len(fake.Calls()) != 0 {
+				t.Errorf("dry run ran %v", fake.Calls())
+			}
+		})
+	}
+}
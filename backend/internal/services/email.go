@@ -3,6 +3,7 @@ package services
 import (
 	"context"
 	"fmt"
+	"net"
 
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
@@ -10,6 +11,9 @@ import (
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/mailer"
 	"github.com/mynodecp/mynodecp/backend/internal/models"
 )
 
@@ -18,14 +22,31 @@ type EmailService struct {
 	db     *gorm.DB
 	redis  *redis.Client
 	logger *zap.Logger
+	config config.MailConfig
+
+	notifications *NotificationService
+	domains       *DomainService
+	resolver      MailResolver  // Looks up the records deliverability tests check
+	testSender    mailer.Sender // Sends deliverability test messages through the server's MTA
 }
 
 // NewEmailService creates a new email service
-func NewEmailService(db *gorm.DB, redis *redis.Client, logger *zap.Logger) *EmailService {
+func NewEmailService(db *gorm.DB, redis *redis.Client, logger *zap.Logger, config config.MailConfig, notifications *NotificationService, domains *DomainService) *EmailService {
+	var testSender mailer.Sender = mailer.NewSMTPSender(config)
+	if config.DryRun {
+		testSender = mailer.NewLogSender(logger)
+	}
+
 	return &EmailService{
 		db:     db,
 		redis:  redis,
 		logger: logger,
+		config: config,
+
+		notifications: notifications,
+		domains:       domains,
+		resolver:      net.DefaultResolver,
+		testSender:    testSender,
 	}
 }
 
@@ -34,7 +55,10 @@ func (s *EmailService) CreateEmailAccount(ctx context.Context, domainID uuid.UUI
 	// Check if domain exists
 	var domain models.Domain
 	if err := s.db.WithContext(ctx).Where("id = ?", domainID).First(&domain).Error; err != nil {
-		return nil, fmt.Errorf("domain not found: %w", err)
+		return nil, apperrors.FromDB(err, "domain")
+	}
+	if err := requireFeature(&domain, FeatureEmail); err != nil {
+		return nil, err
 	}
 
 	// Check if email account already exists
@@ -91,7 +115,7 @@ func (s *EmailService) GetEmailAccounts(ctx context.Context, domainID uuid.UUID)
 func (s *EmailService) UpdateEmailAccount(ctx context.Context, accountID uuid.UUID, updates map[string]interface{}) (*models.EmailAccount, error) {
 	var account models.EmailAccount
 	if err := s.db.WithContext(ctx).Where("id = ?", accountID).First(&account).Error; err != nil {
-		return nil, fmt.Errorf("email account not found: %w", err)
+		return nil, apperrors.FromDB(err, "email account")
 	}
 
 	// Hash password if it's being updated
@@ -122,6 +146,14 @@ func (s *EmailService) DeleteEmailAccount(ctx context.Context, accountID uuid.UU
 
 // CreateEmailAlias creates a new email alias
 func (s *EmailService) CreateEmailAlias(ctx context.Context, domainID uuid.UUID, alias, destination string) (*models.EmailAlias, error) {
+	var domain models.Domain
+	if err := s.db.WithContext(ctx).Where("id = ?", domainID).First(&domain).Error; err != nil {
+		return nil, apperrors.FromDB(err, "domain")
+	}
+	if err := requireFeature(&domain, FeatureEmail); err != nil {
+		return nil, err
+	}
+
 	emailAlias := &models.EmailAlias{
 		DomainID:    domainID,
 		Alias:       alias,
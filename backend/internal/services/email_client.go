@@ -0,0 +1,223 @@
+package services
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// Connection security values understood by mail clients
+const (
+	MailSecuritySSL      = "SSL"
+	MailSecurityStartTLS = "STARTTLS"
+)
+
+// MailServerSettings describes how a mail client connects to one protocol
+type MailServerSettings struct {
+	Hostname string `json:"hostname"`
+	Port     int    `json:"port"`
+	Security string `json:"security"`
+	Username string `json:"username"`
+}
+
+// MailClientConfig holds the recommended client settings for an email account
+type MailClientConfig struct {
+	Email string             `json:"email"`
+	IMAP  MailServerSettings `json:"imap"`
+	POP3  MailServerSettings `json:"pop3"`
+	SMTP  MailServerSettings `json:"smtp"`
+}
+
+// GetClientConfig returns the IMAP, POP3 and SMTP settings for an account owned by the caller
+func (s *EmailService) GetClientConfig(ctx context.Context, accountID uuid.UUID) (*MailClientConfig, error) {
+	var account models.EmailAccount
+	if err := s.db.WithContext(ctx).Preload("Domain").Where("id = ?", accountID).First(&account).Error; err != nil {
+		return nil, apperrors.FromDB(err, "email account")
+	}
+
+	if err := authorizeOwner(ctx, account.Domain.UserID, "email account"); err != nil {
+		return nil, err
+	}
+
+	return s.clientConfig(account.Domain.Name, account.Username+"@"+account.Domain.Name), nil
+}
+
+// clientConfig derives the client settings for an address from the server configuration
+func (s *EmailService) clientConfig(domainName, username string) *MailClientConfig {
+	hostname := s.config.ClientHostname
+	if hostname == "" {
+		hostname = "mail." + domainName
+	}
+
+	return &MailClientConfig{
+		Email: username,
+		IMAP:  MailServerSettings{Hostname: hostname, Port: s.config.ClientIMAPPort, Security: portSecurity(s.config.ClientIMAPPort, 143), Username: username},
+		POP3:  MailServerSettings{Hostname: hostname, Port: s.config.ClientPOP3Port, Security: portSecurity(s.config.ClientPOP3Port, 110), Username: username},
+		SMTP:  MailServerSettings{Hostname: hostname, Port: s.config.ClientSMTPPort, Security: portSecurity(s.config.ClientSMTPPort, 25, 587), Username: username},
+	}
+}
+
+// portSecurity returns STARTTLS for the protocol's plain-text ports and implicit TLS otherwise
+func portSecurity(port int, plainPorts ...int) string {
+	for _, plain := range plainPorts {
+		if port == plain {
+			return MailSecurityStartTLS
+		}
+	}
+	return MailSecuritySSL
+}
+
+// autoconfigServer is a server entry in a Thunderbird autoconfig document
+type autoconfigServer struct {
+	Type           string `xml:"type,attr"`
+	Hostname       string `xml:"hostname"`
+	Port           int    `xml:"port"`
+	SocketType     string `xml:"socketType"`
+	Authentication string `xml:"authentication"`
+	Username       string `xml:"username"`
+}
+
+type autoconfigDocument struct {
+	XMLName  xml.Name `xml:"clientConfig"`
+	Version  string   `xml:"version,attr"`
+	Provider struct {
+		ID               string             `xml:"id,attr"`
+		Domain           string             `xml:"domain"`
+		DisplayName      string             `xml:"displayName"`
+		DisplayShortName string             `xml:"displayShortName"`
+		Incoming         []autoconfigServer `xml:"incomingServer"`
+		Outgoing         []autoconfigServer `xml:"outgoingServer"`
+	} `xml:"emailProvider"`
+}
+
+// AutoconfigXML renders the Thunderbird autoconfig document for a hosted domain
+func (s *EmailService) AutoconfigXML(ctx context.Context, domainName string) ([]byte, error) {
+	domain, err := s.hostedMailDomain(ctx, domainName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Thunderbird substitutes the address the user typed for the placeholder
+	config := s.clientConfig(domain.Name, "%EMAILADDRESS%")
+	server := func(kind string, settings MailServerSettings) autoconfigServer {
+		return autoconfigServer{
+			Type:           kind,
+			Hostname:       settings.Hostname,
+			Port:           settings.Port,
+			SocketType:     settings.Security,
+			Authentication: "password-cleartext",
+			Username:       settings.Username,
+		}
+	}
+
+	doc := autoconfigDocument{Version: "1.1"}
+	doc.Provider.ID = domain.Name
+	doc.Provider.Domain = domain.Name
+	doc.Provider.DisplayName = domain.Name
+	doc.Provider.DisplayShortName = domain.Name
+	doc.Provider.Incoming = []autoconfigServer{server("imap", config.IMAP), server("pop3", config.POP3)}
+	doc.Provider.Outgoing = []autoconfigServer{server("smtp", config.SMTP)}
+
+	return marshalXML(doc)
+}
+
+// autodiscoverProtocol is a protocol entry in an Outlook autodiscover response
+type autodiscoverProtocol struct {
+	Type           string `xml:"Type"`
+	Server         string `xml:"Server"`
+	Port           int    `xml:"Port"`
+	DomainRequired string `xml:"DomainRequired"`
+	LoginName      string `xml:"LoginName"`
+	SPA            string `xml:"SPA"`
+	Encryption     string `xml:"Encryption"`
+	AuthRequired   string `xml:"AuthRequired"`
+}
+
+type autodiscoverDocument struct {
+	XMLName  xml.Name `xml:"http://schemas.microsoft.com/exchange/autodiscover/responseschema/2006 Autodiscover"`
+	Response struct {
+		XMLName xml.Name `xml:"http://schemas.microsoft.com/exchange/autodiscover/outlook/responseschema/2006a Response"`
+		Account struct {
+			AccountType string                 `xml:"AccountType"`
+			Action      string                 `xml:"Action"`
+			Protocols   []autodiscoverProtocol `xml:"Protocol"`
+		} `xml:"Account"`
+	}
+}
+
+// AutodiscoverRequest is the body Outlook posts to the autodiscover endpoint
+type AutodiscoverRequest struct {
+	XMLName xml.Name `xml:"Autodiscover"`
+	Request struct {
+		EMailAddress string `xml:"EMailAddress"`
+	} `xml:"Request"`
+}
+
+// AutodiscoverXML renders the Outlook autodiscover response for an address on a hosted domain
+func (s *EmailService) AutodiscoverXML(ctx context.Context, emailAddress string) ([]byte, error) {
+	at := strings.LastIndex(emailAddress, "@")
+	if at <= 0 || at == len(emailAddress)-1 {
+		return nil, fmt.Errorf("invalid email address: %s", emailAddress)
+	}
+
+	domain, err := s.hostedMailDomain(ctx, emailAddress[at+1:])
+	if err != nil {
+		return nil, err
+	}
+
+	config := s.clientConfig(domain.Name, emailAddress)
+	protocol := func(kind string, settings MailServerSettings) autodiscoverProtocol {
+		encryption := "SSL"
+		if settings.Security == MailSecurityStartTLS {
+			encryption = "TLS"
+		}
+		return autodiscoverProtocol{
+			Type:           kind,
+			Server:         settings.Hostname,
+			Port:           settings.Port,
+			DomainRequired: "off",
+			LoginName:      settings.Username,
+			SPA:            "off",
+			Encryption:     encryption,
+			AuthRequired:   "on",
+		}
+	}
+
+	var doc autodiscoverDocument
+	doc.Response.Account.AccountType = "email"
+	doc.Response.Account.Action = "settings"
+	doc.Response.Account.Protocols = []autodiscoverProtocol{
+		protocol("IMAP", config.IMAP),
+		protocol("POP3", config.POP3),
+		protocol("SMTP", config.SMTP),
+	}
+
+	return marshalXML(doc)
+}
+
+// hostedMailDomain looks up an active domain by name for the public discovery endpoints
+func (s *EmailService) hostedMailDomain(ctx context.Context, name string) (*models.Domain, error) {
+	var domain models.Domain
+	if err := s.db.WithContext(ctx).
+		Where("name = ? AND is_active = ?", strings.ToLower(name), true).
+		First(&domain).Error; err != nil {
+		return nil, apperrors.FromDB(err, "domain")
+	}
+
+	return &domain, nil
+}
+
+func marshalXML(doc interface{}) ([]byte, error) {
+	body, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode XML: %w", err)
+	}
+
+	return append([]byte(xml.Header), body...), nil
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// DefaultMail lists the mailboxes and aliases set up when a domain's email was first enabled
+type DefaultMail struct {
+	Mailboxes []*models.EmailAccount `json:"mailboxes"`
+	Aliases   []*models.EmailAlias   `json:"aliases"`
+	Skipped   []string               `json:"skipped,omitempty"` // Addresses that existed or did not fit the disk quota
+}
+
+// createDefaultMail sets up the configured default mailboxes and aliases of a domain the first
+// time its email is enabled. It returns nil when there is nothing to set up: email is off, the
+// defaults were set up before, or none are configured.
+func (s *DomainService) createDefaultMail(ctx context.Context, domain *models.Domain) (*DefaultMail, error) {
+	if !domain.EmailEnabled || domain.MailDefaultsAt != nil ||
+		len(s.config.DefaultMailboxes)+len(s.config.DefaultMailAliases) == 0 {
+		return nil, nil
+	}
+
+	var owner models.User
+	if err := s.db.WithContext(ctx).Select("id", "email").Where("id = ?", domain.UserID).First(&owner).Error; err != nil {
+		return nil, fmt.Errorf("failed to get domain owner: %w", err)
+	}
+
+	result := &DefaultMail{}
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Claim the domain first so concurrent enables set the defaults up only once
+		now := time.Now()
+		claim := tx.Model(&models.Domain{}).
+			Where("id = ? AND mail_defaults_at IS NULL", domain.ID).
+			Update("mail_defaults_at", now)
+		if claim.Error != nil {
+			return claim.Error
+		}
+		if claim.RowsAffected == 0 {
+			result = nil
+			return nil
+		}
+		domain.MailDefaultsAt = &now
+
+		var accounts []models.EmailAccount
+		if err := tx.Select("username", "quota_mb").Where("domain_id = ?", domain.ID).Find(&accounts).Error; err != nil {
+			return err
+		}
+		var aliases []string
+		if err := tx.Model(&models.EmailAlias{}).Where("domain_id = ?", domain.ID).Pluck("alias", &aliases).Error; err != nil {
+			return err
+		}
+
+		// Aliases may be stored as local parts or as full addresses
+		taken := make(map[string]bool)
+		allocatedMB := int64(0)
+		for _, account := range accounts {
+			taken[account.Username] = true
+			allocatedMB += int64(account.QuotaMB)
+		}
+		for _, alias := range aliases {
+			taken[alias] = true
+		}
+		exists := func(name string) bool {
+			return taken[name] || taken[name+"@"+domain.Name]
+		}
+
+		for _, name := range s.config.DefaultMailboxes {
+			quotaMB := int64(s.config.DefaultMailboxQuotaMB)
+			if exists(name) || (domain.DiskQuota > 0 && (allocatedMB+quotaMB)<<20 > domain.DiskQuota) {
+				result.Skipped = append(result.Skipped, name+"@"+domain.Name)
+				continue
+			}
+
+			account := &models.EmailAccount{
+				DomainID: domain.ID,
+				Username: name,
+				QuotaMB:  s.config.DefaultMailboxQuotaMB,
+				IsActive: true,
+			}
+			if err := tx.Create(account).Error; err != nil {
+				return err
+			}
+			taken[name] = true
+			allocatedMB += quotaMB
+			result.Mailboxes = append(result.Mailboxes, account)
+		}
+
+		for _, name := range s.config.DefaultMailAliases {
+			if exists(name) {
+				result.Skipped = append(result.Skipped, name+"@"+domain.Name)
+				continue
+			}
+
+			alias := &models.EmailAlias{
+				DomainID:    domain.ID,
+				Alias:       name,
+				Destination: owner.Email,
+				IsActive:    true,
+			}
+			if err := tx.Create(alias).Error; err != nil {
+				return err
+			}
+			taken[name] = true
+			result.Aliases = append(result.Aliases, alias)
+		}
+		return nil
+	})
+	if err != nil {
+		domain.MailDefaultsAt = nil
+		return nil, fmt.Errorf("failed to create default mail addresses: %w", err)
+	}
+	if result == nil {
+		return nil, nil
+	}
+	s.invalidateDomain(ctx, domain.ID)
+
+	s.logger.Info("Default mail addresses created",
+		zap.String("domain", domain.Name),
+		zap.Int("mailboxes", len(result.Mailboxes)),
+		zap.Int("aliases", len(result.Aliases)),
+		zap.Strings("skipped", result.Skipped))
+
+	return result, nil
+}
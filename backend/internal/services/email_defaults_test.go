@@ -0,0 +1,150 @@
+package services
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestSetFeaturesCreatesDefaultMail(t *testing.T) {
+	enable, disable := true, false
+
+	tests := []struct {
+		name          string
+		diskQuota     int64
+		existing      []interface{} // Created before email is first enabled
+		wantMailboxes []string
+		wantAliases   []string
+		wantSkipped   []string
+	}{
+		{
+			name:          "all created",
+			wantMailboxes: []string{"abuse", "postmaster"},
+			wantAliases:   []string{"hostmaster"},
+		},
+		{
+			name: "existing addresses kept",
+			existing: []interface{}{
+				&models.EmailAccount{Username: "postmaster", QuotaMB: 10, IsActive: true},
+				&models.EmailAlias{Alias: "hostmaster@defaults.example", Destination: "someone@example.net", IsActive: true},
+			},
+			wantMailboxes: []string{"abuse"},
+			wantSkipped:   []string{"hostmaster@defaults.example", "postmaster@defaults.example"},
+		},
+		{
+			name:          "alias taking a mailbox name",
+			existing:      []interface{}{&models.EmailAlias{Alias: "abuse", Destination: "someone@example.net", IsActive: true}},
+			wantMailboxes: []string{"postmaster"},
+			wantAliases:   []string{"hostmaster"},
+			wantSkipped:   []string{"abuse@defaults.example"},
+		},
+		{
+			name:          "disk quota full",
+			diskQuota:     150 << 20,
+			existing:      []interface{}{&models.EmailAccount{Username: "info", QuotaMB: 60, IsActive: true}},
+			wantMailboxes: []string{"postmaster"},
+			wantAliases:   []string{"hostmaster"},
+			wantSkipped:   []string{"abuse@defaults.example"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			cfg := testHostingConfig(t)
+			cfg.DefaultMailboxes = []string{"postmaster", "abuse"}
+			cfg.DefaultMailAliases = []string{"hostmaster"}
+			cfg.DefaultMailboxQuotaMB = 50
+			domains, _ := newTestDomainService(t, db, cfg)
+			owner := createTestUser(t, db)
+			domain := createTestDomain(t, db, owner, "defaults.example")
+			db.Model(domain).Updates(map[string]interface{}{"email_enabled": false, "disk_quota": tt.diskQuota})
+			for _, value := range tt.existing {
+				switch v := value.(type) {
+				case *models.EmailAccount:
+					v.DomainID = domain.ID
+				case *models.EmailAlias:
+					v.DomainID = domain.ID
+				}
+				mustCreate(t, db, value)
+			}
+			ctx := asUser(owner.ID, "admin")
+
+			updated, defaults, err := domains.SetFeatures(ctx, domain.ID, DomainFeatures{Email: &enable})
+			if err != nil {
+				t.Fatalf("SetFeatures() error = %v", err)
+			}
+			if defaults == nil || updated.MailDefaultsAt == nil {
+				t.Fatalf("no defaults created: %+v", defaults)
+			}
+
+			var mailboxes, aliases []string
+			for _, account := range defaults.Mailboxes {
+				mailboxes = append(mailboxes, account.Username)
+				if account.QuotaMB != 50 || !account.IsActive {
+					t.Errorf("mailbox %s = %d MB, active %v", account.Username, account.QuotaMB, account.IsActive)
+				}
+			}
+			for _, alias := range defaults.Aliases {
+				aliases = append(aliases, alias.Alias)
+				if alias.Destination != owner.Email {
+					t.Errorf("alias %s forwards to %s, want the owner's %s", alias.Alias, alias.Destination, owner.Email)
+				}
+			}
+			sort.Strings(mailboxes)
+			sort.Strings(defaults.Skipped)
+			if !equalStrings(mailboxes, tt.wantMailboxes) || !equalStrings(aliases, tt.wantAliases) || !equalStrings(defaults.Skipped, tt.wantSkipped) {
+				t.Errorf("created mailboxes %v, aliases %v, skipped %v; want %v, %v, %v",
+					mailboxes, aliases, defaults.Skipped, tt.wantMailboxes, tt.wantAliases, tt.wantSkipped)
+			}
+
+			var postmasters int64
+			db.Model(&models.EmailAccount{}).Where("domain_id = ? AND username = ?", domain.ID, "postmaster").Count(&postmasters)
+			if postmasters != 1 {
+				t.Errorf("%d postmaster mailboxes, want 1", postmasters)
+			}
+
+			// Enabling email again does not set the defaults up again
+			if _, _, err := domains.SetFeatures(ctx, domain.ID, DomainFeatures{Email: &disable}); err != nil {
+				t.Fatalf("disable email: %v", err)
+			}
+			if _, defaults, err := domains.SetFeatures(ctx, domain.ID, DomainFeatures{Email: &enable}); err != nil || defaults != nil {
+				t.Errorf("second enable: defaults %+v, error %v", defaults, err)
+			}
+		})
+	}
+}
+
+func TestCreateDomainCreatesDefaultMail(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	cfg.DefaultMailboxes = []string{"postmaster"}
+	cfg.DefaultMailboxQuotaMB = 100
+	domains, _ := newTestDomainService(t, db, cfg)
+	owner := createTestUser(t, db)
+
+	domain, err := domains.CreateDomain(asUser(owner.ID), owner.ID, "new.example", nil)
+	if err != nil {
+		t.Fatalf("CreateDomain() error = %v", err)
+	}
+	if len(domain.EmailAccounts) != 1 || domain.EmailAccounts[0].Username != "postmaster" {
+		t.Errorf("mailboxes of the new domain = %+v", domain.EmailAccounts)
+	}
+	var stored models.Domain
+	db.First(&stored, "id = ?", domain.ID)
+	if stored.MailDefaultsAt == nil {
+		t.Error("defaults not recorded as set up")
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
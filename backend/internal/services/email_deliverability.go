@@ -0,0 +1,445 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/mailer"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// deliverabilityTestWindow is the window DeliverabilityTestLimit applies to
+const deliverabilityTestWindow = time.Hour
+
+// Outcomes of a deliverability check
+const (
+	CheckPass    = "pass"
+	CheckWarn    = "warn" // Mail gets through, but less reliably than it could
+	CheckFail    = "fail"
+	CheckSkipped = "skipped" // Not run, and not counted in the score
+)
+
+// MailResolver looks up the DNS records deliverability depends on; satisfied by *net.Resolver
+type MailResolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// DeliverabilityReport is the result of testing whether a domain can send and receive mail
+type DeliverabilityReport struct {
+	Domain   string                 `json:"domain"`
+	Score    int                    `json:"score"` // 0 to 100, from the checks that ran
+	Checks   []*DeliverabilityCheck `json:"checks"`
+	TestedAt time.Time              `json:"tested_at"`
+}
+
+// DeliverabilityCheck is the outcome of one check of a deliverability test
+type DeliverabilityCheck struct {
+	Name        string `json:"name"` // mx, spf, dkim, dmarc, dnsbl or test_message
+	Status      string `json:"status"`
+	Detail      string `json:"detail"`
+	Remediation string `json:"remediation,omitempty"` // What to change when the check did not pass
+	weight      int
+}
+
+// DeliverabilityTest checks that a domain can send and receive mail: its MX, SPF, DKIM and DMARC
+// records, and that the server's address is on none of the configured DNS blocklists. With a
+// verification mailbox configured, a test message is sent there from the domain's postmaster.
+// The report scores the checks and says how to fix those that did not pass.
+func (s *EmailService) DeliverabilityTest(ctx context.Context, domainID uuid.UUID) (*DeliverabilityReport, error) {
+	var domain models.Domain
+	if err := s.db.WithContext(ctx).Preload("Node").Where("id = ?", domainID).First(&domain).Error; err != nil {
+		return nil, apperrors.FromDB(err, "domain")
+	}
+
+	if err := authorizeDomain(ctx, &domain); err != nil {
+		return nil, err
+	}
+
+	// Each test makes a few dozen DNS queries and may send mail
+	key := fmt.Sprintf("deliverability_test:%s", domainID)
+	tests, err := s.redis.Incr(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check deliverability test rate limit: %w", err)
+	}
+	if tests == 1 {
+		s.redis.Expire(ctx, key, deliverabilityTestWindow)
+	}
+	if tests > int64(s.config.DeliverabilityTestLimit) {
+		return nil, apperrors.PreconditionCode("deliverability_test_limit", map[string]string{"limit": strconv.Itoa(s.config.DeliverabilityTestLimit)})
+	}
+
+	ipv4, ipv6 := s.domains.serverIPs(&domain)
+	checks := []*DeliverabilityCheck{
+		s.checkMX(ctx, domain.Name, ipv4, ipv6),
+		s.checkSPF(ctx, domain.Name, ipv4, ipv6),
+		s.checkDKIM(ctx, domain.Name),
+		s.checkDMARC(ctx, domain.Name),
+		s.checkDNSBLs(ctx, ipv4),
+		s.sendTestMessage(ctx, domain.Name),
+	}
+	report := &DeliverabilityReport{
+		Domain:   domain.Name,
+		Score:    deliverabilityScore(checks),
+		Checks:   checks,
+		TestedAt: time.Now(),
+	}
+
+	s.logger.Info("Mail deliverability tested", zap.String("domain", domain.Name), zap.Int("score", report.Score))
+
+	return report, nil
+}
+
+// deliverabilityScore returns the share of the weight of the checks that ran that passed, as a
+// percentage; warnings earn half their weight
+func deliverabilityScore(checks []*DeliverabilityCheck) int {
+	total, earned := 0, 0
+	for _, check := range checks {
+		switch check.Status {
+		case CheckPass:
+			earned += 2 * check.weight
+		case CheckWarn:
+			earned += check.weight
+		case CheckSkipped:
+			continue
+		}
+		total += 2 * check.weight
+	}
+	if total == 0 {
+		return 0
+	}
+	return int(math.Round(100 * float64(earned) / float64(total)))
+}
+
+// checkMX checks that the domain has MX records and that one of them points at the server
+func (s *EmailService) checkMX(ctx context.Context, name, ipv4, ipv6 string) *DeliverabilityCheck {
+	check := &DeliverabilityCheck{Name: "mx", weight: 25}
+	suggested := fmt.Sprintf("Publish an MX record for %s pointing at %s, with an A record of %s", name, s.mailHostname(name), ipv4)
+
+	records, err := s.resolver.LookupMX(ctx, name)
+	if err != nil && !dnsNotFound(err) {
+		check.Status, check.Detail = CheckWarn, fmt.Sprintf("MX records could not be looked up: %v", err)
+		return check
+	}
+	if len(records) == 0 {
+		check.Status, check.Detail, check.Remediation = CheckFail, "No MX records: mail to the domain cannot be delivered", suggested
+		return check
+	}
+
+	hosts := make([]string, len(records))
+	for i, record := range records {
+		hosts[i] = strings.TrimSuffix(record.Host, ".")
+	}
+	if ipv4 == "" && ipv6 == "" {
+		check.Status, check.Detail = CheckPass, "MX records: "+strings.Join(hosts, ", ")
+		return check
+	}
+	for _, host := range hosts {
+		addresses, err := s.resolver.LookupHost(ctx, host)
+		if err != nil {
+			continue
+		}
+		for _, address := range addresses {
+			if sameIP(address, ipv4) || sameIP(address, ipv6) {
+				check.Status, check.Detail = CheckPass, fmt.Sprintf("%s receives the domain's mail on this server", host)
+				return check
+			}
+		}
+	}
+
+	check.Status = CheckWarn
+	check.Detail = fmt.Sprintf("No MX host (%s) points at this server; mail for the domain goes elsewhere", strings.Join(hosts, ", "))
+	check.Remediation = "If the domain's mail should be hosted here: " + suggested
+	return check
+}
+
+// checkSPF checks that the domain publishes one SPF record that lets the server send its mail
+func (s *EmailService) checkSPF(ctx context.Context, name, ipv4, ipv6 string) *DeliverabilityCheck {
+	check := &DeliverabilityCheck{Name: "spf", weight: 20}
+	suggested := fmt.Sprintf("Publish a TXT record for %s of %q", name, suggestedSPF(ipv4, ipv6))
+
+	records, err := s.lookupTXT(ctx, name, "v=spf1")
+	if err != nil {
+		check.Status, check.Detail = CheckWarn, fmt.Sprintf("SPF record could not be looked up: %v", err)
+		return check
+	}
+	switch {
+	case len(records) == 0:
+		check.Status, check.Detail, check.Remediation = CheckFail, "No SPF record: receivers cannot tell which servers may send the domain's mail", suggested
+		return check
+	case len(records) > 1:
+		check.Status, check.Detail, check.Remediation = CheckFail, "More than one SPF record, which makes SPF fail everywhere", "Merge the SPF records into one: "+suggested
+		return check
+	}
+
+	record := records[0]
+	terms := strings.Fields(strings.ToLower(record))
+	last := terms[len(terms)-1]
+	switch {
+	case last == "+all" || last == "all":
+		check.Status, check.Detail, check.Remediation = CheckFail, "The SPF record ("+record+") lets any server send as the domain", "End the SPF record with ~all or -all"
+		return check
+	case last == "?all" || !strings.HasSuffix(last, "all") && !strings.HasPrefix(last, "redirect="):
+		check.Status, check.Detail, check.Remediation = CheckWarn, "The SPF record ("+record+") does not tell receivers to reject other servers", "End the SPF record with ~all or -all"
+		return check
+	}
+
+	if !spfCoversServer(terms, ipv4, ipv6) {
+		check.Status = CheckWarn
+		check.Detail = "The SPF record (" + record + ") does not list this server by address or through its a or mx mechanisms; unless an include covers it, its mail fails SPF"
+		check.Remediation = suggested
+		return check
+	}
+
+	check.Status, check.Detail = CheckPass, "SPF record: "+record
+	return check
+}
+
+// spfCoversServer reports whether the terms of an SPF record can match the server: by its
+// address, through the domain's A or MX records, or through an include or redirect that is not
+// followed here
+func spfCoversServer(terms []string, ipv4, ipv6 string) bool {
+	for _, term := range terms {
+		term = strings.TrimLeft(term, "+")
+		switch {
+		case term == "a", term == "mx", strings.HasPrefix(term, "a:"), strings.HasPrefix(term, "mx:"),
+			strings.HasPrefix(term, "include:"), strings.HasPrefix(term, "redirect="):
+			return true
+		case ipv4 != "" && strings.HasPrefix(term, "ip4:") && spfNetworkContains(strings.TrimPrefix(term, "ip4:"), ipv4):
+			return true
+		case ipv6 != "" && strings.HasPrefix(term, "ip6:") && spfNetworkContains(strings.TrimPrefix(term, "ip6:"), ipv6):
+			return true
+		}
+	}
+	return false
+}
+
+// spfNetworkContains reports whether an ip4 or ip6 value of an SPF record, an address or a CIDR
+// range, contains address
+func spfNetworkContains(value, address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	if !strings.Contains(value, "/") {
+		return ip.Equal(net.ParseIP(value))
+	}
+	_, network, err := net.ParseCIDR(value)
+	return err == nil && network.Contains(ip)
+}
+
+// suggestedSPF returns an SPF record letting the domain's MX hosts and the server send its mail
+func suggestedSPF(ipv4, ipv6 string) string {
+	record := "v=spf1 mx a"
+	if ipv4 != "" {
+		record += " ip4:" + ipv4
+	}
+	if ipv6 != "" {
+		record += " ip6:" + ipv6
+	}
+	return record + " ~all"
+}
+
+// checkDKIM checks that the domain publishes a DKIM key under one of the configured selectors
+func (s *EmailService) checkDKIM(ctx context.Context, name string) *DeliverabilityCheck {
+	check := &DeliverabilityCheck{Name: "dkim", weight: 20}
+	if len(s.config.DKIMSelectors) == 0 {
+		check.Status, check.Detail = CheckSkipped, "No DKIM selectors are configured"
+		return check
+	}
+
+	var revoked []string
+	for _, selector := range s.config.DKIMSelectors {
+		records, err := s.resolver.LookupTXT(ctx, selector+"._domainkey."+name)
+		if err != nil {
+			continue
+		}
+		tags := dkimTags(strings.Join(records, ""))
+		if _, isKey := tags["p"]; !isKey {
+			continue
+		}
+		if tags["p"] == "" {
+			revoked = append(revoked, selector)
+			continue
+		}
+		check.Status, check.Detail = CheckPass, fmt.Sprintf("DKIM key published under selector %q", selector)
+		return check
+	}
+
+	if len(revoked) > 0 {
+		check.Status = CheckFail
+		check.Detail = fmt.Sprintf("The DKIM key of selector %q is revoked (empty p=)", revoked[0])
+	} else {
+		check.Status = CheckFail
+		check.Detail = fmt.Sprintf("No DKIM key found under the selectors %s", strings.Join(s.config.DKIMSelectors, ", "))
+	}
+	check.Remediation = fmt.Sprintf("Sign outgoing mail with DKIM and publish the public key as a TXT record at <selector>._domainkey.%s", name)
+	return check
+}
+
+// dkimTags parses the tag=value list of a DKIM key record
+func dkimTags(record string) map[string]string {
+	tags := make(map[string]string)
+	for _, part := range strings.Split(record, ";") {
+		tag, value, ok := strings.Cut(part, "=")
+		if !ok {
+			continue
+		}
+		// Values such as the base64 key may be split by whitespace
+		tags[strings.TrimSpace(tag)] = strings.Join(strings.Fields(value), "")
+	}
+	return tags
+}
+
+// checkDMARC checks that the domain publishes a DMARC policy that acts on failing mail
+func (s *EmailService) checkDMARC(ctx context.Context, name string) *DeliverabilityCheck {
+	check := &DeliverabilityCheck{Name: "dmarc", weight: 15}
+	suggested := fmt.Sprintf("Publish a TXT record for _dmarc.%s of \"v=DMARC1; p=quarantine; rua=mailto:postmaster@%s\"", name, name)
+
+	records, err := s.lookupTXT(ctx, "_dmarc."+name, "v=dmarc1")
+	if err != nil {
+		check.Status, check.Detail = CheckWarn, fmt.Sprintf("DMARC record could not be looked up: %v", err)
+		return check
+	}
+	if len(records) != 1 {
+		check.Status, check.Remediation = CheckFail, suggested
+		check.Detail = "No DMARC record: receivers get no policy for mail failing SPF and DKIM"
+		if len(records) > 1 {
+			check.Detail = "More than one DMARC record, so receivers ignore them"
+		}
+		return check
+	}
+
+	record := records[0]
+	switch policy := strings.ToLower(dkimTags(record)["p"]); policy {
+	case "quarantine", "reject":
+		check.Status, check.Detail = CheckPass, "DMARC record: "+record
+	case "none":
+		check.Status, check.Detail = CheckWarn, "The DMARC policy ("+record+") only monitors; failing mail is still delivered"
+		check.Remediation = "Once the DMARC reports show legitimate mail passing, raise the policy to p=quarantine or p=reject"
+	default:
+		check.Status, check.Detail, check.Remediation = CheckFail, "The DMARC record ("+record+") has no valid policy", suggested
+	}
+	return check
+}
+
+// checkDNSBLs checks that the server's IPv4 address is on none of the configured DNS blocklists.
+// Lists that cannot be queried are left out rather than failing the check.
+func (s *EmailService) checkDNSBLs(ctx context.Context, ipv4 string) *DeliverabilityCheck {
+	check := &DeliverabilityCheck{Name: "dnsbl", weight: 20}
+	ip := net.ParseIP(ipv4).To4()
+	if ip == nil || len(s.config.DNSBLs) == 0 {
+		check.Status, check.Detail = CheckSkipped, "No server IPv4 address or no DNS blocklists are configured"
+		return check
+	}
+
+	reversed := fmt.Sprintf("%d.%d.%d.%d", ip[3], ip[2], ip[1], ip[0])
+	var listed, checked []string
+	for _, zone := range s.config.DNSBLs {
+		addresses, err := s.resolver.LookupHost(ctx, reversed+"."+zone)
+		if err != nil {
+			if dnsNotFound(err) {
+				checked = append(checked, zone)
+			}
+			continue
+		}
+		// Blocklists answer 127.0.0.x for listed addresses. Other answers, such as the 127.255.255.x
+		// of a refused query, are error responses that leave the list unchecked.
+		for _, address := range addresses {
+			if strings.HasPrefix(address, "127.0.0.") {
+				listed = append(listed, zone)
+				checked = append(checked, zone)
+				break
+			}
+		}
+	}
+
+	switch {
+	case len(listed) > 0:
+		check.Status = CheckFail
+		check.Detail = fmt.Sprintf("%s is listed on %s; receivers using these lists reject or junk its mail", ipv4, strings.Join(listed, ", "))
+		check.Remediation = "Find and stop what sent spam from the server, such as a compromised mailbox or script, then request delisting from each blocklist"
+	case len(checked) == 0:
+		check.Status, check.Detail = CheckSkipped, "None of the DNS blocklists could be queried"
+	default:
+		check.Status, check.Detail = CheckPass, fmt.Sprintf("%s is not listed on %s", ipv4, strings.Join(checked, ", "))
+	}
+	return check
+}
+
+// sendTestMessage sends a test message from the domain's postmaster to the verification mailbox
+func (s *EmailService) sendTestMessage(ctx context.Context, name string) *DeliverabilityCheck {
+	check := &DeliverabilityCheck{Name: "test_message", weight: 10}
+	if s.config.DeliverabilityMailbox == "" {
+		check.Status, check.Detail = CheckSkipped, "No verification mailbox is configured"
+		return check
+	}
+
+	now := time.Now().UTC()
+	msg := mailer.Message{
+		From:    "postmaster@" + name,
+		To:      s.config.DeliverabilityMailbox,
+		Subject: "Deliverability test for " + name,
+		Body:    fmt.Sprintf("This message tests that %s can send mail. It was sent on %s and needs no reply.\n", name, now.Format(time.RFC1123Z)),
+	}
+	if err := s.testSender.Send(ctx, msg); err != nil {
+		check.Status = CheckFail
+		check.Detail = fmt.Sprintf("The test message from %s was not accepted: %v", msg.From, err)
+		check.Remediation = "Check the mail server's log for why it refused the message"
+		return check
+	}
+
+	check.Status, check.Detail = CheckPass, fmt.Sprintf("Test message sent from %s to the verification mailbox", msg.From)
+	return check
+}
+
+// lookupTXT returns the TXT records of name starting with prefix, compared case-insensitively. A
+// name without records is not an error.
+func (s *EmailService) lookupTXT(ctx context.Context, name, prefix string) ([]string, error) {
+	records, err := s.resolver.LookupTXT(ctx, name)
+	if err != nil {
+		if dnsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var matching []string
+	for _, record := range records {
+		if lower := strings.ToLower(record); lower == prefix || strings.HasPrefix(lower, prefix+" ") || strings.HasPrefix(lower, prefix+";") {
+			matching = append(matching, record)
+		}
+	}
+	return matching, nil
+}
+
+// mailHostname returns the host name mail clients and MX records should use for a domain
+func (s *EmailService) mailHostname(name string) string {
+	if s.config.ClientHostname != "" {
+		return s.config.ClientHostname
+	}
+	return "mail." + name
+}
+
+// dnsNotFound reports whether a lookup failed because the name or record does not exist
+func dnsNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+// sameIP reports whether two textual addresses are the same IP
+func sameIP(a, b string) bool {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	return ipA != nil && ipA.Equal(ipB)
+}
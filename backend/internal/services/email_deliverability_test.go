@@ -0,0 +1,303 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/mailer"
+)
+
+// mailDNS answers the lookups of deliverability tests from its records; other names do not exist
+type mailDNS struct {
+	mx    map[string][]*net.MX
+	txt   map[string][]string
+	hosts map[string][]string
+	fail  map[string]bool // Names whose lookups time out
+}
+
+func (d mailDNS) lookup(name string) error {
+	if d.fail[name] {
+		return &net.DNSError{Err: "i/o timeout", Name: name, IsTimeout: true}
+	}
+	return &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func (d mailDNS) LookupMX(_ context.Context, name string) ([]*net.MX, error) {
+	if records, ok := d.mx[name]; ok {
+		return records, nil
+	}
+	return nil, d.lookup(name)
+}
+
+func (d mailDNS) LookupTXT(_ context.Context, name string) ([]string, error) {
+	if records, ok := d.txt[name]; ok {
+		return records, nil
+	}
+	return nil, d.lookup(name)
+}
+
+func (d mailDNS) LookupHost(_ context.Context, host string) ([]string, error) {
+	if addresses, ok := d.hosts[host]; ok {
+		return addresses, nil
+	}
+	return nil, d.lookup(host)
+}
+
+// recordingSender records the messages it sends, failing with err when set
+type recordingSender struct {
+	sent []mailer.Message
+	err  error
+}
+
+func (s *recordingSender) Send(_ context.Context, msg mailer.Message) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.sent = append(s.sent, msg)
+	return nil
+}
+
+// newDeliverabilityService creates an email service resolving through dns
+func newDeliverabilityService(dns mailDNS, cfg config.MailConfig) *EmailService {
+	return &EmailService{logger: zap.NewNop(), config: cfg, resolver: dns}
+}
+
+func TestCheckMX(t *testing.T) {
+	tests := []struct {
+		name   string
+		dns    mailDNS
+		ipv4   string
+		status string
+	}{
+		{"points here", mailDNS{mx: map[string][]*net.MX{"shop.example": {{Host: "mx.shop.example.", Pref: 10}}}, hosts: map[string][]string{"mx.shop.example": {"192.0.2.10"}}}, "192.0.2.10", CheckPass},
+		{"points elsewhere", mailDNS{mx: map[string][]*net.MX{"shop.example": {{Host: "aspmx.l.google.com.", Pref: 1}}}, hosts: map[string][]string{"aspmx.l.google.com": {"203.0.113.5"}}}, "192.0.2.10", CheckWarn},
+		{"no server address", mailDNS{mx: map[string][]*net.MX{"shop.example": {{Host: "mx.shop.example.", Pref: 10}}}}, "", CheckPass},
+		{"missing", mailDNS{}, "192.0.2.10", CheckFail},
+		{"lookup failed", mailDNS{fail: map[string]bool{"shop.example": true}}, "192.0.2.10", CheckWarn},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := newDeliverabilityService(tt.dns, config.MailConfig{}).checkMX(context.Background(), "shop.example", tt.ipv4, "")
+			if check.Status != tt.status {
+				t.Errorf("status = %s, want %s: %s", check.Status, tt.status, check.Detail)
+			}
+			if check.Status == CheckFail && check.Remediation == "" {
+				t.Error("no remediation for a failed check")
+			}
+		})
+	}
+}
+
+func TestCheckSPF(t *testing.T) {
+	tests := []struct {
+		name    string
+		records []string
+		status  string
+	}{
+		{"server by address", []string{"v=spf1 ip4:192.0.2.10 -all"}, CheckPass},
+		{"server in a range", []string{"v=spf1 ip4:192.0.2.0/24 ~all"}, CheckPass},
+		{"mx mechanism", []string{"v=spf1 mx ~all"}, CheckPass},
+		{"include", []string{"v=spf1 include:_spf.example.net -all"}, CheckPass},
+		{"redirect", []string{"v=spf1 redirect=_spf.example.net"}, CheckPass},
+		{"other records ignored", []string{"google-site-verification=abc", "v=spf1 a -all"}, CheckPass},
+		{"other server only", []string{"v=spf1 ip4:203.0.113.5 -all"}, CheckWarn},
+		{"neutral", []string{"v=spf1 a ?all"}, CheckWarn},
+		{"no all", []string{"v=spf1 a"}, CheckWarn},
+		{"anyone may send", []string{"v=spf1 +all"}, CheckFail},
+		{"two records", []string{"v=spf1 a -all", "v=spf1 mx -all"}, CheckFail},
+		{"missing", nil, CheckFail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dns := mailDNS{txt: map[string][]string{}}
+			if tt.records != nil {
+				dns.txt["shop.example"] = tt.records
+			}
+			check := newDeliverabilityService(dns, config.MailConfig{}).checkSPF(context.Background(), "shop.example", "192.0.2.10", "")
+			if check.Status != tt.status {
+				t.Errorf("status = %s, want %s: %s", check.Status, tt.status, check.Detail)
+			}
+			if check.Status != CheckPass && check.Remediation == "" {
+				t.Error("no remediation for a check that did not pass")
+			}
+		})
+	}
+}
+
+func TestCheckDKIM(t *testing.T) {
+	tests := []struct {
+		name   string
+		txt    map[string][]string
+		status string
+	}{
+		{"key under a later selector", map[string][]string{"mail._domainkey.shop.example": {"v=DKIM1; k=rsa; p=MIIBIjAN", "BgkqhkiG9w0B"}}, CheckPass},
+		{"revoked key", map[string][]string{"default._domainkey.shop.example": {"v=DKIM1; p="}}, CheckFail},
+		{"not a key", map[string][]string{"default._domainkey.shop.example": {"v=spf1 -all"}}, CheckFail},
+		{"missing", nil, CheckFail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newDeliverabilityService(mailDNS{txt: tt.txt}, config.MailConfig{DKIMSelectors: []string{"default", "mail"}})
+			if check := s.checkDKIM(context.Background(), "shop.example"); check.Status != tt.status {
+				t.Errorf("status = %s, want %s: %s", check.Status, tt.status, check.Detail)
+			}
+		})
+	}
+
+	if check := newDeliverabilityService(mailDNS{}, config.MailConfig{}).checkDKIM(context.Background(), "shop.example"); check.Status != CheckSkipped {
+		t.Errorf("status without selectors = %s, want skipped", check.Status)
+	}
+}
+
+func TestCheckDMARC(t *testing.T) {
+	tests := []struct {
+		name    string
+		records []string
+		status  string
+	}{
+		{"reject", []string{"v=DMARC1; p=reject; rua=mailto:dmarc@shop.example"}, CheckPass},
+		{"quarantine", []string{"v=DMARC1;p=Quarantine"}, CheckPass},
+		{"monitoring only", []string{"v=DMARC1; p=none"}, CheckWarn},
+		{"no policy", []string{"v=DMARC1; rua=mailto:dmarc@shop.example"}, CheckFail},
+		{"two records", []string{"v=DMARC1; p=reject", "v=DMARC1; p=none"}, CheckFail},
+		{"missing", nil, CheckFail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dns := mailDNS{txt: map[string][]string{}}
+			if tt.records != nil {
+				dns.txt["_dmarc.shop.example"] = tt.records
+			}
+			if check := newDeliverabilityService(dns, config.MailConfig{}).checkDMARC(context.Background(), "shop.example"); check.Status != tt.status {
+				t.Errorf("status = %s, want %s: %s", check.Status, tt.status, check.Detail)
+			}
+		})
+	}
+}
+
+func TestCheckDNSBLs(t *testing.T) {
+	lists := []string{"zen.spamhaus.org", "bl.spamcop.net"}
+	tests := []struct {
+		name   string
+		dns    mailDNS
+		status string
+		detail string
+	}{
+		{"not listed", mailDNS{}, CheckPass, "192.0.2.10 is not listed on zen.spamhaus.org, bl.spamcop.net"},
+		{"listed", mailDNS{hosts: map[string][]string{"10.2.0.192.bl.spamcop.net": {"127.0.0.2"}}}, CheckFail, "192.0.2.10 is listed on bl.spamcop.net; receivers using these lists reject or junk its mail"},
+		{"one list unreachable", mailDNS{fail: map[string]bool{"10.2.0.192.zen.spamhaus.org": true}}, CheckPass, "192.0.2.10 is not listed on bl.spamcop.net"},
+		// Spamhaus refuses queries through public resolvers with an error answer, which is no result
+		{"query refused", mailDNS{hosts: map[string][]string{"10.2.0.192.zen.spamhaus.org": {"127.255.255.254"}}}, CheckPass, "192.0.2.10 is not listed on bl.spamcop.net"},
+		{"no list answered", mailDNS{fail: map[string]bool{"10.2.0.192.zen.spamhaus.org": true, "10.2.0.192.bl.spamcop.net": true}}, CheckSkipped, "None of the DNS blocklists could be queried"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := newDeliverabilityService(tt.dns, config.MailConfig{DNSBLs: lists}).checkDNSBLs(context.Background(), "192.0.2.10")
+			if check.Status != tt.status || check.Detail != tt.detail {
+				t.Errorf("check = %s: %s, want %s: %s", check.Status, check.Detail, tt.status, tt.detail)
+			}
+		})
+	}
+
+	if check := newDeliverabilityService(mailDNS{}, config.MailConfig{DNSBLs: lists}).checkDNSBLs(context.Background(), ""); check.Status != CheckSkipped {
+		t.Errorf("status without an IPv4 address = %s, want skipped", check.Status)
+	}
+}
+
+func TestDeliverabilityScore(t *testing.T) {
+	check := func(status string, weight int) *DeliverabilityCheck {
+		return &DeliverabilityCheck{Status: status, weight: weight}
+	}
+	tests := []struct {
+		name   string
+		checks []*DeliverabilityCheck
+		want   int
+	}{
+		{"all pass", []*DeliverabilityCheck{check(CheckPass, 25), check(CheckPass, 20)}, 100},
+		{"all fail", []*DeliverabilityCheck{check(CheckFail, 25), check(CheckFail, 20)}, 0},
+		{"warnings earn half", []*DeliverabilityCheck{check(CheckWarn, 25), check(CheckWarn, 25)}, 50},
+		{"weighted", []*DeliverabilityCheck{check(CheckPass, 25), check(CheckFail, 75)}, 25},
+		{"skipped not counted", []*DeliverabilityCheck{check(CheckPass, 25), check(CheckSkipped, 75)}, 100},
+		{"nothing ran", []*DeliverabilityCheck{check(CheckSkipped, 25)}, 0},
+	}
+	for _, tt := range tests {
+		if got := deliverabilityScore(tt.checks); got != tt.want {
+			t.Errorf("%s: score = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDeliverabilityTest(t *testing.T) {
+	db := newTestDB(t)
+	client, _ := newTestRedis(t)
+	domains, _ := newTestDomainService(t, db, testHostingConfig(t))
+	email := NewEmailService(db, client, zap.NewNop(), config.MailConfig{
+		DKIMSelectors:           []string{"default"},
+		DNSBLs:                  []string{"bl.spamcop.net"},
+		DeliverabilityMailbox:   "verify@panel.example",
+		DeliverabilityTestLimit: 2,
+	}, nil, domains)
+	email.resolver = mailDNS{
+		mx:    map[string][]*net.MX{"shop.example": {{Host: "mail.shop.example.", Pref: 10}}},
+		hosts: map[string][]string{"mail.shop.example": {"192.0.2.10"}},
+		txt: map[string][]string{
+			"shop.example":                    {"v=spf1 mx -all"},
+			"default._domainkey.shop.example": {"v=DKIM1; p=MIIBIjAN"},
+			"_dmarc.shop.example":             {"v=DMARC1; p=none"},
+		},
+	}
+	sender := &recordingSender{}
+	email.testSender = sender
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "shop.example")
+
+	if _, err := email.DeliverabilityTest(asUser(uuid.New()), domain.ID); !apperrors.IsPermissionDenied(err) {
+		t.Fatalf("test by another user error = %v, want permission denied", err)
+	}
+
+	report, err := email.DeliverabilityTest(asUser(owner.ID), domain.ID)
+	if err != nil {
+		t.Fatalf("DeliverabilityTest() error = %v", err)
+	}
+	statuses := map[string]string{}
+	for _, check := range report.Checks {
+		statuses[check.Name] = check.Status
+	}
+	want := map[string]string{"mx": CheckPass, "spf": CheckPass, "dkim": CheckPass, "dmarc": CheckWarn, "dnsbl": CheckPass, "test_message": CheckPass}
+	for name, status := range want {
+		if statuses[name] != status {
+			t.Errorf("%s = %s, want %s", name, statuses[name], status)
+		}
+	}
+	// Only DMARC's warning, weighing 15 of 110, costs half its weight
+	if report.Score != 93 || report.Domain != "shop.example" || time.Since(report.TestedAt) > time.Minute {
+		t.Errorf("report = %d for %s at %v, want 93", report.Score, report.Domain, report.TestedAt)
+	}
+	if len(sender.sent) != 1 || sender.sent[0].From != "postmaster@shop.example" || sender.sent[0].To != "verify@panel.example" {
+		t.Errorf("test messages = %+v", sender.sent)
+	}
+
+	// A refused test message fails its check
+	sender.err = errors.New("550 relay denied")
+	report, err = email.DeliverabilityTest(asUser(owner.ID), domain.ID)
+	if err != nil {
+		t.Fatalf("DeliverabilityTest() error = %v", err)
+	}
+	if check := report.Checks[len(report.Checks)-1]; check.Status != CheckFail || !strings.Contains(check.Detail, "550 relay denied") {
+		t.Errorf("test message check = %+v", check)
+	}
+
+	// Tests of a domain are limited per hour
+	if _, err := email.DeliverabilityTest(asUser(owner.ID), domain.ID); errorCode(err) != "deliverability_test_limit" {
+		t.Errorf("third test error = %v, want the rate limit", err)
+	}
+}
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"context"
+)
+
+// DeliveryDecision tells the MTA whether to accept an incoming message for a hosted mailbox
+type DeliveryDecision struct {
+	Allowed   bool   `json:"allowed"`
+	Reason    string `json:"reason,omitempty"`
+	Temporary bool   `json:"temporary,omitempty"` // Refused for now, e.g. while over quota; the sender should retry
+}
+
+// CheckDelivery decides whether the MTA should accept a message for recipient. Mail for disabled
+// or suspended mailboxes is refused, and mail for mailboxes over quota is deferred until space is
+// freed or the quota is raised.
+func (s *EmailService) CheckDelivery(ctx context.Context, recipient string) (*DeliveryDecision, error) {
+	account, err := s.accountByAddress(ctx, recipient)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		// Not one of ours; the MTA decides what to do with unknown recipients
+		return &DeliveryDecision{Allowed: true}, nil
+	}
+
+	switch {
+	case !account.IsActive || !account.Domain.IsActive:
+		return &DeliveryDecision{Reason: "mailbox is disabled"}, nil
+	case account.SuspendedAt != nil || account.Domain.SuspendedAt != nil:
+		return &DeliveryDecision{Reason: "mailbox is suspended"}, nil
+	case account.QuotaBlockedAt != nil:
+		return &DeliveryDecision{Reason: "mailbox is over quota", Temporary: true}, nil
+	}
+
+	return &DeliveryDecision{Allowed: true}, nil
+}
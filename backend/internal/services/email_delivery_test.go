@@ -0,0 +1,54 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestCheckDelivery(t *testing.T) {
+	tests := []struct {
+		name      string
+		recipient string
+		change    func(db *gorm.DB, domain *models.Domain, account *models.EmailAccount)
+		allowed   bool
+		temporary bool
+	}{
+		{"active", "info@deliver.example", nil, true, false},
+		{"not hosted", "someone@elsewhere.example", nil, true, false},
+		{"over quota", "info@deliver.example", func(db *gorm.DB, _ *models.Domain, account *models.EmailAccount) {
+			db.Model(account).Update("quota_blocked_at", time.Now())
+		}, false, true},
+		{"disabled", "info@deliver.example", func(db *gorm.DB, _ *models.Domain, account *models.EmailAccount) {
+			db.Model(account).Update("is_active", false)
+		}, false, false},
+		{"domain suspended", "INFO@deliver.example", func(db *gorm.DB, domain *models.Domain, _ *models.EmailAccount) {
+			db.Model(domain).Update("suspended_at", time.Now())
+		}, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			emails := newTestEmailService(t, db, config.MailConfig{SendLimitWindow: time.Hour})
+			domain := createTestDomain(t, db, createTestUser(t, db), "deliver.example")
+			account := createTestMailbox(t, db, domain, "info", "secret-password")
+			if tt.change != nil {
+				tt.change(db, domain, account)
+			}
+
+			decision, err := emails.CheckDelivery(context.Background(), tt.recipient)
+			if err != nil {
+				t.Fatalf("check delivery: %v", err)
+			}
+			if decision.Allowed != tt.allowed || decision.Temporary != tt.temporary {
+				t.Errorf("decision = %+v, want allowed %v temporary %v", decision, tt.allowed, tt.temporary)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// Mail discovery records that can be listed in mail.discovery_records
+const (
+	MailDiscoveryAutoconfig   = "autoconfig"
+	MailDiscoveryAutodiscover = "autodiscover"
+	MailDiscoveryIMAP         = "imap"
+	MailDiscoverySubmission   = "submission"
+)
+
+// AddDiscoveryRecords creates the configured DNS records mail clients use to find a domain's
+// settings and returns those created. A record whose name is already taken, for instance by an
+// autodiscover CNAME of another mail provider or an SRV record set up by hand, is skipped, so
+// enabling email again does not duplicate or replace anything. The records are added through the
+// DNS service, which checks the record limits, keeps the zone history and publishes the zone.
+func (s *EmailService) AddDiscoveryRecords(ctx context.Context, domain *models.Domain) ([]*models.DNSRecord, error) {
+	records := s.discoveryRecords(domain)
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	var existing []*models.DNSRecord
+	if err := s.db.WithContext(ctx).Where("domain_id = ?", domain.ID).Find(&existing).Error; err != nil {
+		return nil, fmt.Errorf("failed to get DNS records: %w", err)
+	}
+	// Records may be stored with relative or fully qualified names
+	for _, record := range existing {
+		record.Name = relativeName(record.Name, domain.Name)
+	}
+
+	var created []*models.DNSRecord
+	for _, record := range records {
+		if len(conflictingRecords(existing, record)) > 0 {
+			continue
+		}
+		existing = append(existing, record)
+		created = append(created, record)
+	}
+	if len(created) == 0 {
+		return nil, nil
+	}
+
+	if err := s.domains.addRecords(ctx, domain.ID, created); err != nil {
+		return nil, fmt.Errorf("failed to create mail discovery records: %w", err)
+	}
+
+	s.logger.Info("Mail discovery records created", zap.String("domain", domain.Name), zap.Int("records", len(created)))
+	return created, nil
+}
+
+// discoveryRecords builds the configured discovery records of a domain. The SRV records follow
+// the client ports: the IMAP record is _imaps unless the port is the plain-text one, and the
+// submission record is _submissions (RFC 8314) for implicit TLS.
+func (s *EmailService) discoveryRecords(domain *models.Domain) []*models.DNSRecord {
+	host := strings.ToLower(strings.TrimSuffix(s.config.DiscoveryHost, "."))
+	if host == "" {
+		host = domain.Name
+	}
+	mailHost := strings.TrimSuffix(s.mailHostname(domain.Name), ".")
+	ttl := defaultRecordTTL(domain, s.domains.config)
+
+	record := func(recordType, name, value string) *models.DNSRecord {
+		return &models.DNSRecord{
+			DomainID: domain.ID,
+			Type:     recordType,
+			Name:     name,
+			Value:    value,
+			TTL:      ttl,
+			IsActive: true,
+		}
+	}
+	// SRV data is priority, weight, port and the fully qualified target
+	srv := func(name string, port int, target string) *models.DNSRecord {
+		return record("SRV", name, fmt.Sprintf("0 1 %d %s.", port, target))
+	}
+
+	var records []*models.DNSRecord
+	for _, name := range s.config.DiscoveryRecords {
+		switch name {
+		case MailDiscoveryAutoconfig:
+			records = append(records, record("CNAME", "autoconfig", host))
+		case MailDiscoveryAutodiscover:
+			records = append(records,
+				record("CNAME", "autodiscover", host),
+				srv("_autodiscover._tcp", 443, host))
+		case MailDiscoveryIMAP:
+			service := "_imaps._tcp"
+			if portSecurity(s.config.ClientIMAPPort, 143) == MailSecurityStartTLS {
+				service = "_imap._tcp"
+			}
+			records = append(records, srv(service, s.config.ClientIMAPPort, mailHost))
+		case MailDiscoverySubmission:
+			service := "_submissions._tcp"
+			if portSecurity(s.config.ClientSMTPPort, 25, 587) == MailSecurityStartTLS {
+				service = "_submission._tcp"
+			}
+			records = append(records, srv(service, s.config.ClientSMTPPort, mailHost))
+		}
+	}
+
+	return records
+}
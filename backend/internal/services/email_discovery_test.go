@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestAddDiscoveryRecordsSkipsTakenNames(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	client, _ := newTestRedis(t)
+	domains, _ := newTestDomainService(t, db, cfg)
+	email := NewEmailService(db, client, zap.NewNop(), config.MailConfig{
+		DiscoveryRecords: []string{MailDiscoveryAutoconfig, MailDiscoveryAutodiscover, MailDiscoveryIMAP, MailDiscoverySubmission},
+		ClientIMAPPort:   993,
+		ClientSMTPPort:   465,
+	}, nil, domains)
+	domain := createTestDomain(t, db, createTestUser(t, db), "mail.example")
+	// Another provider's autodiscover, stored fully qualified
+	mustCreate(t, db, &models.DNSRecord{DomainID: domain.ID, Type: "CNAME", Name: "autodiscover.mail.example.", Value: "autodiscover.outlook.com.", TTL: 3600, IsActive: true})
+	ctx := context.Background()
+
+	created, err := email.AddDiscoveryRecords(ctx, domain)
+	if err != nil {
+		t.Fatalf("AddDiscoveryRecords() error = %v", err)
+	}
+	var names []string
+	for _, record := range created {
+		names = append(names, record.Type+" "+record.Name)
+	}
+	want := []string{"CNAME autoconfig", "SRV _autodiscover._tcp", "SRV _imaps._tcp", "SRV _submissions._tcp"}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("created = %v, want %v", names, want)
+	}
+
+	var versions int64
+	db.Model(&models.DNSZoneVersion{}).Where("domain_id = ?", domain.ID).Count(&versions)
+	if versions == 0 {
+		t.Error("no zone history recorded for the discovery records")
+	}
+	zone, err := os.ReadFile(filepath.Join(cfg.ZoneDir, domain.Name+".zone"))
+	if err != nil {
+		t.Fatalf("read zone file: %v", err)
+	}
+	if !strings.Contains(string(zone), "_imaps._tcp") || !strings.Contains(string(zone), "autodiscover.outlook.com.") {
+		t.Errorf("published zone lacks the records:\n%s", zone)
+	}
+
+	// Enabling email again adds nothing
+	again, err := email.AddDiscoveryRecords(ctx, domain)
+	if err != nil || len(again) != 0 {
+		t.Errorf("second AddDiscoveryRecords() = %d records, %v", len(again), err)
+	}
+	var count int64
+	db.Model(&models.DNSRecord{}).Where("domain_id = ?", domain.ID).Count(&count)
+	if count != 5 {
+		t.Errorf("domain has %d records, want 5", count)
+	}
+}
+
+func TestAddDiscoveryRecordsRespectsRecordLimits(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	cfg.DNSMaxRecords = 2
+	client, _ := newTestRedis(t)
+	domains, _ := newTestDomainService(t, db, cfg)
+	email := NewEmailService(db, client, zap.NewNop(), config.MailConfig{
+		DiscoveryRecords: []string{MailDiscoveryAutoconfig, MailDiscoveryAutodiscover},
+	}, nil, domains)
+	domain := createTestDomain(t, db, createTestUser(t, db), "full.example")
+
+	if _, err := email.AddDiscoveryRecords(context.Background(), domain); errorCode(err) != "dns_record_limit_reached" {
+		t.Fatalf("AddDiscoveryRecords() error = %v, want dns_record_limit_reached", err)
+	}
+	var count int64
+	db.Model(&models.DNSRecord{}).Where("domain_id = ?", domain.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("%d records created over the limit", count)
+	}
+}
@@ -0,0 +1,274 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/i18n"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// SendDecision tells the MTA whether to accept a message from a hosted mailbox
+type SendDecision struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// SendCounts are the recipients sent to in the current window
+type SendCounts struct {
+	Domain       int64               `json:"domain"`
+	DomainLimit  int                 `json:"domain_limit"`
+	Accounts     map[uuid.UUID]int64 `json:"accounts"`
+	AccountLimit int                 `json:"account_limit"`
+	WindowEnds   time.Time           `json:"window_ends"`
+}
+
+// RecordSend counts a message the MTA is about to send for a hosted mailbox and decides whether
+// to let it through. Exceeding the account or domain limit within the window suspends sending
+// until an admin resumes it, and raises a high-severity security event.
+func (s *EmailService) RecordSend(ctx context.Context, sender string, recipients int) (*SendDecision, error) {
+	if recipients < 1 {
+		recipients = 1
+	}
+
+	account, err := s.accountByAddress(ctx, sender)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil {
+		// Not one of ours; relaying rules are the MTA's business
+		return &SendDecision{Allowed: true}, nil
+	}
+
+	// Refused before counting, so a disabled mailbox cannot use up its domain's limit
+	if !account.IsActive || !account.Domain.IsActive {
+		return &SendDecision{Reason: "mail is disabled for " + sender}, nil
+	}
+	if account.Domain.SuspendedAt != nil || account.SuspendedAt != nil {
+		return &SendDecision{Reason: "mail is suspended for " + sender}, nil
+	}
+	if account.Domain.SendSuspendedAt != nil {
+		return &SendDecision{Reason: "sending is suspended for " + account.Domain.Name}, nil
+	}
+	if account.SendSuspendedAt != nil {
+		return &SendDecision{Reason: "sending is suspended for " + sender}, nil
+	}
+
+	window := s.sendWindow(time.Now())
+	accountCount, err := s.incrSendCount(ctx, sendCountKey("account", account.ID, window), recipients)
+	if err != nil {
+		return nil, err
+	}
+	domainCount, err := s.incrSendCount(ctx, sendCountKey("domain", account.DomainID, window), recipients)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case s.config.SendLimitDomain > 0 && domainCount > int64(s.config.SendLimitDomain):
+		s.suspendSending(ctx, &models.Domain{ID: account.DomainID}, account.Domain.UserID, account.Domain.Name, domainCount, s.config.SendLimitDomain)
+		return &SendDecision{Reason: "send limit exceeded for " + account.Domain.Name}, nil
+	case s.config.SendLimitAccount > 0 && accountCount > int64(s.config.SendLimitAccount):
+		s.suspendSending(ctx, &models.EmailAccount{ID: account.ID}, account.Domain.UserID, sender, accountCount, s.config.SendLimitAccount)
+		return &SendDecision{Reason: "send limit exceeded for " + sender}, nil
+	}
+
+	return &SendDecision{Allowed: true}, nil
+}
+
+// GetSendCounts returns how many recipients a domain and each of its accounts sent to in the current window
+func (s *EmailService) GetSendCounts(ctx context.Context, domainID uuid.UUID) (*SendCounts, error) {
+	var domain models.Domain
+	if err := s.db.WithContext(ctx).Where("id = ?", domainID).First(&domain).Error; err != nil {
+		return nil, apperrors.FromDB(err, "domain")
+	}
+
+	if err := authorizeDomain(ctx, &domain); err != nil {
+		return nil, err
+	}
+
+	var accounts []*models.EmailAccount
+	if err := s.db.WithContext(ctx).Where("domain_id = ?", domainID).Find(&accounts).Error; err != nil {
+		return nil, fmt.Errorf("failed to get email accounts: %w", err)
+	}
+
+	window := s.sendWindow(time.Now())
+	keys := []string{sendCountKey("domain", domainID, window)}
+	for _, account := range accounts {
+		keys = append(keys, sendCountKey("account", account.ID, window))
+	}
+
+	values, err := s.redis.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get send counts: %w", err)
+	}
+
+	counts := &SendCounts{
+		Domain:       parseCount(values[0]),
+		DomainLimit:  s.config.SendLimitDomain,
+		Accounts:     make(map[uuid.UUID]int64, len(accounts)),
+		AccountLimit: s.config.SendLimitAccount,
+		WindowEnds:   time.Unix((window+1)*int64(s.config.SendLimitWindow/time.Second), 0).UTC(),
+	}
+	for i, account := range accounts {
+		counts.Accounts[account.ID] = parseCount(values[i+1])
+	}
+
+	return counts, nil
+}
+
+// ResumeAccountSending lifts a send suspension of an account and resets its count. Admin only.
+func (s *EmailService) ResumeAccountSending(ctx context.Context, accountID uuid.UUID) error {
+	if !hasRoleInContext(ctx, "admin") {
+		return apperrors.PermissionDenied("email account")
+	}
+
+	result := s.db.WithContext(ctx).Model(&models.EmailAccount{}).Where("id = ?", accountID).Update("send_suspended_at", nil)
+	if result.Error != nil {
+		return fmt.Errorf("failed to resume sending: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return apperrors.NotFound("email account")
+	}
+
+	s.redis.Del(ctx, sendCountKey("account", accountID, s.sendWindow(time.Now())))
+	s.recordSendAudit(ctx, "email_account", accountID)
+	return nil
+}
+
+// ResumeDomainSending lifts a send suspension of a domain and resets its count. Admin only.
+func (s *EmailService) ResumeDomainSending(ctx context.Context, domainID uuid.UUID) error {
+	if !hasRoleInContext(ctx, "admin") {
+		return apperrors.PermissionDenied("domain")
+	}
+
+	result := s.db.WithContext(ctx).Model(&models.Domain{}).Where("id = ?", domainID).Update("send_suspended_at", nil)
+	if result.Error != nil {
+		return fmt.Errorf("failed to resume sending: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return apperrors.NotFound("domain")
+	}
+
+	s.domains.invalidateDomain(ctx, domainID)
+
+	s.redis.Del(ctx, sendCountKey("domain", domainID, s.sendWindow(time.Now())))
+	s.recordSendAudit(ctx, "domain", domainID)
+	return nil
+}
+
+// accountByAddress finds the hosted account of an address, or nil when it is not hosted here
+func (s *EmailService) accountByAddress(ctx context.Context, address string) (*models.EmailAccount, error) {
+	username, domainName, ok := strings.Cut(strings.ToLower(strings.TrimSpace(address)), "@")
+	if !ok || username == "" || domainName == "" {
+		return nil, nil
+	}
+
+	var accounts []*models.EmailAccount
+	if err := s.db.WithContext(ctx).
+		Joins("Domain").
+		Where("email_accounts.username = ? AND Domain.name = ?", username, domainName).
+		Limit(1).
+		Find(&accounts).Error; err != nil {
+		return nil, fmt.Errorf("failed to look up sender: %w", err)
+	}
+	if len(accounts) == 0 {
+		return nil, nil
+	}
+
+	return accounts[0], nil
+}
+
+// suspendSending stops outbound mail of an account or domain, raises a security event and, the
+// first time, notifies the owner
+func (s *EmailService) suspendSending(ctx context.Context, model interface{}, ownerID uuid.UUID, name string, count int64, limit int) {
+	result := s.db.WithContext(ctx).Model(model).Where("send_suspended_at IS NULL").Update("send_suspended_at", time.Now())
+	if result.Error != nil {
+		s.logger.Error("Failed to suspend sending", zap.String("sender", name), zap.Error(result.Error))
+	}
+	if domain, ok := model.(*models.Domain); ok {
+		s.domains.invalidateDomain(ctx, domain.ID)
+	}
+
+	s.logger.Warn("Sending suspended after exceeding the send limit",
+		zap.String("sender", name),
+		zap.Int64("count", count),
+		zap.Int("limit", limit),
+	)
+
+	securityEvent := &models.SecurityEvent{
+		UserID:      &ownerID,
+		Type:        "mail_send_abuse",
+		Severity:    "high",
+		Source:      "smtp",
+		Description: fmt.Sprintf("Sending suspended for %s after %d recipients within %s (limit %d)", name, count, s.config.SendLimitWindow, limit),
+	}
+	if err := s.db.WithContext(ctx).Create(securityEvent).Error; err != nil {
+		s.logger.Error("Failed to record security event", zap.Error(err))
+	}
+
+	if result.RowsAffected == 0 || s.notifications == nil {
+		return
+	}
+	if err := s.notifications.Notify(ctx, ownerID, NotificationSecurity, func(locale string) (string, string) {
+		params := map[string]string{
+			"name":   name,
+			"count":  strconv.FormatInt(count, 10),
+			"limit":  strconv.Itoa(limit),
+			"window": s.config.SendLimitWindow.String(),
+		}
+		return i18n.Translate(locale, "send.blocked.subject", params), i18n.Translate(locale, "send.blocked.body", params)
+	}); err != nil {
+		s.logger.Error("Failed to notify of suspended sending", zap.String("sender", name), zap.Error(err))
+	}
+}
+
+func (s *EmailService) recordSendAudit(ctx context.Context, resource string, id uuid.UUID) {
+	resourceID := id.String()
+	auditLog := &models.AuditLog{
+		UserID:     actorFromContext(ctx),
+		Action:     "resume_sending",
+		Resource:   resource,
+		ResourceID: &resourceID,
+		Success:    true,
+	}
+	if err := s.db.WithContext(ctx).Create(auditLog).Error; err != nil {
+		s.logger.Error("Failed to record audit log", zap.Error(err))
+	}
+}
+
+// incrSendCount adds recipients to a window counter, which expires with the window
+func (s *EmailService) incrSendCount(ctx context.Context, key string, recipients int) (int64, error) {
+	count, err := s.redis.IncrBy(ctx, key, int64(recipients)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count send: %w", err)
+	}
+	if count == int64(recipients) {
+		s.redis.Expire(ctx, key, s.config.SendLimitWindow)
+	}
+	return count, nil
+}
+
+// sendWindow numbers the fixed window t falls in
+func (s *EmailService) sendWindow(t time.Time) int64 {
+	return t.Unix() / int64(s.config.SendLimitWindow/time.Second)
+}
+
+func sendCountKey(kind string, id uuid.UUID, window int64) string {
+	return fmt.Sprintf("send_count:%s:%s:%d", kind, id, window)
+}
+
+func parseCount(value interface{}) int64 {
+	var count int64
+	if str, ok := value.(string); ok {
+		fmt.Sscan(str, &count)
+	}
+	return count
+}
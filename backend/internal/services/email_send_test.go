@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestRecordSendLimits(t *testing.T) {
+	db := newTestDB(t)
+	emails := newTestEmailService(t, db, config.MailConfig{SendLimitAccount: 3, SendLimitDomain: 10, SendLimitWindow: time.Hour})
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "limits.example")
+	account := createTestMailbox(t, db, domain, "news", "secret-password")
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		decision, err := emails.RecordSend(ctx, "news@limits.example", 1)
+		if err != nil || !decision.Allowed {
+			t.Fatalf("send %d: %+v, %v", i+1, decision, err)
+		}
+	}
+	decision, _ := emails.RecordSend(ctx, "news@limits.example", 1)
+	if decision.Allowed {
+		t.Fatal("send over the account limit allowed")
+	}
+
+	db.First(account, "id = ?", account.ID)
+	if account.SendSuspendedAt == nil {
+		t.Error("account not suspended after exceeding the limit")
+	}
+	var events int64
+	db.Model(&models.SecurityEvent{}).Where("type = ?", "mail_send_abuse").Count(&events)
+	if events != 1 {
+		t.Errorf("security events = %d, want 1", events)
+	}
+}
+
+func TestRecordSendRefusesInactiveWithoutCounting(t *testing.T) {
+	db := newTestDB(t)
+	emails := newTestEmailService(t, db, config.MailConfig{SendLimitDomain: 2, SendLimitWindow: time.Hour})
+	domain := createTestDomain(t, db, createTestUser(t, db), "inactive.example")
+	disabled := createTestMailbox(t, db, domain, "old", "secret-password")
+	createTestMailbox(t, db, domain, "info", "secret-password")
+	db.Model(disabled).Update("is_active", false)
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		decision, err := emails.RecordSend(ctx, "old@inactive.example", 1)
+		if err != nil || decision.Allowed {
+			t.Fatalf("send from a disabled mailbox: %+v, %v", decision, err)
+		}
+	}
+
+	decision, err := emails.RecordSend(ctx, "info@inactive.example", 2)
+	if err != nil || !decision.Allowed {
+		t.Errorf("refused sends used up the domain limit: %+v, %v", decision, err)
+	}
+	counts, err := emails.GetSendCounts(asUser(domain.UserID), domain.ID)
+	if err != nil {
+		t.Fatalf("send counts: %v", err)
+	}
+	if counts.Domain != 2 {
+		t.Errorf("domain count = %d, want 2", counts.Domain)
+	}
+}
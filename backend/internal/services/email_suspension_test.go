@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// newTestEmailService creates an email service on db with a Redis of its own
+func newTestEmailService(t *testing.T, db *gorm.DB, cfg config.MailConfig) *EmailService {
+	t.Helper()
+
+	client, _ := newTestRedis(t)
+	domains, _ := newTestDomainService(t, db, testHostingConfig(t))
+	return NewEmailService(db, client, zap.NewNop(), cfg, nil, domains)
+}
+
+// createTestMailbox stores an active mailbox of the domain with the password
+func createTestMailbox(t *testing.T, db *gorm.DB, domain *models.Domain, username, password string) *models.EmailAccount {
+	t.Helper()
+
+	hash, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	account := &models.EmailAccount{DomainID: domain.ID, Username: username, PasswordHash: string(hash), IsActive: true}
+	if err := db.Create(account).Error; err != nil {
+		t.Fatalf("create mailbox: %v", err)
+	}
+	return account
+}
+
+func TestSetUserDomainsSuspendedPausesMail(t *testing.T) {
+	db := newTestDB(t)
+	domains, _ := newTestDomainService(t, db, testHostingConfig(t))
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "suspend.example")
+	account := createTestMailbox(t, db, domain, "info", "secret-password")
+	ctx := context.Background()
+
+	if err := domains.SetUserDomainsSuspended(ctx, owner.ID, true); err != nil {
+		t.Fatalf("suspend: %v", err)
+	}
+	db.First(account, "id = ?", account.ID)
+	db.First(domain, "id = ?", domain.ID)
+	if account.SuspendedAt == nil || domain.SuspendedAt == nil {
+		t.Fatalf("suspension not cascaded: domain %v, mailbox %v", domain.SuspendedAt, account.SuspendedAt)
+	}
+
+	if err := domains.SetUserDomainsSuspended(ctx, owner.ID, false); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	var resumed models.EmailAccount
+	db.First(&resumed, "id = ?", account.ID)
+	if resumed.SuspendedAt != nil {
+		t.Error("mailbox still suspended after resuming")
+	}
+}
+
+func TestSuspendedMailboxes(t *testing.T) {
+	tests := []struct {
+		name    string
+		suspend func(db *gorm.DB, domain *models.Domain, account *models.EmailAccount)
+		allowed bool
+	}{
+		{"active", func(*gorm.DB, *models.Domain, *models.EmailAccount) {}, true},
+		{"mailbox suspended", func(db *gorm.DB, _ *models.Domain, account *models.EmailAccount) {
+			db.Model(account).Update("suspended_at", time.Now())
+		}, false},
+		{"domain suspended", func(db *gorm.DB, domain *models.Domain, _ *models.EmailAccount) {
+			db.Model(domain).Update("suspended_at", time.Now())
+		}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			emails := newTestEmailService(t, db, config.MailConfig{SendLimitWindow: time.Hour})
+			owner := createTestUser(t, db)
+			domain := createTestDomain(t, db, owner, "mail.example")
+			account := createTestMailbox(t, db, domain, "info", "secret-password")
+			tt.suspend(db, domain, account)
+			ctx := asUser(owner.ID, "support")
+
+			check, err := emails.VerifyCredentials(ctx, domain.ID, "info", "secret-password")
+			if err != nil {
+				t.Fatalf("verify credentials: %v", err)
+			}
+			if check.Valid != tt.allowed {
+				t.Errorf("credentials valid = %v (%s), want %v", check.Valid, check.Reason, tt.allowed)
+			}
+
+			decision, err := emails.RecordSend(ctx, "info@mail.example", 1)
+			if err != nil {
+				t.Fatalf("record send: %v", err)
+			}
+			if decision.Allowed != tt.allowed {
+				t.Errorf("send allowed = %v (%s), want %v", decision.Allowed, decision.Reason, tt.allowed)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+const (
+	// credentialCheckLimit is the number of verification attempts allowed per mailbox per window
+	credentialCheckLimit  = 5
+	credentialCheckWindow = 15 * time.Minute
+	imapTimeout           = 10 * time.Second
+)
+
+// dummyPasswordHash is compared against when a mailbox does not exist so timing does not reveal it
+const dummyPasswordHash = "$2a$10$EcDkTAKYeEJjGJLWUUnhy.0AQTyHVKM32E4inY1v96FZ.amPke/kK"
+
+// CredentialCheck is the result of verifying a mailbox password
+type CredentialCheck struct {
+	Valid  bool   `json:"valid"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// VerifyCredentials checks a mailbox password against the stored hash and, when configured,
+// against the IMAP server. Only support staff see why a check failed.
+func (s *EmailService) VerifyCredentials(ctx context.Context, domainID uuid.UUID, username, password string) (*CredentialCheck, error) {
+	key := fmt.Sprintf("email_verify:%s:%s", domainID, strings.ToLower(username))
+	attempts, err := s.redis.Incr(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check verification rate limit: %w", err)
+	}
+	if attempts == 1 {
+		s.redis.Expire(ctx, key, credentialCheckWindow)
+	}
+	if attempts > credentialCheckLimit {
+		return nil, apperrors.PreconditionCode("credential_check_limit", map[string]string{
+			"limit":   strconv.Itoa(credentialCheckLimit),
+			"minutes": strconv.Itoa(int(credentialCheckWindow.Minutes())),
+		})
+	}
+
+	var account models.EmailAccount
+	var domain models.Domain
+	found := s.db.WithContext(ctx).Where("id = ?", domainID).First(&domain).Error == nil &&
+		s.db.WithContext(ctx).Where("domain_id = ? AND username = ?", domainID, username).First(&account).Error == nil
+
+	result := &CredentialCheck{Valid: true}
+	switch {
+	case !found:
+		bcrypt.CompareHashAndPassword([]byte(dummyPasswordHash), []byte(password))
+		result = &CredentialCheck{Reason: "account not found"}
+	case bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(password)) != nil:
+		result = &CredentialCheck{Reason: "incorrect password"}
+	case !account.IsActive:
+		result = &CredentialCheck{Reason: "account is disabled"}
+	case account.SuspendedAt != nil || domain.SuspendedAt != nil:
+		result = &CredentialCheck{Reason: "account is suspended"}
+	case s.config.IMAPAddr != "":
+		if err := s.imapLogin(ctx, username+"@"+domain.Name, password); err != nil {
+			result = &CredentialCheck{Reason: fmt.Sprintf("IMAP login failed: %v", err)}
+		}
+	}
+
+	resourceID := username
+	if found {
+		resourceID = username + "@" + domain.Name
+	}
+	auditLog := &models.AuditLog{
+		UserID:     actorFromContext(ctx),
+		Action:     "email.verify_credentials",
+		Resource:   "email_account",
+		ResourceID: &resourceID,
+		Details:    result.Reason,
+		Success:    result.Valid,
+	}
+	if err := s.db.WithContext(ctx).Create(auditLog).Error; err != nil {
+		s.logger.Error("Failed to record audit log", zap.Error(err))
+	}
+
+	if !result.Valid && !hasRoleInContext(ctx, "support") {
+		result.Reason = "invalid credentials"
+	}
+
+	return result, nil
+}
+
+// imapLogin performs a LOGIN against the configured IMAP server over implicit TLS
+func (s *EmailService) imapLogin(ctx context.Context, address, password string) error {
+	if strings.ContainsAny(address+password, "\r\n") {
+		return fmt.Errorf("credentials contain line breaks")
+	}
+
+	host, _, err := net.SplitHostPort(s.config.IMAPAddr)
+	if err != nil {
+		return fmt.Errorf("invalid IMAP address: %w", err)
+	}
+
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: imapTimeout},
+		Config:    &tls.Config{ServerName: host},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", s.config.IMAPAddr)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(imapTimeout))
+
+	reader := bufio.NewReader(conn)
+	if _, err := reader.ReadString('\n'); err != nil {
+		return fmt.Errorf("failed to read greeting: %w", err)
+	}
+
+	if _, err := fmt.Fprintf(conn, "a1 LOGIN %s %s\r\n", imapQuote(address), imapQuote(password)); err != nil {
+		return fmt.Errorf("failed to send login: %w", err)
+	}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read login response: %w", err)
+		}
+		if !strings.HasPrefix(line, "a1 ") {
+			continue
+		}
+
+		fmt.Fprintf(conn, "a2 LOGOUT\r\n")
+		if strings.HasPrefix(line, "a1 OK") {
+			return nil
+		}
+		return fmt.Errorf("server rejected login")
+	}
+}
+
+// imapQuote formats a value as an IMAP quoted string
+func imapQuote(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + replacer.Replace(value) + `"`
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestVerifyCredentials(t *testing.T) {
+	db := newTestDB(t)
+	email := newTestEmailService(t, db, config.MailConfig{})
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "verify.example")
+	createTestMailbox(t, db, domain, "info", "right-password")
+	disabled := createTestMailbox(t, db, domain, "old", "right-password")
+	db.Model(disabled).Update("is_active", false)
+	suspended := createTestMailbox(t, db, domain, "paused", "right-password")
+	db.Model(suspended).Update("suspended_at", time.Now())
+
+	tests := []struct {
+		name       string
+		username   string
+		password   string
+		wantValid  bool
+		wantReason string
+	}{
+		{"right password", "info", "right-password", true, ""},
+		{"wrong password", "info", "wrong-password", false, "incorrect password"},
+		{"missing mailbox", "nobody", "right-password", false, "account not found"},
+		{"disabled mailbox", "old", "right-password", false, "account is disabled"},
+		{"suspended mailbox", "paused", "right-password", false, "account is suspended"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			support, err := email.VerifyCredentials(asUser(owner.ID, "support"), domain.ID, tt.username, tt.password)
+			if err != nil {
+				t.Fatalf("VerifyCredentials() error = %v", err)
+			}
+			if support.Valid != tt.wantValid || support.Reason != tt.wantReason {
+				t.Errorf("support sees %+v, want valid %v with %q", support, tt.wantValid, tt.wantReason)
+			}
+
+			user, err := email.VerifyCredentials(asUser(owner.ID, "user"), domain.ID, tt.username, tt.password)
+			if err != nil {
+				t.Fatalf("VerifyCredentials() error = %v", err)
+			}
+			if !tt.wantValid && user.Reason != "invalid credentials" {
+				t.Errorf("user sees reason %q", user.Reason)
+			}
+		})
+	}
+
+	var audits int64
+	db.Model(&models.AuditLog{}).Where("action = ?", "email.verify_credentials").Count(&audits)
+	if audits != int64(2*len(tests)) {
+		t.Errorf("audit entries = %d, want %d", audits, 2*len(tests))
+	}
+}
+
+func TestVerifyCredentialsRateLimit(t *testing.T) {
+	db := newTestDB(t)
+	email := newTestEmailService(t, db, config.MailConfig{})
+	domain := createTestDomain(t, db, createTestUser(t, db), "limit.example")
+	createTestMailbox(t, db, domain, "info", "right-password")
+	ctx := context.Background()
+
+	for i := 0; i < credentialCheckLimit; i++ {
+		if _, err := email.VerifyCredentials(ctx, domain.ID, "info", "guess"); err != nil {
+			t.Fatalf("attempt %d: %v", i+1, err)
+		}
+	}
+	// The limit is per mailbox, whatever the case of its name
+	_, err := email.VerifyCredentials(ctx, domain.ID, "INFO", "right-password")
+	if errorCode(err) != "credential_check_limit" || apperrors.HTTPStatus(err) != http.StatusConflict {
+		t.Errorf("over the limit: error = %v, want credential_check_limit", err)
+	}
+	createTestMailbox(t, db, domain, "sales", "right-password")
+	if check, err := email.VerifyCredentials(ctx, domain.ID, "sales", "right-password"); err != nil || !check.Valid {
+		t.Errorf("other mailbox = %+v, %v", check, err)
+	}
+}
+
+func TestIMAPQuote(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{`secret`, `"secret"`},
+		{`pa"ss`, `"pa\"ss"`},
+		{`back\slash`, `"back\\slash"`},
+	}
+	for _, tt := range tests {
+		if got := imapQuote(tt.value); got != tt.want {
+			t.Errorf("imapQuote(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
 )
 
 // FileService handles file management operations
@@ -13,14 +15,20 @@ type FileService struct {
 	db     *gorm.DB
 	redis  *redis.Client
 	logger *zap.Logger
+	config config.HostingConfig
+
+	domains *DomainService
 }
 
 // NewFileService creates a new file service
-func NewFileService(db *gorm.DB, redis *redis.Client, logger *zap.Logger) *FileService {
+func NewFileService(db *gorm.DB, redis *redis.Client, logger *zap.Logger, config config.HostingConfig, domains *DomainService) *FileService {
 	return &FileService{
 		db:     db,
 		redis:  redis,
 		logger: logger,
+		config: config,
+
+		domains: domains,
 	}
 }
 
@@ -0,0 +1,503 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// uploadLockTTL bounds how long a chunk holds its upload, in case the server stops mid-chunk
+const uploadLockTTL = 15 * time.Minute
+
+// uploadIDPattern matches upload IDs, which name the staged files
+var uploadIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{32}$`)
+
+// uploadUnlockScript deletes the lock of an upload while it still holds the caller's token, so a
+// chunk whose lock lapsed cannot release the lock of the chunk that took it over
+var uploadUnlockScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`)
+
+// Upload is a resumable upload of a file into a domain's directory. Its data arrives in chunks,
+// each continuing at the offset the upload has reached, so an interrupted upload resumes where it
+// stopped. Once all Size bytes are in, the file is moved to Path.
+type Upload struct {
+	ID        string     `json:"id"`
+	DomainID  uuid.UUID  `json:"domain_id"`
+	UserID    *uuid.UUID `json:"user_id,omitempty"`
+	Path      string     `json:"path"`
+	Size      int64      `json:"size"`
+	Offset    int64      `json:"offset"` // Bytes received so far
+	Completed bool       `json:"completed"`
+	ExpiresAt time.Time  `json:"expires_at"` // Given up unless a chunk arrives before then
+}
+
+// CreateUpload starts a resumable upload of size bytes to path, relative to the domain's
+// directory. The size must fit the domain's remaining disk quota.
+func (s *FileService) CreateUpload(ctx context.Context, domainID uuid.UUID, path string, size int64) (*Upload, error) {
+	domain, err := s.domains.ownedDomain(ctx, domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	v := apperrors.NewValidation()
+	switch {
+	case size <= 0:
+		v.AddCode("size", "field.minimum", map[string]string{"min": "1"})
+	case s.config.UploadMaxSize > 0 && size > s.config.UploadMaxSize:
+		v.AddCode("size", "field.maximum", map[string]string{"max": strconv.FormatInt(s.config.UploadMaxSize, 10)})
+	}
+	target, err := uploadTarget(domain, path)
+	if err != nil {
+		v.AddCode("path", "upload.path", nil)
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	// Uploads of a domain are started one at a time, so each one counts the space reserved by
+	// the others
+	held, err := lockDomain(ctx, s.domains.locks, domain.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer held.Release()
+
+	reserved, err := s.reservedUploadSpace(ctx, domain.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkUploadQuota(domain, size, reserved); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("failed to generate upload id: %w", err)
+	}
+	upload := &Upload{
+		ID:       base64.RawURLEncoding.EncodeToString(buf),
+		DomainID: domain.ID,
+		UserID:   actorFromContext(ctx),
+		Path:     target,
+		Size:     size,
+	}
+
+	if err := os.MkdirAll(s.config.UploadDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create upload directory: %w", err)
+	}
+	file, err := os.OpenFile(s.stagingPath(upload.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upload: %w", err)
+	}
+	file.Close()
+
+	if err := s.saveUpload(ctx, upload); err != nil {
+		os.Remove(s.stagingPath(upload.ID))
+		return nil, err
+	}
+	if err := s.redis.HSet(ctx, uploadReservationsKey(domain.ID), upload.ID, size).Err(); err != nil {
+		s.redis.Del(ctx, uploadKey(upload.ID))
+		os.Remove(s.stagingPath(upload.ID))
+		return nil, fmt.Errorf("failed to reserve upload space: %w", err)
+	}
+	s.redis.Expire(ctx, uploadReservationsKey(domain.ID), s.config.UploadTTL)
+
+	s.logger.Info("Upload started",
+		zap.String("domain", domain.Name),
+		zap.String("path", target),
+		zap.Int64("size", size))
+
+	return upload, nil
+}
+
+// GetUpload returns an upload with the offset to resume it from
+func (s *FileService) GetUpload(ctx context.Context, uploadID string) (*Upload, error) {
+	return s.loadUpload(ctx, uploadID)
+}
+
+// WriteChunk appends the data read from r to an upload at offset, which must be the offset the
+// upload has reached. Data received before r fails is kept, so the upload resumes after it. The
+// chunk completing the upload moves the file into place.
+func (s *FileService) WriteChunk(ctx context.Context, uploadID string, offset int64, r io.Reader) (*Upload, error) {
+	upload, err := s.loadUpload(ctx, uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	// One chunk at a time, so concurrent retries cannot interleave their data
+	token, err := newUploadToken()
+	if err != nil {
+		return nil, err
+	}
+	locked, err := s.redis.SetNX(ctx, uploadLockKey(uploadID), token, uploadLockTTL).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock upload: %w", err)
+	}
+	if !locked {
+		return nil, apperrors.PreconditionCode("upload_busy", nil)
+	}
+	defer uploadUnlockScript.Run(context.WithoutCancel(ctx), s.redis, []string{uploadLockKey(uploadID)}, token)
+
+	// Loaded again under the lock, since a chunk may have finished in the meantime
+	if upload, err = s.loadUpload(ctx, uploadID); err != nil {
+		return nil, err
+	}
+	if offset != upload.Offset {
+		return nil, apperrors.PreconditionCode("upload_offset_mismatch", map[string]string{"offset": strconv.FormatInt(upload.Offset, 10)})
+	}
+
+	var domain models.Domain
+	if err := s.db.WithContext(ctx).Where("id = ?", upload.DomainID).First(&domain).Error; err != nil {
+		return nil, apperrors.FromDB(err, "domain")
+	}
+	if domain.QuotaBlockedAt != nil {
+		return nil, apperrors.PreconditionCode("disk_quota_exceeded", map[string]string{"name": domain.Name})
+	}
+
+	written, writeErr := s.appendChunk(upload, r)
+	upload.Offset += written
+	if writeErr != nil && written == 0 {
+		return nil, writeErr
+	}
+
+	// Kept under a context of its own: an interrupted request cancels ctx, and the bytes it
+	// delivered must still count
+	saveCtx := context.WithoutCancel(ctx)
+	if upload.Offset == upload.Size && writeErr == nil {
+		if err := s.completeUpload(saveCtx, upload, &domain); err != nil {
+			return nil, err
+		}
+		return upload, nil
+	}
+	if err := s.saveUpload(saveCtx, upload); err != nil {
+		return nil, err
+	}
+	if writeErr != nil {
+		return nil, writeErr
+	}
+	return upload, nil
+}
+
+// CancelUpload gives up an upload and deletes the data received for it
+func (s *FileService) CancelUpload(ctx context.Context, uploadID string) error {
+	upload, err := s.loadUpload(ctx, uploadID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.redis.Del(ctx, uploadKey(uploadID)).Err(); err != nil {
+		return fmt.Errorf("failed to cancel upload: %w", err)
+	}
+	s.releaseUploadSpace(ctx, upload)
+	if err := os.Remove(s.stagingPath(uploadID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		s.logger.Warn("Failed to remove staged upload", zap.String("upload", uploadID), zap.Error(err))
+	}
+	return nil
+}
+
+// PurgeStaleUploads deletes staged data of uploads given up longer than the upload TTL ago
+func (s *FileService) PurgeStaleUploads(ctx context.Context) (int64, error) {
+	entries, err := os.ReadDir(s.config.UploadDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to list staged uploads: %w", err)
+	}
+
+	var purged int64
+	cutoff := time.Now().Add(-s.config.UploadTTL)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() || info.ModTime().After(cutoff) {
+			continue
+		}
+		// A chunk written since the file was last modified keeps the upload alive
+		if exists, err := s.redis.Exists(ctx, uploadKey(entry.Name())).Result(); err != nil || exists > 0 {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.config.UploadDir, entry.Name())); err != nil {
+			s.logger.Warn("Failed to remove stale upload", zap.String("upload", entry.Name()), zap.Error(err))
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// appendChunk writes the data read from r to an upload's staged file at its offset, and returns
+// how many bytes were written. Data beyond the upload's size is refused, and anything left of an
+// earlier interrupted write past the offset is dropped first.
+func (s *FileService) appendChunk(upload *Upload, r io.Reader) (int64, error) {
+	file, err := os.OpenFile(s.stagingPath(upload.ID), os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open upload: %w", err)
+	}
+	defer file.Close()
+
+	if err := file.Truncate(upload.Offset); err != nil {
+		return 0, fmt.Errorf("failed to resume upload: %w", err)
+	}
+	if _, err := file.Seek(upload.Offset, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("failed to resume upload: %w", err)
+	}
+
+	remaining := upload.Size - upload.Offset
+	written, copyErr := io.Copy(file, io.LimitReader(r, remaining+1))
+	if written > remaining {
+		file.Truncate(upload.Offset)
+		return 0, apperrors.InvalidCode("body", "upload.too_long", map[string]string{"size": strconv.FormatInt(upload.Size, 10)})
+	}
+
+	// Only data on disk counts as received
+	if err := file.Sync(); err != nil {
+		file.Truncate(upload.Offset)
+		return 0, fmt.Errorf("failed to write upload: %w", err)
+	}
+	if copyErr != nil {
+		return written, fmt.Errorf("upload interrupted after %d bytes: %w", upload.Offset+written, copyErr)
+	}
+	return written, nil
+}
+
+// completeUpload moves a fully received upload to its target, owned by the web files' owner. The
+// target is checked again, since the domain's directory may have changed during the upload.
+func (s *FileService) completeUpload(ctx context.Context, upload *Upload, domain *models.Domain) error {
+	target, err := uploadTarget(domain, upload.Path)
+	if err != nil {
+		return apperrors.InvalidCode("path", "upload.path", nil)
+	}
+
+	if err := mkdirOwned(filepath.Dir(target), s.config.FTPUID, s.config.FTPGID); err != nil {
+		return fmt.Errorf("failed to create upload directory: %w", err)
+	}
+	if err := moveFile(s.stagingPath(upload.ID), target); err != nil {
+		return fmt.Errorf("failed to move upload into place: %w", err)
+	}
+	if err := os.Chmod(target, 0644); err != nil {
+		return fmt.Errorf("failed to set upload permissions: %w", err)
+	}
+	if err := os.Chown(target, s.config.FTPUID, s.config.FTPGID); err != nil {
+		return fmt.Errorf("failed to set upload owner: %w", err)
+	}
+
+	upload.Completed = true
+	if err := s.redis.Del(ctx, uploadKey(upload.ID)).Err(); err != nil {
+		s.logger.Warn("Failed to remove completed upload", zap.String("upload", upload.ID), zap.Error(err))
+	}
+	s.releaseUploadSpace(ctx, upload)
+
+	s.logger.Info("Upload completed",
+		zap.String("domain", domain.Name),
+		zap.String("path", target),
+		zap.Int64("size", upload.Size))
+	return nil
+}
+
+// loadUpload returns an upload of the calling user; admins may see every upload
+func (s *FileService) loadUpload(ctx context.Context, uploadID string) (*Upload, error) {
+	if !uploadIDPattern.MatchString(uploadID) {
+		return nil, apperrors.NotFound("upload")
+	}
+
+	data, err := s.redis.Get(ctx, uploadKey(uploadID)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, apperrors.NotFound("upload")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load upload: %w", err)
+	}
+
+	var upload Upload
+	if err := json.Unmarshal([]byte(data), &upload); err != nil {
+		return nil, fmt.Errorf("failed to decode upload: %w", err)
+	}
+
+	actor := actorFromContext(ctx)
+	if !hasRoleInContext(ctx, "admin") && (actor == nil || upload.UserID == nil || *actor != *upload.UserID) {
+		return nil, apperrors.NotFound("upload")
+	}
+	return &upload, nil
+}
+
+// saveUpload stores an upload's state, extending it by the upload TTL
+func (s *FileService) saveUpload(ctx context.Context, upload *Upload) error {
+	upload.ExpiresAt = time.Now().Add(s.config.UploadTTL)
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return fmt.Errorf("failed to encode upload: %w", err)
+	}
+	if err := s.redis.Set(ctx, uploadKey(upload.ID), data, s.config.UploadTTL).Err(); err != nil {
+		return fmt.Errorf("failed to store upload: %w", err)
+	}
+	// The domain's reservations last as long as its most recently active upload
+	s.redis.Expire(ctx, uploadReservationsKey(upload.DomainID), s.config.UploadTTL)
+	return nil
+}
+
+// reservedUploadSpace returns the bytes reserved by a domain's active uploads. Reservations of
+// uploads that were given up are dropped on the way.
+func (s *FileService) reservedUploadSpace(ctx context.Context, domainID uuid.UUID) (int64, error) {
+	reservations, err := s.redis.HGetAll(ctx, uploadReservationsKey(domainID)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get upload reservations: %w", err)
+	}
+
+	var reserved int64
+	for uploadID, value := range reservations {
+		exists, err := s.redis.Exists(ctx, uploadKey(uploadID)).Result()
+		if err != nil {
+			return 0, fmt.Errorf("failed to get upload reservations: %w", err)
+		}
+		size, parseErr := strconv.ParseInt(value, 10, 64)
+		if exists == 0 || parseErr != nil {
+			s.redis.HDel(ctx, uploadReservationsKey(domainID), uploadID)
+			continue
+		}
+		reserved += size
+	}
+	return reserved, nil
+}
+
+// releaseUploadSpace drops the reservation of a completed or cancelled upload
+func (s *FileService) releaseUploadSpace(ctx context.Context, upload *Upload) {
+	if err := s.redis.HDel(ctx, uploadReservationsKey(upload.DomainID), upload.ID).Err(); err != nil {
+		s.logger.Warn("Failed to release upload reservation", zap.String("upload", upload.ID), zap.Error(err))
+	}
+}
+
+// stagingPath returns where an upload's data is collected until it is complete
+func (s *FileService) stagingPath(uploadID string) string {
+	return filepath.Join(s.config.UploadDir, uploadID)
+}
+
+// uploadTarget resolves an upload path against a domain's directory. The target must be a file,
+// existing or not, inside the directory, also after following the symlinks on the way.
+func uploadTarget(domain *models.Domain, path string) (string, error) {
+	root := domainRoot(domain.Name)
+	target, err := resolveRealWithin(root, path)
+	if err != nil {
+		return "", err
+	}
+	if target == root {
+		return "", fmt.Errorf("upload path %s is the domain directory", path)
+	}
+
+	if info, err := os.Lstat(target); err == nil && !info.Mode().IsRegular() {
+		return "", fmt.Errorf("upload path %s is not a regular file", target)
+	}
+	return target, nil
+}
+
+// checkUploadQuota refuses uploads into domains blocked for their disk usage, and uploads that
+// would not fit the rest of the disk quota once the reserved bytes of other uploads in progress
+// are taken off. A quota of 0 is unlimited.
+func checkUploadQuota(domain *models.Domain, size, reserved int64) error {
+	if domain.QuotaBlockedAt != nil {
+		return apperrors.PreconditionCode("disk_quota_exceeded", map[string]string{"name": domain.Name})
+	}
+	if domain.DiskQuota <= 0 {
+		return nil
+	}
+
+	free := domain.DiskQuota - domain.DiskUsage - reserved
+	if free < 0 {
+		free = 0
+	}
+	if size > free {
+		return apperrors.PreconditionCode("upload_over_quota", map[string]string{
+			"name": domain.Name,
+			"size": formatQuotaAmount(QuotaMetricDisk, size),
+			"free": formatQuotaAmount(QuotaMetricDisk, free),
+		})
+	}
+	return nil
+}
+
+// mkdirOwned creates dir and its missing parents, owned by uid and gid like the web files
+func mkdirOwned(dir string, uid, gid int) error {
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+	if err := mkdirOwned(filepath.Dir(dir), uid, gid); err != nil {
+		return err
+	}
+	if err := os.Mkdir(dir, 0755); err != nil && !errors.Is(err, os.ErrExist) {
+		return err
+	}
+	return os.Chown(dir, uid, gid)
+}
+
+// moveFile renames src to dst, copying when they are on different filesystems. dst is replaced
+// atomically either way.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".upload-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Remove(src)
+}
+
+func uploadKey(uploadID string) string {
+	return "upload:" + uploadID
+}
+
+func uploadLockKey(uploadID string) string {
+	return "upload:" + uploadID + ":lock"
+}
+
+func uploadReservationsKey(domainID uuid.UUID) string {
+	return "upload_reservations:" + domainID.String()
+}
+
+// newUploadToken returns a random token identifying the chunk holding an upload's lock
+func newUploadToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate upload lock token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
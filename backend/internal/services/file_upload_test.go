@@ -0,0 +1,407 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// newTestFileService creates a file service on db whose uploads are staged in a temporary
+// directory, with the Redis server holding their state
+func newTestFileService(t *testing.T, db *gorm.DB) (*FileService, config.HostingConfig, *miniredis.Miniredis) {
+	t.Helper()
+
+	cfg := testHostingConfig(t)
+	cfg.UploadTTL = time.Hour
+	cfg.FTPUID, cfg.FTPGID = os.Getuid(), os.Getgid()
+	client, server := newTestRedis(t)
+	domains, _ := newTestDomainService(t, db, cfg)
+	return NewFileService(db, client, zap.NewNop(), cfg, domains), cfg, server
+}
+
+// interruptedReader delivers data, then fails like a dropped connection
+func interruptedReader(data string) io.Reader {
+	return io.MultiReader(strings.NewReader(data), iotest.ErrReader(errors.New("connection reset by peer")))
+}
+
+func TestCreateUploadValidation(t *testing.T) {
+	db := newTestDB(t)
+	files, cfg, _ := newTestFileService(t, db)
+	files.config.UploadMaxSize = 100
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "shop.example")
+	ctx := asUser(owner.ID, "user")
+
+	tests := []struct {
+		name  string
+		path  string
+		size  int64
+		field string
+	}{
+		{"empty", "public_html/a.zip", 0, "size"},
+		{"over the maximum", "public_html/a.zip", 101, "size"},
+		{"outside the domain", "../other.example/a.zip", 10, "path"},
+		{"absolute elsewhere", "/etc/passwd", 10, "path"},
+		{"the domain directory", ".", 10, "path"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := files.CreateUpload(ctx, domain.ID, tt.path, tt.size)
+			if fieldMessage(err, tt.field) == "" {
+				t.Errorf("CreateUpload(%q, %d) error = %v, want a %s error", tt.path, tt.size, err, tt.field)
+			}
+		})
+	}
+
+	if entries, _ := os.ReadDir(cfg.UploadDir); len(entries) != 0 {
+		t.Errorf("%d files staged by refused uploads", len(entries))
+	}
+	if _, err := files.CreateUpload(asUser(uuid.New(), "user"), domain.ID, "public_html/a.zip", 10); !apperrors.IsPermissionDenied(err) {
+		t.Errorf("upload into another user's domain: error = %v", err)
+	}
+}
+
+func TestCreateUploadQuota(t *testing.T) {
+	db := newTestDB(t)
+	files, _, _ := newTestFileService(t, db)
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "shop.example")
+	db.Model(domain).Updates(map[string]interface{}{"disk_quota": 1000, "disk_usage": 900})
+	ctx := asUser(owner.ID, "user")
+
+	if _, err := files.CreateUpload(ctx, domain.ID, "public_html/a.zip", 101); errorCode(err) != "upload_over_quota" {
+		t.Errorf("upload over the free quota: error = %v", err)
+	}
+	if _, err := files.CreateUpload(ctx, domain.ID, "public_html/a.zip", 100); err != nil {
+		t.Errorf("upload filling the quota: %v", err)
+	}
+
+	db.Model(domain).Update("disk_quota", 0)
+	if _, err := files.CreateUpload(ctx, domain.ID, "public_html/a.zip", 1<<40); err != nil {
+		t.Errorf("upload without a quota: %v", err)
+	}
+
+	db.Model(domain).Update("quota_blocked_at", time.Now())
+	if _, err := files.CreateUpload(ctx, domain.ID, "public_html/a.zip", 1); errorCode(err) != "disk_quota_exceeded" {
+		t.Errorf("upload into a blocked domain: error = %v", err)
+	}
+}
+
+func TestUploadReservesQuota(t *testing.T) {
+	db := newTestDB(t)
+	files, _, server := newTestFileService(t, db)
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "shop.example")
+	db.Model(domain).Updates(map[string]interface{}{"disk_quota": 1000, "disk_usage": 900})
+	ctx := asUser(owner.ID, "user")
+
+	first, err := files.CreateUpload(ctx, domain.ID, "public_html/a.zip", 60)
+	if err != nil {
+		t.Fatalf("CreateUpload() error = %v", err)
+	}
+	// The first upload's 60 bytes are reserved although none have arrived yet
+	if _, err := files.CreateUpload(ctx, domain.ID, "public_html/b.zip", 60); errorCode(err) != "upload_over_quota" {
+		t.Fatalf("upload over the space left by another upload: error = %v", err)
+	}
+	if _, err := files.CreateUpload(ctx, domain.ID, "public_html/b.zip", 40); err != nil {
+		t.Fatalf("upload into the space left: %v", err)
+	}
+
+	// Cancelling frees the reservation, and so does an upload given up until it expired
+	if err := files.CancelUpload(ctx, first.ID); err != nil {
+		t.Fatalf("CancelUpload() error = %v", err)
+	}
+	lapsed, err := files.CreateUpload(ctx, domain.ID, "public_html/c.zip", 60)
+	if err != nil {
+		t.Fatalf("upload after a cancelled one: %v", err)
+	}
+	server.Del(uploadKey(lapsed.ID))
+	if _, err := files.CreateUpload(ctx, domain.ID, "public_html/d.zip", 60); err != nil {
+		t.Errorf("upload after an expired one: %v", err)
+	}
+}
+
+// lockStealingReader replaces the upload's lock with another holder's while the chunk is read,
+// as when the chunk outlives its lock and another chunk takes the upload
+type lockStealingReader struct {
+	server *miniredis.Miniredis
+	key    string
+	data   io.Reader
+}
+
+func (r *lockStealingReader) Read(p []byte) (int, error) {
+	r.server.Set(r.key, "other-chunk")
+	return r.data.Read(p)
+}
+
+func TestUploadResumesAfterInterruption(t *testing.T) {
+	db := newTestDB(t)
+	files, cfg, _ := newTestFileService(t, db)
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "shop.example")
+	ctx := asUser(owner.ID, "user")
+
+	upload, err := files.CreateUpload(ctx, domain.ID, "public_html/backup.tar", 10)
+	if err != nil {
+		t.Fatalf("CreateUpload() error = %v", err)
+	}
+	if upload.Offset != 0 || upload.Path != domainRoot("shop.example")+"/public_html/backup.tar" || !uploadIDPattern.MatchString(upload.ID) {
+		t.Errorf("upload = %+v", upload)
+	}
+
+	if upload, err = files.WriteChunk(ctx, upload.ID, 0, strings.NewReader("abc")); err != nil || upload.Offset != 3 {
+		t.Fatalf("first chunk: offset %v, error %v", upload, err)
+	}
+
+	// The connection drops during the second chunk, and what arrived of it is kept
+	if _, err := files.WriteChunk(ctx, upload.ID, 3, interruptedReader("de")); err == nil || !strings.Contains(err.Error(), "interrupted after 5 bytes") {
+		t.Errorf("interrupted chunk: error = %v", err)
+	}
+	resumed, err := files.GetUpload(ctx, upload.ID)
+	if err != nil || resumed.Offset != 5 || resumed.Completed {
+		t.Fatalf("GetUpload() after the interruption = %+v, %v", resumed, err)
+	}
+
+	// A retry of the whole chunk is told where to continue
+	_, err = files.WriteChunk(ctx, upload.ID, 3, strings.NewReader("defghij"))
+	if errorCode(err) != "upload_offset_mismatch" || apperrors.HTTPStatus(err) != http.StatusConflict {
+		t.Errorf("chunk at a stale offset: error = %v", err)
+	}
+	var precondition *apperrors.PreconditionError
+	if errors.As(err, &precondition) && precondition.MessageParams["offset"] != "5" {
+		t.Errorf("offset mismatch reports %v, want 5", precondition.MessageParams)
+	}
+
+	// Nothing beyond the size is taken
+	if _, err := files.WriteChunk(ctx, upload.ID, 5, strings.NewReader("fghijk")); fieldMessage(err, "body") == "" {
+		t.Errorf("chunk past the size: error = %v", err)
+	}
+	if resumed, _ := files.GetUpload(ctx, upload.ID); resumed.Offset != 5 {
+		t.Errorf("offset after a refused chunk = %d, want 5", resumed.Offset)
+	}
+	staged, _ := os.ReadFile(filepath.Join(cfg.UploadDir, upload.ID))
+	if string(staged) != "abcde" {
+		t.Errorf("staged data = %q, want abcde", staged)
+	}
+
+	// Another user cannot see or continue the upload, an admin can see it
+	other := asUser(uuid.New(), "user")
+	if _, err := files.GetUpload(other, upload.ID); apperrors.HTTPStatus(err) != http.StatusNotFound {
+		t.Errorf("another user's GetUpload() error = %v", err)
+	}
+	if _, err := files.WriteChunk(other, upload.ID, 5, strings.NewReader("fghij")); apperrors.HTTPStatus(err) != http.StatusNotFound {
+		t.Errorf("another user's WriteChunk() error = %v", err)
+	}
+	if _, err := files.GetUpload(asUser(uuid.New(), "admin"), upload.ID); err != nil {
+		t.Errorf("admin GetUpload() error = %v", err)
+	}
+	if _, err := files.GetUpload(ctx, "../../etc/passwd"); apperrors.HTTPStatus(err) != http.StatusNotFound {
+		t.Errorf("GetUpload() of a malformed id: error = %v", err)
+	}
+}
+
+func TestUploadChunkLocking(t *testing.T) {
+	db := newTestDB(t)
+	files, _, server := newTestFileService(t, db)
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "shop.example")
+	ctx := asUser(owner.ID, "user")
+
+	upload, err := files.CreateUpload(ctx, domain.ID, "public_html/a.bin", 10)
+	if err != nil {
+		t.Fatalf("CreateUpload() error = %v", err)
+	}
+
+	// A chunk still being written holds the upload
+	server.Set(uploadLockKey(upload.ID), "1")
+	if _, err := files.WriteChunk(ctx, upload.ID, 0, strings.NewReader("abc")); errorCode(err) != "upload_busy" {
+		t.Errorf("chunk during another chunk: error = %v", err)
+	}
+	server.Del(uploadLockKey(upload.ID))
+	if _, err := files.WriteChunk(ctx, upload.ID, 0, strings.NewReader("abc")); err != nil {
+		t.Errorf("chunk after the lock was released: %v", err)
+	}
+	if server.Exists(uploadLockKey(upload.ID)) {
+		t.Error("chunk left its lock behind")
+	}
+
+	// A chunk that lost its lock leaves the new holder's lock alone
+	stealer := &lockStealingReader{server: server, key: uploadLockKey(upload.ID), data: strings.NewReader("def")}
+	if _, err := files.WriteChunk(ctx, upload.ID, 3, stealer); err != nil {
+		t.Fatalf("WriteChunk() error = %v", err)
+	}
+	if held, _ := server.Get(uploadLockKey(upload.ID)); held != "other-chunk" {
+		t.Errorf("lock = %q, want the other chunk's lock kept", held)
+	}
+	server.Del(uploadLockKey(upload.ID))
+
+	// Uploads into a domain blocked meanwhile stop
+	db.Model(domain).Update("quota_blocked_at", time.Now())
+	if _, err := files.WriteChunk(ctx, upload.ID, 6, strings.NewReader("ghi")); errorCode(err) != "disk_quota_exceeded" {
+		t.Errorf("chunk into a blocked domain: error = %v", err)
+	}
+}
+
+func TestUploadExpiry(t *testing.T) {
+	db := newTestDB(t)
+	files, cfg, server := newTestFileService(t, db)
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "shop.example")
+	ctx := asUser(owner.ID, "user")
+
+	upload, err := files.CreateUpload(ctx, domain.ID, "public_html/a.bin", 10)
+	if err != nil {
+		t.Fatalf("CreateUpload() error = %v", err)
+	}
+
+	// Every chunk extends the upload
+	server.FastForward(45 * time.Minute)
+	if _, err := files.WriteChunk(ctx, upload.ID, 0, strings.NewReader("abc")); err != nil {
+		t.Fatalf("chunk before expiry: %v", err)
+	}
+	server.FastForward(45 * time.Minute)
+	if _, err := files.GetUpload(ctx, upload.ID); err != nil {
+		t.Errorf("upload expired within the TTL of its last chunk: %v", err)
+	}
+	server.FastForward(time.Hour)
+	if _, err := files.GetUpload(ctx, upload.ID); apperrors.HTTPStatus(err) != http.StatusNotFound {
+		t.Errorf("GetUpload() after expiry: error = %v", err)
+	}
+
+	// Staged data is purged once it is older than the TTL, unless the upload is still alive
+	live, err := files.CreateUpload(ctx, domain.ID, "public_html/b.bin", 10)
+	if err != nil {
+		t.Fatalf("CreateUpload() error = %v", err)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	for _, id := range []string{upload.ID, live.ID} {
+		os.Chtimes(filepath.Join(cfg.UploadDir, id), old, old)
+	}
+	purged, err := files.PurgeStaleUploads(context.Background())
+	if err != nil || purged != 1 {
+		t.Fatalf("PurgeStaleUploads() = %d, %v, want 1", purged, err)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.UploadDir, upload.ID)); !errors.Is(err, os.ErrNotExist) {
+		t.Error("expired upload's data was kept")
+	}
+	if _, err := os.Stat(filepath.Join(cfg.UploadDir, live.ID)); err != nil {
+		t.Errorf("live upload's data was purged: %v", err)
+	}
+}
+
+func TestCancelUpload(t *testing.T) {
+	db := newTestDB(t)
+	files, cfg, _ := newTestFileService(t, db)
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "shop.example")
+	ctx := asUser(owner.ID, "user")
+
+	upload, err := files.CreateUpload(ctx, domain.ID, "public_html/a.bin", 10)
+	if err != nil {
+		t.Fatalf("CreateUpload() error = %v", err)
+	}
+	if err := files.CancelUpload(asUser(uuid.New(), "user"), upload.ID); apperrors.HTTPStatus(err) != http.StatusNotFound {
+		t.Errorf("another user's CancelUpload() error = %v", err)
+	}
+	if err := files.CancelUpload(ctx, upload.ID); err != nil {
+		t.Fatalf("CancelUpload() error = %v", err)
+	}
+	if _, err := files.GetUpload(ctx, upload.ID); apperrors.HTTPStatus(err) != http.StatusNotFound {
+		t.Errorf("GetUpload() after cancelling: error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.UploadDir, upload.ID)); !errors.Is(err, os.ErrNotExist) {
+		t.Error("cancelled upload's data was kept")
+	}
+}
+
+func TestUploadCompletes(t *testing.T) {
+	db := newTestDB(t)
+	files, cfg, server := newTestFileService(t, db)
+	owner := createTestUser(t, db)
+
+	// Completed uploads land in the domain's directory under the web root
+	name := "upload-" + uuid.NewString()[:8] + ".test"
+	root := domainRoot(name)
+	if err := os.MkdirAll(root, 0755); err != nil {
+		t.Skipf("web root not writable: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(root) })
+	domain := createTestDomain(t, db, owner, name)
+	ctx := asUser(owner.ID, "user")
+
+	upload, err := files.CreateUpload(ctx, domain.ID, "public_html/site/backup.tar", 8)
+	if err != nil {
+		t.Fatalf("CreateUpload() error = %v", err)
+	}
+	if _, err := files.WriteChunk(ctx, upload.ID, 0, interruptedReader("back")); err == nil {
+		t.Fatal("interrupted chunk succeeded")
+	}
+	upload, err = files.WriteChunk(ctx, upload.ID, 4, strings.NewReader("up!!"))
+	if err != nil || !upload.Completed || upload.Offset != 8 {
+		t.Fatalf("last chunk = %+v, %v", upload, err)
+	}
+
+	target := filepath.Join(root, "public_html/site/backup.tar")
+	data, err := os.ReadFile(target)
+	if err != nil || string(data) != "backup!!" {
+		t.Errorf("uploaded file = %q, %v", data, err)
+	}
+	if info, err := os.Stat(target); err == nil && info.Mode().Perm() != 0644 {
+		t.Errorf("uploaded file mode = %v, want 0644", info.Mode().Perm())
+	}
+	if _, err := os.Stat(filepath.Join(cfg.UploadDir, upload.ID)); !errors.Is(err, os.ErrNotExist) {
+		t.Error("staged data kept after completion")
+	}
+	if _, err := files.GetUpload(ctx, upload.ID); apperrors.HTTPStatus(err) != http.StatusNotFound {
+		t.Errorf("GetUpload() after completion: error = %v", err)
+	}
+	if reserved, _ := server.HKeys(uploadReservationsKey(domain.ID)); len(reserved) != 0 {
+		t.Errorf("reservations kept after completion: %v", reserved)
+	}
+
+	// A symlink out of the domain's directory does not carry uploads along
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+	if _, err := files.CreateUpload(ctx, domain.ID, "escape/a.bin", 1); fieldMessage(err, "path") == "" {
+		t.Errorf("upload through a symlink out of the domain: error = %v", err)
+	}
+
+	// Existing files are replaced, directories are not
+	if _, err := files.CreateUpload(ctx, domain.ID, "public_html/site", 1); fieldMessage(err, "path") == "" {
+		t.Errorf("upload onto a directory: error = %v", err)
+	}
+	upload, err = files.CreateUpload(ctx, domain.ID, "public_html/site/backup.tar", 3)
+	if err != nil {
+		t.Fatalf("CreateUpload() over an existing file: %v", err)
+	}
+	if _, err := files.WriteChunk(ctx, upload.ID, 0, strings.NewReader("new")); err != nil {
+		t.Fatalf("replace: %v", err)
+	}
+	if data, _ := os.ReadFile(target); string(data) != "new" {
+		t.Errorf("replaced file = %q, want new", data)
+	}
+
+	var stored models.Domain
+	db.First(&stored, "id = ?", domain.ID)
+	if stored.QuotaBlockedAt != nil {
+		t.Error("upload blocked the domain")
+	}
+}
@@ -0,0 +1,318 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// ftpUsernamePattern matches the part of an FTP login before the @
+var ftpUsernamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,31}$`)
+
+const (
+	ftpPasswordMinLen = 8
+	// ftpShell is the shell of FTP logins; they never get a shell, so ProFTPD needs
+	// RequireValidShell off
+	ftpShell = "/sbin/nologin"
+)
+
+// ftpFileHeader marks the synced files as generated so manual edits are not expected to survive
+const ftpFileHeader = "# Managed by MyNodeCP. Changes made here are overwritten.\n"
+
+// FTPService manages the FTP/SFTP accounts of domains
+type FTPService struct {
+	db     *gorm.DB
+	redis  *redis.Client
+	logger *zap.Logger
+	config config.HostingConfig
+}
+
+// NewFTPService creates a new FTP service
+func NewFTPService(db *gorm.DB, redis *redis.Client, logger *zap.Logger, config config.HostingConfig) *FTPService {
+	return &FTPService{
+		db:     db,
+		redis:  redis,
+		logger: logger,
+		config: config,
+	}
+}
+
+// CreateFTPAccount creates an FTP account of a domain. An empty home directory gives access to
+// the whole domain directory; a relative one is taken from there.
+func (s *FTPService) CreateFTPAccount(ctx context.Context, domainID uuid.UUID, username, password, homeDir string, quotaMB int, readOnly bool) (*models.FTPAccount, error) {
+	var domain models.Domain
+	if err := s.db.WithContext(ctx).Where("id = ?", domainID).First(&domain).Error; err != nil {
+		return nil, apperrors.FromDB(err, "domain")
+	}
+
+	username = strings.ToLower(strings.TrimSpace(username))
+	v := apperrors.NewValidation()
+	if !ftpUsernamePattern.MatchString(username) {
+		v.AddCode("username", "ftp.username_invalid", nil)
+	}
+	if len(password) < ftpPasswordMinLen {
+		v.AddCode("password", "field.min_length", map[string]string{"min": strconv.Itoa(ftpPasswordMinLen)})
+	}
+	if quotaMB < 0 {
+		v.AddCode("quota_mb", "field.minimum", map[string]string{"min": "0"})
+	}
+	home, err := ftpHomeDir(&domain, homeDir)
+	if err != nil {
+		v.AddCode("home_dir", "ftp.home_outside", map[string]string{"root": domainRoot(domain.Name)})
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&models.FTPAccount{}).
+		Where("domain_id = ? AND username = ?", domainID, username).
+		Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("failed to check FTP account existence: %w", err)
+	}
+	if count > 0 {
+		return nil, apperrors.InvalidCode("username", "ftp.username_taken", nil)
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	account := &models.FTPAccount{
+		DomainID:     domainID,
+		Username:     username,
+		PasswordHash: string(hashedPassword),
+		HomeDir:      home,
+		QuotaMB:      quotaMB,
+		ReadOnly:     readOnly,
+		IsActive:     true,
+		Domain:       domain,
+	}
+	if err := s.db.WithContext(ctx).Omit("Domain").Create(account).Error; err != nil {
+		return nil, fmt.Errorf("failed to create FTP account: %w", err)
+	}
+
+	s.audit(ctx, "ftp_account.create", account)
+	s.sync(ctx)
+
+	return account, nil
+}
+
+// GetFTPAccounts retrieves the FTP accounts of a domain
+func (s *FTPService) GetFTPAccounts(ctx context.Context, domainID uuid.UUID) ([]*models.FTPAccount, error) {
+	var accounts []*models.FTPAccount
+	if err := s.db.WithContext(ctx).
+		Preload("Domain").
+		Where("domain_id = ?", domainID).
+		Order("username").
+		Find(&accounts).Error; err != nil {
+		return nil, fmt.Errorf("failed to get FTP accounts: %w", err)
+	}
+
+	return accounts, nil
+}
+
+// UpdateFTPAccount changes the password, home directory, quota, read-only flag or active state
+// of an FTP account
+func (s *FTPService) UpdateFTPAccount(ctx context.Context, accountID uuid.UUID, updates map[string]interface{}) (*models.FTPAccount, error) {
+	var account models.FTPAccount
+	if err := s.db.WithContext(ctx).Preload("Domain").Where("id = ?", accountID).First(&account).Error; err != nil {
+		return nil, apperrors.FromDB(err, "FTP account")
+	}
+
+	v := apperrors.NewValidation()
+	changes := make(map[string]interface{}, len(updates))
+	for field, value := range updates {
+		switch field {
+		case "password":
+			password, isString := value.(string)
+			if !isString || len(password) < ftpPasswordMinLen {
+				v.AddCode("password", "field.min_length", map[string]string{"min": strconv.Itoa(ftpPasswordMinLen)})
+				continue
+			}
+			hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+			if err != nil {
+				return nil, fmt.Errorf("failed to hash password: %w", err)
+			}
+			changes["password_hash"] = string(hashedPassword)
+		case "home_dir":
+			homeDir, isString := value.(string)
+			home, err := ftpHomeDir(&account.Domain, homeDir)
+			if !isString || err != nil {
+				v.AddCode("home_dir", "ftp.home_outside", map[string]string{"root": domainRoot(account.Domain.Name)})
+				continue
+			}
+			changes["home_dir"] = home
+		case "quota_mb":
+			quota, ok := quotaValue(value)
+			if !ok || quota < 0 {
+				v.AddCode("quota_mb", "field.minimum", map[string]string{"min": "0"})
+				continue
+			}
+			changes["quota_mb"] = quota
+		case "read_only", "is_active":
+			if _, isBool := value.(bool); !isBool {
+				v.AddCode(field, "field.boolean", nil)
+				continue
+			}
+			changes[field] = value
+		default:
+			v.AddCode(field, "field.unknown", nil)
+		}
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.WithContext(ctx).Model(&account).Updates(changes).Error; err != nil {
+		return nil, fmt.Errorf("failed to update FTP account: %w", err)
+	}
+	if err := s.db.WithContext(ctx).Preload("Domain").Where("id = ?", accountID).First(&account).Error; err != nil {
+		return nil, fmt.Errorf("failed to reload FTP account: %w", err)
+	}
+
+	s.audit(ctx, "ftp_account.update", &account)
+	s.sync(ctx)
+
+	return &account, nil
+}
+
+// DeleteFTPAccount deletes an FTP account
+func (s *FTPService) DeleteFTPAccount(ctx context.Context, accountID uuid.UUID) error {
+	var account models.FTPAccount
+	if err := s.db.WithContext(ctx).Preload("Domain").Where("id = ?", accountID).First(&account).Error; err != nil {
+		return apperrors.FromDB(err, "FTP account")
+	}
+
+	if err := s.db.WithContext(ctx).Where("id = ?", accountID).Delete(&models.FTPAccount{}).Error; err != nil {
+		return fmt.Errorf("failed to delete FTP account: %w", err)
+	}
+
+	s.audit(ctx, "ftp_account.delete", &account)
+	s.sync(ctx)
+
+	return nil
+}
+
+// SyncFTPUsers rewrites the FTP server's user file and read-only include from the active
+// accounts of domains that are not suspended
+func (s *FTPService) SyncFTPUsers(ctx context.Context) error {
+	var accounts []*models.FTPAccount
+	if err := s.db.WithContext(ctx).
+		Joins("Domain").
+		Where("ftp_accounts.is_active = ? AND Domain.suspended_at IS NULL", true).
+		Find(&accounts).Error; err != nil {
+		return fmt.Errorf("failed to get FTP accounts: %w", err)
+	}
+
+	if dryRun(ctx, s.config) {
+		s.logger.Info("Dry run: skipping FTP user sync", zap.String("path", s.config.FTPUsersFile), zap.Int("accounts", len(accounts)))
+		return nil
+	}
+
+	if err := writeFileAtomic(s.config.FTPUsersFile, FTPUsersContent(accounts, s.config.FTPUID, s.config.FTPGID), 0600); err != nil {
+		return fmt.Errorf("failed to write FTP users: %w", err)
+	}
+	if err := writeFileAtomic(s.config.FTPReadOnlyFile, FTPReadOnlyContent(accounts), 0644); err != nil {
+		return fmt.Errorf("failed to write FTP read-only rules: %w", err)
+	}
+
+	return nil
+}
+
+// FTPUsersContent renders accounts as a ProFTPD AuthUserFile, one passwd-style line per account
+// sorted by login. Each account is confined to its home directory by the server's DefaultRoot.
+func FTPUsersContent(accounts []*models.FTPAccount, uid, gid int) string {
+	var b strings.Builder
+	b.WriteString(ftpFileHeader)
+	for _, account := range sortedFTPAccounts(accounts) {
+		fmt.Fprintf(&b, "%s:%s:%d:%d::%s:%s\n", account.Login(), account.PasswordHash, uid, gid, account.HomeDir, ftpShell)
+	}
+	return b.String()
+}
+
+// FTPReadOnlyContent renders the ProFTPD rules that deny writes to read-only accounts
+func FTPReadOnlyContent(accounts []*models.FTPAccount) string {
+	var b strings.Builder
+	b.WriteString(ftpFileHeader)
+	for _, account := range sortedFTPAccounts(accounts) {
+		if !account.ReadOnly {
+			continue
+		}
+		fmt.Fprintf(&b, "<IfUser %s>\n  <Limit WRITE>\n    DenyAll\n  </Limit>\n</IfUser>\n", account.Login())
+	}
+	return b.String()
+}
+
+func sortedFTPAccounts(accounts []*models.FTPAccount) []*models.FTPAccount {
+	sorted := append([]*models.FTPAccount(nil), accounts...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Login() < sorted[j].Login() })
+	return sorted
+}
+
+// ftpHomeDir resolves an FTP account's home directory, which must stay inside the domain's
+// directory. An empty one is the domain directory itself.
+func ftpHomeDir(domain *models.Domain, homeDir string) (string, error) {
+	root := domainRoot(domain.Name)
+	if strings.TrimSpace(homeDir) == "" {
+		return root, nil
+	}
+	if strings.ContainsAny(homeDir, ":\n") {
+		return "", fmt.Errorf("home directory contains invalid characters")
+	}
+	return resolveWithin(root, homeDir)
+}
+
+// writeFileAtomic replaces a file through a temporary file so readers never see a partial one
+func writeFileAtomic(path, content string, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(content), perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// sync updates the FTP server after a change; failures are logged since the change is already stored
+func (s *FTPService) sync(ctx context.Context) {
+	if err := s.SyncFTPUsers(ctx); err != nil {
+		s.logger.Error("Failed to sync FTP users", zap.Error(err))
+	}
+}
+
+func (s *FTPService) audit(ctx context.Context, action string, account *models.FTPAccount) {
+	resourceID := account.ID.String()
+	auditLog := &models.AuditLog{
+		UserID:     actorFromContext(ctx),
+		Action:     action,
+		Resource:   "ftp_account",
+		ResourceID: &resourceID,
+		Details:    fmt.Sprintf("login=%s home=%s read_only=%t", account.Login(), account.HomeDir, account.ReadOnly),
+		Success:    true,
+	}
+	if err := s.db.WithContext(ctx).Create(auditLog).Error; err != nil {
+		s.logger.Error("Failed to record audit log", zap.Error(err))
+	}
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestFTPHomeDir(t *testing.T) {
+	domain := &models.Domain{Name: "shop.example"}
+	root := domainRoot(domain.Name)
+
+	tests := []struct {
+		homeDir string
+		want    string
+		invalid bool
+	}{
+		{homeDir: "", want: root},
+		{homeDir: "  ", want: root},
+		{homeDir: "public_html", want: root + "/public_html"},
+		{homeDir: "uploads/../public_html/", want: root + "/public_html"},
+		{homeDir: root + "/logs", want: root + "/logs"},
+		{homeDir: root, want: root},
+		{homeDir: "..", invalid: true},
+		{homeDir: "public_html/../../other.example", invalid: true},
+		{homeDir: root + "-evil", invalid: true},
+		{homeDir: "/etc", invalid: true},
+		{homeDir: "a:b", invalid: true},
+		{homeDir: "a\nb", invalid: true},
+	}
+	for _, tt := range tests {
+		got, err := ftpHomeDir(domain, tt.homeDir)
+		if tt.invalid {
+			if err == nil {
+				t.Errorf("ftpHomeDir(%q) = %q, want an error", tt.homeDir, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ftpHomeDir(%q) = %q, %v, want %q", tt.homeDir, got, err, tt.want)
+		}
+	}
+}
+
+func TestFTPSyncContent(t *testing.T) {
+	shop := models.Domain{Name: "shop.example"}
+	blog := models.Domain{Name: "blog.example"}
+	accounts := []*models.FTPAccount{
+		{Username: "web", PasswordHash: "$2a$10$web", HomeDir: "/var/www/shop.example/public_html", Domain: shop},
+		{Username: "backup", PasswordHash: "$2a$10$backup", HomeDir: "/var/www/shop.example", ReadOnly: true, Domain: shop},
+		{Username: "author", PasswordHash: "$2a$10$author", HomeDir: "/var/www/blog.example", Domain: blog},
+	}
+
+	wantUsers := ftpFileHeader +
+		"author@blog.example:$2a$10$author:33:33::/var/www/blog.example:/sbin/nologin\n" +
+		"backup@shop.example:$2a$10$backup:33:33::/var/www/shop.example:/sbin/nologin\n" +
+		"web@shop.example:$2a$10$web:33:33::/var/www/shop.example/public_html:/sbin/nologin\n"
+	if got := FTPUsersContent(accounts, 33, 33); got != wantUsers {
+		t.Errorf("FTPUsersContent() =\n%s\nwant:\n%s", got, wantUsers)
+	}
+
+	wantReadOnly := ftpFileHeader + "<IfUser backup@shop.example>\n  <Limit WRITE>\n    DenyAll\n  </Limit>\n</IfUser>\n"
+	if got := FTPReadOnlyContent(accounts); got != wantReadOnly {
+		t.Errorf("FTPReadOnlyContent() =\n%s\nwant:\n%s", got, wantReadOnly)
+	}
+}
+
+func TestCreateFTPAccountValidation(t *testing.T) {
+	db := newTestDB(t)
+	ftp := NewFTPService(db, nil, zap.NewNop(), testHostingConfig(t))
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "shop.example")
+	ctx := asUser(owner.ID)
+
+	if _, err := ftp.CreateFTPAccount(ctx, domain.ID, "web", "longenough", "", 0, false); err != nil {
+		t.Fatalf("CreateFTPAccount() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		homeDir  string
+		quota    int
+		field    string
+	}{
+		{"bad username", "-web", "longenough", "", 0, "username"},
+		{"short password", "other", "short", "", 0, "password"},
+		{"negative quota", "other", "longenough", "", -1, "quota_mb"},
+		{"home outside", "other", "longenough", "../other.example", 0, "home_dir"},
+		{"taken", " WEB ", "longenough", "", 0, "username"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ftp.CreateFTPAccount(ctx, domain.ID, tt.username, tt.password, tt.homeDir, tt.quota, false)
+			if fieldMessage(err, tt.field) == "" {
+				t.Errorf("error = %v, want one for %s", err, tt.field)
+			}
+		})
+	}
+
+	if _, err := ftp.CreateFTPAccount(ctx, domain.ID, "web", "longenough", "", 0, false); apperrors.HTTPStatus(err) != http.StatusUnprocessableEntity {
+		t.Errorf("duplicate login: error = %v", err)
+	}
+}
+
+func TestFTPAccountLifecycleSyncs(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	cfg.FTPUID, cfg.FTPGID = 33, 33
+	ftp := NewFTPService(db, nil, zap.NewNop(), cfg)
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "shop.example")
+	ctx := asUser(owner.ID)
+
+	readFile := func(path string) string {
+		t.Helper()
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("read %s: %v", path, err)
+		}
+		return string(content)
+	}
+
+	account, err := ftp.CreateFTPAccount(ctx, domain.ID, "Web", "longenough", "public_html", 100, true)
+	if err != nil {
+		t.Fatalf("CreateFTPAccount() error = %v", err)
+	}
+	if account.Username != "web" || account.HomeDir != domainRoot("shop.example")+"/public_html" {
+		t.Errorf("account = %+v", account)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte("longenough")) != nil {
+		t.Error("password is not stored as a bcrypt hash")
+	}
+	users := readFile(cfg.FTPUsersFile)
+	if !strings.Contains(users, "web@shop.example:"+account.PasswordHash+":33:33::"+account.HomeDir+":/sbin/nologin\n") {
+		t.Errorf("users file:\n%s", users)
+	}
+	if info, _ := os.Stat(cfg.FTPUsersFile); info.Mode().Perm() != 0600 {
+		t.Errorf("users file mode = %v, want 0600", info.Mode().Perm())
+	}
+	if !strings.Contains(readFile(cfg.FTPReadOnlyFile), "<IfUser web@shop.example>") {
+		t.Error("read-only account missing from the read-only rules")
+	}
+
+	if _, err := ftp.UpdateFTPAccount(ctx, account.ID, map[string]interface{}{"home_dir": "/etc"}); fieldMessage(err, "home_dir") == "" {
+		t.Errorf("home outside the domain: error = %v", err)
+	}
+	if _, err := ftp.UpdateFTPAccount(ctx, account.ID, map[string]interface{}{"shell": "/bin/sh"}); fieldMessage(err, "shell") == "" {
+		t.Errorf("unknown field: error = %v", err)
+	}
+	if _, err := ftp.UpdateFTPAccount(ctx, account.ID, map[string]interface{}{"read_only": false}); err != nil {
+		t.Fatalf("UpdateFTPAccount() error = %v", err)
+	}
+	if strings.Contains(readFile(cfg.FTPReadOnlyFile), "web@shop.example") {
+		t.Error("writable account still in the read-only rules")
+	}
+	if _, err := ftp.UpdateFTPAccount(ctx, account.ID, map[string]interface{}{"is_active": false}); err != nil {
+		t.Fatalf("UpdateFTPAccount() error = %v", err)
+	}
+	if strings.Contains(readFile(cfg.FTPUsersFile), "web@shop.example") {
+		t.Error("inactive account still synced")
+	}
+
+	// Accounts of suspended domains are left out too
+	if _, err := ftp.UpdateFTPAccount(ctx, account.ID, map[string]interface{}{"is_active": true}); err != nil {
+		t.Fatalf("UpdateFTPAccount() error = %v", err)
+	}
+	now := time.Now()
+	db.Model(domain).Update("suspended_at", &now)
+	if err := ftp.SyncFTPUsers(ctx); err != nil {
+		t.Fatalf("SyncFTPUsers() error = %v", err)
+	}
+	if strings.Contains(readFile(cfg.FTPUsersFile), "web@shop.example") {
+		t.Error("account of a suspended domain synced")
+	}
+
+	if err := ftp.DeleteFTPAccount(ctx, account.ID); err != nil {
+		t.Fatalf("DeleteFTPAccount() error = %v", err)
+	}
+	var audits []models.AuditLog
+	db.Where("resource = ? AND resource_id = ?", "ftp_account", account.ID.String()).Order("created_at").Find(&audits)
+	if len(audits) != 5 || audits[0].Action != "ftp_account.create" || audits[4].Action != "ftp_account.delete" {
+		t.Errorf("audit entries = %d", len(audits))
+	}
+}
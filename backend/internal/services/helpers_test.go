@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/database"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/runner"
+)
+
+// newTestDB opens an in-memory database of its own for a test, with the schema migrated
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := "file:" + uuid.NewString() + "?mode=memory&cache=shared&_busy_timeout=5000"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("test database handle: %v", err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+
+	return db
+}
+
+// newTestRedis starts an in-memory Redis server for a test
+func newTestRedis(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+	t.Helper()
+
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return client, server
+}
+
+// asUser returns a context authenticated as the user, with the given roles
+func asUser(userID uuid.UUID, roles ...string) context.Context {
+	ctx := context.WithValue(context.Background(), "user_id", userID)
+	return context.WithValue(ctx, "roles", roles)
+}
+
+// createTestUser stores an active user with a unique name
+func createTestUser(t *testing.T, db *gorm.DB) *models.User {
+	t.Helper()
+
+	name := "user" + uuid.NewString()[:8]
+	user := &models.User{
+		Username:     name,
+		Email:        name + "@example.net",
+		PasswordHash: "x",
+		IsActive:     true,
+	}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+// createTestDomain stores a domain owned by the user
+func createTestDomain(t *testing.T, db *gorm.DB, owner *models.User, name string) *models.Domain {
+	t.Helper()
+
+	domain := &models.Domain{
+		UserID:       owner.ID,
+		Name:         name,
+		DocumentRoot: "/var/www/" + name + "/public_html",
+		IsActive:     true,
+		EmailEnabled: true,
+	}
+	if err := db.Create(domain).Error; err != nil {
+		t.Fatalf("create domain: %v", err)
+	}
+	return domain
+}
+
+// testHostingConfig returns a hosting configuration whose directories are inside a temporary
+// directory of the test
+func testHostingConfig(t *testing.T) config.HostingConfig {
+	t.Helper()
+
+	dir := t.TempDir()
+	return config.HostingConfig{
+		VhostDir:            dir + "/vhosts",
+		SSLDir:              dir + "/ssl",
+		PHPFPMSocketDir:     dir + "/run",
+		PHPPoolDir:          dir + "/pools",
+		PHPCGIDir:           dir + "/cgi",
+		ZoneDir:             dir + "/zones",
+		LogDir:              dir + "/logs",
+		BackupDir:           dir + "/backups",
+		HomeDir:             dir + "/home",
+		HtpasswdDir:         dir + "/htpasswd",
+		UploadDir:           dir + "/uploads",
+		SuspendedPageDir:    dir + "/suspended",
+		FTPUsersFile:        dir + "/ftpd.passwd",
+		FTPReadOnlyFile:     dir + "/ftpd.readonly",
+		ServerIPv4:          "192.0.2.10",
+		DNSDefaultTTL:       3600,
+		SubdomainDNSCleanup: "all",
+		AccessLogFormat:     "combined",
+		LandingPage:         "none",
+	}
+}
+
+// newTestDomainService creates a domain service on db whose commands go to the returned fake.
+// Its zones are published by a DNS service on the same database.
+func newTestDomainService(t *testing.T, db *gorm.DB, cfg config.HostingConfig) (*DomainService, *runner.Fake) {
+	t.Helper()
+
+	fake := runner.NewFake()
+	domains := NewDomainService(db, nil, zap.NewNop(), cfg, nil, nil, fake)
+	domains.SetZonePublisher(NewDNSService(db, nil, zap.NewNop(), cfg, nil, domains))
+	return domains, fake
+}
+
+// newTestDNSService creates a DNS service on db with the domain service it is built on
+func newTestDNSService(t *testing.T, db *gorm.DB, cfg config.HostingConfig) (*DNSService, *DomainService) {
+	t.Helper()
+
+	domains, _ := newTestDomainService(t, db, cfg)
+	return domains.zones.(*DNSService), domains
+}
+
+// errorCode returns the message code of a coded error, or "" for other errors and nil
+func errorCode(err error) string {
+	var coded apperrors.Coded
+	if !errors.As(err, &coded) {
+		return ""
+	}
+	return coded.Code()
+}
+
+// fieldMessage returns the message of a field of a validation error, or "" when there is none
+func fieldMessage(err error, field string) string {
+	validation, ok := apperrors.AsValidation(err)
+	if !ok {
+		return ""
+	}
+	return validation.Fields[field]
+}
+
+// runnerFailure is a canned result of a command that fails with output on stderr
+func runnerFailure(stderr string) runner.Result {
+	return runner.Result{Stderr: []byte(stderr), Err: errors.New("exit status 1")}
+}
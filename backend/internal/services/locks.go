@@ -0,0 +1,32 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/lock"
+)
+
+// lockDomain takes the lock of a domain for the length of a long-running operation on it, so
+// operations that would conflict, such as a rename while a certificate is issued, run one at a
+// time across panel instances
+func lockDomain(ctx context.Context, locks *lock.Locker, domainID uuid.UUID) (*lock.Lock, error) {
+	return acquire(ctx, locks, "domain:"+domainID.String())
+}
+
+// lockDomainName takes the lock of a domain name, so two operations cannot both take it
+func lockDomainName(ctx context.Context, locks *lock.Locker, name string) (*lock.Lock, error) {
+	return acquire(ctx, locks, "domain_name:"+name)
+}
+
+// acquire takes the lock of a resource, reporting a lock held elsewhere as the domain being busy
+func acquire(ctx context.Context, locks *lock.Locker, resource string) (*lock.Lock, error) {
+	held, err := locks.Acquire(ctx, resource)
+	if errors.Is(err, lock.ErrBusy) {
+		return nil, apperrors.PreconditionCode("resource_busy", map[string]string{"resource": "domain"})
+	}
+	return held, err
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/lock"
+)
+
+func TestDomainOperationsRejectedWhileLocked(t *testing.T) {
+	db := newTestDB(t)
+	client, _ := newTestRedis(t)
+	cfg := testHostingConfig(t)
+	cfg.ACMEDirectoryURL = "https://acme.invalid/directory"
+	locks := lock.New(client, time.Minute, 0)
+	domains, _ := newTestDomainService(t, db, cfg)
+	domains.locks = locks
+	ssl := NewSSLService(db, nil, zap.NewNop(), cfg, domains, nil, nil, locks)
+	backups, _ := newTestBackupService(t)
+	backups.db = db
+	backups.locks = locks
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "locked.example")
+	ctx := asUser(owner.ID, "admin")
+
+	// Another operation, perhaps on another panel instance, holds the domain
+	held, err := locks.Acquire(context.Background(), "domain:"+domain.ID.String())
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+
+	operations := []struct {
+		name string
+		run  func() error
+	}{
+		{"rename", func() error { _, err := domains.Rename(ctx, domain.ID, "renamed.example"); return err }},
+		{"suspend", func() error { _, err := domains.Suspend(ctx, domain.ID, "abuse"); return err }},
+		{"unsuspend", func() error { _, err := domains.Unsuspend(ctx, domain.ID); return err }},
+		{"PHP settings", func() error { _, err := domains.SetPHPSettings(ctx, domain.ID, PHPSettings{}); return err }},
+		{"clone", func() error { _, err := domains.CloneConfig(ctx, domain.ID, "clone.example", false); return err }},
+		{"delete", func() error { return domains.DeleteDomain(ctx, domain.ID) }},
+		{"certificate", func() error { _, err := ssl.GenerateCertificate(ctx, domain.ID, nil); return err }},
+		{"backup", func() error {
+			_, err := backups.CreateBackup(ctx, owner.ID, domain.ID, BackupTypeFiles, "")
+			return err
+		}},
+	}
+	for _, op := range operations {
+		t.Run(op.name, func(t *testing.T) {
+			if err := op.run(); errorCode(err) != "resource_busy" {
+				t.Errorf("error = %v, want the domain reported busy", err)
+			}
+		})
+	}
+
+	// Once released, the domain can be worked on again
+	held.Release()
+	if _, err := domains.Suspend(ctx, domain.ID, "abuse"); err != nil {
+		t.Errorf("Suspend() after the release error = %v", err)
+	}
+}
+
+func TestCreateDomainLocksName(t *testing.T) {
+	db := newTestDB(t)
+	client, _ := newTestRedis(t)
+	locks := lock.New(client, time.Minute, 0)
+	domains, _ := newTestDomainService(t, db, testHostingConfig(t))
+	domains.locks = locks
+	owner := createTestUser(t, db)
+	ctx := asUser(owner.ID)
+
+	// A name being taken, by a creation or a rename, cannot be taken at the same time
+	held, err := locks.Acquire(context.Background(), "domain_name:new.example")
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if _, err := domains.CreateDomain(ctx, owner.ID, "new.example", nil); errorCode(err) != "resource_busy" {
+		t.Errorf("CreateDomain() error = %v, want the name reported busy", err)
+	}
+	if _, err := domains.CreateDomain(ctx, owner.ID, "other.example", nil); err != nil {
+		t.Errorf("CreateDomain() of another name error = %v", err)
+	}
+	held.Release()
+	if _, err := domains.CreateDomain(ctx, owner.ID, "new.example", nil); err != nil {
+		t.Errorf("CreateDomain() after the release error = %v", err)
+	}
+}
@@ -0,0 +1,239 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/cache"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// Node roles
+var nodeRoles = map[string]bool{
+	"web":      true,
+	"dns":      true,
+	"mail":     true,
+	"database": true,
+}
+
+// NodeRegistration describes a server being added to the panel
+type NodeRegistration struct {
+	Name          string   `json:"name"`
+	Hostname      string   `json:"hostname"`
+	IPAddress     string   `json:"ip_address"`
+	IPv6Address   string   `json:"ipv6_address"` // Optional
+	Roles         []string `json:"roles"`
+	AgentEndpoint string   `json:"agent_endpoint"`
+	IsDefault     bool     `json:"is_default"`
+
+	// Capacities in bytes for the overcommit guard; 0 leaves them unchecked
+	DiskCapacity      int64 `json:"disk_capacity"`
+	BandwidthCapacity int64 `json:"bandwidth_capacity"`
+}
+
+// NodeService handles managed server operations
+type NodeService struct {
+	db     *gorm.DB
+	redis  *redis.Client
+	logger *zap.Logger
+	config config.HostingConfig
+	dns    *DNSService
+	cache  *cache.Cache
+}
+
+// NewNodeService creates a new node service
+func NewNodeService(db *gorm.DB, redis *redis.Client, logger *zap.Logger, config config.HostingConfig, dns *DNSService, cache *cache.Cache) *NodeService {
+	return &NodeService{
+		db:     db,
+		redis:  redis,
+		logger: logger,
+		config: config,
+		dns:    dns,
+		cache:  cache,
+	}
+}
+
+// RegisterNode adds a managed server
+func (s *NodeService) RegisterNode(ctx context.Context, req NodeRegistration) (*models.Node, error) {
+	v := apperrors.NewValidation()
+	if req.Name == "" {
+		v.AddCode("name", "field.required", nil)
+	}
+	if req.Hostname == "" {
+		v.AddCode("hostname", "field.required", nil)
+	}
+	if ip := net.ParseIP(req.IPAddress); ip == nil || ip.To4() == nil {
+		v.AddCode("ip_address", "node.ipv4_invalid", nil)
+	}
+	if req.IPv6Address != "" {
+		if ip := net.ParseIP(req.IPv6Address); ip == nil || ip.To4() != nil {
+			v.AddCode("ipv6_address", "node.ipv6_invalid", nil)
+		}
+	}
+	for _, role := range req.Roles {
+		if !nodeRoles[role] {
+			v.AddCode("roles", "node.role_unknown", map[string]string{"role": role})
+			break
+		}
+	}
+	if req.AgentEndpoint != "" {
+		endpoint, err := url.Parse(req.AgentEndpoint)
+		if err != nil || (endpoint.Scheme != "https" && endpoint.Scheme != "http") || endpoint.Host == "" {
+			v.AddCode("agent_endpoint", "node.endpoint_invalid", nil)
+		}
+	}
+	if req.DiskCapacity < 0 {
+		v.AddCode("disk_capacity", "field.minimum", map[string]string{"min": "0"})
+	}
+	if req.BandwidthCapacity < 0 {
+		v.AddCode("bandwidth_capacity", "field.minimum", map[string]string{"min": "0"})
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	roles, err := json.Marshal(req.Roles)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode node roles: %w", err)
+	}
+
+	node := &models.Node{
+		Name:          req.Name,
+		Hostname:      req.Hostname,
+		IPAddress:     req.IPAddress,
+		IPv6Address:   req.IPv6Address,
+		Roles:         string(roles),
+		AgentEndpoint: req.AgentEndpoint,
+		IsDefault:     req.IsDefault,
+		IsActive:      true,
+
+		DiskCapacity:      req.DiskCapacity,
+		BandwidthCapacity: req.BandwidthCapacity,
+	}
+
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Only one node receives new domains
+		if node.IsDefault {
+			if err := tx.Model(&models.Node{}).Where("is_default = ?", true).Update("is_default", false).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Create(node).Error
+	}); err != nil {
+		return nil, fmt.Errorf("failed to register node: %w", err)
+	}
+
+	s.logger.Info("Node registered",
+		zap.String("node", node.Name),
+		zap.String("hostname", node.Hostname),
+		zap.String("ip", node.IPAddress))
+
+	return node, nil
+}
+
+// GetNodes retrieves all managed servers
+func (s *NodeService) GetNodes(ctx context.Context) ([]*models.Node, error) {
+	var nodes []*models.Node
+	if err := s.db.WithContext(ctx).Order("name").Find(&nodes).Error; err != nil {
+		return nil, fmt.Errorf("failed to get nodes: %w", err)
+	}
+
+	return nodes, nil
+}
+
+// GetNode retrieves a managed server by ID
+func (s *NodeService) GetNode(ctx context.Context, nodeID uuid.UUID) (*models.Node, error) {
+	var node models.Node
+	if err := s.db.WithContext(ctx).Where("id = ?", nodeID).First(&node).Error; err != nil {
+		return nil, apperrors.FromDB(err, "node")
+	}
+
+	return &node, nil
+}
+
+// AssignDomain moves a domain to a node and repoints the A and AAAA records that targeted the
+// previous server. AAAA records are removed when the node has no IPv6 address.
+func (s *NodeService) AssignDomain(ctx context.Context, domainID, nodeID uuid.UUID) (*models.Domain, error) {
+	var domain models.Domain
+	if err := s.db.WithContext(ctx).Preload("Node").Where("id = ?", domainID).First(&domain).Error; err != nil {
+		return nil, apperrors.FromDB(err, "domain")
+	}
+
+	node, err := s.GetNode(ctx, nodeID)
+	if err != nil {
+		return nil, err
+	}
+	if !node.IsActive {
+		return nil, fmt.Errorf("node is not active")
+	}
+	quotas := &DomainQuotas{DiskQuota: domain.DiskQuota, BandwidthQuota: domain.BandwidthQuota}
+	if err := checkCapacity(ctx, s.db, s.logger, s.config, node, &domain.ID, quotas); err != nil {
+		return nil, err
+	}
+
+	previousIPv4, previousIPv6 := s.config.ServerIPv4, s.config.ServerIPv6
+	if domain.Node != nil {
+		previousIPv4, previousIPv6 = domain.Node.IPAddress, domain.Node.IPv6Address
+	}
+
+	if err := s.db.WithContext(ctx).Model(&domain).Update("node_id", node.ID).Error; err != nil {
+		return nil, fmt.Errorf("failed to assign domain to node: %w", err)
+	}
+	domain.NodeID = &node.ID
+	domain.Node = node
+
+	if err := s.repointRecords(ctx, domainID, "A", previousIPv4, node.IPAddress); err != nil {
+		return nil, err
+	}
+	if err := s.repointRecords(ctx, domainID, "AAAA", previousIPv6, node.IPv6Address); err != nil {
+		return nil, err
+	}
+
+	if err := s.cache.Invalidate(ctx, cache.DomainKey(domainID)); err != nil {
+		s.logger.Warn("Failed to invalidate domain cache", zap.String("domain_id", domainID.String()), zap.Error(err))
+	}
+
+	s.logger.Info("Domain assigned to node",
+		zap.String("domain", domain.Name),
+		zap.String("node", node.Name))
+
+	return &domain, nil
+}
+
+// repointRecords moves a domain's records of an address type from the previous server's address to
+// the new server's, or removes them when the new server has no address of that family
+func (s *NodeService) repointRecords(ctx context.Context, domainID uuid.UUID, recordType, previous, next string) error {
+	if previous == "" || previous == next {
+		return nil
+	}
+
+	var records []*models.DNSRecord
+	if err := s.db.WithContext(ctx).
+		Where("domain_id = ? AND type = ? AND value = ?", domainID, recordType, previous).
+		Find(&records).Error; err != nil {
+		return fmt.Errorf("failed to get DNS records: %w", err)
+	}
+	for _, record := range records {
+		var err error
+		if next == "" {
+			err = s.dns.DeleteDNSRecord(ctx, record.ID)
+		} else {
+			_, err = s.dns.UpdateDNSRecord(ctx, record.ID, map[string]interface{}{"value": next})
+		}
+		if err != nil {
+			s.logger.Error("Failed to repoint DNS record", zap.String("record_id", record.ID.String()), zap.Error(err))
+		}
+	}
+
+	return nil
+}
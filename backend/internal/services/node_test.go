@@ -0,0 +1,142 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestAssignDomainRepointsAddressRecords(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	cfg.ServerIPv6 = "2001:db8::10"
+	dns, _ := newTestDNSService(t, db, cfg)
+	nodes := NewNodeService(db, nil, zap.NewNop(), cfg, dns, nil)
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "moving.example")
+	ctx := asUser(owner.ID, "admin")
+
+	for _, record := range []models.DNSRecord{
+		{Type: "A", Name: "@", Value: "192.0.2.10"},
+		{Type: "A", Name: "www", Value: "192.0.2.10"},
+		{Type: "AAAA", Name: "@", Value: "2001:db8::10"},
+		{Type: "A", Name: "shop", Value: "203.0.113.7"},
+		{Type: "AAAA", Name: "shop", Value: "2001:db8::77"},
+	} {
+		record.DomainID = domain.ID
+		record.TTL = 3600
+		record.IsActive = true
+		if err := db.Create(&record).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	node, err := nodes.RegisterNode(ctx, NodeRegistration{Name: "web2", Hostname: "web2.panel.example", IPAddress: "198.51.100.5"})
+	if err != nil {
+		t.Fatalf("RegisterNode: %v", err)
+	}
+	if _, err := nodes.AssignDomain(ctx, domain.ID, node.ID); err != nil {
+		t.Fatalf("AssignDomain: %v", err)
+	}
+
+	var records []models.DNSRecord
+	db.Where("domain_id = ?", domain.ID).Order("name, type").Find(&records)
+	var got []string
+	for _, record := range records {
+		got = append(got, record.Type+" "+record.Name+" "+record.Value)
+	}
+	want := []string{
+		"A @ 198.51.100.5",
+		"A shop 203.0.113.7",
+		"AAAA shop 2001:db8::77",
+		"A www 198.51.100.5",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("records:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestAssignDomainRepointsAAAAToNodeIPv6(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	cfg.ServerIPv6 = "2001:db8::10"
+	dns, _ := newTestDNSService(t, db, cfg)
+	nodes := NewNodeService(db, nil, zap.NewNop(), cfg, dns, nil)
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "dualstack.example")
+	ctx := asUser(owner.ID, "admin")
+	db.Create(&models.DNSRecord{DomainID: domain.ID, Type: "AAAA", Name: "@", Value: "2001:db8::10", TTL: 3600, IsActive: true})
+
+	if _, err := nodes.RegisterNode(ctx, NodeRegistration{Name: "bad", Hostname: "bad.example", IPAddress: "198.51.100.6", IPv6Address: "198.51.100.6"}); err == nil {
+		t.Error("IPv4 address accepted as the node's IPv6 address")
+	}
+	node, err := nodes.RegisterNode(ctx, NodeRegistration{Name: "web3", Hostname: "web3.panel.example", IPAddress: "198.51.100.7", IPv6Address: "2001:db8::7"})
+	if err != nil {
+		t.Fatalf("RegisterNode: %v", err)
+	}
+	if _, err := nodes.AssignDomain(ctx, domain.ID, node.ID); err != nil {
+		t.Fatalf("AssignDomain: %v", err)
+	}
+
+	var record models.DNSRecord
+	db.Where("domain_id = ? AND type = ?", domain.ID, "AAAA").First(&record)
+	if record.Value != "2001:db8::7" {
+		t.Errorf("AAAA = %q, want the node's 2001:db8::7", record.Value)
+	}
+}
+
+func TestCreateDomainOnDefaultNodeUsesItsAddresses(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	dns, domains := newTestDNSService(t, db, cfg)
+	nodes := NewNodeService(db, nil, zap.NewNop(), cfg, dns, nil)
+	owner := createTestUser(t, db)
+	if _, err := nodes.RegisterNode(asUser(owner.ID, "admin"), NodeRegistration{Name: "web4", Hostname: "web4.panel.example", IPAddress: "198.51.100.8", IPv6Address: "2001:db8::8", IsDefault: true}); err != nil {
+		t.Fatalf("RegisterNode: %v", err)
+	}
+
+	domain, err := domains.CreateDomain(asUser(owner.ID), owner.ID, "noded.example", nil)
+	if err != nil {
+		t.Fatalf("CreateDomain: %v", err)
+	}
+
+	var records []models.DNSRecord
+	db.Where("domain_id = ? AND name = ?", domain.ID, "@").Where("type IN ?", []string{"A", "AAAA"}).Order("type").Find(&records)
+	if len(records) != 2 || records[0].Value != "198.51.100.8" || records[1].Value != "2001:db8::8" {
+		t.Errorf("apex address records = %+v, want the node's addresses", records)
+	}
+}
+
+func TestRegisterNodeValidation(t *testing.T) {
+	db := newTestDB(t)
+	nodes := NewNodeService(db, nil, zap.NewNop(), testHostingConfig(t), nil, nil)
+	ctx := asUser(createTestUser(t, db).ID, "admin")
+	valid := NodeRegistration{Name: "web5", Hostname: "web5.panel.example", IPAddress: "198.51.100.11"}
+
+	tests := []struct {
+		name   string
+		change func(*NodeRegistration)
+		field  string
+	}{
+		{"missing name", func(r *NodeRegistration) { r.Name = "" }, "name"},
+		{"missing hostname", func(r *NodeRegistration) { r.Hostname = "" }, "hostname"},
+		{"IPv6 as IPv4 address", func(r *NodeRegistration) { r.IPAddress = "2001:db8::11" }, "ip_address"},
+		{"IPv4 as IPv6 address", func(r *NodeRegistration) { r.IPv6Address = "198.51.100.11" }, "ipv6_address"},
+		{"unknown role", func(r *NodeRegistration) { r.Roles = []string{"web", "ftp"} }, "roles"},
+		{"agent endpoint without scheme", func(r *NodeRegistration) { r.AgentEndpoint = "web5.panel.example:9443" }, "agent_endpoint"},
+		{"negative disk capacity", func(r *NodeRegistration) { r.DiskCapacity = -1 }, "disk_capacity"},
+		{"negative bandwidth capacity", func(r *NodeRegistration) { r.BandwidthCapacity = -1 }, "bandwidth_capacity"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := valid
+			tt.change(&req)
+			if _, err := nodes.RegisterNode(ctx, req); fieldMessage(err, tt.field) == "" {
+				t.Fatalf("RegisterNode() error = %v, want a validation error on %s", err, tt.field)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+)
+
+func TestMissingRecordsAreNotFound(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	dns, domains := newTestDNSService(t, db, cfg)
+	email := newTestEmailService(t, db, config.MailConfig{})
+	users := newTestUserService(t, db)
+	admin := createTestUser(t, db)
+	ctx := asUser(admin.ID, "admin")
+	missing := uuid.New()
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"domain", func() error { _, err := domains.GetDomain(ctx, missing); return err }},
+		{"subdomain", func() error { _, err := domains.UpdateSubdomain(ctx, missing, map[string]interface{}{}); return err }},
+		{"deleted subdomain", func() error { return domains.DeleteSubdomain(ctx, missing) }},
+		{"DNS record", func() error { _, err := dns.UpdateDNSRecord(ctx, missing, map[string]interface{}{}); return err }},
+		{"deleted DNS record", func() error { return dns.DeleteDNSRecord(ctx, missing) }},
+		{"email account", func() error { _, err := email.UpdateEmailAccount(ctx, missing, map[string]interface{}{}); return err }},
+		{"user", func() error { _, err := users.GetUser(ctx, missing); return err }},
+		{"role", func() error { return users.AssignRole(ctx, admin.ID, missing) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			if !apperrors.IsNotFound(err) {
+				t.Errorf("error = %v, want a NotFoundError", err)
+			}
+		})
+	}
+}
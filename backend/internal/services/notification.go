@@ -0,0 +1,286 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/i18n"
+	"github.com/mynodecp/mynodecp/backend/internal/mailer"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// Notification event types users set preferences for
+const (
+	NotificationQuotaAlert     = "quota_alert"
+	NotificationPHPDeprecation = "php_deprecation"
+	NotificationSecurity       = "security" // Urgent: always emailed immediately
+
+	// NotificationServiceDown tells admins the watchdog gave up restarting a service. It is
+	// urgent and has no preference.
+	NotificationServiceDown = "service_down"
+	// NotificationAbuseReport tells admins of a new abuse report. It has no preference.
+	NotificationAbuseReport = "abuse_report"
+)
+
+// Notification channels and frequencies
+const (
+	NotificationChannelEmail = "email"
+	NotificationChannelPanel = "panel" // Only listed in the panel
+	NotificationImmediate    = "immediate"
+	NotificationDigest       = "digest"
+	NotificationOff          = "off"
+)
+
+// notificationEventTypes lists the event types in the order preferences are returned
+var notificationEventTypes = []string{NotificationQuotaAlert, NotificationPHPDeprecation, NotificationSecurity}
+
+// urgentNotifications are emailed immediately whatever the user's preference
+var urgentNotifications = map[string]bool{NotificationSecurity: true, NotificationServiceDown: true}
+
+// maxDigestNotifications caps the notifications listed in one digest; the rest wait for the next
+const maxDigestNotifications = 200
+
+// NotificationService delivers notifications to users as their preferences ask: emailed at once,
+// collected into a periodic digest, or only listed in the panel
+type NotificationService struct {
+	db     *gorm.DB
+	logger *zap.Logger
+	mailer *mailer.Mailer
+}
+
+// NewNotificationService creates a new notification service
+func NewNotificationService(db *gorm.DB, logger *zap.Logger, mailer *mailer.Mailer) *NotificationService {
+	return &NotificationService{
+		db:     db,
+		logger: logger,
+		mailer: mailer,
+	}
+}
+
+// Notify notifies a user of an event. render is given the user's locale and returns the subject
+// and body. Nothing is recorded for event types the user turned off.
+func (s *NotificationService) Notify(ctx context.Context, userID uuid.UUID, eventType string, render func(locale string) (subject, body string)) error {
+	preference, err := s.preference(ctx, userID, eventType)
+	if err != nil {
+		return err
+	}
+	if preference.Frequency == NotificationOff {
+		return nil
+	}
+
+	var user models.User
+	if err := s.db.WithContext(ctx).Where("id = ?", userID).First(&user).Error; err != nil {
+		return apperrors.FromDB(err, "user")
+	}
+
+	locale := i18n.Resolve(user.Locale, "")
+	subject, body := render(locale)
+	email := preference.Channel == NotificationChannelEmail
+	notification := &models.Notification{
+		UserID:        userID,
+		EventType:     eventType,
+		Subject:       subject,
+		Body:          body,
+		DigestPending: email && preference.Frequency == NotificationDigest,
+	}
+	if err := s.db.WithContext(ctx).Create(notification).Error; err != nil {
+		return fmt.Errorf("failed to record notification: %w", err)
+	}
+
+	if !email || notification.DigestPending || s.mailer == nil || user.Email == "" {
+		return nil
+	}
+	if _, err := s.mailer.EnqueueLocale(ctx, user.Email, locale, "notification", map[string]string{
+		"Subject": subject,
+		"Body":    body,
+	}); err != nil {
+		return fmt.Errorf("failed to queue notification: %w", err)
+	}
+	if err := s.db.WithContext(ctx).Model(notification).Update("emailed_at", time.Now()).Error; err != nil {
+		s.logger.Error("Failed to record notification email", zap.String("notification_id", notification.ID.String()), zap.Error(err))
+	}
+
+	return nil
+}
+
+// preference returns how a user gets notifications of an event type: as set, or emailed
+// immediately when unset or urgent
+func (s *NotificationService) preference(ctx context.Context, userID uuid.UUID, eventType string) (*models.NotificationPreference, error) {
+	preference := &models.NotificationPreference{
+		UserID:    userID,
+		EventType: eventType,
+		Channel:   NotificationChannelEmail,
+		Frequency: NotificationImmediate,
+	}
+	if urgentNotifications[eventType] {
+		return preference, nil
+	}
+
+	var stored []*models.NotificationPreference
+	if err := s.db.WithContext(ctx).Where("user_id = ? AND event_type = ?", userID, eventType).Limit(1).Find(&stored).Error; err != nil {
+		return nil, fmt.Errorf("failed to get notification preference: %w", err)
+	}
+	if len(stored) > 0 {
+		return stored[0], nil
+	}
+	return preference, nil
+}
+
+// Preferences returns a user's preference for every event type, including the defaults of those
+// never set. Users read their own; admins any account's.
+func (s *NotificationService) Preferences(ctx context.Context, userID uuid.UUID) ([]*models.NotificationPreference, error) {
+	if err := authorizeOwner(ctx, userID, "user"); err != nil {
+		return nil, err
+	}
+
+	preferences := make([]*models.NotificationPreference, 0, len(notificationEventTypes))
+	for _, eventType := range notificationEventTypes {
+		preference, err := s.preference(ctx, userID, eventType)
+		if err != nil {
+			return nil, err
+		}
+		preferences = append(preferences, preference)
+	}
+	return preferences, nil
+}
+
+// SetPreferences sets how a user gets notifications of the given event types, leaving the others
+// as they are, and returns the preferences of every event type. Urgent event types can only be
+// emailed immediately.
+func (s *NotificationService) SetPreferences(ctx context.Context, userID uuid.UUID, preferences []models.NotificationPreference) ([]*models.NotificationPreference, error) {
+	if err := authorizeOwner(ctx, userID, "user"); err != nil {
+		return nil, err
+	}
+
+	v := apperrors.NewValidation()
+	known := make(map[string]bool, len(notificationEventTypes))
+	for _, eventType := range notificationEventTypes {
+		known[eventType] = true
+	}
+	rows := make([]*models.NotificationPreference, 0, len(preferences))
+	for _, preference := range preferences {
+		switch {
+		case !known[preference.EventType]:
+			v.AddCode("preferences", "notify.event_unknown", map[string]string{"type": preference.EventType})
+		case preference.Channel != NotificationChannelEmail && preference.Channel != NotificationChannelPanel:
+			v.AddCode("preferences", "field.enum", map[string]string{"values": NotificationChannelEmail + ", " + NotificationChannelPanel})
+		case preference.Frequency != NotificationImmediate && preference.Frequency != NotificationDigest && preference.Frequency != NotificationOff:
+			v.AddCode("preferences", "field.enum", map[string]string{"values": strings.Join([]string{NotificationImmediate, NotificationDigest, NotificationOff}, ", ")})
+		case urgentNotifications[preference.EventType] &&
+			(preference.Channel != NotificationChannelEmail || preference.Frequency != NotificationImmediate):
+			v.AddCode("preferences", "notify.urgent", map[string]string{"type": preference.EventType})
+		default:
+			rows = append(rows, &models.NotificationPreference{
+				UserID:    userID,
+				EventType: preference.EventType,
+				Channel:   preference.Channel,
+				Frequency: preference.Frequency,
+			})
+		}
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(rows) > 0 {
+		if err := s.db.WithContext(ctx).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "event_type"}},
+			DoUpdates: clause.AssignmentColumns([]string{"channel", "frequency", "updated_at"}),
+		}).Create(&rows).Error; err != nil {
+			return nil, fmt.Errorf("failed to save notification preferences: %w", err)
+		}
+	}
+
+	return s.Preferences(ctx, userID)
+}
+
+// Notifications lists a user's most recent notifications, newest first
+func (s *NotificationService) Notifications(ctx context.Context, userID uuid.UUID, limit int) ([]*models.Notification, error) {
+	var notifications []*models.Notification
+	if err := s.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&notifications).Error; err != nil {
+		return nil, fmt.Errorf("failed to get notifications: %w", err)
+	}
+	return notifications, nil
+}
+
+// SendDigests emails every user with notifications waiting for a digest one summary of them
+func (s *NotificationService) SendDigests(ctx context.Context) error {
+	var userIDs []uuid.UUID
+	if err := s.db.WithContext(ctx).Model(&models.Notification{}).
+		Where("digest_pending = ?", true).
+		Distinct("user_id").
+		Pluck("user_id", &userIDs).Error; err != nil {
+		return fmt.Errorf("failed to get pending digests: %w", err)
+	}
+
+	sent := 0
+	for _, userID := range userIDs {
+		if err := s.sendDigest(ctx, userID); err != nil {
+			s.logger.Error("Failed to send notification digest", zap.String("user_id", userID.String()), zap.Error(err))
+			continue
+		}
+		sent++
+	}
+	if sent > 0 {
+		s.logger.Info("Sent notification digests", zap.Int("users", sent))
+	}
+	return nil
+}
+
+// sendDigest queues one digest of a user's waiting notifications and takes them off the digest.
+// Those of a user without an email address are taken off too, so they do not pile up.
+func (s *NotificationService) sendDigest(ctx context.Context, userID uuid.UUID) error {
+	var notifications []*models.Notification
+	if err := s.db.WithContext(ctx).
+		Where("user_id = ? AND digest_pending = ?", userID, true).
+		Order("created_at").
+		Limit(maxDigestNotifications).
+		Find(&notifications).Error; err != nil {
+		return fmt.Errorf("failed to get notifications: %w", err)
+	}
+	if len(notifications) == 0 {
+		return nil
+	}
+
+	var user models.User
+	if err := s.db.WithContext(ctx).Where("id = ?", userID).First(&user).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	updates := map[string]interface{}{"digest_pending": false}
+	if s.mailer != nil && user.Email != "" {
+		name := user.FirstName
+		if name == "" {
+			name = user.Username
+		}
+		if _, err := s.mailer.EnqueueLocale(ctx, user.Email, i18n.Resolve(user.Locale, ""), "notification_digest", map[string]interface{}{
+			"Name":          name,
+			"Notifications": notifications,
+		}); err != nil {
+			return fmt.Errorf("failed to queue digest: %w", err)
+		}
+		updates["emailed_at"] = time.Now()
+	}
+
+	ids := make([]uuid.UUID, len(notifications))
+	for i, notification := range notifications {
+		ids[i] = notification.ID
+	}
+	if err := s.db.WithContext(ctx).Model(&models.Notification{}).Where("id IN ?", ids).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to mark notifications sent: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/mailer"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// newTestNotificationService creates a notification service that queues its mail in db's outbox
+func newTestNotificationService(t *testing.T, db *gorm.DB) *NotificationService {
+	t.Helper()
+
+	return NewNotificationService(db, zap.NewNop(), mailer.NewWithSender(db, config.MailConfig{}, zap.NewNop(), nil))
+}
+
+// outbox returns the emails queued for address, oldest first
+func outbox(t *testing.T, db *gorm.DB, address string) []models.OutboxEmail {
+	t.Helper()
+
+	var emails []models.OutboxEmail
+	if err := db.Where("`to` = ?", address).Order("created_at").Find(&emails).Error; err != nil {
+		t.Fatalf("read outbox: %v", err)
+	}
+	return emails
+}
+
+// rendered renders a notification the same way in every locale
+func rendered(subject string) func(string) (string, string) {
+	return func(string) (string, string) { return subject, subject + " happened" }
+}
+
+func TestNotifyFollowsPreferences(t *testing.T) {
+	tests := []struct {
+		name        string
+		eventType   string
+		preference  *models.NotificationPreference
+		wantStored  bool
+		wantPending bool
+		wantEmailed bool
+	}{
+		{name: "default", eventType: NotificationQuotaAlert, wantStored: true, wantEmailed: true},
+		{name: "email immediately", eventType: NotificationQuotaAlert, preference: &models.NotificationPreference{Channel: NotificationChannelEmail, Frequency: NotificationImmediate}, wantStored: true, wantEmailed: true},
+		{name: "email digest", eventType: NotificationQuotaAlert, preference: &models.NotificationPreference{Channel: NotificationChannelEmail, Frequency: NotificationDigest}, wantStored: true, wantPending: true},
+		{name: "panel only", eventType: NotificationPHPDeprecation, preference: &models.NotificationPreference{Channel: NotificationChannelPanel, Frequency: NotificationImmediate}, wantStored: true},
+		{name: "off", eventType: NotificationPHPDeprecation, preference: &models.NotificationPreference{Channel: NotificationChannelEmail, Frequency: NotificationOff}},
+		// Stored preferences of urgent types are ignored
+		{name: "urgent set to off", eventType: NotificationSecurity, preference: &models.NotificationPreference{Channel: NotificationChannelPanel, Frequency: NotificationOff}, wantStored: true, wantEmailed: true},
+		{name: "urgent without preferences", eventType: NotificationServiceDown, wantStored: true, wantEmailed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			notifications := newTestNotificationService(t, db)
+			user := createTestUser(t, db)
+			if tt.preference != nil {
+				tt.preference.UserID, tt.preference.EventType = user.ID, tt.eventType
+				mustCreate(t, db, tt.preference)
+			}
+
+			if err := notifications.Notify(context.Background(), user.ID, tt.eventType, rendered("Disk almost full")); err != nil {
+				t.Fatalf("Notify() error = %v", err)
+			}
+
+			var stored []models.Notification
+			db.Where("user_id = ?", user.ID).Find(&stored)
+			if (len(stored) == 1) != tt.wantStored || len(stored) > 1 {
+				t.Fatalf("%d notifications stored, want stored %v", len(stored), tt.wantStored)
+			}
+			emails := outbox(t, db, user.Email)
+			if (len(emails) == 1) != tt.wantEmailed || len(emails) > 1 {
+				t.Errorf("%d emails queued, want emailed %v", len(emails), tt.wantEmailed)
+			}
+			if !tt.wantStored {
+				return
+			}
+			n := stored[0]
+			if n.EventType != tt.eventType || n.Subject != "Disk almost full" || n.Body != "Disk almost full happened" {
+				t.Errorf("notification = %+v", n)
+			}
+			if n.DigestPending != tt.wantPending || (n.EmailedAt != nil) != tt.wantEmailed {
+				t.Errorf("digest pending %v, emailed at %v; want pending %v, emailed %v", n.DigestPending, n.EmailedAt, tt.wantPending, tt.wantEmailed)
+			}
+			if tt.wantEmailed && !strings.Contains(emails[0].Body, "Disk almost full happened") {
+				t.Errorf("email body:\n%s", emails[0].Body)
+			}
+		})
+	}
+}
+
+func TestSendDigests(t *testing.T) {
+	db := newTestDB(t)
+	notifications := newTestNotificationService(t, db)
+	ctx := context.Background()
+	digest := createTestUser(t, db)
+	immediate := createTestUser(t, db)
+	for _, eventType := range []string{NotificationQuotaAlert, NotificationPHPDeprecation} {
+		mustCreate(t, db, &models.NotificationPreference{UserID: digest.ID, EventType: eventType, Channel: NotificationChannelEmail, Frequency: NotificationDigest})
+	}
+
+	notifications.Notify(ctx, digest.ID, NotificationQuotaAlert, rendered("Disk at 80%"))
+	notifications.Notify(ctx, digest.ID, NotificationPHPDeprecation, rendered("PHP 7.4 is going away"))
+	notifications.Notify(ctx, digest.ID, NotificationSecurity, rendered("Sending blocked"))
+	notifications.Notify(ctx, immediate.ID, NotificationQuotaAlert, rendered("Disk at 95%"))
+
+	// Only the urgent notification went out before the digest
+	if emails := outbox(t, db, digest.Email); len(emails) != 1 || !strings.Contains(emails[0].Body, "Sending blocked") {
+		t.Fatalf("emails before the digest = %+v", emails)
+	}
+
+	if err := notifications.SendDigests(ctx); err != nil {
+		t.Fatalf("SendDigests() error = %v", err)
+	}
+	emails := outbox(t, db, digest.Email)
+	if len(emails) != 2 || emails[1].Template != "notification_digest" {
+		t.Fatalf("emails after the digest = %+v", emails)
+	}
+	body := emails[1].Body
+	if !strings.Contains(emails[1].Subject, "2 new") || !strings.Contains(body, "Disk at 80%") || !strings.Contains(body, "PHP 7.4 is going away") || strings.Contains(body, "Sending blocked") {
+		t.Errorf("digest %q:\n%s", emails[1].Subject, body)
+	}
+	if got := outbox(t, db, immediate.Email); len(got) != 1 {
+		t.Errorf("user without digests got %d emails, want only the immediate one", len(got))
+	}
+	var pending int64
+	db.Model(&models.Notification{}).Where("digest_pending = ?", true).Count(&pending)
+	if pending != 0 {
+		t.Errorf("%d notifications still pending", pending)
+	}
+
+	// With nothing waiting no further digest goes out
+	if err := notifications.SendDigests(ctx); err != nil {
+		t.Fatalf("second SendDigests() error = %v", err)
+	}
+	if emails := outbox(t, db, digest.Email); len(emails) != 2 {
+		t.Errorf("%d emails after a second run, want 2", len(emails))
+	}
+}
+
+func TestSendDigestsWithoutAddress(t *testing.T) {
+	db := newTestDB(t)
+	notifications := newTestNotificationService(t, db)
+	user := createTestUser(t, db)
+	mustCreate(t, db, &models.Notification{UserID: user.ID, EventType: NotificationQuotaAlert, Subject: "Disk at 80%", DigestPending: true})
+	db.Model(user).Update("email", "")
+
+	if err := notifications.SendDigests(context.Background()); err != nil {
+		t.Fatalf("SendDigests() error = %v", err)
+	}
+	var n models.Notification
+	db.Where("user_id = ?", user.ID).First(&n)
+	if n.DigestPending || n.EmailedAt != nil {
+		t.Errorf("notification of a user without an address = %+v", n)
+	}
+	var queued int64
+	db.Model(&models.OutboxEmail{}).Count(&queued)
+	if queued != 0 {
+		t.Errorf("%d emails queued", queued)
+	}
+}
+
+func TestSetPreferences(t *testing.T) {
+	db := newTestDB(t)
+	notifications := newTestNotificationService(t, db)
+	user := createTestUser(t, db)
+	ctx := asUser(user.ID, "user")
+
+	preferences, err := notifications.Preferences(ctx, user.ID)
+	if err != nil || len(preferences) != len(notificationEventTypes) {
+		t.Fatalf("Preferences() = %v, %v", preferences, err)
+	}
+	for _, p := range preferences {
+		if p.Channel != NotificationChannelEmail || p.Frequency != NotificationImmediate {
+			t.Errorf("default preference = %+v", p)
+		}
+	}
+
+	set := func(eventType, channel, frequency string) error {
+		_, err := notifications.SetPreferences(ctx, user.ID, []models.NotificationPreference{{EventType: eventType, Channel: channel, Frequency: frequency}})
+		return err
+	}
+	rejected := []struct {
+		name                          string
+		eventType, channel, frequency string
+	}{
+		{"unknown event type", "newsletter", NotificationChannelEmail, NotificationDigest},
+		{"unknown channel", NotificationQuotaAlert, "sms", NotificationImmediate},
+		{"unknown frequency", NotificationQuotaAlert, NotificationChannelEmail, "weekly"},
+		{"urgent as a digest", NotificationSecurity, NotificationChannelEmail, NotificationDigest},
+		{"urgent in the panel", NotificationSecurity, NotificationChannelPanel, NotificationImmediate},
+	}
+	for _, tt := range rejected {
+		if err := set(tt.eventType, tt.channel, tt.frequency); fieldMessage(err, "preferences") == "" {
+			t.Errorf("%s: error = %v, want a preferences error", tt.name, err)
+		}
+	}
+
+	if err := set(NotificationQuotaAlert, NotificationChannelEmail, NotificationDigest); err != nil {
+		t.Fatalf("SetPreferences() error = %v", err)
+	}
+	// Setting it again updates the stored preference
+	preferences, err = notifications.SetPreferences(ctx, user.ID, []models.NotificationPreference{{EventType: NotificationQuotaAlert, Channel: NotificationChannelPanel, Frequency: NotificationImmediate}})
+	if err != nil {
+		t.Fatalf("SetPreferences() error = %v", err)
+	}
+	for _, p := range preferences {
+		want := NotificationChannelEmail
+		if p.EventType == NotificationQuotaAlert {
+			want = NotificationChannelPanel
+		}
+		if p.Channel != want || p.Frequency != NotificationImmediate {
+			t.Errorf("preference after update = %+v", p)
+		}
+	}
+	var stored int64
+	db.Model(&models.NotificationPreference{}).Where("user_id = ?", user.ID).Count(&stored)
+	if stored != 1 {
+		t.Errorf("%d preferences stored, want 1", stored)
+	}
+
+	other := asUser(createTestUser(t, db).ID, "user")
+	if _, err := notifications.Preferences(other, user.ID); !apperrors.IsPermissionDenied(err) {
+		t.Errorf("Preferences() of another user error = %v", err)
+	}
+	if _, err := notifications.SetPreferences(other, user.ID, nil); !apperrors.IsPermissionDenied(err) {
+		t.Errorf("SetPreferences() of another user error = %v", err)
+	}
+}
+
+func TestQuotaAlertsJoinTheDigest(t *testing.T) {
+	db := newTestDB(t)
+	notifications := newTestNotificationService(t, db)
+	cfg := testHostingConfig(t)
+	cfg.QuotaAlertThresholds = []int{80}
+	quotas := NewQuotaService(db, nil, zap.NewNop(), cfg, nil, notifications)
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "shop.example")
+	db.Model(domain).Updates(map[string]interface{}{"disk_quota": 1000, "disk_usage": 900})
+	mustCreate(t, db, &models.NotificationPreference{UserID: owner.ID, EventType: NotificationQuotaAlert, Channel: NotificationChannelEmail, Frequency: NotificationDigest})
+
+	if err := quotas.CheckUsage(context.Background()); err != nil {
+		t.Fatalf("CheckUsage() error = %v", err)
+	}
+	if emails := outbox(t, db, owner.Email); len(emails) != 0 {
+		t.Fatalf("quota alert emailed at once: %+v", emails)
+	}
+	if err := notifications.SendDigests(context.Background()); err != nil {
+		t.Fatalf("SendDigests() error = %v", err)
+	}
+	if emails := outbox(t, db, owner.Email); len(emails) != 1 || !strings.Contains(emails[0].Body, "shop.example") {
+		t.Errorf("digest = %+v", emails)
+	}
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/auth"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/i18n"
+	"github.com/mynodecp/mynodecp/backend/internal/mailer"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// Onboarding steps
+const (
+	OnboardingWelcomeEmail    = "welcome_email"
+	OnboardingStarterDomain   = "starter_domain"
+	OnboardingDefaultDatabase = "default_database"
+)
+
+// onboardingLabelInvalid matches the runs of characters a username cannot keep in a DNS label
+// or database name
+var onboardingLabelInvalid = regexp.MustCompile(`[^a-z0-9]+`)
+
+// onboarding is the state of one user's onboarding, shared by its steps
+type onboarding struct {
+	user   *models.User
+	domain *models.Domain // Set by the starter_domain step
+}
+
+// OnboardingService runs the configured provisioning steps after a user registers
+type OnboardingService struct {
+	logger   *zap.Logger
+	config   config.AuthConfig
+	mailer   *mailer.Mailer
+	domains  *DomainService
+	database *DatabaseService
+}
+
+// NewOnboardingService creates a new onboarding service
+func NewOnboardingService(logger *zap.Logger, config config.AuthConfig, mailer *mailer.Mailer, domains *DomainService, database *DatabaseService) *OnboardingService {
+	return &OnboardingService{
+		logger:   logger,
+		config:   config,
+		mailer:   mailer,
+		domains:  domains,
+		database: database,
+	}
+}
+
+// Onboard implements auth.Onboarder. Steps run in the configured order; a failed step is logged
+// and the next one still runs, though a default database cannot be created without a starter domain.
+func (s *OnboardingService) Onboard(ctx context.Context, user *models.User) []auth.OnboardingResult {
+	state := &onboarding{user: user}
+	results := make([]auth.OnboardingResult, 0, len(s.config.OnboardingSteps))
+
+	for _, step := range s.config.OnboardingSteps {
+		err := s.run(ctx, step, state)
+		if err != nil {
+			s.logger.Error("Onboarding step failed",
+				zap.String("step", step),
+				zap.String("user_id", user.ID.String()),
+				zap.Error(err))
+		}
+		results = append(results, auth.OnboardingResult{Step: step, Success: err == nil})
+	}
+
+	return results
+}
+
+func (s *OnboardingService) run(ctx context.Context, step string, state *onboarding) error {
+	switch step {
+	case OnboardingWelcomeEmail:
+		_, err := s.mailer.EnqueueLocale(ctx, state.user.Email, i18n.Resolve(state.user.Locale, ""), "welcome", map[string]string{
+			"Name":     displayName(state.user),
+			"Username": state.user.Username,
+		})
+		return err
+	case OnboardingStarterDomain:
+		domain, err := s.domains.CreateDomain(ctx, state.user.ID, starterDomainName(s.config.OnboardingDomain, state.user.Username), nil)
+		if err != nil {
+			return err
+		}
+		state.domain = domain
+		return nil
+	case OnboardingDefaultDatabase:
+		if state.domain == nil {
+			return fmt.Errorf("no starter domain to create the database on")
+		}
+		_, err := s.database.CreateDatabase(ctx, state.domain.ID, defaultDatabaseName(state.user.Username), "mysql")
+		return err
+	}
+	return fmt.Errorf("unknown onboarding step: %s", step)
+}
+
+// starterDomainName fills a username into the starter domain pattern, reduced to the characters
+// a DNS label can hold
+func starterDomainName(pattern, username string) string {
+	label := strings.Trim(onboardingLabelInvalid.ReplaceAllString(strings.ToLower(username), "-"), "-")
+	if len(label) > 63 {
+		label = strings.TrimRight(label[:63], "-")
+	}
+	return strings.ReplaceAll(pattern, "{username}", label)
+}
+
+// defaultDatabaseName derives a user's first database name from the username, within MySQL's
+// 64 character limit
+func defaultDatabaseName(username string) string {
+	name := strings.Trim(onboardingLabelInvalid.ReplaceAllString(strings.ToLower(username), "_"), "_")
+	if len(name) > 61 {
+		name = name[:61]
+	}
+	return name + "_db"
+}
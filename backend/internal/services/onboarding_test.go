@@ -0,0 +1,118 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/mynodecp/mynodecp/backend/internal/auth"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/mailer"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/runner"
+)
+
+func TestOnboardingNames(t *testing.T) {
+	tests := []struct {
+		username string
+		domain   string
+		database string
+	}{
+		{"alice", "alice.panel.example", "alice_db"},
+		{"Bob.Smith", "bob-smith.panel.example", "bob_smith_db"},
+		{"_x__y_", "x-y.panel.example", "x_y_db"},
+	}
+	for _, tt := range tests {
+		if got := starterDomainName("{username}.panel.example", tt.username); got != tt.domain {
+			t.Errorf("starterDomainName(%q) = %q, want %q", tt.username, got, tt.domain)
+		}
+		if got := defaultDatabaseName(tt.username); got != tt.database {
+			t.Errorf("defaultDatabaseName(%q) = %q, want %q", tt.username, got, tt.database)
+		}
+	}
+
+	long := strings.Repeat("abcdefghij", 7)
+	if got := starterDomainName("{username}.panel.example", long); len(got) != 63+len(".panel.example") {
+		t.Errorf("starterDomainName() of a %d character username = %q", len(long), got)
+	}
+	if got := defaultDatabaseName(long); len(got) != 64 {
+		t.Errorf("defaultDatabaseName() of a %d character username is %d characters", len(long), len(got))
+	}
+}
+
+func TestOnboard(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []string
+		taken bool // The starter domain exists already
+		want  []auth.OnboardingResult
+	}{
+		{
+			name:  "all steps",
+			steps: []string{OnboardingWelcomeEmail, OnboardingStarterDomain, OnboardingDefaultDatabase},
+			want:  []auth.OnboardingResult{{Step: "welcome_email", Success: true}, {Step: "starter_domain", Success: true}, {Step: "default_database", Success: true}},
+		},
+		{
+			name:  "failed domain",
+			steps: []string{OnboardingStarterDomain, OnboardingDefaultDatabase, OnboardingWelcomeEmail},
+			taken: true,
+			want:  []auth.OnboardingResult{{Step: "starter_domain", Success: false}, {Step: "default_database", Success: false}, {Step: "welcome_email", Success: true}},
+		},
+		{
+			name: "none",
+			want: []auth.OnboardingResult{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			cfg := testHostingConfig(t)
+			domains, _ := newTestDomainService(t, db, cfg)
+			databases := NewDatabaseService(db, nil, zap.NewNop(), cfg, runner.NewFake(), nil)
+			core, logs := observer.New(zap.ErrorLevel)
+			onboarding := NewOnboardingService(zap.New(core), config.AuthConfig{
+				OnboardingSteps:  tt.steps,
+				OnboardingDomain: "{username}.panel.example",
+			}, mailer.NewWithSender(db, config.MailConfig{}, zap.NewNop(), nil), domains, databases)
+
+			user := createTestUser(t, db)
+			if tt.taken {
+				createTestDomain(t, db, createTestUser(t, db), user.Username+".panel.example")
+			}
+
+			results := onboarding.Onboard(asUser(user.ID), user)
+			if !reflect.DeepEqual(results, tt.want) {
+				t.Fatalf("Onboard() = %+v, want %+v", results, tt.want)
+			}
+
+			failed := 0
+			for _, result := range tt.want {
+				if !result.Success {
+					failed++
+				}
+			}
+			if logs.Len() != failed {
+				t.Errorf("%d errors logged, want %d", logs.Len(), failed)
+			}
+
+			var welcomes, databaseCount int64
+			db.Model(&models.OutboxEmail{}).Where("template = ? AND `to` = ?", "welcome", user.Email).Count(&welcomes)
+			db.Model(&models.Database{}).Where("name = ?", defaultDatabaseName(user.Username)).Count(&databaseCount)
+			wantWelcome, wantDatabase := int64(0), int64(0)
+			for _, result := range tt.want {
+				if result.Step == OnboardingWelcomeEmail && result.Success {
+					wantWelcome = 1
+				}
+				if result.Step == OnboardingDefaultDatabase && result.Success {
+					wantDatabase = 1
+				}
+			}
+			if welcomes != wantWelcome || databaseCount != wantDatabase {
+				t.Errorf("welcome emails = %d, databases = %d, want %d and %d", welcomes, databaseCount, wantWelcome, wantDatabase)
+			}
+		})
+	}
+}
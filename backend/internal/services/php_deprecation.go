@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/cache"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/i18n"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// PHPDeprecationWarning warns that a PHP version is being retired
+type PHPDeprecationWarning struct {
+	Version     string    `json:"version"`
+	RemovedAt   time.Time `json:"removed_at"`
+	Removed     bool      `json:"removed"` // Past RemovedAt: the version can no longer be selected
+	Replacement string    `json:"replacement,omitempty"`
+}
+
+// phpDeprecation returns the warning for a PHP version under the configured deprecations, or
+// nil when the version is not deprecated. A version is removed from the start of its removal
+// date, in UTC.
+func phpDeprecation(deprecations []config.PHPDeprecation, version string, now time.Time) *PHPDeprecationWarning {
+	for _, deprecation := range deprecations {
+		if deprecation.Version != version {
+			continue
+		}
+		// Checked when the configuration was loaded
+		removedAt, err := time.Parse("2006-01-02", deprecation.RemovedAt)
+		if err != nil {
+			return nil
+		}
+		return &PHPDeprecationWarning{
+			Version:     deprecation.Version,
+			RemovedAt:   removedAt,
+			Removed:     !now.Before(removedAt),
+			Replacement: deprecation.Replacement,
+		}
+	}
+	return nil
+}
+
+// checkPHPVersionSelectable rejects switching to a PHP version past its removal date
+func (s *DomainService) checkPHPVersionSelectable(field, version string) error {
+	warning := phpDeprecation(s.config.PHPDeprecations, version, time.Now())
+	if warning == nil || !warning.Removed {
+		return nil
+	}
+	return apperrors.InvalidCode(field, "php.version_removed", map[string]string{
+		"version": version,
+		"date":    warning.RemovedAt.Format("2006-01-02"),
+	})
+}
+
+// PHPDeprecationService notifies owners of domains whose PHP version is being retired
+type PHPDeprecationService struct {
+	db     *gorm.DB
+	logger *zap.Logger
+	config config.HostingConfig
+	cache  *cache.Cache
+	now    func() time.Time
+
+	notifications *NotificationService
+}
+
+// NewPHPDeprecationService creates a new PHP deprecation service
+func NewPHPDeprecationService(db *gorm.DB, logger *zap.Logger, config config.HostingConfig, cache *cache.Cache, notifications *NotificationService) *PHPDeprecationService {
+	return &PHPDeprecationService{
+		db:     db,
+		logger: logger,
+		config: config,
+		cache:  cache,
+		now:    time.Now,
+
+		notifications: notifications,
+	}
+}
+
+// Notify emails the owners of domains running a deprecated PHP version. Each domain is notified
+// once per version; a domain moved to another deprecated version is notified again.
+func (s *PHPDeprecationService) Notify(ctx context.Context) error {
+	if len(s.config.PHPDeprecations) == 0 {
+		return nil
+	}
+	versions := make([]string, len(s.config.PHPDeprecations))
+	for i, deprecation := range s.config.PHPDeprecations {
+		versions[i] = deprecation.Version
+	}
+
+	var domains []models.Domain
+	if err := s.db.WithContext(ctx).
+		Where("php_version IN ? AND (php_deprecation_notice IS NULL OR php_deprecation_notice <> php_version)", versions).
+		Find(&domains).Error; err != nil {
+		return fmt.Errorf("failed to get domains on deprecated PHP versions: %w", err)
+	}
+
+	notified := 0
+	for i := range domains {
+		if s.notify(ctx, &domains[i]) {
+			notified++
+		}
+	}
+	if notified > 0 {
+		s.logger.Info("Notified owners of domains on deprecated PHP versions", zap.Int("domains", notified))
+	}
+	return nil
+}
+
+// notify notifies a domain's owner about its PHP version and records the notice. The notice is
+// recorded even when the notification cannot be sent, so a bad address is not retried every run.
+func (s *PHPDeprecationService) notify(ctx context.Context, domain *models.Domain) bool {
+	warning := phpDeprecation(s.config.PHPDeprecations, domain.PHPVersion, s.now())
+	if warning == nil {
+		return false
+	}
+
+	if s.notifications != nil {
+		if err := s.notifications.Notify(ctx, domain.UserID, NotificationPHPDeprecation, func(locale string) (string, string) {
+			params := map[string]string{
+				"name":        domain.Name,
+				"version":     warning.Version,
+				"date":        warning.RemovedAt.Format("2006-01-02"),
+				"replacement": warning.Replacement,
+			}
+			body := i18n.Translate(locale, "php.eol.body", params)
+			if warning.Replacement != "" {
+				body += " " + i18n.Translate(locale, "php.eol.upgrade", params)
+			}
+			return i18n.Translate(locale, "php.eol.subject", params), body
+		}); err != nil {
+			s.logger.Warn("Failed to send PHP deprecation notice", zap.String("domain", domain.Name), zap.Error(err))
+		}
+	}
+
+	if err := s.db.WithContext(ctx).Model(domain).UpdateColumn("php_deprecation_notice", domain.PHPVersion).Error; err != nil {
+		s.logger.Error("Failed to record PHP deprecation notice", zap.String("domain", domain.Name), zap.Error(err))
+		return false
+	}
+	if err := s.cache.Invalidate(ctx, cache.DomainKey(domain.ID)); err != nil {
+		s.logger.Warn("Failed to invalidate domain cache", zap.String("domain_id", domain.ID.String()), zap.Error(err))
+	}
+	return true
+}
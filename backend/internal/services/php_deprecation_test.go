@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// testPHPDeprecations retires 7.4, removed in the past, and 8.0, removed in the future
+func testPHPDeprecations() []config.PHPDeprecation {
+	return []config.PHPDeprecation{
+		{Version: "7.4", RemovedAt: "2020-01-01", Replacement: "8.2"},
+		{Version: "8.0", RemovedAt: time.Now().AddDate(1, 0, 0).Format("2006-01-02")},
+	}
+}
+
+func TestPHPDeprecation(t *testing.T) {
+	deprecations := []config.PHPDeprecation{{Version: "7.4", RemovedAt: "2025-06-01", Replacement: "8.2"}}
+	removal := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		version     string
+		now         time.Time
+		wantWarning bool
+		wantRemoved bool
+	}{
+		{"not deprecated", "8.2", removal, false, false},
+		{"before removal", "7.4", removal.Add(-time.Second), true, false},
+		{"on the removal date", "7.4", removal, true, true},
+		{"after removal", "7.4", removal.AddDate(1, 0, 0), true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warning := phpDeprecation(deprecations, tt.version, tt.now)
+			if (warning != nil) != tt.wantWarning {
+				t.Fatalf("phpDeprecation() = %+v, want a warning %v", warning, tt.wantWarning)
+			}
+			if warning == nil {
+				return
+			}
+			if warning.Removed != tt.wantRemoved || !warning.RemovedAt.Equal(removal) || warning.Replacement != "8.2" {
+				t.Errorf("warning = %+v", warning)
+			}
+		})
+	}
+}
+
+func TestSetPHPVersionPastRemoval(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	cfg.PHPDeprecations = testPHPDeprecations()
+	cfg.PHPHandlers = []string{"fpm"}
+	cfg.PHPModsDir = filepath.Join(t.TempDir(), "{version}", "mods-available")
+	for _, version := range []string{"7.4", "8.0", "8.2"} {
+		if err := os.MkdirAll(strings.ReplaceAll(cfg.PHPModsDir, "{version}", version), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	domains, _ := newTestDomainService(t, db, cfg)
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "legacy.example")
+	db.Model(domain).Update("php_version", "8.2")
+	ctx := asUser(owner.ID, "user")
+
+	if _, err := domains.SetPHPSettings(ctx, domain.ID, PHPSettings{Version: "7.4", Handler: "fpm"}); !strings.Contains(fieldMessage(err, "version"), "2020-01-01") {
+		t.Errorf("switch to a removed version: error = %v", err)
+	}
+	if _, err := domains.SetPHPSettings(ctx, domain.ID, PHPSettings{Version: "8.0", Handler: "fpm"}); err != nil {
+		t.Errorf("switch to a deprecated version before its removal: %v", err)
+	}
+
+	// A domain already on a removed version keeps it
+	db.Model(domain).Update("php_version", "7.4")
+	if _, err := domains.SetPHPSettings(ctx, domain.ID, PHPSettings{Version: "7.4", Handler: "fpm"}); err != nil {
+		t.Errorf("keeping a removed version: %v", err)
+	}
+
+	subdomain := &models.Subdomain{DomainID: domain.ID, Name: "shop", DocumentRoot: "/var/www/legacy.example/subdomains/shop", IsActive: true}
+	mustCreate(t, db, subdomain)
+	if _, err := domains.UpdateSubdomain(ctx, subdomain.ID, map[string]interface{}{"php_version": "7.4"}); fieldMessage(err, "php_version") == "" {
+		t.Errorf("subdomain switch to a removed version: error = %v", err)
+	}
+}
+
+func TestDomainStatsWarnsOfDeprecation(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	cfg.PHPDeprecations = testPHPDeprecations()
+	domains, _ := newTestDomainService(t, db, cfg)
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "legacy.example")
+	ctx := asUser(owner.ID, "user")
+
+	db.Model(domain).Update("php_version", "8.2")
+	stats, err := domains.GetDomainStats(ctx, domain.ID)
+	if err != nil {
+		t.Fatalf("GetDomainStats() error = %v", err)
+	}
+	if _, ok := stats["php_deprecation"]; ok {
+		t.Error("warning for a supported version")
+	}
+
+	db.Model(domain).Update("php_version", "8.0")
+	stats, _ = domains.GetDomainStats(ctx, domain.ID)
+	if warning, ok := stats["php_deprecation"].(*PHPDeprecationWarning); !ok || warning.Version != "8.0" || warning.Removed {
+		t.Errorf("php_deprecation = %#v", stats["php_deprecation"])
+	}
+
+	if _, err := domains.GetDomainStats(asUser(createTestUser(t, db).ID, "user"), domain.ID); !apperrors.IsPermissionDenied(err) {
+		t.Errorf("another user's stats: error = %v", err)
+	}
+}
+
+func TestPHPDeprecationNotify(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	cfg.PHPDeprecations = testPHPDeprecations()
+	deprecation := NewPHPDeprecationService(db, zap.NewNop(), cfg, nil, nil)
+	owner := createTestUser(t, db)
+	legacy := createTestDomain(t, db, owner, "legacy.example")
+	current := createTestDomain(t, db, owner, "current.example")
+	db.Model(legacy).Update("php_version", "7.4")
+	db.Model(current).Update("php_version", "8.2")
+	ctx := context.Background()
+	notice := func(domain *models.Domain) string {
+		var stored models.Domain
+		db.First(&stored, "id = ?", domain.ID)
+		return stored.PHPDeprecationNotice
+	}
+
+	if err := deprecation.Notify(ctx); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	if notice(legacy) != "7.4" || notice(current) != "" {
+		t.Errorf("notices = %q, %q", notice(legacy), notice(current))
+	}
+
+	// Moving to another deprecated version brings another notice
+	db.Model(legacy).Update("php_version", "8.0")
+	if err := deprecation.Notify(ctx); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	if notice(legacy) != "8.0" {
+		t.Errorf("notice after moving to 8.0 = %q", notice(legacy))
+	}
+}
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/cache"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/i18n"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// Quota metrics
+const (
+	QuotaMetricDisk      = "disk"
+	QuotaMetricBandwidth = "bandwidth"
+	QuotaMetricMailbox   = "mailbox"
+)
+
+// QuotaService alerts owners as their domains and mailboxes approach their quotas
+type QuotaService struct {
+	db     *gorm.DB
+	redis  *redis.Client
+	logger *zap.Logger
+	config config.HostingConfig
+	cache  *cache.Cache
+	now    func() time.Time
+
+	notifications *NotificationService
+}
+
+// NewQuotaService creates a new quota service
+func NewQuotaService(db *gorm.DB, redis *redis.Client, logger *zap.Logger, config config.HostingConfig, cache *cache.Cache, notifications *NotificationService) *QuotaService {
+	thresholds := append([]int(nil), config.QuotaAlertThresholds...)
+	sort.Ints(thresholds)
+	config.QuotaAlertThresholds = thresholds
+
+	return &QuotaService{
+		db:     db,
+		redis:  redis,
+		logger: logger,
+		config: config,
+		cache:  cache,
+		now:    time.Now,
+
+		notifications: notifications,
+	}
+}
+
+// quotaTarget is a resource whose usage is measured against a quota
+type quotaTarget struct {
+	resource string
+	id       uuid.UUID
+	name     string
+	ownerID  uuid.UUID
+}
+
+// CheckUsage compares the usage of every domain and mailbox with its quota, records newly crossed
+// thresholds and notifies owners. Each threshold alerts at most once per monthly cycle.
+func (s *QuotaService) CheckUsage(ctx context.Context) error {
+	var domains []*models.Domain
+	if err := s.db.WithContext(ctx).Find(&domains).Error; err != nil {
+		return fmt.Errorf("failed to get domains: %w", err)
+	}
+
+	for _, domain := range domains {
+		target := quotaTarget{resource: "domain", id: domain.ID, name: domain.Name, ownerID: domain.UserID}
+		diskFull := s.evaluate(ctx, target, QuotaMetricDisk, domain.DiskUsage, domain.DiskQuota)
+		s.evaluate(ctx, target, QuotaMetricBandwidth, domain.BandwidthUsage, domain.BandwidthQuota)
+
+		if s.config.QuotaEnforce {
+			s.setBlocked(ctx, &models.Domain{ID: domain.ID}, domain.QuotaBlockedAt, diskFull)
+		}
+	}
+
+	var accounts []*models.EmailAccount
+	if err := s.db.WithContext(ctx).Preload("Domain").Find(&accounts).Error; err != nil {
+		return fmt.Errorf("failed to get email accounts: %w", err)
+	}
+
+	for _, account := range accounts {
+		target := quotaTarget{
+			resource: "email_account",
+			id:       account.ID,
+			name:     account.Username + "@" + account.Domain.Name,
+			ownerID:  account.Domain.UserID,
+		}
+		full := s.evaluate(ctx, target, QuotaMetricMailbox, int64(account.UsedMB), int64(account.QuotaMB))
+
+		if s.config.QuotaEnforce {
+			s.setBlocked(ctx, &models.EmailAccount{ID: account.ID}, account.QuotaBlockedAt, full)
+		}
+	}
+
+	return nil
+}
+
+// GetAlerts returns the alerts of the current cycle whose usage is still above the threshold,
+// optionally only those of one owner
+func (s *QuotaService) GetAlerts(ctx context.Context, ownerID *uuid.UUID) ([]*models.QuotaAlert, error) {
+	query := s.db.WithContext(ctx).Where("cycle = ? AND resolved_at IS NULL", quotaCycle(s.now()))
+	if ownerID != nil {
+		query = query.Where("owner_id = ?", *ownerID)
+	}
+
+	var alerts []*models.QuotaAlert
+	if err := query.Order("threshold DESC, created_at").Find(&alerts).Error; err != nil {
+		return nil, fmt.Errorf("failed to get quota alerts: %w", err)
+	}
+
+	return alerts, nil
+}
+
+// evaluate records the thresholds a usage figure has crossed, resolves the ones it fell back below
+// and notifies the owner about the highest newly crossed threshold. It reports whether the quota is used up.
+func (s *QuotaService) evaluate(ctx context.Context, target quotaTarget, metric string, usage, quota int64) bool {
+	if quota <= 0 {
+		return false
+	}
+
+	cycle := quotaCycle(s.now())
+	percent := usage * 100 / quota
+	newlyCrossed := 0
+	for _, threshold := range s.config.QuotaAlertThresholds {
+		var alert models.QuotaAlert
+		err := s.db.WithContext(ctx).
+			Where("resource_id = ? AND metric = ? AND threshold = ? AND cycle = ?", target.id, metric, threshold, cycle).
+			First(&alert).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			s.logger.Error("Failed to load quota alert", zap.String("resource", target.name), zap.Error(err))
+			continue
+		}
+		exists := err == nil
+
+		switch {
+		case percent >= int64(threshold) && !exists:
+			alert = models.QuotaAlert{
+				OwnerID:      target.ownerID,
+				Resource:     target.resource,
+				ResourceID:   target.id,
+				ResourceName: target.name,
+				Metric:       metric,
+				Threshold:    threshold,
+				Cycle:        cycle,
+				Usage:        usage,
+				Quota:        quota,
+			}
+			if err := s.db.WithContext(ctx).Create(&alert).Error; err != nil {
+				// Another instance may have recorded it first; it sends the notification
+				s.logger.Warn("Failed to record quota alert", zap.String("resource", target.name), zap.Error(err))
+				continue
+			}
+			newlyCrossed = threshold
+
+		case percent >= int64(threshold):
+			// Already alerted this cycle; keep the figures current without notifying again
+			s.db.WithContext(ctx).Model(&alert).Updates(map[string]interface{}{"usage": usage, "quota": quota, "resolved_at": nil})
+
+		case exists && alert.ResolvedAt == nil:
+			s.db.WithContext(ctx).Model(&alert).Updates(map[string]interface{}{"usage": usage, "resolved_at": s.now()})
+		}
+	}
+
+	if newlyCrossed > 0 {
+		s.notify(ctx, target, metric, newlyCrossed, usage, quota)
+	}
+
+	return percent >= 100
+}
+
+// notify notifies the owner that a threshold was crossed, as their preferences for quota alerts ask
+func (s *QuotaService) notify(ctx context.Context, target quotaTarget, metric string, threshold int, usage, quota int64) {
+	if s.notifications == nil {
+		return
+	}
+
+	if err := s.notifications.Notify(ctx, target.ownerID, NotificationQuotaAlert, func(locale string) (string, string) {
+		params := map[string]string{
+			"name":      target.name,
+			"threshold": strconv.Itoa(threshold),
+			"metric":    i18n.Term(locale, metric),
+			"usage":     formatQuotaAmount(metric, usage),
+			"quota":     formatQuotaAmount(metric, quota),
+		}
+		body := i18n.Translate(locale, "quota.alert.body", params)
+		if threshold >= 100 && s.config.QuotaEnforce {
+			switch metric {
+			case QuotaMetricDisk:
+				body += " " + i18n.Translate(locale, "quota.blocked.disk", nil)
+			case QuotaMetricMailbox:
+				body += " " + i18n.Translate(locale, "quota.blocked.mailbox", nil)
+			}
+		}
+		return i18n.Translate(locale, "quota.alert.subject", params), body
+	}); err != nil {
+		s.logger.Error("Failed to send quota alert", zap.String("resource", target.name), zap.Error(err))
+	}
+}
+
+// setBlocked sets or clears the quota block on a domain or mailbox when it changes
+func (s *QuotaService) setBlocked(ctx context.Context, model interface{}, blockedAt *time.Time, blocked bool) {
+	if blocked == (blockedAt != nil) {
+		return
+	}
+
+	var value interface{}
+	if blocked {
+		value = s.now()
+	}
+	if err := s.db.WithContext(ctx).Model(model).Update("quota_blocked_at", value).Error; err != nil {
+		s.logger.Error("Failed to update quota block", zap.Error(err))
+		return
+	}
+	if domain, ok := model.(*models.Domain); ok {
+		if err := s.cache.Invalidate(ctx, cache.DomainKey(domain.ID)); err != nil {
+			s.logger.Warn("Failed to invalidate domain cache", zap.String("domain_id", domain.ID.String()), zap.Error(err))
+		}
+	}
+}
+
+// quotaCycle returns the monthly cycle alerts are deduplicated within
+func quotaCycle(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
+
+// formatQuotaAmount renders a usage figure; mailbox figures are in megabytes, the rest in bytes
+func formatQuotaAmount(metric string, amount int64) string {
+	if metric == QuotaMetricMailbox {
+		return fmt.Sprintf("%d MB", amount)
+	}
+	return fmt.Sprintf("%.1f GB", float64(amount)/(1<<30))
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/runner"
+)
+
+func TestPurgeKeepsRecentRows(t *testing.T) {
+	db := newTestDB(t)
+	audit := NewAuditService(db, nil, zap.NewNop())
+	system := NewSystemService(db, nil, zap.NewNop(), config.HostingConfig{}, runner.NewFake(), nil, nil, nil)
+	now := time.Now()
+	old, recent := now.Add(-31*24*time.Hour), now.Add(-29*24*time.Hour)
+	cutoff := now.Add(-30 * 24 * time.Hour)
+
+	for _, at := range []time.Time{old, recent} {
+		mustCreate(t, db, &models.AuditLog{Action: "update_domain", Resource: "domain", Success: true, CreatedAt: at})
+		mustCreate(t, db, &models.ChangeLog{Resource: "domains", ResourceID: "1", Action: "update", CreatedAt: at})
+		mustCreate(t, db, &models.SecurityEvent{Type: "login_failed", Severity: "medium", Source: "web", CreatedAt: at})
+		mustCreate(t, db, &models.SystemMetric{Type: "cpu", Unit: "percent", CreatedAt: at})
+	}
+
+	tests := []struct {
+		name  string
+		purge func(context.Context, time.Time) (int64, error)
+		model interface{}
+	}{
+		{"audit logs", audit.PurgeAuditLogs, &models.AuditLog{}},
+		{"change logs", audit.PurgeChangeLogs, &models.ChangeLog{}},
+		{"security events", audit.PurgeSecurityEvents, &models.SecurityEvent{}},
+		{"metrics", system.PurgeMetrics, &models.SystemMetric{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			purged, err := tt.purge(context.Background(), cutoff)
+			if err != nil || purged != 1 {
+				t.Fatalf("purge = %d, %v, want 1", purged, err)
+			}
+			var left int64
+			db.Model(tt.model).Where("created_at > ?", cutoff).Count(&left)
+			var total int64
+			db.Model(tt.model).Count(&total)
+			if total != 1 || left != 1 {
+				t.Errorf("%d rows left, %d of them recent, want only the recent one", total, left)
+			}
+		})
+	}
+}
+
+func TestPurgeBackups(t *testing.T) {
+	s, _ := newTestBackupService(t)
+	owner := createTestUser(t, s.db)
+	dir := t.TempDir()
+	now := time.Now()
+	cutoff := now.Add(-7 * 24 * time.Hour)
+
+	backup := func(name, status string, createdAt time.Time) *models.Backup {
+		path := filepath.Join(dir, name+".tar.gz")
+		writeTestFile(t, path, name)
+		b := &models.Backup{UserID: owner.ID, Type: BackupTypeFull, Name: name, FilePath: path, Status: status, CreatedAt: createdAt}
+		mustCreate(t, s.db, b)
+		return b
+	}
+	old := backup("old", "completed", now.Add(-8*24*time.Hour))
+	failed := backup("failed", "failed", now.Add(-8*24*time.Hour))
+	running := backup("running", "running", now.Add(-8*24*time.Hour))
+	recent := backup("recent", "completed", now.Add(-6*24*time.Hour))
+
+	purged, err := s.PurgeBackups(context.Background(), cutoff)
+	if err != nil || purged != 2 {
+		t.Fatalf("PurgeBackups() = %d, %v, want 2", purged, err)
+	}
+	for _, b := range []*models.Backup{old, failed} {
+		if _, err := os.Stat(b.FilePath); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("archive of %s kept", b.Name)
+		}
+		if err := s.db.Where("id = ?", b.ID).First(&models.Backup{}).Error; err == nil {
+			t.Errorf("backup %s kept", b.Name)
+		}
+	}
+	for _, b := range []*models.Backup{running, recent} {
+		if _, err := os.Stat(b.FilePath); err != nil {
+			t.Errorf("archive of %s removed: %v", b.Name, err)
+		}
+		if err := s.db.Where("id = ?", b.ID).First(&models.Backup{}).Error; err != nil {
+			t.Errorf("backup %s removed: %v", b.Name, err)
+		}
+	}
+}
+
+func TestPurgeBackupsKeepsUnremovableArchives(t *testing.T) {
+	s, _ := newTestBackupService(t)
+	owner := createTestUser(t, s.db)
+
+	// A directory in place of the archive cannot be removed with its contents
+	path := filepath.Join(t.TempDir(), "stuck.tar.gz")
+	writeTestFile(t, filepath.Join(path, "inside"), "x")
+	b := &models.Backup{UserID: owner.ID, Type: BackupTypeFull, Name: "stuck", FilePath: path, Status: "completed", CreatedAt: time.Now().Add(-48 * time.Hour)}
+	mustCreate(t, s.db, b)
+
+	purged, err := s.PurgeBackups(context.Background(), time.Now().Add(-24*time.Hour))
+	if err != nil || purged != 0 {
+		t.Fatalf("PurgeBackups() = %d, %v, want 0", purged, err)
+	}
+	if err := s.db.Where("id = ?", b.ID).First(&models.Backup{}).Error; err != nil {
+		t.Errorf("backup with an unremovable archive was deleted: %v", err)
+	}
+}
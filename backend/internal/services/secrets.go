@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/secret"
+)
+
+// reencryptBatchSize bounds the rows loaded at once by ReencryptSecrets
+const reencryptBatchSize = 100
+
+// secretColumns are the columns holding secret.String values
+var secretColumns = []struct {
+	model  interface{}
+	column string
+}{
+	{&models.User{}, "two_factor_secret"},
+	{&models.SSLCertificate{}, "private_key"},
+}
+
+// ReencryptSecrets rewrites secret columns still stored as plaintext, or encrypted with a key
+// other than the current one, with the current key, and returns how many values it rewrote.
+// Vault items are re-sealed the same way. Once it has run after a key rotation, the old key can
+// be removed. Without a key it does nothing.
+func (s *SystemService) ReencryptSecrets(ctx context.Context) (int64, error) {
+	keyring := secret.Current()
+	if keyring == nil {
+		return 0, nil
+	}
+	current := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(keyring.CurrentPrefix()) + "%"
+
+	var total int64
+	for _, c := range secretColumns {
+		for {
+			var rows []struct {
+				ID    uuid.UUID
+				Value secret.String
+			}
+			if err := s.db.WithContext(ctx).Unscoped().Model(c.model).
+				Select("id", c.column+" AS value").
+				Where(c.column+" <> '' AND "+c.column+" NOT LIKE ?", current).
+				Limit(reencryptBatchSize).
+				Scan(&rows).Error; err != nil {
+				return total, fmt.Errorf("failed to load %s values: %w", c.column, err)
+			}
+
+			for _, row := range rows {
+				if err := s.db.WithContext(ctx).Unscoped().Model(c.model).
+					Where("id = ?", row.ID).
+					UpdateColumn(c.column, row.Value).Error; err != nil {
+					return total, fmt.Errorf("failed to re-encrypt %s: %w", c.column, err)
+				}
+				total++
+			}
+			if len(rows) < reencryptBatchSize {
+				break
+			}
+		}
+	}
+
+	count, err := s.reencryptVault(ctx, keyring, current)
+	return total + count, err
+}
+
+// reencryptVault re-seals vault items encrypted with a key other than the current one, keeping
+// them bound to their owner and item
+func (s *SystemService) reencryptVault(ctx context.Context, keyring *secret.Keyring, current string) (int64, error) {
+	var total int64
+	for {
+		var items []*models.VaultItem
+		if err := s.db.WithContext(ctx).
+			Where("sealed NOT LIKE ?", current).
+			Limit(reencryptBatchSize).
+			Find(&items).Error; err != nil {
+			return total, fmt.Errorf("failed to load vault items: %w", err)
+		}
+
+		for _, item := range items {
+			content, err := openVaultContent(keyring, item)
+			if err != nil {
+				return total, err
+			}
+			sealed, err := sealVaultContent(keyring, item, *content)
+			if err != nil {
+				return total, err
+			}
+			if err := s.db.WithContext(ctx).Model(item).UpdateColumn("sealed", sealed).Error; err != nil {
+				return total, fmt.Errorf("failed to re-encrypt vault item: %w", err)
+			}
+			total++
+		}
+		if len(items) < reencryptBatchSize {
+			return total, nil
+		}
+	}
+}
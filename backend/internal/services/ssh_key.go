@@ -0,0 +1,316 @@
+package services
+
+import (
+	"context"
+	"crypto/rsa"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+const (
+	// sshKeyChangeLimit is the number of key additions and removals allowed per user per window
+	sshKeyChangeLimit  = 10
+	sshKeyChangeWindow = time.Hour
+	sshKeyNameMaxLen   = 64
+	minRSAKeyBits      = 2048
+)
+
+// authorizedKeysHeader marks the file as generated so manual edits are not expected to survive
+const authorizedKeysHeader = "# Managed by MyNodeCP. Changes made here are overwritten.\n"
+
+// SSHKeyService manages the public keys of shell/SFTP users
+type SSHKeyService struct {
+	db     *gorm.DB
+	redis  *redis.Client
+	logger *zap.Logger
+	config config.HostingConfig
+}
+
+// NewSSHKeyService creates a new SSH key service
+func NewSSHKeyService(db *gorm.DB, redis *redis.Client, logger *zap.Logger, config config.HostingConfig) *SSHKeyService {
+	return &SSHKeyService{
+		db:     db,
+		redis:  redis,
+		logger: logger,
+		config: config,
+	}
+}
+
+// AddKey validates a public key in authorized_keys format and adds it to the user's account
+func (s *SSHKeyService) AddKey(ctx context.Context, userID uuid.UUID, name, publicKey string) (*models.SSHKey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > sshKeyNameMaxLen || strings.ContainsAny(name, "\r\n") {
+		return nil, apperrors.InvalidCode("name", "ssh_key.name_invalid", map[string]string{"max": strconv.Itoa(sshKeyNameMaxLen)})
+	}
+
+	normalized, fingerprint, err := ParseSSHPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var owner models.User
+	if err := s.db.WithContext(ctx).Where("id = ?", userID).First(&owner).Error; err != nil {
+		return nil, apperrors.FromDB(err, "user")
+	}
+
+	if err := s.checkRateLimit(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&models.SSHKey{}).
+		Where("user_id = ? AND fingerprint = ?", userID, fingerprint).
+		Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("failed to check existing keys: %w", err)
+	}
+	if count > 0 {
+		return nil, apperrors.InvalidCode("public_key", "ssh_key.exists", nil)
+	}
+
+	key := &models.SSHKey{
+		UserID:      userID,
+		Name:        name,
+		PublicKey:   normalized,
+		Fingerprint: fingerprint,
+	}
+	if err := s.db.WithContext(ctx).Create(key).Error; err != nil {
+		return nil, fmt.Errorf("failed to add SSH key: %w", err)
+	}
+
+	s.audit(ctx, "ssh_key.add", key, owner.Username)
+	s.sync(ctx, &owner)
+
+	return key, nil
+}
+
+// GetKeys retrieves all SSH keys of a user
+func (s *SSHKeyService) GetKeys(ctx context.Context, userID uuid.UUID) ([]*models.SSHKey, error) {
+	var keys []*models.SSHKey
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at").Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("failed to get SSH keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// DeleteKey removes an SSH key from a user's account
+func (s *SSHKeyService) DeleteKey(ctx context.Context, userID, keyID uuid.UUID) error {
+	var key models.SSHKey
+	if err := s.db.WithContext(ctx).Preload("User").Where("id = ? AND user_id = ?", keyID, userID).First(&key).Error; err != nil {
+		return apperrors.FromDB(err, "SSH key")
+	}
+
+	if err := s.checkRateLimit(ctx, userID); err != nil {
+		return err
+	}
+
+	if err := s.db.WithContext(ctx).Delete(&key).Error; err != nil {
+		return fmt.Errorf("failed to delete SSH key: %w", err)
+	}
+
+	s.audit(ctx, "ssh_key.delete", &key, key.User.Username)
+	s.sync(ctx, &key.User)
+
+	return nil
+}
+
+// ParseSSHPublicKey validates a single public key line and returns it normalized, together with
+// its SHA256 fingerprint. Key options are rejected because they are managed by the panel.
+func ParseSSHPublicKey(publicKey string) (normalized, fingerprint string, err error) {
+	publicKey = strings.TrimSpace(publicKey)
+	if strings.ContainsAny(publicKey, "\r\n") {
+		return "", "", apperrors.InvalidCode("public_key", "ssh_key.single_line", nil)
+	}
+
+	parsed, comment, options, rest, err := ssh.ParseAuthorizedKey([]byte(publicKey))
+	if err != nil {
+		return "", "", apperrors.InvalidCode("public_key", "ssh_key.invalid", nil)
+	}
+	if len(options) > 0 || len(rest) > 0 {
+		return "", "", apperrors.InvalidCode("public_key", "ssh_key.options", nil)
+	}
+
+	switch parsed.Type() {
+	case ssh.KeyAlgoDSA:
+		return "", "", apperrors.InvalidCode("public_key", "ssh_key.dsa", nil)
+	case ssh.KeyAlgoRSA:
+		if cryptoKey, ok := parsed.(ssh.CryptoPublicKey); ok {
+			if rsaKey, ok := cryptoKey.CryptoPublicKey().(*rsa.PublicKey); ok && rsaKey.N.BitLen() < minRSAKeyBits {
+				return "", "", apperrors.InvalidCode("public_key", "ssh_key.rsa_bits", map[string]string{"bits": strconv.Itoa(minRSAKeyBits)})
+			}
+		}
+	}
+
+	normalized = strings.TrimSpace(string(ssh.MarshalAuthorizedKey(parsed)))
+	if comment = strings.TrimSpace(comment); comment != "" {
+		normalized += " " + comment
+	}
+
+	return normalized, ssh.FingerprintSHA256(parsed), nil
+}
+
+// AuthorizedKeysContent renders the authorized_keys file for a set of keys
+func AuthorizedKeysContent(keys []*models.SSHKey) string {
+	var b strings.Builder
+	b.WriteString(authorizedKeysHeader)
+	for _, key := range keys {
+		b.WriteString(key.PublicKey)
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// SyncAuthorizedKeys rewrites the user's authorized_keys file from the stored keys
+func (s *SSHKeyService) SyncAuthorizedKeys(ctx context.Context, owner *models.User) error {
+	keys, err := s.GetKeys(ctx, owner.ID)
+	if err != nil {
+		return err
+	}
+
+	if dryRun(ctx, s.config) {
+		s.logger.Info("Dry run: skipping authorized keys write", zap.String("username", owner.Username), zap.Int("keys", len(keys)))
+		return nil
+	}
+
+	account, err := user.Lookup(owner.Username)
+	if err != nil {
+		return fmt.Errorf("failed to look up system user %s: %w", owner.Username, err)
+	}
+	uid, err := strconv.Atoi(account.Uid)
+	if err != nil {
+		return fmt.Errorf("invalid uid of system user %s: %w", owner.Username, err)
+	}
+	gid, err := strconv.Atoi(account.Gid)
+	if err != nil {
+		return fmt.Errorf("invalid gid of system user %s: %w", owner.Username, err)
+	}
+
+	return writeAuthorizedKeys(filepath.Join(s.config.HomeDir, owner.Username), AuthorizedKeysContent(keys), uid, gid)
+}
+
+// writeAuthorizedKeys replaces home/.ssh/authorized_keys with content owned by uid and gid. The
+// user controls their home directory, so symlinks there are refused rather than followed: the
+// panel would otherwise write or chown whatever file the link points at.
+func writeAuthorizedKeys(home, content string, uid, gid int) error {
+	if err := requireDir(home); err != nil {
+		return err
+	}
+
+	sshDir := filepath.Join(home, ".ssh")
+	if err := os.Mkdir(sshDir, 0700); err != nil && !os.IsExist(err) {
+		return fmt.Errorf("failed to create %s: %w", sshDir, err)
+	}
+	dir, err := os.OpenFile(sshDir, os.O_RDONLY|syscall.O_DIRECTORY|syscall.O_NOFOLLOW, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", sshDir, err)
+	}
+	defer dir.Close()
+	if err := dir.Chown(uid, gid); err != nil {
+		return fmt.Errorf("failed to set owner of %s: %w", sshDir, err)
+	}
+	if err := dir.Chmod(0700); err != nil {
+		return fmt.Errorf("failed to set mode of %s: %w", sshDir, err)
+	}
+
+	// Write to a temporary file first so sshd never reads a partial file
+	tmp, err := os.CreateTemp(sshDir, "authorized_keys.*")
+	if err != nil {
+		return fmt.Errorf("failed to create authorized keys: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write authorized keys: %w", err)
+	}
+	if err := tmp.Chown(uid, gid); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to set owner of authorized keys: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write authorized keys: %w", err)
+	}
+
+	// The directory must not have been swapped for another since it was opened
+	opened, err := dir.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to check %s: %w", sshDir, err)
+	}
+	current, err := os.Lstat(sshDir)
+	if err != nil || !os.SameFile(opened, current) {
+		return fmt.Errorf("%s changed while writing authorized keys", sshDir)
+	}
+
+	// Renaming replaces a symlink at authorized_keys instead of following it
+	if err := os.Rename(tmp.Name(), filepath.Join(sshDir, "authorized_keys")); err != nil {
+		return fmt.Errorf("failed to replace authorized keys: %w", err)
+	}
+
+	return nil
+}
+
+// requireDir fails unless path is a directory itself rather than a symlink to one
+func requireDir(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return fmt.Errorf("failed to check %s: %w", path, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", path)
+	}
+	return nil
+}
+
+// sync updates authorized_keys after a change; failures are logged since the change is already stored
+func (s *SSHKeyService) sync(ctx context.Context, owner *models.User) {
+	if err := s.SyncAuthorizedKeys(ctx, owner); err != nil {
+		s.logger.Error("Failed to sync authorized keys", zap.String("user", owner.Username), zap.Error(err))
+	}
+}
+
+func (s *SSHKeyService) checkRateLimit(ctx context.Context, userID uuid.UUID) error {
+	key := fmt.Sprintf("ssh_key_changes:%s", userID)
+	changes, err := s.redis.Incr(ctx, key).Result()
+	if err != nil {
+		return fmt.Errorf("failed to check SSH key rate limit: %w", err)
+	}
+	if changes == 1 {
+		s.redis.Expire(ctx, key, sshKeyChangeWindow)
+	}
+	if changes > sshKeyChangeLimit {
+		return apperrors.PreconditionCode("ssh_key_change_limit", nil)
+	}
+
+	return nil
+}
+
+func (s *SSHKeyService) audit(ctx context.Context, action string, key *models.SSHKey, username string) {
+	resourceID := key.ID.String()
+	auditLog := &models.AuditLog{
+		UserID:     actorFromContext(ctx),
+		Action:     action,
+		Resource:   "ssh_key",
+		ResourceID: &resourceID,
+		Details:    fmt.Sprintf("user=%s name=%q fingerprint=%s", username, key.Name, key.Fingerprint),
+		Success:    true,
+	}
+	if err := s.db.WithContext(ctx).Create(auditLog).Error; err != nil {
+		s.logger.Error("Failed to record audit log", zap.Error(err))
+	}
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+)
+
+func TestWriteAuthorizedKeys(t *testing.T) {
+	home := t.TempDir()
+	uid, gid := os.Getuid(), os.Getgid()
+
+	if err := writeAuthorizedKeys(home, "first\n", uid, gid); err != nil {
+		t.Fatalf("first write: %v", err)
+	}
+	if err := writeAuthorizedKeys(home, "second\n", uid, gid); err != nil {
+		t.Fatalf("second write: %v", err)
+	}
+
+	path := filepath.Join(home, ".ssh", "authorized_keys")
+	content, err := os.ReadFile(path)
+	if err != nil || string(content) != "second\n" {
+		t.Fatalf("authorized_keys = %q, %v", content, err)
+	}
+	info, _ := os.Stat(path)
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+	entries, _ := os.ReadDir(filepath.Join(home, ".ssh"))
+	if len(entries) != 1 {
+		t.Errorf("%d files in .ssh, want only authorized_keys", len(entries))
+	}
+}
+
+func TestWriteAuthorizedKeysRefusesSymlinks(t *testing.T) {
+	uid, gid := os.Getuid(), os.Getgid()
+
+	t.Run("ssh directory", func(t *testing.T) {
+		home, elsewhere := t.TempDir(), t.TempDir()
+		os.Symlink(elsewhere, filepath.Join(home, ".ssh"))
+
+		if err := writeAuthorizedKeys(home, "key\n", uid, gid); err == nil {
+			t.Fatal("wrote through a symlinked .ssh")
+		}
+		if entries, _ := os.ReadDir(elsewhere); len(entries) != 0 {
+			t.Errorf("link target got %d files", len(entries))
+		}
+	})
+
+	t.Run("home directory", func(t *testing.T) {
+		parent, elsewhere := t.TempDir(), t.TempDir()
+		home := filepath.Join(parent, "user")
+		os.Symlink(elsewhere, home)
+
+		if err := writeAuthorizedKeys(home, "key\n", uid, gid); err == nil {
+			t.Fatal("wrote through a symlinked home")
+		}
+	})
+
+	t.Run("authorized_keys", func(t *testing.T) {
+		home := t.TempDir()
+		victim := filepath.Join(t.TempDir(), "passwd")
+		os.WriteFile(victim, []byte("untouched"), 0644)
+		os.Mkdir(filepath.Join(home, ".ssh"), 0700)
+		path := filepath.Join(home, ".ssh", "authorized_keys")
+		os.Symlink(victim, path)
+
+		if err := writeAuthorizedKeys(home, "key\n", uid, gid); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if content, _ := os.ReadFile(victim); string(content) != "untouched" {
+			t.Errorf("link target overwritten with %q", content)
+		}
+		if info, _ := os.Lstat(path); info.Mode()&os.ModeSymlink != 0 {
+			t.Error("authorized_keys is still a symlink")
+		}
+	})
+}
+
+func testPublicKey(t *testing.T, key interface{}) string {
+	t.Helper()
+
+	public, err := ssh.NewPublicKey(key)
+	if err != nil {
+		t.Fatalf("public key: %v", err)
+	}
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(public)))
+}
+
+func TestAddKeyErrors(t *testing.T) {
+	db := newTestDB(t)
+	client, _ := newTestRedis(t)
+	keys := NewSSHKeyService(db, client, zap.NewNop(), testHostingConfig(t))
+	ctx := context.Background()
+	owner := createTestUser(t, db)
+
+	edKey, _, _ := ed25519.GenerateKey(rand.Reader)
+	valid := testPublicKey(t, edKey)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 1024)
+	if _, err := keys.AddKey(ctx, owner.ID, "laptop", valid); err != nil {
+		t.Fatalf("AddKey() error = %v", err)
+	}
+
+	tests := []struct {
+		name, keyName, publicKey, field string
+	}{
+		{"empty name", " ", valid, "name"},
+		{"multiline name", "lap\ntop", valid, "name"},
+		{"garbage", "desktop", "ssh-ed25519 not-base64", "public_key"},
+		{"two lines", "desktop", valid + "\n" + valid, "public_key"},
+		{"options", "desktop", `command="ls" ` + valid, "public_key"},
+		{"short RSA key", "desktop", testPublicKey(t, &rsaKey.PublicKey), "public_key"},
+		{"duplicate", "desktop", valid + " other comment", "public_key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := keys.AddKey(ctx, owner.ID, tt.keyName, tt.publicKey)
+			if fieldMessage(err, tt.field) == "" || apperrors.HTTPStatus(err) != http.StatusUnprocessableEntity {
+				t.Fatalf("AddKey() error = %v, want a validation error on %s", err, tt.field)
+			}
+		})
+	}
+}
+
+func TestAddKeyRateLimit(t *testing.T) {
+	db := newTestDB(t)
+	client, _ := newTestRedis(t)
+	keys := NewSSHKeyService(db, client, zap.NewNop(), testHostingConfig(t))
+	ctx := context.Background()
+	owner := createTestUser(t, db)
+
+	var err error
+	for i := 0; i <= sshKeyChangeLimit && err == nil; i++ {
+		edKey, _, _ := ed25519.GenerateKey(rand.Reader)
+		_, err = keys.AddKey(ctx, owner.ID, "key", testPublicKey(t, edKey))
+	}
+	if errorCode(err) != "ssh_key_change_limit" || apperrors.HTTPStatus(err) != http.StatusConflict {
+		t.Fatalf("AddKey() error = %v, want ssh_key_change_limit", err)
+	}
+}
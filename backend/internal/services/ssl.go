@@ -2,35 +2,159 @@ package services
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/egress"
+	"github.com/mynodecp/mynodecp/backend/internal/lock"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
 )
 
 // SSLService handles SSL certificate operations
 type SSLService struct {
-	db     *gorm.DB
-	redis  *redis.Client
-	logger *zap.Logger
+	db      *gorm.DB
+	redis   *redis.Client
+	logger  *zap.Logger
+	config  config.HostingConfig
+	domains *DomainService
+	dns     *DNSService // Publishes DNS-01 challenge records
+	locks   *lock.Locker
+
+	httpClient *http.Client // Talks to the ACME server
+	acmeMu     sync.Mutex
+	acme       acmeClient // Registered account, set up on first issuance
 }
 
-// NewSSLService creates a new SSL service
-func NewSSLService(db *gorm.DB, redis *redis.Client, logger *zap.Logger) *SSLService {
+// NewSSLService creates a new SSL service. Calls to the ACME server follow the outbound policy.
+func NewSSLService(db *gorm.DB, redis *redis.Client, logger *zap.Logger, config config.HostingConfig, domains *DomainService, dns *DNSService, outbound *egress.Policy, locks *lock.Locker) *SSLService {
 	return &SSLService{
-		db:     db,
-		redis:  redis,
-		logger: logger,
+		db:      db,
+		redis:   redis,
+		logger:  logger,
+		config:  config,
+		domains: domains,
+		dns:     dns,
+		locks:   locks,
+
+		httpClient: outbound.Client(acmeTimeout),
 	}
 }
 
-// Placeholder methods - to be implemented
-func (s *SSLService) GenerateCertificate(ctx context.Context) (interface{}, error) {
-	// TODO: Implement SSL certificate generation
-	return nil, nil
+// GenerateCertificate issues a certificate for a domain from the ACME server and installs it as
+// the domain's certificate. names are the DNS names it covers: the domain itself, names below it
+// and wildcards such as *.example.com; without names it covers the domain and its www name.
+// Wildcards are validated over DNS-01 with records in the domain's zone, other names over HTTP-01
+// where the panel serves them.
+//
+// The domain must first pass ownership verification so ACME challenges are not attempted, and rate
+// limit spent, on domains that do not point at this server.
+func (s *SSLService) GenerateCertificate(ctx context.Context, domainID uuid.UUID, names []string) (*models.SSLCertificate, error) {
+	var domain models.Domain
+	if err := s.db.WithContext(ctx).Preload("Node").Where("id = ?", domainID).First(&domain).Error; err != nil {
+		return nil, apperrors.FromDB(err, "domain")
+	}
+
+	if err := authorizeDomain(ctx, &domain); err != nil {
+		return nil, err
+	}
+
+	names, err := requestedNames(domain.Name, names)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.generate(ctx, &domain, names, false)
+}
+
+// generate verifies a domain, loaded with its node, and issues and installs a certificate for
+// it, turning on force_https with forceHTTPS
+func (s *SSLService) generate(ctx context.Context, domain *models.Domain, names []string, forceHTTPS bool) (*models.SSLCertificate, error) {
+	if s.config.ACMEDirectoryURL == "" {
+		return nil, apperrors.PreconditionCode("acme_disabled", nil)
+	}
+	if dryRun(ctx, s.config) {
+		return nil, apperrors.Precondition("certificates cannot be issued in dry-run mode")
+	}
+
+	held, err := lockDomain(ctx, s.locks, domain.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer held.Release()
+
+	verification, err := s.domains.verifyOwnership(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	if !verification.Verified {
+		return nil, apperrors.Precondition(fmt.Sprintf("domain ownership not verified: %s; point the domain at %v or publish TXT %s %q",
+			verification.Message, verification.Expected, verification.TXTName, verification.TXTValue))
+	}
+
+	client, err := s.acmeAccount(ctx)
+	if err != nil {
+		return nil, err
+	}
+	issued, err := s.issue(ctx, client, domain, names)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.installCertificate(ctx, domain, issued, forceHTTPS)
 }
 
-func (s *SSLService) RenewCertificate(ctx context.Context) error {
-	// TODO: Implement SSL certificate renewal
+// certificateRenewBefore is how long before they expire certificates are renewed
+const certificateRenewBefore = 30 * 24 * time.Hour
+
+// RenewCertificates renews the active ACME certificates set to renew automatically that expire
+// within certificateRenewBefore, for the names they cover. Suspended domains are skipped. A
+// certificate that fails to renew is left for the next run; the failures are returned together
+// once the others were attempted.
+func (s *SSLService) RenewCertificates(ctx context.Context) error {
+	var certificates []*models.SSLCertificate
+	if err := s.db.WithContext(ctx).Preload("Domain.Node").
+		Joins("JOIN domains ON domains.id = ssl_certificates.domain_id").
+		Where("ssl_certificates.type = ? AND ssl_certificates.is_active = ? AND ssl_certificates.auto_renew = ?", "letsencrypt", true, true).
+		Where("ssl_certificates.expires_at < ? AND domains.suspended_at IS NULL", time.Now().Add(certificateRenewBefore)).
+		Order("ssl_certificates.expires_at").
+		Find(&certificates).Error; err != nil {
+		return fmt.Errorf("failed to load certificates due for renewal: %w", err)
+	}
+
+	var errs []error
+	for _, certificate := range certificates {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		renewed, err := s.generate(ctx, &certificate.Domain, certificate.Names, false)
+		if err != nil {
+			s.logger.Warn("Certificate renewal failed",
+				zap.String("domain", certificate.Domain.Name),
+				zap.Time("expires_at", certificate.ExpiresAt),
+				zap.Error(err))
+			errs = append(errs, fmt.Errorf("%s: %w", certificate.Domain.Name, err))
+			continue
+		}
+
+		if err := s.db.WithContext(ctx).Model(renewed).Update("renewed_at", time.Now()).Error; err != nil {
+			s.logger.Error("Failed to record certificate renewal", zap.String("domain", certificate.Domain.Name), zap.Error(err))
+		}
+		s.logger.Info("Certificate renewed", zap.String("domain", certificate.Domain.Name), zap.Time("expires_at", renewed.ExpiresAt))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to renew %d of %d certificates: %w", len(errs), len(certificates), errors.Join(errs...))
+	}
 	return nil
 }
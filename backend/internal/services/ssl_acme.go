@@ -0,0 +1,457 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/acme"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/secret"
+)
+
+// acmeTimeout bounds each request to the ACME server
+const acmeTimeout = 30 * time.Second
+
+// maxCertificateNames is the most names one certificate may cover, the limit of Let's Encrypt
+const maxCertificateNames = 100
+
+// acmeTokenPattern matches challenge tokens, which name the HTTP-01 response file
+var acmeTokenPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// acmeClient is the part of the ACME protocol issuing certificates uses; *acme.Client implements it
+type acmeClient interface {
+	AuthorizeOrder(ctx context.Context, id []acme.AuthzID, opt ...acme.OrderOption) (*acme.Order, error)
+	GetAuthorization(ctx context.Context, url string) (*acme.Authorization, error)
+	Accept(ctx context.Context, chal *acme.Challenge) (*acme.Challenge, error)
+	WaitAuthorization(ctx context.Context, url string) (*acme.Authorization, error)
+	WaitOrder(ctx context.Context, url string) (*acme.Order, error)
+	CreateOrderCert(ctx context.Context, url string, csr []byte, bundle bool) (der [][]byte, certURL string, err error)
+	DNS01ChallengeRecord(token string) (string, error)
+	HTTP01ChallengeResponse(token string) (string, error)
+}
+
+// issuedCertificate is a certificate fresh from the ACME server, leaf first, with its key
+type issuedCertificate struct {
+	names []string
+	der   [][]byte
+	key   *ecdsa.PrivateKey
+}
+
+// presentedChallenge is a challenge whose response is in place for the ACME server to check
+type presentedChallenge struct {
+	authzURL  string
+	name      string // As requested, *. included for wildcards
+	challenge *acme.Challenge
+	cleanup   func() // Takes the response down again
+}
+
+// requestedNames checks the names requested for a domain's certificate and returns them lowercased,
+// without duplicates. Each must be the domain, a name below it or a wildcard of either, and the
+// domain itself must be covered since the certificate is installed as the domain's.
+func requestedNames(domainName string, names []string) ([]string, error) {
+	if len(names) == 0 {
+		return []string{domainName, "www." + domainName}, nil
+	}
+	if len(names) > maxCertificateNames {
+		return nil, apperrors.InvalidCode("names", "ssl.too_many_names", map[string]string{"max": strconv.Itoa(maxCertificateNames)})
+	}
+
+	v := apperrors.NewValidation()
+	seen := make(map[string]bool, len(names))
+	requested := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+		base := strings.TrimPrefix(name, "*.")
+		if !domainNamePattern.MatchString(base) || (base != domainName && !strings.HasSuffix(base, "."+domainName)) {
+			v.AddCode("names", "ssl.name_outside", map[string]string{"name": name, "domain": domainName})
+			continue
+		}
+		if !seen[name] {
+			seen[name] = true
+			requested = append(requested, name)
+		}
+	}
+	if !seen[domainName] {
+		v.AddCode("names", "ssl.name_apex", map[string]string{"domain": domainName})
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	return requested, nil
+}
+
+// acmeAccount returns the client of the panel's ACME account, registering the account on first use
+func (s *SSLService) acmeAccount(ctx context.Context) (acmeClient, error) {
+	s.acmeMu.Lock()
+	defer s.acmeMu.Unlock()
+	if s.acme != nil {
+		return s.acme, nil
+	}
+
+	key, err := loadACMEAccountKey(s.config.ACMEAccountKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	client := &acme.Client{
+		Key:          key,
+		DirectoryURL: s.config.ACMEDirectoryURL,
+		HTTPClient:   s.httpClient,
+		UserAgent:    "mynodecp",
+	}
+
+	account := &acme.Account{}
+	if s.config.ACMEEmail != "" {
+		account.Contact = []string{"mailto:" + s.config.ACMEEmail}
+	}
+	if _, err := client.Register(ctx, account, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return nil, fmt.Errorf("failed to register ACME account: %w", err)
+	}
+
+	s.acme = client
+	return client, nil
+}
+
+// loadACMEAccountKey reads the ACME account key, creating it when the file does not exist yet
+func loadACMEAccountKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return createACMEAccountKey(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ACME account key: %w", err)
+	}
+
+	key, err := parsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ACME account key %s: %w", path, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("invalid ACME account key %s: cannot sign", path)
+	}
+	return signer, nil
+}
+
+func createACMEAccountKey(path string) (crypto.Signer, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ACME account key: %w", err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode ACME account key: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create ACME account key directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ACME account key: %w", err)
+	}
+	defer file.Close()
+	if err := pem.Encode(file, &pem.Block{Type: "EC PRIVATE KEY", Bytes: der}); err != nil {
+		return nil, fmt.Errorf("failed to write ACME account key: %w", err)
+	}
+
+	return key, nil
+}
+
+// issue orders a certificate for names and completes its challenges. Every challenge response is
+// put in place before any is accepted, so the DNS-01 records share one propagation wait, and all
+// are taken down again whatever the outcome.
+func (s *SSLService) issue(ctx context.Context, client acmeClient, domain *models.Domain, names []string) (*issuedCertificate, error) {
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(names...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to place ACME order: %w", err)
+	}
+
+	var presented []*presentedChallenge
+	defer func() {
+		for _, challenge := range presented {
+			challenge.cleanup()
+		}
+	}()
+
+	viaDNS := false
+	for _, url := range order.AuthzURLs {
+		authz, err := client.GetAuthorization(ctx, url)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get ACME authorization: %w", err)
+		}
+		if authz.Status == acme.StatusValid {
+			continue
+		}
+
+		challenge, err := s.presentChallenge(ctx, client, domain, authz)
+		if err != nil {
+			return nil, err
+		}
+		presented = append(presented, challenge)
+		viaDNS = viaDNS || challenge.challenge.Type == "dns-01"
+	}
+
+	if viaDNS && s.config.ACMEDNSPropagation > 0 {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(s.config.ACMEDNSPropagation):
+		}
+	}
+
+	for _, challenge := range presented {
+		if _, err := client.Accept(ctx, challenge.challenge); err != nil {
+			return nil, fmt.Errorf("failed to accept ACME challenge for %s: %w", challenge.name, err)
+		}
+	}
+	for _, challenge := range presented {
+		if _, err := client.WaitAuthorization(ctx, challenge.authzURL); err != nil {
+			return nil, apperrors.PreconditionCode("acme_challenge_failed", map[string]string{
+				"name":  challenge.name,
+				"type":  challenge.challenge.Type,
+				"error": err.Error(),
+			})
+		}
+	}
+
+	if order, err = client.WaitOrder(ctx, order.URI); err != nil {
+		return nil, fmt.Errorf("ACME order failed: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate certificate key: %w", err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: names[0]},
+		DNSNames: names,
+	}, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate request: %w", err)
+	}
+	der, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to finalize ACME order: %w", err)
+	}
+	if len(der) == 0 {
+		return nil, fmt.Errorf("ACME server returned no certificate")
+	}
+
+	return &issuedCertificate{names: names, der: der, key: key}, nil
+}
+
+// presentChallenge puts the response to one authorization's challenge in place. Wildcards can only
+// be validated over DNS-01; other names use HTTP-01 where the panel serves them and fall back to
+// DNS-01 otherwise.
+func (s *SSLService) presentChallenge(ctx context.Context, client acmeClient, domain *models.Domain, authz *acme.Authorization) (*presentedChallenge, error) {
+	name := authz.Identifier.Value
+	requested := name
+	if authz.Wildcard {
+		requested = "*." + name
+	}
+
+	var httpChallenge, dnsChallenge *acme.Challenge
+	for _, challenge := range authz.Challenges {
+		switch challenge.Type {
+		case "http-01":
+			httpChallenge = challenge
+		case "dns-01":
+			dnsChallenge = challenge
+		}
+	}
+
+	presented := &presentedChallenge{authzURL: authz.URI, name: requested}
+	var err error
+	if root := s.challengeWebRoot(ctx, domain, name); httpChallenge != nil && !authz.Wildcard && root != "" {
+		presented.challenge = httpChallenge
+		presented.cleanup, err = s.presentHTTP01(client, root, httpChallenge.Token)
+	} else if dnsChallenge != nil {
+		presented.challenge = dnsChallenge
+		presented.cleanup, err = s.presentDNS01(ctx, client, domain, name, dnsChallenge.Token)
+	} else {
+		return nil, apperrors.PreconditionCode("acme_challenge_unsupported", map[string]string{"name": requested})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return presented, nil
+}
+
+// challengeWebRoot returns the document root the panel serves a name from, or "" when HTTP-01 cannot
+// reach it there: the name has no site of its own, the domain is suspended or redirected away.
+func (s *SSLService) challengeWebRoot(ctx context.Context, domain *models.Domain, name string) string {
+	if domain.SuspendedAt != nil {
+		return ""
+	}
+
+	if name == domain.Name || name == "www."+domain.Name {
+		var redirected int64
+		if err := s.db.WithContext(ctx).Model(&models.Redirect{}).
+			Where("domain_id = ? AND source_path = ?", domain.ID, "/").
+			Count(&redirected).Error; err != nil || redirected > 0 {
+			return ""
+		}
+		return domain.DocumentRoot
+	}
+
+	var subdomain models.Subdomain
+	if err := s.db.WithContext(ctx).
+		Where("domain_id = ? AND name = ? AND is_active = ?", domain.ID, strings.TrimSuffix(name, "."+domain.Name), true).
+		First(&subdomain).Error; err != nil {
+		return ""
+	}
+	return subdomain.DocumentRoot
+}
+
+// presentHTTP01 writes the response to an HTTP-01 challenge below a document root
+func (s *SSLService) presentHTTP01(client acmeClient, root, token string) (func(), error) {
+	if !acmeTokenPattern.MatchString(token) {
+		return nil, fmt.Errorf("invalid ACME challenge token %q", token)
+	}
+	response, err := client.HTTP01ChallengeResponse(token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute ACME challenge response: %w", err)
+	}
+
+	dir := filepath.Join(root, ".well-known", "acme-challenge")
+	if err := mkdirOwned(dir, s.config.FTPUID, s.config.FTPGID); err != nil {
+		return nil, fmt.Errorf("failed to create ACME challenge directory: %w", err)
+	}
+	// The directory is the domain owner's, who could have pointed it elsewhere with a symlink
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve document root: %w", err)
+	}
+	resolvedDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve ACME challenge directory: %w", err)
+	}
+	if _, err := resolveWithin(resolvedRoot, resolvedDir); err != nil {
+		return nil, fmt.Errorf("ACME challenge directory leaves the document root: %w", err)
+	}
+
+	path := filepath.Join(resolvedDir, token)
+	if err := os.WriteFile(path, []byte(response), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write ACME challenge response: %w", err)
+	}
+
+	return func() {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			s.logger.Warn("Failed to remove ACME challenge response", zap.String("path", path), zap.Error(err))
+		}
+	}, nil
+}
+
+// presentDNS01 publishes the TXT record answering a DNS-01 challenge for a name in the domain's zone
+func (s *SSLService) presentDNS01(ctx context.Context, client acmeClient, domain *models.Domain, name, token string) (func(), error) {
+	value, err := client.DNS01ChallengeRecord(token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute ACME challenge record: %w", err)
+	}
+
+	recordName := "_acme-challenge"
+	if name != domain.Name {
+		recordName += "." + strings.TrimSuffix(name, "."+domain.Name)
+	}
+	record, err := s.dns.addChallengeRecord(ctx, domain.ID, recordName, value)
+	if err != nil {
+		return nil, err
+	}
+
+	cleanupCtx := context.WithoutCancel(ctx)
+	return func() { s.dns.removeChallengeRecord(cleanupCtx, record) }, nil
+}
+
+// installCertificate stores an issued certificate as the domain's active one, replacing the
+// previous, and writes it where the domain's vhost loads it from. With forceHTTPS, the domain
+// also starts redirecting to HTTPS.
+func (s *SSLService) installCertificate(ctx context.Context, domain *models.Domain, issued *issuedCertificate, forceHTTPS bool) (*models.SSLCertificate, error) {
+	leaf, err := x509.ParseCertificate(issued.der[0])
+	if err != nil {
+		return nil, fmt.Errorf("ACME server returned an invalid certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(issued.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode certificate key: %w", err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: issued.der[0]})
+	var chainPEM []byte
+	for _, der := range issued.der[1:] {
+		chainPEM = append(chainPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+
+	dir := filepath.Join(s.config.SSLDir, domain.Name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create certificate directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "privkey.pem"), keyPEM, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write certificate key: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "fullchain.pem"), append(certPEM, chainPEM...), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write certificate: %w", err)
+	}
+
+	certificate := &models.SSLCertificate{
+		DomainID:    domain.ID,
+		Type:        "letsencrypt",
+		Names:       issued.names,
+		Certificate: string(certPEM),
+		PrivateKey:  secret.String(keyPEM),
+		Chain:       string(chainPEM),
+		IsActive:    true,
+		AutoRenew:   true,
+		ExpiresAt:   leaf.NotAfter,
+	}
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.SSLCertificate{}).
+			Where("domain_id = ? AND is_active = ?", domain.ID, true).
+			Update("is_active", false).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(certificate).Error; err != nil {
+			return err
+		}
+		updates := map[string]interface{}{"has_ssl": true}
+		if forceHTTPS {
+			updates["force_https"] = true
+		}
+		return tx.Model(domain).Updates(updates).Error
+	}); err != nil {
+		return nil, fmt.Errorf("failed to store certificate: %w", err)
+	}
+
+	domain.HasSSL = true
+	domain.ForceHTTPS = domain.ForceHTTPS || forceHTTPS
+	s.domains.writeVhost(ctx, domain)
+	s.domains.invalidateDomain(ctx, domain.ID)
+
+	s.logger.Info("Certificate issued",
+		zap.String("domain", domain.Name),
+		zap.Strings("names", issued.names),
+		zap.Time("expires_at", leaf.NotAfter),
+	)
+
+	return certificate, nil
+}
@@ -0,0 +1,348 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/acme"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// fakeACME is an ACME server that offers HTTP-01 and DNS-01 for plain names and only DNS-01 for
+// wildcards, and signs whatever is ordered. onAccept sees each challenge as it is accepted.
+type fakeACME struct {
+	authzs   map[string]*acme.Authorization
+	accepted []*acme.Challenge
+	onAccept func(*acme.Authorization, *acme.Challenge)
+	failing  string // Name whose authorization fails
+	caKey    *ecdsa.PrivateKey
+}
+
+func newFakeACME(t *testing.T) *fakeACME {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &fakeACME{authzs: make(map[string]*acme.Authorization), caKey: key}
+}
+
+func (f *fakeACME) AuthorizeOrder(ctx context.Context, ids []acme.AuthzID, opt ...acme.OrderOption) (*acme.Order, error) {
+	order := &acme.Order{URI: "order", FinalizeURL: "finalize"}
+	for i, id := range ids {
+		url := fmt.Sprintf("authz/%d", i)
+		token := fmt.Sprintf("token%d", i)
+		authz := &acme.Authorization{
+			URI:        url,
+			Identifier: acme.AuthzID{Type: "dns", Value: strings.TrimPrefix(id.Value, "*.")},
+			Wildcard:   strings.HasPrefix(id.Value, "*."),
+			Challenges: []*acme.Challenge{{Type: "dns-01", Token: token}},
+		}
+		if !authz.Wildcard {
+			authz.Challenges = append(authz.Challenges, &acme.Challenge{Type: "http-01", Token: token})
+		}
+		f.authzs[url] = authz
+		order.AuthzURLs = append(order.AuthzURLs, url)
+	}
+	return order, nil
+}
+
+func (f *fakeACME) GetAuthorization(ctx context.Context, url string) (*acme.Authorization, error) {
+	return f.authzs[url], nil
+}
+
+func (f *fakeACME) Accept(ctx context.Context, challenge *acme.Challenge) (*acme.Challenge, error) {
+	f.accepted = append(f.accepted, challenge)
+	for _, authz := range f.authzs {
+		for _, offered := range authz.Challenges {
+			if offered == challenge && f.onAccept != nil {
+				f.onAccept(authz, challenge)
+			}
+		}
+	}
+	return challenge, nil
+}
+
+func (f *fakeACME) WaitAuthorization(ctx context.Context, url string) (*acme.Authorization, error) {
+	if authz := f.authzs[url]; authz.Identifier.Value == f.failing {
+		return nil, errors.New("no valid TXT record found")
+	}
+	return f.authzs[url], nil
+}
+
+func (f *fakeACME) WaitOrder(ctx context.Context, url string) (*acme.Order, error) {
+	return &acme.Order{URI: url, FinalizeURL: "finalize"}, nil
+}
+
+func (f *fakeACME) CreateOrderCert(ctx context.Context, url string, csr []byte, bundle bool) ([][]byte, string, error) {
+	request, err := x509.ParseCertificateRequest(csr)
+	if err != nil {
+		return nil, "", err
+	}
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Fake ACME CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(10 * 365 * 24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &f.caKey.PublicKey, f.caKey)
+	if err != nil {
+		return nil, "", err
+	}
+	leaf := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      request.Subject,
+		DNSNames:     request.DNSNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leaf, ca, request.PublicKey, f.caKey)
+	if err != nil {
+		return nil, "", err
+	}
+	return [][]byte{leafDER, caDER}, "cert", nil
+}
+
+func (f *fakeACME) DNS01ChallengeRecord(token string) (string, error) {
+	return "dns-" + token, nil
+}
+
+func (f *fakeACME) HTTP01ChallengeResponse(token string) (string, error) {
+	return "http-" + token, nil
+}
+
+// pointsHere resolves every name to the test server's address
+type pointsHere struct{}
+
+func (pointsHere) LookupIPAddr(context.Context, string) ([]net.IPAddr, error) {
+	return []net.IPAddr{{IP: net.ParseIP("192.0.2.10")}}, nil
+}
+
+func (pointsHere) LookupTXT(context.Context, string) ([]string, error) {
+	return nil, nil
+}
+
+func (pointsHere) LookupNS(context.Context, string) ([]*net.NS, error) {
+	return nil, nil
+}
+
+// newTestSSLService creates an SSL service issuing from a fake ACME server, for domains that point
+// at the server
+func newTestSSLService(t *testing.T, db *gorm.DB) (*SSLService, *fakeACME, string) {
+	t.Helper()
+
+	cfg := testHostingConfig(t)
+	cfg.ACMEDirectoryURL = "https://acme.invalid/directory"
+	cfg.FTPUID, cfg.FTPGID = os.Getuid(), os.Getgid()
+	dns, domains := newTestDNSService(t, db, cfg)
+	domains.resolver = pointsHere{}
+	ssl := NewSSLService(db, nil, zap.NewNop(), cfg, domains, dns, nil, nil)
+	fake := newFakeACME(t)
+	ssl.acme = fake
+	return ssl, fake, cfg.ZoneDir
+}
+
+func TestRequestedNames(t *testing.T) {
+	tests := []struct {
+		names []string
+		want  []string
+	}{
+		{nil, []string{"shop.example", "www.shop.example"}},
+		{[]string{"shop.example", "*.shop.example"}, []string{"shop.example", "*.shop.example"}},
+		{[]string{" Shop.Example. ", "BLOG.shop.example", "shop.example"}, []string{"shop.example", "blog.shop.example"}},
+		{[]string{"*.blog.shop.example", "shop.example"}, []string{"*.blog.shop.example", "shop.example"}},
+		{[]string{"www.shop.example"}, nil},
+		{[]string{"shop.example", "other.example"}, nil},
+		{[]string{"shop.example", "evilshop.example"}, nil},
+		{[]string{"shop.example", "*.*.shop.example"}, nil},
+		{[]string{"shop.example", "*"}, nil},
+	}
+	for _, tt := range tests {
+		got, err := requestedNames("shop.example", tt.names)
+		if tt.want == nil {
+			if fieldMessage(err, "names") == "" {
+				t.Errorf("requestedNames(%q) = %q, want a names error", tt.names, got)
+			}
+			continue
+		}
+		if err != nil || !equalStrings(got, tt.want) {
+			t.Errorf("requestedNames(%q) = %q, %v, want %q", tt.names, got, err, tt.want)
+		}
+	}
+
+	many := make([]string, maxCertificateNames+1)
+	for i := range many {
+		many[i] = fmt.Sprintf("n%d.shop.example", i)
+	}
+	if _, err := requestedNames("shop.example", many); fieldMessage(err, "names") == "" {
+		t.Errorf("%d names accepted", len(many))
+	}
+}
+
+func TestIssueChallengeLifecycle(t *testing.T) {
+	db := newTestDB(t)
+	ssl, fake, zoneDir := newTestSSLService(t, db)
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "shop.example")
+	docRoot, blogRoot := t.TempDir(), t.TempDir()
+	db.Model(domain).Update("document_root", docRoot)
+	mustCreate(t, db, &models.Subdomain{DomainID: domain.ID, Name: "blog", DocumentRoot: blogRoot, IsActive: true})
+
+	// Every response is in place when the ACME server checks any of them
+	seen := make(map[string]string)
+	fake.onAccept = func(authz *acme.Authorization, challenge *acme.Challenge) {
+		name := authz.Identifier.Value
+		if authz.Wildcard {
+			name = "*." + name
+		}
+		seen[name] = challenge.Type
+
+		var records []models.DNSRecord
+		db.Where("domain_id = ? AND type = ?", domain.ID, "TXT").Find(&records)
+		if len(records) != 2 {
+			t.Errorf("%d challenge records while %s is checked, want 2", len(records), name)
+		}
+		zone, _ := os.ReadFile(filepath.Join(zoneDir, "shop.example.zone"))
+		if !strings.Contains(string(zone), "_acme-challenge\t") || !strings.Contains(string(zone), "_acme-challenge.api\t") {
+			t.Errorf("zone lacks the challenge records while %s is checked:\n%s", name, zone)
+		}
+		if challenge.Type == "http-01" {
+			root := docRoot
+			if name == "blog.shop.example" {
+				root = blogRoot
+			}
+			response, err := os.ReadFile(filepath.Join(root, ".well-known", "acme-challenge", challenge.Token))
+			if err != nil || string(response) != "http-"+challenge.Token {
+				t.Errorf("HTTP-01 response for %s = %q, %v", name, response, err)
+			}
+		}
+	}
+
+	names := []string{"shop.example", "*.shop.example", "blog.shop.example", "api.shop.example"}
+	certificate, err := ssl.GenerateCertificate(asUser(owner.ID, "user"), domain.ID, names)
+	if err != nil {
+		t.Fatalf("GenerateCertificate() error = %v", err)
+	}
+
+	// Wildcards and names without a site are validated over DNS, the rest over HTTP
+	want := map[string]string{"shop.example": "http-01", "*.shop.example": "dns-01", "blog.shop.example": "http-01", "api.shop.example": "dns-01"}
+	for name, challenge := range want {
+		if seen[name] != challenge {
+			t.Errorf("%s validated with %q, want %s", name, seen[name], challenge)
+		}
+	}
+
+	// The responses are gone again
+	var left int64
+	db.Model(&models.DNSRecord{}).Where("domain_id = ? AND type = ?", domain.ID, "TXT").Count(&left)
+	if left != 0 {
+		t.Errorf("%d challenge records left", left)
+	}
+	zone, _ := os.ReadFile(filepath.Join(zoneDir, "shop.example.zone"))
+	if strings.Contains(string(zone), "_acme-challenge") {
+		t.Errorf("zone keeps a challenge record:\n%s", zone)
+	}
+	for _, root := range []string{docRoot, blogRoot} {
+		if entries, _ := os.ReadDir(filepath.Join(root, ".well-known", "acme-challenge")); len(entries) != 0 {
+			t.Errorf("%d HTTP-01 responses left in %s", len(entries), root)
+		}
+	}
+
+	// The certificate covers every name and is stored with them
+	if !equalStrings(certificate.Names, names) || certificate.Type != "letsencrypt" || !certificate.IsActive {
+		t.Errorf("certificate = %+v", certificate)
+	}
+	var stored models.SSLCertificate
+	db.First(&stored, "id = ?", certificate.ID)
+	if !equalStrings(stored.Names, names) {
+		t.Errorf("stored names = %q", stored.Names)
+	}
+	leaf, err := x509.ParseCertificate(mustDecodePEM(t, stored.Certificate))
+	if err != nil || !equalStrings(leaf.DNSNames, names) {
+		t.Errorf("issued certificate = %v, %v", leaf, err)
+	}
+	if _, err := os.Stat(filepath.Join(ssl.config.SSLDir, "shop.example", "fullchain.pem")); err != nil {
+		t.Errorf("certificate not installed: %v", err)
+	}
+}
+
+func TestIssueCleansUpFailedChallenges(t *testing.T) {
+	db := newTestDB(t)
+	ssl, fake, _ := newTestSSLService(t, db)
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "shop.example")
+
+	// Redirected away, the apex cannot answer over HTTP either
+	mustCreate(t, db, &models.Redirect{DomainID: domain.ID, SourcePath: "/", TargetURL: "https://elsewhere.example/", StatusCode: 301})
+	fake.failing = "shop.example"
+
+	_, err := ssl.GenerateCertificate(asUser(owner.ID, "user"), domain.ID, []string{"shop.example", "*.shop.example"})
+	if errorCode(err) != "acme_challenge_failed" || apperrors.HTTPStatus(err) != http.StatusConflict {
+		t.Fatalf("GenerateCertificate() error = %v, want acme_challenge_failed", err)
+	}
+	for _, challenge := range fake.accepted {
+		if challenge.Type != "dns-01" {
+			t.Errorf("%s challenge accepted for a redirected domain", challenge.Type)
+		}
+	}
+
+	var left int64
+	db.Model(&models.DNSRecord{}).Where("domain_id = ? AND type = ?", domain.ID, "TXT").Count(&left)
+	if left != 0 {
+		t.Errorf("%d challenge records left after the failure", left)
+	}
+	db.Model(&models.SSLCertificate{}).Where("domain_id = ?", domain.ID).Count(&left)
+	if left != 0 {
+		t.Errorf("%d certificates stored after the failure", left)
+	}
+}
+
+func TestGenerateCertificateRefusals(t *testing.T) {
+	db := newTestDB(t)
+	ssl, fake, _ := newTestSSLService(t, db)
+	owner := createTestUser(t, db)
+	domain := createTestDomain(t, db, owner, "shop.example")
+	ctx := asUser(owner.ID, "user")
+
+	if _, err := ssl.GenerateCertificate(asUser(createTestUser(t, db).ID, "user"), domain.ID, nil); !apperrors.IsPermissionDenied(err) {
+		t.Errorf("another user's GenerateCertificate() error = %v", err)
+	}
+	if _, err := ssl.GenerateCertificate(ctx, domain.ID, []string{"shop.example", "other.example"}); fieldMessage(err, "names") == "" {
+		t.Errorf("name outside the domain: error = %v", err)
+	}
+
+	ssl.domains.resolver = unresolvable{}
+	if _, err := ssl.GenerateCertificate(ctx, domain.ID, nil); !strings.Contains(fmt.Sprint(err), "ownership not verified") {
+		t.Errorf("unverified domain: error = %v", err)
+	}
+
+	ssl.config.ACMEDirectoryURL = ""
+	if _, err := ssl.GenerateCertificate(ctx, domain.ID, nil); errorCode(err) != "acme_disabled" {
+		t.Errorf("without an ACME directory: error = %v", err)
+	}
+	if len(fake.accepted) != 0 {
+		t.Errorf("%d challenges accepted for refused requests", len(fake.accepted))
+	}
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// States of a domain's automatic certificate; none once it was issued or was never queued
+const (
+	AutoSSLPending = "pending" // Waiting for the domain to point at the server, or for a retry
+	AutoSSLFailed  = "failed"  // Retries ran out; the owner has to request a certificate
+)
+
+const (
+	// autoSSLBatchSize bounds the domains one run of IssuePendingCertificates attempts
+	autoSSLBatchSize = 20
+	// maxAutoSSLBackoff caps the doubling wait between attempts
+	maxAutoSSLBackoff = 24 * time.Hour
+)
+
+// IssuePendingCertificates attempts the automatic certificates of domains whose next attempt is
+// due. Each is verified first; one that does not point at the server yet, or fails issuance, is
+// retried after a growing backoff until hosting.auto_ssl_max_attempts, and then marked failed.
+// Suspended domains wait until they are reinstated.
+func (s *SSLService) IssuePendingCertificates(ctx context.Context) error {
+	var domains []*models.Domain
+	if err := s.db.WithContext(ctx).Preload("Node").
+		Where("auto_ssl_status = ? AND auto_ssl_next_at <= ? AND suspended_at IS NULL", AutoSSLPending, time.Now()).
+		Order("auto_ssl_next_at").
+		Limit(autoSSLBatchSize).
+		Find(&domains).Error; err != nil {
+		return fmt.Errorf("failed to load domains waiting for certificates: %w", err)
+	}
+
+	for _, domain := range domains {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := s.autoIssue(ctx, domain); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// autoIssue attempts one domain's automatic certificate and records the outcome. Issuance
+// failures are recorded on the domain; only failing to record them is returned.
+func (s *SSLService) autoIssue(ctx context.Context, domain *models.Domain) error {
+	// A certificate installed in the meantime, by the owner or an admin, ends the wait
+	var issueErr error
+	if !domain.HasSSL {
+		_, issueErr = s.generate(ctx, domain, s.autoSSLNames(ctx, domain), true)
+	}
+
+	updates := map[string]interface{}{
+		"auto_ssl_status":   "",
+		"auto_ssl_attempts": 0,
+		"auto_ssl_next_at":  nil,
+		"auto_ssl_error":    "",
+	}
+	if issueErr != nil {
+		attempts := domain.AutoSSLAttempts + 1
+		updates["auto_ssl_attempts"] = attempts
+		updates["auto_ssl_error"] = issueErr.Error()
+		if attempts >= s.config.AutoSSLMaxAttempts {
+			updates["auto_ssl_status"] = AutoSSLFailed
+			s.logger.Warn("Automatic certificate failed, giving up",
+				zap.String("domain", domain.Name), zap.Int("attempts", attempts), zap.Error(issueErr))
+		} else {
+			updates["auto_ssl_status"] = AutoSSLPending
+			updates["auto_ssl_next_at"] = time.Now().Add(min(restartBackoff(s.config.AutoSSLBackoff, attempts), maxAutoSSLBackoff))
+			s.logger.Info("Automatic certificate not issued yet, retrying later",
+				zap.String("domain", domain.Name), zap.Int("attempts", attempts), zap.Error(issueErr))
+		}
+	}
+
+	if err := s.db.WithContext(ctx).Model(&models.Domain{}).Where("id = ?", domain.ID).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to record automatic certificate of %s: %w", domain.Name, err)
+	}
+	s.domains.invalidateDomain(ctx, domain.ID)
+
+	return nil
+}
+
+// autoSSLNames are the names an automatic certificate covers: the domain, and its www name when
+// that points at the server too, so a domain without one still gets a certificate
+func (s *SSLService) autoSSLNames(ctx context.Context, domain *models.Domain) []string {
+	names := []string{domain.Name}
+
+	ipv4, ipv6 := s.domains.serverIPs(domain)
+	addrs, err := s.domains.resolver.LookupIPAddr(ctx, "www."+domain.Name)
+	if err != nil {
+		return names
+	}
+	for _, addr := range addrs {
+		if addr.IP.Equal(net.ParseIP(ipv4)) || addr.IP.Equal(net.ParseIP(ipv6)) {
+			return append(names, "www."+domain.Name)
+		}
+	}
+
+	return names
+}
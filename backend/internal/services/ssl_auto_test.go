@@ -0,0 +1,75 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// unresolvable is a resolver for which no name exists
+type unresolvable struct{}
+
+func (unresolvable) LookupIPAddr(context.Context, string) ([]net.IPAddr, error) {
+	return nil, errors.New("no such host")
+}
+
+func (unresolvable) LookupTXT(context.Context, string) ([]string, error) {
+	return nil, errors.New("no such host")
+}
+
+func (unresolvable) LookupNS(context.Context, string) ([]*net.NS, error) {
+	return nil, errors.New("no such host")
+}
+
+func TestIssuePendingCertificatesCountsAttempts(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	cfg.AutoSSLBackoff = time.Minute
+	cfg.AutoSSLMaxAttempts = 3
+	domains, _ := newTestDomainService(t, db, cfg)
+	domains.resolver = unresolvable{}
+	ssl := NewSSLService(db, nil, zap.NewNop(), cfg, domains, nil, nil, nil)
+	domain := createTestDomain(t, db, createTestUser(t, db), "pending.example")
+
+	tests := []struct {
+		attempts int
+		status   string
+	}{
+		{1, AutoSSLPending},
+		{2, AutoSSLPending},
+		{3, AutoSSLFailed},
+	}
+
+	for _, tt := range tests {
+		// Make the next attempt due
+		if err := db.Model(domain).Updates(map[string]interface{}{
+			"auto_ssl_status":  AutoSSLPending,
+			"auto_ssl_next_at": time.Now().Add(-time.Minute),
+		}).Error; err != nil {
+			t.Fatalf("queue domain: %v", err)
+		}
+		if err := ssl.IssuePendingCertificates(context.Background()); err != nil {
+			t.Fatalf("IssuePendingCertificates() error = %v", err)
+		}
+
+		var stored models.Domain
+		if err := db.Where("id = ?", domain.ID).First(&stored).Error; err != nil {
+			t.Fatalf("reload domain: %v", err)
+		}
+		if stored.AutoSSLAttempts != tt.attempts || stored.AutoSSLError == "" {
+			t.Errorf("after attempt %d: attempts = %d, error %q", tt.attempts, stored.AutoSSLAttempts, stored.AutoSSLError)
+		}
+		if stored.AutoSSLStatus != tt.status {
+			t.Errorf("status after %d attempts = %q, want %q", tt.attempts, stored.AutoSSLStatus, tt.status)
+		}
+		if tt.status == AutoSSLPending && (stored.AutoSSLNextAt == nil || !stored.AutoSSLNextAt.After(time.Now())) {
+			t.Errorf("after attempt %d: next attempt at %v, want later", tt.attempts, stored.AutoSSLNextAt)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package services
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/pkcs12"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+)
+
+// Certificate upload formats
+const (
+	CertificateFormatPEM    = "pem"
+	CertificateFormatDER    = "der"
+	CertificateFormatPKCS12 = "pkcs12"
+)
+
+// ConvertedCertificate is uploaded certificate material in the PEM form the panel stores: the
+// certificate, its chain of intermediates and a PKCS#8 private key
+type ConvertedCertificate struct {
+	Format      string    `json:"format"` // Format the certificate was uploaded in
+	Certificate string    `json:"certificate"`
+	Chain       string    `json:"chain,omitempty"`
+	PrivateKey  string    `json:"-"`
+	Names       []string  `json:"names"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// ConvertCertificate detects the format of uploaded certificate material and converts it to PEM.
+// data is a PEM bundle, DER certificates or a PKCS#12 bundle, opened with password. The private
+// key comes from keyData, PEM or DER, when given, and otherwise from data. Of the certificates,
+// the one matching the key is returned as the certificate and the others as its chain.
+//
+// PKCS#12 bundles must use the legacy 3DES or RC2 encryption; bundles exported with AES, the
+// default of OpenSSL 3, are reported as unsupported.
+func (s *SSLService) ConvertCertificate(data, keyData []byte, password string) (*ConvertedCertificate, error) {
+	format := DetectCertificateFormat(data)
+
+	var certs []*x509.Certificate
+	var key crypto.PrivateKey
+	var err error
+	switch format {
+	case CertificateFormatPEM:
+		certs, key, err = parsePEMBundle(data)
+	case CertificateFormatDER:
+		certs, err = x509.ParseCertificates(data)
+		if err != nil {
+			err = apperrors.InvalidCode("certificate", "ssl.cert_invalid", nil)
+		}
+	case CertificateFormatPKCS12:
+		certs, key, err = parsePKCS12(data, password)
+	default:
+		err = apperrors.InvalidCode("certificate", "ssl.format_unknown", nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(certs) == 0 {
+		return nil, apperrors.InvalidCode("certificate", "ssl.cert_invalid", nil)
+	}
+
+	if len(bytes.TrimSpace(keyData)) > 0 {
+		if key, err = parsePrivateKey(keyData); err != nil {
+			return nil, err
+		}
+	}
+	if key == nil {
+		return nil, apperrors.InvalidCode("private_key", "ssl.key_missing", nil)
+	}
+
+	leaf := matchingCertificate(certs, key)
+	if leaf < 0 {
+		return nil, apperrors.InvalidCode("private_key", "ssl.key_mismatch", nil)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, apperrors.InvalidCode("private_key", "ssl.key_invalid", nil)
+	}
+
+	var chain strings.Builder
+	for i, cert := range certs {
+		if i != leaf {
+			chain.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+		}
+	}
+
+	return &ConvertedCertificate{
+		Format:      format,
+		Certificate: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certs[leaf].Raw})),
+		Chain:       chain.String(),
+		PrivateKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})),
+		Names:       certificateNames(certs[leaf]),
+		ExpiresAt:   certs[leaf].NotAfter,
+	}, nil
+}
+
+// DetectCertificateFormat returns the format of uploaded certificate material, or "" when it is
+// none the panel reads
+func DetectCertificateFormat(data []byte) string {
+	switch {
+	case bytes.Contains(data, []byte("-----BEGIN ")):
+		return CertificateFormatPEM
+	case isPKCS12(data):
+		return CertificateFormatPKCS12
+	}
+	if _, err := x509.ParseCertificates(data); err == nil && len(data) > 0 {
+		return CertificateFormatDER
+	}
+	return ""
+}
+
+// isPKCS12 reports whether data is a PKCS#12 PFX structure, which starts with version 3
+func isPKCS12(data []byte) bool {
+	var pfx struct {
+		Version  int
+		AuthSafe asn1.RawValue
+		MacData  asn1.RawValue `asn1:"optional"`
+	}
+	_, err := asn1.Unmarshal(data, &pfx)
+	return err == nil && pfx.Version == 3
+}
+
+// parsePEMBundle reads the certificates and the private key, if any, of a PEM bundle
+func parsePEMBundle(data []byte) ([]*x509.Certificate, crypto.PrivateKey, error) {
+	var certs []*x509.Certificate
+	var key crypto.PrivateKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		switch {
+		case block.Type == "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, nil, apperrors.InvalidCode("certificate", "ssl.cert_invalid", nil)
+			}
+			certs = append(certs, cert)
+		case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+			parsed, err := parsePrivateKeyBlock(block)
+			if err != nil {
+				return nil, nil, err
+			}
+			key = parsed
+		}
+	}
+	return certs, key, nil
+}
+
+// parsePKCS12 reads the certificates and private key of a PKCS#12 bundle
+func parsePKCS12(data []byte, password string) ([]*x509.Certificate, crypto.PrivateKey, error) {
+	blocks, err := pkcs12.ToPEM(data, password)
+	if errors.Is(err, pkcs12.ErrIncorrectPassword) {
+		return nil, nil, apperrors.InvalidCode("password", "ssl.password", nil)
+	}
+	if err != nil {
+		return nil, nil, apperrors.InvalidCode("certificate", "ssl.pkcs12_unsupported", map[string]string{"error": err.Error()})
+	}
+
+	var bundle []byte
+	for _, block := range blocks {
+		// Bag attributes such as friendlyName become headers, which are of no use here
+		bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: block.Bytes})...)
+	}
+	return parsePEMBundle(bundle)
+}
+
+// parsePrivateKey reads a private key uploaded on its own, as PEM or DER
+func parsePrivateKey(data []byte) (crypto.PrivateKey, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		return parsePrivateKeyBlock(block)
+	}
+	return parsePrivateKeyDER(data)
+}
+
+// parsePrivateKeyBlock reads a PEM private key. Encrypted keys are refused, since the panel has
+// no use for a key it cannot read.
+func parsePrivateKeyBlock(block *pem.Block) (crypto.PrivateKey, error) {
+	if block.Type == "ENCRYPTED PRIVATE KEY" || block.Headers["Proc-Type"] != "" {
+		return nil, apperrors.InvalidCode("private_key", "ssl.key_encrypted", nil)
+	}
+	return parsePrivateKeyDER(block.Bytes)
+}
+
+// parsePrivateKeyDER reads a PKCS#8, PKCS#1 (RSA) or SEC 1 (EC) private key. PEM block types
+// are not trusted to name the encoding: PKCS#12 bundles yield PKCS#1 and SEC 1 keys as
+// "PRIVATE KEY".
+func parsePrivateKeyDER(der []byte) (crypto.PrivateKey, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	return nil, apperrors.InvalidCode("private_key", "ssl.key_invalid", nil)
+}
+
+// matchingCertificate returns the index of the certificate for key, or -1
+func matchingCertificate(certs []*x509.Certificate, key crypto.PrivateKey) int {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return -1
+	}
+	public, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok {
+		return -1
+	}
+
+	for i, cert := range certs {
+		if public.Equal(cert.PublicKey) {
+			return i
+		}
+	}
+	return -1
+}
+
+// certificateNames returns the names a certificate covers: its DNS names, or its common name
+// for certificates without any
+func certificateNames(cert *x509.Certificate) []string {
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames
+	}
+	if cert.Subject.CommonName != "" {
+		return []string{cert.Subject.CommonName}
+	}
+	return []string{}
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestRenewCertificatesSelectsDueCertificates(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t) // No ACME directory, so every attempted renewal fails
+	domains, _ := newTestDomainService(t, db, cfg)
+	ssl := NewSSLService(db, nil, zap.NewNop(), cfg, domains, nil, nil, nil)
+	owner := createTestUser(t, db)
+
+	certificate := func(name, kind string, expiresIn time.Duration, autoRenew bool) {
+		domain := createTestDomain(t, db, owner, name)
+		cert := &models.SSLCertificate{DomainID: domain.ID, Type: kind, Names: []string{name}, IsActive: true, ExpiresAt: time.Now().Add(expiresIn)}
+		db.Create(cert)
+		db.Model(cert).Update("auto_renew", autoRenew)
+	}
+	certificate("due.example", "letsencrypt", 10*24*time.Hour, true)
+	certificate("later.example", "letsencrypt", 80*24*time.Hour, true)
+	certificate("custom.example", "custom", 10*24*time.Hour, true)
+	certificate("manual.example", "letsencrypt", 10*24*time.Hour, false)
+	certificate("suspended.example", "letsencrypt", 10*24*time.Hour, true)
+	db.Model(&models.Domain{}).Where("name = ?", "suspended.example").Update("suspended_at", time.Now())
+
+	err := ssl.RenewCertificates(context.Background())
+	if err == nil {
+		t.Fatal("renewal without an ACME directory succeeded")
+	}
+	if !strings.Contains(err.Error(), "1 of 1") || !strings.Contains(err.Error(), "due.example") {
+		t.Errorf("err = %v, want only due.example attempted", err)
+	}
+}
+
+func TestRenewCertificatesWithNothingDue(t *testing.T) {
+	db := newTestDB(t)
+	cfg := testHostingConfig(t)
+	domains, _ := newTestDomainService(t, db, cfg)
+	ssl := NewSSLService(db, nil, zap.NewNop(), cfg, domains, nil, nil, nil)
+
+	if err := ssl.RenewCertificates(context.Background()); err != nil {
+		t.Errorf("renew: %v", err)
+	}
+}
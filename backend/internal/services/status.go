@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/cache"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// Public status page states, from best to worst
+const (
+	StatusOperational = "operational"
+	StatusUnknown     = "unknown"
+	StatusDegraded    = "degraded"
+	StatusOutage      = "outage"
+)
+
+const (
+	publicStatusKey = "cache:public_status"
+	statusNoticeKey = "status:notice"
+	// maxStatusNotice bounds the incident note shown on the status page
+	maxStatusNotice = 2000
+)
+
+// statusRank orders states so the worst of several can be picked
+var statusRank = map[string]int{
+	StatusOperational: 0,
+	StatusUnknown:     1,
+	StatusDegraded:    2,
+	StatusOutage:      3,
+}
+
+// PublicStatus is the status page shown without authentication. It deliberately carries only
+// component names and states: service names, hosts and error details stay internal.
+type PublicStatus struct {
+	Status     string            `json:"status"`
+	Components []ComponentStatus `json:"components"`
+	Notice     string            `json:"notice,omitempty"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+}
+
+// ComponentStatus is the state of one published component
+type ComponentStatus struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+// StatusService builds the public status page from the managed service checks
+type StatusService struct {
+	db     *gorm.DB
+	redis  *redis.Client
+	logger *zap.Logger
+	config config.StatusConfig
+	cache  *cache.Cache
+}
+
+// NewStatusService creates a new status service. The page is cached for the configured TTL
+// whether or not the read cache is enabled, since it is served to anyone.
+func NewStatusService(db *gorm.DB, redis *redis.Client, logger *zap.Logger, cfg config.StatusConfig) *StatusService {
+	return &StatusService{
+		db:     db,
+		redis:  redis,
+		logger: logger,
+		config: cfg,
+		cache:  cache.New(redis, config.CacheConfig{Enabled: true, TTL: cfg.CacheTTL}),
+	}
+}
+
+// PublicStatus returns the status page
+func (s *StatusService) PublicStatus(ctx context.Context) (*PublicStatus, error) {
+	return cache.GetOrSet(ctx, s.cache, publicStatusKey, func() (*PublicStatus, error) {
+		return s.buildStatus(ctx)
+	})
+}
+
+// SetNotice publishes an incident note on the status page; an empty one removes it
+func (s *StatusService) SetNotice(ctx context.Context, notice string) error {
+	notice = strings.TrimSpace(notice)
+	if len(notice) > maxStatusNotice {
+		return apperrors.InvalidCode("notice", "field.max_length", map[string]string{"max": strconv.Itoa(maxStatusNotice)})
+	}
+
+	var err error
+	if notice == "" {
+		err = s.redis.Del(ctx, statusNoticeKey).Err()
+	} else {
+		err = s.redis.Set(ctx, statusNoticeKey, notice, 0).Err()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to store status notice: %w", err)
+	}
+
+	return s.cache.Invalidate(ctx, publicStatusKey)
+}
+
+func (s *StatusService) buildStatus(ctx context.Context) (*PublicStatus, error) {
+	var names []string
+	for _, component := range s.config.Components {
+		names = append(names, component.Services...)
+	}
+
+	var checks []*models.ServiceStatus
+	if len(names) > 0 {
+		if err := s.db.WithContext(ctx).
+			Select("service_name", "status", "last_checked").
+			Where("service_name IN ?", names).
+			Order("last_checked DESC").
+			Find(&checks).Error; err != nil {
+			return nil, fmt.Errorf("failed to get service statuses: %w", err)
+		}
+	}
+
+	now := time.Now().UTC()
+	status := &PublicStatus{
+		Components: ComponentStatuses(s.config.Components, checks, now.Add(-s.config.StaleAfter)),
+		UpdatedAt:  now,
+	}
+	status.Status = overallStatus(status.Components)
+
+	notice, err := s.redis.Get(ctx, statusNoticeKey).Result()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		// The page is still useful without the note
+		s.logger.Warn("Failed to load status notice", zap.Error(err))
+	}
+	status.Notice = notice
+
+	return status, nil
+}
+
+// ComponentStatuses derives the state of each component from the latest check of its services,
+// given newest first: operational when all run, outage when none do, degraded in between.
+// Services without a check since staleBefore are unknown, and make the component unknown unless
+// another service is down.
+func ComponentStatuses(components []config.StatusComponent, checks []*models.ServiceStatus, staleBefore time.Time) []ComponentStatus {
+	latest := make(map[string]*models.ServiceStatus)
+	for _, check := range checks {
+		if _, ok := latest[check.ServiceName]; !ok {
+			latest[check.ServiceName] = check
+		}
+	}
+
+	statuses := make([]ComponentStatus, 0, len(components))
+	for _, component := range components {
+		up, down, unknown := 0, 0, 0
+		for _, name := range component.Services {
+			check, ok := latest[name]
+			switch {
+			case !ok || check.LastChecked.Before(staleBefore):
+				unknown++
+			case check.Status == "running":
+				up++
+			default:
+				down++
+			}
+		}
+
+		state := StatusOperational
+		switch {
+		case down > 0 && up == 0 && unknown == 0:
+			state = StatusOutage
+		case down > 0:
+			state = StatusDegraded
+		case unknown > 0:
+			state = StatusUnknown
+		}
+		statuses = append(statuses, ComponentStatus{Name: component.Name, Status: state})
+	}
+
+	return statuses
+}
+
+// overallStatus is the worst component state, or unknown when nothing is published
+func overallStatus(components []ComponentStatus) string {
+	if len(components) == 0 {
+		return StatusUnknown
+	}
+
+	overall := StatusOperational
+	for _, component := range components {
+		if statusRank[component.Status] > statusRank[overall] {
+			overall = component.Status
+		}
+	}
+	return overall
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestComponentStatuses(t *testing.T) {
+	now := time.Now()
+	staleBefore := now.Add(-5 * time.Minute)
+	checks := []*models.ServiceStatus{
+		{ServiceName: "nginx", Status: "running", LastChecked: now},
+		{ServiceName: "php-fpm", Status: "failed", LastChecked: now},
+		{ServiceName: "mysql", Status: "stopped", LastChecked: now},
+		{ServiceName: "postfix", Status: "running", LastChecked: now.Add(-time.Hour)},
+		// Older checks than the first of a service are ignored
+		{ServiceName: "nginx", Status: "failed", LastChecked: now.Add(-time.Minute)},
+		{ServiceName: "mysql", Status: "running", LastChecked: now.Add(-time.Minute)},
+	}
+
+	tests := []struct {
+		services []string
+		want     string
+	}{
+		{[]string{"nginx"}, StatusOperational},
+		{[]string{"nginx", "php-fpm"}, StatusDegraded},
+		{[]string{"php-fpm", "mysql"}, StatusOutage},
+		{[]string{"postfix"}, StatusUnknown},
+		{[]string{"nginx", "dovecot"}, StatusUnknown},
+		{[]string{"mysql", "postfix"}, StatusDegraded},
+	}
+	for _, tt := range tests {
+		components := []config.StatusComponent{{Name: "Component", Services: tt.services}}
+		got := ComponentStatuses(components, checks, staleBefore)
+		if len(got) != 1 || got[0].Status != tt.want {
+			t.Errorf("ComponentStatuses(%v) = %+v, want %s", tt.services, got, tt.want)
+		}
+	}
+}
+
+func TestOverallStatus(t *testing.T) {
+	tests := []struct {
+		states []string
+		want   string
+	}{
+		{nil, StatusUnknown},
+		{[]string{StatusOperational, StatusOperational}, StatusOperational},
+		{[]string{StatusOperational, StatusUnknown}, StatusUnknown},
+		{[]string{StatusUnknown, StatusDegraded}, StatusDegraded},
+		{[]string{StatusOutage, StatusDegraded, StatusOperational}, StatusOutage},
+	}
+	for _, tt := range tests {
+		var components []ComponentStatus
+		for _, state := range tt.states {
+			components = append(components, ComponentStatus{Name: "c", Status: state})
+		}
+		if got := overallStatus(components); got != tt.want {
+			t.Errorf("overallStatus(%v) = %s, want %s", tt.states, got, tt.want)
+		}
+	}
+}
+
+func TestPublicStatus(t *testing.T) {
+	db := newTestDB(t)
+	client, _ := newTestRedis(t)
+	status := NewStatusService(db, client, zap.NewNop(), config.StatusConfig{
+		Components: []config.StatusComponent{
+			{Name: "Websites", Services: []string{"nginx", "php-fpm"}},
+			{Name: "Email", Services: []string{"postfix"}},
+		},
+		CacheTTL:   time.Minute,
+		StaleAfter: 5 * time.Minute,
+	})
+	ctx := context.Background()
+	mustCreate(t, db, &models.ServiceStatus{ServiceName: "nginx", Status: "running", LastChecked: time.Now()})
+	mustCreate(t, db, &models.ServiceStatus{ServiceName: "php-fpm", Status: "failed", LastChecked: time.Now()})
+	mustCreate(t, db, &models.ServiceStatus{ServiceName: "postfix", Status: "running", LastChecked: time.Now()})
+
+	page, err := status.PublicStatus(ctx)
+	if err != nil {
+		t.Fatalf("PublicStatus() error = %v", err)
+	}
+	want := []ComponentStatus{{Name: "Websites", Status: StatusDegraded}, {Name: "Email", Status: StatusOperational}}
+	if !reflect.DeepEqual(page.Components, want) || page.Status != StatusDegraded || page.Notice != "" {
+		t.Errorf("PublicStatus() = %+v", page)
+	}
+
+	// The page is served from the cache until a notice is set
+	db.Model(&models.ServiceStatus{}).Where("service_name = ?", "php-fpm").Update("status", "running")
+	if cached, _ := status.PublicStatus(ctx); cached.Status != StatusDegraded {
+		t.Errorf("cached status = %s, want degraded", cached.Status)
+	}
+	if err := status.SetNotice(ctx, "  PHP restarted after an update  "); err != nil {
+		t.Fatalf("SetNotice() error = %v", err)
+	}
+	page, _ = status.PublicStatus(ctx)
+	if page.Status != StatusOperational || page.Notice != "PHP restarted after an update" {
+		t.Errorf("after SetNotice: %+v", page)
+	}
+
+	if err := status.SetNotice(ctx, strings.Repeat("x", maxStatusNotice+1)); apperrors.HTTPStatus(err) != http.StatusUnprocessableEntity {
+		t.Errorf("long notice: error = %v, want a validation error", err)
+	}
+	if err := status.SetNotice(ctx, ""); err != nil {
+		t.Fatalf("clear notice: %v", err)
+	}
+	if page, _ = status.PublicStatus(ctx); page.Notice != "" {
+		t.Errorf("notice = %q after clearing it", page.Notice)
+	}
+}
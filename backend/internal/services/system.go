@@ -2,25 +2,91 @@ package services
 
 import (
 	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/database"
+	"github.com/mynodecp/mynodecp/backend/internal/egress"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/pagination"
+	"github.com/mynodecp/mynodecp/backend/internal/runner"
+)
+
+// selfTestTimeout bounds how long a single self-test check may take
+const selfTestTimeout = 10 * time.Second
+
+// Self-test check statuses
+const (
+	CheckStatusOK      = "ok"
+	CheckStatusFailed  = "failed"
+	CheckStatusSkipped = "skipped"
 )
 
+// Dialer opens network connections; satisfied by *net.Dialer
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// SelfTestResult is the outcome of a single self-test check
+type SelfTestResult struct {
+	Name        string        `json:"name"`
+	Status      string        `json:"status"`
+	Message     string        `json:"message,omitempty"`
+	Remediation string        `json:"remediation,omitempty"`
+	Duration    time.Duration `json:"duration"`
+}
+
+// selfTestCheck describes a runnable self-test check
+type selfTestCheck struct {
+	run         func(ctx context.Context) (skipped bool, err error)
+	remediation string
+}
+
 // SystemService handles system monitoring operations
 type SystemService struct {
 	db     *gorm.DB
 	redis  *redis.Client
 	logger *zap.Logger
+	config config.HostingConfig
+
+	dialer       Dialer
+	httpClient   *http.Client
+	runner       runner.Runner
+	provisioning *database.Provisioning
+
+	notifications *NotificationService
+	now           func() time.Time
+
+	watchMu sync.Mutex
+	watches map[string]*serviceWatch // Watchdog state by unit
 }
 
-// NewSystemService creates a new system service
-func NewSystemService(db *gorm.DB, redis *redis.Client, logger *zap.Logger) *SystemService {
+// NewSystemService creates a new system service. provisioning may be nil when no provisioning
+// user is configured. HTTP checks follow the outbound policy.
+func NewSystemService(db *gorm.DB, redis *redis.Client, logger *zap.Logger, config config.HostingConfig, runner runner.Runner, provisioning *database.Provisioning, outbound *egress.Policy, notifications *NotificationService) *SystemService {
 	return &SystemService{
-		db:     db,
-		redis:  redis,
-		logger: logger,
+		db:           db,
+		redis:        redis,
+		logger:       logger,
+		config:       config,
+		dialer:       &net.Dialer{},
+		httpClient:   outbound.Client(selfTestTimeout),
+		runner:       runner,
+		provisioning: provisioning,
+
+		notifications: notifications,
+		now:           time.Now,
+		watches:       make(map[string]*serviceWatch),
 	}
 }
 
@@ -30,7 +96,218 @@ func (s *SystemService) GetSystemStats(ctx context.Context) (interface{}, error)
 	return nil, nil
 }
 
-func (s *SystemService) GetServiceStatus(ctx context.Context) (interface{}, error) {
-	// TODO: Implement service status checking
-	return nil, nil
+// GetMetrics retrieves recorded metrics newest first, optionally of one type, one page at a time.
+// Pass the returned cursor to fetch the next page; it is empty on the last page.
+func (s *SystemService) GetMetrics(ctx context.Context, metricType, cursor string, limit int) ([]*models.SystemMetric, string, error) {
+	query := s.db.WithContext(ctx).Model(&models.SystemMetric{})
+	if metricType != "" {
+		query = query.Where("type = ?", metricType)
+	}
+
+	limit = pagination.ClampLimit(limit)
+	query, err := pagination.Apply(query, cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var metrics []*models.SystemMetric
+	if err := query.Find(&metrics).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to get metrics: %w", err)
+	}
+
+	metrics, next := pagination.Next(metrics, limit, func(metric *models.SystemMetric) pagination.Cursor {
+		return pagination.Cursor{CreatedAt: metric.CreatedAt, ID: metric.ID.String()}
+	})
+	return metrics, next, nil
+}
+
+// SelfTestChecks returns the names of all available self-test checks
+func (s *SystemService) SelfTestChecks() []string {
+	return []string{"provisioning_db", "nameserver_api", "mta_config", "backup_storage", "acme_directory"}
+}
+
+// SelfTest runs every self-test check and reports the status of each
+func (s *SystemService) SelfTest(ctx context.Context) []SelfTestResult {
+	names := s.SelfTestChecks()
+	results := make([]SelfTestResult, 0, len(names))
+	for _, name := range names {
+		result, _ := s.RunSelfTestCheck(ctx, name)
+		results = append(results, *result)
+	}
+
+	return results
+}
+
+// RunSelfTestCheck runs a single self-test check by name
+func (s *SystemService) RunSelfTestCheck(ctx context.Context, name string) (*SelfTestResult, error) {
+	check, ok := s.selfTestChecks()[name]
+	if !ok {
+		return &SelfTestResult{Name: name, Status: CheckStatusFailed, Message: "unknown check"}, fmt.Errorf("unknown self-test check: %s", name)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, selfTestTimeout)
+	defer cancel()
+
+	start := time.Now()
+	skipped, err := check.run(ctx)
+	result := &SelfTestResult{
+		Name:     name,
+		Status:   CheckStatusOK,
+		Duration: time.Since(start),
+	}
+
+	switch {
+	case skipped:
+		result.Status = CheckStatusSkipped
+		result.Message = "not configured"
+	case err != nil:
+		result.Status = CheckStatusFailed
+		result.Message = err.Error()
+		result.Remediation = check.remediation
+		s.logger.Warn("Self-test check failed", zap.String("check", name), zap.Error(err))
+	}
+
+	return result, nil
+}
+
+func (s *SystemService) selfTestChecks() map[string]selfTestCheck {
+	return map[string]selfTestCheck{
+		"provisioning_db": {
+			run:         s.checkProvisioningDB,
+			remediation: "Ensure the database server is running, hosting.provisioning_db_addr points to it and the provisioning user can log in.",
+		},
+		"nameserver_api": {
+			run:         s.checkNameserverAPI,
+			remediation: "Verify hosting.nameserver_api_url and that the nameserver API is running and reachable.",
+		},
+		"mta_config": {
+			run:         s.checkMTAConfig,
+			remediation: "Fix the errors reported by the MTA configuration check before reloading the mail server.",
+		},
+		"backup_storage": {
+			run:         s.checkBackupStorage,
+			remediation: "Create hosting.backup_dir and make it writable by the panel user, and check free disk space.",
+		},
+		"acme_directory": {
+			run:         s.checkACMEDirectory,
+			remediation: "Allow outbound HTTPS to the ACME server and verify hosting.acme_directory_url.",
+		},
+	}
+}
+
+func (s *SystemService) checkProvisioningDB(ctx context.Context) (bool, error) {
+	if s.config.ProvisioningDBAddr == "" {
+		return true, nil
+	}
+
+	// With credentials, check that the server also accepts the provisioning user
+	if s.provisioning != nil {
+		if err := s.provisioning.Ping(ctx); err != nil {
+			return false, fmt.Errorf("database server unreachable: %w", err)
+		}
+		return false, nil
+	}
+
+	conn, err := s.dialer.DialContext(ctx, "tcp", s.config.ProvisioningDBAddr)
+	if err != nil {
+		return false, fmt.Errorf("database server unreachable: %w", err)
+	}
+	conn.Close()
+
+	return false, nil
+}
+
+func (s *SystemService) checkNameserverAPI(ctx context.Context) (bool, error) {
+	if s.config.NameserverAPIURL == "" {
+		return true, nil
+	}
+
+	status, err := s.httpStatus(ctx, s.config.NameserverAPIURL)
+	if err != nil {
+		return false, fmt.Errorf("nameserver API unreachable: %w", err)
+	}
+	if status >= http.StatusInternalServerError {
+		return false, fmt.Errorf("nameserver API returned status %d", status)
+	}
+
+	return false, nil
+}
+
+func (s *SystemService) checkMTAConfig(ctx context.Context) (bool, error) {
+	fields := strings.Fields(s.config.MTACheckCommand)
+	if len(fields) == 0 {
+		return true, nil
+	}
+
+	stdout, stderr, err := s.runner.Run(ctx, fields[0], fields[1:]...)
+	if err != nil {
+		output := strings.TrimSpace(string(stdout) + "\n" + string(stderr))
+		return false, fmt.Errorf("MTA configuration check failed: %v: %s", err, output)
+	}
+
+	return false, nil
+}
+
+func (s *SystemService) checkBackupStorage(ctx context.Context) (bool, error) {
+	if s.config.BackupDir == "" {
+		return true, nil
+	}
+
+	if err := os.MkdirAll(s.config.BackupDir, 0750); err != nil {
+		return false, fmt.Errorf("backup directory unavailable: %w", err)
+	}
+
+	file, err := os.CreateTemp(s.config.BackupDir, ".selftest-*")
+	if err != nil {
+		return false, fmt.Errorf("backup directory not writable: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if _, err := file.WriteString("mynodecp self-test"); err != nil {
+		return false, fmt.Errorf("failed to write to backup directory: %w", err)
+	}
+
+	return false, nil
+}
+
+func (s *SystemService) checkACMEDirectory(ctx context.Context) (bool, error) {
+	if s.config.ACMEDirectoryURL == "" {
+		return true, nil
+	}
+
+	status, err := s.httpStatus(ctx, s.config.ACMEDirectoryURL)
+	if err != nil {
+		return false, fmt.Errorf("ACME directory unreachable: %w", err)
+	}
+	if status != http.StatusOK {
+		return false, fmt.Errorf("ACME directory returned status %d", status)
+	}
+
+	return false, nil
+}
+
+func (s *SystemService) httpStatus(ctx context.Context, url string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode, nil
+}
+
+// PurgeMetrics deletes metrics recorded before the cutoff and returns how many were removed
+func (s *SystemService) PurgeMetrics(ctx context.Context, before time.Time) (int64, error) {
+	result := s.db.WithContext(ctx).Where("created_at < ?", before).Delete(&models.SystemMetric{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to purge metrics: %w", result.Error)
+	}
+
+	return result.RowsAffected, nil
 }
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/database"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/runner"
+)
+
+// statusServer answers every request with the status
+func statusServer(t *testing.T, status int) string {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestSelfTestSkipsUnconfiguredChecks(t *testing.T) {
+	system := NewSystemService(nil, nil, zap.NewNop(), config.HostingConfig{}, runner.NewFake(), nil, nil, nil)
+
+	results := system.SelfTest(context.Background())
+	if len(results) != len(system.SelfTestChecks()) {
+		t.Fatalf("SelfTest() ran %d checks, want %d", len(results), len(system.SelfTestChecks()))
+	}
+	for _, result := range results {
+		if result.Status != CheckStatusSkipped {
+			t.Errorf("%s = %s, want skipped", result.Name, result.Status)
+		}
+	}
+}
+
+func TestRunSelfTestCheck(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	closed.Close()
+
+	blocked := filepath.Join(t.TempDir(), "backups")
+	if err := os.WriteFile(blocked, nil, 0644); err != nil {
+		t.Fatalf("block backup directory: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		check  string
+		config config.HostingConfig
+		mta    runner.Result
+		want   string
+	}{
+		{name: "database server up", check: "provisioning_db", config: config.HostingConfig{ProvisioningDBAddr: listener.Addr().String()}, want: CheckStatusOK},
+		{name: "database server down", check: "provisioning_db", config: config.HostingConfig{ProvisioningDBAddr: closed.Addr().String()}, want: CheckStatusFailed},
+		{name: "nameserver API up", check: "nameserver_api", config: config.HostingConfig{NameserverAPIURL: statusServer(t, http.StatusUnauthorized)}, want: CheckStatusOK},
+		{name: "nameserver API failing", check: "nameserver_api", config: config.HostingConfig{NameserverAPIURL: statusServer(t, http.StatusBadGateway)}, want: CheckStatusFailed},
+		{name: "MTA configuration valid", check: "mta_config", config: config.HostingConfig{MTACheckCommand: "postfix check"}, want: CheckStatusOK},
+		{name: "MTA configuration invalid", check: "mta_config", config: config.HostingConfig{MTACheckCommand: "postfix check"}, mta: runnerFailure("main.cf: syntax error"), want: CheckStatusFailed},
+		{name: "backup storage writable", check: "backup_storage", config: config.HostingConfig{BackupDir: filepath.Join(t.TempDir(), "backups")}, want: CheckStatusOK},
+		{name: "backup storage unavailable", check: "backup_storage", config: config.HostingConfig{BackupDir: blocked}, want: CheckStatusFailed},
+		{name: "ACME directory up", check: "acme_directory", config: config.HostingConfig{ACMEDirectoryURL: statusServer(t, http.StatusOK)}, want: CheckStatusOK},
+		{name: "ACME directory missing", check: "acme_directory", config: config.HostingConfig{ACMEDirectoryURL: statusServer(t, http.StatusNotFound)}, want: CheckStatusFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := runner.NewFake()
+			fake.Respond("postfix", tt.mta)
+			system := NewSystemService(nil, nil, zap.NewNop(), tt.config, fake, nil, nil, nil)
+
+			result, err := system.RunSelfTestCheck(context.Background(), tt.check)
+			if err != nil {
+				t.Fatalf("RunSelfTestCheck() error = %v", err)
+			}
+			if result.Status != tt.want {
+				t.Fatalf("status = %s (%s), want %s", result.Status, result.Message, tt.want)
+			}
+			if tt.want == CheckStatusFailed && (result.Message == "" || result.Remediation == "") {
+				t.Errorf("failed check lacks a message or remediation: %+v", result)
+			}
+			if tt.check == "mta_config" && tt.want == CheckStatusFailed && !strings.Contains(result.Message, "syntax error") {
+				t.Errorf("message %q lacks the MTA output", result.Message)
+			}
+		})
+	}
+}
+
+func TestProvisioningDBCheckLogsIn(t *testing.T) {
+	// The server accepts connections but never completes a login
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	cfg := config.HostingConfig{
+		ProvisioningDBAddr:         listener.Addr().String(),
+		ProvisioningDBUser:         "provision",
+		ProvisioningDBMaxOpenConns: 1,
+		ProvisioningDBDialTimeout:  100 * time.Millisecond,
+		ProvisioningDBQueryTimeout: 100 * time.Millisecond,
+	}
+	provisioning, err := database.NewProvisioning(cfg, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewProvisioning() error = %v", err)
+	}
+	defer provisioning.Close()
+
+	system := NewSystemService(nil, nil, zap.NewNop(), cfg, runner.NewFake(), provisioning, nil, nil)
+	result, err := system.RunSelfTestCheck(context.Background(), "provisioning_db")
+	if err != nil {
+		t.Fatalf("RunSelfTestCheck() error = %v", err)
+	}
+	if result.Status != CheckStatusFailed {
+		t.Errorf("status = %s, want failed when the provisioning user cannot log in", result.Status)
+	}
+}
+
+func TestRunUnknownSelfTestCheck(t *testing.T) {
+	system := NewSystemService(nil, nil, zap.NewNop(), config.HostingConfig{}, runner.NewFake(), nil, nil, nil)
+
+	if _, err := system.RunSelfTestCheck(context.Background(), "coffee_machine"); err == nil {
+		t.Error("unknown check ran")
+	}
+}
+
+func TestGetMetricsPages(t *testing.T) {
+	db := newTestDB(t)
+	system := NewSystemService(db, nil, zap.NewNop(), config.HostingConfig{}, runner.NewFake(), nil, nil, nil)
+	base := time.Now().Add(-time.Hour)
+	for i := 0; i < 5; i++ {
+		mustCreate(t, db, &models.SystemMetric{Type: "cpu", Value: float64(i), Unit: "percent", CreatedAt: base.Add(time.Duration(i) * time.Minute)})
+		mustCreate(t, db, &models.SystemMetric{Type: "memory", Value: float64(i), Unit: "bytes", CreatedAt: base.Add(time.Duration(i) * time.Minute)})
+	}
+
+	var values []float64
+	cursor := ""
+	for {
+		metrics, next, err := system.GetMetrics(context.Background(), "cpu", cursor, 2)
+		if err != nil {
+			t.Fatalf("GetMetrics() error = %v", err)
+		}
+		for _, metric := range metrics {
+			if metric.Type != "cpu" {
+				t.Errorf("metric of type %s in a cpu page", metric.Type)
+			}
+			values = append(values, metric.Value)
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if len(values) != 5 || values[0] != 4 || values[4] != 0 {
+		t.Errorf("paged values = %v, want 4 to 0", values)
+	}
+
+	if _, _, err := system.GetMetrics(context.Background(), "", "not-a-cursor", 2); err == nil {
+		t.Error("malformed cursor accepted")
+	}
+}
@@ -0,0 +1,261 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/i18n"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// Service states recorded in the service checks, as the status page reads them
+const (
+	ServiceRunning = "running"
+	ServiceStopped = "stopped"
+	ServiceFailed  = "failed"
+)
+
+// serviceWatch is the watchdog's state of one service
+type serviceWatch struct {
+	attempts    int       // Restarts in a row since the service last ran
+	nextAttempt time.Time // No restart before this
+	lastError   string
+	alerted     bool // Admins were told the watchdog gave up
+}
+
+// WatchedService is the state of a service looked after by the watchdog
+type WatchedService struct {
+	Name        string     `json:"name"`
+	Status      string     `json:"status"` // running, stopped, failed; empty before the first check
+	LastChecked *time.Time `json:"last_checked,omitempty"`
+	Attempts    int        `json:"restart_attempts"` // Restarts in a row since it last ran
+	NextAttempt *time.Time `json:"next_attempt,omitempty"`
+	GaveUp      bool       `json:"gave_up"` // Not restarted again until it runs
+}
+
+// unitState maps the output of systemctl is-active to a service state. It reports false for
+// output it does not know, such as when systemctl itself failed.
+func unitState(output string) (string, bool) {
+	switch strings.TrimSpace(output) {
+	case "active", "reloading", "activating":
+		return ServiceRunning, true
+	case "inactive", "deactivating":
+		return ServiceStopped, true
+	case "failed":
+		return ServiceFailed, true
+	}
+	return "", false
+}
+
+// restartBackoff returns how long the watchdog waits after the given restart attempt: the
+// configured backoff, doubled with each further attempt
+func restartBackoff(base time.Duration, attempt int) time.Duration {
+	if attempt < 1 {
+		return 0
+	}
+	if attempt > 16 {
+		attempt = 16
+	}
+	return base << (attempt - 1)
+}
+
+// GetServiceStatus returns the state of each service the watchdog looks after, from its latest
+// check, with the watchdog's restart attempts
+func (s *SystemService) GetServiceStatus(ctx context.Context) ([]*WatchedService, error) {
+	services := s.config.WatchdogServices
+
+	var checks []*models.ServiceStatus
+	if len(services) > 0 {
+		if err := s.db.WithContext(ctx).Where("service_name IN ?", services).Find(&checks).Error; err != nil {
+			return nil, fmt.Errorf("failed to get service statuses: %w", err)
+		}
+	}
+	latest := make(map[string]*models.ServiceStatus, len(checks))
+	for _, check := range checks {
+		if current, ok := latest[check.ServiceName]; !ok || check.LastChecked.After(current.LastChecked) {
+			latest[check.ServiceName] = check
+		}
+	}
+
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+
+	statuses := make([]*WatchedService, 0, len(services))
+	for _, name := range services {
+		status := &WatchedService{Name: name}
+		if check, ok := latest[name]; ok {
+			status.Status = check.Status
+			lastChecked := check.LastChecked
+			status.LastChecked = &lastChecked
+		}
+		if watch, ok := s.watches[name]; ok && watch.attempts > 0 {
+			status.Attempts = watch.attempts
+			status.GaveUp = watch.attempts >= s.config.WatchdogMaxAttempts
+			if !status.GaveUp {
+				nextAttempt := watch.nextAttempt
+				status.NextAttempt = &nextAttempt
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// ServiceRestarts lists the watchdog's restart attempts newest first, optionally of one service
+func (s *SystemService) ServiceRestarts(ctx context.Context, service string, limit int) ([]*models.ServiceRestart, error) {
+	query := s.db.WithContext(ctx).Order("created_at DESC").Limit(limit)
+	if service != "" {
+		query = query.Where("service = ?", service)
+	}
+
+	var restarts []*models.ServiceRestart
+	if err := query.Find(&restarts).Error; err != nil {
+		return nil, fmt.Errorf("failed to get service restarts: %w", err)
+	}
+	return restarts, nil
+}
+
+// WatchServices checks each configured service and restarts those found failed. Restarts of a
+// service back off, and stop after the configured number in a row; admins are then alerted once.
+// A service counts as recovered when it still runs once its backoff has passed, so one that keeps
+// crashing right after its restarts still reaches the limit.
+func (s *SystemService) WatchServices(ctx context.Context) error {
+	for _, service := range s.config.WatchdogServices {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		s.watchService(ctx, service)
+	}
+	return nil
+}
+
+// watchService checks one service and restarts it when due
+func (s *SystemService) watchService(ctx context.Context, service string) {
+	stdout, _, err := s.runner.Run(ctx, "systemctl", "is-active", service)
+	state, known := unitState(string(stdout))
+	if !known {
+		// systemctl is-active exits non-zero for stopped and failed units, so only output it
+		// does not know means the check itself failed
+		s.logger.Warn("Failed to check service", zap.String("service", service), zap.Error(err))
+		return
+	}
+	s.recordServiceCheck(ctx, service, state)
+
+	now := s.now()
+	s.watchMu.Lock()
+	watch, ok := s.watches[service]
+	if !ok {
+		watch = &serviceWatch{}
+		s.watches[service] = watch
+	}
+
+	if state != ServiceFailed {
+		if watch.attempts > 0 && state == ServiceRunning && !now.Before(watch.nextAttempt) {
+			s.logger.Info("Service recovered", zap.String("service", service), zap.Int("restarts", watch.attempts))
+			*watch = serviceWatch{}
+		}
+		s.watchMu.Unlock()
+		return
+	}
+
+	if watch.attempts >= s.config.WatchdogMaxAttempts {
+		alert := !watch.alerted
+		watch.alerted = true
+		attempts, lastError := watch.attempts, watch.lastError
+		s.watchMu.Unlock()
+		if alert {
+			s.alertServiceDown(ctx, service, attempts, lastError)
+		}
+		return
+	}
+	if now.Before(watch.nextAttempt) {
+		s.watchMu.Unlock()
+		return
+	}
+	watch.attempts++
+	watch.nextAttempt = now.Add(restartBackoff(s.config.WatchdogBackoff, watch.attempts))
+	attempt := watch.attempts
+	s.watchMu.Unlock()
+
+	restartErr := s.restartService(ctx, service)
+
+	restart := &models.ServiceRestart{Service: service, Attempt: attempt, Success: restartErr == nil}
+	if restartErr != nil {
+		restart.Error = restartErr.Error()
+		s.watchMu.Lock()
+		watch.lastError = restart.Error
+		s.watchMu.Unlock()
+		s.logger.Error("Failed to restart service", zap.String("service", service), zap.Int("attempt", attempt), zap.Error(restartErr))
+	} else {
+		s.logger.Warn("Restarted failed service", zap.String("service", service), zap.Int("attempt", attempt))
+	}
+	if err := s.db.WithContext(ctx).Create(restart).Error; err != nil {
+		s.logger.Error("Failed to record service restart", zap.String("service", service), zap.Error(err))
+	}
+}
+
+// restartService restarts a systemd unit, or only logs it in dry-run mode
+func (s *SystemService) restartService(ctx context.Context, service string) error {
+	if dryRun(ctx, s.config) {
+		s.logger.Info("Dry run: skipping service restart", zap.String("service", service))
+		return nil
+	}
+
+	_, stderr, err := s.runner.Run(ctx, "systemctl", "restart", service)
+	if err != nil {
+		if message := strings.TrimSpace(string(stderr)); message != "" {
+			return fmt.Errorf("%w: %s", err, message)
+		}
+		return err
+	}
+	return nil
+}
+
+// recordServiceCheck stores the latest state of a service, which the status page also reads
+func (s *SystemService) recordServiceCheck(ctx context.Context, service, state string) {
+	check := models.ServiceStatus{ServiceName: service}
+	if err := s.db.WithContext(ctx).
+		Where("service_name = ?", service).
+		Assign(map[string]interface{}{"status": state, "last_checked": s.now()}).
+		FirstOrCreate(&check).Error; err != nil {
+		s.logger.Error("Failed to record service check", zap.String("service", service), zap.Error(err))
+	}
+}
+
+// alertServiceDown tells every active admin that the watchdog gave up restarting a service
+func (s *SystemService) alertServiceDown(ctx context.Context, service string, attempts int, lastError string) {
+	s.logger.Error("Service still failed after the watchdog's restarts; giving up until it runs again",
+		zap.String("service", service),
+		zap.Int("attempts", attempts))
+
+	if s.notifications == nil {
+		return
+	}
+
+	admins, err := activeAdminIDs(s.db.WithContext(ctx))
+	if err != nil {
+		s.logger.Error("Failed to get admins to alert", zap.Error(err))
+		return
+	}
+
+	if lastError == "" {
+		lastError = "-"
+	}
+	for _, admin := range admins {
+		if err := s.notifications.Notify(ctx, admin, NotificationServiceDown, func(locale string) (string, string) {
+			params := map[string]string{
+				"service":  service,
+				"attempts": strconv.Itoa(attempts),
+				"error":    lastError,
+			}
+			return i18n.Translate(locale, "service.down.subject", params), i18n.Translate(locale, "service.down.body", params)
+		}); err != nil {
+			s.logger.Error("Failed to alert admin of failed service", zap.String("user_id", admin.String()), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/runner"
+)
+
+func TestUnitState(t *testing.T) {
+	tests := []struct {
+		output    string
+		want      string
+		wantKnown bool
+	}{
+		{"active\n", ServiceRunning, true},
+		{"activating\n", ServiceRunning, true},
+		{"inactive\n", ServiceStopped, true},
+		{"failed\n", ServiceFailed, true},
+		{"", "", false},
+		{"Failed to connect to bus\n", "", false},
+	}
+	for _, tt := range tests {
+		if got, known := unitState(tt.output); got != tt.want || known != tt.wantKnown {
+			t.Errorf("unitState(%q) = %q, %v, want %q, %v", tt.output, got, known, tt.want, tt.wantKnown)
+		}
+	}
+}
+
+func TestRestartBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, 0},
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{40, time.Minute << 15},
+	}
+	for _, tt := range tests {
+		if got := restartBackoff(time.Minute, tt.attempt); got != tt.want {
+			t.Errorf("restartBackoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+// watchdogClock is a settable clock for the watchdog
+type watchdogClock struct{ now time.Time }
+
+func (c *watchdogClock) Now() time.Time          { return c.now }
+func (c *watchdogClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+// newTestWatchdog creates a system service watching nginx with a backoff of a minute and three
+// attempts, whose commands go to the returned fake and whose clock is the returned one
+func newTestWatchdog(t *testing.T) (*SystemService, *runner.Fake, *watchdogClock) {
+	t.Helper()
+
+	db := newTestDB(t)
+	fake := runner.NewFake()
+	cfg := config.HostingConfig{WatchdogServices: []string{"nginx"}, WatchdogBackoff: time.Minute, WatchdogMaxAttempts: 3}
+	system := NewSystemService(db, nil, zap.NewNop(), cfg, fake, nil, nil, NewNotificationService(db, zap.NewNop(), nil))
+	clock := &watchdogClock{now: time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)}
+	system.now = clock.Now
+	return system, fake, clock
+}
+
+// unitIs makes systemctl report the state of nginx
+func unitIs(fake *runner.Fake, state string) {
+	result := runner.Result{Stdout: []byte(state + "\n")}
+	if state != "active" {
+		result.Err = errors.New("exit status 3")
+	}
+	fake.Respond("systemctl is-active nginx", result)
+}
+
+// restarts returns the number of times nginx was restarted
+func restarts(fake *runner.Fake) int {
+	count := 0
+	for _, call := range fake.Calls() {
+		if call.String() == "systemctl restart nginx" {
+			count++
+		}
+	}
+	return count
+}
+
+func TestWatchdogRestartsWithBackoff(t *testing.T) {
+	system, fake, clock := newTestWatchdog(t)
+	ctx := context.Background()
+	unitIs(fake, "failed")
+
+	steps := []struct {
+		name    string
+		advance time.Duration
+		want    int // Restarts so far
+	}{
+		{"found failed", 0, 1},
+		{"within the backoff", 30 * time.Second, 1},
+		{"backoff passed", 30 * time.Second, 2},
+		{"within the doubled backoff", time.Minute, 2},
+		{"doubled backoff passed", time.Minute, 3},
+	}
+	for _, step := range steps {
+		clock.Advance(step.advance)
+		if err := system.WatchServices(ctx); err != nil {
+			t.Fatalf("%s: WatchServices() error = %v", step.name, err)
+		}
+		if got := restarts(fake); got != step.want {
+			t.Fatalf("%s: %d restarts, want %d", step.name, got, step.want)
+		}
+	}
+
+	// Each attempt is recorded and the check is stored for the status page
+	recorded, err := system.ServiceRestarts(ctx, "nginx", 10)
+	if err != nil || len(recorded) != 3 {
+		t.Fatalf("ServiceRestarts() = %d, %v, want 3", len(recorded), err)
+	}
+	attempts := map[int]bool{}
+	for _, r := range recorded {
+		if !r.Success || r.Service != "nginx" {
+			t.Errorf("restart = %+v", r)
+		}
+		attempts[r.Attempt] = true
+	}
+	if !attempts[1] || !attempts[2] || !attempts[3] {
+		t.Errorf("attempts recorded = %v", attempts)
+	}
+	statuses, err := system.GetServiceStatus(ctx)
+	if err != nil || len(statuses) != 1 {
+		t.Fatalf("GetServiceStatus() = %v, %v", statuses, err)
+	}
+	if s := statuses[0]; s.Status != ServiceFailed || s.Attempts != 3 || !s.GaveUp || s.NextAttempt != nil || s.LastChecked == nil {
+		t.Errorf("status = %+v", s)
+	}
+	var checks int64
+	system.db.Model(&models.ServiceStatus{}).Where("service_name = ?", "nginx").Count(&checks)
+	if checks != 1 {
+		t.Errorf("%d service checks stored, want one kept current", checks)
+	}
+}
+
+func TestWatchdogCircuitBreaker(t *testing.T) {
+	system, fake, clock := newTestWatchdog(t)
+	ctx := context.Background()
+	admin := createTestUser(t, system.db)
+	role := &models.Role{Name: "admin", DisplayName: "admin"}
+	mustCreate(t, system.db, role)
+	mustCreate(t, system.db, &models.UserRole{UserID: admin.ID, RoleID: role.ID})
+	unitIs(fake, "failed")
+	fake.Respond("systemctl restart nginx", runner.Result{Stderr: []byte("Job for nginx.service failed.\n"), Err: errors.New("exit status 1")})
+
+	for i := 0; i < 6; i++ {
+		system.WatchServices(ctx)
+		clock.Advance(time.Hour)
+	}
+	if got := restarts(fake); got != 3 {
+		t.Fatalf("%d restarts, want the limit of 3", got)
+	}
+	recorded, _ := system.ServiceRestarts(ctx, "", 10)
+	for _, r := range recorded {
+		if r.Success || !strings.Contains(r.Error, "Job for nginx.service failed.") {
+			t.Errorf("failed restart recorded as %+v", r)
+		}
+	}
+
+	// Admins are alerted once
+	var alerts []models.Notification
+	system.db.Where("user_id = ? AND event_type = ?", admin.ID, NotificationServiceDown).Find(&alerts)
+	if len(alerts) != 1 || !strings.Contains(alerts[0].Subject+alerts[0].Body, "nginx") {
+		t.Fatalf("alerts = %+v, want one about nginx", alerts)
+	}
+
+	// Running again resets the breaker once the backoff has passed
+	unitIs(fake, "active")
+	system.WatchServices(ctx)
+	statuses, _ := system.GetServiceStatus(ctx)
+	if s := statuses[0]; s.Status != ServiceRunning || s.Attempts != 0 || s.GaveUp {
+		t.Errorf("status after recovery = %+v", s)
+	}
+	unitIs(fake, "failed")
+	system.WatchServices(ctx)
+	if got := restarts(fake); got != 4 {
+		t.Errorf("%d restarts after failing again, want 4", got)
+	}
+}
+
+func TestWatchdogCrashLoopReachesLimit(t *testing.T) {
+	system, fake, clock := newTestWatchdog(t)
+	ctx := context.Background()
+
+	// The service runs right after each restart but fails again before the backoff passes
+	for i := 0; i < 3; i++ {
+		unitIs(fake, "failed")
+		system.WatchServices(ctx)
+		clock.Advance(10 * time.Second)
+		unitIs(fake, "active")
+		system.WatchServices(ctx)
+		clock.Advance(10 * time.Minute)
+	}
+	unitIs(fake, "failed")
+	system.WatchServices(ctx)
+	if got := restarts(fake); got != 3 {
+		t.Errorf("%d restarts of a crash-looping service, want the limit of 3", got)
+	}
+	if statuses, _ := system.GetServiceStatus(ctx); !statuses[0].GaveUp {
+		t.Errorf("status = %+v, want given up", statuses[0])
+	}
+}
+
+func TestWatchdogIgnoresUnknownState(t *testing.T) {
+	system, fake, _ := newTestWatchdog(t)
+	fake.Respond("systemctl is-active nginx", runner.Result{Stderr: []byte("Failed to connect to bus"), Err: errors.New("exit status 1")})
+
+	if err := system.WatchServices(context.Background()); err != nil {
+		t.Fatalf("WatchServices() error = %v", err)
+	}
+	if got := restarts(fake); got != 0 {
+		t.Errorf("%d restarts without a known state", got)
+	}
+	statuses, _ := system.GetServiceStatus(context.Background())
+	if len(statuses) != 1 || statuses[0].Status != "" || statuses[0].LastChecked != nil {
+		t.Errorf("status = %+v, want unchecked", statuses[0])
+	}
+}
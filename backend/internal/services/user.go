@@ -2,44 +2,79 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/mail"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/pquerna/otp/totp"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
-
+	"gorm.io/gorm/clause"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/auth"
+	"github.com/mynodecp/mynodecp/backend/internal/cache"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/i18n"
+	"github.com/mynodecp/mynodecp/backend/internal/mailer"
 	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/secret"
+)
+
+const (
+	twoFactorIssuer          = "MyNodeCP"
+	twoFactorSetupTTL        = 15 * time.Minute
+	twoFactorBackupCodeCount = 10
 )
 
 // UserService handles user-related operations
 type UserService struct {
-	db     *gorm.DB
-	redis  *redis.Client
-	logger *zap.Logger
+	db      *gorm.DB
+	redis   *redis.Client
+	logger  *zap.Logger
+	cache   *cache.Cache
+	auth    *auth.Service
+	domains *DomainService
+	mailer  *mailer.Mailer
+	config  config.AuthConfig
+
+	notifications *NotificationService
 }
 
 // NewUserService creates a new user service
-func NewUserService(db *gorm.DB, redis *redis.Client, logger *zap.Logger) *UserService {
+func NewUserService(db *gorm.DB, redis *redis.Client, logger *zap.Logger, cache *cache.Cache, auth *auth.Service, domains *DomainService, mailer *mailer.Mailer, config config.AuthConfig, notifications *NotificationService) *UserService {
 	return &UserService{
-		db:     db,
-		redis:  redis,
-		logger: logger,
+		db:      db,
+		redis:   redis,
+		logger:  logger,
+		cache:   cache,
+		auth:    auth,
+		domains: domains,
+		mailer:  mailer,
+		config:  config,
+
+		notifications: notifications,
 	}
 }
 
 // GetUser retrieves a user by ID
 func (s *UserService) GetUser(ctx context.Context, userID uuid.UUID) (*models.User, error) {
-	var user models.User
-	if err := s.db.WithContext(ctx).
-		Preload("Roles").
-		Where("id = ?", userID).
-		First(&user).Error; err != nil {
-		return nil, fmt.Errorf("failed to get user: %w", err)
-	}
+	return cache.GetOrSet(ctx, s.cache, cache.UserKey(userID), func() (*models.User, error) {
+		var user models.User
+		if err := s.db.WithContext(ctx).
+			Preload("Roles").
+			Where("id = ?", userID).
+			First(&user).Error; err != nil {
+			return nil, apperrors.FromDB(err, "user")
+		}
 
-	return &user, nil
+		return &user, nil
+	})
 }
 
 // GetUsers retrieves all users with pagination
@@ -68,21 +103,99 @@ func (s *UserService) GetUsers(ctx context.Context, offset, limit int) ([]*model
 func (s *UserService) UpdateUser(ctx context.Context, userID uuid.UUID, updates map[string]interface{}) (*models.User, error) {
 	var user models.User
 	if err := s.db.WithContext(ctx).Where("id = ?", userID).First(&user).Error; err != nil {
-		return nil, fmt.Errorf("failed to find user: %w", err)
+		return nil, apperrors.FromDB(err, "user")
+	}
+
+	// Account state changes cascade to sessions and services
+	if value, ok := updates["is_active"]; ok {
+		active, isBool := value.(bool)
+		if !isBool {
+			return nil, fmt.Errorf("is_active must be a boolean")
+		}
+		delete(updates, "is_active")
+
+		var err error
+		if active {
+			err = s.Reactivate(ctx, userID)
+		} else {
+			err = s.Deactivate(ctx, userID)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Reserved usernames are only given out by admins
+	if value, ok := updates["username"]; ok {
+		if username, isString := value.(string); isString && !hasRoleInContext(ctx, "admin") && s.auth.ReservedUsername(username) {
+			return nil, apperrors.InvalidCode("username", "user.username_reserved", map[string]string{"name": username})
+		}
+	}
+
+	// Users change their own address through RequestEmailChange, which confirms the new one.
+	// An address set by an admin is unverified unless the update says otherwise.
+	if value, ok := updates["email"]; ok {
+		if !hasRoleInContext(ctx, "admin") {
+			return nil, apperrors.InvalidCode("email", "user.email_change", nil)
+		}
+		email, isString := value.(string)
+		if address, err := mail.ParseAddress(email); !isString || err != nil || address.Address != email {
+			return nil, apperrors.InvalidCode("email", "user.email_invalid", nil)
+		}
+		if err := checkEmailAvailable(s.db.WithContext(ctx), userID, email); err != nil {
+			return nil, err
+		}
+		if _, set := updates["is_email_verified"]; !set && email != user.Email {
+			updates["is_email_verified"] = false
+		}
+	}
+
+	// An empty locale clears the preference so messages follow the browser again
+	if value, ok := updates["locale"]; ok {
+		locale, isString := value.(string)
+		if locale = i18n.Normalize(locale); !isString || (locale != "" && !i18n.Supported(locale)) {
+			return nil, apperrors.InvalidCode("locale", "field.locale", map[string]string{"locales": strings.Join(i18n.Locales(), ", ")})
+		}
+		updates["locale"] = locale
 	}
 
 	// Hash password if it's being updated
-	if password, ok := updates["password"]; ok {
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password.(string)), bcrypt.DefaultCost)
+	if value, ok := updates["password"]; ok {
+		password, isString := value.(string)
+		if !isString {
+			return nil, fmt.Errorf("password must be a string")
+		}
+		if err := s.auth.CheckPassword(ctx, password); err != nil {
+			return nil, err
+		}
+		if err := s.auth.CheckPasswordReuse(ctx, &user, "password", password); err != nil {
+			return nil, err
+		}
+
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 		if err != nil {
 			return nil, fmt.Errorf("failed to hash password: %w", err)
 		}
 		updates["password_hash"] = string(hashedPassword)
+		updates["password_changed_at"] = time.Now()
+		updates["password_warned_at"] = nil
 		delete(updates, "password")
 	}
 
-	if err := s.db.WithContext(ctx).Model(&user).Updates(updates).Error; err != nil {
-		return nil, fmt.Errorf("failed to update user: %w", err)
+	if len(updates) > 0 {
+		previousHash := user.PasswordHash
+		if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&user).Updates(updates).Error; err != nil {
+				return fmt.Errorf("failed to update user: %w", err)
+			}
+			if passwordHash, ok := updates["password_hash"].(string); ok {
+				return s.auth.RecordPassword(tx, userID, previousHash, passwordHash)
+			}
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+		s.invalidateUser(ctx, userID)
 	}
 
 	// Reload user with relationships
@@ -93,11 +206,75 @@ func (s *UserService) UpdateUser(ctx context.Context, userID uuid.UUID, updates
 	return &user, nil
 }
 
+// Deactivate disables an account, revokes all of its sessions and suspends its domains and mail
+func (s *UserService) Deactivate(ctx context.Context, userID uuid.UUID) error {
+	var revokedSessions []uuid.UUID
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Preload("Roles").Where("id = ?", userID).First(&user).Error; err != nil {
+			return apperrors.FromDB(err, "user")
+		}
+
+		if err := ensureNotLastAdmin(tx, &user); err != nil {
+			return err
+		}
+		if err := tx.Model(&user).Update("is_active", false).Error; err != nil {
+			return fmt.Errorf("failed to deactivate user: %w", err)
+		}
+
+		sessions, err := revokeUserSessions(tx, userID)
+		if err != nil {
+			return err
+		}
+		revokedSessions = sessions
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.invalidateUser(ctx, userID)
+
+	if err := s.auth.DropSessions(ctx, revokedSessions...); err != nil {
+		return err
+	}
+
+	if err := s.domains.SetUserDomainsSuspended(ctx, userID, true); err != nil {
+		return err
+	}
+
+	s.logger.Info("User deactivated",
+		zap.String("user_id", userID.String()),
+		zap.Int("revoked_sessions", len(revokedSessions)))
+
+	return nil
+}
+
+// Reactivate re-enables a deactivated account and resumes its domains and mail
+func (s *UserService) Reactivate(ctx context.Context, userID uuid.UUID) error {
+	result := s.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", userID).Update("is_active", true)
+	if result.Error != nil {
+		return fmt.Errorf("failed to reactivate user: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return apperrors.NotFound("user")
+	}
+	s.invalidateUser(ctx, userID)
+
+	if err := s.domains.SetUserDomainsSuspended(ctx, userID, false); err != nil {
+		return err
+	}
+
+	s.logger.Info("User reactivated", zap.String("user_id", userID.String()))
+
+	return nil
+}
+
 // DeleteUser soft deletes a user
 func (s *UserService) DeleteUser(ctx context.Context, userID uuid.UUID) error {
 	if err := s.db.WithContext(ctx).Where("id = ?", userID).Delete(&models.User{}).Error; err != nil {
 		return fmt.Errorf("failed to delete user: %w", err)
 	}
+	s.invalidateUser(ctx, userID)
 
 	return nil
 }
@@ -107,13 +284,13 @@ func (s *UserService) AssignRole(ctx context.Context, userID, roleID uuid.UUID)
 	// Check if user exists
 	var user models.User
 	if err := s.db.WithContext(ctx).Where("id = ?", userID).First(&user).Error; err != nil {
-		return fmt.Errorf("user not found: %w", err)
+		return apperrors.FromDB(err, "user")
 	}
 
 	// Check if role exists
 	var role models.Role
 	if err := s.db.WithContext(ctx).Where("id = ?", roleID).First(&role).Error; err != nil {
-		return fmt.Errorf("role not found: %w", err)
+		return apperrors.FromDB(err, "role")
 	}
 
 	// Check if assignment already exists
@@ -137,6 +314,7 @@ func (s *UserService) AssignRole(ctx context.Context, userID, roleID uuid.UUID)
 	if err := s.db.WithContext(ctx).Create(userRole).Error; err != nil {
 		return fmt.Errorf("failed to assign role: %w", err)
 	}
+	s.invalidateUser(ctx, userID)
 
 	return nil
 }
@@ -148,6 +326,7 @@ func (s *UserService) RemoveRole(ctx context.Context, userID, roleID uuid.UUID)
 		Delete(&models.UserRole{}).Error; err != nil {
 		return fmt.Errorf("failed to remove role: %w", err)
 	}
+	s.invalidateUser(ctx, userID)
 
 	return nil
 }
@@ -167,44 +346,55 @@ func (s *UserService) GetUserRoles(ctx context.Context, userID uuid.UUID) ([]*mo
 
 // GetUserPermissions retrieves all permissions for a user
 func (s *UserService) GetUserPermissions(ctx context.Context, userID uuid.UUID) ([]*models.Permission, error) {
-	var permissions []*models.Permission
-	if err := s.db.WithContext(ctx).
-		Joins("JOIN role_permissions ON role_permissions.permission_id = permissions.id").
-		Joins("JOIN user_roles ON user_roles.role_id = role_permissions.role_id").
-		Where("user_roles.user_id = ?", userID).
-		Distinct().
-		Find(&permissions).Error; err != nil {
-		return nil, fmt.Errorf("failed to get user permissions: %w", err)
-	}
+	return cache.GetOrSet(ctx, s.cache, cache.PermissionsKey(userID), func() ([]*models.Permission, error) {
+		var permissions []*models.Permission
+		if err := s.db.WithContext(ctx).
+			Joins("JOIN role_permissions ON role_permissions.permission_id = permissions.id").
+			Joins("JOIN user_roles ON user_roles.role_id = role_permissions.role_id").
+			Where("user_roles.user_id = ?", userID).
+			Distinct().
+			Find(&permissions).Error; err != nil {
+			return nil, fmt.Errorf("failed to get user permissions: %w", err)
+		}
 
-	return permissions, nil
+		return permissions, nil
+	})
 }
 
 // HasPermission checks if a user has a specific permission
 func (s *UserService) HasPermission(ctx context.Context, userID uuid.UUID, resource, action string) (bool, error) {
-	var count int64
-	if err := s.db.WithContext(ctx).
-		Model(&models.Permission{}).
-		Joins("JOIN role_permissions ON role_permissions.permission_id = permissions.id").
-		Joins("JOIN user_roles ON user_roles.role_id = role_permissions.role_id").
-		Where("user_roles.user_id = ? AND permissions.resource = ? AND permissions.action = ?", userID, resource, action).
-		Count(&count).Error; err != nil {
+	// Resolved from the cached permission set so every check avoids the join
+	permissions, err := s.GetUserPermissions(ctx, userID)
+	if err != nil {
 		return false, fmt.Errorf("failed to check permission: %w", err)
 	}
 
-	return count > 0, nil
+	for _, permission := range permissions {
+		if permission.Resource == resource && permission.Action == action {
+			return true, nil
+		}
+	}
+
+	return false, nil
 }
 
 // ChangePassword changes a user's password
 func (s *UserService) ChangePassword(ctx context.Context, userID uuid.UUID, currentPassword, newPassword string) error {
 	var user models.User
 	if err := s.db.WithContext(ctx).Where("id = ?", userID).First(&user).Error; err != nil {
-		return fmt.Errorf("user not found: %w", err)
+		return apperrors.FromDB(err, "user")
 	}
 
 	// Verify current password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(currentPassword)); err != nil {
-		return fmt.Errorf("current password is incorrect")
+		return apperrors.InvalidCode("current_password", "user.password_wrong", nil)
+	}
+
+	if err := s.auth.CheckPassword(ctx, newPassword); err != nil {
+		return apperrors.Invalid("new_password", err.Error())
+	}
+	if err := s.auth.CheckPasswordReuse(ctx, &user, "new_password", newPassword); err != nil {
+		return err
 	}
 
 	// Hash new password
@@ -214,37 +404,342 @@ func (s *UserService) ChangePassword(ctx context.Context, userID uuid.UUID, curr
 	}
 
 	// Update password
-	if err := s.db.WithContext(ctx).Model(&user).Update("password_hash", string(hashedPassword)).Error; err != nil {
-		return fmt.Errorf("failed to update password: %w", err)
+	previousHash := user.PasswordHash
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"password_hash":       string(hashedPassword),
+			"password_changed_at": time.Now(),
+			"password_warned_at":  nil,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to update password: %w", err)
+		}
+		return s.auth.RecordPassword(tx, user.ID, previousHash, string(hashedPassword))
+	}); err != nil {
+		return err
 	}
+	s.invalidateUser(ctx, user.ID)
 
 	return nil
 }
 
-// EnableTwoFactor enables two-factor authentication for a user
-func (s *UserService) EnableTwoFactor(ctx context.Context, userID uuid.UUID, secret string) error {
-	if err := s.db.WithContext(ctx).Model(&models.User{}).
-		Where("id = ?", userID).
-		Updates(map[string]interface{}{
-			"is_two_factor_enabled": true,
-			"two_factor_secret":     secret,
-		}).Error; err != nil {
-		return fmt.Errorf("failed to enable two-factor authentication: %w", err)
+// TwoFactorSetup holds the secret a user must add to their authenticator app
+type TwoFactorSetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// BeginTwoFactorSetup generates a pending TOTP secret that must be confirmed before 2FA is enabled
+func (s *UserService) BeginTwoFactorSetup(ctx context.Context, userID uuid.UUID) (*TwoFactorSetup, error) {
+	var user models.User
+	if err := s.db.WithContext(ctx).Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, apperrors.FromDB(err, "user")
 	}
 
-	return nil
+	if !s.auth.MethodAvailable(auth.MethodTOTP) {
+		v := apperrors.NewValidation()
+		v.AddCode("method", "user.mfa_unavailable", map[string]string{"method": auth.MethodTOTP})
+		return nil, v.Err()
+	}
+	if user.TwoFactorSecret != "" {
+		return nil, apperrors.PreconditionCode("two_factor_enrolled", nil)
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      twoFactorIssuer,
+		AccountName: user.Email,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate two-factor secret: %w", err)
+	}
+
+	if err := s.redis.Set(ctx, twoFactorPendingKey(userID), key.Secret(), twoFactorSetupTTL).Err(); err != nil {
+		return nil, fmt.Errorf("failed to store pending two-factor secret: %w", err)
+	}
+
+	return &TwoFactorSetup{
+		Secret: key.Secret(),
+		URI:    key.URL(),
+	}, nil
 }
 
-// DisableTwoFactor disables two-factor authentication for a user
+// ConfirmTwoFactorSetup enables two-factor authentication once the user proves they can generate
+// a valid code for the pending secret, and returns a new set of one-time backup codes. The
+// authenticator app becomes the default method if the user has none.
+func (s *UserService) ConfirmTwoFactorSetup(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	pendingSecret, err := s.redis.Get(ctx, twoFactorPendingKey(userID)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, apperrors.PreconditionCode("two_factor_setup_missing", nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pending two-factor setup: %w", err)
+	}
+
+	if !totp.Validate(code, pendingSecret) {
+		return nil, apperrors.InvalidCode("code", "user.mfa_code_invalid", nil)
+	}
+
+	var user models.User
+	if err := s.db.WithContext(ctx).Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, apperrors.FromDB(err, "user")
+	}
+
+	codes, hashes, err := newBackupCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{
+		"is_two_factor_enabled":   true,
+		"two_factor_secret":       secret.String(pendingSecret),
+		"two_factor_backup_codes": hashes,
+	}
+	if user.TwoFactorMethod == "" {
+		updates["two_factor_method"] = auth.MethodTOTP
+	}
+	if err := s.db.WithContext(ctx).Model(&user).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to enable two-factor authentication: %w", err)
+	}
+	s.invalidateUser(ctx, userID)
+
+	s.redis.Del(ctx, twoFactorPendingKey(userID))
+
+	return codes, nil
+}
+
+// DisableTwoFactor disables two-factor authentication for a user, removing every method they
+// enrolled
 func (s *UserService) DisableTwoFactor(ctx context.Context, userID uuid.UUID) error {
-	if err := s.db.WithContext(ctx).Model(&models.User{}).
-		Where("id = ?", userID).
-		Updates(map[string]interface{}{
-			"is_two_factor_enabled": false,
-			"two_factor_secret":     "",
-		}).Error; err != nil {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.WebAuthnCredential{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).
+			Where("id = ?", userID).
+			Updates(map[string]interface{}{
+				"is_two_factor_enabled":   false,
+				"two_factor_secret":       "",
+				"two_factor_backup_codes": "",
+				"two_factor_method":       "",
+				"email_otp_enabled":       false,
+			}).Error
+	})
+	if err != nil {
 		return fmt.Errorf("failed to disable two-factor authentication: %w", err)
 	}
+	s.invalidateUser(ctx, userID)
+
+	return nil
+}
+
+// BulkUserAction identifies an operation applied by BulkUpdate
+type BulkUserAction string
+
+const (
+	BulkActivate    BulkUserAction = "activate"
+	BulkDeactivate  BulkUserAction = "deactivate"
+	BulkAssignRole  BulkUserAction = "assign_role"
+	BulkForceLogout BulkUserAction = "force_logout"
+)
+
+// BulkUserResult reports the outcome of a bulk operation for a single user
+type BulkUserResult struct {
+	UserID  uuid.UUID `json:"user_id"`
+	Success bool      `json:"success"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// BulkUpdate applies an action to many users in a single transaction.
+// Each user is processed in its own savepoint so one failure does not undo the others.
+func (s *UserService) BulkUpdate(ctx context.Context, actorID uuid.UUID, userIDs []uuid.UUID, action BulkUserAction, roleID *uuid.UUID) ([]BulkUserResult, error) {
+	switch action {
+	case BulkActivate, BulkDeactivate, BulkForceLogout:
+	case BulkAssignRole:
+		if roleID == nil {
+			return nil, fmt.Errorf("role is required for role assignment")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported bulk action: %s", action)
+	}
+
+	results := make([]BulkUserResult, 0, len(userIDs))
+	var revokedSessions []uuid.UUID
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for i, userID := range userIDs {
+			savepoint := fmt.Sprintf("bulk_user_%d", i)
+			if err := tx.SavePoint(savepoint).Error; err != nil {
+				return fmt.Errorf("failed to create savepoint: %w", err)
+			}
+
+			sessions, err := s.applyBulkAction(tx, userID, action, roleID)
+			result := BulkUserResult{UserID: userID, Success: err == nil}
+			if err != nil {
+				if rbErr := tx.RollbackTo(savepoint).Error; rbErr != nil {
+					return fmt.Errorf("failed to roll back savepoint: %w", rbErr)
+				}
+				result.Error = err.Error()
+			} else {
+				revokedSessions = append(revokedSessions, sessions...)
+			}
+			results = append(results, result)
+
+			resourceID := userID.String()
+			auditLog := &models.AuditLog{
+				UserID:     &actorID,
+				Action:     "user.bulk_" + string(action),
+				Resource:   "user",
+				ResourceID: &resourceID,
+				Details:    result.Error,
+				Success:    result.Success,
+			}
+			if err := tx.Create(auditLog).Error; err != nil {
+				return fmt.Errorf("failed to record audit log: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply bulk update: %w", err)
+	}
+
+	for _, result := range results {
+		if result.Success {
+			s.invalidateUser(ctx, result.UserID)
+		}
+	}
+
+	// Drop revoked sessions from Redis only once the revocation is committed
+	if err := s.auth.DropSessions(ctx, revokedSessions...); err != nil {
+		s.logger.Error("Failed to drop revoked sessions", zap.Error(err))
+	}
+
+	// Suspension touches files and caches, so it runs after the commit as well
+	for _, result := range results {
+		if !result.Success || (action != BulkActivate && action != BulkDeactivate) {
+			continue
+		}
+		if err := s.domains.SetUserDomainsSuspended(ctx, result.UserID, action == BulkDeactivate); err != nil {
+			s.logger.Error("Failed to update domain suspension", zap.String("user_id", result.UserID.String()), zap.Error(err))
+		}
+	}
+
+	return results, nil
+}
+
+// applyBulkAction applies a single bulk action and returns any sessions it revoked
+func (s *UserService) applyBulkAction(tx *gorm.DB, userID uuid.UUID, action BulkUserAction, roleID *uuid.UUID) ([]uuid.UUID, error) {
+	var user models.User
+	if err := tx.Preload("Roles").Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	switch action {
+	case BulkActivate:
+		return nil, tx.Model(&user).Update("is_active", true).Error
+
+	case BulkDeactivate:
+		if err := ensureNotLastAdmin(tx, &user); err != nil {
+			return nil, err
+		}
+		if err := tx.Model(&user).Update("is_active", false).Error; err != nil {
+			return nil, err
+		}
+		return revokeUserSessions(tx, userID)
+
+	case BulkAssignRole:
+		for _, role := range user.Roles {
+			if role.ID == *roleID {
+				return nil, nil
+			}
+		}
+		var role models.Role
+		if err := tx.Where("id = ?", *roleID).First(&role).Error; err != nil {
+			return nil, fmt.Errorf("role not found")
+		}
+		return nil, tx.Create(&models.UserRole{UserID: userID, RoleID: *roleID}).Error
+
+	case BulkForceLogout:
+		return revokeUserSessions(tx, userID)
+	}
+
+	return nil, fmt.Errorf("unsupported bulk action: %s", action)
+}
+
+func twoFactorPendingKey(userID uuid.UUID) string {
+	return fmt.Sprintf("2fa_pending:%s", userID)
+}
+
+// invalidateUser drops the cached user and their cached permissions
+func (s *UserService) invalidateUser(ctx context.Context, userID uuid.UUID) {
+	if err := s.cache.Invalidate(ctx, cache.UserKey(userID), cache.PermissionsKey(userID)); err != nil {
+		s.logger.Warn("Failed to invalidate user cache", zap.String("user_id", userID.String()), zap.Error(err))
+	}
+}
+
+// revokeUserSessions revokes every active session of a user and returns their IDs
+func revokeUserSessions(tx *gorm.DB, userID uuid.UUID) ([]uuid.UUID, error) {
+	var sessionIDs []uuid.UUID
+	if err := tx.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Pluck("id", &sessionIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to find sessions: %w", err)
+	}
+
+	if len(sessionIDs) == 0 {
+		return nil, nil
+	}
+
+	if err := tx.Model(&models.Session{}).
+		Where("id IN ?", sessionIDs).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		return nil, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	return sessionIDs, nil
+}
+
+// ensureNotLastAdmin refuses to deactivate the only remaining active admin. The active admins are
+// locked until the transaction ends so two concurrent deactivations cannot both see another admin.
+func ensureNotLastAdmin(tx *gorm.DB, user *models.User) error {
+	if !hasRole(user, "admin") || !user.IsActive {
+		return nil
+	}
+
+	var activeAdmins []uuid.UUID
+	if err := tx.Model(&models.User{}).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Joins("JOIN user_roles ON user_roles.user_id = users.id").
+		Joins("JOIN roles ON roles.id = user_roles.role_id").
+		Where("roles.name = ? AND users.is_active = ?", "admin", true).
+		Pluck("users.id", &activeAdmins).Error; err != nil {
+		return fmt.Errorf("failed to count admins: %w", err)
+	}
+	if len(activeAdmins) <= 1 {
+		return apperrors.PreconditionCode("last_admin", nil)
+	}
 
 	return nil
 }
+
+// activeAdminIDs returns the IDs of the active admins, for alerting them
+func activeAdminIDs(db *gorm.DB) ([]uuid.UUID, error) {
+	var admins []uuid.UUID
+	if err := db.Model(&models.User{}).
+		Joins("JOIN user_roles ON user_roles.user_id = users.id").
+		Joins("JOIN roles ON roles.id = user_roles.role_id").
+		Where("roles.name = ? AND users.is_active = ?", "admin", true).
+		Pluck("users.id", &admins).Error; err != nil {
+		return nil, fmt.Errorf("failed to get admins: %w", err)
+	}
+	return admins, nil
+}
+
+// hasRole reports whether a user with preloaded roles has the named role
+func hasRole(user *models.User, name string) bool {
+	for _, role := range user.Roles {
+		if role.Name == name {
+			return true
+		}
+	}
+	return false
+}
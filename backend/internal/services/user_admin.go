@@ -0,0 +1,164 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// CreateAdmin creates an active account with a verified email address and the admin role, for
+// bootstrapping a panel without one. Unlike registration it needs no invite and accepts reserved
+// usernames; the password policy still applies.
+func (s *UserService) CreateAdmin(ctx context.Context, username, email, password string) (*models.User, error) {
+	v := apperrors.NewValidation()
+	username = strings.TrimSpace(username)
+	if username == "" {
+		v.AddCode("username", "user.username_required", nil)
+	}
+	if address, err := mail.ParseAddress(email); err != nil || address.Address != email {
+		v.AddCode("email", "user.email_invalid", nil)
+	}
+	if err := s.auth.CheckPassword(ctx, password); err != nil {
+		v.Add("password", err.Error())
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	var existing []models.User
+	if err := s.db.WithContext(ctx).Select("username", "email").
+		Where("username = ? OR email = ?", username, email).
+		Find(&existing).Error; err != nil {
+		return nil, fmt.Errorf("failed to check user existence: %w", err)
+	}
+	for _, user := range existing {
+		if user.Username == username {
+			v.AddCode("username", "user.username_taken", nil)
+		}
+		if user.Email == email {
+			v.AddCode("email", "user.email_taken", nil)
+		}
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	now := time.Now()
+	user := &models.User{
+		Username:          username,
+		Email:             email,
+		PasswordHash:      string(hashedPassword),
+		IsActive:          true,
+		IsEmailVerified:   true,
+		PasswordChangedAt: &now,
+	}
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var role models.Role
+		if err := tx.Where(models.Role{Name: "admin"}).
+			Attrs(models.Role{DisplayName: "Administrator", Description: "Full access to the panel", IsSystem: true}).
+			FirstOrCreate(&role).Error; err != nil {
+			return fmt.Errorf("failed to get admin role: %w", err)
+		}
+		if err := tx.Create(user).Error; err != nil {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+		if err := s.auth.RecordPassword(tx, user.ID, "", user.PasswordHash); err != nil {
+			return err
+		}
+		return tx.Create(&models.UserRole{UserID: user.ID, RoleID: role.ID}).Error
+	}); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Admin created", zap.String("user_id", user.ID.String()), zap.String("username", username))
+
+	return user, nil
+}
+
+// ResetPassword sets a new password for the account with the given username or email address,
+// without the current one. It also lifts a login lockout and revokes the account's sessions. The
+// password may not repeat a recent one, as when users change it themselves.
+func (s *UserService) ResetPassword(ctx context.Context, identity, password string) (*models.User, error) {
+	var user models.User
+	if err := s.db.WithContext(ctx).Where("username = ? OR email = ?", identity, identity).First(&user).Error; err != nil {
+		return nil, apperrors.FromDB(err, "user")
+	}
+
+	if err := s.auth.CheckPassword(ctx, password); err != nil {
+		v := apperrors.NewValidation()
+		v.Add("password", err.Error())
+		return nil, v.Err()
+	}
+	if err := s.auth.CheckPasswordReuse(ctx, &user, "password", password); err != nil {
+		return nil, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	previousHash := user.PasswordHash
+	var revokedSessions []uuid.UUID
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"password_hash":       string(hashedPassword),
+			"password_changed_at": time.Now(),
+			"password_warned_at":  nil,
+			"failed_login_count":  0,
+			"locked_until":        nil,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to update password: %w", err)
+		}
+		if err := s.auth.RecordPassword(tx, user.ID, previousHash, string(hashedPassword)); err != nil {
+			return err
+		}
+
+		sessions, err := revokeUserSessions(tx, user.ID)
+		if err != nil {
+			return err
+		}
+		revokedSessions = sessions
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	s.invalidateUser(ctx, user.ID)
+
+	if err := s.auth.DropSessions(ctx, revokedSessions...); err != nil {
+		return nil, err
+	}
+
+	resourceID := user.ID.String()
+	auditLog := &models.AuditLog{
+		UserID:     actorFromContext(ctx),
+		Action:     "password_reset",
+		Resource:   "user",
+		ResourceID: &resourceID,
+		Details:    fmt.Sprintf("revoked %d sessions", len(revokedSessions)),
+		Success:    true,
+	}
+	if err := s.db.WithContext(ctx).Create(auditLog).Error; err != nil {
+		s.logger.Error("Failed to record audit log", zap.Error(err))
+	}
+
+	s.logger.Info("Password reset",
+		zap.String("user_id", user.ID.String()),
+		zap.Int("revoked_sessions", len(revokedSessions)))
+
+	return &user, nil
+}
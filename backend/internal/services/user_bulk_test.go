@@ -0,0 +1,164 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/auth"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// newTestUserService creates a user service on db with sessions in an in-memory Redis
+func newTestUserService(t *testing.T, db *gorm.DB) *UserService {
+	t.Helper()
+
+	client, _ := newTestRedis(t)
+	domains, _ := newTestDomainService(t, db, testHostingConfig(t))
+	authService := auth.NewService(db, client, zap.NewNop(), config.AuthConfig{JWTExpiration: time.Hour}, nil, nil, nil, nil)
+	return NewUserService(db, client, zap.NewNop(), nil, authService, domains, nil, config.AuthConfig{}, nil)
+}
+
+// grantRole gives the user the named role, creating it when needed
+func grantRole(t *testing.T, db *gorm.DB, user *models.User, name string) *models.Role {
+	t.Helper()
+
+	role := models.Role{Name: name, DisplayName: name}
+	if err := db.Where(models.Role{Name: name}).FirstOrCreate(&role).Error; err != nil {
+		t.Fatalf("create role %s: %v", name, err)
+	}
+	mustCreate(t, db, &models.UserRole{UserID: user.ID, RoleID: role.ID})
+	return &role
+}
+
+// createTestSession stores an active session of the user
+func createTestSession(t *testing.T, db *gorm.DB, user *models.User) *models.Session {
+	t.Helper()
+
+	session := &models.Session{UserID: user.ID, Token: uuid.NewString(), RefreshToken: uuid.NewString(), ExpiresAt: time.Now().Add(time.Hour)}
+	mustCreate(t, db, session)
+	return session
+}
+
+func TestBulkDeactivateKeepsOtherUsersOnFailure(t *testing.T) {
+	db := newTestDB(t)
+	users := newTestUserService(t, db)
+	actor := createTestUser(t, db)
+	member := createTestUser(t, db)
+	session := createTestSession(t, db, member)
+	admin := createTestUser(t, db)
+	grantRole(t, db, admin, "admin")
+	missing := uuid.New()
+
+	results, err := users.BulkUpdate(context.Background(), actor.ID, []uuid.UUID{member.ID, admin.ID, missing}, BulkDeactivate, nil)
+	if err != nil {
+		t.Fatalf("BulkUpdate() error = %v", err)
+	}
+
+	want := []struct {
+		success bool
+		err     string
+	}{{true, ""}, {false, "last active admin"}, {false, "not found"}}
+	if len(results) != len(want) {
+		t.Fatalf("results = %+v", results)
+	}
+	for i, w := range want {
+		if results[i].Success != w.success || !strings.Contains(results[i].Error, w.err) {
+			t.Errorf("result %d = %+v, want success %v with %q", i, results[i], w.success, w.err)
+		}
+	}
+
+	var deactivated, kept models.User
+	db.Where("id = ?", member.ID).First(&deactivated)
+	if deactivated.IsActive {
+		t.Error("member still active")
+	}
+	db.Where("id = ?", admin.ID).First(&kept)
+	if !kept.IsActive {
+		t.Error("last admin deactivated")
+	}
+	var revoked models.Session
+	db.Where("id = ?", session.ID).First(&revoked)
+	if revoked.RevokedAt == nil {
+		t.Error("session of the deactivated member not revoked")
+	}
+
+	var audits int64
+	db.Model(&models.AuditLog{}).Where("action = ?", "user.bulk_deactivate").Count(&audits)
+	if audits != 3 {
+		t.Errorf("audit entries = %d, want one per user", audits)
+	}
+}
+
+func TestDeactivateLastAdmin(t *testing.T) {
+	db := newTestDB(t)
+	users := newTestUserService(t, db)
+	first := createTestUser(t, db)
+	grantRole(t, db, first, "admin")
+	second := createTestUser(t, db)
+	grantRole(t, db, second, "admin")
+
+	if err := users.Deactivate(context.Background(), first.ID); err != nil {
+		t.Fatalf("Deactivate() error = %v", err)
+	}
+	err := users.Deactivate(context.Background(), second.ID)
+	if errorCode(err) != "last_admin" || apperrors.HTTPStatus(err) != http.StatusConflict {
+		t.Fatalf("Deactivate() error = %v, want last_admin", err)
+	}
+	var kept models.User
+	db.Where("id = ?", second.ID).First(&kept)
+	if !kept.IsActive {
+		t.Error("last admin deactivated")
+	}
+}
+
+func TestBulkAssignRole(t *testing.T) {
+	db := newTestDB(t)
+	users := newTestUserService(t, db)
+	actor := createTestUser(t, db)
+	holder := createTestUser(t, db)
+	role := grantRole(t, db, holder, "reseller")
+	other := createTestUser(t, db)
+
+	results, err := users.BulkUpdate(context.Background(), actor.ID, []uuid.UUID{holder.ID, other.ID}, BulkAssignRole, &role.ID)
+	if err != nil {
+		t.Fatalf("BulkUpdate() error = %v", err)
+	}
+	for _, result := range results {
+		if !result.Success {
+			t.Errorf("result = %+v", result)
+		}
+	}
+	var assigned int64
+	db.Model(&models.UserRole{}).Where("role_id = ?", role.ID).Count(&assigned)
+	if assigned != 2 {
+		t.Errorf("role holders = %d, want 2", assigned)
+	}
+
+	unknown := uuid.New()
+	results, err = users.BulkUpdate(context.Background(), actor.ID, []uuid.UUID{other.ID}, BulkAssignRole, &unknown)
+	if err != nil || len(results) != 1 || results[0].Success {
+		t.Errorf("assigning an unknown role = %+v, %v", results, err)
+	}
+}
+
+func TestBulkUpdateRejectsBadRequests(t *testing.T) {
+	db := newTestDB(t)
+	users := newTestUserService(t, db)
+	user := createTestUser(t, db)
+
+	if _, err := users.BulkUpdate(context.Background(), user.ID, []uuid.UUID{user.ID}, BulkAssignRole, nil); err == nil {
+		t.Error("role assignment without a role accepted")
+	}
+	if _, err := users.BulkUpdate(context.Background(), user.ID, []uuid.UUID{user.ID}, "delete", nil); err == nil {
+		t.Error("unknown action accepted")
+	}
+}
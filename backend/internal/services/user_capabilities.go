@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// capabilityFeatures are the features GetCapabilities reports, each named after the permission
+// resource that grants it, mapped to whether it is an admin feature. RBAC only restricts a
+// customer feature once a permission for its resource exists; until then everyone has it. Admin
+// features always need a permission or the admin role.
+var capabilityFeatures = map[string]bool{
+	"domains":   false,
+	"dns":       false,
+	"email":     false,
+	"databases": false,
+	"files":     false,
+	"ftp":       false,
+	"ssl":       false,
+	"backups":   false,
+	"ssh_keys":  false,
+	"users":     true,
+	"nodes":     true,
+	"system":    true,
+}
+
+// Capabilities is what a user can do in the panel, for tailoring the UI to them
+type Capabilities struct {
+	UserID   uuid.UUID       `json:"user_id"`
+	Roles    []string        `json:"roles"`
+	Admin    bool            `json:"admin"`
+	Features map[string]bool `json:"features"`
+	// Actions lists the granted actions per permission resource; admins may do everything and
+	// get an empty list
+	Actions map[string][]string `json:"actions"`
+	Package PackageLimits       `json:"package"`
+}
+
+// PackageLimits are the allocations the user's roles grant new domains
+type PackageLimits struct {
+	DiskQuota      int64 `json:"disk_quota"`      // Bytes
+	BandwidthQuota int64 `json:"bandwidth_quota"` // Bytes
+	MaxSubdomains  int   `json:"max_subdomains"`  // Per domain; 0 means unlimited
+	AutoSSL        bool  `json:"auto_ssl"`        // New domains get a certificate automatically
+}
+
+// GetCapabilities returns the features available to a user, derived from their roles'
+// permissions, along with their package limits
+func (s *UserService) GetCapabilities(ctx context.Context, userID uuid.UUID) (*Capabilities, error) {
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions, err := s.GetUserPermissions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var defined []string
+	if err := s.db.WithContext(ctx).Model(&models.Permission{}).Distinct().Pluck("resource", &defined).Error; err != nil {
+		return nil, fmt.Errorf("failed to get permission resources: %w", err)
+	}
+
+	capabilities := resolveCapabilities(user.Roles, permissions, defined)
+	capabilities.UserID = user.ID
+
+	quotas := packageQuotas(user.Roles, s.domains.config.DefaultDiskQuota, s.domains.config.DefaultBandwidthQuota)
+	capabilities.Package = PackageLimits{
+		DiskQuota:      quotas.DiskQuota,
+		BandwidthQuota: quotas.BandwidthQuota,
+		MaxSubdomains:  packageSubdomainLimit(user.Roles, s.domains.config.DefaultMaxSubdomains),
+		AutoSSL:        packageAutoSSL(user.Roles, s.domains.config.AutoSSL),
+	}
+
+	return capabilities, nil
+}
+
+// HasCapability reports whether a feature is available to a user. Unknown features are not.
+func (s *UserService) HasCapability(ctx context.Context, userID uuid.UUID, feature string) (bool, error) {
+	capabilities, err := s.GetCapabilities(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return capabilities.Features[feature], nil
+}
+
+// resolveCapabilities works out the features and actions granted by roles and their permissions.
+// defined lists every resource some permission exists for.
+func resolveCapabilities(roles []models.Role, permissions []*models.Permission, defined []string) *Capabilities {
+	capabilities := &Capabilities{
+		Roles:    make([]string, 0, len(roles)),
+		Features: make(map[string]bool, len(capabilityFeatures)),
+		Actions:  make(map[string][]string),
+	}
+	for _, role := range roles {
+		capabilities.Roles = append(capabilities.Roles, role.Name)
+		if role.Name == "admin" {
+			capabilities.Admin = true
+		}
+	}
+	sort.Strings(capabilities.Roles)
+
+	for _, permission := range permissions {
+		capabilities.Actions[permission.Resource] = append(capabilities.Actions[permission.Resource], permission.Action)
+	}
+	for resource := range capabilities.Actions {
+		sort.Strings(capabilities.Actions[resource])
+	}
+
+	restricted := make(map[string]bool, len(defined))
+	for _, resource := range defined {
+		restricted[resource] = true
+	}
+
+	for feature, admin := range capabilityFeatures {
+		_, granted := capabilities.Actions[feature]
+		switch {
+		case capabilities.Admin || granted:
+			capabilities.Features[feature] = true
+		case admin:
+			capabilities.Features[feature] = false
+		default:
+			capabilities.Features[feature] = !restricted[feature]
+		}
+	}
+
+	return capabilities
+}
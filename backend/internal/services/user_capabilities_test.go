@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestResolveCapabilities(t *testing.T) {
+	permission := func(resource, action string) *models.Permission {
+		return &models.Permission{Resource: resource, Action: action}
+	}
+
+	tests := []struct {
+		name        string
+		roles       []models.Role
+		permissions []*models.Permission
+		defined     []string
+		want        map[string]bool
+	}{
+		{
+			name:  "no permissions defined",
+			roles: []models.Role{{Name: "user"}},
+			want:  map[string]bool{"email": true, "dns": true, "users": false, "system": false},
+		},
+		{
+			name:    "defined resource without a grant",
+			roles:   []models.Role{{Name: "user"}},
+			defined: []string{"email", "backups"},
+			want:    map[string]bool{"email": false, "backups": false, "dns": true},
+		},
+		{
+			name:        "granted resource",
+			roles:       []models.Role{{Name: "user"}},
+			permissions: []*models.Permission{permission("email", "read"), permission("users", "read")},
+			defined:     []string{"email", "users"},
+			want:        map[string]bool{"email": true, "users": true, "nodes": false},
+		},
+		{
+			name:    "admin",
+			roles:   []models.Role{{Name: "admin"}},
+			defined: []string{"email", "users"},
+			want:    map[string]bool{"email": true, "users": true, "nodes": true, "system": true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			capabilities := resolveCapabilities(tt.roles, tt.permissions, tt.defined)
+			if len(capabilities.Features) != len(capabilityFeatures) {
+				t.Errorf("%d features reported, want %d", len(capabilities.Features), len(capabilityFeatures))
+			}
+			for feature, want := range tt.want {
+				if got := capabilities.Features[feature]; got != want {
+					t.Errorf("feature %s = %v, want %v", feature, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGetCapabilities(t *testing.T) {
+	db := newTestDB(t)
+	users := newTestUserService(t, db)
+	limited := createTestUser(t, db)
+	admin := createTestUser(t, db)
+	grantRole(t, db, admin, "admin")
+	reseller := grantRole(t, db, limited, "reseller")
+
+	// Only roles granted an email permission may use email; the reseller gets DNS writes
+	for _, p := range []*models.Permission{
+		{Name: "email.manage", DisplayName: "Manage email", Resource: "email", Action: "manage"},
+		{Name: "dns.write", DisplayName: "Edit DNS", Resource: "dns", Action: "write"},
+		{Name: "dns.read", DisplayName: "Read DNS", Resource: "dns", Action: "read"},
+	} {
+		mustCreate(t, db, p)
+		if p.Resource == "dns" {
+			mustCreate(t, db, &models.RolePermission{RoleID: reseller.ID, PermissionID: p.ID})
+		}
+	}
+	db.Model(reseller).Updates(map[string]interface{}{"disk_quota": 5000, "max_subdomains": 3})
+
+	ctx := context.Background()
+	got, err := users.GetCapabilities(ctx, limited.ID)
+	if err != nil {
+		t.Fatalf("GetCapabilities() error = %v", err)
+	}
+	if got.Admin || got.Features["email"] || !got.Features["dns"] || !got.Features["files"] || got.Features["users"] {
+		t.Errorf("limited user features = %v", got.Features)
+	}
+	if actions := got.Actions["dns"]; len(actions) != 2 || actions[0] != "read" || actions[1] != "write" {
+		t.Errorf("dns actions = %v, want sorted read, write", actions)
+	}
+	if got.Package.DiskQuota != 5000 || got.Package.MaxSubdomains != 3 {
+		t.Errorf("package = %+v", got.Package)
+	}
+	if len(got.Roles) != 1 || got.Roles[0] != "reseller" {
+		t.Errorf("roles = %v", got.Roles)
+	}
+
+	full, err := users.GetCapabilities(ctx, admin.ID)
+	if err != nil {
+		t.Fatalf("GetCapabilities() error = %v", err)
+	}
+	for feature := range capabilityFeatures {
+		if !full.Features[feature] {
+			t.Errorf("admin lacks %s", feature)
+		}
+	}
+
+	if ok, err := users.HasCapability(ctx, limited.ID, "email"); ok || err != nil {
+		t.Errorf("HasCapability(email) = %v, %v", ok, err)
+	}
+	if ok, _ := users.HasCapability(ctx, admin.ID, "teleport"); ok {
+		t.Error("unknown feature reported available")
+	}
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/i18n"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// pendingEmailChange is an email change waiting for the new address to be confirmed
+type pendingEmailChange struct {
+	UserID uuid.UUID `json:"user_id"`
+	Email  string    `json:"email"`
+}
+
+// RequestEmailChange starts changing a user's email address. Nothing changes until the link sent
+// to the new address is opened, so an account can only move to an address its owner controls. A
+// new request replaces any pending one.
+func (s *UserService) RequestEmailChange(ctx context.Context, userID uuid.UUID, newEmail string) error {
+	var user models.User
+	if err := s.db.WithContext(ctx).Where("id = ?", userID).First(&user).Error; err != nil {
+		return apperrors.FromDB(err, "user")
+	}
+
+	newEmail = strings.TrimSpace(newEmail)
+	if address, err := mail.ParseAddress(newEmail); err != nil || address.Address != newEmail {
+		return apperrors.InvalidCode("email", "user.email_invalid", nil)
+	}
+	if strings.EqualFold(newEmail, user.Email) {
+		return apperrors.InvalidCode("email", "user.email_unchanged", nil)
+	}
+	if err := checkEmailAvailable(s.db.WithContext(ctx), userID, newEmail); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Errorf("failed to generate email change token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	tokenHash := hashEmailChangeToken(token)
+
+	data, err := json.Marshal(pendingEmailChange{UserID: userID, Email: newEmail})
+	if err != nil {
+		return fmt.Errorf("failed to encode email change: %w", err)
+	}
+
+	if previous, err := s.redis.Get(ctx, emailChangeUserKey(userID)).Result(); err == nil {
+		s.redis.Del(ctx, emailChangeKey(previous))
+	}
+	pipe := s.redis.TxPipeline()
+	pipe.Set(ctx, emailChangeKey(tokenHash), data, s.config.EmailChangeTTL)
+	pipe.Set(ctx, emailChangeUserKey(userID), tokenHash, s.config.EmailChangeTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to store email change: %w", err)
+	}
+
+	link, err := url.Parse(s.config.EmailChangeURL)
+	if err != nil {
+		return fmt.Errorf("invalid email change URL: %w", err)
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	if _, err := s.mailer.EnqueueLocale(ctx, newEmail, i18n.Resolve(user.Locale, ""), "confirm_email_change", map[string]string{
+		"Name":      displayName(&user),
+		"Username":  user.Username,
+		"Email":     newEmail,
+		"Link":      link.String(),
+		"ExpiresIn": shortDuration(s.config.EmailChangeTTL),
+	}); err != nil {
+		s.redis.Del(ctx, emailChangeKey(tokenHash), emailChangeUserKey(userID))
+		return fmt.Errorf("failed to send email change confirmation: %w", err)
+	}
+
+	return nil
+}
+
+// ConfirmEmailChange applies the email change a confirmation token was issued for. The new
+// address counts as verified, since opening the link proves it receives mail. The old address
+// is told about the change.
+func (s *UserService) ConfirmEmailChange(ctx context.Context, token string) (*models.User, error) {
+	data, err := s.redis.GetDel(ctx, emailChangeKey(hashEmailChangeToken(token))).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, apperrors.InvalidCode("token", "user.email_token", nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load email change: %w", err)
+	}
+
+	var change pendingEmailChange
+	if err := json.Unmarshal([]byte(data), &change); err != nil {
+		return nil, fmt.Errorf("failed to decode email change: %w", err)
+	}
+	s.redis.Del(ctx, emailChangeUserKey(change.UserID))
+
+	var (
+		user     models.User
+		oldEmail string
+	)
+	if err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ?", change.UserID).First(&user).Error; err != nil {
+			return apperrors.FromDB(err, "user")
+		}
+		// Updates writes the new address into user
+		oldEmail = user.Email
+		// The address may have been registered since the change was requested
+		if err := checkEmailAvailable(tx, user.ID, change.Email); err != nil {
+			return err
+		}
+		return tx.Model(&user).Updates(map[string]interface{}{
+			"email":             change.Email,
+			"is_email_verified": true,
+		}).Error
+	}); err != nil {
+		return nil, fmt.Errorf("failed to change email: %w", err)
+	}
+	s.invalidateUser(ctx, user.ID)
+
+	if _, err := s.mailer.EnqueueLocale(ctx, oldEmail, i18n.Resolve(user.Locale, ""), "email_changed", map[string]string{
+		"Name":     displayName(&user),
+		"Username": user.Username,
+		"OldEmail": oldEmail,
+		"NewEmail": change.Email,
+	}); err != nil {
+		s.logger.Warn("Failed to queue email change notice", zap.String("user_id", user.ID.String()), zap.Error(err))
+	}
+
+	resourceID := user.ID.String()
+	auditLog := &models.AuditLog{
+		UserID:     &user.ID,
+		Action:     "email_change",
+		Resource:   "user",
+		ResourceID: &resourceID,
+		Details:    fmt.Sprintf("email changed from %s to %s", oldEmail, change.Email),
+		Success:    true,
+	}
+	if err := s.db.WithContext(ctx).Create(auditLog).Error; err != nil {
+		s.logger.Error("Failed to record audit log", zap.Error(err))
+	}
+
+	return s.GetUser(ctx, user.ID)
+}
+
+// checkEmailAvailable rejects an address another account uses. Deleted accounts count, since
+// they keep their row and its unique email.
+func checkEmailAvailable(db *gorm.DB, userID uuid.UUID, email string) error {
+	var count int64
+	if err := db.Unscoped().Model(&models.User{}).
+		Where("email = ? AND id <> ?", email, userID).
+		Count(&count).Error; err != nil {
+		return fmt.Errorf("failed to check email existence: %w", err)
+	}
+	if count > 0 {
+		return apperrors.InvalidCode("email", "user.email_taken", nil)
+	}
+	return nil
+}
+
+func hashEmailChangeToken(token string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(token)))
+	return hex.EncodeToString(sum[:])
+}
+
+func emailChangeKey(tokenHash string) string {
+	return fmt.Sprintf("email_change:%s", tokenHash)
+}
+
+func emailChangeUserKey(userID uuid.UUID) string {
+	return fmt.Sprintf("email_change_user:%s", userID)
+}
+
+// displayName returns the name to greet a user with in emails
+func displayName(user *models.User) string {
+	if user.FirstName != "" {
+		return user.FirstName
+	}
+	return user.Username
+}
+
+// shortDuration formats a duration without trailing zero units, such as 24h or 1h30m
+func shortDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
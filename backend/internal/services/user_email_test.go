@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/auth"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/mailer"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+var emailChangeToken = regexp.MustCompile(`token=([A-Za-z0-9_-]+)`)
+
+// newEmailChangeService creates a user service that queues its mail in db's outbox
+func newEmailChangeService(t *testing.T, db *gorm.DB) *UserService {
+	t.Helper()
+
+	client, _ := newTestRedis(t)
+	domains, _ := newTestDomainService(t, db, testHostingConfig(t))
+	authService := auth.NewService(db, client, zap.NewNop(), config.AuthConfig{JWTExpiration: time.Hour}, nil, nil, nil, nil)
+	mail := mailer.NewWithSender(db, config.MailConfig{}, zap.NewNop(), nil)
+	cfg := config.AuthConfig{EmailChangeURL: "https://panel.example/account/email?lang=en", EmailChangeTTL: 24 * time.Hour}
+	return NewUserService(db, client, zap.NewNop(), nil, authService, domains, mail, cfg, nil)
+}
+
+// lastEmailChangeToken returns the token of the latest confirmation link sent to address
+func lastEmailChangeToken(t *testing.T, db *gorm.DB, address string) string {
+	t.Helper()
+
+	var email models.OutboxEmail
+	if err := db.Where("template = ? AND `to` = ?", "confirm_email_change", address).Order("created_at DESC").First(&email).Error; err != nil {
+		t.Fatalf("no confirmation sent to %s: %v", address, err)
+	}
+	match := emailChangeToken.FindStringSubmatch(email.Body)
+	if match == nil {
+		t.Fatalf("confirmation has no link:\n%s", email.Body)
+	}
+	return match[1]
+}
+
+func TestRequestEmailChangeRejections(t *testing.T) {
+	db := newTestDB(t)
+	users := newEmailChangeService(t, db)
+	user := createTestUser(t, db)
+	other := createTestUser(t, db)
+	deleted := createTestUser(t, db)
+	db.Delete(deleted)
+
+	tests := []struct {
+		name  string
+		email string
+		want  string
+	}{
+		{"not an address", "nobody", "valid email"},
+		{"display name", "Ann <ann@example.org>", "valid email"},
+		{"unchanged", "  " + user.Email, "already"},
+		{"unchanged in other case", "USER" + user.Email[4:], "already"},
+		{"taken", other.Email, "in use"},
+		{"taken by a deleted account", deleted.Email, "in use"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := users.RequestEmailChange(asUser(user.ID), user.ID, tt.email)
+			if apperrors.HTTPStatus(err) != http.StatusUnprocessableEntity {
+				t.Fatalf("RequestEmailChange(%q) error = %v, want a validation error", tt.email, err)
+			}
+		})
+	}
+
+	var queued int64
+	db.Model(&models.OutboxEmail{}).Count(&queued)
+	if queued != 0 {
+		t.Errorf("%d emails queued for rejected changes", queued)
+	}
+}
+
+func TestEmailChangeConfirmation(t *testing.T) {
+	db := newTestDB(t)
+	users := newEmailChangeService(t, db)
+	user := createTestUser(t, db)
+	db.Model(user).Update("is_email_verified", true)
+	oldEmail := user.Email
+	ctx := asUser(user.ID)
+
+	if err := users.RequestEmailChange(ctx, user.ID, "first@example.org"); err != nil {
+		t.Fatalf("RequestEmailChange() error = %v", err)
+	}
+	replaced := lastEmailChangeToken(t, db, "first@example.org")
+	if err := users.RequestEmailChange(ctx, user.ID, "new@example.org"); err != nil {
+		t.Fatalf("RequestEmailChange() error = %v", err)
+	}
+	token := lastEmailChangeToken(t, db, "new@example.org")
+
+	var stored models.User
+	db.Where("id = ?", user.ID).First(&stored)
+	if stored.Email != oldEmail {
+		t.Fatalf("email changed to %s before confirmation", stored.Email)
+	}
+
+	if _, err := users.ConfirmEmailChange(context.Background(), replaced); apperrors.HTTPStatus(err) != http.StatusUnprocessableEntity {
+		t.Errorf("replaced token: error = %v, want a validation error", err)
+	}
+
+	changed, err := users.ConfirmEmailChange(context.Background(), token)
+	if err != nil {
+		t.Fatalf("ConfirmEmailChange() error = %v", err)
+	}
+	if changed.Email != "new@example.org" || !changed.IsEmailVerified {
+		t.Errorf("confirmed user: email %s, verified %v", changed.Email, changed.IsEmailVerified)
+	}
+
+	var notice models.OutboxEmail
+	if err := db.Where("template = ?", "email_changed").First(&notice).Error; err != nil || notice.To != oldEmail {
+		t.Errorf("notice to old address: %+v (%v)", notice, err)
+	}
+	var audits int64
+	db.Model(&models.AuditLog{}).Where("action = ? AND user_id = ?", "email_change", user.ID).Count(&audits)
+	if audits != 1 {
+		t.Errorf("%d audit entries, want 1", audits)
+	}
+
+	if _, err := users.ConfirmEmailChange(context.Background(), token); apperrors.HTTPStatus(err) != http.StatusUnprocessableEntity {
+		t.Errorf("reused token: error = %v, want a validation error", err)
+	}
+}
+
+func TestConfirmEmailChangeTakenMeanwhile(t *testing.T) {
+	db := newTestDB(t)
+	users := newEmailChangeService(t, db)
+	user := createTestUser(t, db)
+	oldEmail := user.Email
+
+	if err := users.RequestEmailChange(asUser(user.ID), user.ID, "wanted@example.org"); err != nil {
+		t.Fatalf("RequestEmailChange() error = %v", err)
+	}
+	token := lastEmailChangeToken(t, db, "wanted@example.org")
+	mustCreate(t, db, &models.User{Username: "quick", Email: "wanted@example.org", PasswordHash: "x", IsActive: true})
+
+	if _, err := users.ConfirmEmailChange(context.Background(), token); apperrors.HTTPStatus(err) != http.StatusUnprocessableEntity {
+		t.Fatalf("ConfirmEmailChange() error = %v, want a validation error", err)
+	}
+	var stored models.User
+	db.Where("id = ?", user.ID).First(&stored)
+	if stored.Email != oldEmail {
+		t.Errorf("email = %s, want the old address kept", stored.Email)
+	}
+}
+
+func TestUpdateUserEmail(t *testing.T) {
+	db := newTestDB(t)
+	users := newTestUserService(t, db)
+	user := createTestUser(t, db)
+	admin := createTestUser(t, db)
+	db.Model(user).Update("is_email_verified", true)
+
+	if _, err := users.UpdateUser(asUser(user.ID, "user"), user.ID, map[string]interface{}{"email": "self@example.org"}); apperrors.HTTPStatus(err) != http.StatusUnprocessableEntity {
+		t.Errorf("own update: error = %v, want a validation error", err)
+	}
+	if _, err := users.UpdateUser(asUser(admin.ID, "admin"), user.ID, map[string]interface{}{"email": admin.Email}); apperrors.HTTPStatus(err) != http.StatusUnprocessableEntity {
+		t.Errorf("taken address: error = %v, want a validation error", err)
+	}
+
+	if _, err := users.UpdateUser(asUser(admin.ID, "admin"), user.ID, map[string]interface{}{"email": "set@example.org"}); err != nil {
+		t.Fatalf("admin update: %v", err)
+	}
+	var stored models.User
+	db.Where("id = ?", user.ID).First(&stored)
+	if stored.Email != "set@example.org" || stored.IsEmailVerified {
+		t.Errorf("after admin update: email %s, verified %v", stored.Email, stored.IsEmailVerified)
+	}
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestUpdateUserLocale(t *testing.T) {
+	tests := []struct {
+		locale  interface{}
+		want    string
+		invalid bool
+	}{
+		{locale: "de", want: "de"},
+		{locale: "de-AT", want: "de"},
+		{locale: " EN ", want: "en"},
+		{locale: "", want: ""},
+		{locale: "fr", invalid: true},
+		{locale: 7, invalid: true},
+	}
+
+	for _, tt := range tests {
+		db := newTestDB(t)
+		users := newTestUserService(t, db)
+		user := createTestUser(t, db)
+
+		_, err := users.UpdateUser(asUser(user.ID, "user"), user.ID, map[string]interface{}{"locale": tt.locale})
+		if tt.invalid {
+			if apperrors.HTTPStatus(err) != http.StatusUnprocessableEntity {
+				t.Errorf("locale %v: error = %v, want a validation error", tt.locale, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("locale %v: error = %v", tt.locale, err)
+		}
+		var stored models.User
+		db.Where("id = ?", user.ID).First(&stored)
+		if stored.Locale != tt.want {
+			t.Errorf("locale %v stored as %q, want %q", tt.locale, stored.Locale, tt.want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/i18n"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// NotifyPasswordExpiry notifies users whose password expires within the configured notice period,
+// once per password. Users whose password already expired unnoticed, such as when a maximum age
+// is first set, are notified too.
+func (s *UserService) NotifyPasswordExpiry(ctx context.Context) error {
+	shortest, err := s.shortestPasswordMaxAge(ctx)
+	if err != nil || shortest <= 0 {
+		return err
+	}
+
+	// No password changed after the cutoff can be due yet, whatever the user's roles
+	cutoff := time.Now().Add(s.config.PasswordExpiryNotice - shortest)
+	var users []models.User
+	if err := s.db.WithContext(ctx).
+		Preload("Roles").
+		Where("is_active = ? AND password_warned_at IS NULL", true).
+		Where("COALESCE(password_changed_at, created_at) < ?", cutoff).
+		Find(&users).Error; err != nil {
+		return fmt.Errorf("failed to get users with expiring passwords: %w", err)
+	}
+
+	notified := 0
+	for i := range users {
+		if s.notifyPasswordExpiry(ctx, &users[i]) {
+			notified++
+		}
+	}
+	if notified > 0 {
+		s.logger.Info("Notified users of expiring passwords", zap.Int("users", notified))
+	}
+	return nil
+}
+
+// notifyPasswordExpiry notifies a user when their password is due and records the notice. As with
+// other notices, it is recorded even when the notification cannot be sent.
+func (s *UserService) notifyPasswordExpiry(ctx context.Context, user *models.User) bool {
+	expiresAt := s.auth.PasswordExpiresAt(user)
+	if expiresAt == nil || time.Until(*expiresAt) > s.config.PasswordExpiryNotice {
+		return false
+	}
+
+	if s.notifications != nil {
+		if err := s.notifications.Notify(ctx, user.ID, NotificationSecurity, func(locale string) (string, string) {
+			params := map[string]string{
+				"username": user.Username,
+				"date":     expiresAt.Format("2006-01-02"),
+			}
+			return i18n.Translate(locale, "password.due.subject", params), i18n.Translate(locale, "password.due.body", params)
+		}); err != nil {
+			s.logger.Warn("Failed to send password expiry notice", zap.String("user_id", user.ID.String()), zap.Error(err))
+		}
+	}
+
+	if err := s.db.WithContext(ctx).Model(&models.User{}).Where("id = ?", user.ID).UpdateColumn("password_warned_at", time.Now()).Error; err != nil {
+		s.logger.Error("Failed to record password expiry notice", zap.String("user_id", user.ID.String()), zap.Error(err))
+		return false
+	}
+	return true
+}
+
+// shortestPasswordMaxAge returns the shortest maximum password age of the configuration and the
+// roles, or zero when passwords never expire
+func (s *UserService) shortestPasswordMaxAge(ctx context.Context) (time.Duration, error) {
+	shortest := s.config.PasswordMaxAge
+
+	var days []int
+	if err := s.db.WithContext(ctx).Model(&models.Role{}).
+		Where("password_max_age_days > 0").
+		Pluck("password_max_age_days", &days).Error; err != nil {
+		return 0, fmt.Errorf("failed to get password ages of roles: %w", err)
+	}
+	for _, d := range days {
+		if age := time.Duration(d) * 24 * time.Hour; shortest <= 0 || age < shortest {
+			shortest = age
+		}
+	}
+
+	return shortest, nil
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/mynodecp/mynodecp/backend/internal/auth"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// newPasswordExpiryService creates a user service expiring passwords after 30 days, with a notice
+// a week before, whose notifications are queued in db's outbox
+func newPasswordExpiryService(t *testing.T) *UserService {
+	t.Helper()
+
+	db := newTestDB(t)
+	client, _ := newTestRedis(t)
+	cfg := config.AuthConfig{JWTExpiration: time.Hour, PasswordMaxAge: 30 * 24 * time.Hour, PasswordExpiryNotice: 7 * 24 * time.Hour}
+	return NewUserService(db, client, zap.NewNop(), nil, auth.NewService(db, client, zap.NewNop(), cfg, nil, nil, nil, nil), nil, nil, cfg, newTestNotificationService(t, db))
+}
+
+// passwordChanged stores a user whose password was changed age ago
+func passwordChanged(t *testing.T, users *UserService, age time.Duration) *models.User {
+	t.Helper()
+
+	user := createTestUser(t, users.db)
+	changedAt := time.Now().Add(-age)
+	users.db.Model(user).Update("password_changed_at", changedAt)
+	user.PasswordChangedAt = &changedAt
+	return user
+}
+
+func TestChangePasswordClearsExpiry(t *testing.T) {
+	users := newPasswordExpiryService(t)
+	ctx := context.Background()
+	user := passwordChanged(t, users, 40*24*time.Hour)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("original-pass"), bcrypt.MinCost)
+	users.db.Model(user).Updates(map[string]interface{}{"password_hash": string(hash), "password_warned_at": time.Now()})
+
+	if err := users.ChangePassword(ctx, user.ID, "wrong-pass", "rotated-pass"); fieldMessage(err, "current_password") != "current password is incorrect" {
+		t.Fatalf("ChangePassword() with a wrong password error = %v", err)
+	}
+	if err := users.ChangePassword(ctx, user.ID, "original-pass", "rotated-pass"); err != nil {
+		t.Fatalf("ChangePassword() error = %v", err)
+	}
+
+	var changed models.User
+	users.db.First(&changed, "id = ?", user.ID)
+	if changed.PasswordChangedAt == nil || time.Since(*changed.PasswordChangedAt) > time.Minute || changed.PasswordWarnedAt != nil {
+		t.Errorf("changed at %v, warned at %v, want now and cleared", changed.PasswordChangedAt, changed.PasswordWarnedAt)
+	}
+	if expiresAt := users.auth.PasswordExpiresAt(&changed); expiresAt == nil || !expiresAt.After(time.Now()) {
+		t.Errorf("password expires at %v, want in the future", expiresAt)
+	}
+}
+
+func TestNotifyPasswordExpiry(t *testing.T) {
+	users := newPasswordExpiryService(t)
+	ctx := context.Background()
+	due := passwordChanged(t, users, 25*24*time.Hour)
+	expired := passwordChanged(t, users, 40*24*time.Hour)
+	fresh := passwordChanged(t, users, 10*24*time.Hour)
+	exempt := passwordChanged(t, users, 25*24*time.Hour)
+	never := 0
+	role := &models.Role{Name: "service", DisplayName: "Service", PasswordMaxAgeDays: &never}
+	mustCreate(t, users.db, role)
+	mustCreate(t, users.db, &models.UserRole{UserID: exempt.ID, RoleID: role.ID})
+
+	// Notices go out once per password
+	for i := 0; i < 2; i++ {
+		if err := users.NotifyPasswordExpiry(ctx); err != nil {
+			t.Fatalf("NotifyPasswordExpiry() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		user *models.User
+		want int
+	}{
+		{"due within the notice", due, 1},
+		{"already expired", expired, 1},
+		{"not due yet", fresh, 0},
+		{"exempt role", exempt, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var notices []models.Notification
+			users.db.Where("user_id = ? AND event_type = ?", tt.user.ID, NotificationSecurity).Find(&notices)
+			if len(notices) != tt.want {
+				t.Fatalf("%d notices, want %d", len(notices), tt.want)
+			}
+			if tt.want > 0 && !strings.Contains(notices[0].Body, tt.user.Username) {
+				t.Errorf("notice = %q, want it naming the account", notices[0].Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/mynodecp/mynodecp/backend/internal/auth"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestChangePasswordRejectsRecentPasswords(t *testing.T) {
+	db := newTestDB(t)
+	client, _ := newTestRedis(t)
+	cfg := config.AuthConfig{JWTExpiration: time.Hour, PasswordMinLength: 8, PasswordHistory: 2}
+	users := NewUserService(db, client, zap.NewNop(), nil, auth.NewService(db, client, zap.NewNop(), cfg, nil, nil, nil, nil), nil, nil, cfg, nil)
+	user := createTestUser(t, db)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("original-pass"), bcrypt.MinCost)
+	db.Model(user).Update("password_hash", string(hash))
+	ctx := context.Background()
+
+	steps := []struct {
+		current, next string
+		reused        bool
+	}{
+		{"original-pass", "original-pass", true}, // The current password
+		{"original-pass", "second-pass", false},
+		{"second-pass", "original-pass", true}, // Within the last two
+		{"second-pass", "third-pass", false},
+		{"third-pass", "original-pass", false}, // Older than the last two
+	}
+	for _, step := range steps {
+		err := users.ChangePassword(ctx, user.ID, step.current, step.next)
+		if step.reused {
+			if fieldMessage(err, "new_password") != "must differ from your last 2 passwords" {
+				t.Fatalf("ChangePassword(%s -> %s) error = %v, want the password rejected as reused", step.current, step.next, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("ChangePassword(%s -> %s) error = %v", step.current, step.next, err)
+		}
+	}
+
+	var kept int64
+	db.Model(&models.PasswordHistory{}).Where("user_id = ?", user.ID).Count(&kept)
+	if kept != 2 {
+		t.Errorf("%d history entries kept, want 2", kept)
+	}
+
+	// Resetting the password is held to the same window
+	if _, err := users.ResetPassword(ctx, user.Username, "third-pass"); fieldMessage(err, "password") == "" {
+		t.Errorf("ResetPassword() error = %v, want the recent password rejected", err)
+	}
+	if _, err := users.ResetPassword(ctx, user.Username, "second-pass"); err != nil {
+		t.Errorf("ResetPassword() error = %v for a password older than the window", err)
+	}
+}
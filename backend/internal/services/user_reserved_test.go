@@ -0,0 +1,34 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/auth"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestUpdateUserReservedUsername(t *testing.T) {
+	db := newTestDB(t)
+	client, _ := newTestRedis(t)
+	domains, _ := newTestDomainService(t, db, testHostingConfig(t))
+	authService := auth.NewService(db, client, zap.NewNop(), config.AuthConfig{JWTExpiration: time.Hour, ReservedUsernames: []string{"support"}}, nil, nil, nil, nil)
+	users := NewUserService(db, client, zap.NewNop(), nil, authService, domains, nil, config.AuthConfig{}, nil)
+	user := createTestUser(t, db)
+
+	if _, err := users.UpdateUser(asUser(user.ID, "user"), user.ID, map[string]interface{}{"username": "Support"}); fieldMessage(err, "username") == "" {
+		t.Errorf("user taking a reserved name: error = %v", err)
+	}
+	if _, err := users.UpdateUser(asUser(user.ID, "admin"), user.ID, map[string]interface{}{"username": "support"}); err != nil {
+		t.Fatalf("admin giving out a reserved name: %v", err)
+	}
+
+	var stored models.User
+	db.Where("id = ?", user.ID).First(&stored)
+	if stored.Username != "support" {
+		t.Errorf("username = %q, want support", stored.Username)
+	}
+}
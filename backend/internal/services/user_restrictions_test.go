@@ -0,0 +1,77 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestSetLoginRestrictions(t *testing.T) {
+	db := newTestDB(t)
+	users := newTestUserService(t, db)
+	users.config.GeoIPDatabase = "/usr/share/GeoIP/GeoLite2-City.mmdb"
+	user := createTestUser(t, db)
+	ctx := asUser(user.ID, "user")
+
+	rejections := []struct {
+		name         string
+		restrictions LoginRestrictions
+		field        string
+		want         string
+	}{
+		{"malformed range", LoginRestrictions{IPRanges: []string{"203.0.113.0/33"}}, "ip_ranges", `"203.0.113.0/33" is not`},
+		{"host name", LoginRestrictions{IPRanges: []string{"office.example"}}, "ip_ranges", "not an IP address"},
+		{"country name", LoginRestrictions{Countries: []string{"Netherlands"}}, "countries", "two-letter"},
+		{"numeric country", LoginRestrictions{Countries: []string{"31"}}, "countries", "two-letter"},
+	}
+	for _, tt := range rejections {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := users.SetLoginRestrictions(ctx, user.ID, tt.restrictions)
+			if message := fieldMessage(err, tt.field); !strings.Contains(message, tt.want) {
+				t.Errorf("%s = %q (%v), want %q", tt.field, message, err, tt.want)
+			}
+		})
+	}
+
+	updated, err := users.SetLoginRestrictions(ctx, user.ID, LoginRestrictions{
+		IPRanges:  []string{" 203.0.113.9 ", "198.51.100.77/24", "198.51.100.0/24", "2001:db8::1"},
+		Countries: []string{"nl", "NL", " de"},
+	})
+	if err != nil {
+		t.Fatalf("SetLoginRestrictions() error = %v", err)
+	}
+	var stored models.User
+	db.First(&stored, "id = ?", user.ID)
+	wantRanges := []string{"203.0.113.9/32", "198.51.100.0/24", "2001:db8::1/128"}
+	wantCountries := []string{"NL", "DE"}
+	if !reflect.DeepEqual(updated.AllowedIPRanges, wantRanges) || !reflect.DeepEqual(stored.AllowedIPRanges, wantRanges) {
+		t.Errorf("ranges = %v, stored %v, want %v", updated.AllowedIPRanges, stored.AllowedIPRanges, wantRanges)
+	}
+	if !reflect.DeepEqual(stored.AllowedCountries, wantCountries) {
+		t.Errorf("countries = %v, want %v", stored.AllowedCountries, wantCountries)
+	}
+
+	// Other users cannot change them; admins can lift them
+	other := createTestUser(t, db)
+	if _, err := users.SetLoginRestrictions(asUser(other.ID, "user"), user.ID, LoginRestrictions{}); err == nil {
+		t.Error("another user lifted the restrictions")
+	}
+	if _, err := users.SetLoginRestrictions(asUser(other.ID, "admin"), user.ID, LoginRestrictions{}); err != nil {
+		t.Fatalf("admin lifting the restrictions: %v", err)
+	}
+	db.First(&stored, "id = ?", user.ID)
+	if len(stored.AllowedIPRanges) != 0 || len(stored.AllowedCountries) != 0 {
+		t.Errorf("restrictions left after lifting: %v %v", stored.AllowedIPRanges, stored.AllowedCountries)
+	}
+
+	// Countries need a GeoIP database to locate logins
+	users.config.GeoIPDatabase = ""
+	if _, err := users.SetLoginRestrictions(ctx, user.ID, LoginRestrictions{Countries: []string{"NL"}}); !strings.Contains(fieldMessage(err, "countries"), "GeoIP") {
+		t.Errorf("countries without GeoIP: error = %v", err)
+	}
+	if _, err := users.SetLoginRestrictions(ctx, user.ID, LoginRestrictions{IPRanges: []string{"203.0.113.0/24"}}); err != nil {
+		t.Errorf("ranges without GeoIP: %v", err)
+	}
+}
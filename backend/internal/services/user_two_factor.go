@@ -0,0 +1,305 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/auth"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// TwoFactorMethods describes the second factors of a user
+type TwoFactorMethods struct {
+	Available       []string                    `json:"available"` // Methods the server offers
+	Enrolled        []string                    `json:"enrolled"`  // Methods the user set up, in the order logins fall back on them
+	Default         string                      `json:"default"`   // Method logins are challenged with first
+	SecurityKeys    []models.WebAuthnCredential `json:"security_keys"`
+	BackupCodesLeft int                         `json:"backup_codes_left"`
+}
+
+// GetTwoFactorMethods returns the second factors a user has enrolled
+func (s *UserService) GetTwoFactorMethods(ctx context.Context, userID uuid.UUID) (*TwoFactorMethods, error) {
+	var user models.User
+	if err := s.db.WithContext(ctx).Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, apperrors.FromDB(err, "user")
+	}
+
+	methods := &TwoFactorMethods{Default: user.TwoFactorMethod}
+	for _, method := range s.config.TwoFactorMethods {
+		if s.auth.MethodAvailable(method) {
+			methods.Available = append(methods.Available, method)
+		}
+	}
+
+	enrolled, err := s.auth.EnrolledMethods(ctx, &user)
+	if err != nil {
+		return nil, err
+	}
+	methods.Enrolled = enrolled
+
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at").Find(&methods.SecurityKeys).Error; err != nil {
+		return nil, fmt.Errorf("failed to get security keys: %w", err)
+	}
+
+	var hashes []string
+	if user.TwoFactorBackupCodes != "" && json.Unmarshal([]byte(user.TwoFactorBackupCodes), &hashes) == nil {
+		methods.BackupCodesLeft = len(hashes)
+	}
+
+	return methods, nil
+}
+
+// EnableEmailOTP lets a user receive sign-in codes at their verified email address. Backup codes
+// are returned when this is the user's first second factor, and nil otherwise.
+func (s *UserService) EnableEmailOTP(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	user, err := s.twoFactorUser(ctx, userID, auth.MethodEmail)
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsEmailVerified {
+		return nil, apperrors.PreconditionCode("user.mfa_unverified", nil)
+	}
+
+	codes, err := s.enrollSecondFactor(s.db.WithContext(ctx), user, auth.MethodEmail, map[string]interface{}{
+		"email_otp_enabled": true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.invalidateUser(ctx, userID)
+
+	return codes, nil
+}
+
+// BeginWebAuthnRegistration returns the options the browser needs to create a new security key or
+// passkey for a user
+func (s *UserService) BeginWebAuthnRegistration(ctx context.Context, userID uuid.UUID) (*auth.WebAuthnCreationOptions, error) {
+	user, err := s.twoFactorUser(ctx, userID, auth.MethodWebAuthn)
+	if err != nil {
+		return nil, err
+	}
+
+	var existing []models.WebAuthnCredential
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).Find(&existing).Error; err != nil {
+		return nil, fmt.Errorf("failed to get security keys: %w", err)
+	}
+
+	return s.auth.BeginWebAuthnRegistration(ctx, user, existing)
+}
+
+// FinishWebAuthnRegistration checks the browser's response to BeginWebAuthnRegistration and stores
+// the new security key under the given name. Backup codes are returned when this is the user's
+// first second factor, and nil otherwise.
+func (s *UserService) FinishWebAuthnRegistration(ctx context.Context, userID uuid.UUID, name string, attestation *auth.WebAuthnAttestation) (*models.WebAuthnCredential, []string, error) {
+	user, err := s.twoFactorUser(ctx, userID, auth.MethodWebAuthn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "Security key"
+	}
+
+	credential, err := s.auth.FinishWebAuthnRegistration(ctx, user, attestation)
+	if err != nil {
+		return nil, nil, err
+	}
+	credential.Name = name
+
+	var codes []string
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(credential).Error; err != nil {
+			return apperrors.FromDB(err, "security key")
+		}
+		codes, err = s.enrollSecondFactor(tx, user, auth.MethodWebAuthn, map[string]interface{}{})
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	s.invalidateUser(ctx, userID)
+
+	return credential, codes, nil
+}
+
+// RemoveTwoFactorMethod removes one of a user's second factors. For WebAuthn, credentialID picks
+// the security key to remove, and uuid.Nil removes them all. If the removed method was the default,
+// the next enrolled one takes its place; removing the last one disables two-factor authentication.
+func (s *UserService) RemoveTwoFactorMethod(ctx context.Context, userID uuid.UUID, method string, credentialID uuid.UUID) error {
+	var user models.User
+	if err := s.db.WithContext(ctx).Where("id = ?", userID).First(&user).Error; err != nil {
+		return apperrors.FromDB(err, "user")
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		switch method {
+		case auth.MethodTOTP:
+			user.TwoFactorSecret = ""
+			if err := tx.Model(&user).Update("two_factor_secret", "").Error; err != nil {
+				return err
+			}
+		case auth.MethodEmail:
+			user.EmailOTPEnabled = false
+			if err := tx.Model(&user).Update("email_otp_enabled", false).Error; err != nil {
+				return err
+			}
+		case auth.MethodWebAuthn:
+			query := tx.Where("user_id = ?", userID)
+			if credentialID != uuid.Nil {
+				query = query.Where("id = ?", credentialID)
+			}
+			result := query.Delete(&models.WebAuthnCredential{})
+			if result.Error != nil {
+				return result.Error
+			}
+			if credentialID != uuid.Nil && result.RowsAffected == 0 {
+				return apperrors.NotFound("security key")
+			}
+		default:
+			v := apperrors.NewValidation()
+			v.AddCode("method", "user.mfa_not_enrolled", map[string]string{"method": method})
+			return v.Err()
+		}
+
+		return settleSecondFactors(tx, &user)
+	})
+	if err != nil {
+		return err
+	}
+	s.invalidateUser(ctx, userID)
+
+	return nil
+}
+
+// SetDefaultTwoFactorMethod sets the method a user's logins are challenged with first
+func (s *UserService) SetDefaultTwoFactorMethod(ctx context.Context, userID uuid.UUID, method string) error {
+	var user models.User
+	if err := s.db.WithContext(ctx).Where("id = ?", userID).First(&user).Error; err != nil {
+		return apperrors.FromDB(err, "user")
+	}
+
+	enrolled, err := s.auth.EnrolledMethods(ctx, &user)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(enrolled, method) {
+		v := apperrors.NewValidation()
+		v.AddCode("method", "user.mfa_not_enrolled", map[string]string{"method": method})
+		return v.Err()
+	}
+
+	if err := s.db.WithContext(ctx).Model(&user).Update("two_factor_method", method).Error; err != nil {
+		return fmt.Errorf("failed to set default two-factor method: %w", err)
+	}
+	s.invalidateUser(ctx, userID)
+
+	return nil
+}
+
+// twoFactorUser loads a user about to enroll a second factor, checking the server offers it
+func (s *UserService) twoFactorUser(ctx context.Context, userID uuid.UUID, method string) (*models.User, error) {
+	if !s.auth.MethodAvailable(method) {
+		v := apperrors.NewValidation()
+		v.AddCode("method", "user.mfa_unavailable", map[string]string{"method": method})
+		return nil, v.Err()
+	}
+
+	var user models.User
+	if err := s.db.WithContext(ctx).Where("id = ?", userID).First(&user).Error; err != nil {
+		return nil, apperrors.FromDB(err, "user")
+	}
+	return &user, nil
+}
+
+// enrollSecondFactor applies updates enrolling method for a user and enables two-factor
+// authentication. The method becomes the default if the user has none, and backup codes are
+// generated and returned if the user has none.
+func (s *UserService) enrollSecondFactor(tx *gorm.DB, user *models.User, method string, updates map[string]interface{}) ([]string, error) {
+	updates["is_two_factor_enabled"] = true
+	if user.TwoFactorMethod == "" {
+		updates["two_factor_method"] = method
+	}
+
+	var codes []string
+	if user.TwoFactorBackupCodes == "" {
+		var hashes string
+		var err error
+		codes, hashes, err = newBackupCodes()
+		if err != nil {
+			return nil, err
+		}
+		updates["two_factor_backup_codes"] = hashes
+	}
+
+	if err := tx.Model(user).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to enable two-factor authentication: %w", err)
+	}
+
+	return codes, nil
+}
+
+// settleSecondFactors fixes up a user after a second factor was removed: the default moves to the
+// first method still enrolled, and without any two-factor authentication is disabled
+func settleSecondFactors(tx *gorm.DB, user *models.User) error {
+	var count int64
+	if err := tx.Model(&models.WebAuthnCredential{}).Where("user_id = ?", user.ID).Count(&count).Error; err != nil {
+		return err
+	}
+
+	// Work out what is left from the user's columns, as the removal is not committed yet
+	var enrolled []string
+	if count > 0 {
+		enrolled = append(enrolled, auth.MethodWebAuthn)
+	}
+	if user.TwoFactorSecret != "" {
+		enrolled = append(enrolled, auth.MethodTOTP)
+	}
+	if user.EmailOTPEnabled && user.IsEmailVerified {
+		enrolled = append(enrolled, auth.MethodEmail)
+	}
+
+	if len(enrolled) == 0 {
+		return tx.Model(user).Updates(map[string]interface{}{
+			"is_two_factor_enabled":   false,
+			"two_factor_backup_codes": "",
+			"two_factor_method":       "",
+		}).Error
+	}
+	if !slices.Contains(enrolled, user.TwoFactorMethod) {
+		return tx.Model(user).Update("two_factor_method", enrolled[0]).Error
+	}
+	return nil
+}
+
+// newBackupCodes generates one-time backup codes, returning them and the JSON list of their hashes
+// to store
+func newBackupCodes() ([]string, string, error) {
+	codes := make([]string, twoFactorBackupCodeCount)
+	hashes := make([]string, twoFactorBackupCodeCount)
+	for i := range codes {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, "", fmt.Errorf("failed to generate backup codes: %w", err)
+		}
+		encoded := hex.EncodeToString(buf)
+		codes[i] = encoded[:5] + "-" + encoded[5:]
+		hashes[i] = auth.HashBackupCode(codes[i])
+	}
+
+	hashesJSON, err := json.Marshal(hashes)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode backup codes: %w", err)
+	}
+
+	return codes, string(hashesJSON), nil
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/auth"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestTwoFactorSetup(t *testing.T) {
+	db := newTestDB(t)
+	client, _ := newTestRedis(t)
+	authService := auth.NewService(db, client, zap.NewNop(), config.AuthConfig{JWTExpiration: time.Hour, TwoFactorMethods: []string{auth.MethodTOTP}}, nil, nil, nil, nil)
+	users := NewUserService(db, client, zap.NewNop(), nil, authService, nil, nil, config.AuthConfig{}, nil)
+	user := createTestUser(t, db)
+	ctx := context.Background()
+
+	// Confirming without a setup in progress asks for one to be started
+	if _, err := users.ConfirmTwoFactorSetup(ctx, user.ID, "123456"); errorCode(err) != "two_factor_setup_missing" || apperrors.HTTPStatus(err) != http.StatusConflict {
+		t.Errorf("confirm without a setup: error = %v", err)
+	}
+
+	setup, err := users.BeginTwoFactorSetup(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("BeginTwoFactorSetup() error = %v", err)
+	}
+	if _, err := users.ConfirmTwoFactorSetup(ctx, user.ID, "000000"); fieldMessage(err, "code") == "" {
+		t.Errorf("confirm with a wrong code: error = %v, want code rejected", err)
+	}
+
+	code, err := totp.GenerateCode(setup.Secret, time.Now())
+	if err != nil {
+		t.Fatalf("generate code: %v", err)
+	}
+	backupCodes, err := users.ConfirmTwoFactorSetup(ctx, user.ID, code)
+	if err != nil || len(backupCodes) == 0 {
+		t.Fatalf("ConfirmTwoFactorSetup() = %v, %v", backupCodes, err)
+	}
+	var stored models.User
+	db.First(&stored, "id = ?", user.ID)
+	if !stored.IsTwoFactorEnabled || stored.TwoFactorMethod != "totp" {
+		t.Errorf("after setup: enabled %v, method %q", stored.IsTwoFactorEnabled, stored.TwoFactorMethod)
+	}
+
+	// The setup is used up, and a second app cannot be set up over the first
+	if _, err := users.ConfirmTwoFactorSetup(ctx, user.ID, code); errorCode(err) != "two_factor_setup_missing" {
+		t.Errorf("confirm twice: error = %v", err)
+	}
+	if _, err := users.BeginTwoFactorSetup(ctx, user.ID); errorCode(err) != "two_factor_enrolled" || apperrors.HTTPStatus(err) != http.StatusConflict {
+		t.Errorf("setup over an enrolled app: error = %v", err)
+	}
+}
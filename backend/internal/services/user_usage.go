@@ -0,0 +1,223 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// UsageRecord is the usage of one domain during a billing period, aggregated from its snapshots.
+// Peaks are the highest sampled values; bandwidth is the month's total as of the last snapshot.
+type UsageRecord struct {
+	DomainID       uuid.UUID `json:"domain_id"`
+	DomainName     string    `json:"domain_name"`
+	Samples        int       `json:"samples"`
+	FirstSample    time.Time `json:"first_sample"`
+	LastSample     time.Time `json:"last_sample"`
+	DiskPeak       int64     `json:"disk_peak"`    // Bytes
+	DiskAverage    int64     `json:"disk_average"` // Bytes, averaged over the samples
+	Bandwidth      int64     `json:"bandwidth"`    // Bytes
+	EmailAccounts  int       `json:"email_accounts"`
+	EmailPeakMB    int64     `json:"email_peak_mb"`
+	Databases      int       `json:"databases"`
+	DatabasePeakMB int64     `json:"database_peak_mb"`
+}
+
+var usageExportHeader = []string{
+	"domain_id", "domain_name", "samples", "first_sample", "last_sample", "disk_peak", "disk_average",
+	"bandwidth", "email_accounts", "email_peak_mb", "databases", "database_peak_mb",
+}
+
+func (r *UsageRecord) fields() []string {
+	return []string{
+		r.DomainID.String(),
+		r.DomainName,
+		strconv.Itoa(r.Samples),
+		r.FirstSample.UTC().Format(time.RFC3339),
+		r.LastSample.UTC().Format(time.RFC3339),
+		strconv.FormatInt(r.DiskPeak, 10),
+		strconv.FormatInt(r.DiskAverage, 10),
+		strconv.FormatInt(r.Bandwidth, 10),
+		strconv.Itoa(r.EmailAccounts),
+		strconv.FormatInt(r.EmailPeakMB, 10),
+		strconv.Itoa(r.Databases),
+		strconv.FormatInt(r.DatabasePeakMB, 10),
+	}
+}
+
+// usagePeriod returns the billing period (UTC calendar month) containing month
+func usagePeriod(month time.Time) (time.Time, time.Time) {
+	year, mon, _ := month.UTC().Date()
+	start := time.Date(year, mon, 1, 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 1, 0)
+}
+
+// UsageExport writes the usage of a user's domains during the calendar month (UTC) containing
+// month to w as CSV or JSON, one record per domain the user owned during the month. Users export
+// their own usage; admins any account's.
+func (s *UserService) UsageExport(ctx context.Context, w io.Writer, userID uuid.UUID, month time.Time, format string) error {
+	if err := authorizeOwner(ctx, userID, "user"); err != nil {
+		return err
+	}
+
+	var out exportWriter
+	switch format {
+	case ExportFormatCSV:
+		out = &csvExportWriter{w: csv.NewWriter(w)}
+	case ExportFormatJSON:
+		out = &jsonExportWriter{w: w}
+	default:
+		return fmt.Errorf("unsupported export format: %s", format)
+	}
+
+	records, err := s.usageRecords(ctx, userID, month)
+	if err != nil {
+		return err
+	}
+
+	if err := out.begin(usageExportHeader); err != nil {
+		return err
+	}
+	for _, record := range records {
+		if err := out.write(record, record.fields()); err != nil {
+			return fmt.Errorf("failed to write export: %w", err)
+		}
+	}
+	return out.end()
+}
+
+// usageRecords aggregates a user's snapshots of a billing period by domain, in domain name order
+func (s *UserService) usageRecords(ctx context.Context, userID uuid.UUID, month time.Time) ([]*UsageRecord, error) {
+	start, end := usagePeriod(month)
+
+	var snapshots []*models.UsageSnapshot
+	if err := s.db.WithContext(ctx).
+		Where("user_id = ? AND taken_at >= ? AND taken_at < ?", userID, start, end).
+		Order("domain_name, domain_id, taken_at").
+		Find(&snapshots).Error; err != nil {
+		return nil, fmt.Errorf("failed to get usage snapshots: %w", err)
+	}
+
+	return aggregateUsage(snapshots), nil
+}
+
+// aggregateUsage folds snapshots, ordered by domain and time, into one record per domain
+func aggregateUsage(snapshots []*models.UsageSnapshot) []*UsageRecord {
+	var records []*UsageRecord
+	var record *UsageRecord
+	var diskTotal int64
+	for _, snapshot := range snapshots {
+		if record == nil || record.DomainID != snapshot.DomainID {
+			if record != nil {
+				record.DiskAverage = diskTotal / int64(record.Samples)
+			}
+			record = &UsageRecord{DomainID: snapshot.DomainID, FirstSample: snapshot.TakenAt}
+			records = append(records, record)
+			diskTotal = 0
+		}
+
+		record.DomainName = snapshot.DomainName
+		record.Samples++
+		record.LastSample = snapshot.TakenAt
+		diskTotal += snapshot.DiskUsage
+		record.DiskPeak = max(record.DiskPeak, snapshot.DiskUsage)
+		record.Bandwidth = max(record.Bandwidth, snapshot.BandwidthUsage)
+		record.EmailAccounts = max(record.EmailAccounts, snapshot.EmailAccounts)
+		record.EmailPeakMB = max(record.EmailPeakMB, snapshot.EmailUsedMB)
+		record.Databases = max(record.Databases, snapshot.Databases)
+		record.DatabasePeakMB = max(record.DatabasePeakMB, snapshot.DatabaseSizeMB)
+	}
+	if record != nil {
+		record.DiskAverage = diskTotal / int64(record.Samples)
+	}
+
+	return records
+}
+
+// domainTotals is the count and summed size of a domain's mailboxes or databases
+type domainTotals struct {
+	DomainID uuid.UUID
+	Count    int
+	Size     int64
+}
+
+// TakeUsageSnapshots records the current usage of every domain for the billing exports
+func (s *UserService) TakeUsageSnapshots(ctx context.Context) error {
+	var domains []*models.Domain
+	if err := s.db.WithContext(ctx).
+		Select("id", "user_id", "name", "disk_usage", "bandwidth_usage").
+		Find(&domains).Error; err != nil {
+		return fmt.Errorf("failed to get domains: %w", err)
+	}
+	if len(domains) == 0 {
+		return nil
+	}
+
+	mail, err := s.domainTotals(ctx, &models.EmailAccount{}, "used_mb")
+	if err != nil {
+		return fmt.Errorf("failed to sum mailbox usage: %w", err)
+	}
+	databases, err := s.domainTotals(ctx, &models.Database{}, "size_mb")
+	if err != nil {
+		return fmt.Errorf("failed to sum database sizes: %w", err)
+	}
+
+	takenAt := time.Now().UTC().Truncate(time.Second)
+	snapshots := make([]*models.UsageSnapshot, 0, len(domains))
+	for _, domain := range domains {
+		snapshots = append(snapshots, &models.UsageSnapshot{
+			DomainID:       domain.ID,
+			TakenAt:        takenAt,
+			UserID:         domain.UserID,
+			DomainName:     domain.Name,
+			DiskUsage:      domain.DiskUsage,
+			BandwidthUsage: domain.BandwidthUsage,
+			EmailAccounts:  mail[domain.ID].Count,
+			EmailUsedMB:    mail[domain.ID].Size,
+			Databases:      databases[domain.ID].Count,
+			DatabaseSizeMB: databases[domain.ID].Size,
+		})
+	}
+
+	if err := s.db.WithContext(ctx).CreateInBatches(snapshots, 500).Error; err != nil {
+		return fmt.Errorf("failed to store usage snapshots: %w", err)
+	}
+
+	s.logger.Debug("Usage snapshots taken", zap.Int("domains", len(snapshots)))
+	return nil
+}
+
+// domainTotals counts the rows of a per-domain model and sums one of their size columns, by domain
+func (s *UserService) domainTotals(ctx context.Context, model interface{}, sizeColumn string) (map[uuid.UUID]domainTotals, error) {
+	var rows []domainTotals
+	if err := s.db.WithContext(ctx).Model(model).
+		Select("domain_id, COUNT(*) AS count, COALESCE(SUM(" + sizeColumn + "), 0) AS size").
+		Group("domain_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	totals := make(map[uuid.UUID]domainTotals, len(rows))
+	for _, row := range rows {
+		totals[row.DomainID] = row
+	}
+	return totals, nil
+}
+
+// PurgeUsageSnapshots deletes usage snapshots taken before the given time
+func (s *UserService) PurgeUsageSnapshots(ctx context.Context, before time.Time) (int64, error) {
+	result := s.db.WithContext(ctx).Where("taken_at < ?", before).Delete(&models.UsageSnapshot{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to purge usage snapshots: %w", result.Error)
+	}
+
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestUsagePeriod(t *testing.T) {
+	tests := []struct {
+		month      time.Time
+		start, end string
+	}{
+		{time.Date(2024, time.March, 15, 12, 0, 0, 0, time.UTC), "2024-03-01", "2024-04-01"},
+		{time.Date(2024, time.December, 31, 23, 59, 0, 0, time.UTC), "2024-12-01", "2025-01-01"},
+		// The month is taken in UTC
+		{time.Date(2024, time.March, 31, 22, 0, 0, 0, time.FixedZone("UTC-5", -5*3600)), "2024-04-01", "2024-05-01"},
+	}
+	for _, tt := range tests {
+		start, end := usagePeriod(tt.month)
+		if start.Format("2006-01-02") != tt.start || end.Format("2006-01-02") != tt.end {
+			t.Errorf("usagePeriod(%v) = %v, %v, want %s, %s", tt.month, start, end, tt.start, tt.end)
+		}
+	}
+}
+
+func TestUsageExport(t *testing.T) {
+	db := newTestDB(t)
+	users := NewUserService(db, nil, zap.NewNop(), nil, nil, nil, nil, config.AuthConfig{}, nil)
+	owner := createTestUser(t, db)
+	other := createTestUser(t, db)
+	shop := createTestDomain(t, db, owner, "shop.example")
+	blog := createTestDomain(t, db, owner, "blog.example")
+	ctx := asUser(owner.ID, "user")
+
+	snapshot := func(domain *models.Domain, at time.Time, disk, bandwidth int64, mailboxes int) {
+		mustCreate(t, db, &models.UsageSnapshot{
+			DomainID: domain.ID, TakenAt: at, UserID: domain.UserID, DomainName: domain.Name,
+			DiskUsage: disk, BandwidthUsage: bandwidth, EmailAccounts: mailboxes, EmailUsedMB: int64(mailboxes) * 10,
+			Databases: 1, DatabaseSizeMB: disk / 100,
+		})
+	}
+	day := func(month time.Month, day int) time.Time { return time.Date(2024, month, day, 6, 0, 0, 0, time.UTC) }
+
+	// Outside March, on either side
+	snapshot(shop, day(time.February, 29), 9000, 9000, 9)
+	snapshot(shop, day(time.April, 1).Add(-6*time.Hour), 9000, 9000, 9)
+	// March
+	snapshot(shop, day(time.March, 1).Add(-6*time.Hour), 1000, 100, 1)
+	snapshot(shop, day(time.March, 10), 3000, 500, 3)
+	snapshot(shop, day(time.March, 20), 2000, 800, 2)
+	snapshot(blog, day(time.March, 5), 400, 40, 0)
+	// Another account's domain
+	mustCreate(t, db, &models.UsageSnapshot{DomainID: createTestDomain(t, db, other, "other.example").ID, TakenAt: day(time.March, 5), UserID: other.ID, DomainName: "other.example", DiskUsage: 7})
+
+	march := time.Date(2024, time.March, 15, 0, 0, 0, 0, time.UTC)
+
+	var buf bytes.Buffer
+	if err := users.UsageExport(ctx, &buf, owner.ID, march, ExportFormatJSON); err != nil {
+		t.Fatalf("UsageExport() error = %v", err)
+	}
+	var records []UsageRecord
+	if err := json.Unmarshal(buf.Bytes(), &records); err != nil {
+		t.Fatalf("export is not JSON: %v\n%s", err, buf.String())
+	}
+	if len(records) != 2 || records[0].DomainName != "blog.example" || records[1].DomainName != "shop.example" {
+		t.Fatalf("records = %+v, want blog.example and shop.example", records)
+	}
+	got := records[1]
+	want := UsageRecord{
+		DomainID: shop.ID, DomainName: "shop.example", Samples: 3,
+		FirstSample: day(time.March, 1).Add(-6 * time.Hour), LastSample: day(time.March, 20),
+		DiskPeak: 3000, DiskAverage: 2000, Bandwidth: 800,
+		EmailAccounts: 3, EmailPeakMB: 30, Databases: 1, DatabasePeakMB: 30,
+	}
+	if !got.FirstSample.Equal(want.FirstSample) || !got.LastSample.Equal(want.LastSample) {
+		t.Errorf("samples from %v to %v, want %v to %v", got.FirstSample, got.LastSample, want.FirstSample, want.LastSample)
+	}
+	got.FirstSample, got.LastSample = want.FirstSample, want.LastSample
+	if got != want {
+		t.Errorf("shop.example = %+v, want %+v", got, want)
+	}
+	if blog := records[0]; blog.Samples != 1 || blog.DiskPeak != 400 || blog.DiskAverage != 400 || blog.Bandwidth != 40 {
+		t.Errorf("blog.example = %+v", blog)
+	}
+
+	// The CSV has the same records under a header
+	buf.Reset()
+	if err := users.UsageExport(ctx, &buf, owner.ID, march, ExportFormatCSV); err != nil {
+		t.Fatalf("UsageExport(csv) error = %v", err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil || len(rows) != 3 {
+		t.Fatalf("CSV rows = %v, %v", rows, err)
+	}
+	if rows[0][0] != "domain_id" || rows[2][1] != "shop.example" || rows[2][2] != "3" || rows[2][3] != "2024-03-01T00:00:00Z" || rows[2][7] != "800" {
+		t.Errorf("CSV = %v", rows)
+	}
+
+	// A month without snapshots exports nothing
+	buf.Reset()
+	if err := users.UsageExport(ctx, &buf, owner.ID, march.AddDate(-1, 0, 0), ExportFormatCSV); err != nil {
+		t.Fatalf("UsageExport() of an empty month error = %v", err)
+	}
+	if rows, _ := csv.NewReader(&buf).ReadAll(); len(rows) != 1 {
+		t.Errorf("empty month = %v, want only the header", rows)
+	}
+
+	if err := users.UsageExport(ctx, &buf, owner.ID, march, "xml"); err == nil {
+		t.Error("UsageExport() accepted an unknown format")
+	}
+	if err := users.UsageExport(asUser(other.ID, "user"), &buf, owner.ID, march, ExportFormatCSV); !apperrors.IsPermissionDenied(err) {
+		t.Errorf("another user's export error = %v, want permission denied", err)
+	}
+	buf.Reset()
+	if err := users.UsageExport(asUser(other.ID, "admin"), &buf, owner.ID, march, ExportFormatCSV); err != nil {
+		t.Errorf("admin export error = %v", err)
+	}
+	if rows, _ := csv.NewReader(&buf).ReadAll(); len(rows) != 3 {
+		t.Errorf("admin export = %v", rows)
+	}
+}
+
+func TestTakeUsageSnapshots(t *testing.T) {
+	db := newTestDB(t)
+	users := NewUserService(db, nil, zap.NewNop(), nil, nil, nil, nil, config.AuthConfig{}, nil)
+	owner := createTestUser(t, db)
+	shop := createTestDomain(t, db, owner, "shop.example")
+	empty := createTestDomain(t, db, owner, "empty.example")
+	db.Model(shop).Updates(map[string]interface{}{"disk_usage": 5000, "bandwidth_usage": 700})
+	mustCreate(t, db, &models.EmailAccount{DomainID: shop.ID, Username: "a", PasswordHash: "x", UsedMB: 12})
+	mustCreate(t, db, &models.EmailAccount{DomainID: shop.ID, Username: "b", PasswordHash: "x", UsedMB: 30})
+	mustCreate(t, db, &models.Database{DomainID: shop.ID, Name: "shop_db", Type: "mysql", SizeMB: 64})
+
+	if err := users.TakeUsageSnapshots(context.Background()); err != nil {
+		t.Fatalf("TakeUsageSnapshots() error = %v", err)
+	}
+
+	var snapshots []models.UsageSnapshot
+	db.Order("domain_name").Find(&snapshots)
+	if len(snapshots) != 2 {
+		t.Fatalf("%d snapshots, want 2", len(snapshots))
+	}
+	if s := snapshots[0]; s.DomainID != empty.ID || s.DiskUsage != 0 || s.EmailAccounts != 0 || s.Databases != 0 {
+		t.Errorf("empty.example snapshot = %+v", s)
+	}
+	want := models.UsageSnapshot{
+		DomainID: shop.ID, TakenAt: snapshots[1].TakenAt, UserID: owner.ID, DomainName: "shop.example",
+		DiskUsage: 5000, BandwidthUsage: 700, EmailAccounts: 2, EmailUsedMB: 42, Databases: 1, DatabaseSizeMB: 64,
+	}
+	if snapshots[1] != want {
+		t.Errorf("shop.example snapshot = %+v, want %+v", snapshots[1], want)
+	}
+	if time.Since(snapshots[1].TakenAt) > time.Minute {
+		t.Errorf("snapshot taken at %v", snapshots[1].TakenAt)
+	}
+
+	// Snapshots go into the export of the current month
+	var buf bytes.Buffer
+	if err := users.UsageExport(asUser(owner.ID, "user"), &buf, owner.ID, time.Now(), ExportFormatCSV); err != nil {
+		t.Fatalf("UsageExport() error = %v", err)
+	}
+	if rows, _ := csv.NewReader(&buf).ReadAll(); len(rows) != 3 {
+		t.Errorf("export after a snapshot = %v", rows)
+	}
+
+	// Purging drops the old ones only
+	mustCreate(t, db, &models.UsageSnapshot{DomainID: shop.ID, TakenAt: time.Now().AddDate(-2, 0, 0), UserID: owner.ID, DomainName: "shop.example"})
+	purged, err := users.PurgeUsageSnapshots(context.Background(), time.Now().AddDate(-1, 0, 0))
+	if err != nil || purged != 1 {
+		t.Errorf("PurgeUsageSnapshots() = %d, %v, want 1", purged, err)
+	}
+}
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/secret"
+)
+
+const (
+	// vaultItemLimit is the number of vault items a user can keep
+	vaultItemLimit      = 500
+	vaultNameMaxLen     = 128
+	vaultSecretMaxBytes = 8192
+	vaultNotesMaxBytes  = 8192
+)
+
+// VaultService stores users' secrets encrypted. Items are only ever read by their owner:
+// admins have no access to other users' vaults, and a sealed value is bound to its owner and
+// item, so it does not open when copied to another row.
+type VaultService struct {
+	db     *gorm.DB
+	logger *zap.Logger
+}
+
+// NewVaultService creates a new vault service
+func NewVaultService(db *gorm.DB, logger *zap.Logger) *VaultService {
+	return &VaultService{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// VaultContent is the sealed part of a vault item
+type VaultContent struct {
+	Secret string `json:"secret"`
+	Notes  string `json:"notes"`
+}
+
+// VaultItemDetails is a vault item opened for its owner
+type VaultItemDetails struct {
+	*models.VaultItem
+	VaultContent
+}
+
+// VaultItemUpdate holds the changes to a vault item; nil fields are kept
+type VaultItemUpdate struct {
+	Name   *string
+	Secret *string
+	Notes  *string
+}
+
+// ListItems lists the names of a user's vault items, without opening them
+func (s *VaultService) ListItems(ctx context.Context, userID uuid.UUID) ([]*models.VaultItem, error) {
+	var items []*models.VaultItem
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).Order("name").Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("failed to get vault items: %w", err)
+	}
+
+	return items, nil
+}
+
+// CreateItem stores a new secret in a user's vault
+func (s *VaultService) CreateItem(ctx context.Context, userID uuid.UUID, name string, content VaultContent) (*VaultItemDetails, error) {
+	keyring, err := vaultKeyring()
+	if err != nil {
+		return nil, err
+	}
+
+	name = strings.TrimSpace(name)
+	if err := validateVaultItem(name, content); err != nil {
+		return nil, err
+	}
+
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&models.VaultItem{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("failed to count vault items: %w", err)
+	}
+	if count >= vaultItemLimit {
+		return nil, apperrors.PreconditionCode("vault_limit_reached", map[string]string{"limit": fmt.Sprint(vaultItemLimit)})
+	}
+
+	item := &models.VaultItem{ID: uuid.New(), UserID: userID, Name: name}
+	if item.Sealed, err = sealVaultContent(keyring, item, content); err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).Create(item).Error; err != nil {
+		return nil, fmt.Errorf("failed to create vault item: %w", err)
+	}
+
+	s.audit(ctx, "vault.create", item)
+
+	return &VaultItemDetails{VaultItem: item, VaultContent: content}, nil
+}
+
+// GetItem opens one of a user's vault items
+func (s *VaultService) GetItem(ctx context.Context, userID, itemID uuid.UUID) (*VaultItemDetails, error) {
+	keyring, err := vaultKeyring()
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := s.item(ctx, userID, itemID)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := openVaultContent(keyring, item)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit(ctx, "vault.reveal", item)
+
+	return &VaultItemDetails{VaultItem: item, VaultContent: *content}, nil
+}
+
+// UpdateItem changes the name, secret or notes of one of a user's vault items
+func (s *VaultService) UpdateItem(ctx context.Context, userID, itemID uuid.UUID, update VaultItemUpdate) (*VaultItemDetails, error) {
+	keyring, err := vaultKeyring()
+	if err != nil {
+		return nil, err
+	}
+
+	item, err := s.item(ctx, userID, itemID)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := openVaultContent(keyring, item)
+	if err != nil {
+		return nil, err
+	}
+	if update.Name != nil {
+		item.Name = strings.TrimSpace(*update.Name)
+	}
+	if update.Secret != nil {
+		content.Secret = *update.Secret
+	}
+	if update.Notes != nil {
+		content.Notes = *update.Notes
+	}
+	if err := validateVaultItem(item.Name, *content); err != nil {
+		return nil, err
+	}
+
+	if item.Sealed, err = sealVaultContent(keyring, item, *content); err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).Model(item).Updates(map[string]interface{}{
+		"name":   item.Name,
+		"sealed": item.Sealed,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to update vault item: %w", err)
+	}
+
+	s.audit(ctx, "vault.update", item)
+
+	return &VaultItemDetails{VaultItem: item, VaultContent: *content}, nil
+}
+
+// DeleteItem removes one of a user's vault items
+func (s *VaultService) DeleteItem(ctx context.Context, userID, itemID uuid.UUID) error {
+	item, err := s.item(ctx, userID, itemID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.WithContext(ctx).Delete(item).Error; err != nil {
+		return fmt.Errorf("failed to delete vault item: %w", err)
+	}
+
+	s.audit(ctx, "vault.delete", item)
+
+	return nil
+}
+
+// item loads a vault item of the user; items of other users are not found, for admins too
+func (s *VaultService) item(ctx context.Context, userID, itemID uuid.UUID) (*models.VaultItem, error) {
+	var item models.VaultItem
+	if err := s.db.WithContext(ctx).Where("id = ? AND user_id = ?", itemID, userID).First(&item).Error; err != nil {
+		return nil, apperrors.FromDB(err, "vault item")
+	}
+	return &item, nil
+}
+
+// vaultKeyring returns the keyring, which the vault cannot work without
+func vaultKeyring() (*secret.Keyring, error) {
+	keyring := secret.Current()
+	if keyring == nil {
+		return nil, apperrors.PreconditionCode("vault_unavailable", nil)
+	}
+	return keyring, nil
+}
+
+// vaultContext binds sealed vault content to its owner and item
+func vaultContext(item *models.VaultItem) string {
+	return "vault:" + item.UserID.String() + ":" + item.ID.String()
+}
+
+func sealVaultContent(keyring *secret.Keyring, item *models.VaultItem, content VaultContent) (string, error) {
+	plaintext, err := json.Marshal(content)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode vault item: %w", err)
+	}
+	sealed, err := keyring.EncryptFor(string(plaintext), vaultContext(item))
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt vault item: %w", err)
+	}
+	return sealed, nil
+}
+
+func openVaultContent(keyring *secret.Keyring, item *models.VaultItem) (*VaultContent, error) {
+	plaintext, err := keyring.DecryptFor(item.Sealed, vaultContext(item))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt vault item: %w", err)
+	}
+	var content VaultContent
+	if err := json.Unmarshal([]byte(plaintext), &content); err != nil {
+		return nil, fmt.Errorf("failed to decode vault item: %w", err)
+	}
+	return &content, nil
+}
+
+func validateVaultItem(name string, content VaultContent) error {
+	v := apperrors.NewValidation()
+	if name == "" {
+		v.AddCode("name", "field.empty", nil)
+	} else if len(name) > vaultNameMaxLen || strings.ContainsAny(name, "\r\n") {
+		v.AddCode("name", "vault.name_invalid", map[string]string{"max": fmt.Sprint(vaultNameMaxLen)})
+	}
+	if len(content.Secret) > vaultSecretMaxBytes {
+		v.AddCode("secret", "vault.too_large", map[string]string{"max": fmt.Sprint(vaultSecretMaxBytes)})
+	}
+	if len(content.Notes) > vaultNotesMaxBytes {
+		v.AddCode("notes", "vault.too_large", map[string]string{"max": fmt.Sprint(vaultNotesMaxBytes)})
+	}
+	return v.Err()
+}
+
+// audit records changes to and reveals of a vault item, without its content
+func (s *VaultService) audit(ctx context.Context, action string, item *models.VaultItem) {
+	resourceID := item.ID.String()
+	auditLog := &models.AuditLog{
+		UserID:     actorFromContext(ctx),
+		Action:     action,
+		Resource:   "vault_item",
+		ResourceID: &resourceID,
+		Details:    fmt.Sprintf("owner=%s name=%q", item.UserID, item.Name),
+		Success:    true,
+	}
+	if err := s.db.WithContext(ctx).Create(auditLog).Error; err != nil {
+		s.logger.Error("Failed to record audit log", zap.Error(err))
+	}
+}
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/mynodecp/mynodecp/backend/internal/apperrors"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+	"github.com/mynodecp/mynodecp/backend/internal/secret"
+)
+
+func TestVaultStoresCiphertext(t *testing.T) {
+	db := newTestDB(t)
+	useKeyring(t, "v1")
+	vault := NewVaultService(db, zap.NewNop())
+	owner := createTestUser(t, db)
+	ctx := asUser(owner.ID, "user")
+
+	created, err := vault.CreateItem(ctx, owner.ID, " Shop database ", VaultContent{Secret: "hunter2-mysql", Notes: "user shop_admin"})
+	if err != nil {
+		t.Fatalf("CreateItem() error = %v", err)
+	}
+	if created.Name != "Shop database" || created.Secret != "hunter2-mysql" {
+		t.Errorf("created = %+v", created)
+	}
+
+	var sealed string
+	db.Raw("SELECT sealed FROM vault_items WHERE id = ?", created.ID).Scan(&sealed)
+	if !strings.HasPrefix(sealed, "enc:v1:") || strings.Contains(sealed, "hunter2") || strings.Contains(sealed, "shop_admin") {
+		t.Errorf("stored as %q, want ciphertext", sealed)
+	}
+
+	// Listing does not open items, and their JSON carries no sealed content
+	items, err := vault.ListItems(ctx, owner.ID)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("ListItems() = %v, %v", items, err)
+	}
+	listed, _ := json.Marshal(items)
+	if strings.Contains(string(listed), "enc:") || strings.Contains(string(listed), "hunter2") || !strings.Contains(string(listed), "Shop database") {
+		t.Errorf("list = %s", listed)
+	}
+
+	opened, err := vault.GetItem(ctx, owner.ID, created.ID)
+	if err != nil || opened.Secret != "hunter2-mysql" || opened.Notes != "user shop_admin" {
+		t.Errorf("GetItem() = %+v, %v", opened, err)
+	}
+	var reveals int64
+	db.Model(&models.AuditLog{}).Where("action = ? AND resource_id = ?", "vault.reveal", created.ID.String()).Count(&reveals)
+	if reveals != 1 {
+		t.Errorf("%d reveals audited, want 1", reveals)
+	}
+}
+
+func TestVaultOpensOnlyForOwner(t *testing.T) {
+	db := newTestDB(t)
+	useKeyring(t, "v1")
+	vault := NewVaultService(db, zap.NewNop())
+	owner, other := createTestUser(t, db), createTestUser(t, db)
+	item, err := vault.CreateItem(asUser(owner.ID, "user"), owner.ID, "FTP", VaultContent{Secret: "s3cret"})
+	if err != nil {
+		t.Fatalf("CreateItem() error = %v", err)
+	}
+	name := "Renamed"
+
+	// Other users, admins among them, do not find the item
+	tests := []struct {
+		name string
+		call func(ctx context.Context, userID uuid.UUID) error
+	}{
+		{"get", func(ctx context.Context, userID uuid.UUID) error {
+			_, err := vault.GetItem(ctx, userID, item.ID)
+			return err
+		}},
+		{"update", func(ctx context.Context, userID uuid.UUID) error {
+			_, err := vault.UpdateItem(ctx, userID, item.ID, VaultItemUpdate{Name: &name})
+			return err
+		}},
+		{"delete", func(ctx context.Context, userID uuid.UUID) error {
+			return vault.DeleteItem(ctx, userID, item.ID)
+		}},
+	}
+	for _, tt := range tests {
+		for _, roles := range [][]string{{"user"}, {"admin"}} {
+			if err := tt.call(asUser(other.ID, roles...), other.ID); !apperrors.IsNotFound(err) {
+				t.Errorf("%s by %v error = %v, want not found", tt.name, roles, err)
+			}
+		}
+	}
+	if items, _ := vault.ListItems(asUser(other.ID, "user"), other.ID); len(items) != 0 {
+		t.Errorf("another user lists %d items", len(items))
+	}
+
+	// Sealed content copied to another user's item does not open there
+	copied := &models.VaultItem{UserID: other.ID, Name: "Copied"}
+	mustCreate(t, db, copied)
+	var sealed string
+	db.Raw("SELECT sealed FROM vault_items WHERE id = ?", item.ID).Scan(&sealed)
+	db.Model(&models.VaultItem{}).Where("id = ?", copied.ID).Update("sealed", sealed)
+	if _, err := vault.GetItem(asUser(other.ID, "user"), other.ID, copied.ID); err == nil {
+		t.Error("sealed content opened for another user's item")
+	}
+
+	var stored models.VaultItem
+	db.First(&stored, "id = ?", item.ID)
+	if stored.Name != "FTP" {
+		t.Errorf("item renamed to %q by another user", stored.Name)
+	}
+}
+
+func TestVaultUpdateAndDelete(t *testing.T) {
+	db := newTestDB(t)
+	useKeyring(t, "v1")
+	vault := NewVaultService(db, zap.NewNop())
+	owner := createTestUser(t, db)
+	ctx := asUser(owner.ID, "user")
+	item, _ := vault.CreateItem(ctx, owner.ID, "Mail", VaultContent{Secret: "old", Notes: "imap"})
+
+	secretValue := "new"
+	updated, err := vault.UpdateItem(ctx, owner.ID, item.ID, VaultItemUpdate{Secret: &secretValue})
+	if err != nil {
+		t.Fatalf("UpdateItem() error = %v", err)
+	}
+	opened, _ := vault.GetItem(ctx, owner.ID, item.ID)
+	if updated.Secret != "new" || opened.Secret != "new" || opened.Notes != "imap" || opened.Name != "Mail" {
+		t.Errorf("after update = %+v, want the secret changed and the rest kept", opened.VaultContent)
+	}
+
+	if err := vault.DeleteItem(ctx, owner.ID, item.ID); err != nil {
+		t.Fatalf("DeleteItem() error = %v", err)
+	}
+	if _, err := vault.GetItem(ctx, owner.ID, item.ID); !apperrors.IsNotFound(err) {
+		t.Errorf("deleted item error = %v, want not found", err)
+	}
+}
+
+func TestVaultValidation(t *testing.T) {
+	db := newTestDB(t)
+	useKeyring(t, "v1")
+	vault := NewVaultService(db, zap.NewNop())
+	owner := createTestUser(t, db)
+	ctx := asUser(owner.ID, "user")
+
+	tests := []struct {
+		name    string
+		item    string
+		content VaultContent
+		field   string
+	}{
+		{"empty name", "  ", VaultContent{Secret: "x"}, "name"},
+		{"long name", strings.Repeat("n", vaultNameMaxLen+1), VaultContent{}, "name"},
+		{"name on two lines", "FTP\nSSH", VaultContent{}, "name"},
+		{"large secret", "FTP", VaultContent{Secret: strings.Repeat("s", vaultSecretMaxBytes+1)}, "secret"},
+		{"large notes", "FTP", VaultContent{Notes: strings.Repeat("n", vaultNotesMaxBytes+1)}, "notes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := vault.CreateItem(ctx, owner.ID, tt.item, tt.content); fieldMessage(err, tt.field) == "" {
+				t.Errorf("CreateItem() error = %v, want %s rejected", err, tt.field)
+			}
+		})
+	}
+
+	// A full vault takes no more items
+	items := make([]*models.VaultItem, vaultItemLimit)
+	for i := range items {
+		items[i] = &models.VaultItem{UserID: owner.ID, Name: "item", Sealed: "enc:v1:x"}
+	}
+	if err := db.CreateInBatches(items, 100).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := vault.CreateItem(ctx, owner.ID, "One more", VaultContent{}); errorCode(err) != "vault_limit_reached" {
+		t.Errorf("CreateItem() in a full vault error = %v", err)
+	}
+}
+
+func TestVaultWithoutKeyring(t *testing.T) {
+	db := newTestDB(t)
+	secret.Use(nil)
+	vault := NewVaultService(db, zap.NewNop())
+	owner := createTestUser(t, db)
+
+	if _, err := vault.CreateItem(asUser(owner.ID, "user"), owner.ID, "FTP", VaultContent{Secret: "x"}); errorCode(err) != "vault_unavailable" {
+		t.Errorf("CreateItem() error = %v, want vault_unavailable", err)
+	}
+	var count int64
+	db.Model(&models.VaultItem{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d items stored without a key", count)
+	}
+}
+
+func TestReencryptSecretsResealsVault(t *testing.T) {
+	db := newTestDB(t)
+	useKeyring(t, "v1")
+	vault := NewVaultService(db, zap.NewNop())
+	owner := createTestUser(t, db)
+	ctx := asUser(owner.ID, "user")
+	item, _ := vault.CreateItem(ctx, owner.ID, "SSH", VaultContent{Secret: "rotate me"})
+
+	useKeyring(t, "v1", "v2")
+	system := NewSystemService(db, nil, zap.NewNop(), testHostingConfig(t), nil, nil, nil, nil)
+	if _, err := system.ReencryptSecrets(context.Background()); err != nil {
+		t.Fatalf("ReencryptSecrets() error = %v", err)
+	}
+
+	var sealed string
+	db.Raw("SELECT sealed FROM vault_items WHERE id = ?", item.ID).Scan(&sealed)
+	if !strings.HasPrefix(sealed, "enc:v2:") {
+		t.Errorf("sealed = %q, want it under the current key", sealed)
+	}
+	// The old key can go
+	keyring, err := secret.NewKeyring(map[string]string{"v2": base64.StdEncoding.EncodeToString([]byte(strings.Repeat("b", secret.KeySize)))}, "v2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret.Use(keyring)
+	if opened, err := vault.GetItem(ctx, owner.ID, item.ID); err != nil || opened.Secret != "rotate me" {
+		t.Errorf("GetItem() after rotation = %+v, %v", opened, err)
+	}
+}
@@ -0,0 +1,94 @@
+// Package tracing records OpenTelemetry spans of requests and of the work they cause: service
+// methods, database and Redis calls, commands and jobs. Spans are exported to an OTLP collector;
+// without one configured the global tracer provider stays the no-op one, so starting spans costs
+// next to nothing.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+)
+
+// instrumentation names the tracer the panel's spans come from
+const instrumentation = "github.com/mynodecp/mynodecp/backend"
+
+// RequestIDKey is the span attribute holding the request ID, as in the request logs
+const RequestIDKey = attribute.Key("request.id")
+
+// Setup exports spans to the configured collector and returns the function that flushes and
+// stops the export on shutdown. It leaves tracing off when no endpoint is configured.
+func Setup(ctx context.Context, cfg config.TracingConfig, version string) (func(context.Context) error, error) {
+	if cfg.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	options := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.Endpoint)}
+	if cfg.Insecure {
+		options = append(options, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRate))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceName("mynodecp"),
+			semconv.ServiceVersion(version),
+		)),
+	)
+	Use(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Use makes a tracer provider the one spans are recorded with, and propagates trace context in
+// the W3C headers
+func Use(provider trace.TracerProvider) {
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+}
+
+// Tracer returns the tracer of the panel's spans
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentation)
+}
+
+// Start starts a span of internal work, such as a service method, as a child of the span on ctx
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End ends a span, marking it failed when err is set. It is meant to be deferred with a pointer
+// to the named error result of the traced function.
+func End(span trace.Span, err *error) {
+	if err != nil && *err != nil {
+		Fail(span, *err)
+	}
+	span.End()
+}
+
+// Fail records an error on a span and marks it failed
+func Fail(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// SetUser adds the ID of the authenticated user to the span on ctx
+func SetUser(ctx context.Context, userID string) {
+	trace.SpanFromContext(ctx).SetAttributes(semconv.EnduserID(userID))
+}
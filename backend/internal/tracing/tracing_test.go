@@ -0,0 +1,66 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+)
+
+func TestSetupWithoutEndpoint(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	shutdown, err := Setup(context.Background(), config.TracingConfig{}, "test")
+	if err != nil {
+		t.Fatalf("Setup() error = %v", err)
+	}
+	if otel.GetTracerProvider() != previous {
+		t.Error("Setup() replaced the tracer provider without an endpoint")
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("shutdown() error = %v", err)
+	}
+}
+
+func TestEnd(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	recorder := tracetest.NewSpanRecorder()
+	Use(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	failure := errors.New("zone not found")
+	tests := []struct {
+		name       string
+		err        *error
+		wantCode   codes.Code
+		wantEvents int
+	}{
+		{"no error result", nil, codes.Unset, 0},
+		{"nil error", new(error), codes.Unset, 0},
+		{"error", &failure, codes.Error, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, span := Start(context.Background(), "DNSService.GetZone")
+			SetUser(ctx, "user-1")
+			End(span, tt.err)
+
+			spans := recorder.Ended()
+			got := spans[len(spans)-1]
+			if got.Status().Code != tt.wantCode || len(got.Events()) != tt.wantEvents {
+				t.Errorf("span = %+v, %d events", got.Status(), len(got.Events()))
+			}
+			if tt.wantCode == codes.Error && got.Status().Description != "zone not found" {
+				t.Errorf("description = %q", got.Status().Description)
+			}
+			if attrs := got.Attributes(); len(attrs) != 1 || attrs[0].Value.AsString() != "user-1" {
+				t.Errorf("attributes = %v, want the user", attrs)
+			}
+		})
+	}
+}
@@ -0,0 +1,312 @@
+package vhost
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+const siteTemplate = `{{define "suspended"}}
+    root {{.SuspendedRoot}};
+    error_page 503 /suspended.html;
+
+    location = /suspended.html {
+        internal;
+    }
+
+    location / {
+        return 503;
+    }
+{{- end -}}
+{{define "body"}}
+    root {{.DocumentRoot}};
+    index index.php index.html index.htm;
+
+    access_log {{.AccessLog}} {{.LogFormat}};
+    error_log {{.ErrorLog}};
+{{- range .Redirects}}
+
+    location = {{.Path}} {
+        return {{.Code}} "{{.Target}}";
+    }
+{{- end}}
+{{- range .ProtectedDirectories}}
+
+    location ~ {{.Pattern}} {
+        auth_basic "{{.Realm}}";
+        auth_basic_user_file {{.UserFile}};
+        try_files $uri $uri/ /index.php?$query_string;
+
+        location ~ \.php$ {
+            include fastcgi_params;
+            fastcgi_pass unix:{{$.PHPSocket}};
+            fastcgi_param SCRIPT_FILENAME $document_root$fastcgi_script_name;
+        }
+    }
+{{- end}}
+
+    location / {
+        try_files $uri $uri/ /index.php?$query_string;
+    }
+
+    location ~ \.php$ {
+        include fastcgi_params;
+        fastcgi_pass unix:{{.PHPSocket}};
+        fastcgi_param SCRIPT_FILENAME $document_root$fastcgi_script_name;
+    }
+
+    location ~ /\.ht {
+        deny all;
+    }
+{{- end -}}
+server {
+    listen 80;
+    listen [::]:80;
+    server_name {{.ServerNames}};
+{{- if .Suspended}}
+{{template "suspended" .}}
+{{- else if .DomainRedirect}}
+
+    return {{.DomainRedirect.Code}} "{{.DomainRedirect.Target}}";
+{{- else if .ForceHTTPS}}
+
+    return 301 https://$host$request_uri;
+{{- else}}
+{{template "body" .}}
+{{- end}}
+}
+{{- if .SSL}}
+
+server {
+    listen 443 ssl http2;
+    listen [::]:443 ssl http2;
+    server_name {{.ServerNames}};
+
+    ssl_certificate {{.CertFile}};
+    ssl_certificate_key {{.KeyFile}};
+{{- if .Suspended}}
+{{template "suspended" .}}
+{{- else if .DomainRedirect}}
+
+    return {{.DomainRedirect.Code}} "{{.DomainRedirect.Target}}";
+{{- else}}
+{{template "body" .}}
+{{- end}}
+}
+{{- end}}
+`
+
+// Generator renders web server virtual host configuration for domains
+type Generator struct {
+	config config.HostingConfig
+	tmpl   *template.Template
+}
+
+// NewGenerator creates a new vhost generator
+func NewGenerator(config config.HostingConfig) *Generator {
+	return &Generator{
+		config: config,
+		tmpl:   template.Must(template.New("site").Parse(siteTemplate)),
+	}
+}
+
+// siteData holds the values substituted into the site template
+type siteData struct {
+	ServerNames  string
+	DocumentRoot string
+	PHPSocket    string
+	ForceHTTPS   bool
+	Suspended    bool
+	SSL          bool
+	CertFile     string
+	KeyFile      string
+	AccessLog    string
+	LogFormat    string
+	ErrorLog     string
+	// SuspendedRoot holds the page suspended sites answer with
+	SuspendedRoot string
+
+	// Redirects are exact-path redirects; DomainRedirect, when set, redirects every request
+	Redirects      []redirectRule
+	DomainRedirect *redirectRule
+	// ProtectedDirectories require basic authentication; they come before the PHP location so
+	// scripts below them are protected too
+	ProtectedDirectories []protectedRule
+}
+
+// redirectRule is a redirect as it appears in the site template
+type redirectRule struct {
+	Path   string
+	Code   int
+	Target string
+}
+
+// redirectRules splits a domain's redirects into path redirects and a whole-domain redirect
+func redirectRules(redirects []models.Redirect) (rules []redirectRule, domainRule *redirectRule) {
+	for _, redirect := range redirects {
+		rule := redirectRule{Path: redirect.SourcePath, Code: redirect.StatusCode, Target: redirect.TargetURL}
+		if redirect.PreserveQuery {
+			rule.Target += "$is_args$args"
+		}
+		if redirect.SourcePath == "/" {
+			domainRule = &rule
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules, domainRule
+}
+
+// ServesHTTPS reports whether a domain's vhost has an HTTPS server, which redirecting its visitors
+// to HTTPS needs; without one the redirect would make the site unreachable
+func ServesHTTPS(domain *models.Domain) bool {
+	return domain.HasSSL
+}
+
+// Render renders the virtual host configuration for a domain. The domain's Redirects and
+// ProtectedDirectories must be loaded, otherwise the rendered configuration drops them.
+func (g *Generator) Render(domain *models.Domain) (string, error) {
+	accessLog, errorLog := g.LogPaths(domain.Name)
+	redirects, domainRedirect := redirectRules(domain.Redirects)
+	return g.render(siteData{
+		ServerNames:  domain.Name + " www." + domain.Name,
+		DocumentRoot: domain.DocumentRoot,
+		PHPSocket:    g.DomainPHPSocket(domain),
+		SSL:          ServesHTTPS(domain),
+		ForceHTTPS:   domain.ForceHTTPS && ServesHTTPS(domain),
+		Suspended:    domain.SuspendedAt != nil,
+		CertFile:     filepath.Join(g.config.SSLDir, domain.Name, "fullchain.pem"),
+		KeyFile:      filepath.Join(g.config.SSLDir, domain.Name, "privkey.pem"),
+		AccessLog:    accessLog,
+		LogFormat:    g.config.AccessLogFormat,
+		ErrorLog:     errorLog,
+
+		SuspendedRoot: g.suspendedRoot(domain),
+
+		Redirects:      redirects,
+		DomainRedirect: domainRedirect,
+
+		ProtectedDirectories: g.protectedRules(domain),
+	})
+}
+
+// RenderSubdomain renders the virtual host configuration for a subdomain of a domain. A subdomain
+// on the domain's PHP version shares its handler; one on another version uses that version's
+// shared pool.
+func (g *Generator) RenderSubdomain(domain *models.Domain, subdomain *models.Subdomain) (string, error) {
+	phpSocket := g.DomainPHPSocket(domain)
+	if subdomain.PHPVersion != "" && subdomain.PHPVersion != domain.PHPVersion {
+		phpSocket = g.phpSocket(subdomain.PHPVersion)
+	}
+
+	serverName := subdomain.Name + "." + domain.Name
+	accessLog, errorLog := g.LogPaths(serverName)
+	return g.render(siteData{
+		ServerNames:  serverName,
+		DocumentRoot: subdomain.DocumentRoot,
+		PHPSocket:    phpSocket,
+		Suspended:    domain.SuspendedAt != nil,
+		AccessLog:    accessLog,
+		LogFormat:    g.config.AccessLogFormat,
+		ErrorLog:     errorLog,
+
+		SuspendedRoot: g.suspendedRoot(domain),
+	})
+}
+
+// LogPaths returns the access and error log paths used for a server name
+func (g *Generator) LogPaths(serverName string) (accessLog, errorLog string) {
+	dir := filepath.Join(g.config.LogDir, serverName)
+	return filepath.Join(dir, "access.log"), filepath.Join(dir, "error.log")
+}
+
+func (g *Generator) render(data siteData) (string, error) {
+	var buf bytes.Buffer
+	if err := g.tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render vhost for %s: %w", data.ServerNames, err)
+	}
+
+	return buf.String(), nil
+}
+
+// Write renders the virtual host configuration for a domain and writes it to the vhost directory,
+// along with the suspension page while the domain is suspended
+func (g *Generator) Write(domain *models.Domain) error {
+	if domain.SuspendedAt != nil {
+		if err := g.writeSuspendedPage(domain); err != nil {
+			return err
+		}
+	} else if err := g.removeSuspendedPage(domain); err != nil {
+		return err
+	}
+
+	content, err := g.Render(domain)
+	if err != nil {
+		return err
+	}
+
+	return g.write(domain.Name, content)
+}
+
+// WriteSubdomain renders the virtual host configuration for a subdomain and writes it to the vhost directory
+func (g *Generator) WriteSubdomain(domain *models.Domain, subdomain *models.Subdomain) error {
+	content, err := g.RenderSubdomain(domain, subdomain)
+	if err != nil {
+		return err
+	}
+
+	return g.write(subdomain.Name+"."+domain.Name, content)
+}
+
+// Remove deletes the configuration written for a domain under its current name: the vhosts of the
+// domain and its loaded subdomains, its PHP handler configuration and its suspension page
+func (g *Generator) Remove(domain *models.Domain) error {
+	paths := []string{
+		filepath.Join(g.config.VhostDir, domain.Name+".conf"),
+		g.poolPath(domain.PHPVersion, domain.Name),
+		filepath.Join(g.config.PHPCGIDir, domain.Name+".ini"),
+		filepath.Join(g.config.PHPCGIDir, domain.Name+".env"),
+	}
+	for _, subdomain := range domain.Subdomains {
+		paths = append(paths, filepath.Join(g.config.VhostDir, subdomain.Name+"."+domain.Name+".conf"))
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+	}
+
+	return g.removeSuspendedPage(domain)
+}
+
+// RemoveSubdomain deletes the vhost written for a subdomain of a domain under the given name
+func (g *Generator) RemoveSubdomain(domain *models.Domain, name string) error {
+	path := filepath.Join(g.config.VhostDir, name+"."+domain.Name+".conf")
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove %s: %w", path, err)
+	}
+	return nil
+}
+
+func (g *Generator) write(name, content string) error {
+	if err := os.MkdirAll(g.config.VhostDir, 0755); err != nil {
+		return fmt.Errorf("failed to create vhost directory: %w", err)
+	}
+
+	path := filepath.Join(g.config.VhostDir, name+".conf")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write vhost for %s: %w", name, err)
+	}
+
+	return nil
+}
+
+func (g *Generator) phpSocket(version string) string {
+	return filepath.Join(g.config.PHPFPMSocketDir, fmt.Sprintf("php%s-fpm.sock", version))
+}
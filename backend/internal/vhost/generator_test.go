@@ -0,0 +1,122 @@
+package vhost
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestRenderForceHTTPS(t *testing.T) {
+	g := NewGenerator(config.HostingConfig{SSLDir: "/etc/ssl/panel", PHPFPMSocketDir: "/run/php", LogDir: "/var/log/nginx/domains", AccessLogFormat: "combined"})
+
+	tests := []struct {
+		name         string
+		hasSSL       bool
+		forceHTTPS   bool
+		wantRedirect bool
+		wantHTTPS    bool
+	}{
+		{name: "plain", hasSSL: false, forceHTTPS: false},
+		{name: "forced without certificate", hasSSL: false, forceHTTPS: true},
+		{name: "certificate", hasSSL: true, forceHTTPS: false, wantHTTPS: true},
+		{name: "forced with certificate", hasSSL: true, forceHTTPS: true, wantRedirect: true, wantHTTPS: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			domain := &models.Domain{Name: "example.com", DocumentRoot: "/var/www/example.com/public_html", PHPVersion: "8.2", HasSSL: tt.hasSSL, ForceHTTPS: tt.forceHTTPS}
+			out, err := g.Render(domain)
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			if got := strings.Contains(out, "return 301 https://$host$request_uri;"); got != tt.wantRedirect {
+				t.Errorf("redirect = %v, want %v", got, tt.wantRedirect)
+			}
+			if got := strings.Contains(out, "listen 443 ssl"); got != tt.wantHTTPS {
+				t.Errorf("HTTPS server = %v, want %v", got, tt.wantHTTPS)
+			}
+			if got := tt.forceHTTPS && ServesHTTPS(domain); got != tt.wantRedirect {
+				t.Errorf("ServesHTTPS disagrees with the rendered redirect")
+			}
+		})
+	}
+}
+
+func TestRenderSubdomainPHPVersion(t *testing.T) {
+	g := NewGenerator(config.HostingConfig{PHPFPMSocketDir: "/run/php", LogDir: "/var/log/nginx/domains", AccessLogFormat: "combined"})
+	domain := &models.Domain{Name: "example.com", DocumentRoot: "/var/www/example.com/public_html", PHPVersion: "8.2"}
+
+	tests := []struct {
+		name       string
+		phpVersion string
+		wantSocket string
+	}{
+		{name: "inherited", phpVersion: "", wantSocket: g.DomainPHPSocket(domain)},
+		{name: "same as the domain", phpVersion: "8.2", wantSocket: g.DomainPHPSocket(domain)},
+		{name: "override", phpVersion: "8.3", wantSocket: "/run/php/php8.3-fpm.sock"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subdomain := &models.Subdomain{Name: "blog", DocumentRoot: "/var/www/example.com/blog", PHPVersion: tt.phpVersion}
+			out, err := g.RenderSubdomain(domain, subdomain)
+			if err != nil {
+				t.Fatalf("RenderSubdomain: %v", err)
+			}
+			if !strings.Contains(out, "server_name blog.example.com") || !strings.Contains(out, "root /var/www/example.com/blog") {
+				t.Errorf("subdomain vhost lacks its name or root:\n%s", out)
+			}
+			if !strings.Contains(out, tt.wantSocket) {
+				t.Errorf("subdomain vhost does not use %s:\n%s", tt.wantSocket, out)
+			}
+		})
+	}
+}
+
+func TestRenderLogsPerServerName(t *testing.T) {
+	g := NewGenerator(config.HostingConfig{PHPFPMSocketDir: "/run/php", LogDir: "/var/log/nginx/domains", AccessLogFormat: "combined"})
+	domain := &models.Domain{Name: "example.com", DocumentRoot: "/var/www/example.com/public_html", PHPVersion: "8.2"}
+
+	out, err := g.Render(domain)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if !strings.Contains(out, "access_log /var/log/nginx/domains/example.com/access.log") || !strings.Contains(out, "error_log /var/log/nginx/domains/example.com/error.log") {
+		t.Errorf("domain vhost lacks its own logs:\n%s", out)
+	}
+
+	out, err = g.RenderSubdomain(domain, &models.Subdomain{Name: "shop", DocumentRoot: "/var/www/example.com/shop"})
+	if err != nil {
+		t.Fatalf("RenderSubdomain: %v", err)
+	}
+	if !strings.Contains(out, "access_log /var/log/nginx/domains/shop.example.com/access.log") {
+		t.Errorf("subdomain vhost does not log separately:\n%s", out)
+	}
+}
+
+func TestRenderRedirects(t *testing.T) {
+	g := NewGenerator(config.HostingConfig{PHPFPMSocketDir: "/run/php", LogDir: "/var/log/nginx/domains", AccessLogFormat: "combined"})
+	domain := &models.Domain{Name: "example.com", DocumentRoot: "/var/www/example.com/public_html", PHPVersion: "8.2", Redirects: []models.Redirect{
+		{SourcePath: "/blog", TargetURL: "https://blog.example.net/", StatusCode: 302},
+	}}
+
+	out, err := g.Render(domain)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if !strings.Contains(out, "location = /blog {\n        return 302 \"https://blog.example.net/\";") {
+		t.Errorf("path redirect missing:\n%s", out)
+	}
+	if !strings.Contains(out, "try_files") {
+		t.Errorf("site no longer served next to a path redirect:\n%s", out)
+	}
+
+	domain.Redirects = append(domain.Redirects, models.Redirect{SourcePath: "/", TargetURL: "https://example.org", StatusCode: 301, PreserveQuery: true})
+	out, err = g.Render(domain)
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if !strings.Contains(out, `return 301 "https://example.org$is_args$args";`) {
+		t.Errorf("whole-domain redirect missing:\n%s", out)
+	}
+}
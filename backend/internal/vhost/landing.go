@@ -0,0 +1,178 @@
+package vhost
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// Landing pages new domains can start with
+const (
+	LandingPageDefault    = "default"
+	LandingPageComingSoon = "coming_soon"
+	LandingPageNone       = "none"
+)
+
+// landingPageFile is the name of the landing page in a document root
+const landingPageFile = "index.html"
+
+// landingMarker starts every generated landing page, so an index.html the owner uploaded is never
+// taken for one
+const landingMarker = "<!-- Generated by MyNodeCP: landing page -->\n"
+
+const defaultLandingTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Domain}}</title>
+<style>
+body { margin: 0; font-family: system-ui, sans-serif; color: #1f2933; background: #f5f7fa; }
+main { max-width: 40rem; margin: 20vh auto; padding: 0 1.5rem; }
+h1 { font-size: 2rem; margin-bottom: .5rem; }
+p { line-height: 1.5; color: #52606d; }
+</style>
+</head>
+<body>
+<main>
+<h1>{{.Domain}}</h1>
+<p>This website is hosted by {{.Brand}} and is ready for its content.</p>
+<p>If you own this domain, upload your site to replace this page.</p>
+</main>
+</body>
+</html>
+`
+
+const comingSoonLandingTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Domain}} - Coming soon</title>
+<style>
+body { margin: 0; font-family: system-ui, sans-serif; color: #fff; background: #243b53; }
+main { max-width: 40rem; margin: 25vh auto; padding: 0 1.5rem; text-align: center; }
+h1 { font-size: 2.5rem; margin-bottom: .5rem; }
+p { line-height: 1.5; color: #bcccdc; }
+</style>
+</head>
+<body>
+<main>
+<h1>Coming soon</h1>
+<p>{{.Domain}} is under construction. Please check back later.</p>
+</main>
+</body>
+</html>
+`
+
+var landingTemplates = template.Must(template.New(LandingPageDefault).Parse(defaultLandingTemplate))
+
+func init() {
+	template.Must(landingTemplates.New(LandingPageComingSoon).Parse(comingSoonLandingTemplate))
+}
+
+// landingData holds the values substituted into landing page templates
+type landingData struct {
+	Domain string
+	Brand  string
+}
+
+// RenderLandingPage renders the landing page configured for new domains: the operator's template
+// when one is set, otherwise the built-in page
+func (g *Generator) RenderLandingPage(domain *models.Domain) (string, error) {
+	tmpl := landingTemplates.Lookup(g.config.LandingPage)
+	if g.config.LandingPageTemplate != "" {
+		custom, err := template.ParseFiles(g.config.LandingPageTemplate)
+		if err != nil {
+			return "", fmt.Errorf("failed to load landing page template: %w", err)
+		}
+		tmpl = custom
+	}
+	if tmpl == nil {
+		return "", fmt.Errorf("unknown landing page %q", g.config.LandingPage)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(landingMarker)
+	if err := tmpl.Execute(&buf, landingData{Domain: domain.Name, Brand: g.config.LandingPageBrand}); err != nil {
+		return "", fmt.Errorf("failed to render landing page for %s: %w", domain.Name, err)
+	}
+	return buf.String(), nil
+}
+
+// WriteLandingPage creates a domain's document root and puts the landing page in it, owned by the
+// owner of the web files. It reports false without writing anything when landing pages are off or
+// the document root already has an index page.
+func (g *Generator) WriteLandingPage(domain *models.Domain) (bool, error) {
+	if g.config.LandingPage == LandingPageNone {
+		return false, nil
+	}
+
+	for _, index := range []string{"index.php", "index.html", "index.htm"} {
+		if _, err := os.Lstat(filepath.Join(domain.DocumentRoot, index)); err == nil {
+			return false, nil
+		}
+	}
+
+	content, err := g.RenderLandingPage(domain)
+	if err != nil {
+		return false, err
+	}
+
+	if err := os.MkdirAll(domain.DocumentRoot, 0755); err != nil {
+		return false, fmt.Errorf("failed to create %s: %w", domain.DocumentRoot, err)
+	}
+	if err := os.Chown(domain.DocumentRoot, g.config.FTPUID, g.config.FTPGID); err != nil {
+		return false, fmt.Errorf("failed to set owner of %s: %w", domain.DocumentRoot, err)
+	}
+
+	path := filepath.Join(domain.DocumentRoot, landingPageFile)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return false, fmt.Errorf("failed to write landing page for %s: %w", domain.Name, err)
+	}
+	if err := os.Chown(path, g.config.FTPUID, g.config.FTPGID); err != nil {
+		os.Remove(path)
+		return false, fmt.Errorf("failed to set owner of landing page for %s: %w", domain.Name, err)
+	}
+
+	return true, nil
+}
+
+// RemoveLandingPage deletes a domain's landing page once anything else is in its document root;
+// hidden entries such as .well-known do not count as content. It reports true when the document
+// root no longer holds the generated page, including when the owner replaced or deleted it.
+func (g *Generator) RemoveLandingPage(domain *models.Domain) (bool, error) {
+	path := filepath.Join(domain.DocumentRoot, landingPageFile)
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read landing page of %s: %w", domain.Name, err)
+	}
+	if !strings.HasPrefix(string(content), landingMarker) {
+		return true, nil
+	}
+
+	entries, err := os.ReadDir(domain.DocumentRoot)
+	if err != nil {
+		return false, fmt.Errorf("failed to list %s: %w", domain.DocumentRoot, err)
+	}
+	for _, entry := range entries {
+		if entry.Name() == landingPageFile || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return false, fmt.Errorf("failed to remove landing page of %s: %w", domain.Name, err)
+		}
+		return true, nil
+	}
+
+	return false, nil
+}
@@ -0,0 +1,138 @@
+package vhost
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// landingGenerator returns a generator writing landing pages as the user running the test
+func landingGenerator(page, template string) *Generator {
+	return NewGenerator(config.HostingConfig{
+		LandingPage:         page,
+		LandingPageTemplate: template,
+		LandingPageBrand:    "Acme <Hosting>",
+		FTPUID:              os.Getuid(),
+		FTPGID:              os.Getgid(),
+	})
+}
+
+func TestRenderLandingPage(t *testing.T) {
+	custom := filepath.Join(t.TempDir(), "landing.html")
+	if err := os.WriteFile(custom, []byte("<p>Welcome to {{.Domain}} at {{.Brand}}</p>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	domain := &models.Domain{Name: "shop.example"}
+
+	tests := []struct {
+		name     string
+		page     string
+		template string
+		want     string
+		wantErr  bool
+	}{
+		{name: "default", page: LandingPageDefault, want: "hosted by Acme &lt;Hosting&gt;"},
+		{name: "coming soon", page: LandingPageComingSoon, want: "shop.example is under construction"},
+		{name: "operator template", page: LandingPageDefault, template: custom, want: "<p>Welcome to shop.example at Acme &lt;Hosting&gt;</p>"},
+		{name: "missing template", page: LandingPageDefault, template: custom + ".missing", wantErr: true},
+		{name: "unknown page", page: "splash", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, err := landingGenerator(tt.page, tt.template).RenderLandingPage(domain)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RenderLandingPage() error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !strings.HasPrefix(content, landingMarker) || !strings.Contains(content, tt.want) {
+				t.Errorf("page lacks the marker or %q:\n%s", tt.want, content)
+			}
+		})
+	}
+}
+
+func TestWriteLandingPage(t *testing.T) {
+	t.Run("new document root", func(t *testing.T) {
+		domain := &models.Domain{Name: "shop.example", DocumentRoot: filepath.Join(t.TempDir(), "public_html")}
+		written, err := landingGenerator(LandingPageDefault, "").WriteLandingPage(domain)
+		if err != nil || !written {
+			t.Fatalf("WriteLandingPage() = %v, %v", written, err)
+		}
+		content, err := os.ReadFile(filepath.Join(domain.DocumentRoot, "index.html"))
+		if err != nil || !strings.Contains(string(content), "shop.example") {
+			t.Errorf("landing page not written (%v):\n%s", err, content)
+		}
+	})
+
+	t.Run("landing pages off", func(t *testing.T) {
+		domain := &models.Domain{Name: "shop.example", DocumentRoot: filepath.Join(t.TempDir(), "public_html")}
+		if written, err := landingGenerator(LandingPageNone, "").WriteLandingPage(domain); err != nil || written {
+			t.Errorf("WriteLandingPage() = %v, %v", written, err)
+		}
+		if _, err := os.Stat(domain.DocumentRoot); !os.IsNotExist(err) {
+			t.Error("document root created with landing pages off")
+		}
+	})
+
+	t.Run("existing index page", func(t *testing.T) {
+		domain := &models.Domain{Name: "shop.example", DocumentRoot: t.TempDir()}
+		index := filepath.Join(domain.DocumentRoot, "index.php")
+		os.WriteFile(index, []byte("<?php echo 'site';"), 0644)
+		if written, err := landingGenerator(LandingPageDefault, "").WriteLandingPage(domain); err != nil || written {
+			t.Errorf("WriteLandingPage() = %v, %v", written, err)
+		}
+		if _, err := os.Stat(filepath.Join(domain.DocumentRoot, "index.html")); !os.IsNotExist(err) {
+			t.Error("landing page written next to the site's index")
+		}
+	})
+}
+
+func TestRemoveLandingPage(t *testing.T) {
+	g := landingGenerator(LandingPageDefault, "")
+
+	tests := []struct {
+		name        string
+		files       map[string]string // Added after the landing page; "index.html" replaces it
+		wantRemoved bool
+		wantPage    bool // The generated page is still there
+	}{
+		{name: "still empty", wantPage: true},
+		{name: "only hidden files", files: map[string]string{".well-known": ""}, wantPage: true},
+		{name: "site uploaded", files: map[string]string{"about.html": "about"}, wantRemoved: true},
+		{name: "page replaced by the owner", files: map[string]string{"index.html": "my site"}, wantRemoved: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			domain := &models.Domain{Name: "shop.example", DocumentRoot: t.TempDir()}
+			if _, err := g.WriteLandingPage(domain); err != nil {
+				t.Fatalf("WriteLandingPage() error = %v", err)
+			}
+			for name, content := range tt.files {
+				os.WriteFile(filepath.Join(domain.DocumentRoot, name), []byte(content), 0644)
+			}
+
+			removed, err := g.RemoveLandingPage(domain)
+			if err != nil || removed != tt.wantRemoved {
+				t.Fatalf("RemoveLandingPage() = %v, %v; want %v", removed, err, tt.wantRemoved)
+			}
+			content, err := os.ReadFile(filepath.Join(domain.DocumentRoot, "index.html"))
+			if page := err == nil && strings.HasPrefix(string(content), landingMarker); page != tt.wantPage {
+				t.Errorf("generated page present = %v, want %v", page, tt.wantPage)
+			}
+			if replaced, ok := tt.files["index.html"]; ok && string(content) != replaced {
+				t.Errorf("owner's index.html = %q, want it untouched", content)
+			}
+		})
+	}
+
+	domain := &models.Domain{Name: "gone.example", DocumentRoot: filepath.Join(t.TempDir(), "missing")}
+	if removed, err := g.RemoveLandingPage(domain); err != nil || !removed {
+		t.Errorf("RemoveLandingPage() of a deleted page = %v, %v", removed, err)
+	}
+}
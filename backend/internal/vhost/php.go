@@ -0,0 +1,221 @@
+package vhost
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// PHP handlers a domain can run its scripts with
+const (
+	PHPHandlerFPM = "fpm" // PHP-FPM pool
+	PHPHandlerCGI = "cgi" // php-cgi in FastCGI mode, one process group per domain
+)
+
+// poolTemplate is a domain's own PHP-FPM pool, used when it loads extensions or sets error
+// handling of its own
+const poolTemplate = `; Generated by MyNodeCP for {{.Name}}; changes are overwritten
+[{{.Name}}]
+user = {{.UID}}
+group = {{.GID}}
+listen = {{.Socket}}
+listen.owner = {{.UID}}
+listen.group = {{.GID}}
+listen.mode = 0660
+pm = ondemand
+pm.max_children = 5
+pm.process_idle_timeout = 10s
+{{- range .Extensions}}
+php_admin_value[extension] = {{.}}
+{{- end}}
+{{- if .DisplayErrors}}
+php_flag[display_errors] = on
+{{- end}}
+{{- if .LogErrors}}
+php_admin_flag[log_errors] = on
+php_admin_value[error_log] = {{.ErrorLog}}
+{{- end}}
+`
+
+// cgiTemplate is the php.ini of a domain's php-cgi processes
+const cgiTemplate = `; Generated by MyNodeCP for {{.Name}}; changes are overwritten
+{{- range .Extensions}}
+extension={{.}}
+{{- end}}
+{{- if .DisplayErrors}}
+display_errors=On
+{{- end}}
+{{- if .LogErrors}}
+log_errors=On
+error_log="{{.ErrorLog}}"
+{{- end}}
+`
+
+// cgiEnvTemplate tells the service running a domain's php-cgi processes which binary and socket to use
+const cgiEnvTemplate = `PHP_VERSION={{.Version}}
+PHP_SOCKET={{.Socket}}
+`
+
+var phpTemplates = template.Must(template.New("pool").Parse(poolTemplate))
+
+func init() {
+	template.Must(phpTemplates.New("cgi").Parse(cgiTemplate))
+	template.Must(phpTemplates.New("cgi-env").Parse(cgiEnvTemplate))
+}
+
+// phpData holds the values substituted into the PHP handler templates
+type phpData struct {
+	Name       string
+	Version    string
+	Socket     string
+	UID        int
+	GID        int
+	Extensions []string
+
+	DisplayErrors bool
+	LogErrors     bool
+	ErrorLog      string
+}
+
+// phpHandler returns a domain's handler, defaulting to FPM
+func phpHandler(domain *models.Domain) string {
+	if domain.PHPHandler == "" {
+		return PHPHandlerFPM
+	}
+	return domain.PHPHandler
+}
+
+// ownPHPPool reports whether a domain's PHP settings need an FPM pool of its own rather than the
+// shared pool of its version
+func ownPHPPool(domain *models.Domain) bool {
+	return len(domain.PHPExtensions) > 0 || domain.PHPDisplayErrors || domain.PHPLogErrors
+}
+
+// DomainPHPSocket returns the socket a domain's PHP requests go to: the shared pool of its PHP
+// version, unless it has a pool of its own or runs php-cgi
+func (g *Generator) DomainPHPSocket(domain *models.Domain) string {
+	switch {
+	case phpHandler(domain) == PHPHandlerCGI:
+		return filepath.Join(g.config.PHPFPMSocketDir, fmt.Sprintf("php%s-cgi-%s.sock", domain.PHPVersion, domain.Name))
+	case ownPHPPool(domain):
+		return filepath.Join(g.config.PHPFPMSocketDir, fmt.Sprintf("php%s-fpm-%s.sock", domain.PHPVersion, domain.Name))
+	}
+	return g.phpSocket(domain.PHPVersion)
+}
+
+// poolPath returns where a domain's FPM pool for a PHP version is written
+func (g *Generator) poolPath(version, name string) string {
+	return filepath.Join(strings.ReplaceAll(g.config.PHPPoolDir, "{version}", version), name+".conf")
+}
+
+// RenderPHP renders the PHP handler configuration of a domain, by path. It is empty for domains
+// served by the shared FPM pool of their version.
+func (g *Generator) RenderPHP(domain *models.Domain) (map[string]string, error) {
+	data := phpData{
+		Name:       domain.Name,
+		Version:    domain.PHPVersion,
+		Socket:     g.DomainPHPSocket(domain),
+		UID:        g.config.FTPUID,
+		GID:        g.config.FTPGID,
+		Extensions: domain.PHPExtensions,
+
+		DisplayErrors: domain.PHPDisplayErrors,
+		LogErrors:     domain.PHPLogErrors,
+		ErrorLog:      domain.PHPErrorLog,
+	}
+
+	files := make(map[string]string)
+	switch {
+	case phpHandler(domain) == PHPHandlerCGI:
+		for path, name := range map[string]string{
+			filepath.Join(g.config.PHPCGIDir, domain.Name+".ini"): "cgi",
+			filepath.Join(g.config.PHPCGIDir, domain.Name+".env"): "cgi-env",
+		} {
+			content, err := renderPHP(name, data)
+			if err != nil {
+				return nil, err
+			}
+			files[path] = content
+		}
+	case ownPHPPool(domain):
+		content, err := renderPHP("pool", data)
+		if err != nil {
+			return nil, err
+		}
+		files[g.poolPath(domain.PHPVersion, domain.Name)] = content
+	}
+
+	return files, nil
+}
+
+func renderPHP(name string, data phpData) (string, error) {
+	var buf bytes.Buffer
+	if err := phpTemplates.ExecuteTemplate(&buf, name, data); err != nil {
+		return "", fmt.Errorf("failed to render PHP configuration for %s: %w", data.Name, err)
+	}
+	return buf.String(), nil
+}
+
+// WritePHP writes the PHP handler configuration of a domain and removes the files it no longer
+// uses, including the pool of previousVersion when the domain moved to another PHP version
+func (g *Generator) WritePHP(domain *models.Domain, previousVersion string) error {
+	files, err := g.RenderPHP(domain)
+	if err != nil {
+		return err
+	}
+
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create PHP configuration directory: %w", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return fmt.Errorf("failed to write PHP configuration for %s: %w", domain.Name, err)
+		}
+	}
+
+	stale := []string{
+		g.poolPath(domain.PHPVersion, domain.Name),
+		filepath.Join(g.config.PHPCGIDir, domain.Name+".ini"),
+		filepath.Join(g.config.PHPCGIDir, domain.Name+".env"),
+	}
+	if previousVersion != "" && previousVersion != domain.PHPVersion {
+		stale = append(stale, g.poolPath(previousVersion, domain.Name))
+	}
+	for _, path := range stale {
+		if _, ok := files[path]; ok {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove PHP configuration %s: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// InstalledPHPExtensions lists the extensions installed for a PHP version: the names of the .ini
+// files in the extension directory, with "{version}" in dir replaced. It fails when the version
+// is not installed.
+func InstalledPHPExtensions(dir, version string) ([]string, error) {
+	entries, err := os.ReadDir(strings.ReplaceAll(dir, "{version}", version))
+	if err != nil {
+		return nil, err
+	}
+
+	var extensions []string
+	for _, entry := range entries {
+		if name, ok := strings.CutSuffix(entry.Name(), ".ini"); ok && !entry.IsDir() {
+			extensions = append(extensions, name)
+		}
+	}
+	sort.Strings(extensions)
+
+	return extensions, nil
+}
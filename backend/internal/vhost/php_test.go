@@ -0,0 +1,185 @@
+package vhost
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestRenderPHP(t *testing.T) {
+	g := NewGenerator(config.HostingConfig{PHPFPMSocketDir: "/run/php", PHPPoolDir: "/etc/php/{version}/fpm/pool.d", PHPCGIDir: "/etc/php-cgi", FTPUID: 2000, FTPGID: 2000})
+
+	tests := []struct {
+		name       string
+		domain     models.Domain
+		wantSocket string
+		wantFiles  map[string][]string // Lines each rendered file must contain
+	}{
+		{
+			name:       "shared pool",
+			domain:     models.Domain{Name: "a.example", PHPVersion: "8.2", PHPHandler: PHPHandlerFPM},
+			wantSocket: "/run/php/php8.2-fpm.sock",
+			wantFiles:  map[string][]string{},
+		},
+		{
+			name:       "handler left empty",
+			domain:     models.Domain{Name: "a.example", PHPVersion: "8.2"},
+			wantSocket: "/run/php/php8.2-fpm.sock",
+			wantFiles:  map[string][]string{},
+		},
+		{
+			name:       "own pool for extensions",
+			domain:     models.Domain{Name: "a.example", PHPVersion: "8.3", PHPHandler: PHPHandlerFPM, PHPExtensions: []string{"intl", "redis"}},
+			wantSocket: "/run/php/php8.3-fpm-a.example.sock",
+			wantFiles: map[string][]string{
+				"/etc/php/8.3/fpm/pool.d/a.example.conf": {
+					"[a.example]",
+					"listen = /run/php/php8.3-fpm-a.example.sock",
+					"user = 2000",
+					"php_admin_value[extension] = intl",
+					"php_admin_value[extension] = redis",
+				},
+			},
+		},
+		{
+			name:       "own pool for error handling",
+			domain:     models.Domain{Name: "a.example", PHPVersion: "8.2", PHPHandler: PHPHandlerFPM, PHPDisplayErrors: true, PHPLogErrors: true, PHPErrorLog: "/var/www/a.example/logs/php_error.log"},
+			wantSocket: "/run/php/php8.2-fpm-a.example.sock",
+			wantFiles: map[string][]string{
+				"/etc/php/8.2/fpm/pool.d/a.example.conf": {
+					"php_flag[display_errors] = on",
+					"php_admin_flag[log_errors] = on",
+					"php_admin_value[error_log] = /var/www/a.example/logs/php_error.log",
+				},
+			},
+		},
+		{
+			name:       "php-cgi with an error log",
+			domain:     models.Domain{Name: "a.example", PHPVersion: "8.2", PHPHandler: PHPHandlerCGI, PHPLogErrors: true, PHPErrorLog: "/var/www/a.example/logs/php.log"},
+			wantSocket: "/run/php/php8.2-cgi-a.example.sock",
+			wantFiles: map[string][]string{
+				"/etc/php-cgi/a.example.ini": {"log_errors=On", `error_log="/var/www/a.example/logs/php.log"`},
+				"/etc/php-cgi/a.example.env": {"PHP_VERSION=8.2"},
+			},
+		},
+		{
+			name:       "php-cgi",
+			domain:     models.Domain{Name: "a.example", PHPVersion: "8.1", PHPHandler: PHPHandlerCGI, PHPExtensions: []string{"gd"}},
+			wantSocket: "/run/php/php8.1-cgi-a.example.sock",
+			wantFiles: map[string][]string{
+				"/etc/php-cgi/a.example.ini": {"extension=gd"},
+				"/etc/php-cgi/a.example.env": {"PHP_VERSION=8.1", "PHP_SOCKET=/run/php/php8.1-cgi-a.example.sock"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := g.DomainPHPSocket(&tt.domain); got != tt.wantSocket {
+				t.Errorf("DomainPHPSocket() = %s, want %s", got, tt.wantSocket)
+			}
+
+			files, err := g.RenderPHP(&tt.domain)
+			if err != nil {
+				t.Fatalf("RenderPHP() error = %v", err)
+			}
+			if len(files) != len(tt.wantFiles) {
+				t.Errorf("rendered %d files, want %d: %v", len(files), len(tt.wantFiles), files)
+			}
+			for path, lines := range tt.wantFiles {
+				content, ok := files[path]
+				if !ok {
+					t.Errorf("%s not rendered", path)
+					continue
+				}
+				for _, line := range lines {
+					if !strings.Contains(content, line+"\n") {
+						t.Errorf("%s lacks %q:\n%s", path, line, content)
+					}
+				}
+			}
+
+			vhost, err := g.Render(&tt.domain)
+			if err != nil {
+				t.Fatalf("Render() error = %v", err)
+			}
+			if !strings.Contains(vhost, tt.wantSocket) {
+				t.Errorf("vhost does not pass PHP to %s", tt.wantSocket)
+			}
+		})
+	}
+}
+
+func TestWritePHPRemovesStaleFiles(t *testing.T) {
+	dir := t.TempDir()
+	g := NewGenerator(config.HostingConfig{PHPFPMSocketDir: dir + "/run", PHPPoolDir: dir + "/{version}/pool.d", PHPCGIDir: dir + "/cgi"})
+	domain := &models.Domain{Name: "a.example", PHPVersion: "8.2", PHPHandler: PHPHandlerFPM, PHPExtensions: []string{"intl"}}
+	exists := func(path string) bool {
+		_, err := os.Stat(filepath.Join(dir, path))
+		return err == nil
+	}
+
+	if err := g.WritePHP(domain, ""); err != nil {
+		t.Fatalf("WritePHP() error = %v", err)
+	}
+	if !exists("8.2/pool.d/a.example.conf") {
+		t.Fatal("pool not written")
+	}
+
+	// Moving to another version drops the pool of the old one
+	domain.PHPVersion = "8.3"
+	if err := g.WritePHP(domain, "8.2"); err != nil {
+		t.Fatalf("WritePHP() error = %v", err)
+	}
+	if exists("8.2/pool.d/a.example.conf") || !exists("8.3/pool.d/a.example.conf") {
+		t.Error("pool not moved to PHP 8.3")
+	}
+
+	// Switching to php-cgi drops the pool
+	domain.PHPHandler = PHPHandlerCGI
+	if err := g.WritePHP(domain, "8.3"); err != nil {
+		t.Fatalf("WritePHP() error = %v", err)
+	}
+	if exists("8.3/pool.d/a.example.conf") || !exists("cgi/a.example.ini") || !exists("cgi/a.example.env") {
+		t.Error("pool not replaced with php-cgi files")
+	}
+
+	// Back on the shared pool, nothing of the domain is left
+	domain.PHPHandler = PHPHandlerFPM
+	domain.PHPExtensions = nil
+	if err := g.WritePHP(domain, "8.3"); err != nil {
+		t.Fatalf("WritePHP() error = %v", err)
+	}
+	if exists("cgi/a.example.ini") || exists("cgi/a.example.env") || exists("8.3/pool.d/a.example.conf") {
+		t.Error("files of the domain left behind on the shared pool")
+	}
+}
+
+func TestInstalledPHPExtensions(t *testing.T) {
+	dir := t.TempDir()
+	mods := filepath.Join(dir, "8.2", "mods-available")
+	if err := os.MkdirAll(filepath.Join(mods, "conf.ini"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"redis.ini", "intl.ini", "README"} {
+		if err := os.WriteFile(filepath.Join(mods, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := InstalledPHPExtensions(filepath.Join(dir, "{version}", "mods-available"), "8.2")
+	if err != nil {
+		t.Fatalf("InstalledPHPExtensions() error = %v", err)
+	}
+	if want := []string{"intl", "redis"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("InstalledPHPExtensions() = %v, want %v", got, want)
+	}
+
+	if _, err := InstalledPHPExtensions(filepath.Join(dir, "{version}", "mods-available"), "5.6"); err == nil {
+		t.Error("missing PHP version listed")
+	}
+}
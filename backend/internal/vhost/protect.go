@@ -0,0 +1,104 @@
+package vhost
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// htpasswdHeader marks password files as generated so manual edits are not expected to survive
+const htpasswdHeader = "# Managed by MyNodeCP. Changes made here are overwritten.\n"
+
+// protectedRule is a protected directory as it appears in the site template
+type protectedRule struct {
+	Pattern  string // Location regex matching the path and everything below it
+	Realm    string
+	UserFile string
+}
+
+// protectedRules returns the protected directories of a domain, deepest paths first so each
+// request is checked against the directory closest to it
+func (g *Generator) protectedRules(domain *models.Domain) []protectedRule {
+	directories := append([]models.ProtectedDirectory{}, domain.ProtectedDirectories...)
+	sort.SliceStable(directories, func(i, j int) bool {
+		return len(directories[i].Path) > len(directories[j].Path)
+	})
+
+	rules := make([]protectedRule, 0, len(directories))
+	for _, directory := range directories {
+		rules = append(rules, protectedRule{
+			Pattern:  protectedPattern(directory.Path),
+			Realm:    directory.Realm,
+			UserFile: g.HtpasswdPath(domain, &directory),
+		})
+	}
+	return rules
+}
+
+// protectedPattern returns a location regex matching path and everything below it, but not
+// siblings sharing its prefix: /admin matches /admin and /admin/x, not /administrator
+func protectedPattern(path string) string {
+	if path == "/" {
+		return "^/"
+	}
+	return "^" + regexp.QuoteMeta(path) + "(/|$)"
+}
+
+// HtpasswdDir returns the directory holding the password files of a domain's protected directories
+func (g *Generator) HtpasswdDir(domainName string) string {
+	return filepath.Join(g.config.HtpasswdDir, domainName)
+}
+
+// HtpasswdPath returns the password file of a protected directory
+func (g *Generator) HtpasswdPath(domain *models.Domain, directory *models.ProtectedDirectory) string {
+	return filepath.Join(g.HtpasswdDir(domain.Name), directory.ID.String())
+}
+
+// RenderHtpasswd renders the password file of a protected directory: one username:hash line per
+// user, sorted by username
+func RenderHtpasswd(users []models.DirectoryUser) string {
+	sorted := append([]models.DirectoryUser{}, users...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Username < sorted[j].Username })
+
+	var b strings.Builder
+	b.WriteString(htpasswdHeader)
+	for _, user := range sorted {
+		fmt.Fprintf(&b, "%s:%s\n", user.Username, user.PasswordHash)
+	}
+	return b.String()
+}
+
+// WriteHtpasswd writes the password file of a protected directory. The directory's Users must be
+// loaded.
+func (g *Generator) WriteHtpasswd(domain *models.Domain, directory *models.ProtectedDirectory) error {
+	path := g.HtpasswdPath(domain, directory)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create htpasswd directory: %w", err)
+	}
+
+	// Written next to the file and renamed, so nginx never reads a partial file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(RenderHtpasswd(directory.Users)), 0644); err != nil {
+		return fmt.Errorf("failed to write htpasswd for %s%s: %w", domain.Name, directory.Path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write htpasswd for %s%s: %w", domain.Name, directory.Path, err)
+	}
+
+	return nil
+}
+
+// RemoveHtpasswd deletes the password file of a protected directory
+func (g *Generator) RemoveHtpasswd(domain *models.Domain, directory *models.ProtectedDirectory) error {
+	if err := os.Remove(g.HtpasswdPath(domain, directory)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove htpasswd for %s%s: %w", domain.Name, directory.Path, err)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package vhost
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestProtectedPattern(t *testing.T) {
+	tests := []struct {
+		path    string
+		matches []string
+		misses  []string
+	}{
+		{"/", []string{"/", "/admin", "/index.php"}, nil},
+		{"/admin", []string{"/admin", "/admin/", "/admin/x/index.php"}, []string{"/administrator", "/", "/x/admin"}},
+		{"/a.b", []string{"/a.b", "/a.b/c"}, []string{"/axb", "/a.bc"}},
+	}
+	for _, tt := range tests {
+		pattern := regexp.MustCompile(protectedPattern(tt.path))
+		for _, uri := range tt.matches {
+			if !pattern.MatchString(uri) {
+				t.Errorf("pattern of %s does not match %s", tt.path, uri)
+			}
+		}
+		for _, uri := range tt.misses {
+			if pattern.MatchString(uri) {
+				t.Errorf("pattern of %s matches %s", tt.path, uri)
+			}
+		}
+	}
+}
+
+func TestRenderHtpasswd(t *testing.T) {
+	got := RenderHtpasswd([]models.DirectoryUser{
+		{Username: "zoe", PasswordHash: "$2a$10$zzz"},
+		{Username: "adam", PasswordHash: "$2a$10$aaa"},
+	})
+	want := htpasswdHeader + "adam:$2a$10$aaa\nzoe:$2a$10$zzz\n"
+	if got != want {
+		t.Errorf("RenderHtpasswd() = %q, want %q", got, want)
+	}
+	if got := RenderHtpasswd(nil); got != htpasswdHeader {
+		t.Errorf("RenderHtpasswd(nil) = %q, want only the header", got)
+	}
+}
+
+func TestRenderProtectedDirectories(t *testing.T) {
+	g := NewGenerator(config.HostingConfig{PHPFPMSocketDir: "/run/php", LogDir: "/var/log/nginx/domains", HtpasswdDir: "/etc/nginx/htpasswd", AccessLogFormat: "combined"})
+	shallow := models.ProtectedDirectory{ID: uuid.New(), Path: "/admin", Realm: "Admins"}
+	deep := models.ProtectedDirectory{ID: uuid.New(), Path: "/admin/billing", Realm: "Billing"}
+	domain := &models.Domain{
+		Name:                 "example.com",
+		DocumentRoot:         "/var/www/example.com/public_html",
+		PHPVersion:           "8.2",
+		ProtectedDirectories: []models.ProtectedDirectory{shallow, deep},
+	}
+
+	out, err := g.Render(domain)
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	for _, line := range []string{
+		`auth_basic "Billing";`,
+		"auth_basic_user_file /etc/nginx/htpasswd/example.com/" + deep.ID.String() + ";",
+		`auth_basic "Admins";`,
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("vhost lacks %q:\n%s", line, out)
+		}
+	}
+
+	// nginx uses the first matching regex location, so the deeper directory must come first
+	billing, admin := strings.Index(out, `"Billing"`), strings.Index(out, `"Admins"`)
+	if billing > admin {
+		t.Error("/admin is checked before /admin/billing")
+	}
+	if php := strings.Index(out, "\n    location ~ \\.php$ {"); php < admin {
+		t.Error("protected directories come after the PHP location")
+	}
+}
@@ -0,0 +1,82 @@
+package vhost
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// suspendedPageFile is the name of the suspension page in a domain's suspension root
+const suspendedPageFile = "suspended.html"
+
+const suspendedPageTemplate = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{.Domain}} - Suspended</title>
+<style>
+body { margin: 0; font-family: system-ui, sans-serif; color: #1f2933; background: #f5f7fa; }
+main { max-width: 40rem; margin: 20vh auto; padding: 0 1.5rem; }
+h1 { font-size: 2rem; margin-bottom: .5rem; }
+p { line-height: 1.5; color: #52606d; }
+</style>
+</head>
+<body>
+<main>
+<h1>This website is temporarily unavailable</h1>
+<p>{{.Domain}} has been suspended by {{.Brand}}.</p>
+<p>If you own this domain, please contact {{.Brand}} to have it restored.</p>
+</main>
+</body>
+</html>
+`
+
+var suspendedPage = template.Must(template.New("suspended").Parse(suspendedPageTemplate))
+
+// suspendedRoot is the directory a suspended domain's vhosts serve the suspension page from
+func (g *Generator) suspendedRoot(domain *models.Domain) string {
+	return filepath.Join(g.config.SuspendedPageDir, domain.Name)
+}
+
+// RenderSuspendedPage renders the page a suspended domain answers every request with
+func (g *Generator) RenderSuspendedPage(domain *models.Domain) (string, error) {
+	var buf bytes.Buffer
+	if err := suspendedPage.Execute(&buf, landingData{Domain: domain.Name, Brand: g.config.LandingPageBrand}); err != nil {
+		return "", fmt.Errorf("failed to render suspension page for %s: %w", domain.Name, err)
+	}
+	return buf.String(), nil
+}
+
+// writeSuspendedPage puts a domain's suspension page into its suspension root. The page is
+// panel-owned and outside the document root, so the customer's files stay untouched.
+func (g *Generator) writeSuspendedPage(domain *models.Domain) error {
+	content, err := g.RenderSuspendedPage(domain)
+	if err != nil {
+		return err
+	}
+
+	dir := g.suspendedRoot(domain)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, suspendedPageFile), []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write suspension page for %s: %w", domain.Name, err)
+	}
+
+	return nil
+}
+
+// removeSuspendedPage deletes a domain's suspension root, if any
+func (g *Generator) removeSuspendedPage(domain *models.Domain) error {
+	if err := os.RemoveAll(g.suspendedRoot(domain)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove suspension page for %s: %w", domain.Name, err)
+	}
+	return nil
+}
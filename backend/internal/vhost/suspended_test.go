@@ -0,0 +1,105 @@
+package vhost
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mynodecp/mynodecp/backend/internal/config"
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestRenderSuspended(t *testing.T) {
+	g := NewGenerator(config.HostingConfig{SSLDir: "/etc/ssl/panel", PHPFPMSocketDir: "/run/php", LogDir: "/var/log/nginx/domains", AccessLogFormat: "combined", SuspendedPageDir: "/var/lib/panel/suspended"})
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		domain *models.Domain
+	}{
+		{"plain", &models.Domain{Name: "shop.example", DocumentRoot: "/var/www/shop.example/public_html", PHPVersion: "8.2", SuspendedAt: &now}},
+		{"HTTPS", &models.Domain{Name: "shop.example", DocumentRoot: "/var/www/shop.example/public_html", PHPVersion: "8.2", HasSSL: true, SuspendedAt: &now}},
+		{"redirected", &models.Domain{Name: "shop.example", DocumentRoot: "/var/www/shop.example/public_html", Redirects: []models.Redirect{{SourcePath: "/", TargetURL: "https://other.example/", StatusCode: 301}}, SuspendedAt: &now}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := g.Render(tt.domain)
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			servers := strings.Count(out, "server {")
+			for _, want := range []string{"root /var/lib/panel/suspended/shop.example;", "error_page 503 /suspended.html;", "return 503;"} {
+				if got := strings.Count(out, want); got != servers {
+					t.Errorf("%q in %d of %d servers:\n%s", want, got, servers, out)
+				}
+			}
+			for _, unwanted := range []string{"root /var/www/shop.example/public_html;", "fastcgi_pass", "other.example"} {
+				if strings.Contains(out, unwanted) {
+					t.Errorf("suspended vhost has %q:\n%s", unwanted, out)
+				}
+			}
+		})
+	}
+
+	// Subdomains are suspended with their domain
+	domain := tests[0].domain
+	out, err := g.RenderSubdomain(domain, &models.Subdomain{Name: "blog", DocumentRoot: "/var/www/shop.example/blog"})
+	if err != nil || !strings.Contains(out, "root /var/lib/panel/suspended/shop.example;") || strings.Contains(out, "/var/www/shop.example/blog") {
+		t.Errorf("suspended subdomain (%v):\n%s", err, out)
+	}
+
+	// Once resumed the site is served again
+	domain.SuspendedAt = nil
+	out, _ = g.Render(domain)
+	if strings.Contains(out, "return 503;") || !strings.Contains(out, "root /var/www/shop.example/public_html;") {
+		t.Errorf("resumed vhost:\n%s", out)
+	}
+}
+
+func TestWriteSuspendedPage(t *testing.T) {
+	dir := t.TempDir()
+	g := NewGenerator(config.HostingConfig{
+		VhostDir:         filepath.Join(dir, "vhosts"),
+		SuspendedPageDir: filepath.Join(dir, "suspended"),
+		PHPFPMSocketDir:  "/run/php",
+		LogDir:           "/var/log/nginx/domains",
+		AccessLogFormat:  "combined",
+		LandingPageBrand: "Acme <Hosting>",
+	})
+	os.MkdirAll(filepath.Join(dir, "vhosts"), 0755)
+	documentRoot := filepath.Join(dir, "public_html")
+	os.MkdirAll(documentRoot, 0755)
+	os.WriteFile(filepath.Join(documentRoot, "index.html"), []byte("my site"), 0644)
+	now := time.Now()
+	domain := &models.Domain{Name: "shop.example", DocumentRoot: documentRoot, SuspendedAt: &now}
+	page := filepath.Join(dir, "suspended", "shop.example", "suspended.html")
+
+	if err := g.Write(domain); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	content, err := os.ReadFile(page)
+	if err != nil {
+		t.Fatalf("suspension page not written: %v", err)
+	}
+	for _, want := range []string{"shop.example has been suspended by Acme &lt;Hosting&gt;", `<meta name="robots" content="noindex">`} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("suspension page lacks %q:\n%s", want, content)
+		}
+	}
+	if site, _ := os.ReadFile(filepath.Join(documentRoot, "index.html")); string(site) != "my site" {
+		t.Errorf("site's index = %q", site)
+	}
+
+	domain.SuspendedAt = nil
+	if err := g.Write(domain); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Dir(page)); !os.IsNotExist(err) {
+		t.Error("suspension page kept after resuming")
+	}
+	if site, _ := os.ReadFile(filepath.Join(documentRoot, "index.html")); string(site) != "my site" {
+		t.Errorf("site's index after resuming = %q", site)
+	}
+}
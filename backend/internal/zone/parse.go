@@ -0,0 +1,297 @@
+package zone
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// entry is one logical line of a zone file: parentheses joined, comments removed
+type entry struct {
+	line    int
+	tokens  []string
+	inherit bool // The line starts with whitespace, so it has no owner and reuses the previous one
+}
+
+// Parse reads a BIND zone file for origin and returns its records with names relative to the
+// origin ("@" for the apex) and host values without the trailing dot, as the panel stores them.
+// SOA records are skipped since the panel generates its own. The file must not name another
+// origin; $INCLUDE and classes other than IN are not supported.
+func Parse(origin, data string) ([]models.DNSRecord, error) {
+	origin = strings.ToLower(strings.TrimSuffix(origin, "."))
+
+	entries, err := split(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []models.DNSRecord
+	fileTTL, owner := defaultTTL, ""
+	for _, e := range entries {
+		tokens := e.tokens
+		switch strings.ToUpper(tokens[0]) {
+		case "$ORIGIN":
+			if len(tokens) != 2 || !strings.EqualFold(strings.TrimSuffix(tokens[1], "."), origin) {
+				return nil, fmt.Errorf("line %d: zone is not for %s", e.line, origin)
+			}
+			continue
+		case "$TTL":
+			if len(tokens) != 2 {
+				return nil, fmt.Errorf("line %d: $TTL needs a single value", e.line)
+			}
+			ttl, ok := parseTTL(tokens[1])
+			if !ok {
+				return nil, fmt.Errorf("line %d: invalid TTL %q", e.line, tokens[1])
+			}
+			fileTTL = ttl
+			continue
+		case "$INCLUDE", "$GENERATE":
+			return nil, fmt.Errorf("line %d: %s is not supported", e.line, tokens[0])
+		}
+
+		if e.inherit {
+			if owner == "" {
+				return nil, fmt.Errorf("line %d: record has no owner name", e.line)
+			}
+		} else {
+			name, err := relative(tokens[0], origin)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", e.line, err)
+			}
+			owner = name
+			tokens = tokens[1:]
+		}
+
+		// The TTL and class may come in either order, and both are optional
+		ttl := fileTTL
+	fields:
+		for len(tokens) > 0 {
+			value, isTTL := parseTTL(tokens[0])
+			switch class := strings.ToUpper(tokens[0]); {
+			case isTTL:
+				ttl = value
+			case class == "IN":
+			case class == "CH" || class == "HS":
+				return nil, fmt.Errorf("line %d: class %s is not supported", e.line, tokens[0])
+			default:
+				break fields
+			}
+			tokens = tokens[1:]
+		}
+		if len(tokens) < 2 {
+			return nil, fmt.Errorf("line %d: incomplete record", e.line)
+		}
+
+		recordType, rdata := strings.ToUpper(tokens[0]), tokens[1:]
+		if recordType == "SOA" {
+			continue
+		}
+
+		record := models.DNSRecord{Type: recordType, Name: owner, TTL: ttl, IsActive: true}
+		switch recordType {
+		case "A", "AAAA":
+			if len(rdata) != 1 {
+				return nil, fmt.Errorf("line %d: %s record needs a single address", e.line, recordType)
+			}
+			record.Value = rdata[0]
+		case "CNAME", "NS":
+			if len(rdata) != 1 {
+				return nil, fmt.Errorf("line %d: %s record needs a single host name", e.line, recordType)
+			}
+			record.Value = absolute(rdata[0], origin)
+		case "MX":
+			if len(rdata) != 2 {
+				return nil, fmt.Errorf("line %d: MX record needs a priority and a host name", e.line)
+			}
+			priority, err := strconv.Atoi(rdata[0])
+			if err != nil || priority < 0 || priority > 65535 {
+				return nil, fmt.Errorf("line %d: invalid MX priority %q", e.line, rdata[0])
+			}
+			record.Priority = &priority
+			record.Value = absolute(rdata[1], origin)
+		case "TXT":
+			var b strings.Builder
+			for _, token := range rdata {
+				b.WriteString(unquote(token))
+			}
+			record.Value = b.String()
+		default:
+			record.Value = strings.Join(rdata, " ")
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// split breaks a zone file into entries, joining parenthesized continuation lines and removing
+// comments. Quoted strings are kept as single tokens with their quotes.
+func split(data string) ([]entry, error) {
+	var (
+		entries []entry
+		current entry
+		token   strings.Builder
+		inQuote bool
+		escaped bool
+		depth   int
+		line    = 1
+		atStart = true
+	)
+
+	flushToken := func() {
+		if token.Len() > 0 {
+			current.tokens = append(current.tokens, token.String())
+			token.Reset()
+		}
+	}
+	flushEntry := func() {
+		flushToken()
+		if len(current.tokens) > 0 {
+			entries = append(entries, current)
+		}
+		current = entry{}
+	}
+
+	runes := []rune(data)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if atStart {
+			current.line = line
+			current.inherit = r == ' ' || r == '\t'
+			atStart = false
+		}
+
+		switch {
+		case inQuote:
+			token.WriteRune(r)
+			switch {
+			case escaped:
+				escaped = false
+			case r == '\\':
+				escaped = true
+			case r == '"':
+				inQuote = false
+			case r == '\n':
+				return nil, fmt.Errorf("line %d: unterminated quoted string", line)
+			}
+		case r == '"':
+			inQuote = true
+			token.WriteRune(r)
+		case r == ';':
+			for i+1 < len(runes) && runes[i+1] != '\n' {
+				i++
+			}
+		case r == '(':
+			flushToken()
+			depth++
+		case r == ')':
+			flushToken()
+			if depth == 0 {
+				return nil, fmt.Errorf("line %d: unbalanced parenthesis", line)
+			}
+			depth--
+		case r == '\n':
+			line++
+			if depth == 0 {
+				flushEntry()
+				atStart = true
+			} else {
+				flushToken()
+			}
+		case unicode.IsSpace(r):
+			flushToken()
+		default:
+			token.WriteRune(r)
+		}
+	}
+	if inQuote || depth > 0 {
+		return nil, fmt.Errorf("line %d: unexpected end of zone file", line)
+	}
+	flushEntry()
+
+	return entries, nil
+}
+
+// relative turns an owner name into a name relative to origin, rejecting names outside it
+func relative(name, origin string) (string, error) {
+	name = strings.ToLower(name)
+	if name == "@" {
+		return "@", nil
+	}
+	if !strings.HasSuffix(name, ".") {
+		return name, nil
+	}
+
+	name = strings.TrimSuffix(name, ".")
+	switch {
+	case name == origin:
+		return "@", nil
+	case strings.HasSuffix(name, "."+origin):
+		return strings.TrimSuffix(name, "."+origin), nil
+	}
+	return "", fmt.Errorf("%s is outside of %s", name, origin)
+}
+
+// absolute turns a host name in record data into a fully qualified name without the trailing dot
+func absolute(name, origin string) string {
+	switch {
+	case name == "@":
+		return origin
+	case strings.HasSuffix(name, "."):
+		return strings.TrimSuffix(name, ".")
+	}
+	return name + "." + origin
+}
+
+// unquote removes the quotes of a character string and resolves its escapes
+func unquote(token string) string {
+	if len(token) < 2 || !strings.HasPrefix(token, `"`) || !strings.HasSuffix(token, `"`) {
+		return token
+	}
+
+	var b strings.Builder
+	escaped := false
+	for _, r := range token[1 : len(token)-1] {
+		if !escaped && r == '\\' {
+			escaped = true
+			continue
+		}
+		escaped = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// parseTTL parses a TTL in seconds or with BIND units, such as 3600 or 1h30m
+func parseTTL(value string) (int, bool) {
+	if value == "" || value[0] < '0' || value[0] > '9' {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return seconds, seconds >= 0
+	}
+
+	units := map[byte]int{'s': 1, 'm': 60, 'h': 3600, 'd': 86400, 'w': 604800}
+	total, number := 0, 0
+	digits := false
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c >= '0' && c <= '9':
+			number = number*10 + int(c-'0')
+			digits = true
+		case digits && units[c|0x20] > 0:
+			total += number * units[c|0x20]
+			number, digits = 0, false
+		default:
+			return 0, false
+		}
+	}
+	if digits {
+		return 0, false
+	}
+	return total, true
+}
@@ -0,0 +1,121 @@
+package zone
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestParse(t *testing.T) {
+	data := `$ORIGIN shop.example.
+$TTL 1h
+; The SOA is the panel's and skipped
+@	IN	SOA	ns1.host.example. hostmaster.shop.example. (
+		2024010101 ; serial
+		7200 3600 1209600 300 )
+@		IN	NS	ns1.host.example.
+		IN	NS	ns2
+www	300	IN	A	192.0.2.10
+www	IN	300	AAAA	2001:db8::10
+mail.shop.example.	MX	10	mx
+blog	CNAME	@
+@	TXT	"v=spf1 mx -all"
+txt	1d	TXT	"part one; " "part \"two\""
+_sip._tcp	SRV	10 5 5060 sip.shop.example.
+`
+	priority := 10
+	want := []models.DNSRecord{
+		{Type: "NS", Name: "@", Value: "ns1.host.example", TTL: 3600, IsActive: true},
+		{Type: "NS", Name: "@", Value: "ns2.shop.example", TTL: 3600, IsActive: true},
+		{Type: "A", Name: "www", Value: "192.0.2.10", TTL: 300, IsActive: true},
+		{Type: "AAAA", Name: "www", Value: "2001:db8::10", TTL: 300, IsActive: true},
+		{Type: "MX", Name: "mail", Value: "mx.shop.example", Priority: &priority, TTL: 3600, IsActive: true},
+		{Type: "CNAME", Name: "blog", Value: "shop.example", TTL: 3600, IsActive: true},
+		{Type: "TXT", Name: "@", Value: "v=spf1 mx -all", TTL: 3600, IsActive: true},
+		{Type: "TXT", Name: "txt", Value: `part one; part "two"`, TTL: 86400, IsActive: true},
+		{Type: "SRV", Name: "_sip._tcp", Value: "10 5 5060 sip.shop.example.", TTL: 3600, IsActive: true},
+	}
+
+	got, err := Parse("Shop.Example.", data)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse() =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"other origin", "$ORIGIN other.example.\n", "line 1: zone is not for shop.example"},
+		{"bad TTL", "$TTL soon\n", `invalid TTL "soon"`},
+		{"include", "$INCLUDE other.zone\n", "$INCLUDE is not supported"},
+		{"no owner", "  IN A 192.0.2.1\n", "no owner name"},
+		{"outside the zone", "www.other.example. A 192.0.2.1\n", "outside of shop.example"},
+		{"class", "www CH A 192.0.2.1\n", "class CH is not supported"},
+		{"incomplete", "www 300 IN A\n", "incomplete record"},
+		{"two addresses", "www A 192.0.2.1 192.0.2.2\n", "needs a single address"},
+		{"MX priority", "@ MX high mx\n", `invalid MX priority "high"`},
+		{"unterminated quote", "@ TXT \"open\n", "unterminated quoted string"},
+		{"unbalanced parenthesis", "@ A 192.0.2.1 )\n", "unbalanced parenthesis"},
+		{"open parenthesis", "@ SOA ( 1 2\n", "unexpected end of zone file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse("shop.example", tt.data)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTTL(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+		ok    bool
+	}{
+		{"3600", 3600, true},
+		{"0", 0, true},
+		{"1h30m", 5400, true},
+		{"1W2D", 777600, true},
+		{"90s", 90, true},
+		{"", 0, false},
+		{"IN", 0, false},
+		{"1h30", 0, false},
+		{"1x", 0, false},
+		{"h1", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseTTL(tt.value)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseTTL(%q) = %d, %v, want %d, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRenderParseRoundTrip(t *testing.T) {
+	priority := 5
+	records := []models.DNSRecord{
+		{Type: "NS", Name: "@", Value: "ns1.host.example", TTL: 3600, IsActive: true},
+		{Type: "A", Name: "@", Value: "192.0.2.10", TTL: 600, IsActive: true},
+		{Type: "MX", Name: "@", Value: "mail.shop.example", Priority: &priority, TTL: 3600, IsActive: true},
+		{Type: "CNAME", Name: "www", Value: "shop.example", TTL: 3600, IsActive: true},
+		{Type: "TXT", Name: "@", Value: `say "hi" \o/`, TTL: 3600, IsActive: true},
+	}
+
+	got, err := Parse("shop.example", Render("shop.example", SOA{Serial: 1}, records))
+	if err != nil {
+		t.Fatalf("Parse(Render()) error = %v", err)
+	}
+	if !reflect.DeepEqual(got, records) {
+		t.Errorf("round trip =\n%+v\nwant\n%+v", got, records)
+	}
+}
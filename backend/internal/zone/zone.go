@@ -0,0 +1,135 @@
+package zone
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+// defaultTTL is used for the $TTL directive of zones rendered without one
+const defaultTTL = 3600
+
+// Default SOA timers, in seconds: refresh, retry, expire and negative caching TTL
+const (
+	soaRefresh = 7200
+	soaRetry   = 3600
+	soaExpire  = 1209600
+	soaMinimum = 300
+)
+
+// SOA holds the zone-wide values rendered into a zone's $TTL directive and SOA record. Zero
+// timers and TTL use the defaults.
+type SOA struct {
+	Serial  uint32
+	TTL     int // Default TTL of the zone's records
+	Refresh int
+	Retry   int
+	Expire  int
+	Minimum int // Negative caching TTL
+}
+
+// Render renders the active records of a domain as a BIND zone file. The SOA takes its primary
+// nameserver and contact from the zone's SOA record, whose value is "<primary> <contact>", and
+// without one names the first apex NS record as primary. A zone with neither has no SOA.
+func Render(origin string, soa SOA, records []models.DNSRecord) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "$ORIGIN %s.\n", origin)
+	fmt.Fprintf(&b, "$TTL %d\n", orDefault(soa.TTL, defaultTTL))
+
+	if primary, contact := soaNames(origin, records); primary != "" {
+		fmt.Fprintf(&b, "@\t%d\tIN\tSOA\t%s %s %d %d %d %d %d\n",
+			orDefault(soa.TTL, defaultTTL), qualify(primary), qualify(contact), soa.Serial,
+			orDefault(soa.Refresh, soaRefresh), orDefault(soa.Retry, soaRetry),
+			orDefault(soa.Expire, soaExpire), orDefault(soa.Minimum, soaMinimum))
+	}
+
+	for _, record := range records {
+		if !record.IsActive || record.Type == "SOA" {
+			continue
+		}
+		fmt.Fprintf(&b, "%s\t%d\tIN\t%s\t%s\n", record.Name, record.TTL, record.Type, rdata(record))
+	}
+
+	return b.String()
+}
+
+// Contact turns a contact mailbox into the SOA form: hostmaster@example.com becomes
+// hostmaster.example.com, with dots in the local part escaped
+func Contact(mailbox string) string {
+	local, domain, ok := strings.Cut(mailbox, "@")
+	if !ok {
+		return mailbox
+	}
+	return strings.ReplaceAll(local, ".", "\\.") + "." + domain
+}
+
+// soaNames returns the primary nameserver and contact of a zone's SOA
+func soaNames(origin string, records []models.DNSRecord) (primary, contact string) {
+	for _, record := range records {
+		name := strings.TrimSuffix(record.Name, ".")
+		if record.IsActive && record.Type == "SOA" && (name == "@" || strings.EqualFold(name, origin)) {
+			if fields := strings.Fields(record.Value); len(fields) == 2 {
+				return fields[0], fields[1]
+			}
+		}
+	}
+	if primary := primaryNameserver(origin, records); primary != "" {
+		return primary, "hostmaster." + origin
+	}
+	return "", ""
+}
+
+func orDefault(value, fallback int) int {
+	if value > 0 {
+		return value
+	}
+	return fallback
+}
+
+// primaryNameserver returns the first active NS record at the apex of the zone, if any
+func primaryNameserver(origin string, records []models.DNSRecord) string {
+	for _, record := range records {
+		name := strings.TrimSuffix(record.Name, ".")
+		if record.IsActive && record.Type == "NS" && (name == "@" || strings.EqualFold(name, origin)) {
+			return record.Value
+		}
+	}
+	return ""
+}
+
+// rdata formats the data portion of a record
+func rdata(record models.DNSRecord) string {
+	switch record.Type {
+	case "CNAME", "NS":
+		return qualify(record.Value)
+	case "MX":
+		priority := 0
+		if record.Priority != nil {
+			priority = *record.Priority
+		}
+		return fmt.Sprintf("%d %s", priority, qualify(record.Value))
+	case "TXT":
+		return quote(record.Value)
+	default:
+		return record.Value
+	}
+}
+
+// qualify turns a hostname into a fully qualified name
+func qualify(name string) string {
+	if name == "@" || strings.HasSuffix(name, ".") || !strings.Contains(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// quote wraps TXT data in quotes, escaping embedded quotes and backslashes
+func quote(value string) string {
+	if strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) && len(value) > 1 {
+		return value
+	}
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + replacer.Replace(value) + `"`
+}
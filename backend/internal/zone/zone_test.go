@@ -0,0 +1,103 @@
+package zone
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mynodecp/mynodecp/backend/internal/models"
+)
+
+func TestRenderSOA(t *testing.T) {
+	priority := 10
+	apexNS := []models.DNSRecord{
+		{Type: "NS", Name: "@", Value: "ns1.host.example", TTL: 3600, IsActive: true},
+		{Type: "NS", Name: "@", Value: "ns2.host.example", TTL: 3600, IsActive: true},
+	}
+
+	tests := []struct {
+		name    string
+		records []models.DNSRecord
+		wantSOA string // "" when the zone must have no SOA
+	}{
+		{"first apex nameserver is primary", apexNS, "@\t3600\tIN\tSOA\tns1.host.example. hostmaster.shop.example. 2024010101 7200 3600 1209600 300"},
+		{"apex named by origin", []models.DNSRecord{{Type: "NS", Name: "shop.example.", Value: "ns9.host.example", TTL: 3600, IsActive: true}}, "ns9.host.example. hostmaster.shop.example."},
+		{"inactive nameserver skipped", append([]models.DNSRecord{{Type: "NS", Name: "@", Value: "ns0.host.example", IsActive: false}}, apexNS...), "ns1.host.example."},
+		{"delegation is not the apex", []models.DNSRecord{{Type: "NS", Name: "dev", Value: "ns1.other.example", TTL: 3600, IsActive: true}}, ""},
+		{"no nameservers", []models.DNSRecord{{Type: "MX", Name: "@", Value: "mail.shop.example", Priority: &priority, TTL: 3600, IsActive: true}}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := Render("shop.example", SOA{Serial: 2024010101}, tt.records)
+			if !strings.HasPrefix(out, "$ORIGIN shop.example.\n$TTL 3600\n") {
+				t.Errorf("zone header missing:\n%s", out)
+			}
+			if tt.wantSOA == "" {
+				if strings.Contains(out, "SOA") {
+					t.Errorf("zone has an SOA:\n%s", out)
+				}
+				return
+			}
+			if !strings.Contains(out, tt.wantSOA) {
+				t.Errorf("zone lacks %q:\n%s", tt.wantSOA, out)
+			}
+		})
+	}
+}
+
+func TestRenderRecords(t *testing.T) {
+	priority := 10
+	out := Render("shop.example", SOA{Serial: 1, TTL: 600}, []models.DNSRecord{
+		{Type: "NS", Name: "dev", Value: "ns1.other.example", TTL: 3600, IsActive: true},
+		{Type: "MX", Name: "@", Value: "mail.shop.example", Priority: &priority, TTL: 3600, IsActive: true},
+		{Type: "TXT", Name: "@", Value: `v=spf1 "a" -all`, TTL: 300, IsActive: true},
+		{Type: "A", Name: "old", Value: "192.0.2.9", TTL: 300, IsActive: false},
+	})
+
+	for _, want := range []string{
+		"$TTL 600\n",
+		"dev\t3600\tIN\tNS\tns1.other.example.\n",
+		"@\t3600\tIN\tMX\t10 mail.shop.example.\n",
+		"@\t300\tIN\tTXT\t\"v=spf1 \\\"a\\\" -all\"\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("zone lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "192.0.2.9") {
+		t.Errorf("inactive record rendered:\n%s", out)
+	}
+}
+
+func TestContact(t *testing.T) {
+	tests := []struct{ mailbox, want string }{
+		{"hostmaster@shop.example", "hostmaster.shop.example"},
+		{"dns.admin@shop.example", `dns\.admin.shop.example`},
+		{"hostmaster.shop.example", "hostmaster.shop.example"},
+	}
+	for _, tt := range tests {
+		if got := Contact(tt.mailbox); got != tt.want {
+			t.Errorf("Contact(%q) = %q, want %q", tt.mailbox, got, tt.want)
+		}
+	}
+}
+
+func TestRenderManagedSOA(t *testing.T) {
+	records := []models.DNSRecord{
+		{Type: "SOA", Name: "@", Value: "ns1.host.example hostmaster.host.example", TTL: 600, IsActive: true},
+		{Type: "NS", Name: "@", Value: "ns9.other.example", TTL: 600, IsActive: true},
+	}
+
+	out := Render("shop.example", SOA{Serial: 2024030502, TTL: 600, Refresh: 900, Retry: 300, Expire: 604800, Minimum: 60}, records)
+	if !strings.HasPrefix(out, "$ORIGIN shop.example.\n$TTL 600\n") {
+		t.Errorf("zone header lacks the default TTL:\n%s", out)
+	}
+	want := "@\t600\tIN\tSOA\tns1.host.example. hostmaster.host.example. 2024030502 900 300 604800 60"
+	if !strings.Contains(out, want) {
+		t.Errorf("zone lacks %q:\n%s", want, out)
+	}
+	// The SOA record itself is only rendered as the SOA
+	if strings.Count(out, "SOA") != 1 {
+		t.Errorf("zone has %d SOA lines:\n%s", strings.Count(out, "SOA"), out)
+	}
+}
@@ -0,0 +1,77 @@
+package logger
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Redacted replaces the values of sensitive fields in logs
+const Redacted = "[REDACTED]"
+
+// Redactor decides which header, query and form fields are too sensitive to log. A field is
+// sensitive when its name contains one of the redactor's names, ignoring case, so "password"
+// also covers new_password and X-Admin-Password.
+type Redactor struct {
+	names []string
+}
+
+// NewRedactor returns a redactor for the given field names
+func NewRedactor(names []string) *Redactor {
+	r := &Redactor{}
+	for _, name := range names {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			r.names = append(r.names, name)
+		}
+	}
+	return r
+}
+
+// Sensitive reports whether a field's value must not be logged
+func (r *Redactor) Sensitive(name string) bool {
+	name = strings.ToLower(name)
+	for _, sensitive := range r.names {
+		if strings.Contains(name, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// Query returns a raw query string with the values of sensitive parameters replaced, keeping the
+// parameters in order
+func (r *Redactor) Query(raw string) string {
+	if raw == "" {
+		return raw
+	}
+
+	params := strings.Split(raw, "&")
+	for i, param := range params {
+		key, _, hasValue := strings.Cut(param, "=")
+		name, err := url.QueryUnescape(key)
+		if err != nil {
+			name = key
+		}
+		if hasValue && r.Sensitive(name) {
+			params[i] = key + "=" + Redacted
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// Headers returns the values of the named request headers, with sensitive ones replaced. Headers
+// the request does not carry are left out.
+func (r *Redactor) Headers(header http.Header, names []string) map[string]string {
+	values := make(map[string]string, len(names))
+	for _, name := range names {
+		value := header.Get(name)
+		if value == "" {
+			continue
+		}
+		if r.Sensitive(name) {
+			value = Redacted
+		}
+		values[http.CanonicalHeaderKey(name)] = value
+	}
+	return values
+}
@@ -0,0 +1,66 @@
+package logger
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSensitive(t *testing.T) {
+	r := NewRedactor([]string{"Authorization", " X-API-Key ", "password", ""})
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"authorization", true},
+		{"Proxy-Authorization", true},
+		{"x-api-key", true},
+		{"new_password", true},
+		{"X-Admin-Password", true},
+		{"user", false},
+		{"Accept", false},
+	}
+	for _, tt := range tests {
+		if got := r.Sensitive(tt.name); got != tt.want {
+			t.Errorf("Sensitive(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRedactQuery(t *testing.T) {
+	r := NewRedactor([]string{"password", "token"})
+
+	tests := []struct{ raw, want string }{
+		{"", ""},
+		{"page=2&sort=name", "page=2&sort=name"},
+		{"user=alice&password=hunter2&page=1", "user=alice&password=" + Redacted + "&page=1"},
+		{"reset_token=abc&token=def", "reset_token=" + Redacted + "&token=" + Redacted},
+		{"pass%77ord=x", "pass%77ord=" + Redacted},
+		{"password", "password"},
+		{"%zz=1&token=a", "%zz=1&token=" + Redacted},
+	}
+	for _, tt := range tests {
+		if got := r.Query(tt.raw); got != tt.want {
+			t.Errorf("Query(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestRedactHeaders(t *testing.T) {
+	r := NewRedactor([]string{"Authorization", "X-API-Key"})
+	header := http.Header{}
+	header.Set("Authorization", "Bearer secret")
+	header.Set("X-Api-Key", "key")
+	header.Set("User-Agent", "curl/8")
+
+	got := r.Headers(header, []string{"authorization", "x-api-key", "user-agent", "X-Forwarded-For"})
+	want := map[string]string{"Authorization": Redacted, "X-Api-Key": Redacted, "User-Agent": "curl/8"}
+	if len(got) != len(want) {
+		t.Fatalf("Headers() = %v, want %v", got, want)
+	}
+	for name, value := range want {
+		if got[name] != value {
+			t.Errorf("header %s = %q, want %q", name, got[name], value)
+		}
+	}
+}